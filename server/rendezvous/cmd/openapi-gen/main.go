@@ -0,0 +1,24 @@
+// Command openapi-gen writes the OpenAPI document for the API routes. It runs
+// from go generate in internal/api, which embeds the output.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"rendezvous/internal/api"
+)
+
+func main() {
+	output := flag.String("o", "openapi.json", "Output file")
+	flag.Parse()
+
+	spec, err := api.OpenAPISpec()
+	if err != nil {
+		log.Fatalf("OpenAPI generation failed: %v", err)
+	}
+	if err := os.WriteFile(*output, spec, 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *output, err)
+	}
+}
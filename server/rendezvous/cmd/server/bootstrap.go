@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"rendezvous/internal/attestation"
+	"rendezvous/internal/cache"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+	"rendezvous/internal/geo"
+	"rendezvous/internal/metrics"
+	"rendezvous/internal/privacy"
+	"rendezvous/internal/store"
+)
+
+// app holds the dependencies shared by the server and the --selftest command.
+type app struct {
+	database           *db.Database
+	redis              *redis.Client // Nil when REDIS_URL is unset and the store backend does not need it
+	stores             store.Stores
+	storePruner        *store.Postgres // Nil unless the store backend is postgres
+	policyCache        *cache.PolicyCache
+	configService      *config.ConfigService
+	attestationService *attestation.AttestationService
+	geoBalancer        *geo.GeoBalancer
+	gatewaySecrets     *gateway.SecretStore // Nil without a data key
+}
+
+// bootstrap checks the production guards, applies migrations and initializes
+// every dependency the server needs. Call Close on the result.
+func bootstrap(ctx context.Context) (*app, error) {
+	if err := checkProductionGuards(); err != nil {
+		return nil, err
+	}
+
+	databaseURL, err := databaseURLFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	persistence, err := loadPersistencePolicy()
+	if err != nil {
+		return nil, err
+	}
+	storeConfig, err := store.LoadConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("Running database migrations...")
+	if err := db.RunMigrations(databaseURL); err != nil {
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+	log.Println("Database migrations completed")
+
+	a := &app{}
+	if a.database, err = db.New(ctx, databaseURL); err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	if redisRequired(storeConfig) {
+		if a.redis, err = newRedisClient(); err != nil {
+			a.Close()
+			return nil, err
+		}
+	}
+	a.stores, a.storePruner = newStores(storeConfig, a.redis, a.database)
+	a.policyCache = newPolicyCache(a.redis)
+	a.database.SetPolicyCache(a.policyCache)
+	a.database.SetPersistencePolicy(persistence)
+
+	if err := a.initServices(ctx); err != nil {
+		a.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// initServices creates the config, attestation and geo services and the
+// gateway secret store on top of the database, and loads any rotated config
+// signing key.
+func (a *app) initServices(ctx context.Context) error {
+	configService, err := config.NewConfigService(a.database)
+	if err != nil {
+		return fmt.Errorf("failed to initialize config service: %w", err)
+	}
+	a.configService = configService
+	if err := configService.RefreshSigningKeys(ctx); err != nil {
+		return fmt.Errorf("failed to load config signing keys: %w", err)
+	}
+	if err := configService.RefreshKillSwitches(ctx); err != nil {
+		return fmt.Errorf("failed to load kill switches: %w", err)
+	}
+	if a.gatewaySecrets, err = gateway.NewSecretStoreFromEnv(a.database); err != nil {
+		return fmt.Errorf("failed to initialize gateway secrets: %w", err)
+	}
+	configService.SetGatewaySecrets(a.gatewaySecrets)
+	a.attestationService = attestation.NewAttestationService(a.database)
+	a.attestationService.SetChallenges(a.stores.Challenges)
+	a.attestationService.SetChallengeRates(a.stores.RateLimits)
+	a.attestationService.SetVerificationRates(a.stores.RateLimits)
+	a.geoBalancer = geo.NewBalancer(a.database)
+	return nil
+}
+
+// Close releases the connections opened by bootstrap.
+func (a *app) Close() {
+	if a.policyCache != nil {
+		a.policyCache.Close()
+	}
+	if a.redis != nil {
+		a.redis.Close()
+	}
+	if a.database != nil {
+		a.database.Close()
+	}
+}
+
+// checkProductionGuards fails fast on settings that must never reach
+// production: attestation bypass and ephemeral or missing signing keys.
+func checkProductionGuards() error {
+	if err := checkProductionAttestationGuard(); err != nil {
+		return err
+	}
+	if strings.ToLower(os.Getenv("GO_ENV")) != "production" {
+		return nil
+	}
+	if os.Getenv("LUMENLINK_ALLOW_EPHEMERAL_SIGNING_KEY") == "true" {
+		return errors.New("LUMENLINK_ALLOW_EPHEMERAL_SIGNING_KEY must be false in production")
+	}
+	// A remote signer holds the private key itself
+	if os.Getenv("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY") == "" && os.Getenv("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY_FILE") == "" &&
+		os.Getenv("LUMENLINK_CONFIG_SIGNER") != config.SignerRemote {
+		return errors.New("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY or LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY_FILE is required in production")
+	}
+	return nil
+}
+
+// loadPersistencePolicy reads the data minimization mode and declares it in
+// the log and in lumenlink_persistence_mode.
+func loadPersistencePolicy() (*privacy.Policy, error) {
+	policy, err := privacy.LoadPolicyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	for _, mode := range []string{privacy.ModeStandard, privacy.ModeMinimized} {
+		metrics.PersistenceMode.WithLabelValues(mode).Set(0)
+	}
+	metrics.PersistenceMode.WithLabelValues(policy.Mode()).Set(1)
+	if policy.Minimized() {
+		log.Println("Data minimization is on: no attestation records, discovery client addresses (only keyed network buckets), free-form client error context or device tracking will be persisted")
+	} else {
+		log.Printf("Persistence mode: %s", policy.Mode())
+	}
+	return policy, nil
+}
+
+func databaseURLFromEnv() (string, error) {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		return "", errors.New("DATABASE_URL environment variable not set")
+	}
+	return databaseURL, nil
+}
+
+// newRedisClient creates a client from REDIS_URL, with REDIS_PASSWORD taking
+// precedence over any password in the URL. It does not connect.
+func newRedisClient() (*redis.Client, error) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		return nil, errors.New("REDIS_URL environment variable not set")
+	}
+	redisOptions, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	if password := os.Getenv("REDIS_PASSWORD"); password != "" {
+		redisOptions.Password = password
+	}
+	return redis.NewClient(redisOptions), nil
+}
+
+// redisRequired reports whether the server connects to Redis: always for the
+// redis store backend, otherwise only when REDIS_URL is set.
+func redisRequired(config store.Config) bool {
+	return config.Backend == store.BackendRedis || os.Getenv("REDIS_URL") != ""
+}
+
+// newStores creates the configured store backend and logs what it cannot do
+// for this deployment. The Postgres backend is also returned so its pruning
+// job can be started.
+func newStores(config store.Config, redisClient *redis.Client, database *db.Database) (store.Stores, *store.Postgres) {
+	log.Printf("Store backend: %s", config.Backend)
+	for _, warning := range config.Warnings() {
+		log.Printf("Store warning: %s", warning)
+	}
+	switch config.Backend {
+	case store.BackendMemory:
+		return store.NewMemory().Stores(), nil
+	case store.BackendPostgres:
+		postgres := store.NewPostgres(database)
+		return postgres.Stores(), postgres
+	default:
+		return store.NewRedis(redisClient).Stores(), nil
+	}
+}
+
+// newPolicyCache caches policy tables per replica; admin mutations invalidate
+// every replica over Redis. Without Redis, changes propagate within the TTL.
+func newPolicyCache(redisClient *redis.Client) *cache.PolicyCache {
+	policyCacheTTL := envDuration("LUMENLINK_POLICY_CACHE_TTL", 30*time.Second)
+	if redisClient == nil {
+		log.Println("Redis not configured: policy changes propagate within LUMENLINK_POLICY_CACHE_TTL")
+		policyCache, _ := cache.NewPolicyCache(policyCacheTTL, nil)
+		return policyCache
+	}
+	policyCache, err := cache.NewPolicyCache(policyCacheTTL, cache.NewRedisInvalidator(redisClient))
+	if err != nil {
+		log.Printf("Policy cache invalidation unavailable, relying on TTL: %v", err)
+		policyCache, _ = cache.NewPolicyCache(policyCacheTTL, nil)
+	}
+	return policyCache
+}
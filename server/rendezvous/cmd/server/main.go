@@ -2,115 +2,148 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"golang.org/x/time/rate"
+	"github.com/prometheus/client_golang/prometheus"
+	"rendezvous/internal/admission"
 	"rendezvous/internal/api"
 	"rendezvous/internal/attestation"
+	"rendezvous/internal/canary"
 	"rendezvous/internal/config"
-	"rendezvous/internal/db"
+	"rendezvous/internal/federation"
+	"rendezvous/internal/gateway"
 	"rendezvous/internal/geo"
+	"rendezvous/internal/issuance"
+	"rendezvous/internal/lifecycle"
 	_ "rendezvous/internal/metrics"
+	"rendezvous/internal/notify"
+	"rendezvous/internal/server"
+	"rendezvous/internal/trust"
 )
 
 func main() {
+	selftest := flag.Bool("selftest", false, "Validate configuration, database, Redis, signing keys and attestation, then exit without serving traffic")
+	canaryMode := flag.Bool("canary", false, "Compare packs against LUMENLINK_CANARY_PEER_URL at startup and report unhealthy until they match")
+	flag.Parse()
+
 	// Production: disable Gin debug mode (prevents stack trace leaks)
 	if strings.ToLower(os.Getenv("GO_ENV")) == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	// Production guard: fail fast if attestation bypass is enabled in production
-	if err := checkProductionAttestationGuard(); err != nil {
-		log.Fatal(err)
-	}
-
-	// Initialize database
-	databaseURL := os.Getenv("DATABASE_URL")
-	if databaseURL == "" {
-		log.Fatal("DATABASE_URL environment variable not set")
-	}
-
-	// Run database migrations
-	log.Println("Running database migrations...")
-	if err := db.RunMigrations(databaseURL); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+	if *selftest {
+		os.Exit(runSelftest(context.Background(), os.Stdout))
 	}
-	log.Println("Database migrations completed")
 
-	// Initialize database connection
-	ctx := context.Background()
-	database, err := db.New(ctx, databaseURL)
+	// Production guards, migrations, database, Redis and services
+	a, err := bootstrap(context.Background())
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
-	}
-	defer database.Close()
-
-	// Initialize Redis
-	redisURL := os.Getenv("REDIS_URL")
-	if redisURL == "" {
-		log.Fatal("REDIS_URL environment variable not set")
-	}
-
-	// Production: fail fast if config signing key is missing
-	if strings.ToLower(os.Getenv("GO_ENV")) == "production" {
-		if os.Getenv("LUMENLINK_ALLOW_EPHEMERAL_SIGNING_KEY") == "true" {
-			log.Fatal("LUMENLINK_ALLOW_EPHEMERAL_SIGNING_KEY must be false in production")
-		}
-		if os.Getenv("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY") == "" {
-			log.Fatal("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY is required in production")
-		}
-	}
-
-	// Initialize services
-	configService, err := config.NewConfigService(database)
-	if err != nil {
-		log.Fatalf("Failed to initialize config service: %v", err)
+		log.Fatal(err)
 	}
-	attestationService := attestation.NewAttestationService(database)
-	geoBalancer := geo.NewBalancer(database)
+	defer a.Close()
 
 	// Initialize API handler
-	handler := api.NewHandler(configService, attestationService, geoBalancer, database)
-
-	// Setup router
-	router := gin.Default()
-
-	// Security headers (all responses)
-	router.Use(securityHeaders())
-
-	// CORS: strict in production, permissive in dev
-	router.Use(corsMiddleware())
-
-	// Health check (no rate limit)
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
+	handler := api.NewHandler(a.configService, a.attestationService, a.geoBalancer, a.database)
+	drainGrace := envDuration("LUMENLINK_DRAIN_GRACE", 0)
+	drain := lifecycle.NewDrain(lifecycle.DrainConfig{
+		Grace:        drainGrace,
+		ReconnectMin: envDuration("LUMENLINK_DRAIN_RECONNECT_MIN", 5*time.Second),
+		ReconnectMax: envDuration("LUMENLINK_DRAIN_RECONNECT_MAX", time.Minute),
+
+		HeartbeatInterval: time.Duration(gateway.LoadHeartbeatScheduleFromEnv().IntervalSeconds) * time.Second,
+	})
+	if drainGrace > 0 && drain.Grace() != drainGrace {
+		log.Printf("LUMENLINK_DRAIN_GRACE=%s does not outlast a gateway heartbeat interval; draining for %s", drainGrace, drain.Grace())
+	}
+	handler.SetDrain(drain)
+	admissionConfig := admission.LoadConfigFromEnv()
+	if admissionConfig.NewClientsPerMinute > 0 && len(admissionConfig.TokenSecret) == 0 {
+		log.Println("LUMENLINK_ADMISSION_TOKEN_SECRET is not set: waiting-room tokens are only honoured by the replica that issued them")
+	}
+	if os.Getenv("LUMENLINK_ATTESTATION_SESSION_SECRET") == "" {
+		log.Println("LUMENLINK_ATTESTATION_SESSION_SECRET is not set: attestation sessions are only honoured by the replica that issued them")
+	}
+	handler.SetAdmission(admission.NewController(a.stores.Assignments, a.stores.Reservations, admissionConfig))
+	handler.SetTrust(trust.NewTracker(a.database, trust.LoadPolicyFromEnv()))
+	federationConfig := federation.LoadConfigFromEnv()
+	handler.SetFederation(federationConfig)
+	if federationConfig.Import {
+		a.configService.EnableFederatedGateways(federationConfig.MaxAge)
+	}
+
+	// Operator notifications; email is only sent when SMTP is configured
+	var email notify.EmailSender
+	if sender := notify.NewSMTPSenderFromEnv(); sender != nil {
+		email = sender
+	}
+	operatorEvents := notify.NewOperatorDispatcher(a.database, email, notify.LoadOperatorDispatcherConfigFromEnv())
+	handler.SetOperatorEvents(operatorEvents)
+	handler.SetGatewaySecrets(a.gatewaySecrets)
+	issuanceCounter := gateway.NewIssuanceCounter(a.database)
+	handler.SetIssuance(issuanceCounter)
+	issuanceLog, err := issuance.NewLogFromEnv(a.database)
+	if err != nil {
+		log.Fatalf("Failed to initialize issuance log: %v", err)
+	}
+	handler.SetIssuanceLog(issuanceLog)
+	endpointAllocations := config.NewEndpointAllocationCounter(a.database)
+	handler.SetEndpointAllocations(endpointAllocations)
+	handler.SetStatusPage(api.StatusPage{
+		Enabled:     envBool("LUMENLINK_STATUS_PAGE_ENABLED", true),
+		Maintenance: strings.TrimSpace(os.Getenv("LUMENLINK_MAINTENANCE_MESSAGE")),
 	})
 
-	// Prometheus metrics
-	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router := server.NewRouter(handler, a.stores.RateLimits)
+	prometheus.MustRegister(geo.NewRolloutCollector(a.database))
 
-	// API routes - using /api/v1 to match frontend expectations (rate limited)
-	apiLimiter := newRateLimiter(100, 10) // 100 req/min burst 10
-	apiGroup := router.Group("/api/v1")
-	apiGroup.Use(apiLimiter.middleware())
-	{
-		apiGroup.POST("/config", handler.GetConfig)
-		apiGroup.GET("/attest/challenge", handler.GetAttestationChallenge)
-		apiGroup.POST("/attest", handler.VerifyAttestation)
-		apiGroup.POST("/gateway/status", handler.HandleGatewayStatus)
-		apiGroup.POST("/discovery/log", handler.HandleDiscoveryLog)
-		apiGroup.GET("/gateways", handler.GetGateways) // Community page endpoint
+	// Background jobs stop when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if *canaryMode {
+		canaryConfig := canary.LoadConfigFromEnv()
+		if canaryConfig.PeerURL == "" {
+			log.Fatal("--canary requires LUMENLINK_CANARY_PEER_URL")
+		}
+		check := canary.NewCheck(canary.PreviewerFunc(handler.PreviewProfile), canary.NewPeerPreviewer(canaryConfig), canary.DefaultProfiles, canaryConfig)
+		handler.SetCanary(check)
+		go check.Start(jobsCtx)
+	}
+	go a.configService.StartSigningKeyRefresh(jobsCtx, envDuration("LUMENLINK_CONFIG_SIGNING_KEY_REFRESH_INTERVAL", time.Minute))
+	go handler.StartCountryRegionRefresh(jobsCtx, envDuration("LUMENLINK_COUNTRY_REGION_REFRESH_INTERVAL", 5*time.Minute))
+	go gateway.NewAuditor(a.database).Start(jobsCtx, envDuration("LUMENLINK_GATEWAY_AUDIT_INTERVAL", time.Hour))
+	scorer := gateway.NewSuspicionScorer(a.database)
+	scorer.SetEvents(operatorEvents)
+	go scorer.Start(jobsCtx, envDuration("LUMENLINK_SUSPICION_INTERVAL", 24*time.Hour))
+	reaper := gateway.NewReaper(a.database)
+	reaper.SetEvents(operatorEvents)
+	go reaper.Start(jobsCtx, envDuration("LUMENLINK_GATEWAY_REAPER_INTERVAL", time.Minute))
+	go operatorEvents.Run(jobsCtx)
+	go gateway.NewCountryRollup(a.database).Start(jobsCtx, envDuration("LUMENLINK_COUNTRY_ROLLUP_INTERVAL", 24*time.Hour))
+	go issuanceCounter.Start(jobsCtx, envDuration("LUMENLINK_ISSUANCE_FLUSH_INTERVAL", time.Minute))
+	if issuanceLog != nil {
+		go issuanceLog.Start(jobsCtx, envDuration("LUMENLINK_ISSUANCE_LOG_FLUSH_INTERVAL", time.Minute))
+	}
+	go endpointAllocations.Start(jobsCtx, envDuration("LUMENLINK_ENDPOINT_ALLOCATION_FLUSH_INTERVAL", time.Minute))
+	go gateway.NewUserCountReconciler(a.database).Start(jobsCtx, envDuration("LUMENLINK_RECONCILIATION_INTERVAL", time.Hour))
+	go attestation.NewCleanup(a.database).Start(jobsCtx, envDuration("LUMENLINK_ATTESTATION_CLEANUP_INTERVAL", time.Hour))
+	go gateway.NewDiscoveryEventCleanup(a.database).Start(jobsCtx, envDuration("LUMENLINK_DISCOVERY_EVENT_CLEANUP_INTERVAL", time.Hour))
+	if a.attestationService.ReceiptRefreshConfigured() {
+		go attestation.NewReceiptRefresher(a.attestationService).Start(jobsCtx, envDuration("LUMENLINK_APP_ATTEST_RECEIPT_INTERVAL", time.Hour))
+	}
+	if a.storePruner != nil {
+		go a.storePruner.Start(jobsCtx, envDuration("LUMENLINK_STORE_PRUNE_INTERVAL", 5*time.Minute))
+	}
+	if federationConfig.Import {
+		go federation.NewPoller(a.database, a.configService, federationConfig.MaxAge).Start(jobsCtx, federationConfig.PollInterval)
 	}
 
 	// Start server
@@ -140,19 +173,35 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopJobs()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// A second signal skips the rest of the drain grace period
+	graceCtx, stopGrace := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopGrace()
 
-	if err := srv.Shutdown(ctx); err != nil {
+	if err := drainAndShutdown(graceCtx, srv, drain); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
 
 	log.Println("Server exited")
 }
 
+// drainAndShutdown tells gateway agents to back off, keeps serving for the
+// drain grace period so their next heartbeat carries the directive, then
+// closes the listeners and waits up to 5s for in-flight requests.
+func drainAndShutdown(graceCtx context.Context, srv *http.Server, drain *lifecycle.Drain) error {
+	log.Println("Draining gateway agents...")
+	drain.Begin()
+	drain.Wait(graceCtx)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
 // checkProductionAttestationGuard returns an error if attestation bypass is enabled in production.
-// This prevents accidental deployment with LUMENLINK_ALLOW_ATTESTATION_BYPASS=true when GO_ENV=production.
+// This prevents accidental deployment with LUMENLINK_ALLOW_ATTESTATION_BYPASS=true, or with devices
+// listed in LUMENLINK_ATTESTATION_BYPASS_DEVICE_IDS, when GO_ENV=production.
 func checkProductionAttestationGuard() error {
 	if strings.ToLower(os.Getenv("GO_ENV")) != "production" {
 		return nil
@@ -161,91 +210,29 @@ func checkProductionAttestationGuard() error {
 	if v == "true" || v == "1" || v == "yes" {
 		return fmt.Errorf("LUMENLINK_ALLOW_ATTESTATION_BYPASS must not be enabled in production (GO_ENV=production). Set it to false or remove it")
 	}
-	return nil
-}
-
-// securityHeaders adds security headers to all responses.
-func securityHeaders() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("X-Content-Type-Options", "nosniff")
-		c.Header("X-Frame-Options", "DENY")
-		c.Header("X-XSS-Protection", "1; mode=block")
-		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
-		c.Next()
+	if len(attestation.LoadBypassDeviceIDsFromEnv()) > 0 {
+		return fmt.Errorf("LUMENLINK_ATTESTATION_BYPASS_DEVICE_IDS must be empty in production (GO_ENV=production). Remove it")
 	}
+	return nil
 }
 
-// corsMiddleware returns CORS config: strict in production, permissive in dev.
-func corsMiddleware() gin.HandlerFunc {
-	origins := os.Getenv("CORS_ALLOWED_ORIGINS")
-	if origins == "" {
-		if strings.ToLower(os.Getenv("GO_ENV")) == "production" {
-			// Production default: only lumenlink.org
-			origins = "https://lumenlink.org,https://www.lumenlink.org"
-		} else {
-			// Dev default: allow localhost
-			origins = "http://localhost:3000,http://127.0.0.1:3000,http://localhost:3001"
+// envDuration parses a Go duration (e.g. "30m") from the environment.
+func envDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
 		}
 	}
-	allowList := strings.Split(origins, ",")
-	for i := range allowList {
-		allowList[i] = strings.TrimSpace(allowList[i])
-	}
-	cfg := cors.Config{
-		AllowOrigins:     allowList,
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}
-	return cors.New(cfg)
-}
-
-// rateLimiter provides per-client rate limiting.
-type rateLimiter struct {
-	limiters map[string]*rate.Limiter
-	mu       sync.RWMutex
-	r        rate.Limit
-	b        int
+	return defaultValue
 }
 
-func newRateLimiter(perMin int, burst int) *rateLimiter {
-	return &rateLimiter{
-		limiters: make(map[string]*rate.Limiter),
-		r:        rate.Limit(float64(perMin) / 60),
-		b:        burst,
-	}
-}
-
-func (rl *rateLimiter) getLimiter(ip string) *rate.Limiter {
-	rl.mu.RLock()
-	l, ok := rl.limiters[ip]
-	rl.mu.RUnlock()
-	if ok {
-		return l
-	}
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-	l, ok = rl.limiters[ip]
-	if !ok {
-		l = rate.NewLimiter(rl.r, rl.b)
-		rl.limiters[ip] = l
-	}
-	return l
-}
-
-func (rl *rateLimiter) middleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		if ip == "" {
-			ip = "unknown"
-		}
-		limiter := rl.getLimiter(ip)
-		if !limiter.Allow() {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate_limit_exceeded"})
-			return
-		}
-		c.Next()
+// envBool parses a boolean (true/false, 1/0, yes/no) from the environment.
+func envBool(key string, defaultValue bool) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(key))) {
+	case "true", "1", "yes":
+		return true
+	case "false", "0", "no":
+		return false
 	}
+	return defaultValue
 }
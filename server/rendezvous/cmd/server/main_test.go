@@ -1,8 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/api"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+	"rendezvous/internal/lifecycle"
 )
 
 func TestCheckProductionAttestationGuard(t *testing.T) {
@@ -10,24 +26,30 @@ func TestCheckProductionAttestationGuard(t *testing.T) {
 		name     string
 		goEnv    string
 		bypass   string
+		devices  string
 		wantErr  bool
 	}{
-		{"dev with bypass ok", "development", "true", false},
-		{"dev empty bypass ok", "development", "", false},
-		{"empty env with bypass ok", "", "true", false},
-		{"production with bypass fails", "production", "true", true},
-		{"production with bypass 1 fails", "production", "1", true},
-		{"production with bypass yes fails", "production", "yes", true},
-		{"production with bypass false ok", "production", "false", false},
-		{"production with bypass empty ok", "production", "", false},
+		{"dev with bypass ok", "development", "true", "", false},
+		{"dev empty bypass ok", "development", "", "", false},
+		{"empty env with bypass ok", "", "true", "", false},
+		{"production with bypass fails", "production", "true", "", true},
+		{"production with bypass 1 fails", "production", "1", "", true},
+		{"production with bypass yes fails", "production", "yes", "", true},
+		{"production with bypass false ok", "production", "false", "", false},
+		{"production with bypass empty ok", "production", "", "", false},
+		{"dev with bypass devices ok", "development", "", "qa-pixel-7", false},
+		{"production with bypass devices fails", "production", "", "qa-pixel-7,qa-iphone-15", true},
+		{"production with blank bypass devices ok", "production", "", " , ", false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			os.Setenv("GO_ENV", tt.goEnv)
 			os.Setenv("LUMENLINK_ALLOW_ATTESTATION_BYPASS", tt.bypass)
+			os.Setenv("LUMENLINK_ATTESTATION_BYPASS_DEVICE_IDS", tt.devices)
 			defer func() {
 				os.Unsetenv("GO_ENV")
 				os.Unsetenv("LUMENLINK_ALLOW_ATTESTATION_BYPASS")
+				os.Unsetenv("LUMENLINK_ATTESTATION_BYPASS_DEVICE_IDS")
 			}()
 			err := checkProductionAttestationGuard()
 			if (err != nil) != tt.wantErr {
@@ -36,3 +58,110 @@ func TestCheckProductionAttestationGuard(t *testing.T) {
 		})
 	}
 }
+
+func TestDrainAndShutdown_AgentsReceiveDirectiveBeforeClose(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	drain := lifecycle.NewDrain(lifecycle.DrainConfig{
+		Grace:        300 * time.Millisecond,
+		ReconnectMin: 5 * time.Second,
+		ReconnectMax: 10 * time.Second,
+	})
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	handler := api.NewHandler(nil, nil, nil, db.NewFromPool(sqlDB))
+	handler.SetDrain(drain)
+
+	// Every heartbeat looks up the gateway's key and records the status;
+	// there are more of these than the test sends
+	const gatewayID = "6f1c2d3e-4a5b-4c6d-8e9f-0a1b2c3d4e5f"
+	publicKey, privateKey, _ := ed25519.GenerateKey(nil)
+	for i := 0; i < 100; i++ {
+		now := time.Now()
+		mock.ExpectQuery(`WHERE id = \$1`).WillReturnRows(sqlmock.NewRows([]string{
+			"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+			"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+			"operator_id", "approval_status", "asn", "created_at", "last_seen", "updated_at",
+		}).AddRow(
+			gatewayID, []byte(publicKey), "192.0.2.1", 443, "{masque}", "{}",
+			"me-south-1", nil, 0, nil, "active", false,
+			"op-1", "approved", nil, now, nil, now,
+		))
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE gateways SET status`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO operator_metrics`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	router := gin.New()
+	router.POST("/api/v1/gateway/status", handler.HandleGatewayStatus)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: router}
+	go srv.Serve(listener)
+	url := "http://" + listener.Addr().String() + "/api/v1/gateway/status"
+
+	heartbeat := func() (*api.GatewayStatusResponse, error) {
+		body := []byte(`{"gateway_id":"` + gatewayID + `","status":"active","users_connected":1,"uptime_percent":100}`)
+		timestamp := time.Now().Unix()
+		signature := ed25519.Sign(privateKey, gateway.RequestBodyMessage(gatewayID, "/api/v1/gateway/status", timestamp, body))
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Gateway-Timestamp", strconv.FormatInt(timestamp, 10))
+		req.Header.Set("X-Gateway-Signature", base64.StdEncoding.EncodeToString(signature))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		var status api.GatewayStatusResponse
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			return nil, err
+		}
+		return &status, nil
+	}
+
+	before, err := heartbeat()
+	if err != nil {
+		t.Fatalf("heartbeat before drain: %v", err)
+	}
+	if before.Directive != nil {
+		t.Fatalf("directive before drain: %+v", before.Directive)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- drainAndShutdown(context.Background(), srv, drain) }()
+
+	// Heartbeats during the grace period are answered with the directive
+	deadline := time.Now().Add(200 * time.Millisecond)
+	var during *api.GatewayStatusResponse
+	for during == nil || during.Directive == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("no drain directive received during the grace period")
+		}
+		if during, err = heartbeat(); err != nil {
+			t.Fatalf("heartbeat during drain: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if during.Directive.Type != api.DirectiveDrain {
+		t.Errorf("directive type: got %q, want %q", during.Directive.Type, api.DirectiveDrain)
+	}
+	if ms := during.Directive.ReconnectAfterMs; ms < 5000 || ms > 10000 {
+		t.Errorf("reconnect_after_ms: got %d, want within [5000, 10000]", ms)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("drainAndShutdown: %v", err)
+	}
+	if _, err := heartbeat(); err == nil {
+		t.Error("server still serving after shutdown")
+	}
+}
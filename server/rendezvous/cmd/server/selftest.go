@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"rendezvous/internal/attestation"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+	"rendezvous/internal/geo"
+	"rendezvous/internal/store"
+)
+
+// Check statuses reported by --selftest
+const (
+	checkPassed  = "pass"
+	checkFailed  = "fail"
+	checkSkipped = "skip"
+)
+
+// selftestCheckTimeout bounds each check; db.New alone retries for ~30s.
+const selftestCheckTimeout = time.Minute
+
+// selftestCheck is one named step of the self-test. run returns a short
+// detail for the report, or an error; a skipError marks the check skipped.
+type selftestCheck struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// skipError marks a check that could not run, e.g. because a check it
+// depends on failed. Skipped checks do not fail the self-test by themselves.
+type skipError struct {
+	reason string
+}
+
+func (e *skipError) Error() string {
+	return e.reason
+}
+
+func skipCheck(format string, args ...interface{}) error {
+	return &skipError{reason: fmt.Sprintf(format, args...)}
+}
+
+// checkResult is the outcome of one check in the report
+type checkResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// selftestReport is written to stdout as JSON by --selftest
+type selftestReport struct {
+	OK       bool          `json:"ok"`
+	Failures int           `json:"failures"`
+	Checks   []checkResult `json:"checks"`
+}
+
+// runSelftest validates the full startup path against the real environment
+// without serving traffic, writes the report to w and returns the exit code.
+func runSelftest(ctx context.Context, w io.Writer) int {
+	a := &app{}
+	defer a.Close()
+	return reportSelftest(ctx, w, selftestChecks(a))
+}
+
+// reportSelftest runs checks, writes the report to w and returns 1 if any
+// check failed.
+func reportSelftest(ctx context.Context, w io.Writer, checks []selftestCheck) int {
+	report := runChecks(ctx, checks)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write selftest report: %v\n", err)
+		return 1
+	}
+	if !report.OK {
+		return 1
+	}
+	return 0
+}
+
+// runChecks runs every check in order, even after failures, so that one run
+// reports every problem.
+func runChecks(ctx context.Context, checks []selftestCheck) selftestReport {
+	report := selftestReport{OK: true, Checks: make([]checkResult, 0, len(checks))}
+	for _, check := range checks {
+		result := runCheck(ctx, check)
+		if result.Status == checkFailed {
+			report.OK = false
+			report.Failures++
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+func runCheck(ctx context.Context, check selftestCheck) (result checkResult) {
+	ctx, cancel := context.WithTimeout(ctx, selftestCheckTimeout)
+	defer cancel()
+
+	result.Name = check.name
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			result.Status = checkFailed
+			result.Error = fmt.Sprintf("panic: %v", r)
+		}
+		result.DurationMs = time.Since(start).Milliseconds()
+	}()
+
+	detail, err := check.run(ctx)
+	result.Detail = detail
+	var skipped *skipError
+	switch {
+	case errors.As(err, &skipped):
+		result.Status = checkSkipped
+		result.Detail = skipped.reason
+	case err != nil:
+		result.Status = checkFailed
+		result.Error = err.Error()
+	default:
+		result.Status = checkPassed
+	}
+	return result
+}
+
+// selftestChecks builds the checks against the real environment. Checks fill
+// in a as they go, so later checks skip when an earlier dependency failed.
+func selftestChecks(a *app) []selftestCheck {
+	checks := []selftestCheck{
+		{name: "production_guards", run: func(context.Context) (string, error) {
+			return "", checkProductionGuards()
+		}},
+		{name: "migrations", run: func(context.Context) (string, error) {
+			databaseURL, err := databaseURLFromEnv()
+			if err != nil {
+				return "", err
+			}
+			status, err := db.GetMigrationStatus(databaseURL)
+			if err != nil {
+				return "", err
+			}
+			return describeMigrationStatus(status)
+		}},
+		{name: "database", run: func(ctx context.Context) (string, error) {
+			databaseURL, err := databaseURLFromEnv()
+			if err != nil {
+				return "", err
+			}
+			if a.database, err = db.New(ctx, databaseURL); err != nil {
+				return "", err
+			}
+			return "connected", nil
+		}},
+		{name: "store", run: func(context.Context) (string, error) {
+			config, err := store.LoadConfigFromEnv()
+			if err != nil {
+				return "", err
+			}
+			detail := config.Backend
+			if warnings := config.Warnings(); len(warnings) > 0 {
+				detail += "; " + strings.Join(warnings, "; ")
+			}
+			return detail, nil
+		}},
+		{name: "redis", run: func(ctx context.Context) (string, error) {
+			if config, err := store.LoadConfigFromEnv(); err == nil && !redisRequired(config) {
+				return "", skipCheck("REDIS_URL not set; the %s store backend does not need Redis", config.Backend)
+			}
+			client, err := newRedisClient()
+			if err != nil {
+				return "", err
+			}
+			a.redis = client
+			if err := client.Ping(ctx).Err(); err != nil {
+				return "", fmt.Errorf("failed to ping redis: %w", err)
+			}
+			return "connected", nil
+		}},
+		{name: "signing_keys", run: func(ctx context.Context) (string, error) {
+			if err := a.initServices(ctx); err != nil {
+				return "", err
+			}
+			return "", nil
+		}},
+	}
+
+	for _, region := range selftestRegions() {
+		region := region
+		checks = append(checks, selftestCheck{name: "config_pack:" + region, run: func(ctx context.Context) (string, error) {
+			if a.database == nil {
+				return "", skipCheck("database unavailable")
+			}
+			if a.configService == nil {
+				return "", skipCheck("signing keys unavailable")
+			}
+			return checkConfigPack(ctx, a.configService, region)
+		}})
+	}
+
+	checks = append(checks, selftestCheck{name: "play_integrity", run: func(ctx context.Context) (string, error) {
+		return checkPlayIntegrity(ctx, attestation.NewAttestationService(a.database))
+	}})
+	return checks
+}
+
+// describeMigrationStatus fails when the schema is dirty or newer than this
+// binary's migrations. Pending migrations pass: the server applies them.
+func describeMigrationStatus(status db.MigrationStatus) (string, error) {
+	if status.Dirty {
+		return "", fmt.Errorf("database schema version %d is dirty; manual intervention required", status.Current)
+	}
+	if status.Current > status.Latest {
+		return "", fmt.Errorf("database schema version %d is newer than the latest embedded migration %d", status.Current, status.Latest)
+	}
+	return fmt.Sprintf("version %d, %d pending (latest %d)", status.Current, status.Pending(), status.Latest), nil
+}
+
+// selftestRegions returns LUMENLINK_SELFTEST_REGIONS (comma separated), or
+// every known region.
+func selftestRegions() []string {
+	value := strings.TrimSpace(os.Getenv("LUMENLINK_SELFTEST_REGIONS"))
+	if value == "" {
+		return geo.Regions()
+	}
+	var regions []string
+	for _, region := range strings.Split(value, ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// checkConfigPack generates a pack for region from real gateway data, as an
+// attested client would receive it, and verifies its signature.
+func checkConfigPack(ctx context.Context, configService *config.ConfigService, region string) (string, error) {
+	attested := &config.AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	pack, err := configService.GenerateConfigPack(ctx, "selftest", region, "", "", config.ClientInfo{}, "", attested, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate config pack: %w", err)
+	}
+	if !configService.VerifyConfigPack(pack) {
+		return "", errors.New("config pack signature does not verify")
+	}
+	if len(pack.Gateways) == 0 {
+		return "", errors.New("no gateways selected")
+	}
+	return fmt.Sprintf("%d gateways, key_id %v", len(pack.Gateways), pack.Metadata["key_id"]), nil
+}
+
+// playIntegrityAuthChecker is the part of the attestation service the
+// play_integrity check uses.
+type playIntegrityAuthChecker interface {
+	CheckPlayIntegrityAuth(ctx context.Context) error
+}
+
+// checkPlayIntegrity verifies the Play Integrity credentials authenticate.
+// Outside production an unconfigured client is skipped rather than failed.
+func checkPlayIntegrity(ctx context.Context, checker playIntegrityAuthChecker) (string, error) {
+	err := checker.CheckPlayIntegrityAuth(ctx)
+	if errors.Is(err, attestation.ErrPlayIntegrityNotConfigured) && strings.ToLower(os.Getenv("GO_ENV")) != "production" {
+		return "", skipCheck("PLAY_INTEGRITY_PACKAGE_NAME not set")
+	}
+	if err != nil {
+		return "", err
+	}
+	return "authenticated", nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/attestation"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+)
+
+func TestReportSelftest_Format(t *testing.T) {
+	checks := []selftestCheck{
+		{name: "database", run: func(context.Context) (string, error) { return "connected", nil }},
+		{name: "redis", run: func(context.Context) (string, error) { return "", errors.New("connection refused") }},
+		{name: "config_pack:us-east-1", run: func(context.Context) (string, error) {
+			return "", skipCheck("database unavailable")
+		}},
+		{name: "play_integrity", run: func(context.Context) (string, error) { panic("boom") }},
+	}
+
+	var out bytes.Buffer
+	if code := reportSelftest(context.Background(), &out, checks); code != 1 {
+		t.Errorf("exit code: got %d, want 1", code)
+	}
+
+	var report struct {
+		OK       bool `json:"ok"`
+		Failures int  `json:"failures"`
+		Checks   []struct {
+			Name       string `json:"name"`
+			Status     string `json:"status"`
+			Detail     string `json:"detail"`
+			Error      string `json:"error"`
+			DurationMs *int64 `json:"duration_ms"`
+		} `json:"checks"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("report is not JSON: %v\n%s", err, out.String())
+	}
+	if report.OK || report.Failures != 2 {
+		t.Errorf("ok=%v failures=%d, want ok=false failures=2", report.OK, report.Failures)
+	}
+	if len(report.Checks) != len(checks) {
+		t.Fatalf("checks: got %d, want %d", len(report.Checks), len(checks))
+	}
+
+	want := []struct{ name, status, detail, err string }{
+		{"database", checkPassed, "connected", ""},
+		{"redis", checkFailed, "", "connection refused"},
+		{"config_pack:us-east-1", checkSkipped, "database unavailable", ""},
+		{"play_integrity", checkFailed, "", "panic: boom"},
+	}
+	for i, w := range want {
+		got := report.Checks[i]
+		if got.Name != w.name || got.Status != w.status || got.Detail != w.detail || got.Error != w.err {
+			t.Errorf("check %d: got %+v, want %+v", i, got, w)
+		}
+		if got.DurationMs == nil {
+			t.Errorf("check %d: missing duration_ms", i)
+		}
+	}
+}
+
+func TestReportSelftest_PassesWithSkips(t *testing.T) {
+	checks := []selftestCheck{
+		{name: "database", run: func(context.Context) (string, error) { return "connected", nil }},
+		{name: "play_integrity", run: func(context.Context) (string, error) { return "", skipCheck("not configured") }},
+	}
+
+	var out bytes.Buffer
+	if code := reportSelftest(context.Background(), &out, checks); code != 0 {
+		t.Errorf("exit code: got %d, want 0\n%s", code, out.String())
+	}
+	if !strings.Contains(out.String(), `"ok": true`) {
+		t.Errorf("expected ok report, got %s", out.String())
+	}
+}
+
+func TestRunChecks_ContinuesAfterFailure(t *testing.T) {
+	ran := 0
+	checks := []selftestCheck{
+		{name: "first", run: func(context.Context) (string, error) { ran++; return "", errors.New("failed") }},
+		{name: "second", run: func(context.Context) (string, error) { ran++; return "", nil }},
+	}
+
+	report := runChecks(context.Background(), checks)
+	if ran != 2 {
+		t.Errorf("ran %d checks, want 2", ran)
+	}
+	if report.OK || report.Checks[1].Status != checkPassed {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestDescribeMigrationStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  db.MigrationStatus
+		wantErr bool
+	}{
+		{"up to date", db.MigrationStatus{Current: 7, Latest: 7}, false},
+		{"pending", db.MigrationStatus{Current: 5, Latest: 7}, false},
+		{"dirty", db.MigrationStatus{Current: 7, Latest: 7, Dirty: true}, true},
+		{"schema ahead of binary", db.MigrationStatus{Current: 8, Latest: 7}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := describeMigrationStatus(tt.status)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("describeMigrationStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckProductionGuards_SigningKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		ephemeral  string
+		privateKey string
+		keyFile    string
+		signer     string
+		wantErr    bool
+	}{
+		{"configured key ok", "", "key", "", "", false},
+		{"key file ok", "", "", "/run/secrets/signing-key", "", false},
+		{"missing key fails", "", "", "", "", true},
+		{"ephemeral key fails", "true", "key", "", "", true},
+		{"remote signer ok", "", "", "", "remote", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("GO_ENV", "production")
+			os.Setenv("LUMENLINK_ALLOW_EPHEMERAL_SIGNING_KEY", tt.ephemeral)
+			os.Setenv("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY", tt.privateKey)
+			os.Setenv("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY_FILE", tt.keyFile)
+			os.Setenv("LUMENLINK_CONFIG_SIGNER", tt.signer)
+			defer func() {
+				os.Unsetenv("GO_ENV")
+				os.Unsetenv("LUMENLINK_ALLOW_EPHEMERAL_SIGNING_KEY")
+				os.Unsetenv("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY")
+				os.Unsetenv("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY_FILE")
+				os.Unsetenv("LUMENLINK_CONFIG_SIGNER")
+			}()
+			err := checkProductionGuards()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkProductionGuards() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSelftestRegions(t *testing.T) {
+	os.Setenv("LUMENLINK_SELFTEST_REGIONS", " eu-west-1, ,us-east-1 ")
+	defer os.Unsetenv("LUMENLINK_SELFTEST_REGIONS")
+
+	got := selftestRegions()
+	if len(got) != 2 || got[0] != "eu-west-1" || got[1] != "us-east-1" {
+		t.Errorf("selftestRegions() = %v", got)
+	}
+}
+
+func TestCheckConfigPack(t *testing.T) {
+	t.Run("pack with gateways passes", func(t *testing.T) {
+		configService := mustTestConfigService(t, func(mock sqlmock.Sqlmock) {
+			rows := gatewayRows()
+			rows.AddRow(
+				"gw-1", []byte("0123456789abcdef0123456789abcdef"), "192.0.2.1", 443,
+				"{masque}", "{dns}",
+				"us-east-1", 100, 0, 100, "active", false,
+				nil, "approved", nil,
+				time.Now(), time.Now(), time.Now(),
+			)
+			mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(rows)
+			mock.ExpectQuery(`SELECT key, region, percentage`).WillReturnRows(rolloutRows())
+		})
+
+		detail, err := checkConfigPack(context.Background(), configService, "us-east-1")
+		if err != nil {
+			t.Fatalf("checkConfigPack: %v", err)
+		}
+		if !strings.HasPrefix(detail, "1 gateways, key_id ") {
+			t.Errorf("detail: got %q", detail)
+		}
+	})
+
+	t.Run("empty region fails", func(t *testing.T) {
+		configService := mustTestConfigService(t, func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(gatewayRows())
+			mock.ExpectQuery(`SELECT key, region, percentage`).WillReturnRows(rolloutRows())
+		})
+
+		if _, err := checkConfigPack(context.Background(), configService, "me-south-1"); err == nil {
+			t.Error("expected failure for a region without gateways")
+		}
+	})
+
+	t.Run("query error fails", func(t *testing.T) {
+		configService := mustTestConfigService(t, func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(`SELECT id, public_key`).WillReturnError(errors.New("relation does not exist"))
+		})
+
+		_, err := checkConfigPack(context.Background(), configService, "us-east-1")
+		if err == nil || !strings.Contains(err.Error(), "relation does not exist") {
+			t.Errorf("expected query error, got %v", err)
+		}
+	})
+}
+
+type fakePlayIntegrity struct {
+	err error
+}
+
+func (f fakePlayIntegrity) CheckPlayIntegrityAuth(context.Context) error {
+	return f.err
+}
+
+func TestCheckPlayIntegrity(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := checkPlayIntegrity(ctx, fakePlayIntegrity{}); err != nil {
+		t.Errorf("authenticated client: unexpected error %v", err)
+	}
+
+	_, err := checkPlayIntegrity(ctx, fakePlayIntegrity{err: errors.New("invalid_grant")})
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("auth failure: got %v", err)
+	}
+
+	var skipped *skipError
+	_, err = checkPlayIntegrity(ctx, fakePlayIntegrity{err: attestation.ErrPlayIntegrityNotConfigured})
+	if !errors.As(err, &skipped) {
+		t.Errorf("unconfigured outside production: expected skip, got %v", err)
+	}
+
+	os.Setenv("GO_ENV", "production")
+	defer os.Unsetenv("GO_ENV")
+	_, err = checkPlayIntegrity(ctx, fakePlayIntegrity{err: attestation.ErrPlayIntegrityNotConfigured})
+	if err == nil || errors.As(err, &skipped) {
+		t.Errorf("unconfigured in production: expected failure, got %v", err)
+	}
+}
+
+func mustTestConfigService(t *testing.T, expect func(sqlmock.Sqlmock)) *config.ConfigService {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	expect(mock)
+
+	os.Setenv("LUMENLINK_ALLOW_EPHEMERAL_SIGNING_KEY", "true")
+	defer os.Unsetenv("LUMENLINK_ALLOW_EPHEMERAL_SIGNING_KEY")
+	configService, err := config.NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	return configService
+}
+
+func gatewayRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
+		"created_at", "last_seen", "updated_at",
+	})
+}
+
+func rolloutRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"key", "region", "percentage", "description", "created_at", "updated_at",
+		"schedule_start_at", "schedule_end_at", "schedule_start_percentage", "schedule_end_percentage",
+		"schedule_easing", "aborted_at"})
+}
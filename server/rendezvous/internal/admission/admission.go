@@ -0,0 +1,240 @@
+// Package admission limits how fast brand-new devices are admitted to each
+// region, so a surge of installs cannot overwhelm the region's gateways
+// faster than operators can add capacity. Devices that have been admitted
+// before are never limited.
+package admission
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/store"
+)
+
+// Admission outcomes
+const (
+	OutcomeKnown     = "known"     // Seen before; never limited
+	OutcomeAdmitted  = "admitted"  // New, within the region's cap
+	OutcomeReturning = "returning" // New, presented a valid waiting-room token
+	OutcomeDeferred  = "deferred"  // New, over the cap; told to come back later
+)
+
+// Config controls the admission controller
+type Config struct {
+	NewClientsPerMinute int           // Per region; 0 tracks devices without limiting
+	SeenTTL             time.Duration // How long an admitted device stays known without returning
+	TokenTTL            time.Duration // How long a waiting-room token is honoured once due
+	MaxRetryAfter       time.Duration // Longest a deferred device is told to wait
+	TokenSecret         []byte        // Shared by every replica; random per process if empty
+}
+
+// LoadConfigFromEnv reads the admission config from the environment.
+func LoadConfigFromEnv() Config {
+	return Config{
+		NewClientsPerMinute: envInt("LUMENLINK_ADMISSION_NEW_CLIENTS_PER_MINUTE", 0),
+		SeenTTL:             envDuration("LUMENLINK_ADMISSION_SEEN_TTL", 90*24*time.Hour),
+		TokenTTL:            envDuration("LUMENLINK_ADMISSION_TOKEN_TTL", time.Hour),
+		MaxRetryAfter:       envDuration("LUMENLINK_ADMISSION_MAX_RETRY_AFTER", 30*time.Minute),
+		TokenSecret:         []byte(os.Getenv("LUMENLINK_ADMISSION_TOKEN_SECRET")),
+	}
+}
+
+// Decision is the controller's answer for one config request
+type Decision struct {
+	Outcome    string
+	RetryAfter time.Duration // Deferred only
+	Token      string        // Deferred only: present it on return for priority admission
+}
+
+// ErrInvalidToken is returned when a waiting-room token does not verify
+var ErrInvalidToken = errors.New("invalid waiting-room token")
+
+// Store key prefixes
+const (
+	seenKeyPrefix    = "admission:seen:"
+	counterKeyPrefix = "admission:new:"
+)
+
+// counterTTL keeps a minute's counter slightly longer than the minute so late
+// increments from skewed replicas still land on it.
+const counterTTL = 2 * time.Minute
+
+// retryJitter spreads deferred devices across the minute they are told to return in
+const retryJitter = 30 * time.Second
+
+// Controller admits new devices per region at up to the configured rate.
+// Devices over the cap in a minute are deferred to a later minute, one
+// minute's cap at a time, and receive a signed waiting-room token that admits
+// them ahead of the cap once their retry time has come.
+type Controller struct {
+	seen     store.StickyAssignmentStore // Admitted devices, assigned their region
+	counters store.ReservationStore      // New devices per region and minute
+	config   Config
+	clock    clock.Clock
+
+	mu  sync.Mutex
+	rng *mathrand.Rand
+}
+
+// NewController creates a controller keeping admitted devices in seen and
+// the per-region new-device counters in counters
+func NewController(seen store.StickyAssignmentStore, counters store.ReservationStore, config Config) *Controller {
+	if len(config.TokenSecret) == 0 {
+		config.TokenSecret = make([]byte, 32)
+		if _, err := rand.Read(config.TokenSecret); err != nil {
+			panic(fmt.Sprintf("admission: failed to generate token secret: %v", err))
+		}
+	}
+	return &Controller{
+		seen:     seen,
+		counters: counters,
+		config:   config,
+		clock:    clock.Real{},
+		rng:      mathrand.New(mathrand.NewSource(clock.Real{}.Now().UnixNano())),
+	}
+}
+
+// Limiting reports whether new devices are rate limited
+func (c *Controller) Limiting() bool {
+	return c.config.NewClientsPerMinute > 0
+}
+
+// Admit decides whether a config request from deviceID in region may proceed.
+// region may be empty when unknown; such devices share one counter. A store
+// error is returned as is: callers should admit the request rather than turn
+// devices away because the store is unreachable.
+func (c *Controller) Admit(ctx context.Context, deviceID, region, token string) (Decision, error) {
+	device := deviceKey(deviceID)
+	_, seen, err := c.seen.Lookup(ctx, seenKeyPrefix+device, c.config.SeenTTL)
+	if err != nil {
+		return Decision{}, err
+	}
+	if seen {
+		return Decision{Outcome: OutcomeKnown}, nil
+	}
+
+	now := c.clock.Now()
+	outcome := OutcomeAdmitted
+	switch {
+	case token != "" && c.verifyToken(token, device, now) == nil:
+		outcome = OutcomeReturning
+	case c.Limiting():
+		minute := strconv.FormatInt(now.Truncate(time.Minute).Unix(), 10)
+		count, err := c.counters.Reserve(ctx, counterKeyPrefix+region+":"+minute, counterTTL)
+		if err != nil {
+			return Decision{}, err
+		}
+		if over := count - int64(c.config.NewClientsPerMinute); over > 0 {
+			retryAfter := c.retryAfter(over)
+			return Decision{
+				Outcome:    OutcomeDeferred,
+				RetryAfter: retryAfter,
+				Token:      c.issueToken(device, now.Add(retryAfter)),
+			}, nil
+		}
+	}
+
+	if err := c.seen.Assign(ctx, seenKeyPrefix+device, region, c.config.SeenTTL); err != nil {
+		return Decision{}, err
+	}
+	return Decision{Outcome: outcome}, nil
+}
+
+// retryAfter schedules the over-th device past the cap: each later minute
+// takes one cap's worth, so returning devices arrive at about the cap's rate.
+func (c *Controller) retryAfter(over int64) time.Duration {
+	minutes := (over-1)/int64(c.config.NewClientsPerMinute) + 1
+	delay := time.Duration(minutes) * time.Minute
+	if c.config.MaxRetryAfter > 0 && delay > c.config.MaxRetryAfter {
+		delay = c.config.MaxRetryAfter
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return delay + time.Duration(c.rng.Int63n(int64(retryJitter)))
+}
+
+// tokenClaims is the signed content of a waiting-room token
+type tokenClaims struct {
+	Device    string `json:"d"`
+	NotBefore int64  `json:"nbf"` // Unix seconds
+	Expires   int64  `json:"exp"` // Unix seconds
+}
+
+// issueToken returns a token admitting device from notBefore for TokenTTL
+func (c *Controller) issueToken(device string, notBefore time.Time) string {
+	claims, _ := json.Marshal(tokenClaims{
+		Device:    device,
+		NotBefore: notBefore.Unix(),
+		Expires:   notBefore.Add(c.config.TokenTTL).Unix(),
+	})
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(c.sign(payload))
+}
+
+// verifyToken checks a token's signature, device and validity window at now
+func (c *Controller) verifyToken(token, device string, now time.Time) error {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, c.sign(payload)) {
+		return ErrInvalidToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return ErrInvalidToken
+	}
+	if claims.Device != device || now.Unix() < claims.NotBefore || now.Unix() >= claims.Expires {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func (c *Controller) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, c.config.TokenSecret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// deviceKey identifies a device in the store without keeping its ID
+func deviceKey(deviceID string) string {
+	sum := sha256.Sum256([]byte(deviceID))
+	return hex.EncodeToString(sum[:16])
+}
+
+func envInt(key string, defaultValue int) int {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func envDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
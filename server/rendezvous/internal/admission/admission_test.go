@@ -0,0 +1,202 @@
+package admission
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/store"
+)
+
+func newTestController(perMinute int) (*Controller, *clock.Fake) {
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 10, 0, time.UTC))
+	memory := store.NewMemory()
+	memory.SetClock(fake)
+	controller := NewController(memory, memory, Config{
+		NewClientsPerMinute: perMinute,
+		SeenTTL:             24 * time.Hour,
+		TokenTTL:            time.Hour,
+		MaxRetryAfter:       10 * time.Minute,
+		TokenSecret:         []byte("test-secret"),
+	})
+	controller.clock = fake
+	return controller, fake
+}
+
+func admit(t *testing.T, c *Controller, deviceID, token string) Decision {
+	t.Helper()
+	decision, err := c.Admit(context.Background(), deviceID, "ap-east-1", token)
+	if err != nil {
+		t.Fatalf("Admit(%s): %v", deviceID, err)
+	}
+	return decision
+}
+
+func TestAdmit_Cap(t *testing.T) {
+	c, fake := newTestController(2)
+
+	for _, device := range []string{"device-1", "device-2"} {
+		if got := admit(t, c, device, "").Outcome; got != OutcomeAdmitted {
+			t.Fatalf("%s: got %s, want admitted", device, got)
+		}
+	}
+
+	// Over the cap: each later minute takes one cap's worth of devices
+	wantMinutes := []time.Duration{1, 1, 2, 2, 3}
+	for i, minutes := range wantMinutes {
+		decision := admit(t, c, "surge-"+string(rune('a'+i)), "")
+		if decision.Outcome != OutcomeDeferred {
+			t.Fatalf("surge %d: got %s, want deferred", i, decision.Outcome)
+		}
+		min := minutes * time.Minute
+		if decision.RetryAfter < min || decision.RetryAfter >= min+retryJitter {
+			t.Errorf("surge %d: retry after %v, want [%v, %v)", i, decision.RetryAfter, min, min+retryJitter)
+		}
+		if decision.Token == "" {
+			t.Errorf("surge %d: no waiting-room token", i)
+		}
+	}
+
+	// Other regions have their own counter
+	decision, err := c.Admit(context.Background(), "device-eu", "eu-central-1", "")
+	if err != nil || decision.Outcome != OutcomeAdmitted {
+		t.Errorf("other region: got %+v, %v; want admitted", decision, err)
+	}
+
+	// The counter resets with the minute
+	fake.Advance(time.Minute)
+	if got := admit(t, c, "device-3", "").Outcome; got != OutcomeAdmitted {
+		t.Errorf("next minute: got %s, want admitted", got)
+	}
+}
+
+func TestAdmit_RetryAfterCapped(t *testing.T) {
+	c, _ := newTestController(1)
+	admit(t, c, "device-1", "")
+	var last Decision
+	for i := 0; i < 20; i++ {
+		last = admit(t, c, "surge-"+string(rune('a'+i)), "")
+	}
+	if last.RetryAfter >= 10*time.Minute+retryJitter {
+		t.Errorf("retry after %v exceeds the 10m cap", last.RetryAfter)
+	}
+}
+
+func TestAdmit_KnownDevicesBypassCap(t *testing.T) {
+	c, _ := newTestController(1)
+	admit(t, c, "device-1", "")
+
+	// Fill the minute, then the known device comes back
+	admit(t, c, "device-2", "")
+	for i := 0; i < 3; i++ {
+		if got := admit(t, c, "device-1", "").Outcome; got != OutcomeKnown {
+			t.Fatalf("known device: got %s, want known", got)
+		}
+	}
+	// A deferred device is not known yet
+	if got := admit(t, c, "device-2", "").Outcome; got != OutcomeDeferred {
+		t.Errorf("deferred device on retry without token: got %s, want deferred", got)
+	}
+}
+
+func TestAdmit_TokenRoundTrip(t *testing.T) {
+	c, fake := newTestController(1)
+	admit(t, c, "device-1", "")
+	deferred := admit(t, c, "device-2", "")
+	if deferred.Outcome != OutcomeDeferred {
+		t.Fatalf("got %s, want deferred", deferred.Outcome)
+	}
+
+	// Too early: the token is not yet honoured, so the cap still applies
+	if got := admit(t, c, "device-2", deferred.Token).Outcome; got != OutcomeDeferred {
+		t.Errorf("early return: got %s, want deferred", got)
+	}
+
+	fake.Advance(deferred.RetryAfter)
+	// Fill the new minute so only the token can get device-2 in
+	admit(t, c, "device-3", "")
+	if got := admit(t, c, "device-4", "").Outcome; got != OutcomeDeferred {
+		t.Fatalf("filler: got %s, want deferred", got)
+	}
+	if got := admit(t, c, "device-2", deferred.Token).Outcome; got != OutcomeReturning {
+		t.Fatalf("return with token: got %s, want returning", got)
+	}
+	if got := admit(t, c, "device-2", "").Outcome; got != OutcomeKnown {
+		t.Errorf("after returning: got %s, want known", got)
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	c, fake := newTestController(1)
+	device := deviceKey("device-1")
+	token := c.issueToken(device, fake.Now())
+	payload, signature, _ := strings.Cut(token, ".")
+
+	other, _ := newTestController(1)
+	other.config.TokenSecret = []byte("other-secret")
+
+	tests := []struct {
+		name       string
+		controller *Controller
+		token      string
+		device     string
+		at         time.Time
+		wantErr    bool
+	}{
+		{"valid", c, token, device, fake.Now(), false},
+		{"other device", c, token, deviceKey("device-2"), fake.Now(), true},
+		{"before due", c, token, device, fake.Now().Add(-time.Second), true},
+		{"expired", c, token, device, fake.Now().Add(time.Hour), true},
+		{"tampered payload", c, payload + "x." + signature, device, fake.Now(), true},
+		{"other secret", other, token, device, fake.Now(), true},
+		{"malformed", c, "not-a-token", device, fake.Now(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.controller.verifyToken(tt.token, tt.device, tt.at)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyToken: err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAdmit_DisabledTracksDevices(t *testing.T) {
+	c, _ := newTestController(0)
+	for i := 0; i < 10; i++ {
+		if got := admit(t, c, "device-"+string(rune('a'+i)), "").Outcome; got != OutcomeAdmitted {
+			t.Fatalf("got %s, want admitted", got)
+		}
+	}
+	// Devices admitted before the cap is enabled stay known
+	if got := admit(t, c, "device-a", "").Outcome; got != OutcomeKnown {
+		t.Errorf("got %s, want known", got)
+	}
+}
+
+type failingStore struct{ *store.Memory }
+
+func (*failingStore) Lookup(context.Context, string, time.Duration) (string, bool, error) {
+	return "", false, errors.New("redis: connection refused")
+}
+
+func TestAdmit_StoreError(t *testing.T) {
+	memory := store.NewMemory()
+	c := NewController(&failingStore{memory}, memory, Config{NewClientsPerMinute: 1})
+	if _, err := c.Admit(context.Background(), "device-1", "ap-east-1", ""); err == nil {
+		t.Error("expected the store error")
+	}
+}
+
+func TestDeviceKey_DoesNotKeepID(t *testing.T) {
+	key := deviceKey("device-1")
+	if strings.Contains(key, "device-1") || len(key) != 32 {
+		t.Errorf("deviceKey = %q", key)
+	}
+	if deviceKey("device-1") != key {
+		t.Error("deviceKey is not stable")
+	}
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+	"rendezvous/internal/sanitize"
+)
+
+// adminWindows are the aggregation windows accepted by admin reporting endpoints
+var adminWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// parseWindow resolves a window query parameter such as "24h" or "7d".
+func parseWindow(value string) (time.Duration, bool) {
+	window, ok := adminWindows[value]
+	return window, ok
+}
+
+// ReviewItemResponse represents a review queue item in admin responses
+type ReviewItemResponse struct {
+	ID          string          `json:"id"`
+	SubjectType string          `json:"subject_type"`
+	SubjectID   string          `json:"subject_id"`
+	Reason      string          `json:"reason"`
+	Details     json.RawMessage `json:"details"`
+	Status      string          `json:"status"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// GetReviewQueue lists admin review queue items (default: open items)
+func (h *Handler) GetReviewQueue(c *gin.Context) {
+	status := c.DefaultQuery("status", "open")
+	if status != "open" && status != "resolved" && status != "dismissed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_status"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+	items, err := h.database.GetReviewItems(c.Request.Context(), status, limit)
+	if err != nil {
+		respondError(c, err, "review_queue_fetch_failed")
+		return
+	}
+
+	response := make([]ReviewItemResponse, 0, len(items))
+	for _, item := range items {
+		response = append(response, ReviewItemResponse{
+			ID:          item.ID,
+			SubjectType: item.SubjectType,
+			SubjectID:   item.SubjectID,
+			Reason:      item.Reason,
+			Details:     json.RawMessage(item.Details),
+			Status:      item.Status,
+			CreatedAt:   item.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": response})
+}
+
+// CloseReviewItemRequest represents a request to close a review queue item
+type CloseReviewItemRequest struct {
+	Status     string `json:"status" binding:"required" enum:"resolved,dismissed"`
+	ResolvedBy string `json:"resolved_by"` // Sanitized and cut to maxResolvedByLen bytes
+}
+
+// maxResolvedByLen bounds the stored name of whoever closed a review item
+const maxResolvedByLen = 255
+
+// CloseReviewItem marks a review queue item as resolved or dismissed
+func (h *Handler) CloseReviewItem(c *gin.Context) {
+	var req CloseReviewItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status != "resolved" && req.Status != "dismissed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_status"})
+		return
+	}
+
+	req.ResolvedBy = sanitize.Text(req.ResolvedBy, maxResolvedByLen)
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		if err := h.database.CloseReviewItem(ctx, c.Param("id"), req.Status, req.ResolvedBy); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditReviewItemClose, SubjectType: "review_item", SubjectID: c.Param("id"), Details: map[string]interface{}{
+			"status":      req.Status,
+			"resolved_by": req.ResolvedBy,
+		}}, nil
+	})
+	if err != nil {
+		respondError(c, err, "review_item_update_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": req.Status})
+}
+
+// AdminGatewayResponse is the admin view of one gateway
+type AdminGatewayResponse struct {
+	ID                string               `json:"id"`
+	OperatorID        string               `json:"operator_id"`
+	IPAddress         string               `json:"ip_address"`
+	Port              int                  `json:"port"`
+	Region            string               `json:"region"`
+	TransportTypes    []string             `json:"transport_types"`
+	DiscoveryChannels []string             `json:"discovery_channels"`
+	ASN               *int                 `json:"asn,omitempty"`
+	Status            string               `json:"status"`
+	ApprovalStatus    string               `json:"approval_status"`
+	IsHoneypot        bool                 `json:"is_honeypot"`
+	CurrentUsers      int                  `json:"current_users"`
+	CreatedAt         time.Time            `json:"created_at"`
+	LastSeenAt        *time.Time           `json:"last_seen_at,omitempty"`
+	LastSeen          *time.Time           `json:"last_seen,omitempty"` // Deprecated: last_seen_at, sent in response version 1 only
+	Suspicion         *db.GatewaySuspicion `json:"suspicion"`           // Null until the gateway has been scored
+	Secrets           []AdminGatewaySecret `json:"secrets,omitempty"`   // Only with include_secrets=true
+}
+
+// GetAdminGateway returns one gateway with its honeypot suspicion score.
+// Its transport secrets are included only with ?include_secrets=true, and
+// that export is audited.
+func (h *Handler) GetAdminGateway(c *gin.Context) {
+	if !gatewayIDPattern.MatchString(c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "gateway_not_found"})
+		return
+	}
+	ctx := c.Request.Context()
+	gw, err := h.database.GetGatewayByID(ctx, c.Param("id"))
+	if err != nil {
+		respondError(c, err, "gateway_fetch_failed")
+		return
+	}
+	suspicion, err := h.database.GetGatewaySuspicion(ctx, gw.ID)
+	if err != nil {
+		respondError(c, err, "gateway_fetch_failed")
+		return
+	}
+
+	response := AdminGatewayResponse{
+		ID:                gw.ID,
+		OperatorID:        gw.OperatorID,
+		IPAddress:         gw.IPAddress,
+		Port:              gw.Port,
+		Region:            gw.Region,
+		TransportTypes:    gw.TransportTypes,
+		DiscoveryChannels: gw.DiscoveryChannels,
+		ASN:               gw.ASN,
+		Status:            gw.Status,
+		ApprovalStatus:    gw.ApprovalStatus,
+		IsHoneypot:        gw.IsHoneypot,
+		CurrentUsers:      gw.CurrentUsers,
+		CreatedAt:         gw.CreatedAt,
+		LastSeenAt:        gw.LastSeen,
+		Suspicion:         suspicion,
+	}
+	if legacyFieldNames(c) {
+		response.LastSeen = gw.LastSeen
+	}
+	if c.Query("include_secrets") == "true" {
+		if response.Secrets, err = h.adminGatewaySecrets(c, gw.ID); err != nil {
+			respondError(c, err, "gateway_fetch_failed")
+			return
+		}
+		// Secrets are not exported unless the export is on the record
+		_, err = h.database.AppendAuditEntry(ctx, auditActor(c), AuditGatewaySecretsExport, "gateway", gw.ID, map[string]interface{}{
+			"generations": len(response.Secrets),
+		})
+		if err != nil {
+			respondError(c, err, "gateway_fetch_failed")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ApproveGateway approves a gateway registered above quota
+func (h *Handler) ApproveGateway(c *gin.Context) {
+	h.setGatewayApproval(c, true)
+}
+
+// RejectGateway rejects a gateway registered above quota
+func (h *Handler) RejectGateway(c *gin.Context) {
+	h.setGatewayApproval(c, false)
+}
+
+func (h *Handler) setGatewayApproval(c *gin.Context, approved bool) {
+	action := AuditGatewayReject
+	if approved {
+		action = AuditGatewayApprove
+	}
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		if err := h.registry.SetApproval(ctx, c.Param("id"), approved); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: action, SubjectType: "gateway", SubjectID: c.Param("id")}, nil
+	})
+	if err != nil {
+		respondError(c, err, "gateway_approval_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"gateway_id": c.Param("id"), "approved": approved})
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+)
+
+func TestGetAdminGateway_IncludesSuspicion(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`WHERE id = \$1`).WithArgs(testGatewayID).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
+		"created_at", "last_seen", "updated_at",
+	}).AddRow(
+		testGatewayID, make([]byte, 32), "192.0.2.1", 443, "{masque}", "{}",
+		"me-south-1", nil, 30, nil, "active", false,
+		"op-1", "pending", nil,
+		now, now, now,
+	))
+	mock.ExpectQuery(`FROM gateway_suspicion_scores`).WithArgs(testGatewayID).WillReturnRows(
+		sqlmock.NewRows([]string{"gateway_id", "score", "components", "signals", "flagged", "computed_at"}).
+			AddRow(testGatewayID, 0.85, []byte(`{"unconfirmed":1}`), []byte(`{"heartbeats":2000}`), true, now))
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.GET("/api/v1/admin/gateways/:id", handler.GetAdminGateway)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/gateways/"+testGatewayID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+
+	var resp AdminGatewayResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.ApprovalStatus != "pending" || resp.Suspicion == nil || !resp.Suspicion.Flagged || resp.Suspicion.Score != 0.85 {
+		t.Errorf("response: got %+v, suspicion %+v", resp, resp.Suspicion)
+	}
+	if resp.Suspicion.Signals["heartbeats"] != 2000 {
+		t.Errorf("signals: got %v", resp.Suspicion.Signals)
+	}
+}
+
+func TestGetAdminGateway_NotFound(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	mock.ExpectQuery(`WHERE id = \$1`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.GET("/api/v1/admin/gateways/:id", handler.GetAdminGateway)
+
+	for _, id := range []string{testGatewayID, "not-a-uuid"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/gateways/"+id, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", id, w.Code)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"rendezvous/internal/admission"
+	"rendezvous/internal/config"
+	"rendezvous/internal/metrics"
+	"rendezvous/internal/privacy"
+	"rendezvous/internal/store"
+)
+
+func postConfig(t *testing.T, router *gin.Engine, body map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/config", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetConfig_AdmissionDeferred(t *testing.T) {
+	configSvc, err := config.NewConfigService(mustTestDB(t))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	memory := store.NewMemory()
+	handler := &Handler{
+		configService: configSvc,
+		admission:     admission.NewController(memory, memory, admission.Config{NewClientsPerMinute: 1, SeenTTL: time.Hour}),
+	}
+	router := gin.New()
+	router.POST("/api/v1/config", handler.GetConfig)
+
+	admitted := metrics.AdmissionRequests.WithLabelValues("me-south-1", admission.OutcomeAdmitted)
+	deferred := metrics.AdmissionRequests.WithLabelValues("me-south-1", admission.OutcomeDeferred)
+	beforeAdmitted, beforeDeferred := testutil.ToFloat64(admitted), testutil.ToFloat64(deferred)
+
+	// The first new device fills the region's cap for this minute
+	w := postConfig(t, router, map[string]interface{}{"device_id": "device-1", "platform": "android", "region": "me-south-1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("first device: status %d (%s)", w.Code, w.Body.String())
+	}
+
+	// The second is deferred with a signed come-back-later pack; no database
+	// queries are made for it
+	w = postConfig(t, router, map[string]interface{}{"device_id": "device-2", "platform": "android", "region": "me-south-1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("second device: status %d (%s)", w.Code, w.Body.String())
+	}
+	var resp GetConfigResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	pack := resp.ConfigPack
+	if pack.Metadata["admission"] != config.AdmissionDeferred || len(pack.Gateways) != 0 {
+		t.Fatalf("want a deferred pack without gateways, got metadata %v and %d gateways", pack.Metadata, len(pack.Gateways))
+	}
+	token, _ := pack.Metadata["waiting_room_token"].(string)
+	if token == "" {
+		t.Error("deferred pack has no waiting-room token")
+	}
+	retryAfter, _ := pack.Metadata["retry_after"].(float64)
+	if header := w.Header().Get("Retry-After"); header != strconv.Itoa(int(retryAfter)) || retryAfter < 60 {
+		t.Errorf("Retry-After header %q, metadata retry_after %v", header, retryAfter)
+	}
+
+	if got := testutil.ToFloat64(admitted) - beforeAdmitted; got != 1 {
+		t.Errorf("admitted delta: got %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(deferred) - beforeDeferred; got != 1 {
+		t.Errorf("deferred delta: got %v, want 1", got)
+	}
+}
+
+func TestGetConfig_KnownDeviceBypassesAdmission(t *testing.T) {
+	configSvc, err := config.NewConfigService(mustTestDB(t))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	memory := store.NewMemory()
+	controller := admission.NewController(memory, memory, admission.Config{NewClientsPerMinute: 1, SeenTTL: time.Hour})
+	// device-1 was admitted earlier; another device has since filled the cap
+	for _, device := range []string{"device-1", "device-2"} {
+		if _, err := controller.Admit(context.Background(), device, "me-south-1", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := &Handler{configService: configSvc, admission: controller}
+	router := gin.New()
+	router.POST("/api/v1/config", handler.GetConfig)
+
+	w := postConfig(t, router, map[string]interface{}{"device_id": "device-1", "platform": "android", "region": "me-south-1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d (%s)", w.Code, w.Body.String())
+	}
+	var resp GetConfigResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if _, ok := resp.ConfigPack.Metadata["admission"]; ok {
+		t.Errorf("known device got a deferred pack: %v", resp.ConfigPack.Metadata)
+	}
+	if w.Header().Get("Retry-After") != "" {
+		t.Error("known device got a Retry-After header")
+	}
+}
+
+func TestSetAdmission_DisabledUnderDataMinimization(t *testing.T) {
+	memory := store.NewMemory()
+	controller := admission.NewController(memory, memory, admission.Config{NewClientsPerMinute: 1, SeenTTL: time.Hour})
+
+	standard := &Handler{database: mustTestDB(t)}
+	standard.SetAdmission(controller)
+	if standard.admission == nil {
+		t.Error("admission disabled in standard mode")
+	}
+
+	database := mustTestDB(t)
+	database.SetPersistencePolicy(privacy.NewPolicy(true))
+	minimized := &Handler{database: database}
+	minimized.SetAdmission(controller)
+	if minimized.admission != nil {
+		t.Error("admission enabled under data minimization; its seen-device set tracks devices")
+	}
+}
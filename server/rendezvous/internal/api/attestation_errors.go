@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/attestation"
+)
+
+// Attestation error codes group the failure reasons by what the client
+// should do next
+const (
+	// AttestationErrorIntegrity: the device or app failed Google's or
+	// Apple's checks; retrying will not help
+	AttestationErrorIntegrity = "integrity_failed"
+	// AttestationErrorInvalidToken: the token is malformed or its signature
+	// does not verify; a client bug, not worth retrying
+	AttestationErrorInvalidToken = "invalid_token"
+	// AttestationErrorChallenge: the token's challenge was unknown, used or
+	// stale; retry with a new challenge and token
+	AttestationErrorChallenge = "challenge_failed"
+	// AttestationErrorReattest: the key asserted with is not known; retry
+	// with a full attestation of a new key, or after enrolling
+	AttestationErrorReattest = "reattestation_required"
+	// AttestationErrorRevoked: the device is banned
+	AttestationErrorRevoked = "device_revoked"
+	// AttestationErrorUnsupported: this server cannot attest the platform
+	AttestationErrorUnsupported = "unsupported"
+	// AttestationErrorUnavailable: verification could not complete; retry
+	// after the Retry-After delay
+	AttestationErrorUnavailable = "unavailable"
+	// AttestationErrorRateLimited: the device attested too often; retry
+	// later, reusing the stored attestation meanwhile
+	AttestationErrorRateLimited = "rate_limited"
+	// AttestationErrorFailed: a reason this server does not classify
+	AttestationErrorFailed = "attestation_failed"
+)
+
+type attestationErrorCode struct {
+	code      string
+	retryable bool
+}
+
+// attestationErrorCodes classifies every AttestationResult.Reason
+var attestationErrorCodes = map[string]attestationErrorCode{
+	"device_integrity_failed": {AttestationErrorIntegrity, false},
+	"app_not_recognized":      {AttestationErrorIntegrity, false},
+	"app_not_licensed":        {AttestationErrorIntegrity, false},
+	"app_version_not_allowed": {AttestationErrorIntegrity, false},
+	"package_name_mismatch":   {AttestationErrorIntegrity, false},
+	"key_already_bound":       {AttestationErrorIntegrity, false},
+
+	"key_not_hardware_backed":     {AttestationErrorIntegrity, false},
+	"signature_digest_mismatch":   {AttestationErrorIntegrity, false},
+	"certificate_chain_untrusted": {AttestationErrorIntegrity, false},
+
+	"bundle_id_not_allowed":               {AttestationErrorIntegrity, false},
+	"development_environment_not_allowed": {AttestationErrorIntegrity, false},
+
+	"missing_token":                   {AttestationErrorInvalidToken, false},
+	"missing_token_payload":           {AttestationErrorInvalidToken, false},
+	"missing_key_id":                  {AttestationErrorInvalidToken, false},
+	"invalid_request_type":            {AttestationErrorInvalidToken, false},
+	"invalid_environment":             {AttestationErrorInvalidToken, false},
+	"invalid_token_type":              {AttestationErrorInvalidToken, false},
+	"invalid_certificate_chain":       {AttestationErrorInvalidToken, false},
+	"invalid_key_description":         {AttestationErrorInvalidToken, false},
+	"invalid_attestation_format":      {AttestationErrorInvalidToken, false},
+	"invalid_assertion_format":        {AttestationErrorInvalidToken, false},
+	"invalid_statement_format":        {AttestationErrorInvalidToken, false},
+	"dcappattest_verification_failed": {AttestationErrorInvalidToken, false},
+	"assertion_verification_failed":   {AttestationErrorInvalidToken, false},
+	"desktop_signature_invalid":       {AttestationErrorInvalidToken, false},
+
+	"challenge_invalid":     {AttestationErrorChallenge, true},
+	"request_hash_mismatch": {AttestationErrorChallenge, true},
+	"attestation_expired":   {AttestationErrorChallenge, true},
+	"assertion_replayed":    {AttestationErrorChallenge, true},
+
+	"unknown_key":         {AttestationErrorReattest, true},
+	"device_not_enrolled": {AttestationErrorReattest, true},
+
+	"device_revoked": {AttestationErrorRevoked, false},
+
+	"unsupported_platform":           {AttestationErrorUnsupported, false},
+	"play_integrity_not_configured":  {AttestationErrorUnsupported, false},
+	"missing_dcappattest_config":     {AttestationErrorUnsupported, false},
+	"key_attestation_not_configured": {AttestationErrorUnsupported, false},
+
+	"play_integrity_api_error": {AttestationErrorUnavailable, true},
+	"verification_error":       {AttestationErrorUnavailable, true},
+	"attestation_busy":         {AttestationErrorUnavailable, true},
+
+	"too_many_verifications": {AttestationErrorRateLimited, true},
+}
+
+// classifyAttestationFailure returns the error code for a failure reason
+// and whether retrying may succeed
+func classifyAttestationFailure(reason string) (string, bool) {
+	if classified, ok := attestationErrorCodes[reason]; ok {
+		return classified.code, classified.retryable
+	}
+	return AttestationErrorFailed, false
+}
+
+// respondVerificationError answers an attestation that could not be
+// verified. Errors that are not the client's fault are transient: they are
+// answered 503 with a Retry-After, so clients back off and try again.
+func respondVerificationError(c *gin.Context, result *attestation.AttestationResult, err error) {
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		status = http.StatusServiceUnavailable
+	}
+	code := apperr.Code(err)
+	if code == "" {
+		code = "verification_failed"
+	}
+
+	response := VerifyAttestationResponse{Error: code, Reason: code}
+	if result != nil && result.Reason != "" {
+		response.Reason = result.Reason
+	}
+	switch {
+	case status == http.StatusServiceUnavailable:
+		response.ErrorCode, response.Retryable = AttestationErrorUnavailable, true
+		c.Header("Retry-After", strconv.Itoa(int(attestation.BusyRetryAfter/time.Second)))
+	case errors.Is(err, apperr.ErrInvalidInput):
+		// Google or Apple rejected the token itself
+		response.ErrorCode, response.Retryable = AttestationErrorInvalidToken, false
+	default:
+		response.ErrorCode, response.Retryable = classifyAttestationFailure(response.Reason)
+	}
+	c.JSON(status, response)
+}
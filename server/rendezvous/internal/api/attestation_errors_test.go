@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/googleapi"
+	"rendezvous/internal/attestation"
+	"rendezvous/internal/db"
+)
+
+func TestClassifyAttestationFailure(t *testing.T) {
+	tests := []struct {
+		reason    string
+		code      string
+		retryable bool
+	}{
+		{"device_integrity_failed", AttestationErrorIntegrity, false},
+		{"app_not_recognized", AttestationErrorIntegrity, false},
+		{"app_not_licensed", AttestationErrorIntegrity, false},
+		{"app_version_not_allowed", AttestationErrorIntegrity, false},
+		{"package_name_mismatch", AttestationErrorIntegrity, false},
+		{"key_already_bound", AttestationErrorIntegrity, false},
+		{"bundle_id_not_allowed", AttestationErrorIntegrity, false},
+		{"development_environment_not_allowed", AttestationErrorIntegrity, false},
+		{"key_not_hardware_backed", AttestationErrorIntegrity, false},
+		{"signature_digest_mismatch", AttestationErrorIntegrity, false},
+		{"certificate_chain_untrusted", AttestationErrorIntegrity, false},
+		{"missing_token", AttestationErrorInvalidToken, false},
+		{"missing_token_payload", AttestationErrorInvalidToken, false},
+		{"missing_key_id", AttestationErrorInvalidToken, false},
+		{"invalid_request_type", AttestationErrorInvalidToken, false},
+		{"invalid_environment", AttestationErrorInvalidToken, false},
+		{"invalid_token_type", AttestationErrorInvalidToken, false},
+		{"invalid_certificate_chain", AttestationErrorInvalidToken, false},
+		{"invalid_key_description", AttestationErrorInvalidToken, false},
+		{"invalid_attestation_format", AttestationErrorInvalidToken, false},
+		{"invalid_assertion_format", AttestationErrorInvalidToken, false},
+		{"invalid_statement_format", AttestationErrorInvalidToken, false},
+		{"dcappattest_verification_failed", AttestationErrorInvalidToken, false},
+		{"assertion_verification_failed", AttestationErrorInvalidToken, false},
+		{"desktop_signature_invalid", AttestationErrorInvalidToken, false},
+		{"challenge_invalid", AttestationErrorChallenge, true},
+		{"request_hash_mismatch", AttestationErrorChallenge, true},
+		{"attestation_expired", AttestationErrorChallenge, true},
+		{"assertion_replayed", AttestationErrorChallenge, true},
+		{"unknown_key", AttestationErrorReattest, true},
+		{"device_not_enrolled", AttestationErrorReattest, true},
+		{"device_revoked", AttestationErrorRevoked, false},
+		{"unsupported_platform", AttestationErrorUnsupported, false},
+		{"play_integrity_not_configured", AttestationErrorUnsupported, false},
+		{"missing_dcappattest_config", AttestationErrorUnsupported, false},
+		{"key_attestation_not_configured", AttestationErrorUnsupported, false},
+		{"play_integrity_api_error", AttestationErrorUnavailable, true},
+		{"verification_error", AttestationErrorUnavailable, true},
+		{"attestation_busy", AttestationErrorUnavailable, true},
+		{"too_many_verifications", AttestationErrorRateLimited, true},
+		{"something_new", AttestationErrorFailed, false},
+	}
+	if len(tests)-1 != len(attestationErrorCodes) {
+		t.Errorf("table covers %d reasons, attestationErrorCodes has %d", len(tests)-1, len(attestationErrorCodes))
+	}
+	for _, tt := range tests {
+		code, retryable := classifyAttestationFailure(tt.reason)
+		if code != tt.code || retryable != tt.retryable {
+			t.Errorf("%s: got %s, %v; want %s, %v", tt.reason, code, retryable, tt.code, tt.retryable)
+		}
+	}
+}
+
+func TestVerifyAttestation_ErrorCodes(t *testing.T) {
+	t.Setenv("PLAY_INTEGRITY_PACKAGE_NAME", "org.lumenlink.app")
+	tests := []struct {
+		name       string
+		platform   string
+		setup      func(*attestation.FakePlayIntegrity)
+		wantStatus int
+		want       VerifyAttestationResponse
+		retryAfter string
+	}{
+		{"integrity failed", "android", func(f *attestation.FakePlayIntegrity) {
+			f.Payload.DeviceIntegrity.DeviceRecognitionVerdict = nil
+		}, http.StatusUnauthorized, VerifyAttestationResponse{DeviceIntegrity: "UNKNOWN", Reason: "device_integrity_failed", ErrorCode: AttestationErrorIntegrity}, ""},
+		{"unsupported platform", "symbian", nil, http.StatusUnauthorized,
+			VerifyAttestationResponse{Reason: "unsupported_platform", ErrorCode: AttestationErrorUnsupported}, ""},
+		{"token rejected by google", "android", func(f *attestation.FakePlayIntegrity) {
+			f.Err = &googleapi.Error{Code: http.StatusBadRequest}
+		}, http.StatusBadRequest, VerifyAttestationResponse{Reason: "verification_error", ErrorCode: AttestationErrorInvalidToken, Error: "verification_failed"}, ""},
+		{"google unreachable", "android", func(f *attestation.FakePlayIntegrity) {
+			f.Err = errors.New("connection refused")
+		}, http.StatusServiceUnavailable, VerifyAttestationResponse{Reason: "verification_error", ErrorCode: AttestationErrorUnavailable, Retryable: true, Error: "verification_failed"}, "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+			mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			mock.ExpectExec(`INSERT INTO attestations`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+			fake := attestation.NewFakePlayIntegrity("org.lumenlink.app", time.Now(), "MEETS_DEVICE_INTEGRITY")
+			if tt.setup != nil {
+				tt.setup(fake)
+			}
+			svc := attestation.NewAttestationService(db.NewFromPool(sqlDB), attestation.WithPlayIntegrityDecoder(fake))
+			handler := &Handler{attestationService: svc}
+			router := gin.New()
+			router.POST("/api/v1/attest", handler.VerifyAttestation)
+
+			body := []byte(`{"platform":"` + tt.platform + `","device_id":"device-1","token":"token"}`)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/attest", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var got VerifyAttestationResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode %s: %v", w.Body.String(), err)
+			}
+			if w.Code != tt.wantStatus || got != tt.want {
+				t.Errorf("got %d %+v, want %d %+v", w.Code, got, tt.wantStatus, tt.want)
+			}
+			if ra := w.Header().Get("Retry-After"); ra != tt.retryAfter {
+				t.Errorf("Retry-After: got %q, want %q", ra, tt.retryAfter)
+			}
+		})
+	}
+}
+
+func TestRespondVerificationError_Busy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	respondVerificationError(c, nil, attestation.ErrAttestationBusy)
+
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "5" {
+		t.Errorf("got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	want := `{"verified":false,"reason":"attestation_busy","error_code":"unavailable","retryable":true,"error":"attestation_busy"}`
+	if body := w.Body.String(); body != want {
+		t.Errorf("body: got %s", body)
+	}
+}
+
+func TestRespondVerificationError_RateLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	respondVerificationError(c, nil, attestation.ErrTooManyVerifications)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("got %d", w.Code)
+	}
+	want := `{"verified":false,"reason":"too_many_verifications","error_code":"rate_limited","retryable":true,"error":"too_many_verifications"}`
+	if body := w.Body.String(); body != want {
+		t.Errorf("body: got %s", body)
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+)
+
+// AttestationPlatformStats summarises one platform's attestations
+type AttestationPlatformStats struct {
+	Platform     string  `json:"platform"`
+	Total        int64   `json:"total"`
+	Verified     int64   `json:"verified"`
+	Failed       int64   `json:"failed"`
+	VerifiedRate float64 `json:"verified_rate"`
+}
+
+// GetAttestationStats summarises stored attestations per platform, with a
+// breakdown by integrity verdict and failure reason, for the admin API.
+// Attestations are not stored under data minimization, so the counts are
+// then empty and Prometheus is the only record.
+func (h *Handler) GetAttestationStats(c *gin.Context) {
+	window, ok := parseWindow(c.DefaultQuery("window", "24h"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_window"})
+		return
+	}
+
+	counts, err := h.database.GetAttestationStats(c.Request.Context(), h.now().Add(-window))
+	if err != nil {
+		respondError(c, err, "attestation_stats_fetch_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"window":    c.DefaultQuery("window", "24h"),
+		"platforms": summarizeAttestations(counts),
+		"counts":    counts,
+	})
+}
+
+// summarizeAttestations totals attestation counts per platform, in the
+// order the platforms first appear
+func summarizeAttestations(counts []db.AttestationStats) []AttestationPlatformStats {
+	platforms := []AttestationPlatformStats{}
+	index := map[string]int{}
+	for _, count := range counts {
+		i, ok := index[count.Platform]
+		if !ok {
+			i = len(platforms)
+			index[count.Platform] = i
+			platforms = append(platforms, AttestationPlatformStats{Platform: count.Platform})
+		}
+		p := &platforms[i]
+		p.Total += count.Count
+		if count.Verified {
+			p.Verified += count.Count
+		} else {
+			p.Failed += count.Count
+		}
+	}
+	for i := range platforms {
+		if platforms[i].Total > 0 {
+			platforms[i].VerifiedRate = float64(platforms[i].Verified) / float64(platforms[i].Total)
+		}
+	}
+	return platforms
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+)
+
+func TestGetAttestationStats_SummarisesPerPlatform(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`FROM attestations\s+WHERE created_at >= \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"platform", "verified", "device_integrity", "reason", "count"}).
+			AddRow("android", true, "MEETS_DEVICE_INTEGRITY", "", 60).
+			AddRow("android", true, "MEETS_STRONG_INTEGRITY", "", 30).
+			AddRow("android", false, "", "request_hash_mismatch", 10).
+			AddRow("ios", false, "", "challenge_invalid", 4))
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.GET("/api/v1/admin/attestation/stats", handler.GetAttestationStats)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/attestation/stats?window=7d", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Window    string                     `json:"window"`
+		Platforms []AttestationPlatformStats `json:"platforms"`
+		Counts    []db.AttestationStats      `json:"counts"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	want := []AttestationPlatformStats{
+		{Platform: "android", Total: 100, Verified: 90, Failed: 10, VerifiedRate: 0.9},
+		{Platform: "ios", Total: 4, Failed: 4},
+	}
+	if resp.Window != "7d" || len(resp.Platforms) != len(want) {
+		t.Fatalf("got window %q and platforms %+v", resp.Window, resp.Platforms)
+	}
+	for i := range want {
+		if resp.Platforms[i] != want[i] {
+			t.Errorf("platform %d: got %+v, want %+v", i, resp.Platforms[i], want[i])
+		}
+	}
+	if len(resp.Counts) != 4 || resp.Counts[2].Reason != "request_hash_mismatch" {
+		t.Errorf("counts: got %+v", resp.Counts)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetAttestationStats_RejectsUnknownWindow(t *testing.T) {
+	handler := &Handler{}
+	router := gin.New()
+	router.GET("/api/v1/admin/attestation/stats", handler.GetAttestationStats)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/attestation/stats?window=2h", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status: got %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/audit"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+)
+
+func auditRows(t *testing.T, n int) (*sqlmock.Rows, []audit.Entry) {
+	t.Helper()
+	rows := sqlmock.NewRows([]string{
+		"seq", "actor", "action", "subject_type", "subject_id", "details", "created_at", "prev_hash", "hash",
+	})
+	var entries []audit.Entry
+	prev := audit.GenesisHash
+	for i := 1; i <= n; i++ {
+		e := audit.Entry{
+			Seq:         int64(i),
+			Actor:       "admin",
+			Action:      AuditGatewayApprove,
+			SubjectType: "gateway",
+			SubjectID:   "gw-1",
+			Details:     json.RawMessage(`{}`),
+			CreatedAt:   time.Date(2026, 2, 1, 10, i, 0, 0, time.UTC),
+			PrevHash:    prev,
+		}
+		e.Hash, _ = audit.ComputeHash(&e)
+		prev = e.Hash
+		entries = append(entries, e)
+		rows.AddRow(e.Seq, e.Actor, e.Action, e.SubjectType, e.SubjectID, string(e.Details), e.CreatedAt, e.PrevHash, e.Hash)
+	}
+	return rows, entries
+}
+
+func TestExportAuditLog_SignedAndVerifiable(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	rows, entries := auditRows(t, 3)
+	mock.ExpectQuery(`FROM admin_audit_log`).WillReturnRows(rows)
+
+	database := db.NewFromPool(sqlDB)
+	configService, err := config.NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := &Handler{database: database, configService: configService}
+	router := gin.New()
+	router.GET("/api/v1/admin/audit/export", handler.ExportAuditLog)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/audit/export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+
+	var export audit.Export
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if export.HeadSeq != 3 || export.HeadHash != entries[2].Hash {
+		t.Errorf("head: got seq %d hash %s, want seq 3 hash %s", export.HeadSeq, export.HeadHash, entries[2].Hash)
+	}
+	if export.KeyID != config.KeyID(export.PublicKey) {
+		t.Errorf("key_id %s does not match public key", export.KeyID)
+	}
+	if err := audit.VerifyExport(&export, ed25519.PublicKey(export.PublicKey)); err != nil {
+		t.Errorf("VerifyExport: %v", err)
+	}
+}
+
+func TestExportAuditLog_RefusesBrokenChain(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	_, entries := auditRows(t, 2)
+	rows := sqlmock.NewRows([]string{
+		"seq", "actor", "action", "subject_type", "subject_id", "details", "created_at", "prev_hash", "hash",
+	})
+	for _, e := range entries {
+		rows.AddRow(e.Seq, "mallory", e.Action, e.SubjectType, e.SubjectID, string(e.Details), e.CreatedAt, e.PrevHash, e.Hash)
+	}
+	mock.ExpectQuery(`FROM admin_audit_log`).WillReturnRows(rows)
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.GET("/api/v1/admin/audit/export", handler.ExportAuditLog)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/audit/export", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("status: got %d, want 409 (%s)", w.Code, w.Body.String())
+	}
+}
+
+// expectAuditAppend expects an audit entry to be appended to an empty chain
+// in the open transaction
+func expectAuditAppend(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`LOCK TABLE admin_audit_log`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT seq, hash FROM admin_audit_log`).WillReturnRows(sqlmock.NewRows([]string{"seq", "hash"}))
+	mock.ExpectExec(`INSERT INTO admin_audit_log`).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// asAdmin authenticates every request as the named admin credential
+func asAdmin(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ContextAdminActor, name)
+	}
+}
+
+func TestPutRollout_RecordsAuditEntry(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// The rollout and its audit entry commit together, under the name of
+	// the credential rather than a header the caller chooses
+	_, entries := auditRows(t, 1)
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO rollouts`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`LOCK TABLE admin_audit_log`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT seq, hash FROM admin_audit_log`).
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "hash"}).AddRow(1, entries[0].Hash))
+	mock.ExpectExec(`INSERT INTO admin_audit_log`).
+		WithArgs(int64(2), "alice", AuditRolloutPut, "rollout", "scan_interval_120",
+			`{"percentage":25,"region":"me-south-1"}`, sqlmock.AnyArg(), entries[0].Hash, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.Use(asAdmin("alice"))
+	router.PUT("/api/v1/admin/rollouts/:key", handler.PutRollout)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/rollouts/scan_interval_120",
+		bytes.NewReader([]byte(`{"region":"me-south-1","percentage":25}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Admin-Actor", "mallory")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAudited_FailedAppendRollsBackMutation(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM rollouts`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`LOCK TABLE admin_audit_log`).WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectRollback()
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.DELETE("/api/v1/admin/rollouts/:key", handler.DeleteRollout)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/admin/rollouts/scan_interval_120", nil))
+
+	// Without its audit entry the delete is not committed
+	if w.Code == http.StatusNoContent {
+		t.Errorf("status: got 204 for a change without an audit entry")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+)
+
+var enrollmentRegionPattern = regexp.MustCompile(`^[a-z0-9-]{1,10}$`)
+
+// bootstrapSecretLen is the size of the transport secret issued to a newly
+// enrolled gateway
+const bootstrapSecretLen = 32
+
+// EnrollmentTokenRequest asks for a token that registers one gateway for an
+// operator in a region
+type EnrollmentTokenRequest struct {
+	OperatorID string `json:"operator_id" binding:"required"`
+	Region     string `json:"region" binding:"required"`
+	TTLSeconds int    `json:"ttl_seconds,omitempty"` // Defaults to 24 hours; at most 7 days
+}
+
+// EnrollmentTokenResponse carries a new enrollment token. The token is only
+// ever returned here.
+type EnrollmentTokenResponse struct {
+	ID         string    `json:"id"`
+	Token      string    `json:"token"`
+	OperatorID string    `json:"operator_id"`
+	Region     string    `json:"region"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// GatewayBootstrapRequest is sent once by a new gateway agent. The
+// operator and region come from the enrollment token.
+type GatewayBootstrapRequest struct {
+	EnrollmentToken   string   `json:"enrollment_token" binding:"required"`
+	PublicKey         []byte   `json:"public_key" binding:"required"` // base64; the agent's ed25519 key
+	IPAddress         string   `json:"ip_address" binding:"required"`
+	Port              int      `json:"port" binding:"required"`
+	TransportTypes    []string `json:"transport_types" binding:"required" enum:"masque,xtls,parasite,ssh"`
+	DiscoveryChannels []string `json:"discovery_channels" enum:"gps,fm_rds,dtv,plc,gsm_cb,lte_sib,iot_mqtt,blockchain,satellite,intranet,social"`
+	BandwidthMbps     *int     `json:"bandwidth_mbps"`
+	MaxUsers          *int     `json:"max_users"`
+	ASN               *int     `json:"asn"`
+}
+
+// CreateEnrollmentToken issues a single-use gateway enrollment token
+func (h *Handler) CreateEnrollmentToken(c *gin.Context) {
+	var req EnrollmentTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.OperatorID) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_field_length"})
+		return
+	}
+	if !enrollmentRegionPattern.MatchString(req.Region) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_region"})
+		return
+	}
+	ttl := gateway.DefaultEnrollmentTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl <= 0 || ttl > gateway.MaxEnrollmentTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_ttl"})
+		return
+	}
+
+	var token string
+	var stored *db.EnrollmentToken
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		var err error
+		if token, stored, err = h.registry.IssueEnrollmentToken(ctx, req.OperatorID, req.Region, auditActor(c), ttl, h.now().UTC()); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditEnrollmentTokenCreate, SubjectType: "enrollment_token", SubjectID: stored.ID, Details: map[string]interface{}{
+			"operator_id": stored.OperatorID,
+			"region":      stored.Region,
+			"expires_at":  stored.ExpiresAt,
+		}}, nil
+	})
+	if err != nil {
+		respondError(c, err, "enrollment_token_create_failed")
+		return
+	}
+
+	c.JSON(http.StatusCreated, EnrollmentTokenResponse{
+		ID:         stored.ID,
+		Token:      token,
+		OperatorID: stored.OperatorID,
+		Region:     stored.Region,
+		ExpiresAt:  stored.ExpiresAt,
+	})
+}
+
+// BootstrapGateway redeems an enrollment token and registers the calling
+// agent in one step. The signed response carries the gateway ID,
+// credentials, transport settings and heartbeat schedule. Registrations over
+// quota are still pending approval (202), as with RegisterGateway.
+func (h *Handler) BootstrapGateway(c *gin.Context) {
+	var req GatewayBootstrapRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if code := validateGatewayCapabilities(req.PublicKey, req.Port, req.TransportTypes, req.DiscoveryChannels, req.BandwidthMbps, req.MaxUsers); code != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": code})
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := h.now().UTC()
+	registration := &gateway.Registration{
+		PublicKey:         req.PublicKey,
+		IPAddress:         req.IPAddress,
+		Port:              req.Port,
+		TransportTypes:    req.TransportTypes,
+		DiscoveryChannels: req.DiscoveryChannels,
+		BandwidthMbps:     req.BandwidthMbps,
+		MaxUsers:          req.MaxUsers,
+		ASN:               req.ASN,
+	}
+	result, token, err := h.registry.Enroll(ctx, req.EnrollmentToken, registration, now)
+	if err != nil {
+		respondError(c, err, "gateway_bootstrap_failed")
+		return
+	}
+
+	bootstrap := &config.GatewayBootstrap{
+		GatewayID:      result.GatewayID,
+		OperatorID:     token.OperatorID,
+		Region:         token.Region,
+		ApprovalStatus: result.ApprovalStatus,
+		Transports:     h.configService.GatewayTransports(ctx, token.Region, req.TransportTypes),
+		Heartbeat:      h.heartbeat,
+		IssuedAt:       now.Unix(),
+	}
+	bootstrap.Credentials.TransportSecret = h.issueBootstrapSecret(c, result.GatewayID, now)
+	if err := h.configService.SignGatewayBootstrap(bootstrap); err != nil {
+		respondError(c, err, "gateway_bootstrap_failed")
+		return
+	}
+
+	status := http.StatusCreated
+	if result.ApprovalStatus == gateway.ApprovalPending {
+		status = http.StatusAccepted
+	}
+	c.JSON(status, bootstrap)
+}
+
+// issueBootstrapSecret gives a new gateway its first transport secret. It
+// returns nil when secrets are not configured or the secret could not be
+// stored; the gateway can still set one with PutGatewaySecret.
+func (h *Handler) issueBootstrapSecret(c *gin.Context, gatewayID string, now time.Time) []byte {
+	if h.gatewaySecrets == nil {
+		return nil
+	}
+	secret := make([]byte, bootstrapSecretLen)
+	if _, err := rand.Read(secret); err != nil {
+		log.Printf("bootstrap secret for gateway %s not generated: %v", gatewayID, err)
+		return nil
+	}
+	if _, _, err := h.gatewaySecrets.Rotate(c.Request.Context(), gatewayID, secret, now); err != nil {
+		log.Printf("bootstrap secret for gateway %s not stored: %v", gatewayID, err)
+		return nil
+	}
+	return secret
+}
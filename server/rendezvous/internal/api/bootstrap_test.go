@@ -0,0 +1,271 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/attestation"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+	"rendezvous/internal/geo"
+)
+
+const (
+	bootstrapPath = "/api/v1/gateway/bootstrap"
+	statusPath    = "/api/v1/gateway/status"
+)
+
+func bootstrapRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	database := db.NewFromPool(sqlDB)
+	configSvc, err := config.NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := NewHandler(configSvc, attestation.NewAttestationService(database), geo.NewBalancer(database), database)
+
+	router := gin.New()
+	router.POST(bootstrapPath, handler.BootstrapGateway)
+	router.POST(statusPath, handler.HandleGatewayStatus)
+	router.POST("/api/v1/admin/enrollment-tokens", asAdmin("ops@example.org"), handler.CreateEnrollmentToken)
+	return router, mock
+}
+
+func signedHeartbeat(gatewayID string, privateKey ed25519.PrivateKey) *http.Request {
+	body, _ := json.Marshal(map[string]interface{}{
+		"gateway_id":      gatewayID,
+		"status":          "active",
+		"users_connected": 2,
+		"uptime_percent":  100.0,
+	})
+	timestamp := time.Now().Unix()
+	message := gateway.RequestBodyMessage(gatewayID, statusPath, timestamp, body)
+	req := httptest.NewRequest(http.MethodPost, statusPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gateway-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Gateway-Signature", base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, message)))
+	return req
+}
+
+func TestBootstrapGateway_EnrollsAndHeartbeats(t *testing.T) {
+	router, mock := bootstrapRouter(t)
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Now().UTC()
+
+	// An admin issues a token
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateway_enrollment_tokens`).
+		WithArgs(sqlmock.AnyArg(), "op-1", "me-south-1", "ops@example.org", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("tok-1", now))
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/enrollment-tokens",
+		bytes.NewReader([]byte(`{"operator_id":"op-1","region":"me-south-1"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := serve(router, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("token: status %d (%s)", w.Code, w.Body.String())
+	}
+	var issued EnrollmentTokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &issued); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if issued.Token == "" || issued.ExpiresAt.Sub(now) < 23*time.Hour {
+		t.Fatalf("token: got %+v, want a token valid for a day", issued)
+	}
+
+	// The agent bootstraps with it
+	mock.ExpectQuery(`UPDATE gateway_enrollment_tokens SET used_at`).
+		WithArgs(gateway.HashEnrollmentToken(issued.Token), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "operator_id", "region", "created_by", "created_at", "expires_at", "used_at"}).
+			AddRow("tok-1", "op-1", "me-south-1", "ops@example.org", now, issued.ExpiresAt, now))
+	mock.ExpectQuery(`SELECT COUNT`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`SELECT COUNT`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testGatewayID))
+	mock.ExpectCommit()
+	mock.ExpectExec(`UPDATE gateway_enrollment_tokens SET gateway_id`).
+		WithArgs("tok-1", testGatewayID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	w = postJSON(t, router, bootstrapPath, map[string]interface{}{
+		"enrollment_token": issued.Token,
+		"public_key":       []byte(publicKey),
+		"ip_address":       "192.0.2.1",
+		"port":             443,
+		"transport_types":  []string{"masque"},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("bootstrap: status %d (%s)", w.Code, w.Body.String())
+	}
+	var bootstrap config.GatewayBootstrap
+	if err := json.Unmarshal(w.Body.Bytes(), &bootstrap); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !config.VerifyGatewayBootstrap(&bootstrap, bootstrap.Credentials.ConfigPublicKey) {
+		t.Error("bootstrap signature does not verify")
+	}
+	if bootstrap.GatewayID != testGatewayID || bootstrap.OperatorID != "op-1" || bootstrap.Region != "me-south-1" {
+		t.Errorf("bootstrap: got %+v", bootstrap)
+	}
+	if len(bootstrap.Transports) != 1 || bootstrap.Transports[0].Type != "masque" {
+		t.Errorf("transports: got %+v, want masque only", bootstrap.Transports)
+	}
+	if bootstrap.Heartbeat.IntervalSeconds <= 0 || bootstrap.Heartbeat.StaleAfterSeconds <= bootstrap.Heartbeat.IntervalSeconds {
+		t.Errorf("heartbeat: got %+v", bootstrap.Heartbeat)
+	}
+
+	// Its first heartbeat authenticates with the enrolled key
+	mock.ExpectQuery(`WHERE id = \$1`).WithArgs(testGatewayID).WillReturnRows(operatorGatewayRows(publicKey, "op-1", nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE gateways SET status`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO operator_metrics`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	w = serve(router, signedHeartbeat(bootstrap.GatewayID, privateKey))
+	if w.Code != http.StatusOK {
+		t.Fatalf("heartbeat: status %d (%s)", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandleGatewayStatus_RejectsWrongKey(t *testing.T) {
+	router, mock := bootstrapRouter(t)
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	mock.ExpectQuery(`WHERE id = \$1`).WillReturnRows(operatorGatewayRows(publicKey, "op-1", nil))
+
+	w := serve(router, signedHeartbeat(testGatewayID, otherKey))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status: got %d, want 401 (%s)", w.Code, w.Body.String())
+	}
+	// Nothing is recorded
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBootstrapGateway_Rejected(t *testing.T) {
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	tests := []struct {
+		name    string
+		usedAt  interface{}
+		found   bool
+		status  int
+		errCode string
+	}{
+		{"unknown token", nil, false, http.StatusUnauthorized, "invalid_enrollment_token"},
+		{"used token", time.Now(), true, http.StatusConflict, "enrollment_token_used"},
+		{"expired token", nil, true, http.StatusUnauthorized, "enrollment_token_expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := bootstrapRouter(t)
+			mock.ExpectQuery(`UPDATE gateway_enrollment_tokens SET used_at`).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			rows := sqlmock.NewRows([]string{"used_at"})
+			if tt.found {
+				rows.AddRow(tt.usedAt)
+			}
+			mock.ExpectQuery(`SELECT used_at FROM gateway_enrollment_tokens`).WillReturnRows(rows)
+
+			w := postJSON(t, router, bootstrapPath, map[string]interface{}{
+				"enrollment_token": "token",
+				"public_key":       []byte(publicKey),
+				"ip_address":       "192.0.2.1",
+				"port":             443,
+				"transport_types":  []string{"masque"},
+			})
+			if w.Code != tt.status {
+				t.Fatalf("status: got %d, want %d (%s)", w.Code, tt.status, w.Body.String())
+			}
+			var resp map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if resp["error"] != tt.errCode {
+				t.Errorf("error: got %v, want %s", resp["error"], tt.errCode)
+			}
+		})
+	}
+}
+
+func TestBootstrapGateway_InvalidRequest(t *testing.T) {
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	tests := []struct {
+		name string
+		body map[string]interface{}
+	}{
+		{"missing token", map[string]interface{}{
+			"public_key": []byte(publicKey), "ip_address": "192.0.2.1", "port": 443, "transport_types": []string{"masque"},
+		}},
+		{"short key", map[string]interface{}{
+			"enrollment_token": "token", "public_key": []byte("short"), "ip_address": "192.0.2.1", "port": 443, "transport_types": []string{"masque"},
+		}},
+		{"unknown transport", map[string]interface{}{
+			"enrollment_token": "token", "public_key": []byte(publicKey), "ip_address": "192.0.2.1", "port": 443, "transport_types": []string{"carrier-pigeon"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := bootstrapRouter(t)
+			w := postJSON(t, router, bootstrapPath, tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status: got %d, want 400 (%s)", w.Code, w.Body.String())
+			}
+			// The token is not spent on a bad request
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCreateEnrollmentToken_InvalidRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		errCode string
+	}{
+		{"bad region", `{"operator_id":"op-1","region":"Not A Region"}`, "invalid_region"},
+		{"negative ttl", `{"operator_id":"op-1","region":"us-east-1","ttl_seconds":-1}`, "invalid_ttl"},
+		{"ttl too long", `{"operator_id":"op-1","region":"us-east-1","ttl_seconds":864000}`, "invalid_ttl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := bootstrapRouter(t)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/enrollment-tokens", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := serve(router, req)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status: got %d, want 400 (%s)", w.Code, w.Body.String())
+			}
+			var resp map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if resp["error"] != tt.errCode {
+				t.Errorf("error: got %v, want %s", resp["error"], tt.errCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/metrics"
+	"rendezvous/internal/sanitize"
+)
+
+// allowedClientErrorCodes is the closed set of error codes clients may report.
+// Free-form messages and stack traces are deliberately not accepted.
+var allowedClientErrorCodes = map[string]struct{}{
+	"pack_signature_invalid":   {},
+	"pack_expired":             {},
+	"pack_parse_failed":        {},
+	"transport_unusable":       {},
+	"gateway_unreachable":      {},
+	"clock_skew":               {},
+	"discovery_failed":         {},
+	"attestation_unavailable":  {},
+	"config_fetch_failed":      {},
+	"pack_verification_failed": {},
+}
+
+var allowedClientPlatforms = map[string]struct{}{
+	"android": {},
+	"ios":     {},
+	"desktop": {},
+}
+
+// Client error context limits
+const (
+	maxClientErrorContextKeys  = 8
+	maxClientErrorContextValue = 128
+)
+
+var (
+	clientVersionPattern   = regexp.MustCompile(`^[0-9A-Za-z.+-]{1,32}$`)
+	clientContextKeyFormat = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+	keyIDPattern           = regexp.MustCompile(`^[0-9a-f]{16}$`)
+	clientReleasePattern   = regexp.MustCompile(`^v?([0-9]{1,2})\.([0-9]{1,2})(?:[.+-]|$)`)
+)
+
+// clientVersionLabel reduces a reported client version to its major.minor
+// release for the ClientErrors metric, so clients cannot mint new series.
+// Anything else is "other"; the full version is only stored in client_errors.
+func clientVersionLabel(version string) string {
+	m := clientReleasePattern.FindStringSubmatch(version)
+	if m == nil {
+		return "other"
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return strconv.Itoa(major) + "." + strconv.Itoa(minor)
+}
+
+// ClientErrorRequest represents a structured client error report
+type ClientErrorRequest struct {
+	Code          string            `json:"code" binding:"required"`
+	ClientVersion string            `json:"client_version" binding:"required"`
+	Platform      string            `json:"platform" binding:"required" enum:"android,ios,desktop"`
+	Context       map[string]string `json:"context,omitempty"` // Small key/value details, e.g. transport type
+}
+
+// ClientErrorResponse represents a client error report response
+type ClientErrorResponse struct {
+	Recorded bool `json:"recorded"`
+}
+
+// validateClientError checks a report against the enumerated codes and size limits.
+// It returns an API error code, or "" if the report is acceptable.
+func validateClientError(req *ClientErrorRequest) string {
+	if _, ok := allowedClientErrorCodes[req.Code]; !ok {
+		return "invalid_error_code"
+	}
+	if _, ok := allowedClientPlatforms[req.Platform]; !ok {
+		return "invalid_platform"
+	}
+	if !clientVersionPattern.MatchString(req.ClientVersion) {
+		return "invalid_client_version"
+	}
+	if len(req.Context) > maxClientErrorContextKeys {
+		return "context_too_large"
+	}
+	for key, value := range req.Context {
+		if !clientContextKeyFormat.MatchString(key) {
+			return "invalid_context"
+		}
+		if len(value) > maxClientErrorContextValue {
+			return "context_too_large"
+		}
+	}
+	if req.Code == "pack_verification_failed" {
+		// Both key IDs are needed to attribute the failure to a key rotation
+		if !keyIDPattern.MatchString(req.Context["trusted_key_id"]) ||
+			!keyIDPattern.MatchString(req.Context["pack_key_id"]) {
+			return "invalid_key_id"
+		}
+	}
+	return ""
+}
+
+// ReportClientError handles structured client error reports
+func (h *Handler) ReportClientError(c *gin.Context) {
+	var req ClientErrorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if code := validateClientError(&req); code != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": code})
+		return
+	}
+	for key, value := range req.Context {
+		req.Context[key] = sanitize.Text(value, maxClientErrorContextValue)
+	}
+
+	if h.database != nil {
+		var regionPtr *string
+		if country := c.GetHeader("CF-IPCountry"); country != "" {
+			region := h.mapCountryToRegion(country)
+			regionPtr = &region
+		}
+
+		if err := h.database.RecordClientError(
+			c.Request.Context(),
+			req.Code,
+			req.ClientVersion,
+			req.Platform,
+			req.Context,
+			regionPtr,
+		); err != nil {
+			respondError(c, err, "client_error_store_failed")
+			return
+		}
+		if req.Code == "transport_unusable" {
+			h.recordEndpointFailure(c, req.Context)
+		}
+	}
+	metrics.ClientErrors.WithLabelValues(req.Code, clientVersionLabel(req.ClientVersion)).Inc()
+	if req.Code == "pack_verification_failed" && h.verification != nil {
+		h.verification.RecordFailure(req.Context["trusted_key_id"], req.Context["pack_key_id"])
+	}
+
+	c.JSON(http.StatusOK, ClientErrorResponse{Recorded: true})
+}
+
+// GetClientErrorSummary aggregates client error reports for the admin API
+func (h *Handler) GetClientErrorSummary(c *gin.Context) {
+	window, ok := parseWindow(c.DefaultQuery("window", "24h"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_window"})
+		return
+	}
+
+	counts, err := h.database.GetClientErrorCounts(c.Request.Context(), h.now().Add(-window))
+	if err != nil {
+		respondError(c, err, "client_error_fetch_failed")
+		return
+	}
+
+	var total int64
+	for _, count := range counts {
+		total += count.Count
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"window": c.DefaultQuery("window", "24h"),
+		"total":  total,
+		"counts": counts,
+	})
+}
+
+// GetPackVerificationFailures aggregates pack verification failures per key pair
+func (h *Handler) GetPackVerificationFailures(c *gin.Context) {
+	window, ok := parseWindow(c.DefaultQuery("window", "24h"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_window"})
+		return
+	}
+
+	counts, err := h.database.GetPackVerificationFailureCounts(c.Request.Context(), h.now().Add(-window))
+	if err != nil {
+		respondError(c, err, "client_error_fetch_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"window": c.DefaultQuery("window", "24h"),
+		"pairs":  counts,
+	})
+}
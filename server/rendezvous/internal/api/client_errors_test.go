@@ -0,0 +1,219 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+)
+
+func TestValidateClientError(t *testing.T) {
+	longValue := strings.Repeat("x", maxClientErrorContextValue+1)
+	tooManyKeys := map[string]string{}
+	for i := 0; i <= maxClientErrorContextKeys; i++ {
+		tooManyKeys[string(rune('a'+i))] = "v"
+	}
+
+	tests := []struct {
+		name string
+		req  ClientErrorRequest
+		want string
+	}{
+		{"valid", ClientErrorRequest{Code: "clock_skew", ClientVersion: "1.4.2", Platform: "android"}, ""},
+		{"valid with context", ClientErrorRequest{Code: "transport_unusable", ClientVersion: "1.4.2-beta+7", Platform: "ios",
+			Context: map[string]string{"transport": "xtls"}}, ""},
+		{"unknown code", ClientErrorRequest{Code: "segfault", ClientVersion: "1.0", Platform: "android"}, "invalid_error_code"},
+		{"unknown platform", ClientErrorRequest{Code: "clock_skew", ClientVersion: "1.0", Platform: "web"}, "invalid_platform"},
+		{"bad version", ClientErrorRequest{Code: "clock_skew", ClientVersion: "1.0; DROP TABLE", Platform: "android"}, "invalid_client_version"},
+		{"oversized value", ClientErrorRequest{Code: "clock_skew", ClientVersion: "1.0", Platform: "android",
+			Context: map[string]string{"detail": longValue}}, "context_too_large"},
+		{"too many keys", ClientErrorRequest{Code: "clock_skew", ClientVersion: "1.0", Platform: "android",
+			Context: tooManyKeys}, "context_too_large"},
+		{"verification failure", ClientErrorRequest{Code: "pack_verification_failed", ClientVersion: "2.0.1", Platform: "android",
+			Context: map[string]string{"trusted_key_id": "0123456789abcdef", "pack_key_id": "fedcba9876543210"}}, ""},
+		{"verification failure without key ids", ClientErrorRequest{Code: "pack_verification_failed", ClientVersion: "2.0.1",
+			Platform: "android"}, "invalid_key_id"},
+		{"verification failure with bad key id", ClientErrorRequest{Code: "pack_verification_failed", ClientVersion: "2.0.1",
+			Platform: "android", Context: map[string]string{"trusted_key_id": "ZZZ", "pack_key_id": "fedcba9876543210"}}, "invalid_key_id"},
+		{"bad key", ClientErrorRequest{Code: "clock_skew", ClientVersion: "1.0", Platform: "android",
+			Context: map[string]string{"Stack Trace": "..."}}, "invalid_context"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validateClientError(&tt.req); got != tt.want {
+				t.Errorf("validateClientError() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientVersionLabel(t *testing.T) {
+	tests := map[string]string{
+		"1.4.2":        "1.4",
+		"1.4.2-beta+7": "1.4",
+		"v2.10":        "2.10",
+		"01.04.9":      "1.4",
+		"1.4-rc1":      "1.4",
+		"1":            "other",
+		"1.400.2":      "other",
+		"1.4beta":      "other",
+		"nightly-3f2a": "other",
+	}
+	for version, want := range tests {
+		if got := clientVersionLabel(version); got != want {
+			t.Errorf("clientVersionLabel(%q) = %q, want %q", version, got, want)
+		}
+	}
+}
+
+func TestReportClientError_Stored(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectExec(`INSERT INTO client_errors`).
+		WithArgs("transport_unusable", "2.0.1", "android", []byte(`{"transport":"masque"}`), "me-south-1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.POST("/api/v1/client/errors", handler.ReportClientError)
+
+	body := []byte(`{"code":"transport_unusable","client_version":"2.0.1","platform":"android","context":{"transport":"masque"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/client/errors", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("CF-IPCountry", "IR")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReportClientError_CountsEndpointFailure(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	database := db.NewFromPool(sqlDB)
+	configService, err := config.NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	mock.ExpectExec(`INSERT INTO client_errors`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE endpoint_allocations SET failures = failures \+ 1`).
+		WithArgs(configService.EndpointEpoch(), "masque", "a.example").
+		WillReturnError(errors.New("connection reset"))
+
+	handler := &Handler{database: database, configService: configService}
+	router := gin.New()
+	router.POST("/api/v1/client/errors", handler.ReportClientError)
+
+	// A failure to count the endpoint does not fail the report
+	body := []byte(`{"code":"transport_unusable","client_version":"2.0.1","platform":"android","context":{"transport":"masque","endpoint":"a.example"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/client/errors", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReportClientError_RejectsUnknownCode(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.POST("/api/v1/client/errors", handler.ReportClientError)
+
+	body := []byte(`{"code":"java.lang.NullPointerException","client_version":"2.0.1","platform":"android"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/client/errors", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status: got %d, want 400", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("nothing should be stored: %v", err)
+	}
+}
+
+func TestGetClientErrorSummary(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`SELECT code, client_version, platform, COUNT\(\*\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"code", "client_version", "platform", "count"}).
+			AddRow("pack_signature_invalid", "2.0.1", "android", 12).
+			AddRow("clock_skew", "1.9.0", "ios", 3))
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.GET("/api/v1/admin/client-errors", handler.GetClientErrorSummary)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/client-errors?window=7d", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200", w.Code)
+	}
+	var resp struct {
+		Window string                `json:"window"`
+		Total  int64                 `json:"total"`
+		Counts []db.ClientErrorCount `json:"counts"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if resp.Window != "7d" || resp.Total != 15 || len(resp.Counts) != 2 {
+		t.Errorf("response: got %+v", resp)
+	}
+	if resp.Counts[0].Code != "pack_signature_invalid" || resp.Counts[0].Count != 12 {
+		t.Errorf("first count: got %+v", resp.Counts[0])
+	}
+}
+
+func TestGetClientErrorSummary_InvalidWindow(t *testing.T) {
+	handler := &Handler{}
+	router := gin.New()
+	router.GET("/api/v1/admin/client-errors", handler.GetClientErrorSummary)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/client-errors?window=forever", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status: got %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JSON field names follow one convention: snake_case, timestamps end in _at,
+// windows are starts_at/ends_at, and attestation verdicts are
+// device_integrity. A few fields shipped under other names. Requests accept
+// both the legacy and the canonical name, the canonical one winning when both
+// are sent. Responses carry both unless the client negotiates version 2.
+//
+// Renamed fields:
+//
+//	rollout schedule     start_at, end_at   -> starts_at, ends_at
+//	gateway listings     last_seen          -> last_seen_at
+//	adversarial activity first_seen, last_seen -> first_seen_at, last_seen_at
+//	pack preview         integrity          -> device_integrity
+//
+// bandwidth_used_mbps keeps its name but accepts fractional values, which
+// are rounded to whole Mbps.
+
+// apiVersionHeader negotiates the response version. Clients send it with the
+// version they understand and the server echoes the version it used.
+const apiVersionHeader = "X-API-Version"
+
+const (
+	// responseVersionLegacy responses carry legacy field names next to the
+	// canonical ones. It is the default until shipped clients have moved on.
+	responseVersionLegacy = 1
+	// responseVersionCurrent responses carry canonical field names only
+	responseVersionCurrent = 2
+)
+
+// responseVersion returns the response version the client asked for.
+// Missing, malformed and unknown older versions get the legacy format;
+// anything newer gets the current one.
+func responseVersion(c *gin.Context) int {
+	version, err := strconv.Atoi(c.GetHeader(apiVersionHeader))
+	if err != nil || version < responseVersionCurrent {
+		return responseVersionLegacy
+	}
+	return responseVersionCurrent
+}
+
+// legacyFieldNames reports whether the response should also carry legacy
+// field names. It echoes the negotiated version, and marks legacy responses
+// deprecated so clients can spot them.
+func legacyFieldNames(c *gin.Context) bool {
+	version := responseVersion(c)
+	c.Header(apiVersionHeader, strconv.Itoa(version))
+	if version == responseVersionLegacy {
+		c.Header("Deprecation", "true")
+		return true
+	}
+	return false
+}
+
+// legacyTime returns t for legacy responses and nil otherwise, so the legacy
+// field is omitted
+func legacyTime(legacy bool, t time.Time) *time.Time {
+	if !legacy || t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// UnmarshalJSON accepts start_at and end_at as legacy names for starts_at
+// and ends_at
+func (r *RolloutScheduleRequest) UnmarshalJSON(data []byte) error {
+	type plain RolloutScheduleRequest
+	var v struct {
+		plain
+		StartAt *time.Time `json:"start_at"`
+		EndAt   *time.Time `json:"end_at"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.StartsAt.IsZero() && v.StartAt != nil {
+		v.StartsAt = *v.StartAt
+	}
+	if v.EndsAt.IsZero() && v.EndAt != nil {
+		v.EndsAt = *v.EndAt
+	}
+	*r = RolloutScheduleRequest(v.plain)
+	return nil
+}
+
+// UnmarshalJSON accepts integrity as the legacy name for device_integrity
+func (r *PackPreviewRequest) UnmarshalJSON(data []byte) error {
+	type plain PackPreviewRequest
+	var v struct {
+		plain
+		Integrity *string `json:"integrity"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.DeviceIntegrity == "" && v.Integrity != nil {
+		v.DeviceIntegrity = *v.Integrity
+	}
+	*r = PackPreviewRequest(v.plain)
+	return nil
+}
+
+// UnmarshalJSON accepts a fractional bandwidth_used_mbps and rounds it to
+// the nearest whole Mbps; agents that measure fractions got a decode error
+// before
+func (r *GatewayStatusRequest) UnmarshalJSON(data []byte) error {
+	type plain GatewayStatusRequest
+	var v struct {
+		plain
+		BandwidthUsedMbps *float64 `json:"bandwidth_used_mbps"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.BandwidthUsedMbps != nil {
+		mbps := math.Round(*v.BandwidthUsedMbps)
+		if mbps > math.MaxInt32 || mbps < math.MinInt32 {
+			return errors.New("bandwidth_used_mbps out of range")
+		}
+		v.plain.BandwidthUsedMbps = int(mbps)
+	}
+	*r = GatewayStatusRequest(v.plain)
+	return nil
+}
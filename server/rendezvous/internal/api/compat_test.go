@@ -0,0 +1,253 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+)
+
+func TestResponseVersion(t *testing.T) {
+	tests := []struct {
+		header      string
+		want        int
+		wantLegacy  bool
+		deprecation string
+	}{
+		{"", responseVersionLegacy, true, "true"},
+		{"1", responseVersionLegacy, true, "true"},
+		{"banana", responseVersionLegacy, true, "true"},
+		{"2", responseVersionCurrent, false, ""},
+		{"3", responseVersionCurrent, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Request.Header.Set(apiVersionHeader, tt.header)
+
+			if got := responseVersion(c); got != tt.want {
+				t.Errorf("responseVersion: got %d, want %d", got, tt.want)
+			}
+			if got := legacyFieldNames(c); got != tt.wantLegacy {
+				t.Errorf("legacyFieldNames: got %v, want %v", got, tt.wantLegacy)
+			}
+			if got := w.Header().Get("Deprecation"); got != tt.deprecation {
+				t.Errorf("Deprecation: got %q, want %q", got, tt.deprecation)
+			}
+		})
+	}
+}
+
+func TestRolloutScheduleRequest_AcceptsBothNames(t *testing.T) {
+	starts := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	ends := time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"canonical", `{"starts_at":"2026-03-01T00:00:00Z","ends_at":"2026-03-04T00:00:00Z","start_percentage":5,"end_percentage":50}`},
+		{"legacy", `{"start_at":"2026-03-01T00:00:00Z","end_at":"2026-03-04T00:00:00Z","start_percentage":5,"end_percentage":50}`},
+		{"canonical wins", `{"starts_at":"2026-03-01T00:00:00Z","start_at":"2020-01-01T00:00:00Z","ends_at":"2026-03-04T00:00:00Z","end_at":"2020-01-02T00:00:00Z","start_percentage":5,"end_percentage":50}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req RolloutScheduleRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !req.StartsAt.Equal(starts) || !req.EndsAt.Equal(ends) {
+				t.Errorf("window: got %v to %v", req.StartsAt, req.EndsAt)
+			}
+			if *req.StartPercentage != 5 || *req.EndPercentage != 50 {
+				t.Errorf("percentages: got %d to %d", *req.StartPercentage, *req.EndPercentage)
+			}
+		})
+	}
+
+	var req RolloutScheduleRequest
+	if err := json.Unmarshal([]byte(`{"starts_at":"yesterday"}`), &req); err == nil {
+		t.Error("malformed starts_at accepted")
+	}
+}
+
+func TestPackPreviewRequest_AcceptsBothNames(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"canonical", `{"region":"us-east-1","device_integrity":"MEETS_DEVICE_INTEGRITY"}`, "MEETS_DEVICE_INTEGRITY"},
+		{"legacy", `{"region":"us-east-1","integrity":"MEETS_DEVICE_INTEGRITY"}`, "MEETS_DEVICE_INTEGRITY"},
+		{"canonical wins", `{"region":"us-east-1","device_integrity":"MEETS_STRONG_INTEGRITY","integrity":"MEETS_BASIC_INTEGRITY"}`, "MEETS_STRONG_INTEGRITY"},
+		{"unattested", `{"region":"us-east-1"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req PackPreviewRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if req.DeviceIntegrity != tt.want || req.Region != "us-east-1" {
+				t.Errorf("got %+v, want device_integrity %q", req, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatewayStatusRequest_Bandwidth(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    int
+		wantErr bool
+	}{
+		{"whole", `{"gateway_id":"gw","status":"active","bandwidth_used_mbps":120}`, 120, false},
+		{"fraction rounds down", `{"gateway_id":"gw","status":"active","bandwidth_used_mbps":12.4}`, 12, false},
+		{"fraction rounds up", `{"gateway_id":"gw","status":"active","bandwidth_used_mbps":12.5}`, 13, false},
+		{"absent", `{"gateway_id":"gw","status":"active"}`, 0, false},
+		{"out of range", `{"gateway_id":"gw","status":"active","bandwidth_used_mbps":1e12}`, 0, true},
+		{"string", `{"gateway_id":"gw","status":"active","bandwidth_used_mbps":"12"}`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req GatewayStatusRequest
+			err := json.Unmarshal([]byte(tt.body), &req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal: got %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (req.BandwidthUsedMbps != tt.want || req.GatewayID != "gw" || req.Status != "active") {
+				t.Errorf("got %+v, want %d Mbps", req, tt.want)
+			}
+		})
+	}
+}
+
+func TestRolloutResponse_WireFormats(t *testing.T) {
+	rollout := &db.Rollout{
+		Key:    "scan_interval_120",
+		Region: "",
+		Schedule: &db.RolloutSchedule{
+			StartAt:         time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+			EndAt:           time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC),
+			StartPercentage: 5,
+			EndPercentage:   50,
+			Easing:          db.EasingLinear,
+		},
+		Percentage: 5,
+		UpdatedAt:  time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC),
+	}
+	now := time.Date(2026, 2, 28, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		legacy bool
+		want   string
+	}{
+		{"version 1", true, `{"key":"scan_interval_120","region":"","percentage":5,"effective_percentage":5,` +
+			`"schedule":{"starts_at":"2026-03-01T00:00:00Z","ends_at":"2026-03-04T00:00:00Z","start_percentage":5,"end_percentage":50,"easing":"linear",` +
+			`"start_at":"2026-03-01T00:00:00Z","end_at":"2026-03-04T00:00:00Z"},"updated_at":"2026-02-28T00:00:00Z"}`},
+		{"version 2", false, `{"key":"scan_interval_120","region":"","percentage":5,"effective_percentage":5,` +
+			`"schedule":{"starts_at":"2026-03-01T00:00:00Z","ends_at":"2026-03-04T00:00:00Z","start_percentage":5,"end_percentage":50,"easing":"linear"},` +
+			`"updated_at":"2026-02-28T00:00:00Z"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(rolloutResponse(rollout, now, tt.legacy))
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminGatewayResponse_WireFormats(t *testing.T) {
+	lastSeen := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	response := AdminGatewayResponse{LastSeenAt: &lastSeen}
+
+	current, err := json.Marshal(response)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	response.LastSeen = &lastSeen
+	legacy, err := json.Marshal(response)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	for name, tt := range map[string]struct {
+		body       []byte
+		wantLegacy bool
+	}{"version 1": {legacy, true}, "version 2": {current, false}} {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(tt.body, &fields); err != nil {
+			t.Fatalf("%s: Unmarshal: %v", name, err)
+		}
+		if string(fields["last_seen_at"]) != `"2026-03-01T12:00:00Z"` {
+			t.Errorf("%s: last_seen_at: got %s", name, fields["last_seen_at"])
+		}
+		if _, ok := fields["last_seen"]; ok != tt.wantLegacy {
+			t.Errorf("%s: last_seen present: got %v, want %v", name, ok, tt.wantLegacy)
+		}
+	}
+}
+
+func TestGetAdversarialActivity_WireFormats(t *testing.T) {
+	firstSeen := time.Date(2026, 3, 1, 11, 0, 0, 0, time.UTC)
+	lastSeen := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"", `{"gateway_id":"hp-1","region":"me-south-1","channel":"dtv","attempts":120,"successes":118,"distinct_clients":37,` +
+			`"first_seen_at":"2026-03-01T11:00:00Z","last_seen_at":"2026-03-01T12:00:00Z",` +
+			`"first_seen":"2026-03-01T11:00:00Z","last_seen":"2026-03-01T12:00:00Z"}`},
+		{"2", `{"gateway_id":"hp-1","region":"me-south-1","channel":"dtv","attempts":120,"successes":118,"distinct_clients":37,` +
+			`"first_seen_at":"2026-03-01T11:00:00Z","last_seen_at":"2026-03-01T12:00:00Z"}`},
+	}
+	for _, tt := range tests {
+		t.Run("version "+tt.version, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+			mock.ExpectQuery(`WHERE dl.is_honeypot = TRUE`).
+				WillReturnRows(sqlmock.NewRows([]string{
+					"gateway_id", "region", "channel_type", "count", "successes", "clients", "first_seen", "last_seen",
+				}).AddRow("hp-1", "me-south-1", "dtv", 120, 118, 37, firstSeen, lastSeen))
+
+			handler := &Handler{database: db.NewFromPool(sqlDB)}
+			router := gin.New()
+			router.GET("/api/v1/admin/adversarial-activity", handler.GetAdversarialActivity)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/adversarial-activity", nil)
+			req.Header.Set(apiVersionHeader, tt.version)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want 200", w.Code)
+			}
+			var resp struct {
+				Activity []json.RawMessage `json:"activity"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("json.Unmarshal: %v", err)
+			}
+			if len(resp.Activity) != 1 || string(resp.Activity[0]) != tt.want {
+				t.Errorf("got  %s\nwant %s", resp.Activity, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content encodings config responses can be compressed with
+const (
+	encodingIdentity = "identity"
+	encodingGzip     = "gzip"
+	encodingZstd     = "zstd"
+)
+
+// zstdEncoder compresses config responses; EncodeAll is safe for concurrent use
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+
+// contentEncoding returns the encoding a config request asked for, from
+// its compress field or else its Accept-Encoding header, reporting false for
+// an unknown compress value. Of the encodings the header accepts, zstd is
+// preferred over gzip at equal quality; without either the response is
+// sent uncompressed.
+func contentEncoding(requested, acceptEncoding string) (string, bool) {
+	switch requested {
+	case encodingIdentity, encodingGzip, encodingZstd:
+		return requested, true
+	case "":
+	default:
+		return "", false
+	}
+
+	best, bestQuality := encodingIdentity, 0.0
+	quality := map[string]float64{}
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(entry, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		quality[coding] = q
+	}
+	for _, coding := range []string{encodingZstd, encodingGzip} {
+		q, ok := quality[coding]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > bestQuality {
+			best, bestQuality = coding, q
+		}
+	}
+	return best, true
+}
+
+// compressBody encodes body with encoding
+func compressBody(encoding string, body []byte) ([]byte, error) {
+	switch encoding {
+	case encodingGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case encodingZstd:
+		return zstdEncoder.EncodeAll(body, nil), nil
+	default:
+		return body, nil
+	}
+}
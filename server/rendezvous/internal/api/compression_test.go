@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+)
+
+func TestContentEncoding(t *testing.T) {
+	tests := []struct {
+		requested, accept string
+		want              string
+		wantOK            bool
+	}{
+		{"", "", encodingIdentity, true},
+		{"", "gzip", encodingGzip, true},
+		{"", "gzip, deflate, br, zstd", encodingZstd, true},
+		{"", "zstd;q=0.5, gzip", encodingGzip, true},
+		{"", "zstd;q=0, gzip;q=0", encodingIdentity, true},
+		{"", "*", encodingZstd, true},
+		{"", "*;q=0.2, zstd;q=0", encodingGzip, true},
+		{"", "br", encodingIdentity, true},
+		{"gzip", "zstd", encodingGzip, true},
+		{"identity", "gzip", encodingIdentity, true},
+		{"brotli", "", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := contentEncoding(tt.requested, tt.accept)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("contentEncoding(%q, %q) = %q, %v; want %q, %v", tt.requested, tt.accept, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestGetConfig_CompressedFormats(t *testing.T) {
+	tests := []struct {
+		name           string
+		fields         string
+		acceptEncoding string
+		wantEncoding   string
+		wantCBOR       bool
+	}{
+		{"uncompressed", ``, "", "", false},
+		{"gzip by header", ``, "gzip", "gzip", false},
+		{"zstd by field", `,"compress":"zstd"`, "gzip", "zstd", false},
+		{"cbor", `,"format":"cbor"`, "", "", true},
+		{"cbor and zstd", `,"format":"cbor"`, "zstd, gzip", "zstd", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+			mock.ExpectQuery(`FROM launch_open_regions`).WillReturnRows(sqlmock.NewRows([]string{"region"}))
+			mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+			mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+
+			configSvc, err := config.NewConfigService(db.NewFromPool(sqlDB))
+			if err != nil {
+				t.Fatalf("NewConfigService: %v", err)
+			}
+			handler := &Handler{configService: configSvc}
+			router := gin.New()
+			router.POST("/api/v1/config", handler.GetConfig)
+
+			body := `{"device_id":"device-1","platform":"android","region":"us-east-1","supported_pack_versions":["1.0","2.0"]` + tt.fields + `}`
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/config", bytes.NewReader([]byte(body)))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status: got %d (%s)", w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding: got %q, want %q", got, tt.wantEncoding)
+			}
+
+			var decoded []byte
+			switch tt.wantEncoding {
+			case "gzip":
+				r, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("gzip: %v", err)
+				}
+				decoded, err = io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("gzip: %v", err)
+				}
+			case "zstd":
+				r, err := zstd.NewReader(nil)
+				if err != nil {
+					t.Fatalf("zstd: %v", err)
+				}
+				if decoded, err = r.DecodeAll(w.Body.Bytes(), nil); err != nil {
+					t.Fatalf("zstd: %v", err)
+				}
+			default:
+				decoded = w.Body.Bytes()
+			}
+
+			var resp GetConfigResponse
+			pack := &config.SignedConfigPack{}
+			if tt.wantCBOR {
+				if got := w.Header().Get("Content-Type"); got != "application/cbor" {
+					t.Errorf("Content-Type: got %q", got)
+				}
+				if err := config.UnmarshalCBOR(decoded, &resp); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if resp.ConfigPack != nil {
+					t.Error("config_pack set alongside config_pack_cbor")
+				}
+				if pack, err = config.DecodePackCBOR(resp.ConfigPackCBOR); err != nil {
+					t.Fatalf("DecodePackCBOR: %v", err)
+				}
+			} else {
+				if err := json.Unmarshal(decoded, &resp); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				pack = resp.ConfigPack
+			}
+			if pack == nil || resp.PackVersion != config.PackVersion2 || !configSvc.VerifyConfigPack(pack) {
+				t.Errorf("pack does not verify: %+v", pack)
+			}
+		})
+	}
+
+	// Unknown encodings are refused before any work
+	handler := &Handler{}
+	router := gin.New()
+	router.POST("/api/v1/config", handler.GetConfig)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/config",
+		bytes.NewReader([]byte(`{"device_id":"device-1","platform":"android","compress":"brotli"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte("invalid_compression")) {
+		t.Errorf("unknown compress: got %d %s", w.Code, w.Body.String())
+	}
+}
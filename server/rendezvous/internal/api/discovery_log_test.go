@@ -0,0 +1,223 @@
+package api
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+	"rendezvous/internal/sanitize"
+)
+
+const testEventID = "9b2f4c1a-7d3e-4f60-8a91-2c5b6d7e8f90"
+
+// cutoffNear matches a dedupe cutoff within a few seconds of want
+type cutoffNear struct{ want time.Time }
+
+func (m cutoffNear) Match(v driver.Value) bool {
+	got, ok := v.(time.Time)
+	return ok && got.Sub(m.want) < 5*time.Second && m.want.Sub(got) < 5*time.Second
+}
+
+func discoveryLogRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.POST("/api/v1/discovery/log", handler.HandleDiscoveryLog)
+	router.POST("/api/v1/discovery/logs", handler.HandleDiscoveryLogBatch)
+	return router, mock
+}
+
+func postJSON(t *testing.T, router *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func expectClaim(mock sqlmock.Sqlmock, eventID string, claimed bool) {
+	var rows int64
+	if claimed {
+		rows = 1
+	}
+	mock.ExpectExec(`INSERT INTO discovery_log_events`).WithArgs(eventID, cutoffNear{time.Now().Add(-db.DiscoveryDedupeWindow)}).
+		WillReturnResult(sqlmock.NewResult(0, rows))
+}
+
+func expectDiscoveryInsert(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`INSERT INTO discovery_logs`).WillReturnRows(sqlmock.NewRows([]string{"is_honeypot"}).AddRow(false))
+}
+
+func TestHandleDiscoveryLog_DuplicateAcrossRequests(t *testing.T) {
+	router, mock := discoveryLogRouter(t)
+	for _, claimed := range []bool{true, false} {
+		mock.ExpectBegin()
+		expectClaim(mock, testEventID, claimed)
+		if claimed {
+			expectDiscoveryInsert(mock)
+		}
+		mock.ExpectCommit()
+	}
+
+	logged := metrics.DiscoveryLogs.WithLabelValues("gps", "true")
+	duplicates := metrics.DiscoveryLogDuplicates.WithLabelValues("gps")
+	loggedBefore, duplicatesBefore := testutil.ToFloat64(logged), testutil.ToFloat64(duplicates)
+
+	body := map[string]interface{}{"event_id": testEventID, "channel_type": "gps", "success": true}
+	var responses []DiscoveryLogResponse
+	for i := 0; i < 2; i++ {
+		w := postJSON(t, router, "/api/v1/discovery/log", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("post %d: status %d (%s)", i, w.Code, w.Body.String())
+		}
+		var resp DiscoveryLogResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		responses = append(responses, resp)
+	}
+
+	if !responses[0].Logged || responses[0].Duplicate || !responses[1].Logged || !responses[1].Duplicate {
+		t.Errorf("responses: got %+v, want the retry acknowledged as a duplicate", responses)
+	}
+	if got := testutil.ToFloat64(logged) - loggedBefore; got != 1 {
+		t.Errorf("discovery metric delta: got %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(duplicates) - duplicatesBefore; got != 1 {
+		t.Errorf("duplicate metric delta: got %v, want 1", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandleDiscoveryLogBatch_DedupesWithinBatch(t *testing.T) {
+	router, mock := discoveryLogRouter(t)
+	const otherEventID = "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+	mock.ExpectBegin()
+	expectClaim(mock, testEventID, true)
+	expectDiscoveryInsert(mock)
+	expectClaim(mock, otherEventID, true)
+	expectDiscoveryInsert(mock)
+	expectDiscoveryInsert(mock) // No event ID: always logged
+	mock.ExpectCommit()
+
+	w := postJSON(t, router, "/api/v1/discovery/logs", map[string]interface{}{
+		"entries": []map[string]interface{}{
+			{"event_id": testEventID, "channel_type": "dtv", "success": true},
+			{"event_id": otherEventID, "channel_type": "dtv", "success": false},
+			// The same attempt queued twice, once with an upper-case ID
+			{"event_id": "9B2F4C1A-7D3E-4F60-8A91-2C5B6D7E8F90", "channel_type": "dtv", "success": true},
+			{"channel_type": "dtv", "success": true},
+		},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d (%s)", w.Code, w.Body.String())
+	}
+	var resp DiscoveryLogBatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.Logged != 3 || resp.Duplicates != 1 {
+		t.Errorf("got %+v, want 3 logged and 1 duplicate", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandleDiscoveryLog_AcceptedAgainAfterWindow(t *testing.T) {
+	router, mock := discoveryLogRouter(t)
+	// A claim older than the window is taken over, so the ID claims again
+	// before the cleanup job has pruned it
+	mock.ExpectBegin()
+	mock.ExpectExec(`ON CONFLICT \(event_id\) DO UPDATE SET received_at = NOW\(\)\s+WHERE discovery_log_events.received_at < \$2`).
+		WithArgs(testEventID, cutoffNear{time.Now().Add(-db.DiscoveryDedupeWindow)}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectDiscoveryInsert(mock)
+	mock.ExpectCommit()
+
+	w := postJSON(t, router, "/api/v1/discovery/log", map[string]interface{}{"event_id": testEventID, "channel_type": "gps", "success": true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d (%s)", w.Code, w.Body.String())
+	}
+	var resp DiscoveryLogResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.Duplicate {
+		t.Error("an ID outside the window was treated as a duplicate")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandleDiscoveryLogBatch_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []map[string]interface{}
+		want    string
+	}{
+		{"empty", []map[string]interface{}{}, "invalid_batch_size"},
+		{"bad event id", []map[string]interface{}{{"event_id": "retry-1", "channel_type": "gps"}}, "invalid_event_id"},
+		{"bad channel", []map[string]interface{}{{"channel_type": "gps"}, {"channel_type": "smoke"}}, "invalid_channel_type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := discoveryLogRouter(t)
+			w := postJSON(t, router, "/api/v1/discovery/logs", map[string]interface{}{"entries": tt.entries})
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400", w.Code)
+			}
+			var resp map[string]interface{}
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp["error"] != tt.want {
+				t.Errorf("error: got %v, want %s", resp["error"], tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleDiscoveryLog_SanitizesError(t *testing.T) {
+	router, mock := discoveryLogRouter(t)
+	long := strings.Repeat("é", maxDiscoveryErrorLen)
+	want := strings.Repeat("é", (maxDiscoveryErrorLen-len(sanitize.Ellipsis))/2) + sanitize.Ellipsis
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO discovery_logs`).
+		WithArgs("gps", nil, sqlmock.AnyArg(), nil, nil, false, nil, want, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"is_honeypot"}).AddRow(false))
+	mock.ExpectCommit()
+
+	w := postJSON(t, router, "/api/v1/discovery/log", map[string]interface{}{
+		"channel_type": "gps",
+		"error":        "\x1b[31m\x00" + long + "\x1b[0m",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d (%s)", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
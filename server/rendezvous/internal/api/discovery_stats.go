@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+)
+
+// GetDiscoveryStats returns per-channel discovery success rates for the
+// community page. Honeypot-targeted logs are excluded.
+func (h *Handler) GetDiscoveryStats(c *gin.Context) {
+	window, ok := parseWindow(c.DefaultQuery("window", "24h"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_window"})
+		return
+	}
+
+	stats, err := h.database.GetDiscoveryStats(c.Request.Context(), h.now().Add(-window))
+	if err != nil {
+		respondError(c, err, "discovery_stats_fetch_failed")
+		return
+	}
+
+	c.Header("Cache-Control", statsCacheControl)
+	c.JSON(http.StatusOK, gin.H{
+		"window":   c.DefaultQuery("window", "24h"),
+		"channels": stats,
+	})
+}
+
+// GetAdversarialActivity lists discovery attempts against honeypot gateways,
+// grouped per honeypot and channel, for the admin API
+func (h *Handler) GetAdversarialActivity(c *gin.Context) {
+	window, ok := parseWindow(c.DefaultQuery("window", "24h"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_window"})
+		return
+	}
+
+	activity, err := h.database.GetHoneypotActivity(c.Request.Context(), h.now().Add(-window))
+	if err != nil {
+		respondError(c, err, "honeypot_activity_fetch_failed")
+		return
+	}
+
+	legacy := legacyFieldNames(c)
+	response := make([]honeypotActivityResponse, 0, len(activity))
+	for _, a := range activity {
+		response = append(response, honeypotActivityResponse{
+			HoneypotActivity: a,
+			FirstSeen:        legacyTime(legacy, a.FirstSeen),
+			LastSeen:         legacyTime(legacy, a.LastSeen),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"window":   c.DefaultQuery("window", "24h"),
+		"activity": response,
+	})
+}
+
+// honeypotActivityResponse adds the legacy field names of response version 1
+type honeypotActivityResponse struct {
+	db.HoneypotActivity
+	FirstSeen *time.Time `json:"first_seen,omitempty"` // Deprecated: first_seen_at
+	LastSeen  *time.Time `json:"last_seen,omitempty"`  // Deprecated: last_seen_at
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+func TestHandleDiscoveryLog_HoneypotKeptOutOfPublicMetric(t *testing.T) {
+	tests := []struct {
+		name       string
+		isHoneypot bool
+	}{
+		{"real gateway", false},
+		{"honeypot gateway", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`INSERT INTO discovery_logs`).
+				WillReturnRows(sqlmock.NewRows([]string{"is_honeypot"}).AddRow(tt.isHoneypot))
+			mock.ExpectCommit()
+
+			public := metrics.DiscoveryLogs.WithLabelValues("dtv", "true")
+			honeypot := metrics.HoneypotDiscoveryLogs.WithLabelValues("dtv", "true")
+			publicBefore, honeypotBefore := testutil.ToFloat64(public), testutil.ToFloat64(honeypot)
+
+			handler := &Handler{database: db.NewFromPool(sqlDB)}
+			router := gin.New()
+			router.POST("/api/v1/discovery/log", handler.HandleDiscoveryLog)
+
+			body := []byte(`{"channel_type":"dtv","gateway_id":"3f0c2a8e-8b1d-4c55-9d7a-0c1e2f3a4b5c","success":true}`)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/discovery/log", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+			}
+			wantPublic, wantHoneypot := 1.0, 0.0
+			if tt.isHoneypot {
+				wantPublic, wantHoneypot = 0, 1
+			}
+			if got := testutil.ToFloat64(public) - publicBefore; got != wantPublic {
+				t.Errorf("public discovery metric delta: got %v, want %v", got, wantPublic)
+			}
+			if got := testutil.ToFloat64(honeypot) - honeypotBefore; got != wantHoneypot {
+				t.Errorf("honeypot discovery metric delta: got %v, want %v", got, wantHoneypot)
+			}
+		})
+	}
+}
+
+func TestGetDiscoveryStats_ExcludesHoneypots(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`FROM discovery_logs\s+WHERE is_honeypot = FALSE`).
+		WillReturnRows(sqlmock.NewRows([]string{"channel_type", "count", "successes"}).
+			AddRow("dtv", 40, 30).
+			AddRow("gps", 10, 0))
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.GET("/api/v1/stats/discovery", handler.GetDiscoveryStats)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stats/discovery", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200", w.Code)
+	}
+	var resp struct {
+		Channels []db.DiscoveryChannelStats `json:"channels"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(resp.Channels) != 2 || resp.Channels[0].SuccessRate != 0.75 || resp.Channels[1].SuccessRate != 0 {
+		t.Errorf("channels: got %+v", resp.Channels)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetAdversarialActivity(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`WHERE dl.is_honeypot = TRUE`).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"gateway_id", "region", "channel_type", "count", "successes", "clients", "first_seen", "last_seen",
+		}).AddRow("hp-1", "me-south-1", "dtv", 120, 118, 37, now.Add(-time.Hour), now))
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.GET("/api/v1/admin/adversarial-activity", handler.GetAdversarialActivity)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/adversarial-activity?window=7d", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200", w.Code)
+	}
+	var resp struct {
+		Activity []db.HoneypotActivity `json:"activity"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(resp.Activity) != 1 || resp.Activity[0].GatewayID != "hp-1" || resp.Activity[0].DistinctClients != 37 {
+		t.Errorf("activity: got %+v", resp.Activity)
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+)
+
+// Endpoint burn report window, in epochs
+const (
+	defaultEndpointBurnEpochs = 7
+	maxEndpointBurnEpochs     = 90
+)
+
+// EndpointBurnResponse reports how much of each transport's endpoint pool
+// clients found unusable, per allocation epoch
+type EndpointBurnResponse struct {
+	Epoch int64              `json:"epoch"` // Current epoch; 0 when allocation is disabled
+	Burn  []*db.EndpointBurn `json:"burn"`
+}
+
+// GetEndpointBurn reports pool endpoint burn for the last epochs, default 7
+func (h *Handler) GetEndpointBurn(c *gin.Context) {
+	epochs, err := strconv.Atoi(c.DefaultQuery("epochs", strconv.Itoa(defaultEndpointBurnEpochs)))
+	if err != nil || epochs < 1 || epochs > maxEndpointBurnEpochs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_epochs"})
+		return
+	}
+	epoch := h.configService.EndpointEpoch()
+	burn, err := h.database.GetEndpointBurn(c.Request.Context(), epoch-int64(epochs)+1)
+	if err != nil {
+		respondError(c, err, "endpoint_burn_fetch_failed")
+		return
+	}
+	c.JSON(http.StatusOK, EndpointBurnResponse{Epoch: epoch, Burn: burn})
+}
+
+// recordEndpointFailure counts a transport_unusable report against the pool
+// endpoint it names, in the current epoch. Reports without one, or for
+// endpoints not allocated, are not counted; a failure to count does not fail
+// the report.
+func (h *Handler) recordEndpointFailure(c *gin.Context, report map[string]string) {
+	transport, endpoint := report["transport"], report["endpoint"]
+	if h.configService == nil || transport == "" || endpoint == "" {
+		return
+	}
+	epoch := h.configService.EndpointEpoch()
+	if epoch == 0 {
+		return
+	}
+	if err := h.database.RecordEndpointFailure(c.Request.Context(), epoch, transport, endpoint); err != nil {
+		log.Printf("endpoint failure not counted: %v", err)
+	}
+}
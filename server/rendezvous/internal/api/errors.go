@@ -0,0 +1,41 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/apperr"
+)
+
+// errorStatus maps an error from the db or service layers to an HTTP status
+// by its apperr kind; errors of no kind are internal errors.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, apperr.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, apperr.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, apperr.ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, apperr.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, apperr.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, apperr.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondError answers a failed request with the status for err. The error
+// code is the specific error's own (such as "gateway_not_found") when it has
+// one, otherwise fallback, which names what the handler was doing.
+func respondError(c *gin.Context, err error, fallback string) {
+	code := apperr.Code(err)
+	if code == "" {
+		code = fallback
+	}
+	c.JSON(errorStatus(err), gin.H{"error": code})
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/attestation"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+	"rendezvous/internal/i18n"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"not found", fmt.Errorf("load: %w", db.ErrGatewayNotFound), http.StatusNotFound},
+		{"conflict", fmt.Errorf("status: %w", db.ErrDuplicateSequence), http.StatusConflict},
+		{"invalid input", fmt.Errorf("parse: %w", i18n.ErrInvalidLocale), http.StatusBadRequest},
+		{"unauthorized", fmt.Errorf("register: %w", gateway.ErrInvalidConfirmation), http.StatusUnauthorized},
+		{"rate limited", fmt.Errorf("verify: %w", attestation.ErrTooManyVerifications), http.StatusTooManyRequests},
+		{"unavailable", fmt.Errorf("query: %w", apperr.WithKind(apperr.ErrUnavailable, errors.New("eof"))), http.StatusServiceUnavailable},
+		{"untyped", errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorStatus(tt.err); got != tt.want {
+				t.Errorf("errorStatus: got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteRollout_ErrorMapping(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(sqlmock.Sqlmock)
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			"not found",
+			func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM rollouts`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			http.StatusNotFound,
+			`{"error":"rollout_not_found"}`,
+		},
+		{
+			"database unavailable",
+			func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM rollouts`).WillReturnError(&pq.Error{Code: "57P01"})
+				mock.ExpectRollback()
+			},
+			http.StatusServiceUnavailable,
+			`{"error":"rollout_delete_failed"}`,
+		},
+		{
+			"unexpected error",
+			func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM rollouts`).WillReturnError(&pq.Error{Code: "42601"})
+				mock.ExpectRollback()
+			},
+			http.StatusInternalServerError,
+			`{"error":"rollout_delete_failed"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+			tt.setup(mock)
+
+			handler := &Handler{database: db.NewFromPool(sqlDB)}
+			router := gin.New()
+			router.DELETE("/api/v1/admin/rollouts/:key", handler.DeleteRollout)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/admin/rollouts/scan_interval_120", nil))
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+				t.Errorf("got %d %s, want %d %s", w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRespondAttestationError_Busy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	respondAttestationError(c, attestation.ErrAttestationBusy, "verification_failed")
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status: got %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("Retry-After: got %q, want 5", got)
+	}
+	if body := w.Body.String(); body != `{"error":"attestation_busy"}` {
+		t.Errorf("body: got %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	respondAttestationError(c, errors.New("upstream"), "verification_failed")
+	if w.Header().Get("Retry-After") != "" {
+		t.Error("non-busy error got a Retry-After header")
+	}
+}
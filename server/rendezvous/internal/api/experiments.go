@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/cache"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+	"rendezvous/internal/sanitize"
+)
+
+var experimentNamePattern = regexp.MustCompile(`^[a-z0-9_.-]{1,100}$`)
+
+// maxExperimentDescriptionLen bounds an experiment's stored description
+const maxExperimentDescriptionLen = 1024
+
+// ExperimentRequest creates or replaces an experiment. Changing the variants
+// or their weights reassigns devices.
+type ExperimentRequest struct {
+	Description *string                    `json:"description,omitempty"` // Sanitized and cut to maxExperimentDescriptionLen bytes
+	Variants    []ExperimentVariantRequest `json:"variants" binding:"required"`
+	Regions     []string                   `json:"regions,omitempty"`   // Empty targets every region
+	Platforms   []string                   `json:"platforms,omitempty"` // Empty targets every platform
+	StartsAt    *time.Time                 `json:"starts_at,omitempty"` // Unset starts now
+	EndsAt      *time.Time                 `json:"ends_at,omitempty"`   // Unset runs until deleted
+}
+
+// ExperimentVariantRequest is one variant of an experiment. Parameters left
+// unset keep the device's usual values.
+type ExperimentVariantRequest struct {
+	Name           string   `json:"name" binding:"required"`
+	Weight         int      `json:"weight"`                    // Share of devices, relative to the other variants
+	TransportOrder []string `json:"transport_order,omitempty"` // Transport types listed first, in this order
+	ScanInterval   int      `json:"scan_interval,omitempty"`   // Discovery scan interval in seconds
+}
+
+// ExperimentResponse is an experiment in admin responses
+type ExperimentResponse struct {
+	Name        string                     `json:"name"`
+	Description *string                    `json:"description,omitempty"`
+	Variants    []ExperimentVariantRequest `json:"variants"`
+	Regions     []string                   `json:"regions"`
+	Platforms   []string                   `json:"platforms"`
+	StartsAt    *time.Time                 `json:"starts_at,omitempty"`
+	EndsAt      *time.Time                 `json:"ends_at,omitempty"`
+	Running     bool                       `json:"running"` // Within its window now
+	CreatedAt   time.Time                  `json:"created_at"`
+	UpdatedAt   time.Time                  `json:"updated_at"`
+}
+
+// ExperimentListResponse lists every experiment
+type ExperimentListResponse struct {
+	Experiments []ExperimentResponse `json:"experiments"`
+}
+
+func experimentResponse(e *db.Experiment, now time.Time) ExperimentResponse {
+	variants := make([]ExperimentVariantRequest, len(e.Variants))
+	for i, v := range e.Variants {
+		variants[i] = ExperimentVariantRequest(v)
+	}
+	return ExperimentResponse{
+		Name:        e.Name,
+		Description: e.Description,
+		Variants:    variants,
+		Regions:     e.Regions,
+		Platforms:   e.Platforms,
+		StartsAt:    e.StartsAt,
+		EndsAt:      e.EndsAt,
+		Running:     (e.StartsAt == nil || !now.Before(*e.StartsAt)) && (e.EndsAt == nil || now.Before(*e.EndsAt)),
+		CreatedAt:   e.CreatedAt,
+		UpdatedAt:   e.UpdatedAt,
+	}
+}
+
+// ListExperiments returns every experiment
+func (h *Handler) ListExperiments(c *gin.Context) {
+	experiments, err := h.database.GetExperiments(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "experiment_fetch_failed")
+		return
+	}
+	now := h.now()
+	response := ExperimentListResponse{Experiments: make([]ExperimentResponse, len(experiments))}
+	for i, e := range experiments {
+		response.Experiments[i] = experimentResponse(e, now)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// PutExperiment creates or replaces an experiment. Devices get their
+// variant from their next config request.
+func (h *Handler) PutExperiment(c *gin.Context) {
+	name := c.Param("name")
+	if !experimentNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_experiment_name"})
+		return
+	}
+	var req ExperimentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	experiment := &db.Experiment{
+		Name:      name,
+		Variants:  make([]db.ExperimentVariant, len(req.Variants)),
+		Regions:   []string{},
+		Platforms: []string{},
+		StartsAt:  req.StartsAt,
+		EndsAt:    req.EndsAt,
+	}
+	if req.Description != nil {
+		description := sanitize.Multiline(*req.Description, maxExperimentDescriptionLen)
+		experiment.Description = &description
+	}
+	for _, region := range req.Regions {
+		if !previewRegionPattern.MatchString(region) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_region"})
+			return
+		}
+		experiment.Regions = append(experiment.Regions, region)
+	}
+	for _, platform := range req.Platforms {
+		if _, ok := allowedClientPlatforms[platform]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_platform"})
+			return
+		}
+		experiment.Platforms = append(experiment.Platforms, platform)
+	}
+	for i, v := range req.Variants {
+		for _, transport := range v.TransportOrder {
+			if _, ok := allowedTransportTypes[transport]; !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_transport_type"})
+				return
+			}
+		}
+		experiment.Variants[i] = db.ExperimentVariant(v)
+	}
+	if err := config.ValidateExperiment(experiment); err != nil {
+		respondError(c, err, "invalid_experiment")
+		return
+	}
+
+	var stored *db.Experiment
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		var err error
+		if stored, err = h.database.UpsertExperiment(ctx, experiment); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditExperimentPut, SubjectType: "experiment", SubjectID: name,
+			Details: map[string]interface{}{"variants": len(stored.Variants)}}, nil
+	})
+	if err != nil {
+		respondError(c, err, "experiment_update_failed")
+		return
+	}
+	h.invalidateExperiments(c)
+
+	c.JSON(http.StatusOK, experimentResponse(stored, h.now()))
+}
+
+// DeleteExperiment ends an experiment; its devices get their usual
+// parameters from their next config request
+func (h *Handler) DeleteExperiment(c *gin.Context) {
+	name := c.Param("name")
+	if !experimentNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_experiment_name"})
+		return
+	}
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		if err := h.database.DeleteExperiment(ctx, name); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditExperimentDelete, SubjectType: "experiment", SubjectID: name}, nil
+	})
+	if err != nil {
+		respondError(c, err, "experiment_delete_failed")
+		return
+	}
+	h.invalidateExperiments(c)
+
+	c.Status(http.StatusNoContent)
+}
+
+// invalidateExperiments propagates an experiment change to every replica.
+// The write has already committed, so a failed publish is only logged.
+func (h *Handler) invalidateExperiments(c *gin.Context) {
+	if err := h.database.InvalidatePolicy(c.Request.Context(), cache.TableExperiments); err != nil {
+		log.Printf("experiment cache invalidation failed: %v", err)
+	}
+}
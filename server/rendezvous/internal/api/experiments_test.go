@@ -0,0 +1,100 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+func experimentRouter(database *db.Database) *gin.Engine {
+	handler := &Handler{database: database}
+	handler.SetClock(clock.NewFake(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)))
+	router := gin.New()
+	router.GET("/api/v1/admin/experiments", handler.ListExperiments)
+	router.PUT("/api/v1/admin/experiments/:name", handler.PutExperiment)
+	router.DELETE("/api/v1/admin/experiments/:name", handler.DeleteExperiment)
+	return router
+}
+
+func TestPutExperiment(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	updatedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO experiments`).
+		WithArgs("ssh-first", nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(updatedAt, updatedAt))
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+	router := experimentRouter(db.NewFromPool(sqlDB))
+
+	put := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	const variants = `"variants":[{"name":"control","weight":1},{"name":"ssh","weight":1,"transport_order":["ssh"]}]`
+	for _, tt := range []struct{ path, body, want string }{
+		{"/api/v1/admin/experiments/SSH%20First", `{` + variants + `}`, "invalid_experiment_name"},
+		{"/api/v1/admin/experiments/ssh-first", `{` + variants + `,"regions":["US East"]}`, "invalid_region"},
+		{"/api/v1/admin/experiments/ssh-first", `{` + variants + `,"platforms":["windows"]}`, "invalid_platform"},
+		{"/api/v1/admin/experiments/ssh-first", `{"variants":[{"name":"a","weight":1},{"name":"b","weight":1,"transport_order":["wireguard"]}]}`, "invalid_transport_type"},
+		{"/api/v1/admin/experiments/ssh-first", `{"variants":[{"name":"a","weight":1}]}`, "invalid_experiment"},
+		{"/api/v1/admin/experiments/ssh-first", `{"variants":[{"name":"a","weight":0},{"name":"b","weight":0}]}`, "invalid_experiment"},
+	} {
+		if w := put(tt.path, tt.body); w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte(tt.want)) {
+			t.Errorf("PUT %s %s: got %d %s, want 400 %s", tt.path, tt.body, w.Code, w.Body.String(), tt.want)
+		}
+	}
+
+	w := put("/api/v1/admin/experiments/ssh-first", `{`+variants+`,"regions":["me-south-1"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	want := `{"name":"ssh-first","variants":[{"name":"control","weight":1},{"name":"ssh","weight":1,"transport_order":["ssh"]}],` +
+		`"regions":["me-south-1"],"platforms":[],"running":true,` +
+		`"created_at":"2026-03-01T12:00:00Z","updated_at":"2026-03-01T12:00:00Z"}`
+	if w.Body.String() != want {
+		t.Errorf("body: got %s, want %s", w.Body.String(), want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeleteExperiment_NotFound(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM experiments`).WithArgs("ssh-first").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	router := experimentRouter(db.NewFromPool(sqlDB))
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/experiments/ssh-first", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound || !bytes.Contains(w.Body.Bytes(), []byte("experiment_not_found")) {
+		t.Errorf("got %d %s, want 404 experiment_not_found", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
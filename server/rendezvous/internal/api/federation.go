@@ -0,0 +1,257 @@
+package api
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+	"rendezvous/internal/federation"
+)
+
+// federationPeerNamePattern restricts peer names, which label metrics
+var federationPeerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,99}$`)
+
+// FederationPeerRequest adds or changes a federation peer
+type FederationPeerRequest struct {
+	Name            string `json:"name" binding:"required"`             // Lowercase letters, digits and dashes
+	AnnouncementURL string `json:"announcement_url" binding:"required"` // HTTPS URL of the peer's signed announcement
+	PublicKey       []byte `json:"public_key" binding:"required"`       // The peer's Ed25519 config key, base64; pinned
+}
+
+// FederationPeerResponse represents a federation peer in admin responses
+type FederationPeerResponse struct {
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	AnnouncementURL string     `json:"announcement_url"`
+	PublicKey       []byte     `json:"public_key"`
+	KeyID           string     `json:"key_id"`
+	Enabled         bool       `json:"enabled"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	LastPolledAt    *time.Time `json:"last_polled_at,omitempty"`
+	LastAnnouncedAt *time.Time `json:"last_announced_at,omitempty"` // Issue time of the last imported announcement
+	LastError       *string    `json:"last_error,omitempty"`        // Set while polls are failing
+	Gateways        int        `json:"gateways"`                    // Gateways currently imported
+}
+
+// FederationPeerListResponse lists federation peers
+type FederationPeerListResponse struct {
+	Peers []FederationPeerResponse `json:"peers"`
+}
+
+// SetFederation configures federation. Our announcement is only served when
+// cfg.Publish is set.
+func (h *Handler) SetFederation(cfg federation.Config) {
+	h.federation = cfg
+}
+
+// GetFederationAnnouncement serves our signed gateway announcement to
+// federation peers. The announcement lists every gateway address, so the
+// request must be signed by an enabled peer's pinned key; see
+// federation.AuthenticatePeer.
+func (h *Handler) GetFederationAnnouncement(c *gin.Context) {
+	if !h.federation.Publish {
+		c.JSON(http.StatusNotFound, gin.H{"error": "federation_disabled"})
+		return
+	}
+	timestamp, err := strconv.ParseInt(c.GetHeader(federation.HeaderTimestamp), 10, 64)
+	if err != nil {
+		respondError(c, federation.ErrPeerUnauthorized, "")
+		return
+	}
+	signature, err := base64.StdEncoding.DecodeString(c.GetHeader(federation.HeaderSignature))
+	if err != nil {
+		respondError(c, federation.ErrPeerUnauthorized, "")
+		return
+	}
+	_, err = federation.AuthenticatePeer(c.Request.Context(), h.database, c.GetHeader(federation.HeaderKeyID),
+		c.Request.URL.EscapedPath(), timestamp, signature, h.now())
+	if err != nil {
+		respondError(c, err, "announcement_failed")
+		return
+	}
+	announcement, err := h.configService.GatewayAnnouncement(c.Request.Context(), h.federation.Issuer)
+	if err != nil {
+		respondError(c, err, "announcement_failed")
+		return
+	}
+	c.JSON(http.StatusOK, announcement)
+}
+
+// ListFederationPeers lists every federation peer with its poll status
+func (h *Handler) ListFederationPeers(c *gin.Context) {
+	peers, err := h.database.ListFederationPeers(c.Request.Context(), false)
+	if err != nil {
+		respondError(c, err, "federation_peers_fetch_failed")
+		return
+	}
+	resp := FederationPeerListResponse{Peers: make([]FederationPeerResponse, len(peers))}
+	for i, peer := range peers {
+		resp.Peers[i] = federationPeerResponse(peer)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateFederationPeer adds an enabled federation peer. Its gateways are
+// imported from the next poll.
+func (h *Handler) CreateFederationPeer(c *gin.Context) {
+	req, ok := bindFederationPeer(c)
+	if !ok {
+		return
+	}
+	var peer *db.FederationPeer
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		var err error
+		if peer, err = h.database.CreateFederationPeer(ctx, req.Name, req.AnnouncementURL, req.PublicKey); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditFederationPeerCreate, SubjectType: "federation_peer", SubjectID: peer.ID, Details: federationPeerDetails(peer)}, nil
+	})
+	if err != nil {
+		respondError(c, err, "federation_peer_create_failed")
+		return
+	}
+	c.JSON(http.StatusCreated, federationPeerResponse(peer))
+}
+
+// UpdateFederationPeer changes a peer's name, announcement URL and pinned key
+func (h *Handler) UpdateFederationPeer(c *gin.Context) {
+	id, ok := federationPeerID(c)
+	if !ok {
+		return
+	}
+	req, ok := bindFederationPeer(c)
+	if !ok {
+		return
+	}
+	var peer *db.FederationPeer
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		var err error
+		if peer, err = h.database.UpdateFederationPeer(ctx, id, req.Name, req.AnnouncementURL, req.PublicKey); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditFederationPeerUpdate, SubjectType: "federation_peer", SubjectID: peer.ID, Details: federationPeerDetails(peer)}, nil
+	})
+	if err != nil {
+		respondError(c, err, "federation_peer_update_failed")
+		return
+	}
+	c.JSON(http.StatusOK, federationPeerResponse(peer))
+}
+
+// DeleteFederationPeer removes a peer and every gateway imported from it
+func (h *Handler) DeleteFederationPeer(c *gin.Context) {
+	id, ok := federationPeerID(c)
+	if !ok {
+		return
+	}
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		if err := h.database.DeleteFederationPeer(ctx, id); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditFederationPeerDelete, SubjectType: "federation_peer", SubjectID: id}, nil
+	})
+	if err != nil {
+		respondError(c, err, "federation_peer_delete_failed")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// EnableFederationPeer resumes polling a peer and including its gateways
+func (h *Handler) EnableFederationPeer(c *gin.Context) {
+	h.setFederationPeerEnabled(c, true, AuditFederationPeerEnable)
+}
+
+// DisableFederationPeer stops polling a peer and leaves its gateways out of
+// packs at once
+func (h *Handler) DisableFederationPeer(c *gin.Context) {
+	h.setFederationPeerEnabled(c, false, AuditFederationPeerDisable)
+}
+
+func (h *Handler) setFederationPeerEnabled(c *gin.Context, enabled bool, action string) {
+	id, ok := federationPeerID(c)
+	if !ok {
+		return
+	}
+	var peer *db.FederationPeer
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		var err error
+		if peer, err = h.database.SetFederationPeerEnabled(ctx, id, enabled); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: action, SubjectType: "federation_peer", SubjectID: peer.ID}, nil
+	})
+	if err != nil {
+		respondError(c, err, "federation_peer_update_failed")
+		return
+	}
+	c.JSON(http.StatusOK, federationPeerResponse(peer))
+}
+
+// federationPeerID validates the :id path parameter, responding 404 when it
+// cannot name a peer
+func federationPeerID(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if !gatewayIDPattern.MatchString(id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "federation_peer_not_found"})
+		return "", false
+	}
+	return id, true
+}
+
+// bindFederationPeer decodes and validates a peer request, responding 400
+// when it is invalid
+func bindFederationPeer(c *gin.Context) (*FederationPeerRequest, bool) {
+	var req FederationPeerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !federationPeerNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_peer_name"})
+		return nil, false
+	}
+	if u, err := url.Parse(req.AnnouncementURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_announcement_url"})
+		return nil, false
+	}
+	if len(req.PublicKey) != ed25519.PublicKeySize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_public_key"})
+		return nil, false
+	}
+	return &req, true
+}
+
+func federationPeerDetails(peer *db.FederationPeer) map[string]interface{} {
+	return map[string]interface{}{
+		"name":             peer.Name,
+		"announcement_url": peer.AnnouncementURL,
+		"key_id":           config.KeyID(peer.PublicKey),
+	}
+}
+
+func federationPeerResponse(peer *db.FederationPeer) FederationPeerResponse {
+	return FederationPeerResponse{
+		ID:              peer.ID,
+		Name:            peer.Name,
+		AnnouncementURL: peer.AnnouncementURL,
+		PublicKey:       peer.PublicKey,
+		KeyID:           config.KeyID(peer.PublicKey),
+		Enabled:         peer.Enabled,
+		CreatedAt:       peer.CreatedAt,
+		UpdatedAt:       peer.UpdatedAt,
+		LastPolledAt:    peer.LastPolledAt,
+		LastAnnouncedAt: peer.LastAnnouncedAt,
+		LastError:       peer.LastError,
+		Gateways:        peer.Gateways,
+	}
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+	"rendezvous/internal/federation"
+)
+
+const testPeerID = "6f1c1b7e-3d5a-4c61-9a0e-2b7f4d8c9e10"
+
+var federationPeerColumns = []string{
+	"id", "name", "announcement_url", "public_key", "enabled", "created_at", "updated_at",
+	"last_polled_at", "last_announced_at", "last_error", "gateways",
+}
+
+func federationRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	database := db.NewFromPool(sqlDB)
+	configSvc, err := config.NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := &Handler{database: database, configService: configSvc}
+	handler.SetFederation(federation.Config{Publish: true, Issuer: "lumenlink-test"})
+	router := gin.New()
+	router.GET("/api/v1/federation/announcement", handler.GetFederationAnnouncement)
+	router.POST("/api/v1/admin/federation/peers", handler.CreateFederationPeer)
+	router.DELETE("/api/v1/admin/federation/peers/:id", handler.DeleteFederationPeer)
+	router.POST("/api/v1/admin/federation/peers/:id/disable", handler.DisableFederationPeer)
+	return router, mock
+}
+
+func TestCreateFederationPeer(t *testing.T) {
+	router, mock := federationRouter(t)
+	key := make([]byte, ed25519.PublicKeySize)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO federation_peers`).WithArgs("partner", "https://partner.example/api/v1/federation/announcement", key).
+		WillReturnRows(sqlmock.NewRows(federationPeerColumns).
+			AddRow(testPeerID, "partner", "https://partner.example/api/v1/federation/announcement", key, true, now, now, nil, nil, nil, 0))
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+
+	invalid := []FederationPeerRequest{
+		{Name: "Partner!", AnnouncementURL: "https://partner.example/a", PublicKey: key},
+		{Name: "partner", AnnouncementURL: "http://partner.example/a", PublicKey: key},
+		{Name: "partner", AnnouncementURL: "https://partner.example/a", PublicKey: key[:16]},
+	}
+	for _, req := range invalid {
+		if w := postJSON(t, router, "/api/v1/admin/federation/peers", req); w.Code != http.StatusBadRequest {
+			t.Errorf("%+v: got %d, want 400: %s", req, w.Code, w.Body.String())
+		}
+	}
+
+	w := postJSON(t, router, "/api/v1/admin/federation/peers", FederationPeerRequest{
+		Name:            "partner",
+		AnnouncementURL: "https://partner.example/api/v1/federation/announcement",
+		PublicKey:       key,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var resp FederationPeerResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.ID != testPeerID || !resp.Enabled || resp.KeyID != config.KeyID(key) {
+		t.Errorf("response: %+v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDisableAndDeleteFederationPeer(t *testing.T) {
+	router, mock := federationRouter(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE federation_peers AS p SET enabled`).WithArgs(testPeerID, false).
+		WillReturnRows(sqlmock.NewRows(federationPeerColumns).
+			AddRow(testPeerID, "partner", "https://partner.example/a", []byte{}, false, now, now, now, now, nil, 4))
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM federation_peers`).WithArgs(testPeerID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	w := serve(router, httptest.NewRequest(http.MethodPost, "/api/v1/admin/federation/peers/"+testPeerID+"/disable", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("disable: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp FederationPeerResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.Enabled || resp.Gateways != 4 {
+		t.Errorf("response: %+v", resp)
+	}
+
+	w = serve(router, httptest.NewRequest(http.MethodDelete, "/api/v1/admin/federation/peers/"+testPeerID, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("delete of a missing peer: got %d: %s", w.Code, w.Body.String())
+	}
+	w = serve(router, httptest.NewRequest(http.MethodDelete, "/api/v1/admin/federation/peers/not-a-uuid", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("malformed id: got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// signedAnnouncementRequest requests our announcement as the peer with key
+func signedAnnouncementRequest(key ed25519.PrivateKey, at time.Time) *http.Request {
+	const path = "/api/v1/federation/announcement"
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	publicKey := key.Public().(ed25519.PublicKey)
+	req.Header.Set(federation.HeaderKeyID, config.KeyID(publicKey))
+	req.Header.Set(federation.HeaderTimestamp, strconv.FormatInt(at.Unix(), 10))
+	req.Header.Set(federation.HeaderSignature, base64.StdEncoding.EncodeToString(
+		ed25519.Sign(key, config.AnnouncementRequestMessage(path, at.Unix()))))
+	return req
+}
+
+// expectFederationPeer answers the lookup of enabled peers with one peer
+// pinned to publicKey
+func expectFederationPeer(mock sqlmock.Sqlmock, publicKey ed25519.PublicKey) {
+	now := time.Now()
+	mock.ExpectQuery(`FROM federation_peers`).WithArgs(true).WillReturnRows(sqlmock.NewRows(federationPeerColumns).
+		AddRow(testPeerID, "partner", "https://partner.example/announcement", []byte(publicKey), true, now, now, nil, nil, nil, 0))
+}
+
+func TestGetFederationAnnouncement(t *testing.T) {
+	router, mock := federationRouter(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	key := make([]byte, ed25519.PublicKeySize)
+	peerPub, peerPriv, _ := ed25519.GenerateKey(nil)
+	expectFederationPeer(mock, peerPub)
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns).
+		AddRow(testGatewayID, key, "192.0.2.1", 443, "{masque}", "{}", "me-south-1", nil, 0, nil, "active", false,
+			"op-1", "approved", nil, now, now, now).
+		AddRow("2b0c6c1e-5a7d-4f1e-8d3a-9c4b5e6f7a80", key, "192.0.2.2", 443, "{masque}", "{}", "me-south-1", nil, 0, nil, "active", true,
+			"op-1", "approved", nil, now, now, now))
+
+	w := serve(router, signedAnnouncementRequest(peerPriv, time.Now()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var announcement config.GatewayAnnouncement
+	if err := json.Unmarshal(w.Body.Bytes(), &announcement); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !config.VerifyAnnouncement(&announcement, announcement.PublicKey) {
+		t.Error("announcement signature does not verify")
+	}
+	if announcement.Issuer != "lumenlink-test" || len(announcement.Gateways) != 1 || announcement.Gateways[0].ID != testGatewayID {
+		t.Errorf("announcement: %+v; the honeypot must not be announced", announcement)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	unpublished := &Handler{}
+	router = gin.New()
+	router.GET("/api/v1/federation/announcement", unpublished.GetFederationAnnouncement)
+	if w := serve(router, httptest.NewRequest(http.MethodGet, "/api/v1/federation/announcement", nil)); w.Code != http.StatusNotFound {
+		t.Errorf("publishing off: got %d, want 404", w.Code)
+	}
+}
+
+func TestGetFederationAnnouncement_RequiresPeerSignature(t *testing.T) {
+	peerPub, peerPriv, _ := ed25519.GenerateKey(nil)
+	_, strangerPriv, _ := ed25519.GenerateKey(nil)
+	tests := []struct {
+		name    string
+		request *http.Request
+		queried bool // Whether peers are looked up
+	}{
+		{"unsigned", httptest.NewRequest(http.MethodGet, "/api/v1/federation/announcement", nil), false},
+		{"unknown key", signedAnnouncementRequest(strangerPriv, time.Now()), true},
+		{"stale signature", signedAnnouncementRequest(peerPriv, time.Now().Add(-time.Hour)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := federationRouter(t)
+			if tt.queried {
+				expectFederationPeer(mock, peerPub)
+			}
+			// No gateways are read
+			w := serve(router, tt.request)
+			if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "federation_peer_unauthorized") {
+				t.Errorf("got %d %s, want 401 federation_peer_unauthorized", w.Code, w.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+)
+
+var gatewayIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// GatewayMetricsResponse is the operator view of one gateway's metrics
+type GatewayMetricsResponse struct {
+	GatewayID           string                      `json:"gateway_id"`
+	CountryDistribution gateway.CountryDistribution `json:"country_distribution"`
+	Uptime              gateway.Uptime              `json:"uptime"` // Over the window query parameter, 30d by default
+}
+
+// GetGatewayMetrics returns metrics for one gateway to its operator. The
+// request is signed with the gateway's key over gateway.RequestMessage for
+// the request path and the X-Gateway-Timestamp header (Unix seconds); the
+// signature is sent base64 encoded in X-Gateway-Signature.
+func (h *Handler) GetGatewayMetrics(c *gin.Context) {
+	gatewayID := c.Param("id")
+	if !gatewayIDPattern.MatchString(gatewayID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_gateway_id"})
+		return
+	}
+	timestamp, signature, ok := gatewayRequestSignature(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_signature"})
+		return
+	}
+	window, ok := parseUptimeWindow(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_window"})
+		return
+	}
+	if h.database == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database_unavailable"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	gw, err := h.registry.AuthenticateGateway(ctx, gatewayID, c.Request.URL.Path, nil, timestamp, signature)
+	if err != nil {
+		respondError(c, err, "authentication_failed")
+		return
+	}
+
+	now := h.now().UTC()
+	counts, err := h.database.GetGatewayCountryCounts(ctx, gatewayID)
+	if err != nil {
+		respondError(c, err, "metrics_query_failed")
+		return
+	}
+	uptimes, err := h.registry.Uptimes(ctx, []*db.Gateway{gw}, window, now)
+	if err != nil {
+		respondError(c, err, "uptime_query_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, GatewayMetricsResponse{
+		GatewayID:           gatewayID,
+		CountryDistribution: gateway.SummarizeCountries(counts, h.countryPolicy),
+		Uptime:              uptimes[gatewayID],
+	})
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+)
+
+const testGatewayID = "3f0c2a8e-8b1d-4c55-9d7a-0c1e2f3a4b5c"
+
+func gatewayMetricsRouter(t *testing.T, publicKey ed25519.PublicKey, expect func(sqlmock.Sqlmock)) *gin.Engine {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	now := time.Now()
+	mock.ExpectQuery(`WHERE id = \$1`).WithArgs(testGatewayID).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
+		"created_at", "last_seen", "updated_at",
+	}).AddRow(
+		testGatewayID, []byte(publicKey), "192.0.2.1", 443, "{masque}", "{}",
+		"me-south-1", nil, 0, nil, "active", false,
+		"op-1", "approved", nil,
+		now.AddDate(0, 0, -100), nil, now,
+	))
+	if expect != nil {
+		expect(mock)
+	}
+
+	database := db.NewFromPool(sqlDB)
+	handler := &Handler{
+		database:      database,
+		registry:      gateway.NewRegistry(database),
+		countryPolicy: gateway.CountryPolicy{TopN: 5, MinClients: 10, WindowDays: 30},
+	}
+	router := gin.New()
+	router.GET("/api/v1/gateway/:id/metrics", handler.GetGatewayMetrics)
+	return router
+}
+
+func getGatewayMetrics(router *gin.Engine, privateKey ed25519.PrivateKey) *httptest.ResponseRecorder {
+	path := "/api/v1/gateway/" + testGatewayID + "/metrics"
+	timestamp := time.Now().Unix()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-Gateway-Timestamp", strconv.FormatInt(timestamp, 10))
+	signature := ed25519.Sign(privateKey, gateway.RequestMessage(testGatewayID, path, timestamp))
+	req.Header.Set("X-Gateway-Signature", base64.StdEncoding.EncodeToString(signature))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetGatewayMetrics_CountryDistribution(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	router := gatewayMetricsRouter(t, publicKey, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(`FROM gateway_country_rollups`).
+			WithArgs(testGatewayID).
+			WillReturnRows(sqlmock.NewRows([]string{"country", "clients"}).
+				AddRow("IR", 37).
+				AddRow("TJ", 8).
+				AddRow("AF", 3))
+		mock.ExpectQuery(`FROM gateway_status_history`).WillReturnRows(sqlmock.NewRows([]string{"gateway_id", "status", "changed_at"}))
+		mock.ExpectQuery(`FROM gateway_maintenance_windows`).WillReturnRows(sqlmock.NewRows(maintenanceWindowColumns))
+	})
+
+	w := getGatewayMetrics(router, privateKey)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+
+	var resp GatewayMetricsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	countries := resp.CountryDistribution.Countries
+	if len(countries) != 2 || countries[0].Country != "IR" || countries[1].Country != gateway.CountryOther {
+		t.Fatalf("countries: got %+v, want IR and other", countries)
+	}
+	// Only percentages leave the service, never the underlying counts
+	if strings.Contains(w.Body.String(), "AF") || strings.Contains(w.Body.String(), "TJ") || strings.Contains(w.Body.String(), "37") {
+		t.Errorf("response exposes suppressed data: %s", w.Body.String())
+	}
+}
+
+func TestGetGatewayMetrics_Uptime(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	now := time.Now().UTC()
+	day := 24 * time.Hour
+	router := gatewayMetricsRouter(t, publicKey, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(`FROM gateway_country_rollups`).
+			WillReturnRows(sqlmock.NewRows([]string{"country", "clients"}))
+		mock.ExpectQuery(`FROM gateway_status_history`).WillReturnRows(
+			sqlmock.NewRows([]string{"gateway_id", "status", "changed_at"}).
+				AddRow(testGatewayID, "offline", now.Add(-3*day)).
+				AddRow(testGatewayID, "active", now.Add(-36*time.Hour)))
+		// The first day of the outage was approved maintenance
+		mock.ExpectQuery(`FROM gateway_maintenance_windows`).WillReturnRows(
+			sqlmock.NewRows(maintenanceWindowColumns).
+				AddRow("mw-1", testGatewayID, now.Add(-3*day), now.Add(-2*day), nil, "admin", now))
+	})
+
+	w := getGatewayMetrics(router, privateKey)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	var resp GatewayMetricsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	uptime := resp.Uptime
+	if uptime.Window != "30d" || uptime.Percent == nil {
+		t.Fatalf("uptime: got %+v, want a 30d percentage", uptime)
+	}
+	if want := int64(29 * day / time.Second); uptime.ExpectedSeconds != want {
+		t.Errorf("expected seconds: got %d, want %d", uptime.ExpectedSeconds, want)
+	}
+	if want := int64((29*day - 12*time.Hour) / time.Second); uptime.UpSeconds != want {
+		t.Errorf("up seconds: got %d, want %d", uptime.UpSeconds, want)
+	}
+	if want := int64(day / time.Second); uptime.ExcludedSeconds != want {
+		t.Errorf("excluded seconds: got %d, want %d", uptime.ExcludedSeconds, want)
+	}
+}
+
+func TestGetGatewayMetrics_RejectsForgedSignature(t *testing.T) {
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, attackerKey, _ := ed25519.GenerateKey(rand.Reader)
+	router := gatewayMetricsRouter(t, publicKey, nil)
+
+	w := getGatewayMetrics(router, attackerKey)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status: got %d, want 401 (%s)", w.Code, w.Body.String())
+	}
+}
+
+func TestGetGatewayMetrics_InvalidRequest(t *testing.T) {
+	handler := &Handler{}
+	router := gin.New()
+	router.GET("/api/v1/gateway/:id/metrics", handler.GetGatewayMetrics)
+
+	tests := []struct {
+		name     string
+		path     string
+		headers  map[string]string
+		wantCode int
+	}{
+		{"malformed id", "/api/v1/gateway/not-a-uuid/metrics", nil, http.StatusBadRequest},
+		{"unknown window", "/api/v1/gateway/" + testGatewayID + "/metrics?window=1y",
+			map[string]string{"X-Gateway-Timestamp": "1700000000", "X-Gateway-Signature": "AAAA"}, http.StatusBadRequest},
+		{"unsigned", "/api/v1/gateway/" + testGatewayID + "/metrics", nil, http.StatusUnauthorized},
+		{"bad signature encoding", "/api/v1/gateway/" + testGatewayID + "/metrics",
+			map[string]string{"X-Gateway-Timestamp": "1700000000", "X-Gateway-Signature": "%%%"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("status: got %d, want %d (%s)", w.Code, tt.wantCode, w.Body.String())
+			}
+		})
+	}
+}
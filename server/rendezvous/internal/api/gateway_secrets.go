@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/gateway"
+)
+
+// Bounds on a gateway transport secret, in bytes
+const (
+	minGatewaySecretLen = 16
+	maxGatewaySecretLen = 256
+)
+
+// GatewaySecretRequest carries a gateway's new transport secret
+type GatewaySecretRequest struct {
+	Secret []byte `json:"secret" binding:"required"` // Base64, 16 to 256 bytes
+}
+
+// GatewaySecretResponse reports a completed secret rotation. The secret is
+// never echoed back.
+type GatewaySecretResponse struct {
+	GatewayID         string    `json:"gateway_id"`
+	Generation        int       `json:"generation"`
+	PreviousExpiresAt time.Time `json:"previous_expires_at"` // Until then packs carry both secrets
+}
+
+// AdminGatewaySecret is one secret generation in an admin export
+type AdminGatewaySecret struct {
+	Generation int        `json:"generation"`
+	Secret     []byte     `json:"secret"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// SetGatewaySecrets attaches the gateway secret store; without one secret
+// rotation returns secrets_unavailable.
+func (h *Handler) SetGatewaySecrets(store *gateway.SecretStore) {
+	h.gatewaySecrets = store
+}
+
+// PutGatewaySecret rotates a gateway's transport secret. The gateway signs
+// the request with its key over gateway.RequestBodyMessage; its previous
+// secret stays in trusted packs for the configured overlap.
+func (h *Handler) PutGatewaySecret(c *gin.Context) {
+	gatewayID := c.Param("id")
+	if !gatewayIDPattern.MatchString(gatewayID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_gateway_id"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPreferencesBody+1))
+	if err != nil || len(body) > maxPreferencesBody {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_body"})
+		return
+	}
+	timestamp, signature, ok := gatewayRequestSignature(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_signature"})
+		return
+	}
+	if h.database == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database_unavailable"})
+		return
+	}
+	ctx := c.Request.Context()
+	if _, err := h.registry.AuthenticateGateway(ctx, gatewayID, c.Request.URL.Path, body, timestamp, signature); err != nil {
+		respondError(c, err, "authentication_failed")
+		return
+	}
+
+	// Binding errors are not echoed: they could quote the secret
+	var req GatewaySecretRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_secret"})
+		return
+	}
+	if len(req.Secret) < minGatewaySecretLen || len(req.Secret) > maxGatewaySecretLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_secret"})
+		return
+	}
+
+	generation, previousExpiresAt, err := h.gatewaySecrets.Rotate(ctx, gatewayID, req.Secret, h.now().UTC())
+	if err != nil {
+		respondError(c, err, "secret_rotation_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, GatewaySecretResponse{
+		GatewayID:         gatewayID,
+		Generation:        generation,
+		PreviousExpiresAt: previousExpiresAt,
+	})
+}
+
+// adminGatewaySecrets decrypts a gateway's active secrets for an admin who
+// asked for them with include_secrets=true.
+func (h *Handler) adminGatewaySecrets(c *gin.Context, gatewayID string) ([]AdminGatewaySecret, error) {
+	if h.gatewaySecrets == nil {
+		return nil, gateway.ErrSecretsUnavailable
+	}
+	secrets, err := h.gatewaySecrets.Active(c.Request.Context(), []string{gatewayID}, h.now())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]AdminGatewaySecret, 0, len(secrets[gatewayID]))
+	for _, secret := range secrets[gatewayID] {
+		result = append(result, AdminGatewaySecret{Generation: secret.Generation, Secret: secret.Value, ExpiresAt: secret.ExpiresAt})
+	}
+	return result, nil
+}
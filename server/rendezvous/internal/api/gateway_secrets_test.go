@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/crypt"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+)
+
+const secretPath = "/api/v1/gateway/" + testGatewayID + "/secret"
+
+func secretRouter(t *testing.T, withStore bool) (*gin.Engine, sqlmock.Sqlmock, *crypt.Sealer) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	sealer, err := crypt.NewSealer(bytes.Repeat([]byte{3}, crypt.KeySize))
+	if err != nil {
+		t.Fatalf("NewSealer: %v", err)
+	}
+
+	database := db.NewFromPool(sqlDB)
+	handler := &Handler{database: database, registry: gateway.NewRegistry(database)}
+	if withStore {
+		handler.SetGatewaySecrets(gateway.NewSecretStore(database, sealer, time.Hour))
+	}
+	router := gin.New()
+	router.PUT("/api/v1/gateway/:id/secret", handler.PutGatewaySecret)
+	router.GET("/api/v1/admin/gateways/:id", handler.GetAdminGateway)
+	return router, mock, sealer
+}
+
+func TestPutGatewaySecret(t *testing.T) {
+	router, mock, _ := secretRouter(t, true)
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	mock.ExpectQuery(`WHERE id = \$1`).WithArgs(testGatewayID).WillReturnRows(operatorGatewayRows(publicKey, nil, nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM gateway_secrets`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE gateway_secrets SET expires_at`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO gateway_secrets`).WillReturnRows(sqlmock.NewRows([]string{"generation"}).AddRow(2))
+	mock.ExpectCommit()
+
+	body := []byte(`{"secret":"bmV3LW9iZnVzY2F0aW9uLXNlZWQ="}`) // new-obfuscation-seed
+	w := serve(router, signedOperatorRequest(http.MethodPut, secretPath, privateKey, body, body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d (%s)", w.Code, w.Body.String())
+	}
+	var resp GatewaySecretResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.Generation != 2 || time.Until(resp.PreviousExpiresAt) < 59*time.Minute {
+		t.Errorf("got %+v, want generation 2 with the previous secret valid for the overlap", resp)
+	}
+	if strings.Contains(w.Body.String(), "bmV3LW9iZnVzY2F0aW9uLXNlZWQ") {
+		t.Error("response echoes the secret")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPutGatewaySecret_Rejected(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	short := []byte(`{"secret":"c2hvcnQ="}`)
+	valid := []byte(`{"secret":"bmV3LW9iZnVzY2F0aW9uLXNlZWQ="}`)
+	tests := []struct {
+		name      string
+		withStore bool
+		key       ed25519.PrivateKey
+		body      []byte
+		status    int
+		want      string
+	}{
+		{"short secret", true, privateKey, short, http.StatusBadRequest, "invalid_secret"},
+		{"wrong key", true, otherKey, valid, http.StatusUnauthorized, "invalid_signature"},
+		{"no data key", false, privateKey, valid, http.StatusServiceUnavailable, "secrets_unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock, _ := secretRouter(t, tt.withStore)
+			mock.ExpectQuery(`WHERE id = \$1`).WillReturnRows(operatorGatewayRows(publicKey, nil, nil))
+			w := serve(router, signedOperatorRequest(http.MethodPut, secretPath, tt.key, tt.body, tt.body))
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d (%s)", w.Code, tt.status, w.Body.String())
+			}
+			var resp map[string]interface{}
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp["error"] != tt.want {
+				t.Errorf("error: got %v, want %s", resp["error"], tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAdminGateway_Secrets(t *testing.T) {
+	router, mock, sealer := secretRouter(t, true)
+	expectAdminGateway := func() {
+		mock.ExpectQuery(`WHERE id = \$1`).WillReturnRows(operatorGatewayRows(make([]byte, 32), "op-1", nil))
+		mock.ExpectQuery(`FROM gateway_suspicion_scores`).WillReturnRows(
+			sqlmock.NewRows([]string{"gateway_id", "score", "components", "signals", "flagged", "computed_at"}))
+	}
+	path := "/api/v1/admin/gateways/" + testGatewayID
+
+	// Without the flag the secrets table is not read
+	expectAdminGateway()
+	w := serve(router, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"secrets"`) {
+		t.Fatalf("status %d (%s), want 200 without secrets", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, _ := sealer.Seal([]byte("new-obfuscation-seed"), []byte(testGatewayID))
+	expectAdminGateway()
+	mock.ExpectQuery(`FROM gateway_secrets`).WillReturnRows(
+		sqlmock.NewRows([]string{"gateway_id", "generation", "ciphertext", "created_at", "expires_at"}).
+			AddRow(testGatewayID, 1, sealed, time.Now(), nil))
+	mock.ExpectBegin()
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+	w = serve(router, httptest.NewRequest(http.MethodGet, path+"?include_secrets=true", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d (%s)", w.Code, w.Body.String())
+	}
+	var resp AdminGatewayResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.Secrets) != 1 || string(resp.Secrets[0].Secret) != "new-obfuscation-seed" {
+		t.Errorf("secrets: got %+v", resp.Secrets)
+	}
+
+	// An export that cannot be audited is refused
+	expectAdminGateway()
+	mock.ExpectQuery(`FROM gateway_secrets`).WillReturnRows(
+		sqlmock.NewRows([]string{"gateway_id", "generation", "ciphertext", "created_at", "expires_at"}).
+			AddRow(testGatewayID, 1, sealed, time.Now(), nil))
+	mock.ExpectBegin().WillReturnError(sqlmock.ErrCancelled)
+	w = serve(router, httptest.NewRequest(http.MethodGet, path+"?include_secrets=true", nil))
+	if w.Code == http.StatusOK || bytes.Contains(w.Body.Bytes(), []byte("secrets")) {
+		t.Errorf("unaudited export: got %d (%s)", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
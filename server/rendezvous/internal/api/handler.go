@@ -1,15 +1,35 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"rendezvous/internal/admission"
+	"rendezvous/internal/apperr"
 	"rendezvous/internal/attestation"
+	"rendezvous/internal/canary"
+	"rendezvous/internal/clock"
 	"rendezvous/internal/config"
 	"rendezvous/internal/db"
+	"rendezvous/internal/federation"
+	"rendezvous/internal/gateway"
 	"rendezvous/internal/geo"
+	"rendezvous/internal/i18n"
+	"rendezvous/internal/issuance"
+	"rendezvous/internal/lifecycle"
 	"rendezvous/internal/metrics"
+	"rendezvous/internal/notify"
+	"rendezvous/internal/sanitize"
+	"rendezvous/internal/trust"
 )
 
 // Handler handles HTTP API requests
@@ -18,6 +38,24 @@ type Handler struct {
 	attestationService *attestation.AttestationService
 	geoBalancer        *geo.GeoBalancer
 	database           *db.Database
+	registry           *gateway.Registry
+	verification       *config.VerificationMonitor
+	countryPolicy      gateway.CountryPolicy
+	countryRegions     *geo.CountryRegions // Nil uses the built-in table alone
+	drain              *lifecycle.Drain
+	canary             *canary.Check
+	statusPage         StatusPage
+	admission          *admission.Controller
+	trust              *trust.Tracker                    // Nil unless SetTrust
+	operatorEvents     notify.OperatorEmitter            // Nil until SetOperatorEvents
+	gatewaySecrets     *gateway.SecretStore              // Nil until SetGatewaySecrets
+	issuance           *gateway.IssuanceCounter          // Nil until SetIssuance
+	issuanceLog        *issuance.Log                     // Nil unless SetIssuanceLog
+	allocations        *config.EndpointAllocationCounter // Nil until SetEndpointAllocations
+	bandwidthWarn      int                               // Percent of declared bandwidth that warns the operator
+	heartbeat          gateway.HeartbeatSchedule
+	federation         federation.Config
+	clock              clock.Clock // Nil is the system clock
 }
 
 var allowedGatewayStatuses = map[string]struct{}{
@@ -27,20 +65,15 @@ var allowedGatewayStatuses = map[string]struct{}{
 	"maintenance": {},
 }
 
-var allowedDiscoveryChannels = map[string]struct{}{
-	"gps":        {},
-	"fm_rds":     {},
-	"dtv":        {},
-	"plc":        {},
-	"gsm_cb":     {},
-	"lte_sib":    {},
-	"iot_mqtt":   {},
-	"blockchain": {},
-	"satellite":  {},
-	"intranet":   {},
-	"social":     {},
+var allowedTransportTypes = map[string]struct{}{
+	"masque":   {},
+	"xtls":     {},
+	"parasite": {},
+	"ssh":      {},
 }
 
+var allowedDiscoveryChannels = config.AllowedDiscoveryChannels
+
 // NewHandler creates a new API handler
 func NewHandler(
 	configService *config.ConfigService,
@@ -48,12 +81,100 @@ func NewHandler(
 	geoBalancer *geo.GeoBalancer,
 	database *db.Database,
 ) *Handler {
+	countryRegions := geo.NewCountryRegions(database)
+	if err := countryRegions.Refresh(context.Background()); err != nil {
+		log.Printf("country region overrides unavailable, using the built-in table: %v", err)
+	}
 	return &Handler{
 		configService:      configService,
 		attestationService: attestationService,
 		geoBalancer:        geoBalancer,
 		database:           database,
+		registry:           gateway.NewRegistry(database),
+		verification:       config.NewVerificationMonitor(notify.NewFromEnv()),
+		countryPolicy:      gateway.LoadCountryPolicyFromEnv(),
+		countryRegions:     countryRegions,
+		bandwidthWarn:      gateway.LoadBandwidthWarnPercentFromEnv(),
+		heartbeat:          gateway.LoadHeartbeatScheduleFromEnv(),
+	}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (h *Handler) SetClock(c clock.Clock) {
+	h.clock = c
+}
+
+// now reads the handler's clock
+func (h *Handler) now() time.Time {
+	if h.clock == nil {
+		return clock.Real{}.Now()
+	}
+	return h.clock.Now()
+}
+
+// SetDrain attaches the shutdown drain; while it is draining, health checks
+// fail and gateway heartbeats are answered with a drain directive.
+func (h *Handler) SetDrain(drain *lifecycle.Drain) {
+	h.drain = drain
+}
+
+// SetCanary attaches the startup canary check; health checks fail until it
+// passes.
+func (h *Handler) SetCanary(check *canary.Check) {
+	h.canary = check
+}
+
+// SetAdmission attaches the new-device admission controller; without one
+// every device is admitted. Admission needs a seen-device set, so it stays
+// off when the persistence policy does not allow tracking devices.
+func (h *Handler) SetAdmission(controller *admission.Controller) {
+	if controller != nil && !h.database.PersistencePolicy().TrackDevices() {
+		log.Println("Data minimization: new-device admission is disabled")
+		return
+	}
+	h.admission = controller
+}
+
+// SetOperatorEvents attaches the sink for operator events; heartbeats that
+// report bandwidth near the gateway's cap are reported to its operator.
+func (h *Handler) SetOperatorEvents(events notify.OperatorEmitter) {
+	h.operatorEvents = events
+}
+
+// SetIssuance attaches the counter of packs issued per gateway, which the
+// user count reconciliation compares reported users against.
+func (h *Handler) SetIssuance(counter *gateway.IssuanceCounter) {
+	h.issuance = counter
+}
+
+// SetIssuanceLog attaches the log of packs issued to each device, which the
+// admin device lookup reads. Under data minimization it is not attached.
+func (h *Handler) SetIssuanceLog(issuances *issuance.Log) {
+	if issuances != nil && !h.database.PersistencePolicy().TrackDevices() {
+		log.Println("Data minimization: the device issuance log is disabled")
+		return
 	}
+	h.issuanceLog = issuances
+}
+
+// SetEndpointAllocations attaches the counter of packs each allocated pool
+// endpoint was issued in, which the endpoint burn report compares failures
+// against.
+func (h *Handler) SetEndpointAllocations(counter *config.EndpointAllocationCounter) {
+	h.allocations = counter
+}
+
+// Health reports whether this replica should receive traffic
+func (h *Handler) Health(c *gin.Context) {
+	if h.drain.Draining() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+	if !h.canary.Ready() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": h.canary.Status()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 }
 
 // GetConfigRequest represents a config request
@@ -63,95 +184,546 @@ type GetConfigRequest struct {
 	Region      string `json:"region"`
 	Attestation string `json:"attestation"` // Attestation token
 	Version     string `json:"version"`     // Client version
+	Locale      string `json:"locale"`      // Optional BCP-47 tag for pack notices
+
+	// Latitude and Longitude are the client's approximate location, sent
+	// together. Without region, the nearest available region to them, or
+	// else to the centroid of the client's country, is used. They are not
+	// stored.
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+
+	// AttestationRequestType is the Play Integrity flow of an Android
+	// token: "classic" (default) or "standard"
+	AttestationRequestType string `json:"attestation_request_type,omitempty"`
+
+	// AttestationEnvironment and AttestationBundleID are the App Attest
+	// environment and app bundle ID of an iOS token, as in /attest
+	AttestationEnvironment string `json:"attestation_environment,omitempty" enum:"production,development"`
+	AttestationBundleID    string `json:"attestation_bundle_id,omitempty"`
+
+	// AttestationTokenType is what an Android token is, as in /attest
+	AttestationTokenType string `json:"attestation_token_type,omitempty" enum:"play_integrity,key_attestation"`
+
+	// AttestationSession is the session_token from /attest, sent instead of
+	// Attestation. An invalid or expired session leaves the request
+	// unattested.
+	AttestationSession string `json:"attestation_session,omitempty"`
+
+	// WaitingRoomToken is the token from a deferred pack, presented on return
+	// for priority admission.
+	WaitingRoomToken string `json:"waiting_room_token,omitempty"`
+
+	// SupportedPackVersions lists the pack formats the client can verify;
+	// clients that predate negotiation omit it and get the 1.0 format.
+	SupportedPackVersions []string `json:"supported_pack_versions,omitempty"`
+
+	// CurrentPackHash is the pack_hash of the pack the client holds. If the
+	// new pack's content is the same, a signed not_modified is returned
+	// instead of the pack.
+	CurrentPackHash string `json:"current_pack_hash,omitempty"`
+
+	// Format is how the pack is returned: "json" (default) in config_pack,
+	// "jws" in config_pack_jws, or "cbor" in config_pack_cbor of a response
+	// encoded in CBOR. Without it, an Accept header of application/jose
+	// selects "jws" and one of application/cbor "cbor".
+	Format string `json:"format,omitempty" enum:"json,jws,cbor"`
+
+	// Compress is the content encoding of the response, for clients that
+	// cannot set Accept-Encoding, which is used without it
+	Compress string `json:"compress,omitempty" enum:"gzip,zstd,identity"`
+
+	// SigAlg is the algorithm the pack is signed in: "ed25519" (default) or
+	// "ecdsa-p256" for clients that verify only P-256
+	SigAlg string `json:"sig_alg,omitempty" enum:"ed25519,ecdsa-p256"`
 }
 
 // GetConfigResponse represents a config response
 type GetConfigResponse struct {
-	ConfigPack *config.SignedConfigPack `json:"config_pack"`
+	ConfigPack  *config.SignedConfigPack `json:"config_pack"`          // Null when not_modified or config_pack_jws is set
+	PackVersion string                   `json:"pack_version"`         // The negotiated format of config_pack
+	ExpiresAt   *time.Time               `json:"expires_at,omitempty"` // When config_pack, or the pack not_modified extends, expires; fetch a new one before then
+	PackHash    string                   `json:"pack_hash,omitempty"`  // Content hash to send as current_pack_hash
+
+	// ConfigPackJWS is the pack as an EdDSA or ES256 JWS in compact serialization,
+	// set instead of config_pack when the jws format was requested
+	ConfigPackJWS string `json:"config_pack_jws,omitempty"`
+
+	// ConfigPackCBOR is the pack in CBOR, set instead of config_pack when
+	// the cbor format was requested
+	ConfigPackCBOR []byte `json:"config_pack_cbor,omitempty"`
+
+	// NotModified is set instead of config_pack when the client's current
+	// pack is still current; it carries the pack's new signed expiry
+	NotModified *config.PackNotModified `json:"not_modified,omitempty"`
+
+	// ChangedSince summarizes how config_pack differs from the client's
+	// current pack, when the server still remembers that pack
+	ChangedSince *config.PackChanges `json:"changed_since,omitempty"`
+}
+
+// PackVersionUnsupportedResponse tells a client that supports none of the
+// server's pack formats to update before requesting config again
+type PackVersionUnsupportedResponse struct {
+	Error                 string   `json:"error"`
+	SupportedPackVersions []string `json:"supported_pack_versions"`
 }
 
-// GetConfig handles config pack requests
+// maxClientPackVersions bounds supported_pack_versions in config requests
+const maxClientPackVersions = 16
+
+// GetConfig handles config pack requests. Served packs record their phase
+// durations in metrics.ConfigPhaseDuration.
 func (h *Handler) GetConfig(c *gin.Context) {
+	timer := metrics.NewPhaseTimer()
 	var req GetConfigRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Locale != "" {
+		locale, err := i18n.ParseLocale(req.Locale)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_locale"})
+			return
+		}
+		req.Locale = locale
+	}
+	if len(req.SupportedPackVersions) > maxClientPackVersions {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too_many_pack_versions"})
+		return
+	}
+	packVersion, err := config.NegotiatePackVersion(req.SupportedPackVersions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, PackVersionUnsupportedResponse{
+			Error:                 apperr.Code(err),
+			SupportedPackVersions: config.SupportedPackVersions(),
+		})
+		return
+	}
+	format, ok := packFormat(req.Format, c.GetHeader("Accept"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_pack_format"})
+		return
+	}
+	encoding, ok := contentEncoding(req.Compress, c.GetHeader("Accept-Encoding"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_compression"})
+		return
+	}
+	if !config.ValidSignatureAlg(req.SigAlg) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_sig_alg"})
+		return
+	}
+	if !validLocation(req.Latitude, req.Longitude) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_location"})
+		return
+	}
+	if req.SigAlg == config.SigAlgECDSAP256 {
+		// Not-modified answers are signed in ed25519 only, so these clients
+		// always get their pack
+		req.CurrentPackHash = ""
+	}
+
+	// Select region, when not requested nearest the client's coordinates or
+	// the centroid of the country from Cloudflare or other CDN headers. It
+	// stays empty when unknown, and the launch policy then decides between
+	// the default region and a closed-region pack.
+	endRegion := timer.Start(metrics.PhaseRegionResolution)
+	region := req.Region
+	country := c.GetHeader("CF-IPCountry")
+	if region == "" {
+		region = h.nearestRegion(c.Request.Context(), country, req.Latitude, req.Longitude)
+	}
+	endRegion()
+
+	// New devices over the region's admission cap are told to come back later
+	if h.admission != nil {
+		decision, err := h.admission.Admit(c.Request.Context(), req.DeviceID, region, req.WaitingRoomToken)
+		if err != nil {
+			// Admit rather than turn devices away while Redis is unreachable
+			log.Printf("admission check failed, admitting device: %v", err)
+		} else if decision.Outcome != admission.OutcomeKnown {
+			countAdmission(region, decision.Outcome)
+		}
+		if err == nil && decision.Outcome == admission.OutcomeDeferred {
+			retryAfter := int((decision.RetryAfter + time.Second - 1) / time.Second)
+			pack, err := h.configService.DeferredConfigPack(req.DeviceID, region, req.Locale, packVersion, req.SigAlg, retryAfter, decision.Token)
+			if err != nil {
+				respondError(c, err, "config_generation_failed")
+				return
+			}
+			response := &GetConfigResponse{ConfigPack: pack, PackVersion: packVersion, ExpiresAt: packExpiry(pack)}
+			body, contentType, err := h.configResponseBody(response, format, encoding)
+			if err != nil {
+				respondError(c, err, "config_generation_failed")
+				return
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			writeConfigResponse(c, body, contentType, encoding)
+			return
+		}
+	}
 
 	// Verify attestation if provided
 	var attestationResult *attestation.AttestationResult
 	if req.Attestation != "" {
 		attestReq := &attestation.AttestationRequest{
-			Platform: req.Platform,
-			Token:    req.Attestation,
-			DeviceID: req.DeviceID,
+			Platform:    req.Platform,
+			Token:       req.Attestation,
+			DeviceID:    req.DeviceID,
+			Region:      region,
+			RequestType: req.AttestationRequestType,
+			Environment: req.AttestationEnvironment,
+			BundleID:    req.AttestationBundleID,
+			TokenType:   req.AttestationTokenType,
+
+			ClientIP:     c.ClientIP(),
+			ClientRegion: h.clientRegion(c),
 		}
-		
+
+		endAttestation := timer.Start(metrics.PhaseAttestation)
 		result, err := h.attestationService.VerifyAttestation(c.Request.Context(), attestReq)
+		endAttestation()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "attestation_verification_failed"})
+			respondAttestationError(c, err, "attestation_verification_failed")
 			return
 		}
 		attestationResult = result
 	}
 
-	// Select region
-	region := req.Region
-	if region == "" {
-		// Auto-detect region from Cloudflare or other CDN headers
-		country := c.GetHeader("CF-IPCountry")
-		if country != "" {
-			region = h.mapCountryToRegion(country)
-		} else {
-			// Fallback to default region
-			region = "us-east-1"
-		}
-	}
-
-	// Convert attestation result to config package type
-	var configAttestationResult *config.AttestationResult
+	// Decide probation and honeypots on the device's attestation
 	if attestationResult != nil {
-		configAttestationResult = &config.AttestationResult{
-			IsValid:         attestationResult.IsValid,
-			DeviceIntegrity: attestationResult.DeviceIntegrity,
+		attestationResult.Probation = h.onProbation(c.Request.Context(), req.DeviceID, attestationResult.IsValid)
+		attestationResult.Honeypots = h.attestationService.ShouldUseHoneypot(c.Request.Context(), req.DeviceID, c.ClientIP(), attestationResult)
+	} else if previous := h.sessionAttestation(req.DeviceID, req.AttestationSession); previous != nil {
+		// A device holding a session from /attest need not attest again;
+		// once it expires the device is unattested
+		previous.Probation = h.stillOnProbation(c.Request.Context(), req.DeviceID)
+		previous.Honeypots = h.attestationService.ShouldUseHoneypot(c.Request.Context(), req.DeviceID, c.ClientIP(), previous)
+		attestationResult = previous
+	} else if h.attestationService != nil {
+		attestationResult = &attestation.AttestationResult{
+			Unattested: true,
+			Honeypots:  h.attestationService.ShouldUseHoneypot(c.Request.Context(), req.DeviceID, c.ClientIP(), nil),
 		}
 	}
 
-	// Generate config pack
+	// Generate config pack; transport policies follow the client's country
+	countryCode, _ := gateway.ParseCountry(country)
 	pack, err := h.configService.GenerateConfigPack(
 		c.Request.Context(),
 		req.DeviceID,
 		region,
-		configAttestationResult,
+		countryCode,
+		req.Locale,
+		config.ClientInfo{Platform: req.Platform, Version: req.Version, SignatureAlg: req.SigAlg, Address: c.ClientIP()},
+		packVersion,
+		attestationResult,
+		timer,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "config_generation_failed"})
+		respondError(c, err, "config_generation_failed")
 		return
 	}
 
-	metrics.ConfigPackGenerated.WithLabelValues(region).Inc()
+	countConfigPack(pack, country)
+	h.recordIssuance(pack)
+	h.logIssuance(req.DeviceID, region, pack)
+	h.recordEndpointAllocations(pack)
 
-	c.JSON(http.StatusOK, GetConfigResponse{
-		ConfigPack: pack,
-	})
+	endSerialization := timer.Start(metrics.PhaseSerialization)
+	response, err := h.configResponse(req.DeviceID, req.CurrentPackHash, pack, packVersion)
+	var body []byte
+	var contentType string
+	if err == nil {
+		body, contentType, err = h.configResponseBody(response, format, encoding)
+	}
+	endSerialization()
+	if err != nil {
+		respondError(c, err, "config_generation_failed")
+		return
+	}
+	writeConfigResponse(c, body, contentType, encoding)
+	timer.Observe(metrics.ConfigPhaseDuration)
+}
+
+// configResponseBody serializes a config response with its pack in format,
+// as CBOR for the cbor format and JSON otherwise, and compresses it with
+// encoding. Signatures cover the uncompressed canonical encodings, so
+// clients verify after decompressing. It returns the body and its type.
+func (h *Handler) configResponseBody(response *GetConfigResponse, format, encoding string) ([]byte, string, error) {
+	if err := h.encodeConfigPack(response, format); err != nil {
+		return nil, "", err
+	}
+	body, contentType := []byte(nil), "application/json; charset=utf-8"
+	var err error
+	if format == config.PackFormatCBOR {
+		body, err = config.MarshalCBOR(response)
+		contentType = "application/cbor"
+	} else {
+		body, err = json.Marshal(response)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if body, err = compressBody(encoding, body); err != nil {
+		return nil, "", err
+	}
+	return body, contentType, nil
+}
+
+// writeConfigResponse sends a serialized config response
+func writeConfigResponse(c *gin.Context, body []byte, contentType, encoding string) {
+	c.Header("Vary", "Accept, Accept-Encoding")
+	if encoding != encodingIdentity {
+		c.Header("Content-Encoding", encoding)
+	}
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// packExpiry is when pack expires
+func packExpiry(pack *config.SignedConfigPack) *time.Time {
+	expiresAt := time.Unix(pack.ExpiresAt, 0).UTC()
+	return &expiresAt
+}
+
+// packFormat returns the pack format a config request asked for, from its
+// format field or else its Accept header, reporting false for an unknown
+// format
+func packFormat(requested, accept string) (string, bool) {
+	switch requested {
+	case config.PackFormatJSON, config.PackFormatJWS, config.PackFormatCBOR:
+		return requested, true
+	case "":
+		for _, mediaType := range strings.Split(accept, ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			switch strings.ToLower(strings.TrimSpace(mediaType)) {
+			case "application/jose":
+				return config.PackFormatJWS, true
+			case "application/cbor":
+				return config.PackFormatCBOR, true
+			}
+		}
+		return config.PackFormatJSON, true
+	default:
+		return "", false
+	}
+}
+
+// encodeConfigPack moves a response's pack into config_pack_jws or
+// config_pack_cbor when the jws or cbor format was requested
+func (h *Handler) encodeConfigPack(response *GetConfigResponse, format string) error {
+	if response.ConfigPack == nil {
+		return nil
+	}
+	switch format {
+	case config.PackFormatJWS:
+		token, err := h.configService.EncodePackJWS(response.ConfigPack)
+		if err != nil {
+			return err
+		}
+		response.ConfigPackJWS = token
+	case config.PackFormatCBOR:
+		encoded, err := config.EncodePackCBOR(response.ConfigPack)
+		if err != nil {
+			return err
+		}
+		response.ConfigPackCBOR = encoded
+	default:
+		return nil
+	}
+	response.ConfigPack = nil
+	return nil
+}
+
+// configResponse answers a config request with pack, or with a signed
+// not-modified when the client's current pack has the same content
+func (h *Handler) configResponse(
+	deviceID, currentPackHash string,
+	pack *config.SignedConfigPack,
+	packVersion string,
+) (*GetConfigResponse, error) {
+	packHash, err := pack.ContentHash()
+	if err != nil {
+		return nil, err
+	}
+	if currentPackHash == packHash {
+		notModified, err := h.configService.NotModified(deviceID, packHash, pack.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		return &GetConfigResponse{PackVersion: packVersion, ExpiresAt: packExpiry(pack), PackHash: packHash, NotModified: notModified}, nil
+	}
+
+	response := &GetConfigResponse{
+		ConfigPack:  pack,
+		PackVersion: packVersion,
+		ExpiresAt:   packExpiry(pack),
+		PackHash:    packHash,
+	}
+	if currentPackHash != "" {
+		response.ChangedSince = h.configService.ChangesSince(currentPackHash, pack)
+	}
+	h.configService.RememberPack(packHash, pack)
+	return response, nil
+}
+
+// sessionAttestation returns the attestation a device's session token
+// vouches for, checked without verifying or reading any attestation. Without
+// a session, or with one that does not verify, the device is unattested: a
+// stored attestation is never enough, since any client can name a device.
+func (h *Handler) sessionAttestation(deviceID, session string) *attestation.AttestationResult {
+	if session == "" || h.attestationService == nil {
+		return nil
+	}
+	result, err := h.attestationService.VerifySession(session, deviceID)
+	if err != nil {
+		log.Printf("attestation session rejected for device=%s: %v", deviceID, err)
+		return nil
+	}
+	return result
 }
 
-// mapCountryToRegion maps ISO country codes to infrastructure regions
+// StartCountryRegionRefresh reloads the country region overrides every
+// interval until ctx is done
+func (h *Handler) StartCountryRegionRefresh(ctx context.Context, interval time.Duration) {
+	h.countryRegions.Start(ctx, interval)
+}
+
+// mapCountryToRegion maps ISO country codes to infrastructure regions,
+// falling back to the default region for codes that name no country
 func (h *Handler) mapCountryToRegion(country string) string {
-	mapping := map[string]string{
-		"CN": "ap-east-1",
-		"IR": "me-south-1",
-		"RU": "eu-central-1",
-		"US": "us-east-1",
-		"GB": "eu-west-1",
-		"DE": "eu-central-1",
-		// Add more mappings as needed
-	}
-	
-	if region, ok := mapping[country]; ok {
+	if region, ok := h.countryRegions.Lookup(country); ok {
+		return region
+	}
+	return config.DefaultRegion
+}
+
+// validLocation reports whether the request's coordinates are both absent,
+// or both present and in range
+func validLocation(latitude, longitude *float64) bool {
+	if latitude == nil || longitude == nil {
+		return latitude == nil && longitude == nil
+	}
+	_, err := geo.NewLocation(*latitude, *longitude)
+	return err == nil
+}
+
+// nearestRegion returns the region to serve the client from. An override for
+// its country always wins, then the country's mapped region while it is
+// available. Otherwise it is the available region nearest the client,
+// located by its coordinates or else its country's centroid. Without a
+// location, or when no region can be ranked, it returns the mapped region.
+func (h *Handler) nearestRegion(ctx context.Context, country string, latitude, longitude *float64) string {
+	if region, ok := h.countryRegions.Override(country); ok {
 		return region
 	}
-	return "us-east-1" // Default
+	mapped, _ := h.countryRegions.Lookup(country)
+	if h.geoBalancer == nil {
+		return mapped
+	}
+	origin, located := geo.ClientLocation(country, latitude, longitude)
+	region, err := h.geoBalancer.RegionForClient(ctx, mapped, origin, located)
+	if err != nil {
+		log.Printf("region availability unavailable, using the country's region: %v", err)
+		return mapped
+	}
+	return region
+}
+
+// clientRegion returns the region of the client's CF-IPCountry, or empty
+// without the header
+func (h *Handler) clientRegion(c *gin.Context) string {
+	country := c.GetHeader("CF-IPCountry")
+	if country == "" {
+		return ""
+	}
+	return h.mapCountryToRegion(country)
+}
+
+// countConfigPack counts a generated pack by the region it was built for and
+// the config version it was built from, and its demand by that region, the
+// client's country and whether the region is open, so closed-region demand
+// shows where to expand. Unknown regions and countries are counted as
+// "unknown".
+func countConfigPack(pack *config.SignedConfigPack, country string) {
+	region, _ := pack.Metadata["region"].(string)
+	if region == "" {
+		region = "unknown"
+	}
+	code, ok := gateway.ParseCountry(country)
+	if !ok {
+		code = "unknown"
+	}
+	status := "open"
+	if pack.Metadata["region_status"] == config.RegionStatusClosed {
+		status = config.RegionStatusClosed
+	}
+	metrics.ConfigPackGenerated.WithLabelValues(region).Inc()
+	if version, ok := pack.Metadata["config_version"].(string); ok {
+		metrics.ConfigPackVersion.WithLabelValues(version).Inc()
+	}
+	metrics.RegionDemand.WithLabelValues(region, code, status).Inc()
+}
+
+// recordIssuance counts the pack against each of our non-honeypot gateways
+// it lists
+func (h *Handler) recordIssuance(pack *config.SignedConfigPack) {
+	if h.issuance == nil {
+		return
+	}
+	ids := make([]string, 0, len(pack.Gateways))
+	for _, gw := range pack.Gateways {
+		if gw.Origin == "" && !gw.IsHoneypot {
+			ids = append(ids, gw.ID)
+		}
+	}
+	h.issuance.Record(ids)
+}
+
+// logIssuance records the pack, and every gateway it lists, in the device's
+// issuance log
+func (h *Handler) logIssuance(deviceID, region string, pack *config.SignedConfigPack) {
+	if h.issuanceLog == nil || deviceID == "" {
+		return
+	}
+	hash, err := pack.ContentHash()
+	if err != nil {
+		log.Printf("Failed to hash config pack for the issuance log: %v", err)
+		return
+	}
+	ids := make([]string, 0, len(pack.Gateways))
+	for _, gw := range pack.Gateways {
+		ids = append(ids, gw.ID)
+	}
+	h.issuanceLog.Record(issuance.Record{DeviceID: deviceID, PackHash: hash, Region: region, GatewayIDs: ids})
+}
+
+// recordEndpointAllocations counts the pack against each pool endpoint
+// allocated in it
+func (h *Handler) recordEndpointAllocations(pack *config.SignedConfigPack) {
+	if h.allocations == nil {
+		return
+	}
+	h.allocations.Record(pack.EndpointAllocations())
+}
+
+// countAdmission counts a new device's admission outcome by region
+func countAdmission(region, outcome string) {
+	if region == "" {
+		region = "unknown"
+	}
+	metrics.AdmissionRequests.WithLabelValues(region, outcome).Inc()
+}
+
+// respondAttestationError responds to a failed verification, telling clients
+// shed by a saturated attestation pool when to retry
+func respondAttestationError(c *gin.Context, err error, fallbackCode string) {
+	if errors.Is(err, attestation.ErrAttestationBusy) {
+		c.Header("Retry-After", strconv.Itoa(int(attestation.BusyRetryAfter/time.Second)))
+	}
+	respondError(c, err, fallbackCode)
 }
 
 // VerifyAttestationRequest represents an attestation verification request
@@ -160,25 +732,92 @@ type VerifyAttestationRequest struct {
 	Token    string `json:"token" binding:"required"`
 	DeviceID string `json:"device_id" binding:"required"`
 	KeyID    string `json:"key_id"` // For iOS DCAppAttest
+	Region   string `json:"region"` // Optional; detected from the client's country otherwise
+	// RequestType is the Play Integrity flow of an Android token: "classic"
+	// (default) or "standard"
+	RequestType string `json:"request_type,omitempty"`
+	// Environment is the App Attest environment of an iOS token; empty is
+	// the server's. BundleID is the iOS app's; empty is the server's
+	// APPLE_BUNDLE_ID.
+	Environment string `json:"environment,omitempty" enum:"production,development"`
+	BundleID    string `json:"bundle_id,omitempty"`
+	// TokenType is what an Android token is: "play_integrity" (default) or,
+	// for devices without Google Play services, "key_attestation", a JSON
+	// object whose certificate_chain is the attested key's base64 DER
+	// certificates, leaf first
+	TokenType string `json:"token_type,omitempty" enum:"play_integrity,key_attestation"`
+}
+
+// DesktopEnrollmentRequest enrolls the key a desktop client generated at
+// install time
+type DesktopEnrollmentRequest struct {
+	DeviceID  string `json:"device_id" binding:"required"`
+	PublicKey []byte `json:"public_key" binding:"required"` // Ed25519, base64
+}
+
+// DesktopEnrollmentResponse confirms a desktop enrollment
+type DesktopEnrollmentResponse struct {
+	DeviceID string `json:"device_id"`
+	Enrolled bool   `json:"enrolled"`
 }
 
 // VerifyAttestationResponse represents an attestation verification response
 type VerifyAttestationResponse struct {
-	Verified       bool   `json:"verified"`
+	Verified        bool   `json:"verified"`
 	DeviceIntegrity string `json:"device_integrity,omitempty"`
-	Reason         string `json:"reason,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+
+	// SessionToken vouches for a successful attestation until
+	// SessionExpiresAt; send it as attestation_session with /config instead
+	// of the attestation token.
+	SessionToken     string     `json:"session_token,omitempty"`
+	SessionExpiresAt *time.Time `json:"session_expires_at,omitempty"`
+
+	// ErrorCode groups Reason by what the client should do next, and
+	// Retryable tells it whether trying again may succeed. Both are set on
+	// failures only; Error repeats the code of requests that could not be
+	// verified at all, as in the API's other error responses.
+	ErrorCode string `json:"error_code,omitempty" enum:"integrity_failed,invalid_token,challenge_failed,reattestation_required,device_revoked,unsupported,unavailable,rate_limited,attestation_failed"`
+	Retryable bool   `json:"retryable"`
+	Error     string `json:"error,omitempty"`
 }
 
-// GetAttestationChallenge returns a random challenge for iOS App Attest
+// GetAttestationChallenge returns a random challenge for iOS App Attest, or
+// whose hash an Android client binds its Play Integrity token to
 func (h *Handler) GetAttestationChallenge(c *gin.Context) {
-	challenge, err := h.attestationService.GenerateChallenge(c.Request.Context())
+	// The challenge is only good for the device that asked for it
+	deviceID := c.Query("device_id")
+	if len(deviceID) > maxDeviceIDLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_device_id"})
+		return
+	}
+	challenge, err := h.attestationService.GenerateChallenge(c.Request.Context(), deviceID, c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "challenge_generation_failed"})
+		respondError(c, err, "challenge_generation_failed")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"challenge": challenge})
 }
 
+// EnrollDesktopDevice records a desktop client's key. Enrolling the same key
+// again is accepted; a device enrolled with another key is a conflict.
+func (h *Handler) EnrollDesktopDevice(c *gin.Context) {
+	var req DesktopEnrollmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.DeviceID) > maxDeviceIDLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_device_id"})
+		return
+	}
+	if err := h.attestationService.EnrollDesktopKey(c.Request.Context(), req.DeviceID, req.PublicKey); err != nil {
+		respondError(c, err, "desktop_enrollment_failed")
+		return
+	}
+	c.JSON(http.StatusCreated, DesktopEnrollmentResponse{DeviceID: req.DeviceID, Enrolled: true})
+}
+
 // VerifyAttestation handles attestation verification requests
 func (h *Handler) VerifyAttestation(c *gin.Context) {
 	var req VerifyAttestationRequest
@@ -187,18 +826,32 @@ func (h *Handler) VerifyAttestation(c *gin.Context) {
 		return
 	}
 
+	region := req.Region
+	if region == "" {
+		region, _ = h.countryRegions.Lookup(c.GetHeader("CF-IPCountry"))
+	}
 	attestReq := &attestation.AttestationRequest{
-		Platform: req.Platform,
-		Token:    req.Token,
-		DeviceID: req.DeviceID,
-		KeyID:    req.KeyID,
+		Platform:    req.Platform,
+		Token:       req.Token,
+		DeviceID:    req.DeviceID,
+		KeyID:       req.KeyID,
+		Region:      region,
+		RequestType: req.RequestType,
+		Environment: req.Environment,
+		BundleID:    req.BundleID,
+		TokenType:   req.TokenType,
+
+		ClientIP:     c.ClientIP(),
+		ClientRegion: h.clientRegion(c),
 	}
 
 	result, err := h.attestationService.VerifyAttestation(c.Request.Context(), attestReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "verification_failed"})
+		respondVerificationError(c, result, err)
 		return
 	}
+	// Assertions count towards the device's trust like attestations in config requests
+	h.onProbation(c.Request.Context(), req.DeviceID, result.IsValid)
 
 	response := VerifyAttestationResponse{
 		Verified:        result.IsValid,
@@ -207,30 +860,67 @@ func (h *Handler) VerifyAttestation(c *gin.Context) {
 
 	if !result.IsValid {
 		response.Reason = result.Reason
+		response.ErrorCode, response.Retryable = classifyAttestationFailure(result.Reason)
 		c.JSON(http.StatusUnauthorized, response)
 		return
 	}
+	if token, expires, ok := h.attestationService.IssueSession(result); ok {
+		response.SessionToken, response.SessionExpiresAt = token, &expires
+	}
 
 	c.JSON(http.StatusOK, response)
 }
 
 // GatewayStatusRequest represents a gateway status update request
 type GatewayStatusRequest struct {
-	GatewayID        string  `json:"gateway_id" binding:"required"`
-	Status           string  `json:"status" binding:"required"`
-	UsersConnected   int     `json:"users_connected"`
-	BandwidthUsedMbps int    `json:"bandwidth_used_mbps"`
-	PacketsForwarded int64   `json:"packets_forwarded"`
-	UptimePercent    float64 `json:"uptime_percent"`
+	GatewayID         string  `json:"gateway_id" binding:"required"`
+	Status            string  `json:"status" binding:"required" enum:"active,degraded,offline,maintenance"`
+	UsersConnected    int     `json:"users_connected"`
+	BandwidthUsedMbps int     `json:"bandwidth_used_mbps"`
+	PacketsForwarded  int64   `json:"packets_forwarded"`
+	UptimePercent     float64 `json:"uptime_percent"`
+
+	// ReportedAt is the gateway's own clock (RFC 3339) and Sequence its
+	// heartbeat counter. A repeated sequence is rejected with 409.
+	ReportedAt *time.Time `json:"reported_at,omitempty"`
+	Sequence   *int64     `json:"sequence,omitempty"`
+}
+
+// statusMaxSkew bounds how far a gateway's reported_at may be from server time
+const statusMaxSkew = 5 * time.Minute
+
+// DirectiveDrain tells an agent that this replica is shutting down
+const DirectiveDrain = "drain"
+
+// GatewayDirective is an instruction to the gateway agent sent with a
+// heartbeat response
+type GatewayDirective struct {
+	Type             string `json:"type"`
+	ReconnectAfterMs int64  `json:"reconnect_after_ms"` // Wait before the next heartbeat
 }
 
 // GatewayStatusResponse represents a gateway status response
 type GatewayStatusResponse struct {
-	Acknowledged bool `json:"acknowledged"`
+	Acknowledged bool              `json:"acknowledged"`
+	Directive    *GatewayDirective `json:"directive,omitempty"`
 }
 
-// HandleGatewayStatus handles gateway status updates
+// HandleGatewayStatus handles gateway status updates. Every heartbeat must
+// be signed with the gateway's key over gateway.RequestBodyMessage, so no
+// one else can report a gateway's status or load.
 func (h *Handler) HandleGatewayStatus(c *gin.Context) {
+	timestamp, signature, ok := gatewayRequestSignature(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_signature"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPreferencesBody+1))
+	if err != nil || len(body) > maxPreferencesBody {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_body"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
 	var req GatewayStatusRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -249,112 +939,391 @@ func (h *Handler) HandleGatewayStatus(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_uptime"})
 		return
 	}
+	if req.Sequence != nil {
+		if *req.Sequence < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_sequence"})
+			return
+		}
+		// Without a timestamp an old heartbeat could be replayed once its
+		// sequence has been pruned
+		if req.ReportedAt == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reported_at_required"})
+			return
+		}
+	}
+	if req.ReportedAt != nil {
+		skew := h.now().Sub(*req.ReportedAt)
+		if skew > statusMaxSkew || skew < -statusMaxSkew {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":            "clock_skew",
+				"max_skew_seconds": int(statusMaxSkew.Seconds()),
+			})
+			return
+		}
+	}
+
+	if h.database == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database_unavailable"})
+		return
+	}
+	if _, err := h.registry.AuthenticateGateway(c.Request.Context(), req.GatewayID, c.Request.URL.Path, body, timestamp, signature); err != nil {
+		respondError(c, err, "authentication_failed")
+		return
+	}
 
-	if h.database != nil {
-		err := h.database.RecordGatewayStatus(
-			c.Request.Context(),
-			req.GatewayID,
-			req.Status,
-			req.UsersConnected,
-			req.BandwidthUsedMbps,
-			req.PacketsForwarded,
-			req.UptimePercent,
-		)
-		if err != nil {
-			if errors.Is(err, db.ErrGatewayNotFound) {
-				c.JSON(http.StatusNotFound, gin.H{"error": "gateway_not_found"})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "gateway_status_store_failed"})
+	err = h.database.RecordGatewayStatus(
+		c.Request.Context(),
+		req.GatewayID,
+		req.Status,
+		req.UsersConnected,
+		req.BandwidthUsedMbps,
+		req.PacketsForwarded,
+		req.UptimePercent,
+		req.ReportedAt,
+		req.Sequence,
+	)
+	if err != nil {
+		// Echo the sequence so the gateway can tell which report was a replay
+		if errors.Is(err, db.ErrDuplicateSequence) {
+			c.JSON(http.StatusConflict, gin.H{"error": "duplicate_sequence", "sequence": *req.Sequence})
 			return
 		}
-		metrics.GatewayStatusUpdates.Inc()
+		respondError(c, err, "gateway_status_store_failed")
+		return
+	}
+	metrics.GatewayStatusUpdates.Inc()
+	h.checkBandwidthCap(c.Request.Context(), req.GatewayID, req.BandwidthUsedMbps)
+
+	resp := GatewayStatusResponse{Acknowledged: true}
+	if h.drain.Draining() {
+		resp.Directive = &GatewayDirective{
+			Type:             DirectiveDrain,
+			ReconnectAfterMs: h.drain.ReconnectAfter().Milliseconds(),
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GatewayRegistrationRequest represents a gateway registration request. The
+// operator is the one the X-Operator-Token credential was issued to.
+type GatewayRegistrationRequest struct {
+	OperatorID        string   `json:"operator_id,omitempty"`         // Optional; must be the credential's operator
+	PublicKey         []byte   `json:"public_key" binding:"required"` // base64
+	IPAddress         string   `json:"ip_address" binding:"required"`
+	Port              int      `json:"port" binding:"required"`
+	TransportTypes    []string `json:"transport_types" binding:"required" enum:"masque,xtls,parasite,ssh"`
+	DiscoveryChannels []string `json:"discovery_channels" enum:"gps,fm_rds,dtv,plc,gsm_cb,lte_sib,iot_mqtt,blockchain,satellite,intranet,social"`
+	Region            string   `json:"region" binding:"required"`
+	BandwidthMbps     *int     `json:"bandwidth_mbps"`
+	MaxUsers          *int     `json:"max_users"`
+	ASN               *int     `json:"asn"`
+
+	// KeyProof is signed with the key being registered over
+	// gateway.RegistrationMessage, to show the caller holds it
+	KeyProof *GatewayConfirmation `json:"key_proof" binding:"required"`
+
+	// Confirmation is required to change the attributes of an already registered
+	// public key; see gateway.ConfirmationMessage for the signed payload.
+	Confirmation *GatewayConfirmation `json:"confirmation,omitempty"`
+}
+
+// GatewayConfirmation is a signature with the gateway key, as a
+// re-registration confirmation or a registration's key proof
+type GatewayConfirmation struct {
+	Timestamp int64  `json:"timestamp" binding:"required"` // Unix seconds
+	Signature []byte `json:"signature" binding:"required"` // base64
+}
+
+// GatewayRegistrationResponse represents a gateway registration response
+type GatewayRegistrationResponse struct {
+	Outcome        string   `json:"outcome" enum:"created,already_exists,updated"`
+	GatewayID      string   `json:"gateway_id"`
+	ApprovalStatus string   `json:"approval_status"`
+	QuotaReasons   []string `json:"quota_reasons,omitempty"`
+}
+
+// RegisterGateway handles gateway registration by an operator holding an
+// operator credential, with proof it holds the gateway key. Registrations
+// over the operator or subnet quota are accepted as pending admin approval
+// (202). Repeating a registration returns the existing gateway (200);
+// changing the attributes of a registered key requires a signed confirmation
+// (409 until one is supplied).
+func (h *Handler) RegisterGateway(c *gin.Context) {
+	var req GatewayRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, GatewayStatusResponse{
-		Acknowledged: true,
+	operatorID, err := h.registry.AuthenticateOperatorCredential(c.Request.Context(), c.GetHeader("X-Operator-Token"))
+	if err != nil {
+		respondError(c, err, "authentication_failed")
+		return
+	}
+	if req.OperatorID != "" && req.OperatorID != operatorID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "operator_mismatch"})
+		return
+	}
+
+	if len(req.Region) > 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_field_length"})
+		return
+	}
+	if code := validateGatewayCapabilities(req.PublicKey, req.Port, req.TransportTypes, req.DiscoveryChannels, req.BandwidthMbps, req.MaxUsers); code != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": code})
+		return
+	}
+
+	registration := &gateway.Registration{
+		OperatorID:        operatorID,
+		PublicKey:         req.PublicKey,
+		IPAddress:         req.IPAddress,
+		Port:              req.Port,
+		TransportTypes:    req.TransportTypes,
+		DiscoveryChannels: req.DiscoveryChannels,
+		Region:            req.Region,
+		BandwidthMbps:     req.BandwidthMbps,
+		MaxUsers:          req.MaxUsers,
+		ASN:               req.ASN,
+		KeyProof: &gateway.Confirmation{
+			Timestamp: req.KeyProof.Timestamp,
+			Signature: req.KeyProof.Signature,
+		},
+	}
+	if req.Confirmation != nil {
+		registration.Confirmation = &gateway.Confirmation{
+			Timestamp: req.Confirmation.Timestamp,
+			Signature: req.Confirmation.Signature,
+		}
+	}
+
+	result, err := h.registry.Register(c.Request.Context(), registration)
+	if err != nil {
+		respondError(c, err, "gateway_registration_failed")
+		return
+	}
+
+	var status int
+	switch {
+	case result.Outcome == gateway.OutcomeConfirmationRequired:
+		c.JSON(http.StatusConflict, gin.H{"error": "confirmation_required", "gateway_id": result.GatewayID})
+		return
+	case result.Outcome != gateway.OutcomeCreated:
+		status = http.StatusOK
+	case result.ApprovalStatus == gateway.ApprovalPending:
+		status = http.StatusAccepted
+	default:
+		status = http.StatusCreated
+	}
+	c.JSON(status, GatewayRegistrationResponse{
+		Outcome:        result.Outcome,
+		GatewayID:      result.GatewayID,
+		ApprovalStatus: result.ApprovalStatus,
+		QuotaReasons:   result.QuotaReasons,
 	})
 }
 
+// validateGatewayCapabilities checks what a gateway reports about itself
+// when registering or bootstrapping. It returns the error code for an
+// invalid field.
+func validateGatewayCapabilities(publicKey []byte, port int, transports, channels []string, bandwidthMbps, maxUsers *int) string {
+	if len(publicKey) != 32 {
+		return "invalid_public_key"
+	}
+	if port <= 0 || port > 65535 {
+		return "invalid_port"
+	}
+	if len(transports) == 0 {
+		return "invalid_transport_type"
+	}
+	for _, transport := range transports {
+		if _, ok := allowedTransportTypes[transport]; !ok {
+			return "invalid_transport_type"
+		}
+	}
+	for _, channel := range channels {
+		if _, ok := allowedDiscoveryChannels[channel]; !ok {
+			return "invalid_channel_type"
+		}
+	}
+	if (bandwidthMbps != nil && *bandwidthMbps <= 0) || (maxUsers != nil && *maxUsers <= 0) {
+		return "invalid_capacity"
+	}
+	return ""
+}
+
 // DiscoveryLogRequest represents a discovery log entry
 type DiscoveryLogRequest struct {
-	ChannelType string `json:"channel_type" binding:"required"`
+	EventID     string `json:"event_id,omitempty"` // Client-generated UUID, repeated on retries
+	ChannelType string `json:"channel_type" binding:"required" enum:"gps,fm_rds,dtv,plc,gsm_cb,lte_sib,iot_mqtt,blockchain,satellite,intranet,social"`
 	GatewayID   string `json:"gateway_id,omitempty"`
+	DeviceID    string `json:"device_id,omitempty"` // Never stored with the log
 	Success     bool   `json:"success"`
 	LatencyMs   int    `json:"latency_ms,omitempty"`
-	Error       string `json:"error,omitempty"`
+	Error       string `json:"error,omitempty"` // Sanitized and cut to maxDiscoveryErrorLen bytes
+
+	// AttestationSession is the device's session_token from /attest. Only
+	// attempts sent with a valid session count towards the device's trust
+	// tier, since anyone can name a device.
+	AttestationSession string `json:"attestation_session,omitempty"`
 }
 
+// maxDiscoveryErrorLen bounds a discovery log's stored error message
+const maxDiscoveryErrorLen = 512
+
 // DiscoveryLogResponse represents a discovery log response
 type DiscoveryLogResponse struct {
-	Logged bool `json:"logged"`
+	Logged    bool `json:"logged"`
+	Duplicate bool `json:"duplicate,omitempty"` // Already logged under this event_id; not counted again
+}
+
+// DiscoveryLogBatchRequest carries several discovery log entries
+type DiscoveryLogBatchRequest struct {
+	Entries []DiscoveryLogRequest `json:"entries" binding:"required"`
+}
+
+// DiscoveryLogBatchResponse counts what a batch did
+type DiscoveryLogBatchResponse struct {
+	Logged     int `json:"logged"`
+	Duplicates int `json:"duplicates"` // Acknowledged but not logged again
 }
 
-// HandleDiscoveryLog handles discovery channel logs
+// maxDiscoveryLogBatch bounds the entries in one batch
+const maxDiscoveryLogBatch = 100
+
+// HandleDiscoveryLog handles discovery channel logs. Entries repeating an
+// event_id logged in the last day are acknowledged but not stored or counted.
 func (h *Handler) HandleDiscoveryLog(c *gin.Context) {
 	var req DiscoveryLogRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	entry, code := h.discoveryLogEntry(c, &req)
+	if code != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": code})
+		return
+	}
 
-	if _, ok := allowedDiscoveryChannels[req.ChannelType]; !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_channel_type"})
+	resp := DiscoveryLogResponse{Logged: true}
+	if h.database != nil {
+		results, err := h.database.RecordDiscoveryLogs(c.Request.Context(), []db.DiscoveryLogEntry{entry}, h.now().Add(-db.DiscoveryDedupeWindow))
+		if err != nil {
+			respondError(c, err, "discovery_log_store_failed")
+			return
+		}
+		countDiscoveryLog(entry, results[0])
+		h.observeDiscovery(c.Request.Context(), &req, entry, results[0])
+		resp.Duplicate = results[0].Duplicate
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleDiscoveryLogBatch logs several discovery attempts at once, for
+// clients that queue them while offline. The batch is stored atomically;
+// entries repeating an event_id, within the batch or from an earlier
+// request, are acknowledged but not stored or counted.
+func (h *Handler) HandleDiscoveryLogBatch(c *gin.Context) {
+	var req DiscoveryLogBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if req.LatencyMs < 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_latency"})
+	if len(req.Entries) == 0 || len(req.Entries) > maxDiscoveryLogBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_batch_size", "max_entries": maxDiscoveryLogBatch})
 		return
 	}
+	entries := make([]db.DiscoveryLogEntry, len(req.Entries))
+	for i := range req.Entries {
+		entry, code := h.discoveryLogEntry(c, &req.Entries[i])
+		if code != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": code, "index": i})
+			return
+		}
+		entries[i] = entry
+	}
 
+	resp := DiscoveryLogBatchResponse{Logged: len(entries)}
 	if h.database != nil {
-		var gatewayID *string
-		if req.GatewayID != "" {
-			gatewayID = &req.GatewayID
-		}
-		clientIP := c.ClientIP()
-		var clientIPPtr *string
-		if clientIP != "" {
-			clientIPPtr = &clientIP
-		}
-		var regionPtr *string
-		country := c.GetHeader("CF-IPCountry")
-		if country != "" {
-			region := h.mapCountryToRegion(country)
-			regionPtr = &region
-		}
-		var latencyPtr *int
-		if req.LatencyMs > 0 {
-			latencyPtr = &req.LatencyMs
+		results, err := h.database.RecordDiscoveryLogs(c.Request.Context(), entries, h.now().Add(-db.DiscoveryDedupeWindow))
+		if err != nil {
+			respondError(c, err, "discovery_log_store_failed")
+			return
 		}
-		var errorPtr *string
-		if req.Error != "" {
-			errorPtr = &req.Error
+		resp.Logged = 0
+		for i, result := range results {
+			countDiscoveryLog(entries[i], result)
+			h.observeDiscovery(c.Request.Context(), &req.Entries[i], entries[i], result)
+			if result.Duplicate {
+				resp.Duplicates++
+			} else {
+				resp.Logged++
+			}
 		}
+	}
 
-		if err := h.database.RecordDiscoveryLog(
-			c.Request.Context(),
-			req.ChannelType,
-			gatewayID,
-			clientIPPtr,
-			regionPtr,
-			req.Success,
-			latencyPtr,
-			errorPtr,
-		); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "discovery_log_store_failed"})
-			return
-		}
-		successLabel := "false"
-		if req.Success {
-			successLabel = "true"
+	c.JSON(http.StatusOK, resp)
+}
+
+// discoveryLogEntry validates a discovery log request and builds its entry
+// from the request and the client's connection. It returns an error code if
+// the request is invalid.
+func (h *Handler) discoveryLogEntry(c *gin.Context, req *DiscoveryLogRequest) (db.DiscoveryLogEntry, string) {
+	if _, ok := allowedDiscoveryChannels[req.ChannelType]; !ok {
+		return db.DiscoveryLogEntry{}, "invalid_channel_type"
+	}
+	if req.LatencyMs < 0 {
+		return db.DiscoveryLogEntry{}, "invalid_latency"
+	}
+
+	entry := db.DiscoveryLogEntry{ChannelType: req.ChannelType, Success: req.Success}
+	if req.EventID != "" {
+		// UUIDs are compared in lowercase; some platforms format them in upper
+		eventID := strings.ToLower(req.EventID)
+		if !gatewayIDPattern.MatchString(eventID) {
+			return db.DiscoveryLogEntry{}, "invalid_event_id"
 		}
-		metrics.DiscoveryLogs.WithLabelValues(req.ChannelType, successLabel).Inc()
+		entry.EventID = &eventID
+	}
+	if req.GatewayID != "" {
+		entry.GatewayID = &req.GatewayID
+	}
+	if clientIP := c.ClientIP(); clientIP != "" {
+		entry.ClientIP = &clientIP
+	}
+	country := c.GetHeader("CF-IPCountry")
+	if country != "" {
+		region := h.mapCountryToRegion(country)
+		entry.Region = &region
+	}
+	if code, ok := gateway.ParseCountry(country); ok {
+		entry.Country = &code
 	}
+	if req.LatencyMs > 0 {
+		entry.LatencyMs = &req.LatencyMs
+	}
+	if message := sanitize.Text(req.Error, maxDiscoveryErrorLen); message != "" {
+		entry.ErrorMessage = &message
+	}
+	return entry, ""
+}
 
-	c.JSON(http.StatusOK, DiscoveryLogResponse{
-		Logged: true,
-	})
+// countDiscoveryLog updates the discovery metrics for one stored entry.
+// Honeypot traffic is adversarial, so it is kept out of the public success rate.
+func countDiscoveryLog(entry db.DiscoveryLogEntry, result db.DiscoveryLogResult) {
+	successLabel := "false"
+	if entry.Success {
+		successLabel = "true"
+	}
+	switch {
+	case result.Duplicate:
+		metrics.DiscoveryLogDuplicates.WithLabelValues(entry.ChannelType).Inc()
+	case result.IsHoneypot:
+		metrics.HoneypotDiscoveryLogs.WithLabelValues(entry.ChannelType, successLabel).Inc()
+	default:
+		metrics.DiscoveryLogs.WithLabelValues(entry.ChannelType, successLabel).Inc()
+	}
 }
 
 // GetGateways handles gateway listing requests for community page
@@ -366,44 +1335,62 @@ func (h *Handler) GetGateways(c *gin.Context) {
 		return
 	}
 
+	window, ok := parseUptimeWindow(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_window"})
+		return
+	}
+
 	gateways, err := h.database.GetAllGateways(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(errorStatus(err), gin.H{
 			"error": "failed to fetch gateways",
 		})
 		return
 	}
+	uptimes, err := h.registry.Uptimes(c.Request.Context(), gateways, window, h.now().UTC())
+	if err != nil {
+		respondError(c, err, "uptime_query_failed")
+		return
+	}
+	// Gateways flagged for inflating their user count show the plausible one
+	caps, err := h.database.GetGatewayUserCaps(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "gateway_fetch_failed")
+		return
+	}
 
 	// Transform gateways to API response format
+	legacy := legacyFieldNames(c)
 	gatewayList := make([]gin.H, 0, len(gateways))
 	for _, gw := range gateways {
-		// Calculate uptime from operator_metrics if available
-		// For now, use a placeholder
-		uptimePercent := 0.0
-		if gw.LastSeen != nil {
-			// Simple uptime calculation based on last seen
-			// In production, this would query operator_metrics
-			uptimePercent = 98.0 // Placeholder
-		}
-
 		callsign := "OP-unknown"
 		if len(gw.ID) >= 8 {
 			callsign = "OP-" + gw.ID[:8]
 		} else if gw.ID != "" {
 			callsign = "OP-" + gw.ID
 		}
-		gatewayList = append(gatewayList, gin.H{
-			"id":            gw.ID,
-			"callsign":      callsign,
-			"region":        gw.Region,
-			"status":        gw.Status,
-			"current_users": gw.CurrentUsers,
-			"max_users":     gw.MaxUsers,
-			"last_seen":     gw.LastSeen,
-			"uptime_percent": uptimePercent,
+		users := gw.CurrentUsers
+		if limit, ok := caps[gw.ID]; ok && users > limit {
+			users = limit
+		}
+		entry := gin.H{
+			"id":             gw.ID,
+			"callsign":       callsign,
+			"region":         gw.Region,
+			"status":         gw.Status,
+			"current_users":  users,
+			"max_users":      gw.MaxUsers,
+			"last_seen_at":   gw.LastSeen,
+			"uptime_percent": uptimes[gw.ID].Percent,
+			"uptime_window":  window,
 			// Note: lat/lng would come from a separate geolocation table
 			// For now, we'll use region-based defaults
-		})
+		}
+		if legacy {
+			entry["last_seen"] = gw.LastSeen
+		}
+		gatewayList = append(gatewayList, entry)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -2,24 +2,47 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"rendezvous/internal/attestation"
+	"rendezvous/internal/canary"
+	"rendezvous/internal/clock"
 	"rendezvous/internal/config"
 	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
 	"rendezvous/internal/geo"
+	"rendezvous/internal/lifecycle"
+	"rendezvous/internal/metrics"
+	"rendezvous/internal/store"
 )
 
 func init() {
 	gin.SetMode(gin.TestMode)
 	os.Setenv("LUMENLINK_ALLOW_EPHEMERAL_SIGNING_KEY", "true")
 	os.Setenv("LUMENLINK_ALLOW_ATTESTATION_BYPASS", "true")
+	// Most packs here are built from empty regions; borrowing from nearby
+	// regions is tested on its own
+	os.Setenv("LUMENLINK_PACK_MIN_REGION_GATEWAYS", "0")
 }
 
 func TestHealth(t *testing.T) {
@@ -44,6 +67,68 @@ func TestHealth(t *testing.T) {
 	}
 }
 
+func TestHealth_Draining(t *testing.T) {
+	drain := lifecycle.NewDrain(lifecycle.DrainConfig{})
+	handler := &Handler{}
+	handler.SetDrain(drain)
+	router := gin.New()
+	router.GET("/health", handler.Health)
+
+	for _, tt := range []struct {
+		begin    bool
+		wantCode int
+	}{
+		{false, http.StatusOK},
+		{true, http.StatusServiceUnavailable},
+	} {
+		if tt.begin {
+			drain.Begin()
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if w.Code != tt.wantCode {
+			t.Errorf("draining=%v: got %d, want %d", tt.begin, w.Code, tt.wantCode)
+		}
+	}
+}
+
+func TestHealth_Canary(t *testing.T) {
+	pack := &config.SignedConfigPack{Version: "1.0", Metadata: map[string]interface{}{}}
+	peer := &config.SignedConfigPack{Version: "2.0", Metadata: map[string]interface{}{}}
+	preview := func(p *config.SignedConfigPack) canary.Previewer {
+		return canary.PreviewerFunc(func(context.Context, canary.Profile) (*config.SignedConfigPack, error) { return p, nil })
+	}
+
+	for _, tt := range []struct {
+		name     string
+		peer     *config.SignedConfigPack
+		wantCode int
+	}{
+		{"matching", pack, http.StatusOK},
+		{"divergent", peer, http.StatusServiceUnavailable},
+	} {
+		check := canary.NewCheck(preview(pack), preview(tt.peer), canary.DefaultProfiles, canary.Config{})
+		handler := &Handler{}
+		handler.SetCanary(check)
+		router := gin.New()
+		router.GET("/health", handler.Health)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: got %d before the check ran, want 503", tt.name, w.Code)
+		}
+		if _, err := check.Run(context.Background()); err != nil {
+			t.Fatalf("%s: Run: %v", tt.name, err)
+		}
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.wantCode)
+		}
+	}
+}
+
 func TestGetAttestationChallenge(t *testing.T) {
 	database := mustTestDB(t)
 	defer database.Close()
@@ -59,7 +144,7 @@ func TestGetAttestationChallenge(t *testing.T) {
 	router := gin.New()
 	router.GET("/api/v1/attest/challenge", handler.GetAttestationChallenge)
 
-	req := httptest.NewRequest(http.MethodGet, "/api/v1/attest/challenge", nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/attest/challenge?device_id=device-1", nil)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
@@ -75,6 +160,38 @@ func TestGetAttestationChallenge(t *testing.T) {
 	}
 }
 
+func TestGetAttestationChallenge_RequiresDeviceID(t *testing.T) {
+	handler := &Handler{attestationService: attestation.NewAttestationService(nil)}
+	router := gin.New()
+	router.GET("/api/v1/attest/challenge", handler.GetAttestationChallenge)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/attest/challenge", nil))
+	if w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte(`"device_id_required"`)) {
+		t.Errorf("got %d %s, want 400 device_id_required", w.Code, w.Body.String())
+	}
+}
+
+func TestGetAttestationChallenge_OverLimit(t *testing.T) {
+	attestSvc := attestation.NewAttestationService(nil, attestation.WithChallengeLimits(attestation.ChallengeLimits{PerDevice: 1, PerIP: 10}))
+	attestSvc.SetChallengeRates(store.NewMemory())
+	handler := &Handler{attestationService: attestSvc}
+	router := gin.New()
+	router.GET("/api/v1/attest/challenge", handler.GetAttestationChallenge)
+
+	codes := []int{http.StatusOK, http.StatusTooManyRequests}
+	for i, want := range codes {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/attest/challenge?device_id=device-1", nil))
+		if w.Code != want {
+			t.Errorf("request %d: got %d, want %d", i+1, w.Code, want)
+		}
+		if want == http.StatusTooManyRequests && !bytes.Contains(w.Body.Bytes(), []byte(`"too_many_challenges"`)) {
+			t.Errorf("request %d: body %s", i+1, w.Body.String())
+		}
+	}
+}
+
 func TestVerifyAttestation_AndroidBypass(t *testing.T) {
 	database := mustTestDBWithAttestStorage(t)
 	defer database.Close()
@@ -106,6 +223,45 @@ func TestVerifyAttestation_AndroidBypass(t *testing.T) {
 	if v, ok := resp["verified"].(bool); !ok || !v {
 		t.Errorf("verified: got %v, want true", resp["verified"])
 	}
+	// The session vouches for the device in its config requests
+	token, _ := resp["session_token"].(string)
+	if _, err := attestSvc.VerifySession(token, "test-device"); err != nil {
+		t.Errorf("session_token %q: %v", token, err)
+	}
+}
+
+func TestSessionAttestation(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	attestSvc := attestation.NewAttestationService(db.NewFromPool(sqlDB))
+	handler := &Handler{attestationService: attestSvc}
+	token, _, _ := attestSvc.IssueSession(&attestation.AttestationResult{
+		IsValid: true, Platform: "android", DeviceID: "device-1", DeviceIntegrity: "MEETS_DEVICE_INTEGRITY",
+	})
+
+	// A valid session is trusted without reading stored attestations
+	if previous := handler.sessionAttestation("device-1", token); previous == nil || previous.DeviceIntegrity != "MEETS_DEVICE_INTEGRITY" {
+		t.Errorf("valid session: got %+v", previous)
+	}
+
+	// Without a session, or with another device's or an expired one, the
+	// device is unattested; stored attestations are never consulted
+	if previous := handler.sessionAttestation("device-1", ""); previous != nil {
+		t.Errorf("no session: got %+v", previous)
+	}
+	if previous := handler.sessionAttestation("device-2", token); previous != nil {
+		t.Errorf("other device's session: got %+v", previous)
+	}
+	attestSvc.SetClock(clock.NewFake(time.Now().Add(time.Hour)))
+	if previous := handler.sessionAttestation("device-1", token); previous != nil {
+		t.Errorf("expired session: got %+v", previous)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
 }
 
 func TestVerifyAttestation_UnsupportedPlatform(t *testing.T) {
@@ -160,6 +316,430 @@ func TestGetConfig_InvalidRequest(t *testing.T) {
 	}
 }
 
+func TestGetConfig_MalformedLocale(t *testing.T) {
+	database := mustTestDB(t)
+	defer database.Close()
+
+	configSvc, err := config.NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := NewHandler(configSvc, attestation.NewAttestationService(database), geo.NewBalancer(database), database)
+
+	router := gin.New()
+	router.POST("/api/v1/config", handler.GetConfig)
+
+	for _, locale := range []string{"english", "en_US!", "en-"} {
+		body := []byte(`{"device_id":"device-1","platform":"android","locale":"` + locale + `"}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/config", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte("invalid_locale")) {
+			t.Errorf("locale %q: got %d %s, want 400 invalid_locale", locale, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestGetConfig_PackVersionNegotiation(t *testing.T) {
+	tests := []struct {
+		name        string
+		versions    string
+		wantStatus  int
+		wantVersion string
+	}{
+		{"legacy client", ``, http.StatusOK, "1.0"},
+		{"newer client", `,"supported_pack_versions":["1.0","7.0"]`, http.StatusOK, "1.0"},
+		{"unsupported only", `,"supported_pack_versions":["7.0"]`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+			if tt.wantStatus == http.StatusOK {
+				mock.ExpectQuery(`FROM launch_open_regions`).WillReturnRows(sqlmock.NewRows([]string{"region"}))
+				mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+				mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+			}
+
+			configSvc, err := config.NewConfigService(db.NewFromPool(sqlDB))
+			if err != nil {
+				t.Fatalf("NewConfigService: %v", err)
+			}
+			handler := &Handler{configService: configSvc}
+			router := gin.New()
+			router.POST("/api/v1/config", handler.GetConfig)
+
+			body := `{"device_id":"device-1","platform":"android","region":"us-east-1"` + tt.versions + `}`
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/config", bytes.NewReader([]byte(body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status: got %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if want := `{"error":"pack_version_unsupported","supported_pack_versions":["1.0","2.0"]}`; w.Body.String() != want {
+					t.Errorf("body: got %s, want %s", w.Body.String(), want)
+				}
+				return
+			}
+			var resp GetConfigResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.PackVersion != tt.wantVersion || resp.ConfigPack.Version != tt.wantVersion {
+				t.Errorf("pack version: got %q (pack %q), want %q", resp.PackVersion, resp.ConfigPack.Version, tt.wantVersion)
+			}
+			if resp.ConfigPack.ExpiresAt == 0 || !resp.ExpiresAt.Equal(time.Unix(resp.ConfigPack.ExpiresAt, 0)) {
+				t.Errorf("expires_at: got %v, pack expires at %d", resp.ExpiresAt, resp.ConfigPack.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestRegisterGateway_OverQuotaPending(t *testing.T) {
+	os.Setenv("LUMENLINK_MAX_GATEWAYS_PER_OPERATOR", "1")
+	defer os.Unsetenv("LUMENLINK_MAX_GATEWAYS_PER_OPERATOR")
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	database := db.NewFromPool(sqlDB)
+
+	expectOperatorCredential(mock, "op-1")
+	mock.ExpectQuery(`SELECT COUNT`).WithArgs("op-1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT COUNT`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-2"))
+	mock.ExpectExec(`INSERT INTO review_queue`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	configSvc, err := config.NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := NewHandler(configSvc, attestation.NewAttestationService(database), geo.NewBalancer(database), database)
+
+	router := gin.New()
+	router.POST("/api/v1/gateway/register", handler.RegisterGateway)
+
+	_, privateKey, _ := ed25519.GenerateKey(nil)
+	req := registrationRequest(t, privateKey, "op-1", "192.0.2.10")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status: got %d, want 202 (%s)", w.Code, w.Body.String())
+	}
+	var resp GatewayRegistrationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if resp.GatewayID != "gw-2" || resp.ApprovalStatus != "pending" {
+		t.Errorf("response: got %+v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegisterGateway_RequiresOperatorAndKey(t *testing.T) {
+	_, privateKey, _ := ed25519.GenerateKey(nil)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	tests := []struct {
+		name       string
+		credential bool // Whether the operator credential is valid
+		request    func() *http.Request
+		wantStatus int
+		wantBody   string
+	}{
+		{"no credential", false, func() *http.Request {
+			req := registrationRequest(t, privateKey, "op-1", "192.0.2.10")
+			req.Header.Del("X-Operator-Token")
+			return req
+		}, http.StatusUnauthorized, `"error":"invalid_operator_credential"`},
+		{"revoked credential", false, func() *http.Request {
+			return registrationRequest(t, privateKey, "op-1", "192.0.2.10")
+		}, http.StatusUnauthorized, `"error":"invalid_operator_credential"`},
+		{"another operator", true, func() *http.Request {
+			return registrationRequest(t, privateKey, "op-2", "192.0.2.10")
+		}, http.StatusForbidden, `"error":"operator_mismatch"`},
+		{"key proof by another key", true, func() *http.Request {
+			req := registrationRequest(t, privateKey, "op-1", "192.0.2.10")
+			forged := registrationRequest(t, otherKey, "op-1", "192.0.2.10")
+			var body, forgedBody map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&body)
+			json.NewDecoder(forged.Body).Decode(&forgedBody)
+			body["key_proof"] = forgedBody["key_proof"]
+			encoded, _ := json.Marshal(body)
+			req.Body = io.NopCloser(bytes.NewReader(encoded))
+			return req
+		}, http.StatusUnauthorized, `"error":"invalid_key_proof"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+			handler := &Handler{registry: gateway.NewRegistry(db.NewFromPool(sqlDB))}
+			router := gin.New()
+			router.POST("/api/v1/gateway/register", handler.RegisterGateway)
+
+			req := tt.request()
+			if req.Header.Get("X-Operator-Token") != "" {
+				if tt.credential {
+					expectOperatorCredential(mock, "op-1")
+				} else {
+					mock.ExpectQuery(`FROM operator_credentials`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				}
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			// Nothing is registered
+			if w.Code != tt.wantStatus || !bytes.Contains(w.Body.Bytes(), []byte(tt.wantBody)) {
+				t.Errorf("got %d %s, want %d %s", w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// expectOperatorCredential answers the lookup of a request's operator
+// credential with operatorID
+func expectOperatorCredential(mock sqlmock.Sqlmock, operatorID string) {
+	mock.ExpectQuery(`FROM operator_credentials`).
+		WithArgs(gateway.HashEnrollmentToken("operator-token")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "operator_id", "created_by", "created_at"}).
+			AddRow("cred-1", operatorID, "admin", time.Now()))
+}
+
+// registrationRequest registers privateKey's gateway at ip for operatorID,
+// with the operator credential expectOperatorCredential accepts
+func registrationRequest(t *testing.T, privateKey ed25519.PrivateKey, operatorID, ip string) *http.Request {
+	t.Helper()
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	timestamp := time.Now().Unix()
+	body, err := json.Marshal(map[string]interface{}{
+		"operator_id":     operatorID,
+		"public_key":      []byte(publicKey),
+		"ip_address":      ip,
+		"port":            443,
+		"transport_types": []string{"masque"},
+		"region":          "us-east-1",
+		"key_proof": map[string]interface{}{
+			"timestamp": timestamp,
+			"signature": ed25519.Sign(privateKey, gateway.RegistrationMessage(operatorID, publicKey, timestamp)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/gateway/register", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Operator-Token", "operator-token")
+	return req
+}
+
+func TestRegisterGateway_RepeatAndChangedIP(t *testing.T) {
+	os.Setenv("LUMENLINK_MAX_GATEWAYS_PER_OPERATOR", "0")
+	os.Setenv("LUMENLINK_MAX_GATEWAYS_PER_SUBNET", "0")
+	defer os.Unsetenv("LUMENLINK_MAX_GATEWAYS_PER_OPERATOR")
+	defer os.Unsetenv("LUMENLINK_MAX_GATEWAYS_PER_SUBNET")
+
+	tests := []struct {
+		name       string
+		ip         string
+		wantStatus int
+		wantBody   string
+	}{
+		{"same attributes", "192.0.2.10", http.StatusOK, `"outcome":"already_exists"`},
+		{"different ip", "198.51.100.10", http.StatusConflict, `"error":"confirmation_required"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+			database := db.NewFromPool(sqlDB)
+
+			now := time.Now()
+			_, privateKey, _ := ed25519.GenerateKey(nil)
+			expectOperatorCredential(mock, "op-1")
+			mock.ExpectBegin()
+			mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectQuery(`SELECT id FROM gateways WHERE public_key`).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-1"))
+			mock.ExpectRollback()
+			mock.ExpectQuery(`WHERE id = \$1`).WillReturnRows(sqlmock.NewRows([]string{
+				"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+				"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+				"operator_id", "approval_status", "asn",
+				"created_at", "last_seen", "updated_at",
+			}).AddRow(
+				"gw-1", []byte(privateKey.Public().(ed25519.PublicKey)), "192.0.2.10", 443, "{masque}", "{}",
+				"us-east-1", nil, 0, nil, "active", false,
+				"op-1", "approved", nil,
+				now, nil, now,
+			))
+
+			configSvc, err := config.NewConfigService(database)
+			if err != nil {
+				t.Fatalf("NewConfigService: %v", err)
+			}
+			handler := NewHandler(configSvc, attestation.NewAttestationService(database), geo.NewBalancer(database), database)
+
+			router := gin.New()
+			router.POST("/api/v1/gateway/register", handler.RegisterGateway)
+
+			req := registrationRequest(t, privateKey, "op-1", tt.ip)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status: got %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if !bytes.Contains(w.Body.Bytes(), []byte(tt.wantBody)) {
+				t.Errorf("body: got %s, want %s", w.Body.String(), tt.wantBody)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRegisterGateway_InvalidTransport(t *testing.T) {
+	database := mustTestDB(t)
+	defer database.Close()
+
+	configSvc, err := config.NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := NewHandler(configSvc, attestation.NewAttestationService(database), geo.NewBalancer(database), database)
+
+	router := gin.New()
+	router.POST("/api/v1/gateway/register", handler.RegisterGateway)
+
+	body := []byte(`{"operator_id":"op-1","public_key":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",` +
+		`"ip_address":"192.0.2.10","port":443,"transport_types":["telnet"],"region":"us-east-1"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/gateway/register", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status: got %d, want 400", w.Code)
+	}
+}
+
+func TestGetConfig_RecordsEachPhaseOnce(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`INSERT INTO attestations`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`FROM launch_open_regions`).WillReturnRows(sqlmock.NewRows([]string{"region"}))
+	mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+
+	database := db.NewFromPool(sqlDB)
+	configSvc, err := config.NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := &Handler{configService: configSvc, attestationService: attestation.NewAttestationService(database)}
+	router := gin.New()
+	router.POST("/api/v1/config", handler.GetConfig)
+
+	phases := []string{
+		metrics.PhaseAttestation, metrics.PhaseRegionResolution, metrics.PhaseGatewaySelection,
+		metrics.PhasePolicyApplication, metrics.PhaseSigning, metrics.PhaseSerialization, metrics.PhasePackCore,
+	}
+	before := map[string]uint64{}
+	for _, phase := range phases {
+		before[phase] = phaseSamples(t, phase)
+	}
+
+	w := postJSON(t, router, "/api/v1/config", map[string]string{
+		"device_id": "device-1", "platform": "android", "region": "us-east-1", "attestation": "{}",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+		t.Errorf("content type: got %q", got)
+	}
+	for _, phase := range phases {
+		if got := phaseSamples(t, phase) - before[phase]; got != 1 {
+			t.Errorf("%s: got %d observations, want 1", phase, got)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyAttestation_StoresClientOrigin(t *testing.T) {
+	t.Setenv("LUMENLINK_ATTESTATION_ANONYMIZE_IP", "true")
+	t.Setenv("LUMENLINK_ATTESTATION_IP_HASH_SECRET", "secret")
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("192.0.2.1"))
+	mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`INSERT INTO attestations`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), hex.EncodeToString(mac.Sum(nil)[:16]), "ap-east-1", false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	database := db.NewFromPool(sqlDB)
+	handler := &Handler{database: database, attestationService: attestation.NewAttestationService(database)}
+	router := gin.New()
+	router.POST("/api/v1/attest", handler.VerifyAttestation)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/attest",
+		bytes.NewReader([]byte(`{"platform":"android","token":"{}","device_id":"device-1"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("CF-IPCountry", "CN")
+	req.RemoteAddr = "192.0.2.1:41000"
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// phaseSamples returns how many durations have been observed for phase
+func phaseSamples(t *testing.T, phase string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := metrics.ConfigPhaseDuration.WithLabelValues(phase).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatalf("read histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
 func mustTestDB(t *testing.T) *db.Database {
 	t.Helper()
 	sqlDB, mock, err := sqlmock.New()
@@ -168,15 +748,19 @@ func mustTestDB(t *testing.T) *db.Database {
 	}
 	t.Cleanup(func() { sqlDB.Close() })
 
-	// Mock GetGatewaysByRegion and GetHoneypotGateways for config service
+	// Mock GetOpenRegions, IsDeviceRevoked, GetGatewaysByRegion and GetHoneypotGateways for config service
+	mock.ExpectQuery(`FROM launch_open_regions`).WillReturnRows(sqlmock.NewRows([]string{"region"}))
+	mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 	mock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{
 		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
 		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
 		"created_at", "last_seen", "updated_at",
 	}))
 	mock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{
 		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
 		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
 		"created_at", "last_seen", "updated_at",
 	}))
 
@@ -191,6 +775,583 @@ func mustTestDBWithAttestStorage(t *testing.T) *db.Database {
 	}
 	t.Cleanup(func() { sqlDB.Close() })
 
+	mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 	mock.ExpectExec(`INSERT INTO attestations`).WillReturnResult(sqlmock.NewResult(1, 1))
 	return db.NewFromPool(sqlDB)
 }
+
+const statusGatewayID = "6f1c2d3e-4a5b-4c6d-8e9f-0a1b2c3d4e5f"
+
+// statusGatewayKey is the key statusGatewayID signs its heartbeats with
+var _, statusGatewayKey, _ = ed25519.GenerateKey(nil)
+
+func postGatewayStatus(t *testing.T, database *db.Database, body map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	handler := &Handler{database: database}
+	if database != nil {
+		handler.registry = gateway.NewRegistry(database)
+	}
+	return serveGatewayStatus(t, handler, body)
+}
+
+// serveGatewayStatus posts body to handler as a heartbeat signed with
+// statusGatewayKey
+func serveGatewayStatus(t *testing.T, handler *Handler, body map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	router := gin.New()
+	router.POST("/api/v1/gateway/status", handler.HandleGatewayStatus)
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	const path = "/api/v1/gateway/status"
+	timestamp := time.Now().Unix()
+	signature := ed25519.Sign(statusGatewayKey, gateway.RequestBodyMessage(statusGatewayID, path, timestamp, payload))
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gateway-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Gateway-Signature", base64.StdEncoding.EncodeToString(signature))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// expectStatusGateway answers the lookup that authenticates a heartbeat
+// from statusGatewayID
+func expectStatusGateway(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`WHERE id = \$1`).WithArgs(statusGatewayID).
+		WillReturnRows(operatorGatewayRows(statusGatewayKey.Public().(ed25519.PublicKey), "op-1", nil))
+}
+
+func statusBody(reportedAt time.Time, sequence int64) map[string]interface{} {
+	return map[string]interface{}{
+		"gateway_id":      statusGatewayID,
+		"status":          "active",
+		"users_connected": 3,
+		"uptime_percent":  99.5,
+		"reported_at":     reportedAt.Format(time.RFC3339Nano),
+		"sequence":        sequence,
+	}
+}
+
+func TestHandleGatewayStatus_RecordsReportedAtAndSequence(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	reportedAt := time.Now().Add(-30 * time.Second).UTC()
+	expectStatusGateway(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE gateways SET status`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM operator_metrics_sequences`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO operator_metrics_sequences`).
+		WithArgs(statusGatewayID, int64(41)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO operator_metrics`).
+		WithArgs(sqlmock.AnyArg(), statusGatewayID, 3, 0, int64(0), 99.5, reportedAt, int64(41)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	w := postGatewayStatus(t, db.NewFromPool(sqlDB), statusBody(reportedAt, 41))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandleGatewayStatus_DuplicateSequence(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	expectStatusGateway(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE gateways SET status`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM operator_metrics_sequences`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO operator_metrics_sequences`).
+		WillReturnError(&pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"})
+	mock.ExpectRollback()
+
+	w := postGatewayStatus(t, db.NewFromPool(sqlDB), statusBody(time.Now(), 41))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status: got %d, want 409: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp["error"] != "duplicate_sequence" || resp["sequence"] != float64(41) {
+		t.Errorf("body: got %v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandleGatewayStatus_ClockSkew(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	database := db.NewFromPool(sqlDB)
+
+	for _, offset := range []time.Duration{-statusMaxSkew - time.Minute, statusMaxSkew + time.Minute} {
+		w := postGatewayStatus(t, database, statusBody(time.Now().Add(offset), 7))
+		if w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte("clock_skew")) {
+			t.Errorf("offset %v: got %d %s, want 400 clock_skew", offset, w.Code, w.Body.String())
+		}
+	}
+
+	// Rejected before touching the database
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandleGatewayStatus_SequenceValidation(t *testing.T) {
+	body := statusBody(time.Now(), 1)
+	delete(body, "reported_at")
+	if w := postGatewayStatus(t, nil, body); w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte("reported_at_required")) {
+		t.Errorf("sequence without reported_at: got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := postGatewayStatus(t, nil, statusBody(time.Now(), -1)); w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte("invalid_sequence")) {
+		t.Errorf("negative sequence: got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleGatewayStatus_RejectsUnsigned(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.POST("/api/v1/gateway/status", handler.HandleGatewayStatus)
+
+	payload, _ := json.Marshal(statusBody(time.Now(), 1))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/gateway/status", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized || !bytes.Contains(w.Body.Bytes(), []byte("invalid_signature")) {
+		t.Errorf("got %d %s, want 401 invalid_signature", w.Code, w.Body.String())
+	}
+	// Nothing is recorded
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandleGatewayStatus_DrainDirective(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	expectStatusGateway(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE gateways SET status`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM operator_metrics_sequences`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO operator_metrics_sequences`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO operator_metrics`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	drain := lifecycle.NewDrain(lifecycle.DrainConfig{ReconnectMin: 2 * time.Second, ReconnectMax: 4 * time.Second})
+	database := db.NewFromPool(sqlDB)
+	handler := &Handler{database: database, registry: gateway.NewRegistry(database)}
+	handler.SetDrain(drain)
+	drain.Begin()
+
+	w := serveGatewayStatus(t, handler, statusBody(time.Now(), 1))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var resp GatewayStatusResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !resp.Acknowledged || resp.Directive == nil || resp.Directive.Type != DirectiveDrain {
+		t.Fatalf("response: got %+v, want acknowledged with a drain directive", resp)
+	}
+	if ms := resp.Directive.ReconnectAfterMs; ms < 2000 || ms > 4000 {
+		t.Errorf("reconnect_after_ms: got %d, want within [2000, 4000]", ms)
+	}
+}
+
+func TestRecordIssuance_CountsOwnGateways(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	counter := gateway.NewIssuanceCounter(db.NewFromPool(sqlDB))
+	handler := &Handler{issuance: counter}
+	handler.recordIssuance(&config.SignedConfigPack{Gateways: []config.GatewayInfo{
+		{ID: "gw-own"},
+		{ID: "gw-honeypot", IsHoneypot: true},
+		{ID: "gw-federated", Origin: "partner"},
+	}})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO gateway_issuance_counts`).WithArgs("gw-own", sqlmock.AnyArg(), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := counter.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetConfig_CurrentPackHash(t *testing.T) {
+	t.Setenv("LUMENLINK_PACK_GATEWAY_CACHE_TTL", "0")
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	now := time.Now()
+	for _, id := range []string{"gw-1", "gw-1", "gw-2"} {
+		mock.ExpectQuery(`FROM launch_open_regions`).WillReturnRows(sqlmock.NewRows([]string{"region"}))
+		mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns).AddRow(
+			id, make([]byte, 32), "203.0.113.1", 443, "{masque}", "{gps}",
+			"us-east-1", 100, 10, 100, "active", false, nil, "approved", nil, now, now, now))
+		mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+	}
+
+	configSvc, err := config.NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := &Handler{configService: configSvc}
+	router := gin.New()
+	router.POST("/api/v1/config", handler.GetConfig)
+	fetch := func(currentPackHash string) GetConfigResponse {
+		t.Helper()
+		body := `{"device_id":"device-1","platform":"android","region":"us-east-1","current_pack_hash":"` + currentPackHash + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/config", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status: got %d (%s)", w.Code, w.Body.String())
+		}
+		var resp GetConfigResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	// A client without a pack gets the full pack and its hash
+	first := fetch("")
+	if first.ConfigPack == nil || first.PackHash == "" || first.NotModified != nil || first.ChangedSince != nil {
+		t.Fatalf("first response: %+v", first)
+	}
+
+	// Nothing changed: a signed not-modified instead of the pack
+	unchanged := fetch(first.PackHash)
+	if unchanged.ConfigPack != nil || unchanged.ExpiresAt == nil || unchanged.NotModified == nil {
+		t.Fatalf("unchanged response: %+v", unchanged)
+	}
+	// It extends the client's pack as far as a new pack would have lasted
+	if n := unchanged.NotModified; n.ClientID != "device-1" || n.PackHash != first.PackHash ||
+		n.ExpiresAt < first.ConfigPack.ExpiresAt || n.ExpiresAt != unchanged.ExpiresAt.Unix() ||
+		!config.VerifyNotModified(n, first.ConfigPack.PublicKey) {
+		t.Errorf("not modified: %+v", n)
+	}
+	forged := *unchanged.NotModified
+	forged.ExpiresAt += 86400
+	if config.VerifyNotModified(&forged, first.ConfigPack.PublicKey) {
+		t.Error("not modified verified with an altered expiry")
+	}
+
+	// The gateway changed: the full pack and what changed since
+	changed := fetch(first.PackHash)
+	if changed.ConfigPack == nil || changed.NotModified != nil || changed.PackHash == first.PackHash {
+		t.Fatalf("changed response: %+v", changed)
+	}
+	if c := changed.ChangedSince; c == nil || fmt.Sprint(c.AddedGateways) != "[gw-2]" || fmt.Sprint(c.RemovedGateways) != "[gw-1]" {
+		t.Errorf("changed since: %+v", c)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetConfig_JWSFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     string
+		accept     string
+		wantStatus int
+		wantJWS    bool
+	}{
+		{"default", ``, "", http.StatusOK, false},
+		{"format field", `,"format":"jws"`, "", http.StatusOK, true},
+		{"accept header", ``, "application/json;q=0.5, application/jose", http.StatusOK, true},
+		{"format overrides accept", `,"format":"json"`, "application/jose", http.StatusOK, false},
+		{"unknown format", `,"format":"msgpack"`, "", http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+			if tt.wantStatus == http.StatusOK {
+				mock.ExpectQuery(`FROM launch_open_regions`).WillReturnRows(sqlmock.NewRows([]string{"region"}))
+				mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+				mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+			}
+
+			configSvc, err := config.NewConfigService(db.NewFromPool(sqlDB))
+			if err != nil {
+				t.Fatalf("NewConfigService: %v", err)
+			}
+			handler := &Handler{configService: configSvc}
+			router := gin.New()
+			router.POST("/api/v1/config", handler.GetConfig)
+
+			body := `{"device_id":"device-1","platform":"android","region":"us-east-1"` + tt.format + `}`
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/config", bytes.NewReader([]byte(body)))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status: got %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp GetConfigResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !tt.wantJWS {
+				if resp.ConfigPack == nil || resp.ConfigPackJWS != "" {
+					t.Errorf("got config_pack %v, config_pack_jws %q", resp.ConfigPack, resp.ConfigPackJWS)
+				}
+				return
+			}
+			if resp.ConfigPack != nil {
+				t.Error("config_pack set alongside config_pack_jws")
+			}
+			pack, ok := configSvc.VerifyConfigPackJWS(resp.ConfigPackJWS)
+			if !ok {
+				t.Fatalf("config_pack_jws does not verify: %q", resp.ConfigPackJWS)
+			}
+			if pack.Metadata["client_id"] != "device-1" || !resp.ExpiresAt.Equal(time.Unix(pack.ExpiresAt, 0)) {
+				t.Errorf("pack: %+v, expires_at %v", pack, resp.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestGetConfig_SignerUnavailable(t *testing.T) {
+	var attempts int
+	signer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer signer.Close()
+	publicKey, _, _ := ed25519.GenerateKey(nil)
+	t.Setenv("LUMENLINK_CONFIG_SIGNER", config.SignerRemote)
+	t.Setenv("LUMENLINK_CONFIG_SIGNING_PUBLIC_KEY", base64.StdEncoding.EncodeToString(publicKey))
+	t.Setenv("LUMENLINK_REMOTE_SIGNER_URL", signer.URL)
+	t.Setenv("LUMENLINK_REMOTE_SIGNER_MAX_ATTEMPTS", "2")
+	t.Setenv("LUMENLINK_REMOTE_SIGNER_RETRY_BACKOFF", "0")
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	mock.ExpectQuery(`FROM launch_open_regions`).WillReturnRows(sqlmock.NewRows([]string{"region"}))
+	mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+
+	configSvc, err := config.NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := &Handler{configService: configSvc}
+	router := gin.New()
+	router.POST("/api/v1/config", handler.GetConfig)
+
+	body := `{"device_id":"device-1","platform":"android","region":"us-east-1"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/config", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status: got %d, want 503 (%s)", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp["error"] != "signer_unavailable" {
+		t.Errorf("body: %s", w.Body.String())
+	}
+	if _, ok := resp["config_pack"]; ok {
+		t.Error("a pack was served without a signature")
+	}
+	if attempts != 2 {
+		t.Errorf("signer attempts: got %d, want 2", attempts)
+	}
+}
+
+func TestGetConfig_SigAlg(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	mock.ExpectQuery(`FROM launch_open_regions`).WillReturnRows(sqlmock.NewRows([]string{"region"}))
+	mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+
+	configSvc, err := config.NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := &Handler{configService: configSvc}
+	router := gin.New()
+	router.POST("/api/v1/config", handler.GetConfig)
+
+	for _, tt := range []struct{ sigAlg, want string }{
+		{"rsa", "invalid_sig_alg"},                      // Refused before any work
+		{config.SigAlgECDSAP256, "sig_alg_unavailable"}, // No P-256 key is configured
+	} {
+		body := `{"device_id":"device-1","platform":"android","region":"us-east-1","sig_alg":"` + tt.sigAlg + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/config", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte(tt.want)) {
+			t.Errorf("sig_alg %s: got %d %s, want 400 %s", tt.sigAlg, w.Code, w.Body.String(), tt.want)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetConfig_ForceUpgrade(t *testing.T) {
+	t.Setenv("LUMENLINK_CLIENT_VERSIONS", `{"android": {"min_version": "1.4.0"}}`)
+	configSvc, err := config.NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := &Handler{configService: configSvc}
+	router := gin.New()
+	router.POST("/api/v1/config", handler.GetConfig)
+
+	body := `{"device_id":"device-1","platform":"android","region":"us-east-1","version":"1.3.0"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/config", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	var resp GetConfigResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	pack := resp.ConfigPack
+	if len(pack.Gateways) != 0 || len(pack.Transports) != 1 || pack.Transports[0].Type != config.UpgradeTransport {
+		t.Errorf("pack: got gateways %+v and transports %+v, want only the upgrade transport", pack.Gateways, pack.Transports)
+	}
+	if pack.Metadata["force_upgrade"] != true || pack.Metadata["min_version"] != "1.4.0" {
+		t.Errorf("metadata: got %v", pack.Metadata)
+	}
+}
+
+func TestGetConfig_RegionFallback(t *testing.T) {
+	t.Setenv("LUMENLINK_PACK_MIN_REGION_GATEWAYS", "1")
+	t.Setenv("LUMENLINK_GATEWAY_FULL_DETAIL_MIN_INTEGRITY", "none")
+	t.Setenv("LUMENLINK_GATEWAY_REDUCED_DETAIL_MIN_INTEGRITY", "none")
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	now := time.Now()
+
+	// us-east-1 has no gateways, so its nearest neighbor's are served
+	mock.ExpectQuery(`FROM launch_open_regions`).WillReturnRows(sqlmock.NewRows([]string{"region"}))
+	mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("us-east-1", false, config.DefaultGatewayCandidateLimit).
+		WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("us-west-1", false, config.DefaultGatewayCandidateLimit).
+		WillReturnRows(sqlmock.NewRows(launchGatewayColumns).
+			AddRow("gw-west-1", make([]byte, ed25519.PublicKeySize), "203.0.113.1", 443, "{masque}", "{gps}",
+				"us-west-1", 100, 10, 100, "active", false, nil, "approved", nil, now, now, now).
+			AddRow("gw-west-2", make([]byte, ed25519.PublicKeySize), "198.51.100.1", 443, "{masque}", "{gps}",
+				"us-west-1", 100, 20, 100, "active", false, nil, "approved", nil, now, now, now))
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("us-east-1").WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+
+	configSvc, err := config.NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := &Handler{configService: configSvc}
+	router := gin.New()
+	router.POST("/api/v1/config", handler.GetConfig)
+
+	fallbacks := testutil.ToFloat64(metrics.RegionFallback.WithLabelValues("us-east-1"))
+	body := `{"device_id":"device-1","platform":"android","region":"us-east-1"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/config", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	var resp GetConfigResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	pack := resp.ConfigPack
+	if len(pack.Gateways) != 2 {
+		t.Fatalf("gateways: got %+v, want the neighbor's two", pack.Gateways)
+	}
+	for _, gw := range pack.Gateways {
+		if gw.Region != "us-west-1" {
+			t.Errorf("%s: region got %q, want us-west-1", gw.ID, gw.Region)
+		}
+	}
+	if pack.Metadata["region"] != "us-east-1" {
+		t.Errorf("pack region: got %v, want us-east-1", pack.Metadata["region"])
+	}
+	if got := testutil.ToFloat64(metrics.RegionFallback.WithLabelValues("us-east-1")) - fallbacks; got != 1 {
+		t.Errorf("region fallback delta: got %v, want 1", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
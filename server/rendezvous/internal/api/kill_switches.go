@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/cache"
+	"rendezvous/internal/db"
+	"rendezvous/internal/sanitize"
+)
+
+// maxKillSwitchReasonLen bounds a kill switch's stored reason, which every
+// pack carries
+const maxKillSwitchReasonLen = 256
+
+// KillSwitchRequest disables a transport server-wide
+type KillSwitchRequest struct {
+	Reason string `json:"reason" binding:"required"` // Shown to clients; sanitized and cut to maxKillSwitchReasonLen bytes
+}
+
+// KillSwitchesResponse lists the disabled transports by type, each with the
+// reason it was disabled
+type KillSwitchesResponse struct {
+	KillSwitches map[string]string `json:"kill_switches"`
+}
+
+// ListKillSwitches returns the disabled transports
+func (h *Handler) ListKillSwitches(c *gin.Context) {
+	killSwitches, err := h.database.GetKillSwitches(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "kill_switch_fetch_failed")
+		return
+	}
+	c.JSON(http.StatusOK, KillSwitchesResponse{KillSwitches: killSwitches})
+}
+
+// PutKillSwitch disables a transport in every pack generated from now on,
+// replacing the reason if it is already disabled
+func (h *Handler) PutKillSwitch(c *gin.Context) {
+	transport := c.Param("transport")
+	if _, ok := allowedTransportTypes[transport]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_transport_type"})
+		return
+	}
+	var req KillSwitchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reason := sanitize.Text(req.Reason, maxKillSwitchReasonLen)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_reason"})
+		return
+	}
+
+	var killSwitches map[string]string
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		var err error
+		if killSwitches, err = h.database.SetKillSwitch(ctx, transport, reason); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditKillSwitchPut, SubjectType: "transport", SubjectID: transport,
+			Details: map[string]interface{}{"reason": reason}}, nil
+	})
+	if err != nil {
+		respondError(c, err, "kill_switch_update_failed")
+		return
+	}
+	h.invalidateKillSwitches(c)
+
+	c.JSON(http.StatusOK, KillSwitchesResponse{KillSwitches: killSwitches})
+}
+
+// DeleteKillSwitch enables a disabled transport again from the next pack
+func (h *Handler) DeleteKillSwitch(c *gin.Context) {
+	transport := c.Param("transport")
+	if _, ok := allowedTransportTypes[transport]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_transport_type"})
+		return
+	}
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		if err := h.database.ClearKillSwitch(ctx, transport); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditKillSwitchDelete, SubjectType: "transport", SubjectID: transport}, nil
+	})
+	if err != nil {
+		respondError(c, err, "kill_switch_delete_failed")
+		return
+	}
+	h.invalidateKillSwitches(c)
+
+	c.Status(http.StatusNoContent)
+}
+
+// invalidateKillSwitches propagates a kill switch change to every replica.
+// The write has already committed, so a failed publish is only logged and
+// the change reaches other replicas within the policy cache TTL.
+func (h *Handler) invalidateKillSwitches(c *gin.Context) {
+	if err := h.database.InvalidatePolicy(c.Request.Context(), cache.TableSettings); err != nil {
+		log.Printf("kill switch cache invalidation failed: %v", err)
+	}
+}
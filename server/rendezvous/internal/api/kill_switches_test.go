@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+)
+
+func killSwitchRouter(database *db.Database) *gin.Engine {
+	handler := &Handler{database: database}
+	router := gin.New()
+	router.GET("/api/v1/admin/kill-switches", handler.ListKillSwitches)
+	router.PUT("/api/v1/admin/kill-switches/:transport", handler.PutKillSwitch)
+	router.DELETE("/api/v1/admin/kill-switches/:transport", handler.DeleteKillSwitch)
+	return router
+}
+
+func TestPutKillSwitch(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO settings`).
+		WithArgs(db.SettingKillSwitches, []byte(`{"ssh":"exploited in the wild"}`)).
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow([]byte(`{"ssh": "exploited in the wild", "xtls": "blocked"}`)))
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+	router := killSwitchRouter(db.NewFromPool(sqlDB))
+
+	put := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, tt := range []struct{ path, body, want string }{
+		{"/api/v1/admin/kill-switches/wireguard", `{"reason":"exploited"}`, "invalid_transport_type"},
+		{"/api/v1/admin/kill-switches/ssh", `{}`, "Reason"},
+		{"/api/v1/admin/kill-switches/ssh", `{"reason":" \u202e "}`, "invalid_reason"},
+	} {
+		if w := put(tt.path, tt.body); w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte(tt.want)) {
+			t.Errorf("PUT %s %s: got %d %s, want 400 %s", tt.path, tt.body, w.Code, w.Body.String(), tt.want)
+		}
+	}
+
+	w := put("/api/v1/admin/kill-switches/ssh", `{"reason":"exploited in the wild"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	if want := `{"kill_switches":{"ssh":"exploited in the wild","xtls":"blocked"}}`; w.Body.String() != want {
+		t.Errorf("body: got %s, want %s", w.Body.String(), want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeleteKillSwitch_NotFound(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE settings SET value = value - \$2`).WithArgs(db.SettingKillSwitches, "ssh").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	router := killSwitchRouter(db.NewFromPool(sqlDB))
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/kill-switches/ssh", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound || !bytes.Contains(w.Body.Bytes(), []byte("kill_switch_not_found")) {
+		t.Errorf("got %d %s, want 404 kill_switch_not_found", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
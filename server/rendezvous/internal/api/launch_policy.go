@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/cache"
+	"rendezvous/internal/db"
+)
+
+// LaunchPolicyRequest replaces the set of open regions
+type LaunchPolicyRequest struct {
+	OpenRegions []string `json:"open_regions" binding:"required"` // Empty opens every region
+}
+
+// LaunchPolicyResponse is the launch policy in admin responses
+type LaunchPolicyResponse struct {
+	OpenRegions []string `json:"open_regions"`
+	Restricted  bool     `json:"restricted"` // False while every region is open
+}
+
+// GetLaunchPolicy returns the regions open during the soft launch
+func (h *Handler) GetLaunchPolicy(c *gin.Context) {
+	regions, err := h.database.GetOpenRegions(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "launch_policy_fetch_failed")
+		return
+	}
+	c.JSON(http.StatusOK, LaunchPolicyResponse{OpenRegions: regions, Restricted: len(regions) > 0})
+}
+
+// PutLaunchPolicy replaces the regions open during the soft launch. Clients
+// from any other region get honeypot-only packs from their next request.
+func (h *Handler) PutLaunchPolicy(c *gin.Context) {
+	var req LaunchPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	seen := map[string]bool{}
+	regions := []string{}
+	for _, region := range req.OpenRegions {
+		if !previewRegionPattern.MatchString(region) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_region"})
+			return
+		}
+		if !seen[region] {
+			seen[region] = true
+			regions = append(regions, region)
+		}
+	}
+	sort.Strings(regions)
+
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		if err := h.database.SetOpenRegions(ctx, regions); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditLaunchPolicyPut, SubjectType: "launch_policy", SubjectID: "open_regions",
+			Details: map[string]interface{}{"open_regions": regions}}, nil
+	})
+	if err != nil {
+		respondError(c, err, "launch_policy_update_failed")
+		return
+	}
+	if err := h.database.InvalidatePolicy(c.Request.Context(), cache.TableLaunchRegions); err != nil {
+		log.Printf("launch policy cache invalidation failed: %v", err)
+	}
+
+	c.JSON(http.StatusOK, LaunchPolicyResponse{OpenRegions: regions, Restricted: len(regions) > 0})
+}
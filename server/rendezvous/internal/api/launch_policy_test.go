@@ -0,0 +1,251 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+	"rendezvous/internal/geo"
+	"rendezvous/internal/metrics"
+)
+
+var launchGatewayColumns = []string{
+	"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+	"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+	"operator_id", "approval_status", "asn",
+	"created_at", "last_seen", "updated_at",
+}
+
+func TestGetConfig_RegionDemand(t *testing.T) {
+	pubKey := make([]byte, ed25519.PublicKeySize)
+	rand.Read(pubKey)
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		country    string
+		expect     func(sqlmock.Sqlmock)
+		wantRegion string
+		wantStatus string
+	}{
+		{
+			"open region",
+			"US",
+			func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT id, public_key`).WithArgs("us-east-1", false, config.DefaultGatewayCandidateLimit).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+				mock.ExpectQuery(`SELECT id, public_key`).WithArgs("us-east-1").WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+			},
+			"us-east-1",
+			"open",
+		},
+		{
+			"closed region",
+			"CN",
+			func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT id, public_key`).WithArgs("").WillReturnRows(sqlmock.NewRows(launchGatewayColumns).
+					AddRow("hp-1", pubKey, "203.0.113.10", 443, "{masque}", "{gps}",
+						"us-east-1", 100, 0, 100, "active", true, nil, "approved", nil, now, now, now))
+			},
+			"ap-east-1",
+			"closed",
+		},
+		{
+			"continent default region",
+			"KE",
+			func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT id, public_key`).WithArgs("").WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+			},
+			"af-south-1",
+			"closed",
+		},
+		{
+			"unmapped country",
+			"ZZ",
+			func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT id, public_key`).WithArgs("").WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+			},
+			"unknown",
+			"closed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+			mock.ExpectQuery(`FROM launch_open_regions`).
+				WillReturnRows(sqlmock.NewRows([]string{"region"}).AddRow("me-south-1").AddRow("us-east-1"))
+			mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			tt.expect(mock)
+
+			configSvc, err := config.NewConfigService(db.NewFromPool(sqlDB))
+			if err != nil {
+				t.Fatalf("NewConfigService: %v", err)
+			}
+			handler := &Handler{configService: configSvc}
+			router := gin.New()
+			router.POST("/api/v1/config", handler.GetConfig)
+
+			demand := metrics.RegionDemand.WithLabelValues(tt.wantRegion, tt.country, tt.wantStatus)
+			before := testutil.ToFloat64(demand)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/config",
+				bytes.NewReader([]byte(`{"device_id":"device-1","platform":"android"}`)))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("CF-IPCountry", tt.country)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+			}
+			if got := testutil.ToFloat64(demand) - before; got != 1 {
+				t.Errorf("region demand %s/%s/%s delta: got %v, want 1", tt.wantRegion, tt.country, tt.wantStatus, got)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestGetConfig_NearestRegion(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	database := db.NewFromPool(sqlDB)
+	configSvc, err := config.NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := &Handler{configService: configSvc, geoBalancer: geo.NewBalancer(database)}
+	router := gin.New()
+	router.POST("/api/v1/config", handler.GetConfig)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/config", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("CF-IPCountry", "GB")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, body := range []string{
+		`{"device_id":"device-1","platform":"android","latitude":26.2}`,
+		`{"device_id":"device-1","platform":"android","latitude":26.2,"longitude":190}`,
+		`{"device_id":"device-1","platform":"android","latitude":-91,"longitude":50.5}`,
+	} {
+		if w := post(body); w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte("invalid_location")) {
+			t.Errorf("%s: got %d %s, want invalid_location", body, w.Code, w.Body.String())
+		}
+	}
+
+	expectRegions := func(loads *sqlmock.Rows) {
+		mock.ExpectQuery(`FROM gateways`).WillReturnRows(loads)
+		mock.ExpectQuery(`FROM regions`).WillReturnRows(sqlmock.NewRows([]string{"name", "latitude", "longitude"}).
+			AddRow("eu-west-1", 53.35, -6.26).
+			AddRow("me-south-1", 26.07, 50.56))
+	}
+	// A region's candidates are only read for its first pack, then cached
+	expectPack := func(region string, candidates bool) {
+		mock.ExpectQuery(`FROM launch_open_regions`).
+			WillReturnRows(sqlmock.NewRows([]string{"region"}).AddRow("eu-west-1").AddRow("me-south-1"))
+		mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		if candidates {
+			mock.ExpectQuery(`SELECT id, public_key`).WithArgs(region, false, config.DefaultGatewayCandidateLimit).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+			mock.ExpectQuery(`SELECT id, public_key`).WithArgs(region).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+		}
+	}
+	served := func(when, region, body string) {
+		t.Helper()
+		demand := metrics.RegionDemand.WithLabelValues(region, "GB", "open")
+		before := testutil.ToFloat64(demand)
+		if w := post(body); w.Code != http.StatusOK {
+			t.Fatalf("%s: status: got %d, want 200 (%s)", when, w.Code, w.Body.String())
+		}
+		if got := testutil.ToFloat64(demand) - before; got != 1 {
+			t.Errorf("%s: region demand %s/GB/open delta: got %v, want 1", when, region, got)
+		}
+	}
+
+	// GB's own eu-west-1 is available, so it serves even a client in
+	// Bahrain; regions are not ranked
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(sqlmock.NewRows([]string{"region", "avg", "min"}).AddRow("eu-west-1", 0.1, 0.1).AddRow("me-south-1", 0.5, 0.5))
+	expectPack("eu-west-1", true)
+	served("mapped region available", "eu-west-1", `{"device_id":"device-1","platform":"android","latitude":26.2,"longitude":50.5}`)
+
+	// With eu-west-1 full, the client in Bahrain is served from me-south-1
+	expectRegions(sqlmock.NewRows([]string{"region", "avg", "min"}).AddRow("eu-west-1", 0.95, 0.95).AddRow("me-south-1", 0.5, 0.5))
+	expectPack("me-south-1", true)
+	served("from coordinates", "me-south-1", `{"device_id":"device-1","platform":"android","latitude":26.2,"longitude":50.5}`)
+
+	// Without coordinates, from GB's centroid: the nearest available region
+	expectRegions(sqlmock.NewRows([]string{"region", "avg", "min"}).AddRow("eu-west-1", 0.95, 0.95).AddRow("me-south-1", 0.5, 0.5))
+	expectPack("me-south-1", false)
+	served("from the country's centroid", "me-south-1", `{"device_id":"device-1","platform":"android"}`)
+
+	// The country's region when availability cannot be read
+	mock.ExpectQuery(`FROM gateways`).WillReturnError(errors.New("connection refused"))
+	expectPack("eu-west-1", false)
+	served("unranked", "eu-west-1", `{"device_id":"device-1","platform":"android"}`)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPutLaunchPolicy(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM launch_open_regions`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO launch_open_regions`).WithArgs("eu-central-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO launch_open_regions`).WithArgs("us-east-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.PUT("/api/v1/admin/launch-policy", handler.PutLaunchPolicy)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/launch-policy", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := put(`{"open_regions":["us-east-1","Mars"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid region: got %d, want 400", w.Code)
+	}
+
+	w := put(`{"open_regions":["us-east-1","eu-central-1","us-east-1"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	if want := `{"open_regions":["eu-central-1","us-east-1"],"restricted":true}`; w.Body.String() != want {
+		t.Errorf("body: got %s, want %s", w.Body.String(), want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
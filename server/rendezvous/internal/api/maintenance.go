@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+	"rendezvous/internal/sanitize"
+)
+
+// maxMaintenanceReasonLen bounds a maintenance window's stored reason
+const maxMaintenanceReasonLen = 1024
+
+// MaintenanceWindowRequest schedules approved maintenance for a gateway.
+// Downtime inside the window does not count against the gateway's uptime.
+type MaintenanceWindowRequest struct {
+	StartsAt time.Time `json:"starts_at" binding:"required"`
+	EndsAt   time.Time `json:"ends_at" binding:"required"`
+	Reason   *string   `json:"reason,omitempty"` // Sanitized and cut to maxMaintenanceReasonLen bytes
+}
+
+// MaintenanceWindowResponse represents a maintenance window in admin responses
+type MaintenanceWindowResponse struct {
+	ID         string    `json:"id"`
+	GatewayID  string    `json:"gateway_id"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	Reason     *string   `json:"reason,omitempty"`
+	ApprovedBy string    `json:"approved_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// parseUptimeWindow resolves the window query parameter of uptime-reporting
+// endpoints, defaulting to gateway.DefaultUptimeWindow.
+func parseUptimeWindow(c *gin.Context) (string, bool) {
+	window := c.DefaultQuery("window", gateway.DefaultUptimeWindow)
+	_, ok := gateway.UptimeWindows[window]
+	return window, ok
+}
+
+// CreateMaintenanceWindow records an approved maintenance window for a
+// gateway. The admin creating it is recorded as its approver.
+func (h *Handler) CreateMaintenanceWindow(c *gin.Context) {
+	gatewayID := c.Param("id")
+	if !gatewayIDPattern.MatchString(gatewayID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_gateway_id"})
+		return
+	}
+
+	var req MaintenanceWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_maintenance_window"})
+		return
+	}
+	if req.Reason != nil {
+		reason := sanitize.Multiline(*req.Reason, maxMaintenanceReasonLen)
+		req.Reason = &reason
+	}
+
+	ctx := c.Request.Context()
+	if _, err := h.database.GetGatewayByID(ctx, gatewayID); err != nil {
+		respondError(c, err, "gateway_fetch_failed")
+		return
+	}
+	approvedBy := auditActor(c)
+	var window *db.MaintenanceWindow
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		var err error
+		window, err = h.database.CreateMaintenanceWindow(ctx, gatewayID, req.StartsAt.UTC(), req.EndsAt.UTC(), req.Reason, approvedBy)
+		if err != nil {
+			return nil, err
+		}
+		details := map[string]interface{}{"window_id": window.ID, "starts_at": window.StartsAt, "ends_at": window.EndsAt}
+		if window.Reason != nil {
+			details["reason"] = *window.Reason
+		}
+		return &db.AuditRecord{Action: AuditMaintenanceWindowCreate, SubjectType: "gateway", SubjectID: gatewayID, Details: details}, nil
+	})
+	if err != nil {
+		respondError(c, err, "maintenance_window_create_failed")
+		return
+	}
+
+	c.JSON(http.StatusCreated, MaintenanceWindowResponse{
+		ID:         window.ID,
+		GatewayID:  window.GatewayID,
+		StartsAt:   window.StartsAt,
+		EndsAt:     window.EndsAt,
+		Reason:     window.Reason,
+		ApprovedBy: window.ApprovedBy,
+		CreatedAt:  window.CreatedAt,
+	})
+}
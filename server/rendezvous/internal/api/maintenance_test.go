@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+)
+
+var maintenanceWindowColumns = []string{"id", "gateway_id", "starts_at", "ends_at", "reason", "approved_by", "created_at"}
+
+func maintenanceRouter(database *db.Database) *gin.Engine {
+	handler := &Handler{database: database, registry: gateway.NewRegistry(database)}
+	router := gin.New()
+	router.GET("/api/v1/gateways", handler.GetGateways)
+	router.POST("/api/v1/admin/gateways/:id/maintenance-windows", asAdmin("alice"), handler.CreateMaintenanceWindow)
+	return router
+}
+
+func TestCreateMaintenanceWindow(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	startsAt := time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC)
+	endsAt := startsAt.Add(2 * time.Hour)
+	mock.ExpectQuery(`WHERE id = \$1`).WithArgs(testGatewayID).WillReturnRows(
+		sqlmock.NewRows(launchGatewayColumns).AddRow(
+			testGatewayID, []byte{}, "192.0.2.1", 443, "{masque}", "{}",
+			"me-south-1", nil, 0, nil, "active", false,
+			"op-1", "approved", nil,
+			startsAt, nil, startsAt,
+		))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateway_maintenance_windows`).
+		WithArgs(testGatewayID, startsAt, endsAt, "kernel upgrade", "alice").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("mw-1", startsAt))
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+	router := maintenanceRouter(db.NewFromPool(sqlDB))
+
+	post := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/gateways/"+id+"/maintenance-windows", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		return serve(router, req)
+	}
+
+	if w := post("not-a-uuid", `{}`); w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte("invalid_gateway_id")) {
+		t.Errorf("malformed id: got %d %s", w.Code, w.Body.String())
+	}
+	inverted := `{"starts_at":"2026-03-01T04:00:00Z","ends_at":"2026-03-01T02:00:00Z"}`
+	if w := post(testGatewayID, inverted); w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte("invalid_maintenance_window")) {
+		t.Errorf("inverted window: got %d %s", w.Code, w.Body.String())
+	}
+
+	w := post(testGatewayID, `{"starts_at":"2026-03-01T02:00:00Z","ends_at":"2026-03-01T04:00:00Z","reason":"kernel upgrade"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status: got %d, want 201 (%s)", w.Code, w.Body.String())
+	}
+	var resp MaintenanceWindowResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.ID != "mw-1" || resp.ApprovedBy != "alice" || resp.Reason == nil || *resp.Reason != "kernel upgrade" {
+		t.Errorf("response: got %+v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCreateMaintenanceWindow_UnknownGateway(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`WHERE id = \$1`).WithArgs(testGatewayID).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+	router := maintenanceRouter(db.NewFromPool(sqlDB))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/gateways/"+testGatewayID+"/maintenance-windows",
+		bytes.NewReader([]byte(`{"starts_at":"2026-03-01T02:00:00Z","ends_at":"2026-03-01T04:00:00Z"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	if w := serve(router, req); w.Code != http.StatusNotFound {
+		t.Errorf("status: got %d, want 404 (%s)", w.Code, w.Body.String())
+	}
+}
+
+func TestGetGateways_Uptime(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	now := time.Now().UTC()
+	day := 24 * time.Hour
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns).
+		AddRow(
+			testGatewayID, []byte{}, "192.0.2.1", 443, "{masque}", "{}",
+			"me-south-1", nil, 0, nil, "active", false,
+			"op-1", "approved", nil,
+			now.Add(-30*day), now, now,
+		).
+		AddRow(
+			"new-gateway", []byte{}, "192.0.2.2", 443, "{masque}", "{}",
+			"me-south-1", nil, 0, nil, "active", false,
+			"op-2", "approved", nil,
+			now.Add(time.Hour), nil, now,
+		))
+	mock.ExpectQuery(`FROM gateway_status_history`).WillReturnRows(
+		sqlmock.NewRows([]string{"gateway_id", "status", "changed_at"}).
+			AddRow(testGatewayID, "offline", now.Add(-4*day)).
+			AddRow(testGatewayID, "active", now.Add(-3*day)))
+	mock.ExpectQuery(`FROM gateway_maintenance_windows`).WillReturnRows(sqlmock.NewRows(maintenanceWindowColumns))
+	mock.ExpectQuery(`FROM gateway_user_reconciliation`).WillReturnRows(sqlmock.NewRows([]string{"gateway_id", "plausible_users"}))
+	router := maintenanceRouter(db.NewFromPool(sqlDB))
+
+	if w := serve(router, httptest.NewRequest(http.MethodGet, "/api/v1/gateways?window=1y", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown window: got %d, want 400", w.Code)
+	}
+
+	w := serve(router, httptest.NewRequest(http.MethodGet, "/api/v1/gateways?window=7d", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Gateways []struct {
+			ID            string   `json:"id"`
+			UptimePercent *float64 `json:"uptime_percent"`
+			UptimeWindow  string   `json:"uptime_window"`
+		} `json:"gateways"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.Gateways) != 2 {
+		t.Fatalf("gateways: got %d, want 2", len(resp.Gateways))
+	}
+	// One day down out of seven
+	if got := resp.Gateways[0].UptimePercent; got == nil || *got < 85.7 || *got > 85.8 || resp.Gateways[0].UptimeWindow != "7d" {
+		t.Errorf("uptime: got %v over %s, want ~85.7%% over 7d", got, resp.Gateways[0].UptimeWindow)
+	}
+	// A gateway with no time in the window has no uptime yet
+	if got := resp.Gateways[1].UptimePercent; got != nil {
+		t.Errorf("new gateway uptime: got %v, want null", *got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetGateways_CapsInflatedUserCounts(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	now := time.Now().UTC()
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns).
+		AddRow(
+			testGatewayID, []byte{}, "192.0.2.1", 443, "{masque}", "{}",
+			"me-south-1", nil, 400, nil, "active", false,
+			"op-1", "approved", nil,
+			now, now, now,
+		).
+		AddRow(
+			"honest-gateway", []byte{}, "192.0.2.2", 443, "{masque}", "{}",
+			"me-south-1", nil, 30, nil, "active", false,
+			"op-2", "approved", nil,
+			now, now, now,
+		))
+	mock.ExpectQuery(`FROM gateway_status_history`).WillReturnRows(sqlmock.NewRows([]string{"gateway_id", "status", "changed_at"}))
+	mock.ExpectQuery(`FROM gateway_maintenance_windows`).WillReturnRows(sqlmock.NewRows(maintenanceWindowColumns))
+	mock.ExpectQuery(`FROM gateway_user_reconciliation`).WillReturnRows(
+		sqlmock.NewRows([]string{"gateway_id", "plausible_users"}).AddRow(testGatewayID, 95))
+	router := maintenanceRouter(db.NewFromPool(sqlDB))
+
+	w := serve(router, httptest.NewRequest(http.MethodGet, "/api/v1/gateways", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Gateways []struct {
+			ID           string `json:"id"`
+			CurrentUsers int    `json:"current_users"`
+		} `json:"gateways"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.Gateways) != 2 || resp.Gateways[0].CurrentUsers != 95 || resp.Gateways[1].CurrentUsers != 30 {
+		t.Errorf("gateways: got %+v, want the flagged one capped at 95", resp.Gateways)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
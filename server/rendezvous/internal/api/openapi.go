@@ -0,0 +1,164 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/audit"
+	"rendezvous/internal/config"
+	"rendezvous/internal/openapi"
+)
+
+//go:generate go run ../../cmd/openapi-gen -o openapi.json
+
+// openAPISpec is the generated document served at /api/v1/openapi.json.
+// Regenerate it with go generate after changing Routes or a bound type.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPIInfo describes the API in the generated document
+var openAPIInfo = openapi.Info{Title: "LumenLink Rendezvous API", Version: "1"}
+
+// Routes documents every route the server registers, in registration order.
+// The server's router test fails when the two drift apart.
+var Routes = []openapi.Route{
+	{Method: http.MethodGet, Path: "/health", OperationID: "Health", Summary: "Report whether this replica should receive traffic"},
+	{Method: http.MethodGet, Path: "/status", OperationID: "GetStatusPage", Summary: "Read-only HTML status page", HTML: true},
+
+	{Method: http.MethodPost, Path: "/api/v1/config", OperationID: "GetConfig", Summary: "Fetch a signed config pack",
+		Request: GetConfigRequest{}, Response: GetConfigResponse{}},
+	{Method: http.MethodGet, Path: "/api/v1/config/signing-keys", OperationID: "GetSigningKeys", Summary: "Config signing keys, each endorsed by the key it replaced",
+		Response: config.SigningKeyHistory{}},
+	{Method: http.MethodGet, Path: "/api/v1/config/revocations", OperationID: "GetRevocations", Summary: "Signed list of revoked packs and signing keys",
+		Response: config.RevocationList{}},
+	{Method: http.MethodGet, Path: "/api/v1/attest/challenge", OperationID: "GetAttestationChallenge", Summary: "Issue an attestation challenge bound to a device",
+		RequiredQuery: []string{"device_id"}},
+	{Method: http.MethodPost, Path: "/api/v1/attest", OperationID: "VerifyAttestation", Summary: "Verify a device attestation token",
+		Request: VerifyAttestationRequest{}, Response: VerifyAttestationResponse{}},
+	{Method: http.MethodPost, Path: "/api/v1/attest/desktop/enroll", OperationID: "EnrollDesktopDevice", Summary: "Enroll a desktop client's attestation key",
+		Request: DesktopEnrollmentRequest{}, Response: DesktopEnrollmentResponse{}, Status: http.StatusCreated},
+	{Method: http.MethodPost, Path: "/api/v1/gateway/status", OperationID: "HandleGatewayStatus", Summary: "Report gateway status (heartbeat), signed with its key over the body",
+		Headers: []string{"X-Gateway-Timestamp", "X-Gateway-Signature"}, Request: GatewayStatusRequest{}, Response: GatewayStatusResponse{}},
+	{Method: http.MethodPost, Path: "/api/v1/gateway/register", OperationID: "RegisterGateway", Summary: "Register a gateway with an operator credential",
+		Headers: []string{"X-Operator-Token"}, Request: GatewayRegistrationRequest{}, Response: GatewayRegistrationResponse{}, Status: http.StatusCreated},
+	{Method: http.MethodPost, Path: "/api/v1/gateway/bootstrap", OperationID: "BootstrapGateway", Summary: "Register a gateway with a single-use enrollment token",
+		Request: GatewayBootstrapRequest{}, Response: config.GatewayBootstrap{}, Status: http.StatusCreated},
+	{Method: http.MethodGet, Path: "/api/v1/gateway/:id/metrics", OperationID: "GetGatewayMetrics", Summary: "Fetch a gateway's metrics, signed with its key",
+		Headers: []string{"X-Gateway-Timestamp", "X-Gateway-Signature"}, Query: []string{"window"}, Response: GatewayMetricsResponse{}},
+	{Method: http.MethodPut, Path: "/api/v1/gateway/:id/secret", OperationID: "PutGatewaySecret", Summary: "Rotate a gateway's transport secret, signed with its key over the body",
+		Headers: []string{"X-Gateway-Timestamp", "X-Gateway-Signature"}, Request: GatewaySecretRequest{}, Response: GatewaySecretResponse{}},
+	{Method: http.MethodGet, Path: "/api/v1/gateway/:id/notifications", OperationID: "GetNotificationPreferences", Summary: "Fetch the operator's notification preferences with an operator credential",
+		Headers: []string{"X-Operator-Token"}, Response: NotificationPreferencesResponse{}},
+	{Method: http.MethodPut, Path: "/api/v1/gateway/:id/notifications", OperationID: "PutNotificationPreferences", Summary: "Replace the operator's notification preferences with an operator credential",
+		Headers: []string{"X-Operator-Token"}, Request: NotificationPreferencesRequest{}, Response: NotificationPreferencesResponse{}},
+	{Method: http.MethodGet, Path: "/api/v1/gateway/:id/notifications/deliveries", OperationID: "GetNotificationDeliveries", Summary: "List the operator's recent notification delivery attempts with an operator credential",
+		Headers: []string{"X-Operator-Token"}, Query: []string{"limit"}, Response: NotificationDeliveriesResponse{}},
+	{Method: http.MethodPost, Path: "/api/v1/discovery/log", OperationID: "HandleDiscoveryLog", Summary: "Log a discovery attempt",
+		Request: DiscoveryLogRequest{}, Response: DiscoveryLogResponse{}},
+	{Method: http.MethodPost, Path: "/api/v1/discovery/logs", OperationID: "HandleDiscoveryLogBatch", Summary: "Log several discovery attempts at once",
+		Request: DiscoveryLogBatchRequest{}, Response: DiscoveryLogBatchResponse{}},
+	{Method: http.MethodPost, Path: "/api/v1/client/errors", OperationID: "ReportClientError", Summary: "Report a structured client error",
+		Request: ClientErrorRequest{}, Response: ClientErrorResponse{}},
+	{Method: http.MethodGet, Path: "/api/v1/gateways", OperationID: "GetGateways", Summary: "List gateways for the community page",
+		Query: []string{"window"}},
+	{Method: http.MethodGet, Path: "/api/v1/stats/discovery", OperationID: "GetDiscoveryStats", Summary: "Per-channel discovery success rates",
+		Query: []string{"window"}},
+	{Method: http.MethodGet, Path: "/api/v1/federation/announcement", OperationID: "GetFederationAnnouncement", Summary: "Our signed gateway announcement for federation peers",
+		Headers: []string{"X-Federation-Key-ID", "X-Federation-Timestamp", "X-Federation-Signature"}, Response: config.GatewayAnnouncement{}},
+	{Method: http.MethodGet, Path: "/api/v1/openapi.json", OperationID: "GetOpenAPISpec", Summary: "This document"},
+
+	{Method: http.MethodGet, Path: "/api/v1/admin/review-queue", OperationID: "GetReviewQueue", Summary: "List review queue items",
+		Admin: true, Query: []string{"status", "limit"}},
+	{Method: http.MethodPost, Path: "/api/v1/admin/review-queue/:id/close", OperationID: "CloseReviewItem", Summary: "Resolve or dismiss a review queue item",
+		Admin: true, Request: CloseReviewItemRequest{}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/gateways/:id", OperationID: "GetAdminGateway", Summary: "Fetch a gateway with its suspicion score",
+		Admin: true, Query: []string{"include_secrets"}, Response: AdminGatewayResponse{}},
+	{Method: http.MethodPost, Path: "/api/v1/admin/gateways/:id/approve", OperationID: "ApproveGateway", Summary: "Approve a pending gateway",
+		Admin: true},
+	{Method: http.MethodPost, Path: "/api/v1/admin/gateways/:id/reject", OperationID: "RejectGateway", Summary: "Reject a pending gateway",
+		Admin: true},
+	{Method: http.MethodPost, Path: "/api/v1/admin/gateways/:id/maintenance-windows", OperationID: "CreateMaintenanceWindow", Summary: "Record approved maintenance excluded from a gateway's uptime",
+		Admin: true, Request: MaintenanceWindowRequest{}, Response: MaintenanceWindowResponse{}, Status: http.StatusCreated},
+	{Method: http.MethodGet, Path: "/api/v1/admin/devices/:id", OperationID: "GetAdminDevice", Summary: "Fetch a device's progressive trust tier",
+		Admin: true, Response: AdminDeviceResponse{}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/federation/peers", OperationID: "ListFederationPeers", Summary: "List federation peers with their poll status",
+		Admin: true, Response: FederationPeerListResponse{}},
+	{Method: http.MethodPost, Path: "/api/v1/admin/federation/peers", OperationID: "CreateFederationPeer", Summary: "Add a federation peer whose gateways are imported",
+		Admin: true, Request: FederationPeerRequest{}, Response: FederationPeerResponse{}, Status: http.StatusCreated},
+	{Method: http.MethodPut, Path: "/api/v1/admin/federation/peers/:id", OperationID: "UpdateFederationPeer", Summary: "Change a federation peer's name, URL or pinned key",
+		Admin: true, Request: FederationPeerRequest{}, Response: FederationPeerResponse{}},
+	{Method: http.MethodDelete, Path: "/api/v1/admin/federation/peers/:id", OperationID: "DeleteFederationPeer", Summary: "Remove a federation peer and its imported gateways",
+		Admin: true, Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/api/v1/admin/federation/peers/:id/enable", OperationID: "EnableFederationPeer", Summary: "Resume importing a federation peer's gateways",
+		Admin: true, Response: FederationPeerResponse{}},
+	{Method: http.MethodPost, Path: "/api/v1/admin/federation/peers/:id/disable", OperationID: "DisableFederationPeer", Summary: "Stop importing a federation peer's gateways",
+		Admin: true, Response: FederationPeerResponse{}},
+	{Method: http.MethodPost, Path: "/api/v1/admin/enrollment-tokens", OperationID: "CreateEnrollmentToken", Summary: "Issue a single-use gateway enrollment token",
+		Admin: true, Request: EnrollmentTokenRequest{}, Response: EnrollmentTokenResponse{}, Status: http.StatusCreated},
+	{Method: http.MethodPost, Path: "/api/v1/admin/operator-credentials", OperationID: "CreateOperatorCredential", Summary: "Issue a credential a gateway operator registers gateways with",
+		Admin: true, Request: OperatorCredentialRequest{}, Response: OperatorCredentialResponse{}, Status: http.StatusCreated},
+	{Method: http.MethodDelete, Path: "/api/v1/admin/operator-credentials/:id", OperationID: "RevokeOperatorCredential", Summary: "Revoke an operator credential",
+		Admin: true, Response: OperatorCredentialResponse{}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/client-errors", OperationID: "GetClientErrorSummary", Summary: "Aggregate client error reports",
+		Admin: true, Query: []string{"window"}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/pack-verification-failures", OperationID: "GetPackVerificationFailures", Summary: "Pack verification failures per key pair",
+		Admin: true, Query: []string{"window"}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/attestation/stats", OperationID: "GetAttestationStats", Summary: "Attestation outcomes per platform and reason",
+		Admin: true, Query: []string{"window"}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/adversarial-activity", OperationID: "GetAdversarialActivity", Summary: "Discovery attempts against honeypots",
+		Admin: true, Query: []string{"window"}},
+	{Method: http.MethodPost, Path: "/api/v1/admin/packs/preview", OperationID: "PreviewConfigPack", Summary: "Preview the pack a device profile would receive",
+		Admin: true, Request: PackPreviewRequest{}, Response: PackPreviewResponse{}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/config/preview", OperationID: "GetConfigPreview", Summary: "Preview the pack a device in a region would receive, optionally unsigned",
+		Admin: true, Query: []string{"region", "integrity", "device_id", "platform", "country", "locale", "unsigned"}, Response: PackPreviewResponse{}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/rollouts", OperationID: "ListRollouts", Summary: "List rollouts",
+		Admin: true},
+	{Method: http.MethodPut, Path: "/api/v1/admin/rollouts/:key", OperationID: "PutRollout", Summary: "Create or update a rollout",
+		Admin: true, Request: RolloutRequest{}},
+	{Method: http.MethodDelete, Path: "/api/v1/admin/rollouts/:key", OperationID: "DeleteRollout", Summary: "Delete a rollout",
+		Admin: true, Query: []string{"region"}, Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/api/v1/admin/rollouts/:key/abort", OperationID: "AbortRollout", Summary: "Freeze a rollout at its current percentage",
+		Admin: true, Query: []string{"region"}, Response: RolloutResponse{}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/launch-policy", OperationID: "GetLaunchPolicy", Summary: "Fetch the soft launch open regions",
+		Admin: true, Response: LaunchPolicyResponse{}},
+	{Method: http.MethodPut, Path: "/api/v1/admin/launch-policy", OperationID: "PutLaunchPolicy", Summary: "Replace the soft launch open regions",
+		Admin: true, Request: LaunchPolicyRequest{}, Response: LaunchPolicyResponse{}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/transport-policies", OperationID: "ListTransportPolicies", Summary: "List country transport policies",
+		Admin: true, Response: TransportPolicyListResponse{}},
+	{Method: http.MethodPut, Path: "/api/v1/admin/transport-policies/:country/:transport", OperationID: "PutTransportPolicy", Summary: "Allow, deny or prefer a transport in a country",
+		Admin: true, Request: TransportPolicyRequest{}, Response: TransportPolicyResponse{}},
+	{Method: http.MethodDelete, Path: "/api/v1/admin/transport-policies/:country/:transport", OperationID: "DeleteTransportPolicy", Summary: "Remove a country transport policy",
+		Admin: true, Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/api/v1/admin/experiments", OperationID: "ListExperiments", Summary: "List pack parameter experiments",
+		Admin: true, Response: ExperimentListResponse{}},
+	{Method: http.MethodPut, Path: "/api/v1/admin/experiments/:name", OperationID: "PutExperiment", Summary: "Create or replace an experiment",
+		Admin: true, Request: ExperimentRequest{}, Response: ExperimentResponse{}},
+	{Method: http.MethodDelete, Path: "/api/v1/admin/experiments/:name", OperationID: "DeleteExperiment", Summary: "End and remove an experiment",
+		Admin: true, Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/api/v1/admin/kill-switches", OperationID: "ListKillSwitches", Summary: "List transports disabled in every pack",
+		Admin: true, Response: KillSwitchesResponse{}},
+	{Method: http.MethodPut, Path: "/api/v1/admin/kill-switches/:transport", OperationID: "PutKillSwitch", Summary: "Disable a transport in every pack",
+		Admin: true, Request: KillSwitchRequest{}, Response: KillSwitchesResponse{}},
+	{Method: http.MethodDelete, Path: "/api/v1/admin/kill-switches/:transport", OperationID: "DeleteKillSwitch", Summary: "Enable a disabled transport again",
+		Admin: true, Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/api/v1/admin/transports/endpoint-burn", OperationID: "GetEndpointBurn", Summary: "Pool endpoint burn per allocation epoch",
+		Admin: true, Query: []string{"epochs"}, Response: EndpointBurnResponse{}},
+	{Method: http.MethodGet, Path: "/api/v1/admin/audit/export", OperationID: "ExportAuditLog", Summary: "Export the signed admin audit chain",
+		Admin: true, Response: audit.Export{}},
+	{Method: http.MethodPost, Path: "/api/v1/admin/signing-keys/rotate", OperationID: "RotateSigningKey", Summary: "Replace the config signing key, keeping the old one for a grace period",
+		Admin: true, Response: config.KeyRotation{}},
+	{Method: http.MethodPost, Path: "/api/v1/admin/config/revocations", OperationID: "CreateRevocation", Summary: "Revoke a pack by its hash or a signing key by its ID",
+		Admin: true, Request: RevocationRequest{}, Response: RevocationResponse{}},
+}
+
+// OpenAPISpec generates the OpenAPI document for Routes
+func OpenAPISpec() ([]byte, error) {
+	return openapi.Generate(openAPIInfo, Routes)
+}
+
+// GetOpenAPISpec serves the generated OpenAPI document
+func (h *Handler) GetOpenAPISpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", openAPISpec)
+}
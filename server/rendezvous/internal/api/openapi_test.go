@@ -0,0 +1,88 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPISpecIsUpToDate(t *testing.T) {
+	spec, err := OpenAPISpec()
+	if err != nil {
+		t.Fatalf("OpenAPISpec: %v", err)
+	}
+	if !bytes.Equal(spec, openAPISpec) {
+		t.Fatal("openapi.json is stale: a route or bound type changed; run go generate ./internal/api")
+	}
+}
+
+func TestGetOpenAPISpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/v1/openapi.json", (&Handler{}).GetOpenAPISpec)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var document struct {
+		OpenAPI string                 `json:"openapi"`
+		Paths   map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &document); err != nil {
+		t.Fatalf("spec is not JSON: %v", err)
+	}
+	if document.OpenAPI == "" || document.Paths["/api/v1/gateway/{id}/metrics"] == nil {
+		t.Fatalf("unexpected document: openapi=%q, %d paths", document.OpenAPI, len(document.Paths))
+	}
+}
+
+// Enum annotations are documentation only; keep them in step with validation
+// and with the codes responses carry
+func TestOpenAPIEnumsMatchValidation(t *testing.T) {
+	attestationErrors := map[string]struct{}{}
+	for _, code := range []string{
+		AttestationErrorIntegrity, AttestationErrorInvalidToken, AttestationErrorChallenge, AttestationErrorReattest,
+		AttestationErrorRevoked, AttestationErrorUnsupported, AttestationErrorUnavailable, AttestationErrorRateLimited,
+		AttestationErrorFailed,
+	} {
+		attestationErrors[code] = struct{}{}
+	}
+	enums := map[string]map[string]struct{}{
+		enumTag(t, GatewayStatusRequest{}, "Status"):                  allowedGatewayStatuses,
+		enumTag(t, GatewayRegistrationRequest{}, "TransportTypes"):    allowedTransportTypes,
+		enumTag(t, PackPreviewRequest{}, "Transports"):                allowedTransportTypes,
+		enumTag(t, GatewayRegistrationRequest{}, "DiscoveryChannels"): allowedDiscoveryChannels,
+		enumTag(t, DiscoveryLogRequest{}, "ChannelType"):              allowedDiscoveryChannels,
+		enumTag(t, ClientErrorRequest{}, "Platform"):                  allowedClientPlatforms,
+		enumTag(t, VerifyAttestationResponse{}, "ErrorCode"):          attestationErrors,
+	}
+	for tag, allowed := range enums {
+		values := strings.Split(tag, ",")
+		if len(values) != len(allowed) {
+			t.Errorf("enum %q has %d values, validation allows %d", tag, len(values), len(allowed))
+		}
+		for _, value := range values {
+			if _, ok := allowed[value]; !ok {
+				t.Errorf("enum %q: %q is not accepted by validation", tag, value)
+			}
+		}
+	}
+}
+
+func enumTag(t *testing.T, v interface{}, field string) string {
+	t.Helper()
+	f, ok := reflect.TypeOf(v).FieldByName(field)
+	if !ok {
+		t.Fatalf("%T has no field %s", v, field)
+	}
+	return f.Tag.Get("enum")
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+)
+
+// OperatorCredentialRequest asks for a credential a gateway operator
+// registers gateways with
+type OperatorCredentialRequest struct {
+	OperatorID string `json:"operator_id" binding:"required"`
+}
+
+// OperatorCredentialResponse describes an operator credential. The token is
+// only ever returned when the credential is created.
+type OperatorCredentialResponse struct {
+	ID         string     `json:"id"`
+	Token      string     `json:"token,omitempty"`
+	OperatorID string     `json:"operator_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateOperatorCredential issues a credential to a gateway operator, sent
+// as X-Operator-Token when registering gateways
+func (h *Handler) CreateOperatorCredential(c *gin.Context) {
+	var req OperatorCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.OperatorID) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_field_length"})
+		return
+	}
+
+	var token string
+	var stored *db.OperatorCredential
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		var err error
+		if token, stored, err = h.registry.IssueOperatorCredential(ctx, req.OperatorID, auditActor(c)); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditOperatorCredentialCreate, SubjectType: "operator_credential", SubjectID: stored.ID,
+			Details: map[string]interface{}{"operator_id": stored.OperatorID}}, nil
+	})
+	if err != nil {
+		respondError(c, err, "operator_credential_create_failed")
+		return
+	}
+
+	c.JSON(http.StatusCreated, OperatorCredentialResponse{
+		ID:         stored.ID,
+		Token:      token,
+		OperatorID: stored.OperatorID,
+		CreatedAt:  stored.CreatedAt,
+	})
+}
+
+// RevokeOperatorCredential revokes an operator credential
+func (h *Handler) RevokeOperatorCredential(c *gin.Context) {
+	id := c.Param("id")
+	if !gatewayIDPattern.MatchString(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_credential_id"})
+		return
+	}
+	var revoked *db.OperatorCredential
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		var err error
+		if revoked, err = h.registry.RevokeOperatorCredential(ctx, id); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditOperatorCredentialRevoke, SubjectType: "operator_credential", SubjectID: revoked.ID,
+			Details: map[string]interface{}{"operator_id": revoked.OperatorID}}, nil
+	})
+	if err != nil {
+		respondError(c, err, "operator_credential_revoke_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, OperatorCredentialResponse{
+		ID:         revoked.ID,
+		OperatorID: revoked.OperatorID,
+		CreatedAt:  revoked.CreatedAt,
+		RevokedAt:  revoked.RevokedAt,
+	})
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+	"rendezvous/internal/notify"
+)
+
+// maxPreferencesBody bounds the notification preferences request body
+const maxPreferencesBody = 16 << 10
+
+// NotificationPreferencesRequest replaces an operator's notification preferences
+type NotificationPreferencesRequest struct {
+	WebhookURL string          `json:"webhook_url"` // https; empty for none
+	Email      string          `json:"email"`       // Empty for none
+	Events     map[string]bool `json:"events"`      // Event type to enabled; missing types are disabled
+}
+
+// NotificationPreferencesResponse is an operator's notification preferences
+type NotificationPreferencesResponse struct {
+	OperatorID string          `json:"operator_id"`
+	WebhookURL string          `json:"webhook_url"`
+	Email      string          `json:"email"`
+	Events     map[string]bool `json:"events"`     // Every event type
+	UpdatedAt  *time.Time      `json:"updated_at"` // Null until preferences are first set
+}
+
+// NotificationDeliveriesResponse lists an operator's recent delivery attempts
+type NotificationDeliveriesResponse struct {
+	OperatorID string                    `json:"operator_id"`
+	Deliveries []db.NotificationDelivery `json:"deliveries"`
+}
+
+// GetNotificationPreferences returns the notification preferences of the
+// operator that registered the gateway. The request carries the operator's
+// credential in X-Operator-Token, as registration does; a gateway's own key
+// cannot act for its operator.
+func (h *Handler) GetNotificationPreferences(c *gin.Context) {
+	operatorID, ok := h.authenticateOperator(c)
+	if !ok {
+		return
+	}
+	prefs, err := h.database.GetOperatorPreferences(c.Request.Context(), operatorID)
+	if errors.Is(err, db.ErrPreferencesNotFound) {
+		prefs, err = &db.OperatorPreferences{OperatorID: operatorID}, nil
+	}
+	if err != nil {
+		respondError(c, err, "notification_preferences_fetch_failed")
+		return
+	}
+	c.JSON(http.StatusOK, preferencesResponse(prefs))
+}
+
+// PutNotificationPreferences replaces the operator's notification
+// preferences
+func (h *Handler) PutNotificationPreferences(c *gin.Context) {
+	operatorID, ok := h.authenticateOperator(c)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPreferencesBody+1))
+	if err != nil || len(body) > maxPreferencesBody {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_body"})
+		return
+	}
+
+	var req NotificationPreferencesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.WebhookURL != "" && !validWebhookURL(req.WebhookURL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_webhook_url"})
+		return
+	}
+	if req.Email != "" {
+		if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_email"})
+			return
+		}
+	}
+	events := []string{}
+	for eventType, enabled := range req.Events {
+		if !knownOperatorEvent(eventType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_event_type"})
+			return
+		}
+		if enabled {
+			events = append(events, eventType)
+		}
+	}
+	sort.Strings(events)
+
+	prefs := &db.OperatorPreferences{
+		OperatorID: operatorID,
+		WebhookURL: req.WebhookURL,
+		Email:      req.Email,
+		Events:     events,
+	}
+	ctx := c.Request.Context()
+	if err := h.database.UpsertOperatorPreferences(ctx, prefs); err != nil {
+		respondError(c, err, "notification_preferences_update_failed")
+		return
+	}
+	stored, err := h.database.GetOperatorPreferences(ctx, operatorID)
+	if err != nil {
+		respondError(c, err, "notification_preferences_fetch_failed")
+		return
+	}
+	c.JSON(http.StatusOK, preferencesResponse(stored))
+}
+
+// GetNotificationDeliveries returns the operator's most recent notification
+// delivery attempts, including failures and rate-limited events.
+func (h *Handler) GetNotificationDeliveries(c *gin.Context) {
+	operatorID, ok := h.authenticateOperator(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	deliveries, err := h.database.GetNotificationDeliveries(c.Request.Context(), operatorID, limit)
+	if err != nil {
+		respondError(c, err, "notification_deliveries_fetch_failed")
+		return
+	}
+	c.JSON(http.StatusOK, NotificationDeliveriesResponse{OperatorID: operatorID, Deliveries: deliveries})
+}
+
+// authenticateOperator checks the operator credential in X-Operator-Token
+// and returns its operator, writing the error response if it fails. The
+// gateway in the path must be one of the operator's; a gateway registered
+// without an operator has no operator settings.
+func (h *Handler) authenticateOperator(c *gin.Context) (string, bool) {
+	gatewayID := c.Param("id")
+	if !gatewayIDPattern.MatchString(gatewayID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_gateway_id"})
+		return "", false
+	}
+	if h.database == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database_unavailable"})
+		return "", false
+	}
+
+	ctx := c.Request.Context()
+	operatorID, err := h.registry.AuthenticateOperatorCredential(ctx, c.GetHeader("X-Operator-Token"))
+	if err != nil {
+		respondError(c, err, "authentication_failed")
+		return "", false
+	}
+	gw, err := h.database.GetGatewayByID(ctx, gatewayID)
+	if err != nil && !errors.Is(err, db.ErrGatewayNotFound) {
+		respondError(c, err, "gateway_fetch_failed")
+		return "", false
+	}
+	if gw == nil || gw.OperatorID != operatorID {
+		// Another operator's gateway looks the same as a missing one
+		c.JSON(http.StatusForbidden, gin.H{"error": "operator_mismatch"})
+		return "", false
+	}
+	return operatorID, true
+}
+
+// checkBandwidthCap tells the gateway's operator when a heartbeat reports
+// bandwidth near the gateway's declared capacity. The heartbeat is already
+// stored, so failures are only logged.
+func (h *Handler) checkBandwidthCap(ctx context.Context, gatewayID string, usedMbps int) {
+	if h.operatorEvents == nil || usedMbps <= 0 {
+		return
+	}
+	gw, err := h.database.GetGatewayByID(ctx, gatewayID)
+	if err != nil {
+		if !errors.Is(err, db.ErrGatewayNotFound) {
+			log.Printf("failed to load gateway %s for its bandwidth check: %v", gatewayID, err)
+		}
+		return
+	}
+	if event, ok := gateway.BandwidthCapEvent(gw, usedMbps, h.bandwidthWarn, h.now()); ok {
+		h.operatorEvents.Emit(event)
+	}
+}
+
+// gatewayRequestSignature reads the X-Gateway-Timestamp and
+// X-Gateway-Signature headers of a request signed with a gateway key.
+func gatewayRequestSignature(c *gin.Context) (int64, []byte, bool) {
+	timestamp, err := strconv.ParseInt(c.GetHeader("X-Gateway-Timestamp"), 10, 64)
+	if err != nil {
+		return 0, nil, false
+	}
+	signature, err := base64.StdEncoding.DecodeString(c.GetHeader("X-Gateway-Signature"))
+	if err != nil || len(signature) == 0 {
+		return 0, nil, false
+	}
+	return timestamp, signature, true
+}
+
+func preferencesResponse(prefs *db.OperatorPreferences) NotificationPreferencesResponse {
+	resp := NotificationPreferencesResponse{
+		OperatorID: prefs.OperatorID,
+		WebhookURL: prefs.WebhookURL,
+		Email:      prefs.Email,
+		Events:     map[string]bool{},
+	}
+	for _, eventType := range notify.OperatorEventTypes {
+		resp.Events[eventType] = false
+	}
+	for _, eventType := range prefs.Events {
+		resp.Events[eventType] = true
+	}
+	if !prefs.UpdatedAt.IsZero() {
+		resp.UpdatedAt = &prefs.UpdatedAt
+	}
+	return resp
+}
+
+func knownOperatorEvent(eventType string) bool {
+	for _, known := range notify.OperatorEventTypes {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// validWebhookURL accepts absolute https URLs without credentials. Where the
+// host resolves to is checked when delivering.
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && u.Hostname() != "" && u.User == nil && len(raw) <= 2048
+}
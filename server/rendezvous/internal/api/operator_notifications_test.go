@@ -0,0 +1,275 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+	"rendezvous/internal/notify"
+)
+
+func operatorGatewayRows(publicKey ed25519.PublicKey, operatorID interface{}, bandwidthMbps interface{}) *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows([]string{
+		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
+		"created_at", "last_seen", "updated_at",
+	}).AddRow(
+		testGatewayID, []byte(publicKey), "192.0.2.1", 443, "{masque}", "{}",
+		"me-south-1", bandwidthMbps, 0, nil, "active", false,
+		operatorID, "approved", nil,
+		now, nil, now,
+	)
+}
+
+func preferenceRows(webhookURL, email interface{}, events []string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"operator_id", "webhook_url", "email", "events", "updated_at"}).
+		AddRow("op-1", webhookURL, email, pq.StringArray(events), time.Now())
+}
+
+func operatorRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	database := db.NewFromPool(sqlDB)
+	handler := &Handler{database: database, registry: gateway.NewRegistry(database)}
+	router := gin.New()
+	router.GET("/api/v1/gateway/:id/notifications", handler.GetNotificationPreferences)
+	router.PUT("/api/v1/gateway/:id/notifications", handler.PutNotificationPreferences)
+	router.GET("/api/v1/gateway/:id/notifications/deliveries", handler.GetNotificationDeliveries)
+	return router, mock
+}
+
+// signedOperatorRequest signs body (nil for none) as the gateway's key would;
+// signedBody, if different, is what the signature covers.
+func signedOperatorRequest(method, path string, privateKey ed25519.PrivateKey, body, signedBody []byte) *http.Request {
+	timestamp := time.Now().Unix()
+	message := gateway.RequestMessage(testGatewayID, path, timestamp)
+	if signedBody != nil {
+		message = gateway.RequestBodyMessage(testGatewayID, path, timestamp, signedBody)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("X-Gateway-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Gateway-Signature", base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, message)))
+	return req
+}
+
+// operatorRequest sends body (nil for none) with the operator credential
+// expectOperatorCredential accepts
+func operatorRequest(method, path string, body []byte) *http.Request {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("X-Operator-Token", "operator-token")
+	return req
+}
+
+func serve(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+const notificationsPath = "/api/v1/gateway/" + testGatewayID + "/notifications"
+
+func TestGetNotificationPreferences_Defaults(t *testing.T) {
+	router, mock := operatorRouter(t)
+	expectOperatorCredential(mock, "op-1")
+	mock.ExpectQuery(`WHERE id = \$1`).WillReturnRows(operatorGatewayRows(make([]byte, 32), "op-1", nil))
+	mock.ExpectQuery(`FROM operator_notification_preferences`).WithArgs("op-1").
+		WillReturnRows(sqlmock.NewRows([]string{"operator_id"}))
+
+	w := serve(router, operatorRequest(http.MethodGet, notificationsPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d (%s)", w.Code, w.Body.String())
+	}
+	var resp NotificationPreferencesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.OperatorID != "op-1" || resp.UpdatedAt != nil || len(resp.Events) != len(notify.OperatorEventTypes) {
+		t.Errorf("got %+v", resp)
+	}
+	for eventType, enabled := range resp.Events {
+		if enabled {
+			t.Errorf("%s enabled by default", eventType)
+		}
+	}
+}
+
+func TestPutNotificationPreferences(t *testing.T) {
+	router, mock := operatorRouter(t)
+	body := []byte(`{"webhook_url":"https://ops.example.org/hook","email":"ops@example.org",` +
+		`"events":{"gateway_offline":true,"bandwidth_cap":true,"gateway_flagged":false}}`)
+
+	expectOperatorCredential(mock, "op-1")
+	mock.ExpectQuery(`WHERE id = \$1`).WillReturnRows(operatorGatewayRows(make([]byte, 32), "op-1", nil))
+	mock.ExpectExec(`INSERT INTO operator_notification_preferences`).
+		WithArgs("op-1", "https://ops.example.org/hook", "ops@example.org", pq.Array([]string{"bandwidth_cap", "gateway_offline"})).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM operator_notification_preferences`).
+		WillReturnRows(preferenceRows("https://ops.example.org/hook", "ops@example.org", []string{"bandwidth_cap", "gateway_offline"}))
+
+	w := serve(router, operatorRequest(http.MethodPut, notificationsPath, body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d (%s)", w.Code, w.Body.String())
+	}
+	var resp NotificationPreferencesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !resp.Events[notify.EventGatewayOffline] || resp.Events[notify.EventGatewayFlagged] || resp.UpdatedAt == nil {
+		t.Errorf("got %+v", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPutNotificationPreferences_Rejected(t *testing.T) {
+	body := []byte(`{"webhook_url":"https://ops.example.org/hook"}`)
+
+	tests := []struct {
+		name       string
+		body       []byte
+		credential interface{} // The credential's operator; nil if it is not valid
+		operatorID interface{} // The gateway's operator
+		wantStatus int
+		wantError  string
+	}{
+		{"no valid credential", body, nil, "op-1", http.StatusUnauthorized, "invalid_operator_credential"},
+		{"another operator's gateway", body, "op-2", "op-1", http.StatusForbidden, "operator_mismatch"},
+		{"gateway without operator", body, "op-1", nil, http.StatusForbidden, "operator_mismatch"},
+		{"plain http webhook", []byte(`{"webhook_url":"http://ops.example.org/hook"}`), "op-1", "op-1", http.StatusBadRequest, "invalid_webhook_url"},
+		{"bad email", []byte(`{"email":"Ops <ops@example.org>"}`), "op-1", "op-1", http.StatusBadRequest, "invalid_email"},
+		{"unknown event", []byte(`{"events":{"gateway_exploded":true}}`), "op-1", "op-1", http.StatusBadRequest, "invalid_event_type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := operatorRouter(t)
+			if tt.credential == nil {
+				mock.ExpectQuery(`FROM operator_credentials`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			} else {
+				expectOperatorCredential(mock, tt.credential.(string))
+				mock.ExpectQuery(`WHERE id = \$1`).WillReturnRows(operatorGatewayRows(make([]byte, 32), tt.operatorID, nil))
+			}
+
+			w := serve(router, operatorRequest(http.MethodPut, notificationsPath, tt.body))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var resp map[string]interface{}
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp["error"] != tt.wantError {
+				t.Errorf("error: got %v, want %s", resp["error"], tt.wantError)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestNotificationPreferences_GatewayKeyCannotActForOperator(t *testing.T) {
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	router, mock := operatorRouter(t)
+	mock.ExpectQuery(`FROM operator_credentials`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// Signed by the gateway, without the operator's credential
+	w := serve(router, signedOperatorRequest(http.MethodGet, notificationsPath, privateKey, nil, nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want 401 (%s)", w.Code, w.Body.String())
+	}
+}
+
+func TestGetNotificationDeliveries(t *testing.T) {
+	router, mock := operatorRouter(t)
+	now := time.Now()
+	expectOperatorCredential(mock, "op-1")
+	mock.ExpectQuery(`WHERE id = \$1`).WillReturnRows(operatorGatewayRows(make([]byte, 32), "op-1", nil))
+	mock.ExpectQuery(`FROM operator_notification_deliveries`).WithArgs("op-1", 20).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "operator_id", "event_type", "gateway_id", "channel", "attempt", "status", "error", "created_at",
+		}).
+			AddRow(2, "op-1", notify.EventGatewayOffline, testGatewayID, "webhook", 2, "delivered", nil, now).
+			AddRow(1, "op-1", notify.EventGatewayOffline, testGatewayID, "webhook", 1, "failed", "webhook returned status 503", now))
+
+	path := notificationsPath + "/deliveries"
+	req := operatorRequest(http.MethodGet, path, nil)
+	req.URL.RawQuery = "limit=20"
+	w := serve(router, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d (%s)", w.Code, w.Body.String())
+	}
+	var resp NotificationDeliveriesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.Deliveries) != 2 || resp.Deliveries[1].Status != "failed" || resp.Deliveries[1].Error == "" {
+		t.Errorf("got %+v", resp)
+	}
+}
+
+type recordingEmitter struct{ events []notify.OperatorEvent }
+
+func (e *recordingEmitter) Emit(event notify.OperatorEvent) { e.events = append(e.events, event) }
+
+func TestHandleGatewayStatus_BandwidthCapEvent(t *testing.T) {
+	for _, used := range []int{95, 50} {
+		sqlDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New: %v", err)
+		}
+		defer sqlDB.Close()
+
+		expectStatusGateway(mock)
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE gateways SET status`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO operator_metrics`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(`WHERE id = \$1`).WillReturnRows(operatorGatewayRows(make([]byte, 32), "op-1", 100))
+
+		events := &recordingEmitter{}
+		database := db.NewFromPool(sqlDB)
+		handler := &Handler{database: database, registry: gateway.NewRegistry(database), bandwidthWarn: 90}
+		handler.SetOperatorEvents(events)
+
+		w := serveGatewayStatus(t, handler, map[string]interface{}{
+			"gateway_id":          statusGatewayID,
+			"status":              "active",
+			"bandwidth_used_mbps": used,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d (%s)", w.Code, w.Body.String())
+		}
+
+		wantEvents := 0
+		if used >= 90 {
+			wantEvents = 1
+		}
+		if len(events.events) != wantEvents {
+			t.Errorf("%d Mbps of 100: emitted %d events, want %d", used, len(events.events), wantEvents)
+		}
+		if wantEvents == 1 && (events.events[0].Type != notify.EventBandwidthCap || events.events[0].OperatorID != "op-1") {
+			t.Errorf("event: got %+v", events.events[0])
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	}
+}
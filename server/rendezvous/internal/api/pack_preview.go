@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/attestation"
+	"rendezvous/internal/canary"
+	"rendezvous/internal/config"
+	"rendezvous/internal/gateway"
+	"rendezvous/internal/i18n"
+)
+
+var previewRegionPattern = regexp.MustCompile(`^[a-z0-9-]{1,20}$`)
+
+// previewIntegrityLevels are the device integrity verdicts a preview profile
+// may claim; empty means the device sent no attestation.
+var previewIntegrityLevels = map[string]struct{}{
+	"":                       {},
+	"MEETS_STRONG_INTEGRITY": {},
+	"MEETS_DEVICE_INTEGRITY": {},
+	"MEETS_BASIC_INTEGRITY":  {},
+}
+
+// PackPreviewRequest is a synthetic device profile to preview pack generation for
+type PackPreviewRequest struct {
+	DeviceID        string   `json:"device_id"` // Selects rollout cohorts; defaults to "preview"
+	Region          string   `json:"region" binding:"required"`
+	Country         string   `json:"country"` // ISO 3166-1 alpha-2; selects transport policies
+	Platform        string   `json:"platform" binding:"required" enum:"android,ios,desktop"`
+	Version         string   `json:"version"`                                    // Client version; checked against the platform's requirement
+	DeviceIntegrity string   `json:"device_integrity"`                           // Empty for an unattested device; legacy name integrity
+	Revoked         bool     `json:"revoked"`                                    // Attestation failed or was revoked
+	Bypass          bool     `json:"bypass"`                                     // Attestation bypass (development only)
+	Transports      []string `json:"transports" enum:"masque,xtls,parasite,ssh"` // Transports the client supports
+	PinnedKeyID     string   `json:"pinned_key_id"`                              // Signing key ID the client trusts
+	Locale          string   `json:"locale"`
+}
+
+// PackPreviewResponse is the pack the profile would receive and why
+type PackPreviewResponse struct {
+	Preview    bool                     `json:"preview"` // Always true: the pack was not issued
+	ConfigPack *config.SignedConfigPack `json:"config_pack"`
+	Trace      *config.DecisionTrace    `json:"trace"`
+}
+
+// PreviewConfigPack builds the pack a hypothetical device would receive, with
+// a trace of the policy decisions. Nothing is recorded: no metrics, no logs.
+func (h *Handler) PreviewConfigPack(c *gin.Context) {
+	var req PackPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.previewConfigPack(c, req, true)
+}
+
+// GetConfigPreview is PreviewConfigPack for a profile given in the query:
+// region (required), integrity, device_id, platform, country and locale.
+// With unsigned=true the pack is not signed.
+func (h *Handler) GetConfigPreview(c *gin.Context) {
+	req := PackPreviewRequest{
+		DeviceID:        c.Query("device_id"),
+		Region:          c.Query("region"),
+		Country:         c.Query("country"),
+		Platform:        c.Query("platform"),
+		DeviceIntegrity: c.Query("integrity"),
+		Locale:          c.Query("locale"),
+	}
+	h.previewConfigPack(c, req, c.Query("unsigned") != "true")
+}
+
+// previewConfigPack validates a preview profile and responds with the pack
+// it would receive, signed or not
+func (h *Handler) previewConfigPack(c *gin.Context, req PackPreviewRequest, signed bool) {
+	if !previewRegionPattern.MatchString(req.Region) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_region"})
+		return
+	}
+	if req.Country != "" {
+		country, ok := gateway.ParseCountry(req.Country)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_country"})
+			return
+		}
+		req.Country = country
+	}
+	if _, ok := allowedClientPlatforms[req.Platform]; req.Platform != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_platform"})
+		return
+	}
+	if req.Version != "" && !clientVersionPattern.MatchString(req.Version) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_client_version"})
+		return
+	}
+	if _, ok := previewIntegrityLevels[req.DeviceIntegrity]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_integrity"})
+		return
+	}
+	for _, transport := range req.Transports {
+		if _, ok := allowedTransportTypes[transport]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_transport_type"})
+			return
+		}
+	}
+	if req.PinnedKeyID != "" && !keyIDPattern.MatchString(req.PinnedKeyID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_key_id"})
+		return
+	}
+	if req.Locale != "" {
+		locale, err := i18n.ParseLocale(req.Locale)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_locale"})
+			return
+		}
+		req.Locale = locale
+	}
+	if req.DeviceID == "" {
+		req.DeviceID = "preview"
+	}
+
+	client := config.ClientInfo{Platform: req.Platform, Version: req.Version}
+	attestationResult := previewAttestation(req, h.honeypotPolicy())
+	var pack *config.SignedConfigPack
+	var trace *config.DecisionTrace
+	var err error
+	if signed {
+		pack, trace, err = h.configService.PreviewConfigPack(c.Request.Context(), req.DeviceID, req.Region, req.Country,
+			req.Locale, client, "", attestationResult)
+	} else {
+		pack, trace, err = h.configService.PreviewUnsignedConfigPack(c.Request.Context(), req.DeviceID, req.Region, req.Country,
+			req.Locale, client, attestationResult)
+	}
+	if err != nil {
+		respondError(c, err, "config_generation_failed")
+		return
+	}
+	traceClientCompatibility(trace, pack, req)
+
+	c.JSON(http.StatusOK, PackPreviewResponse{Preview: true, ConfigPack: pack, Trace: trace})
+}
+
+// PreviewProfile builds the pack a canary profile would receive, as the
+// preview endpoint would.
+func (h *Handler) PreviewProfile(ctx context.Context, profile canary.Profile) (*config.SignedConfigPack, error) {
+	attestationResult := previewAttestation(PackPreviewRequest{DeviceIntegrity: profile.Integrity, Revoked: profile.Revoked}, h.honeypotPolicy())
+	pack, _, err := h.configService.PreviewConfigPack(ctx, profile.DeviceID, profile.Region, "", "",
+		config.ClientInfo{Platform: profile.Platform}, "", attestationResult)
+	return pack, err
+}
+
+// previewAttestation maps a profile to the attestation result GetConfig would
+// pass to the pack builder. The honeypot policy decides as for a device with
+// no failed attempts.
+func previewAttestation(req PackPreviewRequest, policy attestation.HoneypotPolicy) *config.AttestationResult {
+	var result *attestation.AttestationResult
+	switch {
+	case req.Revoked:
+		result = &attestation.AttestationResult{IsValid: false}
+	case req.Bypass:
+		result = &attestation.AttestationResult{IsValid: true, DeviceIntegrity: "BYPASS_ENABLED"}
+	case req.DeviceIntegrity == "":
+		if policy.UnattestedHoneypots {
+			return nil
+		}
+		return &attestation.AttestationResult{Unattested: true}
+	default:
+		result = &attestation.AttestationResult{IsValid: true, DeviceIntegrity: req.DeviceIntegrity, Platform: req.Platform}
+	}
+	result.RiskScore = attestation.ScoreRisk(attestation.RiskSignals{Valid: result.IsValid, DeviceIntegrity: result.DeviceIntegrity})
+	result.Honeypots = policy.UseHoneypot(result, attestation.DeviceHistory{})
+	return result
+}
+
+// honeypotPolicy returns the attestation service's honeypot policy, or the
+// default one without a service
+func (h *Handler) honeypotPolicy() attestation.HoneypotPolicy {
+	if h.attestationService == nil {
+		return attestation.HoneypotPolicy{UnattestedHoneypots: true}
+	}
+	return h.attestationService.HoneypotPolicy()
+}
+
+// traceClientCompatibility records how the profile's client would treat the
+// pack: which gateways it can reach and whether it trusts the signing key.
+func traceClientCompatibility(trace *config.DecisionTrace, pack *config.SignedConfigPack, req PackPreviewRequest) {
+	if len(req.Transports) > 0 {
+		supported := make(map[string]bool, len(req.Transports))
+		for _, transport := range req.Transports {
+			supported[transport] = true
+		}
+		usable := 0
+		for _, gw := range pack.Gateways {
+			for _, transport := range gw.Transports {
+				if supported[transport] {
+					usable++
+					break
+				}
+			}
+		}
+		outcome := "usable"
+		if usable == 0 {
+			outcome = "no_usable_gateways"
+		}
+		trace.Record("client_transports", outcome, map[string]interface{}{
+			"usable_gateways": usable,
+			"gateways":        len(pack.Gateways),
+		})
+	}
+
+	if req.PinnedKeyID != "" {
+		keyID := config.KeyID(pack.PublicKey)
+		outcome := "match"
+		if keyID != req.PinnedKeyID {
+			outcome = "mismatch"
+		}
+		trace.Record("pinned_key", outcome, map[string]interface{}{
+			"pinned_key_id": req.PinnedKeyID,
+			"pack_key_id":   keyID,
+		})
+	}
+}
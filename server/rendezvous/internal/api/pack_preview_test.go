@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"rendezvous/internal/attestation"
+	"rendezvous/internal/config"
+	"rendezvous/internal/metrics"
+)
+
+func previewRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	configSvc, err := config.NewConfigService(mustTestDB(t))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := &Handler{configService: configSvc}
+	router := gin.New()
+	router.POST("/api/v1/admin/packs/preview", handler.PreviewConfigPack)
+	router.GET("/api/v1/admin/config/preview", handler.GetConfigPreview)
+	return router
+}
+
+func postPreview(router *gin.Engine, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/packs/preview", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestPreviewConfigPack(t *testing.T) {
+	router := previewRouter(t)
+	generated := metrics.ConfigPackGenerated.WithLabelValues("me-south-1")
+	before := testutil.ToFloat64(generated)
+
+	w := postPreview(router, `{
+		"region": "me-south-1",
+		"platform": "android",
+		"revoked": true,
+		"transports": ["masque"],
+		"pinned_key_id": "0000000000000000"
+	}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+
+	var resp PackPreviewResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.ConfigPack == nil || resp.Trace == nil {
+		t.Fatalf("expected pack and trace: %s", w.Body.String())
+	}
+
+	outcomes := map[string]string{}
+	for _, step := range resp.Trace.Steps {
+		outcomes[step.Policy] = step.Outcome
+	}
+	want := map[string]string{
+		"attestation_tier":  "invalid",
+		"honeypot":          "included",
+		"client_transports": "no_usable_gateways",
+		"pinned_key":        "mismatch",
+	}
+	for policy, outcome := range want {
+		if outcomes[policy] != outcome {
+			t.Errorf("%s: got %q, want %q (trace %+v)", policy, outcomes[policy], outcome, resp.Trace.Steps)
+		}
+	}
+
+	if got := testutil.ToFloat64(generated) - before; got != 0 {
+		t.Errorf("preview must not count as a generated pack, counter moved by %v", got)
+	}
+}
+
+func TestGetConfigPreview(t *testing.T) {
+	generated := metrics.ConfigPackGenerated.WithLabelValues("me-south-1")
+	before := testutil.ToFloat64(generated)
+	get := func(query string) (*httptest.ResponseRecorder, PackPreviewResponse) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		previewRouter(t).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/config/preview?"+query, nil))
+		var resp PackPreviewResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+		}
+		return w, resp
+	}
+
+	w, resp := get("region=me-south-1&integrity=MEETS_STRONG_INTEGRITY&device_id=device-1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	if !resp.Preview || resp.ConfigPack == nil || len(resp.ConfigPack.Signature) == 0 {
+		t.Errorf("signed preview: got %s", w.Body.String())
+	}
+	if resp.ConfigPack.Metadata["client_id"] != "device-1" {
+		t.Errorf("client_id: got %v", resp.ConfigPack.Metadata["client_id"])
+	}
+
+	// Unsigned previews never reach the signer
+	w, resp = get("region=me-south-1&integrity=MEETS_STRONG_INTEGRITY&unsigned=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("unsigned status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	pack := resp.ConfigPack
+	if !resp.Preview || pack == nil || pack.Signature != nil || pack.PublicKey != nil || pack.Version != "" {
+		t.Errorf("unsigned preview: got %s", w.Body.String())
+	}
+	if pack.ExpiresAt <= pack.IssuedAt {
+		t.Errorf("unsigned preview validity: issued %d, expires %d", pack.IssuedAt, pack.ExpiresAt)
+	}
+
+	for query, code := range map[string]string{
+		"integrity=MEETS_STRONG_INTEGRITY":   "invalid_region",
+		"region=me-south-1&integrity=STRONG": "invalid_integrity",
+		"region=me-south-1&platform=windows": "invalid_platform",
+	} {
+		if w, _ := get(query); w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte(code)) {
+			t.Errorf("%s: got %d %s, want 400 %s", query, w.Code, w.Body.String(), code)
+		}
+	}
+	if got := testutil.ToFloat64(generated) - before; got != 0 {
+		t.Errorf("preview must not count as a generated pack, counter moved by %v", got)
+	}
+}
+
+func TestPreviewConfigPack_InvalidProfile(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"missing region", `{"platform":"android"}`, "Region"},
+		{"bad platform", `{"region":"us-east-1","platform":"symbian"}`, "invalid_platform"},
+		{"bad integrity", `{"region":"us-east-1","platform":"android","integrity":"PERFECT"}`, "invalid_integrity"},
+		{"bad transport", `{"region":"us-east-1","platform":"android","transports":["carrier_pigeon"]}`, "invalid_transport_type"},
+		{"bad key id", `{"region":"us-east-1","platform":"ios","pinned_key_id":"XYZ"}`, "invalid_key_id"},
+		{"bad locale", `{"region":"us-east-1","platform":"ios","locale":"english"}`, "invalid_locale"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &Handler{}
+			router := gin.New()
+			router.POST("/api/v1/admin/packs/preview", handler.PreviewConfigPack)
+
+			w := postPreview(router, tt.body)
+			if w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte(tt.want)) {
+				t.Errorf("got %d %s, want 400 containing %q", w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviewAttestation(t *testing.T) {
+	policy := attestation.HoneypotPolicy{UnattestedHoneypots: true}
+	if previewAttestation(PackPreviewRequest{}, policy) != nil {
+		t.Error("no integrity: expected unattested")
+	}
+	if got := previewAttestation(PackPreviewRequest{DeviceIntegrity: "MEETS_STRONG_INTEGRITY", Revoked: true}, policy); got.IsValid || !got.Honeypots {
+		t.Error("revoked: expected invalid attestation given honeypots")
+	}
+	if got := previewAttestation(PackPreviewRequest{Bypass: true}, policy); !got.IsValid || got.DeviceIntegrity != "BYPASS_ENABLED" {
+		t.Errorf("bypass: got %+v", got)
+	}
+	if got := previewAttestation(PackPreviewRequest{DeviceIntegrity: "MEETS_DEVICE_INTEGRITY"}, policy); !got.IsValid || got.DeviceIntegrity != "MEETS_DEVICE_INTEGRITY" {
+		t.Errorf("device integrity: got %+v", got)
+	}
+	// The builder gets the attestation itself, not a copy of some fields
+	if got := previewAttestation(PackPreviewRequest{DeviceIntegrity: "MEETS_BASIC_INTEGRITY", Platform: "android"}, policy); got.Platform != "android" || got.RiskScore == 0 {
+		t.Errorf("platform and risk score: got %+v", got)
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+)
+
+// revocationsCacheControl keeps cached revocation lists short-lived, so a
+// revocation reaches clients within minutes
+const revocationsCacheControl = "public, max-age=60"
+
+// maxRevocationReasonLen bounds the reason stored with a revocation
+const maxRevocationReasonLen = 500
+
+// RevocationRequest revokes a pack or a signing key; exactly one of
+// pack_hash and key_id is set
+type RevocationRequest struct {
+	PackHash string `json:"pack_hash,omitempty"` // A pack's pack_hash
+	KeyID    string `json:"key_id,omitempty"`    // A signing key ID other than the current one
+	Reason   string `json:"reason"`
+}
+
+// RevocationResponse is a revocation as stored
+type RevocationResponse struct {
+	Generation int64     `json:"generation"` // The list generation it first appeared in
+	Kind       string    `json:"kind" enum:"pack,key"`
+	Value      string    `json:"value"`
+	Reason     string    `json:"reason"`
+	RevokedAt  time.Time `json:"revoked_at"`
+}
+
+// GetRevocations publishes the signed list of revoked packs and signing
+// keys. Responses are cacheable briefly and carry the generation and
+// signing key as their ETag.
+func (h *Handler) GetRevocations(c *gin.Context) {
+	list, err := h.configService.Revocations(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "revocations_unavailable")
+		return
+	}
+	etag := fmt.Sprintf(`"%d-%s"`, list.Generation, list.KeyID)
+	c.Header("Cache-Control", revocationsCacheControl)
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// CreateRevocation revokes a pack by its hash or a signing key by its ID.
+// Revoking one again returns the existing revocation.
+func (h *Handler) CreateRevocation(c *gin.Context) {
+	var req RevocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.PackHash == "") == (req.KeyID == "") || len(req.Reason) > maxRevocationReasonLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_revocation"})
+		return
+	}
+
+	var revocation *db.ConfigRevocation
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		var err error
+		action := AuditConfigPackRevoke
+		if req.PackHash != "" {
+			revocation, err = h.configService.RevokePack(ctx, req.PackHash, req.Reason)
+		} else {
+			action = AuditSigningKeyRevoke
+			revocation, err = h.configService.RevokeKey(ctx, req.KeyID, req.Reason)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: action, SubjectType: revocation.Kind, SubjectID: revocation.Value, Details: map[string]interface{}{
+			"reason":     revocation.Reason,
+			"generation": revocation.Generation,
+		}}, nil
+	})
+	if err != nil {
+		respondError(c, err, "revocation_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, RevocationResponse{
+		Generation: revocation.Generation,
+		Kind:       revocation.Kind,
+		Value:      revocation.Value,
+		Reason:     revocation.Reason,
+		RevokedAt:  revocation.RevokedAt,
+	})
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/config"
+)
+
+func TestGetRevocations(t *testing.T) {
+	configService, err := config.NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := &Handler{configService: configService}
+	router := gin.New()
+	router.GET("/api/v1/config/revocations", handler.GetRevocations)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/config/revocations", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d (%s)", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Cache-Control"); got != revocationsCacheControl {
+		t.Errorf("Cache-Control %q, want %q", got, revocationsCacheControl)
+	}
+	var list config.RevocationList
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	pack, err := configService.DeferredConfigPack("device-1", "us-east-1", "", config.PackVersion1, "", 60, "token")
+	if err != nil {
+		t.Fatalf("DeferredConfigPack: %v", err)
+	}
+	if !config.VerifyRevocationList(&list, pack.PublicKey) {
+		t.Error("revocation list must verify with the pack signing key")
+	}
+
+	// A client holding the current generation is told it has not changed
+	etag := w.Header().Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/config/revocations", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match %s: got %d %q, want 304", etag, w.Code, w.Body.String())
+	}
+}
+
+func TestCreateRevocation_Invalid(t *testing.T) {
+	configService, err := config.NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	pack, err := configService.DeferredConfigPack("device-1", "us-east-1", "", config.PackVersion1, "", 60, "token")
+	if err != nil {
+		t.Fatalf("DeferredConfigPack: %v", err)
+	}
+	handler := &Handler{configService: configService}
+	router := gin.New()
+	router.POST("/api/v1/admin/config/revocations", handler.CreateRevocation)
+
+	packHash := strings.Repeat("ab", 32)
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantErr  string
+	}{
+		{"neither", `{"reason":"leak"}`, http.StatusBadRequest, "invalid_revocation"},
+		{"both", `{"pack_hash":"` + packHash + `","key_id":"0123456789abcdef"}`, http.StatusBadRequest, "invalid_revocation"},
+		{"malformed hash", `{"pack_hash":"abc"}`, http.StatusBadRequest, "invalid_revocation"},
+		{"current key", `{"key_id":"` + pack.KeyID + `"}`, http.StatusConflict, "current_key_revoked"},
+		{"no database", `{"pack_hash":"` + packHash + `"}`, http.StatusServiceUnavailable, "revocations_unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/config/revocations", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("status: got %d, want %d (%s)", w.Code, tt.wantCode, w.Body.String())
+			}
+			var resp map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp["error"] != tt.wantErr {
+				t.Errorf("body: got %s, want error %s", w.Body.String(), tt.wantErr)
+			}
+		})
+	}
+}
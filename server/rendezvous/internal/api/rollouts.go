@@ -0,0 +1,262 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/cache"
+	"rendezvous/internal/db"
+	"rendezvous/internal/sanitize"
+)
+
+var (
+	rolloutKeyPattern    = regexp.MustCompile(`^[a-z0-9_.-]{1,100}$`)
+	rolloutRegionPattern = regexp.MustCompile(`^[a-z0-9-]{0,20}$`)
+)
+
+// RolloutRequest represents a request to create or update a rollout. It
+// sets either a fixed percentage or a schedule.
+type RolloutRequest struct {
+	Region      string                  `json:"region"` // Empty applies to every region
+	Percentage  *int                    `json:"percentage,omitempty"`
+	Schedule    *RolloutScheduleRequest `json:"schedule,omitempty"`
+	Description *string                 `json:"description,omitempty"` // Sanitized and cut to maxRolloutDescriptionLen bytes
+}
+
+// RolloutScheduleRequest ramps a rollout between two percentages. Before
+// starts_at the start percentage applies and after ends_at the end
+// percentage. The legacy names start_at and end_at are also accepted.
+type RolloutScheduleRequest struct {
+	StartsAt        time.Time `json:"starts_at" binding:"required"`
+	EndsAt          time.Time `json:"ends_at" binding:"required"`
+	StartPercentage *int      `json:"start_percentage" binding:"required"`
+	EndPercentage   *int      `json:"end_percentage" binding:"required"`
+	Easing          string    `json:"easing,omitempty" enum:"linear,ease_in,ease_out,ease_in_out"` // Defaults to linear
+}
+
+// maxRolloutDescriptionLen bounds a rollout's stored description
+const maxRolloutDescriptionLen = 1024
+
+// RolloutResponse represents a rollout in admin responses
+type RolloutResponse struct {
+	Key                 string                   `json:"key"`
+	Region              string                   `json:"region"`
+	Percentage          int                      `json:"percentage"`
+	EffectivePercentage int                      `json:"effective_percentage"` // The percentage served now
+	Schedule            *RolloutScheduleResponse `json:"schedule,omitempty"`
+	AbortedAt           *time.Time               `json:"aborted_at,omitempty"`
+	Description         *string                  `json:"description,omitempty"`
+	UpdatedAt           time.Time                `json:"updated_at"`
+}
+
+// ListRollouts lists config version and feature rollouts
+func (h *Handler) ListRollouts(c *gin.Context) {
+	rollouts, err := h.database.GetRollouts(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "rollout_fetch_failed")
+		return
+	}
+
+	now := h.now()
+	legacy := legacyFieldNames(c)
+	response := make([]RolloutResponse, 0, len(rollouts))
+	for _, rollout := range rollouts {
+		response = append(response, rolloutResponse(rollout, now, legacy))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rollouts": response})
+}
+
+// rolloutResponse converts a rollout; legacy adds the field names of
+// response version 1
+func rolloutResponse(rollout *db.Rollout, now time.Time, legacy bool) RolloutResponse {
+	response := RolloutResponse{
+		Key:                 rollout.Key,
+		Region:              rollout.Region,
+		Percentage:          rollout.Percentage,
+		EffectivePercentage: rollout.EffectivePercentage(now),
+		AbortedAt:           rollout.AbortedAt,
+		Description:         rollout.Description,
+		UpdatedAt:           rollout.UpdatedAt,
+	}
+	if s := rollout.Schedule; s != nil {
+		response.Schedule = scheduleResponse(*s, legacy)
+	}
+	return response
+}
+
+// RolloutScheduleResponse is a rollout schedule in admin responses
+type RolloutScheduleResponse struct {
+	StartsAt        time.Time  `json:"starts_at"`
+	EndsAt          time.Time  `json:"ends_at"`
+	StartPercentage int        `json:"start_percentage"`
+	EndPercentage   int        `json:"end_percentage"`
+	Easing          string     `json:"easing" enum:"linear,ease_in,ease_out,ease_in_out"`
+	StartAt         *time.Time `json:"start_at,omitempty"` // Deprecated: starts_at, sent in response version 1 only
+	EndAt           *time.Time `json:"end_at,omitempty"`   // Deprecated: ends_at, sent in response version 1 only
+}
+
+func scheduleResponse(s db.RolloutSchedule, legacy bool) *RolloutScheduleResponse {
+	return &RolloutScheduleResponse{
+		StartsAt:        s.StartAt,
+		EndsAt:          s.EndAt,
+		StartPercentage: s.StartPercentage,
+		EndPercentage:   s.EndPercentage,
+		Easing:          s.Easing,
+		StartAt:         legacyTime(legacy, s.StartAt),
+		EndAt:           legacyTime(legacy, s.EndAt),
+	}
+}
+
+// PutRollout creates or updates the rollout for a key (config version or
+// feature). A schedule replaces a fixed percentage and vice versa.
+func (h *Handler) PutRollout(c *gin.Context) {
+	key := c.Param("key")
+	if !rolloutKeyPattern.MatchString(key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_rollout_key"})
+		return
+	}
+
+	var req RolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !rolloutRegionPattern.MatchString(req.Region) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_region"})
+		return
+	}
+	if (req.Percentage == nil) == (req.Schedule == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "percentage_or_schedule_required"})
+		return
+	}
+	if req.Percentage != nil && !validPercentage(*req.Percentage) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_percentage"})
+		return
+	}
+	if req.Schedule != nil {
+		if code := validateRolloutSchedule(req.Schedule); code != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": code})
+			return
+		}
+	}
+
+	if req.Description != nil {
+		description := sanitize.Multiline(*req.Description, maxRolloutDescriptionLen)
+		req.Description = &description
+	}
+
+	details := map[string]interface{}{"region": req.Region}
+	if req.Description != nil {
+		details["description"] = *req.Description
+	}
+	response := gin.H{"key": key, "region": req.Region}
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		if req.Schedule != nil {
+			schedule := db.RolloutSchedule{
+				StartAt:         req.Schedule.StartsAt.UTC(),
+				EndAt:           req.Schedule.EndsAt.UTC(),
+				StartPercentage: *req.Schedule.StartPercentage,
+				EndPercentage:   *req.Schedule.EndPercentage,
+				Easing:          req.Schedule.Easing,
+			}
+			if err := h.database.ScheduleRollout(ctx, key, req.Region, schedule, req.Description); err != nil {
+				return nil, err
+			}
+			details["schedule"] = req.Schedule
+			response["schedule"] = scheduleResponse(schedule, legacyFieldNames(c))
+		} else {
+			if err := h.database.UpsertRollout(ctx, key, req.Region, *req.Percentage, req.Description); err != nil {
+				return nil, err
+			}
+			details["percentage"] = *req.Percentage
+			response["percentage"] = *req.Percentage
+		}
+		return &db.AuditRecord{Action: AuditRolloutPut, SubjectType: "rollout", SubjectID: key, Details: details}, nil
+	})
+	if err != nil {
+		respondError(c, err, "rollout_update_failed")
+		return
+	}
+	h.invalidateRollouts(c.Request.Context())
+
+	c.JSON(http.StatusOK, response)
+}
+
+func validPercentage(percentage int) bool {
+	return percentage >= 0 && percentage <= 100
+}
+
+// validateRolloutSchedule checks a schedule and defaults its easing. It
+// returns the error code for an invalid schedule.
+func validateRolloutSchedule(schedule *RolloutScheduleRequest) string {
+	if !validPercentage(*schedule.StartPercentage) || !validPercentage(*schedule.EndPercentage) {
+		return "invalid_percentage"
+	}
+	if !schedule.EndsAt.After(schedule.StartsAt) {
+		return "invalid_schedule_window"
+	}
+	switch schedule.Easing {
+	case "":
+		schedule.Easing = db.EasingLinear
+	case db.EasingLinear, db.EasingEaseIn, db.EasingEaseOut, db.EasingEaseInOut:
+	default:
+		return "invalid_easing"
+	}
+	return ""
+}
+
+// AbortRollout freezes a rollout at the percentage it has reached; ?region=
+// selects a regional override. The schedule is kept for reference but no
+// longer advances until the rollout is put again.
+func (h *Handler) AbortRollout(c *gin.Context) {
+	var rollout *db.Rollout
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		var err error
+		if rollout, err = h.database.AbortRollout(ctx, c.Param("key"), c.Query("region"), h.now().UTC()); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditRolloutAbort, SubjectType: "rollout", SubjectID: rollout.Key, Details: map[string]interface{}{
+			"region":     rollout.Region,
+			"percentage": rollout.Percentage,
+		}}, nil
+	})
+	if err != nil {
+		respondError(c, err, "rollout_abort_failed")
+		return
+	}
+	h.invalidateRollouts(c.Request.Context())
+
+	c.JSON(http.StatusOK, rolloutResponse(rollout, h.now(), legacyFieldNames(c)))
+}
+
+// DeleteRollout removes the rollout for a key; ?region= selects a regional override
+func (h *Handler) DeleteRollout(c *gin.Context) {
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		if err := h.database.DeleteRollout(ctx, c.Param("key"), c.Query("region")); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditRolloutDelete, SubjectType: "rollout", SubjectID: c.Param("key"),
+			Details: map[string]interface{}{"region": c.Query("region")}}, nil
+	})
+	if err != nil {
+		respondError(c, err, "rollout_delete_failed")
+		return
+	}
+	h.invalidateRollouts(c.Request.Context())
+
+	c.Status(http.StatusNoContent)
+}
+
+// invalidateRollouts propagates a rollout change to every replica's policy
+// cache. The write has already committed, so a failed publish is logged
+// rather than reported; other replicas then pick the change up after the TTL.
+func (h *Handler) invalidateRollouts(ctx context.Context) {
+	if err := h.database.InvalidatePolicy(ctx, cache.TableRollouts); err != nil {
+		log.Printf("rollout cache invalidation failed: %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/cache"
+	"rendezvous/internal/db"
+)
+
+func TestPutRollout(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO rollouts`).
+		WithArgs("scan_interval_120", "me-south-1", 25, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.PUT("/api/v1/admin/rollouts/:key", handler.PutRollout)
+
+	body := []byte(`{"region":"me-south-1","percentage":25}`)
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/rollouts/scan_interval_120", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPutRollout_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		body string
+	}{
+		{"percentage over 100", "scan_interval_120", `{"percentage":150}`},
+		{"missing percentage", "scan_interval_120", `{"region":"us-east-1"}`},
+		{"bad key", "Scan%20Interval", `{"percentage":10}`},
+		{"bad region", "scan_interval_120", `{"region":"US East","percentage":10}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &Handler{}
+			router := gin.New()
+			router.PUT("/api/v1/admin/rollouts/:key", handler.PutRollout)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/rollouts/"+tt.key, bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status: got %d, want 400", w.Code)
+			}
+		})
+	}
+}
+
+func TestPutRollout_InvalidatesOtherReplicas(t *testing.T) {
+	bus := cache.NewLocalBus()
+	newReplica := func() (*db.Database, sqlmock.Sqlmock) {
+		sqlDB, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("sqlmock.New: %v", err)
+		}
+		t.Cleanup(func() { sqlDB.Close() })
+		policy, err := cache.NewPolicyCache(time.Hour, bus.Invalidator())
+		if err != nil {
+			t.Fatalf("NewPolicyCache: %v", err)
+		}
+		database := db.NewFromPool(sqlDB)
+		database.SetPolicyCache(policy)
+		return database, mock
+	}
+	rolloutRows := func(percentage int) *sqlmock.Rows {
+		now := time.Now()
+		return sqlmock.NewRows([]string{"key", "region", "percentage", "description", "created_at", "updated_at",
+			"schedule_start_at", "schedule_end_at", "schedule_start_percentage", "schedule_end_percentage",
+			"schedule_easing", "aborted_at"}).
+			AddRow("scan_interval_120", "", percentage, nil, now, now, nil, nil, nil, nil, nil, nil)
+	}
+
+	replicaA, mockA := newReplica()
+	replicaB, mockB := newReplica()
+	ctx := context.Background()
+
+	// Replica B serves a request and caches the rollouts table
+	mockB.ExpectQuery(`SELECT key, region, percentage`).WillReturnRows(rolloutRows(10))
+	if rollouts, err := replicaB.GetRollouts(ctx); err != nil || rollouts[0].Percentage != 10 {
+		t.Fatalf("GetRollouts: %v %v", rollouts, err)
+	}
+	if rollouts, _ := replicaB.GetRollouts(ctx); rollouts[0].Percentage != 10 {
+		t.Fatal("second read should be served from cache")
+	}
+
+	// An admin raises the rollout through replica A
+	mockA.ExpectBegin()
+	mockA.ExpectExec(`INSERT INTO rollouts`).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAuditAppend(mockA)
+	mockA.ExpectCommit()
+	handler := &Handler{database: replicaA}
+	router := gin.New()
+	router.PUT("/api/v1/admin/rollouts/:key", handler.PutRollout)
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/rollouts/scan_interval_120",
+		bytes.NewReader([]byte(`{"percentage":50}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+
+	// Replica B's next request reads through to the database
+	mockB.ExpectQuery(`SELECT key, region, percentage`).WillReturnRows(rolloutRows(50))
+	rollouts, err := replicaB.GetRollouts(ctx)
+	if err != nil || rollouts[0].Percentage != 50 {
+		t.Errorf("GetRollouts after mutation: got %v %v, want 50%%", rollouts, err)
+	}
+	if err := mockA.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if err := mockB.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPutRollout_SanitizesDescription(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO rollouts`).
+		WithArgs("scan_interval_120", "", 10, "Stage 1\nDTV clients only").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.PUT("/api/v1/admin/rollouts/:key", handler.PutRollout)
+
+	body := []byte(`{"percentage":10,"description":"\u001b[1mStage 1\u001b[0m\r\nDTV clients\u0000 only"}`)
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/rollouts/scan_interval_120", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPutRollout_Schedule(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO rollouts`).
+		WithArgs("scan_interval_120", "", 5, nil, start, start.Add(72*time.Hour), 50, "linear").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.PUT("/api/v1/admin/rollouts/:key", handler.PutRollout)
+
+	body := []byte(`{"schedule":{"start_at":"2026-03-01T02:00:00+02:00","end_at":"2026-03-04T00:00:00Z","start_percentage":5,"end_percentage":50}}`)
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/rollouts/scan_interval_120", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPutRollout_InvalidSchedule(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"percentage and schedule", `{"percentage":10,"schedule":{"start_at":"2026-03-01T00:00:00Z","end_at":"2026-03-02T00:00:00Z","start_percentage":0,"end_percentage":10}}`, "percentage_or_schedule_required"},
+		{"end before start", `{"schedule":{"start_at":"2026-03-02T00:00:00Z","end_at":"2026-03-01T00:00:00Z","start_percentage":0,"end_percentage":10}}`, "invalid_schedule_window"},
+		{"end percentage over 100", `{"schedule":{"start_at":"2026-03-01T00:00:00Z","end_at":"2026-03-02T00:00:00Z","start_percentage":0,"end_percentage":110}}`, "invalid_percentage"},
+		{"unknown easing", `{"schedule":{"start_at":"2026-03-01T00:00:00Z","end_at":"2026-03-02T00:00:00Z","start_percentage":0,"end_percentage":10,"easing":"bounce"}}`, "invalid_easing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &Handler{}
+			router := gin.New()
+			router.PUT("/api/v1/admin/rollouts/:key", handler.PutRollout)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/rollouts/scan_interval_120", bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status: got %d, want 400", w.Code)
+			}
+			var resp map[string]interface{}
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp["error"] != tt.want {
+				t.Errorf("error: got %v, want %s", resp["error"], tt.want)
+			}
+		})
+	}
+}
+
+func TestAbortRollout(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// Halfway through a linear ramp from 0% to 60%
+	now := time.Now()
+	start, end := now.Add(-time.Hour), now.Add(time.Hour)
+	columns := []string{"key", "region", "percentage", "description", "created_at", "updated_at",
+		"schedule_start_at", "schedule_end_at", "schedule_start_percentage", "schedule_end_percentage",
+		"schedule_easing", "aborted_at"}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT (.+) FROM rollouts WHERE key = \$1 AND region = \$2 FOR UPDATE`).
+		WithArgs("scan_interval_120", "eu-west-1").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("scan_interval_120", "eu-west-1", 0, nil, start, start, start, end, 0, 60, "linear", nil))
+	mock.ExpectExec(`UPDATE rollouts SET percentage = \$3, aborted_at = \$4`).
+		WithArgs("scan_interval_120", "eu-west-1", 30, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.POST("/api/v1/admin/rollouts/:key/abort", handler.AbortRollout)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/rollouts/scan_interval_120/abort?region=eu-west-1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	var resp RolloutResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.Percentage != 30 || resp.EffectivePercentage != 30 || resp.AbortedAt == nil || resp.Schedule == nil {
+		t.Errorf("got %+v, want the rollout frozen at 30%%", resp)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAbortRollout_NotFound(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM rollouts`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	router := gin.New()
+	router.POST("/api/v1/admin/rollouts/:key/abort", handler.AbortRollout)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/admin/rollouts/unknown/abort", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status: got %d, want 404 (%s)", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
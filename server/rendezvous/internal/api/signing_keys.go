@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+)
+
+// RotateSigningKey replaces the config signing key with a new one. Packs
+// signed with the replaced key keep verifying until its grace period ends;
+// clients should pin the new public key before then.
+func (h *Handler) RotateSigningKey(c *gin.Context) {
+	var rotation *config.KeyRotation
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		var err error
+		if rotation, err = h.configService.RotateKey(ctx); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditSigningKeyRotate, SubjectType: "signing_key", SubjectID: rotation.KeyID, Details: map[string]interface{}{
+			"previous_key_id":     rotation.PreviousKeyID,
+			"previous_expires_at": rotation.PreviousExpiresAt,
+		}}, nil
+	})
+	if err != nil {
+		respondError(c, err, "signing_key_rotation_failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, rotation)
+}
+
+// signingKeysCacheControl lets clients and proxies reuse the signing key
+// history for a day, well within the default seven-day grace period of a
+// rotated-out key
+const signingKeysCacheControl = "public, max-age=86400"
+
+// GetSigningKeys publishes the current and previous config signing keys,
+// each rotated-in key endorsed by the key it replaced, so clients can move
+// their pinned key forward without trusting the key in a pack.
+func (h *Handler) GetSigningKeys(c *gin.Context) {
+	c.Header("Cache-Control", signingKeysCacheControl)
+	c.JSON(http.StatusOK, h.configService.SigningKeyHistory())
+}
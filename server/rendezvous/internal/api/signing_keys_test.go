@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/config"
+)
+
+func TestRotateSigningKey_WithoutDataKey(t *testing.T) {
+	t.Setenv("LUMENLINK_DATA_KEY", "")
+	configService, err := config.NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := &Handler{configService: configService}
+	router := gin.New()
+	router.POST("/api/v1/admin/signing-keys/rotate", handler.RotateSigningKey)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/admin/signing-keys/rotate", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status: got %d, want 503 (%s)", w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); body != `{"error":"signing_keys_unavailable"}` {
+		t.Errorf("body: got %s", body)
+	}
+}
+
+func TestGetSigningKeys(t *testing.T) {
+	configService, err := config.NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	handler := &Handler{configService: configService}
+	router := gin.New()
+	router.GET("/api/v1/config/signing-keys", handler.GetSigningKeys)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/config/signing-keys", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d (%s)", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Cache-Control"); got != signingKeysCacheControl {
+		t.Errorf("Cache-Control %q, want %q", got, signingKeysCacheControl)
+	}
+	var history config.SigningKeyHistory
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	// A client pinning the key packs are signed with finds it current
+	pack, err := configService.DeferredConfigPack("device-1", "us-east-1", "", config.PackVersion1, "", 60, "token")
+	if err != nil {
+		t.Fatalf("DeferredConfigPack: %v", err)
+	}
+	current, ok := config.VerifySigningKeyChain(&history, pack.PublicKey)
+	if !ok || history.CurrentKeyID != pack.KeyID || !config.VerifyPack(pack, current) {
+		t.Errorf("history %+v does not lead to the pack key %s", history, pack.KeyID)
+	}
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+)
+
+// statsCacheControl lets browsers and proxies reuse public stats for a
+// minute; the JSON stats endpoint and the status page share it.
+const statsCacheControl = "public, max-age=60"
+
+//go:embed templates/status.html
+var templateFS embed.FS
+
+var statusTemplate = template.Must(template.New("status.html").Funcs(template.FuncMap{
+	"percent": func(rate float64) string { return fmt.Sprintf("%.1f%%", rate*100) },
+}).ParseFS(templateFS, "templates/status.html"))
+
+// StatusPage configures the HTML status page for deployments without the
+// frontend
+type StatusPage struct {
+	Enabled     bool
+	Maintenance string // Shown as a maintenance notice while set
+}
+
+// statusPageData is everything the status page renders. It holds aggregates
+// only, so nothing identifying a client or a gateway can reach the page.
+type statusPageData struct {
+	Version     string
+	Maintenance string
+	Draining    bool
+	Regions     []regionGateways
+	Channels    []db.DiscoveryChannelStats
+	Attempts    int64
+	SuccessRate float64
+	GeneratedAt time.Time
+}
+
+// regionGateways counts one region's online gateways
+type regionGateways struct {
+	Region   string
+	Active   int
+	Degraded int
+}
+
+// SetStatusPage configures GET /status; it is disabled until set.
+func (h *Handler) SetStatusPage(page StatusPage) {
+	h.statusPage = page
+}
+
+// GetStatusPage renders a read-only HTML page with gateway counts per region,
+// 24h discovery success, the service version and maintenance state.
+func (h *Handler) GetStatusPage(c *gin.Context) {
+	if !h.statusPage.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		return
+	}
+	if h.database == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database_unavailable"})
+		return
+	}
+
+	data, err := h.statusPageData(c.Request.Context(), h.now().UTC())
+	if err != nil {
+		respondError(c, err, "status_fetch_failed")
+		return
+	}
+	var page bytes.Buffer
+	if err := statusTemplate.Execute(&page, data); err != nil {
+		respondError(c, err, "status_render_failed")
+		return
+	}
+	c.Header("Cache-Control", statsCacheControl)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// statusPageData gathers the page's aggregates from the same queries as the
+// community endpoints. Honeypots are not counted.
+func (h *Handler) statusPageData(ctx context.Context, now time.Time) (*statusPageData, error) {
+	gateways, err := h.database.GetAllGateways(ctx)
+	if err != nil {
+		return nil, err
+	}
+	channels, err := h.database.GetDiscoveryStats(ctx, now.Add(-24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	data := &statusPageData{
+		Version:     serviceVersion(),
+		Maintenance: h.statusPage.Maintenance,
+		Draining:    h.drain.Draining(),
+		Channels:    channels,
+		GeneratedAt: now,
+	}
+	regions := map[string]*regionGateways{}
+	for _, gw := range gateways {
+		if gw.IsHoneypot {
+			continue
+		}
+		region, ok := regions[gw.Region]
+		if !ok {
+			region = &regionGateways{Region: gw.Region}
+			regions[gw.Region] = region
+		}
+		if gw.Status == "degraded" {
+			region.Degraded++
+		} else {
+			region.Active++
+		}
+	}
+	for _, region := range regions {
+		data.Regions = append(data.Regions, *region)
+	}
+	sort.Slice(data.Regions, func(i, j int) bool { return data.Regions[i].Region < data.Regions[j].Region })
+
+	var successes int64
+	for _, channel := range channels {
+		data.Attempts += channel.Attempts
+		successes += channel.Successes
+	}
+	if data.Attempts > 0 {
+		data.SuccessRate = float64(successes) / float64(data.Attempts)
+	}
+	return data, nil
+}
+
+// serviceVersion reports the VCS revision the binary was built from
+func serviceVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version, modified := info.Main.Version, false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			version = setting.Value
+			if len(version) > 12 {
+				version = version[:12]
+			}
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if version == "" || version == "(devel)" {
+		return "development"
+	}
+	if modified {
+		version += "-modified"
+	}
+	return version
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+)
+
+const (
+	statusHoneypotID = "7d1e6b2a-4c3f-4e8a-9b0d-1a2b3c4d5e6f"
+	statusOperatorID = "operator-7741"
+	statusGatewayIP  = "198.51.100.23"
+	statusHoneypotIP = "203.0.113.99"
+)
+
+func statusGatewayRows() *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows([]string{
+		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
+		"created_at", "last_seen", "updated_at",
+	}).
+		AddRow(testGatewayID, []byte("gateway-public-key"), statusGatewayIP, 443, "{masque}", "{}",
+			"eu-west-1", 100, 42, 200, "active", false, statusOperatorID, "approved", 64500, now, now, now).
+		AddRow("0b9e8d7c-6a5f-4e3d-8c2b-1a0f9e8d7c6b", []byte("other-public-key"), "198.51.100.24", 443, "{xtls}", "{}",
+			"eu-west-1", 100, 7, 200, "degraded", false, statusOperatorID, "approved", 64500, now, now, now).
+		AddRow(statusHoneypotID, []byte("honeypot-public-key"), statusHoneypotIP, 443, "{masque}", "{}",
+			"me-south-1", nil, 0, nil, "active", true, nil, "approved", nil, now, now, now)
+}
+
+func statusRouter(t *testing.T, page StatusPage) (*gin.Engine, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	handler := &Handler{database: db.NewFromPool(sqlDB)}
+	handler.SetStatusPage(page)
+	router := gin.New()
+	router.GET("/status", handler.GetStatusPage)
+	return router, mock
+}
+
+func TestGetStatusPage(t *testing.T) {
+	router, mock := statusRouter(t, StatusPage{Enabled: true, Maintenance: "Database upgrade <b>tonight</b>"})
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(statusGatewayRows())
+	mock.ExpectQuery(`FROM discovery_logs`).
+		WillReturnRows(sqlmock.NewRows([]string{"channel_type", "count", "successes"}).
+			AddRow("dtv", 40, 30).
+			AddRow("gps", 60, 45))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d (%s)", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/html") {
+		t.Errorf("Content-Type %q", got)
+	}
+	if got := w.Header().Get("Cache-Control"); got != statsCacheControl {
+		t.Errorf("Cache-Control %q, want %q", got, statsCacheControl)
+	}
+
+	html := w.Body.String()
+	for _, want := range []string{
+		"<td>eu-west-1</td><td class=\"n\">1</td><td class=\"n\">1</td>",
+		"<td>gps</td><td class=\"n\">60</td><td class=\"n\">75.0%</td>",
+		"<th class=\"n\">100</th><th class=\"n\">75.0%</th>",
+		"Database upgrade &lt;b&gt;tonight&lt;/b&gt;",
+		"Version ",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("page is missing %q", want)
+		}
+	}
+	for _, secret := range []string{
+		testGatewayID, statusHoneypotID, statusOperatorID, statusGatewayIP, statusHoneypotIP,
+		"gateway-public-key", "64500", "me-south-1", "honeypot", "<script",
+	} {
+		if strings.Contains(strings.ToLower(html), strings.ToLower(secret)) {
+			t.Errorf("page exposes %q", secret)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetStatusPage_Disabled(t *testing.T) {
+	router, _ := statusRouter(t, StatusPage{})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status %d, want 404", w.Code)
+	}
+}
+
+func TestStatusTemplate_Empty(t *testing.T) {
+	var page bytes.Buffer
+	data := &statusPageData{Version: "development", Draining: true, GeneratedAt: time.Now()}
+	if err := statusTemplate.Execute(&page, data); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	for _, want := range []string{"This server is restarting.", "No gateways are online.", "No discovery attempts were reported."} {
+		if !strings.Contains(page.String(), want) {
+			t.Errorf("page is missing %q", want)
+		}
+	}
+}
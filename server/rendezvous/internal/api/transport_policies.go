@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/cache"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+)
+
+// TransportPolicyRequest sets the action for one transport in one country
+type TransportPolicyRequest struct {
+	Action string `json:"action" binding:"required" enum:"allow,deny,prefer"`
+}
+
+// TransportPolicyResponse is a transport policy in admin responses
+type TransportPolicyResponse struct {
+	Country   string    `json:"country"`
+	Transport string    `json:"transport"`
+	Action    string    `json:"action"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TransportPolicyListResponse lists every transport policy
+type TransportPolicyListResponse struct {
+	Policies []TransportPolicyResponse `json:"policies"`
+}
+
+func transportPolicyResponse(p *db.TransportPolicy) TransportPolicyResponse {
+	return TransportPolicyResponse{
+		Country:   p.Country,
+		Transport: p.Transport,
+		Action:    p.Action,
+		UpdatedAt: p.UpdatedAt,
+	}
+}
+
+// ListTransportPolicies returns every country transport policy
+func (h *Handler) ListTransportPolicies(c *gin.Context) {
+	policies, err := h.database.GetTransportPolicies(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "transport_policy_fetch_failed")
+		return
+	}
+	response := TransportPolicyListResponse{Policies: make([]TransportPolicyResponse, len(policies))}
+	for i, p := range policies {
+		response.Policies[i] = transportPolicyResponse(p)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// PutTransportPolicy allows, denies or prefers a transport for clients in a
+// country. It applies from the clients' next config request.
+func (h *Handler) PutTransportPolicy(c *gin.Context) {
+	country, transport, ok := transportPolicyParams(c)
+	if !ok {
+		return
+	}
+	var req TransportPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch req.Action {
+	case config.TransportAllow, config.TransportDeny, config.TransportPrefer:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_action"})
+		return
+	}
+
+	var policy *db.TransportPolicy
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		var err error
+		if policy, err = h.database.UpsertTransportPolicy(ctx, country, transport, req.Action); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditTransportPolicyPut, SubjectType: "transport_policy", SubjectID: country + "/" + transport,
+			Details: map[string]interface{}{"action": req.Action}}, nil
+	})
+	if err != nil {
+		respondError(c, err, "transport_policy_update_failed")
+		return
+	}
+	h.invalidateTransportPolicies(c)
+
+	c.JSON(http.StatusOK, transportPolicyResponse(policy))
+}
+
+// DeleteTransportPolicy removes a country's policy for a transport
+func (h *Handler) DeleteTransportPolicy(c *gin.Context) {
+	country, transport, ok := transportPolicyParams(c)
+	if !ok {
+		return
+	}
+	err := h.audited(c, func(ctx context.Context) (*db.AuditRecord, error) {
+		if err := h.database.DeleteTransportPolicy(ctx, country, transport); err != nil {
+			return nil, err
+		}
+		return &db.AuditRecord{Action: AuditTransportPolicyDelete, SubjectType: "transport_policy", SubjectID: country + "/" + transport}, nil
+	})
+	if err != nil {
+		respondError(c, err, "transport_policy_delete_failed")
+		return
+	}
+	h.invalidateTransportPolicies(c)
+
+	c.Status(http.StatusNoContent)
+}
+
+// transportPolicyParams validates the :country and :transport path
+// parameters, responding 400 when either is invalid.
+func transportPolicyParams(c *gin.Context) (string, string, bool) {
+	country, ok := gateway.ParseCountry(c.Param("country"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_country"})
+		return "", "", false
+	}
+	transport := c.Param("transport")
+	if _, ok := allowedTransportTypes[transport]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_transport_type"})
+		return "", "", false
+	}
+	return country, transport, true
+}
+
+// invalidateTransportPolicies propagates a policy change to every replica.
+// The write has already committed, so a failed publish is only logged.
+func (h *Handler) invalidateTransportPolicies(c *gin.Context) {
+	if err := h.database.InvalidatePolicy(c.Request.Context(), cache.TableTransportPolicies); err != nil {
+		log.Printf("transport policy cache invalidation failed: %v", err)
+	}
+}
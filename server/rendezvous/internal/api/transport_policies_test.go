@@ -0,0 +1,108 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+)
+
+func transportPolicyRouter(database *db.Database) *gin.Engine {
+	handler := &Handler{database: database}
+	router := gin.New()
+	router.GET("/api/v1/admin/transport-policies", handler.ListTransportPolicies)
+	router.PUT("/api/v1/admin/transport-policies/:country/:transport", handler.PutTransportPolicy)
+	router.DELETE("/api/v1/admin/transport-policies/:country/:transport", handler.DeleteTransportPolicy)
+	return router
+}
+
+func TestPutTransportPolicy(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	updatedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO transport_policies`).WithArgs("IR", "xtls", "deny").
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(updatedAt))
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+	router := transportPolicyRouter(db.NewFromPool(sqlDB))
+
+	put := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, tt := range []struct{ path, body, want string }{
+		{"/api/v1/admin/transport-policies/Iran/xtls", `{"action":"deny"}`, "invalid_country"},
+		{"/api/v1/admin/transport-policies/IR/wireguard", `{"action":"deny"}`, "invalid_transport_type"},
+		{"/api/v1/admin/transport-policies/IR/xtls", `{"action":"block"}`, "invalid_action"},
+	} {
+		if w := put(tt.path, tt.body); w.Code != http.StatusBadRequest || !bytes.Contains(w.Body.Bytes(), []byte(tt.want)) {
+			t.Errorf("PUT %s %s: got %d %s, want 400 %s", tt.path, tt.body, w.Code, w.Body.String(), tt.want)
+		}
+	}
+
+	w := put("/api/v1/admin/transport-policies/ir/xtls", `{"action":"deny"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	if want := `{"country":"IR","transport":"xtls","action":"deny","updated_at":"2026-03-01T12:00:00Z"}`; w.Body.String() != want {
+		t.Errorf("body: got %s, want %s", w.Body.String(), want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListAndDeleteTransportPolicies(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	updatedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM transport_policies`).WillReturnRows(
+		sqlmock.NewRows([]string{"country", "transport", "action", "updated_at"}).
+			AddRow("IR", "ssh", "prefer", updatedAt).
+			AddRow("IR", "xtls", "deny", updatedAt))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM transport_policies`).WithArgs("IR", "xtls").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAuditAppend(mock)
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM transport_policies`).WithArgs("IR", "xtls").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	router := transportPolicyRouter(db.NewFromPool(sqlDB))
+
+	w := serve(router, httptest.NewRequest(http.MethodGet, "/api/v1/admin/transport-policies", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("list status: got %d, want 200", w.Code)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`{"country":"IR","transport":"ssh","action":"prefer"`)) {
+		t.Errorf("list body: %s", w.Body.String())
+	}
+
+	if w := serve(router, httptest.NewRequest(http.MethodDelete, "/api/v1/admin/transport-policies/IR/xtls", nil)); w.Code != http.StatusNoContent {
+		t.Errorf("delete status: got %d, want 204", w.Code)
+	}
+	w = serve(router, httptest.NewRequest(http.MethodDelete, "/api/v1/admin/transport-policies/IR/xtls", nil))
+	if w.Code != http.StatusNotFound || w.Body.String() != `{"error":"transport_policy_not_found"}` {
+		t.Errorf("second delete: got %d %s, want 404 transport_policy_not_found", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
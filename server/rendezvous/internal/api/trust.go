@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/db"
+	"rendezvous/internal/issuance"
+	"rendezvous/internal/trust"
+)
+
+// maxDeviceIDLen is the longest device ID with trust state
+const maxDeviceIDLen = 255
+
+// SetTrust attaches the progressive trust tracker; without one a device's
+// tier follows its attestation alone. The tracker keeps state per device, so
+// it stays off when the persistence policy does not allow tracking devices.
+func (h *Handler) SetTrust(tracker *trust.Tracker) {
+	if tracker != nil && !h.database.PersistencePolicy().TrackDevices() {
+		log.Println("Data minimization: progressive device trust is disabled")
+		return
+	}
+	h.trust = tracker
+}
+
+// onProbation records an attestation result with the trust tracker and
+// reports whether the device is still limited. A device whose state cannot
+// be read or updated is treated as limited.
+func (h *Handler) onProbation(ctx context.Context, deviceID string, valid bool) bool {
+	if h.trust == nil || deviceID == "" || len(deviceID) > maxDeviceIDLen {
+		return false
+	}
+	tier, err := h.trust.ObserveAttestation(ctx, deviceID, valid)
+	if err != nil {
+		log.Printf("device trust update failed, treating device as limited: %v", err)
+		return true
+	}
+	return tier != db.DeviceTierTrusted
+}
+
+// stillOnProbation reports whether a device is limited, as onProbation does,
+// without recording an attestation; for results reused from an earlier one
+func (h *Handler) stillOnProbation(ctx context.Context, deviceID string) bool {
+	if h.trust == nil || deviceID == "" || len(deviceID) > maxDeviceIDLen {
+		return false
+	}
+	tier, err := h.trust.Tier(ctx, deviceID)
+	if err != nil {
+		log.Printf("device trust read failed, treating device as limited: %v", err)
+		return true
+	}
+	return tier != db.DeviceTierTrusted
+}
+
+// observeDiscovery reports a stored discovery log to the trust tracker:
+// contacting a honeypot demotes the device, and a successful connection
+// counts towards its promotion. Only logs sent with the device's valid
+// attestation session count; otherwise anyone could promote a device ID
+// with made-up connections or demote another device's.
+func (h *Handler) observeDiscovery(ctx context.Context, req *DiscoveryLogRequest, entry db.DiscoveryLogEntry, result db.DiscoveryLogResult) {
+	deviceID := req.DeviceID
+	if h.trust == nil || deviceID == "" || len(deviceID) > maxDeviceIDLen || result.Duplicate {
+		return
+	}
+	if h.sessionAttestation(deviceID, req.AttestationSession) == nil {
+		return
+	}
+	var err error
+	switch {
+	case result.IsHoneypot:
+		err = h.trust.Demote(ctx, deviceID, trust.ReasonHoneypotContact)
+	case entry.Success:
+		err = h.trust.ObserveConnection(ctx, deviceID)
+	}
+	if err != nil {
+		log.Printf("device trust update failed: %v", err)
+	}
+}
+
+// AdminDeviceResponse is a device's progressive trust state
+type AdminDeviceResponse struct {
+	DeviceID              string     `json:"device_id"`
+	Tier                  string     `json:"tier" enum:"limited,trusted"`
+	FirstSeenAt           time.Time  `json:"first_seen_at"`
+	ProbationStartedAt    time.Time  `json:"probation_started_at"`
+	ValidAttestations     int        `json:"valid_attestations"`     // Since probation started
+	SuccessfulConnections int        `json:"successful_connections"` // Since probation started
+	TierChangedAt         *time.Time `json:"tier_changed_at,omitempty"`
+	LastAnomaly           *string    `json:"last_anomaly,omitempty"`
+	LastAnomalyAt         *time.Time `json:"last_anomaly_at,omitempty"`
+
+	// RecentIssuances are the last packs issued to the device, newest
+	// first, when the issuance log is enabled
+	RecentIssuances []issuance.Record `json:"recent_issuances,omitempty"`
+}
+
+// adminDeviceIssuances is how many issued packs the admin device lookup lists
+const adminDeviceIssuances = 20
+
+// GetAdminDevice returns a device's current trust tier and the signals
+// behind it, with the packs it was last issued. Devices are not tracked
+// under data minimization.
+func (h *Handler) GetAdminDevice(c *gin.Context) {
+	if h.trust == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device_trust_disabled"})
+		return
+	}
+	deviceID := c.Param("id")
+	if len(deviceID) > maxDeviceIDLen {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device_not_found"})
+		return
+	}
+	state, err := h.database.GetDeviceTrust(c.Request.Context(), deviceID)
+	if err != nil {
+		respondError(c, err, "device_fetch_failed")
+		return
+	}
+	var issuances []issuance.Record
+	if h.issuanceLog != nil {
+		issuances, err = h.issuanceLog.DeviceIssuances(c.Request.Context(), deviceID, adminDeviceIssuances)
+		if err != nil {
+			respondError(c, err, "device_issuances_fetch_failed")
+			return
+		}
+	}
+	c.JSON(http.StatusOK, AdminDeviceResponse{
+		DeviceID:              state.DeviceID,
+		Tier:                  state.Tier,
+		FirstSeenAt:           state.FirstSeenAt,
+		ProbationStartedAt:    state.ProbationStartedAt,
+		ValidAttestations:     state.ValidAttestations,
+		SuccessfulConnections: state.SuccessfulConnections,
+		TierChangedAt:         state.TierChangedAt,
+		LastAnomaly:           state.LastAnomaly,
+		LastAnomalyAt:         state.LastAnomalyAt,
+		RecentIssuances:       issuances,
+	})
+}
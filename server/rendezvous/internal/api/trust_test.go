@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"rendezvous/internal/attestation"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+	"rendezvous/internal/issuance"
+	"rendezvous/internal/metrics"
+	"rendezvous/internal/privacy"
+	"rendezvous/internal/trust"
+)
+
+const testDeviceID = "device-7f3a"
+
+func trustRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock, *Handler) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	database := db.NewFromPool(sqlDB)
+	handler := &Handler{database: database, attestationService: attestation.NewAttestationService(database)}
+	handler.SetTrust(trust.NewTracker(database, trust.LoadPolicyFromEnv()))
+	router := gin.New()
+	router.POST("/api/v1/discovery/log", handler.HandleDiscoveryLog)
+	router.GET("/api/v1/admin/devices/:id", handler.GetAdminDevice)
+	return router, mock, handler
+}
+
+// trustSession issues testDeviceID an attestation session from handler's
+// attestation service
+func trustSession(t *testing.T, handler *Handler) string {
+	t.Helper()
+	token, _, ok := handler.attestationService.IssueSession(&attestation.AttestationResult{
+		IsValid: true, Platform: "android", DeviceID: testDeviceID, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY",
+	})
+	if !ok {
+		t.Fatal("no session issued")
+	}
+	return token
+}
+
+func TestSetTrust_DisabledUnderDataMinimization(t *testing.T) {
+	database := mustTestDB(t)
+	database.SetPersistencePolicy(privacy.NewPolicy(true))
+	minimized := &Handler{database: database}
+	minimized.SetTrust(trust.NewTracker(database, trust.LoadPolicyFromEnv()))
+	if minimized.trust != nil {
+		t.Fatal("progressive trust enabled under data minimization; it keeps state per device")
+	}
+	minimized.SetIssuanceLog(issuance.NewLog(issuance.NewPostgresSink(database), nil, 0))
+	if minimized.issuanceLog != nil {
+		t.Fatal("issuance log enabled under data minimization; it keeps state per device")
+	}
+	// Without a tracker, tiers follow attestation alone and nothing is stored
+	if minimized.onProbation(context.Background(), testDeviceID, true) {
+		t.Error("device put on probation without a tracker")
+	}
+
+	router := gin.New()
+	router.GET("/api/v1/admin/devices/:id", minimized.GetAdminDevice)
+	w := serve(router, httptest.NewRequest(http.MethodGet, "/api/v1/admin/devices/"+testDeviceID, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("device lookup: got %d, want 404: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleDiscoveryLog_HoneypotContactDemotesDevice(t *testing.T) {
+	router, mock, handler := trustRouter(t)
+	demotions := metrics.DeviceTrustTransitions.WithLabelValues("demoted", trust.ReasonHoneypotContact)
+	before := testutil.ToFloat64(demotions)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO discovery_logs`).WillReturnRows(sqlmock.NewRows([]string{"is_honeypot"}).AddRow(true))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT tier FROM device_trust`).WithArgs(testDeviceID).
+		WillReturnRows(sqlmock.NewRows([]string{"tier"}).AddRow(db.DeviceTierTrusted))
+	mock.ExpectExec(`INSERT INTO device_trust`).WithArgs(testDeviceID, trust.ReasonHoneypotContact, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin().WillReturnError(context.Canceled) // audit append; logged and counted
+
+	w := postJSON(t, router, "/api/v1/discovery/log", DiscoveryLogRequest{
+		ChannelType: "dtv",
+		GatewayID:   testGatewayID,
+		DeviceID:    testDeviceID,
+		Success:     true,
+
+		AttestationSession: trustSession(t, handler),
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	if got := testutil.ToFloat64(demotions) - before; got != 1 {
+		t.Errorf("demotions counted: %v, want 1", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandleDiscoveryLog_SuccessCountsConnection(t *testing.T) {
+	router, mock, handler := trustRouter(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO discovery_logs`).WillReturnRows(sqlmock.NewRows([]string{"is_honeypot"}).AddRow(false))
+	mock.ExpectCommit()
+	now := time.Now()
+	mock.ExpectQuery(`INSERT INTO device_trust`).WithArgs(testDeviceID).WillReturnRows(sqlmock.NewRows([]string{
+		"device_id", "tier", "first_seen_at", "probation_started_at", "valid_attestations",
+		"successful_connections", "tier_changed_at", "last_anomaly", "last_anomaly_at",
+	}).AddRow(testDeviceID, db.DeviceTierLimited, now, now, 1, 1, nil, nil, nil))
+
+	w := postJSON(t, router, "/api/v1/discovery/log", DiscoveryLogRequest{
+		ChannelType: "dtv",
+		GatewayID:   testGatewayID,
+		DeviceID:    testDeviceID,
+		Success:     true,
+
+		AttestationSession: trustSession(t, handler),
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandleDiscoveryLog_WithoutSessionNotCounted(t *testing.T) {
+	router, mock, handler := trustRouter(t)
+	other, _, _ := handler.attestationService.IssueSession(&attestation.AttestationResult{
+		IsValid: true, Platform: "android", DeviceID: "device-other", DeviceIntegrity: "MEETS_DEVICE_INTEGRITY",
+	})
+
+	// Neither a honeypot contact nor a success touches the device's trust
+	// without its own session
+	for _, session := range []string{"", "not-a-session", other} {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO discovery_logs`).WillReturnRows(sqlmock.NewRows([]string{"is_honeypot"}).AddRow(true))
+		mock.ExpectCommit()
+		w := postJSON(t, router, "/api/v1/discovery/log", DiscoveryLogRequest{
+			ChannelType: "dtv",
+			GatewayID:   testGatewayID,
+			DeviceID:    testDeviceID,
+			Success:     true,
+
+			AttestationSession: session,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("session %q: got %d: %s", session, w.Code, w.Body.String())
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetAdminDevice(t *testing.T) {
+	router, mock, _ := trustRouter(t)
+	changed := time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+	started := changed.Add(-8 * 24 * time.Hour)
+	columns := []string{
+		"device_id", "tier", "first_seen_at", "probation_started_at", "valid_attestations",
+		"successful_connections", "tier_changed_at", "last_anomaly", "last_anomaly_at",
+	}
+	mock.ExpectQuery(`FROM device_trust WHERE device_id`).WithArgs(testDeviceID).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(testDeviceID, db.DeviceTierTrusted, started, started, 6, 4, changed, nil, nil))
+	mock.ExpectQuery(`FROM device_trust WHERE device_id`).WithArgs("unknown-device").
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	w := serve(router, httptest.NewRequest(http.MethodGet, "/api/v1/admin/devices/"+testDeviceID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var resp AdminDeviceResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.Tier != db.DeviceTierTrusted || resp.ValidAttestations != 6 || resp.TierChangedAt == nil || !resp.TierChangedAt.Equal(changed) {
+		t.Errorf("response: %+v", resp)
+	}
+
+	w = serve(router, httptest.NewRequest(http.MethodGet, "/api/v1/admin/devices/unknown-device", nil))
+	if w.Code != http.StatusNotFound || !json.Valid(w.Body.Bytes()) {
+		t.Errorf("unknown device: got %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetAdminDevice_RecentIssuances(t *testing.T) {
+	router, mock, handler := trustRouter(t)
+	sink, err := issuance.NewFileSink(filepath.Join(t.TempDir(), "issuances.jsonl"))
+	if err != nil {
+		t.Fatalf("NewFileSink: %v", err)
+	}
+	issuances := issuance.NewLog(sink, nil, 0)
+	handler.SetIssuanceLog(issuances)
+	handler.logIssuance(testDeviceID, "us-east-1", &config.SignedConfigPack{Gateways: []config.GatewayInfo{{ID: "gw-1"}, {ID: "hp-1", IsHoneypot: true}}})
+	if err := issuances.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	started := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM device_trust WHERE device_id`).WithArgs(testDeviceID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"device_id", "tier", "first_seen_at", "probation_started_at", "valid_attestations",
+			"successful_connections", "tier_changed_at", "last_anomaly", "last_anomaly_at",
+		}).AddRow(testDeviceID, db.DeviceTierLimited, started, started, 1, 0, nil, nil, nil))
+
+	w := serve(router, httptest.NewRequest(http.MethodGet, "/api/v1/admin/devices/"+testDeviceID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var resp AdminDeviceResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.RecentIssuances) != 1 {
+		t.Fatalf("recent issuances = %+v, want 1", resp.RecentIssuances)
+	}
+	got := resp.RecentIssuances[0]
+	if got.Region != "us-east-1" || got.PackHash == "" || len(got.GatewayIDs) != 2 {
+		t.Errorf("issuance = %+v", got)
+	}
+}
@@ -0,0 +1,76 @@
+// Package apperr defines the kinds of error shared by the db and service
+// layers, so that the API can answer with the right status for any error
+// without knowing which package returned it.
+package apperr
+
+import "errors"
+
+// Error kinds. Check them with errors.Is; specific errors of each kind are
+// created with New and may be wrapped with fmt.Errorf %w for context.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrUnavailable  = errors.New("unavailable")
+	ErrInvalidInput = errors.New("invalid input")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrRateLimited  = errors.New("rate limited")
+)
+
+// Error is a specific error of one kind, carrying the code reported to clients.
+type Error struct {
+	Kind    error  // One of the error kinds above
+	Code    string // snake_case code for API responses
+	Message string
+}
+
+// New creates an error of the given kind.
+func New(kind error, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is the error's kind, so that errors.Is matches
+// both the specific error and its kind.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Code returns the client code of the first Error in err's chain, or "" if
+// there is none.
+func Code(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+// WithKind marks err as being of kind while keeping it in the chain, for
+// errors from outside the service layers such as driver errors.
+func WithKind(kind, err error) error {
+	if err == nil || errors.Is(err, kind) {
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// kindError is an error marked with a kind by WithKind.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,52 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var errWidgetNotFound = New(ErrNotFound, "widget_not_found", "widget not found")
+
+func TestError_IsThroughWrapping(t *testing.T) {
+	err := fmt.Errorf("failed to load dashboard: %w", fmt.Errorf("widget 7: %w", errWidgetNotFound))
+
+	if !errors.Is(err, errWidgetNotFound) {
+		t.Error("errors.Is does not match the specific error")
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("errors.Is does not match the error's kind")
+	}
+	for _, kind := range []error{ErrConflict, ErrUnavailable, ErrInvalidInput, ErrUnauthorized, ErrRateLimited} {
+		if errors.Is(err, kind) {
+			t.Errorf("errors.Is matches unrelated kind %v", kind)
+		}
+	}
+	if got := Code(err); got != "widget_not_found" {
+		t.Errorf("Code: got %q, want widget_not_found", got)
+	}
+	if got := err.Error(); got != "failed to load dashboard: widget 7: widget not found" {
+		t.Errorf("Error: got %q", got)
+	}
+}
+
+func TestWithKind(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("failed to query widgets: %w", WithKind(ErrUnavailable, cause))
+
+	if !errors.Is(err, ErrUnavailable) {
+		t.Error("errors.Is does not match the added kind")
+	}
+	if !errors.Is(err, cause) {
+		t.Error("errors.Is does not match the original error")
+	}
+	if got := Code(err); got != "" {
+		t.Errorf("Code: got %q, want none", got)
+	}
+	if got := err.Error(); got != "failed to query widgets: connection refused" {
+		t.Errorf("Error: got %q", got)
+	}
+	if WithKind(ErrUnavailable, nil) != nil {
+		t.Error("WithKind(nil) is not nil")
+	}
+}
@@ -0,0 +1,87 @@
+package attestation
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/store"
+)
+
+// ErrTooManyChallenges is returned for a challenge requested by a device or
+// address already holding its limit
+var ErrTooManyChallenges = apperr.New(apperr.ErrRateLimited, "too_many_challenges", "too many attestation challenges outstanding")
+
+// ChallengeLimits cap the challenges a device or client address can hold.
+// Each can be issued its limit at once, then more about as quickly as the
+// earlier ones expire, so however often a client asks it stores only a few
+// challenges per challenge TTL.
+type ChallengeLimits struct {
+	PerDevice int // Challenges bound to one device; 0 disables
+	PerIP     int // Challenges requested from one address; 0 disables
+}
+
+// LoadChallengeLimitsFromEnv reads LUMENLINK_ATTEST_CHALLENGE_MAX_PER_DEVICE
+// (default 5) and LUMENLINK_ATTEST_CHALLENGE_MAX_PER_IP (default 30).
+func LoadChallengeLimitsFromEnv() ChallengeLimits {
+	return ChallengeLimits{
+		PerDevice: envInt("LUMENLINK_ATTEST_CHALLENGE_MAX_PER_DEVICE", 5, 0),
+		PerIP:     envInt("LUMENLINK_ATTEST_CHALLENGE_MAX_PER_IP", 30, 0),
+	}
+}
+
+// WithChallengeLimits replaces the challenge limits read from the
+// environment
+func WithChallengeLimits(limits ChallengeLimits) Option {
+	return func(s *AttestationService) {
+		s.challengeLimits = limits
+	}
+}
+
+// SetChallengeRates counts the challenges issued to each device and address
+// in rateLimits; without it challenges are not limited.
+func (s *AttestationService) SetChallengeRates(rateLimits store.RateLimitStore) {
+	s.challengeRates = rateLimits
+}
+
+// allowChallenge counts a challenge requested for deviceID from clientIP and
+// returns ErrTooManyChallenges if either is over its limit. When the rate
+// store is unreachable challenges are issued rather than failing with it.
+func (s *AttestationService) allowChallenge(ctx context.Context, deviceID, clientIP string) error {
+	if s.challengeRates == nil {
+		return nil
+	}
+	checks := []struct {
+		key   string
+		limit int
+	}{
+		{"attest_challenge:ip:" + clientIP, s.challengeLimits.PerIP},
+		{"attest_challenge:device:" + deviceID, s.challengeLimits.PerDevice},
+	}
+	if clientIP == "" {
+		checks[0].limit = 0
+	}
+	for _, check := range checks {
+		if check.limit == 0 {
+			continue
+		}
+		allowed, err := s.challengeRates.Allow(ctx, check.key, challengeLimit(check.limit, s.challengeTTL))
+		if err != nil {
+			log.Printf("challenge rate store unavailable, issuing challenge: %v", err)
+			return nil
+		}
+		if !allowed {
+			return ErrTooManyChallenges
+		}
+	}
+	return nil
+}
+
+// challengeLimit is the rate letting a client hold n challenges living ttl:
+// n at once, refilled at n per ttl. Rates are whole requests per minute, so
+// the refill is rounded up to at least one a minute.
+func challengeLimit(n int, ttl time.Duration) store.Limit {
+	perMinute := (int64(n)*int64(time.Minute) + int64(ttl) - 1) / int64(ttl)
+	return store.Limit{PerMinute: int(max(perMinute, 1)), Burst: n}
+}
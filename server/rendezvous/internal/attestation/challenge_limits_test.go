@@ -0,0 +1,89 @@
+package attestation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/store"
+)
+
+func TestGenerateChallenge_Limits(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	memory := store.NewMemory()
+	memory.SetClock(fake)
+	svc := NewAttestationService(nil, WithChallengeLimits(ChallengeLimits{PerDevice: 2, PerIP: 3}))
+	svc.challengeTTL = 5 * time.Minute
+	svc.SetChallenges(memory)
+	svc.SetChallengeRates(memory)
+	generate := func(deviceID, clientIP string) error {
+		_, err := svc.GenerateChallenge(ctx, deviceID, clientIP)
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := generate("device-1", "198.51.100.1"); err != nil {
+			t.Fatalf("challenge %d: %v", i+1, err)
+		}
+	}
+	if err := generate("device-1", "198.51.100.2"); !errors.Is(err, ErrTooManyChallenges) {
+		t.Errorf("device over its limit: got %v", err)
+	}
+	// The address's third challenge goes to another device; its fourth is
+	// refused whichever device asks
+	if err := generate("device-2", "198.51.100.1"); err != nil {
+		t.Errorf("address within its limit: %v", err)
+	}
+	if err := generate("device-3", "198.51.100.1"); !errors.Is(err, ErrTooManyChallenges) {
+		t.Errorf("address over its limit: got %v", err)
+	}
+	if err := generate("device-3", "198.51.100.3"); err != nil {
+		t.Errorf("device refused at another address: %v", err)
+	}
+
+	// As challenges expire the device can be issued more
+	fake.Advance(5 * time.Minute)
+	if err := generate("device-1", "198.51.100.4"); err != nil {
+		t.Errorf("after the TTL: %v", err)
+	}
+
+	// Without a rate store nothing is limited
+	svc.SetChallengeRates(nil)
+	for i := 0; i < 5; i++ {
+		if err := generate("device-1", "198.51.100.1"); err != nil {
+			t.Fatalf("unlimited challenge %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestChallengeLimit(t *testing.T) {
+	tests := []struct {
+		n    int
+		ttl  time.Duration
+		want store.Limit
+	}{
+		{5, 5 * time.Minute, store.Limit{PerMinute: 1, Burst: 5}},
+		{5, 30 * time.Second, store.Limit{PerMinute: 10, Burst: 5}},
+		{3, 2 * time.Minute, store.Limit{PerMinute: 2, Burst: 3}},
+		{1, time.Hour, store.Limit{PerMinute: 1, Burst: 1}},
+	}
+	for _, tt := range tests {
+		if got := challengeLimit(tt.n, tt.ttl); got != tt.want {
+			t.Errorf("challengeLimit(%d, %s): got %+v, want %+v", tt.n, tt.ttl, got, tt.want)
+		}
+	}
+}
+
+func TestLoadChallengeLimitsFromEnv(t *testing.T) {
+	if limits := LoadChallengeLimitsFromEnv(); limits != (ChallengeLimits{PerDevice: 5, PerIP: 30}) {
+		t.Errorf("defaults: got %+v", limits)
+	}
+	t.Setenv("LUMENLINK_ATTEST_CHALLENGE_MAX_PER_DEVICE", "0")
+	t.Setenv("LUMENLINK_ATTEST_CHALLENGE_MAX_PER_IP", "100")
+	if limits := LoadChallengeLimitsFromEnv(); limits != (ChallengeLimits{PerDevice: 0, PerIP: 100}) {
+		t.Errorf("configured: got %+v", limits)
+	}
+}
@@ -0,0 +1,70 @@
+package attestation
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+// Cleanup periodically deletes attestation records older than the
+// retention window. Every verification stores a record, so without it the
+// table grows forever.
+type Cleanup struct {
+	db        *db.Database
+	retention time.Duration
+	clock     clock.Clock
+}
+
+// NewCleanup creates a cleanup that keeps attestations for
+// LUMENLINK_ATTESTATION_RETENTION (default 30 days).
+func NewCleanup(database *db.Database) *Cleanup {
+	retention := 30 * 24 * time.Hour
+	if r, err := time.ParseDuration(strings.TrimSpace(os.Getenv("LUMENLINK_ATTESTATION_RETENTION"))); err == nil && r > 0 {
+		retention = r
+	}
+	return &Cleanup{db: database, retention: retention, clock: clock.Real{}}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (c *Cleanup) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// Run deletes attestations older than the retention window once and returns
+// how many it deleted
+func (c *Cleanup) Run(ctx context.Context, now time.Time) (int64, error) {
+	deleted, err := c.db.DeleteAttestationsBefore(ctx, now.Add(-c.retention))
+	if err != nil {
+		return deleted, err
+	}
+	metrics.AttestationsDeleted.Observe(float64(deleted))
+	return deleted, nil
+}
+
+// Start cleans up attestations every interval until ctx is cancelled.
+func (c *Cleanup) Start(ctx context.Context, interval time.Duration) {
+	ticker := c.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			deleted, err := c.Run(ctx, c.clock.Now())
+			if err != nil {
+				log.Printf("attestation cleanup failed after deleting %d records: %v", deleted, err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("attestation cleanup deleted %d records", deleted)
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package attestation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	dto "github.com/prometheus/client_model/go"
+
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+func TestCleanup_DeletesBeforeRetentionWindow(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	cleanup := NewCleanup(db.NewFromPool(sqlDB))
+	cleanup.retention = 7 * 24 * time.Hour
+	mock.ExpectExec(`DELETE FROM attestations`).WithArgs(now.Add(-7*24*time.Hour), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	observed := func() (uint64, float64) {
+		var m dto.Metric
+		if err := metrics.AttestationsDeleted.Write(&m); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+	}
+	runs, rows := observed()
+	deleted, err := cleanup.Run(context.Background(), now)
+	if err != nil || deleted != 3 {
+		t.Fatalf("Run: got %d, %v; want 3", deleted, err)
+	}
+	if gotRuns, gotRows := observed(); gotRuns != runs+1 || gotRows != rows+3 {
+		t.Errorf("deleted rows metric: got %d runs and %v rows, want one more run of 3", gotRuns-runs, gotRows-rows)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,48 @@
+package attestation
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// loadClientIPKey returns the key client addresses are hashed with before
+// they are stored with attestations, or nil unless
+// LUMENLINK_ATTESTATION_ANONYMIZE_IP is set. The key is
+// LUMENLINK_ATTESTATION_IP_HASH_SECRET, which every replica must share for
+// the hashes to match; without it a random key is generated, and addresses
+// only match within this process.
+func loadClientIPKey() []byte {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("LUMENLINK_ATTESTATION_ANONYMIZE_IP"))) {
+	case "1", "true", "yes":
+	default:
+		return nil
+	}
+	if secret := os.Getenv("LUMENLINK_ATTESTATION_IP_HASH_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	log.Printf("LUMENLINK_ATTESTATION_IP_HASH_SECRET is not set; client addresses are hashed with a per-process key")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("attestation: failed to generate client address key: %v", err))
+	}
+	return key
+}
+
+// storedClientIP returns the client address stored with an attestation: as
+// seen, or a keyed hash of it when addresses are anonymized. The hash still
+// matches attempts from the same address, which is what correlating probes
+// needs, but cannot be reversed by hashing every address.
+func (s *AttestationService) storedClientIP(ip string) string {
+	if ip == "" || s.clientIPKey == nil {
+		return ip
+	}
+	mac := hmac.New(sha256.New, s.clientIPKey)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
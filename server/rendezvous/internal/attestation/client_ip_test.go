@@ -0,0 +1,59 @@
+package attestation
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"rendezvous/internal/db"
+)
+
+func TestStoreAttestation_ClientOrigin(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	database := db.NewFromPool(sqlDB)
+	req := &AttestationRequest{Platform: "ios", DeviceID: "device-1", Token: "token", ClientIP: "203.0.113.7", ClientRegion: "ap-east-1"}
+	failed := &AttestationResult{IsValid: false, Reason: "unknown_key", RiskScore: 1}
+	expectStored := func(clientIP string) {
+		mock.ExpectExec(`INSERT INTO attestations`).
+			WithArgs("device-1", "ios", "token", false, nil, "", nil, "unknown_key", "", 1.0, clientIP, "ap-east-1", false).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	// By default the address is stored as seen
+	expectStored("203.0.113.7")
+	if err := NewAttestationService(database).storeAttestation(context.Background(), req, failed); err != nil {
+		t.Fatalf("storeAttestation: %v", err)
+	}
+
+	// Anonymized, it is replaced by its keyed hash
+	t.Setenv("LUMENLINK_ATTESTATION_ANONYMIZE_IP", "true")
+	t.Setenv("LUMENLINK_ATTESTATION_IP_HASH_SECRET", "secret")
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("203.0.113.7"))
+	expectStored(hex.EncodeToString(mac.Sum(nil)[:16]))
+	if err := NewAttestationService(database).storeAttestation(context.Background(), req, failed); err != nil {
+		t.Fatalf("storeAttestation anonymized: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// Without a shared secret the address is still hashed, with a key of
+	// this process's own
+	t.Setenv("LUMENLINK_ATTESTATION_IP_HASH_SECRET", "")
+	svc := NewAttestationService(database)
+	if stored := svc.storedClientIP("203.0.113.7"); stored == "203.0.113.7" || len(stored) != 32 || stored != svc.storedClientIP("203.0.113.7") {
+		t.Errorf("per-process key: got %q", stored)
+	}
+	if stored := svc.storedClientIP(""); stored != "" {
+		t.Errorf("no address: got %q", stored)
+	}
+}
@@ -0,0 +1,174 @@
+package attestation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+	"rendezvous/internal/notify"
+)
+
+// maxFailureChecks bounds the failure counts looked up at once; while a
+// probing campaign fails faster than they complete, further checks are
+// skipped and a later failure checks again
+const maxFailureChecks = 8
+
+// FailureAlerter notifies operations when a device fails attestation
+// repeatedly, which usually means an active probing campaign. Failures are
+// counted from the stored attestations, so the count covers every replica;
+// each replica alerts a device at most once per window.
+type FailureAlerter struct {
+	db        *db.Database
+	notifier  notify.Notifier
+	threshold int
+	window    time.Duration
+	clock     clock.Clock
+	checks    chan struct{} // Holds a slot per running check
+
+	mu      sync.Mutex
+	alerted map[string]time.Time // When each device was last alerted
+
+	wg sync.WaitGroup
+}
+
+// NewFailureAlerter creates an alerter that notifies when a device has
+// threshold failed attestations within window
+func NewFailureAlerter(database *db.Database, notifier notify.Notifier, threshold int, window time.Duration) *FailureAlerter {
+	return &FailureAlerter{
+		db:        database,
+		notifier:  notifier,
+		threshold: threshold,
+		window:    window,
+		clock:     clock.Real{},
+		checks:    make(chan struct{}, maxFailureChecks),
+		alerted:   map[string]time.Time{},
+	}
+}
+
+// LoadFailureAlerterFromEnv creates an alerter posting to
+// LUMENLINK_ATTESTATION_ALERT_WEBHOOK_URL, or LUMENLINK_NOTIFY_WEBHOOK_URL
+// when it is unset, for devices with
+// LUMENLINK_ATTESTATION_FAILURE_ALERT_THRESHOLD (default 10) failures within
+// LUMENLINK_ATTESTATION_FAILURE_ALERT_WINDOW (default 1h). It returns nil,
+// disabling the alerts, without a webhook or with a threshold of 0.
+func LoadFailureAlerterFromEnv(database *db.Database) *FailureAlerter {
+	url := strings.TrimSpace(os.Getenv("LUMENLINK_ATTESTATION_ALERT_WEBHOOK_URL"))
+	if url == "" {
+		url = strings.TrimSpace(os.Getenv("LUMENLINK_NOTIFY_WEBHOOK_URL"))
+	}
+	threshold := envInt("LUMENLINK_ATTESTATION_FAILURE_ALERT_THRESHOLD", 10, 0)
+	if url == "" || threshold == 0 {
+		return nil
+	}
+	window := time.Hour
+	if w, err := time.ParseDuration(strings.TrimSpace(os.Getenv("LUMENLINK_ATTESTATION_FAILURE_ALERT_WINDOW"))); err == nil && w > 0 {
+		window = w
+	}
+	return NewFailureAlerter(database, notify.NewWebhook(url), threshold, window)
+}
+
+// WithFailureAlerter replaces the failure alerter read from the environment;
+// nil disables the alerts
+func WithFailureAlerter(alerter *FailureAlerter) Option {
+	return func(s *AttestationService) {
+		s.failureAlerts = alerter
+	}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (a *FailureAlerter) SetClock(c clock.Clock) {
+	a.clock = c
+}
+
+// RecordFailure checks, in the background, whether a device's stored
+// failures have reached the threshold and notifies if so. It never blocks:
+// a device alerted within the window is not checked again, and a check is
+// skipped while too many are running. A nil alerter does nothing.
+func (a *FailureAlerter) RecordFailure(deviceID, platform, reason string) {
+	if a == nil || deviceID == "" || a.recentlyAlerted(deviceID) {
+		return
+	}
+	select {
+	case a.checks <- struct{}{}:
+	default:
+		return
+	}
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		defer func() { <-a.checks }()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		a.check(ctx, deviceID, platform, reason)
+	}()
+}
+
+func (a *FailureAlerter) check(ctx context.Context, deviceID, platform, reason string) {
+	now := a.clock.Now()
+	failures, err := a.db.CountAttestationFailuresSince(ctx, deviceID, now.Add(-a.window))
+	if err != nil {
+		log.Printf("attestation failure count failed for device=%s: %v", deviceID, err)
+		return
+	}
+	if failures < a.threshold || !a.markAlerted(deviceID, now) {
+		return
+	}
+
+	alert := notify.Alert{
+		Kind:    "attestation_failures",
+		Key:     deviceID,
+		Message: fmt.Sprintf("device %s failed attestation %d times within %s", deviceID, failures, a.window),
+		Details: map[string]interface{}{
+			"device_id":   deviceID,
+			"platform":    platform,
+			"last_reason": reason,
+			"count":       failures,
+			"threshold":   a.threshold,
+			"window":      a.window.String(),
+		},
+		FiredAt: now,
+	}
+	if err := a.notifier.Notify(ctx, alert); err != nil {
+		metrics.AttestationFailureAlerts.WithLabelValues("failed").Inc()
+		log.Printf("attestation failure alert for device=%s failed: %v", deviceID, err)
+		return
+	}
+	metrics.AttestationFailureAlerts.WithLabelValues("delivered").Inc()
+}
+
+func (a *FailureAlerter) recentlyAlerted(deviceID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	last, ok := a.alerted[deviceID]
+	return ok && a.clock.Now().Sub(last) < a.window
+}
+
+// markAlerted records that a device is being alerted at now, and reports
+// false if another check alerted it within the window. Devices alerted
+// before the window are forgotten.
+func (a *FailureAlerter) markAlerted(deviceID string, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if last, ok := a.alerted[deviceID]; ok && now.Sub(last) < a.window {
+		return false
+	}
+	for device, last := range a.alerted {
+		if now.Sub(last) >= a.window {
+			delete(a.alerted, device)
+		}
+	}
+	a.alerted[deviceID] = now
+	return true
+}
+
+// wait blocks until the running checks are done; it is intended for tests.
+func (a *FailureAlerter) wait() {
+	a.wg.Wait()
+}
@@ -0,0 +1,166 @@
+package attestation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+	"rendezvous/internal/notify"
+)
+
+type recordingNotifier struct {
+	alerts chan notify.Alert
+	err    error
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, alert notify.Alert) error {
+	n.alerts <- alert
+	return n.err
+}
+
+func TestFailureAlerter_AlertsOncePerWindow(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	notifier := &recordingNotifier{alerts: make(chan notify.Alert, 10)}
+	alerter := NewFailureAlerter(db.NewFromPool(sqlDB), notifier, 10, time.Hour)
+	alerter.SetClock(fake)
+	failures := func(since time.Time, n int) {
+		mock.ExpectQuery(`NOT verified AND created_at >= \$2`).WithArgs("device-1", since).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(n))
+	}
+	delivered := metrics.AttestationFailureAlerts.WithLabelValues("delivered")
+	failed := metrics.AttestationFailureAlerts.WithLabelValues("failed")
+	beforeDelivered, beforeFailed := testutil.ToFloat64(delivered), testutil.ToFloat64(failed)
+
+	// Below the threshold nothing is sent
+	failures(now.Add(-time.Hour), 9)
+	alerter.RecordFailure("device-1", "android", "device_integrity_failed")
+	alerter.wait()
+	if len(notifier.alerts) != 0 {
+		t.Fatal("alert sent below the threshold")
+	}
+
+	failures(now.Add(-time.Hour), 10)
+	alerter.RecordFailure("device-1", "android", "request_hash_mismatch")
+	alerter.wait()
+	select {
+	case alert := <-notifier.alerts:
+		if alert.Kind != "attestation_failures" || alert.Key != "device-1" || alert.Details["count"] != 10 ||
+			alert.Details["platform"] != "android" || alert.Details["last_reason"] != "request_hash_mismatch" || !alert.FiredAt.Equal(now) {
+			t.Errorf("alert: got %+v", alert)
+		}
+	default:
+		t.Fatal("no alert at the threshold")
+	}
+	if testutil.ToFloat64(delivered)-beforeDelivered != 1 {
+		t.Error("delivered alert not counted")
+	}
+
+	// Further failures within the window are not even counted again
+	fake.Advance(59 * time.Minute)
+	alerter.RecordFailure("device-1", "android", "request_hash_mismatch")
+	alerter.wait()
+	if len(notifier.alerts) != 0 {
+		t.Error("device alerted twice within the window")
+	}
+
+	// After the window the device alerts again; a failed delivery is counted
+	fake.Advance(time.Minute)
+	notifier.err = errors.New("status 500")
+	failures(fake.Now().Add(-time.Hour), 12)
+	alerter.RecordFailure("device-1", "android", "request_hash_mismatch")
+	alerter.wait()
+	if len(notifier.alerts) != 1 {
+		t.Error("device not alerted again after the window")
+	}
+	if testutil.ToFloat64(failed)-beforeFailed != 1 {
+		t.Error("failed alert not counted")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// blockingNotifier holds every delivery until released
+type blockingNotifier struct {
+	release chan struct{}
+}
+
+func (n blockingNotifier) Notify(_ context.Context, _ notify.Alert) error {
+	<-n.release
+	return nil
+}
+
+func TestFailureAlerter_NeverBlocks(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	mock.MatchExpectationsInOrder(false)
+	notifier := blockingNotifier{release: make(chan struct{})}
+	alerter := NewFailureAlerter(db.NewFromPool(sqlDB), notifier, 1, time.Hour)
+	for i := 0; i < maxFailureChecks; i++ {
+		mock.ExpectQuery(`NOT verified`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	}
+
+	// Every check's delivery hangs; failures beyond the running checks are
+	// skipped rather than waiting for a slot
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3*maxFailureChecks; i++ {
+			alerter.RecordFailure("device-"+string(rune('a'+i)), "ios", "unknown_key")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RecordFailure blocked on a hanging webhook")
+	}
+	close(notifier.release)
+	alerter.wait()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// A nil alerter is disabled
+	var disabled *FailureAlerter
+	disabled.RecordFailure("device-1", "ios", "unknown_key")
+}
+
+func TestLoadFailureAlerterFromEnv(t *testing.T) {
+	t.Setenv("LUMENLINK_NOTIFY_WEBHOOK_URL", "")
+	t.Setenv("LUMENLINK_ATTESTATION_ALERT_WEBHOOK_URL", "")
+	if alerter := LoadFailureAlerterFromEnv(nil); alerter != nil {
+		t.Error("alerter created without a webhook")
+	}
+
+	t.Setenv("LUMENLINK_NOTIFY_WEBHOOK_URL", "https://alerts.example/hook")
+	alerter := LoadFailureAlerterFromEnv(nil)
+	if alerter == nil || alerter.threshold != 10 || alerter.window != time.Hour {
+		t.Fatalf("defaults: got %+v", alerter)
+	}
+
+	t.Setenv("LUMENLINK_ATTESTATION_FAILURE_ALERT_THRESHOLD", "25")
+	t.Setenv("LUMENLINK_ATTESTATION_FAILURE_ALERT_WINDOW", "30m")
+	if alerter = LoadFailureAlerterFromEnv(nil); alerter.threshold != 25 || alerter.window != 30*time.Minute {
+		t.Errorf("configured: got %+v", alerter)
+	}
+	t.Setenv("LUMENLINK_ATTESTATION_FAILURE_ALERT_THRESHOLD", "0")
+	if alerter = LoadFailureAlerterFromEnv(nil); alerter != nil {
+		t.Error("alerter created with a threshold of 0")
+	}
+}
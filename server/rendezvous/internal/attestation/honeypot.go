@@ -0,0 +1,151 @@
+package attestation
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HoneypotPolicy decides which devices are given honeypot gateways
+type HoneypotPolicy struct {
+	// MinIntegrity is the weakest verdict of a passing attestation that
+	// avoids honeypots; empty lets every passing attestation avoid them.
+	MinIntegrity string
+	// UnattestedHoneypots gives honeypots to devices without an attestation.
+	// Desktop statements count as none: anyone can enroll a desktop key, so
+	// a statement only shows the same install is asking again.
+	UnattestedHoneypots bool
+	// FailureThreshold gives honeypots to devices with at least this many
+	// failed attestations among their last FailureWindow from the client's
+	// address, whatever their latest result; zero disables the check
+	FailureThreshold int
+	FailureWindow    int
+	// MaxRiskMetric gives honeypots to iOS devices whose App Attest fraud
+	// risk metric, as last reported by Apple, is above it; zero disables
+	// the check
+	MaxRiskMetric int
+	// MaxRiskScore gives honeypots to devices whose latest attestation's
+	// risk score is above it; zero disables the check
+	MaxRiskScore float64
+}
+
+// DeviceHistory is what a honeypot decision knows about a device beyond its
+// latest attestation result
+type DeviceHistory struct {
+	RecentFailures int // Failed attestations among the device's last FailureWindow from the client's address
+	RiskMetric     int // Apple's fraud risk metric for the device's App Attest keys
+
+	// Flagged is set for devices flagged as sharing an App Attest key
+	Flagged bool
+}
+
+// LoadHoneypotPolicyFromEnv reads the policy from
+// LUMENLINK_HONEYPOT_MIN_INTEGRITY (default none),
+// LUMENLINK_HONEYPOT_UNATTESTED (default true),
+// LUMENLINK_HONEYPOT_FAILURE_THRESHOLD (default 3),
+// LUMENLINK_HONEYPOT_FAILURE_WINDOW (default 5 attempts),
+// LUMENLINK_HONEYPOT_MAX_RISK_METRIC (default 10) and
+// LUMENLINK_HONEYPOT_MAX_RISK_SCORE (default 0, disabled).
+func LoadHoneypotPolicyFromEnv() HoneypotPolicy {
+	policy := HoneypotPolicy{
+		UnattestedHoneypots: strings.ToLower(os.Getenv("LUMENLINK_HONEYPOT_UNATTESTED")) != "false",
+		FailureThreshold:    envInt("LUMENLINK_HONEYPOT_FAILURE_THRESHOLD", 3, 0),
+		FailureWindow:       envInt("LUMENLINK_HONEYPOT_FAILURE_WINDOW", 5, 1),
+		MaxRiskMetric:       envInt("LUMENLINK_HONEYPOT_MAX_RISK_METRIC", 10, 0),
+	}
+	if value := strings.TrimSpace(os.Getenv("LUMENLINK_HONEYPOT_MAX_RISK_SCORE")); value != "" {
+		if score, err := strconv.ParseFloat(value, 64); err == nil && score >= 0 && score <= 1 {
+			policy.MaxRiskScore = score
+		} else {
+			log.Printf("LUMENLINK_HONEYPOT_MAX_RISK_SCORE %q is not a score from 0 to 1, ignoring it", value)
+		}
+	}
+	if value := strings.ToUpper(strings.TrimSpace(os.Getenv("LUMENLINK_HONEYPOT_MIN_INTEGRITY"))); value != "" {
+		if _, ok := integrityRanks[value]; ok {
+			policy.MinIntegrity = value
+		} else {
+			log.Printf("LUMENLINK_HONEYPOT_MIN_INTEGRITY %q is not a device verdict, ignoring it", value)
+		}
+	}
+	return policy
+}
+
+// UseHoneypot decides for a device's latest attestation result, nil if it
+// has none, and its history
+func (p HoneypotPolicy) UseHoneypot(result *AttestationResult, history DeviceHistory) bool {
+	if p.FailureThreshold > 0 && history.RecentFailures >= p.FailureThreshold {
+		return true // One success does not outweigh a run of failures
+	}
+	if p.MaxRiskMetric > 0 && history.RiskMetric > p.MaxRiskMetric {
+		return true // Apple sees the device attesting far more keys than one install would
+	}
+	if history.Flagged {
+		return true
+	}
+	if result == nil {
+		return p.UnattestedHoneypots
+	}
+	if !result.IsValid || result.Downgraded {
+		return true
+	}
+	if result.Platform == "desktop" {
+		return p.UnattestedHoneypots
+	}
+	if p.MaxRiskScore > 0 && result.RiskScore > p.MaxRiskScore {
+		return true
+	}
+	if p.MinIntegrity == "" {
+		return false
+	}
+	return integrityRanks[result.DeviceIntegrity] < integrityRanks[p.MinIntegrity]
+}
+
+// WithHoneypotPolicy replaces the honeypot policy read from the environment
+func WithHoneypotPolicy(policy HoneypotPolicy) Option {
+	return func(s *AttestationService) {
+		s.honeypots = policy
+	}
+}
+
+// HoneypotPolicy returns the policy ShouldUseHoneypot applies
+func (s *AttestationService) HoneypotPolicy() HoneypotPolicy {
+	return s.honeypots
+}
+
+// ShouldUseHoneypot decides whether a device should be given honeypot
+// gateways, from its latest attestation result (nil if it has none), its
+// recent attestation history from clientIP and, for iOS devices, Apple's
+// risk metric and whether the device was flagged for sharing an App Attest
+// key. Only failures from the client's own address count, so nobody can send
+// failing attestations under another device's ID to give it honeypots. A
+// failed lookup is logged and the decision made without it.
+func (s *AttestationService) ShouldUseHoneypot(ctx context.Context, deviceID, clientIP string, result *AttestationResult) bool {
+	var history DeviceHistory
+	if deviceID == "" {
+		return s.honeypots.UseHoneypot(result, history)
+	}
+	if s.honeypots.FailureThreshold > 0 && clientIP != "" {
+		failures, err := s.db.CountRecentAttestationFailures(ctx, deviceID, s.storedClientIP(clientIP), s.honeypots.FailureWindow)
+		if err != nil {
+			log.Printf("attestation history lookup failed for device=%s: %v", deviceID, err)
+		}
+		history.RecentFailures = failures
+	}
+	if result != nil && result.Platform == "ios" {
+		flagged, err := s.db.IsDeviceFlagged(ctx, deviceID)
+		if err != nil {
+			log.Printf("device flag lookup failed for device=%s: %v", deviceID, err)
+		}
+		history.Flagged = flagged
+	}
+	if s.honeypots.MaxRiskMetric > 0 && result != nil && result.Platform == "ios" {
+		metric, err := s.db.GetDeviceRiskMetric(ctx, deviceID)
+		if err != nil {
+			log.Printf("device risk metric lookup failed for device=%s: %v", deviceID, err)
+		}
+		history.RiskMetric = metric
+	}
+	return s.honeypots.UseHoneypot(result, history)
+}
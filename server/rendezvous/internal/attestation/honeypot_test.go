@@ -0,0 +1,191 @@
+package attestation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+func TestShouldUseHoneypot_RecentFailuresOutweighOneSuccess(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	policy := HoneypotPolicy{UnattestedHoneypots: true, FailureThreshold: 3, FailureWindow: 5}
+	svc := NewAttestationService(db.NewFromPool(sqlDB), WithHoneypotPolicy(policy))
+	success := &AttestationResult{IsValid: true, Platform: "android", DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	recentFailures := func(n int) {
+		mock.ExpectQuery(`FILTER \(WHERE NOT verified\)`).WithArgs("device-1", "203.0.113.7", 5).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(n))
+	}
+
+	// Three failures, then the success just stored
+	recentFailures(3)
+	if !svc.ShouldUseHoneypot(context.Background(), "device-1", "203.0.113.7", success) {
+		t.Error("device with three recent failures avoided honeypots after one success")
+	}
+	recentFailures(2)
+	if svc.ShouldUseHoneypot(context.Background(), "device-1", "203.0.113.7", success) {
+		t.Error("device under the failure threshold given honeypots")
+	}
+	// Without an attestation the history still counts
+	recentFailures(3)
+	svc.honeypots.UnattestedHoneypots = false
+	if !svc.ShouldUseHoneypot(context.Background(), "device-1", "203.0.113.7", nil) {
+		t.Error("unattested device with recent failures avoided honeypots")
+	}
+	// Failures are counted per address, so without one they are not
+	// looked up
+	if svc.ShouldUseHoneypot(context.Background(), "device-1", "", success) {
+		t.Error("device without an address given honeypots")
+	}
+	// A failed lookup leaves the decision to the result
+	mock.ExpectQuery(`FROM attestations`).WillReturnError(errors.New("connection refused"))
+	if svc.ShouldUseHoneypot(context.Background(), "device-1", "203.0.113.7", success) {
+		t.Error("history lookup failure gave honeypots to a passing device")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShouldUseHoneypot_HighRiskMetric(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc := NewAttestationService(db.NewFromPool(sqlDB), WithHoneypotPolicy(HoneypotPolicy{MaxRiskMetric: 10}))
+	ios := &AttestationResult{IsValid: true, Platform: "ios", DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	riskMetric := func(n int) {
+		mock.ExpectQuery(`FROM flagged_devices`).WithArgs("device-1").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectQuery(`MAX\(risk_metric\)`).WithArgs("device-1").
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(n))
+	}
+
+	riskMetric(11)
+	if !svc.ShouldUseHoneypot(context.Background(), "device-1", "", ios) {
+		t.Error("device above the risk metric limit avoided honeypots")
+	}
+	riskMetric(10)
+	if svc.ShouldUseHoneypot(context.Background(), "device-1", "", ios) {
+		t.Error("device at the risk metric limit given honeypots")
+	}
+	// Only iOS devices have a risk metric to look up
+	android := &AttestationResult{IsValid: true, Platform: "android", DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	if svc.ShouldUseHoneypot(context.Background(), "device-1", "", android) {
+		t.Error("android device given honeypots")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHoneypotPolicy_UseHoneypot(t *testing.T) {
+	valid := func(platform, integrity string) *AttestationResult {
+		return &AttestationResult{IsValid: true, Platform: platform, DeviceIntegrity: integrity}
+	}
+	tests := []struct {
+		name   string
+		policy HoneypotPolicy
+		result *AttestationResult
+		want   bool
+	}{
+		{"unattested", HoneypotPolicy{UnattestedHoneypots: true}, nil, true},
+		{"unattested allowed", HoneypotPolicy{}, nil, false},
+		{"failed", HoneypotPolicy{}, &AttestationResult{IsValid: false}, true},
+		{"downgraded", HoneypotPolicy{}, &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY", Downgraded: true}, true},
+		{"any pass without minimum", HoneypotPolicy{}, valid("android", "MEETS_BASIC_INTEGRITY"), false},
+		{"below minimum", HoneypotPolicy{MinIntegrity: "MEETS_STRONG_INTEGRITY"}, valid("android", "MEETS_DEVICE_INTEGRITY"), true},
+		{"at minimum", HoneypotPolicy{MinIntegrity: "MEETS_DEVICE_INTEGRITY"}, valid("android", "MEETS_DEVICE_INTEGRITY"), false},
+		{"strong clears every minimum", HoneypotPolicy{UnattestedHoneypots: true, MinIntegrity: "MEETS_STRONG_INTEGRITY"}, valid("android", "MEETS_STRONG_INTEGRITY"), false},
+		{"desktop as unattested", HoneypotPolicy{UnattestedHoneypots: true}, valid("desktop", "MEETS_DEVICE_INTEGRITY"), true},
+		{"desktop with unattested allowed", HoneypotPolicy{MinIntegrity: "MEETS_STRONG_INTEGRITY"}, valid("desktop", "MEETS_DEVICE_INTEGRITY"), false},
+		{"bypass under a minimum", HoneypotPolicy{MinIntegrity: "MEETS_BASIC_INTEGRITY"}, valid("android", "BYPASS_ENABLED"), true},
+		{"above the risk score limit", HoneypotPolicy{MaxRiskScore: 0.5}, &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY", RiskScore: 0.6}, true},
+		{"at the risk score limit", HoneypotPolicy{MaxRiskScore: 0.5}, &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY", RiskScore: 0.5}, false},
+		{"risk score without a limit", HoneypotPolicy{}, &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY", RiskScore: 0.9}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.UseHoneypot(tt.result, DeviceHistory{}); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadHoneypotPolicyFromEnv(t *testing.T) {
+	policy := LoadHoneypotPolicyFromEnv()
+	if !policy.UnattestedHoneypots || policy.MinIntegrity != "" || policy.FailureThreshold != 3 || policy.FailureWindow != 5 || policy.MaxRiskMetric != 10 || policy.MaxRiskScore != 0 {
+		t.Errorf("defaults: got %+v", policy)
+	}
+
+	t.Setenv("LUMENLINK_HONEYPOT_MIN_INTEGRITY", "meets_device_integrity")
+	t.Setenv("LUMENLINK_HONEYPOT_UNATTESTED", "false")
+	t.Setenv("LUMENLINK_HONEYPOT_FAILURE_THRESHOLD", "0")
+	t.Setenv("LUMENLINK_HONEYPOT_MAX_RISK_METRIC", "0")
+	t.Setenv("LUMENLINK_HONEYPOT_MAX_RISK_SCORE", "0.6")
+	policy = LoadHoneypotPolicyFromEnv()
+	if policy.UnattestedHoneypots || policy.MinIntegrity != "MEETS_DEVICE_INTEGRITY" || policy.FailureThreshold != 0 || policy.MaxRiskMetric != 0 || policy.MaxRiskScore != 0.6 {
+		t.Errorf("configured: got %+v", policy)
+	}
+
+	t.Setenv("LUMENLINK_HONEYPOT_MAX_RISK_SCORE", "1.5")
+	if policy = LoadHoneypotPolicyFromEnv(); policy.MaxRiskScore != 0 {
+		t.Errorf("out of range risk score limit: got %v, want it ignored", policy.MaxRiskScore)
+	}
+}
+
+func TestShouldUseHoneypot_FlaggedDevice(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc := NewAttestationService(db.NewFromPool(sqlDB), WithHoneypotPolicy(HoneypotPolicy{}))
+	ios := &AttestationResult{IsValid: true, Platform: "ios", DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+
+	mock.ExpectQuery(`FROM flagged_devices`).WithArgs("device-1").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	if !svc.ShouldUseHoneypot(context.Background(), "device-1", "", ios) {
+		t.Error("device flagged for a shared key avoided honeypots")
+	}
+	mock.ExpectQuery(`FROM flagged_devices`).WithArgs("device-2").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	if svc.ShouldUseHoneypot(context.Background(), "device-2", "", ios) {
+		t.Error("device without flags given honeypots")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFlagSharedKey_FlagsBothDevices(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc := NewAttestationService(db.NewFromPool(sqlDB))
+	before := testutil.ToFloat64(metrics.AppAttestSharedKeys)
+
+	mock.ExpectQuery(`SELECT device_id FROM app_attest_keys`).WithArgs("key-1").
+		WillReturnRows(sqlmock.NewRows([]string{"device_id"}).AddRow("device-1"))
+	mock.ExpectExec(`INSERT INTO flagged_devices`).WithArgs("device-2", db.FlagSharedAppAttestKey, "key-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO flagged_devices`).WithArgs("device-1", db.FlagSharedAppAttestKey, "key-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	svc.flagSharedKey(context.Background(), "key-1", "device-2")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.ToFloat64(metrics.AppAttestSharedKeys) - before; got != 1 {
+		t.Errorf("shared keys: got %v more, want 1", got)
+	}
+}
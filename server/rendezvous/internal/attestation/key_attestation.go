@@ -0,0 +1,469 @@
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"rendezvous/internal/apperr"
+)
+
+// Android token types: Play Integrity, or for devices without Google Play
+// services, a hardware keystore attestation certificate chain
+const (
+	TokenTypePlayIntegrity  = "play_integrity"
+	TokenTypeKeyAttestation = "key_attestation"
+)
+
+// keyDescriptionOID is the attestation extension of a keystore key's
+// certificate
+var keyDescriptionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 1, 17}
+
+// Keystore security levels
+const (
+	securityLevelSoftware           = 0
+	securityLevelTrustedEnvironment = 1
+	securityLevelStrongBox          = 2
+)
+
+// verifiedBootVerified is the boot state of a device running an image its
+// manufacturer signed
+const verifiedBootVerified = 0
+
+// AuthorizationList tags read from a key description
+const (
+	tagRootOfTrust              = 704
+	tagAttestationApplicationID = 709
+)
+
+// keyDescription is the attestation extension's KeyDescription
+type keyDescription struct {
+	AttestationVersion       int
+	AttestationSecurityLevel asn1.Enumerated
+	KeymasterVersion         int
+	KeymasterSecurityLevel   asn1.Enumerated
+	AttestationChallenge     []byte
+	UniqueID                 []byte
+	SoftwareEnforced         asn1.RawValue
+	TeeEnforced              asn1.RawValue
+}
+
+// rootOfTrust describes the device's verified boot. Later attestation
+// versions append a boot hash, which is not read.
+type rootOfTrust struct {
+	VerifiedBootKey   []byte
+	DeviceLocked      bool
+	VerifiedBootState asn1.Enumerated
+}
+
+// attestationApplicationID identifies the app that created the key
+type attestationApplicationID struct {
+	PackageInfos     []attestationPackageInfo `asn1:"set"`
+	SignatureDigests [][]byte                 `asn1:"set"`
+}
+
+type attestationPackageInfo struct {
+	PackageName []byte
+	Version     int64
+}
+
+// DefaultKeyAttestationStatusURL is Google's revocation status list for
+// hardware attestation certificates
+const DefaultKeyAttestationStatusURL = "https://android.googleapis.com/attestation/status"
+
+// Revocation status list freshness: the list is fetched again once it is
+// older than keyStatusTTL, and a list that cannot be refreshed is used
+// until it is keyStatusMaxStale old
+const (
+	keyStatusTTL      = time.Hour
+	keyStatusMaxStale = 24 * time.Hour
+)
+
+// keyAttestationStatement is an Android key attestation token: the
+// attested key's certificate chain, leaf first
+type keyAttestationStatement struct {
+	Chain [][]byte `json:"certificate_chain"` // Base64 DER in JSON
+}
+
+// keyAttestation verifies keystore attestations against the configured
+// roots and app signing certificates
+type keyAttestation struct {
+	roots            *x509.CertPool
+	signatureDigests map[string]bool // Hex SHA-256 of the app's signing certificates
+	status           *keyStatusList  // Revoked certificates; nil leaves them unchecked
+}
+
+// keyStatusList is Google's attestation revocation status list, fetched
+// when first needed and cached
+type keyStatusList struct {
+	url  string
+	http *http.Client
+
+	mu      sync.Mutex
+	revoked map[string]bool // Lowercase hex serial numbers
+	fetched time.Time
+}
+
+// keyStatusResponse is the status list as Google serves it, by lowercase
+// hex serial number
+type keyStatusResponse struct {
+	Entries map[string]struct {
+		Status string `json:"status"` // REVOKED or SUSPENDED
+		Reason string `json:"reason"`
+	} `json:"entries"`
+}
+
+func newKeyStatusList(url string) *keyStatusList {
+	return &keyStatusList{url: url, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// revokedSerials returns the serial numbers of revoked and suspended
+// certificates as of now, fetching the list when the cached one is older
+// than keyStatusTTL. A failed fetch falls back to the cached list until it
+// is keyStatusMaxStale old; after that, or without one, it fails.
+func (l *keyStatusList) revokedSerials(ctx context.Context, now time.Time) (map[string]bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.revoked != nil && now.Sub(l.fetched) < keyStatusTTL {
+		return l.revoked, nil
+	}
+	revoked, err := l.fetch(ctx)
+	if err == nil {
+		l.revoked, l.fetched = revoked, now
+		return revoked, nil
+	}
+	if l.revoked != nil && now.Sub(l.fetched) < keyStatusMaxStale {
+		log.Printf("attestation status list refresh failed, using the list from %s: %v", l.fetched.Format(time.RFC3339), err)
+		return l.revoked, nil
+	}
+	return nil, err
+}
+
+func (l *keyStatusList) fetch(ctx context.Context) (map[string]bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build attestation status request: %w", err)
+	}
+	resp, err := l.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("attestation status request failed: %w", apperr.WithKind(apperr.ErrUnavailable, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, apperr.WithKind(apperr.ErrUnavailable, fmt.Errorf("attestation status request failed with status %d", resp.StatusCode))
+	}
+	var list keyStatusResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode attestation status list: %w", apperr.WithKind(apperr.ErrUnavailable, err))
+	}
+	revoked := make(map[string]bool, len(list.Entries))
+	for serial, entry := range list.Entries {
+		if entry.Status == "REVOKED" || entry.Status == "SUSPENDED" {
+			revoked[strings.ToLower(serial)] = true
+		}
+	}
+	return revoked, nil
+}
+
+// revokedCertificate reports whether any certificate of chain is on the
+// status list
+func (l *keyStatusList) revokedCertificate(ctx context.Context, now time.Time, chain []*x509.Certificate) (bool, error) {
+	revoked, err := l.revokedSerials(ctx, now)
+	if err != nil {
+		return false, err
+	}
+	for _, cert := range chain {
+		if revoked[strings.ToLower(cert.SerialNumber.Text(16))] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newKeyAttestationFromEnv reads the Google hardware attestation roots from
+// the PEM file ANDROID_KEY_ATTESTATION_ROOTS_FILE and the app's signing
+// certificate digests from ANDROID_SIGNATURE_DIGESTS (comma-separated hex
+// SHA-256, colons allowed). It returns nil if either is unset, and logs
+// unreadable roots, so key attestations are not accepted. Chains are checked
+// against the revocation status list at ANDROID_KEY_ATTESTATION_STATUS_URL
+// (default Google's).
+func newKeyAttestationFromEnv() *keyAttestation {
+	rootsFile := strings.TrimSpace(os.Getenv("ANDROID_KEY_ATTESTATION_ROOTS_FILE"))
+	digests := parseSignatureDigests(os.Getenv("ANDROID_SIGNATURE_DIGESTS"))
+	if rootsFile == "" || len(digests) == 0 {
+		return nil
+	}
+	pem, err := os.ReadFile(rootsFile)
+	if err != nil {
+		log.Printf("Android key attestation disabled: failed to read roots: %v", err)
+		return nil
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		log.Printf("Android key attestation disabled: no certificates in %s", rootsFile)
+		return nil
+	}
+	statusURL := strings.TrimSpace(os.Getenv("ANDROID_KEY_ATTESTATION_STATUS_URL"))
+	if statusURL == "" {
+		statusURL = DefaultKeyAttestationStatusURL
+	}
+	return &keyAttestation{roots: roots, signatureDigests: digests, status: newKeyStatusList(statusURL)}
+}
+
+// parseSignatureDigests reads comma-separated hex digests, as the Play
+// Console and apksigner show them
+func parseSignatureDigests(value string) map[string]bool {
+	digests := map[string]bool{}
+	for _, digest := range strings.Split(value, ",") {
+		digest = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(digest), ":", ""))
+		if digest != "" {
+			digests[digest] = true
+		}
+	}
+	return digests
+}
+
+// androidTokenType returns a request's Android token type, Play Integrity
+// when unset
+func androidTokenType(req *AttestationRequest) string {
+	if req.TokenType == "" {
+		return TokenTypePlayIntegrity
+	}
+	return req.TokenType
+}
+
+// verifyAndroid verifies an Android token by its type
+func (s *AttestationService) verifyAndroid(ctx context.Context, req *AttestationRequest) (*AttestationResult, error) {
+	switch androidTokenType(req) {
+	case TokenTypePlayIntegrity:
+		return s.verifyPlayIntegrity(ctx, req)
+	case TokenTypeKeyAttestation:
+		return s.verifyKeyAttestation(ctx, req)
+	default:
+		return &AttestationResult{
+			Platform:  "android",
+			DeviceID:  req.DeviceID,
+			Timestamp: s.clock.Now(),
+			Reason:    "invalid_token_type",
+		}, nil
+	}
+}
+
+// verifyKeyAttestation verifies an Android hardware keystore attestation,
+// for devices without Google Play services. The chain must lead to a
+// configured Google root without a certificate Google has revoked, and its
+// key must be hardware-backed, created over
+// a challenge issued to the device, and belong to this app as signed by
+// one of its signing certificates. Key attestation cannot vouch for the
+// app's install source or Play's view of the device, so it reaches
+// MEETS_DEVICE_INTEGRITY at best, and MEETS_BASIC_INTEGRITY on a device
+// with an unlocked bootloader or an unverified boot image; it is judged
+// against the key attestation minimum rather than Play Integrity's.
+func (s *AttestationService) verifyKeyAttestation(
+	ctx context.Context,
+	req *AttestationRequest,
+) (*AttestationResult, error) {
+	result := &AttestationResult{
+		Platform:  "android",
+		DeviceID:  req.DeviceID,
+		Timestamp: s.clock.Now(),
+	}
+
+	if req.Token == "" {
+		result.IsValid = false
+		result.Reason = "missing_token"
+		return result, nil
+	}
+	if s.bypassDevices[req.DeviceID] {
+		return bypassed(result), nil
+	}
+	if s.keyAttestation == nil || s.playIntegrityPackageName == "" {
+		if s.allowBypass {
+			return bypassed(result), nil
+		}
+		result.IsValid = false
+		result.Reason = "key_attestation_not_configured"
+		return result, nil
+	}
+
+	var statement keyAttestationStatement
+	if err := json.Unmarshal([]byte(req.Token), &statement); err != nil || len(statement.Chain) < 2 {
+		result.IsValid = false
+		result.Reason = "invalid_certificate_chain"
+		return result, nil
+	}
+	chain := make([]*x509.Certificate, len(statement.Chain))
+	for i, der := range statement.Chain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			result.IsValid = false
+			result.Reason = "invalid_certificate_chain"
+			return result, nil
+		}
+		chain[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         s.keyAttestation.roots,
+		Intermediates: intermediates,
+		CurrentTime:   s.clock.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		result.IsValid = false
+		result.Reason = "certificate_chain_untrusted"
+		return result, nil
+	}
+	if s.keyAttestation.status != nil {
+		revoked, err := s.keyAttestation.status.revokedCertificate(ctx, s.clock.Now(), chain)
+		if err != nil {
+			return result, fmt.Errorf("failed to check attestation status list: %w", apperr.WithKind(apperr.ErrUnavailable, err))
+		}
+		if revoked {
+			result.IsValid = false
+			result.Reason = "certificate_revoked"
+			return result, nil
+		}
+	}
+
+	description, err := parseKeyDescription(chain[0])
+	if err != nil {
+		result.IsValid = false
+		result.Reason = "invalid_key_description"
+		return result, nil
+	}
+	if level := int(description.AttestationSecurityLevel); level != securityLevelTrustedEnvironment && level != securityLevelStrongBox {
+		result.IsValid = false
+		result.Reason = "key_not_hardware_backed"
+		return result, nil
+	}
+
+	if s.challenges != nil {
+		// As for App Attest, consumed before verifying the rest
+		issued, err := s.consumeChallenge(ctx, req.DeviceID, ChallengeHash(string(description.AttestationChallenge)))
+		if err != nil {
+			return result, fmt.Errorf("failed to check challenge: %w", apperr.WithKind(apperr.ErrUnavailable, err))
+		}
+		if !issued {
+			result.IsValid = false
+			result.Reason = "challenge_invalid"
+			return result, nil
+		}
+	}
+
+	// The app's identity is recorded by the OS, outside the secure hardware
+	var app attestationApplicationID
+	found, err := findAuthorization(&app, tagAttestationApplicationID, true, description.TeeEnforced, description.SoftwareEnforced)
+	if err != nil || !found {
+		result.IsValid = false
+		result.Reason = "invalid_key_description"
+		return result, nil
+	}
+	if !app.hasPackage(s.playIntegrityPackageName) {
+		result.IsValid = false
+		result.Reason = "package_name_mismatch"
+		return result, nil
+	}
+	if !app.signedBy(s.keyAttestation.signatureDigests) {
+		result.IsValid = false
+		result.Reason = "signature_digest_mismatch"
+		return result, nil
+	}
+
+	// Only the secure hardware's view of the boot is trusted
+	result.DeviceIntegrity = "MEETS_BASIC_INTEGRITY"
+	var boot rootOfTrust
+	found, err = findAuthorization(&boot, tagRootOfTrust, false, description.TeeEnforced)
+	if err == nil && found && boot.DeviceLocked && boot.VerifiedBootState == verifiedBootVerified {
+		result.DeviceIntegrity = "MEETS_DEVICE_INTEGRITY"
+	}
+
+	if s.policy.meetsKeyAttestationIntegrity(result.DeviceIntegrity) {
+		result.IsValid = true
+		return result, nil
+	}
+	result.IsValid = false
+	result.Reason = "device_integrity_failed"
+	return result, nil
+}
+
+// parseKeyDescription reads the attestation extension of a key's
+// certificate
+func parseKeyDescription(cert *x509.Certificate) (*keyDescription, error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(keyDescriptionOID) {
+			continue
+		}
+		var description keyDescription
+		if _, err := asn1.Unmarshal(ext.Value, &description); err != nil {
+			return nil, fmt.Errorf("failed to parse key description: %w", err)
+		}
+		return &description, nil
+	}
+	return nil, errors.New("missing key description")
+}
+
+// findAuthorization decodes into out the authorization tagged tag from the
+// first of lists holding it. An AuthorizationList is a sequence of
+// explicitly tagged fields; wrapped fields are DER inside an OCTET STRING.
+func findAuthorization(out interface{}, tag int, wrapped bool, lists ...asn1.RawValue) (bool, error) {
+	for _, list := range lists {
+		rest := list.Bytes
+		for len(rest) > 0 {
+			var field asn1.RawValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+				return false, err
+			}
+			if field.Class != asn1.ClassContextSpecific || field.Tag != tag {
+				continue
+			}
+			inner := field.Bytes
+			if wrapped {
+				if _, err := asn1.Unmarshal(inner, &inner); err != nil {
+					return false, err
+				}
+			}
+			if _, err := asn1.Unmarshal(inner, out); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (a attestationApplicationID) hasPackage(packageName string) bool {
+	for _, info := range a.PackageInfos {
+		if bytes.Equal(info.PackageName, []byte(packageName)) {
+			return true
+		}
+	}
+	return false
+}
+
+// signedBy reports whether the app is signed by one of digests. An app
+// signed by several certificates lists every digest.
+func (a attestationApplicationID) signedBy(digests map[string]bool) bool {
+	for _, digest := range a.SignatureDigests {
+		if digests[hex.EncodeToString(digest)] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,396 @@
+package attestation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/store"
+)
+
+// testCA is a certificate authority standing in for a Google hardware
+// attestation root or a device's intermediate
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var testCertSerial int64
+
+// issueTestCert signs a certificate for key with parent, self-signed when
+// parent is nil
+func issueTestCert(t *testing.T, parent *testCA, key *ecdsa.PrivateKey, isCA bool, extensions ...pkix.Extension) *x509.Certificate {
+	t.Helper()
+	testCertSerial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(testCertSerial),
+		Subject:               pkix.Name{CommonName: "test " + big.NewInt(testCertSerial).String()},
+		NotBefore:             time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2036, 1, 1, 0, 0, 0, 0, time.UTC),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		ExtraExtensions:       extensions,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return cert
+}
+
+func newTestCA(t *testing.T, parent *testCA) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return &testCA{cert: issueTestCert(t, parent, key, true), key: key}
+}
+
+// testKeyDescription describes a keystore key as the attestation extension
+// does
+type testKeyDescription struct {
+	securityLevel int
+	challenge     string
+	packageName   string
+	digest        []byte
+	locked        bool
+	bootState     int
+}
+
+func mustMarshal(t *testing.T, value interface{}) []byte {
+	t.Helper()
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		t.Fatalf("asn1.Marshal: %v", err)
+	}
+	return der
+}
+
+// authorizationList encodes fields, tag to DER, as an AuthorizationList
+func authorizationList(t *testing.T, fields map[int][]byte) asn1.RawValue {
+	var content []byte
+	for _, tag := range []int{tagRootOfTrust, tagAttestationApplicationID} {
+		if der, ok := fields[tag]; ok {
+			content = append(content, mustMarshal(t, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: der})...)
+		}
+	}
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: content}
+}
+
+func (d testKeyDescription) extension(t *testing.T) pkix.Extension {
+	app := mustMarshal(t, attestationApplicationID{
+		PackageInfos:     []attestationPackageInfo{{PackageName: []byte(d.packageName), Version: 42}},
+		SignatureDigests: [][]byte{d.digest},
+	})
+	boot := mustMarshal(t, rootOfTrust{
+		VerifiedBootKey:   make([]byte, 32),
+		DeviceLocked:      d.locked,
+		VerifiedBootState: asn1.Enumerated(d.bootState),
+	})
+	description := keyDescription{
+		AttestationVersion:       100,
+		AttestationSecurityLevel: asn1.Enumerated(d.securityLevel),
+		KeymasterVersion:         100,
+		KeymasterSecurityLevel:   asn1.Enumerated(d.securityLevel),
+		AttestationChallenge:     []byte(d.challenge),
+		SoftwareEnforced:         authorizationList(t, map[int][]byte{tagAttestationApplicationID: mustMarshal(t, app)}),
+		TeeEnforced:              authorizationList(t, map[int][]byte{tagRootOfTrust: boot}),
+	}
+	return pkix.Extension{Id: keyDescriptionOID, Value: mustMarshal(t, description)}
+}
+
+// keyAttestationToken returns a token with the chain of a key described by
+// d, issued by an intermediate of root
+func keyAttestationToken(t *testing.T, root *testCA, d testKeyDescription) string {
+	t.Helper()
+	intermediate := newTestCA(t, root)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	leaf := issueTestCert(t, intermediate, key, false, d.extension(t))
+	token, err := json.Marshal(keyAttestationStatement{Chain: [][]byte{leaf.Raw, intermediate.cert.Raw, root.cert.Raw}})
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	return string(token)
+}
+
+func TestKeyAttestation_Verify(t *testing.T) {
+	ctx := context.Background()
+	root := newTestCA(t, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	digest := sha256.Sum256([]byte("signing certificate"))
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	challenges := store.NewMemory()
+	challenges.SetClock(fake)
+	svc := &AttestationService{
+		playIntegrityPackageName: "org.lumenlink.app",
+		keyAttestation:           &keyAttestation{roots: roots, signatureDigests: map[string]bool{hex.EncodeToString(digest[:]): true}},
+		// Play Integrity's strong minimum does not apply to key attestation
+		policy:       Policy{MinDeviceIntegrity: "MEETS_STRONG_INTEGRITY"},
+		clock:        fake,
+		challengeTTL: time.Minute,
+	}
+	svc.SetChallenges(challenges)
+	valid := func(challenge string) testKeyDescription {
+		return testKeyDescription{
+			securityLevel: securityLevelTrustedEnvironment,
+			challenge:     challenge,
+			packageName:   "org.lumenlink.app",
+			digest:        digest[:],
+			locked:        true,
+			bootState:     verifiedBootVerified,
+		}
+	}
+	verify := func(token string) *AttestationResult {
+		t.Helper()
+		result, err := svc.verifyAndroid(ctx, &AttestationRequest{Platform: "android", DeviceID: "device-1", Token: token, TokenType: TokenTypeKeyAttestation})
+		if err != nil {
+			t.Fatalf("verifyAndroid: %v", err)
+		}
+		return result
+	}
+
+	challenge, err := svc.GenerateChallenge(ctx, "device-1", "")
+	if err != nil {
+		t.Fatalf("GenerateChallenge: %v", err)
+	}
+	token := keyAttestationToken(t, root, valid(challenge))
+	if result := verify(token); !result.IsValid || result.DeviceIntegrity != "MEETS_DEVICE_INTEGRITY" {
+		t.Fatalf("valid chain: got %+v", result)
+	}
+	if result := verify(token); result.IsValid || result.Reason != "challenge_invalid" {
+		t.Errorf("replayed chain: got %+v", result)
+	}
+
+	other := newTestCA(t, nil)
+	tests := []struct {
+		name      string
+		token     func(challenge string) string
+		integrity string
+		reason    string
+	}{
+		{"StrongBox", func(c string) string {
+			d := valid(c)
+			d.securityLevel = securityLevelStrongBox
+			return keyAttestationToken(t, root, d)
+		}, "MEETS_DEVICE_INTEGRITY", ""},
+		{"unlocked bootloader", func(c string) string {
+			d := valid(c)
+			d.locked = false
+			return keyAttestationToken(t, root, d)
+		}, "MEETS_BASIC_INTEGRITY", "device_integrity_failed"},
+		{"unverified boot", func(c string) string {
+			d := valid(c)
+			d.bootState = 2
+			return keyAttestationToken(t, root, d)
+		}, "MEETS_BASIC_INTEGRITY", "device_integrity_failed"},
+		{"software key", func(c string) string {
+			d := valid(c)
+			d.securityLevel = securityLevelSoftware
+			return keyAttestationToken(t, root, d)
+		}, "", "key_not_hardware_backed"},
+		{"another root", func(c string) string { return keyAttestationToken(t, other, valid(c)) }, "", "certificate_chain_untrusted"},
+		{"another app", func(c string) string {
+			d := valid(c)
+			d.packageName = "org.example.app"
+			return keyAttestationToken(t, root, d)
+		}, "", "package_name_mismatch"},
+		{"another signer", func(c string) string {
+			d := valid(c)
+			d.digest = make([]byte, 32)
+			return keyAttestationToken(t, root, d)
+		}, "", "signature_digest_mismatch"},
+		{"unissued challenge", func(string) string { return keyAttestationToken(t, root, valid("made-up")) }, "", "challenge_invalid"},
+		{"not a chain", func(string) string { return `{"certificate_chain":["AAAA"]}` }, "", "invalid_certificate_chain"},
+		{"not JSON", func(string) string { return "token" }, "", "invalid_certificate_chain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge, err := svc.GenerateChallenge(ctx, "device-1", "")
+			if err != nil {
+				t.Fatalf("GenerateChallenge: %v", err)
+			}
+			result := verify(tt.token(challenge))
+			if result.IsValid != (tt.reason == "") || result.Reason != tt.reason || result.DeviceIntegrity != tt.integrity {
+				t.Errorf("got %+v, want integrity %q reason %q", result, tt.integrity, tt.reason)
+			}
+		})
+	}
+}
+
+func TestKeyAttestation_RevokedCertificate(t *testing.T) {
+	ctx := context.Background()
+	root := newTestCA(t, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	digest := sha256.Sum256([]byte("signing certificate"))
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+
+	var revoked string
+	available := true
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"entries":{%q:{"status":"REVOKED","reason":"KEY_COMPROMISE"},"ffff":{"status":"SUSPENDED"}}}`, revoked)
+	}))
+	defer server.Close()
+
+	svc := &AttestationService{
+		playIntegrityPackageName: "org.lumenlink.app",
+		keyAttestation: &keyAttestation{
+			roots:            roots,
+			signatureDigests: map[string]bool{hex.EncodeToString(digest[:]): true},
+			status:           newKeyStatusList(server.URL),
+		},
+		clock: fake,
+	}
+	d := testKeyDescription{
+		securityLevel: securityLevelTrustedEnvironment,
+		packageName:   "org.lumenlink.app",
+		digest:        digest[:],
+		locked:        true,
+		bootState:     verifiedBootVerified,
+	}
+	intermediate := newTestCA(t, root)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	leaf := issueTestCert(t, intermediate, key, false, d.extension(t))
+	token, _ := json.Marshal(keyAttestationStatement{Chain: [][]byte{leaf.Raw, intermediate.cert.Raw, root.cert.Raw}})
+	verify := func() (*AttestationResult, error) {
+		return svc.verifyAndroid(ctx, &AttestationRequest{Platform: "android", DeviceID: "device-1", Token: string(token), TokenType: TokenTypeKeyAttestation})
+	}
+
+	// A revoked intermediate fails the chain
+	revoked = intermediate.cert.SerialNumber.Text(16)
+	if result, err := verify(); err != nil || result.IsValid || result.Reason != "certificate_revoked" {
+		t.Fatalf("revoked intermediate: got %+v, %v", result, err)
+	}
+
+	// The list is cached for an hour
+	revoked = "abc"
+	if result, _ := verify(); result.IsValid || fetches != 1 {
+		t.Errorf("cached list: got %+v after %d fetches", result, fetches)
+	}
+	fake.Advance(time.Hour)
+	if result, err := verify(); err != nil || !result.IsValid || result.DeviceIntegrity != "MEETS_DEVICE_INTEGRITY" {
+		t.Errorf("refreshed list: got %+v, %v", result, err)
+	}
+
+	// A list that cannot be refreshed is used for a day, then the
+	// verification fails as unavailable
+	available = false
+	fake.Advance(2 * time.Hour)
+	if result, err := verify(); err != nil || !result.IsValid {
+		t.Errorf("stale list: got %+v, %v", result, err)
+	}
+	fake.Advance(24 * time.Hour)
+	if _, err := verify(); !errors.Is(err, apperr.ErrUnavailable) {
+		t.Errorf("expired list: got %v, want unavailable", err)
+	}
+}
+
+func TestLoadPolicyFromEnv_KeyAttestationIntegrity(t *testing.T) {
+	if policy := LoadPolicyFromEnv(); policy.MinKeyAttestationIntegrity != "MEETS_DEVICE_INTEGRITY" ||
+		!policy.meetsKeyAttestationIntegrity("MEETS_DEVICE_INTEGRITY") || policy.meetsKeyAttestationIntegrity("MEETS_BASIC_INTEGRITY") {
+		t.Errorf("default: got %+v", policy)
+	}
+	t.Setenv("ANDROID_KEY_ATTESTATION_MIN_INTEGRITY", "meets_basic_integrity")
+	if policy := LoadPolicyFromEnv(); !policy.meetsKeyAttestationIntegrity("MEETS_BASIC_INTEGRITY") {
+		t.Errorf("basic: got %+v", policy)
+	}
+	// Key attestation never reaches strong, so a strong minimum is ignored
+	t.Setenv("ANDROID_KEY_ATTESTATION_MIN_INTEGRITY", "MEETS_STRONG_INTEGRITY")
+	if policy := LoadPolicyFromEnv(); policy.MinKeyAttestationIntegrity != "MEETS_DEVICE_INTEGRITY" {
+		t.Errorf("strong: got %+v", policy)
+	}
+}
+
+func TestKeyAttestation_TokenTypes(t *testing.T) {
+	ctx := context.Background()
+	svc := &AttestationService{clock: clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))}
+
+	result, err := svc.verifyAndroid(ctx, &AttestationRequest{Platform: "android", Token: "token", TokenType: "safetynet"})
+	if err != nil || result.IsValid || result.Reason != "invalid_token_type" {
+		t.Errorf("unknown token type: got %+v, %v", result, err)
+	}
+	result, err = svc.verifyAndroid(ctx, &AttestationRequest{Platform: "android", Token: "token", TokenType: TokenTypeKeyAttestation})
+	if err != nil || result.IsValid || result.Reason != "key_attestation_not_configured" {
+		t.Errorf("unconfigured: got %+v, %v", result, err)
+	}
+	svc.allowBypass = true
+	result, err = svc.verifyAndroid(ctx, &AttestationRequest{Platform: "android", Token: "token", TokenType: TokenTypeKeyAttestation})
+	if err != nil || !result.IsValid || result.DeviceIntegrity != "BYPASS_ENABLED" {
+		t.Errorf("unconfigured with bypass: got %+v, %v", result, err)
+	}
+}
+
+func TestNewKeyAttestationFromEnv(t *testing.T) {
+	t.Setenv("ANDROID_KEY_ATTESTATION_ROOTS_FILE", "")
+	t.Setenv("ANDROID_SIGNATURE_DIGESTS", "")
+	if newKeyAttestationFromEnv() != nil {
+		t.Error("configured without roots or digests")
+	}
+
+	root := newTestCA(t, nil)
+	path := filepath.Join(t.TempDir(), "roots.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.cert.Raw}), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	t.Setenv("ANDROID_KEY_ATTESTATION_ROOTS_FILE", path)
+	if newKeyAttestationFromEnv() != nil {
+		t.Error("configured without digests")
+	}
+	t.Setenv("ANDROID_SIGNATURE_DIGESTS", "AB:CD:EF, 0123")
+	verifier := newKeyAttestationFromEnv()
+	if verifier == nil || len(verifier.signatureDigests) != 2 || !verifier.signatureDigests["abcdef"] || !verifier.signatureDigests["0123"] {
+		t.Fatalf("configured: got %+v", verifier)
+	}
+	if verifier.status == nil || verifier.status.url != DefaultKeyAttestationStatusURL {
+		t.Errorf("status list: got %+v, want Google's", verifier.status)
+	}
+
+	t.Setenv("ANDROID_KEY_ATTESTATION_ROOTS_FILE", filepath.Join(t.TempDir(), "missing.pem"))
+	if newKeyAttestationFromEnv() != nil {
+		t.Error("configured with unreadable roots")
+	}
+}
@@ -0,0 +1,227 @@
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+
+	playintegrity "google.golang.org/api/playintegrity/v1"
+
+	"rendezvous/internal/apperr"
+)
+
+// ErrInvalidIntegrityToken is returned when a Play Integrity token cannot be
+// decrypted or its signature does not verify with the configured keys
+var ErrInvalidIntegrityToken = apperr.New(apperr.ErrInvalidInput, "invalid_integrity_token", "invalid play integrity token")
+
+// localPlayIntegrity decodes tokens itself, with the response encryption
+// keys Google manages for the app ("Manage my response encryption keys" in
+// the Play Console), instead of calling the Play Integrity API. A token is
+// a JWE (A256KW, A256GCM) wrapping a JWS (ES256) of the verdict payload.
+type localPlayIntegrity struct {
+	decryptionKey   []byte
+	verificationKey *ecdsa.PublicKey
+}
+
+// newLocalPlayIntegrityFromEnv reads the base64 keys from
+// PLAY_INTEGRITY_DECRYPTION_KEY and PLAY_INTEGRITY_VERIFICATION_KEY. It
+// returns nil if either is unset, and logs unreadable keys, so tokens are
+// decoded by the Play Integrity API instead.
+func newLocalPlayIntegrityFromEnv() *localPlayIntegrity {
+	decryptionKey := strings.TrimSpace(os.Getenv("PLAY_INTEGRITY_DECRYPTION_KEY"))
+	verificationKey := strings.TrimSpace(os.Getenv("PLAY_INTEGRITY_VERIFICATION_KEY"))
+	if decryptionKey == "" || verificationKey == "" {
+		return nil
+	}
+	local, err := newLocalPlayIntegrity(decryptionKey, verificationKey)
+	if err != nil {
+		log.Printf("Local Play Integrity decoding disabled: %v", err)
+		return nil
+	}
+	return local
+}
+
+// newLocalPlayIntegrity parses the keys as the Play Console shows them: the
+// decryption key is a base64 AES-256 key, the verification key a base64 DER
+// P-256 public key
+func newLocalPlayIntegrity(decryptionKey, verificationKey string) (*localPlayIntegrity, error) {
+	aesKey, err := base64.StdEncoding.DecodeString(decryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode play integrity decryption key: %w", err)
+	}
+	if len(aesKey) != 32 {
+		return nil, fmt.Errorf("play integrity decryption key is %d bytes, want 32", len(aesKey))
+	}
+	der, err := base64.StdEncoding.DecodeString(verificationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode play integrity verification key: %w", err)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse play integrity verification key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok || key.Curve != elliptic.P256() {
+		return nil, errors.New("play integrity verification key is not a P-256 key")
+	}
+	return &localPlayIntegrity{decryptionKey: aesKey, verificationKey: key}, nil
+}
+
+// DecodeIntegrityToken decrypts the token and verifies its signature. The
+// payload is checked by the caller exactly as the API's would be.
+func (l *localPlayIntegrity) DecodeIntegrityToken(_ context.Context, _, token string) (*playintegrity.TokenPayloadExternal, error) {
+	signed, err := l.decrypt(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIntegrityToken, err)
+	}
+	payload, err := l.verify(signed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIntegrityToken, err)
+	}
+	var decoded playintegrity.TokenPayloadExternal
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse payload: %v", ErrInvalidIntegrityToken, err)
+	}
+	return &decoded, nil
+}
+
+// decrypt opens the compact JWE: header.encryptedKey.iv.ciphertext.tag
+func (l *localPlayIntegrity) decrypt(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("token has %d parts, want 5", len(parts))
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Enc string `json:"enc"`
+	}
+	if err := decodeJOSEHeader(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "A256KW" || header.Enc != "A256GCM" {
+		return nil, fmt.Errorf("unsupported encryption %s/%s", header.Alg, header.Enc)
+	}
+	decoded := make([][]byte, 4)
+	for i, part := range parts[1:] {
+		value, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode token part %d: %w", i+1, err)
+		}
+		decoded[i] = value
+	}
+	wrappedKey, iv, ciphertext, tag := decoded[0], decoded[1], decoded[2], decoded[3]
+
+	contentKey, err := aesKeyUnwrap(l.decryptionKey, wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content key: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != gcm.NonceSize() || len(tag) != gcm.Overhead() {
+		return nil, errors.New("invalid iv or tag length")
+	}
+	// The protected header, as sent, is the additional authenticated data
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, errors.New("token does not decrypt with the decryption key")
+	}
+	return plaintext, nil
+}
+
+// verify checks the compact JWS and returns its payload
+func (l *localPlayIntegrity) verify(signed []byte) ([]byte, error) {
+	parts := strings.Split(string(bytes.TrimSpace(signed)), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("signed payload has %d parts, want 3", len(parts))
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJOSEHeader(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "ES256" {
+		return nil, fmt.Errorf("unsupported signature algorithm %s", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return nil, errors.New("malformed signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(l.verificationKey, digest[:], r, s) {
+		return nil, errors.New("signature does not verify with the verification key")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	return payload, nil
+}
+
+func decodeJOSEHeader(encoded string, header interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("failed to decode header: %w", err)
+	}
+	if err := json.Unmarshal(data, header); err != nil {
+		return fmt.Errorf("failed to parse header: %w", err)
+	}
+	return nil
+}
+
+// keyWrapIV is the initial value of RFC 3394 key wrapping
+var keyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// aesKeyUnwrap unwraps a key wrapped with kek as in RFC 3394
+func aesKeyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, fmt.Errorf("wrapped key is %d bytes", len(wrapped))
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(wrapped)/8 - 1
+	a := make([]byte, 8)
+	copy(a, wrapped[:8])
+	r := make([]byte, n*8)
+	copy(r, wrapped[8:])
+
+	buf := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			binary.BigEndian.PutUint64(buf[:8], binary.BigEndian.Uint64(a)^uint64(n*j+i))
+			copy(buf[8:], r[(i-1)*8:i*8])
+			block.Decrypt(buf, buf)
+			copy(a, buf[:8])
+			copy(r[(i-1)*8:i*8], buf[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(a, keyWrapIV) != 1 {
+		return nil, errors.New("content key does not unwrap with the decryption key")
+	}
+	return r, nil
+}
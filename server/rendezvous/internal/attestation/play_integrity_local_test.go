@@ -0,0 +1,241 @@
+package attestation
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	playintegrity "google.golang.org/api/playintegrity/v1"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// aesKeyWrap wraps key with kek as in RFC 3394, the inverse of aesKeyUnwrap
+func aesKeyWrap(t *testing.T, kek, key []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := len(key) / 8
+	a := append([]byte(nil), keyWrapIV...)
+	r := append([]byte(nil), key...)
+	buf := make([]byte, 16)
+	for j := 0; j <= 5; j++ {
+		for i := 1; i <= n; i++ {
+			copy(buf, a)
+			copy(buf[8:], r[(i-1)*8:i*8])
+			block.Encrypt(buf, buf)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(buf[:8])^uint64(n*j+i))
+			copy(r[(i-1)*8:i*8], buf[8:])
+		}
+	}
+	return append(a, r...)
+}
+
+// integrityTokenKeys are a synthetic app's response encryption keys
+type integrityTokenKeys struct {
+	aesKey     []byte
+	signingKey *ecdsa.PrivateKey
+}
+
+func newIntegrityTokenKeys(t *testing.T) integrityTokenKeys {
+	t.Helper()
+	aesKey := make([]byte, 32)
+	if _, err := rand.Read(aesKey); err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return integrityTokenKeys{aesKey: aesKey, signingKey: signingKey}
+}
+
+// local returns the decoder for the keys, configured from their base64 forms
+func (k integrityTokenKeys) local(t *testing.T) *localPlayIntegrity {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&k.signingKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := newLocalPlayIntegrity(base64.StdEncoding.EncodeToString(k.aesKey), base64.StdEncoding.EncodeToString(der))
+	if err != nil {
+		t.Fatalf("newLocalPlayIntegrity: %v", err)
+	}
+	return local
+}
+
+// token signs and encrypts payload the way Google does
+func (k integrityTokenKeys) token(t *testing.T, payload interface{}) string {
+	t.Helper()
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256"}`)) + "." + base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, k.signingKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	jws := signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	contentKey := make([]byte, 32)
+	iv := make([]byte, 12)
+	_, _ = rand.Read(contentKey)
+	_, _ = rand.Read(iv)
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"A256KW","enc":"A256GCM"}`))
+	block, _ := aes.NewCipher(contentKey)
+	gcm, _ := cipher.NewGCM(block)
+	sealed := gcm.Seal(nil, iv, []byte(jws), []byte(header))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	return strings.Join([]string{
+		header,
+		base64.RawURLEncoding.EncodeToString(aesKeyWrap(t, k.aesKey, contentKey)),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, ".")
+}
+
+func TestAESKeyUnwrap_RFC3394Vector(t *testing.T) {
+	kek, _ := hex.DecodeString("000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F")
+	wrapped, _ := hex.DecodeString("64E8C3F9CE0F5BA263E9777905818A2A93C8191E7D6E8AE7")
+	key, err := aesKeyUnwrap(kek, wrapped)
+	if err != nil || hex.EncodeToString(key) != "00112233445566778899aabbccddeeff" {
+		t.Errorf("got %x, %v", key, err)
+	}
+	wrapped[0] ^= 1
+	if _, err := aesKeyUnwrap(kek, wrapped); err == nil {
+		t.Error("corrupted wrapped key unwrapped")
+	}
+}
+
+func TestNewLocalPlayIntegrity_RejectsBadKeys(t *testing.T) {
+	keys := newIntegrityTokenKeys(t)
+	der, _ := x509.MarshalPKIXPublicKey(&keys.signingKey.PublicKey)
+	verificationKey := base64.StdEncoding.EncodeToString(der)
+	tests := []struct {
+		name            string
+		decryptionKey   string
+		verificationKey string
+	}{
+		{"decryption key not base64", "not base64!", verificationKey},
+		{"short decryption key", base64.StdEncoding.EncodeToString(keys.aesKey[:16]), verificationKey},
+		{"verification key not a public key", base64.StdEncoding.EncodeToString(keys.aesKey), base64.StdEncoding.EncodeToString([]byte("key"))},
+	}
+	for _, tt := range tests {
+		if _, err := newLocalPlayIntegrity(tt.decryptionKey, tt.verificationKey); err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+
+	t.Setenv("PLAY_INTEGRITY_DECRYPTION_KEY", base64.StdEncoding.EncodeToString(keys.aesKey))
+	t.Setenv("PLAY_INTEGRITY_VERIFICATION_KEY", "")
+	if newLocalPlayIntegrityFromEnv() != nil {
+		t.Error("configured without a verification key")
+	}
+	t.Setenv("PLAY_INTEGRITY_VERIFICATION_KEY", verificationKey)
+	if newLocalPlayIntegrityFromEnv() == nil {
+		t.Error("not configured with both keys")
+	}
+}
+
+func TestLocalPlayIntegrity_Decode(t *testing.T) {
+	keys := newIntegrityTokenKeys(t)
+	local := keys.local(t)
+	payload := NewFakePlayIntegrity("org.lumenlink.app", time.Unix(1700000000, 0), "MEETS_DEVICE_INTEGRITY").Payload
+	token := keys.token(t, payload)
+
+	decoded, err := local.DecodeIntegrityToken(context.Background(), "org.lumenlink.app", token)
+	if err != nil {
+		t.Fatalf("DecodeIntegrityToken: %v", err)
+	}
+	if decoded.RequestDetails.RequestPackageName != "org.lumenlink.app" || decoded.RequestDetails.TimestampMillis != 1700000000000 ||
+		decoded.DeviceIntegrity.DeviceRecognitionVerdict[0] != "MEETS_DEVICE_INTEGRITY" || decoded.AppIntegrity.AppRecognitionVerdict != "PLAY_RECOGNIZED" {
+		t.Errorf("decoded %+v", decoded)
+	}
+
+	otherKeys := newIntegrityTokenKeys(t)
+	parts := strings.Split(token, ".")
+	ciphertext, _ := base64.RawURLEncoding.DecodeString(parts[3])
+	ciphertext[0] ^= 1
+	tampered := strings.Join(append(append([]string{}, parts[:3]...), base64.RawURLEncoding.EncodeToString(ciphertext), parts[4]), ".")
+	// Signed with a key other than the configured verification key
+	forged := integrityTokenKeys{aesKey: keys.aesKey, signingKey: otherKeys.signingKey}.token(t, payload)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"other decryption key", otherKeys.token(t, payload)},
+		{"tampered ciphertext", tampered},
+		{"other signing key", forged},
+		{"not a JWE", "header.payload.signature"},
+		{"unsupported encryption", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"dir","enc":"A256GCM"}`)) + ".." + strings.Join(parts[2:], ".")},
+	}
+	for _, tt := range tests {
+		_, err := local.DecodeIntegrityToken(context.Background(), "org.lumenlink.app", tt.token)
+		if !errors.Is(err, ErrInvalidIntegrityToken) || !errors.Is(err, apperr.ErrInvalidInput) {
+			t.Errorf("%s: got %v, want ErrInvalidIntegrityToken", tt.name, err)
+		}
+	}
+}
+
+func TestVerifyPlayIntegrity_LocalDecoding(t *testing.T) {
+	sqlDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	keys := newIntegrityTokenKeys(t)
+	svc := &AttestationService{
+		db:                       db.NewFromPool(sqlDB),
+		playIntegrityPackageName: "org.lumenlink.app",
+		playIntegrityLocal:       keys.local(t),
+		policy:                   Policy{MaxAge: 5 * time.Minute, MinDeviceIntegrity: "MEETS_DEVICE_INTEGRITY"},
+		pool:                     NewPool(PoolConfig{Workers: 1, QueueDepth: 1}),
+		clock:                    clock.NewFake(now),
+	}
+	payload := NewFakePlayIntegrity("org.lumenlink.app", now, "MEETS_DEVICE_INTEGRITY").Payload
+	ctx := context.Background()
+
+	result, err := svc.verifyPlayIntegrity(ctx, &AttestationRequest{Platform: "android", DeviceID: "device-1", Token: keys.token(t, payload)})
+	if err != nil || !result.IsValid || result.DeviceIntegrity != "MEETS_DEVICE_INTEGRITY" {
+		t.Errorf("valid token: got %+v, %v", result, err)
+	}
+
+	// The payload is checked as the API's would be
+	payload.RequestDetails = &playintegrity.RequestDetails{RequestPackageName: "org.evil.app", TimestampMillis: now.UnixMilli()}
+	result, err = svc.verifyPlayIntegrity(ctx, &AttestationRequest{Platform: "android", DeviceID: "device-1", Token: keys.token(t, payload)})
+	if err != nil || result.IsValid || result.Reason != "package_name_mismatch" {
+		t.Errorf("other package: got %+v, %v", result, err)
+	}
+
+	// A token that does not decrypt is the client's fault, not an outage
+	result, err = svc.verifyPlayIntegrity(ctx, &AttestationRequest{Platform: "android", DeviceID: "device-1", Token: newIntegrityTokenKeys(t).token(t, payload)})
+	if !errors.Is(err, apperr.ErrInvalidInput) || errors.Is(err, apperr.ErrUnavailable) || result.Reason != "play_integrity_api_error" {
+		t.Errorf("undecryptable token: got %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,148 @@
+package attestation
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// integrityRanks orders the Play Integrity device verdicts from weakest to
+// strongest
+var integrityRanks = map[string]int{
+	"MEETS_BASIC_INTEGRITY":  1,
+	"MEETS_DEVICE_INTEGRITY": 2,
+	"MEETS_STRONG_INTEGRITY": 3,
+}
+
+// Policy decides which attestations are accepted
+type Policy struct {
+	// MinDeviceIntegrity is the weakest Play Integrity device verdict
+	// accepted; empty means MEETS_STRONG_INTEGRITY
+	MinDeviceIntegrity string
+	// MinKeyAttestationIntegrity is the weakest verdict accepted from a
+	// hardware key attestation, which reaches MEETS_DEVICE_INTEGRITY at
+	// best; empty means MEETS_DEVICE_INTEGRITY
+	MinKeyAttestationIntegrity string
+	// RequireLicensed rejects Play installs that are not licensed, except
+	// in UnlicensedRegions
+	RequireLicensed   bool
+	UnlicensedRegions map[string]bool // Regions where sideloaded installs are accepted
+	// AllowedVersionCodes lists the app version codes accepted; empty
+	// accepts any
+	AllowedVersionCodes map[int64]bool
+	MaxAge              time.Duration // Oldest Play Integrity token accepted
+	// RequireRequestHash rejects tokens without a requestHash. It is off by
+	// default so that clients released before request binding keep working;
+	// turn it on once those releases are no longer supported.
+	RequireRequestHash bool
+	AppleProduction    bool // Verify App Attest against Apple's production environment
+
+	// DevelopmentBundleIDs are the app bundle IDs whose App Attest requests
+	// may name Apple's development environment in a production deployment,
+	// such as TestFlight builds. Requests may also name these instead of
+	// APPLE_BUNDLE_ID.
+	DevelopmentBundleIDs map[string]bool
+}
+
+// LoadPolicyFromEnv reads the policy from PLAY_INTEGRITY_MIN_DEVICE_INTEGRITY
+// (or PLAY_INTEGRITY_ALLOW_BASIC), ANDROID_KEY_ATTESTATION_MIN_INTEGRITY
+// (default MEETS_DEVICE_INTEGRITY), PLAY_INTEGRITY_REQUIRE_LICENSED,
+// PLAY_INTEGRITY_ALLOW_UNLICENSED_REGIONS, PLAY_INTEGRITY_ALLOWED_VERSION_CODES,
+// PLAY_INTEGRITY_MAX_AGE_SECONDS (default 300),
+// PLAY_INTEGRITY_REQUIRE_REQUEST_HASH, APPLE_PRODUCTION and
+// APPLE_DEVELOPMENT_BUNDLE_IDS.
+func LoadPolicyFromEnv() Policy {
+	policy := Policy{
+		MinDeviceIntegrity:  "MEETS_STRONG_INTEGRITY",
+		RequireLicensed:     strings.ToLower(os.Getenv("PLAY_INTEGRITY_REQUIRE_LICENSED")) != "false",
+		UnlicensedRegions:   map[string]bool{},
+		AllowedVersionCodes: map[int64]bool{},
+		MaxAge:              time.Duration(envInt("PLAY_INTEGRITY_MAX_AGE_SECONDS", 300, 1)) * time.Second,
+		RequireRequestHash:  strings.ToLower(os.Getenv("PLAY_INTEGRITY_REQUIRE_REQUEST_HASH")) == "true",
+		AppleProduction:     strings.ToLower(os.Getenv("APPLE_PRODUCTION")) != "false",
+
+		MinKeyAttestationIntegrity: "MEETS_DEVICE_INTEGRITY",
+		DevelopmentBundleIDs:       map[string]bool{},
+	}
+	if strings.ToLower(os.Getenv("PLAY_INTEGRITY_ALLOW_BASIC")) == "true" {
+		policy.MinDeviceIntegrity = "MEETS_BASIC_INTEGRITY"
+	}
+	if value := strings.ToUpper(strings.TrimSpace(os.Getenv("PLAY_INTEGRITY_MIN_DEVICE_INTEGRITY"))); value != "" {
+		if _, ok := integrityRanks[value]; ok {
+			policy.MinDeviceIntegrity = value
+		} else {
+			log.Printf("PLAY_INTEGRITY_MIN_DEVICE_INTEGRITY %q is not a device verdict, requiring %s", value, policy.MinDeviceIntegrity)
+		}
+	}
+	switch value := strings.ToUpper(strings.TrimSpace(os.Getenv("ANDROID_KEY_ATTESTATION_MIN_INTEGRITY"))); value {
+	case "":
+	case "MEETS_BASIC_INTEGRITY", "MEETS_DEVICE_INTEGRITY":
+		policy.MinKeyAttestationIntegrity = value
+	default:
+		log.Printf("ANDROID_KEY_ATTESTATION_MIN_INTEGRITY %q is not a verdict key attestation can reach, requiring %s", value, policy.MinKeyAttestationIntegrity)
+	}
+	for _, region := range strings.Split(os.Getenv("PLAY_INTEGRITY_ALLOW_UNLICENSED_REGIONS"), ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			policy.UnlicensedRegions[region] = true
+		}
+	}
+	for _, bundleID := range strings.Split(os.Getenv("APPLE_DEVELOPMENT_BUNDLE_IDS"), ",") {
+		if bundleID = strings.TrimSpace(bundleID); bundleID != "" {
+			policy.DevelopmentBundleIDs[bundleID] = true
+		}
+	}
+	for _, value := range strings.Split(os.Getenv("PLAY_INTEGRITY_ALLOWED_VERSION_CODES"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		code, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Printf("PLAY_INTEGRITY_ALLOWED_VERSION_CODES: ignoring %q: %v", value, err)
+			continue
+		}
+		policy.AllowedVersionCodes[code] = true
+	}
+	return policy
+}
+
+// meetsIntegrity reports whether a device verdict is at least the minimum
+func (p Policy) meetsIntegrity(verdict string) bool {
+	required := integrityRanks[p.MinDeviceIntegrity]
+	if required == 0 {
+		required = integrityRanks["MEETS_STRONG_INTEGRITY"]
+	}
+	return integrityRanks[verdict] >= required
+}
+
+// meetsKeyAttestationIntegrity reports whether a key attestation's verdict
+// is at least the key attestation minimum
+func (p Policy) meetsKeyAttestationIntegrity(verdict string) bool {
+	required := integrityRanks[p.MinKeyAttestationIntegrity]
+	if required == 0 {
+		required = integrityRanks["MEETS_DEVICE_INTEGRITY"]
+	}
+	return integrityRanks[verdict] >= required
+}
+
+// requiresLicense reports whether installs whose requests come from region
+// must be licensed; an unknown region ("") always must
+func (p Policy) requiresLicense(region string) bool {
+	return p.RequireLicensed && !p.UnlicensedRegions[region]
+}
+
+// allowsVersion reports whether an app version code is accepted
+func (p Policy) allowsVersion(versionCode int64) bool {
+	return len(p.AllowedVersionCodes) == 0 || p.AllowedVersionCodes[versionCode]
+}
+
+// Option configures an AttestationService
+type Option func(*AttestationService)
+
+// WithPolicy replaces the policy read from the environment
+func WithPolicy(policy Policy) Option {
+	return func(s *AttestationService) {
+		s.policy = policy
+	}
+}
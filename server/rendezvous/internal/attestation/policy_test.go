@@ -0,0 +1,112 @@
+package attestation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/api/playintegrity/v1"
+
+	"rendezvous/internal/clock"
+)
+
+func TestLoadPolicyFromEnv(t *testing.T) {
+	t.Setenv("PLAY_INTEGRITY_ALLOW_BASIC", "true")
+	t.Setenv("PLAY_INTEGRITY_ALLOW_UNLICENSED_REGIONS", "me-south-1, ap-east-1")
+	t.Setenv("PLAY_INTEGRITY_ALLOWED_VERSION_CODES", "41,42,latest")
+	t.Setenv("PLAY_INTEGRITY_MAX_AGE_SECONDS", "60")
+	t.Setenv("APPLE_DEVELOPMENT_BUNDLE_IDS", "org.lumenlink.app.beta,")
+
+	policy := LoadPolicyFromEnv()
+	if policy.MinDeviceIntegrity != "MEETS_BASIC_INTEGRITY" || !policy.RequireLicensed || policy.MaxAge != time.Minute {
+		t.Errorf("policy: got %+v", policy)
+	}
+	if !policy.UnlicensedRegions["ap-east-1"] || len(policy.UnlicensedRegions) != 2 {
+		t.Errorf("unlicensed regions: got %v", policy.UnlicensedRegions)
+	}
+	if !policy.AllowedVersionCodes[42] || len(policy.AllowedVersionCodes) != 2 {
+		t.Errorf("version codes: got %v", policy.AllowedVersionCodes)
+	}
+	if !policy.DevelopmentBundleIDs["org.lumenlink.app.beta"] || len(policy.DevelopmentBundleIDs) != 1 {
+		t.Errorf("development bundle IDs: got %v", policy.DevelopmentBundleIDs)
+	}
+	// Unbound tokens are accepted until the operator opts in
+	if policy.RequireRequestHash {
+		t.Error("request hash required by default")
+	}
+	t.Setenv("PLAY_INTEGRITY_REQUIRE_REQUEST_HASH", "true")
+	if !LoadPolicyFromEnv().RequireRequestHash {
+		t.Error("PLAY_INTEGRITY_REQUIRE_REQUEST_HASH=true not applied")
+	}
+
+	// The explicit minimum wins over the legacy flag; an unknown one is ignored
+	t.Setenv("PLAY_INTEGRITY_MIN_DEVICE_INTEGRITY", "meets_device_integrity")
+	if got := LoadPolicyFromEnv().MinDeviceIntegrity; got != "MEETS_DEVICE_INTEGRITY" {
+		t.Errorf("min device integrity: got %q", got)
+	}
+	t.Setenv("PLAY_INTEGRITY_MIN_DEVICE_INTEGRITY", "MEETS_SOME_INTEGRITY")
+	if got := LoadPolicyFromEnv().MinDeviceIntegrity; got != "MEETS_BASIC_INTEGRITY" {
+		t.Errorf("unknown min device integrity: got %q", got)
+	}
+}
+
+// payloadDecoder returns a fixed licensing verdict, version code and device
+// verdicts for every token
+type payloadDecoder struct {
+	licensing   string
+	versionCode int64
+	verdicts    []string
+}
+
+func (d payloadDecoder) DecodeIntegrityToken(_ context.Context, packageName, _ string) (*playintegrity.TokenPayloadExternal, error) {
+	return &playintegrity.TokenPayloadExternal{
+		RequestDetails:  &playintegrity.RequestDetails{RequestPackageName: packageName},
+		AppIntegrity:    &playintegrity.AppIntegrity{AppRecognitionVerdict: "PLAY_RECOGNIZED", VersionCode: d.versionCode},
+		AccountDetails:  &playintegrity.AccountDetails{AppLicensingVerdict: d.licensing},
+		DeviceIntegrity: &playintegrity.DeviceIntegrity{DeviceRecognitionVerdict: d.verdicts},
+	}, nil
+}
+
+func TestPlayIntegrity_PolicyKnobs(t *testing.T) {
+	policy := Policy{
+		MinDeviceIntegrity:  "MEETS_DEVICE_INTEGRITY",
+		RequireLicensed:     true,
+		UnlicensedRegions:   map[string]bool{"me-south-1": true},
+		AllowedVersionCodes: map[int64]bool{42: true},
+		MaxAge:              5 * time.Minute,
+	}
+	deviceVerdicts := []string{"MEETS_BASIC_INTEGRITY", "MEETS_DEVICE_INTEGRITY"}
+	tests := []struct {
+		name         string
+		decoder      payloadDecoder
+		region       string
+		clientRegion string
+		wantReason   string
+	}{
+		{"licensed device integrity", payloadDecoder{"LICENSED", 42, deviceVerdicts}, "us-east-1", "us-east-1", ""},
+		{"below minimum integrity", payloadDecoder{"LICENSED", 42, []string{"MEETS_BASIC_INTEGRITY"}}, "us-east-1", "us-east-1", "device_integrity_failed"},
+		{"version not allowed", payloadDecoder{"LICENSED", 41, deviceVerdicts}, "us-east-1", "us-east-1", "app_version_not_allowed"},
+		{"unlicensed", payloadDecoder{"UNLICENSED", 42, deviceVerdicts}, "us-east-1", "us-east-1", "app_not_licensed"},
+		{"unlicensed where allowed", payloadDecoder{"UNLICENSED", 42, deviceVerdicts}, "me-south-1", "me-south-1", ""},
+		{"unlicensed asking for an allowed region", payloadDecoder{"UNLICENSED", 42, deviceVerdicts}, "me-south-1", "us-east-1", "app_not_licensed"},
+		{"unlicensed from an unknown region", payloadDecoder{"UNLICENSED", 42, deviceVerdicts}, "me-south-1", "", "app_not_licensed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewAttestationService(nil, WithPolicy(policy))
+			svc.playIntegrityPackageName = "org.lumenlink.app"
+			svc.SetClock(clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)))
+			svc.SetPlayIntegrityDecoder(tt.decoder)
+
+			result, err := svc.verifyPlayIntegrity(context.Background(), &AttestationRequest{
+				Platform: "android", DeviceID: "device-1", Token: "token", Region: tt.region, ClientRegion: tt.clientRegion,
+			})
+			if err != nil {
+				t.Fatalf("verifyPlayIntegrity: %v", err)
+			}
+			if result.IsValid != (tt.wantReason == "") || result.Reason != tt.wantReason {
+				t.Errorf("got %+v, want reason %q", result, tt.wantReason)
+			}
+		})
+	}
+}
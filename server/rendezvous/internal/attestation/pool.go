@@ -0,0 +1,149 @@
+package attestation
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/metrics"
+)
+
+// ErrAttestationBusy is returned when every verification slot is taken and
+// the queue is full. Clients should retry after BusyRetryAfter.
+var ErrAttestationBusy = apperr.New(apperr.ErrUnavailable, "attestation_busy", "attestation verification queue is full")
+
+// BusyRetryAfter is how long a client shed with ErrAttestationBusy should wait
+const BusyRetryAfter = 5 * time.Second
+
+// PoolConfig bounds concurrent upstream verifications
+type PoolConfig struct {
+	Workers    int // Verifications running at once
+	QueueDepth int // Verifications waiting for a slot before new ones are shed
+}
+
+// LoadPoolConfigFromEnv reads LUMENLINK_ATTESTATION_CONCURRENCY (default 16)
+// and LUMENLINK_ATTESTATION_QUEUE_DEPTH (default 64).
+func LoadPoolConfigFromEnv() PoolConfig {
+	return PoolConfig{
+		Workers:    envInt("LUMENLINK_ATTESTATION_CONCURRENCY", 16, 1),
+		QueueDepth: envInt("LUMENLINK_ATTESTATION_QUEUE_DEPTH", 64, 0),
+	}
+}
+
+// Pool runs verifications with bounded concurrency. Waiting verifications
+// get slots in arrival order; once the queue is full, new ones are shed. A
+// nil pool runs everything immediately.
+type Pool struct {
+	config PoolConfig
+
+	mu      sync.Mutex
+	busy    int
+	waiting []chan struct{}
+}
+
+// NewPool creates a pool
+func NewPool(cfg PoolConfig) *Pool {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	p := &Pool{config: cfg}
+	p.report()
+	return p
+}
+
+// Do runs fn in a slot, waiting in the queue for one if needed. It returns
+// ErrAttestationBusy without running fn when the queue is full, and ctx's
+// error if ctx ends while waiting.
+func (p *Pool) Do(ctx context.Context, fn func()) error {
+	if p == nil {
+		fn()
+		return nil
+	}
+	if err := p.acquire(ctx); err != nil {
+		return err
+	}
+	defer p.release()
+	fn()
+	return nil
+}
+
+func (p *Pool) acquire(ctx context.Context) error {
+	p.mu.Lock()
+	if p.busy < p.config.Workers && len(p.waiting) == 0 {
+		p.busy++
+		p.report()
+		p.mu.Unlock()
+		return nil
+	}
+	if len(p.waiting) >= p.config.QueueDepth {
+		p.mu.Unlock()
+		metrics.AttestationShed.Inc()
+		return ErrAttestationBusy
+	}
+	ready := make(chan struct{})
+	p.waiting = append(p.waiting, ready)
+	p.report()
+	p.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for i, waiter := range p.waiting {
+			if waiter == ready {
+				p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+				p.report()
+				return ctx.Err()
+			}
+		}
+		// The slot was handed over as ctx ended: pass it on
+		p.releaseLocked()
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.releaseLocked()
+}
+
+// releaseLocked hands the slot to the longest waiting verification, or frees it
+func (p *Pool) releaseLocked() {
+	if len(p.waiting) > 0 {
+		next := p.waiting[0]
+		p.waiting = p.waiting[1:]
+		close(next)
+	} else {
+		p.busy--
+	}
+	p.report()
+}
+
+// Stats returns the slots in use and the verifications waiting
+func (p *Pool) Stats() (busy, queued int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.busy, len(p.waiting)
+}
+
+// report updates the pool gauges; p.mu must be held
+func (p *Pool) report() {
+	metrics.AttestationPoolUtilization.Set(float64(p.busy) / float64(p.config.Workers))
+	metrics.AttestationQueueDepth.Set(float64(len(p.waiting)))
+}
+
+func envInt(key string, defaultValue, minValue int) int {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= minValue {
+			return n
+		}
+	}
+	return defaultValue
+}
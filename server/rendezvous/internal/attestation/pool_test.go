@@ -0,0 +1,142 @@
+package attestation
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or a second passes
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPool_ShedsBeyondQueue(t *testing.T) {
+	pool := NewPool(PoolConfig{Workers: 2, QueueDepth: 3})
+	release := make(chan struct{})
+
+	const requests = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var ran, shed int
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := pool.Do(context.Background(), func() {
+				<-release
+				mu.Lock()
+				ran++
+				mu.Unlock()
+			})
+			if errors.Is(err, ErrAttestationBusy) {
+				mu.Lock()
+				shed++
+				mu.Unlock()
+			} else if err != nil {
+				t.Errorf("Do: %v", err)
+			}
+		}()
+	}
+
+	waitFor(t, "shed requests", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return shed == requests-5
+	})
+	if busy, queued := pool.Stats(); busy != 2 || queued != 3 {
+		t.Errorf("saturated pool: busy=%d queued=%d, want 2 and 3", busy, queued)
+	}
+
+	close(release)
+	wg.Wait()
+	if ran != 5 || shed != 5 {
+		t.Errorf("ran %d and shed %d, want 5 and 5", ran, shed)
+	}
+	if busy, queued := pool.Stats(); busy != 0 || queued != 0 {
+		t.Errorf("drained pool: busy=%d queued=%d", busy, queued)
+	}
+}
+
+func TestPool_RunsQueuedInArrivalOrder(t *testing.T) {
+	pool := NewPool(PoolConfig{Workers: 1, QueueDepth: 5})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = pool.Do(context.Background(), func() { <-release })
+	}()
+	waitFor(t, "first slot", func() bool { busy, _ := pool.Stats(); return busy == 1 })
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := pool.Do(context.Background(), func() {
+				mu.Lock()
+				order = append(order, i)
+				mu.Unlock()
+			}); err != nil {
+				t.Errorf("Do %d: %v", i, err)
+			}
+		}(i)
+		// Enqueue one at a time so arrival order is known
+		waitFor(t, "queued request", func() bool { _, queued := pool.Stats(); return queued == i+1 })
+	}
+
+	close(release)
+	wg.Wait()
+	<-done
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("ran in order %v, want arrival order", order)
+		}
+	}
+}
+
+func TestPool_CancelledWhileQueued(t *testing.T) {
+	pool := NewPool(PoolConfig{Workers: 1, QueueDepth: 1})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = pool.Do(context.Background(), func() { <-release })
+	}()
+	waitFor(t, "first slot", func() bool { busy, _ := pool.Stats(); return busy == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := pool.Do(ctx, func() { t.Error("cancelled request ran") })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do: got %v, want DeadlineExceeded", err)
+	}
+	if _, queued := pool.Stats(); queued != 0 {
+		t.Errorf("cancelled request still queued: %d", queued)
+	}
+
+	close(release)
+	<-done
+	if busy, _ := pool.Stats(); busy != 0 {
+		t.Errorf("slot not freed: busy=%d", busy)
+	}
+}
+
+func TestPool_Nil(t *testing.T) {
+	var pool *Pool
+	ran := false
+	if err := pool.Do(context.Background(), func() { ran = true }); err != nil || !ran {
+		t.Errorf("nil pool: err=%v ran=%v", err, ran)
+	}
+}
@@ -0,0 +1,281 @@
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+// App Attest receipt exchange endpoints
+const (
+	appleReceiptURL            = "https://data.appattest.apple.com/v1/attestationData"
+	appleReceiptDevelopmentURL = "https://data-development.appattest.apple.com/v1/attestationData"
+)
+
+// receiptRiskMetricField is the receipt field holding Apple's fraud risk
+// metric: roughly how many keys the device attested in the last 30 days
+const receiptRiskMetricField = 17
+
+// ErrReceiptNotModified is returned by a ReceiptExchanger when Apple has no
+// newer receipt than the one sent
+var ErrReceiptNotModified = errors.New("app attest receipt not modified")
+
+// ErrReceiptRefreshNotConfigured is returned by RefreshReceipt when no App
+// Attest developer key is configured
+var ErrReceiptRefreshNotConfigured = apperr.New(apperr.ErrUnavailable, "receipt_refresh_not_configured", "app attest receipt refresh not configured")
+
+// ReceiptExchanger exchanges an App Attest receipt with Apple for a newer
+// one carrying the device's fraud risk metric
+type ReceiptExchanger interface {
+	ExchangeReceipt(ctx context.Context, receipt []byte) ([]byte, error)
+}
+
+// WithReceiptExchanger exchanges receipts with exchanger instead of Apple's
+// endpoint; it is intended for tests.
+func WithReceiptExchanger(exchanger ReceiptExchanger) Option {
+	return func(s *AttestationService) {
+		s.receipts = exchanger
+	}
+}
+
+// appleReceiptClient exchanges receipts with Apple's App Attest data
+// endpoint, authenticated by a developer key with App Attest access
+type appleReceiptClient struct {
+	url    string
+	teamID string
+	keyID  string
+	key    *ecdsa.PrivateKey
+	http   *http.Client
+	clock  clock.Clock
+}
+
+// newAppleReceiptClientFromEnv reads the developer key from
+// APPLE_APP_ATTEST_KEY_ID and APPLE_APP_ATTEST_PRIVATE_KEY_FILE (a .p8
+// file). It returns nil if either is unset, and logs an unreadable key.
+func newAppleReceiptClientFromEnv(teamID string, production bool) *appleReceiptClient {
+	keyID := strings.TrimSpace(os.Getenv("APPLE_APP_ATTEST_KEY_ID"))
+	keyFile := strings.TrimSpace(os.Getenv("APPLE_APP_ATTEST_PRIVATE_KEY_FILE"))
+	if teamID == "" || keyID == "" || keyFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		log.Printf("App Attest receipt refresh disabled: %v", err)
+		return nil
+	}
+	key, err := parseDeveloperKey(data)
+	if err != nil {
+		log.Printf("App Attest receipt refresh disabled: %v", err)
+		return nil
+	}
+	url := appleReceiptDevelopmentURL
+	if production {
+		url = appleReceiptURL
+	}
+	return &appleReceiptClient{
+		url:    url,
+		teamID: teamID,
+		keyID:  keyID,
+		key:    key,
+		http:   &http.Client{Timeout: 30 * time.Second},
+		clock:  clock.Real{},
+	}
+}
+
+// parseDeveloperKey parses the PKCS #8 P-256 key of an Apple .p8 file
+func parseDeveloperKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("developer key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse developer key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("developer key is not an ECDSA key")
+	}
+	return key, nil
+}
+
+// authToken returns the ES256 JWT Apple expects in the Authorization header
+func (c *appleReceiptClient) authToken() (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": c.keyID})
+	claims, _ := json.Marshal(map[string]interface{}{"iss": c.teamID, "iat": c.clock.Now().Unix()})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign receipt auth token: %w", err)
+	}
+	// JWS carries the signature as fixed-width r || s
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ExchangeReceipt sends the receipt, base64 encoded, and decodes the newer
+// receipt Apple answers with
+func (c *appleReceiptClient) ExchangeReceipt(ctx context.Context, receipt []byte) ([]byte, error) {
+	token, err := c.authToken()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url,
+		strings.NewReader(base64.StdEncoding.EncodeToString(receipt)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build receipt request: %w", err)
+	}
+	req.Header.Set("Authorization", token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("receipt request failed: %w", apperr.WithKind(apperr.ErrUnavailable, err))
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read receipt response: %w", apperr.WithKind(apperr.ErrUnavailable, err))
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		refreshed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(body)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode refreshed receipt: %w", err)
+		}
+		return refreshed, nil
+	case http.StatusNotModified:
+		return nil, ErrReceiptNotModified
+	default:
+		return nil, fmt.Errorf("receipt request failed with status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+}
+
+// receiptContentInfo and receiptSignedData are the parts of the PKCS #7
+// envelope around a receipt's fields that are read
+type receiptContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type receiptSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     []byte `asn1:"explicit,tag:0"`
+	}
+}
+
+type receiptField struct {
+	Type    int
+	Version int
+	Value   []byte
+}
+
+// receiptRiskMetric reads the fraud risk metric from a receipt. Only
+// receipts refreshed with Apple carry one; ok is false for the others. The
+// signature is not checked: receipts are read only after Apple returned
+// them over TLS.
+func receiptRiskMetric(receipt []byte) (metric int64, ok bool, err error) {
+	var info receiptContentInfo
+	if _, err := asn1.Unmarshal(receipt, &info); err != nil {
+		return 0, false, fmt.Errorf("failed to parse receipt envelope: %w", err)
+	}
+	var signed receiptSignedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &signed); err != nil {
+		return 0, false, fmt.Errorf("failed to parse receipt signed data: %w", err)
+	}
+	var fields []receiptField
+	if _, err := asn1.UnmarshalWithParams(signed.EncapContentInfo.Content, &fields, "set"); err != nil {
+		return 0, false, fmt.Errorf("failed to parse receipt fields: %w", err)
+	}
+	for _, field := range fields {
+		if field.Type != receiptRiskMetricField {
+			continue
+		}
+		// Apple writes the metric as decimal text; accept a DER integer too
+		if value, err := strconv.ParseInt(strings.TrimSpace(string(field.Value)), 10, 64); err == nil {
+			return value, true, nil
+		}
+		var value *big.Int
+		if _, err := asn1.Unmarshal(field.Value, &value); err == nil && value.IsInt64() {
+			return value.Int64(), true, nil
+		}
+		return 0, false, fmt.Errorf("unreadable risk metric %q", field.Value)
+	}
+	return 0, false, nil
+}
+
+// ReceiptRefreshConfigured reports whether receipts can be exchanged with
+// Apple
+func (s *AttestationService) ReceiptRefreshConfigured() bool {
+	return s.receipts != nil
+}
+
+// RefreshReceipt exchanges the stored receipt of a device's App Attest key
+// with Apple and stores the newer receipt and the risk metric it carries.
+// When Apple has no newer receipt, only the refresh time is recorded.
+func (s *AttestationService) RefreshReceipt(ctx context.Context, deviceID, keyID string) error {
+	key, err := s.db.GetAppAttestKey(ctx, deviceID, keyID)
+	if err != nil {
+		return err
+	}
+	return s.refreshReceipt(ctx, key)
+}
+
+func (s *AttestationService) refreshReceipt(ctx context.Context, key *db.AppAttestKey) error {
+	if s.receipts == nil {
+		return ErrReceiptRefreshNotConfigured
+	}
+	if len(key.Receipt) == 0 {
+		return fmt.Errorf("app attest key %s has no receipt: %w", key.KeyID, apperr.WithKind(apperr.ErrInvalidInput, errors.New("missing receipt")))
+	}
+
+	refreshed, err := s.receipts.ExchangeReceipt(ctx, key.Receipt)
+	if errors.Is(err, ErrReceiptNotModified) {
+		metrics.AppAttestReceiptRefreshes.WithLabelValues("not_modified").Inc()
+		return s.db.UpdateAppAttestReceipt(ctx, key.DeviceID, key.KeyID, nil, sql.NullInt64{}, s.clock.Now())
+	}
+	if err != nil {
+		metrics.AppAttestReceiptRefreshes.WithLabelValues("error").Inc()
+		return fmt.Errorf("failed to exchange app attest receipt: %w", err)
+	}
+
+	var riskMetric sql.NullInt64
+	if metric, ok, err := receiptRiskMetric(refreshed); err != nil {
+		// The receipt is still Apple's newest; keep it without a metric
+		log.Printf("app attest receipt for key=%s device=%s: %v", key.KeyID, key.DeviceID, err)
+	} else if ok {
+		riskMetric = sql.NullInt64{Int64: metric, Valid: true}
+	}
+	metrics.AppAttestReceiptRefreshes.WithLabelValues("refreshed").Inc()
+	return s.db.UpdateAppAttestReceipt(ctx, key.DeviceID, key.KeyID, refreshed, riskMetric, s.clock.Now())
+}
@@ -0,0 +1,82 @@
+package attestation
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"rendezvous/internal/clock"
+)
+
+// ReceiptRefresher periodically exchanges stored App Attest receipts with
+// Apple, so each device's fraud risk metric stays current.
+type ReceiptRefresher struct {
+	service      *AttestationService
+	refreshAfter time.Duration
+	batch        int
+	clock        clock.Clock
+}
+
+// NewReceiptRefresher creates a refresher that exchanges receipts last
+// refreshed more than LUMENLINK_APP_ATTEST_RECEIPT_REFRESH_AFTER (default
+// 24h) ago, at most LUMENLINK_APP_ATTEST_RECEIPT_BATCH (default 100) a run.
+func NewReceiptRefresher(service *AttestationService) *ReceiptRefresher {
+	refreshAfter := 24 * time.Hour
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("LUMENLINK_APP_ATTEST_RECEIPT_REFRESH_AFTER"))); err == nil && d > 0 {
+		refreshAfter = d
+	}
+	return &ReceiptRefresher{
+		service:      service,
+		refreshAfter: refreshAfter,
+		batch:        envInt("LUMENLINK_APP_ATTEST_RECEIPT_BATCH", 100, 1),
+		clock:        clock.Real{},
+	}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (r *ReceiptRefresher) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Run refreshes one batch of due receipts and returns how many it
+// refreshed. A receipt that fails to refresh is logged and retried on a
+// later run.
+func (r *ReceiptRefresher) Run(ctx context.Context, now time.Time) (int, error) {
+	due, err := r.service.db.ListAppAttestReceiptsDue(ctx, now.Add(-r.refreshAfter), r.batch)
+	if err != nil {
+		return 0, err
+	}
+	refreshed := 0
+	for i := range due {
+		if err := r.service.refreshReceipt(ctx, &due[i]); err != nil {
+			log.Printf("app attest receipt refresh failed for key=%s device=%s: %v", due[i].KeyID, due[i].DeviceID, err)
+			continue
+		}
+		refreshed++
+	}
+	return refreshed, nil
+}
+
+// Start refreshes receipts every interval until ctx is cancelled.
+func (r *ReceiptRefresher) Start(ctx context.Context, interval time.Duration) {
+	ticker := r.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			refreshed, err := r.Run(ctx, r.clock.Now())
+			if err != nil {
+				log.Printf("app attest receipt refresh failed: %v", err)
+				continue
+			}
+			if refreshed > 0 {
+				log.Printf("app attest receipt refresh refreshed %d receipts", refreshed)
+			}
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package attestation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// buildReceipt wraps receipt fields in the PKCS #7 envelope Apple signs
+// receipts in, without a signature
+func buildReceipt(t *testing.T, fields ...receiptField) []byte {
+	t.Helper()
+	set, err := asn1.MarshalWithParams(fields, "set")
+	if err != nil {
+		t.Fatalf("marshal fields: %v", err)
+	}
+	var signed receiptSignedData
+	signed.Version = 1
+	signed.DigestAlgorithms = asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true}
+	signed.EncapContentInfo.ContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	signed.EncapContentInfo.Content = set
+	signedDER, err := asn1.Marshal(signed)
+	if err != nil {
+		t.Fatalf("marshal signed data: %v", err)
+	}
+	receipt, err := asn1.Marshal(receiptContentInfo{
+		ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2},
+		Content:     asn1.RawValue{FullBytes: mustExplicit(t, signedDER)},
+	})
+	if err != nil {
+		t.Fatalf("marshal content info: %v", err)
+	}
+	return receipt
+}
+
+func mustExplicit(t *testing.T, der []byte) []byte {
+	t.Helper()
+	wrapped, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wrapped
+}
+
+func TestReceiptRiskMetric(t *testing.T) {
+	appID := receiptField{Type: 2, Version: 1, Value: []byte("TEAM.org.lumenlink.app")}
+	tests := []struct {
+		name    string
+		receipt []byte
+		want    int64
+		wantOK  bool
+		wantErr bool
+	}{
+		{"refreshed", buildReceipt(t, appID, receiptField{Type: receiptRiskMetricField, Version: 1, Value: []byte("7")}), 7, true, false},
+		{"integer metric", buildReceipt(t, receiptField{Type: receiptRiskMetricField, Version: 1, Value: []byte{0x02, 0x01, 0x0c}}), 12, true, false},
+		{"attestation receipt", buildReceipt(t, appID), 0, false, false},
+		{"unreadable metric", buildReceipt(t, receiptField{Type: receiptRiskMetricField, Version: 1, Value: []byte("many")}), 0, false, true},
+		{"not a receipt", []byte("receipt"), 0, false, true},
+	}
+	for _, tt := range tests {
+		got, ok, err := receiptRiskMetric(tt.receipt)
+		if got != tt.want || ok != tt.wantOK || (err != nil) != tt.wantErr {
+			t.Errorf("%s: got %d, %v, %v", tt.name, got, ok, err)
+		}
+	}
+}
+
+func TestAppleReceiptClient_Exchange(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The auth token is an ES256 JWT from the team's developer key
+		parts := strings.Split(r.Header.Get("Authorization"), ".")
+		if len(parts) != 3 {
+			t.Errorf("authorization: got %q", r.Header.Get("Authorization"))
+			return
+		}
+		var header map[string]string
+		var claims map[string]interface{}
+		headerJSON, _ := base64.RawURLEncoding.DecodeString(parts[0])
+		claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		_ = json.Unmarshal(headerJSON, &header)
+		_ = json.Unmarshal(claimsJSON, &claims)
+		if header["alg"] != "ES256" || header["kid"] != "KEY123" || claims["iss"] != "TEAM" || claims["iat"] != float64(now.Unix()) {
+			t.Errorf("token: got header %v, claims %v", header, claims)
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if len(signature) != 64 || !ecdsa.Verify(&key.PublicKey, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+			t.Error("token signature does not verify")
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != base64.StdEncoding.EncodeToString([]byte("old receipt")) {
+			t.Errorf("body: got %q", body)
+		}
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString([]byte("new receipt")) + "\n"))
+		}
+	}))
+	defer server.Close()
+	client := &appleReceiptClient{url: server.URL, teamID: "TEAM", keyID: "KEY123", key: key, http: server.Client(), clock: clock.NewFake(now)}
+
+	refreshed, err := client.ExchangeReceipt(context.Background(), []byte("old receipt"))
+	if err != nil || string(refreshed) != "new receipt" {
+		t.Errorf("exchange: got %q, %v", refreshed, err)
+	}
+	status = http.StatusNotModified
+	if _, err := client.ExchangeReceipt(context.Background(), []byte("old receipt")); !errors.Is(err, ErrReceiptNotModified) {
+		t.Errorf("not modified: got %v", err)
+	}
+	status = http.StatusUnauthorized
+	if _, err := client.ExchangeReceipt(context.Background(), []byte("old receipt")); err == nil || errors.Is(err, ErrReceiptNotModified) {
+		t.Errorf("unauthorized: got %v", err)
+	}
+}
+
+// receiptExchangerFunc exchanges receipts with a function
+type receiptExchangerFunc func(ctx context.Context, receipt []byte) ([]byte, error)
+
+func (f receiptExchangerFunc) ExchangeReceipt(ctx context.Context, receipt []byte) ([]byte, error) {
+	return f(ctx, receipt)
+}
+
+func TestRefreshReceipt_StoresRiskMetric(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	refreshed := buildReceipt(t, receiptField{Type: receiptRiskMetricField, Version: 1, Value: []byte("4")})
+	notModified := false
+	svc := NewAttestationService(db.NewFromPool(sqlDB), WithReceiptExchanger(receiptExchangerFunc(
+		func(_ context.Context, receipt []byte) ([]byte, error) {
+			if string(receipt) != "stored receipt" {
+				t.Errorf("exchanged %q, want the stored receipt", receipt)
+			}
+			if notModified {
+				return nil, ErrReceiptNotModified
+			}
+			return refreshed, nil
+		})))
+	svc.SetClock(clock.NewFake(now))
+	storedKey := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"key_id", "device_id", "public_key", "receipt", "counter", "created_at", "last_used_at", "risk_metric", "receipt_refreshed_at"}).
+			AddRow("key-1", "device-1", []byte{4}, []byte("stored receipt"), 0, now, nil, nil, nil)
+	}
+
+	mock.ExpectQuery(`FROM app_attest_keys`).WithArgs("key-1", "device-1").WillReturnRows(storedKey())
+	mock.ExpectExec(`UPDATE app_attest_keys`).WithArgs("key-1", "device-1", refreshed, sql.NullInt64{Int64: 4, Valid: true}, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := svc.RefreshReceipt(context.Background(), "device-1", "key-1"); err != nil {
+		t.Fatalf("RefreshReceipt: %v", err)
+	}
+
+	// Without a newer receipt only the refresh time changes
+	notModified = true
+	mock.ExpectQuery(`FROM app_attest_keys`).WithArgs("key-1", "device-1").WillReturnRows(storedKey())
+	mock.ExpectExec(`UPDATE app_attest_keys`).WithArgs("key-1", "device-1", nil, sql.NullInt64{}, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := svc.RefreshReceipt(context.Background(), "device-1", "key-1"); err != nil {
+		t.Fatalf("RefreshReceipt not modified: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	unconfigured := NewAttestationService(db.NewFromPool(sqlDB))
+	if err := unconfigured.refreshReceipt(context.Background(), &db.AppAttestKey{Receipt: []byte("r")}); !errors.Is(err, ErrReceiptRefreshNotConfigured) {
+		t.Errorf("unconfigured: got %v", err)
+	}
+}
+
+func TestReceiptRefresher_RunSkipsFailedExchanges(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	refreshed := buildReceipt(t, receiptField{Type: receiptRiskMetricField, Version: 1, Value: []byte("1")})
+	svc := NewAttestationService(db.NewFromPool(sqlDB), WithReceiptExchanger(receiptExchangerFunc(
+		func(_ context.Context, receipt []byte) ([]byte, error) {
+			if string(receipt) == "rejected" {
+				return nil, errors.New("status 400")
+			}
+			return refreshed, nil
+		})))
+	svc.SetClock(clock.NewFake(now))
+	refresher := NewReceiptRefresher(svc)
+
+	mock.ExpectQuery(`FROM app_attest_keys`).WithArgs(now.Add(-24*time.Hour), 100).
+		WillReturnRows(sqlmock.NewRows([]string{"key_id", "device_id", "receipt"}).
+			AddRow("key-1", "device-1", []byte("rejected")).
+			AddRow("key-2", "device-2", []byte("stored")))
+	mock.ExpectExec(`UPDATE app_attest_keys`).WithArgs("key-2", "device-2", refreshed, sql.NullInt64{Int64: 1, Valid: true}, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	count, err := refresher.Run(context.Background(), now)
+	if err != nil || count != 1 {
+		t.Errorf("Run: got %d, %v; want 1 refreshed", count, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
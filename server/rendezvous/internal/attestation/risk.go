@@ -0,0 +1,141 @@
+package attestation
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Weights of the risk score's signals; they sum to 1, so a device showing
+// every signal at its worst scores 1
+const (
+	riskWeightIntegrity    = 0.35
+	riskWeightTokenAge     = 0.1
+	riskWeightLicensing    = 0.2
+	riskWeightFailures     = 0.2
+	riskWeightProbedRegion = 0.15
+)
+
+// integrityRisk is the share of riskWeightIntegrity each device verdict
+// carries; a verdict not listed carries all of it
+var integrityRisk = map[string]float64{
+	"MEETS_STRONG_INTEGRITY": 0,
+	"MEETS_DEVICE_INTEGRITY": 0.3,
+	"MEETS_BASIC_INTEGRITY":  0.7,
+	"BYPASS_ENABLED":         0,
+}
+
+// licensingRisk is the share of riskWeightLicensing each Play licensing
+// verdict carries. Platforms without one, and standard tokens that omit
+// it, carry none.
+var licensingRisk = map[string]float64{
+	"":            0,
+	"LICENSED":    0,
+	"UNEVALUATED": 0.5,
+	"UNLICENSED":  1,
+}
+
+// RiskSignals are what a device's risk score is computed from
+type RiskSignals struct {
+	Valid           bool
+	DeviceIntegrity string
+	// TokenAge is how old the token was when verified, judged against
+	// MaxTokenAge; zero for tokens without an issue time
+	TokenAge    time.Duration
+	MaxTokenAge time.Duration
+	Licensing   string // Play licensing verdict; empty where there is none
+	// RecentFailures of the device's RecentAttempts before this one
+	RecentFailures int
+	RecentAttempts int
+	ProbedRegion   bool // The device is served from a region under heavy probing
+}
+
+// ScoreRisk combines the signals into a score from 0 (no sign of risk) to
+// 1. A failed attestation scores 1 whatever else is known.
+func ScoreRisk(signals RiskSignals) float64 {
+	if !signals.Valid {
+		return 1
+	}
+	integrity, ok := integrityRisk[signals.DeviceIntegrity]
+	if !ok {
+		integrity = 1
+	}
+	score := riskWeightIntegrity * integrity
+
+	if signals.MaxTokenAge > 0 && signals.TokenAge > 0 {
+		score += riskWeightTokenAge * min(float64(signals.TokenAge)/float64(signals.MaxTokenAge), 1)
+	}
+	licensing, ok := licensingRisk[signals.Licensing]
+	if !ok {
+		licensing = 1
+	}
+	score += riskWeightLicensing * licensing
+	if signals.RecentAttempts > 0 {
+		score += riskWeightFailures * min(float64(signals.RecentFailures)/float64(signals.RecentAttempts), 1)
+	}
+	if signals.ProbedRegion {
+		score += riskWeightProbedRegion
+	}
+	return min(score, 1)
+}
+
+// RiskPolicy configures the signals of the risk score that do not come
+// from the attestation itself
+type RiskPolicy struct {
+	// ProbedRegions are regions under heavy probing; devices whose requests
+	// come from them score higher. The region is the one of the client's
+	// address, not the one it asks for, which it could pick to score lower.
+	ProbedRegions map[string]bool
+	// HistoryWindow is how many of a device's previous attestations its
+	// failure ratio is taken over
+	HistoryWindow int
+}
+
+// LoadRiskPolicyFromEnv reads the policy from LUMENLINK_RISK_PROBED_REGIONS
+// (comma-separated) and LUMENLINK_RISK_HISTORY_WINDOW (default 10
+// attestations).
+func LoadRiskPolicyFromEnv() RiskPolicy {
+	policy := RiskPolicy{
+		ProbedRegions: map[string]bool{},
+		HistoryWindow: envInt("LUMENLINK_RISK_HISTORY_WINDOW", 10, 1),
+	}
+	for _, region := range strings.Split(os.Getenv("LUMENLINK_RISK_PROBED_REGIONS"), ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			policy.ProbedRegions[region] = true
+		}
+	}
+	return policy
+}
+
+// WithRiskPolicy replaces the risk policy read from the environment
+func WithRiskPolicy(policy RiskPolicy) Option {
+	return func(s *AttestationService) {
+		s.risk = policy
+	}
+}
+
+// scoreRisk sets a result's risk score. A verified device's failure ratio
+// is taken from its stored history; a failed lookup is logged and the score
+// computed without it.
+func (s *AttestationService) scoreRisk(ctx context.Context, req *AttestationRequest, result *AttestationResult) {
+	signals := RiskSignals{
+		Valid:           result.IsValid,
+		DeviceIntegrity: result.DeviceIntegrity,
+		MaxTokenAge:     s.policy.MaxAge,
+		Licensing:       result.licensing,
+		ProbedRegion:    s.risk.ProbedRegions[req.ClientRegion],
+	}
+	if !result.tokenIssued.IsZero() {
+		signals.TokenAge = s.clock.Now().Sub(result.tokenIssued)
+	}
+	if result.IsValid && req.DeviceID != "" {
+		failures, attempts, err := s.db.CountRecentAttestationOutcomes(ctx, req.DeviceID, s.risk.HistoryWindow)
+		if err != nil {
+			log.Printf("attestation history lookup failed for device=%s: %v", req.DeviceID, err)
+		}
+		signals.RecentFailures, signals.RecentAttempts = failures, attempts
+	}
+	result.RiskScore = ScoreRisk(signals)
+}
@@ -0,0 +1,117 @@
+package attestation
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+func TestScoreRisk(t *testing.T) {
+	strong := RiskSignals{Valid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY", MaxTokenAge: 5 * time.Minute, Licensing: "LICENSED"}
+	with := func(change func(*RiskSignals)) RiskSignals {
+		signals := strong
+		change(&signals)
+		return signals
+	}
+	tests := []struct {
+		name    string
+		signals RiskSignals
+		want    float64
+	}{
+		{"failed", RiskSignals{Valid: false, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}, 1},
+		{"strong, fresh, licensed", strong, 0},
+		{"bypass", with(func(s *RiskSignals) { s.DeviceIntegrity = "BYPASS_ENABLED" }), 0},
+		{"device integrity", with(func(s *RiskSignals) { s.DeviceIntegrity = "MEETS_DEVICE_INTEGRITY" }), 0.105},
+		{"basic integrity", with(func(s *RiskSignals) { s.DeviceIntegrity = "MEETS_BASIC_INTEGRITY" }), 0.245},
+		{"no verdict", with(func(s *RiskSignals) { s.DeviceIntegrity = "" }), 0.35},
+		{"half the max age", with(func(s *RiskSignals) { s.TokenAge = 150 * time.Second }), 0.05},
+		{"at the max age", with(func(s *RiskSignals) { s.TokenAge = 5 * time.Minute }), 0.1},
+		{"age without a max", with(func(s *RiskSignals) { s.TokenAge, s.MaxTokenAge = time.Hour, 0 }), 0},
+		{"no licensing verdict", with(func(s *RiskSignals) { s.Licensing = "" }), 0},
+		{"unevaluated", with(func(s *RiskSignals) { s.Licensing = "UNEVALUATED" }), 0.1},
+		{"unlicensed", with(func(s *RiskSignals) { s.Licensing = "UNLICENSED" }), 0.2},
+		{"no history", with(func(s *RiskSignals) { s.RecentFailures, s.RecentAttempts = 0, 0 }), 0},
+		{"one failure in four", with(func(s *RiskSignals) { s.RecentFailures, s.RecentAttempts = 1, 4 }), 0.05},
+		{"all failures", with(func(s *RiskSignals) { s.RecentFailures, s.RecentAttempts = 5, 5 }), 0.2},
+		{"probed region", with(func(s *RiskSignals) { s.ProbedRegion = true }), 0.15},
+		{"every signal at its worst", RiskSignals{
+			Valid: true, DeviceIntegrity: "", TokenAge: time.Hour, MaxTokenAge: 5 * time.Minute,
+			Licensing: "UNLICENSED", RecentFailures: 10, RecentAttempts: 10, ProbedRegion: true,
+		}, 1},
+		{"basic, unevaluated, half failed, probed", RiskSignals{
+			Valid: true, DeviceIntegrity: "MEETS_BASIC_INTEGRITY", TokenAge: 150 * time.Second, MaxTokenAge: 5 * time.Minute,
+			Licensing: "UNEVALUATED", RecentFailures: 2, RecentAttempts: 4, ProbedRegion: true,
+		}, 0.645},
+	}
+	for _, tt := range tests {
+		if got := ScoreRisk(tt.signals); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadRiskPolicyFromEnv(t *testing.T) {
+	policy := LoadRiskPolicyFromEnv()
+	if len(policy.ProbedRegions) != 0 || policy.HistoryWindow != 10 {
+		t.Errorf("defaults: got %+v", policy)
+	}
+
+	t.Setenv("LUMENLINK_RISK_PROBED_REGIONS", "ap-east-1, me-south-1,")
+	t.Setenv("LUMENLINK_RISK_HISTORY_WINDOW", "20")
+	policy = LoadRiskPolicyFromEnv()
+	if len(policy.ProbedRegions) != 2 || !policy.ProbedRegions["ap-east-1"] || !policy.ProbedRegions["me-south-1"] || policy.HistoryWindow != 20 {
+		t.Errorf("configured: got %+v", policy)
+	}
+}
+
+func TestVerifyAttestation_StoresRiskScore(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := &AttestationService{
+		db:                       db.NewFromPool(sqlDB),
+		playIntegrityPackageName: "org.lumenlink.app",
+		policy:                   Policy{MinDeviceIntegrity: "MEETS_DEVICE_INTEGRITY", MaxAge: 5 * time.Minute},
+		risk:                     RiskPolicy{ProbedRegions: map[string]bool{"ap-east-1": true}, HistoryWindow: 4},
+		pool:                     NewPool(PoolConfig{Workers: 1, QueueDepth: 1}),
+		clock:                    clock.NewFake(now),
+		validity:                 24 * time.Hour,
+	}
+	fake := NewFakePlayIntegrity("org.lumenlink.app", now.Add(-150*time.Second), "MEETS_DEVICE_INTEGRITY")
+	fake.Payload.AccountDetails.AppLicensingVerdict = "UNEVALUATED"
+	svc.SetPlayIntegrityDecoder(fake)
+
+	mock.ExpectQuery(`FROM revoked_devices`).WithArgs("device-1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`SELECT device_integrity`).WithArgs("device-1", "android").
+		WillReturnRows(sqlmock.NewRows([]string{"device_integrity"}))
+	mock.ExpectQuery(`COUNT\(\*\) FILTER \(WHERE NOT verified\), COUNT\(\*\)`).WithArgs("device-1", 4).
+		WillReturnRows(sqlmock.NewRows([]string{"failures", "attempts"}).AddRow(1, 4))
+	mock.ExpectExec(`INSERT INTO attestations`).
+		WithArgs("device-1", "android", "token", true, sqlmock.AnyArg(), "MEETS_DEVICE_INTEGRITY", sqlmock.AnyArg(), "", "", sqlmock.AnyArg(), "", "ap-east-1", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	result, err := svc.VerifyAttestation(context.Background(), &AttestationRequest{
+		Platform: "android", DeviceID: "device-1", Token: "token", Region: "us-east-1", ClientRegion: "ap-east-1",
+	})
+	if err != nil || !result.IsValid {
+		t.Fatalf("VerifyAttestation: got %+v, %v", result, err)
+	}
+	// Device integrity 0.105, half the max age 0.05, unevaluated 0.1, one
+	// failure in four 0.05 and the probed region the request came from 0.15
+	if math.Abs(result.RiskScore-0.455) > 1e-9 {
+		t.Errorf("risk score: got %v, want 0.455", result.RiskScore)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,142 @@
+package attestation
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/metrics"
+)
+
+// Session token errors
+var (
+	// ErrInvalidSession is returned when an attestation session token does
+	// not verify or was issued to another device
+	ErrInvalidSession = apperr.New(apperr.ErrUnauthorized, "invalid_attestation_session", "invalid attestation session")
+	// ErrSessionExpired is returned when an attestation session token has
+	// expired
+	ErrSessionExpired = apperr.New(apperr.ErrUnauthorized, "attestation_session_expired", "attestation session expired")
+)
+
+// sessionClaims is the signed content of an attestation session token
+type sessionClaims struct {
+	Device          string  `json:"d"` // Hash of the device ID
+	Platform        string  `json:"p"`
+	DeviceIntegrity string  `json:"i"`
+	RiskScore       float64 `json:"r,omitempty"`
+	Downgraded      bool    `json:"g,omitempty"`
+	Expires         int64   `json:"exp"` // Unix seconds
+}
+
+// loadSessionSecret reads LUMENLINK_ATTESTATION_SESSION_SECRET, or generates
+// a random secret so that sessions are honoured only by this process
+func loadSessionSecret() []byte {
+	if secret := os.Getenv("LUMENLINK_ATTESTATION_SESSION_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("attestation: failed to generate session secret: %v", err))
+	}
+	return secret
+}
+
+// IssueSession returns a session token vouching for a valid attestation, so
+// the device's config requests need not send the attestation again, and
+// when it expires. It lasts LUMENLINK_ATTESTATION_SESSION_TTL (default
+// 15m), but never beyond the attestation's validity. Failed attestations get
+// no session.
+func (s *AttestationService) IssueSession(result *AttestationResult) (string, time.Time, bool) {
+	if result == nil || !result.IsValid || result.DeviceID == "" {
+		return "", time.Time{}, false
+	}
+	ttl := s.sessionTTL
+	if s.validity < ttl {
+		ttl = s.validity
+	}
+	expires := s.clock.Now().Add(ttl).Truncate(time.Second)
+	claims, _ := json.Marshal(sessionClaims{
+		Device:          sessionDeviceKey(result.DeviceID),
+		Platform:        result.Platform,
+		DeviceIntegrity: result.DeviceIntegrity,
+		RiskScore:       result.RiskScore,
+		Downgraded:      result.Downgraded,
+		Expires:         expires.Unix(),
+	})
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	metrics.AttestationSessions.WithLabelValues("issued").Inc()
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.signSession(payload)), expires, true
+}
+
+// VerifySession checks a session token issued to deviceID and returns the
+// attestation it vouches for. The token is checked locally; no attestation
+// is verified or stored.
+func (s *AttestationService) VerifySession(token, deviceID string) (*AttestationResult, error) {
+	result, err := s.verifySession(token, deviceID)
+	switch {
+	case err == nil:
+		metrics.AttestationSessions.WithLabelValues("valid").Inc()
+	case errors.Is(err, ErrSessionExpired):
+		metrics.AttestationSessions.WithLabelValues("expired").Inc()
+	default:
+		metrics.AttestationSessions.WithLabelValues("invalid").Inc()
+	}
+	return result, err
+}
+
+func (s *AttestationService) verifySession(token, deviceID string) (*AttestationResult, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.signSession(payload)) {
+		return nil, ErrInvalidSession
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, ErrInvalidSession
+	}
+	now := s.clock.Now()
+	if claims.Device != sessionDeviceKey(deviceID) {
+		return nil, ErrInvalidSession
+	}
+	if now.Unix() >= claims.Expires {
+		return nil, ErrSessionExpired
+	}
+	return &AttestationResult{
+		IsValid:         true,
+		DeviceIntegrity: claims.DeviceIntegrity,
+		RiskScore:       claims.RiskScore,
+		Downgraded:      claims.Downgraded,
+		Platform:        claims.Platform,
+		DeviceID:        deviceID,
+		Timestamp:       now,
+	}, nil
+}
+
+func (s *AttestationService) signSession(payload string) []byte {
+	mac := hmac.New(sha256.New, s.sessionSecret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// sessionDeviceKey binds a session to its device without the token
+// carrying the device ID
+func sessionDeviceKey(deviceID string) string {
+	sum := sha256.Sum256([]byte(deviceID))
+	return hex.EncodeToString(sum[:16])
+}
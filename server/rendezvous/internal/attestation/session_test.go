@@ -0,0 +1,78 @@
+package attestation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"rendezvous/internal/clock"
+)
+
+func TestSession_RoundTrip(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	svc := &AttestationService{sessionSecret: []byte("secret"), sessionTTL: 15 * time.Minute, validity: 24 * time.Hour, clock: fake}
+	valid := &AttestationResult{IsValid: true, Platform: "ios", DeviceID: "device-1", DeviceIntegrity: "MEETS_STRONG_INTEGRITY", RiskScore: 0.25}
+
+	token, expires, ok := svc.IssueSession(valid)
+	if !ok || !expires.Equal(now.Add(15*time.Minute)) {
+		t.Fatalf("IssueSession: got %v, %v", expires, ok)
+	}
+	if strings.Contains(token, "device-1") {
+		t.Error("token carries the device ID")
+	}
+	result, err := svc.VerifySession(token, "device-1")
+	if err != nil || !result.IsValid || result.Platform != "ios" || result.DeviceIntegrity != "MEETS_STRONG_INTEGRITY" || result.DeviceID != "device-1" || result.RiskScore != 0.25 {
+		t.Errorf("VerifySession: got %+v, %v", result, err)
+	}
+
+	payload, signature, _ := strings.Cut(token, ".")
+	other := &AttestationService{sessionSecret: []byte("other secret"), sessionTTL: 15 * time.Minute, validity: 24 * time.Hour, clock: fake}
+	otherToken, _, _ := other.IssueSession(valid)
+	tests := []struct {
+		name     string
+		token    string
+		deviceID string
+		want     error
+	}{
+		{"other device", token, "device-2", ErrInvalidSession},
+		{"tampered payload", payload + "x." + signature, "device-1", ErrInvalidSession},
+		{"other secret", otherToken, "device-1", ErrInvalidSession},
+		{"not a token", "session", "device-1", ErrInvalidSession},
+	}
+	for _, tt := range tests {
+		if _, err := svc.VerifySession(tt.token, tt.deviceID); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// A downgrade outlives the attestation it was found in
+	downgraded := *valid
+	downgraded.DeviceIntegrity, downgraded.Downgraded = "MEETS_BASIC_INTEGRITY", true
+	downgradedToken, _, _ := svc.IssueSession(&downgraded)
+	if result, err := svc.VerifySession(downgradedToken, "device-1"); err != nil || !result.Downgraded {
+		t.Errorf("VerifySession of a downgrade: got %+v, %v", result, err)
+	}
+
+	fake.Advance(15 * time.Minute)
+	if _, err := svc.VerifySession(token, "device-1"); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("expired: got %v", err)
+	}
+}
+
+func TestIssueSession_OnlyForValidAttestations(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := &AttestationService{sessionSecret: []byte("secret"), sessionTTL: time.Hour, validity: 10 * time.Minute, clock: clock.NewFake(now)}
+
+	if _, _, ok := svc.IssueSession(&AttestationResult{IsValid: false, DeviceID: "device-1", Reason: "device_integrity_failed"}); ok {
+		t.Error("failed attestation got a session")
+	}
+	if _, _, ok := svc.IssueSession(nil); ok {
+		t.Error("nil result got a session")
+	}
+	// A session never outlives the attestation it vouches for
+	if _, expires, ok := svc.IssueSession(&AttestationResult{IsValid: true, DeviceID: "device-1"}); !ok || !expires.Equal(now.Add(10*time.Minute)) {
+		t.Errorf("got %v, %v; want expiry at the attestation's validity", expires, ok)
+	}
+}
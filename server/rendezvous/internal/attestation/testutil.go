@@ -0,0 +1,57 @@
+package attestation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	playintegrity "google.golang.org/api/playintegrity/v1"
+)
+
+// FakePlayIntegrity is a PlayIntegrityDecoder that answers every token with
+// the same payload, so the Android path can be tested without Google
+// credentials or the bypass. Payload is returned as set, nil included; set
+// Err to fail the call instead.
+type FakePlayIntegrity struct {
+	Payload *playintegrity.TokenPayloadExternal
+	Err     error
+
+	mu     sync.Mutex
+	tokens []string
+}
+
+// NewFakePlayIntegrity returns a fake whose payload passes every check for
+// packageName: issued at issuedAt, recognized by Play, licensed and
+// reporting the given device verdicts. Tests change the payload's fields to
+// fail the check they cover.
+func NewFakePlayIntegrity(packageName string, issuedAt time.Time, verdicts ...string) *FakePlayIntegrity {
+	return &FakePlayIntegrity{
+		Payload: &playintegrity.TokenPayloadExternal{
+			RequestDetails: &playintegrity.RequestDetails{
+				RequestPackageName: packageName,
+				TimestampMillis:    issuedAt.UnixMilli(),
+			},
+			AppIntegrity:    &playintegrity.AppIntegrity{AppRecognitionVerdict: "PLAY_RECOGNIZED"},
+			AccountDetails:  &playintegrity.AccountDetails{AppLicensingVerdict: "LICENSED"},
+			DeviceIntegrity: &playintegrity.DeviceIntegrity{DeviceRecognitionVerdict: verdicts},
+		},
+	}
+}
+
+// DecodeIntegrityToken records token and returns the fake's payload or error
+func (f *FakePlayIntegrity) DecodeIntegrityToken(_ context.Context, _, token string) (*playintegrity.TokenPayloadExternal, error) {
+	f.mu.Lock()
+	f.tokens = append(f.tokens, token)
+	f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return f.Payload, nil
+}
+
+// Tokens returns the tokens decoded so far, in order
+func (f *FakePlayIntegrity) Tokens() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.tokens...)
+}
@@ -0,0 +1,58 @@
+package attestation
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/metrics"
+	"rendezvous/internal/store"
+)
+
+// ErrTooManyVerifications is returned for an attestation from a device
+// already over its verification budget
+var ErrTooManyVerifications = apperr.New(apperr.ErrRateLimited, "too_many_verifications", "too many attestation verifications for this device")
+
+// VerificationLimit caps the attestations verified for one device, however
+// many addresses it sends them from, since each can cost an upstream call.
+// A device can be verified PerHour times at once, then again about as
+// quickly as an hour's budget refills.
+type VerificationLimit struct {
+	PerHour int // Verifications per device; 0 disables
+}
+
+// LoadVerificationLimitFromEnv reads
+// LUMENLINK_ATTEST_MAX_VERIFICATIONS_PER_DEVICE_PER_HOUR (default 10).
+func LoadVerificationLimitFromEnv() VerificationLimit {
+	return VerificationLimit{
+		PerHour: envInt("LUMENLINK_ATTEST_MAX_VERIFICATIONS_PER_DEVICE_PER_HOUR", 10, 0),
+	}
+}
+
+// SetVerificationRates counts the verifications of each device in
+// rateLimits; without it verifications are not limited.
+func (s *AttestationService) SetVerificationRates(rateLimits store.RateLimitStore) {
+	s.verificationRates = rateLimits
+}
+
+// allowVerification counts an attestation from req's device and returns
+// ErrTooManyVerifications if the device is over its limit. Bypassed devices
+// are counted like any other. When the rate store is unreachable
+// attestations are verified rather than failing with it.
+func (s *AttestationService) allowVerification(ctx context.Context, req *AttestationRequest) error {
+	if s.verificationRates == nil || s.verificationLimit.PerHour == 0 || req.DeviceID == "" {
+		return nil
+	}
+	limit := store.Limit{Burst: s.verificationLimit.PerHour, Interval: time.Hour / time.Duration(s.verificationLimit.PerHour)}
+	allowed, err := s.verificationRates.Allow(ctx, "attest_verify:device:"+req.DeviceID, limit)
+	if err != nil {
+		log.Printf("verification rate store unavailable, verifying attestation: %v", err)
+		return nil
+	}
+	if !allowed {
+		metrics.AttestationRateLimited.WithLabelValues(req.Platform).Inc()
+		return ErrTooManyVerifications
+	}
+	return nil
+}
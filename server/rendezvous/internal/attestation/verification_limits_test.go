@@ -0,0 +1,130 @@
+package attestation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+	"rendezvous/internal/store"
+)
+
+func TestVerifyAttestation_DeviceLimit(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	memory := store.NewMemory()
+	memory.SetClock(fake)
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc := NewAttestationService(db.NewFromPool(sqlDB))
+	svc.verificationLimit = VerificationLimit{PerHour: 3}
+	svc.SetVerificationRates(memory)
+	allow := func(deviceID string) error {
+		return svc.allowVerification(ctx, &AttestationRequest{Platform: "android", DeviceID: deviceID})
+	}
+	limited := testutil.ToFloat64(metrics.AttestationRateLimited.WithLabelValues("android"))
+
+	for i := 0; i < 3; i++ {
+		if err := allow("device-1"); err != nil {
+			t.Fatalf("verification %d: %v", i+1, err)
+		}
+	}
+	// Refused before anything is verified or stored, bypassed devices too
+	svc.allowBypass = true
+	mock.ExpectQuery(`FROM revoked_devices`).WithArgs("device-1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	result, err := svc.VerifyAttestation(ctx, &AttestationRequest{Platform: "android", Token: "token", DeviceID: "device-1"})
+	if !errors.Is(err, ErrTooManyVerifications) || result != nil {
+		t.Errorf("device over its limit: got %+v, %v", result, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if err := allow("device-2"); err != nil {
+		t.Errorf("another device: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.AttestationRateLimited.WithLabelValues("android")) - limited; got != 1 {
+		t.Errorf("rate limited delta: got %v, want 1", got)
+	}
+
+	// A third of an hour refills one verification
+	fake.Advance(19 * time.Minute)
+	if err := allow("device-1"); !errors.Is(err, ErrTooManyVerifications) {
+		t.Errorf("before the refill: got %v", err)
+	}
+	fake.Advance(time.Minute)
+	if err := allow("device-1"); err != nil {
+		t.Errorf("after the refill: %v", err)
+	}
+
+	// Without a rate store nothing is limited
+	svc.SetVerificationRates(nil)
+	for i := 0; i < 5; i++ {
+		if err := allow("device-1"); err != nil {
+			t.Fatalf("unlimited verification %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestVerifyAttestation_LimitAfterRevocation(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc := NewAttestationService(db.NewFromPool(sqlDB))
+	svc.verificationLimit = VerificationLimit{PerHour: 1}
+	svc.SetVerificationRates(store.NewMemory())
+	hits := metrics.RevokedDeviceHits.WithLabelValues("attestation")
+	limited := metrics.AttestationRateLimited.WithLabelValues("android")
+	beforeHits, beforeLimited := testutil.ToFloat64(hits), testutil.ToFloat64(limited)
+
+	// A revoked device's retries fail as revoked, however many there are
+	for i := 0; i < 3; i++ {
+		mock.ExpectQuery(`FROM revoked_devices`).WithArgs("device-revoked").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		result, err := svc.VerifyAttestation(ctx, &AttestationRequest{Platform: "android", Token: "token", DeviceID: "device-revoked"})
+		if err != nil || result.Reason != "device_revoked" {
+			t.Fatalf("revoked attempt %d: got %+v, %v", i+1, result, err)
+		}
+	}
+	// Unsupported platforms are refused without being counted either
+	mock.ExpectQuery(`FROM revoked_devices`).WithArgs("device-1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	if result, err := svc.VerifyAttestation(ctx, &AttestationRequest{Platform: "web", Token: "token", DeviceID: "device-1"}); err != nil || result.Reason != "unsupported_platform" {
+		t.Errorf("unsupported platform: got %+v, %v", result, err)
+	}
+	if got := testutil.ToFloat64(hits) - beforeHits; got != 3 {
+		t.Errorf("revoked device hits delta: got %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(limited) - beforeLimited; got != 0 {
+		t.Errorf("rate limited delta: got %v, want 0", got)
+	}
+	for _, deviceID := range []string{"device-revoked", "device-1"} {
+		if err := svc.allowVerification(ctx, &AttestationRequest{Platform: "android", DeviceID: deviceID}); err != nil {
+			t.Errorf("%s budget used: %v", deviceID, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadVerificationLimitFromEnv(t *testing.T) {
+	if limit := LoadVerificationLimitFromEnv(); limit != (VerificationLimit{PerHour: 10}) {
+		t.Errorf("default: got %+v", limit)
+	}
+	t.Setenv("LUMENLINK_ATTEST_MAX_VERIFICATIONS_PER_DEVICE_PER_HOUR", "0")
+	if limit := LoadVerificationLimitFromEnv(); limit != (VerificationLimit{}) {
+		t.Errorf("disabled: got %+v", limit)
+	}
+}
@@ -2,24 +2,33 @@ package attestation
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 	playintegrity "google.golang.org/api/playintegrity/v1"
 
+	"github.com/bas-d/appattest/assertion"
 	"github.com/bas-d/appattest/attestation"
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/clock"
 	"rendezvous/internal/db"
 	"rendezvous/internal/metrics"
+	"rendezvous/internal/store"
 )
 
 // AttestationResult represents the result of attestation verification
@@ -30,73 +39,260 @@ type AttestationResult struct {
 	DeviceID       string
 	Timestamp      time.Time
 	Reason         string // If invalid, reason for failure
+	Downgraded     bool   // Weaker integrity than the device's previous attestation
+	KeyID          string // The App Attest key of an iOS attestation or assertion
+	RiskScore      float64 // From 0 (no sign of risk) to 1; see ScoreRisk
+
+	// Decisions made on the attestation when a config pack is built for the
+	// device
+	Probation  bool // Valid, but the device has not yet earned the trusted tier
+	Unattested bool // No attestation; only Honeypots applies
+	Honeypots  bool // The honeypot policy's decision for the device
+
+	tokenIssued time.Time // When the Play Integrity token was requested
+	licensing   string    // The Play licensing verdict
 }
 
 // AttestationRequest represents an attestation verification request
 type AttestationRequest struct {
-	Platform  string `json:"platform"`  // "android" or "ios"
+	Platform  string `json:"platform"`  // "android", "ios" or "desktop"
 	Token     string `json:"token"`      // Play Integrity token or DCAppAttest token
 	DeviceID  string `json:"device_id"`
 	KeyID     string `json:"key_id"`    // For iOS DCAppAttest
+	Region    string `json:"region"`    // Region the device is served from, for per-region policy
+	// RequestType is the Play Integrity request flow the token came from:
+	// "classic" (the default) or "standard"
+	RequestType string `json:"request_type"`
+	// Environment is the App Attest environment an iOS token came from:
+	// "production" or "development"; empty uses APPLE_PRODUCTION
+	Environment string `json:"environment"`
+	// BundleID is the iOS app's bundle ID; empty is APPLE_BUNDLE_ID
+	BundleID string `json:"bundle_id"`
+	// TokenType is what an Android token is: "play_integrity" (the
+	// default) or "key_attestation"
+	TokenType string `json:"token_type"`
+	// ClientIP and ClientRegion are where the request came from, as the
+	// server saw it, stored with the attestation record
+	ClientIP     string `json:"-"`
+	ClientRegion string `json:"-"`
+}
+
+// App Attest environments
+const (
+	AppAttestProduction  = "production"
+	AppAttestDevelopment = "development"
+)
+
+// Play Integrity request types
+const (
+	RequestTypeClassic  = "classic"
+	RequestTypeStandard = "standard"
+)
+
+// playIntegrityRequestType returns a request's Play Integrity request type,
+// classic when unset
+func playIntegrityRequestType(req *AttestationRequest) string {
+	if req.RequestType == "" {
+		return RequestTypeClassic
+	}
+	return req.RequestType
+}
+
+// countPlayIntegrityRequest counts an Android attestation's result by its
+// request type; requests of an unknown type are not counted
+func countPlayIntegrityRequest(req *AttestationRequest, result string) {
+	if req.Platform != "android" || androidTokenType(req) != TokenTypePlayIntegrity {
+		return
+	}
+	switch requestType := playIntegrityRequestType(req); requestType {
+	case RequestTypeClassic, RequestTypeStandard:
+		metrics.PlayIntegrityRequests.WithLabelValues(requestType, result).Inc()
+	}
 }
 
 // AttestationService handles remote attestation verification
 type AttestationService struct {
 	db *db.Database
-	// In production, these would be API clients for Play Integrity and DCAppAttest
-	playIntegrityClient          *playintegrity.Service
+	playIntegrityClient          PlayIntegrityDecoder // The Play Integrity API, created on first use
 	playIntegrityInitOnce        sync.Once
 	playIntegrityInitErr         error
 	playIntegrityPackageName     string
-	playIntegrityAllowBasic      bool
-	playIntegrityRequireLicensed bool
-	playIntegrityMaxAge          time.Duration
 	playIntegrityCredentialsFile string
 	playIntegrityCredentialsJSON string
+	playIntegrityDecoder         PlayIntegrityDecoder // Replaces the Google API when set
+	playIntegrityLocal           *localPlayIntegrity  // Decodes tokens without the Google API; nil without keys
+	keyAttestation               *keyAttestation      // Verifies keystore attestations; nil without roots and digests
+
+	appleTeamID   string
+	appleBundleID string
+	allowBypass   bool            // Bypass every device when verification is not configured
+	bypassDevices map[string]bool // Devices that are never verified
+	receipts      ReceiptExchanger // Refreshes App Attest receipts; nil when no developer key is configured
+
+	policy    Policy         // Which attestations are accepted
+	honeypots HoneypotPolicy // Which devices are given honeypots
+	risk      RiskPolicy     // How risk scores are computed
+
+	pool  *Pool // Bounds upstream verifications
+	clock clock.Clock
+
+	challenges      store.ChallengeStore // Issued challenges; nil leaves them unchecked
+	challengeTTL    time.Duration
+	challengeRates  store.RateLimitStore // Counts challenges against the limits; nil leaves them unlimited
+	challengeLimits ChallengeLimits
+
+	verificationRates store.RateLimitStore // Counts verifications against the limit; nil leaves them unlimited
+	verificationLimit VerificationLimit
 
-	appleTeamID     string
-	appleBundleID   string
-	appleProduction bool
-	allowBypass     bool
+	validity time.Duration // How long a stored valid attestation vouches for its device
+
+	sessionSecret []byte        // Signs session tokens; random per process unless configured
+	sessionTTL    time.Duration // How long a session token vouches for its device
+
+	failureAlerts *FailureAlerter // Notifies of devices failing repeatedly; nil disables
+	clientIPKey   []byte          // Hashes stored client addresses; nil stores them as seen
 }
 
-// NewAttestationService creates a new attestation service
-func NewAttestationService(database *db.Database) *AttestationService {
-	playIntegrityMaxAge := 5 * time.Minute
-	if maxAge := strings.TrimSpace(os.Getenv("PLAY_INTEGRITY_MAX_AGE_SECONDS")); maxAge != "" {
-		if seconds, err := strconv.Atoi(maxAge); err == nil && seconds > 0 {
-			playIntegrityMaxAge = time.Duration(seconds) * time.Second
-		}
+// NewAttestationService creates a new attestation service with the policy
+// read from the environment, unless an option replaces it
+func NewAttestationService(database *db.Database, opts ...Option) *AttestationService {
+	challengeTTL := 5 * time.Minute
+	if ttl, err := time.ParseDuration(strings.TrimSpace(os.Getenv("LUMENLINK_ATTEST_CHALLENGE_TTL"))); err == nil && ttl > 0 {
+		challengeTTL = ttl
+	}
+	validity := 24 * time.Hour
+	if v, err := time.ParseDuration(strings.TrimSpace(os.Getenv("LUMENLINK_ATTESTATION_VALIDITY"))); err == nil && v > 0 {
+		validity = v
+	}
+	sessionTTL := 15 * time.Minute
+	if ttl, err := time.ParseDuration(strings.TrimSpace(os.Getenv("LUMENLINK_ATTESTATION_SESSION_TTL"))); err == nil && ttl > 0 {
+		sessionTTL = ttl
 	}
 
-	return &AttestationService{
+	s := &AttestationService{
 		db:                          database,
 		playIntegrityPackageName:     strings.TrimSpace(os.Getenv("PLAY_INTEGRITY_PACKAGE_NAME")),
-		playIntegrityAllowBasic:      strings.ToLower(os.Getenv("PLAY_INTEGRITY_ALLOW_BASIC")) == "true",
-		playIntegrityRequireLicensed: strings.ToLower(os.Getenv("PLAY_INTEGRITY_REQUIRE_LICENSED")) != "false",
-		playIntegrityMaxAge:          playIntegrityMaxAge,
 		playIntegrityCredentialsFile: strings.TrimSpace(os.Getenv("PLAY_INTEGRITY_CREDENTIALS_FILE")),
 		playIntegrityCredentialsJSON: strings.TrimSpace(os.Getenv("PLAY_INTEGRITY_CREDENTIALS_JSON")),
+		playIntegrityLocal:           newLocalPlayIntegrityFromEnv(),
+		keyAttestation:               newKeyAttestationFromEnv(),
 		appleTeamID:     strings.TrimSpace(os.Getenv("APPLE_TEAM_ID")),
 		appleBundleID:   strings.TrimSpace(os.Getenv("APPLE_BUNDLE_ID")),
-		appleProduction: strings.ToLower(os.Getenv("APPLE_PRODUCTION")) != "false",
 		allowBypass:     envAllowsBypass(),
+		bypassDevices:   LoadBypassDeviceIDsFromEnv(),
+		policy:          LoadPolicyFromEnv(),
+		honeypots:       LoadHoneypotPolicyFromEnv(),
+		risk:            LoadRiskPolicyFromEnv(),
+		pool:            NewPool(LoadPoolConfigFromEnv()),
+		clock:           clock.Real{},
+		challengeTTL:    challengeTTL,
+		challengeLimits: LoadChallengeLimitsFromEnv(),
+		validity:        validity,
+		sessionSecret:   loadSessionSecret(),
+		sessionTTL:      sessionTTL,
+		failureAlerts:   LoadFailureAlerterFromEnv(database),
+		clientIPKey:     loadClientIPKey(),
+
+		verificationLimit: LoadVerificationLimitFromEnv(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if len(s.bypassDevices) > 0 {
+		log.Printf("WARNING: attestation is bypassed for %d devices listed in LUMENLINK_ATTESTATION_BYPASS_DEVICE_IDS", len(s.bypassDevices))
+	}
+	if s.receipts == nil {
+		if client := newAppleReceiptClientFromEnv(s.appleTeamID, s.policy.AppleProduction); client != nil {
+			s.receipts = client
+		}
 	}
+	return s
+}
+
+// SetChallenges keeps issued challenges in challenges, so an App Attest
+// attestation or assertion, or a Play Integrity token's requestHash, is only
+// accepted over a challenge this deployment issued and each challenge is
+// used once.
+func (s *AttestationService) SetChallenges(challenges store.ChallengeStore) {
+	s.challenges = challenges
+}
+
+// PlayIntegrityDecoder decodes a Play Integrity token into the verdicts
+// Google reports for it.
+type PlayIntegrityDecoder interface {
+	DecodeIntegrityToken(ctx context.Context, packageName, token string) (*playintegrity.TokenPayloadExternal, error)
 }
 
-// VerifyAttestation verifies a device attestation token
+// SetPlayIntegrityDecoder decodes tokens with decoder instead of the Play
+// Integrity API, so verdicts go through the same checks without Google
+// credentials; it is intended for tests.
+func (s *AttestationService) SetPlayIntegrityDecoder(decoder PlayIntegrityDecoder) {
+	s.playIntegrityDecoder = decoder
+}
+
+// WithPlayIntegrityDecoder is the option form of SetPlayIntegrityDecoder
+func WithPlayIntegrityDecoder(decoder PlayIntegrityDecoder) Option {
+	return func(s *AttestationService) {
+		s.playIntegrityDecoder = decoder
+	}
+}
+
+// googlePlayIntegrity decodes tokens with the Play Integrity API
+type googlePlayIntegrity struct {
+	service *playintegrity.Service
+	clock   clock.Clock
+}
+
+func (g googlePlayIntegrity) DecodeIntegrityToken(ctx context.Context, packageName, token string) (*playintegrity.TokenPayloadExternal, error) {
+	started := g.clock.Now()
+	response, err := g.service.V1.DecodeIntegrityToken(
+		packageName,
+		&playintegrity.DecodeIntegrityTokenRequest{IntegrityToken: token},
+	).Context(ctx).Do()
+	metrics.PlayIntegrityAPIDuration.Observe(g.clock.Now().Sub(started).Seconds())
+	if err != nil {
+		return nil, err
+	}
+	return response.TokenPayloadExternal, nil
+}
+
+// SetClock replaces the time source token ages are judged by; it is intended
+// for tests.
+func (s *AttestationService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// VerifyAttestation verifies a device attestation token. Upstream
+// verifications run through the service's pool; bypassed and malformed
+// requests do not take a slot. When the pool is saturated it returns
+// ErrAttestationBusy and a nil result. Revoked devices fail without their
+// token being verified. Other devices over their verification limit get
+// ErrTooManyVerifications and a nil result, bypassed ones included.
 func (s *AttestationService) VerifyAttestation(
 	ctx context.Context,
 	req *AttestationRequest,
 ) (*AttestationResult, error) {
-	var result *AttestationResult
-	var err error
+	if s.deviceRevoked(ctx, req.DeviceID) {
+		metrics.RevokedDeviceHits.WithLabelValues("attestation").Inc()
+		metrics.AttestationTotal.WithLabelValues(req.Platform, "invalid").Inc()
+		metrics.AttestationFailures.WithLabelValues(req.Platform, "device_revoked").Inc()
+		return &AttestationResult{
+			IsValid:   false,
+			Platform:  req.Platform,
+			DeviceID:  req.DeviceID,
+			Timestamp: s.clock.Now(),
+			Reason:    "device_revoked",
+		}, nil
+	}
 
+	var verify func(context.Context, *AttestationRequest) (*AttestationResult, error)
 	switch req.Platform {
 	case "android":
-		result, err = s.verifyPlayIntegrity(ctx, req)
+		verify = s.verifyAndroid
 	case "ios":
-		result, err = s.verifyDCAppAttest(ctx, req)
+		verify = s.verifyDCAppAttest
+	case "desktop":
+		verify = s.verifyDesktopStatement
 	default:
 		metrics.AttestationTotal.WithLabelValues(req.Platform, "invalid").Inc()
 		metrics.AttestationFailures.WithLabelValues(req.Platform, "unsupported_platform").Inc()
@@ -106,31 +302,105 @@ func (s *AttestationService) VerifyAttestation(
 		}, nil
 	}
 
+	// Only attestations that go on to be verified count against the limit
+	if err := s.allowVerification(ctx, req); err != nil {
+		return nil, err
+	}
+	started := s.clock.Now()
+	result, err := verify(ctx, req)
+
+	if errors.Is(err, ErrAttestationBusy) {
+		// Shed before verifying: nothing to count or store
+		return nil, err
+	}
+	elapsed := s.clock.Now().Sub(started).Seconds()
 	if err != nil {
+		metrics.AttestationDuration.WithLabelValues(req.Platform, "error").Observe(elapsed)
 		metrics.AttestationTotal.WithLabelValues(req.Platform, "error").Inc()
+		countPlayIntegrityRequest(req, "error")
 		metrics.AttestationFailures.WithLabelValues(req.Platform, "verification_error").Inc()
-		return &AttestationResult{
-			IsValid: false,
-			Reason:  "verification_error",
-		}, err
+		failed := &AttestationResult{
+			IsValid:   false,
+			Platform:  req.Platform,
+			DeviceID:  req.DeviceID,
+			Timestamp: s.clock.Now(),
+			Reason:    "verification_error",
+		}
+		// Stored and counted like any failure, so errors cannot be used to
+		// attempt verifications that leave no trace
+		if storeErr := s.storeAttestation(ctx, req, failed); storeErr != nil {
+			log.Printf("attestation store failed for device=%s platform=%s: %v", req.DeviceID, req.Platform, storeErr)
+		}
+		s.failureAlerts.RecordFailure(req.DeviceID, req.Platform, failed.Reason)
+		return failed, err
 	}
 
 	if result.IsValid {
+		metrics.AttestationDuration.WithLabelValues(req.Platform, "valid").Observe(elapsed)
 		metrics.AttestationTotal.WithLabelValues(req.Platform, "valid").Inc()
+		countPlayIntegrityRequest(req, "valid")
 	} else {
+		metrics.AttestationDuration.WithLabelValues(req.Platform, "invalid").Observe(elapsed)
 		metrics.AttestationTotal.WithLabelValues(req.Platform, "invalid").Inc()
+		countPlayIntegrityRequest(req, "invalid")
 		metrics.AttestationFailures.WithLabelValues(req.Platform, result.Reason).Inc()
 	}
 
+	// Compared before storing, so the device's previous verdict is the latest
+	s.checkDowngrade(ctx, req, result)
+	s.scoreRisk(ctx, req, result)
+
 	// Store attestation record in database
 	if err := s.storeAttestation(ctx, req, result); err != nil {
 		// Log error but don't fail verification
 		log.Printf("attestation store failed for device=%s platform=%s: %v", req.DeviceID, req.Platform, err)
 	}
+	if !result.IsValid {
+		// Counted from the stored failures, in the background
+		s.failureAlerts.RecordFailure(req.DeviceID, req.Platform, result.Reason)
+	}
 
 	return result, nil
 }
 
+// deviceRevoked reports whether a device is on the revocation list. A failed
+// lookup is logged and the device verified as usual, so an outage of the
+// list does not fail every attestation.
+func (s *AttestationService) deviceRevoked(ctx context.Context, deviceID string) bool {
+	if deviceID == "" {
+		return false
+	}
+	revoked, err := s.db.IsDeviceRevoked(ctx, deviceID)
+	if err != nil {
+		log.Printf("device revocation check failed for device=%s: %v", deviceID, err)
+		return false
+	}
+	return revoked
+}
+
+// checkDowngrade flags a result whose integrity verdict is weaker than the
+// one the device's previous verified attestation reported. A device that
+// reported strong integrity and now reports basic has likely been tampered
+// with or is an emulator replaying its identity. A failed lookup is logged
+// and the result left unflagged.
+func (s *AttestationService) checkDowngrade(ctx context.Context, req *AttestationRequest, result *AttestationResult) {
+	if req.DeviceID == "" || result.DeviceIntegrity == "" || result.DeviceIntegrity == "BYPASS_ENABLED" {
+		return
+	}
+	previous, err := s.db.GetLastDeviceIntegrity(ctx, req.DeviceID, req.Platform)
+	if errors.Is(err, db.ErrAttestationNotFound) {
+		return
+	}
+	if err != nil {
+		log.Printf("device integrity history lookup failed for device=%s: %v", req.DeviceID, err)
+		return
+	}
+	if integrityRanks[result.DeviceIntegrity] < integrityRanks[previous] {
+		result.Downgraded = true
+		metrics.AttestationDowngrades.WithLabelValues(req.Platform, previous, result.DeviceIntegrity).Inc()
+	}
+}
+
 // verifyPlayIntegrity verifies Android Play Integrity API token
 func (s *AttestationService) verifyPlayIntegrity(
 	ctx context.Context,
@@ -139,31 +409,42 @@ func (s *AttestationService) verifyPlayIntegrity(
 	result := &AttestationResult{
 		Platform:  "android",
 		DeviceID:  req.DeviceID,
-		Timestamp: time.Now(),
+		Timestamp: s.clock.Now(),
 	}
 
-	if err := s.initPlayIntegrityClient(ctx); err != nil {
+	requestType := playIntegrityRequestType(req)
+	if requestType != RequestTypeClassic && requestType != RequestTypeStandard {
+		result.IsValid = false
+		result.Reason = "invalid_request_type"
+		return result, nil
+	}
+	standard := requestType == RequestTypeStandard
+	if s.bypassDevices[req.DeviceID] {
+		return bypassed(result), nil
+	}
+
+	decoder, err := s.playIntegrity(ctx)
+	if err != nil {
 		if s.allowBypass {
-			result.IsValid = true
-			result.DeviceIntegrity = "BYPASS_ENABLED"
-			return result, nil
+			return bypassed(result), nil
 		}
 		result.IsValid = false
 		result.Reason = "play_integrity_not_configured"
 		return result, nil
 	}
 
-	response, err := s.playIntegrityClient.V1.DecodeIntegrityToken(
-		s.playIntegrityPackageName,
-		&playintegrity.DecodeIntegrityTokenRequest{IntegrityToken: req.Token},
-	).Do()
+	var payload *playintegrity.TokenPayloadExternal
+	if poolErr := s.pool.Do(ctx, func() {
+		payload, err = decoder.DecodeIntegrityToken(ctx, s.playIntegrityPackageName, req.Token)
+	}); poolErr != nil {
+		return result, poolErr
+	}
 	if err != nil {
 		result.IsValid = false
 		result.Reason = "play_integrity_api_error"
-		return result, err
+		return result, playIntegrityError(err)
 	}
 
-	payload := response.TokenPayloadExternal
 	if payload == nil || payload.RequestDetails == nil {
 		result.IsValid = false
 		result.Reason = "missing_token_payload"
@@ -177,23 +458,59 @@ func (s *AttestationService) verifyPlayIntegrity(
 		return result, nil
 	}
 
-	if payload.RequestDetails.TimestampMillis != 0 {
-		tokenTime := time.UnixMilli(payload.RequestDetails.TimestampMillis)
-		if time.Since(tokenTime) > s.playIntegrityMaxAge {
+	// A token bound to a challenge issued to this device cannot be replayed
+	// from another. Until the flag is set, classic tokens without a
+	// requestHash are let through for clients that predate binding. Standard
+	// tokens carry no nonce, so the requestHash is their only binding and is
+	// always required; without a challenge store none can be checked.
+	requestHash := payload.RequestDetails.RequestHash
+	if standard || (s.challenges != nil && (requestHash != "" || s.policy.RequireRequestHash)) {
+		issued := false
+		if requestHash != "" && s.challenges != nil {
+			issued, err = s.consumeChallenge(ctx, req.DeviceID, requestHash)
+			if err != nil {
+				return result, fmt.Errorf("failed to check challenge: %w", apperr.WithKind(apperr.ErrUnavailable, err))
+			}
+		}
+		if !issued {
 			result.IsValid = false
-			result.Reason = "attestation_expired"
+			result.Reason = "request_hash_mismatch"
 			return result, nil
 		}
 	}
 
+	if s.tokenExpired(payload.RequestDetails.TimestampMillis) {
+		result.IsValid = false
+		result.Reason = "attestation_expired"
+		return result, nil
+	}
+	if payload.RequestDetails.TimestampMillis != 0 {
+		result.tokenIssued = time.UnixMilli(payload.RequestDetails.TimestampMillis)
+	}
+
 	if payload.AppIntegrity == nil || payload.AppIntegrity.AppRecognitionVerdict != "PLAY_RECOGNIZED" {
 		result.IsValid = false
 		result.Reason = "app_not_recognized"
 		return result, nil
 	}
 
-	if s.playIntegrityRequireLicensed {
-		if payload.AccountDetails == nil || payload.AccountDetails.AppLicensingVerdict != "LICENSED" {
+	if !s.policy.allowsVersion(payload.AppIntegrity.VersionCode) {
+		result.IsValid = false
+		result.Reason = "app_version_not_allowed"
+		return result, nil
+	}
+
+	// Where Play is unavailable, sideloaded installs may be allowed.
+	// Standard tokens often carry no licensing verdict, so only an explicit
+	// UNLICENSED fails them.
+	if payload.AccountDetails != nil {
+		result.licensing = payload.AccountDetails.AppLicensingVerdict
+	}
+	// The region comes from where the request was seen, not the region the
+	// client asked for, which anyone can set to an exempt one
+	if s.policy.requiresLicense(req.ClientRegion) {
+		licensing := result.licensing
+		if (standard && licensing == "UNLICENSED") || (!standard && licensing != "LICENSED") {
 			result.IsValid = false
 			result.Reason = "app_not_licensed"
 			return result, nil
@@ -206,11 +523,7 @@ func (s *AttestationService) verifyPlayIntegrity(
 	}
 	result.DeviceIntegrity = bestDeviceIntegrity(verdicts)
 
-	if hasIntegrityVerdict(verdicts, "MEETS_STRONG_INTEGRITY") {
-		result.IsValid = true
-		return result, nil
-	}
-	if s.playIntegrityAllowBasic && hasIntegrityVerdict(verdicts, "MEETS_BASIC_INTEGRITY") {
+	if s.policy.meetsIntegrity(result.DeviceIntegrity) {
 		result.IsValid = true
 		return result, nil
 	}
@@ -221,6 +534,25 @@ func (s *AttestationService) verifyPlayIntegrity(
 	return result, nil
 }
 
+// playIntegrity returns the decoder tokens are verified with: the injected
+// one if set, then local decoding when its keys are configured, and
+// otherwise the Play Integrity API
+func (s *AttestationService) playIntegrity(ctx context.Context) (PlayIntegrityDecoder, error) {
+	if s.playIntegrityDecoder != nil {
+		return s.playIntegrityDecoder, nil
+	}
+	if s.playIntegrityLocal != nil {
+		if s.playIntegrityPackageName == "" {
+			return nil, errors.New("missing package name")
+		}
+		return s.playIntegrityLocal, nil
+	}
+	if err := s.initPlayIntegrityClient(ctx); err != nil {
+		return nil, err
+	}
+	return s.playIntegrityClient, nil
+}
+
 // verifyDCAppAttest verifies iOS DCAppAttest token
 func (s *AttestationService) verifyDCAppAttest(
 	ctx context.Context,
@@ -229,7 +561,7 @@ func (s *AttestationService) verifyDCAppAttest(
 	result := &AttestationResult{
 		Platform:  "ios",
 		DeviceID:  req.DeviceID,
-		Timestamp: time.Now(),
+		Timestamp: s.clock.Now(),
 	}
 
 	if req.Token == "" {
@@ -238,18 +570,33 @@ func (s *AttestationService) verifyDCAppAttest(
 		return result, nil
 	}
 
-	appID := s.appleAppID()
-	if appID == "" {
+	if s.bypassDevices[req.DeviceID] {
+		return bypassed(result), nil
+	}
+
+	if s.appleAppID() == "" {
 		if s.allowBypass {
-			result.IsValid = true
-			result.DeviceIntegrity = "BYPASS_ENABLED"
-			return result, nil
+			return bypassed(result), nil
 		}
 		result.IsValid = false
 		result.Reason = "missing_dcappattest_config"
 		return result, nil
 	}
 
+	appID, production, reason := s.appAttestTarget(req)
+	if reason != "" {
+		result.IsValid = false
+		result.Reason = reason
+		return result, nil
+	}
+
+	var kind struct {
+		Assertion string `json:"assertion"`
+	}
+	if err := json.Unmarshal([]byte(req.Token), &kind); err == nil && kind.Assertion != "" {
+		return s.verifyAppAttestAssertion(ctx, req, appID, result)
+	}
+
 	var aar attestation.AuthenticatorAttestationResponse
 	if err := json.Unmarshal([]byte(req.Token), &aar); err != nil {
 		result.IsValid = false
@@ -257,21 +604,245 @@ func (s *AttestationService) verifyDCAppAttest(
 		return result, nil
 	}
 
-	publicKey, receipt, err := aar.Verify(appID, s.appleProduction)
+	if s.challenges != nil {
+		// The client data App Attest signs over is the challenge we issued.
+		// It is consumed before verifying, so a failed attempt needs a new one.
+		issued, err := s.consumeChallenge(ctx, req.DeviceID, ChallengeHash(string(aar.ClientData)))
+		if err != nil {
+			return result, fmt.Errorf("failed to check challenge: %w", apperr.WithKind(apperr.ErrUnavailable, err))
+		}
+		if !issued {
+			result.IsValid = false
+			result.Reason = "challenge_invalid"
+			return result, nil
+		}
+	}
+
+	var publicKey, receipt []byte
+	var err error
+	if poolErr := s.pool.Do(ctx, func() {
+		publicKey, receipt, err = aar.Verify(appID, production)
+	}); poolErr != nil {
+		return result, poolErr
+	}
 	if err != nil {
 		result.IsValid = false
 		result.Reason = "dcappattest_verification_failed"
+		return result, fmt.Errorf("failed to verify app attest token: %w", apperr.WithKind(apperr.ErrInvalidInput, err))
+	}
+
+	result.KeyID = aar.KeyID
+	// Later requests from the device can be checked with an assertion by
+	// this key; the receipt is kept for Apple's fraud metric
+	err = s.db.StoreAppAttestKey(ctx, &db.AppAttestKey{
+		KeyID:     aar.KeyID,
+		DeviceID:  req.DeviceID,
+		PublicKey: publicKey,
+		Receipt:   receipt,
+	})
+	if errors.Is(err, db.ErrAppAttestKeyConflict) {
+		s.flagSharedKey(ctx, aar.KeyID, req.DeviceID)
+		result.IsValid = false
+		result.Reason = "key_already_bound"
+		return result, nil
+	}
+	if err != nil {
+		// Log error but don't fail verification; the device attests again
+		// instead of asserting
+		log.Printf("app attest key store failed for device=%s: %v", req.DeviceID, err)
+	}
+
+	result.IsValid = true
+	result.DeviceIntegrity = "MEETS_STRONG_INTEGRITY"
+	return result, nil
+}
+
+// verifyAppAttestAssertion verifies an App Attest assertion: client data
+// signed by the key of an earlier attestation by the same device, with a
+// counter above any the key has used before
+func (s *AttestationService) verifyAppAttestAssertion(
+	ctx context.Context,
+	req *AttestationRequest,
+	appID string,
+	result *AttestationResult,
+) (*AttestationResult, error) {
+	if req.KeyID == "" {
+		result.IsValid = false
+		result.Reason = "missing_key_id"
+		return result, nil
+	}
+	result.KeyID = req.KeyID
+
+	var aar assertion.AuthenticatorAssertionResponse
+	var clientData assertion.ClientData
+	if err := json.Unmarshal([]byte(req.Token), &aar); err != nil {
+		result.IsValid = false
+		result.Reason = "invalid_assertion_format"
+		return result, nil
+	}
+	if err := json.Unmarshal(aar.RawClientData, &clientData); err != nil || clientData.Challenge == "" {
+		result.IsValid = false
+		result.Reason = "invalid_assertion_format"
+		return result, nil
+	}
+
+	if s.challenges != nil {
+		// As for attestations, consumed before verifying
+		issued, err := s.consumeChallenge(ctx, req.DeviceID, ChallengeHash(clientData.Challenge))
+		if err != nil {
+			return result, fmt.Errorf("failed to check challenge: %w", apperr.WithKind(apperr.ErrUnavailable, err))
+		}
+		if !issued {
+			result.IsValid = false
+			result.Reason = "challenge_invalid"
+			return result, nil
+		}
+	}
+
+	key, err := s.db.GetAppAttestKey(ctx, req.DeviceID, req.KeyID)
+	if errors.Is(err, db.ErrAppAttestKeyNotFound) {
+		result.IsValid = false
+		result.Reason = "unknown_key"
+		// Naming another device's key proves nothing without its signature,
+		// so unlike a verified attestation it flags no one
+		if _, err := s.db.GetAppAttestKeyDevice(ctx, req.KeyID); err == nil {
+			result.Reason = "key_already_bound"
+		}
+		return result, nil
+	}
+	if err != nil {
 		return result, err
 	}
 
-	_ = receipt // Store receipt for fraud assessment if needed
-	_ = publicKey // Store public key for assertion verification if needed
+	var counter uint32
+	if poolErr := s.pool.Do(ctx, func() {
+		counter, err = aar.Verify(clientData.Challenge, appID, key.Counter, key.PublicKey)
+	}); poolErr != nil {
+		return result, poolErr
+	}
+	if err != nil {
+		result.IsValid = false
+		result.Reason = "assertion_verification_failed"
+		return result, fmt.Errorf("failed to verify app attest assertion: %w", apperr.WithKind(apperr.ErrInvalidInput, err))
+	}
+
+	advanced, err := s.db.AdvanceAppAttestCounter(ctx, req.DeviceID, req.KeyID, counter)
+	if err != nil {
+		return result, err
+	}
+	if !advanced {
+		// Another request used this counter since the key was read
+		result.IsValid = false
+		result.Reason = "assertion_replayed"
+		return result, nil
+	}
 
 	result.IsValid = true
 	result.DeviceIntegrity = "MEETS_STRONG_INTEGRITY"
 	return result, nil
 }
 
+// desktopStatement is a desktop attestation token: an issued challenge and
+// the device's Ed25519 signature over it
+type desktopStatement struct {
+	Challenge string `json:"challenge"`
+	Signature []byte `json:"signature"` // Base64 in JSON
+}
+
+// EnrollDesktopKey records the Ed25519 key a desktop client generated at
+// install time. Later desktop attestations by the device must be signed by it.
+func (s *AttestationService) EnrollDesktopKey(ctx context.Context, deviceID string, publicKey []byte) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return apperr.New(apperr.ErrInvalidInput, "invalid_public_key", "public key must be 32 bytes")
+	}
+	return s.db.EnrollDesktopKey(ctx, deviceID, publicKey)
+}
+
+// verifyDesktopStatement verifies a desktop client's signed statement.
+// Desktops have no hardware-backed attestation, so a valid statement shows
+// only that the request comes from the install that enrolled the key; it
+// reaches MEETS_DEVICE_INTEGRITY at best.
+func (s *AttestationService) verifyDesktopStatement(
+	ctx context.Context,
+	req *AttestationRequest,
+) (*AttestationResult, error) {
+	result := &AttestationResult{
+		Platform:  "desktop",
+		DeviceID:  req.DeviceID,
+		Timestamp: s.clock.Now(),
+	}
+
+	if req.Token == "" {
+		result.IsValid = false
+		result.Reason = "missing_token"
+		return result, nil
+	}
+
+	var statement desktopStatement
+	if err := json.Unmarshal([]byte(req.Token), &statement); err != nil || statement.Challenge == "" {
+		result.IsValid = false
+		result.Reason = "invalid_statement_format"
+		return result, nil
+	}
+
+	if s.challenges != nil {
+		// As for App Attest, consumed before verifying
+		issued, err := s.consumeChallenge(ctx, req.DeviceID, ChallengeHash(statement.Challenge))
+		if err != nil {
+			return result, fmt.Errorf("failed to check challenge: %w", apperr.WithKind(apperr.ErrUnavailable, err))
+		}
+		if !issued {
+			result.IsValid = false
+			result.Reason = "challenge_invalid"
+			return result, nil
+		}
+	}
+
+	publicKey, err := s.db.GetDesktopKey(ctx, req.DeviceID)
+	if errors.Is(err, db.ErrDesktopKeyNotFound) {
+		result.IsValid = false
+		result.Reason = "device_not_enrolled"
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if !ed25519.Verify(publicKey, []byte(statement.Challenge), statement.Signature) {
+		result.IsValid = false
+		result.Reason = "desktop_signature_invalid"
+		return result, nil
+	}
+
+	result.IsValid = true
+	result.DeviceIntegrity = "MEETS_DEVICE_INTEGRITY"
+	return result, nil
+}
+
+// tokenExpired reports whether a Play Integrity token requested at
+// timestampMillis is older than the maximum age. A token exactly at the
+// maximum age is still accepted; one without a timestamp never expires.
+func (s *AttestationService) tokenExpired(timestampMillis int64) bool {
+	if timestampMillis == 0 {
+		return false
+	}
+	return s.clock.Now().Sub(time.UnixMilli(timestampMillis)) > s.policy.MaxAge
+}
+
+// playIntegrityError classifies a failed DecodeIntegrityToken call: Google
+// rejecting the token itself is invalid input, anything else (including our
+// own credentials being refused) leaves attestation unavailable.
+func playIntegrityError(err error) error {
+	if errors.Is(err, ErrInvalidIntegrityToken) {
+		return err
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest {
+		return fmt.Errorf("play integrity rejected token: %w", apperr.WithKind(apperr.ErrInvalidInput, err))
+	}
+	return fmt.Errorf("play integrity request failed: %w", apperr.WithKind(apperr.ErrUnavailable, err))
+}
+
 func (s *AttestationService) appleAppID() string {
 	if s.appleTeamID == "" || s.appleBundleID == "" {
 		return ""
@@ -279,13 +850,90 @@ func (s *AttestationService) appleAppID() string {
 	return s.appleTeamID + "." + s.appleBundleID
 }
 
-// GenerateChallenge returns a random base64url-encoded challenge for iOS App Attest.
-func (s *AttestationService) GenerateChallenge(ctx context.Context) (string, error) {
+// appAttestTarget returns the app ID and Apple environment an iOS request
+// is verified against, or the reason it is refused. A request may name a
+// bundle in the policy's DevelopmentBundleIDs instead of APPLE_BUNDLE_ID,
+// and may name the environment its token came from. Only those bundles may
+// name the development environment in a production deployment, so a
+// production build cannot be attested against Apple's laxer development
+// environment. The attestation itself must then match the bundle and
+// environment.
+func (s *AttestationService) appAttestTarget(req *AttestationRequest) (string, bool, string) {
+	bundleID := req.BundleID
+	if bundleID == "" {
+		bundleID = s.appleBundleID
+	}
+	if bundleID != s.appleBundleID && !s.policy.DevelopmentBundleIDs[bundleID] {
+		return "", false, "bundle_id_not_allowed"
+	}
+	production := s.policy.AppleProduction
+	switch req.Environment {
+	case "":
+	case AppAttestProduction:
+		production = true
+	case AppAttestDevelopment:
+		if s.policy.AppleProduction && !s.policy.DevelopmentBundleIDs[bundleID] {
+			return "", false, "development_environment_not_allowed"
+		}
+		production = false
+	default:
+		return "", false, "invalid_environment"
+	}
+	return s.appleTeamID + "." + bundleID, production, ""
+}
+
+// ErrDeviceIDRequired is returned when a challenge is requested without the
+// device it is for
+var ErrDeviceIDRequired = apperr.New(apperr.ErrInvalidInput, "device_id_required", "attestation challenges are issued to a device")
+
+// GenerateChallenge returns a random base64url-encoded challenge, used as
+// App Attest client data or, through its ChallengeHash, as a Play Integrity
+// requestHash. With a challenge store it is remembered for the challenge
+// TTL, bound to deviceID. Without a device ID it returns
+// ErrDeviceIDRequired, and a device or client address over its challenge
+// limit gets ErrTooManyChallenges.
+func (s *AttestationService) GenerateChallenge(ctx context.Context, deviceID, clientIP string) (string, error) {
+	if deviceID == "" {
+		return "", ErrDeviceIDRequired
+	}
+	if err := s.allowChallenge(ctx, deviceID, clientIP); err != nil {
+		return "", err
+	}
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	return base64.RawURLEncoding.EncodeToString(b), nil
+	challenge := base64.RawURLEncoding.EncodeToString(b)
+	if s.challenges != nil {
+		if err := s.challenges.PutChallenge(ctx, challengeKey(deviceID, ChallengeHash(challenge)), s.challengeTTL); err != nil {
+			return "", fmt.Errorf("failed to store challenge: %w", apperr.WithKind(apperr.ErrUnavailable, err))
+		}
+	}
+	return challenge, nil
+}
+
+// ChallengeHash is the requestHash an Android client sets in its Play
+// Integrity request for challenge: the unpadded base64url SHA-256 of it
+func ChallengeHash(challenge string) string {
+	sum := sha256.Sum256([]byte(challenge))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// consumeChallenge uses up the challenge with hash issued to deviceID,
+// reporting whether there was an unexpired one. A request without a device
+// ID has no challenge.
+func (s *AttestationService) consumeChallenge(ctx context.Context, deviceID, hash string) (bool, error) {
+	if deviceID == "" {
+		return false, nil
+	}
+	return s.challenges.ConsumeChallenge(ctx, challengeKey(deviceID, hash))
+}
+
+// challengeKey is where the challenge with hash issued to deviceID is
+// stored. Challenges are kept by hash so Android tokens, which carry only
+// the hash, can be matched.
+func challengeKey(deviceID, hash string) string {
+	return deviceID + ":" + hash
 }
 
 // storeAttestation stores attestation record in database
@@ -294,17 +942,47 @@ func (s *AttestationService) storeAttestation(
 	req *AttestationRequest,
 	result *AttestationResult,
 ) error {
-	var verifiedAt sql.NullTime
+	var verifiedAt, expiresAt sql.NullTime
 	if result.IsValid {
-		verifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		now := s.clock.Now()
+		verifiedAt = sql.NullTime{Time: now, Valid: true}
+		expiresAt = sql.NullTime{Time: now.Add(s.validity), Valid: true}
 	}
 
-	_, err := s.db.Pool().ExecContext(ctx, `
-		INSERT INTO attestations (
-			device_id, platform, token, verified, verified_at, device_integrity, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, NOW())
-	`, req.DeviceID, req.Platform, req.Token, result.IsValid, verifiedAt, result.DeviceIntegrity)
-	return err
+	return s.db.RecordAttestation(ctx, &db.AttestationRecord{
+		DeviceID:        req.DeviceID,
+		Platform:        req.Platform,
+		Token:           req.Token,
+		Verified:        result.IsValid,
+		VerifiedAt:      verifiedAt,
+		DeviceIntegrity: result.DeviceIntegrity,
+		ExpiresAt:       expiresAt,
+		FailureReason:   result.Reason,
+		KeyID:           result.KeyID,
+		Downgraded:      result.Downgraded,
+		RiskScore:       result.RiskScore,
+		ClientIP:        s.storedClientIP(req.ClientIP),
+		ClientRegion:    req.ClientRegion,
+	})
+}
+
+// flagSharedKey flags a device that presented an App Attest key bound to
+// another device, and the device the key is bound to: one of them is using
+// the other's credentials. A failure is logged; the attestation fails
+// either way.
+func (s *AttestationService) flagSharedKey(ctx context.Context, keyID, deviceID string) {
+	devices := []string{deviceID}
+	if owner, err := s.db.GetAppAttestKeyDevice(ctx, keyID); err != nil {
+		log.Printf("app attest key owner lookup failed for key=%s: %v", keyID, err)
+	} else {
+		devices = append(devices, owner)
+	}
+	for _, device := range devices {
+		if err := s.db.FlagDevice(ctx, device, db.FlagSharedAppAttestKey, keyID); err != nil {
+			log.Printf("flagging device=%s for shared app attest key failed: %v", device, err)
+		}
+	}
+	metrics.AppAttestSharedKeys.Inc()
 }
 
 func envAllowsBypass() bool {
@@ -312,22 +990,24 @@ func envAllowsBypass() bool {
 	return value == "1" || value == "true" || value == "yes"
 }
 
-// ShouldUseHoneypot determines if a client should receive honeypot gateways
-func (s *AttestationService) ShouldUseHoneypot(result *AttestationResult) bool {
-	if result == nil {
-		return true // No attestation = use honeypot
-	}
-
-	if !result.IsValid {
-		return true // Invalid attestation = use honeypot
-	}
-
-	// Check device integrity level
-	if result.DeviceIntegrity != "MEETS_STRONG_INTEGRITY" {
-		return true // Weak integrity = use honeypot
+// LoadBypassDeviceIDsFromEnv reads the devices whose attestations are passed
+// without verification from LUMENLINK_ATTESTATION_BYPASS_DEVICE_IDS, a
+// comma-separated list
+func LoadBypassDeviceIDsFromEnv() map[string]bool {
+	devices := map[string]bool{}
+	for _, id := range strings.Split(os.Getenv("LUMENLINK_ATTESTATION_BYPASS_DEVICE_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			devices[id] = true
+		}
 	}
+	return devices
+}
 
-	return false // Valid attestation with strong integrity = no honeypot
+// bypassed passes an attestation without verifying it
+func bypassed(result *AttestationResult) *AttestationResult {
+	result.IsValid = true
+	result.DeviceIntegrity = "BYPASS_ENABLED"
+	return result
 }
 
 func (s *AttestationService) initPlayIntegrityClient(ctx context.Context) error {
@@ -350,12 +1030,55 @@ func (s *AttestationService) initPlayIntegrityClient(ctx context.Context) error
 			return
 		}
 
-		s.playIntegrityClient = service
+		s.playIntegrityClient = googlePlayIntegrity{service: service, clock: clock.Real{}}
 	})
 
 	return s.playIntegrityInitErr
 }
 
+// ErrPlayIntegrityNotConfigured is returned by CheckPlayIntegrityAuth when no
+// package name is configured.
+var ErrPlayIntegrityNotConfigured = apperr.New(apperr.ErrUnavailable, "play_integrity_not_configured", "play integrity package name not configured")
+
+// CheckPlayIntegrityAuth verifies that the configured Play Integrity
+// credentials can obtain an access token. No integrity token is decoded.
+// With local decoding keys no credentials are needed, and nil is returned.
+func (s *AttestationService) CheckPlayIntegrityAuth(ctx context.Context) error {
+	if s.playIntegrityPackageName == "" {
+		return ErrPlayIntegrityNotConfigured
+	}
+	if s.playIntegrityLocal != nil {
+		// Tokens are decoded locally; Google is never called
+		return nil
+	}
+	if err := s.initPlayIntegrityClient(ctx); err != nil {
+		return fmt.Errorf("failed to create play integrity client: %w", err)
+	}
+
+	var creds *google.Credentials
+	var err error
+	switch {
+	case s.playIntegrityCredentialsFile != "":
+		data, readErr := os.ReadFile(s.playIntegrityCredentialsFile)
+		if readErr != nil {
+			return fmt.Errorf("failed to read play integrity credentials: %w", readErr)
+		}
+		creds, err = google.CredentialsFromJSON(ctx, data, playintegrity.PlayintegrityScope)
+	case s.playIntegrityCredentialsJSON != "":
+		creds, err = google.CredentialsFromJSON(ctx, []byte(s.playIntegrityCredentialsJSON), playintegrity.PlayintegrityScope)
+	default:
+		creds, err = google.FindDefaultCredentials(ctx, playintegrity.PlayintegrityScope)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load play integrity credentials: %w", err)
+	}
+
+	if _, err := creds.TokenSource.Token(); err != nil {
+		return fmt.Errorf("failed to authenticate with play integrity: %w", err)
+	}
+	return nil
+}
+
 func hasIntegrityVerdict(verdicts []string, verdict string) bool {
 	for _, value := range verdicts {
 		if value == verdict {
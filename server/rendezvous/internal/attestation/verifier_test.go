@@ -0,0 +1,993 @@
+package attestation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/ugorji/go/codec"
+	"google.golang.org/api/playintegrity/v1"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+	"rendezvous/internal/store"
+)
+
+func TestTokenExpired_MaxAgeBoundary(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := &AttestationService{policy: Policy{MaxAge: 5 * time.Minute}, clock: clock.NewFake(now)}
+
+	tests := []struct {
+		name    string
+		issued  int64
+		expired bool
+	}{
+		{"fresh", now.Add(-time.Minute).UnixMilli(), false},
+		{"exactly max age", now.Add(-5 * time.Minute).UnixMilli(), false},
+		{"one millisecond past", now.Add(-5*time.Minute - time.Millisecond).UnixMilli(), true},
+		{"no timestamp", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := svc.tokenExpired(tt.issued); got != tt.expired {
+				t.Errorf("tokenExpired: got %v, want %v", got, tt.expired)
+			}
+		})
+	}
+}
+
+func TestTokenExpired_ExpiresWhileQueued(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	svc := &AttestationService{policy: Policy{MaxAge: 5 * time.Minute}, clock: fake}
+	issued := fake.Now().Add(-4 * time.Minute).UnixMilli()
+
+	if svc.tokenExpired(issued) {
+		t.Fatal("token expired on arrival")
+	}
+	// The request waits for a verification slot past the token's maximum age
+	fake.Advance(time.Minute + time.Millisecond)
+	if !svc.tokenExpired(issued) {
+		t.Error("token still accepted after it aged out in the queue")
+	}
+}
+
+// appAttestService returns a service with a challenge store and fake clock,
+// and a builder for App Attest tokens over given client data
+func appAttestService() (*AttestationService, *clock.Fake, func(deviceID, clientData string) *AttestationRequest) {
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	challenges := store.NewMemory()
+	challenges.SetClock(fake)
+	svc := &AttestationService{
+		appleTeamID:   "TEAM",
+		appleBundleID: "org.lumenlink.app",
+		pool:          NewPool(PoolConfig{Workers: 1, QueueDepth: 1}),
+		clock:         fake,
+		challengeTTL:  time.Minute,
+	}
+	svc.SetChallenges(challenges)
+	token := func(deviceID, clientData string) *AttestationRequest {
+		return &AttestationRequest{Platform: "ios", DeviceID: deviceID, Token: fmt.Sprintf(
+			`{"clientData":%q,"keyID":"key","attestationObject":""}`,
+			base64.RawURLEncoding.EncodeToString([]byte(clientData)),
+		)}
+	}
+	return svc, fake, token
+}
+
+func TestAppAttest_ChallengeIssuedAndSingleUse(t *testing.T) {
+	ctx := context.Background()
+	svc, _, token := appAttestService()
+
+	challenge, err := svc.GenerateChallenge(ctx, "device-1", "")
+	if err != nil {
+		t.Fatalf("GenerateChallenge: %v", err)
+	}
+
+	result, _ := svc.verifyDCAppAttest(ctx, token("device-1", "not-issued"))
+	if result.IsValid || result.Reason != "challenge_invalid" {
+		t.Errorf("unissued challenge: got %+v", result)
+	}
+	// The issued challenge gets past the check; the fake attestation object does not verify
+	result, _ = svc.verifyDCAppAttest(ctx, token("device-1", challenge))
+	if result.Reason != "dcappattest_verification_failed" {
+		t.Errorf("issued challenge: got %+v", result)
+	}
+	result, _ = svc.verifyDCAppAttest(ctx, token("device-1", challenge))
+	if result.IsValid || result.Reason != "challenge_invalid" {
+		t.Errorf("reused challenge: got %+v", result)
+	}
+}
+
+func TestAppAttest_ChallengeExpires(t *testing.T) {
+	ctx := context.Background()
+	svc, fake, token := appAttestService()
+
+	challenge, err := svc.GenerateChallenge(ctx, "device-1", "")
+	if err != nil {
+		t.Fatalf("GenerateChallenge: %v", err)
+	}
+	fake.Advance(svc.challengeTTL)
+	result, _ := svc.verifyDCAppAttest(ctx, token("device-1", challenge))
+	if result.IsValid || result.Reason != "challenge_invalid" {
+		t.Errorf("expired challenge: got %+v", result)
+	}
+}
+
+func TestAppAttest_ChallengeBoundToDevice(t *testing.T) {
+	ctx := context.Background()
+	svc, _, token := appAttestService()
+
+	bound, err := svc.GenerateChallenge(ctx, "device-1", "")
+	if err != nil {
+		t.Fatalf("GenerateChallenge: %v", err)
+	}
+	result, _ := svc.verifyDCAppAttest(ctx, token("device-2", bound))
+	if result.IsValid || result.Reason != "challenge_invalid" {
+		t.Errorf("challenge of another device: got %+v", result)
+	}
+	// Using it from the wrong device does not burn it for its own
+	result, _ = svc.verifyDCAppAttest(ctx, token("device-1", bound))
+	if result.Reason != "dcappattest_verification_failed" {
+		t.Errorf("challenge of the same device: got %+v", result)
+	}
+
+	// Challenges are only issued to a device
+	if _, err := svc.GenerateChallenge(ctx, "", ""); !errors.Is(err, ErrDeviceIDRequired) {
+		t.Errorf("challenge without a device: got %v", err)
+	}
+}
+
+// verdictDecoder returns a payload with the verdict named by the token and
+// the request hash after it, if any: "MEETS_STRONG_INTEGRITY|hash"
+type verdictDecoder struct {
+	issuedAt time.Time
+}
+
+func (d verdictDecoder) DecodeIntegrityToken(_ context.Context, packageName, token string) (*playintegrity.TokenPayloadExternal, error) {
+	if token == "unreachable" {
+		return nil, errors.New("connection refused")
+	}
+	verdict, requestHash, _ := strings.Cut(token, "|")
+	return &playintegrity.TokenPayloadExternal{
+		RequestDetails: &playintegrity.RequestDetails{
+			RequestPackageName: packageName,
+			RequestHash:        requestHash,
+			TimestampMillis:    d.issuedAt.UnixMilli(),
+		},
+		AppIntegrity:    &playintegrity.AppIntegrity{AppRecognitionVerdict: "PLAY_RECOGNIZED"},
+		AccountDetails:  &playintegrity.AccountDetails{AppLicensingVerdict: "LICENSED"},
+		DeviceIntegrity: &playintegrity.DeviceIntegrity{DeviceRecognitionVerdict: []string{verdict}},
+	}, nil
+}
+
+func TestPlayIntegrity_DecoderVerdicts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := &AttestationService{
+		playIntegrityPackageName: "org.lumenlink.app",
+		policy:                   Policy{RequireLicensed: true, MaxAge: 5 * time.Minute},
+		pool:                     NewPool(PoolConfig{Workers: 1, QueueDepth: 1}),
+		clock:                    clock.NewFake(now),
+	}
+	svc.SetPlayIntegrityDecoder(verdictDecoder{issuedAt: now})
+
+	tests := []struct {
+		token      string
+		wantValid  bool
+		wantReason string
+		wantErr    bool
+	}{
+		{"MEETS_STRONG_INTEGRITY", true, "", false},
+		{"MEETS_BASIC_INTEGRITY", false, "device_integrity_failed", false},
+		{"unreachable", false, "play_integrity_api_error", true},
+	}
+	for _, tt := range tests {
+		result, err := svc.verifyPlayIntegrity(ctx, &AttestationRequest{Platform: "android", DeviceID: "device-1", Token: tt.token})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.token, err, tt.wantErr)
+		}
+		if result.IsValid != tt.wantValid || result.Reason != tt.wantReason {
+			t.Errorf("%s: got %+v", tt.token, result)
+		}
+	}
+}
+
+func TestPlayIntegrity_PayloadChecks(t *testing.T) {
+	t.Setenv("PLAY_INTEGRITY_PACKAGE_NAME", "org.lumenlink.app")
+	t.Setenv("LUMENLINK_ALLOW_ATTESTATION_BYPASS", "")
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		change     func(*FakePlayIntegrity)
+		wantReason string
+		wantErr    bool
+	}{
+		{"valid", func(*FakePlayIntegrity) {}, "", false},
+		{"package mismatch", func(f *FakePlayIntegrity) {
+			f.Payload.RequestDetails.RequestPackageName = "org.example.clone"
+		}, "package_name_mismatch", false},
+		{"expired token", func(f *FakePlayIntegrity) {
+			f.Payload.RequestDetails.TimestampMillis = now.Add(-6 * time.Minute).UnixMilli()
+		}, "attestation_expired", false},
+		{"missing payload", func(f *FakePlayIntegrity) { f.Payload = nil }, "missing_token_payload", false},
+		{"missing request details", func(f *FakePlayIntegrity) { f.Payload.RequestDetails = nil }, "missing_token_payload", false},
+		{"missing app verdict", func(f *FakePlayIntegrity) { f.Payload.AppIntegrity = nil }, "app_not_recognized", false},
+		{"missing device verdicts", func(f *FakePlayIntegrity) { f.Payload.DeviceIntegrity = nil }, "device_integrity_failed", false},
+		{"empty device verdicts", func(f *FakePlayIntegrity) {
+			f.Payload.DeviceIntegrity.DeviceRecognitionVerdict = nil
+		}, "device_integrity_failed", false},
+		{"unlicensed", func(f *FakePlayIntegrity) {
+			f.Payload.AccountDetails.AppLicensingVerdict = "UNLICENSED"
+		}, "app_not_licensed", false},
+		{"licensing unevaluated", func(f *FakePlayIntegrity) {
+			f.Payload.AccountDetails.AppLicensingVerdict = "UNEVALUATED"
+		}, "app_not_licensed", false},
+		{"missing account details", func(f *FakePlayIntegrity) { f.Payload.AccountDetails = nil }, "app_not_licensed", false},
+		{"api error", func(f *FakePlayIntegrity) { f.Err = errors.New("connection refused") }, "play_integrity_api_error", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakePlayIntegrity("org.lumenlink.app", now, "MEETS_DEVICE_INTEGRITY", "MEETS_STRONG_INTEGRITY")
+			tt.change(fake)
+			svc := NewAttestationService(nil,
+				WithPolicy(Policy{RequireLicensed: true, MaxAge: 5 * time.Minute}),
+				WithPlayIntegrityDecoder(fake),
+			)
+			svc.SetClock(clock.NewFake(now))
+
+			result, err := svc.verifyPlayIntegrity(context.Background(), &AttestationRequest{
+				Platform: "android", DeviceID: "device-1", Token: "token-1",
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result.IsValid != (tt.wantReason == "") || result.Reason != tt.wantReason {
+				t.Errorf("got %+v, want reason %q", result, tt.wantReason)
+			}
+			if tokens := fake.Tokens(); len(tokens) != 1 || tokens[0] != "token-1" {
+				t.Errorf("decoded tokens: got %v", tokens)
+			}
+		})
+	}
+}
+
+func TestPlayIntegrity_RequestTypes(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		requestType string
+		licensing   string // Empty: no account details
+		bound       bool   // requestHash of a challenge issued to the device
+		wantReason  string
+	}{
+		{"standard without licensing verdict", "standard", "", true, ""},
+		{"standard unevaluated", "standard", "UNEVALUATED", true, ""},
+		{"standard unlicensed", "standard", "UNLICENSED", true, "app_not_licensed"},
+		{"standard without request hash", "standard", "LICENSED", false, "request_hash_mismatch"},
+		{"classic without licensing verdict", "classic", "", true, "app_not_licensed"},
+		{"default is classic", "", "", true, "app_not_licensed"},
+		{"classic without request hash", "classic", "LICENSED", false, ""},
+		{"unknown type", "express", "LICENSED", true, "invalid_request_type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := clock.NewFake(now)
+			challenges := store.NewMemory()
+			challenges.SetClock(fake)
+			decoder := NewFakePlayIntegrity("org.lumenlink.app", now, "MEETS_STRONG_INTEGRITY")
+			decoder.Payload.AccountDetails = nil
+			if tt.licensing != "" {
+				decoder.Payload.AccountDetails = &playintegrity.AccountDetails{AppLicensingVerdict: tt.licensing}
+			}
+			svc := &AttestationService{
+				playIntegrityPackageName: "org.lumenlink.app",
+				// Classic tokens without a requestHash are still accepted
+				policy:               Policy{RequireLicensed: true, MaxAge: 5 * time.Minute},
+				pool:                 NewPool(PoolConfig{Workers: 1, QueueDepth: 1}),
+				clock:                fake,
+				challengeTTL:         time.Minute,
+				playIntegrityDecoder: decoder,
+			}
+			svc.SetChallenges(challenges)
+			if tt.bound {
+				challenge, err := svc.GenerateChallenge(ctx, "device-1", "")
+				if err != nil {
+					t.Fatalf("GenerateChallenge: %v", err)
+				}
+				decoder.Payload.RequestDetails.RequestHash = ChallengeHash(challenge)
+			}
+
+			result, err := svc.verifyPlayIntegrity(ctx, &AttestationRequest{
+				Platform: "android", DeviceID: "device-1", Token: "token", RequestType: tt.requestType,
+			})
+			if err != nil {
+				t.Fatalf("verifyPlayIntegrity: %v", err)
+			}
+			if result.IsValid != (tt.wantReason == "") || result.Reason != tt.wantReason {
+				t.Errorf("got %+v, want reason %q", result, tt.wantReason)
+			}
+			if tt.wantReason == "invalid_request_type" && len(decoder.Tokens()) != 0 {
+				t.Error("token of an unknown request type was decoded")
+			}
+		})
+	}
+}
+
+func TestVerifyAttestation_CountsPlayIntegrityRequestType(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := &AttestationService{
+		db:                       db.NewFromPool(sqlDB),
+		playIntegrityPackageName: "org.lumenlink.app",
+		policy:                   Policy{MaxAge: 5 * time.Minute},
+		pool:                     NewPool(PoolConfig{Workers: 1, QueueDepth: 1}),
+		clock:                    clock.NewFake(now),
+	}
+	svc.SetPlayIntegrityDecoder(NewFakePlayIntegrity("org.lumenlink.app", now, "MEETS_BASIC_INTEGRITY"))
+	standard := metrics.PlayIntegrityRequests.WithLabelValues("standard", "invalid")
+	before := testutil.ToFloat64(standard)
+
+	mock.ExpectExec(`INSERT INTO attestations`).WillReturnResult(sqlmock.NewResult(1, 1))
+	if _, err := svc.VerifyAttestation(context.Background(), &AttestationRequest{Platform: "android", Token: "token", RequestType: "standard"}); err != nil {
+		t.Fatalf("VerifyAttestation: %v", err)
+	}
+	if got := testutil.ToFloat64(standard) - before; got != 1 {
+		t.Errorf("standard invalid requests: got %v more, want 1", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// failingDecoder is a Play Integrity API that cannot be reached
+type failingDecoder struct{}
+
+func (failingDecoder) DecodeIntegrityToken(context.Context, string, string) (*playintegrity.TokenPayloadExternal, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestVerifyAttestation_StoresVerificationErrors(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := &AttestationService{
+		db:                       db.NewFromPool(sqlDB),
+		playIntegrityPackageName: "org.lumenlink.app",
+		policy:                   Policy{MaxAge: 5 * time.Minute},
+		pool:                     NewPool(PoolConfig{Workers: 1, QueueDepth: 1}),
+		clock:                    clock.NewFake(now),
+	}
+	svc.SetPlayIntegrityDecoder(failingDecoder{})
+
+	mock.ExpectQuery(`FROM revoked_devices`).WithArgs("device-1").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`INSERT INTO attestations`).
+		WithArgs("device-1", "android", "token", false, nil, "", nil, "verification_error", "", 0.0, "203.0.113.7", "", false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	result, err := svc.VerifyAttestation(context.Background(), &AttestationRequest{
+		Platform: "android", DeviceID: "device-1", Token: "token", ClientIP: "203.0.113.7",
+	})
+	if err == nil || result == nil || result.IsValid || result.Reason != "verification_error" || result.DeviceID != "device-1" {
+		t.Fatalf("got %+v, %v", result, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadBypassDeviceIDsFromEnv(t *testing.T) {
+	t.Setenv("LUMENLINK_ATTESTATION_BYPASS_DEVICE_IDS", " qa-pixel-7, ,qa-iphone-15,qa-pixel-7,")
+	devices := LoadBypassDeviceIDsFromEnv()
+	if len(devices) != 2 || !devices["qa-pixel-7"] || !devices["qa-iphone-15"] {
+		t.Errorf("got %v", devices)
+	}
+	t.Setenv("LUMENLINK_ATTESTATION_BYPASS_DEVICE_IDS", "")
+	if devices := LoadBypassDeviceIDsFromEnv(); len(devices) != 0 {
+		t.Errorf("empty: got %v", devices)
+	}
+}
+
+func TestBypassDevices_OnlyListedDevicesSkipVerification(t *testing.T) {
+	t.Setenv("LUMENLINK_ALLOW_ATTESTATION_BYPASS", "")
+	t.Setenv("LUMENLINK_ATTESTATION_BYPASS_DEVICE_IDS", "qa-pixel-7")
+	t.Setenv("PLAY_INTEGRITY_PACKAGE_NAME", "")
+	t.Setenv("APPLE_TEAM_ID", "")
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Without verification configured, only the listed device passes
+	svc := NewAttestationService(nil)
+	for _, tt := range []struct {
+		platform   string
+		deviceID   string
+		wantReason string
+	}{
+		{"android", "qa-pixel-7", ""},
+		{"android", "device-1", "play_integrity_not_configured"},
+		{"ios", "qa-pixel-7", ""},
+		{"ios", "device-1", "missing_dcappattest_config"},
+	} {
+		req := &AttestationRequest{Platform: tt.platform, DeviceID: tt.deviceID, Token: "token"}
+		var result *AttestationResult
+		if tt.platform == "android" {
+			result, _ = svc.verifyPlayIntegrity(ctx, req)
+		} else {
+			result, _ = svc.verifyDCAppAttest(ctx, req)
+		}
+		if result.IsValid != (tt.wantReason == "") || result.Reason != tt.wantReason {
+			t.Errorf("%s %s: got %+v, want reason %q", tt.platform, tt.deviceID, result, tt.wantReason)
+		}
+		if result.IsValid && result.DeviceIntegrity != "BYPASS_ENABLED" {
+			t.Errorf("%s %s: integrity %q, want BYPASS_ENABLED", tt.platform, tt.deviceID, result.DeviceIntegrity)
+		}
+	}
+
+	// With verification configured, everyone else is still verified
+	t.Setenv("PLAY_INTEGRITY_PACKAGE_NAME", "org.lumenlink.app")
+	decoder := NewFakePlayIntegrity("org.lumenlink.app", now, "MEETS_BASIC_INTEGRITY")
+	svc = NewAttestationService(nil, WithPolicy(Policy{MaxAge: 5 * time.Minute}), WithPlayIntegrityDecoder(decoder))
+	svc.SetClock(clock.NewFake(now))
+	if result, _ := svc.verifyPlayIntegrity(ctx, &AttestationRequest{Platform: "android", DeviceID: "qa-pixel-7", Token: "qa"}); !result.IsValid {
+		t.Errorf("listed device: got %+v", result)
+	}
+	if result, _ := svc.verifyPlayIntegrity(ctx, &AttestationRequest{Platform: "android", DeviceID: "device-1", Token: "real"}); result.IsValid || result.Reason != "device_integrity_failed" {
+		t.Errorf("unlisted device: got %+v", result)
+	}
+	if tokens := decoder.Tokens(); len(tokens) != 1 || tokens[0] != "real" {
+		t.Errorf("decoded tokens: got %v, want only the unlisted device's", tokens)
+	}
+}
+
+// appAttestKey is a device's App Attest key pair, signing assertions the way
+// the Secure Enclave does
+type appAttestKey struct {
+	private *ecdsa.PrivateKey
+}
+
+func newAppAttestKey(t *testing.T) *appAttestKey {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &appAttestKey{private: private}
+}
+
+// publicKey returns the key as attestation verification returns it
+func (k *appAttestKey) publicKey(t *testing.T) []byte {
+	t.Helper()
+	public, err := k.private.PublicKey.ECDH()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return public.Bytes()
+}
+
+// assert returns an assertion request over challenge with counter
+func (k *appAttestKey) assert(t *testing.T, appID, deviceID, challenge string, counter uint32) *AttestationRequest {
+	t.Helper()
+	clientData := []byte(fmt.Sprintf(`{"challenge":%q}`, challenge))
+	rpIDHash := sha256.Sum256([]byte(appID))
+	authData := append(rpIDHash[:], 0)
+	authData = binary.BigEndian.AppendUint32(authData, counter)
+	clientDataHash := sha256.Sum256(clientData)
+	nonce := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	digest := sha256.Sum256(nonce[:])
+	signature, err := ecdsa.SignASN1(rand.Reader, k.private, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded []byte
+	if err := codec.NewEncoderBytes(&encoded, &codec.CborHandle{}).Encode(map[string][]byte{
+		"authenticatorData": authData,
+		"signature":         signature,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return &AttestationRequest{Platform: "ios", DeviceID: deviceID, KeyID: "key-1", Token: fmt.Sprintf(
+		`{"clientData":%q,"assertion":%q}`,
+		base64.RawURLEncoding.EncodeToString(clientData),
+		base64.RawURLEncoding.EncodeToString(encoded),
+	)}
+}
+
+func TestAppAttest_AssertionVerifiesAgainstStoredKey(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _ := appAttestService()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc.db = db.NewFromPool(sqlDB)
+	key := newAppAttestKey(t)
+	appID := svc.appleAppID()
+	keyColumns := []string{"key_id", "device_id", "public_key", "receipt", "counter", "created_at", "last_used_at", "risk_metric", "receipt_refreshed_at"}
+	storedKey := func(counter int64) *sqlmock.Rows {
+		return sqlmock.NewRows(keyColumns).AddRow("key-1", "device-1", key.publicKey(t), nil, counter, time.Now(), nil, nil, nil)
+	}
+
+	challenge, _ := svc.GenerateChallenge(ctx, "device-1", "")
+	mock.ExpectQuery(`FROM app_attest_keys`).WithArgs("key-1", "device-1").WillReturnRows(storedKey(0))
+	mock.ExpectExec(`UPDATE app_attest_keys SET counter`).WithArgs("key-1", "device-1", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	result, err := svc.verifyDCAppAttest(ctx, key.assert(t, appID, "device-1", challenge, 1))
+	if err != nil || !result.IsValid || result.DeviceIntegrity != "MEETS_STRONG_INTEGRITY" {
+		t.Fatalf("first assertion: got %+v, %v", result, err)
+	}
+
+	// A counter the key has already used is a replay
+	challenge, _ = svc.GenerateChallenge(ctx, "device-1", "")
+	mock.ExpectQuery(`FROM app_attest_keys`).WithArgs("key-1", "device-1").WillReturnRows(storedKey(1))
+	result, _ = svc.verifyDCAppAttest(ctx, key.assert(t, appID, "device-1", challenge, 1))
+	if result.IsValid || result.Reason != "assertion_verification_failed" {
+		t.Errorf("replayed counter: got %+v", result)
+	}
+
+	// So is one another request advanced past after the key was read
+	challenge, _ = svc.GenerateChallenge(ctx, "device-1", "")
+	mock.ExpectQuery(`FROM app_attest_keys`).WithArgs("key-1", "device-1").WillReturnRows(storedKey(1))
+	mock.ExpectExec(`UPDATE app_attest_keys SET counter`).WithArgs("key-1", "device-1", int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	result, _ = svc.verifyDCAppAttest(ctx, key.assert(t, appID, "device-1", challenge, 2))
+	if result.IsValid || result.Reason != "assertion_replayed" {
+		t.Errorf("concurrent replay: got %+v", result)
+	}
+
+	// Another device cannot use the key; naming it flags no one
+	challenge, _ = svc.GenerateChallenge(ctx, "device-2", "")
+	mock.ExpectQuery(`FROM app_attest_keys`).WithArgs("key-1", "device-2").WillReturnRows(sqlmock.NewRows(keyColumns))
+	mock.ExpectQuery(`SELECT device_id FROM app_attest_keys`).WithArgs("key-1").
+		WillReturnRows(sqlmock.NewRows([]string{"device_id"}).AddRow("device-1"))
+	result, _ = svc.verifyDCAppAttest(ctx, key.assert(t, appID, "device-2", challenge, 3))
+	if result.IsValid || result.Reason != "key_already_bound" || result.KeyID != "key-1" {
+		t.Errorf("other device: got %+v", result)
+	}
+
+	// A key no device attested is unknown
+	challenge, _ = svc.GenerateChallenge(ctx, "device-2", "")
+	mock.ExpectQuery(`FROM app_attest_keys`).WithArgs("key-1", "device-2").WillReturnRows(sqlmock.NewRows(keyColumns))
+	mock.ExpectQuery(`SELECT device_id FROM app_attest_keys`).WithArgs("key-1").WillReturnRows(sqlmock.NewRows([]string{"device_id"}))
+	result, _ = svc.verifyDCAppAttest(ctx, key.assert(t, appID, "device-2", challenge, 3))
+	if result.IsValid || result.Reason != "unknown_key" {
+		t.Errorf("unknown key: got %+v", result)
+	}
+
+	// Nor can an assertion skip the challenge
+	result, _ = svc.verifyDCAppAttest(ctx, key.assert(t, appID, "device-1", "not-issued", 3))
+	if result.IsValid || result.Reason != "challenge_invalid" {
+		t.Errorf("unissued challenge: got %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAppAttestTarget(t *testing.T) {
+	svc := &AttestationService{
+		appleTeamID:   "TEAM",
+		appleBundleID: "org.lumenlink.app",
+		policy:        Policy{AppleProduction: true, DevelopmentBundleIDs: map[string]bool{"org.lumenlink.app.beta": true}},
+	}
+	tests := []struct {
+		name           string
+		bundleID       string
+		environment    string
+		wantAppID      string
+		wantProduction bool
+		wantReason     string
+	}{
+		{"defaults", "", "", "TEAM.org.lumenlink.app", true, ""},
+		{"production named", "org.lumenlink.app", AppAttestProduction, "TEAM.org.lumenlink.app", true, ""},
+		{"production bundle claiming development", "", AppAttestDevelopment, "", false, "development_environment_not_allowed"},
+		{"testflight build", "org.lumenlink.app.beta", AppAttestDevelopment, "TEAM.org.lumenlink.app.beta", false, ""},
+		{"testflight build on the default environment", "org.lumenlink.app.beta", "", "TEAM.org.lumenlink.app.beta", true, ""},
+		{"unknown bundle", "org.example.other", AppAttestDevelopment, "", false, "bundle_id_not_allowed"},
+		{"unknown environment", "", "sandbox", "", false, "invalid_environment"},
+	}
+	for _, tt := range tests {
+		appID, production, reason := svc.appAttestTarget(&AttestationRequest{BundleID: tt.bundleID, Environment: tt.environment})
+		if appID != tt.wantAppID || production != tt.wantProduction || reason != tt.wantReason {
+			t.Errorf("%s: got %q, %v, %q", tt.name, appID, production, reason)
+		}
+	}
+
+	// A development deployment attests any of its bundles in development
+	svc.policy.AppleProduction = false
+	if appID, production, reason := svc.appAttestTarget(&AttestationRequest{Environment: AppAttestDevelopment}); appID != "TEAM.org.lumenlink.app" || production || reason != "" {
+		t.Errorf("development deployment: got %q, %v, %q", appID, production, reason)
+	}
+}
+
+func TestAppAttest_EnvironmentOverride(t *testing.T) {
+	ctx := context.Background()
+	svc, _, token := appAttestService()
+	svc.policy = Policy{AppleProduction: true, DevelopmentBundleIDs: map[string]bool{"org.lumenlink.app.beta": true}}
+
+	// Refused before the challenge is consumed or Apple's checks run
+	challenge, _ := svc.GenerateChallenge(ctx, "device-1", "")
+	req := token("device-1", challenge)
+	req.Environment = AppAttestDevelopment
+	result, err := svc.verifyDCAppAttest(ctx, req)
+	if err != nil || result.IsValid || result.Reason != "development_environment_not_allowed" {
+		t.Errorf("production bundle claiming development: got %+v, %v", result, err)
+	}
+
+	// A TestFlight build's assertions are checked against its own app ID
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc.db = db.NewFromPool(sqlDB)
+	key := newAppAttestKey(t)
+	mock.ExpectQuery(`FROM app_attest_keys`).WithArgs("key-1", "device-1").
+		WillReturnRows(sqlmock.NewRows([]string{"key_id", "device_id", "public_key", "receipt", "counter", "created_at", "last_used_at", "risk_metric", "receipt_refreshed_at"}).
+			AddRow("key-1", "device-1", key.publicKey(t), nil, 0, time.Now(), nil, nil, nil))
+	mock.ExpectExec(`UPDATE app_attest_keys SET counter`).WithArgs("key-1", "device-1", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	req = key.assert(t, "TEAM.org.lumenlink.app.beta", "device-1", challenge, 1)
+	req.BundleID, req.Environment = "org.lumenlink.app.beta", AppAttestDevelopment
+	if result, err := svc.verifyDCAppAttest(ctx, req); err != nil || !result.IsValid {
+		t.Errorf("testflight assertion: got %+v, %v", result, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPlayIntegrity_RequestHashBoundToChallenge(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	challenges := store.NewMemory()
+	challenges.SetClock(fake)
+	svc := &AttestationService{
+		playIntegrityPackageName: "org.lumenlink.app",
+		policy:                   Policy{MaxAge: 5 * time.Minute, RequireRequestHash: true},
+		pool:                     NewPool(PoolConfig{Workers: 1, QueueDepth: 1}),
+		clock:                    fake,
+		challengeTTL:             time.Minute,
+	}
+	svc.SetChallenges(challenges)
+	svc.SetPlayIntegrityDecoder(verdictDecoder{issuedAt: now})
+	verify := func(deviceID, requestHash string) *AttestationResult {
+		t.Helper()
+		result, err := svc.verifyPlayIntegrity(ctx, &AttestationRequest{
+			Platform: "android", DeviceID: deviceID, Token: "MEETS_STRONG_INTEGRITY|" + requestHash,
+		})
+		if err != nil {
+			t.Fatalf("verifyPlayIntegrity: %v", err)
+		}
+		return result
+	}
+
+	challenge, err := svc.GenerateChallenge(ctx, "device-1", "")
+	if err != nil {
+		t.Fatalf("GenerateChallenge: %v", err)
+	}
+	// A token captured from device-1 cannot be replayed by device-2
+	if result := verify("device-2", ChallengeHash(challenge)); result.IsValid || result.Reason != "request_hash_mismatch" {
+		t.Errorf("other device: got %+v", result)
+	}
+	if result := verify("device-1", ChallengeHash(challenge)); !result.IsValid {
+		t.Errorf("bound token: got %+v", result)
+	}
+	// Nor by device-1 once the challenge is used
+	if result := verify("device-1", ChallengeHash(challenge)); result.IsValid || result.Reason != "request_hash_mismatch" {
+		t.Errorf("reused challenge: got %+v", result)
+	}
+	// The hash is of the challenge, not the challenge itself
+	challenge, _ = svc.GenerateChallenge(ctx, "device-1", "")
+	if result := verify("device-1", challenge); result.IsValid || result.Reason != "request_hash_mismatch" {
+		t.Errorf("unhashed challenge: got %+v", result)
+	}
+	if result := verify("device-1", ""); result.IsValid || result.Reason != "request_hash_mismatch" {
+		t.Errorf("unbound token: got %+v", result)
+	}
+
+	// During the migration window unbound tokens pass, but a hash that is
+	// sent is still checked
+	svc.policy.RequireRequestHash = false
+	if result := verify("device-1", ""); !result.IsValid {
+		t.Errorf("unbound token in migration window: got %+v", result)
+	}
+	if result := verify("device-1", ChallengeHash("not-issued")); result.IsValid || result.Reason != "request_hash_mismatch" {
+		t.Errorf("unissued hash in migration window: got %+v", result)
+	}
+}
+
+func TestAttestationValidity_ExpiryBoundary(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	svc := &AttestationService{db: db.NewFromPool(sqlDB), clock: fake, validity: 24 * time.Hour}
+	verifiedAt := fake.Now()
+	expiresAt := verifiedAt.Add(24 * time.Hour)
+
+	// A valid result is stored with the validity window; a failed one is not
+	// given an expiry
+	mock.ExpectExec(`INSERT INTO attestations`).
+		WithArgs("device-1", "android", "token", true, verifiedAt, "MEETS_STRONG_INTEGRITY", expiresAt, "", "", 0.1, "", "", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO attestations`).
+		WithArgs("device-1", "android", "token", false, nil, "", nil, "invalid_verdict", "", 1.0, "", "", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// A downgrade is stored as one
+	mock.ExpectExec(`INSERT INTO attestations`).
+		WithArgs("device-1", "android", "token", true, verifiedAt, "MEETS_BASIC_INTEGRITY", expiresAt, "", "", 0.0, "", "", true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	req := &AttestationRequest{Platform: "android", DeviceID: "device-1", Token: "token"}
+	if err := svc.storeAttestation(ctx, req, &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY", RiskScore: 0.1}); err != nil {
+		t.Fatalf("storeAttestation valid: %v", err)
+	}
+	if err := svc.storeAttestation(ctx, req, &AttestationResult{IsValid: false, Reason: "invalid_verdict", RiskScore: 1}); err != nil {
+		t.Fatalf("storeAttestation invalid: %v", err)
+	}
+	if err := svc.storeAttestation(ctx, req, &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_BASIC_INTEGRITY", Downgraded: true}); err != nil {
+		t.Fatalf("storeAttestation downgraded: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyAttestation_RevokedDeviceShortCircuits(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := &AttestationService{
+		db:                       db.NewFromPool(sqlDB),
+		playIntegrityPackageName: "org.lumenlink.app",
+		pool:                     NewPool(PoolConfig{Workers: 1, QueueDepth: 1}),
+		clock:                    clock.NewFake(now),
+	}
+	// The token would verify; it is never decoded, and nothing is stored
+	svc.SetPlayIntegrityDecoder(verdictDecoder{issuedAt: now})
+	mock.ExpectQuery(`FROM revoked_devices`).WithArgs("device-revoked").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	hits := metrics.RevokedDeviceHits.WithLabelValues("attestation")
+	failures := metrics.AttestationFailures.WithLabelValues("android", "device_revoked")
+	beforeHits, beforeFailures := testutil.ToFloat64(hits), testutil.ToFloat64(failures)
+
+	result, err := svc.VerifyAttestation(context.Background(), &AttestationRequest{
+		Platform: "android", DeviceID: "device-revoked", Token: "MEETS_STRONG_INTEGRITY",
+	})
+	if err != nil {
+		t.Fatalf("VerifyAttestation: %v", err)
+	}
+	if result.IsValid || result.Reason != "device_revoked" {
+		t.Errorf("got %+v, want device_revoked", result)
+	}
+	if testutil.ToFloat64(hits)-beforeHits != 1 || testutil.ToFloat64(failures)-beforeFailures != 1 {
+		t.Error("revoked device hit not counted")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// slowDecoder takes a fixed time on the service's clock to decode each token
+type slowDecoder struct {
+	verdictDecoder
+	clock   *clock.Fake
+	latency time.Duration
+}
+
+func (d slowDecoder) DecodeIntegrityToken(ctx context.Context, packageName, token string) (*playintegrity.TokenPayloadExternal, error) {
+	d.clock.Advance(d.latency)
+	return d.verdictDecoder.DecodeIntegrityToken(ctx, packageName, token)
+}
+
+func TestVerifyAttestation_ObservesDurationByOutcome(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	svc := &AttestationService{
+		db:                       db.NewFromPool(sqlDB),
+		playIntegrityPackageName: "org.lumenlink.app",
+		policy:                   Policy{MaxAge: 5 * time.Minute},
+		pool:                     NewPool(PoolConfig{Workers: 1, QueueDepth: 1}),
+		clock:                    fake,
+	}
+	svc.SetPlayIntegrityDecoder(slowDecoder{verdictDecoder{issuedAt: now}, fake, 2 * time.Second})
+
+	observed := func(outcome string) (uint64, float64) {
+		var m dto.Metric
+		if err := metrics.AttestationDuration.WithLabelValues("android", outcome).(prometheus.Histogram).Write(&m); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+	}
+	for _, tt := range []struct {
+		token   string
+		outcome string
+	}{
+		{"MEETS_STRONG_INTEGRITY", "valid"},
+		{"MEETS_BASIC_INTEGRITY", "invalid"},
+	} {
+		mock.ExpectExec(`INSERT INTO attestations`).WillReturnResult(sqlmock.NewResult(1, 1))
+		count, sum := observed(tt.outcome)
+		if _, err := svc.VerifyAttestation(context.Background(), &AttestationRequest{Platform: "android", Token: tt.token}); err != nil {
+			t.Fatalf("VerifyAttestation(%s): %v", tt.token, err)
+		}
+		if gotCount, gotSum := observed(tt.outcome); gotCount != count+1 || gotSum-sum != 2 {
+			t.Errorf("%s duration: got %d observations totalling %vs, want one of 2s", tt.outcome, gotCount-count, gotSum-sum)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDesktop_SignedChallengeVerifiesAgainstEnrolledKey(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _ := appAttestService()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc.db = db.NewFromPool(sqlDB)
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	statement := func(deviceID, challenge string, signature []byte) *AttestationRequest {
+		token, _ := json.Marshal(desktopStatement{Challenge: challenge, Signature: signature})
+		return &AttestationRequest{Platform: "desktop", DeviceID: deviceID, Token: string(token)}
+	}
+	enrolled := func(deviceID string) {
+		mock.ExpectQuery(`FROM desktop_device_keys`).WithArgs(deviceID).
+			WillReturnRows(sqlmock.NewRows([]string{"public_key"}).AddRow([]byte(publicKey)))
+	}
+
+	challenge, _ := svc.GenerateChallenge(ctx, "device-1", "")
+	enrolled("device-1")
+	result, err := svc.verifyDesktopStatement(ctx, statement("device-1", challenge, ed25519.Sign(privateKey, []byte(challenge))))
+	if err != nil || !result.IsValid || result.DeviceIntegrity != "MEETS_DEVICE_INTEGRITY" {
+		t.Fatalf("signed challenge: got %+v, %v", result, err)
+	}
+	if svc.ShouldUseHoneypot(ctx, "device-1", "", result) {
+		t.Error("verified desktop device routed to honeypots")
+	}
+
+	// The challenge was consumed
+	result, _ = svc.verifyDesktopStatement(ctx, statement("device-1", challenge, ed25519.Sign(privateKey, []byte(challenge))))
+	if result.IsValid || result.Reason != "challenge_invalid" {
+		t.Errorf("reused challenge: got %+v", result)
+	}
+
+	// A signature over something else does not verify
+	challenge, _ = svc.GenerateChallenge(ctx, "device-1", "")
+	enrolled("device-1")
+	result, _ = svc.verifyDesktopStatement(ctx, statement("device-1", challenge, ed25519.Sign(privateKey, []byte("other"))))
+	if result.IsValid || result.Reason != "desktop_signature_invalid" {
+		t.Errorf("wrong signature: got %+v", result)
+	}
+	if !svc.ShouldUseHoneypot(ctx, "device-1", "", result) {
+		t.Error("failed desktop statement not routed to honeypots")
+	}
+
+	// A device that never enrolled cannot attest
+	challenge, _ = svc.GenerateChallenge(ctx, "device-2", "")
+	mock.ExpectQuery(`FROM desktop_device_keys`).WithArgs("device-2").WillReturnRows(sqlmock.NewRows([]string{"public_key"}))
+	result, _ = svc.verifyDesktopStatement(ctx, statement("device-2", challenge, ed25519.Sign(privateKey, []byte(challenge))))
+	if result.IsValid || result.Reason != "device_not_enrolled" {
+		t.Errorf("unenrolled device: got %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEnrollDesktopKey_RejectsMalformedKey(t *testing.T) {
+	svc := &AttestationService{}
+	err := svc.EnrollDesktopKey(context.Background(), "device-1", []byte("short"))
+	if !errors.Is(err, apperr.ErrInvalidInput) {
+		t.Errorf("got %v, want invalid input", err)
+	}
+}
+
+func TestCheckDowngrade_Transitions(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		previous string // Empty: no earlier attestation
+		current  string
+		want     bool
+	}{
+		{"strong to basic", "MEETS_STRONG_INTEGRITY", "MEETS_BASIC_INTEGRITY", true},
+		{"strong to device", "MEETS_STRONG_INTEGRITY", "MEETS_DEVICE_INTEGRITY", true},
+		{"device to unknown", "MEETS_DEVICE_INTEGRITY", "UNKNOWN", true},
+		{"strong to strong", "MEETS_STRONG_INTEGRITY", "MEETS_STRONG_INTEGRITY", false},
+		{"basic to strong", "MEETS_BASIC_INTEGRITY", "MEETS_STRONG_INTEGRITY", false},
+		{"first attestation", "", "MEETS_BASIC_INTEGRITY", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+			rows := sqlmock.NewRows([]string{"device_integrity"})
+			if tt.previous != "" {
+				rows.AddRow(tt.previous)
+			}
+			// Compared with the last verdict that was not a downgrade itself
+			mock.ExpectQuery(`SELECT device_integrity\s+FROM attestations\s+WHERE .* AND NOT downgraded`).
+				WithArgs("device-1", "android").WillReturnRows(rows)
+
+			svc := &AttestationService{db: db.NewFromPool(sqlDB)}
+			counter := metrics.AttestationDowngrades.WithLabelValues("android", tt.previous, tt.current)
+			before := testutil.ToFloat64(counter)
+			result := &AttestationResult{IsValid: true, Platform: "android", DeviceIntegrity: tt.current}
+			svc.checkDowngrade(ctx, &AttestationRequest{Platform: "android", DeviceID: "device-1"}, result)
+
+			if result.Downgraded != tt.want {
+				t.Errorf("downgraded: got %v, want %v", result.Downgraded, tt.want)
+			}
+			if got := testutil.ToFloat64(counter) - before; (got == 1) != tt.want {
+				t.Errorf("downgrade counter delta: got %v", got)
+			}
+			if tt.want && !svc.ShouldUseHoneypot(ctx, "device-1", "", result) {
+				t.Error("downgraded device not routed to honeypots")
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCheckDowngrade_LookupFailureLeavesResultUnflagged(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	mock.ExpectQuery(`FROM attestations`).WillReturnError(errors.New("connection refused"))
+
+	svc := &AttestationService{db: db.NewFromPool(sqlDB)}
+	result := &AttestationResult{IsValid: true, Platform: "android", DeviceIntegrity: "MEETS_BASIC_INTEGRITY"}
+	svc.checkDowngrade(context.Background(), &AttestationRequest{Platform: "android", DeviceID: "device-1"}, result)
+	if result.Downgraded {
+		t.Error("result flagged although the history could not be read")
+	}
+}
@@ -0,0 +1,147 @@
+// Package audit implements the tamper-evident admin audit log: a hash chain
+// over admin actions and signed exports that can be verified offline.
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"rendezvous/internal/apperr"
+)
+
+// GenesisHash is the previous hash of the first entry in the chain.
+var GenesisHash = strings.Repeat("0", 64)
+
+var (
+	// ErrBrokenChain is returned when entries are missing, reordered, or do
+	// not link to the previous entry's hash.
+	ErrBrokenChain = apperr.New(apperr.ErrConflict, "audit_chain_invalid", "audit chain is broken")
+	// ErrTamperedEntry is returned when an entry's contents do not match its hash.
+	ErrTamperedEntry = apperr.New(apperr.ErrConflict, "audit_chain_invalid", "audit entry has been modified")
+	// ErrInvalidExportSignature is returned when an export's signature does
+	// not cover its head, or was not made with the trusted key.
+	ErrInvalidExportSignature = apperr.New(apperr.ErrUnauthorized, "invalid_export_signature", "audit export signature is invalid")
+)
+
+// Entry is one admin action in the chain. Hash covers every other field,
+// including PrevHash, so changing or removing any entry breaks every later link.
+type Entry struct {
+	Seq         int64           `json:"seq"` // 1 for the first entry, then consecutive
+	Actor       string          `json:"actor"`
+	Action      string          `json:"action"`
+	SubjectType string          `json:"subject_type"`
+	SubjectID   string          `json:"subject_id"`
+	Details     json.RawMessage `json:"details"`
+	CreatedAt   time.Time       `json:"created_at"`
+	PrevHash    string          `json:"prev_hash"`
+	Hash        string          `json:"hash"`
+}
+
+// hashedEntry fixes the field order and encoding that Hash is computed over.
+type hashedEntry struct {
+	Seq         int64           `json:"seq"`
+	Actor       string          `json:"actor"`
+	Action      string          `json:"action"`
+	SubjectType string          `json:"subject_type"`
+	SubjectID   string          `json:"subject_id"`
+	Details     json.RawMessage `json:"details"`
+	CreatedAt   int64           `json:"created_at"` // Unix microseconds, the precision Postgres stores
+	PrevHash    string          `json:"prev_hash"`
+}
+
+// ComputeHash returns the hex SHA-256 of the entry's canonical encoding.
+func ComputeHash(e *Entry) (string, error) {
+	details := e.Details
+	if len(details) == 0 {
+		details = json.RawMessage("{}")
+	}
+	data, err := json.Marshal(hashedEntry{
+		Seq:         e.Seq,
+		Actor:       e.Actor,
+		Action:      e.Action,
+		SubjectType: e.SubjectType,
+		SubjectID:   e.SubjectID,
+		Details:     details,
+		CreatedAt:   e.CreatedAt.UnixMicro(),
+		PrevHash:    e.PrevHash,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// VerifyChain checks that entries form an unbroken chain starting at the
+// genesis entry, and returns the head hash.
+func VerifyChain(entries []Entry) (string, error) {
+	prev := GenesisHash
+	for i := range entries {
+		e := &entries[i]
+		if e.Seq != int64(i+1) || e.PrevHash != prev {
+			return "", fmt.Errorf("%w at seq %d", ErrBrokenChain, e.Seq)
+		}
+		hash, err := ComputeHash(e)
+		if err != nil {
+			return "", err
+		}
+		if hash != e.Hash {
+			return "", fmt.Errorf("%w: seq %d", ErrTamperedEntry, e.Seq)
+		}
+		prev = e.Hash
+	}
+	return prev, nil
+}
+
+// Export is a full copy of the chain with a signature over its head, so that
+// dropping entries from the end is detectable as well.
+type Export struct {
+	Entries    []Entry   `json:"entries"`
+	HeadSeq    int64     `json:"head_seq"`
+	HeadHash   string    `json:"head_hash"`
+	ExportedAt time.Time `json:"exported_at"`
+	KeyID      string    `json:"key_id"`
+	PublicKey  []byte    `json:"public_key"`
+	Signature  []byte    `json:"signature"`
+}
+
+// NewExport verifies entries and returns an unsigned export of them.
+func NewExport(entries []Entry, exportedAt time.Time) (*Export, error) {
+	head, err := VerifyChain(entries)
+	if err != nil {
+		return nil, err
+	}
+	return &Export{
+		Entries:    entries,
+		HeadSeq:    int64(len(entries)),
+		HeadHash:   head,
+		ExportedAt: exportedAt.UTC().Truncate(time.Second),
+	}, nil
+}
+
+// ExportMessage returns the message signed for an export.
+func ExportMessage(headSeq int64, headHash string, exportedAt time.Time) []byte {
+	return []byte(fmt.Sprintf("lumenlink-audit-export\n%d\n%s\n%d", headSeq, headHash, exportedAt.Unix()))
+}
+
+// VerifyExport checks an export offline: the chain, that its head matches the
+// signed head, and that the signature was made with trustedKey.
+func VerifyExport(export *Export, trustedKey ed25519.PublicKey) error {
+	head, err := VerifyChain(export.Entries)
+	if err != nil {
+		return err
+	}
+	if int64(len(export.Entries)) != export.HeadSeq || head != export.HeadHash {
+		return fmt.Errorf("%w: entries end at seq %d, signed head is seq %d", ErrBrokenChain, len(export.Entries), export.HeadSeq)
+	}
+	if len(trustedKey) != ed25519.PublicKeySize ||
+		!ed25519.Verify(trustedKey, ExportMessage(export.HeadSeq, export.HeadHash, export.ExportedAt), export.Signature) {
+		return ErrInvalidExportSignature
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testChain builds a valid chain of n entries.
+func testChain(t *testing.T, n int) []Entry {
+	t.Helper()
+	entries := make([]Entry, 0, n)
+	prev := GenesisHash
+	start := time.Date(2026, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	for i := 1; i <= n; i++ {
+		e := Entry{
+			Seq:         int64(i),
+			Actor:       "alice",
+			Action:      "rollout.put",
+			SubjectType: "rollout",
+			SubjectID:   "scan_interval_120",
+			Details:     json.RawMessage(`{"percentage":25,"region":"me-south-1"}`),
+			CreatedAt:   start.Add(time.Duration(i) * time.Minute),
+			PrevHash:    prev,
+		}
+		hash, err := ComputeHash(&e)
+		if err != nil {
+			t.Fatalf("ComputeHash: %v", err)
+		}
+		e.Hash = hash
+		prev = hash
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func signedExport(t *testing.T, entries []Entry, privateKey ed25519.PrivateKey) *Export {
+	t.Helper()
+	export, err := NewExport(entries, time.Now())
+	if err != nil {
+		t.Fatalf("NewExport: %v", err)
+	}
+	export.Signature = ed25519.Sign(privateKey, ExportMessage(export.HeadSeq, export.HeadHash, export.ExportedAt))
+	return export
+}
+
+func TestVerifyChain(t *testing.T) {
+	entries := testChain(t, 4)
+	head, err := VerifyChain(entries)
+	if err != nil {
+		t.Fatalf("VerifyChain: %v", err)
+	}
+	if head != entries[3].Hash {
+		t.Errorf("head: got %s, want %s", head, entries[3].Hash)
+	}
+
+	empty, err := VerifyChain(nil)
+	if err != nil || empty != GenesisHash {
+		t.Errorf("empty chain: got %q, %v; want genesis", empty, err)
+	}
+}
+
+func TestComputeHash_DetailsWhitespace(t *testing.T) {
+	a := testChain(t, 1)[0]
+	b := a
+	b.Details = json.RawMessage("{ \"percentage\": 25, \"region\": \"me-south-1\" }")
+	hashA, _ := ComputeHash(&a)
+	hashB, _ := ComputeHash(&b)
+	if hashA != hashB {
+		t.Error("hash depends on details whitespace")
+	}
+}
+
+func TestVerifyChain_DetectsTampering(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func([]Entry) []Entry
+		wantErr error
+	}{
+		{"modified details", func(e []Entry) []Entry {
+			e[1].Details = json.RawMessage(`{"percentage":100,"region":"me-south-1"}`)
+			return e
+		}, ErrTamperedEntry},
+		{"modified actor", func(e []Entry) []Entry {
+			e[2].Actor = "mallory"
+			return e
+		}, ErrTamperedEntry},
+		{"modified timestamp", func(e []Entry) []Entry {
+			e[0].CreatedAt = e[0].CreatedAt.Add(time.Microsecond)
+			return e
+		}, ErrTamperedEntry},
+		{"rehashed entry", func(e []Entry) []Entry {
+			e[1].Actor = "mallory"
+			e[1].Hash, _ = ComputeHash(&e[1])
+			return e
+		}, ErrBrokenChain},
+		{"deleted entry", func(e []Entry) []Entry {
+			return append(e[:1], e[2:]...)
+		}, ErrBrokenChain},
+		{"deleted first entry", func(e []Entry) []Entry {
+			return e[1:]
+		}, ErrBrokenChain},
+		{"reordered entries", func(e []Entry) []Entry {
+			e[1], e[2] = e[2], e[1]
+			return e
+		}, ErrBrokenChain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyChain(tt.mutate(testChain(t, 4)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyChain: got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyExport(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	export := signedExport(t, testChain(t, 3), privateKey)
+	if err := VerifyExport(export, publicKey); err != nil {
+		t.Fatalf("VerifyExport: %v", err)
+	}
+	if err := VerifyExport(export, otherKey); !errors.Is(err, ErrInvalidExportSignature) {
+		t.Errorf("untrusted key: got %v, want ErrInvalidExportSignature", err)
+	}
+}
+
+func TestVerifyExport_DetectsTruncation(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	// Dropping the newest entries leaves a valid chain that no longer
+	// reaches the signed head
+	export := signedExport(t, testChain(t, 3), privateKey)
+	export.Entries = export.Entries[:2]
+	if err := VerifyExport(export, publicKey); !errors.Is(err, ErrBrokenChain) {
+		t.Errorf("truncated entries: got %v, want ErrBrokenChain", err)
+	}
+
+	// Moving the head back to match fails the signature instead
+	export.HeadSeq = 2
+	export.HeadHash = export.Entries[1].Hash
+	if err := VerifyExport(export, publicKey); !errors.Is(err, ErrInvalidExportSignature) {
+		t.Errorf("rewritten head: got %v, want ErrInvalidExportSignature", err)
+	}
+}
+
+func TestVerifyExport_JSONRoundTrip(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	export := signedExport(t, testChain(t, 2), privateKey)
+
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded Export
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if err := VerifyExport(&decoded, publicKey); err != nil {
+		t.Errorf("VerifyExport after round trip: %v", err)
+	}
+}
+
+func TestNewExport_RefusesBrokenChain(t *testing.T) {
+	entries := testChain(t, 2)
+	entries[0].Action = "gateway.reject"
+	if _, err := NewExport(entries, time.Now()); !errors.Is(err, ErrTamperedEntry) {
+		t.Errorf("NewExport: got %v, want ErrTamperedEntry", err)
+	}
+}
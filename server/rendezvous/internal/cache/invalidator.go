@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// InvalidationChannel is the Redis pub/sub channel carrying policy table names.
+const InvalidationChannel = "lumenlink:policy-invalidate"
+
+// Invalidator broadcasts cache invalidations between replicas.
+type Invalidator interface {
+	// Publish announces that table changed.
+	Publish(ctx context.Context, table string) error
+	// Subscribe registers a callback for invalidations published by any replica.
+	Subscribe(onInvalidate func(table string)) error
+	// Close stops delivering invalidations.
+	Close() error
+}
+
+// RedisInvalidator carries invalidations over Redis pub/sub. Messages missed
+// while Redis is unreachable are bounded by the cache TTL.
+type RedisInvalidator struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+}
+
+// NewRedisInvalidator creates an invalidator using the given client
+func NewRedisInvalidator(client *redis.Client) *RedisInvalidator {
+	return &RedisInvalidator{client: client}
+}
+
+// Publish implements Invalidator
+func (r *RedisInvalidator) Publish(ctx context.Context, table string) error {
+	if err := r.client.Publish(ctx, InvalidationChannel, table).Err(); err != nil {
+		return fmt.Errorf("failed to publish invalidation: %w", err)
+	}
+	return nil
+}
+
+// Subscribe implements Invalidator. It waits for Redis to confirm the
+// subscription, then delivers messages in the background.
+func (r *RedisInvalidator) Subscribe(onInvalidate func(table string)) error {
+	pubsub := r.client.Subscribe(context.Background(), InvalidationChannel)
+	if _, err := pubsub.Receive(context.Background()); err != nil {
+		pubsub.Close()
+		return fmt.Errorf("failed to subscribe to invalidations: %w", err)
+	}
+	r.pubsub = pubsub
+
+	go func() {
+		for msg := range pubsub.Channel() {
+			onInvalidate(msg.Payload)
+		}
+		log.Println("policy cache invalidation subscription closed")
+	}()
+	return nil
+}
+
+// Close implements Invalidator
+func (r *RedisInvalidator) Close() error {
+	if r.pubsub == nil {
+		return nil
+	}
+	return r.pubsub.Close()
+}
+
+// LocalBus delivers invalidations synchronously between caches in one process.
+// It stands in for Redis in tests and single-replica setups.
+type LocalBus struct {
+	mu          sync.Mutex
+	subscribers []func(table string)
+}
+
+// NewLocalBus creates an in-process invalidation bus
+func NewLocalBus() *LocalBus {
+	return &LocalBus{}
+}
+
+// Invalidator returns a handle on the bus for one cache
+func (b *LocalBus) Invalidator() Invalidator {
+	return &localInvalidator{bus: b}
+}
+
+type localInvalidator struct {
+	bus    *LocalBus
+	mu     sync.Mutex
+	closed bool
+}
+
+func (l *localInvalidator) Publish(_ context.Context, table string) error {
+	l.bus.mu.Lock()
+	subscribers := append([]func(string){}, l.bus.subscribers...)
+	l.bus.mu.Unlock()
+
+	for _, onInvalidate := range subscribers {
+		onInvalidate(table)
+	}
+	return nil
+}
+
+func (l *localInvalidator) Subscribe(onInvalidate func(table string)) error {
+	l.bus.mu.Lock()
+	defer l.bus.mu.Unlock()
+	l.bus.subscribers = append(l.bus.subscribers, func(table string) {
+		l.mu.Lock()
+		closed := l.closed
+		l.mu.Unlock()
+		if !closed {
+			onInvalidate(table)
+		}
+	})
+	return nil
+}
+
+func (l *localInvalidator) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return nil
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+)
+
+// Policy tables cached by PolicyCache. Each is small enough to load whole.
+const (
+	TableRollouts          = "rollouts"
+	TableLaunchRegions     = "launch_open_regions"
+	TableTransportPolicies = "transport_policies"
+	TableTransports        = "transports"
+	TableDiscoveryConfigs  = "discovery_configs"
+	TableExperiments       = "experiments"
+	TableSettings          = "settings"
+	TableRendezvousMirrors = "rendezvous_mirrors"
+	TableRegions           = "regions"
+	// Not a table but an aggregate of gateways; nothing invalidates it, so it
+	// is as fresh as the TTL
+	TableRegionLoads = "region_loads"
+)
+
+// PolicyCache is a read-through cache for low-cardinality policy tables that
+// are consulted on every config request. Entries expire after a short TTL, and
+// admin mutations invalidate them explicitly across replicas through an
+// Invalidator, so a change is visible on the next request rather than after
+// the TTL.
+type PolicyCache struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	clock       clock.Clock
+	entries     map[string]*policyEntry
+	generations map[string]uint64
+	invalidator Invalidator
+}
+
+type policyEntry struct {
+	value    interface{}
+	loadedAt time.Time
+}
+
+// NewPolicyCache creates a cache with the given TTL. If invalidator is non-nil
+// the cache subscribes to it; call Close to unsubscribe.
+func NewPolicyCache(ttl time.Duration, invalidator Invalidator) (*PolicyCache, error) {
+	c := &PolicyCache{
+		ttl:         ttl,
+		clock:       clock.Real{},
+		entries:     make(map[string]*policyEntry),
+		generations: make(map[string]uint64),
+		invalidator: invalidator,
+	}
+	if invalidator != nil {
+		if err := invalidator.Subscribe(c.drop); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Load returns the cached value for table, calling load on a miss or after the
+// TTL. Cached values are shared between callers and must not be modified.
+func Load[T any](ctx context.Context, c *PolicyCache, table string, load func(context.Context) (T, error)) (T, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[table]; ok && c.clock.Now().Sub(entry.loadedAt) < c.ttl {
+		c.mu.Unlock()
+		return entry.value.(T), nil
+	}
+	generation := c.generations[table]
+	c.mu.Unlock()
+
+	value, err := load(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	c.mu.Lock()
+	// An invalidation that arrived while loading may mean value is already
+	// stale; serve it to this caller but don't cache it.
+	if c.generations[table] == generation {
+		c.entries[table] = &policyEntry{value: value, loadedAt: c.clock.Now()}
+	}
+	c.mu.Unlock()
+
+	return value, nil
+}
+
+// Invalidate drops the cached table on this replica and publishes the
+// invalidation to the others. Admin endpoints call it after every mutation.
+func (c *PolicyCache) Invalidate(ctx context.Context, table string) error {
+	c.drop(table)
+	if c.invalidator == nil {
+		return nil
+	}
+	return c.invalidator.Publish(ctx, table)
+}
+
+// Close unsubscribes from invalidations.
+func (c *PolicyCache) Close() error {
+	if c.invalidator == nil {
+		return nil
+	}
+	return c.invalidator.Close()
+}
+
+func (c *PolicyCache) drop(table string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, table)
+	c.generations[table]++
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"rendezvous/internal/clock"
+)
+
+func TestLoad_CachesWithinTTL(t *testing.T) {
+	policy, err := NewPolicyCache(time.Minute, nil)
+	if err != nil {
+		t.Fatalf("NewPolicyCache: %v", err)
+	}
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	policy.clock = fake
+
+	var loads int32
+	load := func(context.Context) (int, error) {
+		return int(atomic.AddInt32(&loads, 1)), nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if v, _ := Load(context.Background(), policy, TableRollouts, load); v != 1 {
+			t.Errorf("Load within TTL: got %d, want 1", v)
+		}
+	}
+
+	fake.Advance(time.Minute)
+	if v, _ := Load(context.Background(), policy, TableRollouts, load); v != 2 {
+		t.Errorf("Load after TTL: got %d, want 2", v)
+	}
+}
+
+func TestInvalidate_PropagatesAcrossReplicas(t *testing.T) {
+	bus := NewLocalBus()
+	replicaA, err := NewPolicyCache(time.Hour, bus.Invalidator())
+	if err != nil {
+		t.Fatalf("NewPolicyCache: %v", err)
+	}
+	replicaB, err := NewPolicyCache(time.Hour, bus.Invalidator())
+	if err != nil {
+		t.Fatalf("NewPolicyCache: %v", err)
+	}
+
+	// The shared "database" both replicas read from
+	var percentage int32 = 10
+	load := func(context.Context) (int32, error) { return atomic.LoadInt32(&percentage), nil }
+
+	ctx := context.Background()
+	for _, replica := range []*PolicyCache{replicaA, replicaB} {
+		if v, _ := Load(ctx, replica, TableRollouts, load); v != 10 {
+			t.Fatalf("initial Load: got %d, want 10", v)
+		}
+	}
+
+	// An admin mutation on replica A commits, then invalidates
+	atomic.StoreInt32(&percentage, 50)
+	if err := replicaA.Invalidate(ctx, TableRollouts); err != nil {
+		t.Fatalf("Invalidate: %v", err)
+	}
+
+	// The very next request on either replica sees the change, long before the TTL
+	for name, replica := range map[string]*PolicyCache{"A": replicaA, "B": replicaB} {
+		if v, _ := Load(ctx, replica, TableRollouts, load); v != 50 {
+			t.Errorf("replica %s after invalidation: got %d, want 50", name, v)
+		}
+	}
+}
+
+func TestInvalidate_DuringLoadIsNotCached(t *testing.T) {
+	policy, err := NewPolicyCache(time.Hour, nil)
+	if err != nil {
+		t.Fatalf("NewPolicyCache: %v", err)
+	}
+
+	ctx := context.Background()
+	stale := func(context.Context) (string, error) {
+		// The row changes and is invalidated while this read is in flight
+		policy.Invalidate(ctx, TableRollouts)
+		return "stale", nil
+	}
+	if v, _ := Load(ctx, policy, TableRollouts, stale); v != "stale" {
+		t.Fatalf("Load: got %q", v)
+	}
+
+	fresh := func(context.Context) (string, error) { return "fresh", nil }
+	if v, _ := Load(ctx, policy, TableRollouts, fresh); v != "fresh" {
+		t.Errorf("Load after racing invalidation: got %q, want fresh", v)
+	}
+}
+
+func TestClose_StopsInvalidations(t *testing.T) {
+	bus := NewLocalBus()
+	publisher, _ := NewPolicyCache(time.Hour, bus.Invalidator())
+	closed, _ := NewPolicyCache(time.Hour, bus.Invalidator())
+
+	ctx := context.Background()
+	Load(ctx, closed, TableRollouts, func(context.Context) (int, error) { return 1, nil })
+	closed.Close()
+	publisher.Invalidate(ctx, TableRollouts)
+
+	if v, _ := Load(ctx, closed, TableRollouts, func(context.Context) (int, error) { return 2, nil }); v != 1 {
+		t.Errorf("closed cache was invalidated: got %d, want 1", v)
+	}
+}
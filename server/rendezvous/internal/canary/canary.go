@@ -0,0 +1,386 @@
+// Package canary lets a newly deployed replica check, before it takes
+// traffic, that it builds the same packs as the rest of the fleet. The
+// replica previews packs for a fixed set of synthetic profiles, asks a
+// healthy peer for the same previews, and stays unready if the
+// policy-relevant parts of any pack differ beyond an allowlist.
+package canary
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/config"
+	"rendezvous/internal/metrics"
+)
+
+// Profile is a synthetic device, sent as an admin pack preview request
+type Profile struct {
+	Name      string `json:"-"`
+	DeviceID  string `json:"device_id"`
+	Region    string `json:"region"`
+	Platform  string `json:"platform"`
+	Integrity string `json:"integrity,omitempty"`
+	Revoked   bool   `json:"revoked,omitempty"`
+}
+
+// DefaultProfiles cover each attestation tier in the default region. Fixed
+// device IDs keep rollout cohorts the same on both sides.
+var DefaultProfiles = []Profile{
+	{Name: "android_strong", DeviceID: "canary-android-strong", Region: "us-east-1", Platform: "android", Integrity: "MEETS_STRONG_INTEGRITY"},
+	{Name: "android_basic", DeviceID: "canary-android-basic", Region: "us-east-1", Platform: "android", Integrity: "MEETS_BASIC_INTEGRITY"},
+	{Name: "android_unattested", DeviceID: "canary-android-unattested", Region: "us-east-1", Platform: "android"},
+	{Name: "ios_revoked", DeviceID: "canary-ios-revoked", Region: "us-east-1", Platform: "ios", Revoked: true},
+}
+
+// Previewer builds the pack a profile would receive
+type Previewer interface {
+	Preview(ctx context.Context, profile Profile) (*config.SignedConfigPack, error)
+}
+
+// PreviewerFunc adapts a function to Previewer
+type PreviewerFunc func(ctx context.Context, profile Profile) (*config.SignedConfigPack, error)
+
+// Preview calls f
+func (f PreviewerFunc) Preview(ctx context.Context, profile Profile) (*config.SignedConfigPack, error) {
+	return f(ctx, profile)
+}
+
+// Config controls the canary check
+type Config struct {
+	PeerURL      string          // Base URL of a healthy replica running the fleet version
+	PeerToken    string          // Admin token for the peer's preview endpoint
+	Allowed      map[string]bool // Fields whose differences do not block readiness
+	RetryEvery   time.Duration   // Wait between attempts while the peer is unreachable
+	RecheckEvery time.Duration   // Wait before comparing again after a failed comparison
+}
+
+// LoadConfigFromEnv reads the canary config from the environment. The peer
+// token defaults to this replica's own admin token.
+func LoadConfigFromEnv() Config {
+	cfg := Config{
+		PeerURL:      strings.TrimRight(strings.TrimSpace(os.Getenv("LUMENLINK_CANARY_PEER_URL")), "/"),
+		PeerToken:    os.Getenv("LUMENLINK_CANARY_PEER_TOKEN"),
+		Allowed:      map[string]bool{},
+		RetryEvery:   10 * time.Second,
+		RecheckEvery: time.Minute,
+	}
+	if cfg.PeerToken == "" {
+		cfg.PeerToken = os.Getenv("LUMENLINK_ADMIN_TOKEN")
+	}
+	for _, field := range strings.Split(os.Getenv("LUMENLINK_CANARY_ALLOWED_DIFFS"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			cfg.Allowed[field] = true
+		}
+	}
+	if value := strings.TrimSpace(os.Getenv("LUMENLINK_CANARY_RETRY_INTERVAL")); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			cfg.RetryEvery = d
+		}
+	}
+	if value := strings.TrimSpace(os.Getenv("LUMENLINK_CANARY_RECHECK_INTERVAL")); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			cfg.RecheckEvery = d
+		}
+	}
+	return cfg
+}
+
+// Difference is one policy-relevant field that differs between two packs
+type Difference struct {
+	Profile string `json:"profile"`
+	Field   string `json:"field"`
+	Local   string `json:"local"` // Canonical JSON
+	Peer    string `json:"peer"`
+	Allowed bool   `json:"allowed"`
+}
+
+// Diff compares the policy-relevant fields of two packs built for the same
+// profile: gateway selection, transports, discovery, the signing key and
+// policy metadata. Timestamps, signatures, gateway load and the client ID
+// are expected to differ and are ignored.
+func Diff(local, peer *config.SignedConfigPack) []Difference {
+	localFields, peerFields := packFields(local), packFields(peer)
+	var diffs []Difference
+	for _, field := range sortedKeys(localFields, peerFields) {
+		if localFields[field] != peerFields[field] {
+			diffs = append(diffs, Difference{Field: field, Local: localFields[field], Peer: peerFields[field]})
+		}
+	}
+	return diffs
+}
+
+// comparedMetadata are the pack metadata keys set by policy
+var comparedMetadata = []string{"key_id", "region", "region_status", "notices"}
+
+// packFields flattens the compared parts of a pack to canonical JSON. Lists
+// whose order is not policy (gateways, transports of equal priority,
+// discovery channels, features) are sorted first, so two replicas that built
+// them in a different order compare equal on every run.
+func packFields(pack *config.SignedConfigPack) map[string]string {
+	ids := make([]string, 0, len(pack.Gateways))
+	honeypots := 0
+	seen := map[string]bool{}
+	var gatewayTransports []string
+	for _, gw := range pack.Gateways {
+		ids = append(ids, gw.ID)
+		if gw.IsHoneypot {
+			honeypots++
+		}
+		for _, transport := range gw.Transports {
+			if !seen[transport] {
+				seen[transport] = true
+				gatewayTransports = append(gatewayTransports, transport)
+			}
+		}
+	}
+	sort.Strings(ids)
+	sort.Strings(gatewayTransports)
+
+	fields := map[string]string{
+		"version":                 canonical(pack.Version),
+		"gateways.ids":            canonical(ids),
+		"gateways.honeypots":      canonical(honeypots),
+		"gateways.transports":     canonical(gatewayTransports),
+		"transports":              canonical(sortedTransports(pack.Transports)),
+		"discovery.channels":      canonical(sortedStrings(pack.Discovery.Channels)),
+		"discovery.scan_interval": canonical(pack.Discovery.ScanInterval),
+		"discovery.battery_aware": canonical(pack.Discovery.BatteryAware),
+	}
+	for _, key := range comparedMetadata {
+		fields["metadata."+key] = canonical(pack.Metadata[key])
+	}
+	fields["metadata.features"] = canonical(sortedFeatures(pack.Metadata["features"]))
+	return fields
+}
+
+// sortedTransports copies transports in priority order, ties broken by
+// type, with each transport's endpoints sorted
+func sortedTransports(transports []config.TransportConfig) []config.TransportConfig {
+	sorted := make([]config.TransportConfig, len(transports))
+	for i, transport := range transports {
+		transport.Endpoints = sortedStrings(transport.Endpoints)
+		sorted[i] = transport
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority > sorted[j].Priority
+		}
+		return sorted[i].Type < sorted[j].Type
+	})
+	return sorted
+}
+
+// sortedFeatures sorts a features list, as built locally ([]string) or
+// decoded from a peer ([]interface{}); anything else is returned as is
+func sortedFeatures(v interface{}) interface{} {
+	switch features := v.(type) {
+	case []string:
+		return sortedStrings(features)
+	case []interface{}:
+		names := make([]string, 0, len(features))
+		for _, feature := range features {
+			name, ok := feature.(string)
+			if !ok {
+				return v
+			}
+			names = append(names, name)
+		}
+		return sortedStrings(names)
+	}
+	return v
+}
+
+func sortedStrings(values []string) []string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// canonical encodes v as JSON; maps encode with sorted keys, so values
+// decoded from a peer's response compare equal to the local originals.
+func canonical(v interface{}) string {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(encoded)
+}
+
+func sortedKeys(a, b map[string]string) []string {
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Check runs the canary comparison and holds its verdict. A nil Check is
+// always ready.
+type Check struct {
+	local    Previewer
+	peer     Previewer
+	profiles []Profile
+	config   Config
+	clock    clock.Clock
+
+	mu     sync.Mutex
+	status string
+}
+
+// Check statuses
+const (
+	StatusPending = "canary_pending"
+	StatusPassed  = "canary_passed"
+	StatusFailed  = "canary_failed"
+)
+
+// NewCheck creates a pending check comparing local against peer
+func NewCheck(local, peer Previewer, profiles []Profile, cfg Config) *Check {
+	return &Check{local: local, peer: peer, profiles: profiles, config: cfg, clock: clock.Real{}, status: StatusPending}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (c *Check) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// Status returns StatusPending until a comparison completes
+func (c *Check) Status() string {
+	if c == nil {
+		return StatusPassed
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// Ready reports whether the replica may take traffic
+func (c *Check) Ready() bool {
+	return c.Status() == StatusPassed
+}
+
+// Run previews every profile on both sides and records the verdict. It
+// returns every difference found, allowed or not. An error means the
+// comparison could not be made and the check stays pending.
+func (c *Check) Run(ctx context.Context) ([]Difference, error) {
+	var diffs []Difference
+	for _, profile := range c.profiles {
+		local, err := c.local.Preview(ctx, profile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to preview %s locally: %w", profile.Name, err)
+		}
+		peer, err := c.peer.Preview(ctx, profile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to preview %s on the peer: %w", profile.Name, err)
+		}
+		for _, diff := range Diff(local, peer) {
+			diff.Profile = profile.Name
+			diff.Allowed = c.config.Allowed[diff.Field]
+			diffs = append(diffs, diff)
+		}
+	}
+
+	status := StatusPassed
+	for _, diff := range diffs {
+		outcome := "allowed"
+		if !diff.Allowed {
+			outcome = "blocking"
+			status = StatusFailed
+		}
+		metrics.CanaryDifferences.WithLabelValues(diff.Field, outcome).Inc()
+		log.Printf("canary: %s differs for %s (%s): local %s, peer %s", diff.Field, diff.Profile, outcome, diff.Local, diff.Peer)
+	}
+	c.mu.Lock()
+	c.status = status
+	c.mu.Unlock()
+	return diffs, nil
+}
+
+// Start runs the comparison, retrying every RetryEvery while it cannot be
+// made, and logs the verdict. A failed comparison is run again every
+// RecheckEvery, since the difference may be the peer's, e.g. mid-deploy. It
+// returns when a comparison passes or ctx is done.
+func (c *Check) Start(ctx context.Context) {
+	for {
+		diffs, err := c.Run(ctx)
+		wait := c.config.RetryEvery
+		switch {
+		case err != nil:
+			log.Printf("canary: %v; retrying in %s", err, wait)
+		case c.Status() == StatusPassed:
+			log.Printf("canary: %s against %s with %d differences", c.Status(), c.config.PeerURL, len(diffs))
+			return
+		default:
+			wait = c.config.RecheckEvery
+			log.Printf("canary: %s against %s with %d differences; comparing again in %s",
+				c.Status(), c.config.PeerURL, len(diffs), wait)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.clock.After(wait):
+		}
+	}
+}
+
+// PeerPreviewer previews packs on another replica through its admin
+// preview endpoint
+type PeerPreviewer struct {
+	URL    string // Base URL, without the path
+	Token  string
+	Client *http.Client
+}
+
+// NewPeerPreviewer creates a previewer for the configured peer
+func NewPeerPreviewer(cfg Config) *PeerPreviewer {
+	return &PeerPreviewer{URL: cfg.PeerURL, Token: cfg.PeerToken, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Preview fetches the peer's preview for profile
+func (p *PeerPreviewer) Preview(ctx context.Context, profile Profile) (*config.SignedConfigPack, error) {
+	body, err := json.Marshal(profile)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL+"/api/v1/admin/packs/preview", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.Token)
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("preview returned status %d", resp.StatusCode)
+	}
+	var preview struct {
+		ConfigPack *config.SignedConfigPack `json:"config_pack"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&preview); err != nil {
+		return nil, fmt.Errorf("failed to decode preview: %w", err)
+	}
+	if preview.ConfigPack == nil {
+		return nil, fmt.Errorf("preview has no config pack")
+	}
+	return preview.ConfigPack, nil
+}
@@ -0,0 +1,225 @@
+package canary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/config"
+)
+
+func testPack() *config.SignedConfigPack {
+	return &config.SignedConfigPack{
+		Version:   "1.0",
+		Timestamp: 1700000000,
+		Gateways: []config.GatewayInfo{
+			{ID: "gw-a", Address: "192.0.2.1", Port: 443, Transports: []string{"masque"}, Region: "us-east-1", Load: 0.2},
+			{ID: "gw-b", Address: "192.0.2.2", Port: 443, Transports: []string{"xtls"}, Region: "us-east-1", Load: 0.5, IsHoneypot: true},
+		},
+		Transports: []config.TransportConfig{
+			{Type: "masque", Endpoints: []string{"/masque"}, Options: map[string]string{"alpn": "h3", "mtu": "1350"}, Priority: 40},
+			{Type: "ssh", Endpoints: []string{"a.example", "b.example"}, Priority: 20},
+			{Type: "xtls", Endpoints: []string{"/xtls"}, Priority: 20},
+		},
+		Discovery: config.DiscoveryConfig{Channels: []string{"gps", "dtv"}, ScanInterval: 300, BatteryAware: true},
+		Metadata: map[string]interface{}{
+			"client_id": "canary-android-strong",
+			"region":    "us-east-1",
+			"key_id":    "0123456789abcdef",
+			"features":  []string{"scan_interval_120", "battery_aware"},
+		},
+		Signature: []byte("local signature"),
+	}
+}
+
+// viaJSON round-trips a pack as a peer's response would
+func viaJSON(t *testing.T, pack *config.SignedConfigPack) *config.SignedConfigPack {
+	t.Helper()
+	encoded, err := json.Marshal(pack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded config.SignedConfigPack
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return &decoded
+}
+
+func TestDiff_Equivalent(t *testing.T) {
+	peer := viaJSON(t, testPack())
+	// Ignored: build time, signature, live load, client ID and gateway order
+	peer.Timestamp++
+	peer.Signature = []byte("peer signature")
+	peer.Gateways[0].Load = 0.9
+	peer.Gateways[0], peer.Gateways[1] = peer.Gateways[1], peer.Gateways[0]
+	peer.Metadata["client_id"] = "other"
+	// Nor the order of lists that is not policy
+	peer.Transports[1], peer.Transports[2] = peer.Transports[2], peer.Transports[1]
+	peer.Transports[2].Endpoints = []string{"b.example", "a.example"}
+	peer.Discovery.Channels = []string{"dtv", "gps"}
+	peer.Metadata["features"] = []interface{}{"battery_aware", "scan_interval_120"}
+
+	if diffs := Diff(testPack(), peer); len(diffs) != 0 {
+		t.Errorf("Diff of equivalent packs: %+v", diffs)
+	}
+}
+
+func TestDiff_Divergent(t *testing.T) {
+	tests := []struct {
+		field  string
+		change func(*config.SignedConfigPack)
+	}{
+		{"gateways.ids", func(p *config.SignedConfigPack) { p.Gateways[0].ID = "gw-c" }},
+		{"gateways.honeypots", func(p *config.SignedConfigPack) { p.Gateways[1].IsHoneypot = false }},
+		{"gateways.transports", func(p *config.SignedConfigPack) { p.Gateways[0].Transports = []string{"ssh"} }},
+		{"transports", func(p *config.SignedConfigPack) { p.Transports[0].Options["mtu"] = "1280" }},
+		{"discovery.channels", func(p *config.SignedConfigPack) { p.Discovery.Channels = []string{"gps"} }},
+		{"discovery.scan_interval", func(p *config.SignedConfigPack) { p.Discovery.ScanInterval = 120 }},
+		{"metadata.key_id", func(p *config.SignedConfigPack) { p.Metadata["key_id"] = "fedcba9876543210" }},
+		{"metadata.features", func(p *config.SignedConfigPack) { delete(p.Metadata, "features") }},
+		{"transports", func(p *config.SignedConfigPack) { p.Transports[0].Priority = 10 }},
+		{"metadata.region_status", func(p *config.SignedConfigPack) { p.Metadata["region_status"] = "closed" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			peer := viaJSON(t, testPack())
+			tt.change(peer)
+			diffs := Diff(testPack(), peer)
+			if len(diffs) != 1 || diffs[0].Field != tt.field {
+				t.Fatalf("got %+v, want one difference in %s", diffs, tt.field)
+			}
+		})
+	}
+}
+
+func staticPreviewer(pack *config.SignedConfigPack, err error) Previewer {
+	return PreviewerFunc(func(context.Context, Profile) (*config.SignedConfigPack, error) { return pack, err })
+}
+
+func TestCheck_Run(t *testing.T) {
+	divergent := testPack()
+	divergent.Gateways[0].ID = "gw-c"
+
+	tests := []struct {
+		name    string
+		peer    *config.SignedConfigPack
+		allowed map[string]bool
+		want    string
+	}{
+		{"equivalent", testPack(), nil, StatusPassed},
+		{"divergent", divergent, nil, StatusFailed},
+		{"allowlisted", divergent, map[string]bool{"gateways.ids": true}, StatusPassed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiles := DefaultProfiles[:1]
+			check := NewCheck(staticPreviewer(testPack(), nil), staticPreviewer(tt.peer, nil), profiles, Config{Allowed: tt.allowed})
+			if check.Ready() {
+				t.Fatal("ready before running")
+			}
+			diffs, err := check.Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if got := check.Status(); got != tt.want {
+				t.Errorf("status %s, want %s (diffs %+v)", got, tt.want, diffs)
+			}
+			for _, diff := range diffs {
+				if diff.Profile != profiles[0].Name {
+					t.Errorf("difference not attributed to the profile: %+v", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestCheck_StartRechecksAfterFailure(t *testing.T) {
+	divergent := testPack()
+	divergent.Gateways[0].ID = "gw-c"
+	var mu sync.Mutex
+	peerPack := divergent
+	peer := PreviewerFunc(func(context.Context, Profile) (*config.SignedConfigPack, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return peerPack, nil
+	})
+
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	check := NewCheck(staticPreviewer(testPack(), nil), peer, DefaultProfiles[:1],
+		Config{RetryEvery: time.Second, RecheckEvery: time.Minute})
+	check.SetClock(clk)
+	done := make(chan struct{})
+	go func() {
+		check.Start(context.Background())
+		close(done)
+	}()
+
+	// The peer finishes its deploy; the next comparison passes
+	clk.BlockUntil(1)
+	if check.Status() != StatusFailed {
+		t.Fatalf("status %s, want %s", check.Status(), StatusFailed)
+	}
+	mu.Lock()
+	peerPack = testPack()
+	mu.Unlock()
+	clk.Advance(time.Second)
+	if check.Status() != StatusFailed {
+		t.Fatal("compared again before RecheckEvery")
+	}
+	clk.Advance(time.Minute)
+	<-done
+	if !check.Ready() {
+		t.Errorf("status %s after the peer converged", check.Status())
+	}
+}
+
+func TestCheck_RunStaysPendingWhenPeerFails(t *testing.T) {
+	check := NewCheck(staticPreviewer(testPack(), nil), staticPreviewer(nil, errors.New("connection refused")), DefaultProfiles, Config{})
+	if _, err := check.Run(context.Background()); err == nil {
+		t.Fatal("Run succeeded without the peer")
+	}
+	if check.Status() != StatusPending {
+		t.Errorf("status %s, want %s", check.Status(), StatusPending)
+	}
+	var unset *Check
+	if !unset.Ready() {
+		t.Error("a nil check must be ready")
+	}
+}
+
+func TestPeerPreviewer(t *testing.T) {
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/admin/packs/preview" || r.Header.Get("Authorization") != "Bearer peer-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var profile Profile
+		if err := json.NewDecoder(r.Body).Decode(&profile); err != nil || profile.DeviceID != "canary-android-strong" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"config_pack": testPack(), "trace": map[string]interface{}{}})
+	}))
+	defer peer.Close()
+
+	previewer := NewPeerPreviewer(Config{PeerURL: peer.URL, PeerToken: "peer-token"})
+	pack, err := previewer.Preview(context.Background(), DefaultProfiles[0])
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if diffs := Diff(testPack(), pack); len(diffs) != 0 {
+		t.Errorf("peer pack differs: %+v", diffs)
+	}
+
+	previewer.Token = "wrong"
+	if _, err := previewer.Preview(context.Background(), DefaultProfiles[0]); err == nil {
+		t.Error("Preview succeeded with a rejected token")
+	}
+}
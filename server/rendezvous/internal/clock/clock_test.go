@@ -0,0 +1,79 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func fired(ch <-chan time.Time) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFake_TimerFiresAtDeadline(t *testing.T) {
+	clock := NewFake(start)
+	timer := clock.NewTimer(time.Minute)
+
+	clock.Advance(time.Minute - time.Nanosecond)
+	if fired(timer.C()) {
+		t.Fatal("timer fired before its deadline")
+	}
+	clock.Advance(time.Nanosecond)
+	if !fired(timer.C()) {
+		t.Fatal("timer did not fire at its deadline")
+	}
+	if timer.Stop() {
+		t.Error("Stop reported a fired timer as pending")
+	}
+	if clock.Waiters() != 0 {
+		t.Errorf("waiters: got %d, want 0", clock.Waiters())
+	}
+}
+
+func TestFake_StoppedTimerNeverFires(t *testing.T) {
+	clock := NewFake(start)
+	timer := clock.NewTimer(time.Second)
+	if !timer.Stop() {
+		t.Fatal("Stop reported a pending timer as fired")
+	}
+	clock.Advance(time.Hour)
+	if fired(timer.C()) {
+		t.Error("stopped timer fired")
+	}
+}
+
+func TestFake_TickerDropsMissedTicks(t *testing.T) {
+	clock := NewFake(start)
+	ticker := clock.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	clock.Advance(3*time.Minute + 30*time.Second)
+	if got := <-ticker.C(); !got.Equal(start.Add(3*time.Minute + 30*time.Second)) {
+		t.Errorf("tick: got %v", got)
+	}
+	if fired(ticker.C()) {
+		t.Error("missed ticks were queued")
+	}
+	clock.Advance(30 * time.Second)
+	if !fired(ticker.C()) {
+		t.Error("ticker did not fire at its next deadline")
+	}
+}
+
+func TestFake_BlockUntil(t *testing.T) {
+	clock := NewFake(start)
+	done := make(chan time.Time)
+	go func() { done <- <-clock.After(time.Second) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if got := <-done; !got.Equal(start.Add(time.Second)) {
+		t.Errorf("After: got %v", got)
+	}
+}
@@ -0,0 +1,47 @@
+package config
+
+// AdmissionDeferred is set as metadata.admission on packs for new devices
+// that are over their region's admission cap.
+const AdmissionDeferred = "deferred"
+
+// NoticeAdmissionDeferred is the message key added to deferred packs.
+const NoticeAdmissionDeferred = "admission_deferred"
+
+// DeferredConfigPack builds a signed "come back later" pack for a new device
+// that is over its region's admission cap. It lists no gateways; the client
+// retries after retryAfter seconds and presents token for priority admission.
+// The pack is generated in packVersion, or the current format when empty,
+// and signed in sigAlg, or ed25519 when empty.
+func (s *ConfigService) DeferredConfigPack(
+	clientID string,
+	region string,
+	locale string,
+	packVersion string,
+	sigAlg string,
+	retryAfter int,
+	token string,
+) (*SignedConfigPack, error) {
+	pack := &SignedConfigPack{
+		Timestamp:    s.clock.Now().Unix(),
+		Gateways:     []GatewayInfo{},
+		Transports:   []TransportConfig{},
+		Discovery:    DiscoveryConfig{Channels: []string{}},
+		KillSwitches: map[string]string{},
+		Mirrors:      []string{},
+		Metadata: map[string]interface{}{
+			"client_id":          clientID,
+			"region":             region,
+			"admission":          AdmissionDeferred,
+			"retry_after":        retryAfter,
+			"waiting_room_token": token,
+		},
+	}
+	if notices := s.resolveNotices(locale, []string{NoticeAdmissionDeferred}, nil); len(notices) > 0 {
+		pack.Metadata["notices"] = notices
+	}
+
+	if err := s.generatePack(pack, packVersion, sigAlg); err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
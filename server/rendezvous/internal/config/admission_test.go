@@ -0,0 +1,35 @@
+package config
+
+import "testing"
+
+func TestDeferredConfigPack(t *testing.T) {
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	pack, err := svc.DeferredConfigPack("client-1", "ap-east-1", "es", "", "", 90, "token")
+	if err != nil {
+		t.Fatalf("DeferredConfigPack: %v", err)
+	}
+	if !svc.VerifyConfigPack(pack) {
+		t.Error("deferred pack signature does not verify")
+	}
+	if len(pack.Gateways) != 0 {
+		t.Errorf("deferred pack lists %d gateways", len(pack.Gateways))
+	}
+	for key, want := range map[string]interface{}{
+		"admission":          AdmissionDeferred,
+		"retry_after":        90,
+		"waiting_room_token": "token",
+		"region":             "ap-east-1",
+	} {
+		if pack.Metadata[key] != want {
+			t.Errorf("metadata %s: got %v, want %v", key, pack.Metadata[key], want)
+		}
+	}
+	notices, _ := pack.Metadata["notices"].([]Notice)
+	if len(notices) != 1 || notices[0].Key != NoticeAdmissionDeferred || notices[0].Locale != "es" {
+		t.Errorf("notices: got %+v, want %s in es", notices, NoticeAdmissionDeferred)
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"log"
+	"time"
+
+	"rendezvous/internal/db"
+)
+
+// AnnouncementVersion is the format of gateway announcements
+const AnnouncementVersion = "1.0"
+
+// GatewayAnnouncement lists the gateways a deployment offers to federation
+// peers. It is signed like a 1.0 pack, with the config signing key, and
+// peers verify it against that key pinned when they added us.
+type GatewayAnnouncement struct {
+	Version   string        `json:"version"`
+	Issuer    string        `json:"issuer"`
+	Timestamp int64         `json:"timestamp"`
+	Gateways  []GatewayInfo `json:"gateways"`
+	Signature []byte        `json:"signature"`
+	PublicKey []byte        `json:"public_key"`
+}
+
+// SignAnnouncement stamps an announcement with key's public key and signs it
+func SignAnnouncement(announcement *GatewayAnnouncement, key ed25519.PrivateKey) error {
+	return signAnnouncement(announcement, newKeySigner(key))
+}
+
+// signAnnouncement is SignAnnouncement with signer's key
+func signAnnouncement(announcement *GatewayAnnouncement, signer Signer) error {
+	announcement.PublicKey = signer.PublicKey()
+	announcement.Signature = nil
+	signature, err := signJSON(signer, *announcement)
+	if err != nil {
+		return fmt.Errorf("failed to sign gateway announcement: %w", err)
+	}
+	announcement.Signature = signature
+	return nil
+}
+
+// VerifyAnnouncement reports whether an announcement was signed by
+// trustedKey. The key the announcement carries is not trusted.
+func VerifyAnnouncement(announcement *GatewayAnnouncement, trustedKey ed25519.PublicKey) bool {
+	unsigned := *announcement
+	unsigned.Signature = nil
+	return verifyJSON(trustedKey, unsigned, announcement.Signature)
+}
+
+// AnnouncementRequestMessage is what a federation peer signs to fetch an
+// announcement: the request path and the time it was sent
+func AnnouncementRequestMessage(path string, timestamp int64) []byte {
+	return []byte(fmt.Sprintf("lumenlink-federation-request\n%s\n%d", path, timestamp))
+}
+
+// SignAnnouncementRequest signs a request for a peer's announcement with the
+// config signing key, which the peer pinned when it added us. It returns the
+// key's ID, by which the peer finds the key, and the signature.
+func (s *ConfigService) SignAnnouncementRequest(path string, timestamp int64) (string, []byte, error) {
+	key := s.signingKey()
+	signature, err := key.Signer.Sign(AnnouncementRequestMessage(path, timestamp))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to sign announcement request: %w", err)
+	}
+	return key.ID, signature, nil
+}
+
+// EnableFederatedGateways lets packs include gateways imported from
+// federation peers whose last announcement is younger than maxAge
+func (s *ConfigService) EnableFederatedGateways(maxAge time.Duration) {
+	s.federationMaxAge = maxAge
+}
+
+// federatedGateways returns the imported gateways for a region, or none
+// when federation is off. A failed lookup leaves them out rather than
+// failing the pack.
+func (s *ConfigService) federatedGateways(ctx context.Context, region string, trace *DecisionTrace) []*db.Gateway {
+	if s.federationMaxAge <= 0 {
+		return nil
+	}
+	gateways, err := s.db.GetFederatedGateways(ctx, region, s.clock.Now().Add(-s.federationMaxAge))
+	if err != nil {
+		log.Printf("federated gateways unavailable, building pack without them: %v", err)
+		trace.Record("federated_gateways", "lookup_failed", map[string]interface{}{"error": err.Error()})
+		return nil
+	}
+	trace.Record("federated_gateways", "included", map[string]interface{}{"candidates": len(gateways)})
+	return gateways
+}
+
+// GatewayAnnouncement announces our own active, approved gateways, signed.
+// Honeypots and gateways imported from peers are never announced.
+func (s *ConfigService) GatewayAnnouncement(ctx context.Context, issuer string) (*GatewayAnnouncement, error) {
+	gateways, err := s.db.GetAllGateways(ctx)
+	if err != nil {
+		return nil, err
+	}
+	announced := gateways[:0]
+	for _, gw := range gateways {
+		if gw.Status == "active" && !gw.IsHoneypot {
+			announced = append(announced, gw)
+		}
+	}
+
+	announcement := &GatewayAnnouncement{
+		Version:   AnnouncementVersion,
+		Issuer:    issuer,
+		Timestamp: s.clock.Now().Unix(),
+		Gateways:  s.gatewayInfos(announced),
+	}
+	if err := signAnnouncement(announcement, s.signingKey().Signer); err != nil {
+		return nil, err
+	}
+	return announcement, nil
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+func TestGenerateConfigPack_IncludesFederatedGateways(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	svc.EnableFederatedGateways(time.Hour)
+
+	now := time.Now()
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns).
+		AddRow(secretGatewayID, []byte("gateway-public-key"), "198.51.100.7", 443, "{parasite}", "{}",
+			"us-east-1", 100, 90, 100, "active", false, nil, "approved", nil, now, now, now))
+	mock.ExpectQuery(`FROM federated_gateways`).WithArgs("us-east-1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "public_key", "ip_address", "port", "transport_types", "region", "load", "imported_at", "updated_at", "name",
+		}).AddRow("0c7d9e4f-1a2b-4c3d-8e5f-6a7b8c9d0e1f", make([]byte, ed25519.PublicKeySize), "203.0.113.9", 8443, "{masque}",
+			"us-east-1", 0.1, now, now, "partner"))
+
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "",
+		&AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	if len(pack.Gateways) != 2 {
+		t.Fatalf("got %d gateways, want the local and the federated one", len(pack.Gateways))
+	}
+	// The federated gateway reports a lower load, so it sorts first
+	federated, local := pack.Gateways[0], pack.Gateways[1]
+	if federated.Origin != "partner" || federated.Load != 0.1 || federated.Address != "203.0.113.9" {
+		t.Errorf("federated gateway: got %+v", federated)
+	}
+	if local.Origin != "" {
+		t.Errorf("local gateway origin: got %q, want none", local.Origin)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyAnnouncement(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	announcement := &GatewayAnnouncement{
+		Version:   AnnouncementVersion,
+		Issuer:    "partner",
+		Timestamp: time.Now().Unix(),
+		Gateways:  []GatewayInfo{{ID: "gw-1", Address: "203.0.113.9", Port: 443, Region: "us-east-1"}},
+	}
+	if err := SignAnnouncement(announcement, priv); err != nil {
+		t.Fatalf("SignAnnouncement: %v", err)
+	}
+	if !VerifyAnnouncement(announcement, pub) {
+		t.Fatal("signed announcement does not verify")
+	}
+	if VerifyAnnouncement(announcement, otherPub) {
+		t.Error("announcement verified against a key that did not sign it")
+	}
+	announcement.Timestamp++
+	if VerifyAnnouncement(announcement, pub) {
+		t.Error("tampered timestamp verified")
+	}
+}
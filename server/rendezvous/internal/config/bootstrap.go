@@ -0,0 +1,83 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+
+	"rendezvous/internal/gateway"
+)
+
+// GatewayBootstrap is everything a newly enrolled gateway agent needs to
+// start serving, signed with the config signing key like a pack.
+type GatewayBootstrap struct {
+	GatewayID      string                    `json:"gateway_id"`
+	OperatorID     string                    `json:"operator_id"`
+	Region         string                    `json:"region"`
+	ApprovalStatus string                    `json:"approval_status"` // Pending gateways are not served to clients until approved
+	Credentials    BootstrapCredentials      `json:"credentials"`
+	Transports     []TransportConfig         `json:"transports"` // What clients are told about the gateway's transports
+	Heartbeat      gateway.HeartbeatSchedule `json:"heartbeat"`
+	IssuedAt       int64                     `json:"issued_at"`
+	Signature      []byte                    `json:"signature"`
+}
+
+// BootstrapCredentials is the credential material in a bootstrap. The
+// gateway's own key never leaves the agent.
+type BootstrapCredentials struct {
+	ConfigPublicKey []byte `json:"config_public_key"` // Verifies this bootstrap and config packs
+	KeyID           string `json:"key_id"`
+	TransportSecret []byte `json:"transport_secret,omitempty"` // Initial transport secret, when secrets are configured
+}
+
+// GatewayTransports returns the transport configs clients in region receive
+// for the given transport types, in pack order.
+func (s *ConfigService) GatewayTransports(ctx context.Context, region string, types []string) []TransportConfig {
+	wanted := map[string]bool{}
+	for _, t := range types {
+		wanted[t] = true
+	}
+	transports := []TransportConfig{}
+	for _, transport := range s.getTransportConfigs(ctx, region, nil) {
+		if wanted[transport.Type] {
+			transports = append(transports, transport)
+		}
+	}
+	return transports
+}
+
+// SignGatewayBootstrap fills in the config key and signs the bootstrap over
+// its JSON encoding without the signature.
+func (s *ConfigService) SignGatewayBootstrap(bootstrap *GatewayBootstrap) error {
+	key := s.signingKey()
+	bootstrap.Credentials.ConfigPublicKey = key.PublicKey
+	bootstrap.Credentials.KeyID = key.ID
+	unsigned := *bootstrap
+	unsigned.Signature = nil
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return fmt.Errorf("failed to encode gateway bootstrap: %w", err)
+	}
+	signature, err := key.Signer.Sign(data)
+	if err != nil {
+		return err
+	}
+	bootstrap.Signature = signature
+	return nil
+}
+
+// VerifyGatewayBootstrap checks a bootstrap's signature against publicKey,
+// the config key the agent was provisioned with.
+func VerifyGatewayBootstrap(bootstrap *GatewayBootstrap, publicKey ed25519.PublicKey) bool {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	unsigned := *bootstrap
+	unsigned.Signature = nil
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(publicKey, data, bootstrap.Signature)
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+// DefaultGatewayCacheTTL is how long a region's gateway candidates are
+// reused
+const DefaultGatewayCacheTTL = 60 * time.Second
+
+// maxCachedCandidates bounds the candidate cache; regions come from clients
+const maxCachedCandidates = 1024
+
+// gatewayCandidates are the gateways a region's packs are selected from,
+// each list sorted by load. They are shared with the cache and must not be
+// modified.
+type gatewayCandidates struct {
+	gateways  []*db.Gateway
+	honeypots []*db.Gateway // Nil unless honeypots are mixed in
+	borrowed  []string      // Nearby regions gateways were borrowed from
+}
+
+// gatewayCandidateCache keeps the candidates for a region and honeypot
+// decision, so packs within the TTL select from them instead of querying
+// gateways again. Gateway changes reach packs within the TTL.
+type gatewayCandidateCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	clock   clock.Clock
+	entries map[string]*cachedCandidates
+}
+
+type cachedCandidates struct {
+	candidates *gatewayCandidates
+	loadedAt   time.Time
+}
+
+func newGatewayCandidateCache(ttl time.Duration) *gatewayCandidateCache {
+	return &gatewayCandidateCache{ttl: ttl, clock: clock.Real{}, entries: map[string]*cachedCandidates{}}
+}
+
+// candidatesKey identifies the inputs candidates depend on
+func candidatesKey(region string, withHoneypots bool, selection SelectionConfig) string {
+	return strings.Join([]string{
+		region,
+		strconv.FormatBool(withHoneypots),
+		strconv.FormatBool(selection.IncludeDegraded),
+		strconv.Itoa(selection.CandidateLimit),
+		strconv.Itoa(selection.MinGateways),
+	}, "|")
+}
+
+// get returns the unexpired candidates for key, or nil, counting the hit or
+// miss. A disabled cache neither hits nor counts.
+func (c *gatewayCandidateCache) get(key string) *gatewayCandidates {
+	if c == nil || c.ttl <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	hit := ok && c.clock.Now().Sub(entry.loadedAt) < c.ttl
+	c.mu.Unlock()
+	if !hit {
+		metrics.ConfigGatewayCache.WithLabelValues("miss").Inc()
+		return nil
+	}
+	metrics.ConfigGatewayCache.WithLabelValues("hit").Inc()
+	return entry.candidates
+}
+
+// put caches candidates under key. When the cache is full, expired entries
+// are dropped, and if none had expired it starts over.
+func (c *gatewayCandidateCache) put(key string, candidates *gatewayCandidates) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	if len(c.entries) >= maxCachedCandidates {
+		for k, entry := range c.entries {
+			if now.Sub(entry.loadedAt) >= c.ttl {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCachedCandidates {
+			c.entries = map[string]*cachedCandidates{}
+		}
+	}
+	c.entries[key] = &cachedCandidates{candidates: candidates, loadedAt: now}
+}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Message keys added to packs for clients below their platform's minimum
+// and recommended versions
+const (
+	NoticeUpdateRequired  = "update_required"
+	NoticeUpdateAvailable = "update_available"
+)
+
+// UpgradeTransport is the type of the only transport in a pack for a client
+// below its platform's minimum version. Its endpoints hold where to get the
+// update; it carries no gateway.
+const UpgradeTransport = "upgrade"
+
+// Client version statuses against a platform's requirement
+const (
+	ClientVersionCurrent     = "current"     // At or above the recommended version, or no requirement applies
+	ClientVersionOutdated    = "outdated"    // Below the recommended version
+	ClientVersionUnsupported = "unsupported" // Below the minimum version; the client must upgrade
+)
+
+// ClientInfo is what a client reports about itself in a config request
+type ClientInfo struct {
+	Platform     string // android, ios or desktop
+	Version      string // The client's version, e.g. 1.4.2
+	SignatureAlg string // The algorithm its pack is signed in; empty for ed25519
+	Address      string // The client's IP address; unattested devices' gateway subsets go by its network
+}
+
+// VersionRequirement is the client versions a platform accepts. Clients
+// below MinVersion are sent only upgrade instructions.
+type VersionRequirement struct {
+	MinVersion         string `json:"min_version,omitempty"`
+	RecommendedVersion string `json:"recommended_version,omitempty"`
+	UpgradeURL         string `json:"upgrade_url,omitempty"` // Where outdated clients get the update
+}
+
+// loadVersionRequirements reads LUMENLINK_CLIENT_VERSIONS, a JSON object
+// mapping platforms to their version requirements, e.g.
+// {"android": {"min_version": "1.4.0", "recommended_version": "1.6.0"}}.
+// Unset, no platform has a requirement.
+func loadVersionRequirements() (map[string]VersionRequirement, error) {
+	requirements := map[string]VersionRequirement{}
+	value := strings.TrimSpace(os.Getenv("LUMENLINK_CLIENT_VERSIONS"))
+	if value == "" {
+		return requirements, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&requirements); err != nil {
+		return nil, fmt.Errorf("invalid LUMENLINK_CLIENT_VERSIONS: %w", err)
+	}
+	for platform, requirement := range requirements {
+		if err := requirement.validate(); err != nil {
+			return nil, fmt.Errorf("invalid client versions for %s: %w", platform, err)
+		}
+	}
+	return requirements, nil
+}
+
+func (r VersionRequirement) validate() error {
+	for _, version := range []string{r.MinVersion, r.RecommendedVersion} {
+		if version == "" {
+			continue
+		}
+		if _, err := parseVersion(version); err != nil {
+			return err
+		}
+	}
+	if r.MinVersion != "" && r.RecommendedVersion != "" && CompareVersions(r.MinVersion, r.RecommendedVersion) > 0 {
+		return fmt.Errorf("minimum version %s is above the recommended version %s", r.MinVersion, r.RecommendedVersion)
+	}
+	if r.UpgradeURL != "" {
+		if parsed, err := url.Parse(r.UpgradeURL); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("upgrade URL %q is not an https URL", r.UpgradeURL)
+		}
+	}
+	return nil
+}
+
+// status returns where version stands against the requirement. A missing or
+// unparseable version cannot be compared, so it is treated as current.
+func (r VersionRequirement) status(version string) string {
+	if _, err := parseVersion(version); err != nil {
+		return ClientVersionCurrent
+	}
+	switch {
+	case r.MinVersion != "" && CompareVersions(version, r.MinVersion) < 0:
+		return ClientVersionUnsupported
+	case r.RecommendedVersion != "" && CompareVersions(version, r.RecommendedVersion) < 0:
+		return ClientVersionOutdated
+	default:
+		return ClientVersionCurrent
+	}
+}
+
+// clientVersion returns the requirement for a client's platform, if it has
+// one, and the client's status against it
+func (s *ConfigService) clientVersion(client ClientInfo, trace *DecisionTrace) (VersionRequirement, string, bool) {
+	requirement, ok := s.clientVersions[client.Platform]
+	if !ok {
+		return VersionRequirement{}, ClientVersionCurrent, false
+	}
+	status := requirement.status(client.Version)
+	trace.Record("client_version", status, map[string]interface{}{
+		"platform":            client.Platform,
+		"version":             client.Version,
+		"min_version":         requirement.MinVersion,
+		"recommended_version": requirement.RecommendedVersion,
+	})
+	return requirement, status, true
+}
+
+// setVersionMetadata records the requirement and whether the client must
+// upgrade in a pack's signed metadata
+func setVersionMetadata(pack *SignedConfigPack, requirement VersionRequirement, status string) {
+	if requirement.MinVersion != "" {
+		pack.Metadata["min_version"] = requirement.MinVersion
+	}
+	if requirement.RecommendedVersion != "" {
+		pack.Metadata["recommended_version"] = requirement.RecommendedVersion
+	}
+	pack.Metadata["force_upgrade"] = status == ClientVersionUnsupported
+}
+
+// upgradeConfigPack builds the pack for a client below its platform's
+// minimum version. It lists no gateways, since the client's transports may
+// be broken, and its only transport tells the client where to upgrade.
+func (s *ConfigService) upgradeConfigPack(
+	clientID string,
+	region string,
+	locale string,
+	client ClientInfo,
+	requirement VersionRequirement,
+	trace *DecisionTrace,
+) *SignedConfigPack {
+	endpoints := []string{}
+	if requirement.UpgradeURL != "" {
+		endpoints = append(endpoints, requirement.UpgradeURL)
+	}
+	pack := &SignedConfigPack{
+		Timestamp: s.clock.Now().Unix(),
+		Gateways:  []GatewayInfo{},
+		Transports: []TransportConfig{{
+			Type:      UpgradeTransport,
+			Endpoints: endpoints,
+			Options: map[string]string{
+				"platform":    client.Platform,
+				"min_version": requirement.MinVersion,
+			},
+		}},
+		Discovery: DiscoveryConfig{Channels: []string{}},
+		Metadata: map[string]interface{}{
+			"client_id": clientID,
+			"region":    region,
+		},
+	}
+	setVersionMetadata(pack, requirement, ClientVersionUnsupported)
+	if notices := s.resolveNotices(locale, []string{NoticeUpdateRequired}, trace); len(notices) > 0 {
+		pack.Metadata["notices"] = notices
+	}
+	return pack
+}
+
+// CompareVersions compares two semver-like versions, returning -1, 0 or 1.
+// A leading "v" and build metadata after "+" are ignored, missing numeric
+// parts count as 0 (1.4 equals 1.4.0), and a pre-release sorts before its
+// release (1.4.0-beta.2 is below 1.4.0). Versions that do not parse compare
+// as equal to everything.
+func CompareVersions(a, b string) int {
+	va, err := parseVersion(a)
+	if err != nil {
+		return 0
+	}
+	vb, err := parseVersion(b)
+	if err != nil {
+		return 0
+	}
+	for i := 0; i < max(len(va.numbers), len(vb.numbers)); i++ {
+		var na, nb uint64
+		if i < len(va.numbers) {
+			na = va.numbers[i]
+		}
+		if i < len(vb.numbers) {
+			nb = vb.numbers[i]
+		}
+		if na != nb {
+			return cmp.Compare(na, nb)
+		}
+	}
+	switch {
+	case len(va.prerelease) == 0 && len(vb.prerelease) == 0:
+		return 0
+	case len(va.prerelease) == 0:
+		return 1
+	case len(vb.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < min(len(va.prerelease), len(vb.prerelease)); i++ {
+		if c := comparePrerelease(va.prerelease[i], vb.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(va.prerelease), len(vb.prerelease))
+}
+
+// semver is a parsed semver-like version
+type semver struct {
+	numbers    []uint64
+	prerelease []string
+}
+
+// maxVersionLength bounds client-supplied versions before parsing
+const maxVersionLength = 64
+
+func parseVersion(s string) (semver, error) {
+	if s == "" || len(s) > maxVersionLength {
+		return semver{}, fmt.Errorf("invalid version %q", s)
+	}
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	s, _, _ = strings.Cut(s, "+")
+	core, prerelease, hasPrerelease := strings.Cut(s, "-")
+
+	var v semver
+	for _, part := range strings.Split(core, ".") {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return semver{}, fmt.Errorf("invalid version %q", s)
+		}
+		v.numbers = append(v.numbers, n)
+	}
+	if hasPrerelease {
+		for _, identifier := range strings.Split(prerelease, ".") {
+			if identifier == "" {
+				return semver{}, fmt.Errorf("invalid version %q", s)
+			}
+			v.prerelease = append(v.prerelease, identifier)
+		}
+	}
+	return v, nil
+}
+
+// comparePrerelease compares pre-release identifiers as semver does: numeric
+// identifiers numerically and below alphanumeric ones, which compare as text
+func comparePrerelease(a, b string) int {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
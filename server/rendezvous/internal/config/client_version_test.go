@@ -0,0 +1,165 @@
+package config
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.4.0", "1.4.0", 0},
+		{"1.4", "1.4.0", 0},
+		{"v1.4.0", "1.4.0", 0},
+		{"1.4.0+build.7", "1.4.0", 0},
+		{"1.4.1", "1.4.0", 1},
+		{"1.10.0", "1.9.9", 1},
+		{"2", "1.99", 1},
+		{"1.3.9", "1.4.0", -1},
+		{"1.4.0-beta.2", "1.4.0", -1},
+		{"1.4.0-beta.2", "1.4.0-beta.10", -1},
+		{"1.4.0-beta", "1.4.0-alpha", 1},
+		{"1.4.0-2", "1.4.0-beta", -1},
+		{"1.4.0-beta", "1.4.0-beta.1", -1},
+		{"1.4.0-rc.1", "1.3.9", 1},
+		{"not-a-version", "1.4.0", 0},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q): got %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := CompareVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareVersions(%q, %q): got %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestVersionRequirement_Status(t *testing.T) {
+	requirement := VersionRequirement{MinVersion: "1.4.0", RecommendedVersion: "1.6.0"}
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"1.3.9", ClientVersionUnsupported},
+		{"1.4.0-rc.1", ClientVersionUnsupported},
+		{"1.4.0", ClientVersionOutdated},
+		{"1.5.2", ClientVersionOutdated},
+		{"1.6.0", ClientVersionCurrent},
+		{"2.0.0", ClientVersionCurrent},
+		{"", ClientVersionCurrent},
+		{"1.x", ClientVersionCurrent},
+	}
+	for _, tt := range tests {
+		if got := requirement.status(tt.version); got != tt.want {
+			t.Errorf("status(%q): got %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestLoadVersionRequirements_Invalid(t *testing.T) {
+	for name, value := range map[string]string{
+		"not JSON":              `android: 1.4.0`,
+		"unknown field":         `{"android": {"minimum": "1.4.0"}}`,
+		"bad version":           `{"android": {"min_version": "latest"}}`,
+		"minimum above":         `{"ios": {"min_version": "2.0.0", "recommended_version": "1.9.0"}}`,
+		"upgrade URL not https": `{"ios": {"min_version": "1.0.0", "upgrade_url": "http://example.com/app"}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("LUMENLINK_CLIENT_VERSIONS", value)
+			if _, err := loadVersionRequirements(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestGenerateConfigPack_ClientVersion(t *testing.T) {
+	t.Setenv("LUMENLINK_CLIENT_VERSIONS",
+		`{"android": {"min_version": "1.4.0", "recommended_version": "1.6.0", "upgrade_url": "https://lumenlink.org/download"}}`)
+	ctx := context.Background()
+
+	t.Run("below the minimum gets only upgrade instructions", func(t *testing.T) {
+		// The upgrade pack is built without touching the database
+		svc, err := NewConfigService(nil)
+		if err != nil {
+			t.Fatalf("NewConfigService: %v", err)
+		}
+		for _, packVersion := range []string{PackVersion1, PackVersion2} {
+			pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", "", "",
+				ClientInfo{Platform: "android", Version: "1.3.2"}, packVersion, nil, nil)
+			if err != nil {
+				t.Fatalf("GenerateConfigPack %s: %v", packVersion, err)
+			}
+			if len(pack.Gateways) != 0 {
+				t.Errorf("%s: got %d gateways, want none", packVersion, len(pack.Gateways))
+			}
+			if len(pack.Transports) != 1 || pack.Transports[0].Type != UpgradeTransport ||
+				len(pack.Transports[0].Endpoints) != 1 || pack.Transports[0].Endpoints[0] != "https://lumenlink.org/download" {
+				t.Errorf("%s: transports got %+v, want the upgrade transport", packVersion, pack.Transports)
+			}
+			if pack.Metadata["force_upgrade"] != true || pack.Metadata["min_version"] != "1.4.0" ||
+				pack.Metadata["recommended_version"] != "1.6.0" {
+				t.Errorf("%s: metadata got %v", packVersion, pack.Metadata)
+			}
+			notices, _ := pack.Metadata["notices"].([]Notice)
+			if len(notices) != 1 || notices[0].Key != NoticeUpdateRequired {
+				t.Errorf("%s: notices got %v, want update_required", packVersion, notices)
+			}
+			if !svc.VerifyConfigPack(pack) {
+				t.Errorf("%s: upgrade pack must verify", packVersion)
+			}
+		}
+	})
+
+	tests := []struct {
+		name       string
+		client     ClientInfo
+		versioned  bool
+		wantNotice bool
+	}{
+		{"at the minimum is told an update is available", ClientInfo{Platform: "android", Version: "1.4.0"}, true, true},
+		{"at the recommended version", ClientInfo{Platform: "android", Version: "1.6.0"}, true, false},
+		{"above the recommended version", ClientInfo{Platform: "android", Version: "1.7.3"}, true, false},
+		{"without a version", ClientInfo{Platform: "android"}, true, false},
+		{"on a platform without a requirement", ClientInfo{Platform: "ios", Version: "0.1.0"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := NewConfigService(mustTestDBForPacks(t, 1))
+			if err != nil {
+				t.Fatalf("NewConfigService: %v", err)
+			}
+			pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", "", "", tt.client, "", nil, nil)
+			if err != nil {
+				t.Fatalf("GenerateConfigPack: %v", err)
+			}
+			for _, transport := range pack.Transports {
+				if transport.Type == UpgradeTransport {
+					t.Error("pack lists the upgrade transport")
+				}
+			}
+			if force, ok := pack.Metadata["force_upgrade"]; ok != tt.versioned || (ok && force != false) {
+				t.Errorf("force_upgrade: got %v (set %v)", force, ok)
+			}
+			if _, ok := pack.Metadata["min_version"]; ok != tt.versioned {
+				t.Errorf("min_version set: got %v, want %v", ok, tt.versioned)
+			}
+			notices, _ := pack.Metadata["notices"].([]Notice)
+			if got := len(notices) == 1 && notices[0].Key == NoticeUpdateAvailable; got != tt.wantNotice {
+				t.Errorf("update_available notice: got %v, want %v", notices, tt.wantNotice)
+			}
+			if !svc.VerifyConfigPack(pack) {
+				t.Error("pack must verify")
+			}
+		})
+	}
+}
+
+func TestPackBaseKey_ClientVersion(t *testing.T) {
+	if packBaseKey("us-east-1", true, nil, GatewayDetailFull, "android:"+ClientVersionOutdated, "", "", "", nil, nil, nil, nil, nil, nil) ==
+		packBaseKey("us-east-1", true, nil, GatewayDetailFull, "android:"+ClientVersionCurrent, "", "", "", nil, nil, nil, nil, nil, nil) {
+		t.Error("outdated clients share a base with current ones")
+	}
+}
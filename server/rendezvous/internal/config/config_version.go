@@ -0,0 +1,136 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"rendezvous/internal/db"
+)
+
+// DefaultStableConfigVersion names the stable config version when
+// LUMENLINK_CONFIG_VERSION is unset
+const DefaultStableConfigVersion = "stable"
+
+// ConfigVersion is a named set of pack parameters. The stable version
+// overrides nothing; a candidate replaces the transports and discovery
+// config it sets, for the devices its rollout includes.
+type ConfigVersion struct {
+	Version    string
+	Transports []TransportConfig // Nil keeps the stable transports
+	Discovery  *DiscoveryConfig  // Nil keeps the stable discovery config
+}
+
+// ConfigVersions are the stable config version and the candidate rolled out
+// in its place, if any
+type ConfigVersions struct {
+	Stable    *ConfigVersion
+	Candidate *ConfigVersion
+}
+
+// candidateParameters is the JSON form of LUMENLINK_CONFIG_CANDIDATE
+type candidateParameters struct {
+	Transports []TransportConfig `json:"transports"`
+	Discovery  *DiscoveryConfig  `json:"discovery"`
+}
+
+// loadConfigVersions reads the stable version's name from
+// LUMENLINK_CONFIG_VERSION, and a candidate from
+// LUMENLINK_CONFIG_CANDIDATE_VERSION and LUMENLINK_CONFIG_CANDIDATE, a JSON
+// object with the transports and discovery config it replaces.
+func loadConfigVersions() (ConfigVersions, error) {
+	stable := strings.TrimSpace(os.Getenv("LUMENLINK_CONFIG_VERSION"))
+	if stable == "" {
+		stable = DefaultStableConfigVersion
+	}
+	versions := ConfigVersions{Stable: &ConfigVersion{Version: stable}}
+
+	name := strings.TrimSpace(os.Getenv("LUMENLINK_CONFIG_CANDIDATE_VERSION"))
+	parameters := strings.TrimSpace(os.Getenv("LUMENLINK_CONFIG_CANDIDATE"))
+	if name == "" && parameters == "" {
+		return versions, nil
+	}
+	if name == "" || parameters == "" {
+		return ConfigVersions{}, fmt.Errorf("LUMENLINK_CONFIG_CANDIDATE_VERSION and LUMENLINK_CONFIG_CANDIDATE must be set together")
+	}
+	if name == stable {
+		return ConfigVersions{}, fmt.Errorf("candidate config version %q is the stable version", name)
+	}
+
+	var candidate candidateParameters
+	decoder := json.NewDecoder(bytes.NewReader([]byte(parameters)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&candidate); err != nil {
+		return ConfigVersions{}, fmt.Errorf("invalid candidate config %s: %w", name, err)
+	}
+	if candidate.Transports == nil && candidate.Discovery == nil {
+		return ConfigVersions{}, fmt.Errorf("candidate config %s changes nothing", name)
+	}
+	for _, transport := range candidate.Transports {
+		if transport.Type == "" {
+			return ConfigVersions{}, fmt.Errorf("candidate config %s has a transport without a type", name)
+		}
+		if transport.Weight < 0 {
+			return ConfigVersions{}, fmt.Errorf("candidate config %s has a transport with a negative weight", name)
+		}
+	}
+	if d := candidate.Discovery; d != nil {
+		stored := &db.DiscoveryConfig{Region: name, Channels: d.Channels, ScanInterval: d.ScanInterval}
+		if err := validateDiscoveryConfig(stored); err != nil {
+			return ConfigVersions{}, fmt.Errorf("invalid candidate config: %w", err)
+		}
+	}
+
+	versions.Candidate = &ConfigVersion{
+		Version:    name,
+		Transports: candidate.Transports,
+		Discovery:  candidate.Discovery,
+	}
+	return versions, nil
+}
+
+// configVersion returns the config version a device's pack is built from:
+// the candidate when its rollout includes the device, else the stable
+// version. Devices stay on the stable version when the rollout cannot be
+// read.
+func (s *ConfigService) configVersion(ctx context.Context, clientID, region string, trace *DecisionTrace) *ConfigVersion {
+	candidate := s.versions.Candidate
+	if candidate == nil || s.rollouts == nil {
+		return s.versions.Stable
+	}
+	included, err := s.rollouts.ShouldIncludeInRollout(ctx, clientID, candidate.Version, region)
+	if err != nil {
+		trace.Record("config_version", "lookup_failed", map[string]interface{}{"error": err.Error()})
+		return s.versions.Stable
+	}
+	if !included {
+		trace.Record("config_version", "stable", map[string]interface{}{"candidate": candidate.Version})
+		return s.versions.Stable
+	}
+	trace.Record("config_version", "candidate", map[string]interface{}{"candidate": candidate.Version})
+	return candidate
+}
+
+// transportConfigs returns copies of the version's transports, since
+// versions are shared by every pack
+func (v *ConfigVersion) transportConfigs() []TransportConfig {
+	transports := make([]TransportConfig, len(v.Transports))
+	for i, transport := range v.Transports {
+		options := make(map[string]string, len(transport.Options))
+		for k, value := range transport.Options {
+			options[k] = value
+		}
+		transports[i] = TransportConfig{
+			Type:        transport.Type,
+			Endpoints:   append([]string{}, transport.Endpoints...),
+			Fingerprint: transport.Fingerprint,
+			Options:     options,
+			Priority:    transport.Priority,
+			Weight:      transport.Weight,
+		}
+	}
+	return transports
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+const testCandidate = `{"transports":[{"type":"masque","endpoints":["cdn.example.com"],"fingerprint":"chrome"}],` +
+	`"discovery":{"channels":["gps"],"scan_interval":60,"battery_aware":false}}`
+
+func setCandidate(t *testing.T, version, parameters string) {
+	t.Helper()
+	t.Setenv("LUMENLINK_CONFIG_CANDIDATE_VERSION", version)
+	t.Setenv("LUMENLINK_CONFIG_CANDIDATE", parameters)
+}
+
+func TestConfigVersion_Rollout(t *testing.T) {
+	ctx := context.Background()
+	const devices = 40
+	setCandidate(t, "2026-10", testCandidate)
+
+	for _, percentage := range []int{0, 50, 100} {
+		t.Run(fmt.Sprintf("%d%%", percentage), func(t *testing.T) {
+			svc, err := NewConfigService(mustTestDBWithFeatureRollout(t, "2026-10", percentage, devices))
+			if err != nil {
+				t.Fatalf("NewConfigService: %v", err)
+			}
+			candidates := 0
+			for i := 0; i < devices; i++ {
+				device := fmt.Sprintf("device-%d", i)
+				version := svc.configVersion(ctx, device, "us-east-1", nil)
+				switch version.Version {
+				case "2026-10":
+					candidates++
+				case DefaultStableConfigVersion:
+				default:
+					t.Fatalf("%s: unexpected version %q", device, version.Version)
+				}
+			}
+			switch {
+			case percentage == 0 && candidates != 0,
+				percentage == 100 && candidates != devices,
+				percentage == 50 && (candidates == 0 || candidates == devices):
+				t.Errorf("%d of %d devices got the candidate", candidates, devices)
+			}
+		})
+	}
+}
+
+func TestGenerateConfigPack_CandidateVersion(t *testing.T) {
+	ctx := context.Background()
+	setCandidate(t, "2026-10", testCandidate)
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`SELECT key, region, percentage`).WillReturnRows(
+			sqlmock.NewRows([]string{"key", "region", "percentage", "description", "created_at", "updated_at",
+				"schedule_start_at", "schedule_end_at", "schedule_start_percentage", "schedule_end_percentage",
+				"schedule_easing", "aborted_at"}).
+				AddRow("2026-10", "", 100, nil, now, now, nil, nil, nil, nil, nil, nil),
+		)
+	}
+
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", "", "", ClientInfo{}, PackVersion1, nil, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	if pack.Metadata["config_version"] != "2026-10" {
+		t.Errorf("config_version: got %v, want 2026-10", pack.Metadata["config_version"])
+	}
+	if len(pack.Transports) != 1 || pack.Transports[0].Endpoints[0] != "cdn.example.com" {
+		t.Errorf("transports: got %+v", pack.Transports)
+	}
+	if pack.Discovery.ScanInterval != 60 || len(pack.Discovery.Channels) != 1 {
+		t.Errorf("discovery: got %+v", pack.Discovery)
+	}
+	if !svc.VerifyConfigPack(pack) {
+		t.Error("VerifyConfigPack: expected valid signature")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// Without a candidate, packs are stamped with the stable version
+	stable, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	if version := stable.versions.Stable.Version; version != DefaultStableConfigVersion {
+		t.Errorf("stable version: got %q", version)
+	}
+}
+
+func TestLoadConfigVersions_Invalid(t *testing.T) {
+	tests := []struct {
+		name, version, parameters string
+	}{
+		{"version only", "2026-10", ""},
+		{"parameters only", "", testCandidate},
+		{"stable name", DefaultStableConfigVersion, testCandidate},
+		{"unknown field", "2026-10", `{"gateways":[]}`},
+		{"no changes", "2026-10", `{}`},
+		{"transport without type", "2026-10", `{"transports":[{"endpoints":["cdn.example.com"]}]}`},
+		{"unknown channel", "2026-10", `{"discovery":{"channels":["pager"],"scan_interval":60}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCandidate(t, tt.version, tt.parameters)
+			if _, err := loadConfigVersions(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
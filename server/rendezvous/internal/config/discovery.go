@@ -0,0 +1,93 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"rendezvous/internal/db"
+)
+
+// AllowedDiscoveryChannels are the discovery channel names clients and
+// gateways understand
+var AllowedDiscoveryChannels = map[string]struct{}{
+	"gps":        {},
+	"fm_rds":     {},
+	"dtv":        {},
+	"plc":        {},
+	"gsm_cb":     {},
+	"lte_sib":    {},
+	"iot_mqtt":   {},
+	"blockchain": {},
+	"satellite":  {},
+	"intranet":   {},
+	"social":     {},
+}
+
+// defaultDiscoveryConfig is the built-in discovery config, served when no
+// stored config applies
+func defaultDiscoveryConfig() DiscoveryConfig {
+	return DiscoveryConfig{
+		Channels:     []string{"gps", "fm_rds", "dtv", "plc", "gsm_cb", "lte_sib", "blockchain"},
+		ScanInterval: 300, // 5 minutes
+		BatteryAware: true,
+	}
+}
+
+// validateDiscoveryConfig checks a stored discovery config before it is sent
+// to clients
+func validateDiscoveryConfig(c *db.DiscoveryConfig) error {
+	if len(c.Channels) == 0 {
+		return fmt.Errorf("discovery config for %s has no channels", c.Region)
+	}
+	for _, channel := range c.Channels {
+		if _, ok := AllowedDiscoveryChannels[channel]; !ok {
+			return fmt.Errorf("discovery config for %s has unknown channel %q", c.Region, channel)
+		}
+	}
+	if c.ScanInterval <= 0 {
+		return fmt.Errorf("discovery config for %s has scan interval %d", c.Region, c.ScanInterval)
+	}
+	return nil
+}
+
+// baseDiscoveryConfig returns the discovery config for region before
+// feature rollouts: the region's stored config, else the stored default,
+// else the built-in one. An invalid stored config is skipped, so a bad row
+// falls back rather than reaching clients.
+func (s *ConfigService) baseDiscoveryConfig(ctx context.Context, region string, trace *DecisionTrace) DiscoveryConfig {
+	if s.db == nil {
+		return defaultDiscoveryConfig()
+	}
+	stored, err := s.db.GetDiscoveryConfigs(ctx)
+	if err != nil {
+		log.Printf("discovery configs unavailable, serving built-in defaults: %v", err)
+		trace.Record("discovery_config", "lookup_failed", map[string]interface{}{"error": err.Error()})
+		return defaultDiscoveryConfig()
+	}
+
+	byRegion := make(map[string]*db.DiscoveryConfig, len(stored))
+	for _, c := range stored {
+		byRegion[c.Region] = c
+	}
+	for _, key := range []string{region, db.DefaultDiscoveryRegion} {
+		c := byRegion[key]
+		if c == nil || key == "" {
+			continue
+		}
+		if err := validateDiscoveryConfig(c); err != nil {
+			log.Printf("skipping invalid discovery config: %v", err)
+			trace.Record("discovery_config", "invalid", map[string]interface{}{"region": key, "error": err.Error()})
+			continue
+		}
+		trace.Record("discovery_config", "stored", map[string]interface{}{"region": key})
+		return DiscoveryConfig{
+			// Copied, since stored configs are shared with the cache
+			Channels:     append([]string{}, c.Channels...),
+			ScanInterval: c.ScanInterval,
+			BatteryAware: c.BatteryAware,
+		}
+	}
+	trace.Record("discovery_config", "defaults", map[string]interface{}{"region": region})
+	return defaultDiscoveryConfig()
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// DefaultEndpointEpoch is how long a device keeps the endpoints allocated to
+// it from transport pools
+const DefaultEndpointEpoch = 24 * time.Hour
+
+// loadAllocationKey returns the key device allocations and gateway subsets
+// are hashed with: LUMENLINK_ALLOCATION_SECRET, which every replica must
+// share for a device to be given the same allocation by each. Without it a
+// random key is generated, and allocations only hold within this process.
+// Keying the hash keeps a censor from computing which endpoints and gateways
+// a device ID is given.
+func loadAllocationKey() []byte {
+	if secret := os.Getenv("LUMENLINK_ALLOCATION_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	log.Printf("LUMENLINK_ALLOCATION_SECRET is not set; device allocations are hashed with a per-process key")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("config: failed to generate allocation key: %v", err))
+	}
+	return key
+}
+
+// EndpointEpoch returns the current endpoint allocation epoch, or 0 when
+// allocation is disabled
+func (s *ConfigService) EndpointEpoch() int64 {
+	if s.endpointEpoch <= 0 {
+		return 0
+	}
+	return s.clock.Now().Unix() / max(int64(s.endpointEpoch/time.Second), 1)
+}
+
+// allocateEndpoints gives the device its own slice of each transport's
+// endpoint pool in place of the shared endpoints, and returns what it was
+// given. Only devices with a valid attestation, directly or through an
+// attestation session, are given pool endpoints: anyone can claim a device
+// ID, so unattested IDs would let a censor walk the pool. Transports without
+// a pool, unattested devices, devices without an ID, and every device while
+// allocation is disabled keep the shared endpoints.
+func (s *ConfigService) allocateEndpoints(
+	clientID string,
+	attestationResult *AttestationResult,
+	transports []TransportConfig,
+	trace *DecisionTrace,
+) []db.EndpointKey {
+	epoch := s.EndpointEpoch()
+	if !attested(attestationResult) {
+		epoch = 0
+	}
+	var allocated []db.EndpointKey
+	for i := range transports {
+		t := &transports[i]
+		pool, perClient := t.pool, t.perClient
+		t.pool = nil
+		if len(pool) == 0 || clientID == "" || epoch == 0 {
+			continue
+		}
+		t.Endpoints = pickEndpoints(s.allocationKey, pool, perClient, epoch, t.Type, clientID)
+		for _, endpoint := range t.Endpoints {
+			allocated = append(allocated, db.EndpointKey{Transport: t.Type, Endpoint: endpoint})
+		}
+	}
+	if len(allocated) > 0 {
+		trace.Record("endpoint_allocation", "allocated", map[string]interface{}{
+			"epoch":     epoch,
+			"endpoints": len(allocated),
+		})
+	}
+	return allocated
+}
+
+// pickEndpoints returns the n endpoints of pool ranked highest for the
+// device in epoch, by a hash of the epoch, transport, device and endpoint
+// keyed with key. The choice is stable within an epoch, and adding or
+// removing an endpoint only changes the slices of devices that ranked it
+// among their n.
+func pickEndpoints(key []byte, pool []string, n int, epoch int64, transport, clientID string) []string {
+	if n <= 0 {
+		n = db.DefaultEndpointsPerClient
+	}
+	ranked := append([]string{}, pool...)
+	score := func(endpoint string) uint64 {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(strconv.FormatInt(epoch, 10) + "|" + transport + "|" + clientID + "|" + endpoint))
+		return binary.BigEndian.Uint64(mac.Sum(nil)[:8])
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		si, sj := score(ranked[i]), score(ranked[j])
+		if si != sj {
+			return si < sj
+		}
+		return ranked[i] < ranked[j]
+	})
+	return ranked[:min(n, len(ranked))]
+}
+
+// EndpointAllocations returns the epoch and the pool endpoints the pack's
+// client was allocated, for counting issued packs
+func (p *SignedConfigPack) EndpointAllocations() (int64, []db.EndpointKey) {
+	return p.allocationEpoch, p.allocations
+}
+
+// EndpointAllocationCounter counts, per epoch and pool endpoint, the config
+// packs the endpoint was allocated in. Counts are kept in memory and added
+// to the database on each flush; no client information is recorded.
+type EndpointAllocationCounter struct {
+	db    *db.Database
+	clock clock.Clock
+
+	mu     sync.Mutex
+	counts map[int64]map[db.EndpointKey]int64 // By epoch, then endpoint
+}
+
+// NewEndpointAllocationCounter creates an endpoint allocation counter
+func NewEndpointAllocationCounter(database *db.Database) *EndpointAllocationCounter {
+	return &EndpointAllocationCounter{db: database, clock: clock.Real{}, counts: map[int64]map[db.EndpointKey]int64{}}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (c *EndpointAllocationCounter) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// Record counts one pack allocating the given endpoints in epoch
+func (c *EndpointAllocationCounter) Record(epoch int64, endpoints []db.EndpointKey) {
+	if len(endpoints) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	byEndpoint := c.counts[epoch]
+	if byEndpoint == nil {
+		byEndpoint = map[db.EndpointKey]int64{}
+		c.counts[epoch] = byEndpoint
+	}
+	for _, endpoint := range endpoints {
+		byEndpoint[endpoint]++
+	}
+}
+
+// Flush adds the counts recorded since the last flush to the database.
+// Counts that fail to be written are kept for the next flush.
+func (c *EndpointAllocationCounter) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	pending := c.counts
+	c.counts = map[int64]map[db.EndpointKey]int64{}
+	c.mu.Unlock()
+
+	for epoch, counts := range pending {
+		if err := c.db.RecordEndpointAllocations(ctx, epoch, counts); err != nil {
+			c.restore(pending)
+			return err
+		}
+		delete(pending, epoch)
+	}
+	return nil
+}
+
+// restore merges unwritten counts back into the pending ones
+func (c *EndpointAllocationCounter) restore(unwritten map[int64]map[db.EndpointKey]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for epoch, counts := range unwritten {
+		byEndpoint := c.counts[epoch]
+		if byEndpoint == nil {
+			byEndpoint = map[db.EndpointKey]int64{}
+			c.counts[epoch] = byEndpoint
+		}
+		for endpoint, n := range counts {
+			byEndpoint[endpoint] += n
+		}
+	}
+}
+
+// Start flushes counts every interval until ctx is cancelled, then flushes
+// once more.
+func (c *EndpointAllocationCounter) Start(ctx context.Context, interval time.Duration) {
+	ticker := c.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := c.Flush(flushCtx); err != nil {
+				log.Printf("final endpoint allocation flush failed: %v", err)
+			}
+			return
+		case <-ticker.C():
+			if err := c.Flush(ctx); err != nil {
+				log.Printf("endpoint allocation flush failed: %v", err)
+			}
+		}
+	}
+}
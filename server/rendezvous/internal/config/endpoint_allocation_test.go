@@ -0,0 +1,185 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/cache"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+func TestPickEndpoints(t *testing.T) {
+	testKey := []byte("allocation-secret")
+	pool := []string{"a.example", "b.example", "c.example", "d.example", "e.example", "f.example"}
+
+	first := pickEndpoints(testKey, pool, 2, 100, "masque", "device-1")
+	if len(first) != 2 || !reflect.DeepEqual(first, pickEndpoints(testKey, pool, 2, 100, "masque", "device-1")) {
+		t.Fatalf("allocation not stable within an epoch: %v", first)
+	}
+	// Pool order does not matter
+	reversed := []string{"f.example", "e.example", "d.example", "c.example", "b.example", "a.example"}
+	if got := pickEndpoints(testKey, reversed, 2, 100, "masque", "device-1"); !reflect.DeepEqual(got, first) {
+		t.Errorf("reordered pool: got %v, want %v", got, first)
+	}
+
+	// Devices are spread over the whole pool, and the next epoch reshuffles
+	// them
+	used := map[string]bool{}
+	moved := 0
+	for i := 0; i < 200; i++ {
+		device := fmt.Sprintf("device-%d", i)
+		now := pickEndpoints(testKey, pool, 2, 100, "masque", device)
+		for _, endpoint := range now {
+			used[endpoint] = true
+		}
+		if !reflect.DeepEqual(now, pickEndpoints(testKey, pool, 2, 101, "masque", device)) {
+			moved++
+		}
+	}
+	if len(used) != len(pool) {
+		t.Errorf("endpoints used: got %d of %d", len(used), len(pool))
+	}
+	if moved < 100 {
+		t.Errorf("only %d of 200 devices moved in the next epoch", moved)
+	}
+
+	// Removing an endpoint only moves the devices that had it
+	for i := 0; i < 200; i++ {
+		device := fmt.Sprintf("device-%d", i)
+		before := pickEndpoints(testKey, pool, 2, 100, "masque", device)
+		if before[0] == "a.example" || before[1] == "a.example" {
+			continue
+		}
+		if after := pickEndpoints(testKey, pool[1:], 2, 100, "masque", device); !reflect.DeepEqual(after, before) {
+			t.Fatalf("%s moved from %v to %v without holding the removed endpoint", device, before, after)
+		}
+	}
+
+	if got := pickEndpoints(testKey, pool[:1], 3, 100, "masque", "device-1"); len(got) != 1 {
+		t.Errorf("pool smaller than the slice: got %v", got)
+	}
+
+	// Without the key, a device's allocation cannot be computed
+	differ := 0
+	for i := 0; i < 20; i++ {
+		device := fmt.Sprintf("device-%d", i)
+		if !reflect.DeepEqual(pickEndpoints(testKey, pool, 2, 100, "masque", device),
+			pickEndpoints([]byte("other-secret"), pool, 2, 100, "masque", device)) {
+			differ++
+		}
+	}
+	if differ == 0 {
+		t.Error("allocations do not depend on the key")
+	}
+}
+
+func TestAllocateEndpoints(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	policy, err := cache.NewPolicyCache(time.Minute, nil)
+	if err != nil {
+		t.Fatalf("NewPolicyCache: %v", err)
+	}
+	database := db.NewFromPool(sqlDB)
+	database.SetPolicyCache(policy)
+	svc, err := NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	svc.SetClock(clock.NewFake(time.Unix(100*86400+3600, 0)))
+
+	now := time.Now()
+	mock.ExpectQuery(`FROM transports`).WillReturnRows(sqlmock.NewRows(transportColumns).
+		AddRow(1, "masque", "{icloud.com}", "apple_icloud", []byte(`{}`), nil, true, 10, now,
+			"{a.example,b.example,c.example,d.example}", 3, 1).
+		AddRow(2, "ssh", "{ssh.example}", "", []byte(`{}`), nil, true, 0, now, "{}", 2, 1))
+
+	trace := &DecisionTrace{}
+	device := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY"}
+	transports := svc.getTransportConfigs(ctx, "us-east-1", nil)
+	allocated := svc.allocateEndpoints("device-1", device, transports, trace)
+	want := pickEndpoints(svc.allocationKey, []string{"a.example", "b.example", "c.example", "d.example"}, 3, 100, "masque", "device-1")
+	if !reflect.DeepEqual(transports[0].Endpoints, want) {
+		t.Errorf("masque endpoints: got %v, want %v", transports[0].Endpoints, want)
+	}
+	if !reflect.DeepEqual(transports[1].Endpoints, []string{"ssh.example"}) {
+		t.Errorf("transport without a pool changed: %v", transports[1].Endpoints)
+	}
+	if len(allocated) != 3 || allocated[0] != (db.EndpointKey{Transport: "masque", Endpoint: want[0]}) {
+		t.Errorf("allocated: got %+v", allocated)
+	}
+	if step := findStep(t, trace, "endpoint_allocation"); step.Details["epoch"] != int64(100) {
+		t.Errorf("endpoint_allocation step: got %+v", step)
+	}
+
+	// Unattested or invalid devices, requests without a device ID, and
+	// every device with allocation disabled keep the cached rows' shared
+	// endpoints
+	for name, result := range map[string]*AttestationResult{
+		"unattested": {Unattested: true},
+		"invalid":    {IsValid: false, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY"},
+		"none":       nil,
+	} {
+		transports = svc.getTransportConfigs(ctx, "us-east-1", nil)
+		if got := svc.allocateEndpoints("device-1", result, transports, nil); got != nil || transports[0].Endpoints[0] != "icloud.com" {
+			t.Errorf("%s: allocated %v, endpoints %v", name, got, transports[0].Endpoints)
+		}
+	}
+	transports = svc.getTransportConfigs(ctx, "us-east-1", nil)
+	if got := svc.allocateEndpoints("", device, transports, nil); got != nil || transports[0].Endpoints[0] != "icloud.com" {
+		t.Errorf("without a device: allocated %v, endpoints %v", got, transports[0].Endpoints)
+	}
+	svc.endpointEpoch = 0
+	transports = svc.getTransportConfigs(ctx, "us-east-1", nil)
+	if got := svc.allocateEndpoints("device-1", device, transports, nil); got != nil || transports[0].Endpoints[0] != "icloud.com" {
+		t.Errorf("disabled: allocated %v, endpoints %v", got, transports[0].Endpoints)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEndpointAllocationCounter_Flush(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	masque := db.EndpointKey{Transport: "masque", Endpoint: "a.example"}
+	counter := NewEndpointAllocationCounter(db.NewFromPool(sqlDB))
+	counter.Record(100, []db.EndpointKey{masque})
+	counter.Record(0, nil)
+
+	mock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+	if err := counter.Flush(context.Background()); err == nil {
+		t.Fatal("Flush succeeded without a database")
+	}
+
+	// Packs issued meanwhile add to the kept count
+	counter.Record(100, []db.EndpointKey{masque})
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO endpoint_allocations`).WithArgs(int64(100), "masque", "a.example", int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := counter.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	// Nothing new to write
+	if err := counter.Flush(context.Background()); err != nil {
+		t.Fatalf("second Flush: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+// ErrInvalidExperiment is returned for an experiment that cannot be run
+var ErrInvalidExperiment = apperr.New(apperr.ErrInvalidInput, "invalid_experiment", "invalid experiment")
+
+// Experiment limits
+const (
+	maxExperimentVariants = 10
+	minExperimentScan     = 30    // seconds
+	maxExperimentScan     = 86400 // seconds
+)
+
+var experimentVariantPattern = regexp.MustCompile(`^[a-z0-9_.-]{1,50}$`)
+
+// ValidateExperiment checks an experiment's variants and window. Transport
+// types and targeting are checked by the caller.
+func ValidateExperiment(e *db.Experiment) error {
+	if len(e.Variants) < 2 || len(e.Variants) > maxExperimentVariants {
+		return fmt.Errorf("%w: experiments need 2 to %d variants", ErrInvalidExperiment, maxExperimentVariants)
+	}
+	names := make(map[string]bool, len(e.Variants))
+	total := 0
+	for _, v := range e.Variants {
+		if !experimentVariantPattern.MatchString(v.Name) || names[v.Name] {
+			return fmt.Errorf("%w: variant names must be unique and match %s", ErrInvalidExperiment, experimentVariantPattern)
+		}
+		names[v.Name] = true
+		if v.Weight < 0 {
+			return fmt.Errorf("%w: variant %s has a negative weight", ErrInvalidExperiment, v.Name)
+		}
+		total += v.Weight
+		for i, transport := range v.TransportOrder {
+			if transport == "" || slices.Contains(v.TransportOrder[:i], transport) {
+				return fmt.Errorf("%w: variant %s lists a transport twice or without a type", ErrInvalidExperiment, v.Name)
+			}
+		}
+		if v.ScanInterval != 0 && (v.ScanInterval < minExperimentScan || v.ScanInterval > maxExperimentScan) {
+			return fmt.Errorf("%w: variant %s scan interval must be between %d and %d seconds",
+				ErrInvalidExperiment, v.Name, minExperimentScan, maxExperimentScan)
+		}
+	}
+	if total == 0 {
+		return fmt.Errorf("%w: no variant has any weight", ErrInvalidExperiment)
+	}
+	if e.StartsAt != nil && e.EndsAt != nil && !e.StartsAt.Before(*e.EndsAt) {
+		return fmt.Errorf("%w: experiment must start before it ends", ErrInvalidExperiment)
+	}
+	return nil
+}
+
+// experimentAssignment is the variant of one experiment a device is in
+type experimentAssignment struct {
+	Experiment string
+	Variant    *db.ExperimentVariant
+}
+
+// experimentRunning reports whether an experiment is in its window at now
+func experimentRunning(e *db.Experiment, now time.Time) bool {
+	return (e.StartsAt == nil || !now.Before(*e.StartsAt)) && (e.EndsAt == nil || now.Before(*e.EndsAt))
+}
+
+// experimentTargets reports whether an experiment targets a device in
+// region on platform
+func experimentTargets(e *db.Experiment, region, platform string) bool {
+	return (len(e.Regions) == 0 || slices.Contains(e.Regions, region)) &&
+		(len(e.Platforms) == 0 || slices.Contains(e.Platforms, platform))
+}
+
+// experimentVariant picks a device's variant by a hash of the experiment
+// and device, in proportion to the variants' weights. A device keeps its
+// variant for as long as the experiment's variants are unchanged.
+func experimentVariant(e *db.Experiment, clientID string) *db.ExperimentVariant {
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(e.Name + "|" + clientID))
+	point := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for i := range e.Variants {
+		if point < e.Variants[i].Weight {
+			return &e.Variants[i]
+		}
+		point -= e.Variants[i].Weight
+	}
+	return nil
+}
+
+// assignExperiments returns the variants of the running experiments that
+// target the device, in experiment name order. Devices without an ID are in
+// no experiment, and none are run while experiments cannot be read.
+func (s *ConfigService) assignExperiments(
+	ctx context.Context,
+	clientID, region, platform string,
+	trace *DecisionTrace,
+) []experimentAssignment {
+	if s.db == nil || clientID == "" {
+		return nil
+	}
+	experiments, err := s.db.GetExperiments(ctx)
+	if err != nil {
+		log.Printf("experiments unavailable, serving packs without them: %v", err)
+		trace.Record("experiment", "lookup_failed", map[string]interface{}{"error": err.Error()})
+		return nil
+	}
+	now := s.clock.Now()
+	var assignments []experimentAssignment
+	for _, e := range experiments {
+		if !experimentRunning(e, now) || !experimentTargets(e, region, platform) {
+			continue
+		}
+		variant := experimentVariant(e, clientID)
+		if variant == nil {
+			continue
+		}
+		assignments = append(assignments, experimentAssignment{Experiment: e.Name, Variant: variant})
+		trace.Record("experiment", "assigned", map[string]interface{}{
+			"experiment": e.Name,
+			"variant":    variant.Name,
+		})
+		if trace == nil {
+			metrics.ExperimentAssignments.WithLabelValues(e.Name, variant.Name).Inc()
+		}
+	}
+	return assignments
+}
+
+// experimentTransports orders the transports as the first assigned variant
+// with a transport order asks. Transports it does not list follow in their
+// usual order, and listed ones the pack lacks are skipped. Clients try
+// transports by priority, so listed ones are raised as far as needed to
+// rank above the ones after them.
+func experimentTransports(assignments []experimentAssignment, transports []TransportConfig) []TransportConfig {
+	for _, a := range assignments {
+		order := a.Variant.TransportOrder
+		if len(order) == 0 {
+			continue
+		}
+		sorted := make([]TransportConfig, 0, len(transports))
+		for _, transport := range order {
+			for _, t := range transports {
+				if t.Type == transport {
+					sorted = append(sorted, t)
+				}
+			}
+		}
+		listed := len(sorted)
+		for _, t := range transports {
+			if !slices.Contains(order, t.Type) {
+				sorted = append(sorted, t)
+			}
+		}
+		for i := listed - 1; i >= 0; i-- {
+			if i+1 < len(sorted) && sorted[i].Priority <= sorted[i+1].Priority {
+				sorted[i].Priority = sorted[i+1].Priority + 1
+			}
+		}
+		return sorted
+	}
+	return transports
+}
+
+// experimentDiscovery sets the scan interval of the first assigned variant
+// with one
+func experimentDiscovery(assignments []experimentAssignment, discovery *DiscoveryConfig) {
+	for _, a := range assignments {
+		if a.Variant.ScanInterval > 0 {
+			discovery.ScanInterval = a.Variant.ScanInterval
+			return
+		}
+	}
+}
+
+// experimentNames maps each assigned experiment to its variant, for pack
+// metadata
+func experimentNames(assignments []experimentAssignment) map[string]string {
+	names := make(map[string]string, len(assignments))
+	for _, a := range assignments {
+		names[a.Experiment] = a.Variant.Name
+	}
+	return names
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+var experimentColumns = []string{"name", "description", "variants", "regions", "platforms",
+	"starts_at", "ends_at", "created_at", "updated_at"}
+
+func TestExperimentVariant_Weights(t *testing.T) {
+	e := &db.Experiment{Name: "transport-order", Variants: []db.ExperimentVariant{
+		{Name: "control", Weight: 70},
+		{Name: "ssh_first", Weight: 20},
+		{Name: "masque_first", Weight: 10},
+		{Name: "off", Weight: 0},
+	}}
+
+	const devices = 20000
+	counts := map[string]int{}
+	for i := 0; i < devices; i++ {
+		device := fmt.Sprintf("device-%d", i)
+		variant := experimentVariant(e, device)
+		if variant != experimentVariant(e, device) {
+			t.Fatalf("%s changed variant between packs", device)
+		}
+		counts[variant.Name]++
+	}
+	for _, v := range e.Variants {
+		share := float64(counts[v.Name]) / devices
+		if want := float64(v.Weight) / 100; math.Abs(share-want) > 0.015 {
+			t.Errorf("variant %s: got %.3f of devices, want %.2f", v.Name, share, want)
+		}
+	}
+
+	// Devices are assigned independently in each experiment
+	other := &db.Experiment{Name: "scan-interval", Variants: e.Variants}
+	same := 0
+	for i := 0; i < 1000; i++ {
+		device := fmt.Sprintf("device-%d", i)
+		if experimentVariant(e, device) == &e.Variants[0] && experimentVariant(other, device) == &other.Variants[0] {
+			same++
+		}
+	}
+	if same < 400 || same > 580 {
+		t.Errorf("control in both experiments: got %d of 1000, want about 490", same)
+	}
+}
+
+func TestExperimentTargeting(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	earlier, later := now.Add(-time.Hour), now.Add(time.Hour)
+	tests := []struct {
+		name     string
+		e        db.Experiment
+		region   string
+		platform string
+		want     bool
+	}{
+		{"untargeted", db.Experiment{}, "us-east-1", "ios", true},
+		{"in region", db.Experiment{Regions: []string{"me-south-1"}}, "me-south-1", "ios", true},
+		{"other region", db.Experiment{Regions: []string{"me-south-1"}}, "us-east-1", "ios", false},
+		{"other platform", db.Experiment{Platforms: []string{"android"}}, "us-east-1", "ios", false},
+		{"in window", db.Experiment{StartsAt: &earlier, EndsAt: &later}, "us-east-1", "ios", true},
+		{"not started", db.Experiment{StartsAt: &later}, "us-east-1", "ios", false},
+		{"ended", db.Experiment{EndsAt: &now}, "us-east-1", "ios", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := experimentRunning(&tt.e, now) && experimentTargets(&tt.e, tt.region, tt.platform); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateExperiment(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	valid := func() *db.Experiment {
+		return &db.Experiment{Name: "e", Variants: []db.ExperimentVariant{
+			{Name: "control", Weight: 1},
+			{Name: "fast_scan", Weight: 1, ScanInterval: 60, TransportOrder: []string{"ssh"}},
+		}}
+	}
+	if err := ValidateExperiment(valid()); err != nil {
+		t.Fatalf("valid experiment: %v", err)
+	}
+	tests := map[string]func(e *db.Experiment){
+		"one variant":         func(e *db.Experiment) { e.Variants = e.Variants[:1] },
+		"duplicate variant":   func(e *db.Experiment) { e.Variants[1].Name = "control" },
+		"bad variant name":    func(e *db.Experiment) { e.Variants[1].Name = "Fast Scan" },
+		"negative weight":     func(e *db.Experiment) { e.Variants[0].Weight = -1 },
+		"no weight":           func(e *db.Experiment) { e.Variants[0].Weight, e.Variants[1].Weight = 0, 0 },
+		"duplicate transport": func(e *db.Experiment) { e.Variants[1].TransportOrder = []string{"ssh", "ssh"} },
+		"scan too short":      func(e *db.Experiment) { e.Variants[1].ScanInterval = 5 },
+		"ends before start":   func(e *db.Experiment) { e.StartsAt, e.EndsAt = &start, &start },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := valid()
+			mutate(e)
+			if err := ValidateExperiment(e); !errors.Is(err, ErrInvalidExperiment) {
+				t.Errorf("got %v, want ErrInvalidExperiment", err)
+			}
+		})
+	}
+}
+
+// experimentService returns a config service over a mock database serving
+// one gateway in me-south-1 and the given experiment rows
+func experimentService(t *testing.T, rows *sqlmock.Rows) *ConfigService {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	svc.SetClock(clock.NewFake(time.Unix(1_700_000_000, 0)))
+
+	now := time.Now()
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns).
+		AddRow("gw-1", []byte("gateway-public-key"), "198.51.100.7", 443, "{xtls,parasite}", "{}",
+			"me-south-1", 100, 1, 100, "active", false, nil, "approved", nil, now, now, now))
+	mock.ExpectQuery(`FROM experiments`).WillReturnRows(rows)
+	return svc
+}
+
+func TestGenerateConfigPack_Experiments(t *testing.T) {
+	created := time.Unix(1_600_000_000, 0)
+	rows := sqlmock.NewRows(experimentColumns).
+		AddRow("scan", nil, []byte(`[{"name":"fast","weight":1,"scan_interval":60},{"name":"slow","weight":0}]`),
+			"{}", "{android}", nil, nil, created, created).
+		AddRow("ssh-first", nil, []byte(`[{"name":"control","weight":0},{"name":"ssh","weight":1,"transport_order":["ssh","parasite"]}]`),
+			"{me-south-1}", "{}", nil, nil, created, created).
+		AddRow("us-only", nil, []byte(`[{"name":"a","weight":1},{"name":"b","weight":1}]`),
+			"{us-east-1}", "{}", nil, nil, created, created)
+	svc := experimentService(t, rows)
+	strong := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+
+	pack, trace, err := svc.PreviewConfigPack(context.Background(), "client-1", "me-south-1", "", "",
+		ClientInfo{Platform: "android"}, "", strong)
+	if err != nil {
+		t.Fatalf("PreviewConfigPack: %v", err)
+	}
+	want := map[string]string{"scan": "fast", "ssh-first": "ssh"}
+	if got := pack.Metadata["experiments"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("experiments metadata: got %v, want %v", got, want)
+	}
+	if got := transportTypes(pack.Transports); !reflect.DeepEqual(got, []string{"ssh", "parasite", "masque", "xtls"}) {
+		t.Errorf("transports: got %v, want ssh and parasite first", got)
+	}
+	for i := 1; i < len(pack.Transports); i++ {
+		if pack.Transports[i-1].Priority <= pack.Transports[i].Priority {
+			t.Errorf("transport %s priority %d does not rank above %s at %d", pack.Transports[i-1].Type,
+				pack.Transports[i-1].Priority, pack.Transports[i].Type, pack.Transports[i].Priority)
+		}
+	}
+	if pack.Discovery.ScanInterval != 60 {
+		t.Errorf("scan interval: got %d, want 60", pack.Discovery.ScanInterval)
+	}
+	if step := findStep(t, trace, "experiment"); step.Details["experiment"] != "scan" || step.Details["variant"] != "fast" {
+		t.Errorf("experiment step: got %+v", step)
+	}
+	if !svc.VerifyConfigPack(pack) {
+		t.Error("pack with experiments must verify")
+	}
+}
+
+func TestAssignExperiments_LookupFailsOpen(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	mock.ExpectQuery(`FROM experiments`).WillReturnError(errors.New("connection reset"))
+
+	trace := &DecisionTrace{}
+	if got := svc.assignExperiments(context.Background(), "client-1", "me-south-1", "ios", trace); got != nil {
+		t.Errorf("assigned %v without experiments", got)
+	}
+	if step := findStep(t, trace, "experiment"); step.Outcome != "lookup_failed" {
+		t.Errorf("experiment outcome: got %q, want lookup_failed", step.Outcome)
+	}
+	if got := svc.assignExperiments(context.Background(), "", "me-south-1", "ios", nil); got != nil {
+		t.Errorf("device without an ID assigned %v", got)
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Gateway detail levels: how much of the real gateways a pack reveals
+const (
+	// GatewayDetailFull lists gateways with their addresses, ports, keys
+	// and transports
+	GatewayDetailFull = "full"
+	// GatewayDetailReduced lists fewer gateways, without addresses or
+	// ports, reachable only through the fronted transports' domains
+	GatewayDetailReduced = "reduced"
+	// GatewayDetailIndirect lists no real gateways: the pack holds only any
+	// honeypots, and the device connects through the fronted transports'
+	// domains
+	GatewayDetailIndirect = "indirect"
+)
+
+// Integrity levels, weakest first, that the gateway detail thresholds are
+// set in
+const (
+	IntegrityNone   = "none"
+	IntegrityBasic  = "basic"
+	IntegrityDevice = "device"
+	IntegrityStrong = "strong"
+)
+
+var integrityLevels = []string{IntegrityNone, IntegrityBasic, IntegrityDevice, IntegrityStrong}
+
+// reducedDetailGateways is the most real gateways a reduced-detail pack lists
+const reducedDetailGateways = 3
+
+// DefaultFrontedTransports are the transports that reach gateways through
+// domain-fronted endpoints rather than the gateway's address
+var DefaultFrontedTransports = []string{"masque", "parasite"}
+
+// GatewayDetailPolicy decides how much gateway detail a device's pack
+// carries from the strength of its attestation
+type GatewayDetailPolicy struct {
+	FullMinIntegrity    string // Weakest integrity given full detail
+	ReducedMinIntegrity string // Weakest integrity given reduced detail; weaker devices get indirect
+
+	// FrontedTransports are the transports reduced-detail gateways keep
+	FrontedTransports map[string]bool
+}
+
+// loadGatewayDetailPolicy reads LUMENLINK_GATEWAY_FULL_DETAIL_MIN_INTEGRITY
+// (default strong), LUMENLINK_GATEWAY_REDUCED_DETAIL_MIN_INTEGRITY (default
+// device) and LUMENLINK_FRONTED_TRANSPORTS (comma-separated, default masque
+// and parasite). Setting both thresholds to none gives every device full
+// detail.
+func loadGatewayDetailPolicy() (GatewayDetailPolicy, error) {
+	policy := GatewayDetailPolicy{
+		FullMinIntegrity:    envString("LUMENLINK_GATEWAY_FULL_DETAIL_MIN_INTEGRITY", IntegrityStrong),
+		ReducedMinIntegrity: envString("LUMENLINK_GATEWAY_REDUCED_DETAIL_MIN_INTEGRITY", IntegrityDevice),
+		FrontedTransports:   map[string]bool{},
+	}
+	full, reduced := integrityRank(policy.FullMinIntegrity), integrityRank(policy.ReducedMinIntegrity)
+	if full < 0 || reduced < 0 {
+		return GatewayDetailPolicy{}, fmt.Errorf("gateway detail thresholds must each be one of %s",
+			strings.Join(integrityLevels, ", "))
+	}
+	if reduced > full {
+		return GatewayDetailPolicy{}, fmt.Errorf("the reduced gateway detail threshold %s is above the full one %s",
+			policy.ReducedMinIntegrity, policy.FullMinIntegrity)
+	}
+
+	fronted := DefaultFrontedTransports
+	if value, ok := os.LookupEnv("LUMENLINK_FRONTED_TRANSPORTS"); ok {
+		fronted = strings.Split(value, ",")
+	}
+	for _, transport := range fronted {
+		if transport = strings.TrimSpace(transport); transport != "" {
+			policy.FrontedTransports[transport] = true
+		}
+	}
+	return policy, nil
+}
+
+// integrityRank is level's position among integrityLevels, or -1
+func integrityRank(level string) int {
+	for i, known := range integrityLevels {
+		if level == known {
+			return i
+		}
+	}
+	return -1
+}
+
+// integrityLevel is the integrity level of an attestation result. A device
+// on probation counts one level below its verdict until it earns trust.
+func integrityLevel(result *AttestationResult) int {
+	if result == nil || result.Unattested || !result.IsValid {
+		return integrityRank(IntegrityNone)
+	}
+	var level int
+	switch result.DeviceIntegrity {
+	case "MEETS_STRONG_INTEGRITY", "BYPASS_ENABLED":
+		level = integrityRank(IntegrityStrong)
+	case "MEETS_DEVICE_INTEGRITY":
+		level = integrityRank(IntegrityDevice)
+	default:
+		level = integrityRank(IntegrityBasic)
+	}
+	if result.Probation {
+		level = max(level-1, integrityRank(IntegrityNone))
+	}
+	return level
+}
+
+// detail returns the gateway detail for a device. Without an attestation
+// service there is nothing to tier on, so every device gets full detail.
+func (p GatewayDetailPolicy) detail(result *AttestationResult) string {
+	if result == nil {
+		return GatewayDetailFull
+	}
+	level := integrityLevel(result)
+	switch {
+	case level >= integrityRank(p.FullMinIntegrity):
+		return GatewayDetailFull
+	case level >= integrityRank(p.ReducedMinIntegrity):
+		return GatewayDetailReduced
+	default:
+		return GatewayDetailIndirect
+	}
+}
+
+// apply withholds what detail does not reveal from selected gateways.
+// Honeypots are given the same shape as the real gateways next to them, or
+// their addresses would give them away: below full detail they too are
+// reachable only through fronted transports, though they are not held to
+// the reduced tier's count.
+func (p GatewayDetailPolicy) apply(detail string, gateways []GatewayInfo) []GatewayInfo {
+	if detail == GatewayDetailFull {
+		return gateways
+	}
+	kept := make([]GatewayInfo, 0, len(gateways))
+	real := 0
+	for _, gw := range gateways {
+		if !gw.IsHoneypot && (detail == GatewayDetailIndirect || real == reducedDetailGateways) {
+			continue
+		}
+		fronted, ok := p.front(gw)
+		if !ok {
+			continue
+		}
+		kept = append(kept, fronted)
+		if !gw.IsHoneypot {
+			real++
+		}
+	}
+	return kept
+}
+
+// front returns gw without its address and port and with only its fronted
+// transports, or false when it has none and so cannot be reached indirectly
+func (p GatewayDetailPolicy) front(gw GatewayInfo) (GatewayInfo, bool) {
+	var transports []string
+	for _, transport := range gw.Transports {
+		if p.FrontedTransports[transport] {
+			transports = append(transports, transport)
+		}
+	}
+	if len(transports) == 0 {
+		return gw, false
+	}
+	gw.Address = ""
+	gw.Port = 0
+	gw.Transports = transports
+	return gw, true
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+func TestGatewayDetailPolicy_Detail(t *testing.T) {
+	policy, err := loadGatewayDetailPolicy()
+	if err != nil {
+		t.Fatalf("loadGatewayDetailPolicy: %v", err)
+	}
+	tests := []struct {
+		name   string
+		result *AttestationResult
+		want   string
+	}{
+		{"no attestation service", nil, GatewayDetailFull},
+		{"unattested", &AttestationResult{Unattested: true, Honeypots: true}, GatewayDetailIndirect},
+		{"invalid", &AttestationResult{IsValid: false}, GatewayDetailIndirect},
+		{"basic integrity", &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_BASIC_INTEGRITY"}, GatewayDetailIndirect},
+		{"device integrity", &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY"}, GatewayDetailReduced},
+		{"strong integrity", &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}, GatewayDetailFull},
+		{"bypass", &AttestationResult{IsValid: true, DeviceIntegrity: "BYPASS_ENABLED"}, GatewayDetailFull},
+		{"strong integrity on probation", &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY", Probation: true}, GatewayDetailReduced},
+		{"device integrity on probation", &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY", Probation: true}, GatewayDetailIndirect},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.detail(tt.result); got != tt.want {
+				t.Errorf("detail: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatewayDetailPolicy_Thresholds(t *testing.T) {
+	t.Setenv("LUMENLINK_GATEWAY_FULL_DETAIL_MIN_INTEGRITY", IntegrityDevice)
+	t.Setenv("LUMENLINK_GATEWAY_REDUCED_DETAIL_MIN_INTEGRITY", IntegrityNone)
+	policy, err := loadGatewayDetailPolicy()
+	if err != nil {
+		t.Fatalf("loadGatewayDetailPolicy: %v", err)
+	}
+	if got := policy.detail(&AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY"}); got != GatewayDetailFull {
+		t.Errorf("device integrity: got %q, want full", got)
+	}
+	if got := policy.detail(&AttestationResult{Unattested: true}); got != GatewayDetailReduced {
+		t.Errorf("unattested: got %q, want reduced", got)
+	}
+
+	for _, thresholds := range [][2]string{{"strong", "platinum"}, {"platinum", "device"}, {"device", "strong"}} {
+		t.Setenv("LUMENLINK_GATEWAY_FULL_DETAIL_MIN_INTEGRITY", thresholds[0])
+		t.Setenv("LUMENLINK_GATEWAY_REDUCED_DETAIL_MIN_INTEGRITY", thresholds[1])
+		if _, err := loadGatewayDetailPolicy(); err == nil {
+			t.Errorf("thresholds %v: expected an error", thresholds)
+		}
+	}
+}
+
+func TestGatewayDetailPolicy_Apply(t *testing.T) {
+	t.Setenv("LUMENLINK_FRONTED_TRANSPORTS", "masque, parasite")
+	policy, err := loadGatewayDetailPolicy()
+	if err != nil {
+		t.Fatalf("loadGatewayDetailPolicy: %v", err)
+	}
+	gateways := []GatewayInfo{
+		{ID: "gw-1", Address: "198.51.100.1", Port: 443, Transports: []string{"masque", "xtls"}},
+		{ID: "gw-2", Address: "198.51.100.2", Port: 443, Transports: []string{"xtls"}},
+		{ID: "honeypot", Address: "192.0.2.1", Port: 443, Transports: []string{"masque", "xtls"}, IsHoneypot: true},
+		{ID: "unfronted-honeypot", Address: "192.0.2.2", Port: 443, Transports: []string{"xtls"}, IsHoneypot: true},
+		{ID: "gw-3", Address: "198.51.100.3", Port: 8443, Transports: []string{"parasite"}},
+		{ID: "gw-4", Address: "198.51.100.4", Port: 443, Transports: []string{"masque"}},
+		{ID: "gw-5", Address: "198.51.100.5", Port: 443, Transports: []string{"masque"}},
+	}
+
+	if got := policy.apply(GatewayDetailFull, gateways); !reflect.DeepEqual(got, gateways) {
+		t.Errorf("full: got %+v, want the gateways unchanged", got)
+	}
+
+	// Only fronted transports are kept, gateways without one are dropped,
+	// and no more than reducedDetailGateways real gateways are listed.
+	// Honeypots are shaped the same, or their addresses would set them apart.
+	reduced := policy.apply(GatewayDetailReduced, gateways)
+	frontedHoneypot := GatewayInfo{ID: "honeypot", Transports: []string{"masque"}, IsHoneypot: true}
+	want := []GatewayInfo{
+		{ID: "gw-1", Transports: []string{"masque"}},
+		frontedHoneypot,
+		{ID: "gw-3", Transports: []string{"parasite"}},
+		{ID: "gw-4", Transports: []string{"masque"}},
+	}
+	if !reflect.DeepEqual(reduced, want) {
+		t.Errorf("reduced: got %+v, want %+v", reduced, want)
+	}
+	if gateways[0].Address == "" || len(gateways[0].Transports) != 2 {
+		t.Error("apply must not modify the gateways it is given")
+	}
+
+	indirect := policy.apply(GatewayDetailIndirect, gateways)
+	if !reflect.DeepEqual(indirect, []GatewayInfo{frontedHoneypot}) {
+		t.Errorf("indirect: got %+v, want the fronted honeypot only", indirect)
+	}
+}
+
+// gatewayDetailService returns a service whose database serves one pack
+// with five real gateways and, if honeypots, a honeypot
+func gatewayDetailService(t *testing.T, honeypots bool) *ConfigService {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	now := time.Now()
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	rows := sqlmock.NewRows(launchGatewayColumns)
+	for i, transports := range []string{"{masque,xtls}", "{xtls}", "{parasite}", "{masque}", "{masque,ssh}"} {
+		rows.AddRow(fmt.Sprintf("7b1e4c2a-5d3f-4e6a-9c8b-0d1e2f3a4b%02d", i), make([]byte, ed25519.PublicKeySize),
+			fmt.Sprintf("198.51.%d.7", 100+i), 443, transports, "{}",
+			"us-east-1", 100, 10*i, 100, "active", false, nil, "approved", nil, now, now, now)
+	}
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(rows)
+	if honeypots {
+		mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns).
+			AddRow("9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d", make([]byte, ed25519.PublicKeySize),
+				"192.0.2.1", 443, "{parasite,xtls}", "{}", "us-east-1", 100, 0, 100, "active", true, nil, "approved", nil,
+				now, now, now))
+	}
+
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	return svc
+}
+
+func TestGenerateConfigPack_GatewayDetailByIntegrity(t *testing.T) {
+	t.Run("strong integrity gets the full list", func(t *testing.T) {
+		svc := gatewayDetailService(t, false)
+		pack, trace, err := svc.PreviewConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "",
+			&AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"})
+		if err != nil {
+			t.Fatalf("PreviewConfigPack: %v", err)
+		}
+		if len(pack.Gateways) != 5 {
+			t.Fatalf("got %d gateways, want all five", len(pack.Gateways))
+		}
+		for _, gw := range pack.Gateways {
+			if gw.Address == "" || gw.Port == 0 {
+				t.Errorf("gateway %s lacks its address", gw.ID)
+			}
+		}
+		if step := findStep(t, trace, "gateway_detail"); step.Outcome != GatewayDetailFull {
+			t.Errorf("gateway_detail outcome: got %q, want full", step.Outcome)
+		}
+	})
+
+	t.Run("device integrity gets a reduced list without addresses", func(t *testing.T) {
+		svc := gatewayDetailService(t, false)
+		pack, trace, err := svc.PreviewConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "",
+			&AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY"})
+		if err != nil {
+			t.Fatalf("PreviewConfigPack: %v", err)
+		}
+		if len(pack.Gateways) != reducedDetailGateways {
+			t.Fatalf("got %d gateways, want %d", len(pack.Gateways), reducedDetailGateways)
+		}
+		for _, gw := range pack.Gateways {
+			if gw.Address != "" || gw.Port != 0 {
+				t.Errorf("gateway %s reveals %s:%d", gw.ID, gw.Address, gw.Port)
+			}
+			for _, transport := range gw.Transports {
+				if transport != "masque" && transport != "parasite" {
+					t.Errorf("gateway %s lists unfronted transport %s", gw.ID, transport)
+				}
+			}
+		}
+		if step := findStep(t, trace, "gateway_detail"); step.Outcome != GatewayDetailReduced {
+			t.Errorf("gateway_detail outcome: got %q, want reduced", step.Outcome)
+		}
+		if !svc.VerifyConfigPack(pack) {
+			t.Error("reduced pack must verify")
+		}
+	})
+
+	t.Run("unattested gets only honeypots", func(t *testing.T) {
+		svc := gatewayDetailService(t, true)
+		pack, trace, err := svc.PreviewConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "",
+			&AttestationResult{Unattested: true, Honeypots: true})
+		if err != nil {
+			t.Fatalf("PreviewConfigPack: %v", err)
+		}
+		if len(pack.Gateways) != 1 || !pack.Gateways[0].IsHoneypot {
+			t.Fatalf("gateways: got %+v, want the honeypot only", pack.Gateways)
+		}
+		if honeypot := pack.Gateways[0]; honeypot.Address != "" || honeypot.Port != 0 ||
+			!reflect.DeepEqual(honeypot.Transports, []string{"parasite"}) {
+			t.Errorf("honeypot not fronted like real gateways: %+v", honeypot)
+		}
+		if step := findStep(t, trace, "gateway_detail"); step.Outcome != GatewayDetailIndirect {
+			t.Errorf("gateway_detail outcome: got %q, want indirect", step.Outcome)
+		}
+	})
+}
+
+func TestPackBaseKey_GatewayDetail(t *testing.T) {
+	// Both devices are in the limited tier but are given different detail
+	t.Setenv("LUMENLINK_GATEWAY_FULL_DETAIL_MIN_INTEGRITY", IntegrityDevice)
+	t.Setenv("LUMENLINK_GATEWAY_REDUCED_DETAIL_MIN_INTEGRITY", IntegrityBasic)
+	policy, err := loadGatewayDetailPolicy()
+	if err != nil {
+		t.Fatalf("loadGatewayDetailPolicy: %v", err)
+	}
+	strong := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY", Probation: true}
+	device := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY", Probation: true}
+	gateways := []GatewayInfo{{ID: "gw-1"}}
+	if packBaseKey("us-east-1", true, strong, policy.detail(strong), "", "", "", "", nil, gateways, nil, nil, nil, nil) ==
+		packBaseKey("us-east-1", true, device, policy.detail(device), "", "", "", "", nil, gateways, nil, nil, nil, nil) {
+		t.Error("devices given full detail share a base with devices given reduced detail")
+	}
+}
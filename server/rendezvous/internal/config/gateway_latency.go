@@ -0,0 +1,138 @@
+package config
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// DefaultGatewayLatencyTTL is how long a replica reuses the gateway latency
+// it last read from discovery logs
+const DefaultGatewayLatencyTTL = 5 * time.Minute
+
+// Gateway latency measurement
+const (
+	gatewayLatencyWindow     = 24 * time.Hour // Discovery logs latency is measured over
+	minGatewayLatencySamples = 5              // Measurements a gateway needs to have a latency
+	gatewayLatencyCeilingMs  = 1000           // Latency weighted selection treats as worst
+)
+
+// gatewayLatencyRefreshTimeout bounds a background latency read
+const gatewayLatencyRefreshTimeout = 30 * time.Second
+
+// gatewayLatencyCache keeps the last gateway latency read, by gateway ID.
+// The aggregate is too costly to run for every pack, or to make packs wait
+// for: one read runs at a time, and packs use the last values meanwhile.
+type gatewayLatencyCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration // 0 disables latency
+	clock      clock.Clock
+	byID       map[string]db.GatewayLatency
+	loadedAt   time.Time
+	refreshing bool
+	refreshes  sync.WaitGroup // Background reads in flight
+}
+
+func newGatewayLatencyCache(ttl time.Duration) *gatewayLatencyCache {
+	return &gatewayLatencyCache{ttl: ttl, clock: clock.Real{}}
+}
+
+// gatewayLatencies returns recent latency by gateway ID, or nil while
+// latency is disabled. Once the TTL passes, the next pack starts a read in
+// the background and every pack keeps the last values read until it
+// completes; when a read fails they are kept until one succeeds. Only the
+// first read is waited for, by the pack that starts it, and packs go
+// without latency until it succeeds.
+func (s *ConfigService) gatewayLatencies(ctx context.Context, trace *DecisionTrace) map[string]db.GatewayLatency {
+	c := s.latency
+	if c == nil || c.ttl <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	previous := c.byID
+	if c.refreshing || (previous != nil && c.clock.Now().Sub(c.loadedAt) < c.ttl) {
+		c.mu.Unlock()
+		return previous
+	}
+	c.refreshing = true
+	c.mu.Unlock()
+
+	if previous != nil {
+		c.refreshes.Add(1)
+		go func() {
+			defer c.refreshes.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), gatewayLatencyRefreshTimeout)
+			defer cancel()
+			if err := s.loadGatewayLatencies(ctx); err != nil {
+				log.Printf("gateway latency unavailable, using the last read: %v", err)
+			}
+		}()
+		return previous
+	}
+	if err := s.loadGatewayLatencies(ctx); err != nil {
+		log.Printf("gateway latency unavailable: %v", err)
+		trace.Record("gateway_latency", "lookup_failed", map[string]interface{}{"error": err.Error()})
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.byID
+}
+
+// loadGatewayLatencies reads gateway latency into the cache and ends the
+// refresh, keeping the last values read when it fails
+func (s *ConfigService) loadGatewayLatencies(ctx context.Context) error {
+	c := s.latency
+	now := c.clock.Now()
+	stats, err := s.db.GetGatewayLatencyStats(ctx, now.Add(-gatewayLatencyWindow), minGatewayLatencySamples)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshing = false
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]db.GatewayLatency, len(stats))
+	for _, l := range stats {
+		byID[l.GatewayID] = l
+	}
+	c.byID, c.loadedAt = byID, now
+	return nil
+}
+
+// setGatewayLatency fills in each gateway's median latency. Gateways
+// without enough measurements are left without one.
+func setGatewayLatency(gateways []GatewayInfo, latencies map[string]db.GatewayLatency) {
+	for i := range gateways {
+		if l, ok := latencies[gateways[i].ID]; ok {
+			gateways[i].LatencyMsP50 = l.P50Ms
+		}
+	}
+}
+
+// sortByLatency returns gateways ordered by load and median latency, each
+// counted in proportion to weight. Latency is scaled to the load's range up
+// to gatewayLatencyCeilingMs, and gateways without a latency count as half
+// way, so they are neither favored nor left out. gateways is not modified.
+func (s *ConfigService) sortByLatency(
+	gateways []*db.Gateway,
+	weight float64,
+	latencies map[string]db.GatewayLatency,
+) []*db.Gateway {
+	score := func(gw *db.Gateway) float64 {
+		latency := 0.5
+		if l, ok := latencies[gw.ID]; ok {
+			latency = float64(min(l.P50Ms, gatewayLatencyCeilingMs)) / gatewayLatencyCeilingMs
+		}
+		return (1-weight)*s.calculateLoad(gw) + weight*latency
+	}
+	sorted := append([]*db.Gateway{}, gateways...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return score(sorted[i]) < score(sorted[j])
+	})
+	return sorted
+}
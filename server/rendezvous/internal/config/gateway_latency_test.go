@@ -0,0 +1,168 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+var gatewayLatencyColumns = []string{"gateway_id", "count", "p50", "p95"}
+
+func TestPreviewConfigPack_GatewayLatency(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	svc.SetClock(clock.NewFake(now))
+	selection := DefaultSelectionConfig()
+	selection.LatencyWeight = 1
+	if err := svc.SetSelectionConfig(selection); err != nil {
+		t.Fatalf("SetSelectionConfig: %v", err)
+	}
+
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(selectionGatewayRows("us-east-1", 20, 50, 80))
+	mock.ExpectQuery(`FROM discovery_logs`).WithArgs(now.Add(-gatewayLatencyWindow), minGatewayLatencySamples).
+		WillReturnRows(sqlmock.NewRows(gatewayLatencyColumns).
+			AddRow("us-east-1-gw-0", 40, 120, 300).
+			AddRow("us-east-1-gw-2", 12, 40, 90))
+
+	strong := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	pack, trace, err := svc.PreviewConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", strong)
+	if err != nil {
+		t.Fatalf("PreviewConfigPack: %v", err)
+	}
+
+	// Ordered by latency alone, with the unmeasured gateway counted as 500ms
+	var ids []string
+	latencies := map[string]int{}
+	for _, gw := range pack.Gateways {
+		ids = append(ids, gw.ID)
+		latencies[gw.ID] = gw.LatencyMsP50
+	}
+	if want := []string{"us-east-1-gw-2", "us-east-1-gw-0", "us-east-1-gw-1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("gateways: got %v, want %v", ids, want)
+	}
+	if want := map[string]int{"us-east-1-gw-0": 120, "us-east-1-gw-1": 0, "us-east-1-gw-2": 40}; !reflect.DeepEqual(latencies, want) {
+		t.Errorf("latency: got %v, want %v", latencies, want)
+	}
+	encoded, err := json.Marshal(pack.Gateways[2])
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	if strings.Contains(string(encoded), "latency_ms_p50") {
+		t.Errorf("gateway without data lists a latency: %s", encoded)
+	}
+	if step := findStep(t, trace, "latency_weight"); step.Details["gateways_with_data"] != 2 {
+		t.Errorf("latency_weight step: got %+v", step)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGatewayLatencies_Cached(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	fake := clock.NewFake(time.Unix(1_700_000_000, 0))
+	svc.SetClock(fake)
+	ctx := context.Background()
+
+	mock.ExpectQuery(`FROM discovery_logs`).WillReturnRows(sqlmock.NewRows(gatewayLatencyColumns).
+		AddRow("gw-1", 10, 80, 200))
+	first := svc.gatewayLatencies(ctx, nil)
+	if first["gw-1"].P50Ms != 80 {
+		t.Fatalf("latency: got %+v", first)
+	}
+
+	// Reused within the TTL
+	fake.Advance(DefaultGatewayLatencyTTL - time.Second)
+	if got := svc.gatewayLatencies(ctx, nil); !reflect.DeepEqual(got, first) {
+		t.Errorf("within the TTL: got %+v", got)
+	}
+
+	// Once expired it is read again in the background, and the last read
+	// served meanwhile and kept while that fails
+	fake.Advance(time.Second)
+	mock.ExpectQuery(`FROM discovery_logs`).WillReturnError(errors.New("connection reset"))
+	if got := svc.gatewayLatencies(ctx, nil); !reflect.DeepEqual(got, first) {
+		t.Errorf("expired: got %+v, want the last read while refreshing", got)
+	}
+	svc.latency.refreshes.Wait()
+	if got := svc.gatewayLatencies(ctx, nil); !reflect.DeepEqual(got, first) {
+		t.Errorf("failed read: got %+v, want the last read", got)
+	}
+	svc.latency.refreshes.Wait()
+
+	// A later read replaces it
+	mock.ExpectQuery(`FROM discovery_logs`).WillReturnRows(sqlmock.NewRows(gatewayLatencyColumns).
+		AddRow("gw-1", 12, 95, 210))
+	svc.gatewayLatencies(ctx, nil)
+	svc.latency.refreshes.Wait()
+	if got := svc.gatewayLatencies(ctx, nil); got["gw-1"].P50Ms != 95 {
+		t.Errorf("after refresh: got %+v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// Disabled, nothing is read
+	svc.latency.ttl = 0
+	if got := svc.gatewayLatencies(ctx, nil); got != nil {
+		t.Errorf("disabled: got %+v", got)
+	}
+}
+
+func TestGatewayLatencies_FirstReadFails(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	ctx := context.Background()
+
+	// Nothing to serve yet: the pack goes without latency and the next one
+	// tries again
+	mock.ExpectQuery(`FROM discovery_logs`).WillReturnError(errors.New("connection reset"))
+	trace := &DecisionTrace{}
+	if got := svc.gatewayLatencies(ctx, trace); got != nil {
+		t.Errorf("failed first read: got %+v, want nil", got)
+	}
+	if step := findStep(t, trace, "gateway_latency"); step.Outcome != "lookup_failed" {
+		t.Errorf("gateway_latency outcome: got %q", step.Outcome)
+	}
+	mock.ExpectQuery(`FROM discovery_logs`).WillReturnRows(sqlmock.NewRows(gatewayLatencyColumns).
+		AddRow("gw-1", 10, 80, 200))
+	if got := svc.gatewayLatencies(ctx, nil); got["gw-1"].P50Ms != 80 {
+		t.Errorf("second read: got %+v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
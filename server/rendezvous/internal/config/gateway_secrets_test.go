@@ -0,0 +1,132 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/crypt"
+	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+)
+
+const secretGatewayID = "5c2a7e10-3b4d-4f6a-8e9b-0c1d2e3f4a5b"
+
+// secretTestService returns a config service over a mock database with one
+// gateway whose secrets were sealed by the returned store's key.
+func secretTestService(t *testing.T) (*ConfigService, sqlmock.Sqlmock, *crypt.Sealer) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	database := db.NewFromPool(sqlDB)
+
+	sealer, err := crypt.NewSealer(bytes.Repeat([]byte{9}, crypt.KeySize))
+	if err != nil {
+		t.Fatalf("NewSealer: %v", err)
+	}
+	svc, err := NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	svc.SetGatewaySecrets(gateway.NewSecretStore(database, sealer, time.Hour))
+
+	now := time.Now()
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns).
+		AddRow(secretGatewayID, []byte("gateway-public-key"), "198.51.100.7", 443, "{parasite}", "{}",
+			"us-east-1", 100, 1, 100, "active", false, nil, "approved", nil, now, now, now))
+	return svc, mock, sealer
+}
+
+func expectGatewaySecrets(t *testing.T, mock sqlmock.Sqlmock, sealer *crypt.Sealer, values ...string) {
+	t.Helper()
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"gateway_id", "generation", "ciphertext", "created_at", "expires_at"})
+	for i, value := range values {
+		sealed, err := sealer.Seal([]byte(value), []byte(secretGatewayID))
+		if err != nil {
+			t.Fatalf("Seal: %v", err)
+		}
+		var expiresAt interface{}
+		if i > 0 {
+			expiresAt = now.Add(time.Hour)
+		}
+		rows.AddRow(secretGatewayID, len(values)-i, sealed, now, expiresAt)
+	}
+	mock.ExpectQuery(`FROM gateway_secrets`).WillReturnRows(rows)
+}
+
+func TestGenerateConfigPack_GatewaySecretsForTrustedTier(t *testing.T) {
+	svc, mock, sealer := secretTestService(t)
+	// Mid-rotation: the new secret and the one it replaced
+	expectGatewaySecrets(t, mock, sealer, "new-obfuscation-seed", "old-obfuscation-seed")
+
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "",
+		&AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	if len(pack.Gateways) != 1 {
+		t.Fatalf("got %d gateways, want 1", len(pack.Gateways))
+	}
+	secrets := pack.Gateways[0].Secrets
+	if len(secrets) != 2 || string(secrets[0]) != "new-obfuscation-seed" || string(secrets[1]) != "old-obfuscation-seed" {
+		t.Errorf("secrets: got %q, want the new and old seeds, newest first", secrets)
+	}
+	if !svc.VerifyConfigPack(pack) {
+		t.Error("the signature must cover the secrets")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerateConfigPack_NoGatewaySecretsBelowTrustedTier(t *testing.T) {
+	for _, result := range []*AttestationResult{
+		{IsValid: true, DeviceIntegrity: "MEETS_BASIC_INTEGRITY"},
+		{IsValid: true, DeviceIntegrity: "BYPASS_ENABLED"},
+		// Strong integrity, but the device is still on probation
+		{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY", Probation: true},
+	} {
+		t.Run(result.DeviceIntegrity, func(t *testing.T) {
+			svc, mock, _ := secretTestService(t)
+			pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", result, nil)
+			if err != nil {
+				t.Fatalf("GenerateConfigPack: %v", err)
+			}
+			for _, gw := range pack.Gateways {
+				if len(gw.Secrets) > 0 {
+					t.Errorf("gateway %s carries secrets", gw.ID)
+				}
+			}
+			// The secrets table is never read for these tiers
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPreviewConfigPack_WithholdsGatewaySecrets(t *testing.T) {
+	svc, mock, sealer := secretTestService(t)
+	expectGatewaySecrets(t, mock, sealer, "new-obfuscation-seed")
+
+	pack, trace, err := svc.PreviewConfigPack(context.Background(), "preview", "us-east-1", "", "", ClientInfo{}, "",
+		&AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY"})
+	if err != nil {
+		t.Fatalf("PreviewConfigPack: %v", err)
+	}
+	if len(pack.Gateways) != 1 || len(pack.Gateways[0].Secrets) != 0 {
+		t.Errorf("preview gateways: got %+v, want one gateway without secrets", pack.Gateways)
+	}
+	step := findStep(t, trace, "gateway_secrets")
+	if step.Outcome != "withheld_in_preview" || step.Details["gateways_with_secrets"] != 1 {
+		t.Errorf("gateway_secrets step: got %+v", step)
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// SigningKeyHistory publishes the config signing keys packs may be signed
+// with, so clients need not trust the public key a pack carries. Each
+// rotated-in key is endorsed by the key it replaced: a client that pinned
+// any key in the history can follow the endorsements to the current key.
+type SigningKeyHistory struct {
+	CurrentKeyID string                `json:"current_key_id"`
+	Keys         []PublishedSigningKey `json:"keys"` // Current first, then previous keys newest first
+}
+
+// PublishedSigningKey is a signing key's public half with its validity
+// window and endorsement
+type PublishedSigningKey struct {
+	KeyID      string     `json:"key_id"`
+	PublicKey  []byte     `json:"public_key"`
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`  // Unset for keys from the environment
+	ValidUntil *time.Time `json:"valid_until,omitempty"` // Unset for the current key
+
+	// Endorsement is the signature by the key with PreviousKeyID over
+	// KeyEndorsementMessage; both are unset for keys without one
+	PreviousKeyID string `json:"previous_key_id,omitempty"`
+	Endorsement   []byte `json:"endorsement,omitempty"`
+}
+
+// KeyEndorsementMessage is what a replaced signing key signs to endorse its
+// successor: the new key's ID and public key, the replaced key's ID, and
+// when the new key became current
+func KeyEndorsementMessage(keyID string, publicKey ed25519.PublicKey, previousKeyID string, validFrom time.Time) []byte {
+	return []byte(fmt.Sprintf("lumenlink-signing-key\n%s\n%s\n%s\n%d",
+		keyID, base64.StdEncoding.EncodeToString(publicKey), previousKeyID, validFrom.Unix()))
+}
+
+// SigningKeyHistory returns the current signing key and the previous keys
+// still in their grace period
+func (s *ConfigService) SigningKeyHistory() *SigningKeyHistory {
+	keys := s.keys.history(s.clock.Now())
+	history := &SigningKeyHistory{CurrentKeyID: keys[0].ID, Keys: make([]PublishedSigningKey, 0, len(keys))}
+	for _, key := range keys {
+		published := PublishedSigningKey{
+			KeyID:         key.ID,
+			PublicKey:     key.PublicKey,
+			ValidUntil:    key.ExpiresAt,
+			PreviousKeyID: key.PreviousKeyID,
+			Endorsement:   key.Endorsement,
+		}
+		if !key.ValidFrom.IsZero() {
+			validFrom := key.ValidFrom.UTC()
+			published.ValidFrom = &validFrom
+		}
+		history.Keys = append(history.Keys, published)
+	}
+	return history
+}
+
+// VerifySigningKeyChain follows the endorsements in history from the
+// client's pinned key to the current key, and returns the current key if
+// every step verifies. A pinned key that is already current verifies
+// trivially. When the key the pinned key endorsed has left the history, or
+// an endorsement is broken, the chain does not verify and the client must
+// re-pin out of band.
+func VerifySigningKeyChain(history *SigningKeyHistory, pinned ed25519.PublicKey) (ed25519.PublicKey, bool) {
+	successors := make(map[string]*PublishedSigningKey, len(history.Keys))
+	for i := range history.Keys {
+		key := &history.Keys[i]
+		if key.PreviousKeyID != "" {
+			successors[key.PreviousKeyID] = key
+		}
+	}
+
+	trusted := pinned
+	for steps := 0; steps <= len(history.Keys); steps++ {
+		id := KeyID(trusted)
+		if id == history.CurrentKeyID {
+			return trusted, true
+		}
+		next := successors[id]
+		// ed25519.Verify panics on a malformed key
+		if next == nil || len(trusted) != ed25519.PublicKeySize || len(next.PublicKey) != ed25519.PublicKeySize ||
+			next.KeyID != KeyID(next.PublicKey) || next.ValidFrom == nil {
+			return nil, false
+		}
+		message := KeyEndorsementMessage(next.KeyID, next.PublicKey, id, *next.ValidFrom)
+		if !ed25519.Verify(trusted, message, next.Endorsement) {
+			return nil, false
+		}
+		trusted = next.PublicKey
+	}
+	return nil, false
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectRotation expects RotateKey to store a key replacing previousID at now
+func expectRotation(mock sqlmock.Sqlmock, previousID string, now, previousExpiresAt time.Time) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM config_signing_keys`).WithArgs(now).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE config_signing_keys`).WithArgs(previousExpiresAt).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO config_signing_keys`).
+		WithArgs(previousID, sqlmock.AnyArg(), now, previousExpiresAt).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO config_signing_keys`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), now, previousID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestSigningKeyChain(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc, mock, _, fake := newRotatingConfigService(t, now)
+	svc.keyGrace = 24 * time.Hour
+	original := svc.signingKey()
+
+	// Two rotations an hour apart
+	expectRotation(mock, original.ID, now, now.Add(24*time.Hour))
+	first, err := svc.RotateKey(context.Background())
+	if err != nil {
+		t.Fatalf("RotateKey: %v", err)
+	}
+	fake.Advance(time.Hour)
+	expectRotation(mock, first.KeyID, now.Add(time.Hour), now.Add(25*time.Hour))
+	second, err := svc.RotateKey(context.Background())
+	if err != nil {
+		t.Fatalf("RotateKey: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Clients read the history as JSON
+	fetch := func() *SigningKeyHistory {
+		encoded, err := json.Marshal(svc.SigningKeyHistory())
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		var history SigningKeyHistory
+		if err := json.Unmarshal(encoded, &history); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		return &history
+	}
+	history := fetch()
+	if history.CurrentKeyID != second.KeyID || len(history.Keys) != 3 {
+		t.Fatalf("history: current %s, %d keys", history.CurrentKeyID, len(history.Keys))
+	}
+	if current := history.Keys[0]; current.ValidUntil != nil || current.ValidFrom == nil || !current.ValidFrom.Equal(now.Add(time.Hour)) {
+		t.Errorf("current key window: %v to %v", current.ValidFrom, current.ValidUntil)
+	}
+	if previous := history.Keys[1]; previous.KeyID != first.KeyID || previous.ValidUntil == nil ||
+		!previous.ValidUntil.Equal(now.Add(25*time.Hour)) {
+		t.Errorf("previous key: %+v", previous)
+	}
+
+	// Clients pinning any key in the history reach the current one
+	for name, pinned := range map[string]ed25519.PublicKey{
+		"original": original.PublicKey,
+		"first":    first.PublicKey,
+		"current":  second.PublicKey,
+	} {
+		current, ok := VerifySigningKeyChain(history, pinned)
+		if !ok || !bytes.Equal(current, second.PublicKey) {
+			t.Errorf("pinned %s: chain does not verify", name)
+		}
+	}
+
+	// A key not endorsed by its predecessor breaks the chain from there
+	forged, _, _ := ed25519.GenerateKey(rand.Reader)
+	substituted := fetch()
+	substituted.Keys[0].PublicKey = forged
+	substituted.Keys[0].KeyID = KeyID(forged)
+	substituted.CurrentKeyID = KeyID(forged)
+	if _, ok := VerifySigningKeyChain(substituted, original.PublicKey); ok {
+		t.Error("substituted current key verifies")
+	}
+	tampered := fetch()
+	tampered.Keys[1].Endorsement[0] ^= 1
+	if _, ok := VerifySigningKeyChain(tampered, original.PublicKey); ok {
+		t.Error("tampered endorsement verifies")
+	}
+	if _, ok := VerifySigningKeyChain(tampered, first.PublicKey); !ok {
+		t.Error("chain after the tampered endorsement rejected")
+	}
+	unknown, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, ok := VerifySigningKeyChain(history, unknown); ok {
+		t.Error("unknown pinned key verifies")
+	}
+
+	// A pinned key that has left the history still verifies while the key
+	// it endorsed is listed, and must be re-pinned once that one leaves too
+	fake.Advance(23 * time.Hour)
+	if history := fetch(); len(history.Keys) != 2 {
+		t.Errorf("history after the original key expired: %d keys", len(history.Keys))
+	} else if _, ok := VerifySigningKeyChain(history, original.PublicKey); !ok {
+		t.Error("original key rejected while its successor is listed")
+	}
+	fake.Advance(time.Hour)
+	if _, ok := VerifySigningKeyChain(fetch(), original.PublicKey); ok {
+		t.Error("original key verifies after its successor expired")
+	}
+	if _, ok := VerifySigningKeyChain(fetch(), first.PublicKey); !ok {
+		t.Error("first rotated key rejected")
+	}
+}
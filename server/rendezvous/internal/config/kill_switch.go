@@ -0,0 +1,98 @@
+package config
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// killSwitchCache keeps the last kill switches read
+type killSwitchCache struct {
+	mu       sync.Mutex
+	switches map[string]string
+}
+
+// RefreshKillSwitches reads the kill switches, so that packs built while
+// they cannot be read keep applying them. The server calls it at startup and
+// does not serve without them.
+func (s *ConfigService) RefreshKillSwitches(ctx context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+	killSwitches, err := s.db.GetKillSwitches(ctx)
+	if err != nil {
+		return err
+	}
+	s.lastKillSwitches.mu.Lock()
+	s.lastKillSwitches.switches = killSwitches
+	s.lastKillSwitches.mu.Unlock()
+	return nil
+}
+
+// killSwitches returns the transport types disabled server-wide, with the
+// reason for each. While they cannot be read the last switches read are
+// applied rather than none, which would hand out a transport disabled
+// because it is being exploited.
+func (s *ConfigService) killSwitches(ctx context.Context, trace *DecisionTrace) map[string]string {
+	if s.db == nil {
+		return map[string]string{}
+	}
+	killSwitches, err := s.db.GetKillSwitches(ctx)
+	s.lastKillSwitches.mu.Lock()
+	defer s.lastKillSwitches.mu.Unlock()
+	if err != nil {
+		log.Printf("kill switches unavailable, applying the last read: %v", err)
+		trace.Record("kill_switch", "lookup_failed", map[string]interface{}{"error": err.Error()})
+		if s.lastKillSwitches.switches == nil {
+			// Only a service the server did not start, which read them
+			return map[string]string{}
+		}
+		return s.lastKillSwitches.switches
+	}
+	s.lastKillSwitches.switches = killSwitches
+	return killSwitches
+}
+
+// applyKillSwitches drops disabled transports. Unlike transport policies a
+// kill switch applies even when it leaves a pack without transports, since a
+// transport being exploited must not be used at all.
+func applyKillSwitches(transports []TransportConfig, killSwitches map[string]string, trace *DecisionTrace) []TransportConfig {
+	if len(killSwitches) == 0 {
+		return transports
+	}
+	kept := make([]TransportConfig, 0, len(transports))
+	var dropped []string
+	for _, t := range transports {
+		if _, disabled := killSwitches[t.Type]; disabled {
+			dropped = append(dropped, t.Type)
+			continue
+		}
+		kept = append(kept, t)
+	}
+	trace.Record("kill_switch", "applied", map[string]interface{}{
+		"disabled": killSwitchTypes(killSwitches),
+		"dropped":  dropped,
+	})
+	return kept
+}
+
+// killSwitchTypes returns the disabled transport types in order
+func killSwitchTypes(killSwitches map[string]string) []string {
+	types := make([]string, 0, len(killSwitches))
+	for transportType := range killSwitches {
+		types = append(types, transportType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// killSwitchKey identifies a set of kill switches in a pack base key
+func killSwitchKey(killSwitches map[string]string) string {
+	entries := make([]string, 0, len(killSwitches))
+	for _, transportType := range killSwitchTypes(killSwitches) {
+		entries = append(entries, transportType+"="+killSwitches[transportType])
+	}
+	return strings.Join(entries, ",")
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+func TestPreviewConfigPack_KillSwitches(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(selectionGatewayRows("us-east-1", 20))
+	mock.ExpectQuery(`SELECT value FROM settings`).WithArgs(db.SettingKillSwitches).
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow([]byte(`{"ssh":"exploited in the wild"}`)))
+
+	strong := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	pack, trace, err := svc.PreviewConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", strong)
+	if err != nil {
+		t.Fatalf("PreviewConfigPack: %v", err)
+	}
+
+	// The built-in transports without ssh, with the switch under the signature
+	var types []string
+	for _, transport := range pack.Transports {
+		types = append(types, transport.Type)
+	}
+	if want := []string{"masque", "xtls", "parasite"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("transports: got %v, want %v", types, want)
+	}
+	if want := map[string]string{"ssh": "exploited in the wild"}; !reflect.DeepEqual(pack.KillSwitches, want) {
+		t.Errorf("kill switches: got %v, want %v", pack.KillSwitches, want)
+	}
+	if !svc.VerifyConfigPack(pack) {
+		t.Error("pack does not verify")
+	}
+	if step := findStep(t, trace, "kill_switch"); step.Outcome != "applied" || !reflect.DeepEqual(step.Details["dropped"], []string{"ssh"}) {
+		t.Errorf("kill_switch step: got %+v", step)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestKillSwitches_InPackBaseAndHash(t *testing.T) {
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	disabled := map[string]string{"xtls": "blocked"}
+	if packBaseKey("us-east-1", true, nil, GatewayDetailFull, "", "", "", "", nil, nil, nil, nil, nil, nil) ==
+		packBaseKey("us-east-1", true, nil, GatewayDetailFull, "", "", "", "", nil, nil, nil, nil, disabled, nil) {
+		t.Error("packs built under different kill switches share a base")
+	}
+
+	// A 2.0 pack carries its kill switches in the signed base
+	pack := benchmarkPack(svc)
+	pack.KillSwitches = disabled
+	before, _ := pack.ContentHash()
+	if err := svc.generatePack(pack, PackVersion2, ""); err != nil {
+		t.Fatalf("generatePack: %v", err)
+	}
+	data, err := json.Marshal(pack)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var received SignedConfigPack
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(received.KillSwitches, disabled) || !VerifyPack(&received, svc.signingKey().PublicKey) {
+		t.Errorf("received kill switches: got %v", received.KillSwitches)
+	}
+
+	// Clearing a switch changes the content hash, so clients get the pack
+	// rather than not_modified
+	pack.KillSwitches = map[string]string{}
+	if after, _ := pack.ContentHash(); after == before {
+		t.Error("content hash ignores kill switches")
+	}
+}
+
+func TestKillSwitches_LastReadWhileUnavailable(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	ctx := context.Background()
+
+	mock.ExpectQuery(`SELECT value FROM settings`).WithArgs(db.SettingKillSwitches).
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow([]byte(`{"ssh":"exploited in the wild"}`)))
+	if err := svc.RefreshKillSwitches(ctx); err != nil {
+		t.Fatalf("RefreshKillSwitches: %v", err)
+	}
+
+	// An outage keeps the switch rather than re-enabling ssh
+	mock.ExpectQuery(`SELECT value FROM settings`).WillReturnError(errors.New("connection refused"))
+	want := map[string]string{"ssh": "exploited in the wild"}
+	trace := &DecisionTrace{Steps: []TraceStep{}}
+	if got := svc.killSwitches(ctx, trace); !reflect.DeepEqual(got, want) {
+		t.Errorf("during an outage: got %v, want %v", got, want)
+	}
+
+	// A later read replaces them
+	mock.ExpectQuery(`SELECT value FROM settings`).WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow([]byte(`{}`)))
+	mock.ExpectQuery(`SELECT value FROM settings`).WillReturnError(errors.New("connection refused"))
+	svc.killSwitches(ctx, trace)
+	if got := svc.killSwitches(ctx, trace); len(got) != 0 {
+		t.Errorf("after clearing: got %v, want none", got)
+	}
+
+	mock.ExpectQuery(`SELECT value FROM settings`).WillReturnError(errors.New("connection refused"))
+	if err := svc.RefreshKillSwitches(ctx); err == nil {
+		t.Error("RefreshKillSwitches: expected an error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
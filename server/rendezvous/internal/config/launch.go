@@ -0,0 +1,69 @@
+package config
+
+import (
+	"context"
+	"sort"
+)
+
+// DefaultRegion serves clients whose region is unknown while every region is open.
+const DefaultRegion = "us-east-1"
+
+// RegionStatusClosed is set as metadata.region_status on packs for regions
+// that are not open yet.
+const RegionStatusClosed = "closed"
+
+// NoticeRegionNotAvailable is the message key added to packs for closed regions.
+const NoticeRegionNotAvailable = "region_not_available"
+
+// LaunchPolicy lists the regions open during a soft launch. Clients from any
+// other region, or whose region is unknown, get a pack of honeypots only, so
+// they do not consume the capacity of the open regions.
+type LaunchPolicy struct {
+	OpenRegions []string // Empty opens every region
+}
+
+// Restricted reports whether the policy closes any region.
+func (p LaunchPolicy) Restricted() bool {
+	return len(p.OpenRegions) > 0
+}
+
+// IsOpen reports whether real gateways are served in region.
+func (p LaunchPolicy) IsOpen(region string) bool {
+	if !p.Restricted() {
+		return true
+	}
+	i := sort.SearchStrings(p.OpenRegions, region)
+	return i < len(p.OpenRegions) && p.OpenRegions[i] == region
+}
+
+// launchRegion resolves the region a pack is built for under the launch
+// policy and reports whether it is open. An empty region is unknown: it gets
+// DefaultRegion while every region is open, and is closed otherwise.
+func (s *ConfigService) launchRegion(ctx context.Context, region string, trace *DecisionTrace) (string, bool) {
+	regions, err := s.db.GetOpenRegions(ctx)
+	if err != nil {
+		// Serve as if unrestricted rather than closing every region on a
+		// failed lookup, as rollouts fall back to the base config
+		trace.Record("launch_policy", "lookup_failed", map[string]interface{}{"error": err.Error()})
+		regions = nil
+	}
+	policy := LaunchPolicy{OpenRegions: regions}
+
+	switch {
+	case !policy.Restricted():
+		if region == "" {
+			region = DefaultRegion
+		}
+		trace.Record("launch_policy", "unrestricted", map[string]interface{}{"region": region})
+		return region, true
+	case policy.IsOpen(region):
+		trace.Record("launch_policy", "open", map[string]interface{}{"region": region})
+		return region, true
+	default:
+		trace.Record("launch_policy", "closed", map[string]interface{}{
+			"region":       region,
+			"open_regions": policy.OpenRegions,
+		})
+		return region, false
+	}
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+// expectOpenRegions expects one launch policy lookup returning regions.
+func expectOpenRegions(mock sqlmock.Sqlmock, regions ...string) {
+	rows := sqlmock.NewRows([]string{"region"})
+	for _, region := range regions {
+		rows.AddRow(region)
+	}
+	mock.ExpectQuery(`FROM launch_open_regions`).WillReturnRows(rows)
+}
+
+// expectNotRevoked expects one device revocation lookup finding nothing.
+func expectNotRevoked(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`FROM revoked_devices`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+}
+
+var launchGatewayColumns = []string{
+	"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+	"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+	"operator_id", "approval_status", "asn",
+	"created_at", "last_seen", "updated_at",
+}
+
+func TestLaunchPolicy_IsOpen(t *testing.T) {
+	if !(LaunchPolicy{}).IsOpen("af-south-1") {
+		t.Error("empty policy must open every region")
+	}
+	policy := LaunchPolicy{OpenRegions: []string{"eu-central-1", "me-south-1", "us-east-1"}}
+	for region, want := range map[string]bool{
+		"us-east-1":  true,
+		"me-south-1": true,
+		"af-south-1": false,
+		"":           false,
+	} {
+		if got := policy.IsOpen(region); got != want {
+			t.Errorf("IsOpen(%q): got %v, want %v", region, got, want)
+		}
+	}
+}
+
+func TestGenerateConfigPack_ClosedRegionGetsHoneypotsOnly(t *testing.T) {
+	for _, region := range []string{"af-south-1", ""} {
+		t.Run("region "+region, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+
+			pubKey := make([]byte, ed25519.PublicKeySize)
+			rand.Read(pubKey)
+			now := time.Now()
+			expectOpenRegions(mock, "me-south-1", "us-east-1")
+			expectNotRevoked(mock)
+			mock.ExpectQuery(`SELECT id, public_key`).WithArgs("").WillReturnRows(sqlmock.NewRows(launchGatewayColumns).
+				AddRow("hp-1", pubKey, "203.0.113.10", 443, "{masque}", "{gps}",
+					"us-east-1", 100, 0, 100, "active", true, nil, "approved", nil, now, now, now))
+
+			svc, err := NewConfigService(db.NewFromPool(sqlDB))
+			if err != nil {
+				t.Fatalf("NewConfigService: %v", err)
+			}
+			// A valid attestation does not unlock real gateways in a closed region
+			pack, err := svc.GenerateConfigPack(context.Background(), "client-1", region, "", "es", ClientInfo{}, "", &AttestationResult{
+				IsValid:         true,
+				DeviceIntegrity: "MEETS_STRONG_INTEGRITY",
+			}, nil)
+			if err != nil {
+				t.Fatalf("GenerateConfigPack: %v", err)
+			}
+
+			if len(pack.Gateways) != 1 || !pack.Gateways[0].IsHoneypot {
+				t.Errorf("gateways: got %+v, want the honeypot only", pack.Gateways)
+			}
+			if pack.Metadata["region_status"] != RegionStatusClosed {
+				t.Errorf("region_status: got %v, want closed", pack.Metadata["region_status"])
+			}
+			notices, _ := pack.Metadata["notices"].([]Notice)
+			if len(notices) == 0 || notices[0].Key != NoticeRegionNotAvailable || notices[0].Locale != "es" {
+				t.Errorf("notices: got %+v, want region_not_available in es", notices)
+			}
+			if !svc.VerifyConfigPack(pack) {
+				t.Error("closed-region pack must be signed")
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestGenerateConfigPack_OpenRegion(t *testing.T) {
+	tests := []struct {
+		name       string
+		open       []string
+		region     string
+		wantRegion string
+	}{
+		{"listed region", []string{"me-south-1", "us-east-1"}, "me-south-1", "me-south-1"},
+		{"unrestricted", nil, "af-south-1", "af-south-1"},
+		{"unknown region while unrestricted", nil, "", DefaultRegion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+
+			expectOpenRegions(mock, tt.open...)
+			expectNotRevoked(mock)
+			mock.ExpectQuery(`SELECT id, public_key`).WithArgs(tt.wantRegion, false, DefaultGatewayCandidateLimit).
+				WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+			mock.ExpectQuery(`SELECT id, public_key`).WithArgs(tt.wantRegion).
+				WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+
+			svc, err := NewConfigService(db.NewFromPool(sqlDB))
+			if err != nil {
+				t.Fatalf("NewConfigService: %v", err)
+			}
+			pack, err := svc.GenerateConfigPack(context.Background(), "client-1", tt.region, "", "", ClientInfo{}, "", nil, nil)
+			if err != nil {
+				t.Fatalf("GenerateConfigPack: %v", err)
+			}
+			if pack.Metadata["region"] != tt.wantRegion {
+				t.Errorf("region: got %v, want %s", pack.Metadata["region"], tt.wantRegion)
+			}
+			if _, ok := pack.Metadata["region_status"]; ok {
+				t.Errorf("open region pack has region_status %v", pack.Metadata["region_status"])
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestGenerateConfigPack_LaunchPolicyLookupFailsOpen(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`FROM launch_open_regions`).WillReturnError(errors.New("connection reset"))
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("me-south-1", false, DefaultGatewayCandidateLimit).WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("me-south-1").WillReturnRows(sqlmock.NewRows(launchGatewayColumns))
+
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	pack, trace, err := svc.PreviewConfigPack(context.Background(), "client-1", "me-south-1", "", "", ClientInfo{}, "", nil)
+	if err != nil {
+		t.Fatalf("PreviewConfigPack: %v", err)
+	}
+	if _, ok := pack.Metadata["region_status"]; ok {
+		t.Error("a failed policy lookup must not close the region")
+	}
+	if trace.Steps[1].Policy != "launch_policy" || trace.Steps[1].Outcome != "lookup_failed" {
+		t.Errorf("trace: got %+v, want launch_policy lookup_failed", trace.Steps[1])
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxPackMirrors is how many rendezvous mirrors a pack lists unless
+// LUMENLINK_PACK_MAX_MIRRORS says otherwise
+const DefaultMaxPackMirrors = 3
+
+// rendezvousMirrors returns the URLs of the enabled mirrors for region, most
+// preferred first and at most s.maxMirrors: higher priority first, and the
+// region's own mirrors before global ones of the same priority. While they
+// cannot be read, packs list none.
+func (s *ConfigService) rendezvousMirrors(ctx context.Context, region string, trace *DecisionTrace) []string {
+	if s.db == nil || s.maxMirrors <= 0 {
+		return []string{}
+	}
+	rows, err := s.db.GetRendezvousMirrors(ctx)
+	if err != nil {
+		log.Printf("rendezvous mirrors unavailable, serving packs without them: %v", err)
+		trace.Record("mirrors", "lookup_failed", map[string]interface{}{"error": err.Error()})
+		return []string{}
+	}
+
+	type candidate struct {
+		url      string
+		priority int
+		regional bool
+	}
+	var candidates []candidate
+	for _, m := range rows {
+		if m.Enabled && (m.Region == "" || m.Region == region) {
+			candidates = append(candidates, candidate{url: m.URL, priority: m.Priority, regional: m.Region != ""})
+		}
+	}
+	// Rows come highest priority first; the stable sort keeps that order
+	// among equals
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority > candidates[j].priority
+		}
+		return candidates[i].regional && !candidates[j].regional
+	})
+
+	mirrors := []string{}
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		if len(mirrors) == s.maxMirrors {
+			break
+		}
+		if !seen[c.url] {
+			seen[c.url] = true
+			mirrors = append(mirrors, c.url)
+		}
+	}
+	trace.Record("mirrors", "selected", map[string]interface{}{
+		"mirrors":    mirrors,
+		"candidates": len(candidates),
+	})
+	return mirrors
+}
+
+// mirrorKey identifies a pack's mirror list in a pack base key
+func mirrorKey(mirrors []string) string {
+	return strings.Join(mirrors, ",")
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+var mirrorColumns = []string{"id", "url", "region", "priority", "enabled", "created_at", "updated_at"}
+
+func TestPreviewConfigPack_Mirrors(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	now := time.Now()
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(selectionGatewayRows("us-east-1", 20))
+	mock.ExpectQuery(`FROM rendezvous_mirrors`).WillReturnRows(sqlmock.NewRows(mirrorColumns).
+		AddRow(1, "https://disabled.example", nil, 100, false, now, now).
+		AddRow(2, "https://eu.example", "eu-west-1", 50, true, now, now).
+		AddRow(3, "https://global.example", nil, 10, true, now, now).
+		AddRow(4, "https://us.example", "us-east-1", 10, true, now, now).
+		AddRow(5, "https://backup.example", nil, 5, true, now, now).
+		AddRow(6, "https://last.example", nil, 1, true, now, now))
+
+	strong := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	pack, trace, err := svc.PreviewConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", strong)
+	if err != nil {
+		t.Fatalf("PreviewConfigPack: %v", err)
+	}
+
+	// By priority, the region's mirror ahead of a global one of the same
+	// priority, capped at DefaultMaxPackMirrors
+	want := []string{"https://us.example", "https://global.example", "https://backup.example"}
+	if !reflect.DeepEqual(pack.Mirrors, want) {
+		t.Errorf("mirrors: got %v, want %v", pack.Mirrors, want)
+	}
+	if step := findStep(t, trace, "mirrors"); step.Outcome != "selected" || step.Details["candidates"] != 4 {
+		t.Errorf("mirrors step: got %+v", step)
+	}
+
+	// The mirrors are signed
+	if !svc.VerifyConfigPack(pack) {
+		t.Fatal("pack does not verify")
+	}
+	pack.Mirrors = append(pack.Mirrors, "https://attacker.example")
+	if svc.VerifyConfigPack(pack) {
+		t.Error("pack verifies with a mirror added")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRendezvousMirrors_LookupFailsOpen(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	mock.ExpectQuery(`FROM rendezvous_mirrors`).WillReturnError(errors.New("connection refused"))
+
+	trace := &DecisionTrace{}
+	if mirrors := svc.rendezvousMirrors(context.Background(), "us-east-1", trace); mirrors == nil || len(mirrors) != 0 {
+		t.Errorf("mirrors: got %v, want none", mirrors)
+	}
+	if step := findStep(t, trace, "mirrors"); step.Outcome != "lookup_failed" {
+		t.Errorf("mirrors step: got %+v", step)
+	}
+
+	// With the cap at 0 the table is not read
+	svc.maxMirrors = 0
+	if mirrors := svc.rendezvousMirrors(context.Background(), "us-east-1", nil); len(mirrors) != 0 {
+		t.Errorf("mirrors with no cap: got %v", mirrors)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMirrors_InPackBaseAndHash(t *testing.T) {
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	mirrors := []string{"https://mirror.example"}
+	if packBaseKey("us-east-1", true, nil, GatewayDetailFull, "", "", "", "", nil, nil, nil, nil, nil, nil) ==
+		packBaseKey("us-east-1", true, nil, GatewayDetailFull, "", "", "", "", nil, nil, nil, nil, nil, mirrors) {
+		t.Error("packs listing different mirrors share a base")
+	}
+
+	// A 2.0 pack carries its mirrors in the signed base
+	pack := benchmarkPack(svc)
+	pack.Mirrors = mirrors
+	before, _ := pack.ContentHash()
+	if err := svc.generatePack(pack, PackVersion2, ""); err != nil {
+		t.Fatalf("generatePack: %v", err)
+	}
+	if !reflect.DeepEqual(pack.base.content.Mirrors, mirrors) || !svc.VerifyConfigPack(pack) {
+		t.Errorf("base mirrors: got %v", pack.base.content.Mirrors)
+	}
+
+	pack.Mirrors = []string{}
+	if after, _ := pack.ContentHash(); after == before {
+		t.Error("content hash ignores mirrors")
+	}
+}
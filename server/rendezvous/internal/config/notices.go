@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"rendezvous/internal/i18n"
+)
+
+// Notice is a human-readable message carried in pack metadata, resolved in
+// the client's locale.
+type Notice struct {
+	Key    string `json:"key"`
+	Text   string `json:"text"`
+	Locale string `json:"locale"` // Locale the text was resolved in
+}
+
+// loadPackNotices reads the message keys in LUMENLINK_PACK_NOTICES (comma
+// separated) and checks that each exists in the catalog.
+func loadPackNotices(catalog *i18n.Catalog) ([]string, error) {
+	var keys []string
+	for _, key := range strings.Split(os.Getenv("LUMENLINK_PACK_NOTICES"), ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if !catalog.Has(key) {
+			return nil, fmt.Errorf("unknown pack notice %q", key)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// resolveNotices resolves the notices with the given message keys in locale,
+// falling back towards the default language.
+func (s *ConfigService) resolveNotices(locale string, keys []string, trace *DecisionTrace) []Notice {
+	notices := make([]Notice, 0, len(keys))
+	for _, key := range keys {
+		if text, resolved, ok := s.messages.Resolve(locale, key); ok {
+			notices = append(notices, Notice{Key: key, Text: text, Locale: resolved})
+			trace.Record("notice", "resolved", map[string]interface{}{"key": key, "locale": resolved})
+		}
+	}
+	return notices
+}
@@ -1,90 +1,302 @@
 package config
 
 import (
+	"bytes"
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log"
+	"math"
 	"os"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"rendezvous/internal/attestation"
+	"rendezvous/internal/audit"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/crypt"
 	"rendezvous/internal/db"
+	"rendezvous/internal/gateway"
+	"rendezvous/internal/geo"
+	"rendezvous/internal/i18n"
+	"rendezvous/internal/metrics"
 )
 
-// AttestationResult represents the result of attestation verification
-type AttestationResult struct {
-	IsValid        bool
-	DeviceIntegrity string
-}
+// AttestationResult is the device's attestation, with the probation and
+// honeypot decisions made on it, as packs are built from it
+type AttestationResult = attestation.AttestationResult
 
 // SignedConfigPack represents a signed configuration pack
 type SignedConfigPack struct {
-	Version      string                 `json:"version"`
-	Timestamp    int64                  `json:"timestamp"`
-	Gateways     []GatewayInfo          `json:"gateways"`
-	Transports   []TransportConfig      `json:"transports"`
-	Discovery    DiscoveryConfig        `json:"discovery"`
-	Metadata     map[string]interface{} `json:"metadata"`
-	Signature    []byte                 `json:"signature"`
-	PublicKey    []byte                 `json:"public_key"`
+	Version    string                 `json:"version"`
+	Timestamp  int64                  `json:"timestamp"`
+	IssuedAt   int64                  `json:"issued_at"`  // When the signed content was issued
+	NotBefore  int64                  `json:"not_before"` // Unix time the pack becomes valid
+	ExpiresAt  int64                  `json:"expires_at"` // Unix time the pack stops being valid
+	Gateways   []GatewayInfo          `json:"gateways"`
+	Transports []TransportConfig      `json:"transports"`
+	Discovery  DiscoveryConfig        `json:"discovery"`
+	Metadata   map[string]interface{} `json:"metadata"`
+	Signature  []byte                 `json:"signature"`
+	PublicKey  []byte                 `json:"public_key"`
+	KeyID      string                 `json:"key_id,omitempty"` // Identifies PublicKey among the server's keys
+
+	// KillSwitches maps transport types disabled server-wide to the reason
+	// why. Clients must stop using them even if an older pack lists them.
+	KillSwitches map[string]string `json:"kill_switches"`
+
+	// Mirrors are URLs of alternate rendezvous endpoints, most preferred
+	// first, for clients to try when this one is blocked
+	Mirrors []string `json:"mirrors"`
+
+	// SignatureAlg is the algorithm Signature is in, a SigAlg constant.
+	// It is signed with the rest of the pack; packs without it are ed25519.
+	SignatureAlg string `json:"signature_alg,omitempty"`
+
+	base    *signedPackBase // The signed base of a 2.0 pack
+	baseKey string          // Caches the 2.0 base; empty when it must not be shared
+
+	allocationEpoch int64            // Epoch the pool endpoints were allocated in
+	allocations     []db.EndpointKey // Pool endpoints allocated to the client
 }
 
 // GatewayInfo contains gateway connection information
 type GatewayInfo struct {
-	ID          string   `json:"id"`
-	Address     string   `json:"address"`
-	Port        int      `json:"port"`
-	Transports  []string `json:"transports"` // e.g., ["masque", "xtls", "parasite"]
-	Region      string   `json:"region"`
-	Load        float64  `json:"load"` // 0.0-1.0
-	IsHoneypot  bool     `json:"is_honeypot"`
-	PublicKey   []byte   `json:"public_key"`
+	ID         string   `json:"id"`
+	Address    string   `json:"address"`
+	Port       int      `json:"port"`
+	Transports []string `json:"transports"` // e.g., ["masque", "xtls", "parasite"]
+	Region     string   `json:"region"`
+	Load       float64  `json:"load"` // 0.0-1.0
+	IsHoneypot bool     `json:"is_honeypot"`
+	PublicKey  []byte   `json:"public_key"`
+	Secrets    [][]byte `json:"secrets,omitempty"` // Transport secrets, newest first; trusted-tier packs only
+	Origin     string   `json:"origin,omitempty"`  // Federation peer that announced the gateway; empty for ours
+
+	LatencyMsP50 int `json:"latency_ms_p50,omitempty"` // Median client latency over the last day; unset without enough data
 }
 
-// TransportConfig contains transport-specific configuration
+// TransportConfig contains transport-specific configuration. Packs list
+// transports in the order clients should try them.
 type TransportConfig struct {
 	Type        string            `json:"type"` // masque, xtls, parasite, ssh
 	Endpoints   []string          `json:"endpoints"`
 	Fingerprint string            `json:"fingerprint"` // TLS fingerprint to mimic
 	Options     map[string]string `json:"options"`
+	Priority    int               `json:"priority"` // Higher first, as configured for the client's region
+	Weight      int               `json:"weight"`   // Share of attempts among transports of the same priority
+
+	pool      []string // Endpoints allocated per device in place of Endpoints
+	perClient int      // How many of pool each device is given
 }
 
 // DiscoveryConfig contains discovery channel configuration
 type DiscoveryConfig struct {
-	Channels    []string `json:"channels"` // gps, fm_rds, dtv, plc, etc.
-	ScanInterval int     `json:"scan_interval"` // seconds
-	BatteryAware bool    `json:"battery_aware"`
+	Channels     []string `json:"channels"`      // Names in AllowedDiscoveryChannels
+	ScanInterval int      `json:"scan_interval"` // seconds
+	BatteryAware bool     `json:"battery_aware"`
 }
 
 // ConfigService handles config pack generation and signing
 type ConfigService struct {
-	db          *db.Database
-	privateKey  ed25519.PrivateKey
-	publicKey   ed25519.PublicKey
+	db        *db.Database
+	keys      *keyring
+	p256      *SigningKey   // Signs packs requested in ecdsa-p256; nil when not configured
+	sealer    *crypt.Sealer // Encrypts rotated signing keys; nil disables rotation
+	keyGrace  time.Duration // How long a replaced signing key still verifies
+	diversity DiversityLimits
+	rollouts  *geo.GeoBalancer
+	messages  *i18n.Catalog
+	notices   []string // Message keys included in every pack
+	secrets   *gateway.SecretStore
+	bases     *packBaseCache // Signed 2.0 pack bases
+	packTTL   time.Duration  // How long a pack is valid after it is issued
+	clock     clock.Clock
+
+	// candidates are recent gateway candidates by region and honeypot
+	// decision, reused by packs until they expire
+	candidates *gatewayCandidateCache
+
+	// latency is the last gateway latency read from discovery logs
+	latency *gatewayLatencyCache
+
+	// subsets assigns devices their subset of a region's gateways
+	subsets GatewaySubsets
+
+	// served remembers the gateways of served packs by content hash, to
+	// tell clients what changed since their pack
+	served *servedPacks
+
+	// versions are the stable config version and any candidate being
+	// rolled out
+	versions ConfigVersions
+
+	// honeypotRatio is the share of a pack's places given to honeypots
+	// when a device gets them
+	honeypotRatio float64
+
+	// detail decides how much of the real gateways a device's pack reveals
+	detail GatewayDetailPolicy
+
+	// clientVersions are the client versions each platform accepts
+	clientVersions map[string]VersionRequirement
+
+	// revocations is the last signed revocation list
+	revocations revocationCache
+
+	// lastKillSwitches are the kill switches last read, applied while they
+	// cannot be read
+	lastKillSwitches killSwitchCache
+
+	// selection tunes gateway selection; it can be replaced while serving
+	selectionMu sync.RWMutex
+	selection   SelectionConfig
+
+	// federationMaxAge is how fresh a peer's announcement must be for its
+	// gateways to be included; 0 leaves federated gateways out
+	federationMaxAge time.Duration
+
+	// endpointEpoch is how long a device keeps its allocated pool
+	// endpoints; 0 serves every device the shared endpoints
+	endpointEpoch time.Duration
+
+	// allocationKey keys the hashes that allocate pool endpoints and gateway
+	// subsets to devices
+	allocationKey []byte
+
+	// maxMirrors is the most rendezvous mirrors a pack lists; 0 lists none
+	maxMirrors int
+}
+
+// DiversityLimits caps how many gateways from one operator or one subnet can
+// appear in a single pack, so a Sybil operator cannot fill a client's whole list.
+type DiversityLimits struct {
+	MaxPerOperator int // 0 disables the cap
+	MaxPerSubnet   int // 0 disables the cap
 }
 
 // NewConfigService creates a new config service
 func NewConfigService(database *db.Database) (*ConfigService, error) {
-	privateKey, publicKey, err := loadSigningKeys()
+	signer, err := loadSigner()
+	if err != nil {
+		return nil, err
+	}
+	previousKeys, err := loadPreviousSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	p256, err := loadP256SigningKey()
+	if err != nil {
+		return nil, err
+	}
+	sealer, err := crypt.LoadSealerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if _, remote := signer.(*RemoteSigner); remote {
+		// Rotated keys would be generated and signed with here, outside the
+		// remote signer
+		sealer = nil
+	}
+	messages := i18n.Default()
+	notices, err := loadPackNotices(messages)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := loadConfigVersions()
+	if err != nil {
+		return nil, err
+	}
+	detail, err := loadGatewayDetailPolicy()
+	if err != nil {
+		return nil, err
+	}
+	clientVersions, err := loadVersionRequirements()
+	if err != nil {
+		return nil, err
+	}
+	selection, err := loadSelectionConfig()
 	if err != nil {
 		return nil, err
 	}
 
+	packTTL := envDuration("LUMENLINK_PACK_TTL", DefaultPackTTL)
 	return &ConfigService{
-		db:         database,
-		privateKey: privateKey,
-		publicKey:  publicKey,
+		db:       database,
+		keys:     newKeyring(&SigningKey{ID: signer.KeyID(), PublicKey: signer.PublicKey(), Signer: signer}, previousKeys),
+		p256:     p256,
+		sealer:   sealer,
+		keyGrace: envDuration("LUMENLINK_CONFIG_SIGNING_KEY_GRACE", DefaultSigningKeyGrace),
+		diversity: DiversityLimits{
+			MaxPerOperator: envInt("LUMENLINK_PACK_MAX_GATEWAYS_PER_OPERATOR", 2),
+			MaxPerSubnet:   envInt("LUMENLINK_PACK_MAX_GATEWAYS_PER_SUBNET", 2),
+		},
+		rollouts: geo.NewBalancer(database),
+		messages: messages,
+		notices:  notices,
+		bases:    newPackBaseCache(envDuration("LUMENLINK_PACK_BASE_TTL", DefaultPackBaseTTL)),
+		packTTL:  packTTL,
+		clock:    clock.Real{},
+
+		candidates:    newGatewayCandidateCache(envDurationOrZero("LUMENLINK_PACK_GATEWAY_CACHE_TTL", DefaultGatewayCacheTTL)),
+		latency:       newGatewayLatencyCache(envDurationOrZero("LUMENLINK_GATEWAY_LATENCY_TTL", DefaultGatewayLatencyTTL)),
+		subsets:       loadGatewaySubsets(),
+		served:        newServedPacks(packTTL),
+		versions:      versions,
+		honeypotRatio: loadHoneypotRatio(),
+		detail:        detail,
+
+		clientVersions: clientVersions,
+		selection:      selection,
+		endpointEpoch:  envDurationOrZero("LUMENLINK_ENDPOINT_EPOCH", DefaultEndpointEpoch),
+		allocationKey:  loadAllocationKey(),
+		maxMirrors:     envInt("LUMENLINK_PACK_MAX_MIRRORS", DefaultMaxPackMirrors),
 	}, nil
 }
 
+// SetClock replaces the time source for pack timestamps, cached pack bases,
+// gateway candidates and latency, served packs and rollout schedules; it is
+// intended for tests.
+func (s *ConfigService) SetClock(c clock.Clock) {
+	s.clock = c
+	s.bases.clock = c
+	s.candidates.clock = c
+	s.latency.clock = c
+	s.served.clock = c
+	s.rollouts.SetClock(c)
+}
+
+// loadSigningKeys reads the config signing key pair. The private key comes
+// from LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY or from the file named by
+// LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY_FILE, both base64. A public key in
+// LUMENLINK_CONFIG_SIGNING_PUBLIC_KEY must be the private key's, since
+// clients pin it; the pair must also sign and verify a probe message.
 func loadSigningKeys() (ed25519.PrivateKey, ed25519.PublicKey, error) {
 	privateKeyB64 := os.Getenv("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY")
+	privateKeyFile := strings.TrimSpace(os.Getenv("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY_FILE"))
 	publicKeyB64 := os.Getenv("LUMENLINK_CONFIG_SIGNING_PUBLIC_KEY")
 	allowEphemeral := os.Getenv("LUMENLINK_ALLOW_EPHEMERAL_SIGNING_KEY")
 
+	if privateKeyFile != "" {
+		if privateKeyB64 != "" {
+			return nil, nil, fmt.Errorf("set only one of LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY and LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY_FILE")
+		}
+		data, err := os.ReadFile(privateKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read config signing private key file: %w", err)
+		}
+		privateKeyB64 = strings.TrimSpace(string(data))
+	}
+
 	if privateKeyB64 == "" {
 		if allowEphemeral == "1" || allowEphemeral == "true" || allowEphemeral == "TRUE" {
 			publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
@@ -105,7 +317,7 @@ func loadSigningKeys() (ed25519.PrivateKey, ed25519.PublicKey, error) {
 	}
 
 	privateKey := ed25519.PrivateKey(privateKeyBytes)
-	var publicKey ed25519.PublicKey
+	publicKey := privateKey.Public().(ed25519.PublicKey)
 	if publicKeyB64 != "" {
 		publicKeyBytes, err := base64.StdEncoding.DecodeString(publicKeyB64)
 		if err != nil {
@@ -114,97 +326,495 @@ func loadSigningKeys() (ed25519.PrivateKey, ed25519.PublicKey, error) {
 		if len(publicKeyBytes) != ed25519.PublicKeySize {
 			return nil, nil, fmt.Errorf("invalid config signing public key length")
 		}
-		publicKey = ed25519.PublicKey(publicKeyBytes)
-	} else {
-		publicKey = privateKey.Public().(ed25519.PublicKey)
+		if !publicKey.Equal(ed25519.PublicKey(publicKeyBytes)) {
+			return nil, nil, fmt.Errorf("config signing public key %s does not match the private key's %s; packs would not verify",
+				KeyID(publicKeyBytes), KeyID(publicKey))
+		}
+	}
+	if err := checkSigningKeys(privateKey, publicKey); err != nil {
+		return nil, nil, err
 	}
 
 	return privateKey, publicKey, nil
 }
 
-// GenerateConfigPack generates a signed config pack for a client
+// signingProbe is signed at startup to check the signing key pair
+var signingProbe = []byte("lumenlink-signing-probe")
+
+// checkSigningKeys signs a probe message and verifies it. An ed25519 private
+// key carries its public key in its second half; a key whose halves do not
+// belong together signs nothing that verifies.
+func checkSigningKeys(privateKey ed25519.PrivateKey, publicKey ed25519.PublicKey) error {
+	if !ed25519.Verify(publicKey, signingProbe, ed25519.Sign(privateKey, signingProbe)) {
+		return fmt.Errorf("config signing private key %s failed its self-test: its signatures do not verify", KeyID(publicKey))
+	}
+	return nil
+}
+
+// DefaultHoneypotRatio is the share of a pack's places given to honeypots
+// when a device gets them
+const DefaultHoneypotRatio = 0.6
+
+// loadHoneypotRatio reads LUMENLINK_PACK_HONEYPOT_RATIO, a share above 0 and
+// at most 1; 1 replaces real gateways with honeypots entirely.
+func loadHoneypotRatio() float64 {
+	value := strings.TrimSpace(os.Getenv("LUMENLINK_PACK_HONEYPOT_RATIO"))
+	if value == "" {
+		return DefaultHoneypotRatio
+	}
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || ratio <= 0 || ratio > 1 {
+		log.Printf("LUMENLINK_PACK_HONEYPOT_RATIO %q is not a share above 0 and at most 1, using %v", value, DefaultHoneypotRatio)
+		return DefaultHoneypotRatio
+	}
+	return ratio
+}
+
+// SetGatewaySecrets attaches the per-gateway secret store; without one packs
+// carry no gateway secrets.
+func (s *ConfigService) SetGatewaySecrets(store *gateway.SecretStore) {
+	s.secrets = store
+}
+
+// GenerateConfigPack generates a signed config pack for a client. region is
+// empty when the client's region is unknown; the launch policy decides what
+// such clients get. country is the client's ISO 3166-1 alpha-2 country, or
+// empty when unknown, and selects transport policies. Notices are resolved in
+// locale (a BCP-47 tag, or empty for the default language). A client below
+// its platform's minimum version gets only upgrade instructions. The build's
+// phases are timed in timer, which may be nil. A pack whose content hash
+// has been revoked is not served: it fails with ErrPackRevoked until the
+// content changes.
 func (s *ConfigService) GenerateConfigPack(
 	ctx context.Context,
 	clientID string,
 	region string,
+	country string,
+	locale string,
+	client ClientInfo,
+	packVersion string,
+	attestationResult *AttestationResult,
+	timer *metrics.PhaseTimer,
+) (*SignedConfigPack, error) {
+	pack, err := s.buildConfigPack(ctx, clientID, region, country, locale, client, packVersion, attestationResult, nil, timer)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPackRevoked(ctx, pack); err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+// PreviewConfigPack returns the pack GenerateConfigPack would build for the
+// same inputs, with a trace of the policy decisions behind it. Like
+// GenerateConfigPack it has no side effects; callers must not count previews
+// as issued packs.
+func (s *ConfigService) PreviewConfigPack(
+	ctx context.Context,
+	clientID string,
+	region string,
+	country string,
+	locale string,
+	client ClientInfo,
+	packVersion string,
+	attestationResult *AttestationResult,
+) (*SignedConfigPack, *DecisionTrace, error) {
+	trace := &DecisionTrace{Steps: []TraceStep{}}
+	pack, err := s.buildConfigPack(ctx, clientID, region, country, locale, client, packVersion, attestationResult, trace, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pack, trace, nil
+}
+
+// PreviewUnsignedConfigPack is PreviewConfigPack without signing: the pack
+// carries its validity but no version, key or signature, so previews need
+// not reach the signer.
+func (s *ConfigService) PreviewUnsignedConfigPack(
+	ctx context.Context,
+	clientID string,
+	region string,
+	country string,
+	locale string,
+	client ClientInfo,
+	attestationResult *AttestationResult,
+) (*SignedConfigPack, *DecisionTrace, error) {
+	trace := &DecisionTrace{Steps: []TraceStep{}}
+	pack, err := s.assembleConfigPack(ctx, clientID, region, country, locale, client, attestationResult, trace, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.setValidity(pack)
+	return pack, trace, nil
+}
+
+// buildConfigPack builds and signs a pack, recording decisions in trace and
+// phase durations in timer when they are non-nil.
+func (s *ConfigService) buildConfigPack(
+	ctx context.Context,
+	clientID string,
+	region string,
+	country string,
+	locale string,
+	client ClientInfo,
+	packVersion string,
+	attestationResult *AttestationResult,
+	trace *DecisionTrace,
+	timer *metrics.PhaseTimer,
+) (*SignedConfigPack, error) {
+	pack, err := s.assembleConfigPack(ctx, clientID, region, country, locale, client, attestationResult, trace, timer)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sign the config pack in the negotiated format
+	endSigning := timer.Start(metrics.PhaseSigning)
+	err = s.generatePack(pack, packVersion, client.SignatureAlg)
+	endSigning()
+	if err != nil {
+		return nil, err
+	}
+
+	return pack, nil
+}
+
+// assembleConfigPack decides a pack's content for a client, leaving it
+// unsigned
+func (s *ConfigService) assembleConfigPack(
+	ctx context.Context,
+	clientID string,
+	region string,
+	country string,
+	locale string,
+	client ClientInfo,
 	attestationResult *AttestationResult,
+	trace *DecisionTrace,
+	timer *metrics.PhaseTimer,
 ) (*SignedConfigPack, error) {
-	// Get gateways based on geo-load balancing
-	gateways, err := s.selectGateways(ctx, region, attestationResult)
+	trace.Record("attestation_tier", attestationTier(attestationResult), attestationRisk(attestationResult))
+	requirement, versionStatus, versioned := s.clientVersion(client, trace)
+	if versionStatus == ClientVersionUnsupported {
+		pack := s.upgradeConfigPack(clientID, region, locale, client, requirement, trace)
+		pack.KillSwitches = s.killSwitches(ctx, trace)
+		pack.Mirrors = s.rendezvousMirrors(ctx, region, trace)
+		return pack, nil
+	}
+	endRegion := timer.Start(metrics.PhaseRegionResolution)
+	region, open := s.launchRegion(ctx, region, trace)
+	endRegion()
+
+	// Get gateways based on geo-load balancing; closed regions and revoked
+	// devices get honeypots only
+	var gateways []GatewayInfo
+	var err error
+	endSelection := timer.Start(metrics.PhaseGatewaySelection)
+	selection := s.SelectionConfig()
+	revoked := s.deviceRevoked(ctx, clientID, trace)
+	if open && !revoked {
+		gateways, err = s.selectGateways(ctx, clientID, region, client, attestationResult, selection, trace)
+	} else {
+		gateways, err = s.selectHoneypots(ctx, selection, trace)
+	}
+	endSelection()
 	if err != nil {
 		return nil, err
 	}
 
-	// Get transport configurations
-	transports := s.getTransportConfigs()
+	endPolicies := timer.Start(metrics.PhasePolicyApplication)
+	if open && !revoked && trustedForSecrets(attestationResult) {
+		s.attachGatewaySecrets(ctx, gateways, trace)
+	}
+
+	// The device's rollout cohort picks the stable or candidate version
+	version := s.configVersion(ctx, clientID, region, trace)
+
+	// Get transport configurations, then apply the client country's overrides
+	var transports []TransportConfig
+	if version.Transports != nil {
+		transports = version.transportConfigs()
+	} else {
+		transports = s.getTransportConfigs(ctx, region, trace)
+	}
+	allocations := s.allocateEndpoints(clientID, attestationResult, transports, trace)
+	experiments := s.assignExperiments(ctx, clientID, region, client.Platform, trace)
+	transports = experimentTransports(experiments, transports)
+	gateways, transports = s.applyTransportPolicies(ctx, country, gateways, transports, trace)
+	killSwitches := s.killSwitches(ctx, trace)
+	transports = applyKillSwitches(transports, killSwitches, trace)
+
+	// Revoked devices are not told where else to find the rendezvous
+	mirrors := []string{}
+	if !revoked {
+		mirrors = s.rendezvousMirrors(ctx, region, trace)
+	}
 
 	// Get discovery configuration
-	discovery := s.getDiscoveryConfig()
+	discovery, features := s.getDiscoveryConfig(ctx, clientID, region, version, trace)
+	experimentDiscovery(experiments, &discovery)
 
 	// Create config pack
 	pack := &SignedConfigPack{
-		Version:    "1.0",
-		Timestamp:  time.Now().Unix(),
-		Gateways:   gateways,
-		Transports: transports,
-		Discovery:  discovery,
+		Timestamp:    s.clock.Now().Unix(),
+		Gateways:     gateways,
+		Transports:   transports,
+		Discovery:    discovery,
+		KillSwitches: killSwitches,
+		Mirrors:      mirrors,
 		Metadata: map[string]interface{}{
-			"client_id": clientID,
-			"region":    region,
+			"client_id":      clientID,
+			"region":         region,
+			"features":       features,
+			"config_version": version.Version,
 		},
-		PublicKey: s.publicKey,
 	}
-
-	// Sign the config pack
-	signature, err := s.signConfigPack(pack)
-	if err != nil {
-		return nil, err
+	if len(experiments) > 0 {
+		pack.Metadata["experiments"] = experimentNames(experiments)
+	}
+	if len(allocations) > 0 {
+		pack.allocationEpoch, pack.allocations = s.EndpointEpoch(), allocations
+	}
+	noticeKeys := s.notices
+	if !open {
+		pack.Metadata["region_status"] = RegionStatusClosed
+		noticeKeys = append([]string{NoticeRegionNotAvailable}, s.notices...)
+	}
+	var clientVersion string
+	if versioned {
+		setVersionMetadata(pack, requirement, versionStatus)
+		if versionStatus == ClientVersionOutdated && !slices.Contains(noticeKeys, NoticeUpdateAvailable) {
+			noticeKeys = append(noticeKeys[:len(noticeKeys):len(noticeKeys)], NoticeUpdateAvailable)
+		}
+		clientVersion = client.Platform + ":" + versionStatus
+	}
+	if notices := s.resolveNotices(locale, noticeKeys, trace); len(notices) > 0 {
+		pack.Metadata["notices"] = notices
+	}
+	// Previews always show a freshly built pack, and revoked devices get
+	// their own rather than sharing a base with other clients
+	if trace == nil && !revoked {
+		pack.baseKey = packBaseKey(region, open, attestationResult, s.detail.detail(attestationResult),
+			clientVersion, country, locale, version.Version, features, gateways, allocations, experiments, killSwitches, mirrors)
 	}
-	pack.Signature = signature
+	endPolicies()
 
 	return pack, nil
 }
 
-// selectGateways selects gateways based on geo-load balancing and honeypot logic
+// selectGateways selects gateways for a device from its subset of the
+// region's gateways, by load and honeypot logic, revealing as much of them
+// as its attestation earns
 func (s *ConfigService) selectGateways(
 	ctx context.Context,
+	clientID string,
 	region string,
+	client ClientInfo,
 	attestationResult *AttestationResult,
+	selection SelectionConfig,
+	trace *DecisionTrace,
 ) ([]GatewayInfo, error) {
-	// Query gateways from database
-	gateways, err := s.db.GetGatewaysByRegion(ctx, region)
+	withHoneypots := includeHoneypots(attestationResult)
+	candidates, err := s.gatewayCandidates(ctx, region, withHoneypots, selection, trace)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates.borrowed) > 0 && trace == nil {
+		metrics.RegionFallback.WithLabelValues(region).Inc()
+	}
+
+	// Devices only see their own subset of the region's gateways
+	size := s.subsets.size(attestationResult, selection.MaxGateways)
+	gateways := candidates.gateways
+	if s.subsets.Epoch > 0 {
+		epoch := s.subsets.epoch(s.clock.Now())
+		var bucket, buckets int
+		kind, member := subsetMember(clientID, client, attestationResult)
+		gateways, bucket, buckets = s.gatewaySubset(gateways, kind, member, region, epoch, size)
+		trace.Record("gateway_subset", "assigned", map[string]interface{}{
+			"by":      kind,
+			"epoch":   epoch,
+			"bucket":  bucket,
+			"buckets": buckets,
+			"size":    size,
+		})
+	}
+
+	// Overloaded gateways are left out after subsetting, so load changes do
+	// not reshuffle which gateways devices are assigned. Honeypots are held
+	// to the same cap, or their load would give them away.
+	honeypots := candidates.honeypots
+	if selection.MaxLoad > 0 {
+		available := len(gateways) + len(honeypots)
+		gateways = s.underLoadCap(gateways, selection.MaxLoad)
+		honeypots = s.underLoadCap(honeypots, selection.MaxLoad)
+		trace.Record("load_cap", "applied", map[string]interface{}{
+			"max_load": selection.MaxLoad,
+			"excluded": available - len(gateways) - len(honeypots),
+		})
+	}
+
+	// Measured latency can count alongside load in which gateways are
+	// selected and how they are ordered
+	latencies := s.gatewayLatencies(ctx, trace)
+	if selection.LatencyWeight > 0 {
+		gateways = s.sortByLatency(gateways, selection.LatencyWeight, latencies)
+		honeypots = s.sortByLatency(honeypots, selection.LatencyWeight, latencies)
+		trace.Record("latency_weight", "applied", map[string]interface{}{
+			"weight":             selection.LatencyWeight,
+			"gateways_with_data": len(latencies),
+		})
+	}
+
+	if withHoneypots {
+		gateways = s.mixHoneypots(honeypots, gateways, selection.MaxGateways)
+		if selection.LatencyWeight > 0 {
+			// Honeypot packs are ordered like the rest
+			gateways = s.sortByLatency(gateways, selection.LatencyWeight, latencies)
+		}
+	} else {
+		// Select the least loaded, keeping operators and subnets diverse
+		gateways = applyDiversityLimits(gateways, size, s.diversity)
+	}
+
+	if trace != nil {
+		traceGatewaySelection(trace, gateways, len(candidates.gateways)+len(candidates.honeypots), size,
+			s.diversity, withHoneypots, len(candidates.honeypots))
+	}
+
+	detail := s.detail.detail(attestationResult)
+	infos := s.gatewayInfos(gateways)
+	setGatewayLatency(infos, latencies)
+	infos = s.detail.apply(detail, infos)
+	trace.Record("gateway_detail", detail, map[string]interface{}{
+		"selected": len(gateways),
+		"listed":   len(infos),
+	})
+	return infos, nil
+}
+
+// gatewayCandidates loads the gateways a region's packs are selected from.
+// Packs reuse recent candidates for the same region, honeypot decision and
+// selection settings; previews always load afresh so the trace can explain
+// them.
+func (s *ConfigService) gatewayCandidates(
+	ctx context.Context,
+	region string,
+	withHoneypots bool,
+	selection SelectionConfig,
+	trace *DecisionTrace,
+) (*gatewayCandidates, error) {
+	key := candidatesKey(region, withHoneypots, selection)
+	if trace == nil {
+		if candidates := s.candidates.get(key); candidates != nil {
+			return candidates, nil
+		}
+	}
+
+	// Query gateways from database, borrowing from nearby regions when the
+	// region has too few
+	gateways, borrowed, err := s.regionGateways(ctx, region, selection, trace)
 	if err != nil {
 		return nil, err
 	}
+	// Gateways from federation peers compete under the same load order and caps
+	gateways = append(gateways, s.federatedGateways(ctx, region, trace)...)
+	// Prefer lower load, from current and max users
+	s.sortByLoad(gateways)
+	candidates := &gatewayCandidates{gateways: gateways, borrowed: borrowed}
 
-	// Apply honeypot logic
-	// If attestation fails or is suspicious, include honeypots
-	if attestationResult == nil || !attestationResult.IsValid {
-		// Add honeypot gateways
+	if withHoneypots {
 		honeypots, err := s.db.GetHoneypotGateways(ctx, region)
 		if err != nil {
-			return nil, err
-		}
-		if len(honeypots) > 0 {
-			gateways = append(honeypots, gateways...)
+			return nil, fmt.Errorf("failed to load honeypot gateways for region %s: %w", region, err)
 		}
+		s.sortByLoad(honeypots)
+		candidates.honeypots = honeypots
+	}
+
+	if trace == nil {
+		s.candidates.put(key, candidates)
+	}
+	return candidates, nil
+}
+
+// includeHoneypots reports whether a device's pack mixes in honeypots. The
+// honeypot policy has decided, and a device it has not judged gets them. A
+// strong attestation already clears the policy's defaults, so a strongly
+// attested device given honeypots was caught by its history or risk.
+func includeHoneypots(attestationResult *AttestationResult) bool {
+	return attestationResult == nil || attestationResult.Honeypots
+}
+
+// mixHoneypots fills a pack of maxGateways for a device given honeypots. The
+// honeypot ratio of its places go to the least loaded honeypots and the rest
+// to real gateways, keeping operators and subnets diverse; honeypots take any
+// places real gateways cannot fill. Both lists must be sorted by load, and
+// the result is too, so a honeypot's position does not give it away.
+func (s *ConfigService) mixHoneypots(honeypots, gateways []*db.Gateway, maxGateways int) []*db.Gateway {
+	places := int(math.Round(s.honeypotRatio * float64(maxGateways)))
+	if places > len(honeypots) {
+		places = len(honeypots)
 	}
+	selected := applyDiversityLimits(gateways, maxGateways-places, s.diversity)
+	if spare := maxGateways - places - len(selected); spare > 0 {
+		places = min(places+spare, len(honeypots))
+	}
+	selected = append(selected, honeypots[:places]...)
+	s.sortByLoad(selected)
+	return selected
+}
 
-	// Calculate load based on current users and max users
-	// Sort by load (prefer lower load)
-	sort.Slice(gateways, func(i, j int) bool {
-		loadI := s.calculateLoad(gateways[i])
-		loadJ := s.calculateLoad(gateways[j])
-		return loadI < loadJ
+// sortByLoad orders gateways least loaded first
+func (s *ConfigService) sortByLoad(gateways []*db.Gateway) {
+	sort.SliceStable(gateways, func(i, j int) bool {
+		return s.calculateLoad(gateways[i]) < s.calculateLoad(gateways[j])
 	})
+}
 
-	// Select top 3-5 gateways
-	maxGateways := 5
-	if len(gateways) > maxGateways {
-		gateways = gateways[:maxGateways]
+// deviceRevoked reports whether a device is on the revocation list. A failed
+// lookup is logged and the device served as usual. Only issued packs count
+// as hits.
+func (s *ConfigService) deviceRevoked(ctx context.Context, clientID string, trace *DecisionTrace) bool {
+	if clientID == "" {
+		return false
+	}
+	revoked, err := s.db.IsDeviceRevoked(ctx, clientID)
+	if err != nil {
+		log.Printf("device revocation check failed, serving device as usual: %v", err)
+		return false
+	}
+	if revoked {
+		trace.Record("device_revocation", "revoked", nil)
+		if trace == nil {
+			metrics.RevokedDeviceHits.WithLabelValues("config").Inc()
+		}
+	}
+	return revoked
+}
+
+// selectHoneypots fills a pack for a closed region with honeypots from any
+// region, least loaded first, under the same load cap as real gateways.
+func (s *ConfigService) selectHoneypots(ctx context.Context, selection SelectionConfig, trace *DecisionTrace) ([]GatewayInfo, error) {
+	honeypots, err := s.db.GetHoneypotGateways(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load honeypot gateways: %w", err)
+	}
+	candidates := len(honeypots)
+	honeypots = s.underLoadCap(honeypots, selection.MaxLoad)
+	if len(honeypots) > selection.MaxGateways {
+		honeypots = honeypots[:selection.MaxGateways]
 	}
+	trace.Record("gateway_selection", "honeypots_only", map[string]interface{}{
+		"candidates": candidates,
+		"selected":   len(honeypots),
+	})
+	infos := s.gatewayInfos(honeypots)
+	setGatewayLatency(infos, s.gatewayLatencies(ctx, trace))
+	return infos, nil
+}
 
-	// Convert to GatewayInfo
+// gatewayInfos converts selected gateways to their pack entries.
+func (s *ConfigService) gatewayInfos(gateways []*db.Gateway) []GatewayInfo {
 	result := make([]GatewayInfo, len(gateways))
 	for i, gw := range gateways {
 		result[i] = GatewayInfo{
@@ -216,22 +826,153 @@ func (s *ConfigService) selectGateways(
 			Load:       s.calculateLoad(gw),
 			IsHoneypot: gw.IsHoneypot,
 			PublicKey:  gw.PublicKey,
+			Origin:     gw.Origin,
+		}
+	}
+
+	return result
+}
+
+// trustedForSecrets reports whether a device may receive gateway secrets:
+// only attested devices meeting device or strong integrity do.
+func trustedForSecrets(result *AttestationResult) bool {
+	tier := attestationTier(result)
+	return tier == "strong" || tier == "device"
+}
+
+// attachGatewaySecrets adds each gateway's active secrets to its pack entry.
+// A failed lookup leaves the pack without secrets rather than failing it.
+// Previews record how many gateways have secrets but never include them.
+func (s *ConfigService) attachGatewaySecrets(ctx context.Context, gateways []GatewayInfo, trace *DecisionTrace) {
+	if s.secrets == nil || len(gateways) == 0 {
+		return
+	}
+	ids := make([]string, len(gateways))
+	for i, gw := range gateways {
+		ids[i] = gw.ID
+	}
+	secrets, err := s.secrets.Active(ctx, ids, s.clock.Now())
+	if err != nil {
+		log.Printf("gateway secrets unavailable, building pack without them: %v", err)
+		trace.Record("gateway_secrets", "lookup_failed", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	withSecrets := 0
+	for i := range gateways {
+		active := secrets[gateways[i].ID]
+		if len(active) == 0 {
+			continue
+		}
+		withSecrets++
+		if trace != nil {
+			continue
+		}
+		for _, secret := range active {
+			gateways[i].Secrets = append(gateways[i].Secrets, secret.Value)
 		}
 	}
+	trace.Record("gateway_secrets", "withheld_in_preview", map[string]interface{}{"gateways_with_secrets": withSecrets})
+}
+
+// applyDiversityLimits picks up to limit gateways in order, skipping any that would
+// exceed the per-operator or per-subnet cap. Honeypots are ours and are exempt.
+func applyDiversityLimits(gateways []*db.Gateway, limit int, limits DiversityLimits) []*db.Gateway {
+	perOperator := map[string]int{}
+	perSubnet := map[string]int{}
+
+	selected := make([]*db.Gateway, 0, limit)
+	for _, gw := range gateways {
+		if len(selected) >= limit {
+			break
+		}
+		if gw.IsHoneypot {
+			selected = append(selected, gw)
+			continue
+		}
 
-	return result, nil
+		if limits.MaxPerOperator > 0 && gw.OperatorID != "" &&
+			perOperator[gw.OperatorID] >= limits.MaxPerOperator {
+			continue
+		}
+		subnet, err := gateway.SubnetOf(gw.IPAddress)
+		if err == nil && limits.MaxPerSubnet > 0 && perSubnet[subnet] >= limits.MaxPerSubnet {
+			continue
+		}
+
+		if gw.OperatorID != "" {
+			perOperator[gw.OperatorID]++
+		}
+		if err == nil {
+			perSubnet[subnet]++
+		}
+		selected = append(selected, gw)
+	}
+	return selected
 }
 
 // calculateLoad calculates gateway load (0.0-1.0)
 func (s *ConfigService) calculateLoad(gw *db.Gateway) float64 {
+	if gw.Origin != "" {
+		return gw.Load // As announced by the peer
+	}
 	if gw.MaxUsers == nil || *gw.MaxUsers == 0 {
 		return 0.5 // Default load if max users not set
 	}
 	return float64(gw.CurrentUsers) / float64(*gw.MaxUsers)
 }
 
-// getTransportConfigs returns transport configurations
-func (s *ConfigService) getTransportConfigs() []TransportConfig {
+// getTransportConfigs returns the transports advertised in region, highest
+// priority first, from the transports table through the policy cache. A
+// region's own rows override the global ones, priority and weight included.
+// Without a database, with no rows for the region, or when the lookup fails,
+// the built-in defaults are served so clients always have something to
+// connect with.
+func (s *ConfigService) getTransportConfigs(ctx context.Context, region string, trace *DecisionTrace) []TransportConfig {
+	if s.db == nil {
+		return defaultTransportConfigs()
+	}
+	rows, err := s.db.GetTransportConfigs(ctx, region)
+	if err != nil {
+		log.Printf("transports unavailable, serving built-in defaults: %v", err)
+		trace.Record("transports", "lookup_failed", map[string]interface{}{"error": err.Error()})
+		return defaultTransportConfigs()
+	}
+	if len(rows) == 0 {
+		trace.Record("transports", "defaults", map[string]interface{}{"region": region})
+		return defaultTransportConfigs()
+	}
+
+	transports := make([]TransportConfig, 0, len(rows))
+	for _, row := range rows {
+		// Rows are shared with the cache, so packs get their own copies
+		options := make(map[string]string, len(row.Options))
+		for k, v := range row.Options {
+			options[k] = v
+		}
+		transport := TransportConfig{
+			Type:        row.Type,
+			Endpoints:   append([]string{}, row.Endpoints...),
+			Fingerprint: row.Fingerprint,
+			Options:     options,
+			Priority:    row.Priority,
+			Weight:      row.Weight,
+		}
+		if len(row.EndpointPool) > 0 {
+			transport.pool, transport.perClient = row.EndpointPool, row.EndpointsPerClient
+		}
+		transports = append(transports, transport)
+	}
+	sort.SliceStable(transports, func(i, j int) bool {
+		return transports[i].Priority > transports[j].Priority
+	})
+	trace.Record("transports", "database", map[string]interface{}{"region": region, "count": len(transports)})
+	return transports
+}
+
+// defaultTransportConfigs returns the built-in transports, served until the
+// transports table has rows
+func defaultTransportConfigs() []TransportConfig {
 	return []TransportConfig{
 		{
 			Type:        "masque",
@@ -240,6 +981,8 @@ func (s *ConfigService) getTransportConfigs() []TransportConfig {
 			Options: map[string]string{
 				"quic_version": "1",
 			},
+			Priority: 40,
+			Weight:   1,
 		},
 		{
 			Type:        "xtls",
@@ -248,6 +991,8 @@ func (s *ConfigService) getTransportConfigs() []TransportConfig {
 			Options: map[string]string{
 				"reality": "true",
 			},
+			Priority: 30,
+			Weight:   1,
 		},
 		{
 			Type:      "parasite",
@@ -255,6 +1000,8 @@ func (s *ConfigService) getTransportConfigs() []TransportConfig {
 			Options: map[string]string{
 				"header_encoding": "base64url",
 			},
+			Priority: 20,
+			Weight:   1,
 		},
 		{
 			Type:      "ssh",
@@ -262,49 +1009,169 @@ func (s *ConfigService) getTransportConfigs() []TransportConfig {
 			Options: map[string]string{
 				"obfuscated": "true",
 			},
+			Priority: 10,
+			Weight:   1,
 		},
 	}
 }
 
-// getDiscoveryConfig returns discovery channel configuration
-func (s *ConfigService) getDiscoveryConfig() DiscoveryConfig {
-	return DiscoveryConfig{
-		Channels:     []string{"gps", "fm_rds", "dtv", "plc", "gsm", "lte", "blockchain"},
-		ScanInterval: 300, // 5 minutes
-		BatteryAware: true,
+// discoveryFeatures are the named discovery feature rollouts, applied in order
+// on top of the base discovery config for devices in each feature's cohort.
+var discoveryFeatures = []struct {
+	Key   string
+	Apply func(*DiscoveryConfig)
+}{
+	{Key: "scan_interval_120", Apply: func(d *DiscoveryConfig) { d.ScanInterval = 120 }},
+}
+
+// getDiscoveryConfig returns discovery channel configuration for a device
+// on version, along with the feature keys that were applied to it
+func (s *ConfigService) getDiscoveryConfig(
+	ctx context.Context,
+	clientID, region string,
+	version *ConfigVersion,
+	trace *DecisionTrace,
+) (DiscoveryConfig, []string) {
+	var discovery DiscoveryConfig
+	if version != nil && version.Discovery != nil {
+		discovery = *version.Discovery
+		discovery.Channels = append([]string{}, version.Discovery.Channels...)
+	} else {
+		discovery = s.baseDiscoveryConfig(ctx, region, trace)
+	}
+
+	if s.rollouts == nil {
+		return discovery, []string{}
+	}
+
+	keys := make([]string, 0, len(discoveryFeatures))
+	for _, feature := range discoveryFeatures {
+		keys = append(keys, feature.Key)
+	}
+	cohorts, err := s.rollouts.FeatureCohorts(ctx, clientID, region, keys)
+	if err != nil {
+		// Fall back to the base config rather than failing the pack
+		trace.Record("rollout_cohort", "lookup_failed", map[string]interface{}{"error": err.Error()})
+		return discovery, []string{}
+	}
+
+	enabled := []string{}
+	for i, feature := range discoveryFeatures {
+		cohort := cohorts[i]
+		outcome := "not_in_cohort"
+		if cohort.InCohort {
+			outcome = "in_cohort"
+			feature.Apply(&discovery)
+			enabled = append(enabled, feature.Key)
+		}
+		trace.Record("rollout_cohort", outcome, map[string]interface{}{
+			"feature":    cohort.Key,
+			"percentage": cohort.Percentage,
+		})
 	}
+
+	return discovery, enabled
 }
 
-// signConfigPack signs a config pack
-func (s *ConfigService) signConfigPack(pack *SignedConfigPack) ([]byte, error) {
+// signConfigPack signs a config pack with key's signer
+func (s *ConfigService) signConfigPack(pack *SignedConfigPack, key *SigningKey) ([]byte, error) {
 	// Create a copy without signature for signing
 	packCopy := *pack
 	packCopy.Signature = nil
 
-	// Marshal to JSON
 	data, err := json.Marshal(packCopy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config pack: %w", err)
+	}
+	return key.Signer.Sign(data)
+}
+
+// signJSON signs the JSON encoding of a document whose signature field is
+// empty, as 1.0 packs are signed
+func signJSON(signer Signer, unsigned interface{}) ([]byte, error) {
+	data, err := json.Marshal(unsigned)
 	if err != nil {
 		return nil, err
 	}
+	return signer.Sign(data)
+}
 
-	// Sign with Ed25519
-	signature := ed25519.Sign(s.privateKey, data)
-	return signature, nil
+// verifyJSON reports whether signature is key's signature over the JSON
+// encoding of unsigned, a document with its signature field emptied
+func verifyJSON(key ed25519.PublicKey, unsigned interface{}, signature []byte) bool {
+	// ed25519.Verify panics on a malformed key
+	if len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(key, data, signature)
 }
 
-// VerifyConfigPack verifies a config pack signature
+// VerifyConfigPack verifies a config pack signature against the key it
+// names, which must be the current signing key, the P-256 key or a previous
+// one still in its grace period, in that key's algorithm, and that the pack
+// is within its validity period. Packs
+// without a key ID are looked up by their public key. Clients verify against
+// their pinned keys with VerifyPack and check IsExpired themselves.
 func (s *ConfigService) VerifyConfigPack(pack *SignedConfigPack) bool {
-	// Create a copy without signature for verification
-	packCopy := *pack
-	signature := packCopy.Signature
-	packCopy.Signature = nil
+	now := s.clock.Now()
+	if pack.ExpiresAt == 0 || pack.IsExpired(now) || now.Unix() < pack.NotBefore {
+		return false
+	}
+	keyID := pack.KeyID
+	if keyID == "" {
+		keyID = KeyID(pack.PublicKey)
+	}
+	key := s.knownKey(keyID, now)
+	if key == nil || !bytes.Equal(key.PublicKey, pack.PublicKey) ||
+		signatureAlg(key.Algorithm) != signatureAlg(pack.SignatureAlg) {
+		return false
+	}
+	return VerifyPack(pack, key.PublicKey)
+}
 
-	// Marshal to JSON
-	data, err := json.Marshal(packCopy)
+// IsExpired reports whether pack's validity period has ended at now. A pack
+// without an expiry never expires, so clients should treat it as stale.
+func (p *SignedConfigPack) IsExpired(now time.Time) bool {
+	return p.ExpiresAt != 0 && now.Unix() >= p.ExpiresAt
+}
+
+// SignAuditExport signs an audit export's head with the config signing key, so
+// exports verify against the same public key clients already pin.
+func (s *ConfigService) SignAuditExport(export *audit.Export) error {
+	key := s.signingKey()
+	signature, err := key.Signer.Sign(audit.ExportMessage(export.HeadSeq, export.HeadHash, export.ExportedAt))
 	if err != nil {
-		return false
+		return err
 	}
+	export.KeyID = key.ID
+	export.PublicKey = key.PublicKey
+	export.Signature = signature
+	return nil
+}
+
+// KeyID returns the short identifier for a signing public key: the first 8
+// bytes of its SHA-256, hex encoded. Clients report it when verification fails.
+func KeyID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+func envInt(key string, defaultValue int) int {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
 
-	// Verify signature
-	return ed25519.Verify(pack.PublicKey, data, signature)
+func envString(key, defaultValue string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return defaultValue
 }
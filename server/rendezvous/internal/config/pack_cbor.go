@@ -0,0 +1,74 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/ugorji/go/codec"
+)
+
+// cborHandle encodes packs in CBOR (RFC 8949). Fields are named by their
+// json tags, and maps decode with string keys so that a decoded 1.0 pack
+// encodes to the same JSON its signature covers.
+var cborHandle = func() *codec.CborHandle {
+	handle := &codec.CborHandle{}
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	handle.Canonical = true
+	return handle
+}()
+
+// EncodePackCBOR serializes a pack in CBOR, a compact alternative to JSON
+// that carries byte fields unencoded. The signatures are unchanged: a 1.0
+// pack's covers the pack's JSON, which verifiers rebuild from the decoded
+// fields, and a 2.0 pack carries its base as the JSON bytes that were signed.
+func EncodePackCBOR(pack *SignedConfigPack) ([]byte, error) {
+	if pack.Version != PackVersion2 || pack.base == nil {
+		return MarshalCBOR(signedConfigPackJSON(*pack))
+	}
+	return MarshalCBOR(pack.wireV2())
+}
+
+// DecodePackCBOR decodes a pack encoded by EncodePackCBOR. As with JSON,
+// verify it with VerifyPack before trusting it.
+func DecodePackCBOR(data []byte) (*SignedConfigPack, error) {
+	var probe struct {
+		Version string `json:"version"`
+	}
+	if err := UnmarshalCBOR(data, &probe); err != nil {
+		return nil, err
+	}
+	pack := &SignedConfigPack{}
+	if probe.Version != PackVersion2 {
+		if err := UnmarshalCBOR(data, (*signedConfigPackJSON)(pack)); err != nil {
+			return nil, err
+		}
+		return pack, nil
+	}
+
+	var wire packWireV2
+	if err := UnmarshalCBOR(data, &wire); err != nil {
+		return nil, err
+	}
+	if err := pack.setWireV2(&wire); err != nil {
+		return nil, err
+	}
+	return pack, nil
+}
+
+// MarshalCBOR encodes v in CBOR as packs are encoded
+func MarshalCBOR(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := codec.NewEncoder(&buf, cborHandle).Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to encode CBOR: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalCBOR decodes CBOR encoded by MarshalCBOR into v
+func UnmarshalCBOR(data []byte, v interface{}) error {
+	if err := codec.NewDecoderBytes(data, cborHandle).Decode(v); err != nil {
+		return fmt.Errorf("invalid CBOR: %w", err)
+	}
+	return nil
+}
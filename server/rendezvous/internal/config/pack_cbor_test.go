@@ -0,0 +1,114 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestPackCBOR_RoundTrip(t *testing.T) {
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	for _, version := range []string{PackVersion1, PackVersion2} {
+		t.Run(version, func(t *testing.T) {
+			pack := benchmarkPack(svc)
+			pack.Gateways[0].Secrets = [][]byte{[]byte("0123456789abcdef")}
+			pack.Metadata["features"] = []string{"scan_interval_120"}
+			pack.Metadata["notices"] = []map[string]string{{"key": "maintenance", "text": "Maintenance tonight"}}
+			if err := svc.generatePack(pack, version, ""); err != nil {
+				t.Fatalf("generatePack: %v", err)
+			}
+
+			encoded, err := EncodePackCBOR(pack)
+			if err != nil {
+				t.Fatalf("EncodePackCBOR: %v", err)
+			}
+			decoded, err := DecodePackCBOR(encoded)
+			if err != nil {
+				t.Fatalf("DecodePackCBOR: %v", err)
+			}
+			if !VerifyPack(decoded, svc.signingKey().PublicKey) {
+				t.Fatal("decoded pack does not verify")
+			}
+			want, _ := pack.ContentHash()
+			if got, _ := decoded.ContentHash(); got != want {
+				t.Errorf("content hash: got %s, want %s", got, want)
+			}
+			asJSON, _ := json.Marshal(pack)
+			if len(encoded) >= len(asJSON) {
+				t.Errorf("CBOR is %d bytes, JSON %d", len(encoded), len(asJSON))
+			}
+
+			// The signature still covers the content
+			decoded.Gateways[0].Port++
+			if version == PackVersion2 {
+				decoded.base.content.Gateways[0].Port++
+			}
+			if VerifyPack(decoded, svc.signingKey().PublicKey) {
+				t.Error("modified pack verifies")
+			}
+		})
+	}
+	if _, err := DecodePackCBOR([]byte{0xff, 0x00}); err == nil {
+		t.Error("DecodePackCBOR: expected an error for invalid CBOR")
+	}
+}
+
+// BenchmarkPackPayloadSize reports the size of a representative pack in each
+// format and content encoding, as bytes/pack
+func BenchmarkPackPayloadSize(b *testing.B) {
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		b.Fatalf("NewConfigService: %v", err)
+	}
+	formats := map[string]func(*SignedConfigPack) ([]byte, error){
+		PackFormatJSON: func(pack *SignedConfigPack) ([]byte, error) { return json.Marshal(pack) },
+		PackFormatJWS: func(pack *SignedConfigPack) ([]byte, error) {
+			token, err := svc.EncodePackJWS(pack)
+			return []byte(token), err
+		},
+		PackFormatCBOR: EncodePackCBOR,
+	}
+	encodings := map[string]func([]byte) []byte{
+		"identity": func(data []byte) []byte { return data },
+		"gzip": func(data []byte) []byte {
+			var buf bytes.Buffer
+			w := gzip.NewWriter(&buf)
+			w.Write(data)
+			w.Close()
+			return buf.Bytes()
+		},
+		"zstd": func(data []byte) []byte {
+			w, _ := zstd.NewWriter(nil)
+			defer w.Close()
+			return w.EncodeAll(data, nil)
+		},
+	}
+
+	for _, version := range []string{PackVersion1, PackVersion2} {
+		pack := benchmarkPack(svc)
+		if err := svc.generatePack(pack, version, ""); err != nil {
+			b.Fatalf("generatePack: %v", err)
+		}
+		for _, format := range []string{PackFormatJSON, PackFormatJWS, PackFormatCBOR} {
+			for _, encoding := range []string{"identity", "gzip", "zstd"} {
+				b.Run(version+"/"+format+"/"+encoding, func(b *testing.B) {
+					var size int
+					for i := 0; i < b.N; i++ {
+						data, err := formats[format](pack)
+						if err != nil {
+							b.Fatal(err)
+						}
+						size = len(encodings[encoding](data))
+					}
+					b.ReportMetric(float64(size), "bytes/pack")
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+)
+
+// maxRememberedPacks bounds the packs whose gateways are kept to describe
+// changes since them
+const maxRememberedPacks = 4096
+
+// PackNotModified tells a client that the pack it holds is still current,
+// and extends it to ExpiresAt, as a new pack with the same content would
+// have expired. It is signed like a 1.0 pack, over its JSON encoding without
+// the signature, so a censor cannot forge one to pin a client to an old pack.
+type PackNotModified struct {
+	ClientID  string `json:"client_id"`
+	PackHash  string `json:"pack_hash"`
+	Timestamp int64  `json:"timestamp"`
+	ExpiresAt int64  `json:"expires_at"` // Unix time the client's pack is now valid until
+	KeyID     string `json:"key_id"`
+	Signature []byte `json:"signature"`
+}
+
+// PackChanges summarizes how a pack differs from the client's current one
+type PackChanges struct {
+	AddedGateways   []string `json:"added_gateways"`
+	RemovedGateways []string `json:"removed_gateways"`
+}
+
+// packHashContent is what a pack's content hash covers: everything a client
+// acts on except when it was issued and how it was signed. Gateways are in
+// ID order without their load, so load changes alone do not make a pack
+// new.
+type packHashContent struct {
+	Version    string                 `json:"version"`
+	KeyID      string                 `json:"key_id"`
+	Gateways   []GatewayInfo          `json:"gateways"`
+	Transports []TransportConfig      `json:"transports"`
+	Discovery  DiscoveryConfig        `json:"discovery"`
+	Metadata   map[string]interface{} `json:"metadata"`
+
+	KillSwitches map[string]string `json:"kill_switches"`
+	Mirrors      []string          `json:"mirrors"`
+}
+
+// ContentHash returns the hex SHA-256 of the pack's canonical content. Two
+// packs with the same hash give a client the same gateways, transports,
+// discovery and metadata. The client ID is left out, so clients served the
+// same content share a hash.
+func (p *SignedConfigPack) ContentHash() (string, error) {
+	gateways := make([]GatewayInfo, len(p.Gateways))
+	copy(gateways, p.Gateways)
+	for i := range gateways {
+		gateways[i].Load = 0
+	}
+	sort.Slice(gateways, func(i, j int) bool { return gateways[i].ID < gateways[j].ID })
+	metadata := make(map[string]interface{}, len(p.Metadata))
+	for key, value := range p.Metadata {
+		if key != "client_id" {
+			metadata[key] = value
+		}
+	}
+
+	// encoding/json writes struct fields in order and map keys sorted
+	data, err := json.Marshal(packHashContent{
+		Version:    p.Version,
+		KeyID:      p.KeyID,
+		Gateways:   gateways,
+		Transports: p.Transports,
+		Discovery:  p.Discovery,
+		Metadata:   metadata,
+
+		KillSwitches: p.KillSwitches,
+		Mirrors:      p.Mirrors,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode pack content: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NotModified signs a response telling clientID its pack with packHash is
+// still current and valid until expiresAt, the expiry of the pack it stands
+// in for. Without the new expiry, a client whose pack had expired would be
+// told to keep a pack it can no longer use.
+func (s *ConfigService) NotModified(clientID, packHash string, expiresAt int64) (*PackNotModified, error) {
+	key := s.signingKey()
+	response := &PackNotModified{
+		ClientID:  clientID,
+		PackHash:  packHash,
+		Timestamp: s.clock.Now().Unix(),
+		ExpiresAt: expiresAt,
+		KeyID:     key.ID,
+	}
+	signature, err := signJSON(key.Signer, response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign not-modified response: %w", err)
+	}
+	response.Signature = signature
+	return response, nil
+}
+
+// VerifyNotModified reports whether response was signed by trustedKey
+func VerifyNotModified(response *PackNotModified, trustedKey ed25519.PublicKey) bool {
+	unsigned := *response
+	unsigned.Signature = nil
+	return verifyJSON(trustedKey, unsigned, response.Signature)
+}
+
+// RememberPack keeps the gateways of a served pack under its hash, so a
+// client presenting the hash later can be told what changed
+func (s *ConfigService) RememberPack(packHash string, pack *SignedConfigPack) {
+	ids := make([]string, len(pack.Gateways))
+	for i, gw := range pack.Gateways {
+		ids[i] = gw.ID
+	}
+	s.served.put(packHash, ids)
+}
+
+// ChangesSince describes how pack differs from the served pack with
+// previousHash, or returns nil when that pack is not remembered
+func (s *ConfigService) ChangesSince(previousHash string, pack *SignedConfigPack) *PackChanges {
+	previous, ok := s.served.get(previousHash)
+	if !ok {
+		return nil
+	}
+	before := make(map[string]bool, len(previous))
+	for _, id := range previous {
+		before[id] = true
+	}
+	changes := &PackChanges{AddedGateways: []string{}, RemovedGateways: []string{}}
+	after := make(map[string]bool, len(pack.Gateways))
+	for _, gw := range pack.Gateways {
+		after[gw.ID] = true
+		if !before[gw.ID] {
+			changes.AddedGateways = append(changes.AddedGateways, gw.ID)
+		}
+	}
+	for _, id := range previous {
+		if !after[id] {
+			changes.RemovedGateways = append(changes.RemovedGateways, id)
+		}
+	}
+	sort.Strings(changes.AddedGateways)
+	sort.Strings(changes.RemovedGateways)
+	return changes
+}
+
+// servedPacks keeps the gateway IDs of recently served packs by hash until
+// the packs expire
+type servedPacks struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	clock   clock.Clock
+	entries map[string]*servedPack
+}
+
+type servedPack struct {
+	gatewayIDs []string
+	servedAt   time.Time
+}
+
+func newServedPacks(ttl time.Duration) *servedPacks {
+	return &servedPacks{ttl: ttl, clock: clock.Real{}, entries: map[string]*servedPack{}}
+}
+
+func (c *servedPacks) get(packHash string) ([]string, bool) {
+	if packHash == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[packHash]
+	if !ok || c.clock.Now().Sub(entry.servedAt) >= c.ttl {
+		return nil, false
+	}
+	return entry.gatewayIDs, true
+}
+
+// put remembers gatewayIDs under packHash. When the cache is full, expired
+// entries are dropped, and if none had expired it starts over.
+func (c *servedPacks) put(packHash string, gatewayIDs []string) {
+	if packHash == "" || c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	if _, ok := c.entries[packHash]; !ok && len(c.entries) >= maxRememberedPacks {
+		for k, entry := range c.entries {
+			if now.Sub(entry.servedAt) >= c.ttl {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxRememberedPacks {
+			c.entries = map[string]*servedPack{}
+		}
+	}
+	c.entries[packHash] = &servedPack{gatewayIDs: gatewayIDs, servedAt: now}
+}
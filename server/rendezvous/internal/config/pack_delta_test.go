@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestContentHash(t *testing.T) {
+	pack := func(clientID string, timestamp int64, gateways ...GatewayInfo) *SignedConfigPack {
+		return &SignedConfigPack{
+			Version:    PackVersion1,
+			Timestamp:  timestamp,
+			ExpiresAt:  timestamp + 3600,
+			Gateways:   gateways,
+			Transports: defaultTransportConfigs(),
+			Discovery:  defaultDiscoveryConfig(),
+			Metadata:   map[string]interface{}{"client_id": clientID, "region": "us-east-1"},
+		}
+	}
+	hash := func(p *SignedConfigPack) string {
+		h, err := p.ContentHash()
+		if err != nil {
+			t.Fatalf("ContentHash: %v", err)
+		}
+		return h
+	}
+	gw1 := GatewayInfo{ID: "gw-1", Address: "203.0.113.1", Port: 443, Load: 0.1}
+	gw2 := GatewayInfo{ID: "gw-2", Address: "203.0.113.2", Port: 443, Load: 0.2}
+
+	want := hash(pack("device-1", 100, gw1, gw2))
+	// Issue time, client, gateway order and load do not change the hash
+	busier := gw1
+	busier.Load = 0.9
+	if got := hash(pack("device-2", 200, gw2, busier)); got != want {
+		t.Errorf("same content: got %s, want %s", got, want)
+	}
+	// Anything a client acts on does
+	moved := gw2
+	moved.Address = "203.0.113.3"
+	changed := pack("device-1", 100, gw1, gw2)
+	changed.Discovery.ScanInterval = 60
+	for name, p := range map[string]*SignedConfigPack{
+		"gateway removed": pack("device-1", 100, gw1),
+		"gateway moved":   pack("device-1", 100, gw1, moved),
+		"discovery":       changed,
+	} {
+		if hash(p) == want {
+			t.Errorf("%s: hash unchanged", name)
+		}
+	}
+}
+
+func TestChangesSince(t *testing.T) {
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	gateways := func(ids ...string) *SignedConfigPack {
+		p := &SignedConfigPack{}
+		for _, id := range ids {
+			p.Gateways = append(p.Gateways, GatewayInfo{ID: id})
+		}
+		return p
+	}
+	svc.RememberPack("old", gateways("gw-1", "gw-2", "gw-3"))
+
+	changes := svc.ChangesSince("old", gateways("gw-4", "gw-2", "gw-0"))
+	if changes == nil || fmt.Sprint(changes.AddedGateways) != "[gw-0 gw-4]" || fmt.Sprint(changes.RemovedGateways) != "[gw-1 gw-3]" {
+		t.Errorf("changes: %+v", changes)
+	}
+	if changes := svc.ChangesSince("unknown", gateways("gw-1")); changes != nil {
+		t.Errorf("unknown pack: got %+v, want nil", changes)
+	}
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"rendezvous/internal/apperr"
+)
+
+// PackVersion1 is the original pack format: the pack struct as JSON, signed
+// over its encoding without the signature.
+const PackVersion1 = "1.0"
+
+// LegacyPackVersion is assumed for clients that do not send the versions
+// they support; every such client predates negotiation.
+const LegacyPackVersion = PackVersion1
+
+// ErrPackVersionUnsupported is returned when a client supports none of the
+// pack versions this server generates; the client must update.
+var ErrPackVersionUnsupported = apperr.New(apperr.ErrInvalidInput, "pack_version_unsupported", "client supports no pack version this server generates")
+
+// packGenerators finish a built pack in each supported format: they stamp
+// the version and sign the pack the way clients of that version verify it.
+// A new format is added here alongside the ones clients still use.
+var packGenerators = map[string]func(s *ConfigService, pack *SignedConfigPack, key *SigningKey) error{
+	PackVersion1: (*ConfigService).generateV1,
+	PackVersion2: (*ConfigService).generateV2,
+}
+
+// generateV1 signs a pack in the 1.0 format
+func (s *ConfigService) generateV1(pack *SignedConfigPack, key *SigningKey) error {
+	pack.Version = PackVersion1
+	signature, err := s.signConfigPack(pack, key)
+	if err != nil {
+		return err
+	}
+	pack.Signature = signature
+	return nil
+}
+
+// generatePack finishes pack in version, or the newest supported version
+// when version is empty, signed with the current signing key in sigAlg, or
+// ed25519 when sigAlg is empty. The pack is valid from its timestamp for the
+// pack TTL.
+func (s *ConfigService) generatePack(pack *SignedConfigPack, version, sigAlg string) error {
+	if version == "" {
+		version = CurrentPackVersion()
+	}
+	generate, ok := packGenerators[version]
+	if !ok {
+		return fmt.Errorf("pack version %q: %w", version, ErrPackVersionUnsupported)
+	}
+	key, err := s.signingKeyFor(sigAlg)
+	if err != nil {
+		return err
+	}
+	s.setValidity(pack)
+	pack.KeyID = key.ID
+	pack.PublicKey = key.PublicKey
+	pack.SignatureAlg = signatureAlg(key.Algorithm)
+	pack.Metadata["key_id"] = key.ID
+	return generate(s, pack, key)
+}
+
+// setValidity sets when a pack's content was issued and how long it is valid
+func (s *ConfigService) setValidity(pack *SignedConfigPack) {
+	pack.IssuedAt = pack.Timestamp
+	pack.NotBefore = pack.Timestamp
+	pack.ExpiresAt = pack.Timestamp + int64(s.packTTL/time.Second)
+}
+
+// SupportedPackVersions lists the pack versions this server generates, oldest first
+func SupportedPackVersions() []string {
+	versions := make([]string, 0, len(packGenerators))
+	for version := range packGenerators {
+		versions = append(versions, version)
+	}
+	sortPackVersions(versions)
+	return versions
+}
+
+// CurrentPackVersion is the newest pack version this server generates
+func CurrentPackVersion() string {
+	versions := SupportedPackVersions()
+	return versions[len(versions)-1]
+}
+
+// NegotiatePackVersion picks the highest pack version both this server and
+// the client support. A client that sends no versions gets LegacyPackVersion.
+func NegotiatePackVersion(clientVersions []string) (string, error) {
+	return negotiatePackVersion(SupportedPackVersions(), clientVersions)
+}
+
+func negotiatePackVersion(serverVersions, clientVersions []string) (string, error) {
+	if len(clientVersions) == 0 {
+		clientVersions = []string{LegacyPackVersion}
+	}
+	supported := map[string]bool{}
+	for _, version := range serverVersions {
+		supported[version] = true
+	}
+	best := ""
+	for _, version := range clientVersions {
+		if !supported[version] {
+			continue
+		}
+		if best == "" || comparePackVersions(version, best) > 0 {
+			best = version
+		}
+	}
+	if best == "" {
+		return "", ErrPackVersionUnsupported
+	}
+	return best, nil
+}
+
+// comparePackVersions orders "major.minor" versions numerically
+func comparePackVersions(a, b string) int {
+	aMajor, aMinor := parsePackVersion(a)
+	bMajor, bMinor := parsePackVersion(b)
+	switch {
+	case aMajor != bMajor:
+		return aMajor - bMajor
+	default:
+		return aMinor - bMinor
+	}
+}
+
+func parsePackVersion(version string) (int, int) {
+	major, minor, _ := strings.Cut(version, ".")
+	majorN, _ := strconv.Atoi(major)
+	minorN, _ := strconv.Atoi(minor)
+	return majorN, minorN
+}
+
+func sortPackVersions(versions []string) {
+	sort.Slice(versions, func(i, j int) bool { return comparePackVersions(versions[i], versions[j]) < 0 })
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGenerateConfigPack_EachSupportedVersion(t *testing.T) {
+	for _, version := range SupportedPackVersions() {
+		t.Run(version, func(t *testing.T) {
+			svc, err := NewConfigService(mustTestDB(t))
+			if err != nil {
+				t.Fatalf("NewConfigService: %v", err)
+			}
+			pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, version, nil, nil)
+			if err != nil {
+				t.Fatalf("GenerateConfigPack: %v", err)
+			}
+			if pack.Version != version {
+				t.Errorf("version: got %q, want %q", pack.Version, version)
+			}
+			if !svc.VerifyConfigPack(pack) {
+				t.Error("pack must verify")
+			}
+
+			deferred, err := svc.DeferredConfigPack("client-1", "us-east-1", "", version, "", 60, "token")
+			if err != nil {
+				t.Fatalf("DeferredConfigPack: %v", err)
+			}
+			if deferred.Version != version || !svc.VerifyConfigPack(deferred) {
+				t.Errorf("deferred pack: version %q, want %q and a valid signature", deferred.Version, version)
+			}
+		})
+	}
+}
+
+func TestGenerateConfigPack_UnknownVersion(t *testing.T) {
+	svc, err := NewConfigService(mustTestDB(t))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	_, err = svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "0.9", nil, nil)
+	if !errors.Is(err, ErrPackVersionUnsupported) {
+		t.Errorf("GenerateConfigPack: got %v, want ErrPackVersionUnsupported", err)
+	}
+}
+
+func TestNegotiatePackVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  []string
+		client  []string
+		want    string
+		wantErr bool
+	}{
+		{"legacy client", []string{"1.0", "2.0"}, nil, "1.0", false},
+		{"legacy client after 1.0 is retired", []string{"2.0"}, nil, "", true},
+		{"highest common", []string{"1.0", "1.1", "2.0"}, []string{"1.0", "1.1"}, "1.1", false},
+		{"client ahead of server", []string{"1.0", "1.1"}, []string{"1.1", "2.0", "3.0"}, "1.1", false},
+		{"numeric not lexical", []string{"1.2", "1.10"}, []string{"1.2", "1.10"}, "1.10", false},
+		{"client order does not matter", []string{"1.0", "2.0"}, []string{"2.0", "1.0"}, "2.0", false},
+		{"nothing in common", []string{"1.0"}, []string{"2.0"}, "", true},
+		{"garbage", []string{"1.0"}, []string{"latest", ""}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := negotiatePackVersion(tt.server, tt.client)
+			if tt.wantErr {
+				if !errors.Is(err, ErrPackVersionUnsupported) {
+					t.Errorf("got %q, %v; want ErrPackVersionUnsupported", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	if got, err := NegotiatePackVersion(nil); err != nil || got != LegacyPackVersion {
+		t.Errorf("NegotiatePackVersion(nil): got %q, %v", got, err)
+	}
+	if got, err := NegotiatePackVersion([]string{CurrentPackVersion(), "99.0"}); err != nil || got != CurrentPackVersion() {
+		t.Errorf("NegotiatePackVersion(current, 99.0): got %q, %v", got, err)
+	}
+}
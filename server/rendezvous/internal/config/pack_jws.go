@@ -0,0 +1,158 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Pack formats a config response can carry its pack in
+const (
+	// PackFormatJSON is the pack as JSON with our own signature fields
+	PackFormatJSON = "json"
+	// PackFormatJWS is the pack as a JWS in compact serialization, signed
+	// with EdDSA, or ES256 for ecdsa-p256 packs, for clients that verify
+	// with a standard JOSE library
+	PackFormatJWS = "jws"
+	// PackFormatCBOR is the pack in CBOR, for clients that count every byte
+	PackFormatCBOR = "cbor"
+)
+
+// jwsAlgorithms are the JWS algs of each signature algorithm: EdDSA for
+// Ed25519 (RFC 8037) and ES256 for ECDSA P-256 (RFC 7518)
+var jwsAlgorithms = map[string]string{
+	SigAlgEd25519:   "EdDSA",
+	SigAlgECDSAP256: "ES256",
+}
+
+// jwsHeader is the protected header of a pack JWS
+type jwsHeader struct {
+	Algorithm string   `json:"alg"`
+	KeyID     string   `json:"kid,omitempty"`
+	Type      string   `json:"typ,omitempty"`
+	Critical  []string `json:"crit,omitempty"`
+}
+
+// packJWSType is the typ of pack JWSs
+const packJWSType = "lumenlink-pack+jws"
+
+// EncodePackJWS serializes a generated pack as a compact JWS. The payload is
+// the pack's JSON without its signature, and the protected header names the
+// key the pack was generated with, which signs it.
+func (s *ConfigService) EncodePackJWS(pack *SignedConfigPack) (string, error) {
+	key := s.knownKey(pack.KeyID, s.clock.Now())
+	if key == nil || key.Signer == nil {
+		return "", fmt.Errorf("signing key %s of the pack is unavailable", pack.KeyID)
+	}
+	unsigned := signedConfigPackJSON(*pack)
+	unsigned.Signature = nil
+	payload, err := json.Marshal(unsigned)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode config pack: %w", err)
+	}
+	header, err := json.Marshal(jwsHeader{Algorithm: jwsAlgorithms[signatureAlg(key.Algorithm)], KeyID: key.ID, Type: packJWSType})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWS header: %w", err)
+	}
+	return signJWS(key.Signer, header, payload)
+}
+
+// signJWS signs header and payload into a compact JWS
+func signJWS(signer Signer, header, payload []byte) (string, error) {
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := signer.Sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseJWS splits a compact JWS, returning its header, payload, signature
+// algorithm and whether its EdDSA or ES256 signature verifies against
+// trustedKey. Headers with critical extensions are rejected, since none are
+// understood.
+func parseJWS(token string, trustedKey []byte) (*jwsHeader, []byte, string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, "", false
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, "", false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, "", false
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil || len(header.Critical) > 0 {
+		return nil, nil, "", false
+	}
+	alg := ""
+	for sigAlg, jwsAlg := range jwsAlgorithms {
+		if header.Algorithm == jwsAlg {
+			alg = sigAlg
+		}
+	}
+	if alg == "" || !verifySignature(alg, trustedKey, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, nil, "", false
+	}
+	return &header, payload, alg, true
+}
+
+// jwsKeyID returns the kid in a compact JWS's protected header, unverified
+func jwsKeyID(token string) string {
+	encoded, _, _ := strings.Cut(token, ".")
+	headerJSON, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ""
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return ""
+	}
+	return header.KeyID
+}
+
+// VerifyPackJWS is VerifyPack for a pack in compact JWS serialization: it
+// returns the pack when the JWS was signed by trustedKey in the pack's
+// signature algorithm and its header names the same key as the pack.
+func VerifyPackJWS(token string, trustedKey []byte) (*SignedConfigPack, bool) {
+	header, payload, alg, ok := parseJWS(token, trustedKey)
+	if !ok {
+		return nil, false
+	}
+	pack := &SignedConfigPack{}
+	if err := json.Unmarshal(payload, (*signedConfigPackJSON)(pack)); err != nil ||
+		signatureAlg(pack.SignatureAlg) != alg {
+		return nil, false
+	}
+	if header.KeyID != "" && pack.KeyID != "" && header.KeyID != pack.KeyID {
+		return nil, false
+	}
+	return pack, true
+}
+
+// VerifyConfigPackJWS is VerifyConfigPack for a pack in compact JWS
+// serialization. It returns the pack when the JWS was signed by the key its
+// header names, a current or previous key in its grace period, and the pack
+// is within its validity period and carries that key.
+func (s *ConfigService) VerifyConfigPackJWS(token string) (*SignedConfigPack, bool) {
+	now := s.clock.Now()
+	key := s.knownKey(jwsKeyID(token), now)
+	if key == nil {
+		return nil, false
+	}
+	pack, ok := VerifyPackJWS(token, key.PublicKey)
+	if !ok || !bytes.Equal(pack.PublicKey, key.PublicKey) ||
+		pack.ExpiresAt == 0 || pack.IsExpired(now) || now.Unix() < pack.NotBefore {
+		return nil, false
+	}
+	return pack, true
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2/jws"
+)
+
+// TestSignJWS_RFC8037 checks the JWS encoding against the Ed25519 example
+// of RFC 8037, appendix A.4
+func TestSignJWS_RFC8037(t *testing.T) {
+	seed, _ := base64.RawURLEncoding.DecodeString("nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A")
+	publicKey, _ := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	const want = "eyJhbGciOiJFZERTQSJ9.RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc." +
+		"hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg"
+
+	token, err := signJWS(newKeySigner(ed25519.NewKeyFromSeed(seed)), []byte(`{"alg":"EdDSA"}`), []byte("Example of Ed25519 signing"))
+	if err != nil || token != want {
+		t.Errorf("signJWS:\ngot  %s\nwant %s", token, want)
+	}
+	if _, payload, _, ok := parseJWS(want, publicKey); !ok || string(payload) != "Example of Ed25519 signing" {
+		t.Errorf("parseJWS: ok=%v payload=%q", ok, payload)
+	}
+}
+
+func TestEncodePackJWS_RoundTrip(t *testing.T) {
+	svc, err := NewConfigService(mustTestDB(t))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, PackVersion1, nil, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	token, err := svc.EncodePackJWS(pack)
+	if err != nil {
+		t.Fatalf("EncodePackJWS: %v", err)
+	}
+	if kid := jwsKeyID(token); kid != pack.KeyID {
+		t.Errorf("kid: got %q, want %q", kid, pack.KeyID)
+	}
+
+	decoded, ok := svc.VerifyConfigPackJWS(token)
+	if !ok {
+		t.Fatal("VerifyConfigPackJWS: expected valid JWS")
+	}
+	if decoded.Metadata["client_id"] != "client-1" || decoded.ExpiresAt != pack.ExpiresAt ||
+		len(decoded.Transports) != len(pack.Transports) || decoded.KeyID != pack.KeyID {
+		t.Errorf("decoded pack differs: %+v", decoded)
+	}
+	if _, ok := VerifyPackJWS(token, pack.PublicKey); !ok {
+		t.Error("VerifyPackJWS: expected valid JWS against the pack key")
+	}
+
+	otherKey, _, _ := ed25519.GenerateKey(nil)
+	parts := strings.Split(token, ".")
+	resign := func(header string) string {
+		token, err := signJWS(svc.signingKey().Signer, []byte(header), []byte(parts[1]))
+		if err != nil {
+			t.Fatalf("signJWS: %v", err)
+		}
+		return token
+	}
+	tampered := map[string]string{
+		"payload":      parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"version":"1.0"}`)) + "." + parts[2],
+		"alg none":     base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + ".",
+		"crit":         resign(`{"alg":"EdDSA","crit":["exp"],"exp":1}`),
+		"not compact":  parts[0] + "." + parts[1],
+		"unknown kid":  resign(`{"alg":"EdDSA","kid":"unknown"}`),
+		"empty":        "",
+		"garbage sig":  parts[0] + "." + parts[1] + ".AAAA",
+		"bad encoding": parts[0] + "." + parts[1] + "!." + parts[2],
+	}
+	for name, token := range tampered {
+		if _, ok := svc.VerifyConfigPackJWS(token); ok {
+			t.Errorf("%s: expected VerifyConfigPackJWS to fail", name)
+		}
+	}
+	if _, ok := VerifyPackJWS(token, otherKey); ok {
+		t.Error("VerifyPackJWS: expected failure against another key")
+	}
+}
+
+// TestVerifyPackJWS_JOSELibrary verifies a pack JWS produced by the JWS
+// encoder in golang.org/x/oauth2, which adds its own header and claims
+func TestVerifyPackJWS_JOSELibrary(t *testing.T) {
+	svc, err := NewConfigService(mustTestDB(t))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, PackVersion1, nil, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	unsigned := signedConfigPackJSON(*pack)
+	unsigned.Signature = nil
+	encoded, err := json.Marshal(unsigned)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(encoded, &claims); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	key := svc.signingKey()
+	token, err := jws.EncodeWithSigner(
+		&jws.Header{Algorithm: "EdDSA", Typ: "JWT", KeyID: key.ID},
+		&jws.ClaimSet{Iss: "lumenlink", PrivateClaims: claims},
+		key.Signer.Sign,
+	)
+	if err != nil {
+		t.Fatalf("EncodeWithSigner: %v", err)
+	}
+	decoded, ok := svc.VerifyConfigPackJWS(token)
+	if !ok {
+		t.Fatal("VerifyConfigPackJWS: expected the library's JWS to verify")
+	}
+	if decoded.Metadata["client_id"] != "client-1" || decoded.ExpiresAt != pack.ExpiresAt {
+		t.Errorf("decoded pack differs: %+v", decoded)
+	}
+
+	// And the library reads ours
+	ours, err := svc.EncodePackJWS(pack)
+	if err != nil {
+		t.Fatalf("EncodePackJWS: %v", err)
+	}
+	if _, err := jws.Decode(ours); err != nil {
+		t.Errorf("jws.Decode: %v", err)
+	}
+}
@@ -4,16 +4,26 @@ import (
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
+	"errors"
+	"fmt"
 	"os"
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"rendezvous/internal/cache"
+	"rendezvous/internal/clock"
 	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
 )
 
 func init() {
 	os.Setenv("LUMENLINK_ALLOW_EPHEMERAL_SIGNING_KEY", "true")
+	// Most packs here are built from empty regions; borrowing from nearby
+	// regions is tested on its own
+	os.Setenv("LUMENLINK_PACK_MIN_REGION_GATEWAYS", "0")
 }
 
 func TestVerifyConfigPack(t *testing.T) {
@@ -26,7 +36,7 @@ func TestVerifyConfigPack(t *testing.T) {
 		t.Fatalf("NewConfigService: %v", err)
 	}
 
-	pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", nil)
+	pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", "", "", ClientInfo{}, "", nil, nil)
 	if err != nil {
 		t.Fatalf("GenerateConfigPack: %v", err)
 	}
@@ -52,7 +62,7 @@ func TestVerifyConfigPack_WrongKey(t *testing.T) {
 		t.Fatalf("NewConfigService: %v", err)
 	}
 
-	pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", nil)
+	pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", "", "", ClientInfo{}, "", nil, nil)
 	if err != nil {
 		t.Fatalf("GenerateConfigPack: %v", err)
 	}
@@ -75,13 +85,13 @@ func TestGenerateConfigPack_Structure(t *testing.T) {
 		t.Fatalf("NewConfigService: %v", err)
 	}
 
-	pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", nil)
+	pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", "", "", ClientInfo{}, "", nil, nil)
 	if err != nil {
 		t.Fatalf("GenerateConfigPack: %v", err)
 	}
 
-	if pack.Version != "1.0" {
-		t.Errorf("Version: got %q, want 1.0", pack.Version)
+	if pack.Version != CurrentPackVersion() {
+		t.Errorf("Version: got %q, want %s", pack.Version, CurrentPackVersion())
 	}
 	if pack.Timestamp <= 0 {
 		t.Error("Timestamp: expected positive")
@@ -113,7 +123,7 @@ func TestVerifyConfigPack_EmptySignature(t *testing.T) {
 		t.Fatalf("NewConfigService: %v", err)
 	}
 
-	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", nil)
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", nil, nil)
 	if err != nil {
 		t.Fatalf("GenerateConfigPack: %v", err)
 	}
@@ -138,7 +148,7 @@ func TestVerifyConfigPack_TamperedSignature(t *testing.T) {
 		t.Fatalf("NewConfigService: %v", err)
 	}
 
-	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", nil)
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", nil, nil)
 	if err != nil {
 		t.Fatalf("GenerateConfigPack: %v", err)
 	}
@@ -159,7 +169,7 @@ func TestVerifyConfigPack_TamperedMetadata(t *testing.T) {
 		t.Fatalf("NewConfigService: %v", err)
 	}
 
-	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", nil)
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", nil, nil)
 	if err != nil {
 		t.Fatalf("GenerateConfigPack: %v", err)
 	}
@@ -179,7 +189,7 @@ func TestVerifyConfigPack_TamperedVersion(t *testing.T) {
 		t.Fatalf("NewConfigService: %v", err)
 	}
 
-	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", nil)
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, PackVersion1, nil, nil)
 	if err != nil {
 		t.Fatalf("GenerateConfigPack: %v", err)
 	}
@@ -199,7 +209,7 @@ func TestVerifyConfigPack_TamperedTimestamp(t *testing.T) {
 		t.Fatalf("NewConfigService: %v", err)
 	}
 
-	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", nil)
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", nil, nil)
 	if err != nil {
 		t.Fatalf("GenerateConfigPack: %v", err)
 	}
@@ -219,7 +229,7 @@ func TestVerifyConfigPack_EmptyPublicKey(t *testing.T) {
 		t.Fatalf("NewConfigService: %v", err)
 	}
 
-	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", nil)
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", nil, nil)
 	if err != nil {
 		t.Fatalf("GenerateConfigPack: %v", err)
 	}
@@ -235,8 +245,64 @@ func TestVerifyConfigPack_EmptyPublicKey(t *testing.T) {
 	}
 }
 
+func TestVerifyConfigPack_Expiry(t *testing.T) {
+	t.Setenv("LUMENLINK_PACK_TTL", "12h")
+	svc, err := NewConfigService(mustTestDBForPacks(t, 2))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	svc.SetClock(fake)
+
+	var packs []*SignedConfigPack
+	for _, version := range []string{PackVersion1, PackVersion2} {
+		pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, version, nil, nil)
+		if err != nil {
+			t.Fatalf("GenerateConfigPack(%s): %v", version, err)
+		}
+		if pack.IssuedAt != now.Unix() || pack.NotBefore != now.Unix() || pack.ExpiresAt != now.Add(12*time.Hour).Unix() {
+			t.Errorf("%s validity: got issued %d, not before %d, expires %d", version, pack.IssuedAt, pack.NotBefore, pack.ExpiresAt)
+		}
+		packs = append(packs, pack)
+	}
+
+	for _, pack := range packs {
+		// The validity period is signed
+		extended := *pack
+		extended.ExpiresAt += int64(time.Hour / time.Second)
+		if svc.VerifyConfigPack(&extended) {
+			t.Errorf("%s pack with an extended expiry verifies", pack.Version)
+		}
+		unexpiring := *pack
+		unexpiring.ExpiresAt = 0
+		if svc.VerifyConfigPack(&unexpiring) {
+			t.Errorf("%s pack without an expiry verifies", pack.Version)
+		}
+	}
+
+	fake.Set(now.Add(-time.Minute))
+	for _, pack := range packs {
+		if svc.VerifyConfigPack(pack) {
+			t.Errorf("%s pack verifies before its not-before time", pack.Version)
+		}
+	}
+	fake.Set(now.Add(12*time.Hour - time.Second))
+	for _, pack := range packs {
+		if pack.IsExpired(fake.Now()) || !svc.VerifyConfigPack(pack) {
+			t.Errorf("%s pack rejected before it expires", pack.Version)
+		}
+	}
+	fake.Set(now.Add(12 * time.Hour))
+	for _, pack := range packs {
+		if !pack.IsExpired(fake.Now()) || svc.VerifyConfigPack(pack) {
+			t.Errorf("%s pack accepted once expired", pack.Version)
+		}
+	}
+}
+
 func TestGenerateConfigPack_ConsistentStructure(t *testing.T) {
-	database := mustTestDB(t)
+	database := mustTestDBForPacks(t, 2)
 	defer database.Close()
 
 	svc, err := NewConfigService(database)
@@ -244,11 +310,11 @@ func TestGenerateConfigPack_ConsistentStructure(t *testing.T) {
 		t.Fatalf("NewConfigService: %v", err)
 	}
 
-	pack1, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", nil)
+	pack1, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", nil, nil)
 	if err != nil {
 		t.Fatalf("GenerateConfigPack: %v", err)
 	}
-	pack2, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", nil)
+	pack2, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", nil, nil)
 	if err != nil {
 		t.Fatalf("GenerateConfigPack: %v", err)
 	}
@@ -277,7 +343,7 @@ func TestGenerateConfigPack_AttestationInvalid_IncludesHoneypots(t *testing.T) {
 		t.Fatalf("NewConfigService: %v", err)
 	}
 
-	pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", &AttestationResult{IsValid: false})
+	pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", "", "", ClientInfo{}, "", &AttestationResult{IsValid: false, Honeypots: true}, nil)
 	if err != nil {
 		t.Fatalf("GenerateConfigPack: %v", err)
 	}
@@ -294,7 +360,252 @@ func TestGenerateConfigPack_AttestationInvalid_IncludesHoneypots(t *testing.T) {
 	}
 }
 
+func TestGenerateConfigPack_HoneypotDecisionFollowed(t *testing.T) {
+	ctx := context.Background()
+	database := mustTestDBWithHoneypots(t)
+	defer database.Close()
+
+	svc, err := NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	// The attestation passes, but the honeypot policy judged the device
+	// suspect, e.g. for its recent failures
+	result := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY", Honeypots: true}
+	pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", "", "", ClientInfo{}, "", result, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	if len(pack.Gateways) != 1 || !pack.Gateways[0].IsHoneypot {
+		t.Errorf("expected the honeypot for a suspect device, got %+v", pack.Gateways)
+	}
+}
+
+func TestGenerateConfigPack_StrongAttestationNoHoneypots(t *testing.T) {
+	svc, err := NewConfigService(mustTestDBWithHoneypots(t))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	result := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", result, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	for _, gw := range pack.Gateways {
+		if gw.IsHoneypot {
+			t.Errorf("strongly attested device given honeypot %s", gw.ID)
+		}
+	}
+}
+
+func TestGenerateConfigPack_StrongAttestationWithHistoryGetsHoneypots(t *testing.T) {
+	svc, err := NewConfigService(mustTestDBWithHoneypots(t))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	// The policy caught the device by its failures despite its attestation
+	result := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY", Honeypots: true}
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", result, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	honeypots := 0
+	for _, gw := range pack.Gateways {
+		if gw.IsHoneypot {
+			honeypots++
+		}
+	}
+	if honeypots == 0 {
+		t.Errorf("expected honeypots for a strongly attested device the policy flagged, got %+v", pack.Gateways)
+	}
+}
+
+func TestMixHoneypots(t *testing.T) {
+	maxUsers := 100
+	gateways := func(prefix string, n, users int, honeypot bool) []*db.Gateway {
+		list := make([]*db.Gateway, n)
+		for i := range list {
+			list[i] = &db.Gateway{
+				ID:           fmt.Sprintf("%s-%d", prefix, i),
+				IPAddress:    fmt.Sprintf("192.0.%d.%d", 2+len(prefix), i+1),
+				CurrentUsers: users + i,
+				MaxUsers:     &maxUsers,
+				IsHoneypot:   honeypot,
+			}
+		}
+		return list
+	}
+	tests := []struct {
+		name          string
+		ratio         float64
+		real          int
+		honeypots     int
+		wantHoneypots int
+		wantTotal     int
+	}{
+		{"default share", DefaultHoneypotRatio, 5, 5, 3, 5},
+		{"replace real gateways", 1, 5, 5, 5, 5},
+		{"small share", 0.2, 5, 5, 1, 5},
+		{"too few honeypots", DefaultHoneypotRatio, 5, 1, 1, 5},
+		{"honeypots fill missing gateways", DefaultHoneypotRatio, 1, 5, 4, 5},
+		{"no honeypots", DefaultHoneypotRatio, 5, 0, 0, 5},
+	}
+	for _, tt := range tests {
+		svc := &ConfigService{honeypotRatio: tt.ratio}
+		selected := svc.mixHoneypots(gateways("hp", tt.honeypots, 0, true), gateways("real", tt.real, 10, false), DefaultMaxPackGateways)
+		honeypots := 0
+		for i, gw := range selected {
+			if gw.IsHoneypot {
+				honeypots++
+			}
+			if i > 0 && svc.calculateLoad(gw) < svc.calculateLoad(selected[i-1]) {
+				t.Errorf("%s: not sorted by load", tt.name)
+			}
+		}
+		if honeypots != tt.wantHoneypots || len(selected) != tt.wantTotal {
+			t.Errorf("%s: got %d honeypots of %d, want %d of %d", tt.name, honeypots, len(selected), tt.wantHoneypots, tt.wantTotal)
+		}
+	}
+}
+
+func TestLoadHoneypotRatio(t *testing.T) {
+	for value, want := range map[string]float64{"": DefaultHoneypotRatio, "0.25": 0.25, "1": 1, "0": DefaultHoneypotRatio, "1.5": DefaultHoneypotRatio, "half": DefaultHoneypotRatio} {
+		t.Setenv("LUMENLINK_PACK_HONEYPOT_RATIO", value)
+		if got := loadHoneypotRatio(); got != want {
+			t.Errorf("%q: got %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestApplyDiversityLimits(t *testing.T) {
+	gateways := []*db.Gateway{
+		{ID: "op1-a", OperatorID: "op-1", IPAddress: "192.0.2.1"},
+		{ID: "op1-b", OperatorID: "op-1", IPAddress: "198.51.100.1"},
+		{ID: "op1-c", OperatorID: "op-1", IPAddress: "203.0.113.1"},
+		{ID: "op2-a", OperatorID: "op-2", IPAddress: "192.0.2.2"},
+		{ID: "op3-a", OperatorID: "op-3", IPAddress: "192.0.2.3"},
+		{ID: "ours", IPAddress: "203.0.113.50"},
+		{ID: "honeypot", IsHoneypot: true, IPAddress: "192.0.2.4"},
+	}
+
+	got := applyDiversityLimits(gateways, 5, DiversityLimits{MaxPerOperator: 2, MaxPerSubnet: 2})
+
+	var ids []string
+	for _, gw := range got {
+		ids = append(ids, gw.ID)
+	}
+	// op1-c exceeds the operator cap, op3-a would be the third gateway in 192.0.2.0/24
+	want := []string{"op1-a", "op1-b", "op2-a", "ours", "honeypot"}
+	if len(ids) != len(want) {
+		t.Fatalf("selected: got %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("selected: got %v, want %v", ids, want)
+		}
+	}
+}
+
+func TestApplyDiversityLimits_Disabled(t *testing.T) {
+	gateways := []*db.Gateway{
+		{ID: "a", OperatorID: "op-1", IPAddress: "192.0.2.1"},
+		{ID: "b", OperatorID: "op-1", IPAddress: "192.0.2.2"},
+		{ID: "c", OperatorID: "op-1", IPAddress: "192.0.2.3"},
+	}
+
+	got := applyDiversityLimits(gateways, 2, DiversityLimits{})
+	if len(got) != 2 || got[0].ID != "a" || got[1].ID != "b" {
+		t.Errorf("expected first two gateways with caps disabled, got %d", len(got))
+	}
+}
+
 func mustTestDB(t *testing.T) *db.Database {
+	t.Helper()
+	return mustTestDBForPacks(t, 1)
+}
+
+func TestGetDiscoveryConfig_FeatureCohorts(t *testing.T) {
+	ctx := context.Background()
+	const devices = 40
+	svc, err := NewConfigService(mustTestDBWithFeatureRollout(t, "scan_interval_120", 50, devices))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	var treated, control int
+	for i := 0; i < devices; i++ {
+		discovery, features := svc.getDiscoveryConfig(ctx, fmt.Sprintf("device-%d", i), "us-east-1", nil, nil)
+		switch {
+		case len(features) == 1 && features[0] == "scan_interval_120":
+			treated++
+			if discovery.ScanInterval != 120 {
+				t.Errorf("treated device: ScanInterval got %d, want 120", discovery.ScanInterval)
+			}
+		case len(features) == 0:
+			control++
+			if discovery.ScanInterval != 300 {
+				t.Errorf("control device: ScanInterval got %d, want 300", discovery.ScanInterval)
+			}
+		default:
+			t.Fatalf("unexpected features: %v", features)
+		}
+	}
+	if treated == 0 || control == 0 {
+		t.Errorf("expected both cohorts, got treated=%d control=%d", treated, control)
+	}
+}
+
+func TestGenerateConfigPack_RecordsFeatures(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows([]string{
+			"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+			"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+			"operator_id", "approval_status", "asn",
+			"created_at", "last_seen", "updated_at",
+		}))
+	}
+	now := time.Now()
+	mock.ExpectQuery(`SELECT key, region, percentage`).WillReturnRows(
+		sqlmock.NewRows([]string{"key", "region", "percentage", "description", "created_at", "updated_at",
+			"schedule_start_at", "schedule_end_at", "schedule_start_percentage", "schedule_end_percentage",
+			"schedule_easing", "aborted_at"}).
+			AddRow("scan_interval_120", "", 100, nil, now, now, nil, nil, nil, nil, nil, nil),
+	)
+
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", "", "", ClientInfo{}, "", nil, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+
+	features, ok := pack.Metadata["features"].([]string)
+	if !ok || len(features) != 1 || features[0] != "scan_interval_120" {
+		t.Errorf("Metadata features: got %v", pack.Metadata["features"])
+	}
+	if pack.Discovery.ScanInterval != 120 {
+		t.Errorf("ScanInterval: got %d, want 120", pack.Discovery.ScanInterval)
+	}
+	if !svc.VerifyConfigPack(pack) {
+		t.Error("VerifyConfigPack: expected valid signature")
+	}
+}
+
+func mustTestDBWithFeatureRollout(t *testing.T, feature string, percentage, lookups int) *db.Database {
 	t.Helper()
 	sqlDB, mock, err := sqlmock.New()
 	if err != nil {
@@ -302,16 +613,42 @@ func mustTestDB(t *testing.T) *db.Database {
 	}
 	t.Cleanup(func() { sqlDB.Close() })
 
-	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows([]string{
-		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
-		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
-		"created_at", "last_seen", "updated_at",
-	}))
-	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows([]string{
-		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
-		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
-		"created_at", "last_seen", "updated_at",
-	}))
+	now := time.Now()
+	for i := 0; i < lookups; i++ {
+		mock.ExpectQuery(`SELECT key, region, percentage`).WillReturnRows(
+			sqlmock.NewRows([]string{"key", "region", "percentage", "description", "created_at", "updated_at",
+				"schedule_start_at", "schedule_end_at", "schedule_start_percentage", "schedule_end_percentage",
+				"schedule_easing", "aborted_at"}).
+				AddRow(feature, "", percentage, nil, now, now, nil, nil, nil, nil, nil, nil),
+		)
+	}
+
+	return db.NewFromPool(sqlDB)
+}
+
+// mustTestDBForPacks returns a mock database that serves an unrestricted
+// launch policy and empty gateway and honeypot queries for the given number
+// of GenerateConfigPack calls.
+func mustTestDBForPacks(t *testing.T, packs int) *db.Database {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	for i := 0; i < packs; i++ {
+		expectOpenRegions(mock)
+		expectNotRevoked(mock)
+		for j := 0; j < 2; j++ {
+			mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows([]string{
+				"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+				"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+				"operator_id", "approval_status", "asn",
+				"created_at", "last_seen", "updated_at",
+			}))
+		}
+	}
 
 	return db.NewFromPool(sqlDB)
 }
@@ -328,10 +665,14 @@ func mustTestDBWithHoneypots(t *testing.T) *db.Database {
 	rand.Read(pubKey)
 	now := time.Now()
 
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+
 	// GetGatewaysByRegion - empty
 	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows([]string{
 		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
 		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
 		"created_at", "last_seen", "updated_at",
 	}))
 
@@ -339,15 +680,397 @@ func mustTestDBWithHoneypots(t *testing.T) *db.Database {
 	rows := sqlmock.NewRows([]string{
 		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
 		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
 		"created_at", "last_seen", "updated_at",
 	})
 	rows.AddRow(
 		"honeypot-id", pubKey, "10.0.0.1", 443,
 		"{masque,xtls}", "{gps}",
 		"us-east-1", 100, 0, 100, "active", true,
+		nil, "approved", nil,
 		now, now, now,
 	)
 	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(rows)
 
 	return db.NewFromPool(sqlDB)
 }
+
+func TestGenerateConfigPack_LocalizedNotices(t *testing.T) {
+	os.Setenv("LUMENLINK_PACK_NOTICES", "maintenance_scheduled, update_available")
+	defer os.Unsetenv("LUMENLINK_PACK_NOTICES")
+
+	svc, err := NewConfigService(mustTestDBForPacks(t, 2))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "es-MX", ClientInfo{}, "", nil, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	notices, ok := pack.Metadata["notices"].([]Notice)
+	if !ok || len(notices) != 2 {
+		t.Fatalf("Metadata notices: got %v", pack.Metadata["notices"])
+	}
+	if notices[0].Key != "maintenance_scheduled" || notices[0].Locale != "es" || notices[0].Text == "" {
+		t.Errorf("first notice: got %+v", notices[0])
+	}
+	if !svc.VerifyConfigPack(pack) {
+		t.Error("VerifyConfigPack: expected valid signature")
+	}
+
+	pack, err = svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", nil, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	notices, _ = pack.Metadata["notices"].([]Notice)
+	if len(notices) != 2 || notices[1].Locale != "en" {
+		t.Errorf("default locale notices: got %+v", notices)
+	}
+}
+
+func TestNewConfigService_UnknownNotice(t *testing.T) {
+	os.Setenv("LUMENLINK_PACK_NOTICES", "maintenance_scheduled,no_such_message")
+	defer os.Unsetenv("LUMENLINK_PACK_NOTICES")
+
+	if _, err := NewConfigService(mustTestDB(t)); err == nil {
+		t.Error("expected error for unknown notice key")
+	}
+}
+
+func TestGenerateConfigPack_NoNoticesByDefault(t *testing.T) {
+	svc, err := NewConfigService(mustTestDB(t))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "fa", ClientInfo{}, "", nil, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	if _, ok := pack.Metadata["notices"]; ok {
+		t.Errorf("expected no notices, got %v", pack.Metadata["notices"])
+	}
+}
+
+func TestGenerateConfigPack_RevokedDeviceGetsHoneypotsOnly(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	pubKey := make([]byte, ed25519.PublicKeySize)
+	rand.Read(pubKey)
+	now := time.Now()
+	expectOpenRegions(mock)
+	mock.ExpectQuery(`FROM revoked_devices`).WithArgs("device-revoked").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("").WillReturnRows(sqlmock.NewRows(launchGatewayColumns).
+		AddRow("hp-1", pubKey, "203.0.113.10", 443, "{masque}", "{gps}",
+			"us-east-1", 100, 0, 100, "active", true, nil, "approved", nil, now, now, now))
+
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	hits := metrics.RevokedDeviceHits.WithLabelValues("config")
+	before := testutil.ToFloat64(hits)
+
+	// A strong attestation does not unlock real gateways for a revoked device
+	pack, err := svc.GenerateConfigPack(context.Background(), "device-revoked", "us-east-1", "", "", ClientInfo{}, PackVersion2,
+		&AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	if len(pack.Gateways) != 1 || !pack.Gateways[0].IsHoneypot {
+		t.Errorf("gateways: got %+v, want the honeypot only", pack.Gateways)
+	}
+	if pack.baseKey != "" {
+		t.Errorf("revoked device's pack shares base %q", pack.baseKey)
+	}
+	if _, ok := pack.Metadata["region_status"]; ok {
+		t.Errorf("revoked device told region is %v", pack.Metadata["region_status"])
+	}
+	if got := testutil.ToFloat64(hits) - before; got != 1 {
+		t.Errorf("revoked device hits: got %v, want 1", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+var transportColumns = []string{
+	"id", "type", "endpoints", "fingerprint", "options", "region", "enabled", "priority", "updated_at",
+	"endpoint_pool", "endpoints_per_client", "weight",
+}
+
+func TestGetTransportConfigs_FromDatabase(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	policy, err := cache.NewPolicyCache(time.Minute, nil)
+	if err != nil {
+		t.Fatalf("NewPolicyCache: %v", err)
+	}
+	database := db.NewFromPool(sqlDB)
+	database.SetPolicyCache(policy)
+	svc, err := NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	now := time.Now()
+	mock.ExpectQuery(`FROM transports`).WillReturnRows(sqlmock.NewRows(transportColumns).
+		AddRow(1, "masque", "{icloud.com}", "apple_icloud", []byte(`{"quic_version":"1"}`), nil, true, 10, now, "{}", 2, 1).
+		AddRow(2, "masque", "{eu.example}", "apple_icloud", []byte(`{"quic_version":"2"}`), "eu-west-1", true, 10, now, "{}", 2, 1).
+		AddRow(3, "ssh", "{}", "", []byte(`{}`), nil, true, 0, now, "{}", 2, 1))
+
+	// The table is read once and cached for every region
+	eu := svc.getTransportConfigs(ctx, "eu-west-1", nil)
+	us := svc.getTransportConfigs(ctx, "us-east-1", nil)
+	if got := transportTypes(eu); len(got) != 2 || got[0] != "masque" || got[1] != "ssh" {
+		t.Fatalf("eu-west-1 transports: got %v", got)
+	}
+	if eu[0].Endpoints[0] != "eu.example" || eu[0].Options["quic_version"] != "2" {
+		t.Errorf("eu-west-1 masque not overridden: %+v", eu[0])
+	}
+	if len(us) != 2 || us[0].Endpoints[0] != "icloud.com" || us[0].Options["quic_version"] != "1" {
+		t.Errorf("us-east-1 transports: got %+v", us)
+	}
+
+	// Packs get copies, so changing one leaves the cached rows alone
+	us[0].Options["quic_version"] = "changed"
+	if again := svc.getTransportConfigs(ctx, "us-east-1", nil); again[0].Options["quic_version"] != "1" {
+		t.Error("cached transport modified through a pack")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetTransportConfigs_RegionPriority(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	policy, err := cache.NewPolicyCache(time.Minute, nil)
+	if err != nil {
+		t.Fatalf("NewPolicyCache: %v", err)
+	}
+	database := db.NewFromPool(sqlDB)
+	database.SetPolicyCache(policy)
+	svc, err := NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	// Where MASQUE is blocked, the region's xtls row outranks it
+	now := time.Now()
+	mock.ExpectQuery(`FROM transports`).WillReturnRows(sqlmock.NewRows(transportColumns).
+		AddRow(4, "xtls", "{ir.example}", "microsoft_edge", []byte(`{}`), "me-south-1", true, 50, now, "{}", 2, 3).
+		AddRow(1, "masque", "{icloud.com}", "apple_icloud", []byte(`{}`), nil, true, 40, now, "{}", 2, 1).
+		AddRow(2, "xtls", "{microsoft.com}", "microsoft_edge", []byte(`{}`), nil, true, 30, now, "{}", 2, 1).
+		AddRow(3, "ssh", "{}", "", []byte(`{}`), nil, true, 10, now, "{}", 2, 1))
+
+	me := svc.getTransportConfigs(ctx, "me-south-1", nil)
+	if got, want := transportTypes(me), []string{"xtls", "masque", "ssh"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("me-south-1 transports: got %v, want %v", got, want)
+	}
+	if me[0].Priority != 50 || me[0].Weight != 3 || me[0].Endpoints[0] != "ir.example" {
+		t.Errorf("me-south-1 xtls: got %+v", me[0])
+	}
+	us := svc.getTransportConfigs(ctx, "us-east-1", nil)
+	if got, want := transportTypes(us), []string{"masque", "xtls", "ssh"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("us-east-1 transports: got %v, want %v", got, want)
+	}
+	if us[1].Priority != 30 || us[1].Weight != 1 {
+		t.Errorf("us-east-1 xtls: got %+v", us[1])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetTransportConfigs_Defaults(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	defaults := transportTypes(defaultTransportConfigs())
+
+	// An empty table
+	mock.ExpectQuery(`FROM transports`).WillReturnRows(sqlmock.NewRows(transportColumns))
+	trace := &DecisionTrace{}
+	if got := transportTypes(svc.getTransportConfigs(ctx, "us-east-1", trace)); fmt.Sprint(got) != fmt.Sprint(defaults) {
+		t.Errorf("empty table: got %v, want %v", got, defaults)
+	}
+	if len(trace.Steps) != 1 || trace.Steps[0].Outcome != "defaults" {
+		t.Errorf("empty table trace: got %+v", trace.Steps)
+	}
+
+	// A failed lookup
+	mock.ExpectQuery(`FROM transports`).WillReturnError(errors.New("connection refused"))
+	trace = &DecisionTrace{}
+	if got := transportTypes(svc.getTransportConfigs(ctx, "us-east-1", trace)); fmt.Sprint(got) != fmt.Sprint(defaults) {
+		t.Errorf("failed lookup: got %v, want %v", got, defaults)
+	}
+	if len(trace.Steps) != 1 || trace.Steps[0].Outcome != "lookup_failed" {
+		t.Errorf("failed lookup trace: got %+v", trace.Steps)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBaseDiscoveryConfig(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	policy, err := cache.NewPolicyCache(time.Minute, nil)
+	if err != nil {
+		t.Fatalf("NewPolicyCache: %v", err)
+	}
+	database := db.NewFromPool(sqlDB)
+	database.SetPolicyCache(policy)
+	svc, err := NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	now := time.Now()
+	mock.ExpectQuery(`FROM discovery_configs`).WillReturnRows(
+		sqlmock.NewRows([]string{"region", "channels", "scan_interval", "battery_aware", "updated_at"}).
+			AddRow("ap-south-1", "{gsm_cb,lte_sib}", 600, true, now).
+			AddRow("default", "{gps,fm_rds}", 300, false, now).
+			AddRow("eu-west-1", "{gps,carrier_pigeon}", 300, true, now))
+
+	tests := []struct {
+		region       string
+		wantChannels []string
+		wantInterval int
+		wantOutcome  string
+	}{
+		{region: "ap-south-1", wantChannels: []string{"gsm_cb", "lte_sib"}, wantInterval: 600, wantOutcome: "stored"},
+		{region: "us-east-1", wantChannels: []string{"gps", "fm_rds"}, wantInterval: 300, wantOutcome: "stored"},
+		// An unknown channel skips the region's row for the default
+		{region: "eu-west-1", wantChannels: []string{"gps", "fm_rds"}, wantInterval: 300, wantOutcome: "invalid"},
+	}
+	for _, tt := range tests {
+		trace := &DecisionTrace{}
+		discovery := svc.baseDiscoveryConfig(ctx, tt.region, trace)
+		if fmt.Sprint(discovery.Channels) != fmt.Sprint(tt.wantChannels) || discovery.ScanInterval != tt.wantInterval {
+			t.Errorf("%s: got %+v", tt.region, discovery)
+		}
+		if len(trace.Steps) == 0 || trace.Steps[0].Outcome != tt.wantOutcome {
+			t.Errorf("%s trace: got %+v", tt.region, trace.Steps)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// Without stored configs, or when they cannot be read, the built-in
+	// config is served
+	sqlDB2, mock2, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB2.Close() })
+	svc, err = NewConfigService(db.NewFromPool(sqlDB2))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	mock2.ExpectQuery(`FROM discovery_configs`).WillReturnRows(
+		sqlmock.NewRows([]string{"region", "channels", "scan_interval", "battery_aware", "updated_at"}))
+	mock2.ExpectQuery(`FROM discovery_configs`).WillReturnError(errors.New("connection refused"))
+	for _, want := range []string{"defaults", "lookup_failed"} {
+		trace := &DecisionTrace{}
+		discovery := svc.baseDiscoveryConfig(ctx, "us-east-1", trace)
+		if fmt.Sprint(discovery) != fmt.Sprint(defaultDiscoveryConfig()) {
+			t.Errorf("%s: got %+v", want, discovery)
+		}
+		if len(trace.Steps) != 1 || trace.Steps[0].Outcome != want {
+			t.Errorf("%s trace: got %+v", want, trace.Steps)
+		}
+	}
+	for _, channel := range defaultDiscoveryConfig().Channels {
+		if _, ok := AllowedDiscoveryChannels[channel]; !ok {
+			t.Errorf("built-in channel %q not allowed", channel)
+		}
+	}
+}
+
+func TestGenerateConfigPack_ReusesGatewaySelection(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	now := time.Now()
+	fake := clock.NewFake(now)
+	svc.SetClock(fake)
+
+	gatewayRows := func(id string) *sqlmock.Rows {
+		return sqlmock.NewRows(launchGatewayColumns).AddRow(
+			id, make([]byte, ed25519.PublicKeySize), "203.0.113.1", 443, "{masque}", "{gps}",
+			"us-east-1", 100, 10, 100, "active", false, nil, "approved", nil, now, now, now,
+		)
+	}
+	// The first pack selects gateways, the second reuses its selection and
+	// the third, after the TTL, selects again. 1.0 packs, so no signed base
+	// is reused either.
+	for _, id := range []string{"gw-1", "", "gw-2"} {
+		expectOpenRegions(mock)
+		expectNotRevoked(mock)
+		if id != "" {
+			mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(gatewayRows(id))
+		}
+	}
+
+	hits := testutil.ToFloat64(metrics.ConfigGatewayCache.WithLabelValues("hit"))
+	misses := testutil.ToFloat64(metrics.ConfigGatewayCache.WithLabelValues("miss"))
+	result := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY"}
+	var selected []string
+	for i, advance := range []time.Duration{0, DefaultGatewayCacheTTL - time.Second, time.Second} {
+		fake.Advance(advance)
+		pack, err := svc.GenerateConfigPack(ctx, fmt.Sprintf("client-%d", i), "us-east-1", "", "", ClientInfo{}, PackVersion1, result, nil)
+		if err != nil {
+			t.Fatalf("GenerateConfigPack %d: %v", i, err)
+		}
+		if len(pack.Gateways) != 1 {
+			t.Fatalf("pack %d gateways: got %+v", i, pack.Gateways)
+		}
+		selected = append(selected, pack.Gateways[0].ID)
+	}
+	if want := []string{"gw-1", "gw-1", "gw-2"}; fmt.Sprint(selected) != fmt.Sprint(want) {
+		t.Errorf("selected gateways: got %v, want %v", selected, want)
+	}
+	if got := testutil.ToFloat64(metrics.ConfigGatewayCache.WithLabelValues("hit")) - hits; got != 1 {
+		t.Errorf("cache hits: got %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.ConfigGatewayCache.WithLabelValues("miss")) - misses; got != 2 {
+		t.Errorf("cache misses: got %v, want 2", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,377 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// PackVersion2 splits the pack in two signed layers. The base (gateways,
+// transports, discovery and policy metadata) is shared by every client with
+// the same region, attestation tier, country, locale and features, and is
+// signed once per base TTL. The envelope binds a base to one client and time
+// by its hash, so each request signs about a hundred bytes.
+const PackVersion2 = "2.0"
+
+// DefaultPackBaseTTL is how long a signed base is reused
+const DefaultPackBaseTTL = 30 * time.Second
+
+// DefaultPackTTL is how long a pack is valid after it is issued. A 2.0 pack
+// is valid for as long as its base, so it may expire up to the base TTL
+// sooner.
+const DefaultPackTTL = 24 * time.Hour
+
+// maxCachedPackBases bounds the base cache; country and locale come from
+// clients
+const maxCachedPackBases = 1024
+
+// PackBase is the signed base of a 2.0 pack
+type PackBase struct {
+	Version    string                 `json:"version"`
+	IssuedAt   int64                  `json:"issued_at"` // When the base was signed
+	NotBefore  int64                  `json:"not_before"`
+	ExpiresAt  int64                  `json:"expires_at"`
+	Gateways   []GatewayInfo          `json:"gateways"`
+	Transports []TransportConfig      `json:"transports"`
+	Discovery  DiscoveryConfig        `json:"discovery"`
+	Metadata   map[string]interface{} `json:"metadata"` // Everything but client_id
+
+	KillSwitches map[string]string `json:"kill_switches"`
+	Mirrors      []string          `json:"mirrors"`
+
+	// SignatureAlg is the algorithm of both the base and envelope signatures
+	SignatureAlg string `json:"signature_alg,omitempty"`
+}
+
+// signedPackBase is a base as signed: its exact encoding, which clients
+// verify as received, and the signature over it
+type signedPackBase struct {
+	content   PackBase
+	payload   []byte
+	signature []byte
+	keyID     string // The key that signed it
+}
+
+// packWireV2 is how a 2.0 pack is sent
+type packWireV2 struct {
+	Version       string `json:"version"`
+	ClientID      string `json:"client_id"`
+	Timestamp     int64  `json:"timestamp"`
+	Base          []byte `json:"base"` // PackBase as JSON
+	BaseSignature []byte `json:"base_signature"`
+	Signature     []byte `json:"signature"` // Over PackEnvelopeMessage
+	PublicKey     []byte `json:"public_key"`
+	KeyID         string `json:"key_id,omitempty"`
+}
+
+// PackBaseMessage is what a base signature covers
+func PackBaseMessage(base []byte) []byte {
+	return append([]byte("lumenlink-pack-base\n"), base...)
+}
+
+// PackEnvelopeMessage is what a 2.0 pack's own signature covers:
+// "lumenlink-pack-envelope\n<version>\n<client_id>\n<timestamp>\n<hex sha256 of base>"
+func PackEnvelopeMessage(version, clientID string, timestamp int64, base []byte) []byte {
+	sum := sha256.Sum256(base)
+	return []byte(fmt.Sprintf("lumenlink-pack-envelope\n%s\n%s\n%d\n%x", version, clientID, timestamp, sum))
+}
+
+// generateV2 signs a pack in the 2.0 format, reusing the cached base for
+// the pack's inputs and signature algorithm when there is one. A reused base
+// replaces the pack's freshly built content, so the pack always describes
+// what was signed. A base signed with a key since rotated out is signed
+// again.
+func (s *ConfigService) generateV2(pack *SignedConfigPack, key *SigningKey) error {
+	pack.Version = PackVersion2
+	clientID, _ := pack.Metadata["client_id"].(string)
+
+	baseKey := pack.baseKey
+	if baseKey != "" {
+		baseKey += "|" + pack.SignatureAlg
+	}
+	base := s.bases.get(baseKey)
+	if base == nil || base.keyID != key.ID {
+		var err error
+		if base, err = s.signPackBase(pack, key); err != nil {
+			return err
+		}
+		s.bases.put(baseKey, base)
+	}
+	signature, err := key.Signer.Sign(PackEnvelopeMessage(pack.Version, clientID, pack.Timestamp, base.payload))
+	if err != nil {
+		return err
+	}
+	pack.useBase(base, clientID)
+	pack.Signature = signature
+	return nil
+}
+
+// signPackBase encodes and signs the shared part of pack with key
+func (s *ConfigService) signPackBase(pack *SignedConfigPack, key *SigningKey) (*signedPackBase, error) {
+	content := baseContent(pack, pack.Version, pack.Timestamp)
+	payload, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode pack base: %w", err)
+	}
+	signature, err := key.Signer.Sign(PackBaseMessage(payload))
+	if err != nil {
+		return nil, err
+	}
+	return &signedPackBase{
+		content:   content,
+		payload:   payload,
+		signature: signature,
+		keyID:     key.ID,
+	}, nil
+}
+
+// baseContent is the shared part of pack: everything but the client ID
+func baseContent(pack *SignedConfigPack, version string, issuedAt int64) PackBase {
+	metadata := make(map[string]interface{}, len(pack.Metadata))
+	for key, value := range pack.Metadata {
+		if key != "client_id" {
+			metadata[key] = value
+		}
+	}
+	return PackBase{
+		Version:    version,
+		IssuedAt:   issuedAt,
+		NotBefore:  pack.NotBefore,
+		ExpiresAt:  pack.ExpiresAt,
+		Gateways:   pack.Gateways,
+		Transports: pack.Transports,
+		Discovery:  pack.Discovery,
+		Metadata:   metadata,
+
+		KillSwitches: pack.KillSwitches,
+		Mirrors:      pack.Mirrors,
+		SignatureAlg: pack.SignatureAlg,
+	}
+}
+
+// useBase fills pack's content from base for clientID. The base's slices
+// are shared with the cache and must not be modified.
+func (p *SignedConfigPack) useBase(base *signedPackBase, clientID string) {
+	p.base = base
+	p.IssuedAt = base.content.IssuedAt
+	p.NotBefore = base.content.NotBefore
+	p.ExpiresAt = base.content.ExpiresAt
+	p.Gateways = base.content.Gateways
+	p.Transports = base.content.Transports
+	p.Discovery = base.content.Discovery
+	p.KillSwitches = base.content.KillSwitches
+	p.Mirrors = base.content.Mirrors
+	p.SignatureAlg = base.content.SignatureAlg
+	p.Metadata = make(map[string]interface{}, len(base.content.Metadata)+1)
+	for key, value := range base.content.Metadata {
+		p.Metadata[key] = value
+	}
+	p.Metadata["client_id"] = clientID
+}
+
+// packBaseKey identifies the inputs a base depends on besides the client.
+// Every policy that shapes a pack is decided by one of them. The gateways
+// are those selected for the client, so clients share a base only with
+// others assigned the same gateway subset and given the same detail of it.
+// clientVersion is the client's platform and version status when its
+// platform has a version requirement. endpoints are those allocated to the
+// client from transport pools, experiments the variants it was assigned,
+// killSwitches the transports disabled when the pack was built, and mirrors
+// the rendezvous mirrors it lists.
+func packBaseKey(
+	region string,
+	open bool,
+	attestationResult *AttestationResult,
+	detail string,
+	clientVersion string,
+	country, locale string,
+	configVersion string,
+	features []string,
+	gateways []GatewayInfo,
+	endpoints []db.EndpointKey,
+	experiments []experimentAssignment,
+	killSwitches map[string]string,
+	mirrors []string,
+) string {
+	ids := make([]string, len(gateways))
+	for i, gw := range gateways {
+		ids[i] = gw.ID
+	}
+	allocated := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		allocated[i] = e.Transport + "=" + e.Endpoint
+	}
+	variants := make([]string, len(experiments))
+	for i, a := range experiments {
+		variants[i] = a.Experiment + "=" + a.Variant.Name
+	}
+	return strings.Join([]string{
+		region,
+		strconv.FormatBool(open),
+		attestationTier(attestationResult),
+		strconv.FormatBool(includeHoneypots(attestationResult)),
+		detail,
+		clientVersion,
+		country,
+		locale,
+		configVersion,
+		strings.Join(features, ","),
+		strings.Join(ids, ","),
+		strings.Join(allocated, ","),
+		strings.Join(variants, ","),
+		killSwitchKey(killSwitches),
+		mirrorKey(mirrors),
+	}, "|")
+}
+
+// packBaseCache keeps signed bases for reuse until they expire
+type packBaseCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	clock   clock.Clock
+	entries map[string]*cachedPackBase
+}
+
+type cachedPackBase struct {
+	base     *signedPackBase
+	signedAt time.Time
+}
+
+func newPackBaseCache(ttl time.Duration) *packBaseCache {
+	return &packBaseCache{ttl: ttl, clock: clock.Real{}, entries: map[string]*cachedPackBase{}}
+}
+
+// get returns the unexpired base for key, or nil. An empty key never hits.
+func (c *packBaseCache) get(key string) *signedPackBase {
+	if c == nil || key == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || c.clock.Now().Sub(entry.signedAt) >= c.ttl {
+		return nil
+	}
+	return entry.base
+}
+
+// put caches base under key. When the cache is full, expired entries are
+// dropped, and if none had expired it starts over.
+func (c *packBaseCache) put(key string, base *signedPackBase) {
+	if c == nil || key == "" || c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	if len(c.entries) >= maxCachedPackBases {
+		for k, entry := range c.entries {
+			if now.Sub(entry.signedAt) >= c.ttl {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCachedPackBases {
+			c.entries = map[string]*cachedPackBase{}
+		}
+	}
+	c.entries[key] = &cachedPackBase{base: base, signedAt: now}
+}
+
+// MarshalJSON encodes 2.0 packs as a signed base and envelope, and other
+// versions as the pack itself
+func (p SignedConfigPack) MarshalJSON() ([]byte, error) {
+	if p.Version != PackVersion2 || p.base == nil {
+		return json.Marshal(signedConfigPackJSON(p))
+	}
+	return json.Marshal(p.wireV2())
+}
+
+// wireV2 is a 2.0 pack as its signed base and envelope
+func (p *SignedConfigPack) wireV2() packWireV2 {
+	clientID, _ := p.Metadata["client_id"].(string)
+	return packWireV2{
+		Version:       p.Version,
+		ClientID:      clientID,
+		Timestamp:     p.Timestamp,
+		Base:          p.base.payload,
+		BaseSignature: p.base.signature,
+		Signature:     p.Signature,
+		PublicKey:     p.PublicKey,
+		KeyID:         p.KeyID,
+	}
+}
+
+// UnmarshalJSON decodes either encoding. The content of a 2.0 pack is read
+// from its base; verify the pack with VerifyPack before trusting it.
+func (p *SignedConfigPack) UnmarshalJSON(data []byte) error {
+	var probe struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return err
+	}
+	if probe.Version != PackVersion2 {
+		return json.Unmarshal(data, (*signedConfigPackJSON)(p))
+	}
+
+	var wire packWireV2
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	return p.setWireV2(&wire)
+}
+
+// setWireV2 replaces p with the 2.0 pack wire describes
+func (p *SignedConfigPack) setWireV2(wire *packWireV2) error {
+	var content PackBase
+	if err := json.Unmarshal(wire.Base, &content); err != nil {
+		return fmt.Errorf("invalid pack base: %w", err)
+	}
+	*p = SignedConfigPack{
+		Version:   wire.Version,
+		Timestamp: wire.Timestamp,
+		Signature: wire.Signature,
+		PublicKey: wire.PublicKey,
+		KeyID:     wire.KeyID,
+	}
+	p.useBase(&signedPackBase{content: content, payload: wire.Base, signature: wire.BaseSignature}, wire.ClientID)
+	return nil
+}
+
+// signedConfigPackJSON encodes a SignedConfigPack field by field
+type signedConfigPackJSON SignedConfigPack
+
+// VerifyPack reports whether pack was signed by trustedKey in the pack's
+// signature algorithm: an ed25519 public key, or a P-256 uncompressed point
+// for ecdsa-p256 packs. A key of the other algorithm never verifies. A 2.0
+// pack needs both its base and its envelope signature to verify, the
+// envelope must name the base it arrived with, and the pack's fields must
+// match the base.
+func VerifyPack(pack *SignedConfigPack, trustedKey []byte) bool {
+	if pack.Version != PackVersion2 {
+		packCopy := *pack
+		packCopy.Signature = nil
+		data, err := json.Marshal(packCopy)
+		return err == nil && verifySignature(pack.SignatureAlg, trustedKey, data, pack.Signature)
+	}
+
+	if pack.base == nil || pack.base.content.Version != PackVersion2 ||
+		!verifySignature(pack.SignatureAlg, trustedKey, PackBaseMessage(pack.base.payload), pack.base.signature) {
+		return false
+	}
+	clientID, _ := pack.Metadata["client_id"].(string)
+	message := PackEnvelopeMessage(pack.Version, clientID, pack.Timestamp, pack.base.payload)
+	if !verifySignature(pack.SignatureAlg, trustedKey, message, pack.Signature) {
+		return false
+	}
+	encoded, err := json.Marshal(baseContent(pack, pack.base.content.Version, pack.IssuedAt))
+	return err == nil && bytes.Equal(encoded, pack.base.payload)
+}
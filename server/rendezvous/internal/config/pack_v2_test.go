@@ -0,0 +1,274 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"rendezvous/internal/clock"
+)
+
+// generateV2Packs generates a 2.0 pack for each client ID and region
+func generateV2Packs(t *testing.T, svc *ConfigService, requests ...[2]string) []*SignedConfigPack {
+	t.Helper()
+	packs := make([]*SignedConfigPack, 0, len(requests))
+	for _, request := range requests {
+		pack, err := svc.GenerateConfigPack(context.Background(), request[0], request[1], "", "", ClientInfo{}, PackVersion2, nil, nil)
+		if err != nil {
+			t.Fatalf("GenerateConfigPack(%s): %v", request[0], err)
+		}
+		packs = append(packs, pack)
+	}
+	return packs
+}
+
+// rewire sends pack over the wire, letting edit change it in transit
+func rewire(t *testing.T, pack *SignedConfigPack, edit func(wire *packWireV2)) *SignedConfigPack {
+	t.Helper()
+	data, err := json.Marshal(pack)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var wire packWireV2
+	if err := json.Unmarshal(data, &wire); err != nil {
+		t.Fatalf("Unmarshal wire: %v", err)
+	}
+	if edit != nil {
+		edit(&wire)
+	}
+	if data, err = json.Marshal(wire); err != nil {
+		t.Fatalf("Marshal wire: %v", err)
+	}
+	var received SignedConfigPack
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	return &received
+}
+
+func TestGenerateV2_SharesBaseAcrossClients(t *testing.T) {
+	svc, err := NewConfigService(mustTestDBForPacks(t, 2))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	packs := generateV2Packs(t, svc, [2]string{"client-1", "us-east-1"}, [2]string{"client-2", "us-east-1"})
+
+	if packs[0].base == nil || packs[0].base != packs[1].base {
+		t.Fatal("clients with the same inputs must share a signed base")
+	}
+	if string(packs[0].Signature) == string(packs[1].Signature) {
+		t.Error("envelopes must differ per client")
+	}
+	for i, pack := range packs {
+		if got := pack.Metadata["client_id"]; got != fmt.Sprintf("client-%d", i+1) {
+			t.Errorf("pack %d client_id: got %v", i, got)
+		}
+		if !VerifyPack(pack, svc.signingKey().PublicKey) {
+			t.Errorf("pack %d must verify", i)
+		}
+		if received := rewire(t, pack, nil); !VerifyPack(received, svc.signingKey().PublicKey) {
+			t.Errorf("pack %d must verify after a round trip", i)
+		}
+	}
+}
+
+func TestGenerateV2_BaseExpires(t *testing.T) {
+	svc, err := NewConfigService(mustTestDBForPacks(t, 3))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	svc.SetClock(fake)
+
+	first := generateV2Packs(t, svc, [2]string{"client-1", "us-east-1"})[0]
+	fake.Advance(DefaultPackBaseTTL - time.Nanosecond)
+	if generateV2Packs(t, svc, [2]string{"client-1", "us-east-1"})[0].base != first.base {
+		t.Error("a base must be reused until the instant it expires")
+	}
+	fake.Advance(time.Nanosecond)
+	second := generateV2Packs(t, svc, [2]string{"client-1", "us-east-1"})[0]
+
+	if first.base == second.base {
+		t.Error("an expired base must be signed again")
+	}
+	if !VerifyPack(second, svc.signingKey().PublicKey) {
+		t.Error("pack with a fresh base must verify")
+	}
+}
+
+func TestGenerateV2_SeparateBasePerRegion(t *testing.T) {
+	svc, err := NewConfigService(mustTestDBForPacks(t, 2))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	packs := generateV2Packs(t, svc, [2]string{"client-1", "us-east-1"}, [2]string{"client-1", "eu-west-1"})
+	if packs[0].base == packs[1].base {
+		t.Error("packs for different regions must not share a base")
+	}
+}
+
+func TestPackBaseKey_HoneypotDecision(t *testing.T) {
+	suspect := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY", Honeypots: true}
+	trusted := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY"}
+	if packBaseKey("us-east-1", true, suspect, GatewayDetailFull, "", "", "", "", nil, nil, nil, nil, nil, nil) == packBaseKey("us-east-1", true, trusted, GatewayDetailFull, "", "", "", "", nil, nil, nil, nil, nil, nil) {
+		t.Error("devices given honeypots share a base with devices that are not")
+	}
+}
+
+func TestPreviewConfigPack_NotCached(t *testing.T) {
+	svc, err := NewConfigService(mustTestDBForPacks(t, 1))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	if _, _, err := svc.PreviewConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, PackVersion2, nil); err != nil {
+		t.Fatalf("PreviewConfigPack: %v", err)
+	}
+	if len(svc.bases.entries) != 0 {
+		t.Errorf("preview cached %d bases, want 0", len(svc.bases.entries))
+	}
+}
+
+func TestVerifyPack_V2Tampering(t *testing.T) {
+	svc, err := NewConfigService(mustTestDBForPacks(t, 3))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	packs := generateV2Packs(t, svc, [2]string{"client-1", "us-east-1"}, [2]string{"client-2", "us-east-1"}, [2]string{"client-1", "eu-west-1"})
+	pack, sameBase, otherBase := packs[0], packs[1], packs[2]
+	otherWire := rewire(t, otherBase, nil).base
+
+	tests := []struct {
+		name string
+		edit func(wire *packWireV2)
+	}{
+		{"base content", func(wire *packWireV2) {
+			var base map[string]interface{}
+			json.Unmarshal(wire.Base, &base)
+			base["metadata"].(map[string]interface{})["region"] = "eu-west-1"
+			wire.Base, _ = json.Marshal(base)
+		}},
+		{"base signature", func(wire *packWireV2) {
+			wire.BaseSignature = append([]byte{}, wire.BaseSignature...)
+			wire.BaseSignature[0] ^= 0xff
+		}},
+		{"base from another region", func(wire *packWireV2) {
+			wire.Base, wire.BaseSignature = otherWire.payload, otherWire.signature
+		}},
+		{"envelope signature", func(wire *packWireV2) {
+			wire.Signature = append([]byte{}, wire.Signature...)
+			wire.Signature[0] ^= 0xff
+		}},
+		{"envelope from another client", func(wire *packWireV2) {
+			wire.Signature = sameBase.Signature
+		}},
+		{"client id", func(wire *packWireV2) { wire.ClientID = "client-2" }},
+		{"timestamp", func(wire *packWireV2) { wire.Timestamp++ }},
+		{"expiry", func(wire *packWireV2) {
+			var base map[string]interface{}
+			json.Unmarshal(wire.Base, &base)
+			base["expires_at"] = base["expires_at"].(float64) + 3600
+			wire.Base, _ = json.Marshal(base)
+		}},
+		{"version", func(wire *packWireV2) { wire.Version = PackVersion1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if VerifyPack(rewire(t, pack, tt.edit), svc.signingKey().PublicKey) {
+				t.Error("tampered pack must not verify")
+			}
+		})
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		wrongPub, _, _ := ed25519.GenerateKey(rand.Reader)
+		if VerifyPack(pack, wrongPub) {
+			t.Error("pack must not verify under another key")
+		}
+	})
+	t.Run("content outside the base", func(t *testing.T) {
+		tampered := *pack
+		tampered.Gateways = append([]GatewayInfo{}, GatewayInfo{ID: "tampered"})
+		if VerifyPack(&tampered, svc.signingKey().PublicKey) {
+			t.Error("pack whose fields differ from its base must not verify")
+		}
+	})
+	t.Run("expiry outside the base", func(t *testing.T) {
+		tampered := *pack
+		tampered.ExpiresAt++
+		if VerifyPack(&tampered, svc.signingKey().PublicKey) {
+			t.Error("pack whose expiry differs from its base must not verify")
+		}
+	})
+}
+
+// benchmarkPack is a representative open-region pack
+func benchmarkPack(svc *ConfigService) *SignedConfigPack {
+	gateways := make([]GatewayInfo, 5)
+	for i := range gateways {
+		gateways[i] = GatewayInfo{
+			ID:         fmt.Sprintf("3f0c2a8e-8b1d-4c55-9d7a-0c1e2f3a4b%02d", i),
+			Address:    fmt.Sprintf("203.0.113.%d", 10+i),
+			Port:       443,
+			Transports: []string{"masque", "xtls"},
+			Region:     "us-east-1",
+			Load:       0.4,
+			PublicKey:  make([]byte, ed25519.PublicKeySize),
+		}
+	}
+	return &SignedConfigPack{
+		Timestamp:  time.Now().Unix(),
+		Gateways:   gateways,
+		Transports: defaultTransportConfigs(),
+		Discovery:  DiscoveryConfig{},
+		Metadata: map[string]interface{}{
+			"client_id": "client-1",
+			"region":    "us-east-1",
+			"features":  []string{},
+			"key_id":    svc.signingKey().ID,
+		},
+		PublicKey: svc.signingKey().PublicKey,
+		baseKey:   packBaseKey("us-east-1", true, nil, GatewayDetailFull, "", "", "", "", nil, nil, nil, nil, nil, nil),
+	}
+}
+
+// BenchmarkPackSigning compares the per-request signing cost of each format.
+// A 2.0 pack whose base is cached signs only its envelope.
+func BenchmarkPackSigning(b *testing.B) {
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		b.Fatalf("NewConfigService: %v", err)
+	}
+	template := benchmarkPack(svc)
+
+	b.Run(PackVersion1, func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pack := *template
+			if err := svc.generateV1(&pack, svc.signingKey()); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := json.Marshal(pack); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run(PackVersion2+" cached base", func(b *testing.B) {
+		warm := *template
+		if err := svc.generateV2(&warm, svc.signingKey()); err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			pack := *template
+			if err := svc.generateV2(&pack, svc.signingKey()); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := json.Marshal(pack); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
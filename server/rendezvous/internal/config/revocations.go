@@ -0,0 +1,178 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+// ErrRevocationsUnavailable is returned when revoking without a database to
+// keep the revocation list in
+var ErrRevocationsUnavailable = apperr.New(apperr.ErrUnavailable, "revocations_unavailable", "config revocations are not configured")
+
+// ErrInvalidRevocation is returned for a pack hash or key ID that is not
+// well-formed
+var ErrInvalidRevocation = apperr.New(apperr.ErrInvalidInput, "invalid_revocation", "invalid pack hash or key ID")
+
+// ErrCurrentKeyRevoked is returned when revoking the key packs are signed
+// with; it must be rotated out first
+var ErrCurrentKeyRevoked = apperr.New(apperr.ErrConflict, "current_key_revoked", "rotate the signing key before revoking it")
+
+// ErrPackRevoked is returned instead of a pack whose content hash has been
+// revoked. The same content always has the same hash, so it is refused until
+// the gateways that made it untrustworthy are withdrawn.
+var ErrPackRevoked = apperr.New(apperr.ErrUnavailable, "pack_revoked", "the config pack for this client has been revoked")
+
+// revocationListTTL is how long a replica reuses its signed revocation list.
+// A revocation made on another replica reaches clients within it plus the
+// endpoint's cache lifetime.
+const revocationListTTL = 30 * time.Second
+
+var (
+	packHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	keyIDPattern    = regexp.MustCompile(`^[0-9a-f]{16}$`)
+)
+
+// RevocationList tells clients which packs and signing keys to stop
+// trusting. It is signed like a 1.0 pack, over its JSON encoding without the
+// signature. Generation grows with every new revocation; clients keep the
+// highest they have seen and reject a list with a lower one, so an old list
+// cannot be replayed to hide a revocation.
+type RevocationList struct {
+	Generation int64    `json:"generation"`
+	PackHashes []string `json:"pack_hashes"` // Content hashes of revoked packs, as in pack_hash
+	KeyIDs     []string `json:"key_ids"`     // Revoked signing keys; packs and endorsements they signed are untrusted
+	Timestamp  int64    `json:"timestamp"`
+	KeyID      string   `json:"key_id"`
+	Signature  []byte   `json:"signature"`
+}
+
+// VerifyRevocationList reports whether list was signed by trustedKey
+func VerifyRevocationList(list *RevocationList, trustedKey ed25519.PublicKey) bool {
+	unsigned := *list
+	unsigned.Signature = nil
+	return verifyJSON(trustedKey, unsigned, list.Signature)
+}
+
+// revocationCache keeps the last signed revocation list
+type revocationCache struct {
+	mu       sync.Mutex
+	list     *RevocationList
+	signedAt time.Time
+}
+
+// Revocations returns the signed revocation list. It is reused for
+// revocationListTTL, and while the revocations cannot be read the last list
+// is served. Without a database nothing can be revoked, so the list is
+// empty.
+func (s *ConfigService) Revocations(ctx context.Context) (*RevocationList, error) {
+	s.revocations.mu.Lock()
+	defer s.revocations.mu.Unlock()
+	now := s.clock.Now()
+	key := s.signingKey()
+	if cached := s.revocations.list; cached != nil && cached.KeyID == key.ID && now.Sub(s.revocations.signedAt) < revocationListTTL {
+		return cached, nil
+	}
+
+	list := &RevocationList{PackHashes: []string{}, KeyIDs: []string{}, Timestamp: now.Unix(), KeyID: key.ID}
+	if s.db != nil {
+		revocations, err := s.db.GetConfigRevocations(ctx)
+		if err != nil {
+			if s.revocations.list != nil {
+				return s.revocations.list, nil
+			}
+			return nil, err
+		}
+		for _, r := range revocations {
+			switch r.Kind {
+			case db.ConfigRevocationPack:
+				list.PackHashes = append(list.PackHashes, r.Value)
+			case db.ConfigRevocationKey:
+				list.KeyIDs = append(list.KeyIDs, r.Value)
+			}
+			list.Generation = max(list.Generation, r.Generation)
+		}
+	}
+	signature, err := signJSON(key.Signer, list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign revocation list: %w", err)
+	}
+	list.Signature = signature
+	s.revocations.list, s.revocations.signedAt = list, now
+	return list, nil
+}
+
+// checkPackRevoked returns ErrPackRevoked when pack's content hash is on the
+// revocation list. While the list cannot be read the pack is served, as
+// refusing every pack would take all clients offline.
+func (s *ConfigService) checkPackRevoked(ctx context.Context, pack *SignedConfigPack) error {
+	list, err := s.Revocations(ctx)
+	if err != nil {
+		log.Printf("revocations unavailable, serving packs unchecked: %v", err)
+		return nil
+	}
+	if len(list.PackHashes) == 0 {
+		return nil
+	}
+	packHash, err := pack.ContentHash()
+	if err != nil {
+		return err
+	}
+	for _, revoked := range list.PackHashes {
+		if revoked == packHash {
+			metrics.RevokedPacksRefused.Inc()
+			return ErrPackRevoked
+		}
+	}
+	return nil
+}
+
+// RevokePack revokes the pack with content hash packHash, as returned in
+// pack_hash. Clients holding it fetch a new pack; one with the same content
+// has the same hash and is refused, so the gateways that made it
+// untrustworthy should be withdrawn first.
+func (s *ConfigService) RevokePack(ctx context.Context, packHash, reason string) (*db.ConfigRevocation, error) {
+	if !packHashPattern.MatchString(packHash) {
+		return nil, ErrInvalidRevocation
+	}
+	return s.revoke(ctx, db.ConfigRevocationPack, packHash, reason)
+}
+
+// RevokeKey revokes a signing key, so clients stop trusting packs and key
+// endorsements it signed. The current key cannot be revoked: rotate it out
+// first, so the revocation list is signed by a key clients still trust.
+func (s *ConfigService) RevokeKey(ctx context.Context, keyID, reason string) (*db.ConfigRevocation, error) {
+	if !keyIDPattern.MatchString(keyID) {
+		return nil, ErrInvalidRevocation
+	}
+	if keyID == s.signingKey().ID {
+		return nil, ErrCurrentKeyRevoked
+	}
+	return s.revoke(ctx, db.ConfigRevocationKey, keyID, reason)
+}
+
+func (s *ConfigService) revoke(ctx context.Context, kind, value, reason string) (*db.ConfigRevocation, error) {
+	if s.db == nil {
+		return nil, ErrRevocationsUnavailable
+	}
+	revocation, err := s.db.AddConfigRevocation(ctx, kind, value, reason)
+	if err != nil {
+		return nil, err
+	}
+	// This replica's list is rebuilt once the revocation commits; others
+	// within revocationListTTL
+	s.db.AfterCommit(ctx, func() {
+		s.revocations.mu.Lock()
+		s.revocations.list = nil
+		s.revocations.mu.Unlock()
+	})
+	return revocation, nil
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+var revocationColumns = []string{"id", "kind", "value", "reason", "revoked_at"}
+
+func TestRevocations(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	svc.SetClock(fake)
+	ctx := context.Background()
+
+	packHash := strings.Repeat("ab", 32)
+	mock.ExpectQuery(`FROM config_revocations`).WillReturnRows(sqlmock.NewRows(revocationColumns).
+		AddRow(3, db.ConfigRevocationPack, packHash, "gateways seized", fake.Now()).
+		AddRow(7, db.ConfigRevocationKey, "0123456789abcdef", "key leaked", fake.Now()))
+
+	list, err := svc.Revocations(ctx)
+	if err != nil {
+		t.Fatalf("Revocations: %v", err)
+	}
+	if list.Generation != 7 || !reflect.DeepEqual(list.PackHashes, []string{packHash}) ||
+		!reflect.DeepEqual(list.KeyIDs, []string{"0123456789abcdef"}) {
+		t.Errorf("list: got %+v", list)
+	}
+	if list.KeyID != svc.signingKey().ID || !VerifyRevocationList(list, svc.signingKey().PublicKey) {
+		t.Error("revocation list must verify with the signing key")
+	}
+	tampered := *list
+	tampered.KeyIDs = nil
+	if VerifyRevocationList(&tampered, svc.signingKey().PublicKey) {
+		t.Error("a list with a revocation removed must not verify")
+	}
+
+	// The signed list is reused within its TTL without another query
+	fake.Advance(revocationListTTL - time.Second)
+	if again, err := svc.Revocations(ctx); err != nil || again != list {
+		t.Errorf("within the TTL: got %v, %v, want the same list", again, err)
+	}
+
+	// Past it, a failed read serves the last list
+	fake.Advance(time.Second)
+	mock.ExpectQuery(`FROM config_revocations`).WillReturnError(errors.New("connection reset"))
+	if stale, err := svc.Revocations(ctx); err != nil || stale != list {
+		t.Errorf("on a failed read: got %v, %v, want the last list", stale, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRevocations_WithoutDatabase(t *testing.T) {
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	list, err := svc.Revocations(context.Background())
+	if err != nil {
+		t.Fatalf("Revocations: %v", err)
+	}
+	if list.Generation != 0 || len(list.PackHashes) != 0 || len(list.KeyIDs) != 0 ||
+		!VerifyRevocationList(list, svc.signingKey().PublicKey) {
+		t.Errorf("list: got %+v, want an empty signed list", list)
+	}
+	if _, err := svc.RevokePack(context.Background(), strings.Repeat("ab", 32), ""); !errors.Is(err, ErrRevocationsUnavailable) {
+		t.Errorf("RevokePack: got %v, want ErrRevocationsUnavailable", err)
+	}
+}
+
+func TestRevokePack(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	ctx := context.Background()
+	packHash := strings.Repeat("cd", 32)
+	now := time.Now()
+
+	mock.ExpectQuery(`FROM config_revocations`).WillReturnRows(sqlmock.NewRows(revocationColumns))
+	if list, err := svc.Revocations(ctx); err != nil || list.Generation != 0 {
+		t.Fatalf("Revocations: got %+v, %v", list, err)
+	}
+
+	mock.ExpectQuery(`INSERT INTO config_revocations`).WithArgs(db.ConfigRevocationPack, packHash, "gateways seized").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "reason", "revoked_at"}).AddRow(1, "gateways seized", now))
+	revocation, err := svc.RevokePack(ctx, packHash, "gateways seized")
+	if err != nil {
+		t.Fatalf("RevokePack: %v", err)
+	}
+	if revocation.Generation != 1 {
+		t.Errorf("revocation: got %+v", revocation)
+	}
+
+	// The replica's cached list is rebuilt at once
+	mock.ExpectQuery(`FROM config_revocations`).WillReturnRows(sqlmock.NewRows(revocationColumns).
+		AddRow(1, db.ConfigRevocationPack, packHash, "gateways seized", now))
+	if list, err := svc.Revocations(ctx); err != nil || list.Generation != 1 || len(list.PackHashes) != 1 {
+		t.Errorf("Revocations after revoking: got %+v, %v", list, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRevokeKey(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := svc.RevokeKey(ctx, svc.signingKey().ID, ""); !errors.Is(err, ErrCurrentKeyRevoked) || !errors.Is(err, apperr.ErrConflict) {
+		t.Errorf("current key: got %v, want ErrCurrentKeyRevoked", err)
+	}
+	for _, invalid := range []string{"", "0123456789ABCDEF", "0123", strings.Repeat("ab", 32)} {
+		if _, err := svc.RevokeKey(ctx, invalid, ""); !errors.Is(err, ErrInvalidRevocation) {
+			t.Errorf("key ID %q: got %v, want ErrInvalidRevocation", invalid, err)
+		}
+	}
+
+	mock.ExpectQuery(`INSERT INTO config_revocations`).WithArgs(db.ConfigRevocationKey, "0123456789abcdef", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "reason", "revoked_at"}).AddRow(4, "", time.Now()))
+	if revocation, err := svc.RevokeKey(ctx, "0123456789abcdef", ""); err != nil || revocation.Generation != 4 {
+		t.Errorf("RevokeKey: got %+v, %v", revocation, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerateConfigPack_RefusesRevokedPack(t *testing.T) {
+	// Upgrade packs are built without a database; their content depends
+	// only on the client's platform
+	t.Setenv("LUMENLINK_CLIENT_VERSIONS", `{
+		"android": {"min_version": "1.4.0", "upgrade_url": "https://lumenlink.org/download"},
+		"ios": {"min_version": "1.4.0", "upgrade_url": "https://lumenlink.org/ios"}}`)
+	android := ClientInfo{Platform: "android", Version: "1.3.2"}
+	ios := ClientInfo{Platform: "ios", Version: "1.3.2"}
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	ctx := context.Background()
+	pack, err := svc.GenerateConfigPack(ctx, "client-1", "us-east-1", "", "", android, "", nil, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	packHash, err := pack.ContentHash()
+	if err != nil {
+		t.Fatalf("ContentHash: %v", err)
+	}
+
+	// A replica's cached list carrying the pack's hash
+	svc.revocations.list = &RevocationList{PackHashes: []string{packHash}, KeyIDs: []string{}, KeyID: svc.signingKey().ID}
+	svc.revocations.signedAt = svc.clock.Now()
+	if _, err := svc.GenerateConfigPack(ctx, "client-2", "us-east-1", "", "", android, "", nil, nil); !errors.Is(err, ErrPackRevoked) || !errors.Is(err, apperr.ErrUnavailable) {
+		t.Errorf("revoked pack: got %v, want ErrPackRevoked", err)
+	}
+
+	// Other content is still served
+	if _, err := svc.GenerateConfigPack(ctx, "client-3", "us-east-1", "", "", ios, "", nil, nil); err != nil {
+		t.Errorf("unrevoked pack: %v", err)
+	}
+}
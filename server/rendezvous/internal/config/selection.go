@@ -0,0 +1,188 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/db"
+)
+
+// ErrInvalidSelection is returned for gateway selection settings that
+// cannot be served with
+var ErrInvalidSelection = apperr.New(apperr.ErrInvalidInput, "invalid_selection", "invalid gateway selection settings")
+
+// DefaultMaxPackGateways is the most gateways a pack lists by default
+const DefaultMaxPackGateways = 5
+
+// DefaultMinRegionGateways is how many candidates a region needs by default
+// before gateways are borrowed from the nearest regions, so a region without
+// gateways never strands its clients with an empty pack
+const DefaultMinRegionGateways = 1
+
+// DefaultGatewayCandidateLimit is how many of a region's gateways, least
+// loaded first, packs are selected from by default
+const DefaultGatewayCandidateLimit = 100
+
+// maxGatewayCandidateLimit bounds the gateways loaded for one region
+const maxGatewayCandidateLimit = 1000
+
+// SelectionConfig tunes how gateways are selected for packs. It can be
+// replaced while serving with SetSelectionConfig.
+type SelectionConfig struct {
+	MaxGateways     int     `json:"max_gateways"`     // Most gateways a pack lists, unless a strongly attested device's subset is larger
+	MinGateways     int     `json:"min_gateways"`     // Candidates a region needs before nearby regions' are added; 0 never borrows
+	MaxLoad         float64 `json:"max_load"`         // Gateways loaded above it are left out; 0 disables the cap
+	IncludeDegraded bool    `json:"include_degraded"` // Whether degraded gateways can be selected
+	CandidateLimit  int     `json:"candidate_limit"`  // Most gateways loaded per region
+	LatencyWeight   float64 `json:"latency_weight"`   // Share of the selection order given to measured latency, 0 to 1; 0 orders by load only
+}
+
+// DefaultSelectionConfig returns the selection settings used when none are
+// configured
+func DefaultSelectionConfig() SelectionConfig {
+	return SelectionConfig{
+		MaxGateways:    DefaultMaxPackGateways,
+		MinGateways:    DefaultMinRegionGateways,
+		CandidateLimit: DefaultGatewayCandidateLimit,
+	}
+}
+
+// Validate reports whether the settings can be served with
+func (c SelectionConfig) Validate() error {
+	switch {
+	case c.MaxGateways < 1:
+		return fmt.Errorf("max gateways must be at least 1")
+	case c.MinGateways < 0:
+		return fmt.Errorf("min gateways must not be negative")
+	case c.MaxLoad < 0:
+		return fmt.Errorf("max load must not be negative")
+	case c.LatencyWeight < 0 || c.LatencyWeight > 1:
+		return fmt.Errorf("latency weight must be between 0 and 1")
+	case c.CandidateLimit < c.MaxGateways || c.CandidateLimit > maxGatewayCandidateLimit:
+		return fmt.Errorf("candidate limit must be between max gateways (%d) and %d", c.MaxGateways, maxGatewayCandidateLimit)
+	}
+	return nil
+}
+
+// loadSelectionConfig reads LUMENLINK_PACK_MAX_GATEWAYS (default 5),
+// LUMENLINK_PACK_MIN_REGION_GATEWAYS (default 1),
+// LUMENLINK_PACK_MAX_GATEWAY_LOAD (default 0, no cap),
+// LUMENLINK_PACK_INCLUDE_DEGRADED_GATEWAYS (default false),
+// LUMENLINK_PACK_GATEWAY_CANDIDATE_LIMIT (default 100) and
+// LUMENLINK_PACK_LATENCY_WEIGHT (default 0, load only).
+func loadSelectionConfig() (SelectionConfig, error) {
+	selection := DefaultSelectionConfig()
+	selection.MaxGateways = envInt("LUMENLINK_PACK_MAX_GATEWAYS", selection.MaxGateways)
+	selection.MinGateways = envInt("LUMENLINK_PACK_MIN_REGION_GATEWAYS", selection.MinGateways)
+	selection.CandidateLimit = envInt("LUMENLINK_PACK_GATEWAY_CANDIDATE_LIMIT", selection.CandidateLimit)
+	if value := strings.TrimSpace(os.Getenv("LUMENLINK_PACK_MAX_GATEWAY_LOAD")); value != "" {
+		maxLoad, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return SelectionConfig{}, fmt.Errorf("invalid LUMENLINK_PACK_MAX_GATEWAY_LOAD: %w", err)
+		}
+		selection.MaxLoad = maxLoad
+	}
+	if value := strings.TrimSpace(os.Getenv("LUMENLINK_PACK_LATENCY_WEIGHT")); value != "" {
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return SelectionConfig{}, fmt.Errorf("invalid LUMENLINK_PACK_LATENCY_WEIGHT: %w", err)
+		}
+		selection.LatencyWeight = weight
+	}
+	if value := strings.TrimSpace(os.Getenv("LUMENLINK_PACK_INCLUDE_DEGRADED_GATEWAYS")); value != "" {
+		includeDegraded, err := strconv.ParseBool(value)
+		if err != nil {
+			return SelectionConfig{}, fmt.Errorf("invalid LUMENLINK_PACK_INCLUDE_DEGRADED_GATEWAYS: %w", err)
+		}
+		selection.IncludeDegraded = includeDegraded
+	}
+	if err := selection.Validate(); err != nil {
+		return SelectionConfig{}, fmt.Errorf("invalid gateway selection: %w", err)
+	}
+	return selection, nil
+}
+
+// SelectionConfig returns the gateway selection settings packs are built
+// with
+func (s *ConfigService) SelectionConfig() SelectionConfig {
+	s.selectionMu.RLock()
+	defer s.selectionMu.RUnlock()
+	return s.selection
+}
+
+// SetSelectionConfig replaces the gateway selection settings for packs built
+// from now on. Candidates cached under the old settings are not reused.
+func (s *ConfigService) SetSelectionConfig(selection SelectionConfig) error {
+	if err := selection.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSelection, err)
+	}
+	s.selectionMu.Lock()
+	s.selection = selection
+	s.selectionMu.Unlock()
+	return nil
+}
+
+// regionGateways loads a region's selectable gateways. When it has fewer
+// than the minimum, gateways from the nearest regions, by distance or else
+// in the geo balancer's preference order, are added until it is reached; they compete with the
+// region's own under the same load order and keep their own region. It also
+// returns the regions borrowed from. A neighbor that cannot be read is
+// skipped, since the region's own gateways can still be served.
+func (s *ConfigService) regionGateways(
+	ctx context.Context,
+	region string,
+	selection SelectionConfig,
+	trace *DecisionTrace,
+) ([]*db.Gateway, []string, error) {
+	gateways, err := s.db.GetSelectableGateways(ctx, region, selection.IncludeDegraded, selection.CandidateLimit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load gateways for region %s: %w", region, err)
+	}
+	if len(gateways) >= selection.MinGateways {
+		return gateways, nil, nil
+	}
+
+	own := len(gateways)
+	borrowed := []string{}
+	for _, fallback := range s.rollouts.NearestFallbackRegions(ctx, region) {
+		if len(gateways) >= selection.MinGateways {
+			break
+		}
+		more, err := s.db.GetSelectableGateways(ctx, fallback, selection.IncludeDegraded, selection.CandidateLimit)
+		if err != nil {
+			log.Printf("fallback gateways for region %s unavailable from %s: %v", region, fallback, err)
+			continue
+		}
+		if len(more) > 0 {
+			gateways = append(gateways, more...)
+			borrowed = append(borrowed, fallback)
+		}
+	}
+	trace.Record("region_fallback", "borrowed", map[string]interface{}{
+		"own":          own,
+		"min_gateways": selection.MinGateways,
+		"regions":      borrowed,
+		"candidates":   len(gateways),
+	})
+	return gateways, borrowed, nil
+}
+
+// underLoadCap returns the gateways loaded at most maxLoad, without
+// modifying gateways; a cap of 0 keeps them all
+func (s *ConfigService) underLoadCap(gateways []*db.Gateway, maxLoad float64) []*db.Gateway {
+	if maxLoad <= 0 {
+		return gateways
+	}
+	kept := make([]*db.Gateway, 0, len(gateways))
+	for _, gw := range gateways {
+		if s.calculateLoad(gw) <= maxLoad {
+			kept = append(kept, gw)
+		}
+	}
+	return kept
+}
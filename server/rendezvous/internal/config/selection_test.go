@@ -0,0 +1,266 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+// selectionGatewayRows returns a region's gateways with the given current
+// users out of 100, each on its own subnet
+func selectionGatewayRows(region string, users ...int) *sqlmock.Rows {
+	now := time.Now()
+	rows := sqlmock.NewRows(launchGatewayColumns)
+	for i, current := range users {
+		rows.AddRow(fmt.Sprintf("%s-gw-%d", region, i), make([]byte, 32), fmt.Sprintf("203.0.%d.1", 10*len(region)+i), 443,
+			"{masque}", "{gps}", region, 100, current, 100, "active", false, nil, "approved", nil, now, now, now)
+	}
+	return rows
+}
+
+func TestPreviewConfigPack_LoadCap(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	selection := DefaultSelectionConfig()
+	selection.MaxLoad = 0.8
+	if err := svc.SetSelectionConfig(selection); err != nil {
+		t.Fatalf("SetSelectionConfig: %v", err)
+	}
+
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("us-east-1", false, DefaultGatewayCandidateLimit).
+		WillReturnRows(selectionGatewayRows("us-east-1", 20, 80, 95))
+
+	strong := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	pack, trace, err := svc.PreviewConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", strong)
+	if err != nil {
+		t.Fatalf("PreviewConfigPack: %v", err)
+	}
+	if len(pack.Gateways) != 2 {
+		t.Fatalf("gateways: got %+v, want the two at or under the cap", pack.Gateways)
+	}
+	for _, gw := range pack.Gateways {
+		if gw.Load > selection.MaxLoad {
+			t.Errorf("%s listed with load %v above the cap", gw.ID, gw.Load)
+		}
+	}
+	if step := findStep(t, trace, "load_cap"); step.Details["excluded"] != 1 {
+		t.Errorf("load_cap step: got %+v, want 1 excluded", step)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPreviewConfigPack_RegionFallback(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	selection := DefaultSelectionConfig()
+	selection.MinGateways = 3
+	selection.IncludeDegraded = true
+	if err := svc.SetSelectionConfig(selection); err != nil {
+		t.Fatalf("SetSelectionConfig: %v", err)
+	}
+
+	// us-east-1 has one gateway, so the nearest regions are added until
+	// there are three; eu-west-1 is not needed
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("us-east-1", true, DefaultGatewayCandidateLimit).
+		WillReturnRows(selectionGatewayRows("us-east-1", 10))
+	expectRegionCoordinates(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("us-west-1", true, DefaultGatewayCandidateLimit).
+		WillReturnRows(selectionGatewayRows("us-west-1", 30, 40))
+
+	strong := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	pack, trace, err := svc.PreviewConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", strong)
+	if err != nil {
+		t.Fatalf("PreviewConfigPack: %v", err)
+	}
+	if len(pack.Gateways) != 3 || pack.Gateways[0].Region != "us-east-1" {
+		t.Errorf("gateways: got %+v, want the region's own first, then two borrowed", pack.Gateways)
+	}
+	step := findStep(t, trace, "region_fallback")
+	if fmt.Sprint(step.Details["regions"]) != "[us-west-1]" || step.Details["own"] != 1 {
+		t.Errorf("region_fallback step: got %+v", step)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// expectRegionCoordinates expects one regions lookup returning the named
+// seeded regions; with none, borrowing follows the preference order
+func expectRegionCoordinates(mock sqlmock.Sqlmock, regions ...string) {
+	seeded := map[string][2]float64{
+		"af-south-1":   {-33.92, 18.42},
+		"eu-central-1": {50.11, 8.68},
+		"me-south-1":   {26.07, 50.56},
+		"sa-east-1":    {-23.55, -46.63},
+		"us-east-1":    {38.95, -77.45},
+	}
+	rows := sqlmock.NewRows([]string{"name", "latitude", "longitude"})
+	for _, region := range regions {
+		rows.AddRow(region, seeded[region][0], seeded[region][1])
+	}
+	mock.ExpectQuery(`FROM regions`).WillReturnRows(rows)
+}
+
+func TestPreviewConfigPack_RegionFallbackByDistance(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	selection := DefaultSelectionConfig()
+	selection.MinGateways = 3
+	if err := svc.SetSelectionConfig(selection); err != nil {
+		t.Fatalf("SetSelectionConfig: %v", err)
+	}
+
+	// af-south-1 has no preference list, so it would borrow from us-east-1
+	// first; by its coordinates, sa-east-1 and then me-south-1 are nearer
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("af-south-1", false, DefaultGatewayCandidateLimit).
+		WillReturnRows(selectionGatewayRows("af-south-1", 10))
+	expectRegionCoordinates(mock, "af-south-1", "eu-central-1", "me-south-1", "sa-east-1", "us-east-1")
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("sa-east-1", false, DefaultGatewayCandidateLimit).
+		WillReturnRows(selectionGatewayRows("sa-east-1", 30))
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("me-south-1", false, DefaultGatewayCandidateLimit).
+		WillReturnRows(selectionGatewayRows("me-south-1", 40))
+
+	strong := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	_, trace, err := svc.PreviewConfigPack(context.Background(), "client-1", "af-south-1", "", "", ClientInfo{}, "", strong)
+	if err != nil {
+		t.Fatalf("PreviewConfigPack: %v", err)
+	}
+	if step := findStep(t, trace, "region_fallback"); fmt.Sprint(step.Details["regions"]) != "[sa-east-1 me-south-1]" {
+		t.Errorf("region_fallback step: got %+v", step)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerateConfigPack_EmptyRegionBorrows(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	if err := svc.SetSelectionConfig(DefaultSelectionConfig()); err != nil {
+		t.Fatalf("SetSelectionConfig: %v", err)
+	}
+
+	// us-west-1 cannot be read, so it is skipped for eu-west-1
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("us-east-1", false, DefaultGatewayCandidateLimit).
+		WillReturnRows(selectionGatewayRows("us-east-1"))
+	expectRegionCoordinates(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("us-west-1", false, DefaultGatewayCandidateLimit).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectQuery(`SELECT id, public_key`).WithArgs("eu-west-1", false, DefaultGatewayCandidateLimit).
+		WillReturnRows(selectionGatewayRows("eu-west-1", 10, 20))
+
+	fallbacks := testutil.ToFloat64(metrics.RegionFallback.WithLabelValues("us-east-1"))
+	strong := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, "", strong, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	if len(pack.Gateways) != 2 || pack.Gateways[0].Region != "eu-west-1" || pack.Metadata["region"] != "us-east-1" {
+		t.Errorf("pack: got gateways %+v in region %v", pack.Gateways, pack.Metadata["region"])
+	}
+	if got := testutil.ToFloat64(metrics.RegionFallback.WithLabelValues("us-east-1")) - fallbacks; got != 1 {
+		t.Errorf("region fallback delta: got %v, want 1", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetSelectionConfig_Invalid(t *testing.T) {
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	before := svc.SelectionConfig()
+	for name, selection := range map[string]SelectionConfig{
+		"no gateways":              {MaxGateways: 0, CandidateLimit: 100},
+		"negative minimum":         {MaxGateways: 5, MinGateways: -1, CandidateLimit: 100},
+		"negative load cap":        {MaxGateways: 5, MaxLoad: -0.5, CandidateLimit: 100},
+		"limit below max gateways": {MaxGateways: 5, CandidateLimit: 4},
+		"limit too high":           {MaxGateways: 5, CandidateLimit: maxGatewayCandidateLimit + 1},
+		"latency weight above 1":   {MaxGateways: 5, CandidateLimit: 100, LatencyWeight: 1.5},
+	} {
+		if err := svc.SetSelectionConfig(selection); !errors.Is(err, ErrInvalidSelection) {
+			t.Errorf("%s: got %v, want ErrInvalidSelection", name, err)
+		}
+	}
+	if got := svc.SelectionConfig(); got != before {
+		t.Errorf("settings changed by invalid updates: got %+v", got)
+	}
+}
+
+func TestLoadSelectionConfig(t *testing.T) {
+	t.Setenv("LUMENLINK_PACK_MAX_GATEWAYS", "8")
+	t.Setenv("LUMENLINK_PACK_MIN_REGION_GATEWAYS", "4")
+	t.Setenv("LUMENLINK_PACK_MAX_GATEWAY_LOAD", "0.9")
+	t.Setenv("LUMENLINK_PACK_INCLUDE_DEGRADED_GATEWAYS", "true")
+	t.Setenv("LUMENLINK_PACK_GATEWAY_CANDIDATE_LIMIT", "200")
+	t.Setenv("LUMENLINK_PACK_LATENCY_WEIGHT", "0.25")
+	selection, err := loadSelectionConfig()
+	if err != nil {
+		t.Fatalf("loadSelectionConfig: %v", err)
+	}
+	want := SelectionConfig{MaxGateways: 8, MinGateways: 4, MaxLoad: 0.9, IncludeDegraded: true, CandidateLimit: 200, LatencyWeight: 0.25}
+	if selection != want {
+		t.Errorf("got %+v, want %+v", selection, want)
+	}
+
+	for key, value := range map[string]string{
+		"LUMENLINK_PACK_MAX_GATEWAY_LOAD":          "high",
+		"LUMENLINK_PACK_INCLUDE_DEGRADED_GATEWAYS": "sometimes",
+		"LUMENLINK_PACK_GATEWAY_CANDIDATE_LIMIT":   "5",
+		"LUMENLINK_PACK_LATENCY_WEIGHT":            "-1",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := loadSelectionConfig(); err == nil {
+				t.Errorf("%s=%s: expected an error", key, value)
+			}
+		})
+	}
+}
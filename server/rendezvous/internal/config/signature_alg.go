@@ -0,0 +1,173 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"rendezvous/internal/apperr"
+)
+
+// Signature algorithms a client can ask its pack to be signed with
+const (
+	// SigAlgEd25519 is the default, signed with the current signing key
+	SigAlgEd25519 = "ed25519"
+	// SigAlgECDSAP256 is ECDSA over P-256 with SHA-256, for clients whose
+	// hardware verifies nothing else. Public keys are uncompressed points
+	// and signatures are r || s, 32 bytes each, as in JWS ES256.
+	SigAlgECDSAP256 = "ecdsa-p256"
+)
+
+// ErrSignatureAlgUnavailable is returned when a pack is requested in a
+// signature algorithm this server has no key for
+var ErrSignatureAlgUnavailable = apperr.New(apperr.ErrInvalidInput, "sig_alg_unavailable", "no config signing key for the signature algorithm")
+
+// ValidSignatureAlg reports whether alg is a signature algorithm clients can
+// ask for; empty asks for the default
+func ValidSignatureAlg(alg string) bool {
+	return alg == "" || alg == SigAlgEd25519 || alg == SigAlgECDSAP256
+}
+
+// signatureAlg returns alg, or SigAlgEd25519 when it is empty
+func signatureAlg(alg string) string {
+	if alg == "" {
+		return SigAlgEd25519
+	}
+	return alg
+}
+
+// p256PublicKeySize is the length of an uncompressed P-256 point
+const p256PublicKeySize = 65
+
+// p256Signer signs with an ECDSA P-256 private key held in process
+type p256Signer struct {
+	privateKey *ecdsa.PrivateKey
+	publicKey  []byte
+}
+
+func newP256Signer(privateKey *ecdsa.PrivateKey) *p256Signer {
+	return &p256Signer{
+		privateKey: privateKey,
+		publicKey:  elliptic.Marshal(elliptic.P256(), privateKey.X, privateKey.Y),
+	}
+}
+
+func (p *p256Signer) Sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, p.privateKey, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with the P-256 key: %w", err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signature, nil
+}
+
+func (p *p256Signer) PublicKey() []byte { return p.publicKey }
+
+func (p *p256Signer) KeyID() string { return KeyID(p.publicKey) }
+
+// loadP256SigningKey reads the optional ECDSA P-256 signing key, following
+// loadSigningKeys: the private key comes from
+// LUMENLINK_CONFIG_SIGNING_P256_PRIVATE_KEY or from the file named by
+// LUMENLINK_CONFIG_SIGNING_P256_PRIVATE_KEY_FILE, as base64 PKCS #8 or SEC 1
+// DER, and a public key in LUMENLINK_CONFIG_SIGNING_P256_PUBLIC_KEY, a
+// base64 uncompressed point, must be the private key's. Without a private
+// key it returns nil, and packs cannot be requested in ecdsa-p256.
+func loadP256SigningKey() (*SigningKey, error) {
+	privateKeyB64 := os.Getenv("LUMENLINK_CONFIG_SIGNING_P256_PRIVATE_KEY")
+	privateKeyFile := strings.TrimSpace(os.Getenv("LUMENLINK_CONFIG_SIGNING_P256_PRIVATE_KEY_FILE"))
+	publicKeyB64 := os.Getenv("LUMENLINK_CONFIG_SIGNING_P256_PUBLIC_KEY")
+
+	if privateKeyFile != "" {
+		if privateKeyB64 != "" {
+			return nil, fmt.Errorf("set only one of LUMENLINK_CONFIG_SIGNING_P256_PRIVATE_KEY and LUMENLINK_CONFIG_SIGNING_P256_PRIVATE_KEY_FILE")
+		}
+		data, err := os.ReadFile(privateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read P-256 config signing private key file: %w", err)
+		}
+		privateKeyB64 = strings.TrimSpace(string(data))
+	}
+	if privateKeyB64 == "" {
+		return nil, nil
+	}
+
+	der, err := base64.StdEncoding.DecodeString(privateKeyB64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid P-256 config signing private key encoding: %w", err)
+	}
+	privateKey, err := parseP256PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer := newP256Signer(privateKey)
+	if publicKeyB64 != "" {
+		publicKey, err := base64.StdEncoding.DecodeString(publicKeyB64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid P-256 config signing public key encoding: %w", err)
+		}
+		if string(publicKey) != string(signer.publicKey) {
+			return nil, fmt.Errorf("P-256 config signing public key %s does not match the private key's %s; packs would not verify",
+				KeyID(publicKey), signer.KeyID())
+		}
+	}
+
+	// As with the ed25519 key, check the key signs what verifies
+	probe, err := signer.Sign(signingProbe)
+	if err != nil || !verifySignature(SigAlgECDSAP256, signer.publicKey, signingProbe, probe) {
+		return nil, fmt.Errorf("P-256 config signing private key %s failed its self-test: its signatures do not verify", signer.KeyID())
+	}
+	return &SigningKey{ID: signer.KeyID(), Algorithm: SigAlgECDSAP256, PublicKey: signer.publicKey, Signer: signer}, nil
+}
+
+// parseP256PrivateKey parses a PKCS #8 or SEC 1 DER private key, which must
+// be on P-256
+func parseP256PrivateKey(der []byte) (*ecdsa.PrivateKey, error) {
+	var privateKey *ecdsa.PrivateKey
+	if parsed, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		privateKey, _ = parsed.(*ecdsa.PrivateKey)
+	} else if parsed, err := x509.ParseECPrivateKey(der); err == nil {
+		privateKey = parsed
+	}
+	if privateKey == nil || privateKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("P-256 config signing private key is not a PKCS #8 or SEC 1 P-256 key")
+	}
+	return privateKey, nil
+}
+
+// verifySignature reports whether signature is publicKey's signature over
+// message in alg. Keys of the wrong size or curve never verify.
+func verifySignature(alg string, publicKey, message, signature []byte) bool {
+	switch signatureAlg(alg) {
+	case SigAlgEd25519:
+		// ed25519.Verify panics on a malformed key
+		if len(publicKey) != ed25519.PublicKeySize {
+			return false
+		}
+		return ed25519.Verify(publicKey, message, signature)
+	case SigAlgECDSAP256:
+		if len(publicKey) != p256PublicKeySize || len(signature) != 64 {
+			return false
+		}
+		x, y := elliptic.Unmarshal(elliptic.P256(), publicKey)
+		if x == nil {
+			return false
+		}
+		digest := sha256.Sum256(message)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, digest[:], r, s)
+	default:
+		return false
+	}
+}
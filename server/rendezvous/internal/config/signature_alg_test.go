@@ -0,0 +1,166 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// setP256SigningKey configures a new P-256 signing key, returning its
+// public key as packs carry it
+func setP256SigningKey(t *testing.T) []byte {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	t.Setenv("LUMENLINK_CONFIG_SIGNING_P256_PRIVATE_KEY", base64.StdEncoding.EncodeToString(der))
+	return elliptic.Marshal(elliptic.P256(), privateKey.X, privateKey.Y)
+}
+
+func TestGeneratePack_ECDSAP256(t *testing.T) {
+	publicKey := setP256SigningKey(t)
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	for _, version := range []string{PackVersion1, PackVersion2} {
+		pack := benchmarkPack(svc)
+		if err := svc.generatePack(pack, version, SigAlgECDSAP256); err != nil {
+			t.Fatalf("generatePack(%s): %v", version, err)
+		}
+		if pack.SignatureAlg != SigAlgECDSAP256 || pack.KeyID != KeyID(publicKey) || string(pack.PublicKey) != string(publicKey) {
+			t.Fatalf("%s pack: alg %q key %s", version, pack.SignatureAlg, pack.KeyID)
+		}
+		if !svc.VerifyConfigPack(pack) {
+			t.Errorf("%s pack does not verify", version)
+		}
+
+		data, err := json.Marshal(pack)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		var received SignedConfigPack
+		if err := json.Unmarshal(data, &received); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if received.SignatureAlg != SigAlgECDSAP256 || !VerifyPack(&received, publicKey) {
+			t.Errorf("%s pack over the wire does not verify", version)
+		}
+		if VerifyPack(&received, svc.signingKey().PublicKey) {
+			t.Errorf("%s pack verifies against the ed25519 key", version)
+		}
+
+		// The algorithm is signed; claiming another breaks the signature
+		received.SignatureAlg = SigAlgEd25519
+		if svc.VerifyConfigPack(&received) {
+			t.Errorf("%s pack verifies with its algorithm changed", version)
+		}
+	}
+
+	// Packs for ed25519 clients are unchanged by the P-256 key
+	pack := benchmarkPack(svc)
+	if err := svc.generatePack(pack, PackVersion2, ""); err != nil {
+		t.Fatalf("generatePack: %v", err)
+	}
+	if pack.SignatureAlg != SigAlgEd25519 || pack.KeyID != svc.signingKey().ID || !svc.VerifyConfigPack(pack) {
+		t.Errorf("ed25519 pack: alg %q key %s", pack.SignatureAlg, pack.KeyID)
+	}
+}
+
+func TestEncodePackJWS_ECDSAP256(t *testing.T) {
+	publicKey := setP256SigningKey(t)
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	pack, err := svc.DeferredConfigPack("client-1", "us-east-1", "", PackVersion1, SigAlgECDSAP256, 60, "token")
+	if err != nil {
+		t.Fatalf("DeferredConfigPack: %v", err)
+	}
+	token, err := svc.EncodePackJWS(pack)
+	if err != nil {
+		t.Fatalf("EncodePackJWS: %v", err)
+	}
+	if header := jwsHeaderOf(t, token); !strings.Contains(header, `"alg":"ES256"`) {
+		t.Errorf("header: got %s, want alg ES256", header)
+	}
+	if _, ok := svc.VerifyConfigPackJWS(token); !ok {
+		t.Error("JWS does not verify")
+	}
+	if _, ok := VerifyPackJWS(token, publicKey); !ok {
+		t.Error("JWS does not verify against the P-256 key")
+	}
+}
+
+func TestDeferredConfigPack_SignatureAlgUnavailable(t *testing.T) {
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	if _, err := svc.DeferredConfigPack("client-1", "us-east-1", "", PackVersion1, SigAlgECDSAP256, 60, "token"); !errors.Is(err, ErrSignatureAlgUnavailable) {
+		t.Errorf("without a P-256 key: got %v, want ErrSignatureAlgUnavailable", err)
+	}
+	if _, err := svc.DeferredConfigPack("client-1", "us-east-1", "", PackVersion1, "rsa", 60, "token"); !errors.Is(err, ErrSignatureAlgUnavailable) {
+		t.Errorf("unknown algorithm: got %v, want ErrSignatureAlgUnavailable", err)
+	}
+}
+
+func TestLoadP256SigningKey(t *testing.T) {
+	if key, err := loadP256SigningKey(); key != nil || err != nil {
+		t.Fatalf("unconfigured: got %v, %v", key, err)
+	}
+
+	publicKey := setP256SigningKey(t)
+	t.Setenv("LUMENLINK_CONFIG_SIGNING_P256_PUBLIC_KEY", base64.StdEncoding.EncodeToString(publicKey))
+	key, err := loadP256SigningKey()
+	if err != nil {
+		t.Fatalf("loadP256SigningKey: %v", err)
+	}
+	if key.Algorithm != SigAlgECDSAP256 || key.ID != KeyID(publicKey) {
+		t.Errorf("key: got %s %s", key.Algorithm, key.ID)
+	}
+
+	// A public key that is not the private key's is refused
+	other := setP256SigningKey(t)
+	t.Setenv("LUMENLINK_CONFIG_SIGNING_P256_PUBLIC_KEY", base64.StdEncoding.EncodeToString(publicKey))
+	if _, err := loadP256SigningKey(); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("mismatched public key %s: got %v", KeyID(other), err)
+	}
+
+	// So is a key on another curve
+	privateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	t.Setenv("LUMENLINK_CONFIG_SIGNING_P256_PRIVATE_KEY", base64.StdEncoding.EncodeToString(der))
+	if _, err := loadP256SigningKey(); err == nil {
+		t.Error("P-384 key: got no error")
+	}
+}
+
+// jwsHeaderOf returns the decoded protected header of a compact JWS
+func jwsHeaderOf(t *testing.T, token string) string {
+	t.Helper()
+	encoded, _, _ := strings.Cut(token, ".")
+	header, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("header: %v", err)
+	}
+	return string(header)
+}
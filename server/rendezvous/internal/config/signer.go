@@ -0,0 +1,198 @@
+package config
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/metrics"
+)
+
+// ErrSignerUnavailable is returned when the signer cannot sign, such as when
+// the remote signing service is unreachable. Nothing is served unsigned.
+var ErrSignerUnavailable = apperr.New(apperr.ErrUnavailable, "signer_unavailable", "config signer is unavailable")
+
+// Signers selected by LUMENLINK_CONFIG_SIGNER
+const (
+	// SignerEnv signs with the private key in LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY
+	SignerEnv = "env"
+	// SignerRemote signs with an external signing service, so the private
+	// key can stay in a KMS or HSM
+	SignerRemote = "remote"
+)
+
+// Signer signs packs and the other documents clients verify with the config
+// public key
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+	PublicKey() []byte // Encoded as packs carry it for the signer's algorithm
+	KeyID() string
+}
+
+// loadSigner returns the signer LUMENLINK_CONFIG_SIGNER selects
+func loadSigner() (Signer, error) {
+	switch kind := os.Getenv("LUMENLINK_CONFIG_SIGNER"); kind {
+	case "", SignerEnv:
+		privateKey, publicKey, err := loadSigningKeys()
+		if err != nil {
+			return nil, err
+		}
+		return &keySigner{privateKey: privateKey, publicKey: publicKey}, nil
+	case SignerRemote:
+		publicKey, err := base64.StdEncoding.DecodeString(os.Getenv("LUMENLINK_CONFIG_SIGNING_PUBLIC_KEY"))
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("the remote signer needs its public key in LUMENLINK_CONFIG_SIGNING_PUBLIC_KEY")
+		}
+		return NewRemoteSigner(RemoteSignerConfig{
+			URL:          os.Getenv("LUMENLINK_REMOTE_SIGNER_URL"),
+			Token:        os.Getenv("LUMENLINK_REMOTE_SIGNER_TOKEN"),
+			PublicKey:    publicKey,
+			Timeout:      envDuration("LUMENLINK_REMOTE_SIGNER_TIMEOUT", 2*time.Second),
+			MaxAttempts:  envInt("LUMENLINK_REMOTE_SIGNER_MAX_ATTEMPTS", 3),
+			RetryBackoff: envDurationOrZero("LUMENLINK_REMOTE_SIGNER_RETRY_BACKOFF", 100*time.Millisecond),
+		})
+	default:
+		return nil, fmt.Errorf("unknown config signer %q", kind)
+	}
+}
+
+// keySigner signs with a private key held in process
+type keySigner struct {
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+func (k *keySigner) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(k.privateKey, data), nil
+}
+
+func (k *keySigner) PublicKey() []byte { return k.publicKey }
+
+func (k *keySigner) KeyID() string { return KeyID(k.publicKey) }
+
+// newKeySigner returns a signer for privateKey
+func newKeySigner(privateKey ed25519.PrivateKey) *keySigner {
+	return &keySigner{privateKey: privateKey, publicKey: privateKey.Public().(ed25519.PublicKey)}
+}
+
+// RemoteSignerConfig configures a RemoteSigner
+type RemoteSignerConfig struct {
+	URL          string            // Endpoint signing requests are POSTed to
+	Token        string            // Sent as a bearer token; empty sends none
+	PublicKey    ed25519.PublicKey // The key the service signs with
+	Timeout      time.Duration     // Per attempt
+	MaxAttempts  int               // Attempts before the signer is reported unavailable
+	RetryBackoff time.Duration     // Wait before the second attempt; doubled for each later one
+}
+
+// RemoteSigner signs with an external signing service, such as a KMS or HSM
+// front end. Each request POSTs {"key_id", "message"} with the message in
+// base64 and expects {"signature"} back, likewise in base64. Signatures are
+// checked against the configured public key before they are used; transport
+// errors, 429s and 5xxs are retried.
+type RemoteSigner struct {
+	config RemoteSignerConfig
+	keyID  string
+	client *http.Client
+	clock  clock.Clock
+}
+
+// NewRemoteSigner creates a remote signer
+func NewRemoteSigner(config RemoteSignerConfig) (*RemoteSigner, error) {
+	if parsed, err := url.Parse(config.URL); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid remote signer URL %q", config.URL)
+	}
+	if len(config.PublicKey) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid remote signer public key")
+	}
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	return &RemoteSigner{
+		config: config,
+		keyID:  KeyID(config.PublicKey),
+		client: &http.Client{Timeout: config.Timeout},
+		clock:  clock.Real{},
+	}, nil
+}
+
+// remoteSignRequest is the body of a request to the remote signer
+type remoteSignRequest struct {
+	KeyID   string `json:"key_id"`
+	Message []byte `json:"message"`
+}
+
+// remoteSignResponse is the remote signer's answer
+type remoteSignResponse struct {
+	Signature []byte `json:"signature"`
+}
+
+func (r *RemoteSigner) PublicKey() []byte { return r.config.PublicKey }
+
+func (r *RemoteSigner) KeyID() string { return r.keyID }
+
+// Sign asks the signing service to sign data, retrying with backoff. When
+// no attempt succeeds the error is ErrSignerUnavailable.
+func (r *RemoteSigner) Sign(data []byte) ([]byte, error) {
+	body, err := json.Marshal(remoteSignRequest{KeyID: r.keyID, Message: data})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signing request: %w", err)
+	}
+
+	backoff := r.config.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		signature, retry, err := r.sign(body)
+		if err == nil && !ed25519.Verify(r.config.PublicKey, data, signature) {
+			err, retry = errors.New("remote signer returned a signature that does not verify"), false
+		}
+		if err == nil {
+			metrics.RemoteSignerRequests.WithLabelValues("signed").Inc()
+			return signature, nil
+		}
+		if !retry || attempt == r.config.MaxAttempts {
+			metrics.RemoteSignerRequests.WithLabelValues("failed").Inc()
+			return nil, fmt.Errorf("%w: %v", ErrSignerUnavailable, err)
+		}
+		metrics.RemoteSignerRequests.WithLabelValues("retried").Inc()
+		<-r.clock.After(backoff)
+		backoff *= 2
+	}
+}
+
+// sign makes one signing request, reporting whether a failure may be retried
+func (r *RemoteSigner) sign(body []byte) ([]byte, bool, error) {
+	req, err := http.NewRequest(http.MethodPost, r.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.config.Token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retry, fmt.Errorf("remote signer answered %d", resp.StatusCode)
+	}
+	var signed remoteSignResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&signed); err != nil {
+		return nil, true, fmt.Errorf("failed to decode remote signer response: %w", err)
+	}
+	return signed.Signature, false, nil
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rendezvous/internal/apperr"
+)
+
+// signingService is a test remote signer that answers its first failures
+// requests with status, then signs with key
+func signingService(t *testing.T, key ed25519.PrivateKey, failures, status int) (*httptest.Server, *int) {
+	t.Helper()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if requests <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		var req remoteSignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.KeyID != KeyID(key.Public().(ed25519.PublicKey)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(remoteSignResponse{Signature: ed25519.Sign(key, req.Message)})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestRemoteSigner(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(nil)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	tests := []struct {
+		name         string
+		key          ed25519.PrivateKey
+		failures     int
+		status       int
+		wantRequests int
+		wantErr      bool
+	}{
+		{"signs", privateKey, 0, 0, 1, false},
+		{"retries server errors", privateKey, 2, http.StatusBadGateway, 3, false},
+		{"retries rate limiting", privateKey, 1, http.StatusTooManyRequests, 2, false},
+		{"gives up after max attempts", privateKey, 3, http.StatusServiceUnavailable, 3, true},
+		{"does not retry client errors", privateKey, 1, http.StatusForbidden, 1, true},
+		{"rejects signatures by another key", otherKey, 0, 0, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := signingService(t, tt.key, tt.failures, tt.status)
+			signer, err := NewRemoteSigner(RemoteSignerConfig{
+				URL:         server.URL,
+				Token:       "secret",
+				PublicKey:   publicKey,
+				MaxAttempts: 3,
+			})
+			if err != nil {
+				t.Fatalf("NewRemoteSigner: %v", err)
+			}
+			signature, err := signer.Sign([]byte("message"))
+			if tt.wantErr {
+				if !errors.Is(err, ErrSignerUnavailable) || !errors.Is(err, apperr.ErrUnavailable) {
+					t.Errorf("error: got %v, want ErrSignerUnavailable", err)
+				}
+			} else if err != nil || !ed25519.Verify(publicKey, []byte("message"), signature) {
+				t.Errorf("Sign: %v", err)
+			}
+			if *requests != tt.wantRequests {
+				t.Errorf("requests: got %d, want %d", *requests, tt.wantRequests)
+			}
+		})
+	}
+
+	// An unreachable service is unavailable too
+	server, _ := signingService(t, privateKey, 0, 0)
+	server.Close()
+	signer, err := NewRemoteSigner(RemoteSignerConfig{URL: server.URL, PublicKey: publicKey, MaxAttempts: 2})
+	if err != nil {
+		t.Fatalf("NewRemoteSigner: %v", err)
+	}
+	if _, err := signer.Sign([]byte("message")); !errors.Is(err, ErrSignerUnavailable) {
+		t.Errorf("unreachable: got %v, want ErrSignerUnavailable", err)
+	}
+}
+
+func TestNewConfigService_RemoteSigner(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(nil)
+	server, requests := signingService(t, privateKey, 0, 0)
+	t.Setenv("LUMENLINK_CONFIG_SIGNER", SignerRemote)
+	t.Setenv("LUMENLINK_CONFIG_SIGNING_PUBLIC_KEY", base64.StdEncoding.EncodeToString(publicKey))
+	t.Setenv("LUMENLINK_REMOTE_SIGNER_URL", server.URL)
+	t.Setenv("LUMENLINK_REMOTE_SIGNER_TOKEN", "secret")
+	t.Setenv("LUMENLINK_DATA_KEY", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+
+	svc, err := NewConfigService(mustTestDBForPacks(t, 2))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	for _, version := range []string{PackVersion1, PackVersion2} {
+		pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "us-east-1", "", "", ClientInfo{}, version, nil, nil)
+		if err != nil {
+			t.Fatalf("GenerateConfigPack %s: %v", version, err)
+		}
+		if pack.KeyID != KeyID(publicKey) || !VerifyPack(pack, publicKey) {
+			t.Errorf("%s pack not signed by the remote key", version)
+		}
+	}
+	if *requests == 0 {
+		t.Error("the remote signer was not used")
+	}
+
+	// The key lives in the remote signer, so it is not rotated here
+	if _, err := svc.RotateKey(context.Background()); !errors.Is(err, ErrSigningKeysUnavailable) {
+		t.Errorf("RotateKey: got %v, want ErrSigningKeysUnavailable", err)
+	}
+}
+
+func TestLoadSigner_Invalid(t *testing.T) {
+	publicKey, _, _ := ed25519.GenerateKey(nil)
+	encoded := base64.StdEncoding.EncodeToString(publicKey)
+	tests := []struct {
+		name, signer, publicKey, url string
+	}{
+		{"unknown signer", "pkcs11", encoded, "https://signer.example.com/sign"},
+		{"remote without public key", SignerRemote, "", "https://signer.example.com/sign"},
+		{"remote without URL", SignerRemote, encoded, ""},
+		{"remote with a bad URL", SignerRemote, encoded, "signer.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LUMENLINK_CONFIG_SIGNER", tt.signer)
+			t.Setenv("LUMENLINK_CONFIG_SIGNING_PUBLIC_KEY", tt.publicKey)
+			t.Setenv("LUMENLINK_REMOTE_SIGNER_URL", tt.url)
+			if _, err := loadSigner(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadSigningKeys(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(nil)
+	otherPublicKey, otherPrivateKey, _ := ed25519.GenerateKey(nil)
+	encode := base64.StdEncoding.EncodeToString
+	// A private key whose public half belongs to another key
+	mismatchedHalves := append(append(ed25519.PrivateKey{}, privateKey[:32]...), otherPublicKey...)
+
+	keyFile := filepath.Join(t.TempDir(), "signing.key")
+	if err := os.WriteFile(keyFile, []byte(encode(privateKey)+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tests := []struct {
+		name, privateKey, privateKeyFile, publicKey string
+		wantErr                                     string
+	}{
+		{"matching pair", encode(privateKey), "", encode(publicKey), ""},
+		{"public key derived", encode(privateKey), "", "", ""},
+		{"private key from file", "", keyFile, encode(publicKey), ""},
+		{"public key of another pair", encode(privateKey), "", encode(otherPublicKey), "does not match"},
+		{"mismatched halves", encode(mismatchedHalves), "", "", "self-test"},
+		{"both env and file", encode(otherPrivateKey), keyFile, "", "only one"},
+		{"missing file", "", filepath.Join(t.TempDir(), "missing.key"), "", "failed to read"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY", tt.privateKey)
+			t.Setenv("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY_FILE", tt.privateKeyFile)
+			t.Setenv("LUMENLINK_CONFIG_SIGNING_PUBLIC_KEY", tt.publicKey)
+			gotPrivate, gotPublic, err := loadSigningKeys()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadSigningKeys: %v", err)
+			}
+			if !gotPrivate.Equal(privateKey) || !gotPublic.Equal(publicKey) {
+				t.Error("loaded a different key pair")
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/db"
+)
+
+// ErrSigningKeysUnavailable is returned when the signing key cannot be
+// rotated because no data key is configured to encrypt it at rest.
+var ErrSigningKeysUnavailable = apperr.New(apperr.ErrUnavailable, "signing_keys_unavailable", "config signing key rotation is not configured")
+
+// DefaultSigningKeyGrace is how long a replaced signing key still verifies
+const DefaultSigningKeyGrace = 7 * 24 * time.Hour
+
+// SigningKey is a config signing key known to the server
+type SigningKey struct {
+	ID        string
+	Algorithm string     // A SigAlg constant; empty for ed25519
+	PublicKey []byte     // As the algorithm's verifiers take it
+	Signer    Signer     // Nil for keys kept only to verify
+	ExpiresAt *time.Time // Nil for the current key and configured keys without an expiry
+
+	// ValidFrom is when a stored key became current; zero for keys from
+	// the environment
+	ValidFrom time.Time
+
+	// Endorsement is the signature over KeyEndorsementMessage by the key
+	// with PreviousKeyID, which this key replaced. Keys from the
+	// environment have none.
+	PreviousKeyID string
+	Endorsement   []byte
+}
+
+// KeyRotation reports a signing key rotation
+type KeyRotation struct {
+	KeyID             string    `json:"key_id"`
+	PublicKey         []byte    `json:"public_key"`
+	PreviousKeyID     string    `json:"previous_key_id"`
+	PreviousExpiresAt time.Time `json:"previous_expires_at"`
+}
+
+// keyring holds the key packs are signed with and the previous keys packs
+// still verify against. Keys from the environment are used until a rotated
+// key is stored.
+type keyring struct {
+	mu         sync.RWMutex
+	current    *SigningKey
+	previous   []*SigningKey // Newest first
+	configured []*SigningKey // Previous keys from the environment
+}
+
+func newKeyring(current *SigningKey, configured []*SigningKey) *keyring {
+	return &keyring{current: current, configured: configured}
+}
+
+// signing returns the current key
+func (k *keyring) signing() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+// lookup returns the current key or an unexpired previous key with id
+func (k *keyring) lookup(id string, now time.Time) *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.current.ID == id {
+		return k.current
+	}
+	for _, keys := range [][]*SigningKey{k.previous, k.configured} {
+		for _, key := range keys {
+			if key.ID == id && (key.ExpiresAt == nil || key.ExpiresAt.After(now)) {
+				return key
+			}
+		}
+	}
+	return nil
+}
+
+// replace makes current the signing key, keeping previous for verification
+func (k *keyring) replace(current *SigningKey, previous []*SigningKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.current = current
+	k.previous = previous
+}
+
+// history returns the current key and the previous keys not expired at
+// now, newest first, then the configured ones
+func (k *keyring) history(now time.Time) []*SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys := []*SigningKey{k.current}
+	seen := map[string]bool{k.current.ID: true}
+	for _, previous := range [][]*SigningKey{k.previous, k.configured} {
+		for _, key := range previous {
+			if !seen[key.ID] && (key.ExpiresAt == nil || key.ExpiresAt.After(now)) {
+				seen[key.ID] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// rotate makes next the signing key. The replaced key verifies until
+// expiresAt; previous keys expired at now are dropped.
+func (k *keyring) rotate(next *SigningKey, expiresAt, now time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	replaced := *k.current
+	replaced.Signer = nil
+	replaced.ExpiresAt = &expiresAt
+	previous := []*SigningKey{&replaced}
+	for _, key := range k.previous {
+		if key.ID != replaced.ID && key.ExpiresAt != nil && key.ExpiresAt.After(now) {
+			previous = append(previous, key)
+		}
+	}
+	k.current = next
+	k.previous = previous
+}
+
+// loadPreviousSigningKeys reads LUMENLINK_CONFIG_SIGNING_PREVIOUS_PUBLIC_KEYS:
+// comma-separated base64 public keys that packs may still be signed with,
+// each optionally followed by "@" and an RFC 3339 time it expires at.
+func loadPreviousSigningKeys() ([]*SigningKey, error) {
+	var keys []*SigningKey
+	for _, entry := range strings.Split(os.Getenv("LUMENLINK_CONFIG_SIGNING_PREVIOUS_PUBLIC_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		encoded, expiry, hasExpiry := strings.Cut(entry, "@")
+		publicKey, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid previous config signing public key %q", encoded)
+		}
+		key := &SigningKey{ID: KeyID(publicKey), PublicKey: publicKey}
+		if hasExpiry {
+			expiresAt, err := time.Parse(time.RFC3339, expiry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expiry for previous config signing key %s: %w", key.ID, err)
+			}
+			key.ExpiresAt = &expiresAt
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// signingKey returns the key packs are signed with now
+func (s *ConfigService) signingKey() *SigningKey {
+	return s.keys.signing()
+}
+
+// signingKeyFor returns the key packs are signed with now in alg. Only
+// ed25519 keys are rotated; the P-256 key is configured.
+func (s *ConfigService) signingKeyFor(alg string) (*SigningKey, error) {
+	switch signatureAlg(alg) {
+	case SigAlgEd25519:
+		return s.signingKey(), nil
+	case SigAlgECDSAP256:
+		if s.p256 != nil {
+			return s.p256, nil
+		}
+	}
+	return nil, fmt.Errorf("signature algorithm %q: %w", alg, ErrSignatureAlgUnavailable)
+}
+
+// knownKey returns the current key, the P-256 key or a previous key with id
+// that has not expired at now, or nil
+func (s *ConfigService) knownKey(id string, now time.Time) *SigningKey {
+	if s.p256 != nil && s.p256.ID == id {
+		return s.p256
+	}
+	return s.keys.lookup(id, now)
+}
+
+// RotateKey generates a new signing key and makes it current. The key it
+// replaces keeps verifying for the grace period, so clients holding packs
+// signed with it keep working while they refresh. The new key is stored
+// encrypted; other replicas pick it up on their next refresh. Keys held by
+// a remote signer are rotated there instead.
+func (s *ConfigService) RotateKey(ctx context.Context) (*KeyRotation, error) {
+	if s.sealer == nil || s.db == nil {
+		return nil, ErrSigningKeysUnavailable
+	}
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	sealed, err := s.sealer.Seal(privateKey, []byte(KeyID(publicKey)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt signing key: %w", err)
+	}
+
+	// The replaced key endorses its successor, so clients pinning it can
+	// follow the rotation
+	previous := s.signingKey()
+	now := s.clock.Now()
+	next := &SigningKey{
+		ID:            KeyID(publicKey),
+		PublicKey:     publicKey,
+		Signer:        newKeySigner(privateKey),
+		ValidFrom:     now,
+		PreviousKeyID: previous.ID,
+	}
+	next.Endorsement, err = previous.Signer.Sign(KeyEndorsementMessage(next.ID, next.PublicKey, previous.ID, now))
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := now.Add(s.keyGrace)
+	if err := s.db.RotateSigningKey(
+		ctx,
+		&db.SigningKey{KeyID: previous.ID, PublicKey: previous.PublicKey},
+		&db.SigningKey{
+			KeyID:            next.ID,
+			PublicKey:        next.PublicKey,
+			SealedPrivateKey: sealed,
+			PreviousKeyID:    next.PreviousKeyID,
+			Endorsement:      next.Endorsement,
+		},
+		expiresAt,
+		now,
+	); err != nil {
+		return nil, err
+	}
+	// Within an audited change the key is used once its audit entry commits
+	s.db.AfterCommit(ctx, func() { s.keys.rotate(next, expiresAt, now) })
+
+	return &KeyRotation{
+		KeyID:             next.ID,
+		PublicKey:         next.PublicKey,
+		PreviousKeyID:     previous.ID,
+		PreviousExpiresAt: expiresAt,
+	}, nil
+}
+
+// RefreshSigningKeys loads the stored signing keys, so a key rotated on
+// another replica is used here too. Until a key has been rotated, or
+// without a data key, the keys from the environment stay in use.
+func (s *ConfigService) RefreshSigningKeys(ctx context.Context) error {
+	if s.sealer == nil || s.db == nil {
+		return nil
+	}
+	stored, err := s.db.GetActiveSigningKeys(ctx, s.clock.Now())
+	if err != nil {
+		return err
+	}
+	if len(stored) == 0 || stored[0].ExpiresAt != nil {
+		return nil
+	}
+
+	opened, err := s.sealer.Open(stored[0].SealedPrivateKey, []byte(stored[0].KeyID))
+	if err != nil || len(opened) != ed25519.PrivateKeySize {
+		return fmt.Errorf("failed to decrypt signing key %s", stored[0].KeyID)
+	}
+	current := storedSigningKey(stored[0])
+	current.Signer = newKeySigner(opened)
+	previous := make([]*SigningKey, 0, len(stored)-1)
+	for _, key := range stored[1:] {
+		previous = append(previous, storedSigningKey(key))
+	}
+	s.keys.replace(current, previous)
+	return nil
+}
+
+// storedSigningKey converts a stored key, without its private key
+func storedSigningKey(key *db.SigningKey) *SigningKey {
+	return &SigningKey{
+		ID:            key.KeyID,
+		PublicKey:     key.PublicKey,
+		ExpiresAt:     key.ExpiresAt,
+		ValidFrom:     key.CreatedAt,
+		PreviousKeyID: key.PreviousKeyID,
+		Endorsement:   key.Endorsement,
+	}
+}
+
+// StartSigningKeyRefresh refreshes the signing keys every interval until ctx
+// is done.
+func (s *ConfigService) StartSigningKeyRefresh(ctx context.Context, interval time.Duration) {
+	ticker := s.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if err := s.RefreshSigningKeys(ctx); err != nil {
+				log.Printf("config signing key refresh failed: %v", err)
+			}
+		}
+	}
+}
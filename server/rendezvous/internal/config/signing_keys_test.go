@@ -0,0 +1,234 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/crypt"
+	"rendezvous/internal/db"
+)
+
+// newRotatingConfigService creates a service able to rotate its signing key
+func newRotatingConfigService(t *testing.T, now time.Time) (*ConfigService, sqlmock.Sqlmock, *crypt.Sealer, *clock.Fake) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	sealer, err := crypt.NewSealer(bytes.Repeat([]byte{7}, crypt.KeySize))
+	if err != nil {
+		t.Fatalf("NewSealer: %v", err)
+	}
+	svc.sealer = sealer
+	fake := clock.NewFake(now)
+	svc.SetClock(fake)
+	return svc, mock, sealer, fake
+}
+
+func TestRotateKey_OldPacksVerifyDuringGrace(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc, mock, _, fake := newRotatingConfigService(t, now)
+	svc.keyGrace = 24 * time.Hour
+	old := svc.signingKey()
+
+	var oldPacks []*SignedConfigPack
+	for _, version := range []string{PackVersion1, PackVersion2} {
+		pack, err := svc.DeferredConfigPack("client-1", "us-east-1", "", version, "", 60, "token")
+		if err != nil {
+			t.Fatalf("DeferredConfigPack(%s): %v", version, err)
+		}
+		if pack.KeyID != old.ID || pack.Metadata["key_id"] != old.ID {
+			t.Fatalf("%s pack key: got %s, want %s", version, pack.KeyID, old.ID)
+		}
+		oldPacks = append(oldPacks, pack)
+	}
+	if received := rewire(t, oldPacks[1], nil); received.KeyID != old.ID {
+		t.Errorf("2.0 pack key over the wire: got %s, want %s", received.KeyID, old.ID)
+	}
+
+	expiresAt := now.Add(24 * time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM config_signing_keys WHERE expires_at <= \$1`).WithArgs(now).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE config_signing_keys SET expires_at = \$1 WHERE expires_at IS NULL`).WithArgs(expiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO config_signing_keys \(key_id, public_key, created_at, expires_at\)`).
+		WithArgs(old.ID, []byte(old.PublicKey), now, expiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO config_signing_keys \(key_id, public_key, sealed_private_key, created_at, previous_key_id, endorsement\)`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), now, old.ID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rotation, err := svc.RotateKey(context.Background())
+	if err != nil {
+		t.Fatalf("RotateKey: %v", err)
+	}
+	if rotation.KeyID == old.ID || rotation.KeyID != KeyID(rotation.PublicKey) ||
+		rotation.PreviousKeyID != old.ID || !rotation.PreviousExpiresAt.Equal(expiresAt) {
+		t.Errorf("rotation: got %+v", rotation)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// New packs are signed with the new key, and a cached 2.0 base signed
+	// with the old key is not reused
+	for _, version := range []string{PackVersion1, PackVersion2} {
+		pack, err := svc.DeferredConfigPack("client-2", "us-east-1", "", version, "", 60, "token")
+		if err != nil {
+			t.Fatalf("DeferredConfigPack(%s): %v", version, err)
+		}
+		if pack.KeyID != rotation.KeyID || !bytes.Equal(pack.PublicKey, rotation.PublicKey) {
+			t.Errorf("%s pack after rotation: key %s, want %s", version, pack.KeyID, rotation.KeyID)
+		}
+		if !svc.VerifyConfigPack(pack) || !VerifyPack(pack, rotation.PublicKey) {
+			t.Errorf("%s pack after rotation does not verify", version)
+		}
+	}
+
+	// Packs signed with the old key verify until its grace period ends
+	fake.Advance(23 * time.Hour)
+	for i, pack := range oldPacks {
+		if !svc.VerifyConfigPack(pack) {
+			t.Errorf("old pack %d rejected during the grace period", i)
+		}
+	}
+	fake.Advance(time.Hour)
+	for i, pack := range oldPacks {
+		if svc.VerifyConfigPack(pack) {
+			t.Errorf("old pack %d accepted after the grace period", i)
+		}
+	}
+}
+
+func TestRotateKey_Unavailable(t *testing.T) {
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	if _, err := svc.RotateKey(context.Background()); !errors.Is(err, ErrSigningKeysUnavailable) {
+		t.Errorf("RotateKey without a data key: got %v", err)
+	}
+}
+
+func TestRefreshSigningKeys(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc, mock, sealer, _ := newRotatingConfigService(t, now)
+	configured := svc.signingKey()
+	columns := []string{"key_id", "public_key", "sealed_private_key", "created_at", "expires_at", "previous_key_id", "endorsement"}
+
+	// Until a key is rotated, the configured key stays in use
+	mock.ExpectQuery(`FROM config_signing_keys`).WithArgs(now).WillReturnRows(sqlmock.NewRows(columns))
+	if err := svc.RefreshSigningKeys(context.Background()); err != nil {
+		t.Fatalf("RefreshSigningKeys: %v", err)
+	}
+	if svc.signingKey() != configured {
+		t.Error("configured key replaced with no stored key")
+	}
+
+	currentPublic, currentPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	previousPublic, previousPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	currentID, previousID := KeyID(currentPublic), KeyID(previousPublic)
+	sealed, err := sealer.Seal(currentPrivate, []byte(currentID))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	expiresAt := now.Add(time.Hour)
+	mock.ExpectQuery(`FROM config_signing_keys`).WithArgs(now).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(currentID, []byte(currentPublic), sealed, now, nil, previousID, []byte("endorsement")).
+		AddRow(previousID, []byte(previousPublic), nil, now.Add(-time.Hour), expiresAt, nil, nil))
+	if err := svc.RefreshSigningKeys(context.Background()); err != nil {
+		t.Fatalf("RefreshSigningKeys: %v", err)
+	}
+
+	current := svc.signingKey()
+	if current.ID != currentID || !bytes.Equal(current.Signer.(*keySigner).privateKey, currentPrivate) {
+		t.Fatalf("current key: got %s, want %s", current.ID, currentID)
+	}
+	previousPack := &SignedConfigPack{
+		Version:   PackVersion1,
+		ExpiresAt: expiresAt.Unix(),
+		Metadata:  map[string]interface{}{},
+		PublicKey: previousPublic,
+		KeyID:     previousID,
+	}
+	if previousPack.Signature, err = signJSON(newKeySigner(previousPrivate), previousPack); err != nil {
+		t.Fatalf("signJSON: %v", err)
+	}
+	if !svc.VerifyConfigPack(previousPack) {
+		t.Error("pack signed with the stored previous key rejected")
+	}
+	pack, err := svc.DeferredConfigPack("client-1", "us-east-1", "", PackVersion1, "", 60, "token")
+	if err != nil {
+		t.Fatalf("DeferredConfigPack: %v", err)
+	}
+	if pack.KeyID != currentID || !svc.VerifyConfigPack(pack) {
+		t.Errorf("pack after refresh: key %s, verifies %v", pack.KeyID, svc.VerifyConfigPack(pack))
+	}
+	if svc.knownKey(configured.ID, now) != nil {
+		t.Error("configured key still trusted after a stored rotation")
+	}
+
+	// A key that cannot be decrypted leaves the keys in use unchanged
+	mock.ExpectQuery(`FROM config_signing_keys`).WithArgs(now).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(previousID, []byte(previousPublic), []byte("garbage"), now, nil, nil, nil))
+	if err := svc.RefreshSigningKeys(context.Background()); err == nil {
+		t.Error("undecryptable key accepted")
+	}
+	if svc.signingKey().ID != currentID {
+		t.Error("keys changed after a failed refresh")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadPreviousSigningKeys(t *testing.T) {
+	expiring, _, _ := ed25519.GenerateKey(rand.Reader)
+	lasting, _, _ := ed25519.GenerateKey(rand.Reader)
+	t.Setenv("LUMENLINK_CONFIG_SIGNING_PREVIOUS_PUBLIC_KEYS",
+		base64.StdEncoding.EncodeToString(expiring)+"@2026-03-01T12:00:00Z, "+base64.StdEncoding.EncodeToString(lasting))
+	keys, err := loadPreviousSigningKeys()
+	if err != nil {
+		t.Fatalf("loadPreviousSigningKeys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != KeyID(expiring) || keys[0].ExpiresAt == nil ||
+		!keys[0].ExpiresAt.Equal(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)) ||
+		keys[1].ID != KeyID(lasting) || keys[1].ExpiresAt != nil {
+		t.Errorf("keys: got %+v", keys)
+	}
+
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	before := time.Date(2026, 3, 1, 11, 0, 0, 0, time.UTC)
+	if svc.knownKey(KeyID(expiring), before) == nil || svc.knownKey(KeyID(expiring), before.Add(time.Hour)) != nil {
+		t.Error("configured previous key does not expire")
+	}
+	if svc.knownKey(KeyID(lasting), before.AddDate(1, 0, 0)) == nil {
+		t.Error("configured previous key without an expiry not trusted")
+	}
+
+	for _, invalid := range []string{"not-base64!", base64.StdEncoding.EncodeToString(lasting) + "@tomorrow"} {
+		t.Setenv("LUMENLINK_CONFIG_SIGNING_PREVIOUS_PUBLIC_KEYS", invalid)
+		if _, err := NewConfigService(nil); err == nil {
+			t.Errorf("%q accepted", invalid)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"time"
+
+	"rendezvous/internal/db"
+	"rendezvous/internal/privacy"
+)
+
+// DefaultSubsetEpoch is how long a device keeps its gateway subset
+const DefaultSubsetEpoch = 24 * time.Hour
+
+// DefaultStrongSubsetSize is the subset size of strongly attested devices
+const DefaultStrongSubsetSize = 7
+
+// GatewaySubsets splits a region's gateways into buckets, bridge-style, and
+// assigns each device one bucket by a hash of its ID, the epoch and the
+// region, keyed with the allocation key so a censor cannot compute which
+// device IDs land in which bucket. Anyone can claim a device ID, so
+// unattested devices are assigned by their client network instead: every
+// request from a network learns the same bucket however many IDs it uses.
+// Assignments are stable within an epoch while the fleet is unchanged, and
+// reshuffle when the epoch rotates.
+type GatewaySubsets struct {
+	Epoch      time.Duration // 0 disables subsetting
+	StrongSize int           // Gateways in a strongly attested device's subset
+}
+
+func loadGatewaySubsets() GatewaySubsets {
+	return GatewaySubsets{
+		Epoch:      envDurationOrZero("LUMENLINK_GATEWAY_SUBSET_EPOCH", DefaultSubsetEpoch),
+		StrongSize: envInt("LUMENLINK_GATEWAY_SUBSET_STRONG_SIZE", DefaultStrongSubsetSize),
+	}
+}
+
+// size returns how many gateways a device's subset holds, which is also the
+// most its pack lists. Strongly attested devices are never given fewer than
+// maxGateways.
+func (g GatewaySubsets) size(attestationResult *AttestationResult, maxGateways int) int {
+	if attestationTier(attestationResult) == "strong" && g.StrongSize > maxGateways {
+		return g.StrongSize
+	}
+	return maxGateways
+}
+
+// epoch returns the epoch number at now
+func (g GatewaySubsets) epoch(now time.Time) int64 {
+	return now.Unix() / max(int64(g.Epoch/time.Second), 1)
+}
+
+// subsetMember returns what a device's subset is assigned by: its ID when it
+// attested, otherwise its client's network. Unattested clients whose address
+// is unknown all share one bucket.
+func subsetMember(clientID string, client ClientInfo, attestationResult *AttestationResult) (string, string) {
+	if attested(attestationResult) {
+		return "device", clientID
+	}
+	return "network", privacy.ClientNetwork(client.Address)
+}
+
+// gatewaySubset returns the bucket of gateways assigned to member, least
+// loaded first, with its index and the number of buckets. Gateways are
+// ordered by their hash and dealt round-robin into len/size buckets, so
+// every bucket holds at least size gateways when there are that many.
+func (s *ConfigService) gatewaySubset(
+	gateways []*db.Gateway,
+	kind, member, region string,
+	epoch int64,
+	size int,
+) ([]*db.Gateway, int, int) {
+	buckets := max(len(gateways)/size, 1)
+	if buckets == 1 {
+		return gateways, 0, 1
+	}
+
+	ordered := append([]*db.Gateway{}, gateways...)
+	ranks := make(map[string]uint64, len(ordered))
+	for _, gw := range ordered {
+		ranks[gw.ID] = subsetHash(s.allocationKey, epoch, region, "gateway", gw.ID)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ranks[ordered[i].ID] < ranks[ordered[j].ID] })
+
+	bucket := int(subsetHash(s.allocationKey, epoch, region, kind, member) % uint64(buckets))
+	subset := make([]*db.Gateway, 0, len(ordered)/buckets+1)
+	for i := bucket; i < len(ordered); i += buckets {
+		subset = append(subset, ordered[i])
+	}
+	s.sortByLoad(subset)
+	return subset, bucket, buckets
+}
+
+// subsetHash hashes the parts of a subset assignment, keyed with key
+func subsetHash(key []byte, epoch int64, region, kind, id string) uint64 {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(strconv.FormatInt(epoch, 10)))
+	for _, part := range []string{region, kind, id} {
+		h.Write([]byte{0})
+		h.Write([]byte(part))
+	}
+	return binary.BigEndian.Uint64(h.Sum(nil)[:8])
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+func subsetGateways(n int) []*db.Gateway {
+	gateways := make([]*db.Gateway, n)
+	for i := range gateways {
+		gateways[i] = &db.Gateway{ID: fmt.Sprintf("gw-%02d", i), IPAddress: fmt.Sprintf("203.0.%d.1", i)}
+	}
+	return gateways
+}
+
+func gatewayIDs(gateways []*db.Gateway) string {
+	ids := make([]string, len(gateways))
+	for i, gw := range gateways {
+		ids[i] = gw.ID
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func TestGatewaySubset(t *testing.T) {
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	gateways := subsetGateways(20)
+
+	subsets := map[string]string{}
+	seen := map[string]bool{}
+	for i := 0; i < 40; i++ {
+		device := fmt.Sprintf("device-%d", i)
+		subset, bucket, buckets := svc.gatewaySubset(gateways, "device", device, "us-east-1", 100, DefaultMaxPackGateways)
+		if buckets != 4 || bucket < 0 || bucket >= buckets || len(subset) != 5 {
+			t.Fatalf("%s: bucket %d of %d, %d gateways", device, bucket, buckets, len(subset))
+		}
+		// Stable within the epoch
+		again, _, _ := svc.gatewaySubset(gateways, "device", device, "us-east-1", 100, DefaultMaxPackGateways)
+		if gatewayIDs(again) != gatewayIDs(subset) {
+			t.Errorf("%s: subset changed within the epoch", device)
+		}
+		subsets[device] = gatewayIDs(subset)
+		for _, gw := range subset {
+			seen[gw.ID] = true
+		}
+	}
+
+	// Devices are spread over disjoint buckets covering the fleet
+	distinct := map[string]bool{}
+	for _, ids := range subsets {
+		distinct[ids] = true
+	}
+	if len(distinct) != 4 || len(seen) != len(gateways) {
+		t.Errorf("got %d distinct subsets covering %d gateways, want 4 covering %d", len(distinct), len(seen), len(gateways))
+	}
+
+	// The next epoch reshuffles the assignments
+	changed := 0
+	for device, ids := range subsets {
+		next, _, _ := svc.gatewaySubset(gateways, "device", device, "us-east-1", 101, DefaultMaxPackGateways)
+		if gatewayIDs(next) != ids {
+			changed++
+		}
+	}
+	if changed == 0 {
+		t.Error("no subset changed in the next epoch")
+	}
+
+	// Too few gateways for more than one bucket: everyone shares them
+	few := subsetGateways(7)
+	if subset, _, buckets := svc.gatewaySubset(few, "device", "device-1", "us-east-1", 100, DefaultMaxPackGateways); buckets != 1 || len(subset) != 7 {
+		t.Errorf("small fleet: %d buckets, %d gateways", buckets, len(subset))
+	}
+}
+
+func TestGatewaySubset_KeyedAndByNetwork(t *testing.T) {
+	svc, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	gateways := subsetGateways(20)
+
+	// Without the key the assignment cannot be computed: another key deals
+	// the buckets differently
+	other, err := NewConfigService(nil)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	other.allocationKey = []byte("another key")
+	differs := false
+	for i := 0; i < 20 && !differs; i++ {
+		device := fmt.Sprintf("device-%d", i)
+		ours, _, _ := svc.gatewaySubset(gateways, "device", device, "us-east-1", 100, DefaultMaxPackGateways)
+		theirs, _, _ := other.gatewaySubset(gateways, "device", device, "us-east-1", 100, DefaultMaxPackGateways)
+		differs = gatewayIDs(ours) != gatewayIDs(theirs)
+	}
+	if !differs {
+		t.Error("subsets do not depend on the allocation key")
+	}
+
+	// Unattested devices are assigned by network, so new device IDs from one
+	// network learn nothing new
+	unattested := &AttestationResult{Unattested: true}
+	subset := func(device, address string, result *AttestationResult) string {
+		kind, member := subsetMember(device, ClientInfo{Address: address}, result)
+		gws, _, _ := svc.gatewaySubset(gateways, kind, member, "us-east-1", 100, DefaultMaxPackGateways)
+		return gatewayIDs(gws)
+	}
+	want := subset("device-0", "198.51.100.7", unattested)
+	for i := 1; i < 20; i++ {
+		if got := subset(fmt.Sprintf("device-%d", i), fmt.Sprintf("198.51.100.%d", 7+i), unattested); got != want {
+			t.Fatalf("unattested device-%d on the same /24 got another subset", i)
+		}
+	}
+	networks := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		networks[subset("device-0", fmt.Sprintf("203.0.%d.1", 113+i), unattested)] = true
+	}
+	if len(networks) < 2 {
+		t.Error("unattested devices on different networks all share a subset")
+	}
+
+	// Attested devices keep their own subset wherever they connect from
+	strong := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	if subset("device-3", "198.51.100.7", strong) != subset("device-3", "203.0.113.9", strong) {
+		t.Error("attested device's subset follows its address")
+	}
+}
+
+func TestGatewaySubsets_Size(t *testing.T) {
+	subsets := GatewaySubsets{Epoch: time.Hour, StrongSize: 7}
+	tests := []struct {
+		result *AttestationResult
+		want   int
+	}{
+		{result: nil, want: DefaultMaxPackGateways},
+		{result: &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_DEVICE_INTEGRITY"}, want: DefaultMaxPackGateways},
+		{result: &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}, want: 7},
+	}
+	for _, tt := range tests {
+		if got := subsets.size(tt.result, DefaultMaxPackGateways); got != tt.want {
+			t.Errorf("size(%+v): got %d, want %d", tt.result, got, tt.want)
+		}
+	}
+
+	t.Setenv("LUMENLINK_GATEWAY_SUBSET_STRONG_SIZE", "3")
+	strong := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	if got := loadGatewaySubsets().size(strong, DefaultMaxPackGateways); got != DefaultMaxPackGateways {
+		t.Errorf("strong size below the pack size: got %d, want %d", got, DefaultMaxPackGateways)
+	}
+
+	t.Setenv("LUMENLINK_GATEWAY_SUBSET_EPOCH", "0")
+	if got := loadGatewaySubsets().Epoch; got != 0 {
+		t.Errorf("disabled epoch: got %v, want 0", got)
+	}
+}
+
+func TestGenerateConfigPack_GatewaySubsets(t *testing.T) {
+	ctx := context.Background()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	now := time.Now()
+	rows := sqlmock.NewRows(launchGatewayColumns)
+	for i := 0; i < 21; i++ {
+		rows.AddRow(fmt.Sprintf("gw-%02d", i), make([]byte, 32), fmt.Sprintf("203.0.%d.1", i), 443, "{masque}", "{gps}",
+			"us-east-1", 100, i, 100, "active", false, nil, "approved", nil, now, now, now)
+	}
+	// The region's gateways are queried once and shared by both packs
+	strong := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(rows)
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+
+	// Two devices in different buckets of seven for strongly attested devices
+	svc.SetClock(clock.NewFake(now))
+	epoch := svc.subsets.epoch(now)
+	bucket := func(device string) uint64 {
+		return subsetHash(svc.allocationKey, epoch, "us-east-1", "device", device) % 3
+	}
+	devices := []string{"device-0"}
+	for i := 1; len(devices) < 2; i++ {
+		if device := fmt.Sprintf("device-%d", i); bucket(device) != bucket(devices[0]) {
+			devices = append(devices, device)
+		}
+	}
+
+	seen := map[string]string{}
+	var baseKeys []string
+	for _, device := range devices {
+		pack, err := svc.GenerateConfigPack(ctx, device, "us-east-1", "", "", ClientInfo{}, PackVersion2, strong, nil)
+		if err != nil {
+			t.Fatalf("GenerateConfigPack(%s): %v", device, err)
+		}
+		if len(pack.Gateways) != svc.subsets.StrongSize {
+			t.Errorf("%s: got %d gateways, want %d", device, len(pack.Gateways), svc.subsets.StrongSize)
+		}
+		for _, gw := range pack.Gateways {
+			if other, ok := seen[gw.ID]; ok {
+				t.Errorf("%s given to %s and %s", gw.ID, other, device)
+			}
+			seen[gw.ID] = device
+		}
+		baseKeys = append(baseKeys, pack.baseKey)
+	}
+	if baseKeys[0] == baseKeys[1] {
+		t.Error("devices with different subsets share a base")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
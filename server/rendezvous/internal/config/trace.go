@@ -0,0 +1,102 @@
+package config
+
+import "rendezvous/internal/db"
+
+// DecisionTrace records the policy branches taken while building a pack, in
+// order. Only previews collect one; recording on a nil trace does nothing.
+type DecisionTrace struct {
+	Steps []TraceStep `json:"steps"`
+}
+
+// TraceStep is one policy decision
+type TraceStep struct {
+	Policy  string                 `json:"policy"`
+	Outcome string                 `json:"outcome"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Record appends a decision to the trace.
+func (t *DecisionTrace) Record(policy, outcome string, details map[string]interface{}) {
+	if t == nil {
+		return
+	}
+	t.Steps = append(t.Steps, TraceStep{Policy: policy, Outcome: outcome, Details: details})
+}
+
+// attestationTier names the trust tier the pack builder applies to an
+// attestation result.
+func attestationTier(result *AttestationResult) string {
+	switch {
+	case result == nil || result.Unattested:
+		return "unattested"
+	case !result.IsValid:
+		return "invalid"
+	case result.DeviceIntegrity == "BYPASS_ENABLED":
+		return "bypass"
+	case result.Probation:
+		return "limited"
+	case result.DeviceIntegrity == "MEETS_STRONG_INTEGRITY":
+		return "strong"
+	case result.DeviceIntegrity == "MEETS_DEVICE_INTEGRITY":
+		return "device"
+	case result.DeviceIntegrity == "MEETS_BASIC_INTEGRITY":
+		return "basic"
+	default:
+		return "valid"
+	}
+}
+
+// attested reports whether a device holds a valid attestation, made with
+// the request or vouched for by its attestation session
+func attested(result *AttestationResult) bool {
+	return result != nil && !result.Unattested && result.IsValid
+}
+
+// attestationRisk details an attested device's risk score for its trace;
+// the honeypot policy has already judged the device by it
+func attestationRisk(result *AttestationResult) map[string]interface{} {
+	if result == nil || result.Unattested {
+		return nil
+	}
+	return map[string]interface{}{"risk_score": result.RiskScore}
+}
+
+// traceGatewaySelection records the honeypot and diversity decisions for the
+// selected gateways.
+func traceGatewaySelection(
+	trace *DecisionTrace,
+	selected []*db.Gateway,
+	candidates int,
+	maxGateways int,
+	limits DiversityLimits,
+	includeHoneypots bool,
+	honeypotsAvailable int,
+) {
+	honeypotsSelected := 0
+	for _, gw := range selected {
+		if gw.IsHoneypot {
+			honeypotsSelected++
+		}
+	}
+	ratio := 0.0
+	if len(selected) > 0 {
+		ratio = float64(honeypotsSelected) / float64(len(selected))
+	}
+
+	outcome := "excluded"
+	if includeHoneypots {
+		outcome = "included"
+	}
+	trace.Record("honeypot", outcome, map[string]interface{}{
+		"available": honeypotsAvailable,
+		"selected":  honeypotsSelected,
+		"ratio":     ratio,
+	})
+	trace.Record("gateway_selection", "selected", map[string]interface{}{
+		"candidates":       candidates,
+		"selected":         len(selected),
+		"max_gateways":     maxGateways,
+		"max_per_operator": limits.MaxPerOperator,
+		"max_per_subnet":   limits.MaxPerSubnet,
+	})
+}
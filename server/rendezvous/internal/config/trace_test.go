@@ -0,0 +1,133 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+func TestPreviewConfigPack_MatchesGenerate(t *testing.T) {
+	profiles := []struct {
+		name        string
+		attestation *AttestationResult
+		honeypots   bool
+	}{
+		{"unattested", nil, true},
+		{"revoked", &AttestationResult{IsValid: false, Honeypots: true}, true},
+		{"strong", &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}, false},
+	}
+	for _, profile := range profiles {
+		t.Run(profile.name, func(t *testing.T) {
+			svc, err := NewConfigService(mustTestDBForPreview(t, 2, profile.honeypots))
+			if err != nil {
+				t.Fatalf("NewConfigService: %v", err)
+			}
+			ctx := context.Background()
+
+			generated, err := svc.GenerateConfigPack(ctx, "device-7", "us-east-1", "", "es", ClientInfo{}, "", profile.attestation, nil)
+			if err != nil {
+				t.Fatalf("GenerateConfigPack: %v", err)
+			}
+			previewed, trace, err := svc.PreviewConfigPack(ctx, "device-7", "us-east-1", "", "es", ClientInfo{}, "", profile.attestation)
+			if err != nil {
+				t.Fatalf("PreviewConfigPack: %v", err)
+			}
+
+			// Only the timestamp (and so the signature) may differ
+			if !svc.VerifyConfigPack(previewed) {
+				t.Error("preview pack signature does not verify")
+			}
+			generated.Timestamp, previewed.Timestamp = 0, 0
+			generated.Signature, previewed.Signature = nil, nil
+			generated.base, previewed.base = nil, nil // Carries the timestamp it was signed at
+			generated.baseKey = ""                    // Previews are never cached
+			if !reflect.DeepEqual(generated, previewed) {
+				t.Errorf("preview differs from generated pack:\ngenerated %+v\npreviewed %+v", generated, previewed)
+			}
+
+			if len(trace.Steps) == 0 || trace.Steps[0].Policy != "attestation_tier" {
+				t.Fatalf("trace should start with the attestation tier: %+v", trace.Steps)
+			}
+			if got := trace.Steps[0].Outcome; got != attestationTier(profile.attestation) {
+				t.Errorf("attestation_tier: got %s", got)
+			}
+			honeypot := findStep(t, trace, "honeypot")
+			wantOutcome := "excluded"
+			if profile.honeypots {
+				wantOutcome = "included"
+			}
+			if honeypot.Outcome != wantOutcome {
+				t.Errorf("honeypot outcome: got %s, want %s", honeypot.Outcome, wantOutcome)
+			}
+			if profile.honeypots && honeypot.Details["ratio"] != 1.0/3.0 {
+				t.Errorf("honeypot ratio: got %v, want 1/3", honeypot.Details["ratio"])
+			}
+			cohort := findStep(t, trace, "rollout_cohort")
+			if cohort.Outcome != "in_cohort" || cohort.Details["percentage"] != 100 {
+				t.Errorf("rollout_cohort: got %+v", cohort)
+			}
+		})
+	}
+}
+
+func findStep(t *testing.T, trace *DecisionTrace, policy string) TraceStep {
+	t.Helper()
+	for _, step := range trace.Steps {
+		if step.Policy == policy {
+			return step
+		}
+	}
+	t.Fatalf("no %s step in trace: %+v", policy, trace.Steps)
+	return TraceStep{}
+}
+
+// mustTestDBForPreview serves two gateways from different operators, one
+// honeypot when the profile gets honeypots, and a 100% scan_interval_120
+// rollout, for the given number of packs.
+func mustTestDBForPreview(t *testing.T, packs int, honeypots bool) *db.Database {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	columns := []string{
+		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
+		"created_at", "last_seen", "updated_at",
+	}
+	pubKey := make([]byte, ed25519.PublicKeySize)
+	rand.Read(pubKey)
+	now := time.Now()
+
+	for i := 0; i < packs; i++ {
+		expectOpenRegions(mock)
+		expectNotRevoked(mock)
+		mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("gw-a", pubKey, "192.0.2.10", 443, "{masque}", "{gps}",
+				"us-east-1", 100, 10, 100, "active", false, "op-a", "approved", nil, now, now, now).
+			AddRow("gw-b", pubKey, "198.51.100.10", 443, "{xtls}", "{gps}",
+				"us-east-1", 100, 50, 100, "active", false, "op-b", "approved", nil, now, now, now))
+		if honeypots {
+			mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(columns).
+				AddRow("hp-1", pubKey, "203.0.113.10", 443, "{masque}", "{gps}",
+					"us-east-1", 100, 90, 100, "active", true, nil, "approved", nil, now, now, now))
+		}
+		mock.ExpectQuery(`SELECT key, region, percentage`).WillReturnRows(
+			sqlmock.NewRows([]string{"key", "region", "percentage", "description", "created_at", "updated_at",
+				"schedule_start_at", "schedule_end_at", "schedule_start_percentage", "schedule_end_percentage",
+				"schedule_easing", "aborted_at"}).
+				AddRow("scan_interval_120", "", 100, nil, now, now, nil, nil, nil, nil, nil, nil),
+		)
+	}
+
+	return db.NewFromPool(sqlDB)
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"context"
+	"log"
+	"sort"
+)
+
+// Transport policy actions. Allow records that a transport was reviewed for a
+// country and stays advertised; it changes nothing in the pack.
+const (
+	TransportAllow  = "allow"
+	TransportDeny   = "deny"
+	TransportPrefer = "prefer"
+)
+
+// TransportPolicy is the set of transport overrides for one country
+type TransportPolicy struct {
+	Deny   map[string]bool
+	Prefer map[string]bool
+}
+
+// empty reports whether the policy leaves packs unchanged
+func (p TransportPolicy) empty() bool {
+	return len(p.Deny) == 0 && len(p.Prefer) == 0
+}
+
+// Apply strips denied transports from the pack's transport list and from each
+// gateway, and orders preferred transports first. Gateways left with no
+// transport are dropped. It returns false, and the inputs unchanged, when the
+// policy would leave no transport or no gateway to connect to.
+func (p TransportPolicy) Apply(gateways []GatewayInfo, transports []TransportConfig) ([]GatewayInfo, []TransportConfig, bool) {
+	keptTransports := make([]TransportConfig, 0, len(transports))
+	for _, transport := range transports {
+		if !p.Deny[transport.Type] {
+			keptTransports = append(keptTransports, transport)
+		}
+	}
+	if len(keptTransports) == 0 {
+		return gateways, transports, false
+	}
+	keptTransports = preferFirst(keptTransports, func(t TransportConfig) bool { return p.Prefer[t.Type] })
+
+	keptGateways := make([]GatewayInfo, 0, len(gateways))
+	for _, gw := range gateways {
+		types := make([]string, 0, len(gw.Transports))
+		for _, transport := range gw.Transports {
+			if !p.Deny[transport] {
+				types = append(types, transport)
+			}
+		}
+		if len(types) == 0 {
+			continue
+		}
+		gw.Transports = preferFirst(types, func(t string) bool { return p.Prefer[t] })
+		keptGateways = append(keptGateways, gw)
+	}
+	if len(gateways) > 0 && len(keptGateways) == 0 {
+		return gateways, transports, false
+	}
+	return keptGateways, keptTransports, true
+}
+
+// preferFirst moves the items matching preferred to the front, keeping the
+// order within each group.
+func preferFirst[T any](items []T, preferred func(T) bool) []T {
+	ordered := make([]T, 0, len(items))
+	for _, item := range items {
+		if preferred(item) {
+			ordered = append(ordered, item)
+		}
+	}
+	for _, item := range items {
+		if !preferred(item) {
+			ordered = append(ordered, item)
+		}
+	}
+	return ordered
+}
+
+// transportPolicyFor loads the overrides for country. An empty country is
+// unknown and has none.
+func (s *ConfigService) transportPolicyFor(ctx context.Context, country string) (TransportPolicy, error) {
+	policy := TransportPolicy{Deny: map[string]bool{}, Prefer: map[string]bool{}}
+	if country == "" {
+		return policy, nil
+	}
+	policies, err := s.db.GetTransportPolicies(ctx)
+	if err != nil {
+		return policy, err
+	}
+	for _, p := range policies {
+		if p.Country != country {
+			continue
+		}
+		switch p.Action {
+		case TransportDeny:
+			policy.Deny[p.Transport] = true
+		case TransportPrefer:
+			policy.Prefer[p.Transport] = true
+		}
+	}
+	return policy, nil
+}
+
+// applyTransportPolicies applies the country's transport overrides to a
+// pack's gateways and transports. A failed lookup, or a policy that would
+// leave nothing to connect with, serves the pack unfiltered.
+func (s *ConfigService) applyTransportPolicies(
+	ctx context.Context,
+	country string,
+	gateways []GatewayInfo,
+	transports []TransportConfig,
+	trace *DecisionTrace,
+) ([]GatewayInfo, []TransportConfig) {
+	if country == "" {
+		return gateways, transports
+	}
+	policy, err := s.transportPolicyFor(ctx, country)
+	if err != nil {
+		log.Printf("transport policies unavailable, serving unfiltered transports: %v", err)
+		trace.Record("transport_policy", "lookup_failed", map[string]interface{}{"error": err.Error()})
+		return gateways, transports
+	}
+	if policy.empty() {
+		trace.Record("transport_policy", "none", map[string]interface{}{"country": country})
+		return gateways, transports
+	}
+
+	filteredGateways, filteredTransports, ok := policy.Apply(gateways, transports)
+	details := map[string]interface{}{
+		"country": country,
+		"denied":  transportNames(policy.Deny),
+		"prefer":  transportNames(policy.Prefer),
+	}
+	if !ok {
+		log.Printf("transport policy for %s would strip every transport, serving unfiltered", country)
+		trace.Record("transport_policy", "fallback_unfiltered", details)
+		return gateways, transports
+	}
+	details["gateways_dropped"] = len(gateways) - len(filteredGateways)
+	trace.Record("transport_policy", "applied", details)
+	return filteredGateways, filteredTransports
+}
+
+// transportNames lists a policy set's transports in order
+func transportNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
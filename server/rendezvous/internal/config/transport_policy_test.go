@@ -0,0 +1,192 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+func transportTypes(transports []TransportConfig) []string {
+	types := make([]string, len(transports))
+	for i, transport := range transports {
+		types[i] = transport.Type
+	}
+	return types
+}
+
+func TestTransportPolicy_Apply(t *testing.T) {
+	transports := []TransportConfig{{Type: "masque"}, {Type: "xtls"}, {Type: "parasite"}, {Type: "ssh"}}
+	gateways := []GatewayInfo{
+		{ID: "a", Transports: []string{"masque", "xtls"}},
+		{ID: "b", Transports: []string{"xtls"}},
+		{ID: "c", Transports: []string{"parasite"}},
+	}
+
+	tests := []struct {
+		name           string
+		policy         TransportPolicy
+		wantOK         bool
+		wantTransports []string
+		wantGateways   map[string][]string
+	}{
+		{
+			name:           "allow changes nothing",
+			policy:         TransportPolicy{},
+			wantOK:         true,
+			wantTransports: []string{"masque", "xtls", "parasite", "ssh"},
+			wantGateways:   map[string][]string{"a": {"masque", "xtls"}, "b": {"xtls"}, "c": {"parasite"}},
+		},
+		{
+			name:           "deny strips the transport and gateways left without one",
+			policy:         TransportPolicy{Deny: map[string]bool{"xtls": true}},
+			wantOK:         true,
+			wantTransports: []string{"masque", "parasite", "ssh"},
+			wantGateways:   map[string][]string{"a": {"masque"}, "c": {"parasite"}},
+		},
+		{
+			name:           "prefer orders first",
+			policy:         TransportPolicy{Prefer: map[string]bool{"ssh": true, "xtls": true}},
+			wantOK:         true,
+			wantTransports: []string{"xtls", "ssh", "masque", "parasite"},
+			wantGateways:   map[string][]string{"a": {"xtls", "masque"}, "b": {"xtls"}, "c": {"parasite"}},
+		},
+		{
+			name:   "denying every transport falls back",
+			policy: TransportPolicy{Deny: map[string]bool{"masque": true, "xtls": true, "parasite": true, "ssh": true}},
+			wantOK: false,
+		},
+		{
+			name:   "denying every gateway's transports falls back",
+			policy: TransportPolicy{Deny: map[string]bool{"masque": true, "xtls": true, "parasite": true}},
+			wantOK: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotGateways, gotTransports, ok := tt.policy.Apply(gateways, transports)
+			if ok != tt.wantOK {
+				t.Fatalf("Apply ok: got %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				if !reflect.DeepEqual(gotGateways, gateways) || !reflect.DeepEqual(gotTransports, transports) {
+					t.Error("fallback must return the inputs unfiltered")
+				}
+				return
+			}
+			if got := transportTypes(gotTransports); !reflect.DeepEqual(got, tt.wantTransports) {
+				t.Errorf("transports: got %v, want %v", got, tt.wantTransports)
+			}
+			got := map[string][]string{}
+			for _, gw := range gotGateways {
+				got[gw.ID] = gw.Transports
+			}
+			if !reflect.DeepEqual(got, tt.wantGateways) {
+				t.Errorf("gateways: got %v, want %v", got, tt.wantGateways)
+			}
+		})
+	}
+	if !reflect.DeepEqual(gateways[0].Transports, []string{"masque", "xtls"}) {
+		t.Errorf("Apply modified its input: %v", gateways[0].Transports)
+	}
+}
+
+// transportPolicyService returns a config service over a mock database
+// serving one xtls and parasite gateway and the given transport policies.
+func transportPolicyService(t *testing.T, policies [][3]string, policyErr error) *ConfigService {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	svc, err := NewConfigService(db.NewFromPool(sqlDB))
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+
+	now := time.Now()
+	expectOpenRegions(mock)
+	expectNotRevoked(mock)
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(sqlmock.NewRows(launchGatewayColumns).
+		AddRow("gw-1", []byte("gateway-public-key"), "198.51.100.7", 443, "{xtls,parasite}", "{}",
+			"me-south-1", 100, 1, 100, "active", false, nil, "approved", nil, now, now, now))
+	if policyErr != nil {
+		mock.ExpectQuery(`FROM transport_policies`).WillReturnError(policyErr)
+		return svc
+	}
+	rows := sqlmock.NewRows([]string{"country", "transport", "action", "updated_at"})
+	for _, p := range policies {
+		rows.AddRow(p[0], p[1], p[2], now)
+	}
+	mock.ExpectQuery(`FROM transport_policies`).WillReturnRows(rows)
+	return svc
+}
+
+func TestGenerateConfigPack_TransportPolicyByCountry(t *testing.T) {
+	svc := transportPolicyService(t, [][3]string{
+		{"IR", "xtls", TransportDeny},
+		{"IR", "ssh", TransportPrefer},
+		{"IR", "masque", TransportAllow},
+		{"TM", "parasite", TransportDeny},
+	}, nil)
+	strong := &AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}
+
+	pack, trace, err := svc.PreviewConfigPack(context.Background(), "client-1", "me-south-1", "IR", "", ClientInfo{}, "", strong)
+	if err != nil {
+		t.Fatalf("PreviewConfigPack: %v", err)
+	}
+	if got, want := transportTypes(pack.Transports), []string{"ssh", "masque", "parasite"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("transports: got %v, want %v", got, want)
+	}
+	if len(pack.Gateways) != 1 || !reflect.DeepEqual(pack.Gateways[0].Transports, []string{"parasite"}) {
+		t.Errorf("gateways: got %+v, want gw-1 with parasite only", pack.Gateways)
+	}
+	if step := findStep(t, trace, "transport_policy"); step.Outcome != "applied" {
+		t.Errorf("transport_policy outcome: got %q, want applied", step.Outcome)
+	}
+	if !svc.VerifyConfigPack(pack) {
+		t.Error("filtered pack must verify")
+	}
+}
+
+func TestGenerateConfigPack_TransportPolicyFallsBackUnfiltered(t *testing.T) {
+	// Denying both of the only gateway's transports would leave nothing to
+	// connect to, so the pack is served as if there were no policy
+	svc := transportPolicyService(t, [][3]string{
+		{"IR", "xtls", TransportDeny},
+		{"IR", "parasite", TransportDeny},
+	}, nil)
+
+	pack, trace, err := svc.PreviewConfigPack(context.Background(), "client-1", "me-south-1", "IR", "", ClientInfo{}, "",
+		&AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"})
+	if err != nil {
+		t.Fatalf("PreviewConfigPack: %v", err)
+	}
+	if got := transportTypes(pack.Transports); len(got) != 4 {
+		t.Errorf("transports: got %v, want all four", got)
+	}
+	if len(pack.Gateways) != 1 || !reflect.DeepEqual(pack.Gateways[0].Transports, []string{"xtls", "parasite"}) {
+		t.Errorf("gateways: got %+v, want gw-1 unfiltered", pack.Gateways)
+	}
+	if step := findStep(t, trace, "transport_policy"); step.Outcome != "fallback_unfiltered" {
+		t.Errorf("transport_policy outcome: got %q, want fallback_unfiltered", step.Outcome)
+	}
+}
+
+func TestGenerateConfigPack_TransportPolicyLookupFailsOpen(t *testing.T) {
+	svc := transportPolicyService(t, nil, errors.New("connection reset"))
+
+	pack, err := svc.GenerateConfigPack(context.Background(), "client-1", "me-south-1", "IR", "", ClientInfo{}, "",
+		&AttestationResult{IsValid: true, DeviceIntegrity: "MEETS_STRONG_INTEGRITY"}, nil)
+	if err != nil {
+		t.Fatalf("GenerateConfigPack: %v", err)
+	}
+	if got := transportTypes(pack.Transports); len(got) != 4 {
+		t.Errorf("transports: got %v, want all four", got)
+	}
+}
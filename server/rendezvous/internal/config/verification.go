@@ -0,0 +1,121 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/metrics"
+	"rendezvous/internal/notify"
+)
+
+// maxTrackedKeyPairs bounds the distinct key pairs tracked for alerting; key
+// IDs come from clients and are not trusted.
+const maxTrackedKeyPairs = 64
+
+// Reasons a pack failed verification, as counted in
+// lumenlink_pack_verification_failures_total. Key IDs are left out of the
+// metric, since clients choose them; alerts and the admin report name them.
+const (
+	// VerificationKeyMismatch is a pack signed by a key other than the one
+	// the client trusts, as after a bad rotation
+	VerificationKeyMismatch = "key_mismatch"
+	// VerificationSignatureInvalid is a pack whose signature fails under
+	// the key the client trusts, which also signed it
+	VerificationSignatureInvalid = "signature_invalid"
+)
+
+// VerificationMonitor aggregates client-reported pack verification failures
+// per (trusted key, pack key) pair. A bad key rotation shows up as one pair
+// failing for many clients, so each pair alerts once per window when it
+// crosses the threshold.
+type VerificationMonitor struct {
+	alerter   *notify.ThresholdAlerter
+	notifier  notify.Notifier
+	threshold int
+	window    time.Duration
+	clock     clock.Clock
+}
+
+// NewVerificationMonitor creates a monitor using LUMENLINK_PACK_VERIFY_ALERT_THRESHOLD
+// (default 50) and LUMENLINK_PACK_VERIFY_ALERT_WINDOW (default 10m).
+func NewVerificationMonitor(notifier notify.Notifier) *VerificationMonitor {
+	threshold := envInt("LUMENLINK_PACK_VERIFY_ALERT_THRESHOLD", 50)
+	window := envDuration("LUMENLINK_PACK_VERIFY_ALERT_WINDOW", 10*time.Minute)
+	return &VerificationMonitor{
+		alerter:   notify.NewThresholdAlerter(threshold, window, maxTrackedKeyPairs),
+		notifier:  notifier,
+		threshold: threshold,
+		window:    window,
+		clock:     clock.Real{},
+	}
+}
+
+// SetClock replaces the time source, including the alert window; it is
+// intended for tests.
+func (m *VerificationMonitor) SetClock(c clock.Clock) {
+	m.clock = c
+	m.alerter.SetClock(c)
+}
+
+// RecordFailure records one verification failure and returns true if it
+// triggered an alert. The alert is delivered in the background.
+func (m *VerificationMonitor) RecordFailure(trustedKeyID, packKeyID string) bool {
+	reason := VerificationSignatureInvalid
+	if trustedKeyID != packKeyID {
+		reason = VerificationKeyMismatch
+	}
+	metrics.PackVerificationFailures.WithLabelValues(reason).Inc()
+
+	pair, count, fire := m.alerter.Observe(trustedKeyID + ":" + packKeyID)
+
+	if !fire {
+		return false
+	}
+
+	alert := notify.Alert{
+		Kind: "pack_verification_failures",
+		Key:  pair,
+		Message: fmt.Sprintf("%d clients failed to verify config packs signed by key %s (trusted key %s) within %s",
+			count, packKeyID, trustedKeyID, m.window),
+		Details: map[string]interface{}{
+			"trusted_key_id": trustedKeyID,
+			"pack_key_id":    packKeyID,
+			"count":          count,
+			"threshold":      m.threshold,
+			"window":         m.window.String(),
+		},
+		FiredAt: m.clock.Now(),
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := m.notifier.Notify(ctx, alert); err != nil {
+			log.Printf("pack verification alert for %s failed: %v", pair, err)
+		}
+	}()
+	return true
+}
+
+func envDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// envDurationOrZero is envDuration for settings where 0 turns a feature off
+func envDurationOrZero(key string, defaultValue time.Duration) time.Duration {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/metrics"
+	"rendezvous/internal/notify"
+)
+
+type recordingNotifier struct {
+	alerts chan notify.Alert
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, alert notify.Alert) error {
+	n.alerts <- alert
+	return nil
+}
+
+func TestVerificationMonitor_BadRotationAlertsOncePerWindow(t *testing.T) {
+	t.Setenv("LUMENLINK_PACK_VERIFY_ALERT_THRESHOLD", "20")
+	t.Setenv("LUMENLINK_PACK_VERIFY_ALERT_WINDOW", "10m")
+
+	notifier := &recordingNotifier{alerts: make(chan notify.Alert, 10)}
+	monitor := NewVerificationMonitor(notifier)
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	monitor.SetClock(fake)
+
+	const trusted, rotated = "0123456789abcdef", "fedcba9876543210"
+
+	// A handful of unrelated failures stays below the threshold
+	for i := 0; i < 5; i++ {
+		if monitor.RecordFailure(trusted, trusted) {
+			t.Fatal("healthy pair should not alert")
+		}
+	}
+
+	// Clients pinned to the old key start rejecting packs signed by the new one
+	alerts := 0
+	for i := 0; i < 200; i++ {
+		if monitor.RecordFailure(trusted, rotated) {
+			alerts++
+		}
+	}
+	if alerts != 1 {
+		t.Fatalf("alerts in first window: got %d, want 1", alerts)
+	}
+
+	select {
+	case alert := <-notifier.alerts:
+		if alert.Kind != "pack_verification_failures" || alert.Key != trusted+":"+rotated {
+			t.Errorf("alert: got %+v", alert)
+		}
+		if alert.Details["count"] != 20 {
+			t.Errorf("alert count: got %v, want 20", alert.Details["count"])
+		}
+	case <-time.After(time.Second):
+		t.Fatal("alert was not delivered")
+	}
+
+	// Still failing in the next window: alert again, once
+	fake.Advance(10 * time.Minute)
+	alerts = 0
+	for i := 0; i < 200; i++ {
+		if monitor.RecordFailure(trusted, rotated) {
+			alerts++
+		}
+	}
+	if alerts != 1 {
+		t.Errorf("alerts in second window: got %d, want 1", alerts)
+	}
+	select {
+	case <-notifier.alerts:
+	case <-time.After(time.Second):
+		t.Fatal("second window alert was not delivered")
+	}
+	select {
+	case alert := <-notifier.alerts:
+		t.Errorf("unexpected extra alert: %+v", alert)
+	default:
+	}
+}
+
+func TestVerificationMonitor_CountsByReason(t *testing.T) {
+	monitor := NewVerificationMonitor(&recordingNotifier{alerts: make(chan notify.Alert, 10)})
+	mismatches := metrics.PackVerificationFailures.WithLabelValues(VerificationKeyMismatch)
+	invalid := metrics.PackVerificationFailures.WithLabelValues(VerificationSignatureInvalid)
+	mismatchesBefore, invalidBefore := testutil.ToFloat64(mismatches), testutil.ToFloat64(invalid)
+
+	// Key IDs come from clients, so any number of them adds no series
+	for i := 0; i < 100; i++ {
+		monitor.RecordFailure(fmt.Sprintf("%016x", i), "fedcba9876543210")
+	}
+	monitor.RecordFailure("fedcba9876543210", "fedcba9876543210")
+	if got := testutil.CollectAndCount(metrics.PackVerificationFailures); got != 2 {
+		t.Errorf("series: got %d, want one per reason", got)
+	}
+	if got := testutil.ToFloat64(mismatches) - mismatchesBefore; got != 100 {
+		t.Errorf("key mismatches: got %v, want 100", got)
+	}
+	if got := testutil.ToFloat64(invalid) - invalidBefore; got != 1 {
+		t.Errorf("invalid signatures: got %v, want 1", got)
+	}
+}
+
+func TestKeyID(t *testing.T) {
+	id := KeyID(make([]byte, 32))
+	if len(id) != 16 {
+		t.Errorf("KeyID length: got %d, want 16", len(id))
+	}
+	if KeyID(make([]byte, 32)) != id {
+		t.Error("KeyID should be deterministic")
+	}
+}
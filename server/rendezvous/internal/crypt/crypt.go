@@ -0,0 +1,82 @@
+// Package crypt encrypts small secrets for storage with a data key held
+// outside the database, using AES-256-GCM. Each ciphertext is bound to
+// associated data naming what it belongs to, so a ciphertext copied to
+// another row fails to open.
+package crypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySize is the data key length: AES-256
+const KeySize = 32
+
+// ErrDecrypt is returned when a ciphertext was altered, bound to different
+// associated data or sealed under another key
+var ErrDecrypt = errors.New("crypt: message authentication failed")
+
+// Sealer encrypts and decrypts with one data key
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer creates a sealer for a KeySize-byte data key
+func NewSealer(key []byte) (*Sealer, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("crypt: data key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// LoadSealerFromEnv creates a sealer from the base64 data key in
+// LUMENLINK_DATA_KEY. It returns nil when the variable is unset.
+func LoadSealerFromEnv() (*Sealer, error) {
+	encoded := strings.TrimSpace(os.Getenv("LUMENLINK_DATA_KEY"))
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LUMENLINK_DATA_KEY encoding: %w", err)
+	}
+	return NewSealer(key)
+}
+
+// Seal encrypts plaintext bound to associatedData. The result is a random
+// nonce followed by the ciphertext and tag.
+func (s *Sealer) Seal(plaintext, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(plaintext)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("crypt: failed to generate nonce: %w", err)
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+// Open decrypts a Seal result with the same associatedData. Any mismatch
+// returns ErrDecrypt.
+func (s *Sealer) Open(sealed, associatedData []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize()+s.aead.Overhead() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, associatedData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
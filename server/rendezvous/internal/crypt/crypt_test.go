@@ -0,0 +1,87 @@
+package crypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func testSealer(t *testing.T, fill byte) *Sealer {
+	t.Helper()
+	sealer, err := NewSealer(bytes.Repeat([]byte{fill}, KeySize))
+	if err != nil {
+		t.Fatalf("NewSealer: %v", err)
+	}
+	return sealer
+}
+
+func TestSealOpen(t *testing.T) {
+	sealer := testSealer(t, 1)
+	plaintext := []byte("obfuscation seed")
+	sealed, err := sealer.Seal(plaintext, []byte("gateway-a"))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Fatal("sealed output contains the plaintext")
+	}
+	again, _ := sealer.Seal(plaintext, []byte("gateway-a"))
+	if bytes.Equal(sealed, again) {
+		t.Error("sealing twice gave the same output; nonces must be random")
+	}
+
+	opened, err := sealer.Open(sealed, []byte("gateway-a"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open: got %q, want %q", opened, plaintext)
+	}
+}
+
+func TestOpen_Rejects(t *testing.T) {
+	sealer := testSealer(t, 1)
+	sealed, err := sealer.Seal([]byte("obfuscation seed"), []byte("gateway-a"))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 0x01
+
+	tests := []struct {
+		name   string
+		sealer *Sealer
+		sealed []byte
+		ad     string
+	}{
+		{"other associated data", sealer, sealed, "gateway-b"},
+		{"other key", testSealer(t, 2), sealed, "gateway-a"},
+		{"tampered", sealer, tampered, "gateway-a"},
+		{"truncated", sealer, sealed[:10], "gateway-a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.sealer.Open(tt.sealed, []byte(tt.ad)); !errors.Is(err, ErrDecrypt) {
+				t.Errorf("Open: got %v, want ErrDecrypt", err)
+			}
+		})
+	}
+}
+
+func TestLoadSealerFromEnv(t *testing.T) {
+	t.Setenv("LUMENLINK_DATA_KEY", "")
+	if sealer, err := LoadSealerFromEnv(); sealer != nil || err != nil {
+		t.Errorf("unset: got %v, %v; want nil, nil", sealer, err)
+	}
+
+	t.Setenv("LUMENLINK_DATA_KEY", base64.StdEncoding.EncodeToString([]byte("too short")))
+	if _, err := LoadSealerFromEnv(); err == nil {
+		t.Error("short key: want an error")
+	}
+
+	t.Setenv("LUMENLINK_DATA_KEY", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, KeySize)))
+	if sealer, err := LoadSealerFromEnv(); sealer == nil || err != nil {
+		t.Errorf("valid key: got %v, %v", sealer, err)
+	}
+}
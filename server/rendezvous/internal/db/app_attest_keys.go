@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"rendezvous/internal/apperr"
+)
+
+// AppAttestKey is the public key of a verified iOS App Attest attestation
+type AppAttestKey struct {
+	KeyID      string
+	DeviceID   string
+	PublicKey  []byte // Uncompressed P-256 point
+	Receipt    []byte
+	Counter    uint32 // Highest assertion counter accepted
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+
+	RiskMetric         sql.NullInt64 // Apple's fraud risk metric from the latest refreshed receipt
+	ReceiptRefreshedAt sql.NullTime
+}
+
+// ErrAppAttestKeyNotFound is returned when a device has no key with an ID
+var ErrAppAttestKeyNotFound = apperr.New(apperr.ErrNotFound, "app_attest_key_not_found", "app attest key not found")
+
+// ErrAppAttestKeyConflict is returned when a key ID is already registered
+// to another device
+var ErrAppAttestKeyConflict = apperr.New(apperr.ErrConflict, "app_attest_key_conflict", "app attest key registered to another device")
+
+// StoreAppAttestKey stores the key of a verified attestation. Attesting the
+// same key again replaces its public key and receipt but keeps its counter,
+// so earlier assertions cannot be replayed. Under data minimization nothing
+// is stored, as a key recognises its device across requests.
+func (d *Database) StoreAppAttestKey(ctx context.Context, key *AppAttestKey) error {
+	if !d.persistence.TrackDevices() {
+		return nil
+	}
+	result, err := d.pool.ExecContext(ctx, `
+		INSERT INTO app_attest_keys (key_id, device_id, public_key, receipt)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key_id) DO UPDATE
+		SET public_key = EXCLUDED.public_key, receipt = EXCLUDED.receipt
+		WHERE app_attest_keys.device_id = EXCLUDED.device_id
+	`, key.KeyID, key.DeviceID, key.PublicKey, key.Receipt)
+	if err != nil {
+		return fmt.Errorf("failed to store app attest key: %w", classify(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to store app attest key: %w", classify(err))
+	}
+	if rows == 0 {
+		return ErrAppAttestKeyConflict
+	}
+	return nil
+}
+
+// GetAppAttestKeyDevice returns the device a key ID is bound to
+func (d *Database) GetAppAttestKeyDevice(ctx context.Context, keyID string) (string, error) {
+	var deviceID string
+	err := d.pool.QueryRowContext(ctx, `SELECT device_id FROM app_attest_keys WHERE key_id = $1`, keyID).Scan(&deviceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrAppAttestKeyNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get app attest key device: %w", classify(err))
+	}
+	return deviceID, nil
+}
+
+// GetAppAttestKey returns a device's key by ID
+func (d *Database) GetAppAttestKey(ctx context.Context, deviceID, keyID string) (*AppAttestKey, error) {
+	var key AppAttestKey
+	var counter int64
+	err := d.pool.QueryRowContext(ctx, `
+		SELECT key_id, device_id, public_key, receipt, counter, created_at, last_used_at,
+		       risk_metric, receipt_refreshed_at
+		FROM app_attest_keys WHERE key_id = $1 AND device_id = $2
+	`, keyID, deviceID).Scan(&key.KeyID, &key.DeviceID, &key.PublicKey, &key.Receipt, &counter, &key.CreatedAt, &key.LastUsedAt,
+		&key.RiskMetric, &key.ReceiptRefreshedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAppAttestKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app attest key: %w", classify(err))
+	}
+	key.Counter = uint32(counter)
+	return &key, nil
+}
+
+// AdvanceAppAttestCounter records an accepted assertion counter for a key.
+// It reports false if the stored counter had already reached counter, so of
+// two concurrent uses of one assertion only one is accepted.
+func (d *Database) AdvanceAppAttestCounter(ctx context.Context, deviceID, keyID string, counter uint32) (bool, error) {
+	result, err := d.pool.ExecContext(ctx, `
+		UPDATE app_attest_keys SET counter = $3, last_used_at = NOW()
+		WHERE key_id = $1 AND device_id = $2 AND counter < $3
+	`, keyID, deviceID, int64(counter))
+	if err != nil {
+		return false, fmt.Errorf("failed to advance app attest counter: %w", classify(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to advance app attest counter: %w", classify(err))
+	}
+	return rows == 1, nil
+}
+
+// ListAppAttestReceiptsDue returns up to limit keys whose receipt was never
+// refreshed or was last refreshed before before, least recently refreshed
+// first. Only the key and device IDs and the receipt are filled in.
+func (d *Database) ListAppAttestReceiptsDue(ctx context.Context, before time.Time, limit int) ([]AppAttestKey, error) {
+	rows, err := d.pool.QueryContext(ctx, `
+		SELECT key_id, device_id, receipt
+		FROM app_attest_keys
+		WHERE receipt IS NOT NULL AND (receipt_refreshed_at IS NULL OR receipt_refreshed_at < $1)
+		ORDER BY receipt_refreshed_at NULLS FIRST
+		LIMIT $2
+	`, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list app attest receipts: %w", classify(err))
+	}
+	defer rows.Close()
+
+	var keys []AppAttestKey
+	for rows.Next() {
+		var key AppAttestKey
+		if err := rows.Scan(&key.KeyID, &key.DeviceID, &key.Receipt); err != nil {
+			return nil, fmt.Errorf("failed to scan app attest receipt: %w", classify(err))
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list app attest receipts: %w", classify(err))
+	}
+	return keys, nil
+}
+
+// UpdateAppAttestReceipt records a refresh of a key's receipt at
+// refreshedAt. A nil receipt keeps the stored one, as when Apple has no
+// newer receipt, and an invalid riskMetric keeps the stored metric.
+func (d *Database) UpdateAppAttestReceipt(ctx context.Context, deviceID, keyID string, receipt []byte, riskMetric sql.NullInt64, refreshedAt time.Time) error {
+	var newReceipt interface{} // A nil slice would be sent as an empty bytea, not NULL
+	if receipt != nil {
+		newReceipt = receipt
+	}
+	result, err := d.pool.ExecContext(ctx, `
+		UPDATE app_attest_keys
+		SET receipt = COALESCE($3, receipt), risk_metric = COALESCE($4, risk_metric), receipt_refreshed_at = $5
+		WHERE key_id = $1 AND device_id = $2
+	`, keyID, deviceID, newReceipt, riskMetric, refreshedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update app attest receipt: %w", classify(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update app attest receipt: %w", classify(err))
+	}
+	if rows == 0 {
+		return ErrAppAttestKeyNotFound
+	}
+	return nil
+}
+
+// GetDeviceRiskMetric returns the highest fraud risk metric Apple reported
+// for any of a device's App Attest keys, and 0 if none has been reported.
+// Under data minimization no keys are stored, so it is always 0.
+func (d *Database) GetDeviceRiskMetric(ctx context.Context, deviceID string) (int, error) {
+	if !d.persistence.TrackDevices() {
+		return 0, nil
+	}
+	var metric int
+	err := d.pool.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(risk_metric), 0) FROM app_attest_keys WHERE device_id = $1
+	`, deviceID).Scan(&metric)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get device risk metric: %w", classify(err))
+	}
+	return metric, nil
+}
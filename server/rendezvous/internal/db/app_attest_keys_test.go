@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAppAttestKeys_BoundToDevice(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping app attest key tests")
+	}
+	if err := RunMigrations(databaseURL); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	ctx := context.Background()
+	database, err := New(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer database.Close()
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	keyID := hex.EncodeToString(b)
+	defer database.Pool().ExecContext(ctx, `DELETE FROM app_attest_keys WHERE key_id = $1`, keyID)
+
+	key := &AppAttestKey{KeyID: keyID, DeviceID: "device-1", PublicKey: []byte{4, 1}, Receipt: []byte("receipt")}
+	if err := database.StoreAppAttestKey(ctx, key); err != nil {
+		t.Fatalf("StoreAppAttestKey: %v", err)
+	}
+	if advanced, err := database.AdvanceAppAttestCounter(ctx, "device-1", keyID, 3); err != nil || !advanced {
+		t.Fatalf("AdvanceAppAttestCounter: %v, %v", advanced, err)
+	}
+
+	// Re-attesting the key keeps its counter
+	key.PublicKey = []byte{4, 2}
+	if err := database.StoreAppAttestKey(ctx, key); err != nil {
+		t.Fatalf("StoreAppAttestKey again: %v", err)
+	}
+	got, err := database.GetAppAttestKey(ctx, "device-1", keyID)
+	if err != nil {
+		t.Fatalf("GetAppAttestKey: %v", err)
+	}
+	if got.Counter != 3 || string(got.PublicKey) != string(key.PublicKey) {
+		t.Errorf("got counter %d, public key %x", got.Counter, got.PublicKey)
+	}
+	if advanced, _ := database.AdvanceAppAttestCounter(ctx, "device-1", keyID, 3); advanced {
+		t.Error("counter advanced to its current value")
+	}
+
+	// The key ID cannot move to another device
+	other := &AppAttestKey{KeyID: keyID, DeviceID: "device-2", PublicKey: []byte{4, 3}}
+	if err := database.StoreAppAttestKey(ctx, other); !errors.Is(err, ErrAppAttestKeyConflict) {
+		t.Errorf("StoreAppAttestKey for another device: %v, want ErrAppAttestKeyConflict", err)
+	}
+	if _, err := database.GetAppAttestKey(ctx, "device-2", keyID); !errors.Is(err, ErrAppAttestKeyNotFound) {
+		t.Errorf("GetAppAttestKey for another device: %v, want ErrAppAttestKeyNotFound", err)
+	}
+	if owner, err := database.GetAppAttestKeyDevice(ctx, keyID); err != nil || owner != "device-1" {
+		t.Errorf("GetAppAttestKeyDevice: got %q, %v", owner, err)
+	}
+	if _, err := database.GetAppAttestKeyDevice(ctx, keyID+"-unknown"); !errors.Is(err, ErrAppAttestKeyNotFound) {
+		t.Errorf("GetAppAttestKeyDevice for an unknown key: %v, want ErrAppAttestKeyNotFound", err)
+	}
+}
+
+func TestFlaggedDevices(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping flagged device tests")
+	}
+	if err := RunMigrations(databaseURL); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	ctx := context.Background()
+	database, err := New(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer database.Close()
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	deviceID := "device-" + hex.EncodeToString(b)
+	defer database.Pool().ExecContext(ctx, `DELETE FROM flagged_devices WHERE device_id = $1`, deviceID)
+
+	if flagged, err := database.IsDeviceFlagged(ctx, deviceID); err != nil || flagged {
+		t.Fatalf("IsDeviceFlagged before flagging: %v, %v", flagged, err)
+	}
+	// Flagging twice for the same reason keeps one flag
+	for i := 0; i < 2; i++ {
+		if err := database.FlagDevice(ctx, deviceID, FlagSharedAppAttestKey, "key-1"); err != nil {
+			t.Fatalf("FlagDevice: %v", err)
+		}
+	}
+	if flagged, err := database.IsDeviceFlagged(ctx, deviceID); err != nil || !flagged {
+		t.Errorf("IsDeviceFlagged: %v, %v", flagged, err)
+	}
+}
+
+func TestAppAttestReceipts_RefreshRecordsRiskMetric(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping app attest receipt tests")
+	}
+	if err := RunMigrations(databaseURL); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	ctx := context.Background()
+	database, err := New(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer database.Close()
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	keyID, deviceID := hex.EncodeToString(b), "device-"+hex.EncodeToString(b[:4])
+	defer database.Pool().ExecContext(ctx, `DELETE FROM app_attest_keys WHERE key_id = $1`, keyID)
+
+	if err := database.StoreAppAttestKey(ctx, &AppAttestKey{KeyID: keyID, DeviceID: deviceID, PublicKey: []byte{4, 1}, Receipt: []byte("attest")}); err != nil {
+		t.Fatalf("StoreAppAttestKey: %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	due, err := database.ListAppAttestReceiptsDue(ctx, now, 1000)
+	if err != nil {
+		t.Fatalf("ListAppAttestReceiptsDue: %v", err)
+	}
+	if !containsKey(due, keyID) {
+		t.Error("never refreshed receipt not due")
+	}
+
+	if err := database.UpdateAppAttestReceipt(ctx, deviceID, keyID, []byte("refreshed"), sql.NullInt64{Int64: 12, Valid: true}, now); err != nil {
+		t.Fatalf("UpdateAppAttestReceipt: %v", err)
+	}
+	// Not modified: the receipt and metric are kept
+	if err := database.UpdateAppAttestReceipt(ctx, deviceID, keyID, nil, sql.NullInt64{}, now.Add(time.Minute)); err != nil {
+		t.Fatalf("UpdateAppAttestReceipt not modified: %v", err)
+	}
+	key, err := database.GetAppAttestKey(ctx, deviceID, keyID)
+	if err != nil {
+		t.Fatalf("GetAppAttestKey: %v", err)
+	}
+	if string(key.Receipt) != "refreshed" || key.RiskMetric.Int64 != 12 || !key.ReceiptRefreshedAt.Time.Equal(now.Add(time.Minute)) {
+		t.Errorf("got receipt %q, risk metric %v, refreshed at %v", key.Receipt, key.RiskMetric, key.ReceiptRefreshedAt)
+	}
+	if metric, err := database.GetDeviceRiskMetric(ctx, deviceID); err != nil || metric != 12 {
+		t.Errorf("GetDeviceRiskMetric: got %d, %v", metric, err)
+	}
+	if due, _ := database.ListAppAttestReceiptsDue(ctx, now, 1000); containsKey(due, keyID) {
+		t.Error("receipt refreshed since the cutoff still due")
+	}
+	if err := database.UpdateAppAttestReceipt(ctx, "device-other", keyID, nil, sql.NullInt64{}, now); !errors.Is(err, ErrAppAttestKeyNotFound) {
+		t.Errorf("UpdateAppAttestReceipt for another device: %v, want ErrAppAttestKeyNotFound", err)
+	}
+}
+
+func containsKey(keys []AppAttestKey, keyID string) bool {
+	for _, key := range keys {
+		if key.KeyID == keyID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"rendezvous/internal/apperr"
+)
+
+// ErrAttestationNotFound is returned when a device has no unexpired valid
+// attestation
+var ErrAttestationNotFound = apperr.New(apperr.ErrNotFound, "attestation_not_found", "attestation not found")
+
+// attestationDeleteBatch is how many attestations DeleteAttestationsBefore
+// deletes per statement, so no statement holds its locks for long
+var attestationDeleteBatch = 1000
+
+// AttestationRecord is one attestation verification as stored
+type AttestationRecord struct {
+	DeviceID        string
+	Platform        string
+	Token           string
+	Verified        bool
+	VerifiedAt      sql.NullTime
+	DeviceIntegrity string
+	ExpiresAt       sql.NullTime // When a verified attestation stops vouching for the device
+	FailureReason   string       // Why a failed attestation was rejected
+	KeyID           string       // The App Attest key of an iOS attestation
+	Downgraded      bool         // Weaker integrity than the device's previous verdict
+
+	// RiskScore is the attestation's risk score, from 0 to 1
+	RiskScore float64
+	// ClientIP is the address the attestation came from, possibly hashed,
+	// and ClientRegion the region of its country; either may be empty
+	ClientIP     string
+	ClientRegion string
+}
+
+// AttestationStats counts the stored attestations of one platform with one
+// outcome, integrity verdict and failure reason
+type AttestationStats struct {
+	Platform        string `json:"platform"`
+	Verified        bool   `json:"verified"`
+	DeviceIntegrity string `json:"device_integrity,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+	Count           int64  `json:"count"`
+}
+
+// RecordAttestation stores an attestation result. Under data minimization
+// nothing is stored; the verifier's counters are the only record.
+func (d *Database) RecordAttestation(ctx context.Context, record *AttestationRecord) error {
+	if !d.persistence.PersistDeviceRecords() {
+		return nil
+	}
+	_, err := d.pool.ExecContext(ctx, `
+		INSERT INTO attestations (
+			device_id, platform, token, verified, verified_at, device_integrity, expires_at, failure_reason, key_id, risk_score,
+			client_ip, client_region, downgraded, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''), $10, NULLIF($11, ''), NULLIF($12, ''), $13, NOW())
+	`, record.DeviceID, record.Platform, record.Token, record.Verified, record.VerifiedAt, record.DeviceIntegrity, record.ExpiresAt,
+		record.FailureReason, record.KeyID, record.RiskScore, record.ClientIP, record.ClientRegion, record.Downgraded)
+	if err != nil {
+		return fmt.Errorf("failed to store attestation: %w", classify(err))
+	}
+	return nil
+}
+
+// GetLastDeviceIntegrity returns the integrity verdict of a device's most
+// recent verified attestation on a platform, expired or not, skipping
+// attestations flagged as downgrades: a device that fell from strong to
+// basic integrity is still compared with strong next time. Under data
+// minimization nothing is stored, so it returns ErrAttestationNotFound
+// without asking the database.
+func (d *Database) GetLastDeviceIntegrity(ctx context.Context, deviceID, platform string) (string, error) {
+	if !d.persistence.PersistDeviceRecords() {
+		return "", ErrAttestationNotFound
+	}
+	var integrity sql.NullString
+	err := d.pool.QueryRowContext(ctx, `
+		SELECT device_integrity
+		FROM attestations
+		WHERE device_id = $1 AND platform = $2 AND verified AND NOT downgraded
+		ORDER BY verified_at DESC
+		LIMIT 1
+	`, deviceID, platform).Scan(&integrity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrAttestationNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get last device integrity: %w", classify(err))
+	}
+	return integrity.String, nil
+}
+
+// CountRecentAttestationFailures counts the failed attestations among a
+// device's last n that came from clientIP, as stored. Attempts from
+// elsewhere are not counted: the device ID is only the client's claim, so
+// failures sent under it from another address may not be the device's.
+// Under data minimization no history is stored, so it is always zero.
+func (d *Database) CountRecentAttestationFailures(ctx context.Context, deviceID, clientIP string, n int) (int, error) {
+	if !d.persistence.PersistDeviceRecords() || clientIP == "" {
+		return 0, nil
+	}
+	var failures int
+	err := d.pool.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE NOT verified)
+		FROM (
+			SELECT verified FROM attestations
+			WHERE device_id = $1 AND client_ip = $2
+			ORDER BY created_at DESC
+			LIMIT $3
+		) recent
+	`, deviceID, clientIP, n).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recent attestation failures: %w", classify(err))
+	}
+	return failures, nil
+}
+
+// CountRecentAttestationOutcomes counts the failed attestations among a
+// device's last n, and how many of them there are. Under data minimization
+// no history is stored, so both are zero.
+func (d *Database) CountRecentAttestationOutcomes(ctx context.Context, deviceID string, n int) (int, int, error) {
+	if !d.persistence.PersistDeviceRecords() {
+		return 0, 0, nil
+	}
+	var failures, attempts int
+	err := d.pool.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE NOT verified), COUNT(*)
+		FROM (
+			SELECT verified FROM attestations
+			WHERE device_id = $1
+			ORDER BY created_at DESC
+			LIMIT $2
+		) recent
+	`, deviceID, n).Scan(&failures, &attempts)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count recent attestation outcomes: %w", classify(err))
+	}
+	return failures, attempts, nil
+}
+
+// CountAttestationFailuresSince counts a device's failed attestations
+// stored since the given time. Under data minimization no history is
+// stored, so it is always zero.
+func (d *Database) CountAttestationFailuresSince(ctx context.Context, deviceID string, since time.Time) (int, error) {
+	if !d.persistence.PersistDeviceRecords() {
+		return 0, nil
+	}
+	var failures int
+	err := d.pool.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM attestations
+		WHERE device_id = $1 AND NOT verified AND created_at >= $2
+	`, deviceID, since).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count attestation failures: %w", classify(err))
+	}
+	return failures, nil
+}
+
+// GetAttestationStats counts attestations stored since the given time per
+// platform, outcome, integrity verdict and failure reason, largest first
+// within each platform
+func (d *Database) GetAttestationStats(ctx context.Context, since time.Time) ([]AttestationStats, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT platform, verified, COALESCE(device_integrity, ''), COALESCE(failure_reason, ''), COUNT(*)
+		 FROM attestations
+		 WHERE created_at >= $1
+		 GROUP BY 1, 2, 3, 4
+		 ORDER BY platform, COUNT(*) DESC`,
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attestation stats: %w", classify(err))
+	}
+	defer rows.Close()
+
+	stats := []AttestationStats{}
+	for rows.Next() {
+		var s AttestationStats
+		if err := rows.Scan(&s.Platform, &s.Verified, &s.DeviceIntegrity, &s.Reason, &s.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan attestation stats: %w", classify(err))
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
+
+// DeleteAttestationsBefore deletes attestations created before the given
+// time, in batches, and returns how many it deleted. Attestations that are
+// still vouching for their device at that time are kept until they expire.
+func (d *Database) DeleteAttestationsBefore(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	for {
+		result, err := d.pool.ExecContext(ctx, `
+			DELETE FROM attestations WHERE id IN (
+				SELECT id FROM attestations
+				WHERE created_at < $1 AND (expires_at IS NULL OR expires_at <= $1)
+				LIMIT $2
+			)
+		`, before, attestationDeleteBatch)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete attestations: %w", classify(err))
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete attestations: %w", classify(err))
+		}
+		deleted += n
+		if n < int64(attestationDeleteBatch) {
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDeleteAttestationsBefore_DeletesInBatches(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	defer func(batch int) { attestationDeleteBatch = batch }(attestationDeleteBatch)
+	attestationDeleteBatch = 2
+
+	before := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectExec(`DELETE FROM attestations`).WithArgs(before, 2).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM attestations`).WithArgs(before, 2).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM attestations`).WithArgs(before, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	deleted, err := NewFromPool(sqlDB).DeleteAttestationsBefore(context.Background(), before)
+	if err != nil || deleted != 5 {
+		t.Errorf("DeleteAttestationsBefore: got %d, %v; want 5", deleted, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCountRecentAttestationFailures(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping attestation history tests")
+	}
+	if err := RunMigrations(databaseURL); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	ctx := context.Background()
+	database, err := New(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer database.Close()
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	deviceID := "device-" + hex.EncodeToString(b)
+	defer database.Pool().ExecContext(ctx, `DELETE FROM attestations WHERE device_id = $1`, deviceID)
+
+	// An old success, three failures, then a success, with failures sent
+	// under the same device ID from another address in between
+	for _, verified := range []bool{true, false, false, false, true} {
+		if err := database.RecordAttestation(ctx, &AttestationRecord{DeviceID: deviceID, Platform: "android", Token: "token", Verified: verified, ClientIP: "203.0.113.7"}); err != nil {
+			t.Fatalf("RecordAttestation: %v", err)
+		}
+		if err := database.RecordAttestation(ctx, &AttestationRecord{DeviceID: deviceID, Platform: "android", Token: "token", ClientIP: "198.51.100.9"}); err != nil {
+			t.Fatalf("RecordAttestation: %v", err)
+		}
+	}
+	if failures, err := database.CountRecentAttestationFailures(ctx, deviceID, "203.0.113.7", 4); err != nil || failures != 3 {
+		t.Errorf("last 4: got %d, %v; want 3", failures, err)
+	}
+	if failures, err := database.CountRecentAttestationFailures(ctx, deviceID, "203.0.113.7", 2); err != nil || failures != 1 {
+		t.Errorf("last 2: got %d, %v; want 1", failures, err)
+	}
+	if failures, err := database.CountRecentAttestationFailures(ctx, deviceID, "", 4); err != nil || failures != 0 {
+		t.Errorf("without an address: got %d, %v; want 0", failures, err)
+	}
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"rendezvous/internal/audit"
+)
+
+// AuditRecord is an admin mutation to append to the audit chain
+type AuditRecord struct {
+	Action      string
+	SubjectType string
+	SubjectID   string
+	Details     map[string]interface{}
+}
+
+// Audited runs an admin mutation and appends the record it returns to the
+// audit chain in the same transaction, so a mutation never commits without
+// its entry. Database methods called with the context mutate is given join
+// the transaction.
+func (d *Database) Audited(
+	ctx context.Context,
+	actor string,
+	mutate func(ctx context.Context) (*AuditRecord, error),
+) (*audit.Entry, error) {
+	tx, err := d.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	audited := &auditedTx{tx: tx}
+	record, err := mutate(context.WithValue(ctx, auditedTxKey{}, audited))
+	if err != nil {
+		return nil, err
+	}
+	entry, err := d.appendAuditEntry(ctx, tx, actor, record.Action, record.SubjectType, record.SubjectID, record.Details)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit audited change: %w", classify(err))
+	}
+	for _, fn := range audited.afterCommit {
+		fn()
+	}
+	return entry, nil
+}
+
+// AppendAuditEntry adds an action that is not itself a database change to
+// the end of the audit chain.
+func (d *Database) AppendAuditEntry(
+	ctx context.Context,
+	actor string,
+	action string,
+	subjectType string,
+	subjectID string,
+	details map[string]interface{},
+) (*audit.Entry, error) {
+	tx, err := d.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	entry, err := d.appendAuditEntry(ctx, tx, actor, action, subjectType, subjectID, details)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit audit entry: %w", classify(err))
+	}
+	return entry, nil
+}
+
+// appendAuditEntry adds an entry to the end of the audit chain in tx. The
+// table is locked for the transaction so concurrent appends cannot fork the
+// chain; reads are not blocked.
+func (d *Database) appendAuditEntry(
+	ctx context.Context,
+	tx *sql.Tx,
+	actor string,
+	action string,
+	subjectType string,
+	subjectID string,
+	details map[string]interface{},
+) (*audit.Entry, error) {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit details: %w", classify(err))
+	}
+
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE admin_audit_log IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return nil, fmt.Errorf("failed to lock audit log: %w", classify(err))
+	}
+
+	entry := &audit.Entry{
+		Seq:         1,
+		Actor:       actor,
+		Action:      action,
+		SubjectType: subjectType,
+		SubjectID:   subjectID,
+		Details:     detailsJSON,
+		CreatedAt:   d.clock.Now().UTC().Truncate(time.Microsecond),
+		PrevHash:    audit.GenesisHash,
+	}
+	var headSeq int64
+	var headHash string
+	err = tx.QueryRowContext(ctx, `SELECT seq, hash FROM admin_audit_log ORDER BY seq DESC LIMIT 1`).Scan(&headSeq, &headHash)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read audit head: %w", classify(err))
+	default:
+		entry.Seq = headSeq + 1
+		entry.PrevHash = headHash
+	}
+	if entry.Hash, err = audit.ComputeHash(entry); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO admin_audit_log
+		 (seq, actor, action, subject_type, subject_id, details, created_at, prev_hash, hash)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		entry.Seq,
+		entry.Actor,
+		entry.Action,
+		entry.SubjectType,
+		entry.SubjectID,
+		string(entry.Details),
+		entry.CreatedAt,
+		entry.PrevHash,
+		entry.Hash,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert audit entry: %w", classify(err))
+	}
+	return entry, nil
+}
+
+// GetAuditEntries returns the whole audit chain in order.
+func (d *Database) GetAuditEntries(ctx context.Context) ([]audit.Entry, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT seq, actor, action, subject_type, subject_id, details, created_at, prev_hash, hash
+		 FROM admin_audit_log
+		 ORDER BY seq`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", classify(err))
+	}
+	defer rows.Close()
+
+	entries := []audit.Entry{}
+	for rows.Next() {
+		var e audit.Entry
+		var details string
+		if err := rows.Scan(&e.Seq, &e.Actor, &e.Action, &e.SubjectType, &e.SubjectID, &details, &e.CreatedAt, &e.PrevHash, &e.Hash); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", classify(err))
+		}
+		e.Details = json.RawMessage(details)
+		e.CreatedAt = e.CreatedAt.UTC()
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAudited_MutationJoinsTransaction(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	d := NewFromPool(sqlDB)
+
+	// The open regions' own transaction is the audited one: one commit
+	// covers both the change and its entry
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM launch_open_regions`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO launch_open_regions`).WithArgs("us-east-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`LOCK TABLE admin_audit_log`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT seq, hash FROM admin_audit_log`).WillReturnRows(sqlmock.NewRows([]string{"seq", "hash"}))
+	mock.ExpectExec(`INSERT INTO admin_audit_log`).
+		WithArgs(int64(1), "alice", "launch_policy.put", "launch_policy", "open_regions",
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	committed := false
+	entry, err := d.Audited(context.Background(), "alice", func(ctx context.Context) (*AuditRecord, error) {
+		if err := d.SetOpenRegions(ctx, []string{"us-east-1"}); err != nil {
+			return nil, err
+		}
+		d.AfterCommit(ctx, func() { committed = true })
+		if committed {
+			t.Error("after-commit hook ran before the commit")
+		}
+		return &AuditRecord{Action: "launch_policy.put", SubjectType: "launch_policy", SubjectID: "open_regions"}, nil
+	})
+	if err != nil || entry.Seq != 1 {
+		t.Fatalf("Audited: got %+v, %v", entry, err)
+	}
+	if !committed {
+		t.Error("after-commit hook did not run")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAudited_FailedAppendRollsBack(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	d := NewFromPool(sqlDB)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM experiments`).WithArgs("ssh-first").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`LOCK TABLE admin_audit_log`).WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectRollback()
+
+	committed := false
+	_, err = d.Audited(context.Background(), "alice", func(ctx context.Context) (*AuditRecord, error) {
+		if err := d.DeleteExperiment(ctx, "ssh-first"); err != nil {
+			return nil, err
+		}
+		d.AfterCommit(ctx, func() { committed = true })
+		return &AuditRecord{Action: "experiment.delete", SubjectType: "experiment", SubjectID: "ssh-first"}, nil
+	})
+	if err == nil {
+		t.Fatal("Audited succeeded without its audit entry")
+	}
+	if committed {
+		t.Error("after-commit hook ran for a rolled back change")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ClientErrorCount is one row of the client error aggregation
+type ClientErrorCount struct {
+	Code          string `json:"code"`
+	ClientVersion string `json:"client_version"`
+	Platform      string `json:"platform"`
+	Count         int64  `json:"count"`
+}
+
+// KeyPairFailureCount is one row of the pack verification failure aggregation
+type KeyPairFailureCount struct {
+	TrustedKeyID string `json:"trusted_key_id"`
+	PackKeyID    string `json:"pack_key_id"`
+	Count        int64  `json:"count"`
+}
+
+// RecordClientError inserts a client error report. Under data minimization
+// only aggregate context is kept.
+func (d *Database) RecordClientError(
+	ctx context.Context,
+	code string,
+	clientVersion string,
+	platform string,
+	errorContext map[string]string,
+	region *string,
+) error {
+	errorContext = d.persistence.ClientErrorContext(errorContext)
+	if errorContext == nil {
+		errorContext = map[string]string{}
+	}
+	contextJSON, err := json.Marshal(errorContext)
+	if err != nil {
+		return fmt.Errorf("failed to encode client error context: %w", err)
+	}
+
+	_, err = d.pool.ExecContext(
+		ctx,
+		`INSERT INTO client_errors (code, client_version, platform, context, region)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		code,
+		clientVersion,
+		platform,
+		contextJSON,
+		region,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert client error: %w", err)
+	}
+
+	return nil
+}
+
+// GetClientErrorCounts aggregates client error reports since the given time by
+// code, client version, and platform, most frequent first.
+func (d *Database) GetClientErrorCounts(ctx context.Context, since time.Time) ([]ClientErrorCount, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT code, client_version, platform, COUNT(*)
+		 FROM client_errors
+		 WHERE created_at >= $1
+		 GROUP BY code, client_version, platform
+		 ORDER BY COUNT(*) DESC, code, client_version
+		 LIMIT 500`,
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query client errors: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []ClientErrorCount{}
+	for rows.Next() {
+		var c ClientErrorCount
+		if err := rows.Scan(&c.Code, &c.ClientVersion, &c.Platform, &c.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan client error count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
+
+// GetPackVerificationFailureCounts aggregates pack_verification_failed reports
+// since the given time by the key the client trusted and the key on the pack.
+func (d *Database) GetPackVerificationFailureCounts(ctx context.Context, since time.Time) ([]KeyPairFailureCount, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT context->>'trusted_key_id', context->>'pack_key_id', COUNT(*)
+		 FROM client_errors
+		 WHERE code = 'pack_verification_failed' AND created_at >= $1
+		 GROUP BY 1, 2
+		 ORDER BY COUNT(*) DESC
+		 LIMIT 100`,
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pack verification failures: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []KeyPairFailureCount{}
+	for rows.Next() {
+		var c KeyPairFailureCount
+		if err := rows.Scan(&c.TrustedKeyID, &c.PackKeyID, &c.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan pack verification failure count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
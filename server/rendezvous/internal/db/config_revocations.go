@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Config revocation kinds
+const (
+	ConfigRevocationPack = "pack" // Value is a pack's content hash
+	ConfigRevocationKey  = "key"  // Value is a signing key ID
+)
+
+// ConfigRevocation is a pack or signing key clients must no longer trust
+type ConfigRevocation struct {
+	Generation int64 // The revocation list generation it first appeared in
+	Kind       string
+	Value      string
+	Reason     string
+	RevokedAt  time.Time
+}
+
+// AddConfigRevocation revokes a pack hash or signing key ID. Revoking again
+// returns the existing revocation unchanged, so the list's generation only
+// moves for new entries.
+func (d *Database) AddConfigRevocation(ctx context.Context, kind, value, reason string) (*ConfigRevocation, error) {
+	r := ConfigRevocation{Kind: kind, Value: value}
+	err := d.conn(ctx).QueryRowContext(ctx, `
+		INSERT INTO config_revocations (kind, value, reason) VALUES ($1, $2, $3)
+		ON CONFLICT (kind, value) DO UPDATE SET kind = EXCLUDED.kind
+		RETURNING id, reason, revoked_at
+	`, kind, value, reason).Scan(&r.Generation, &r.Reason, &r.RevokedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add config revocation: %w", classify(err))
+	}
+	return &r, nil
+}
+
+// GetConfigRevocations returns every config revocation, oldest first
+func (d *Database) GetConfigRevocations(ctx context.Context) ([]*ConfigRevocation, error) {
+	rows, err := d.pool.QueryContext(ctx,
+		`SELECT id, kind, value, reason, revoked_at FROM config_revocations ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query config revocations: %w", classify(err))
+	}
+	defer rows.Close()
+
+	revocations := []*ConfigRevocation{}
+	for rows.Next() {
+		var r ConfigRevocation
+		if err := rows.Scan(&r.Generation, &r.Kind, &r.Value, &r.Reason, &r.RevokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan config revocation: %w", classify(err))
+		}
+		revocations = append(revocations, &r)
+	}
+	return revocations, rows.Err()
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// GetCountryRegionOverrides returns the regions operators have assigned to
+// countries in place of the built-in table, by upper-case ISO code
+func (d *Database) GetCountryRegionOverrides(ctx context.Context) (map[string]string, error) {
+	rows, err := d.pool.QueryContext(ctx, `SELECT country, region FROM country_region_overrides`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query country region overrides: %w", classify(err))
+	}
+	defer rows.Close()
+
+	overrides := map[string]string{}
+	for rows.Next() {
+		var country, region string
+		if err := rows.Scan(&country, &region); err != nil {
+			return nil, fmt.Errorf("failed to scan country region override: %w", classify(err))
+		}
+		overrides[strings.ToUpper(country)] = region
+	}
+	return overrides, rows.Err()
+}
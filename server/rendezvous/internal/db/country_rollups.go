@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CountryCount is the number of clients a gateway served from one country.
+// Counts are raw and must not leave the service without suppression.
+type CountryCount struct {
+	Country string
+	Clients int64
+}
+
+// RefreshGatewayCountryRollup rebuilds the rollup from successful,
+// non-honeypot discovery logs of the windowDays UTC days ending with the day
+// containing day, and returns how many rows it wrote. Each client is counted
+// once per gateway and country over the whole window. Earlier rollups are
+// replaced in the same transaction, so rerunning it is idempotent.
+func (d *Database) RefreshGatewayCountryRollup(ctx context.Context, day time.Time, windowDays int) (int64, error) {
+	end := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	date := end.AddDate(0, 0, -1).Format("2006-01-02")
+
+	tx, err := d.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM gateway_country_rollups`); err != nil {
+		return 0, fmt.Errorf("failed to clear country rollup for %s: %w", date, err)
+	}
+
+	result, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO gateway_country_rollups (gateway_id, day, country, clients)
+		 SELECT gateway_id, $1, country, COUNT(DISTINCT COALESCE(host(client_ip), client_bucket))
+		 FROM discovery_logs
+		 WHERE gateway_id IS NOT NULL AND country IS NOT NULL AND (client_ip IS NOT NULL OR client_bucket IS NOT NULL)
+		   AND success AND is_honeypot = FALSE
+		   AND created_at >= $2 AND created_at < $3
+		 GROUP BY gateway_id, country`,
+		date,
+		end.AddDate(0, 0, -windowDays),
+		end,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build country rollup for %s: %w", date, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read rollup result: %w", classify(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit country rollup for %s: %w", date, err)
+	}
+	return rows, nil
+}
+
+// GetGatewayCountryCounts returns a gateway's distinct clients per country
+// over the window of the latest rollup, largest first.
+func (d *Database) GetGatewayCountryCounts(ctx context.Context, gatewayID string) ([]CountryCount, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT country, clients
+		 FROM gateway_country_rollups
+		 WHERE gateway_id = $1 AND day = (SELECT MAX(day) FROM gateway_country_rollups WHERE gateway_id = $1)
+		 ORDER BY clients DESC, country`,
+		gatewayID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query country rollups: %w", classify(err))
+	}
+	defer rows.Close()
+
+	counts := []CountryCount{}
+	for rows.Next() {
+		var c CountryCount
+		if err := rows.Scan(&c.Country, &c.Clients); err != nil {
+			return nil, fmt.Errorf("failed to scan country rollup: %w", classify(err))
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
@@ -8,19 +8,36 @@ import (
 	"time"
 
 	"github.com/lib/pq"
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/cache"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/privacy"
 )
 
 // Database wraps a PostgreSQL connection pool
 type Database struct {
-	pool *sql.DB
+	pool        *sql.DB
+	policy      *cache.PolicyCache // Optional read-through cache for policy tables
+	persistence *privacy.Policy    // What client data writes may store; nil is standard
+	clock       clock.Clock
 }
 
 // ErrGatewayNotFound is returned when a gateway ID does not exist.
-var ErrGatewayNotFound = errors.New("gateway not found")
+var ErrGatewayNotFound = apperr.New(apperr.ErrNotFound, "gateway_not_found", "gateway not found")
+
+// ErrDuplicateSequence is returned when a gateway reports a status sequence
+// number it has already used.
+var ErrDuplicateSequence = apperr.New(apperr.ErrConflict, "duplicate_sequence", "duplicate status sequence")
 
 // NewFromPool creates a Database from an existing connection pool (for testing).
 func NewFromPool(pool *sql.DB) *Database {
-	return &Database{pool: pool}
+	return &Database{pool: pool, clock: clock.Real{}}
+}
+
+// SetClock replaces the time source for timestamps the database layer
+// assigns; it is intended for tests.
+func (d *Database) SetClock(c clock.Clock) {
+	d.clock = c
 }
 
 // New creates a new database connection pool with retry on connect.
@@ -28,7 +45,7 @@ func NewFromPool(pool *sql.DB) *Database {
 func New(ctx context.Context, databaseURL string) (*Database, error) {
 	db, err := sql.Open("postgres", databaseURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", classify(err))
 	}
 
 	// Configure connection pool
@@ -37,6 +54,7 @@ func New(ctx context.Context, databaseURL string) (*Database, error) {
 	db.SetConnMaxLifetime(5 * time.Minute)
 
 	// Verify connection with retries (handles DB not yet ready at startup)
+	database := NewFromPool(db)
 	const maxAttempts = 5
 	baseDelay := 2 * time.Second
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
@@ -44,7 +62,7 @@ func New(ctx context.Context, databaseURL string) (*Database, error) {
 		err = db.PingContext(pingCtx)
 		cancel()
 		if err == nil {
-			return &Database{pool: db}, nil
+			return database, nil
 		}
 		if attempt == maxAttempts {
 			return nil, fmt.Errorf("failed to ping database after %d attempts: %w", maxAttempts, err)
@@ -56,7 +74,7 @@ func New(ctx context.Context, databaseURL string) (*Database, error) {
 		select {
 		case <-ctx.Done():
 			return nil, fmt.Errorf("context cancelled while waiting for database: %w", ctx.Err())
-		case <-time.After(delay):
+		case <-database.clock.After(delay):
 			// retry
 		}
 	}
@@ -73,138 +91,145 @@ func (d *Database) Pool() *sql.DB {
 	return d.pool
 }
 
+// SetPolicyCache enables read-through caching of low-cardinality policy tables
+// (currently rollouts).
+func (d *Database) SetPolicyCache(policy *cache.PolicyCache) {
+	d.policy = policy
+}
+
+// SetPersistencePolicy sets the policy every write of client data consults
+func (d *Database) SetPersistencePolicy(policy *privacy.Policy) {
+	d.persistence = policy
+}
+
+// PersistencePolicy returns the policy set with SetPersistencePolicy. It is
+// nil, meaning standard, on a nil Database.
+func (d *Database) PersistencePolicy() *privacy.Policy {
+	if d == nil {
+		return nil
+	}
+	return d.persistence
+}
+
+// InvalidatePolicy drops a cached policy table on every replica. Callers that
+// mutate a policy table must call it after the write commits.
+func (d *Database) InvalidatePolicy(ctx context.Context, table string) error {
+	if d.policy == nil {
+		return nil
+	}
+	return d.policy.Invalidate(ctx, table)
+}
+
 // Health checks database health
 func (d *Database) Health(ctx context.Context) error {
 	return d.pool.PingContext(ctx)
 }
 
-// GetGatewaysByRegion returns gateways in a specific region
-func (d *Database) GetGatewaysByRegion(ctx context.Context, region string) ([]*Gateway, error) {
-	query := `
-		SELECT id, public_key, ip_address, port, transport_types, discovery_channels,
+// gatewayColumns is the column list shared by every gateway SELECT so that
+// scanGateways stays in sync with the queries.
+const gatewayColumns = `id, public_key, ip_address, port, transport_types, discovery_channels,
 		       region, bandwidth_mbps, current_users, max_users, status, is_honeypot,
-		       created_at, last_seen, updated_at
-		FROM gateways
-		WHERE region = $1 AND status = 'active' AND is_honeypot = FALSE
-		ORDER BY current_users ASC
-		LIMIT 100
-	`
-	
-	rows, err := d.pool.QueryContext(ctx, query, region)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query gateways: %w", err)
-	}
-	defer rows.Close()
+		       operator_id, approval_status, asn, created_at, last_seen, updated_at`
 
+// scanGateways reads gateway rows selected with gatewayColumns.
+func scanGateways(rows *sql.Rows) ([]*Gateway, error) {
 	var gateways []*Gateway
 	for rows.Next() {
 		var gw Gateway
 		var transportTypes pq.StringArray
 		var discoveryChannels pq.StringArray
-		
+		var operatorID sql.NullString
+
 		err := rows.Scan(
 			&gw.ID, &gw.PublicKey, &gw.IPAddress, &gw.Port,
 			&transportTypes, &discoveryChannels,
 			&gw.Region, &gw.BandwidthMbps, &gw.CurrentUsers, &gw.MaxUsers,
-			&gw.Status, &gw.IsHoneypot, &gw.CreatedAt, &gw.LastSeen, &gw.UpdatedAt,
+			&gw.Status, &gw.IsHoneypot, &operatorID, &gw.ApprovalStatus, &gw.ASN,
+			&gw.CreatedAt, &gw.LastSeen, &gw.UpdatedAt,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan gateway: %w", err)
+			return nil, fmt.Errorf("failed to scan gateway: %w", classify(err))
 		}
 
 		gw.TransportTypes = []string(transportTypes)
 		gw.DiscoveryChannels = []string(discoveryChannels)
+		gw.OperatorID = operatorID.String
 		gateways = append(gateways, &gw)
 	}
 
 	return gateways, rows.Err()
 }
 
-// GetAllGateways returns all active gateways
+// GetGatewaysByRegion returns approved, active gateways in a specific region
+func (d *Database) GetGatewaysByRegion(ctx context.Context, region string) ([]*Gateway, error) {
+	return d.GetSelectableGateways(ctx, region, false, 100)
+}
+
+// GetSelectableGateways returns up to limit approved gateways in a region,
+// least loaded first: active ones, and degraded ones too when
+// includeDegraded is set
+func (d *Database) GetSelectableGateways(ctx context.Context, region string, includeDegraded bool, limit int) ([]*Gateway, error) {
+	query := `
+		SELECT ` + gatewayColumns + `
+		FROM gateways
+		WHERE region = $1 AND (status = 'active' OR ($2 AND status = 'degraded'))
+		  AND is_honeypot = FALSE AND approval_status = 'approved'
+		ORDER BY current_users ASC
+		LIMIT $3
+	`
+
+	rows, err := d.pool.QueryContext(ctx, query, region, includeDegraded, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gateways: %w", classify(err))
+	}
+	defer rows.Close()
+
+	return scanGateways(rows)
+}
+
+// GetAllGateways returns all approved active or degraded gateways
 func (d *Database) GetAllGateways(ctx context.Context) ([]*Gateway, error) {
 	query := `
-		SELECT id, public_key, ip_address, port, transport_types, discovery_channels,
-		       region, bandwidth_mbps, current_users, max_users, status, is_honeypot,
-		       created_at, last_seen, updated_at
+		SELECT ` + gatewayColumns + `
 		FROM gateways
-		WHERE status IN ('active', 'degraded')
+		WHERE status IN ('active', 'degraded') AND approval_status = 'approved'
 		ORDER BY current_users DESC, last_seen DESC
 		LIMIT 1000
 	`
-	
+
 	rows, err := d.pool.QueryContext(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query gateways: %w", err)
+		return nil, fmt.Errorf("failed to query gateways: %w", classify(err))
 	}
 	defer rows.Close()
 
-	var gateways []*Gateway
-	for rows.Next() {
-		var gw Gateway
-		var transportTypes pq.StringArray
-		var discoveryChannels pq.StringArray
-		
-		err := rows.Scan(
-			&gw.ID, &gw.PublicKey, &gw.IPAddress, &gw.Port,
-			&transportTypes, &discoveryChannels,
-			&gw.Region, &gw.BandwidthMbps, &gw.CurrentUsers, &gw.MaxUsers,
-			&gw.Status, &gw.IsHoneypot, &gw.CreatedAt, &gw.LastSeen, &gw.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan gateway: %w", err)
-		}
-
-		gw.TransportTypes = []string(transportTypes)
-		gw.DiscoveryChannels = []string(discoveryChannels)
-		gateways = append(gateways, &gw)
-	}
-
-	return gateways, rows.Err()
+	return scanGateways(rows)
 }
 
-// GetHoneypotGateways returns honeypot gateways for a region
+// GetHoneypotGateways returns honeypot gateways for a region, or for every
+// region when region is empty
 func (d *Database) GetHoneypotGateways(ctx context.Context, region string) ([]*Gateway, error) {
 	query := `
-		SELECT id, public_key, ip_address, port, transport_types, discovery_channels,
-		       region, bandwidth_mbps, current_users, max_users, status, is_honeypot,
-		       created_at, last_seen, updated_at
+		SELECT ` + gatewayColumns + `
 		FROM gateways
-		WHERE region = $1 AND status = 'active' AND is_honeypot = TRUE
+		WHERE ($1 = '' OR region = $1) AND status = 'active' AND is_honeypot = TRUE
 		ORDER BY current_users ASC
 		LIMIT 10
 	`
 
 	rows, err := d.pool.QueryContext(ctx, query, region)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query honeypot gateways: %w", err)
+		return nil, fmt.Errorf("failed to query honeypot gateways: %w", classify(err))
 	}
 	defer rows.Close()
 
-	var gateways []*Gateway
-	for rows.Next() {
-		var gw Gateway
-		var transportTypes pq.StringArray
-		var discoveryChannels pq.StringArray
-
-		err := rows.Scan(
-			&gw.ID, &gw.PublicKey, &gw.IPAddress, &gw.Port,
-			&transportTypes, &discoveryChannels,
-			&gw.Region, &gw.BandwidthMbps, &gw.CurrentUsers, &gw.MaxUsers,
-			&gw.Status, &gw.IsHoneypot, &gw.CreatedAt, &gw.LastSeen, &gw.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan honeypot gateway: %w", err)
-		}
-
-		gw.TransportTypes = []string(transportTypes)
-		gw.DiscoveryChannels = []string(discoveryChannels)
-		gateways = append(gateways, &gw)
-	}
-
-	return gateways, rows.Err()
+	return scanGateways(rows)
 }
 
-// RecordGatewayStatus updates gateway status and records metrics.
+// RecordGatewayStatus updates gateway status and records metrics. reportedAt
+// is the gateway's own timestamp and sequence its heartbeat counter; both are
+// optional. A sequence already recorded for the gateway returns
+// ErrDuplicateSequence and records nothing.
 func (d *Database) RecordGatewayStatus(
 	ctx context.Context,
 	gatewayID string,
@@ -213,10 +238,12 @@ func (d *Database) RecordGatewayStatus(
 	bandwidthUsedMbps int,
 	packetsForwarded int64,
 	uptimePercent float64,
+	reportedAt *time.Time,
+	sequence *int64,
 ) error {
 	tx, err := d.pool.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
 	}
 	defer func() {
 		_ = tx.Rollback()
@@ -230,77 +257,215 @@ func (d *Database) RecordGatewayStatus(
 		gatewayID,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update gateway status: %w", err)
+		return fmt.Errorf("failed to update gateway status: %w", classify(err))
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to read update result: %w", err)
+		return fmt.Errorf("failed to read update result: %w", classify(err))
 	}
 	if rowsAffected == 0 {
-		return ErrGatewayNotFound
+		return fmt.Errorf("gateway %s: %w", gatewayID, ErrGatewayNotFound)
+	}
+
+	if sequence != nil {
+		if err := recordStatusSequence(ctx, tx, gatewayID, *sequence); err != nil {
+			return err
+		}
 	}
 
 	_, err = tx.ExecContext(
 		ctx,
 		`INSERT INTO operator_metrics
-		 (time, gateway_id, users_connected, bandwidth_used_mbps, packets_forwarded, uptime_percent)
-		 VALUES ($1, $2, $3, $4, $5, $6)`,
-		time.Now().UTC(),
+		 (time, gateway_id, users_connected, bandwidth_used_mbps, packets_forwarded, uptime_percent, reported_at, sequence)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		d.clock.Now().UTC(),
 		gatewayID,
 		usersConnected,
 		bandwidthUsedMbps,
 		packetsForwarded,
 		uptimePercent,
+		reportedAt,
+		sequence,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to insert operator metrics: %w", err)
+		return fmt.Errorf("failed to insert operator metrics: %w", classify(err))
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit gateway status: %w", err)
+		return fmt.Errorf("failed to commit gateway status: %w", classify(err))
+	}
+
+	return nil
+}
+
+// recordStatusSequence claims (gatewayID, sequence) in the companion table
+// that enforces its uniqueness, pruning the gateway's claims older than a day.
+func recordStatusSequence(ctx context.Context, tx *sql.Tx, gatewayID string, sequence int64) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM operator_metrics_sequences
+		 WHERE gateway_id = $1 AND received_at < NOW() - INTERVAL '1 day'`,
+		gatewayID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to prune status sequences: %w", classify(err))
 	}
 
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO operator_metrics_sequences (gateway_id, sequence) VALUES ($1, $2)`,
+		gatewayID,
+		sequence,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return fmt.Errorf("gateway %s sequence %d: %w", gatewayID, sequence, ErrDuplicateSequence)
+		}
+		return fmt.Errorf("failed to record status sequence: %w", classify(err))
+	}
 	return nil
 }
 
-// RecordDiscoveryLog inserts a discovery log entry.
-func (d *Database) RecordDiscoveryLog(
+// DiscoveryLogEntry is one discovery attempt reported by a client
+type DiscoveryLogEntry struct {
+	EventID      *string // Client-generated UUID identifying the attempt across retries
+	ChannelType  string
+	GatewayID    *string
+	ClientIP     *string
+	Region       *string
+	Country      *string
+	Success      bool
+	LatencyMs    *int
+	ErrorMessage *string
+}
+
+// DiscoveryLogResult reports what happened to one DiscoveryLogEntry
+type DiscoveryLogResult struct {
+	Duplicate  bool // The event ID was already recorded; nothing was stored
+	IsHoneypot bool // The entry targeted a honeypot gateway
+}
+
+// DiscoveryDedupeWindow is how long a discovery log event ID is remembered
+const DiscoveryDedupeWindow = 24 * time.Hour
+
+// discoveryEventDeleteBatch is how many event IDs DeleteDiscoveryEventsBefore
+// deletes per statement
+var discoveryEventDeleteBatch = 1000
+
+// RecordDiscoveryLogs inserts discovery log entries in one transaction.
+// Entries are tagged as honeypot traffic at insert time when their gateway is
+// a honeypot. An entry whose event ID was claimed since dedupeSince, earlier
+// in the batch or by an earlier request, is not stored and is reported as a
+// duplicate; an older claim is taken over. Claims are pruned by
+// DeleteDiscoveryEventsBefore, not here, so logging never waits on the
+// delete. Client addresses are dropped under data minimization. Only our own gateways are referenced;
+// entries for federated gateways are stored without a gateway ID.
+func (d *Database) RecordDiscoveryLogs(
 	ctx context.Context,
-	channelType string,
-	gatewayID *string,
-	clientIP *string,
-	region *string,
-	success bool,
-	latencyMs *int,
-	errorMessage *string,
-) error {
-	var latencyValue interface{}
-	if latencyMs != nil {
-		latencyValue = *latencyMs
+	entries []DiscoveryLogEntry,
+	dedupeSince time.Time,
+) ([]DiscoveryLogResult, error) {
+	tx, err := d.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	results := make([]DiscoveryLogResult, len(entries))
+	seen := map[string]bool{}
+	for i, entry := range entries {
+		if entry.EventID != nil {
+			if seen[*entry.EventID] {
+				results[i].Duplicate = true
+				continue
+			}
+			seen[*entry.EventID] = true
+			claimed, err := claimDiscoveryEvent(ctx, tx, *entry.EventID, dedupeSince)
+			if err != nil {
+				return nil, err
+			}
+			if !claimed {
+				results[i].Duplicate = true
+				continue
+			}
+		}
+
+		err := tx.QueryRowContext(
+			ctx,
+			`INSERT INTO discovery_logs
+			 (channel_type, gateway_id, client_ip, region, country, success, latency_ms, error_message, client_bucket, is_honeypot)
+			 VALUES ($1, (SELECT id FROM gateways WHERE id = $2), $3, $4, $5, $6, $7, $8, $9,
+			         COALESCE((SELECT is_honeypot FROM gateways WHERE id = $2), FALSE))
+			 RETURNING is_honeypot`,
+			entry.ChannelType,
+			entry.GatewayID,
+			d.persistence.ClientAddress(entry.ClientIP),
+			entry.Region,
+			entry.Country,
+			entry.Success,
+			entry.LatencyMs,
+			entry.ErrorMessage,
+			d.persistence.ClientBucket(entry.ClientIP),
+		).Scan(&results[i].IsHoneypot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert discovery log: %w", classify(err))
+		}
 	}
 
-	var errorValue interface{}
-	if errorMessage != nil {
-		errorValue = *errorMessage
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit discovery logs: %w", classify(err))
 	}
+	return results, nil
+}
 
-	_, err := d.pool.ExecContext(
+// claimDiscoveryEvent records eventID and reports whether it was new, or
+// last claimed before since. A concurrent claim of the same ID waits for the
+// first to commit.
+func claimDiscoveryEvent(ctx context.Context, tx *sql.Tx, eventID string, since time.Time) (bool, error) {
+	result, err := tx.ExecContext(
 		ctx,
-		`INSERT INTO discovery_logs
-		 (channel_type, gateway_id, client_ip, region, success, latency_ms, error_message)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
-		channelType,
-		gatewayID,
-		clientIP,
-		region,
-		success,
-		latencyValue,
-		errorValue,
+		`INSERT INTO discovery_log_events (event_id) VALUES ($1)
+		 ON CONFLICT (event_id) DO UPDATE SET received_at = NOW()
+		 WHERE discovery_log_events.received_at < $2`,
+		eventID,
+		since,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to insert discovery log: %w", err)
+		return false, fmt.Errorf("failed to claim discovery log event: %w", classify(err))
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read claim result: %w", classify(err))
 	}
+	return rowsAffected > 0, nil
+}
 
-	return nil
+// DeleteDiscoveryEventsBefore deletes discovery log event IDs claimed before
+// the given time, in batches, and returns how many it deleted
+func (d *Database) DeleteDiscoveryEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	for {
+		result, err := d.pool.ExecContext(ctx, `
+			DELETE FROM discovery_log_events WHERE event_id IN (
+				SELECT event_id FROM discovery_log_events
+				WHERE received_at < $1
+				LIMIT $2
+			)
+		`, before, discoveryEventDeleteBatch)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete discovery log events: %w", classify(err))
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete discovery log events: %w", classify(err))
+		}
+		deleted += n
+		if n < int64(discoveryEventDeleteBatch) {
+			return deleted, nil
+		}
+	}
 }
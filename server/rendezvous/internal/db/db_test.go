@@ -0,0 +1,31 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDeleteDiscoveryEventsBefore_DeletesInBatches(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	defer func(batch int) { discoveryEventDeleteBatch = batch }(discoveryEventDeleteBatch)
+	discoveryEventDeleteBatch = 2
+
+	before := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectExec(`DELETE FROM discovery_log_events`).WithArgs(before, 2).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM discovery_log_events`).WithArgs(before, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	deleted, err := NewFromPool(sqlDB).DeleteDiscoveryEventsBefore(context.Background(), before)
+	if err != nil || deleted != 2 {
+		t.Errorf("DeleteDiscoveryEventsBefore: got %d, %v; want 2", deleted, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
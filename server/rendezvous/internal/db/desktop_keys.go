@@ -0,0 +1,59 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"rendezvous/internal/apperr"
+)
+
+// ErrDesktopKeyNotFound is returned when a desktop device has not enrolled
+var ErrDesktopKeyNotFound = apperr.New(apperr.ErrNotFound, "desktop_key_not_found", "desktop device not enrolled")
+
+// ErrDesktopKeyConflict is returned when a desktop device is already
+// enrolled with another key
+var ErrDesktopKeyConflict = apperr.New(apperr.ErrConflict, "desktop_key_conflict", "desktop device enrolled with another key")
+
+// EnrollDesktopKey stores the key a desktop device enrolled at install time.
+// Enrolling the same key again succeeds; a device's key is never replaced.
+// Keys are stored under data minimization too: without one a desktop device
+// cannot attest at all, and a key says nothing about the gateways a device
+// was given.
+func (d *Database) EnrollDesktopKey(ctx context.Context, deviceID string, publicKey []byte) error {
+	var enrolled []byte
+	err := d.pool.QueryRowContext(ctx, `
+		WITH inserted AS (
+			INSERT INTO desktop_device_keys (device_id, public_key) VALUES ($1, $2)
+			ON CONFLICT (device_id) DO NOTHING
+			RETURNING public_key
+		)
+		SELECT public_key FROM inserted
+		UNION ALL
+		SELECT public_key FROM desktop_device_keys WHERE device_id = $1
+		LIMIT 1
+	`, deviceID, publicKey).Scan(&enrolled)
+	if err != nil {
+		return fmt.Errorf("failed to enroll desktop key: %w", classify(err))
+	}
+	if !bytes.Equal(enrolled, publicKey) {
+		return ErrDesktopKeyConflict
+	}
+	return nil
+}
+
+// GetDesktopKey returns a desktop device's enrolled key
+func (d *Database) GetDesktopKey(ctx context.Context, deviceID string) ([]byte, error) {
+	var publicKey []byte
+	err := d.pool.QueryRowContext(ctx,
+		`SELECT public_key FROM desktop_device_keys WHERE device_id = $1`, deviceID).Scan(&publicKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDesktopKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get desktop key: %w", classify(err))
+	}
+	return publicKey, nil
+}
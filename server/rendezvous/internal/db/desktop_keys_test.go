@@ -0,0 +1,59 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestDesktopKeys_EnrollOnce(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping desktop key tests")
+	}
+	if err := RunMigrations(databaseURL); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	ctx := context.Background()
+	database, err := New(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer database.Close()
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	deviceID := "device-" + hex.EncodeToString(b)
+	key := make([]byte, 32)
+	other := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(other); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.GetDesktopKey(ctx, deviceID); !errors.Is(err, ErrDesktopKeyNotFound) {
+		t.Fatalf("GetDesktopKey before enrollment: %v, want ErrDesktopKeyNotFound", err)
+	}
+	if err := database.EnrollDesktopKey(ctx, deviceID, key); err != nil {
+		t.Fatalf("EnrollDesktopKey: %v", err)
+	}
+	// Enrolling the same key again is accepted, another key is not
+	if err := database.EnrollDesktopKey(ctx, deviceID, key); err != nil {
+		t.Fatalf("EnrollDesktopKey again: %v", err)
+	}
+	if err := database.EnrollDesktopKey(ctx, deviceID, other); !errors.Is(err, ErrDesktopKeyConflict) {
+		t.Fatalf("EnrollDesktopKey with another key: %v, want ErrDesktopKeyConflict", err)
+	}
+	stored, err := database.GetDesktopKey(ctx, deviceID)
+	if err != nil || !bytes.Equal(stored, key) {
+		t.Errorf("GetDesktopKey: %x, %v", stored, err)
+	}
+}
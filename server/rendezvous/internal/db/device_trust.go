@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"rendezvous/internal/apperr"
+)
+
+// Device trust tiers
+const (
+	DeviceTierLimited = "limited"
+	DeviceTierTrusted = "trusted"
+)
+
+// ErrDeviceNotFound is returned when a device has no trust state
+var ErrDeviceNotFound = apperr.New(apperr.ErrNotFound, "device_not_found", "device not found")
+
+const deviceTrustColumns = `device_id, tier, first_seen_at, probation_started_at, valid_attestations,
+	successful_connections, tier_changed_at, last_anomaly, last_anomaly_at`
+
+func scanDeviceTrust(row interface{ Scan(...interface{}) error }) (*DeviceTrust, error) {
+	var t DeviceTrust
+	err := row.Scan(&t.DeviceID, &t.Tier, &t.FirstSeenAt, &t.ProbationStartedAt, &t.ValidAttestations,
+		&t.SuccessfulConnections, &t.TierChangedAt, &t.LastAnomaly, &t.LastAnomalyAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetDeviceTrust returns a device's trust state
+func (d *Database) GetDeviceTrust(ctx context.Context, deviceID string) (*DeviceTrust, error) {
+	t, err := scanDeviceTrust(d.pool.QueryRowContext(ctx,
+		`SELECT `+deviceTrustColumns+` FROM device_trust WHERE device_id = $1`, deviceID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device trust: %w", classify(err))
+	}
+	return t, nil
+}
+
+// RecordDeviceAttestation counts a valid attestation for a device, starting
+// its probation if it is new, and returns its updated state
+func (d *Database) RecordDeviceAttestation(ctx context.Context, deviceID string) (*DeviceTrust, error) {
+	t, err := scanDeviceTrust(d.pool.QueryRowContext(ctx,
+		`INSERT INTO device_trust (device_id, valid_attestations) VALUES ($1, 1)
+		 ON CONFLICT (device_id) DO UPDATE
+		 SET valid_attestations = device_trust.valid_attestations + 1, updated_at = NOW()
+		 RETURNING `+deviceTrustColumns, deviceID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record device attestation: %w", classify(err))
+	}
+	return t, nil
+}
+
+// RecordDeviceConnection counts a successful gateway connection for a
+// device, starting its probation if it is new, and returns its updated state
+func (d *Database) RecordDeviceConnection(ctx context.Context, deviceID string) (*DeviceTrust, error) {
+	t, err := scanDeviceTrust(d.pool.QueryRowContext(ctx,
+		`INSERT INTO device_trust (device_id, successful_connections) VALUES ($1, 1)
+		 ON CONFLICT (device_id) DO UPDATE
+		 SET successful_connections = device_trust.successful_connections + 1, updated_at = NOW()
+		 RETURNING `+deviceTrustColumns, deviceID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record device connection: %w", classify(err))
+	}
+	return t, nil
+}
+
+// PromoteDevice moves a limited device to the trusted tier. It reports false
+// if the device was not limited, so concurrent promotions happen once.
+func (d *Database) PromoteDevice(ctx context.Context, deviceID string) (bool, error) {
+	result, err := d.pool.ExecContext(ctx,
+		`UPDATE device_trust SET tier = 'trusted', tier_changed_at = NOW(), updated_at = NOW()
+		 WHERE device_id = $1 AND tier = 'limited'`, deviceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to promote device: %w", classify(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to promote device: %w", classify(err))
+	}
+	return rows == 1, nil
+}
+
+// DemoteDevice records an anomaly for a device: it returns to the limited
+// tier and restarts its probation with no attestations or connections
+// counted. It reports whether the device was trusted.
+func (d *Database) DemoteDevice(ctx context.Context, deviceID, reason string) (bool, error) {
+	tx, err := d.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var tier string
+	err = tx.QueryRowContext(ctx, `SELECT tier FROM device_trust WHERE device_id = $1 FOR UPDATE`, deviceID).Scan(&tier)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to read device trust: %w", classify(err))
+	}
+	demoted := tier == DeviceTierTrusted
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO device_trust (device_id, last_anomaly, last_anomaly_at) VALUES ($1, $2, NOW())
+		 ON CONFLICT (device_id) DO UPDATE
+		 SET tier = 'limited', probation_started_at = NOW(), valid_attestations = 0, successful_connections = 0,
+		     tier_changed_at = CASE WHEN $3 THEN NOW() ELSE device_trust.tier_changed_at END,
+		     last_anomaly = $2, last_anomaly_at = NOW(), updated_at = NOW()`,
+		deviceID, reason, demoted)
+	if err != nil {
+		return false, fmt.Errorf("failed to demote device: %w", classify(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit device demotion: %w", classify(err))
+	}
+	return demoted, nil
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DiscoveryChannelStats is the public success rate of one discovery channel
+type DiscoveryChannelStats struct {
+	Channel     string  `json:"channel"`
+	Attempts    int64   `json:"attempts"`
+	Successes   int64   `json:"successes"`
+	SuccessRate float64 `json:"success_rate"`
+}
+
+// HoneypotActivity aggregates discovery logs that targeted one honeypot gateway
+// over one channel
+type HoneypotActivity struct {
+	GatewayID       string    `json:"gateway_id"`
+	Region          string    `json:"region"`
+	Channel         string    `json:"channel"`
+	Attempts        int64     `json:"attempts"`
+	Successes       int64     `json:"successes"`
+	DistinctClients int64     `json:"distinct_clients"`
+	FirstSeen       time.Time `json:"first_seen_at"`
+	LastSeen        time.Time `json:"last_seen_at"`
+}
+
+// GetDiscoveryStats aggregates discovery success per channel since the given
+// time. Logs that targeted honeypot gateways are excluded so adversarial
+// clients cannot skew the public numbers.
+func (d *Database) GetDiscoveryStats(ctx context.Context, since time.Time) ([]DiscoveryChannelStats, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT channel_type, COUNT(*), COUNT(*) FILTER (WHERE success)
+		 FROM discovery_logs
+		 WHERE is_honeypot = FALSE AND created_at >= $1
+		 GROUP BY channel_type
+		 ORDER BY channel_type`,
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query discovery stats: %w", classify(err))
+	}
+	defer rows.Close()
+
+	stats := []DiscoveryChannelStats{}
+	for rows.Next() {
+		var s DiscoveryChannelStats
+		if err := rows.Scan(&s.Channel, &s.Attempts, &s.Successes); err != nil {
+			return nil, fmt.Errorf("failed to scan discovery stats: %w", classify(err))
+		}
+		if s.Attempts > 0 {
+			s.SuccessRate = float64(s.Successes) / float64(s.Attempts)
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
+
+// GetHoneypotActivity aggregates honeypot-targeted discovery logs per honeypot
+// gateway and channel since the given time, busiest first.
+func (d *Database) GetHoneypotActivity(ctx context.Context, since time.Time) ([]HoneypotActivity, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT dl.gateway_id, g.region, dl.channel_type,
+		        COUNT(*), COUNT(*) FILTER (WHERE dl.success), COUNT(DISTINCT COALESCE(host(dl.client_ip), dl.client_bucket)),
+		        MIN(dl.created_at), MAX(dl.created_at)
+		 FROM discovery_logs dl
+		 JOIN gateways g ON g.id = dl.gateway_id
+		 WHERE dl.is_honeypot = TRUE AND dl.created_at >= $1
+		 GROUP BY dl.gateway_id, g.region, dl.channel_type
+		 ORDER BY COUNT(*) DESC
+		 LIMIT 500`,
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query honeypot activity: %w", classify(err))
+	}
+	defer rows.Close()
+
+	activity := []HoneypotActivity{}
+	for rows.Next() {
+		var a HoneypotActivity
+		if err := rows.Scan(
+			&a.GatewayID, &a.Region, &a.Channel,
+			&a.Attempts, &a.Successes, &a.DistinctClients,
+			&a.FirstSeen, &a.LastSeen,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan honeypot activity: %w", classify(err))
+		}
+		activity = append(activity, a)
+	}
+
+	return activity, rows.Err()
+}
+
+// GatewayLatency is the latency clients measured to one gateway in
+// successful discovery attempts
+type GatewayLatency struct {
+	GatewayID string `json:"gateway_id"`
+	Samples   int64  `json:"samples"`
+	P50Ms     int    `json:"p50_ms"`
+	P95Ms     int    `json:"p95_ms"`
+}
+
+// GetGatewayLatencyStats returns the median and 95th percentile latency of
+// successful discovery attempts per gateway since the given time. Gateways
+// with fewer than minSamples measurements are left out. Honeypots are
+// included, so packs list latency for them like any other gateway.
+func (d *Database) GetGatewayLatencyStats(ctx context.Context, since time.Time, minSamples int) ([]GatewayLatency, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT gateway_id, COUNT(*),
+		        ROUND(percentile_cont(0.5) WITHIN GROUP (ORDER BY latency_ms)),
+		        ROUND(percentile_cont(0.95) WITHIN GROUP (ORDER BY latency_ms))
+		 FROM discovery_logs
+		 WHERE success AND gateway_id IS NOT NULL AND latency_ms IS NOT NULL AND created_at >= $1
+		 GROUP BY gateway_id
+		 HAVING COUNT(*) >= $2`,
+		since,
+		minSamples,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gateway latency: %w", classify(err))
+	}
+	defer rows.Close()
+
+	stats := []GatewayLatency{}
+	for rows.Next() {
+		var l GatewayLatency
+		if err := rows.Scan(&l.GatewayID, &l.Samples, &l.P50Ms, &l.P95Ms); err != nil {
+			return nil, fmt.Errorf("failed to scan gateway latency: %w", classify(err))
+		}
+		stats = append(stats, l)
+	}
+
+	return stats, rows.Err()
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+	"rendezvous/internal/cache"
+)
+
+// DefaultDiscoveryRegion is the region of the discovery config used for
+// regions without their own
+const DefaultDiscoveryRegion = "default"
+
+// GetDiscoveryConfigs returns every region's discovery config, ordered by
+// region. Results come from the policy cache when one is set and must not be
+// modified.
+func (d *Database) GetDiscoveryConfigs(ctx context.Context) ([]*DiscoveryConfig, error) {
+	if d.policy != nil {
+		return cache.Load(ctx, d.policy, cache.TableDiscoveryConfigs, d.queryDiscoveryConfigs)
+	}
+	return d.queryDiscoveryConfigs(ctx)
+}
+
+func (d *Database) queryDiscoveryConfigs(ctx context.Context) ([]*DiscoveryConfig, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT region, channels, scan_interval, battery_aware, updated_at
+		 FROM discovery_configs
+		 ORDER BY region`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query discovery configs: %w", classify(err))
+	}
+	defer rows.Close()
+
+	configs := []*DiscoveryConfig{}
+	for rows.Next() {
+		var c DiscoveryConfig
+		if err := rows.Scan(&c.Region, pq.Array(&c.Channels), &c.ScanInterval, &c.BatteryAware, &c.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan discovery config: %w", classify(err))
+		}
+		configs = append(configs, &c)
+	}
+	return configs, rows.Err()
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// EndpointKey identifies a pool endpoint of a transport
+type EndpointKey struct {
+	Transport string
+	Endpoint  string
+}
+
+// EndpointBurn summarizes one epoch of a transport's pool: how many of its
+// endpoints were allocated and how many of those were reported unusable
+type EndpointBurn struct {
+	Epoch     int64   `json:"epoch"`
+	Transport string  `json:"transport"`
+	Allocated int64   `json:"allocated"` // Endpoints allocated in at least one pack
+	Burned    int64   `json:"burned"`    // Allocated endpoints reported unusable
+	BurnRate  float64 `json:"burn_rate"` // Burned over allocated
+	Packs     int64   `json:"packs"`     // Allocations across all endpoints
+	Failures  int64   `json:"failures"`  // Unusable reports across all endpoints
+}
+
+// RecordEndpointAllocations adds, per pool endpoint, the packs it was
+// allocated in during epoch
+func (d *Database) RecordEndpointAllocations(ctx context.Context, epoch int64, counts map[EndpointKey]int64) error {
+	tx, err := d.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for key, packs := range counts {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO endpoint_allocations (epoch, transport_type, endpoint, packs)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (epoch, transport_type, endpoint) DO UPDATE
+			 SET packs = endpoint_allocations.packs + EXCLUDED.packs`,
+			epoch,
+			key.Transport,
+			key.Endpoint,
+			packs,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record endpoint allocation: %w", classify(err))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit endpoint allocations: %w", classify(err))
+	}
+	return nil
+}
+
+// RecordEndpointFailure counts a report that an endpoint allocated in epoch
+// was unusable. Endpoints never allocated in the epoch are ignored, so
+// clients cannot fill the table with names of their choosing.
+func (d *Database) RecordEndpointFailure(ctx context.Context, epoch int64, transport, endpoint string) error {
+	_, err := d.pool.ExecContext(
+		ctx,
+		`UPDATE endpoint_allocations SET failures = failures + 1
+		 WHERE epoch = $1 AND transport_type = $2 AND endpoint = $3`,
+		epoch,
+		transport,
+		endpoint,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record endpoint failure: %w", classify(err))
+	}
+	return nil
+}
+
+// GetEndpointBurn returns the burn of each transport's pool for epochs
+// since the given one, newest first
+func (d *Database) GetEndpointBurn(ctx context.Context, sinceEpoch int64) ([]*EndpointBurn, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT epoch, transport_type, COUNT(*), COUNT(*) FILTER (WHERE failures > 0),
+		        SUM(packs), SUM(failures)
+		 FROM endpoint_allocations
+		 WHERE epoch >= $1
+		 GROUP BY epoch, transport_type
+		 ORDER BY epoch DESC, transport_type`,
+		sinceEpoch,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query endpoint burn: %w", classify(err))
+	}
+	defer rows.Close()
+
+	burn := []*EndpointBurn{}
+	for rows.Next() {
+		var b EndpointBurn
+		if err := rows.Scan(&b.Epoch, &b.Transport, &b.Allocated, &b.Burned, &b.Packs, &b.Failures); err != nil {
+			return nil, fmt.Errorf("failed to scan endpoint burn: %w", classify(err))
+		}
+		if b.Allocated > 0 {
+			b.BurnRate = float64(b.Burned) / float64(b.Allocated)
+		}
+		burn = append(burn, &b)
+	}
+	return burn, rows.Err()
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"rendezvous/internal/apperr"
+)
+
+var (
+	// ErrEnrollmentTokenInvalid is returned when no enrollment token matches
+	ErrEnrollmentTokenInvalid = apperr.New(apperr.ErrUnauthorized, "invalid_enrollment_token", "invalid enrollment token")
+	// ErrEnrollmentTokenExpired is returned when an unused token has expired
+	ErrEnrollmentTokenExpired = apperr.New(apperr.ErrUnauthorized, "enrollment_token_expired", "enrollment token expired")
+	// ErrEnrollmentTokenUsed is returned when a token has already been redeemed
+	ErrEnrollmentTokenUsed = apperr.New(apperr.ErrConflict, "enrollment_token_used", "enrollment token already used")
+)
+
+// CreateEnrollmentToken stores a new enrollment token by its hash.
+func (d *Database) CreateEnrollmentToken(
+	ctx context.Context,
+	tokenHash string,
+	operatorID string,
+	region string,
+	createdBy string,
+	expiresAt time.Time,
+) (*EnrollmentToken, error) {
+	token := EnrollmentToken{
+		OperatorID: operatorID,
+		Region:     region,
+		CreatedBy:  createdBy,
+		ExpiresAt:  expiresAt,
+	}
+	err := d.conn(ctx).QueryRowContext(
+		ctx,
+		`INSERT INTO gateway_enrollment_tokens (token_hash, operator_id, region, created_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING id, created_at`,
+		tokenHash,
+		operatorID,
+		region,
+		createdBy,
+		expiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create enrollment token: %w", classify(err))
+	}
+	return &token, nil
+}
+
+// RedeemEnrollmentToken marks the token with tokenHash used at now and
+// returns it. The update only matches an unused, unexpired token, so of
+// concurrent redemptions exactly one succeeds; the others get
+// ErrEnrollmentTokenUsed.
+func (d *Database) RedeemEnrollmentToken(ctx context.Context, tokenHash string, now time.Time) (*EnrollmentToken, error) {
+	var token EnrollmentToken
+	err := d.pool.QueryRowContext(
+		ctx,
+		`UPDATE gateway_enrollment_tokens SET used_at = $2
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+		 RETURNING id, operator_id, region, created_by, created_at, expires_at, used_at`,
+		tokenHash,
+		now,
+	).Scan(&token.ID, &token.OperatorID, &token.Region, &token.CreatedBy, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt)
+	if err == nil {
+		return &token, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to redeem enrollment token: %w", classify(err))
+	}
+
+	// Nothing redeemable: tell the agent why
+	var usedAt *time.Time
+	err = d.pool.QueryRowContext(
+		ctx,
+		`SELECT used_at FROM gateway_enrollment_tokens WHERE token_hash = $1`,
+		tokenHash,
+	).Scan(&usedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, ErrEnrollmentTokenInvalid
+	case err != nil:
+		return nil, fmt.Errorf("failed to load enrollment token: %w", classify(err))
+	case usedAt != nil:
+		return nil, ErrEnrollmentTokenUsed
+	default:
+		return nil, ErrEnrollmentTokenExpired
+	}
+}
+
+// CompleteEnrollment records the gateway registered with a redeemed token.
+func (d *Database) CompleteEnrollment(ctx context.Context, tokenID, gatewayID string) error {
+	_, err := d.pool.ExecContext(
+		ctx,
+		`UPDATE gateway_enrollment_tokens SET gateway_id = $2 WHERE id = $1`,
+		tokenID,
+		gatewayID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to complete enrollment: %w", classify(err))
+	}
+	return nil
+}
+
+// ReleaseEnrollmentToken makes a redeemed token usable again when no gateway
+// was registered with it, so a failed bootstrap can be retried.
+func (d *Database) ReleaseEnrollmentToken(ctx context.Context, tokenID string) error {
+	_, err := d.pool.ExecContext(
+		ctx,
+		`UPDATE gateway_enrollment_tokens SET used_at = NULL WHERE id = $1 AND gateway_id IS NULL`,
+		tokenID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release enrollment token: %w", classify(err))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedeemEnrollmentToken_ConcurrentSingleUse(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping enrollment token tests")
+	}
+	if err := RunMigrations(databaseURL); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	ctx := context.Background()
+	database, err := New(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer database.Close()
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	hash := hex.EncodeToString(b)
+	now := time.Now().UTC()
+	if _, err := database.CreateEnrollmentToken(ctx, hash, "op-test", "us-east-1", "test", now.Add(time.Hour)); err != nil {
+		t.Fatalf("CreateEnrollmentToken: %v", err)
+	}
+
+	const agents = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, agents)
+	for i := 0; i < agents; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := database.RedeemEnrollmentToken(ctx, hash, now)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	redeemed := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			redeemed++
+		case !errors.Is(err, ErrEnrollmentTokenUsed):
+			t.Errorf("RedeemEnrollmentToken: %v", err)
+		}
+	}
+	if redeemed != 1 {
+		t.Errorf("redeemed %d times, want once", redeemed)
+	}
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The ephemeral tables back internal/store's Postgres backend. Every method
+// takes the current time from the caller so the store's clock decides expiry.
+
+// PutChallenge stores a single-use challenge until expiresAt
+func (d *Database) PutChallenge(ctx context.Context, challenge string, expiresAt time.Time) error {
+	_, err := d.pool.ExecContext(
+		ctx,
+		`INSERT INTO ephemeral_challenges (challenge, expires_at) VALUES ($1, $2)
+		 ON CONFLICT (challenge) DO UPDATE SET expires_at = EXCLUDED.expires_at`,
+		challenge,
+		expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store challenge: %w", classify(err))
+	}
+	return nil
+}
+
+// ConsumeChallenge deletes a challenge, reporting whether it was stored and
+// unexpired at now
+func (d *Database) ConsumeChallenge(ctx context.Context, challenge string, now time.Time) (bool, error) {
+	result, err := d.pool.ExecContext(
+		ctx,
+		`DELETE FROM ephemeral_challenges WHERE challenge = $1 AND expires_at > $2`,
+		challenge,
+		now,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume challenge: %w", classify(err))
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to consume challenge: %w", classify(err))
+	}
+	return n == 1, nil
+}
+
+// AllowRate applies the generic cell rate algorithm to key: a request at now
+// is allowed when it moves the key's theoretical arrival time no further
+// than tolerance past now. Each allowed request advances it by interval.
+func (d *Database) AllowRate(ctx context.Context, key string, now time.Time, interval, tolerance time.Duration) (bool, error) {
+	var allowed int
+	err := d.pool.QueryRowContext(
+		ctx,
+		`INSERT INTO ephemeral_rate_limits AS r (key, tat)
+		 VALUES ($1, $2::TIMESTAMPTZ + $3::BIGINT * INTERVAL '1 microsecond')
+		 ON CONFLICT (key) DO UPDATE
+		 SET tat = GREATEST(r.tat, $2::TIMESTAMPTZ) + $3::BIGINT * INTERVAL '1 microsecond'
+		 WHERE GREATEST(r.tat, $2::TIMESTAMPTZ) + $3::BIGINT * INTERVAL '1 microsecond'
+		     <= $2::TIMESTAMPTZ + $4::BIGINT * INTERVAL '1 microsecond'
+		 RETURNING 1`,
+		key,
+		now,
+		interval.Microseconds(),
+		tolerance.Microseconds(),
+	).Scan(&allowed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to apply rate limit: %w", classify(err))
+	}
+	return true, nil
+}
+
+// LookupAssignment returns the value assigned to key and extends its expiry
+// to expiresAt. ok is false when key is unassigned or expired at now.
+func (d *Database) LookupAssignment(ctx context.Context, key string, now, expiresAt time.Time) (value string, ok bool, err error) {
+	err = d.pool.QueryRowContext(
+		ctx,
+		`UPDATE ephemeral_assignments SET expires_at = $3
+		 WHERE key = $1 AND expires_at > $2
+		 RETURNING value`,
+		key,
+		now,
+		expiresAt,
+	).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to look up assignment: %w", classify(err))
+	}
+	return value, true, nil
+}
+
+// Assign sets the value assigned to key until expiresAt
+func (d *Database) Assign(ctx context.Context, key, value string, expiresAt time.Time) error {
+	_, err := d.pool.ExecContext(
+		ctx,
+		`INSERT INTO ephemeral_assignments (key, value, expires_at) VALUES ($1, $2, $3)
+		 ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at`,
+		key,
+		value,
+		expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store assignment: %w", classify(err))
+	}
+	return nil
+}
+
+// Reserve takes the next reservation on key and returns how many have been
+// taken, counting from 1 again once the previous ones expired at now. The
+// key then expires at expiresAt.
+func (d *Database) Reserve(ctx context.Context, key string, now, expiresAt time.Time) (int64, error) {
+	var count int64
+	err := d.pool.QueryRowContext(
+		ctx,
+		`INSERT INTO ephemeral_reservations AS r (key, count, expires_at) VALUES ($1, 1, $3)
+		 ON CONFLICT (key) DO UPDATE
+		 SET count = CASE WHEN r.expires_at > $2 THEN r.count + 1 ELSE 1 END,
+		     expires_at = EXCLUDED.expires_at
+		 RETURNING count`,
+		key,
+		now,
+		expiresAt,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve: %w", classify(err))
+	}
+	return count, nil
+}
+
+// PruneEphemeral deletes ephemeral rows that expired before now and returns
+// how many were deleted
+func (d *Database) PruneEphemeral(ctx context.Context, now time.Time) (int64, error) {
+	var pruned int64
+	for _, query := range []string{
+		`DELETE FROM ephemeral_challenges WHERE expires_at <= $1`,
+		`DELETE FROM ephemeral_rate_limits WHERE tat <= $1`,
+		`DELETE FROM ephemeral_assignments WHERE expires_at <= $1`,
+		`DELETE FROM ephemeral_reservations WHERE expires_at <= $1`,
+	} {
+		result, err := d.pool.ExecContext(ctx, query, now)
+		if err != nil {
+			return pruned, fmt.Errorf("failed to prune ephemeral state: %w", classify(err))
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return pruned, fmt.Errorf("failed to prune ephemeral state: %w", classify(err))
+		}
+		pruned += n
+	}
+	return pruned, nil
+}
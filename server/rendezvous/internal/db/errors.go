@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/lib/pq"
+	"rendezvous/internal/apperr"
+)
+
+// PostgreSQL error codes and classes the service layers distinguish
+const (
+	uniqueViolation      = "23505"
+	invalidTextValue     = "22P02"
+	connectionException  = "08"
+	insufficientResource = "53"
+	operatorIntervention = "57"
+)
+
+// classify marks a driver error with its apperr kind: lost connections and
+// an overloaded or restarting server are unavailable, unique violations
+// conflict, and malformed values such as a bad UUID are invalid input.
+// Other errors are returned unchanged.
+func classify(err error) error {
+	var pqErr *pq.Error
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &pqErr):
+		switch {
+		case pqErr.Code == uniqueViolation:
+			return apperr.WithKind(apperr.ErrConflict, err)
+		case pqErr.Code == invalidTextValue:
+			return apperr.WithKind(apperr.ErrInvalidInput, err)
+		case pqErr.Code.Class() == connectionException,
+			pqErr.Code.Class() == insufficientResource,
+			pqErr.Code.Class() == operatorIntervention:
+			return apperr.WithKind(apperr.ErrUnavailable, err)
+		}
+	case errors.Is(err, driver.ErrBadConn),
+		errors.Is(err, sql.ErrConnDone),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr):
+		return apperr.WithKind(apperr.ErrUnavailable, err)
+	}
+	return err
+}
+
+// ClassifyError marks a driver error with its apperr kind, for callers that
+// query the pool directly.
+func ClassifyError(err error) error {
+	return classify(err)
+}
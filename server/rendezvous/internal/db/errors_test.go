@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"rendezvous/internal/apperr"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error // nil when the error should have no kind
+	}{
+		{"unique violation", &pq.Error{Code: uniqueViolation}, apperr.ErrConflict},
+		{"invalid uuid", &pq.Error{Code: invalidTextValue}, apperr.ErrInvalidInput},
+		{"connection failure", &pq.Error{Code: "08006"}, apperr.ErrUnavailable},
+		{"too many connections", &pq.Error{Code: "53300"}, apperr.ErrUnavailable},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, apperr.ErrUnavailable},
+		{"bad connection", driver.ErrBadConn, apperr.ErrUnavailable},
+		{"deadline", context.DeadlineExceeded, apperr.ErrUnavailable},
+		{"syntax error", &pq.Error{Code: "42601"}, nil},
+		{"other", errors.New("boom"), nil},
+	}
+	kinds := []error{apperr.ErrNotFound, apperr.ErrConflict, apperr.ErrUnavailable, apperr.ErrInvalidInput, apperr.ErrUnauthorized}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classify(tt.err)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("classify dropped the original error: %v", err)
+			}
+			for _, kind := range kinds {
+				if got := errors.Is(err, kind); got != (kind == tt.want) {
+					t.Errorf("errors.Is(%v): got %v", kind, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGetGatewayByID_NotFoundIsTyped(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err = NewFromPool(sqlDB).GetGatewayByID(context.Background(), "gw-1")
+	if !errors.Is(err, ErrGatewayNotFound) || !errors.Is(err, apperr.ErrNotFound) {
+		t.Errorf("GetGatewayByID: got %v, want ErrGatewayNotFound of kind ErrNotFound", err)
+	}
+	if got := apperr.Code(err); got != "gateway_not_found" {
+		t.Errorf("code: got %q, want gateway_not_found", got)
+	}
+}
+
+func TestDeleteRollout_ConnectionLossIsUnavailable(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectExec(`DELETE FROM rollouts`).WillReturnError(&pq.Error{Code: "08006"})
+
+	err = NewFromPool(sqlDB).DeleteRollout(context.Background(), "scan_interval_120", "")
+	if !errors.Is(err, apperr.ErrUnavailable) {
+		t.Errorf("DeleteRollout: got %v, want ErrUnavailable", err)
+	}
+}
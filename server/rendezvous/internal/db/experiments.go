@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lib/pq"
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/cache"
+)
+
+// ErrExperimentNotFound is returned when an experiment does not exist
+var ErrExperimentNotFound = apperr.New(apperr.ErrNotFound, "experiment_not_found", "experiment not found")
+
+// GetExperiments returns every experiment, ordered by name. Results come
+// from the policy cache when one is set and must not be modified.
+func (d *Database) GetExperiments(ctx context.Context) ([]*Experiment, error) {
+	if d.policy != nil {
+		return cache.Load(ctx, d.policy, cache.TableExperiments, d.queryExperiments)
+	}
+	return d.queryExperiments(ctx)
+}
+
+func (d *Database) queryExperiments(ctx context.Context) ([]*Experiment, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT name, description, variants, regions, platforms, starts_at, ends_at, created_at, updated_at
+		 FROM experiments
+		 ORDER BY name`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query experiments: %w", classify(err))
+	}
+	defer rows.Close()
+
+	experiments := []*Experiment{}
+	for rows.Next() {
+		var e Experiment
+		var variants []byte
+		var startsAt, endsAt sql.NullTime
+		if err := rows.Scan(&e.Name, &e.Description, &variants, pq.Array(&e.Regions), pq.Array(&e.Platforms),
+			&startsAt, &endsAt, &e.CreatedAt, &e.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan experiment: %w", classify(err))
+		}
+		if err := json.Unmarshal(variants, &e.Variants); err != nil {
+			return nil, fmt.Errorf("failed to decode variants of experiment %s: %w", e.Name, err)
+		}
+		if startsAt.Valid {
+			e.StartsAt = &startsAt.Time
+		}
+		if endsAt.Valid {
+			e.EndsAt = &endsAt.Time
+		}
+		experiments = append(experiments, &e)
+	}
+	return experiments, rows.Err()
+}
+
+// UpsertExperiment creates or replaces an experiment and returns it as
+// stored. Replacing the variants reassigns devices.
+func (d *Database) UpsertExperiment(ctx context.Context, e *Experiment) (*Experiment, error) {
+	variants, err := json.Marshal(e.Variants)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode experiment variants: %w", err)
+	}
+	stored := *e
+	stored.Regions = append([]string{}, e.Regions...)
+	stored.Platforms = append([]string{}, e.Platforms...)
+	err = d.conn(ctx).QueryRowContext(
+		ctx,
+		`INSERT INTO experiments (name, description, variants, regions, platforms, starts_at, ends_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (name) DO UPDATE
+		 SET description = EXCLUDED.description, variants = EXCLUDED.variants, regions = EXCLUDED.regions,
+		     platforms = EXCLUDED.platforms, starts_at = EXCLUDED.starts_at, ends_at = EXCLUDED.ends_at,
+		     updated_at = NOW()
+		 RETURNING created_at, updated_at`,
+		e.Name,
+		e.Description,
+		variants,
+		pq.Array(stored.Regions),
+		pq.Array(stored.Platforms),
+		e.StartsAt,
+		e.EndsAt,
+	).Scan(&stored.CreatedAt, &stored.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert experiment: %w", classify(err))
+	}
+	return &stored, nil
+}
+
+// DeleteExperiment removes an experiment; its devices get their usual
+// parameters from their next pack
+func (d *Database) DeleteExperiment(ctx context.Context, name string) error {
+	result, err := d.conn(ctx).ExecContext(ctx, `DELETE FROM experiments WHERE name = $1`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete experiment: %w", classify(err))
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read delete result: %w", classify(err))
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("experiment %s: %w", name, ErrExperimentNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"rendezvous/internal/apperr"
+)
+
+var (
+	// ErrFederationPeerNotFound is returned when no peer has the given ID
+	ErrFederationPeerNotFound = apperr.New(apperr.ErrNotFound, "federation_peer_not_found", "federation peer not found")
+	// ErrFederationPeerExists is returned when another peer has the same name
+	ErrFederationPeerExists = apperr.New(apperr.ErrConflict, "federation_peer_exists", "a federation peer with this name already exists")
+	// ErrAnnouncementStale is returned for an announcement no newer than the
+	// last one imported from the peer, such as a replayed one
+	ErrAnnouncementStale = apperr.New(apperr.ErrConflict, "announcement_stale", "announcement is not newer than the last one imported")
+)
+
+const federationPeerColumns = `p.id, p.name, p.announcement_url, p.public_key, p.enabled, p.created_at, p.updated_at,
+	p.last_polled_at, p.last_announced_at, p.last_error,
+	(SELECT COUNT(*) FROM federated_gateways g WHERE g.peer_id = p.id)`
+
+func scanFederationPeer(row interface{ Scan(...interface{}) error }) (*FederationPeer, error) {
+	var p FederationPeer
+	err := row.Scan(&p.ID, &p.Name, &p.AnnouncementURL, &p.PublicKey, &p.Enabled, &p.CreatedAt, &p.UpdatedAt,
+		&p.LastPolledAt, &p.LastAnnouncedAt, &p.LastError, &p.Gateways)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListFederationPeers returns every peer by name, or only the enabled ones
+func (d *Database) ListFederationPeers(ctx context.Context, enabledOnly bool) ([]*FederationPeer, error) {
+	rows, err := d.pool.QueryContext(ctx,
+		`SELECT `+federationPeerColumns+` FROM federation_peers p
+		 WHERE p.enabled OR NOT $1
+		 ORDER BY p.name`, enabledOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query federation peers: %w", classify(err))
+	}
+	defer rows.Close()
+
+	peers := []*FederationPeer{}
+	for rows.Next() {
+		p, err := scanFederationPeer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan federation peer: %w", classify(err))
+		}
+		peers = append(peers, p)
+	}
+	return peers, rows.Err()
+}
+
+// GetFederationPeer returns one peer
+func (d *Database) GetFederationPeer(ctx context.Context, id string) (*FederationPeer, error) {
+	p, err := scanFederationPeer(d.pool.QueryRowContext(ctx,
+		`SELECT `+federationPeerColumns+` FROM federation_peers p WHERE p.id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrFederationPeerNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get federation peer: %w", classify(err))
+	}
+	return p, nil
+}
+
+// CreateFederationPeer adds an enabled peer
+func (d *Database) CreateFederationPeer(ctx context.Context, name, announcementURL string, publicKey []byte) (*FederationPeer, error) {
+	p, err := scanFederationPeer(d.conn(ctx).QueryRowContext(ctx,
+		`INSERT INTO federation_peers AS p (name, announcement_url, public_key) VALUES ($1, $2, $3)
+		 RETURNING `+federationPeerColumns, name, announcementURL, publicKey))
+	if err != nil {
+		if errors.Is(classify(err), apperr.ErrConflict) {
+			return nil, ErrFederationPeerExists
+		}
+		return nil, fmt.Errorf("failed to create federation peer: %w", classify(err))
+	}
+	return p, nil
+}
+
+// UpdateFederationPeer changes a peer's name, announcement URL and pinned
+// key. A new key or URL may announce an older timestamp, so the replay
+// check starts over.
+func (d *Database) UpdateFederationPeer(ctx context.Context, id, name, announcementURL string, publicKey []byte) (*FederationPeer, error) {
+	p, err := scanFederationPeer(d.conn(ctx).QueryRowContext(ctx,
+		`UPDATE federation_peers AS p
+		 SET name = $2, announcement_url = $3, public_key = $4, last_announced_at = NULL, updated_at = NOW()
+		 WHERE p.id = $1
+		 RETURNING `+federationPeerColumns, id, name, announcementURL, publicKey))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, ErrFederationPeerNotFound
+	case errors.Is(classify(err), apperr.ErrConflict):
+		return nil, ErrFederationPeerExists
+	case err != nil:
+		return nil, fmt.Errorf("failed to update federation peer: %w", classify(err))
+	}
+	return p, nil
+}
+
+// SetFederationPeerEnabled enables or disables a peer. A disabled peer is
+// not polled and its gateways are left out of packs until it is enabled.
+func (d *Database) SetFederationPeerEnabled(ctx context.Context, id string, enabled bool) (*FederationPeer, error) {
+	p, err := scanFederationPeer(d.conn(ctx).QueryRowContext(ctx,
+		`UPDATE federation_peers AS p SET enabled = $2, updated_at = NOW()
+		 WHERE p.id = $1
+		 RETURNING `+federationPeerColumns, id, enabled))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrFederationPeerNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update federation peer: %w", classify(err))
+	}
+	return p, nil
+}
+
+// DeleteFederationPeer removes a peer and every gateway imported from it
+func (d *Database) DeleteFederationPeer(ctx context.Context, id string) error {
+	result, err := d.conn(ctx).ExecContext(ctx, `DELETE FROM federation_peers WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete federation peer: %w", classify(err))
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrFederationPeerNotFound
+	}
+	return nil
+}
+
+// RecordFederationPollError records a failed poll of a peer, keeping its
+// imported gateways
+func (d *Database) RecordFederationPollError(ctx context.Context, peerID, pollErr string) error {
+	_, err := d.pool.ExecContext(ctx,
+		`UPDATE federation_peers SET last_polled_at = NOW(), last_error = $2 WHERE id = $1`, peerID, pollErr)
+	if err != nil {
+		return fmt.Errorf("failed to record federation poll: %w", classify(err))
+	}
+	return nil
+}
+
+// ReconcileFederatedGateways makes a peer's imported gateways match an
+// announcement issued at announcedAt: announced gateways are added or
+// updated and the rest are removed, in one transaction. An announcement no
+// newer than the last one imported is refused with ErrAnnouncementStale.
+func (d *Database) ReconcileFederatedGateways(
+	ctx context.Context,
+	peerID string,
+	announcedAt time.Time,
+	gateways []FederatedGateway,
+) (*FederationImport, error) {
+	tx, err := d.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var lastAnnounced *time.Time
+	err = tx.QueryRowContext(ctx,
+		`SELECT last_announced_at FROM federation_peers WHERE id = $1 FOR UPDATE`, peerID).Scan(&lastAnnounced)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrFederationPeerNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock federation peer: %w", classify(err))
+	}
+	if lastAnnounced != nil && !announcedAt.After(*lastAnnounced) {
+		return nil, ErrAnnouncementStale
+	}
+
+	result := &FederationImport{}
+	ids := make([]string, len(gateways))
+	for i, gw := range gateways {
+		ids[i] = gw.PeerGatewayID
+		var inserted bool
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO federated_gateways
+			 (peer_id, peer_gateway_id, public_key, ip_address, port, transport_types, region, load)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			 ON CONFLICT (peer_id, peer_gateway_id) DO UPDATE
+			 SET public_key = EXCLUDED.public_key, ip_address = EXCLUDED.ip_address, port = EXCLUDED.port,
+			     transport_types = EXCLUDED.transport_types, region = EXCLUDED.region, load = EXCLUDED.load,
+			     updated_at = NOW()
+			 RETURNING (xmax = 0)`,
+			peerID, gw.PeerGatewayID, gw.PublicKey, gw.IPAddress, gw.Port, pq.Array(gw.TransportTypes), gw.Region, gw.Load,
+		).Scan(&inserted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import federated gateway: %w", classify(err))
+		}
+		if inserted {
+			result.Added++
+		} else {
+			result.Updated++
+		}
+	}
+
+	removed, err := tx.ExecContext(ctx,
+		`DELETE FROM federated_gateways WHERE peer_id = $1 AND NOT (peer_gateway_id = ANY($2))`,
+		peerID, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove federated gateways: %w", classify(err))
+	}
+	if rows, err := removed.RowsAffected(); err == nil {
+		result.Removed = int(rows)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE federation_peers SET last_polled_at = NOW(), last_announced_at = $2, last_error = NULL WHERE id = $1`,
+		peerID, announcedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record federation poll: %w", classify(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit federated gateways: %w", classify(err))
+	}
+	return result, nil
+}
+
+// GetFederatedGateways returns the gateways imported for a region from
+// enabled peers whose last announcement was issued since the given time.
+// They are never honeypots and carry the announcing peer's name as their
+// origin and operator.
+func (d *Database) GetFederatedGateways(ctx context.Context, region string, announcedSince time.Time) ([]*Gateway, error) {
+	rows, err := d.pool.QueryContext(ctx,
+		`SELECT g.id, g.public_key, host(g.ip_address), g.port, g.transport_types, g.region, g.load,
+		        g.imported_at, g.updated_at, p.name
+		 FROM federated_gateways g
+		 JOIN federation_peers p ON p.id = g.peer_id
+		 WHERE g.region = $1 AND p.enabled AND p.last_announced_at >= $2
+		 ORDER BY g.load ASC
+		 LIMIT 100`, region, announcedSince)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query federated gateways: %w", classify(err))
+	}
+	defer rows.Close()
+
+	var gateways []*Gateway
+	for rows.Next() {
+		var gw Gateway
+		var transportTypes pq.StringArray
+		if err := rows.Scan(&gw.ID, &gw.PublicKey, &gw.IPAddress, &gw.Port, &transportTypes, &gw.Region, &gw.Load,
+			&gw.CreatedAt, &gw.UpdatedAt, &gw.Origin); err != nil {
+			return nil, fmt.Errorf("failed to scan federated gateway: %w", classify(err))
+		}
+		gw.TransportTypes = []string(transportTypes)
+		gw.Status = "active"
+		gw.ApprovalStatus = "approved"
+		gw.OperatorID = "federation:" + gw.Origin
+		gateways = append(gateways, &gw)
+	}
+	return gateways, rows.Err()
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// Reasons a device is flagged
+const (
+	// FlagSharedAppAttestKey: the device presented an App Attest key bound
+	// to another device, or its own key was presented by another device
+	FlagSharedAppAttestKey = "shared_app_attest_key"
+)
+
+// FlagDevice flags a device for reason, with the App Attest key involved.
+// Flagging a device again for the same reason replaces the key and flag
+// time. Under data minimization nothing is stored.
+func (d *Database) FlagDevice(ctx context.Context, deviceID, reason, keyID string) error {
+	if !d.persistence.TrackDevices() {
+		return nil
+	}
+	_, err := d.pool.ExecContext(ctx, `
+		INSERT INTO flagged_devices (device_id, reason, key_id) VALUES ($1, $2, NULLIF($3, ''))
+		ON CONFLICT (device_id, reason) DO UPDATE SET key_id = EXCLUDED.key_id, flagged_at = NOW()
+	`, deviceID, reason, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to flag device: %w", classify(err))
+	}
+	return nil
+}
+
+// IsDeviceFlagged reports whether a device has been flagged for any reason.
+// Under data minimization no device is.
+func (d *Database) IsDeviceFlagged(ctx context.Context, deviceID string) (bool, error) {
+	if !d.persistence.TrackDevices() {
+		return false, nil
+	}
+	var flagged bool
+	err := d.pool.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM flagged_devices WHERE device_id = $1)`, deviceID).Scan(&flagged)
+	if err != nil {
+		return false, fmt.Errorf("failed to check device flags: %w", classify(err))
+	}
+	return flagged, nil
+}
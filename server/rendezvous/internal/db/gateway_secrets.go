@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GetActiveGatewaySecrets returns the unexpired secret generations of the
+// given gateways, newest first within each gateway.
+func (d *Database) GetActiveGatewaySecrets(ctx context.Context, gatewayIDs []string, now time.Time) ([]*GatewaySecret, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT gateway_id, generation, ciphertext, created_at, expires_at
+		 FROM gateway_secrets
+		 WHERE gateway_id = ANY($1) AND (expires_at IS NULL OR expires_at > $2)
+		 ORDER BY gateway_id, generation DESC`,
+		pq.Array(gatewayIDs),
+		now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gateway secrets: %w", classify(err))
+	}
+	defer rows.Close()
+
+	secrets := []*GatewaySecret{}
+	for rows.Next() {
+		var s GatewaySecret
+		if err := rows.Scan(&s.GatewayID, &s.Generation, &s.Ciphertext, &s.CreatedAt, &s.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan gateway secret: %w", classify(err))
+		}
+		secrets = append(secrets, &s)
+	}
+	return secrets, rows.Err()
+}
+
+// RotateGatewaySecret stores ciphertext as the gateway's next secret
+// generation. The current generation stays valid until previousExpiresAt,
+// and generations already expired at now are deleted. It returns the new
+// generation.
+func (d *Database) RotateGatewaySecret(
+	ctx context.Context,
+	gatewayID string,
+	ciphertext []byte,
+	previousExpiresAt time.Time,
+	now time.Time,
+) (int, error) {
+	tx, err := d.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM gateway_secrets WHERE gateway_id = $1 AND expires_at <= $2`,
+		gatewayID,
+		now,
+	); err != nil {
+		return 0, fmt.Errorf("failed to prune gateway secrets: %w", classify(err))
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE gateway_secrets SET expires_at = $2 WHERE gateway_id = $1 AND expires_at IS NULL`,
+		gatewayID,
+		previousExpiresAt,
+	); err != nil {
+		return 0, fmt.Errorf("failed to expire gateway secret: %w", classify(err))
+	}
+
+	// Concurrent rotations collide on the primary key and return a conflict
+	var generation int
+	err = tx.QueryRowContext(
+		ctx,
+		`INSERT INTO gateway_secrets (gateway_id, generation, ciphertext, created_at)
+		 SELECT $1, COALESCE(MAX(generation), 0) + 1, $2, $3
+		 FROM gateway_secrets WHERE gateway_id = $1
+		 RETURNING generation`,
+		gatewayID,
+		ciphertext,
+		now,
+	).Scan(&generation)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert gateway secret: %w", classify(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit gateway secret: %w", classify(err))
+	}
+	return generation, nil
+}
@@ -0,0 +1,284 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// NewGateway holds the fields supplied when a gateway is registered.
+type NewGateway struct {
+	OperatorID        string
+	PublicKey         []byte
+	IPAddress         string
+	Port              int
+	TransportTypes    []string
+	DiscoveryChannels []string
+	Region            string
+	BandwidthMbps     *int
+	MaxUsers          *int
+	ASN               *int
+	ApprovalStatus    string
+}
+
+// GatewayReview opens review queue items for a gateway in the same
+// transaction that inserts or updates it, so a gateway held for review is
+// never stored without its items
+type GatewayReview struct {
+	Reasons []string
+	Details map[string]interface{}
+}
+
+// InsertGateway inserts a newly registered gateway with its review items, if
+// review is non-nil, and returns its ID. If a gateway with the same public
+// key already exists nothing is written, and the existing gateway's ID is
+// returned with created set to false. This also holds for the loser of two
+// concurrent registrations of the same key.
+func (d *Database) InsertGateway(ctx context.Context, gw *NewGateway, review *GatewayReview) (id string, created bool, err error) {
+	approvalStatus := gw.ApprovalStatus
+	if approvalStatus == "" {
+		approvalStatus = "approved"
+	}
+
+	tx, err := d.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	err = tx.QueryRowContext(
+		ctx,
+		`INSERT INTO gateways
+		 (public_key, ip_address, port, transport_types, discovery_channels, region,
+		  bandwidth_mbps, max_users, operator_id, approval_status, asn)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		 ON CONFLICT (public_key) DO NOTHING
+		 RETURNING id`,
+		gw.PublicKey,
+		gw.IPAddress,
+		gw.Port,
+		pq.StringArray(gw.TransportTypes),
+		pq.StringArray(gw.DiscoveryChannels),
+		gw.Region,
+		gw.BandwidthMbps,
+		gw.MaxUsers,
+		nullableString(gw.OperatorID),
+		approvalStatus,
+		gw.ASN,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Conflict on public_key: report the gateway that already holds it
+		err = tx.QueryRowContext(
+			ctx,
+			`SELECT id FROM gateways WHERE public_key = $1`,
+			gw.PublicKey,
+		).Scan(&id)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to load existing gateway: %w", classify(err))
+		}
+		return id, false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to insert gateway: %w", classify(err))
+	}
+
+	if err := addGatewayReview(ctx, tx, id, review); err != nil {
+		return "", false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", false, fmt.Errorf("failed to commit gateway: %w", classify(err))
+	}
+	return id, true, nil
+}
+
+// addGatewayReview opens a gateway's review items
+func addGatewayReview(ctx context.Context, q execer, gatewayID string, review *GatewayReview) error {
+	if review == nil {
+		return nil
+	}
+	for _, reason := range review.Reasons {
+		if _, err := addReviewItem(ctx, q, "gateway", gatewayID, reason, review.Details); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetGatewayByID returns a gateway regardless of status or approval.
+func (d *Database) GetGatewayByID(ctx context.Context, gatewayID string) (*Gateway, error) {
+	query := `
+		SELECT ` + gatewayColumns + `
+		FROM gateways
+		WHERE id = $1
+	`
+
+	rows, err := d.pool.QueryContext(ctx, query, gatewayID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gateway: %w", classify(err))
+	}
+	defer rows.Close()
+
+	gateways, err := scanGateways(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(gateways) == 0 {
+		return nil, fmt.Errorf("gateway %s: %w", gatewayID, ErrGatewayNotFound)
+	}
+	return gateways[0], nil
+}
+
+// UpdateGatewayRegistration overwrites the registered attributes of a gateway
+// after its operator has confirmed a re-registration, and opens its review
+// items, if review is non-nil, in the same transaction.
+func (d *Database) UpdateGatewayRegistration(ctx context.Context, gatewayID string, gw *NewGateway, review *GatewayReview) error {
+	tx, err := d.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`UPDATE gateways
+		 SET ip_address = $2, port = $3, transport_types = $4, discovery_channels = $5, region = $6,
+		     bandwidth_mbps = $7, max_users = $8, operator_id = $9, approval_status = $10, asn = $11
+		 WHERE id = $1`,
+		gatewayID,
+		gw.IPAddress,
+		gw.Port,
+		pq.StringArray(gw.TransportTypes),
+		pq.StringArray(gw.DiscoveryChannels),
+		gw.Region,
+		gw.BandwidthMbps,
+		gw.MaxUsers,
+		nullableString(gw.OperatorID),
+		gw.ApprovalStatus,
+		gw.ASN,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update gateway registration: %w", classify(err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read update result: %w", classify(err))
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("gateway %s: %w", gatewayID, ErrGatewayNotFound)
+	}
+
+	if err := addGatewayReview(ctx, tx, gatewayID, review); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit gateway registration: %w", classify(err))
+	}
+	return nil
+}
+
+// CountGatewaysByOperator counts the non-rejected gateways registered by an operator.
+func (d *Database) CountGatewaysByOperator(ctx context.Context, operatorID string) (int, error) {
+	var count int
+	err := d.pool.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM gateways
+		 WHERE operator_id = $1 AND approval_status <> 'rejected'`,
+		operatorID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count operator gateways: %w", classify(err))
+	}
+	return count, nil
+}
+
+// CountGatewaysInSubnet counts the non-rejected, non-honeypot gateways whose
+// address falls inside the given CIDR (e.g. "203.0.113.0/24").
+func (d *Database) CountGatewaysInSubnet(ctx context.Context, cidr string) (int, error) {
+	var count int
+	err := d.pool.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM gateways
+		 WHERE ip_address <<= $1::cidr AND approval_status <> 'rejected' AND is_honeypot = FALSE`,
+		cidr,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count subnet gateways: %w", classify(err))
+	}
+	return count, nil
+}
+
+// SetGatewayApprovalStatus records an admin approval decision for a gateway.
+func (d *Database) SetGatewayApprovalStatus(ctx context.Context, gatewayID string, status string) error {
+	result, err := d.conn(ctx).ExecContext(
+		ctx,
+		`UPDATE gateways
+		 SET approval_status = $1, approved_at = CASE WHEN $1 = 'approved' THEN NOW() ELSE approved_at END
+		 WHERE id = $2`,
+		status,
+		gatewayID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update gateway approval: %w", classify(err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read update result: %w", classify(err))
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("gateway %s: %w", gatewayID, ErrGatewayNotFound)
+	}
+	return nil
+}
+
+// ExcludeSuspiciousGateway moves an approved gateway to pending on behalf of
+// the suspicion scorer and records when. A gateway that is no longer approved
+// is left as it is and excluded is false.
+func (d *Database) ExcludeSuspiciousGateway(ctx context.Context, gatewayID string) (excluded bool, err error) {
+	result, err := d.pool.ExecContext(
+		ctx,
+		`UPDATE gateways SET approval_status = 'pending', suspicion_excluded_at = NOW()
+		 WHERE id = $1 AND approval_status = 'approved'`,
+		gatewayID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to exclude gateway: %w", classify(err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read update result: %w", classify(err))
+	}
+	return rowsAffected > 0, nil
+}
+
+// GetRegisteredGateways returns every non-rejected, non-honeypot gateway for audits.
+func (d *Database) GetRegisteredGateways(ctx context.Context) ([]*Gateway, error) {
+	query := `
+		SELECT ` + gatewayColumns + `
+		FROM gateways
+		WHERE approval_status <> 'rejected' AND is_honeypot = FALSE
+		ORDER BY ip_address
+	`
+
+	rows, err := d.pool.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query registered gateways: %w", classify(err))
+	}
+	defer rows.Close()
+
+	return scanGateways(rows)
+}
+
+// nullableString converts an empty string to SQL NULL.
+func nullableString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
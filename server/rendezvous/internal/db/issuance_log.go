@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// IssuanceRecord is one config pack issued to a device
+type IssuanceRecord struct {
+	DeviceID   string    `json:"device_id"`
+	IssuedAt   time.Time `json:"issued_at"`
+	PackHash   string    `json:"pack_hash"`
+	Region     string    `json:"region,omitempty"`
+	GatewayIDs []string  `json:"gateway_ids"`
+}
+
+// RecordIssuances appends records to the issuance log in one transaction.
+// Under data minimization nothing is stored.
+func (d *Database) RecordIssuances(ctx context.Context, records []IssuanceRecord) error {
+	if !d.persistence.PersistDeviceRecords() || len(records) == 0 {
+		return nil
+	}
+	tx, err := d.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, record := range records {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO issuance_log (device_id, issued_at, pack_hash, region, gateway_ids)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		`, record.DeviceID, record.IssuedAt, record.PackHash, record.Region, pq.Array(record.GatewayIDs))
+		if err != nil {
+			return fmt.Errorf("failed to record issuance: %w", classify(err))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit issuances: %w", classify(err))
+	}
+	return nil
+}
+
+// GetDeviceIssuances returns the last limit packs issued to a device, newest
+// first
+func (d *Database) GetDeviceIssuances(ctx context.Context, deviceID string, limit int) ([]IssuanceRecord, error) {
+	rows, err := d.pool.QueryContext(ctx, `
+		SELECT device_id, issued_at, pack_hash, COALESCE(region, ''), gateway_ids
+		FROM issuance_log
+		WHERE device_id = $1
+		ORDER BY issued_at DESC
+		LIMIT $2
+	`, deviceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device issuances: %w", classify(err))
+	}
+	defer rows.Close()
+
+	records := []IssuanceRecord{}
+	for rows.Next() {
+		var record IssuanceRecord
+		if err := rows.Scan(&record.DeviceID, &record.IssuedAt, &record.PackHash, &record.Region, pq.Array(&record.GatewayIDs)); err != nil {
+			return nil, fmt.Errorf("failed to scan issuance: %w", classify(err))
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read issuances: %w", classify(err))
+	}
+	return records, nil
+}
+
+// DeleteIssuancesBefore deletes issuance log records issued before the given
+// time
+func (d *Database) DeleteIssuancesBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := d.pool.ExecContext(ctx, `DELETE FROM issuance_log WHERE issued_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune issuance log: %w", classify(err))
+	}
+	return result.RowsAffected()
+}
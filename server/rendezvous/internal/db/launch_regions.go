@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"rendezvous/internal/cache"
+)
+
+// GetOpenRegions returns the regions open during a soft launch, sorted. An
+// empty list means every region is open. Results come from the policy cache
+// when one is set and must not be modified.
+func (d *Database) GetOpenRegions(ctx context.Context) ([]string, error) {
+	if d.policy != nil {
+		return cache.Load(ctx, d.policy, cache.TableLaunchRegions, d.queryOpenRegions)
+	}
+	return d.queryOpenRegions(ctx)
+}
+
+func (d *Database) queryOpenRegions(ctx context.Context) ([]string, error) {
+	rows, err := d.pool.QueryContext(ctx, `SELECT region FROM launch_open_regions ORDER BY region`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query open regions: %w", classify(err))
+	}
+	defer rows.Close()
+
+	regions := []string{}
+	for rows.Next() {
+		var region string
+		if err := rows.Scan(&region); err != nil {
+			return nil, fmt.Errorf("failed to scan open region: %w", classify(err))
+		}
+		regions = append(regions, region)
+	}
+	return regions, rows.Err()
+}
+
+// SetOpenRegions replaces the set of open regions. An empty list opens every
+// region.
+func (d *Database) SetOpenRegions(ctx context.Context, regions []string) error {
+	tx, err := d.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM launch_open_regions`); err != nil {
+		return fmt.Errorf("failed to clear open regions: %w", classify(err))
+	}
+	for _, region := range regions {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO launch_open_regions (region) VALUES ($1)`, region); err != nil {
+			return fmt.Errorf("failed to insert open region: %w", classify(err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit open regions: %w", classify(err))
+	}
+	return nil
+}
@@ -164,3 +164,57 @@ func GetMigrationVersion(databaseURL string) (uint, bool, error) {
 
 	return version, dirty, nil
 }
+
+// MigrationStatus describes the schema version relative to the embedded
+// migrations.
+type MigrationStatus struct {
+	Current uint `json:"current"`
+	Latest  uint `json:"latest"`
+	Dirty   bool `json:"dirty"`
+}
+
+// Pending returns the number of embedded migrations not yet applied.
+func (s MigrationStatus) Pending() int {
+	if s.Latest <= s.Current {
+		return 0
+	}
+	pending := 0
+	for _, version := range embeddedMigrationVersions() {
+		if version > s.Current {
+			pending++
+		}
+	}
+	return pending
+}
+
+// GetMigrationStatus compares the applied migration version with the embedded
+// migrations without applying anything.
+func GetMigrationStatus(databaseURL string) (MigrationStatus, error) {
+	current, dirty, err := GetMigrationVersion(databaseURL)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	versions := embeddedMigrationVersions()
+	status := MigrationStatus{Current: current, Dirty: dirty}
+	if len(versions) > 0 {
+		status.Latest = versions[len(versions)-1]
+	}
+	return status, nil
+}
+
+// embeddedMigrationVersions lists the embedded migration versions in order.
+func embeddedMigrationVersions() []uint {
+	sourceDriver, err := iofs.New(migrationsFS, "migrations")
+	if err != nil {
+		return nil
+	}
+	defer sourceDriver.Close()
+
+	var versions []uint
+	version, err := sourceDriver.First()
+	for err == nil {
+		versions = append(versions, version)
+		version, err = sourceDriver.Next(version)
+	}
+	return versions
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS review_queue;
+DROP INDEX IF EXISTS idx_gateways_approval_status;
+DROP INDEX IF EXISTS idx_gateways_operator;
+ALTER TABLE gateways DROP COLUMN IF EXISTS asn;
+ALTER TABLE gateways DROP COLUMN IF EXISTS approval_status;
+ALTER TABLE gateways DROP COLUMN IF EXISTS operator_id;
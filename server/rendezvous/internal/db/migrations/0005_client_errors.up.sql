@@ -0,0 +1,16 @@
+-- LumenLink Client Error Reports
+-- Migration: 0005_client_errors.up.sql
+-- Description: Stores structured, enumerated error reports sent by clients
+
+CREATE TABLE client_errors (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code VARCHAR(50) NOT NULL,
+    client_version VARCHAR(32) NOT NULL,
+    platform VARCHAR(20) NOT NULL CHECK (platform IN ('android', 'ios', 'desktop')),
+    context JSONB NOT NULL DEFAULT '{}',
+    region VARCHAR(10),
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX idx_client_errors_created ON client_errors(created_at DESC);
+CREATE INDEX idx_client_errors_code_version ON client_errors(code, client_version);
@@ -0,0 +1,16 @@
+-- LumenLink Rollouts
+-- Migration: 0006_rollouts.up.sql
+-- Description: DB-backed rollout percentages for config versions and named features
+
+CREATE TABLE rollouts (
+    key VARCHAR(100) NOT NULL,          -- config version (e.g. '1.1') or feature key (e.g. 'scan_interval_120')
+    region VARCHAR(20) NOT NULL DEFAULT '', -- empty string applies to every region
+    percentage INTEGER NOT NULL CHECK (percentage >= 0 AND percentage <= 100),
+    description TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    PRIMARY KEY (key, region)
+);
+
+CREATE TRIGGER update_rollouts_updated_at BEFORE UPDATE ON rollouts
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
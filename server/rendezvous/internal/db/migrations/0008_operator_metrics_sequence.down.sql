@@ -0,0 +1,7 @@
+-- Migration: 0008_operator_metrics_sequence.down.sql
+
+DROP TABLE IF EXISTS operator_metrics_sequences;
+
+COMMENT ON COLUMN operator_metrics.time IS NULL;
+ALTER TABLE operator_metrics DROP COLUMN IF EXISTS sequence;
+ALTER TABLE operator_metrics DROP COLUMN IF EXISTS reported_at;
@@ -0,0 +1,24 @@
+-- LumenLink Gateway Heartbeat Timestamps
+-- Migration: 0008_operator_metrics_sequence.up.sql
+-- Description: Records the gateway's own timestamp and heartbeat sequence with
+-- each status report, and rejects duplicate sequences per gateway
+
+-- time stays the server receive time; reported_at is the gateway's clock
+ALTER TABLE operator_metrics ADD COLUMN reported_at TIMESTAMPTZ;
+ALTER TABLE operator_metrics ADD COLUMN sequence BIGINT;
+
+COMMENT ON COLUMN operator_metrics.time IS 'Server receive time';
+COMMENT ON COLUMN operator_metrics.reported_at IS 'Gateway-reported time, within the allowed clock skew of time';
+
+-- Unique indexes on a hypertable must include its time column, so uniqueness
+-- of (gateway_id, sequence) is enforced in this companion table. Rows older
+-- than a day are pruned on insert; older replays fail the skew check anyway.
+CREATE TABLE operator_metrics_sequences (
+    gateway_id UUID NOT NULL REFERENCES gateways(id) ON DELETE CASCADE,
+    sequence BIGINT NOT NULL CHECK (sequence >= 0),
+    received_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    PRIMARY KEY (gateway_id, sequence)
+);
+
+CREATE INDEX idx_operator_metrics_sequences_received
+ON operator_metrics_sequences (gateway_id, received_at);
@@ -0,0 +1,5 @@
+-- Migration: 0009_gateway_country_rollups.down.sql
+
+DROP TABLE IF EXISTS gateway_country_rollups;
+
+ALTER TABLE discovery_logs DROP COLUMN IF EXISTS country;
@@ -0,0 +1,32 @@
+-- LumenLink Admin Audit Log
+-- Migration: 0010_admin_audit_log.up.sql
+-- Description: Append-only, hash-chained record of admin mutations
+
+-- hash is SHA-256 over the other columns and prev_hash (see internal/audit),
+-- so editing or deleting any row breaks the chain from that row onwards.
+-- details is JSON rather than JSONB so the stored text is not reordered.
+CREATE TABLE admin_audit_log (
+    seq BIGINT PRIMARY KEY CHECK (seq > 0),
+    actor VARCHAR(100) NOT NULL,
+    action VARCHAR(100) NOT NULL,
+    subject_type VARCHAR(50) NOT NULL,
+    subject_id VARCHAR(255) NOT NULL,
+    details JSON NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL UNIQUE
+);
+
+-- The chain is append-only; the hashes make changes detectable, this makes
+-- them fail outright for anyone short of the table owner disabling it
+CREATE FUNCTION admin_audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'admin_audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER admin_audit_log_append_only
+BEFORE UPDATE OR DELETE ON admin_audit_log
+FOR EACH ROW EXECUTE FUNCTION admin_audit_log_append_only();
+
+COMMENT ON COLUMN admin_audit_log.prev_hash IS 'hash of the previous entry; 64 zeros for seq 1';
@@ -0,0 +1,3 @@
+-- Migration: 0011_gateway_suspicion.down.sql
+
+DROP TABLE IF EXISTS gateway_suspicion_scores;
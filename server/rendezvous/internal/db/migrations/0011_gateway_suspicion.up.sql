@@ -0,0 +1,20 @@
+-- LumenLink Gateway Suspicion Scores
+-- Migration: 0011_gateway_suspicion.up.sql
+-- Description: Nightly honeypot suspicion score per gateway, comparing the
+-- gateway's own heartbeats with connections confirmed by clients
+
+CREATE TABLE gateway_suspicion_scores (
+    gateway_id UUID PRIMARY KEY REFERENCES gateways(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL CHECK (score >= 0 AND score <= 1),
+    components JSONB NOT NULL DEFAULT '{}',
+    signals JSONB NOT NULL DEFAULT '{}',
+    flagged BOOLEAN NOT NULL DEFAULT FALSE,
+    computed_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX idx_gateway_suspicion_scores_flagged
+ON gateway_suspicion_scores (score DESC)
+WHERE flagged = TRUE;
+
+COMMENT ON COLUMN gateway_suspicion_scores.components IS 'Weighted score components, each 0-1';
+COMMENT ON COLUMN gateway_suspicion_scores.signals IS 'Heartbeat and client report counts the score was computed from';
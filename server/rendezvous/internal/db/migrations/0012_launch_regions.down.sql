@@ -0,0 +1,3 @@
+-- Migration: 0012_launch_regions.down.sql
+
+DROP TABLE IF EXISTS launch_open_regions;
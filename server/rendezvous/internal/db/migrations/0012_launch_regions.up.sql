@@ -0,0 +1,9 @@
+-- LumenLink Launch Regions
+-- Migration: 0012_launch_regions.up.sql
+-- Description: Regions open to real gateways during a soft launch. While the
+-- table is empty every region is open.
+
+CREATE TABLE launch_open_regions (
+    region VARCHAR(20) PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
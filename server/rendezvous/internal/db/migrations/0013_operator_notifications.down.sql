@@ -0,0 +1,4 @@
+-- Migration: 0013_operator_notifications.down.sql
+
+DROP TABLE IF EXISTS operator_notification_deliveries;
+DROP TABLE IF EXISTS operator_notification_preferences;
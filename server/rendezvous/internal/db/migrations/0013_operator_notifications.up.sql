@@ -0,0 +1,27 @@
+-- LumenLink Operator Notifications
+-- Migration: 0013_operator_notifications.up.sql
+-- Description: Per-operator notification preferences (webhook and/or email,
+-- enabled event types) and a log of every delivery attempt.
+
+CREATE TABLE operator_notification_preferences (
+    operator_id VARCHAR(255) PRIMARY KEY,
+    webhook_url TEXT,
+    email VARCHAR(320),
+    events TEXT[] DEFAULT '{}' NOT NULL, -- Enabled event types
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+CREATE TABLE operator_notification_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    operator_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    gateway_id UUID,
+    channel VARCHAR(20) NOT NULL, -- webhook, email, or none when rate limited
+    attempt INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL, -- delivered, failed or rate_limited
+    error TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX idx_operator_notification_deliveries_operator
+    ON operator_notification_deliveries(operator_id, created_at DESC);
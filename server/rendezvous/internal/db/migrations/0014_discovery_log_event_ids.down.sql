@@ -0,0 +1,3 @@
+-- Migration: 0014_discovery_log_event_ids.down.sql
+
+DROP TABLE IF EXISTS discovery_log_events;
@@ -0,0 +1,10 @@
+-- Migration: 0015_rollout_schedules.down.sql
+
+ALTER TABLE rollouts
+    DROP CONSTRAINT IF EXISTS rollouts_schedule_complete,
+    DROP COLUMN IF EXISTS aborted_at,
+    DROP COLUMN IF EXISTS schedule_easing,
+    DROP COLUMN IF EXISTS schedule_end_percentage,
+    DROP COLUMN IF EXISTS schedule_start_percentage,
+    DROP COLUMN IF EXISTS schedule_end_at,
+    DROP COLUMN IF EXISTS schedule_start_at;
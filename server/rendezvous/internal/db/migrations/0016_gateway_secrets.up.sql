@@ -0,0 +1,15 @@
+-- LumenLink Gateway Secrets
+-- Migration: 0016_gateway_secrets.up.sql
+-- Description: Per-gateway transport secrets (e.g. obfuscation seeds),
+-- encrypted with the data key and delivered only in trusted-tier packs
+
+-- A rotation adds a generation and gives the previous one an expiry, so
+-- clients holding an older pack keep working through the overlap.
+CREATE TABLE gateway_secrets (
+    gateway_id UUID NOT NULL REFERENCES gateways(id) ON DELETE CASCADE,
+    generation INTEGER NOT NULL CHECK (generation > 0),
+    ciphertext BYTEA NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    expires_at TIMESTAMPTZ, -- Null for the current generation
+    PRIMARY KEY (gateway_id, generation)
+);
@@ -0,0 +1,3 @@
+-- Migration: 0018_gateway_maintenance_windows.down.sql
+
+DROP TABLE IF EXISTS gateway_maintenance_windows;
@@ -0,0 +1,17 @@
+-- LumenLink Gateway Maintenance Windows
+-- Migration: 0018_gateway_maintenance_windows.up.sql
+-- Description: Approved maintenance windows, excluded from a gateway's
+-- expected time when its uptime is computed
+
+CREATE TABLE gateway_maintenance_windows (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    gateway_id UUID NOT NULL REFERENCES gateways(id) ON DELETE CASCADE,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    reason TEXT,
+    approved_by VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    CONSTRAINT gateway_maintenance_windows_order CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX idx_gateway_maintenance_windows_gateway ON gateway_maintenance_windows(gateway_id, ends_at);
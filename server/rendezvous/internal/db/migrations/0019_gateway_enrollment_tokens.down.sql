@@ -0,0 +1,3 @@
+-- Migration: 0019_gateway_enrollment_tokens.down.sql
+
+DROP TABLE IF EXISTS gateway_enrollment_tokens;
@@ -0,0 +1,16 @@
+-- LumenLink Gateway Enrollment Tokens
+-- Migration: 0019_gateway_enrollment_tokens.up.sql
+-- Description: Single-use tokens an admin issues to an operator so a new
+-- gateway agent can bootstrap itself in one request
+
+CREATE TABLE gateway_enrollment_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    token_hash CHAR(64) NOT NULL UNIQUE, -- Hex SHA-256; the token itself is only shown once
+    operator_id VARCHAR(255) NOT NULL,
+    region VARCHAR(10) NOT NULL,
+    created_by VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    gateway_id UUID REFERENCES gateways(id) ON DELETE SET NULL
+);
@@ -0,0 +1,18 @@
+-- LumenLink Device Trust
+-- Migration: 0020_device_trust.up.sql
+-- Description: Progressive trust state per device. Devices start in the
+-- limited tier and are promoted to trusted after a probation period of
+-- sustained valid attestations and successful connections.
+
+CREATE TABLE device_trust (
+    device_id VARCHAR(255) PRIMARY KEY,
+    tier VARCHAR(20) NOT NULL DEFAULT 'limited' CHECK (tier IN ('limited', 'trusted')),
+    first_seen_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    probation_started_at TIMESTAMPTZ DEFAULT NOW() NOT NULL, -- Reset on demotion
+    valid_attestations INTEGER DEFAULT 0 NOT NULL,           -- Since probation started
+    successful_connections INTEGER DEFAULT 0 NOT NULL,       -- Since probation started
+    tier_changed_at TIMESTAMPTZ,
+    last_anomaly VARCHAR(50),
+    last_anomaly_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
@@ -0,0 +1,36 @@
+-- LumenLink Ephemeral Stores
+-- Migration: 0023_ephemeral_stores.up.sql
+-- Description: Short-lived state (attestation challenges, rate limits, sticky
+-- assignments and reservations) for deployments that run the Postgres store
+-- backend instead of Redis. Rows past their expiry are ignored and pruned.
+
+CREATE TABLE ephemeral_challenges (
+    challenge TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_ephemeral_challenges_expires_at ON ephemeral_challenges (expires_at);
+
+-- GCRA state: the theoretical arrival time of the next request per key
+CREATE TABLE ephemeral_rate_limits (
+    key TEXT PRIMARY KEY,
+    tat TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_ephemeral_rate_limits_tat ON ephemeral_rate_limits (tat);
+
+CREATE TABLE ephemeral_assignments (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_ephemeral_assignments_expires_at ON ephemeral_assignments (expires_at);
+
+CREATE TABLE ephemeral_reservations (
+    key TEXT PRIMARY KEY,
+    count BIGINT NOT NULL CHECK (count > 0),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_ephemeral_reservations_expires_at ON ephemeral_reservations (expires_at);
@@ -0,0 +1,3 @@
+-- Migration: 0024_app_attest_keys.down.sql
+
+DROP TABLE IF EXISTS app_attest_keys;
@@ -0,0 +1,3 @@
+-- Migration: 0025_revoked_devices.down.sql
+
+DROP TABLE IF EXISTS revoked_devices;
@@ -0,0 +1,10 @@
+-- LumenLink Revoked Devices
+-- Migration: 0025_revoked_devices.up.sql
+-- Description: Devices banned as compromised or abusive. A revoked device
+-- fails attestation and is only ever given honeypots.
+
+CREATE TABLE revoked_devices (
+    device_id VARCHAR(255) PRIMARY KEY,
+    reason TEXT NOT NULL,
+    revoked_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
@@ -0,0 +1,5 @@
+-- LumenLink Attestation Retention
+-- Migration: 0027_attestations_created_at.up.sql
+-- Description: Indexes attestations by creation time for the retention cleanup
+
+CREATE INDEX IF NOT EXISTS idx_attestations_created_at ON attestations(created_at);
@@ -0,0 +1,6 @@
+-- LumenLink Attestation Statistics
+-- Migration: 0028_attestation_failure_reason.up.sql
+-- Description: Records why a failed attestation was rejected, so attestation
+-- statistics can be broken down by reason.
+
+ALTER TABLE attestations ADD COLUMN IF NOT EXISTS failure_reason VARCHAR(64);
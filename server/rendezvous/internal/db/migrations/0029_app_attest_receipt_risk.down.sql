@@ -0,0 +1,5 @@
+-- Migration: 0029_app_attest_receipt_risk.down.sql
+
+DROP INDEX IF EXISTS idx_app_attest_keys_receipt_refreshed;
+ALTER TABLE app_attest_keys DROP COLUMN IF EXISTS receipt_refreshed_at;
+ALTER TABLE app_attest_keys DROP COLUMN IF EXISTS risk_metric;
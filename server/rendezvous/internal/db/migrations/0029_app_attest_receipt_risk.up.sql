@@ -0,0 +1,11 @@
+-- LumenLink App Attest Receipts
+-- Migration: 0029_app_attest_receipt_risk.up.sql
+-- Description: Apple's fraud risk metric for each App Attest key, read from
+-- the receipt Apple returns when a stored receipt is refreshed, and when the
+-- receipt was last refreshed.
+
+ALTER TABLE app_attest_keys ADD COLUMN IF NOT EXISTS risk_metric INTEGER;
+ALTER TABLE app_attest_keys ADD COLUMN IF NOT EXISTS receipt_refreshed_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_app_attest_keys_receipt_refreshed ON app_attest_keys (receipt_refreshed_at NULLS FIRST)
+    WHERE receipt IS NOT NULL;
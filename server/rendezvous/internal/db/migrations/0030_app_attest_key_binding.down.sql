@@ -0,0 +1,5 @@
+-- Migration: 0030_app_attest_key_binding.down.sql
+
+DROP TABLE IF EXISTS flagged_devices;
+DROP INDEX IF EXISTS idx_attestations_key_id;
+ALTER TABLE attestations DROP COLUMN IF EXISTS key_id;
@@ -0,0 +1,18 @@
+-- LumenLink App Attest Key Binding
+-- Migration: 0030_app_attest_key_binding.up.sql
+-- Description: The App Attest key each iOS attestation or assertion used,
+-- and devices flagged for presenting a key bound to another device, a sign
+-- of shared credentials. A key ID stays bound to one device by the primary
+-- key of app_attest_keys.
+
+ALTER TABLE attestations ADD COLUMN IF NOT EXISTS key_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_attestations_key_id ON attestations (key_id) WHERE key_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS flagged_devices (
+    device_id VARCHAR(255) NOT NULL,
+    reason VARCHAR(50) NOT NULL,
+    key_id TEXT, -- The shared App Attest key
+    flagged_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    PRIMARY KEY (device_id, reason)
+);
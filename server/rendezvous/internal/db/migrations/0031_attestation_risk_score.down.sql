@@ -0,0 +1,3 @@
+-- Migration: 0031_attestation_risk_score.down.sql
+
+ALTER TABLE attestations DROP COLUMN IF EXISTS risk_score;
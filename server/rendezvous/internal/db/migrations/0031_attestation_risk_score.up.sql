@@ -0,0 +1,8 @@
+-- LumenLink Attestation Risk Score
+-- Migration: 0031_attestation_risk_score.up.sql
+-- Description: The risk score each attestation was given, from 0 (no sign of
+-- risk) to 1, combining its verdict, token age, licensing verdict, the
+-- device's recent failures and whether its region is under heavy probing.
+-- Attestations stored before scoring have none.
+
+ALTER TABLE attestations ADD COLUMN IF NOT EXISTS risk_score REAL;
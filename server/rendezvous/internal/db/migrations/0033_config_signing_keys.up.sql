@@ -0,0 +1,21 @@
+-- LumenLink Config Signing Keys
+-- Migration: 0033_config_signing_keys.up.sql
+-- Description: Config signing keys created by rotation, the private key
+-- encrypted with the data key. Every replica signs with the current key and
+-- verifies with any unexpired one.
+
+-- A rotation adds the new current key and gives the previous one an expiry,
+-- so packs it signed keep verifying through the grace period. A key first
+-- configured in the environment is recorded by its public key alone when it
+-- is rotated out.
+CREATE TABLE config_signing_keys (
+    key_id VARCHAR(16) PRIMARY KEY,
+    public_key BYTEA NOT NULL,
+    sealed_private_key BYTEA,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    expires_at TIMESTAMPTZ -- Null for the current key
+);
+
+-- At most one current key
+CREATE UNIQUE INDEX idx_config_signing_keys_current
+    ON config_signing_keys ((expires_at IS NULL)) WHERE expires_at IS NULL;
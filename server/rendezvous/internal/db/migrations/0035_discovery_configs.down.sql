@@ -0,0 +1,3 @@
+-- Migration: 0035_discovery_configs.down.sql
+
+DROP TABLE IF EXISTS discovery_configs;
@@ -0,0 +1,11 @@
+-- LumenLink Signing Key Endorsements
+-- Migration: 0036_signing_key_endorsements.up.sql
+-- Description: A rotated-in signing key is endorsed by the key it replaces,
+-- so clients pinning the old key can follow the chain to the new one.
+
+-- The endorsement is the previous key's Ed25519 signature over
+-- config.KeyEndorsementMessage. Keys stored before this migration, and keys
+-- recorded when rotated out of the environment, have none.
+ALTER TABLE config_signing_keys
+    ADD COLUMN previous_key_id VARCHAR(16),
+    ADD COLUMN endorsement BYTEA;
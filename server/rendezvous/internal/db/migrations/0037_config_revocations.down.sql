@@ -0,0 +1,6 @@
+-- Migration: 0037_config_revocations.down.sql
+
+DROP INDEX IF EXISTS idx_config_packs_content_hash;
+ALTER TABLE config_packs DROP COLUMN IF EXISTS revoked_at;
+ALTER TABLE config_packs DROP COLUMN IF EXISTS content_hash;
+DROP TABLE IF EXISTS config_revocations;
@@ -0,0 +1,3 @@
+-- Migration: 0039_experiments.down.sql
+
+DROP TABLE IF EXISTS experiments;
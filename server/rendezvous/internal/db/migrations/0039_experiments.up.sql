@@ -0,0 +1,21 @@
+-- LumenLink Config Experiments
+-- Migration: 0039_experiments.up.sql
+-- Description: A/B experiments on pack parameters. Each device targeted by
+-- an experiment is assigned one of its variants by weight, stably, and its
+-- packs list the variants it was assigned so client telemetry can be
+-- segmented by them.
+
+-- variants is a JSON array of {name, weight, transport_order, scan_interval};
+-- empty regions or platforms target all of them.
+CREATE TABLE experiments (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT,
+    variants JSONB NOT NULL,
+    regions TEXT[] NOT NULL DEFAULT '{}',
+    platforms TEXT[] NOT NULL DEFAULT '{}',
+    starts_at TIMESTAMPTZ,
+    ends_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    CHECK (starts_at IS NULL OR ends_at IS NULL OR starts_at < ends_at)
+);
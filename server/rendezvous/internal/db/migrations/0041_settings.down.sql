@@ -0,0 +1,3 @@
+-- Migration: 0041_settings.down.sql
+
+DROP TABLE IF EXISTS settings;
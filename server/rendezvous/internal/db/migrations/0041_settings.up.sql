@@ -0,0 +1,11 @@
+-- LumenLink Settings
+-- Migration: 0041_settings.up.sql
+-- Description: Server-wide settings edited through the admin API, one JSON
+-- value per key. kill_switches maps a transport type to the reason it is
+-- disabled; every pack carries the map and lists none of those transports.
+
+CREATE TABLE settings (
+    key VARCHAR(100) PRIMARY KEY,
+    value JSONB NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Migration: 0042_country_region_overrides.down.sql
+
+DROP TABLE IF EXISTS country_region_overrides;
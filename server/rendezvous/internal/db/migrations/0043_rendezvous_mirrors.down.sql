@@ -0,0 +1,3 @@
+-- Migration: 0043_rendezvous_mirrors.down.sql
+
+DROP TABLE IF EXISTS rendezvous_mirrors;
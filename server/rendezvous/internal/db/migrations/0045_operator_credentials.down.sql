@@ -0,0 +1,3 @@
+-- Migration: 0045_operator_credentials.down.sql
+
+DROP TABLE IF EXISTS operator_credentials;
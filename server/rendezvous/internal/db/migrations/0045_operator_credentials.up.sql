@@ -0,0 +1,15 @@
+-- LumenLink Operator Credentials
+-- Migration: 0045_operator_credentials.up.sql
+-- Description: Tokens an admin issues to a gateway operator, so operators
+-- authenticate as themselves rather than by asserting an operator_id
+
+CREATE TABLE operator_credentials (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    token_hash CHAR(64) NOT NULL UNIQUE, -- Hex SHA-256; the token itself is only shown once
+    operator_id VARCHAR(255) NOT NULL,
+    created_by VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_operator_credentials_operator ON operator_credentials (operator_id);
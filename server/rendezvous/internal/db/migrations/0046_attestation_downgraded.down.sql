@@ -0,0 +1,3 @@
+-- Migration: 0046_attestation_downgraded.down.sql
+
+ALTER TABLE attestations DROP COLUMN IF EXISTS downgraded;
@@ -0,0 +1,8 @@
+-- LumenLink Attestation Downgrades
+-- Migration: 0046_attestation_downgraded.up.sql
+-- Description: Whether an attestation reported weaker integrity than the
+-- device's previous one. Later attestations are compared with the last
+-- verdict that was not itself a downgrade, so a device cannot launder a
+-- downgrade by attesting weakly twice.
+
+ALTER TABLE attestations ADD COLUMN IF NOT EXISTS downgraded BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- Migration: 0047_discovery_client_bucket.down.sql
+
+ALTER TABLE discovery_logs DROP COLUMN IF EXISTS client_bucket;
@@ -0,0 +1,7 @@
+-- LumenLink Discovery Client Buckets
+-- Migration: 0047_discovery_client_bucket.up.sql
+-- Description: Under data minimization discovery logs keep a keyed hash of
+-- the client's network instead of its address, so distinct client counts
+-- still work without storing who the client was.
+
+ALTER TABLE discovery_logs ADD COLUMN IF NOT EXISTS client_bucket TEXT;
@@ -0,0 +1,7 @@
+-- Migration: 0048_config_packs_revocation_columns.down.sql
+
+ALTER TABLE config_packs
+    ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_config_packs_content_hash ON config_packs(content_hash) WHERE content_hash IS NOT NULL;
@@ -0,0 +1,10 @@
+-- LumenLink Config Pack Revocation Columns
+-- Migration: 0048_config_packs_revocation_columns.up.sql
+-- Description: Packs are not persisted, so nothing ever filled the
+-- content_hash and revoked_at columns 0037 added to config_packs. Revoked
+-- pack hashes are refused when a pack is generated instead.
+
+DROP INDEX IF EXISTS idx_config_packs_content_hash;
+ALTER TABLE config_packs
+    DROP COLUMN IF EXISTS revoked_at,
+    DROP COLUMN IF EXISTS content_hash;
@@ -0,0 +1,3 @@
+-- Migration: 0049_issuance_log.down.sql
+
+DROP TABLE IF EXISTS issuance_log;
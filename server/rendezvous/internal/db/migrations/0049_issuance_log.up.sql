@@ -0,0 +1,16 @@
+-- LumenLink Issuance Log
+-- Migration: 0049_issuance_log.up.sql
+-- Description: The config packs issued to each device, with the gateways
+-- they listed, for the admin device lookup. Pruned after a retention period.
+
+CREATE TABLE IF NOT EXISTS issuance_log (
+    id BIGSERIAL PRIMARY KEY,
+    device_id TEXT NOT NULL,
+    issued_at TIMESTAMPTZ NOT NULL,
+    pack_hash TEXT NOT NULL,
+    region TEXT,
+    gateway_ids TEXT[] NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS idx_issuance_log_device ON issuance_log (device_id, issued_at DESC);
+CREATE INDEX IF NOT EXISTS idx_issuance_log_issued_at ON issuance_log (issued_at);
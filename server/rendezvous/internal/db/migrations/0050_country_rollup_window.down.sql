@@ -0,0 +1,6 @@
+-- Migration: 0050_country_rollup_window.down.sql
+
+DELETE FROM gateway_country_rollups;
+
+COMMENT ON COLUMN gateway_country_rollups.day IS NULL;
+COMMENT ON COLUMN gateway_country_rollups.clients IS 'Distinct client IPs with a successful discovery that day';
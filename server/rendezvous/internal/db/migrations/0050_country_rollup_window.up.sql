@@ -0,0 +1,11 @@
+-- LumenLink Gateway Country Distribution Window
+-- Migration: 0050_country_rollup_window.up.sql
+-- Description: The country rollup now counts distinct clients over the whole
+-- distribution window rather than per day, so summing days no longer counts a
+-- returning client once per day. The per-day rows are cleared; the rollup job
+-- rebuilds the window on its next run.
+
+DELETE FROM gateway_country_rollups;
+
+COMMENT ON COLUMN gateway_country_rollups.day IS 'Last UTC day of the window the row covers';
+COMMENT ON COLUMN gateway_country_rollups.clients IS 'Distinct clients with a successful discovery over the window';
@@ -0,0 +1,5 @@
+-- Migration: 0051_gateway_suspicion_exclusion.down.sql
+
+ALTER TABLE gateways
+DROP COLUMN IF EXISTS suspicion_excluded_at,
+DROP COLUMN IF EXISTS approved_at;
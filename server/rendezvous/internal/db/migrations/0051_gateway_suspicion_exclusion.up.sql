@@ -0,0 +1,12 @@
+-- LumenLink Gateway Suspicion Exclusion
+-- Migration: 0051_gateway_suspicion_exclusion.up.sql
+-- Description: When the suspicion scorer last moved a gateway to pending and
+-- when an admin last approved it, so a gateway an admin approved after its
+-- exclusion is not excluded again on the next pass.
+
+ALTER TABLE gateways
+ADD COLUMN approved_at TIMESTAMPTZ,
+ADD COLUMN suspicion_excluded_at TIMESTAMPTZ;
+
+COMMENT ON COLUMN gateways.approved_at IS 'When an admin last approved the gateway';
+COMMENT ON COLUMN gateways.suspicion_excluded_at IS 'When the suspicion scorer last moved the gateway to pending';
@@ -28,3 +28,24 @@ func TestRunMigrations_SkipWithoutDB(t *testing.T) {
 		t.Errorf("expected version >= 1, got %d", version)
 	}
 }
+
+func TestEmbeddedMigrationVersions(t *testing.T) {
+	versions := embeddedMigrationVersions()
+	if len(versions) == 0 {
+		t.Fatal("expected embedded migrations")
+	}
+	for i := 1; i < len(versions); i++ {
+		if versions[i] <= versions[i-1] {
+			t.Fatalf("versions out of order: %v", versions)
+		}
+	}
+
+	status := MigrationStatus{Current: versions[0], Latest: versions[len(versions)-1]}
+	if got := status.Pending(); got != len(versions)-1 {
+		t.Errorf("Pending() = %d, want %d", got, len(versions)-1)
+	}
+	status.Current = status.Latest
+	if got := status.Pending(); got != 0 {
+		t.Errorf("Pending() at latest = %d, want 0", got)
+	}
+}
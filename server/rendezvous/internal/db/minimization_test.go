@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/privacy"
+)
+
+const (
+	minimizedDeviceID = "device-7f3a"
+	minimizedClientIP = "198.51.100.23"
+)
+
+// withoutIdentifiers matches any argument that does not carry the test
+// device ID or client address, in any form
+type withoutIdentifiers struct{}
+
+func (withoutIdentifiers) Match(v driver.Value) bool {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return true
+	}
+	return !strings.Contains(s, minimizedDeviceID) && !strings.Contains(s, minimizedClientIP)
+}
+
+// clientBucket matches a stored client bucket: present, and carrying
+// neither the test client address nor its network
+type clientBucket struct{}
+
+func (clientBucket) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	return ok && s != "" && !strings.Contains(s, minimizedClientIP) && !strings.Contains(s, "198.51.100.")
+}
+
+func minimizedDatabase(t *testing.T) (*Database, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	database := NewFromPool(sqlDB)
+	database.SetPersistencePolicy(privacy.NewPolicy(true))
+	return database, mock
+}
+
+func TestMinimized_AttestationNotStored(t *testing.T) {
+	database, mock := minimizedDatabase(t)
+	err := database.RecordAttestation(context.Background(), &AttestationRecord{
+		DeviceID:   minimizedDeviceID,
+		Platform:   "android",
+		Token:      "integrity-token",
+		Verified:   true,
+		VerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("RecordAttestation: %v", err)
+	}
+	// No statement reaches the database at all
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStandard_AttestationStored(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	mock.ExpectExec(`INSERT INTO attestations`).
+		WithArgs(minimizedDeviceID, "android", "integrity-token", true, sqlmock.AnyArg(), "MEETS_DEVICE_INTEGRITY", sqlmock.AnyArg(), "", "", 0.0, "", "", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = NewFromPool(sqlDB).RecordAttestation(context.Background(), &AttestationRecord{
+		DeviceID:        minimizedDeviceID,
+		Platform:        "android",
+		Token:           "integrity-token",
+		Verified:        true,
+		VerifiedAt:      sql.NullTime{Time: time.Now(), Valid: true},
+		DeviceIntegrity: "MEETS_DEVICE_INTEGRITY",
+	})
+	if err != nil {
+		t.Fatalf("RecordAttestation: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMinimized_DiscoveryLogDropsClientAddress(t *testing.T) {
+	database, mock := minimizedDatabase(t)
+	gatewayID := "3f0c2a8e-8b1d-4c55-9d7a-0c1e2f3a4b5c"
+	clientIP, region, country := minimizedClientIP, "me-south-1", "IR"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO discovery_logs`).
+		WithArgs("dtv", gatewayID, nil, region, country, true, nil, nil, clientBucket{}).
+		WillReturnRows(sqlmock.NewRows([]string{"is_honeypot"}).AddRow(false))
+	mock.ExpectCommit()
+
+	_, err := database.RecordDiscoveryLogs(context.Background(), []DiscoveryLogEntry{{
+		ChannelType: "dtv",
+		GatewayID:   &gatewayID,
+		ClientIP:    &clientIP,
+		Region:      &region,
+		Country:     &country,
+		Success:     true,
+	}}, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("RecordDiscoveryLogs: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMinimized_ClientErrorKeepsAggregateContextOnly(t *testing.T) {
+	database, mock := minimizedDatabase(t)
+	mock.ExpectExec(`INSERT INTO client_errors`).
+		WithArgs("pack_verification_failed", "1.4.0", "android", withoutIdentifiers{}, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := database.RecordClientError(context.Background(), "pack_verification_failed", "1.4.0", "android", map[string]string{
+		"trusted_key_id": "k1",
+		"pack_key_id":    "k2",
+		"device":         minimizedDeviceID,
+		"last_gateway":   minimizedClientIP,
+	}, nil)
+	if err != nil {
+		t.Fatalf("RecordClientError: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -7,22 +7,26 @@ import (
 
 // Gateway represents a relay server/gateway
 type Gateway struct {
-	ID               string
-	PublicKey        []byte
-	IPAddress        string
-	Port             int
-	TransportTypes   []string
+	ID                string
+	PublicKey         []byte
+	IPAddress         string
+	Port              int
+	TransportTypes    []string
 	DiscoveryChannels []string
-	Region           string
-	BandwidthMbps    *int
-	CurrentUsers     int
-	MaxUsers         *int
-	Status           string
-	IsHoneypot       bool
-	Load             float64 // Current load 0.0-1.0
-	CreatedAt        time.Time
-	LastSeen         *time.Time
-	UpdatedAt        time.Time
+	Region            string
+	BandwidthMbps     *int
+	CurrentUsers      int
+	MaxUsers          *int
+	Status            string
+	IsHoneypot        bool
+	OperatorID        string // Operator account that registered the gateway (empty for our own)
+	ApprovalStatus    string // approved, pending, or rejected
+	ASN               *int
+	Load              float64 // Current load 0.0-1.0
+	Origin            string  // Federation peer that announced the gateway (empty for our own)
+	CreatedAt         time.Time
+	LastSeen          *time.Time
+	UpdatedAt         time.Time
 }
 
 // ConfigPack represents a signed configuration pack
@@ -39,15 +43,16 @@ type ConfigPack struct {
 
 // Attestation represents a device attestation record
 type Attestation struct {
-	ID             string
-	DeviceID       string
-	Platform       string
-	Token          string
-	Verified       bool
-	VerifiedAt     *time.Time
+	ID              string
+	DeviceID        string
+	Platform        string
+	Token           string
+	Verified        bool
+	VerifiedAt      *time.Time
 	DeviceIntegrity *string
-	CreatedAt      time.Time
-	ExpiresAt      *time.Time
+	CreatedAt       time.Time
+	ExpiresAt       *time.Time
+	RiskScore       *float64 // Unset for attestations stored before risk scoring
 }
 
 // OperatorMetric represents a time-series metric entry
@@ -64,15 +69,15 @@ type OperatorMetric struct {
 
 // DiscoveryLog represents a discovery channel log entry
 type DiscoveryLog struct {
-	ID          string
-	ChannelType string
-	GatewayID   *string
-	ClientIP    *string
-	Region      *string
-	Success     bool
-	LatencyMs   *int
+	ID           string
+	ChannelType  string
+	GatewayID    *string
+	ClientIP     *string
+	Region       *string
+	Success      bool
+	LatencyMs    *int
 	ErrorMessage *sql.NullString
-	CreatedAt   time.Time
+	CreatedAt    time.Time
 }
 
 // GatewayStatusHistory represents a gateway status change
@@ -93,3 +98,218 @@ type RateLimit struct {
 	WindowStart  time.Time
 	CreatedAt    time.Time
 }
+
+// ReviewQueueItem represents an entry awaiting admin review
+type ReviewQueueItem struct {
+	ID          string
+	SubjectType string // e.g. "gateway", "gateway_cluster"
+	SubjectID   string
+	Reason      string
+	Details     []byte // JSONB stored as bytes
+	Status      string // open, resolved, dismissed
+	CreatedAt   time.Time
+	ResolvedAt  *time.Time
+	ResolvedBy  *string
+}
+
+// Rollout represents a rollout percentage for a config version or feature key
+type Rollout struct {
+	Key         string
+	Region      string // Empty applies to every region
+	Percentage  int    // The fixed percentage, or the value an aborted schedule froze at
+	Description *string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Schedule    *RolloutSchedule // Ramps the percentage over time when set
+	AbortedAt   *time.Time       // Set when a schedule was stopped at Percentage
+}
+
+// RolloutSchedule ramps a rollout from StartPercentage at StartAt to
+// EndPercentage at EndAt along an easing curve
+type RolloutSchedule struct {
+	StartAt         time.Time
+	EndAt           time.Time
+	StartPercentage int
+	EndPercentage   int
+	Easing          string
+}
+
+// GatewaySecret is one generation of a gateway's transport secret, encrypted
+// with the data key
+type GatewaySecret struct {
+	GatewayID  string
+	Generation int
+	Ciphertext []byte
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time // Nil for the current generation
+}
+
+// SigningKey is a config signing key created by rotation, or an
+// environment-configured key recorded when rotated out
+type SigningKey struct {
+	KeyID            string
+	PublicKey        []byte
+	SealedPrivateKey []byte // Encrypted with the data key; nil for a key recorded by its public key alone
+	CreatedAt        time.Time
+	ExpiresAt        *time.Time // Nil for the current key
+	PreviousKeyID    string     // The key this one replaced; empty for keys without an endorsement
+	Endorsement      []byte     // The previous key's signature over this key
+}
+
+// TransportPolicy overrides whether a transport is advertised to clients in
+// one country
+type TransportPolicy struct {
+	Country   string // ISO 3166-1 alpha-2
+	Transport string
+	Action    string // allow, deny or prefer
+	UpdatedAt time.Time
+}
+
+// Experiment assigns each device it targets one of its variants of the pack
+// parameters, by weight
+type Experiment struct {
+	Name        string
+	Description *string
+	Variants    []ExperimentVariant
+	Regions     []string   // Empty targets every region
+	Platforms   []string   // Empty targets every platform
+	StartsAt    *time.Time // Nil has started
+	EndsAt      *time.Time // Nil never ends
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// ExperimentVariant is one arm of an experiment. Parameters it leaves unset
+// keep the device's usual values.
+type ExperimentVariant struct {
+	Name           string   `json:"name"`
+	Weight         int      `json:"weight"`                    // Share of devices, relative to the other variants
+	TransportOrder []string `json:"transport_order,omitempty"` // Transport types listed first, in this order
+	ScanInterval   int      `json:"scan_interval,omitempty"`   // Discovery scan interval in seconds
+}
+
+// TransportConfig is a transport advertised in packs, for every region or
+// for one region, where it replaces the global row of the same type
+type TransportConfig struct {
+	ID          int64
+	Type        string
+	Endpoints   []string
+	Fingerprint string
+	Options     map[string]string
+	Region      string // Empty for every region
+	Enabled     bool
+	Priority    int // Higher first in packs
+	Weight      int // Share of attempts among transports of the same priority
+	UpdatedAt   time.Time
+
+	// EndpointPool holds SNI/host candidates each device is given its own
+	// EndpointsPerClient of, instead of Endpoints; empty serves Endpoints
+	EndpointPool       []string
+	EndpointsPerClient int
+}
+
+// Region is where an infrastructure region is, in decimal degrees
+type Region struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+}
+
+// RegionLoad is the load of a region's approved, active gateways, as the
+// share of their users to their capacity
+type RegionLoad struct {
+	Region  string
+	Mean    float64 // Mean load of the region's gateways
+	Minimum float64 // Load of its least loaded gateway
+}
+
+// RendezvousMirror is an alternate rendezvous endpoint listed in packs, for
+// every region or for one region
+type RendezvousMirror struct {
+	ID        int64
+	URL       string
+	Region    string // Empty for every region
+	Priority  int    // Higher first in packs
+	Enabled   bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DiscoveryConfig is the discovery settings sent to clients in a region
+type DiscoveryConfig struct {
+	Region       string // DefaultDiscoveryRegion for regions without a row
+	Channels     []string
+	ScanInterval int // Seconds
+	BatteryAware bool
+	UpdatedAt    time.Time
+}
+
+// EnrollmentToken is a single-use token that lets a gateway agent register
+// itself for the operator and region an admin chose. Only its hash is stored.
+type EnrollmentToken struct {
+	ID         string
+	OperatorID string
+	Region     string
+	CreatedBy  string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	UsedAt     *time.Time
+	GatewayID  *string // Set once the redeeming gateway is registered
+}
+
+// OperatorCredential is a token a gateway operator authenticates with. The
+// token itself is never stored.
+type OperatorCredential struct {
+	ID         string
+	OperatorID string
+	CreatedBy  string
+	CreatedAt  time.Time
+	RevokedAt  *time.Time
+}
+
+// DeviceTrust is a device's progressive trust state
+type DeviceTrust struct {
+	DeviceID              string
+	Tier                  string // limited or trusted
+	FirstSeenAt           time.Time
+	ProbationStartedAt    time.Time // Reset on demotion
+	ValidAttestations     int       // Since probation started
+	SuccessfulConnections int       // Since probation started
+	TierChangedAt         *time.Time
+	LastAnomaly           *string
+	LastAnomalyAt         *time.Time
+}
+
+// FederationPeer is a partner rendezvous deployment whose gateway
+// announcements are imported
+type FederationPeer struct {
+	ID              string
+	Name            string
+	AnnouncementURL string
+	PublicKey       []byte // Pinned Ed25519 key
+	Enabled         bool
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	LastPolledAt    *time.Time
+	LastAnnouncedAt *time.Time // Timestamp of the last imported announcement
+	LastError       *string
+	Gateways        int // Gateways currently imported
+}
+
+// FederatedGateway is a gateway as announced by a federation peer
+type FederatedGateway struct {
+	PeerGatewayID  string
+	PublicKey      []byte
+	IPAddress      string
+	Port           int
+	TransportTypes []string
+	Region         string
+	Load           float64
+}
+
+// FederationImport counts what one announcement changed
+type FederationImport struct {
+	Added   int
+	Updated int
+	Removed int
+}
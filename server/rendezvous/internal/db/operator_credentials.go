@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"rendezvous/internal/apperr"
+)
+
+var (
+	// ErrOperatorCredentialInvalid is returned when no unrevoked operator
+	// credential matches
+	ErrOperatorCredentialInvalid = apperr.New(apperr.ErrUnauthorized, "invalid_operator_credential", "invalid operator credential")
+	// ErrOperatorCredentialNotFound is returned when revoking an unknown or
+	// already revoked credential
+	ErrOperatorCredentialNotFound = apperr.New(apperr.ErrNotFound, "operator_credential_not_found", "operator credential not found")
+)
+
+// CreateOperatorCredential stores a new operator credential by its hash.
+func (d *Database) CreateOperatorCredential(ctx context.Context, tokenHash, operatorID, createdBy string) (*OperatorCredential, error) {
+	credential := OperatorCredential{OperatorID: operatorID, CreatedBy: createdBy}
+	err := d.conn(ctx).QueryRowContext(
+		ctx,
+		`INSERT INTO operator_credentials (token_hash, operator_id, created_by)
+		 VALUES ($1, $2, $3)
+		 RETURNING id, created_at`,
+		tokenHash,
+		operatorID,
+		createdBy,
+	).Scan(&credential.ID, &credential.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create operator credential: %w", classify(err))
+	}
+	return &credential, nil
+}
+
+// GetOperatorCredential returns the unrevoked credential stored under
+// tokenHash, or ErrOperatorCredentialInvalid.
+func (d *Database) GetOperatorCredential(ctx context.Context, tokenHash string) (*OperatorCredential, error) {
+	var credential OperatorCredential
+	err := d.pool.QueryRowContext(
+		ctx,
+		`SELECT id, operator_id, created_by, created_at
+		 FROM operator_credentials
+		 WHERE token_hash = $1 AND revoked_at IS NULL`,
+		tokenHash,
+	).Scan(&credential.ID, &credential.OperatorID, &credential.CreatedBy, &credential.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOperatorCredentialInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load operator credential: %w", classify(err))
+	}
+	return &credential, nil
+}
+
+// RevokeOperatorCredential revokes a credential at now and returns it.
+func (d *Database) RevokeOperatorCredential(ctx context.Context, id string, now time.Time) (*OperatorCredential, error) {
+	credential := OperatorCredential{ID: id}
+	err := d.conn(ctx).QueryRowContext(
+		ctx,
+		`UPDATE operator_credentials SET revoked_at = $2
+		 WHERE id = $1 AND revoked_at IS NULL
+		 RETURNING operator_id, created_by, created_at, revoked_at`,
+		id,
+		now,
+	).Scan(&credential.OperatorID, &credential.CreatedBy, &credential.CreatedAt, &credential.RevokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOperatorCredentialNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke operator credential: %w", classify(err))
+	}
+	return &credential, nil
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"rendezvous/internal/apperr"
+)
+
+// ErrPreferencesNotFound is returned when an operator has not set notification preferences.
+var ErrPreferencesNotFound = apperr.New(apperr.ErrNotFound, "notification_preferences_not_found", "notification preferences not found")
+
+// OperatorPreferences is where and about what an operator wants to be notified
+type OperatorPreferences struct {
+	OperatorID string
+	WebhookURL string   // Empty when not set
+	Email      string   // Empty when not set
+	Events     []string // Enabled event types
+	UpdatedAt  time.Time
+}
+
+// NotificationDelivery is one attempt to deliver an operator event
+type NotificationDelivery struct {
+	ID         int64     `json:"id"`
+	OperatorID string    `json:"-"`
+	EventType  string    `json:"event_type"`
+	GatewayID  string    `json:"gateway_id,omitempty"`
+	Channel    string    `json:"channel"` // webhook, email, or none
+	Attempt    int       `json:"attempt"`
+	Status     string    `json:"status"` // delivered, failed or rate_limited
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// StaleGateway is a gateway the reaper marked offline
+type StaleGateway struct {
+	ID         string
+	OperatorID string
+	LastSeen   *time.Time
+}
+
+// GetOperatorPreferences returns an operator's notification preferences.
+func (d *Database) GetOperatorPreferences(ctx context.Context, operatorID string) (*OperatorPreferences, error) {
+	var p OperatorPreferences
+	var webhookURL, email sql.NullString
+	err := d.pool.QueryRowContext(
+		ctx,
+		`SELECT operator_id, webhook_url, email, events, updated_at
+		 FROM operator_notification_preferences
+		 WHERE operator_id = $1`,
+		operatorID,
+	).Scan(&p.OperatorID, &webhookURL, &email, pq.Array(&p.Events), &p.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPreferencesNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification preferences: %w", classify(err))
+	}
+	p.WebhookURL = webhookURL.String
+	p.Email = email.String
+	if p.Events == nil {
+		p.Events = []string{}
+	}
+	return &p, nil
+}
+
+// UpsertOperatorPreferences creates or replaces an operator's notification preferences.
+func (d *Database) UpsertOperatorPreferences(ctx context.Context, p *OperatorPreferences) error {
+	events := p.Events
+	if events == nil {
+		events = []string{}
+	}
+	_, err := d.pool.ExecContext(
+		ctx,
+		`INSERT INTO operator_notification_preferences (operator_id, webhook_url, email, events, updated_at)
+		 VALUES ($1, $2, $3, $4, NOW())
+		 ON CONFLICT (operator_id) DO UPDATE
+		 SET webhook_url = EXCLUDED.webhook_url,
+		     email = EXCLUDED.email,
+		     events = EXCLUDED.events,
+		     updated_at = NOW()`,
+		p.OperatorID,
+		nullableString(p.WebhookURL),
+		nullableString(p.Email),
+		pq.Array(events),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store notification preferences: %w", classify(err))
+	}
+	return nil
+}
+
+// RecordNotificationDelivery logs one delivery attempt.
+func (d *Database) RecordNotificationDelivery(ctx context.Context, delivery *NotificationDelivery) error {
+	_, err := d.pool.ExecContext(
+		ctx,
+		`INSERT INTO operator_notification_deliveries
+		 (operator_id, event_type, gateway_id, channel, attempt, status, error)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		delivery.OperatorID,
+		delivery.EventType,
+		nullableString(delivery.GatewayID),
+		delivery.Channel,
+		delivery.Attempt,
+		delivery.Status,
+		nullableString(delivery.Error),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record notification delivery: %w", classify(err))
+	}
+	return nil
+}
+
+// GetNotificationDeliveries returns an operator's most recent delivery attempts, newest first.
+func (d *Database) GetNotificationDeliveries(ctx context.Context, operatorID string, limit int) ([]NotificationDelivery, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT id, operator_id, event_type, gateway_id, channel, attempt, status, error, created_at
+		 FROM operator_notification_deliveries
+		 WHERE operator_id = $1
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT $2`,
+		operatorID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification deliveries: %w", classify(err))
+	}
+	defer rows.Close()
+
+	deliveries := []NotificationDelivery{}
+	for rows.Next() {
+		var delivery NotificationDelivery
+		var gatewayID, deliveryErr sql.NullString
+		if err := rows.Scan(
+			&delivery.ID, &delivery.OperatorID, &delivery.EventType, &gatewayID,
+			&delivery.Channel, &delivery.Attempt, &delivery.Status, &deliveryErr, &delivery.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan notification delivery: %w", classify(err))
+		}
+		delivery.GatewayID = gatewayID.String
+		delivery.Error = deliveryErr.String
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// MarkStaleGatewaysOffline sets every operator gateway that has not reported
+// since before to offline and returns the gateways it changed. Gateways that
+// never reported and our own gateways are left alone.
+func (d *Database) MarkStaleGatewaysOffline(ctx context.Context, before time.Time) ([]StaleGateway, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`UPDATE gateways SET status = 'offline'
+		 WHERE status <> 'offline' AND last_seen < $1
+		   AND operator_id IS NOT NULL AND is_honeypot = FALSE
+		 RETURNING id, operator_id, last_seen`,
+		before,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark stale gateways offline: %w", classify(err))
+	}
+	defer rows.Close()
+
+	stale := []StaleGateway{}
+	for rows.Next() {
+		var gw StaleGateway
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&gw.ID, &gw.OperatorID, &lastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan stale gateway: %w", classify(err))
+		}
+		if lastSeen.Valid {
+			gw.LastSeen = &lastSeen.Time
+		}
+		stale = append(stale, gw)
+	}
+	return stale, rows.Err()
+}
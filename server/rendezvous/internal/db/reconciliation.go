@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GatewayUserHour is one hour of a gateway's reported users next to the
+// independent signals for the same hour
+type GatewayUserHour struct {
+	GatewayID string
+	Hour      time.Time
+	Reported  int   // Highest users_connected the gateway reported
+	Reports   bool  // False when the gateway did not report that hour
+	Issued    int64 // Config packs that listed the gateway
+	Confirmed int64 // Successful connections clients reported
+}
+
+// GatewayReconciliation is the stored users_connected reconciliation of a
+// gateway
+type GatewayReconciliation struct {
+	GatewayID      string
+	Plausibility   float64
+	PlausibleUsers int
+	Hours          int  // Hours the gateway reported in
+	ExceededHours  int  // Hours its report exceeded the plausible bound
+	Flagged        bool // Caps the gateway's community page user count at PlausibleUsers
+}
+
+// RecordGatewayIssuance adds pack counts per gateway to the given hour.
+// Counts for gateways deleted in the meantime are dropped.
+func (d *Database) RecordGatewayIssuance(ctx context.Context, hour time.Time, counts map[string]int64) error {
+	tx, err := d.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for gatewayID, packs := range counts {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO gateway_issuance_counts (gateway_id, hour, packs)
+			 SELECT id, $2, $3 FROM gateways WHERE id = $1
+			 ON CONFLICT (gateway_id, hour) DO UPDATE
+			 SET packs = gateway_issuance_counts.packs + EXCLUDED.packs`,
+			gatewayID,
+			hour,
+			packs,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record gateway issuance: %w", classify(err))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit gateway issuance: %w", classify(err))
+	}
+	return nil
+}
+
+// PruneGatewayIssuance deletes issuance counts for hours before the given time
+func (d *Database) PruneGatewayIssuance(ctx context.Context, before time.Time) (int64, error) {
+	result, err := d.pool.ExecContext(ctx, `DELETE FROM gateway_issuance_counts WHERE hour < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune gateway issuance: %w", classify(err))
+	}
+	return result.RowsAffected()
+}
+
+// GetGatewayUserHours returns, per non-rejected, non-honeypot gateway and
+// hour since the given time, the users it reported, the packs that listed it
+// and the connections clients confirmed. Hours with none of them are left
+// out. Rows are ordered by gateway, then hour.
+func (d *Database) GetGatewayUserHours(ctx context.Context, since time.Time) ([]*GatewayUserHour, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT s.gateway_id, s.hour, MAX(s.reported), SUM(s.issued)::BIGINT, SUM(s.confirmed)::BIGINT
+		 FROM (
+		     SELECT gateway_id, date_trunc('hour', time) AS hour, users_connected AS reported, 0 AS issued, 0 AS confirmed
+		     FROM operator_metrics
+		     WHERE time >= $1
+		     UNION ALL
+		     SELECT gateway_id, hour, NULL, packs, 0
+		     FROM gateway_issuance_counts
+		     WHERE hour >= date_trunc('hour', $1::TIMESTAMPTZ)
+		     UNION ALL
+		     SELECT gateway_id, date_trunc('hour', created_at), NULL, 0, 1
+		     FROM discovery_logs
+		     WHERE success AND gateway_id IS NOT NULL AND created_at >= $1
+		 ) s
+		 JOIN gateways g ON g.id = s.gateway_id
+		 WHERE g.approval_status <> 'rejected' AND g.is_honeypot = FALSE
+		 GROUP BY s.gateway_id, s.hour
+		 ORDER BY s.gateway_id, s.hour`,
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gateway user hours: %w", classify(err))
+	}
+	defer rows.Close()
+
+	hours := []*GatewayUserHour{}
+	for rows.Next() {
+		var h GatewayUserHour
+		var reported sql.NullInt64
+		if err := rows.Scan(&h.GatewayID, &h.Hour, &reported, &h.Issued, &h.Confirmed); err != nil {
+			return nil, fmt.Errorf("failed to scan gateway user hour: %w", classify(err))
+		}
+		h.Reported, h.Reports = int(reported.Int64), reported.Valid
+		hours = append(hours, &h)
+	}
+	return hours, rows.Err()
+}
+
+// UpsertGatewayReconciliation stores the latest reconciliation of a gateway
+func (d *Database) UpsertGatewayReconciliation(ctx context.Context, r *GatewayReconciliation) error {
+	_, err := d.pool.ExecContext(
+		ctx,
+		`INSERT INTO gateway_user_reconciliation
+		     (gateway_id, plausibility, plausible_users, hours, exceeded_hours, flagged, computed_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		 ON CONFLICT (gateway_id) DO UPDATE
+		 SET plausibility = EXCLUDED.plausibility, plausible_users = EXCLUDED.plausible_users,
+		     hours = EXCLUDED.hours, exceeded_hours = EXCLUDED.exceeded_hours,
+		     flagged = EXCLUDED.flagged, computed_at = EXCLUDED.computed_at`,
+		r.GatewayID,
+		r.Plausibility,
+		r.PlausibleUsers,
+		r.Hours,
+		r.ExceededHours,
+		r.Flagged,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store gateway reconciliation: %w", classify(err))
+	}
+	return nil
+}
+
+// GetGatewayUserCaps returns the plausible user count of every flagged
+// gateway, keyed by gateway ID
+func (d *Database) GetGatewayUserCaps(ctx context.Context) (map[string]int, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT gateway_id, plausible_users FROM gateway_user_reconciliation WHERE flagged = TRUE`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gateway user caps: %w", classify(err))
+	}
+	defer rows.Close()
+
+	caps := map[string]int{}
+	for rows.Next() {
+		var gatewayID string
+		var plausible int
+		if err := rows.Scan(&gatewayID, &plausible); err != nil {
+			return nil, fmt.Errorf("failed to scan gateway user cap: %w", classify(err))
+		}
+		caps[gatewayID] = plausible
+	}
+	return caps, rows.Err()
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"rendezvous/internal/cache"
+)
+
+// GetRegions returns the located infrastructure regions, ordered by name.
+// Results come from the policy cache when one is set and must not be
+// modified.
+func (d *Database) GetRegions(ctx context.Context) ([]*Region, error) {
+	if d.policy != nil {
+		return cache.Load(ctx, d.policy, cache.TableRegions, d.queryRegions)
+	}
+	return d.queryRegions(ctx)
+}
+
+func (d *Database) queryRegions(ctx context.Context) ([]*Region, error) {
+	rows, err := d.pool.QueryContext(ctx, `SELECT name, latitude, longitude FROM regions ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query regions: %w", classify(err))
+	}
+	defer rows.Close()
+
+	regions := []*Region{}
+	for rows.Next() {
+		var r Region
+		if err := rows.Scan(&r.Name, &r.Latitude, &r.Longitude); err != nil {
+			return nil, fmt.Errorf("failed to scan region: %w", classify(err))
+		}
+		regions = append(regions, &r)
+	}
+	return regions, rows.Err()
+}
+
+// GetRegionLoads returns the load of each region with an approved, active
+// gateway that is not a honeypot. Gateways without a capacity count as half
+// loaded. Results come from the policy cache when one is set, so they can be
+// up to its TTL old, and must not be modified.
+func (d *Database) GetRegionLoads(ctx context.Context) ([]*RegionLoad, error) {
+	if d.policy != nil {
+		return cache.Load(ctx, d.policy, cache.TableRegionLoads, d.queryRegionLoads)
+	}
+	return d.queryRegionLoads(ctx)
+}
+
+func (d *Database) queryRegionLoads(ctx context.Context) ([]*RegionLoad, error) {
+	rows, err := d.pool.QueryContext(ctx, `
+		WITH loads AS (
+			SELECT region,
+				CASE WHEN COALESCE(max_users, 0) = 0 THEN 0.5
+					ELSE current_users::DOUBLE PRECISION / max_users END AS load
+			FROM gateways
+			WHERE status = 'active' AND approval_status = 'approved' AND is_honeypot = FALSE
+		)
+		SELECT region, AVG(load), MIN(load)
+		FROM loads
+		GROUP BY region
+		ORDER BY region
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query region loads: %w", classify(err))
+	}
+	defer rows.Close()
+
+	loads := []*RegionLoad{}
+	for rows.Next() {
+		var l RegionLoad
+		if err := rows.Scan(&l.Region, &l.Mean, &l.Minimum); err != nil {
+			return nil, fmt.Errorf("failed to scan region load: %w", classify(err))
+		}
+		loads = append(loads, &l)
+	}
+	return loads, rows.Err()
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/cache"
+)
+
+// ErrRendezvousMirrorNotFound is returned when a mirror has no row for a region.
+var ErrRendezvousMirrorNotFound = apperr.New(apperr.ErrNotFound, "rendezvous_mirror_not_found", "rendezvous mirror not found")
+
+// GetRendezvousMirrors returns every mirror row, enabled or not, highest
+// priority first. Results come from the policy cache when one is set and
+// must not be modified.
+func (d *Database) GetRendezvousMirrors(ctx context.Context) ([]*RendezvousMirror, error) {
+	if d.policy != nil {
+		return cache.Load(ctx, d.policy, cache.TableRendezvousMirrors, d.queryRendezvousMirrors)
+	}
+	return d.queryRendezvousMirrors(ctx)
+}
+
+func (d *Database) queryRendezvousMirrors(ctx context.Context) ([]*RendezvousMirror, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT id, url, region, priority, enabled, created_at, updated_at
+		 FROM rendezvous_mirrors
+		 ORDER BY priority DESC, id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rendezvous mirrors: %w", classify(err))
+	}
+	defer rows.Close()
+
+	mirrors := []*RendezvousMirror{}
+	for rows.Next() {
+		var m RendezvousMirror
+		var region sql.NullString
+		if err := rows.Scan(&m.ID, &m.URL, &region, &m.Priority, &m.Enabled, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan rendezvous mirror: %w", classify(err))
+		}
+		m.Region = region.String
+		mirrors = append(mirrors, &m)
+	}
+	return mirrors, rows.Err()
+}
+
+// UpsertRendezvousMirror stores the mirror for m.URL and m.Region, replacing
+// any existing row, and returns the stored row. URLs must be https. Callers
+// invalidate cache.TableRendezvousMirrors afterwards.
+func (d *Database) UpsertRendezvousMirror(ctx context.Context, m *RendezvousMirror) (*RendezvousMirror, error) {
+	stored := *m
+	err := d.pool.QueryRowContext(
+		ctx,
+		`INSERT INTO rendezvous_mirrors (url, region, priority, enabled)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (url, COALESCE(region, '')) DO UPDATE
+		 SET priority = EXCLUDED.priority,
+		     enabled = EXCLUDED.enabled,
+		     updated_at = NOW()
+		 RETURNING id, created_at, updated_at`,
+		m.URL,
+		sql.NullString{String: m.Region, Valid: m.Region != ""},
+		m.Priority,
+		m.Enabled,
+	).Scan(&stored.ID, &stored.CreatedAt, &stored.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert rendezvous mirror: %w", classify(err))
+	}
+	return &stored, nil
+}
+
+// DeleteRendezvousMirror removes the mirror row for url in region, or the
+// global row when region is empty. Callers invalidate
+// cache.TableRendezvousMirrors afterwards.
+func (d *Database) DeleteRendezvousMirror(ctx context.Context, url, region string) error {
+	result, err := d.pool.ExecContext(
+		ctx,
+		`DELETE FROM rendezvous_mirrors WHERE url = $1 AND COALESCE(region, '') = $2`,
+		url,
+		region,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete rendezvous mirror: %w", classify(err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read delete result: %w", classify(err))
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("rendezvous mirror %s/%s: %w", url, region, ErrRendezvousMirrorNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestRendezvousMirrors(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping rendezvous mirror tests")
+	}
+	if err := RunMigrations(databaseURL); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	ctx := context.Background()
+	database, err := New(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer database.Close()
+
+	const region = "test-mirrors-1"
+	upsert := func(mirror *RendezvousMirror) *RendezvousMirror {
+		t.Helper()
+		stored, err := database.UpsertRendezvousMirror(ctx, mirror)
+		if err != nil {
+			t.Fatalf("UpsertRendezvousMirror(%s/%s): %v", mirror.URL, mirror.Region, err)
+		}
+		t.Cleanup(func() { database.DeleteRendezvousMirror(ctx, mirror.URL, mirror.Region) })
+		return stored
+	}
+	global := upsert(&RendezvousMirror{URL: "https://mirror-a.test", Priority: 10, Enabled: true})
+	upsert(&RendezvousMirror{URL: "https://mirror-a.test", Region: region, Priority: 20, Enabled: true})
+
+	// Upserting again replaces the row for the same URL and region
+	again := upsert(&RendezvousMirror{URL: "https://mirror-a.test", Priority: 5, Enabled: false})
+	if again.ID != global.ID || again.Priority != 5 || again.Enabled {
+		t.Errorf("upsert again: got %+v, want row %d", again, global.ID)
+	}
+
+	mirrors, err := database.GetRendezvousMirrors(ctx)
+	if err != nil {
+		t.Fatalf("GetRendezvousMirrors: %v", err)
+	}
+	found := map[string]*RendezvousMirror{}
+	for _, mirror := range mirrors {
+		if mirror.URL == "https://mirror-a.test" {
+			found[mirror.Region] = mirror
+		}
+	}
+	if m := found[""]; m == nil || m.Priority != 5 || m.Enabled {
+		t.Errorf("global mirror: got %+v", m)
+	}
+	if m := found[region]; m == nil || m.Priority != 20 || !m.Enabled {
+		t.Errorf("regional mirror: got %+v", m)
+	}
+
+	// Only https URLs are stored
+	if _, err := database.UpsertRendezvousMirror(ctx, &RendezvousMirror{URL: "http://mirror-b.test"}); err == nil {
+		database.DeleteRendezvousMirror(ctx, "http://mirror-b.test", "")
+		t.Error("http mirror: expected an error")
+	}
+
+	if err := database.DeleteRendezvousMirror(ctx, "https://mirror-a.test", region); err != nil {
+		t.Fatalf("DeleteRendezvousMirror: %v", err)
+	}
+	if err := database.DeleteRendezvousMirror(ctx, "https://mirror-a.test", region); !errors.Is(err, ErrRendezvousMirrorNotFound) {
+		t.Errorf("delete again: got %v, want ErrRendezvousMirrorNotFound", err)
+	}
+}
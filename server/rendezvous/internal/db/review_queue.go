@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"rendezvous/internal/apperr"
+)
+
+// ErrReviewItemNotFound is returned when a review queue item does not exist or is already closed.
+var ErrReviewItemNotFound = apperr.New(apperr.ErrNotFound, "review_item_not_found", "review item not found")
+
+// AddReviewItem opens a review queue item. If an open item already exists for the
+// same subject and reason it is left untouched and added is false.
+func (d *Database) AddReviewItem(
+	ctx context.Context,
+	subjectType string,
+	subjectID string,
+	reason string,
+	details map[string]interface{},
+) (added bool, err error) {
+	return addReviewItem(ctx, d.pool, subjectType, subjectID, reason, details)
+}
+
+// execer runs statements on the pool or in a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func addReviewItem(
+	ctx context.Context,
+	q execer,
+	subjectType string,
+	subjectID string,
+	reason string,
+	details map[string]interface{},
+) (added bool, err error) {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode review details: %w", classify(err))
+	}
+
+	result, err := q.ExecContext(
+		ctx,
+		`INSERT INTO review_queue (subject_type, subject_id, reason, details)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (subject_type, subject_id, reason) WHERE status = 'open' DO NOTHING`,
+		subjectType,
+		subjectID,
+		reason,
+		detailsJSON,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert review item: %w", classify(err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read insert result: %w", classify(err))
+	}
+	return rowsAffected > 0, nil
+}
+
+// GetReviewItems lists review queue items with the given status, newest first.
+func (d *Database) GetReviewItems(ctx context.Context, status string, limit int) ([]*ReviewQueueItem, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT id, subject_type, subject_id, reason, details, status, created_at, resolved_at, resolved_by
+		 FROM review_queue
+		 WHERE status = $1
+		 ORDER BY created_at DESC
+		 LIMIT $2`,
+		status,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query review queue: %w", classify(err))
+	}
+	defer rows.Close()
+
+	items := []*ReviewQueueItem{}
+	for rows.Next() {
+		var item ReviewQueueItem
+		if err := rows.Scan(
+			&item.ID, &item.SubjectType, &item.SubjectID, &item.Reason, &item.Details,
+			&item.Status, &item.CreatedAt, &item.ResolvedAt, &item.ResolvedBy,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan review item: %w", classify(err))
+		}
+		items = append(items, &item)
+	}
+
+	return items, rows.Err()
+}
+
+// CloseReviewItem marks an open review queue item as resolved or dismissed.
+func (d *Database) CloseReviewItem(ctx context.Context, id string, status string, resolvedBy string) error {
+	result, err := d.conn(ctx).ExecContext(
+		ctx,
+		`UPDATE review_queue
+		 SET status = $1, resolved_at = NOW(), resolved_by = $2
+		 WHERE id = $3 AND status = 'open'`,
+		status,
+		nullableString(resolvedBy),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to close review item: %w", classify(err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read update result: %w", classify(err))
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("review item %s: %w", id, ErrReviewItemNotFound)
+	}
+	return nil
+}
+
+// HasDismissedReviewItem reports whether an admin has dismissed a review item
+// for the subject and reason, i.e. judged the finding a false positive.
+func (d *Database) HasDismissedReviewItem(ctx context.Context, subjectType, subjectID, reason string) (bool, error) {
+	var dismissed bool
+	err := d.pool.QueryRowContext(
+		ctx,
+		`SELECT EXISTS (
+		     SELECT 1 FROM review_queue
+		     WHERE subject_type = $1 AND subject_id = $2 AND reason = $3 AND status = 'dismissed'
+		 )`,
+		subjectType,
+		subjectID,
+		reason,
+	).Scan(&dismissed)
+	if err != nil {
+		return false, fmt.Errorf("failed to query dismissed review items: %w", classify(err))
+	}
+	return dismissed, nil
+}
+
+// HasDismissedReviewItemSince reports whether an admin has dismissed a review
+// item for the subject and reason at or after the given time, for findings
+// whose dismissal only holds for a while.
+func (d *Database) HasDismissedReviewItemSince(ctx context.Context, subjectType, subjectID, reason string, since time.Time) (bool, error) {
+	var dismissed bool
+	err := d.pool.QueryRowContext(
+		ctx,
+		`SELECT EXISTS (
+		     SELECT 1 FROM review_queue
+		     WHERE subject_type = $1 AND subject_id = $2 AND reason = $3 AND status = 'dismissed'
+		       AND resolved_at >= $4
+		 )`,
+		subjectType,
+		subjectID,
+		reason,
+		since,
+	).Scan(&dismissed)
+	if err != nil {
+		return false, fmt.Errorf("failed to query dismissed review items: %w", classify(err))
+	}
+	return dismissed, nil
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"rendezvous/internal/apperr"
+)
+
+// RevokedDevice is a device banned from attesting and from real gateways
+type RevokedDevice struct {
+	DeviceID  string
+	Reason    string
+	RevokedAt time.Time
+}
+
+// ErrRevokedDeviceNotFound is returned when removing a device that is not
+// revoked
+var ErrRevokedDeviceNotFound = apperr.New(apperr.ErrNotFound, "revoked_device_not_found", "device is not revoked")
+
+// IsDeviceRevoked reports whether a device is on the revocation list
+func (d *Database) IsDeviceRevoked(ctx context.Context, deviceID string) (bool, error) {
+	var revoked bool
+	err := d.pool.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM revoked_devices WHERE device_id = $1)`, deviceID).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check device revocation: %w", classify(err))
+	}
+	return revoked, nil
+}
+
+// AddRevokedDevice puts a device on the revocation list. Revoking a device
+// again replaces its reason and revocation time.
+func (d *Database) AddRevokedDevice(ctx context.Context, deviceID, reason string) (*RevokedDevice, error) {
+	r := RevokedDevice{DeviceID: deviceID, Reason: reason}
+	err := d.pool.QueryRowContext(ctx, `
+		INSERT INTO revoked_devices (device_id, reason) VALUES ($1, $2)
+		ON CONFLICT (device_id) DO UPDATE SET reason = EXCLUDED.reason, revoked_at = NOW()
+		RETURNING revoked_at
+	`, deviceID, reason).Scan(&r.RevokedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke device: %w", classify(err))
+	}
+	return &r, nil
+}
+
+// RemoveRevokedDevice takes a device off the revocation list
+func (d *Database) RemoveRevokedDevice(ctx context.Context, deviceID string) error {
+	result, err := d.pool.ExecContext(ctx, `DELETE FROM revoked_devices WHERE device_id = $1`, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to remove revoked device: %w", classify(err))
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to remove revoked device: %w", classify(err))
+	}
+	if rows == 0 {
+		return ErrRevokedDeviceNotFound
+	}
+	return nil
+}
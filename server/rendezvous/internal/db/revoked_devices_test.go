@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestRevokedDevices_AddAndRemove(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping revoked device tests")
+	}
+	if err := RunMigrations(databaseURL); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	ctx := context.Background()
+	database, err := New(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer database.Close()
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	deviceID := "device-" + hex.EncodeToString(b)
+
+	if revoked, err := database.IsDeviceRevoked(ctx, deviceID); err != nil || revoked {
+		t.Fatalf("IsDeviceRevoked before revocation: %v, %v", revoked, err)
+	}
+	if _, err := database.AddRevokedDevice(ctx, deviceID, "key extracted"); err != nil {
+		t.Fatalf("AddRevokedDevice: %v", err)
+	}
+	// Revoking again updates the reason
+	again, err := database.AddRevokedDevice(ctx, deviceID, "scraping")
+	if err != nil || again.Reason != "scraping" {
+		t.Fatalf("AddRevokedDevice again: %+v, %v", again, err)
+	}
+	if revoked, err := database.IsDeviceRevoked(ctx, deviceID); err != nil || !revoked {
+		t.Fatalf("IsDeviceRevoked after revocation: %v, %v", revoked, err)
+	}
+
+	if err := database.RemoveRevokedDevice(ctx, deviceID); err != nil {
+		t.Fatalf("RemoveRevokedDevice: %v", err)
+	}
+	if revoked, err := database.IsDeviceRevoked(ctx, deviceID); err != nil || revoked {
+		t.Errorf("IsDeviceRevoked after removal: %v, %v", revoked, err)
+	}
+	if err := database.RemoveRevokedDevice(ctx, deviceID); !errors.Is(err, ErrRevokedDeviceNotFound) {
+		t.Errorf("RemoveRevokedDevice twice: %v, want ErrRevokedDeviceNotFound", err)
+	}
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"math"
+	"time"
+)
+
+// Rollout schedule easings
+const (
+	EasingLinear    = "linear"
+	EasingEaseIn    = "ease_in"
+	EasingEaseOut   = "ease_out"
+	EasingEaseInOut = "ease_in_out"
+)
+
+// EffectivePercentage returns the rollout percentage in effect at now. A
+// schedule holds its start percentage until StartAt, eases towards its end
+// percentage until EndAt and holds that afterwards; an aborted or
+// unscheduled rollout stays at Percentage. The result depends only on the
+// stored rollout and now, so every replica computes the same value.
+func (r *Rollout) EffectivePercentage(now time.Time) int {
+	s := r.Schedule
+	if s == nil || r.AbortedAt != nil {
+		return r.Percentage
+	}
+	if !now.After(s.StartAt) {
+		return s.StartPercentage
+	}
+	if !now.Before(s.EndAt) {
+		return s.EndPercentage
+	}
+
+	progress := float64(now.Sub(s.StartAt)) / float64(s.EndAt.Sub(s.StartAt))
+	span := float64(s.EndPercentage - s.StartPercentage)
+	return s.StartPercentage + int(math.Round(span*ease(s.Easing, progress)))
+}
+
+// ease maps progress through a schedule, from 0 to 1, onto the fraction of
+// the ramp applied. Unknown easings ramp linearly.
+func ease(easing string, t float64) float64 {
+	switch easing {
+	case EasingEaseIn:
+		return t * t
+	case EasingEaseOut:
+		return 1 - (1-t)*(1-t)
+	case EasingEaseInOut:
+		if t < 0.5 {
+			return 2 * t * t
+		}
+		return 1 - 2*(1-t)*(1-t)
+	default:
+		return t
+	}
+}
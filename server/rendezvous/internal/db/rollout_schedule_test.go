@@ -0,0 +1,67 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEffectivePercentage(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(100 * time.Hour)
+	scheduled := func(easing string) *Rollout {
+		return &Rollout{Percentage: 10, Schedule: &RolloutSchedule{
+			StartAt: start, EndAt: end, StartPercentage: 10, EndPercentage: 90, Easing: easing,
+		}}
+	}
+	quarter, half := start.Add(25*time.Hour), start.Add(50*time.Hour)
+
+	tests := []struct {
+		name    string
+		rollout *Rollout
+		now     time.Time
+		want    int
+	}{
+		{"unscheduled", &Rollout{Percentage: 40}, half, 40},
+		{"before start", scheduled(EasingLinear), start.Add(-time.Hour), 10},
+		{"at start", scheduled(EasingLinear), start, 10},
+		{"linear quarter", scheduled(EasingLinear), quarter, 30},
+		{"linear half", scheduled(EasingLinear), half, 50},
+		{"ease in quarter", scheduled(EasingEaseIn), quarter, 15},
+		{"ease out quarter", scheduled(EasingEaseOut), quarter, 45},
+		{"ease in out quarter", scheduled(EasingEaseInOut), quarter, 20},
+		{"ease in out half", scheduled(EasingEaseInOut), half, 50},
+		{"unknown easing is linear", scheduled("bounce"), quarter, 30},
+		{"at end", scheduled(EasingEaseIn), end, 90},
+		{"after end", scheduled(EasingEaseIn), end.Add(24 * time.Hour), 90},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rollout.EffectivePercentage(tt.now); got != tt.want {
+				t.Errorf("EffectivePercentage() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectivePercentage_RampDown(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	rollout := &Rollout{Schedule: &RolloutSchedule{
+		StartAt: start, EndAt: start.Add(time.Hour), StartPercentage: 100, EndPercentage: 0, Easing: EasingLinear,
+	}}
+	if got := rollout.EffectivePercentage(start.Add(15 * time.Minute)); got != 75 {
+		t.Errorf("EffectivePercentage() = %d, want 75", got)
+	}
+}
+
+func TestEffectivePercentage_Aborted(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	abortedAt := start.Add(30 * time.Minute)
+	rollout := &Rollout{Percentage: 50, AbortedAt: &abortedAt, Schedule: &RolloutSchedule{
+		StartAt: start, EndAt: start.Add(time.Hour), StartPercentage: 0, EndPercentage: 100, Easing: EasingLinear,
+	}}
+	for _, now := range []time.Time{abortedAt, start.Add(45 * time.Minute), start.Add(48 * time.Hour)} {
+		if got := rollout.EffectivePercentage(now); got != 50 {
+			t.Errorf("EffectivePercentage(%s) = %d, want the frozen 50", now, got)
+		}
+	}
+}
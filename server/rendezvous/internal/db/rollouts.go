@@ -0,0 +1,203 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/cache"
+)
+
+// ErrRolloutNotFound is returned when a rollout key/region pair does not exist.
+var ErrRolloutNotFound = apperr.New(apperr.ErrNotFound, "rollout_not_found", "rollout not found")
+
+// GetRollouts returns every configured rollout. The table is small (one row per
+// key and region), so callers evaluate rollouts in memory. Results come from the
+// policy cache when one is set and must not be modified.
+func (d *Database) GetRollouts(ctx context.Context) ([]*Rollout, error) {
+	if d.policy != nil {
+		return cache.Load(ctx, d.policy, cache.TableRollouts, d.queryRollouts)
+	}
+	return d.queryRollouts(ctx)
+}
+
+func (d *Database) queryRollouts(ctx context.Context) ([]*Rollout, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT key, region, percentage, description, created_at, updated_at,
+		        schedule_start_at, schedule_end_at, schedule_start_percentage, schedule_end_percentage,
+		        schedule_easing, aborted_at
+		 FROM rollouts
+		 ORDER BY key, region`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollouts: %w", classify(err))
+	}
+	defer rows.Close()
+
+	rollouts := []*Rollout{}
+	for rows.Next() {
+		r, err := scanRollout(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rollout: %w", classify(err))
+		}
+		rollouts = append(rollouts, r)
+	}
+
+	return rollouts, rows.Err()
+}
+
+// scanRollout reads the columns selected by queryRollouts
+func scanRollout(row interface{ Scan(...interface{}) error }) (*Rollout, error) {
+	var r Rollout
+	var startAt, endAt, abortedAt sql.NullTime
+	var startPercentage, endPercentage sql.NullInt64
+	var easing sql.NullString
+	if err := row.Scan(
+		&r.Key, &r.Region, &r.Percentage, &r.Description, &r.CreatedAt, &r.UpdatedAt,
+		&startAt, &endAt, &startPercentage, &endPercentage, &easing, &abortedAt,
+	); err != nil {
+		return nil, err
+	}
+	if startAt.Valid && endAt.Valid {
+		r.Schedule = &RolloutSchedule{
+			StartAt:         startAt.Time,
+			EndAt:           endAt.Time,
+			StartPercentage: int(startPercentage.Int64),
+			EndPercentage:   int(endPercentage.Int64),
+			Easing:          easing.String,
+		}
+	}
+	if abortedAt.Valid {
+		r.AbortedAt = &abortedAt.Time
+	}
+	return &r, nil
+}
+
+// UpsertRollout creates or updates the rollout percentage for a key and
+// region. Any schedule on the rollout is removed.
+func (d *Database) UpsertRollout(ctx context.Context, key, region string, percentage int, description *string) error {
+	_, err := d.conn(ctx).ExecContext(
+		ctx,
+		`INSERT INTO rollouts (key, region, percentage, description)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (key, region) DO UPDATE
+		 SET percentage = EXCLUDED.percentage, description = EXCLUDED.description,
+		     schedule_start_at = NULL, schedule_end_at = NULL, schedule_start_percentage = NULL,
+		     schedule_end_percentage = NULL, schedule_easing = NULL, aborted_at = NULL`,
+		key,
+		region,
+		percentage,
+		description,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert rollout: %w", classify(err))
+	}
+	return nil
+}
+
+// ScheduleRollout creates or replaces a rollout for a key and region that
+// ramps along schedule. The stored percentage is the schedule's starting
+// value; a previous abort is cleared.
+func (d *Database) ScheduleRollout(ctx context.Context, key, region string, schedule RolloutSchedule, description *string) error {
+	_, err := d.conn(ctx).ExecContext(
+		ctx,
+		`INSERT INTO rollouts (key, region, percentage, description,
+		                       schedule_start_at, schedule_end_at, schedule_start_percentage,
+		                       schedule_end_percentage, schedule_easing)
+		 VALUES ($1, $2, $3, $4, $5, $6, $3, $7, $8)
+		 ON CONFLICT (key, region) DO UPDATE
+		 SET percentage = EXCLUDED.percentage, description = EXCLUDED.description,
+		     schedule_start_at = EXCLUDED.schedule_start_at, schedule_end_at = EXCLUDED.schedule_end_at,
+		     schedule_start_percentage = EXCLUDED.schedule_start_percentage,
+		     schedule_end_percentage = EXCLUDED.schedule_end_percentage,
+		     schedule_easing = EXCLUDED.schedule_easing, aborted_at = NULL`,
+		key,
+		region,
+		schedule.StartPercentage,
+		description,
+		schedule.StartAt,
+		schedule.EndAt,
+		schedule.EndPercentage,
+		schedule.Easing,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule rollout: %w", classify(err))
+	}
+	return nil
+}
+
+// AbortRollout stops a rollout where it stands: the percentage in effect at
+// now is stored and the schedule no longer advances. Aborting an aborted or
+// unscheduled rollout keeps its percentage. It returns the updated rollout.
+func (d *Database) AbortRollout(ctx context.Context, key, region string, now time.Time) (*Rollout, error) {
+	tx, err := d.beginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	rollout, err := scanRollout(tx.QueryRowContext(
+		ctx,
+		`SELECT key, region, percentage, description, created_at, updated_at,
+		        schedule_start_at, schedule_end_at, schedule_start_percentage, schedule_end_percentage,
+		        schedule_easing, aborted_at
+		 FROM rollouts
+		 WHERE key = $1 AND region = $2
+		 FOR UPDATE`,
+		key,
+		region,
+	))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("rollout %s/%s: %w", key, region, ErrRolloutNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rollout: %w", classify(err))
+	}
+
+	if rollout.AbortedAt == nil {
+		rollout.Percentage = rollout.EffectivePercentage(now)
+		rollout.AbortedAt = &now
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE rollouts SET percentage = $3, aborted_at = $4 WHERE key = $1 AND region = $2`,
+		key,
+		region,
+		rollout.Percentage,
+		*rollout.AbortedAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to abort rollout: %w", classify(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit rollout abort: %w", classify(err))
+	}
+	return rollout, nil
+}
+
+// DeleteRollout removes the rollout for a key and region.
+func (d *Database) DeleteRollout(ctx context.Context, key, region string) error {
+	result, err := d.conn(ctx).ExecContext(
+		ctx,
+		`DELETE FROM rollouts WHERE key = $1 AND region = $2`,
+		key,
+		region,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete rollout: %w", classify(err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read delete result: %w", classify(err))
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("rollout %s/%s: %w", key, region, ErrRolloutNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/cache"
+)
+
+// Keys in the settings table
+const (
+	// SettingKillSwitches maps transport types to why they are disabled
+	SettingKillSwitches = "kill_switches"
+)
+
+// ErrKillSwitchNotFound is returned when a transport has no kill switch set
+var ErrKillSwitchNotFound = apperr.New(apperr.ErrNotFound, "kill_switch_not_found", "kill switch not found")
+
+// GetKillSwitches returns the disabled transports by type, each with the
+// reason it was disabled. Results come from the policy cache when one is set
+// and must not be modified.
+func (d *Database) GetKillSwitches(ctx context.Context) (map[string]string, error) {
+	if d.policy != nil {
+		return cache.Load(ctx, d.policy, cache.TableSettings, d.queryKillSwitches)
+	}
+	return d.queryKillSwitches(ctx)
+}
+
+func (d *Database) queryKillSwitches(ctx context.Context) (map[string]string, error) {
+	var value []byte
+	err := d.pool.QueryRowContext(ctx, `SELECT value FROM settings WHERE key = $1`, SettingKillSwitches).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query kill switches: %w", classify(err))
+	}
+	killSwitches := map[string]string{}
+	if err := json.Unmarshal(value, &killSwitches); err != nil {
+		return nil, fmt.Errorf("failed to decode kill switches: %w", err)
+	}
+	return killSwitches, nil
+}
+
+// SetKillSwitch disables a transport type for reason, replacing the reason
+// if it is already disabled, and returns every kill switch as stored
+func (d *Database) SetKillSwitch(ctx context.Context, transportType, reason string) (map[string]string, error) {
+	entry, err := json.Marshal(map[string]string{transportType: reason})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode kill switch: %w", err)
+	}
+	var value []byte
+	err = d.conn(ctx).QueryRowContext(
+		ctx,
+		`INSERT INTO settings (key, value)
+		 VALUES ($1, $2)
+		 ON CONFLICT (key) DO UPDATE
+		 SET value = settings.value || EXCLUDED.value, updated_at = NOW()
+		 RETURNING value`,
+		SettingKillSwitches,
+		entry,
+	).Scan(&value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set kill switch: %w", classify(err))
+	}
+	killSwitches := map[string]string{}
+	if err := json.Unmarshal(value, &killSwitches); err != nil {
+		return nil, fmt.Errorf("failed to decode kill switches: %w", err)
+	}
+	return killSwitches, nil
+}
+
+// ClearKillSwitch enables a disabled transport type again
+func (d *Database) ClearKillSwitch(ctx context.Context, transportType string) error {
+	result, err := d.conn(ctx).ExecContext(
+		ctx,
+		`UPDATE settings SET value = value - $2, updated_at = NOW()
+		 WHERE key = $1 AND value ? $2`,
+		SettingKillSwitches,
+		transportType,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to clear kill switch: %w", classify(err))
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read clear result: %w", classify(err))
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("kill switch for %s: %w", transportType, ErrKillSwitchNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GetActiveSigningKeys returns the unexpired config signing keys, the
+// current key first and the others newest first.
+func (d *Database) GetActiveSigningKeys(ctx context.Context, now time.Time) ([]*SigningKey, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT key_id, public_key, sealed_private_key, created_at, expires_at, previous_key_id, endorsement
+		 FROM config_signing_keys
+		 WHERE expires_at IS NULL OR expires_at > $1
+		 ORDER BY expires_at IS NULL DESC, created_at DESC`,
+		now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query signing keys: %w", classify(err))
+	}
+	defer rows.Close()
+
+	keys := []*SigningKey{}
+	for rows.Next() {
+		var k SigningKey
+		var previousKeyID sql.NullString
+		if err := rows.Scan(
+			&k.KeyID, &k.PublicKey, &k.SealedPrivateKey, &k.CreatedAt, &k.ExpiresAt, &previousKeyID, &k.Endorsement,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan signing key: %w", classify(err))
+		}
+		k.PreviousKeyID = previousKeyID.String
+		keys = append(keys, &k)
+	}
+	return keys, rows.Err()
+}
+
+// RotateSigningKey stores next as the current config signing key, with its
+// endorsement by previous. The key it replaces, previous, stays valid until
+// previousExpiresAt; it is recorded by its public key if it was not stored
+// yet. Keys already expired at now are deleted.
+func (d *Database) RotateSigningKey(
+	ctx context.Context,
+	previous *SigningKey,
+	next *SigningKey,
+	previousExpiresAt time.Time,
+	now time.Time,
+) error {
+	tx, err := d.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", classify(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM config_signing_keys WHERE expires_at <= $1`,
+		now,
+	); err != nil {
+		return fmt.Errorf("failed to prune signing keys: %w", classify(err))
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE config_signing_keys SET expires_at = $1 WHERE expires_at IS NULL`,
+		previousExpiresAt,
+	); err != nil {
+		return fmt.Errorf("failed to expire signing key: %w", classify(err))
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO config_signing_keys (key_id, public_key, created_at, expires_at)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (key_id) DO UPDATE SET expires_at = EXCLUDED.expires_at`,
+		previous.KeyID,
+		previous.PublicKey,
+		now,
+		previousExpiresAt,
+	); err != nil {
+		return fmt.Errorf("failed to record previous signing key: %w", classify(err))
+	}
+
+	// Concurrent rotations collide on the current key index and return a
+	// conflict
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO config_signing_keys (key_id, public_key, sealed_private_key, created_at, previous_key_id, endorsement)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)`,
+		next.KeyID,
+		next.PublicKey,
+		next.SealedPrivateKey,
+		now,
+		next.PreviousKeyID,
+		next.Endorsement,
+	); err != nil {
+		return fmt.Errorf("failed to insert signing key: %w", classify(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit signing key: %w", classify(err))
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GatewayActivity compares what a gateway reported about itself with what
+// clients reported about it over a window.
+type GatewayActivity struct {
+	GatewayID        string
+	ApprovalStatus   string
+	ASN              *int
+	Heartbeats       int64 // Status reports from the gateway
+	MaxUsersReported int   // Highest users_connected the gateway claimed
+	ConfirmedClients int64 // Distinct clients with a successful discovery of the gateway
+	ClientSubnets    int64 // Distinct /24 (IPv4) or /48 (IPv6) networks among them
+	Reapproved       bool  // An admin approved the gateway after the scorer last excluded it
+}
+
+// GatewaySuspicion is the stored honeypot suspicion score of a gateway
+type GatewaySuspicion struct {
+	GatewayID  string             `json:"gateway_id"`
+	Score      float64            `json:"score"`
+	Components map[string]float64 `json:"components"`
+	Signals    map[string]int64   `json:"signals"`
+	Flagged    bool               `json:"flagged"`
+	ComputedAt time.Time          `json:"computed_at"`
+}
+
+// GetGatewayActivity returns the activity of every non-rejected, non-honeypot
+// gateway since the given time.
+func (d *Database) GetGatewayActivity(ctx context.Context, since time.Time) ([]*GatewayActivity, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT g.id, g.approval_status, g.asn,
+		        COALESCE(hb.heartbeats, 0), COALESCE(hb.max_users, 0),
+		        COALESCE(cl.clients, 0), COALESCE(cl.subnets, 0),
+		        COALESCE(g.approved_at > g.suspicion_excluded_at, FALSE)
+		 FROM gateways g
+		 LEFT JOIN (
+		     SELECT gateway_id, COUNT(*) AS heartbeats, MAX(users_connected) AS max_users
+		     FROM operator_metrics
+		     WHERE time >= $1
+		     GROUP BY gateway_id
+		 ) hb ON hb.gateway_id = g.id
+		 LEFT JOIN (
+		     SELECT gateway_id,
+		            COUNT(DISTINCT COALESCE(host(client_ip), client_bucket)) AS clients,
+		            COUNT(DISTINCT COALESCE(network(set_masklen(client_ip, CASE family(client_ip) WHEN 4 THEN 24 ELSE 48 END))::text, client_bucket)) AS subnets
+		     FROM discovery_logs
+		     WHERE success AND gateway_id IS NOT NULL AND (client_ip IS NOT NULL OR client_bucket IS NOT NULL) AND created_at >= $1
+		     GROUP BY gateway_id
+		 ) cl ON cl.gateway_id = g.id
+		 WHERE g.approval_status <> 'rejected' AND g.is_honeypot = FALSE
+		 ORDER BY g.id`,
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gateway activity: %w", classify(err))
+	}
+	defer rows.Close()
+
+	activity := []*GatewayActivity{}
+	for rows.Next() {
+		var a GatewayActivity
+		var asn sql.NullInt64
+		if err := rows.Scan(
+			&a.GatewayID, &a.ApprovalStatus, &asn,
+			&a.Heartbeats, &a.MaxUsersReported, &a.ConfirmedClients, &a.ClientSubnets, &a.Reapproved,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan gateway activity: %w", classify(err))
+		}
+		if asn.Valid {
+			v := int(asn.Int64)
+			a.ASN = &v
+		}
+		activity = append(activity, &a)
+	}
+	return activity, rows.Err()
+}
+
+// UpsertGatewaySuspicion stores the latest suspicion score of a gateway.
+func (d *Database) UpsertGatewaySuspicion(ctx context.Context, s *GatewaySuspicion) error {
+	components, err := json.Marshal(s.Components)
+	if err != nil {
+		return fmt.Errorf("failed to encode suspicion components: %w", classify(err))
+	}
+	signals, err := json.Marshal(s.Signals)
+	if err != nil {
+		return fmt.Errorf("failed to encode suspicion signals: %w", classify(err))
+	}
+
+	_, err = d.pool.ExecContext(
+		ctx,
+		`INSERT INTO gateway_suspicion_scores (gateway_id, score, components, signals, flagged, computed_at)
+		 VALUES ($1, $2, $3, $4, $5, NOW())
+		 ON CONFLICT (gateway_id) DO UPDATE
+		 SET score = EXCLUDED.score, components = EXCLUDED.components, signals = EXCLUDED.signals,
+		     flagged = EXCLUDED.flagged, computed_at = EXCLUDED.computed_at`,
+		s.GatewayID,
+		s.Score,
+		components,
+		signals,
+		s.Flagged,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store suspicion score: %w", classify(err))
+	}
+	return nil
+}
+
+// GetGatewaySuspicion returns the latest suspicion score of a gateway, or nil
+// if it has not been scored.
+func (d *Database) GetGatewaySuspicion(ctx context.Context, gatewayID string) (*GatewaySuspicion, error) {
+	var s GatewaySuspicion
+	var components, signals []byte
+	err := d.pool.QueryRowContext(
+		ctx,
+		`SELECT gateway_id, score, components, signals, flagged, computed_at
+		 FROM gateway_suspicion_scores
+		 WHERE gateway_id = $1`,
+		gatewayID,
+	).Scan(&s.GatewayID, &s.Score, &components, &signals, &s.Flagged, &s.ComputedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query suspicion score: %w", classify(err))
+	}
+	if err := json.Unmarshal(components, &s.Components); err != nil {
+		return nil, fmt.Errorf("failed to decode suspicion components: %w", classify(err))
+	}
+	if err := json.Unmarshal(signals, &s.Signals); err != nil {
+		return nil, fmt.Errorf("failed to decode suspicion signals: %w", classify(err))
+	}
+	return &s, nil
+}
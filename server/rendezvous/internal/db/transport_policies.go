@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/cache"
+)
+
+// ErrTransportPolicyNotFound is returned when a country/transport pair has no policy.
+var ErrTransportPolicyNotFound = apperr.New(apperr.ErrNotFound, "transport_policy_not_found", "transport policy not found")
+
+// GetTransportPolicies returns every transport policy, ordered by country and
+// transport. Results come from the policy cache when one is set and must not
+// be modified.
+func (d *Database) GetTransportPolicies(ctx context.Context) ([]*TransportPolicy, error) {
+	if d.policy != nil {
+		return cache.Load(ctx, d.policy, cache.TableTransportPolicies, d.queryTransportPolicies)
+	}
+	return d.queryTransportPolicies(ctx)
+}
+
+func (d *Database) queryTransportPolicies(ctx context.Context) ([]*TransportPolicy, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT country, transport, action, updated_at
+		 FROM transport_policies
+		 ORDER BY country, transport`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transport policies: %w", classify(err))
+	}
+	defer rows.Close()
+
+	policies := []*TransportPolicy{}
+	for rows.Next() {
+		var p TransportPolicy
+		if err := rows.Scan(&p.Country, &p.Transport, &p.Action, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan transport policy: %w", classify(err))
+		}
+		policies = append(policies, &p)
+	}
+	return policies, rows.Err()
+}
+
+// UpsertTransportPolicy sets the action for a transport in a country and
+// returns the stored policy.
+func (d *Database) UpsertTransportPolicy(ctx context.Context, country, transport, action string) (*TransportPolicy, error) {
+	p := TransportPolicy{Country: country, Transport: transport, Action: action}
+	err := d.conn(ctx).QueryRowContext(
+		ctx,
+		`INSERT INTO transport_policies (country, transport, action)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (country, transport) DO UPDATE
+		 SET action = EXCLUDED.action, updated_at = NOW()
+		 RETURNING updated_at`,
+		country,
+		transport,
+		action,
+	).Scan(&p.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert transport policy: %w", classify(err))
+	}
+	return &p, nil
+}
+
+// DeleteTransportPolicy removes the policy for a transport in a country.
+func (d *Database) DeleteTransportPolicy(ctx context.Context, country, transport string) error {
+	result, err := d.conn(ctx).ExecContext(
+		ctx,
+		`DELETE FROM transport_policies WHERE country = $1 AND transport = $2`,
+		country,
+		transport,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete transport policy: %w", classify(err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read delete result: %w", classify(err))
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("transport policy %s/%s: %w", country, transport, ErrTransportPolicyNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lib/pq"
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/cache"
+)
+
+// DefaultEndpointsPerClient is how many pool endpoints each device is given
+// when a transport does not say
+const DefaultEndpointsPerClient = 2
+
+// DefaultTransportWeight is a transport's weight when it does not set one
+const DefaultTransportWeight = 1
+
+// ErrTransportConfigNotFound is returned when a transport has no row for a region.
+var ErrTransportConfigNotFound = apperr.New(apperr.ErrNotFound, "transport_config_not_found", "transport config not found")
+
+// GetTransportConfigs returns the enabled transports advertised in region,
+// highest priority first. A row for the region replaces the global row of
+// the same type. Results come from the policy cache when one is set and must
+// not be modified.
+func (d *Database) GetTransportConfigs(ctx context.Context, region string) ([]*TransportConfig, error) {
+	var all []*TransportConfig
+	var err error
+	if d.policy != nil {
+		all, err = cache.Load(ctx, d.policy, cache.TableTransports, d.queryTransportConfigs)
+	} else {
+		all, err = d.queryTransportConfigs(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	regional := map[string]bool{}
+	for _, t := range all {
+		if t.Region != "" && t.Region == region {
+			regional[t.Type] = true
+		}
+	}
+	transports := []*TransportConfig{}
+	for _, t := range all {
+		if !t.Enabled {
+			continue
+		}
+		if (t.Region == "" && !regional[t.Type]) || (t.Region != "" && t.Region == region) {
+			transports = append(transports, t)
+		}
+	}
+	return transports, nil
+}
+
+// queryTransportConfigs loads every transport row, enabled or not, so a
+// disabled regional row still hides the global one
+func (d *Database) queryTransportConfigs(ctx context.Context) ([]*TransportConfig, error) {
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT id, type, endpoints, fingerprint, options, region, enabled, priority, updated_at,
+		        endpoint_pool, endpoints_per_client, weight
+		 FROM transports
+		 ORDER BY priority DESC, type, region NULLS FIRST`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transports: %w", classify(err))
+	}
+	defer rows.Close()
+
+	transports := []*TransportConfig{}
+	for rows.Next() {
+		var t TransportConfig
+		var options []byte
+		var region sql.NullString
+		if err := rows.Scan(
+			&t.ID, &t.Type, pq.Array(&t.Endpoints), &t.Fingerprint, &options, &region, &t.Enabled, &t.Priority, &t.UpdatedAt,
+			pq.Array(&t.EndpointPool), &t.EndpointsPerClient, &t.Weight,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan transport: %w", classify(err))
+		}
+		if err := json.Unmarshal(options, &t.Options); err != nil {
+			return nil, fmt.Errorf("failed to decode options of transport %d: %w", t.ID, err)
+		}
+		if t.Endpoints == nil {
+			t.Endpoints = []string{}
+		}
+		if t.EndpointPool == nil {
+			t.EndpointPool = []string{}
+		}
+		t.Region = region.String
+		transports = append(transports, &t)
+	}
+	return transports, rows.Err()
+}
+
+// UpsertTransportConfig stores the transport for t.Type and t.Region,
+// replacing any existing row, and returns the stored row. Callers invalidate
+// cache.TableTransports afterwards.
+func (d *Database) UpsertTransportConfig(ctx context.Context, t *TransportConfig) (*TransportConfig, error) {
+	options := t.Options
+	if options == nil {
+		options = map[string]string{}
+	}
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transport options: %w", err)
+	}
+	endpoints := t.Endpoints
+	if endpoints == nil {
+		endpoints = []string{}
+	}
+	pool := t.EndpointPool
+	if pool == nil {
+		pool = []string{}
+	}
+	perClient := t.EndpointsPerClient
+	if perClient <= 0 {
+		perClient = DefaultEndpointsPerClient
+	}
+	weight := t.Weight
+	if weight <= 0 {
+		weight = DefaultTransportWeight
+	}
+
+	stored := *t
+	stored.Endpoints = endpoints
+	stored.Options = options
+	stored.EndpointPool = pool
+	stored.EndpointsPerClient = perClient
+	stored.Weight = weight
+	err = d.pool.QueryRowContext(
+		ctx,
+		`INSERT INTO transports (type, endpoints, fingerprint, options, region, enabled, priority,
+		                         endpoint_pool, endpoints_per_client, weight)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		 ON CONFLICT (type, COALESCE(region, '')) DO UPDATE
+		 SET endpoints = EXCLUDED.endpoints,
+		     fingerprint = EXCLUDED.fingerprint,
+		     options = EXCLUDED.options,
+		     enabled = EXCLUDED.enabled,
+		     priority = EXCLUDED.priority,
+		     endpoint_pool = EXCLUDED.endpoint_pool,
+		     endpoints_per_client = EXCLUDED.endpoints_per_client,
+		     weight = EXCLUDED.weight,
+		     updated_at = NOW()
+		 RETURNING id, updated_at`,
+		t.Type,
+		pq.Array(endpoints),
+		t.Fingerprint,
+		optionsJSON,
+		sql.NullString{String: t.Region, Valid: t.Region != ""},
+		t.Enabled,
+		t.Priority,
+		pq.Array(pool),
+		perClient,
+		weight,
+	).Scan(&stored.ID, &stored.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert transport: %w", classify(err))
+	}
+	return &stored, nil
+}
+
+// DeleteTransportConfig removes the transport row for transportType in
+// region, or the global row when region is empty.
+func (d *Database) DeleteTransportConfig(ctx context.Context, transportType, region string) error {
+	result, err := d.pool.ExecContext(
+		ctx,
+		`DELETE FROM transports WHERE type = $1 AND COALESCE(region, '') = $2`,
+		transportType,
+		region,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete transport: %w", classify(err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read delete result: %w", classify(err))
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("transport %s/%s: %w", transportType, region, ErrTransportConfigNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestTransportConfigs_RegionOverrides(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping transport tests")
+	}
+	if err := RunMigrations(databaseURL); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	ctx := context.Background()
+	database, err := New(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer database.Close()
+
+	const region = "test-transports-1"
+	upsert := func(transport *TransportConfig) *TransportConfig {
+		t.Helper()
+		stored, err := database.UpsertTransportConfig(ctx, transport)
+		if err != nil {
+			t.Fatalf("UpsertTransportConfig(%s/%s): %v", transport.Type, transport.Region, err)
+		}
+		t.Cleanup(func() { database.DeleteTransportConfig(ctx, transport.Type, transport.Region) })
+		return stored
+	}
+	upsert(&TransportConfig{Type: "test-quic", Endpoints: []string{"a.example"}, Enabled: true, Priority: 1000})
+	upsert(&TransportConfig{Type: "test-tls", Endpoints: []string{"b.example"}, Enabled: true, Priority: 999})
+	upsert(&TransportConfig{
+		Type: "test-quic", Endpoints: []string{"c.example"}, Options: map[string]string{"quic_version": "2"},
+		Region: region, Enabled: true, Priority: 1000,
+	})
+	upsert(&TransportConfig{Type: "test-tls", Region: region, Enabled: false, Priority: 999})
+
+	// Upserting again replaces the row for the same type and region
+	again := upsert(&TransportConfig{Type: "test-tls", Endpoints: []string{"d.example"}, Enabled: true, Priority: 999})
+	if again.ID == 0 || len(again.Endpoints) != 1 || again.Endpoints[0] != "d.example" {
+		t.Errorf("upsert again: got %+v", again)
+	}
+
+	// The region's quic row replaces the global one and its disabled tls row
+	// hides the global tls row
+	regional, err := database.GetTransportConfigs(ctx, region)
+	if err != nil {
+		t.Fatalf("GetTransportConfigs(%s): %v", region, err)
+	}
+	found := map[string]*TransportConfig{}
+	for _, transport := range regional {
+		found[transport.Type] = transport
+	}
+	if quic := found["test-quic"]; quic == nil || quic.Region != region || quic.Options["quic_version"] != "2" {
+		t.Errorf("regional quic: got %+v", quic)
+	}
+	if found["test-tls"] != nil {
+		t.Errorf("disabled regional tls served: %+v", found["test-tls"])
+	}
+
+	global, err := database.GetTransportConfigs(ctx, "test-transports-2")
+	if err != nil {
+		t.Fatalf("GetTransportConfigs: %v", err)
+	}
+	found = map[string]*TransportConfig{}
+	for _, transport := range global {
+		found[transport.Type] = transport
+	}
+	if quic := found["test-quic"]; quic == nil || quic.Region != "" || quic.Endpoints[0] != "a.example" {
+		t.Errorf("global quic: got %+v", quic)
+	}
+	if tls := found["test-tls"]; tls == nil || tls.Endpoints[0] != "d.example" {
+		t.Errorf("global tls: got %+v", tls)
+	}
+
+	if err := database.DeleteTransportConfig(ctx, "test-quic", region); err != nil {
+		t.Fatalf("DeleteTransportConfig: %v", err)
+	}
+	if err := database.DeleteTransportConfig(ctx, "test-quic", region); !errors.Is(err, ErrTransportConfigNotFound) {
+		t.Errorf("DeleteTransportConfig again: got %v, want ErrTransportConfigNotFound", err)
+	}
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// queryer runs statements on the pool or in a transaction
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type auditedTxKey struct{}
+
+// auditedTx is the transaction Audited runs a mutation in
+type auditedTx struct {
+	tx          *sql.Tx
+	afterCommit []func()
+}
+
+func auditedTxFrom(ctx context.Context) *auditedTx {
+	a, _ := ctx.Value(auditedTxKey{}).(*auditedTx)
+	return a
+}
+
+// conn returns the audited transaction ctx carries, or else the pool.
+func (d *Database) conn(ctx context.Context) queryer {
+	if a := auditedTxFrom(ctx); a != nil {
+		return a.tx
+	}
+	return d.pool
+}
+
+// txn is a transaction a method runs in. A joined transaction belongs to
+// Audited, which commits or rolls it back, so Commit and Rollback do nothing.
+type txn struct {
+	*sql.Tx
+	joined bool
+}
+
+func (t txn) Commit() error {
+	if t.joined {
+		return nil
+	}
+	return t.Tx.Commit()
+}
+
+func (t txn) Rollback() error {
+	if t.joined {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
+
+// beginTx starts a transaction, or joins the audited transaction ctx carries.
+func (d *Database) beginTx(ctx context.Context) (txn, error) {
+	if a := auditedTxFrom(ctx); a != nil {
+		return txn{Tx: a.tx, joined: true}, nil
+	}
+	tx, err := d.pool.BeginTx(ctx, nil)
+	return txn{Tx: tx}, err
+}
+
+// AfterCommit runs fn once the audited transaction ctx carries has
+// committed, and never if it is rolled back. Without one, fn runs at once.
+// It defers in-memory changes that must not outlive a rolled back mutation.
+func (d *Database) AfterCommit(ctx context.Context, fn func()) {
+	if a := auditedTxFrom(ctx); a != nil {
+		a.afterCommit = append(a.afterCommit, fn)
+		return
+	}
+	fn()
+}
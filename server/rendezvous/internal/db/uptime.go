@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// StatusChange is one row of a gateway's status history
+type StatusChange struct {
+	GatewayID string
+	Status    string
+	ChangedAt time.Time
+}
+
+// MaintenanceWindow is an approved period during which a gateway's downtime
+// does not count against its uptime
+type MaintenanceWindow struct {
+	ID         string
+	GatewayID  string
+	StartsAt   time.Time
+	EndsAt     time.Time
+	Reason     *string
+	ApprovedBy string
+	CreatedAt  time.Time
+}
+
+// GetStatusHistory returns the status changes of each gateway since since,
+// preceded by the last change before since (the status in effect when the
+// window opens), ordered by gateway and time.
+func (d *Database) GetStatusHistory(ctx context.Context, gatewayIDs []string, since time.Time) ([]StatusChange, error) {
+	if len(gatewayIDs) == 0 {
+		return nil, nil
+	}
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT gateway_id, status, changed_at FROM (
+		     SELECT DISTINCT ON (gateway_id) gateway_id, status, changed_at
+		     FROM gateway_status_history
+		     WHERE gateway_id = ANY($1) AND changed_at < $2
+		     ORDER BY gateway_id, changed_at DESC
+		 ) AS opening
+		 UNION ALL
+		 SELECT gateway_id, status, changed_at
+		 FROM gateway_status_history
+		 WHERE gateway_id = ANY($1) AND changed_at >= $2
+		 ORDER BY gateway_id, changed_at`,
+		pq.Array(gatewayIDs),
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query status history: %w", classify(err))
+	}
+	defer rows.Close()
+
+	changes := []StatusChange{}
+	for rows.Next() {
+		var c StatusChange
+		if err := rows.Scan(&c.GatewayID, &c.Status, &c.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan status change: %w", classify(err))
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// GetMaintenanceWindows returns the approved maintenance windows of each
+// gateway that overlap [since, until), ordered by gateway and start.
+func (d *Database) GetMaintenanceWindows(ctx context.Context, gatewayIDs []string, since, until time.Time) ([]MaintenanceWindow, error) {
+	if len(gatewayIDs) == 0 {
+		return nil, nil
+	}
+	rows, err := d.pool.QueryContext(
+		ctx,
+		`SELECT id, gateway_id, starts_at, ends_at, reason, approved_by, created_at
+		 FROM gateway_maintenance_windows
+		 WHERE gateway_id = ANY($1) AND ends_at > $2 AND starts_at < $3
+		 ORDER BY gateway_id, starts_at`,
+		pq.Array(gatewayIDs),
+		since,
+		until,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query maintenance windows: %w", classify(err))
+	}
+	defer rows.Close()
+
+	windows := []MaintenanceWindow{}
+	for rows.Next() {
+		var w MaintenanceWindow
+		if err := rows.Scan(&w.ID, &w.GatewayID, &w.StartsAt, &w.EndsAt, &w.Reason, &w.ApprovedBy, &w.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan maintenance window: %w", classify(err))
+		}
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
+
+// CreateMaintenanceWindow records an approved maintenance window for a gateway.
+func (d *Database) CreateMaintenanceWindow(
+	ctx context.Context,
+	gatewayID string,
+	startsAt, endsAt time.Time,
+	reason *string,
+	approvedBy string,
+) (*MaintenanceWindow, error) {
+	w := MaintenanceWindow{
+		GatewayID:  gatewayID,
+		StartsAt:   startsAt,
+		EndsAt:     endsAt,
+		Reason:     reason,
+		ApprovedBy: approvedBy,
+	}
+	err := d.conn(ctx).QueryRowContext(
+		ctx,
+		`INSERT INTO gateway_maintenance_windows (gateway_id, starts_at, ends_at, reason, approved_by)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING id, created_at`,
+		gatewayID,
+		startsAt,
+		endsAt,
+		reason,
+		approvedBy,
+	).Scan(&w.ID, &w.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create maintenance window: %w", classify(err))
+	}
+	return &w, nil
+}
@@ -0,0 +1,257 @@
+package e2e
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"rendezvous/internal/api"
+	"rendezvous/internal/attestation"
+	"rendezvous/internal/config"
+	"rendezvous/internal/gateway"
+)
+
+// Device verdicts a client's Play Integrity token can carry
+const (
+	VerdictStrong = "MEETS_STRONG_INTEGRITY"
+	VerdictBasic  = "MEETS_BASIC_INTEGRITY"
+)
+
+// Client is an app install asking for config from one address
+type Client struct {
+	h        *Harness
+	DeviceID string
+	IP       string
+	Verdict  string // Device verdict of its attestations; empty sends none
+
+	session string // Attestation session from Attest, sent with reports
+
+	// PackVersions are the pack formats the client supports; nil is a
+	// client that predates negotiation and gets 1.0
+	PackVersions []string
+}
+
+// NewClient creates a client with a fresh device ID and address whose
+// attestations carry verdict
+func (h *Harness) NewClient(verdict string) *Client {
+	return &Client{h: h, DeviceID: "device-" + randomHex(h.t, 8), IP: h.NewIP(), Verdict: verdict}
+}
+
+// FetchConfig requests a config pack and verifies it against the pinned
+// key. The pack is nil unless the status is 200.
+func (c *Client) FetchConfig() (*config.SignedConfigPack, int) {
+	c.h.t.Helper()
+	req := api.GetConfigRequest{
+		DeviceID:              c.DeviceID,
+		Platform:              "android",
+		Region:                c.h.Region,
+		SupportedPackVersions: c.PackVersions,
+	}
+	if c.Verdict != "" {
+		req.Attestation = IntegrityToken(c.Verdict, attestation.ChallengeHash(c.challenge()))
+	}
+	var resp api.GetConfigResponse
+	status := c.h.post("/api/v1/config", c.IP, req, nil, &resp)
+	if status != http.StatusOK {
+		return nil, status
+	}
+	if resp.ConfigPack == nil || !config.VerifyPack(resp.ConfigPack, c.h.PackKey) {
+		c.h.t.Fatalf("device %s: config pack does not verify against the pinned key", c.DeviceID)
+	}
+	return resp.ConfigPack, status
+}
+
+// challenge fetches a challenge bound to the client's device, which its
+// next integrity token carries the hash of
+func (c *Client) challenge() string {
+	c.h.t.Helper()
+	var resp struct {
+		Challenge string `json:"challenge"`
+	}
+	path := "/api/v1/attest/challenge?device_id=" + url.QueryEscape(c.DeviceID)
+	if status := c.h.get(path, c.IP, &resp); status != http.StatusOK {
+		c.h.t.Fatalf("device %s: challenge request status %d", c.DeviceID, status)
+	}
+	return resp.Challenge
+}
+
+// Attest verifies an integrity token with /attest and keeps the session it
+// returns, which ties the client's discovery reports to its device
+func (c *Client) Attest() {
+	c.h.t.Helper()
+	req := api.VerifyAttestationRequest{
+		Platform: "android",
+		Token:    IntegrityToken(c.Verdict, attestation.ChallengeHash(c.challenge())),
+		DeviceID: c.DeviceID,
+		Region:   c.h.Region,
+	}
+	var resp api.VerifyAttestationResponse
+	if status := c.h.post("/api/v1/attest", c.IP, req, nil, &resp); status != http.StatusOK || !resp.Verified {
+		c.h.t.Fatalf("device %s: attestation status %d, verified %v: %s", c.DeviceID, status, resp.Verified, resp.Reason)
+	}
+	c.session = resp.SessionToken
+}
+
+// Gateways fetches a config pack and returns the IDs of the gateways it
+// lists, failing the test unless the request succeeds
+func (c *Client) Gateways() []string {
+	c.h.t.Helper()
+	pack, status := c.FetchConfig()
+	if status != http.StatusOK {
+		c.h.t.Fatalf("device %s: config request status %d", c.DeviceID, status)
+	}
+	ids := make([]string, len(pack.Gateways))
+	for i, gw := range pack.Gateways {
+		ids[i] = gw.ID
+	}
+	return ids
+}
+
+// ReportConnection logs a discovery attempt against a gateway, as clients do
+// after trying it. Only reports from a client that attested count toward its
+// device's trust.
+func (c *Client) ReportConnection(gatewayID string, success bool) {
+	c.h.t.Helper()
+	req := api.DiscoveryLogRequest{
+		ChannelType: "social",
+		GatewayID:   gatewayID,
+		DeviceID:    c.DeviceID,
+		Success:     success,
+
+		AttestationSession: c.session,
+	}
+	if status := c.h.post("/api/v1/discovery/log", c.IP, req, nil, nil); status != http.StatusOK {
+		c.h.t.Fatalf("device %s: discovery log status %d", c.DeviceID, status)
+	}
+}
+
+// Scraper is an adversary collecting gateway addresses without attesting.
+// It counts what it learned across every identity it used.
+type Scraper struct {
+	h         *Harness
+	IP        string          // Address used unless rotating
+	Learned   map[string]bool // Gateway IDs seen in any pack
+	Requests  int
+	Throttled int // Requests answered 429
+}
+
+// NewScraper creates a scraper with one address of its own
+func (h *Harness) NewScraper() *Scraper {
+	return &Scraper{h: h, IP: h.NewIP(), Learned: map[string]bool{}}
+}
+
+// Scrape sends n config requests, each from a new device ID. When rotate is
+// set each also comes from a new address, as from a pool of proxies.
+func (s *Scraper) Scrape(n int, rotate bool) {
+	s.h.t.Helper()
+	for i := 0; i < n; i++ {
+		client := s.h.NewClient("")
+		if !rotate {
+			client.IP = s.IP
+		}
+		pack, status := client.FetchConfig()
+		s.Requests++
+		switch status {
+		case http.StatusOK:
+			for _, gw := range pack.Gateways {
+				s.Learned[gw.ID] = true
+			}
+		case http.StatusTooManyRequests:
+			s.Throttled++
+		default:
+			s.h.t.Fatalf("scraper: config request status %d", status)
+		}
+	}
+}
+
+// LearnedReal returns how many of the learned gateways are not honeypots
+func (s *Scraper) LearnedReal() int {
+	n := 0
+	for id := range s.Learned {
+		if !s.h.IsHoneypot(id) {
+			n++
+		}
+	}
+	return n
+}
+
+// GatewayAgent is a volunteer gateway: it registers its key and reports its
+// status with signed heartbeats
+type GatewayAgent struct {
+	h          *Harness
+	ID         string
+	privateKey ed25519.PrivateKey
+	sequence   int64
+}
+
+// StartGateway registers a gateway under its own operator and subnet, so
+// no quota holds it for review, and reports it active with users connected
+func (h *Harness) StartGateway(users int) *GatewayAgent {
+	h.t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	subnet := make([]byte, 2)
+	if _, err := rand.Read(subnet); err != nil {
+		h.t.Fatal(err)
+	}
+	operatorID := "e2e-operator-" + randomHex(h.t, 8)
+	maxUsers := 100
+	timestamp := h.Clock.Now().Unix()
+	req := api.GatewayRegistrationRequest{
+		OperatorID:     operatorID,
+		PublicKey:      publicKey,
+		IPAddress:      fmt.Sprintf("10.%d.%d.1", subnet[0], subnet[1]),
+		Port:           443,
+		TransportTypes: []string{"masque"},
+		Region:         h.Region,
+		MaxUsers:       &maxUsers,
+		KeyProof: &api.GatewayConfirmation{
+			Timestamp: timestamp,
+			Signature: ed25519.Sign(privateKey, gateway.RegistrationMessage(operatorID, publicKey, timestamp)),
+		},
+	}
+	header := http.Header{}
+	header.Set("X-Operator-Token", h.OperatorCredential(operatorID))
+	var resp api.GatewayRegistrationResponse
+	if status := h.post("/api/v1/gateway/register", h.NewIP(), req, header, &resp); status != http.StatusCreated {
+		h.t.Fatalf("gateway registration: status %d, approval %q", status, resp.ApprovalStatus)
+	}
+
+	agent := &GatewayAgent{h: h, ID: resp.GatewayID, privateKey: privateKey}
+	agent.Heartbeat("active", users)
+	return agent
+}
+
+// Heartbeat reports the gateway's status and connected users
+func (g *GatewayAgent) Heartbeat(status string, users int) {
+	g.h.t.Helper()
+	g.sequence++
+	reportedAt := g.h.Clock.Now()
+	body, err := json.Marshal(api.GatewayStatusRequest{
+		GatewayID:      g.ID,
+		Status:         status,
+		UsersConnected: users,
+		UptimePercent:  100,
+		ReportedAt:     &reportedAt,
+		Sequence:       &g.sequence,
+	})
+	if err != nil {
+		g.h.t.Fatal(err)
+	}
+	const path = "/api/v1/gateway/status"
+	timestamp := reportedAt.Unix()
+	signature := ed25519.Sign(g.privateKey, gateway.RequestBodyMessage(g.ID, path, timestamp, body))
+	header := http.Header{}
+	header.Set("X-Gateway-Timestamp", strconv.FormatInt(timestamp, 10))
+	header.Set("X-Gateway-Signature", base64.StdEncoding.EncodeToString(signature))
+	if code := g.h.post(path, g.h.NewIP(), json.RawMessage(body), header, nil); code != http.StatusOK {
+		g.h.t.Fatalf("gateway %s heartbeat: status %d", g.ID, code)
+	}
+}
@@ -0,0 +1,307 @@
+// Package e2e runs end-to-end scenarios against the full router: real
+// handlers, config service and database, the in-memory store and a fake
+// clock, with Play Integrity verdicts decided by the scenario instead of
+// Google. Actors (clients, scrapers and gateway agents) talk to it over HTTP
+// exactly as deployed clients do, so a scenario checks what each of them can
+// learn rather than what a single handler returns.
+//
+// With TEST_DATABASE_URL set the harness runs against that Postgres
+// database, migrating it first; each harness works in its own region, so
+// scenarios can share it. Without it the harness runs against an in-memory
+// stand-in that answers the statements the scenarios make.
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/playintegrity/v1"
+
+	"rendezvous/internal/admission"
+	"rendezvous/internal/api"
+	"rendezvous/internal/attestation"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+	"rendezvous/internal/geo"
+	"rendezvous/internal/server"
+	"rendezvous/internal/store"
+	"rendezvous/internal/trust"
+)
+
+// GatewayCacheWindow is how long a region's gateway candidates are reused,
+// and so how long a gateway can stay in 1.0 packs after it goes offline
+const GatewayCacheWindow = config.DefaultGatewayCacheTTL
+
+// PackCacheWindow is how long a 2.0 pack base is reused. A base may be built
+// from candidates about to expire, so a gateway can stay in 2.0 packs for
+// GatewayCacheWindow plus PackCacheWindow after it goes offline.
+const PackCacheWindow = config.DefaultPackBaseTTL
+
+// RevealCap is the most gateways a single pack lists
+const RevealCap = 5
+
+// TrustPolicy is the device trust policy scenarios run under: a short
+// probation the fake clock can pass
+var TrustPolicy = trust.Policy{Probation: time.Hour, MinAttestations: 2, MinConnections: 1}
+
+// packageName is the Android package Play Integrity verdicts are issued for
+const packageName = "org.lumenlink.e2e"
+
+// adminToken authorizes the harness on admin routes
+const adminToken = "e2e-admin-token"
+
+// Harness is one rendezvous deployment under test
+type Harness struct {
+	t       testing.TB
+	Clock   *clock.Fake
+	Region  string            // Every gateway and client of the harness is in this region
+	PackKey ed25519.PublicKey // The key clients pin to verify packs
+
+	router   *gin.Engine
+	database *db.Database
+
+	mu        sync.Mutex
+	nextIP    int
+	honeypots map[string]bool
+}
+
+// New boots the router against the database in TEST_DATABASE_URL, or
+// against an in-memory stand-in when it is not set. Gateways registered in
+// the harness's region are deleted when t ends.
+func New(t testing.TB) *Harness {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LUMENLINK_CONFIG_SIGNING_PRIVATE_KEY", base64.StdEncoding.EncodeToString(privateKey))
+	t.Setenv("LUMENLINK_CONFIG_SIGNING_PUBLIC_KEY", base64.StdEncoding.EncodeToString(publicKey))
+	t.Setenv("LUMENLINK_PACK_BASE_TTL", PackCacheWindow.String())
+	t.Setenv("LUMENLINK_PACK_GATEWAY_CACHE_TTL", GatewayCacheWindow.String())
+	t.Setenv("LUMENLINK_ADMIN_TOKEN", adminToken)
+	t.Setenv("LUMENLINK_ALLOW_ATTESTATION_BYPASS", "false")
+	t.Setenv("PLAY_INTEGRITY_PACKAGE_NAME", packageName)
+	t.Setenv("PLAY_INTEGRITY_ALLOW_BASIC", "false")
+	t.Setenv("PLAY_INTEGRITY_REQUIRE_REQUEST_HASH", "true")
+
+	h := &Harness{
+		t:         t,
+		Clock:     clock.NewFake(time.Now()),
+		Region:    "e2e-" + randomHex(t, 3),
+		PackKey:   publicKey,
+		honeypots: map[string]bool{},
+	}
+	database := h.openDatabase()
+	h.database = database
+
+	memory := store.NewMemory()
+	memory.SetClock(h.Clock)
+	stores := memory.Stores()
+
+	configService, err := config.NewConfigService(database)
+	if err != nil {
+		t.Fatalf("NewConfigService: %v", err)
+	}
+	configService.SetClock(h.Clock)
+	attestationService := attestation.NewAttestationService(database)
+	attestationService.SetClock(h.Clock)
+	attestationService.SetChallenges(stores.Challenges)
+	attestationService.SetChallengeRates(stores.RateLimits)
+	attestationService.SetVerificationRates(stores.RateLimits)
+	attestationService.SetPlayIntegrityDecoder(verdictDecoder{clock: h.Clock})
+
+	handler := api.NewHandler(configService, attestationService, geo.NewBalancer(database), database)
+	handler.SetClock(h.Clock)
+	handler.SetAdmission(admission.NewController(stores.Assignments, stores.Reservations, admission.LoadConfigFromEnv()))
+	tracker := trust.NewTracker(database, TrustPolicy)
+	tracker.SetClock(h.Clock)
+	handler.SetTrust(tracker)
+
+	gin.SetMode(gin.TestMode)
+	h.router = server.NewRouter(handler, stores.RateLimits)
+	return h
+}
+
+// openDatabase connects to TEST_DATABASE_URL, migrating it, or opens an
+// in-memory stand-in on the harness clock. Either is closed when t ends.
+func (h *Harness) openDatabase() *db.Database {
+	t := h.t
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		pool, memory := openMemoryDatabase(newMemoryTables(h.Clock))
+		database := db.NewFromPool(pool)
+		database.SetClock(h.Clock)
+		t.Cleanup(func() {
+			for _, statement := range memory.Unsupported() {
+				t.Errorf("in-memory database does not support: %s", statement)
+			}
+			database.Close()
+		})
+		return database
+	}
+
+	if err := db.RunMigrations(databaseURL); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	database, err := db.New(context.Background(), databaseURL)
+	if err != nil {
+		t.Fatalf("db.New: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := database.Pool().ExecContext(context.Background(), `DELETE FROM gateways WHERE region = $1`, h.Region); err != nil {
+			t.Errorf("failed to delete scenario gateways: %v", err)
+		}
+		database.Close()
+	})
+	return database
+}
+
+// Advance moves the harness clock forward
+func (h *Harness) Advance(d time.Duration) {
+	h.Clock.Advance(d)
+}
+
+// NewIP returns a client address no other actor of the harness uses
+func (h *Harness) NewIP() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextIP++
+	return fmt.Sprintf("198.18.%d.%d", h.nextIP/250, h.nextIP%250+1)
+}
+
+// MarkHoneypot turns a registered gateway into a honeypot. Operators cannot
+// register honeypots, so this goes to the database directly.
+func (h *Harness) MarkHoneypot(gatewayID string) {
+	h.t.Helper()
+	if _, err := h.database.Pool().ExecContext(context.Background(),
+		`UPDATE gateways SET is_honeypot = TRUE WHERE id = $1`, gatewayID); err != nil {
+		h.t.Fatalf("failed to mark honeypot: %v", err)
+	}
+	h.mu.Lock()
+	h.honeypots[gatewayID] = true
+	h.mu.Unlock()
+}
+
+// IsHoneypot reports whether gatewayID was marked a honeypot
+func (h *Harness) IsHoneypot(gatewayID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.honeypots[gatewayID]
+}
+
+// DeviceTier returns a device's trust tier as the admin API reports it
+func (h *Harness) DeviceTier(deviceID string) string {
+	h.t.Helper()
+	var device api.AdminDeviceResponse
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/devices/"+deviceID, nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	if status := h.serve(req, "127.0.0.1", &device); status != http.StatusOK {
+		h.t.Fatalf("GET admin device %s: status %d", deviceID, status)
+	}
+	return device.Tier
+}
+
+// OperatorCredential issues operatorID a credential through the admin API
+func (h *Harness) OperatorCredential(operatorID string) string {
+	h.t.Helper()
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+adminToken)
+	var credential api.OperatorCredentialResponse
+	status := h.post("/api/v1/admin/operator-credentials", "127.0.0.1",
+		api.OperatorCredentialRequest{OperatorID: operatorID}, header, &credential)
+	if status != http.StatusCreated {
+		h.t.Fatalf("operator credential: status %d", status)
+	}
+	return credential.Token
+}
+
+// get sends a GET from ip and decodes the response into out, returning the
+// status
+func (h *Harness) get(path, ip string, out interface{}) int {
+	h.t.Helper()
+	return h.serve(httptest.NewRequest(http.MethodGet, path, nil), ip, out)
+}
+
+// post sends body as JSON from ip and decodes the response into out,
+// returning the status
+func (h *Harness) post(path, ip string, body interface{}, header http.Header, out interface{}) int {
+	h.t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		h.t.Fatalf("failed to encode %s request: %v", path, err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	return h.serve(req, ip, out)
+}
+
+// serve runs req through the router as if sent from ip
+func (h *Harness) serve(req *http.Request, ip string, out interface{}) int {
+	h.t.Helper()
+	req.Header.Set("X-Forwarded-For", ip)
+	w := httptest.NewRecorder()
+	h.router.ServeHTTP(w, req)
+	if out != nil && w.Code < http.StatusBadRequest {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			h.t.Fatalf("failed to decode %s response: %v", req.URL.Path, err)
+		}
+	}
+	return w.Code
+}
+
+// IntegrityToken returns a Play Integrity token the harness decodes to the
+// given device verdict, e.g. MEETS_STRONG_INTEGRITY, and request hash
+func IntegrityToken(verdict, requestHash string) string {
+	return verdict + ":" + requestHash
+}
+
+// verdictDecoder stands in for the Play Integrity API: a token carries its
+// device verdict and request hash and is otherwise a recognized, licensed
+// install
+type verdictDecoder struct {
+	clock clock.Clock
+}
+
+func (d verdictDecoder) DecodeIntegrityToken(_ context.Context, packageName, token string) (*playintegrity.TokenPayloadExternal, error) {
+	verdict, requestHash, ok := strings.Cut(token, ":")
+	if !ok {
+		return nil, fmt.Errorf("malformed integrity token %q", token)
+	}
+	return &playintegrity.TokenPayloadExternal{
+		RequestDetails: &playintegrity.RequestDetails{
+			RequestPackageName: packageName,
+			RequestHash:        requestHash,
+			TimestampMillis:    d.clock.Now().UnixMilli(),
+		},
+		AppIntegrity:    &playintegrity.AppIntegrity{AppRecognitionVerdict: "PLAY_RECOGNIZED"},
+		AccountDetails:  &playintegrity.AccountDetails{AppLicensingVerdict: "LICENSED"},
+		DeviceIntegrity: &playintegrity.DeviceIntegrity{DeviceRecognitionVerdict: []string{verdict}},
+	}, nil
+}
+
+func randomHex(t testing.TB, n int) string {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
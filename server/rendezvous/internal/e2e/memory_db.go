@@ -0,0 +1,163 @@
+package e2e
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// memoryDatabase stands in for Postgres when no TEST_DATABASE_URL is set.
+// It answers the statements the scenarios' requests make, matched by their
+// text, from tables kept in memory; any other statement fails with an error
+// naming it and is reported when the test ends, so a scenario that reaches
+// new SQL shows what the stand-in needs to learn.
+type memoryDatabase struct {
+	mu          sync.Mutex
+	tables      *memoryTables
+	unsupported []string
+}
+
+// memoryStatement answers the statements whose text contains match
+type memoryStatement struct {
+	match string
+	// query returns the result columns and rows; exec the rows affected.
+	// Either may be nil when the statement is only used the other way.
+	query func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error)
+	exec  func(t *memoryTables, args []driver.Value) (int64, error)
+}
+
+// openMemoryDatabase returns a connection pool backed by a new, empty
+// memoryDatabase
+func openMemoryDatabase(tables *memoryTables) (*sql.DB, *memoryDatabase) {
+	m := &memoryDatabase{tables: tables}
+	return sql.OpenDB(memoryConnector{m}), m
+}
+
+// Unsupported returns the statements that were not recognised
+func (m *memoryDatabase) Unsupported() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.unsupported...)
+}
+
+// statement finds how to answer query
+func (m *memoryDatabase) statement(query string) (*memoryStatement, error) {
+	normalized := strings.Join(strings.Fields(query), " ")
+	for i := range memoryStatements {
+		if strings.Contains(normalized, memoryStatements[i].match) {
+			return &memoryStatements[i], nil
+		}
+	}
+	m.unsupported = append(m.unsupported, normalized)
+	return nil, fmt.Errorf("e2e memory database: unsupported statement: %s", normalized)
+}
+
+func (m *memoryDatabase) query(query string, args []driver.NamedValue) (driver.Rows, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stmt, err := m.statement(query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.query == nil {
+		if _, err := stmt.exec(m.tables, values(args)); err != nil {
+			return nil, err
+		}
+		return &memoryRows{}, nil
+	}
+	columns, rows, err := stmt.query(m.tables, values(args))
+	if err != nil {
+		return nil, err
+	}
+	return &memoryRows{columns: columns, rows: rows}, nil
+}
+
+func (m *memoryDatabase) exec(query string, args []driver.NamedValue) (driver.Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stmt, err := m.statement(query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.exec == nil {
+		_, rows, err := stmt.query(m.tables, values(args))
+		if err != nil {
+			return nil, err
+		}
+		return driver.RowsAffected(len(rows)), nil
+	}
+	n, err := stmt.exec(m.tables, values(args))
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	out := make([]driver.Value, len(args))
+	for i, arg := range args {
+		out[i] = arg.Value
+	}
+	return out
+}
+
+// memoryConnector hands out connections to one memoryDatabase. Statements
+// apply as they run: a transaction's writes are not undone by a rollback,
+// which the scenarios do not depend on.
+type memoryConnector struct {
+	m *memoryDatabase
+}
+
+func (c memoryConnector) Connect(context.Context) (driver.Conn, error) { return memoryConn(c), nil }
+func (c memoryConnector) Driver() driver.Driver                        { return memoryDriver{} }
+
+type memoryDriver struct{}
+
+func (memoryDriver) Open(string) (driver.Conn, error) {
+	return nil, fmt.Errorf("e2e memory database: open through its connector")
+}
+
+type memoryConn struct {
+	m *memoryDatabase
+}
+
+func (c memoryConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("e2e memory database: prepared statements are not supported")
+}
+func (c memoryConn) Close() error              { return nil }
+func (c memoryConn) Begin() (driver.Tx, error) { return memoryTx{}, nil }
+func (c memoryConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return memoryTx{}, nil
+}
+func (c memoryConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.m.query(query, args)
+}
+func (c memoryConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.m.exec(query, args)
+}
+
+type memoryTx struct{}
+
+func (memoryTx) Commit() error   { return nil }
+func (memoryTx) Rollback() error { return nil }
+
+type memoryRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *memoryRows) Columns() []string { return r.columns }
+func (r *memoryRows) Close() error      { return nil }
+func (r *memoryRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,569 @@
+package e2e
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"rendezvous/internal/clock"
+)
+
+// memoryTables are the rows of the in-memory database
+type memoryTables struct {
+	clock  clock.Clock
+	nextID int
+
+	operatorCredentials map[string]*memoryOperatorCredential // By token hash
+	gateways            map[string]*memoryGateway            // By ID
+	statusSequences     map[string]map[int64]bool            // By gateway ID
+	attestations        []*memoryAttestation                 // Oldest first
+	deviceTrust         map[string]*memoryDeviceTrust        // By device ID
+	discoveryEvents     map[string]time.Time                 // When each event ID was claimed
+	auditHead           struct {
+		seq  int64
+		hash string
+	}
+}
+
+type memoryOperatorCredential struct {
+	id, operatorID, createdBy string
+	createdAt                 time.Time
+}
+
+// memoryGateway is a row of gateways, in the order of gatewayColumns
+type memoryGateway struct {
+	id             string
+	publicKey      []byte
+	ipAddress      string
+	port           int64
+	transportTypes []string
+	channels       []string
+	region         string
+	bandwidthMbps  int64
+	currentUsers   int64
+	maxUsers       int64
+	status         string
+	isHoneypot     bool
+	operatorID     string
+	approvalStatus string
+	asn            int64
+	createdAt      time.Time
+	lastSeen       time.Time
+	updatedAt      time.Time
+}
+
+// memoryAttestation is a row of attestations
+type memoryAttestation struct {
+	deviceID, platform, integrity, clientIP string
+	verified, downgraded                    bool
+	verifiedAt                              time.Time
+}
+
+// memoryDeviceTrust is a row of device_trust, in the order of
+// db.deviceTrustColumns
+type memoryDeviceTrust struct {
+	deviceID              string
+	tier                  string
+	firstSeenAt           time.Time
+	probationStartedAt    time.Time
+	validAttestations     int64
+	successfulConnections int64
+	tierChangedAt         driver.Value
+	lastAnomaly           driver.Value
+	lastAnomalyAt         driver.Value
+}
+
+var memoryDeviceTrustColumns = []string{
+	"device_id", "tier", "first_seen_at", "probation_started_at", "valid_attestations",
+	"successful_connections", "tier_changed_at", "last_anomaly", "last_anomaly_at",
+}
+
+func (d *memoryDeviceTrust) row() []driver.Value {
+	return []driver.Value{
+		d.deviceID, d.tier, d.firstSeenAt, d.probationStartedAt, d.validAttestations,
+		d.successfulConnections, d.tierChangedAt, d.lastAnomaly, d.lastAnomalyAt,
+	}
+}
+
+// device returns a device's trust row, creating it as limited and on
+// probation from now if it is new
+func (t *memoryTables) device(deviceID string) *memoryDeviceTrust {
+	d, ok := t.deviceTrust[deviceID]
+	if !ok {
+		now := t.clock.Now()
+		d = &memoryDeviceTrust{deviceID: deviceID, tier: "limited", firstSeenAt: now, probationStartedAt: now}
+		t.deviceTrust[deviceID] = d
+	}
+	return d
+}
+
+// recentAttestations returns the last n attestations for which keep is
+// true, newest first
+func (t *memoryTables) recentAttestations(keep func(*memoryAttestation) bool, n int64) []*memoryAttestation {
+	var recent []*memoryAttestation
+	for i := len(t.attestations) - 1; i >= 0 && int64(len(recent)) < n; i-- {
+		if keep(t.attestations[i]) {
+			recent = append(recent, t.attestations[i])
+		}
+	}
+	return recent
+}
+
+// memoryGatewayColumns are the columns of db.gatewayColumns
+var memoryGatewayColumns = []string{
+	"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+	"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+	"operator_id", "approval_status", "asn", "created_at", "last_seen", "updated_at",
+}
+
+func (g *memoryGateway) row() []driver.Value {
+	var operatorID driver.Value
+	if g.operatorID != "" {
+		operatorID = g.operatorID
+	}
+	transportTypes, _ := pq.StringArray(g.transportTypes).Value()
+	channels, _ := pq.StringArray(g.channels).Value()
+	return []driver.Value{
+		g.id, g.publicKey, g.ipAddress, g.port, transportTypes, channels,
+		g.region, g.bandwidthMbps, g.currentUsers, g.maxUsers, g.status, g.isHoneypot,
+		operatorID, g.approvalStatus, g.asn, g.createdAt, g.lastSeen, g.updatedAt,
+	}
+}
+
+func newMemoryTables(clk clock.Clock) *memoryTables {
+	return &memoryTables{
+		clock:               clk,
+		operatorCredentials: map[string]*memoryOperatorCredential{},
+		gateways:            map[string]*memoryGateway{},
+		statusSequences:     map[string]map[int64]bool{},
+		deviceTrust:         map[string]*memoryDeviceTrust{},
+		discoveryEvents:     map[string]time.Time{},
+	}
+}
+
+// newID returns a UUID no other row uses
+func (t *memoryTables) newID() string {
+	t.nextID++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", t.nextID)
+}
+
+// gatewayRows returns the gateways for which keep is true, in ID order
+func (t *memoryTables) gatewayRows(keep func(*memoryGateway) bool) [][]driver.Value {
+	ids := make([]string, 0, len(t.gateways))
+	for id, gw := range t.gateways {
+		if keep(gw) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	rows := make([][]driver.Value, len(ids))
+	for i, id := range ids {
+		rows[i] = t.gateways[id].row()
+	}
+	return rows
+}
+
+// sortedGateways returns up to limit gateways for which keep is true, least
+// loaded first
+func (t *memoryTables) sortedGateways(keep func(*memoryGateway) bool, limit int64) [][]driver.Value {
+	var gateways []*memoryGateway
+	for _, gw := range t.gateways {
+		if keep(gw) {
+			gateways = append(gateways, gw)
+		}
+	}
+	sort.Slice(gateways, func(i, j int) bool {
+		if gateways[i].currentUsers != gateways[j].currentUsers {
+			return gateways[i].currentUsers < gateways[j].currentUsers
+		}
+		return gateways[i].id < gateways[j].id
+	})
+	if int64(len(gateways)) > limit {
+		gateways = gateways[:limit]
+	}
+	rows := make([][]driver.Value, len(gateways))
+	for i, gw := range gateways {
+		rows[i] = gw.row()
+	}
+	return rows
+}
+
+// stringArray parses a text[] argument
+func stringArray(value driver.Value) []string {
+	var array pq.StringArray
+	_ = array.Scan(value)
+	return array
+}
+
+// integer reads an integer argument, which may be a NULL
+func integer(value driver.Value) int64 {
+	n, _ := value.(int64)
+	return n
+}
+
+// str reads a text argument, which may be a NULL
+func str(value driver.Value) string {
+	s, _ := value.(string)
+	return s
+}
+
+// none answers a query with no rows
+func none(columns ...string) func(*memoryTables, []driver.Value) ([]string, [][]driver.Value, error) {
+	return func(*memoryTables, []driver.Value) ([]string, [][]driver.Value, error) {
+		return columns, nil, nil
+	}
+}
+
+// ignored accepts a write the scenarios never read back
+func ignored(*memoryTables, []driver.Value) (int64, error) {
+	return 1, nil
+}
+
+// memoryStatements are the statements the in-memory database answers, by a
+// distinctive part of their text
+var memoryStatements = []memoryStatement{
+	{match: "FROM country_region_overrides", query: none("country", "region")},
+
+	// Operator credentials
+	{
+		match: "INSERT INTO operator_credentials",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			credential := &memoryOperatorCredential{
+				id: t.newID(), operatorID: str(args[1]), createdBy: str(args[2]), createdAt: t.clock.Now(),
+			}
+			t.operatorCredentials[str(args[0])] = credential
+			return []string{"id", "created_at"}, [][]driver.Value{{credential.id, credential.createdAt}}, nil
+		},
+	},
+	{
+		match: "FROM operator_credentials WHERE token_hash = $1 AND revoked_at IS NULL",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			columns := []string{"id", "operator_id", "created_by", "created_at"}
+			credential, ok := t.operatorCredentials[str(args[0])]
+			if !ok {
+				return columns, nil, nil
+			}
+			return columns, [][]driver.Value{{credential.id, credential.operatorID, credential.createdBy, credential.createdAt}}, nil
+		},
+	},
+
+	// Admin audit log; only the head of the chain is kept
+	{match: "LOCK TABLE admin_audit_log", exec: ignored},
+	{
+		match: "SELECT seq, hash FROM admin_audit_log ORDER BY seq DESC LIMIT 1",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			if t.auditHead.seq == 0 {
+				return []string{"seq", "hash"}, nil, nil
+			}
+			return []string{"seq", "hash"}, [][]driver.Value{{t.auditHead.seq, t.auditHead.hash}}, nil
+		},
+	},
+	{
+		match: "INSERT INTO admin_audit_log",
+		exec: func(t *memoryTables, args []driver.Value) (int64, error) {
+			t.auditHead.seq, t.auditHead.hash = integer(args[0]), str(args[8])
+			return 1, nil
+		},
+	},
+
+	// Gateways
+	{
+		match: "SELECT COUNT(*) FROM gateways WHERE operator_id = $1 AND approval_status <> 'rejected'",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			n := len(t.gatewayRows(func(gw *memoryGateway) bool {
+				return gw.operatorID == str(args[0]) && gw.approvalStatus != "rejected"
+			}))
+			return []string{"count"}, [][]driver.Value{{int64(n)}}, nil
+		},
+	},
+	{
+		match: "SELECT COUNT(*) FROM gateways WHERE ip_address <<= $1::cidr",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			_, subnet, err := net.ParseCIDR(str(args[0]))
+			if err != nil {
+				return nil, nil, err
+			}
+			n := len(t.gatewayRows(func(gw *memoryGateway) bool {
+				return subnet.Contains(net.ParseIP(gw.ipAddress)) && gw.approvalStatus != "rejected" && !gw.isHoneypot
+			}))
+			return []string{"count"}, [][]driver.Value{{int64(n)}}, nil
+		},
+	},
+	{
+		match: "INSERT INTO gateways",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			publicKey := args[0].([]byte)
+			for _, gw := range t.gateways {
+				if string(gw.publicKey) == string(publicKey) {
+					return []string{"id"}, nil, nil // ON CONFLICT DO NOTHING
+				}
+			}
+			now := t.clock.Now()
+			gw := &memoryGateway{
+				id:             t.newID(),
+				publicKey:      append([]byte(nil), publicKey...),
+				ipAddress:      str(args[1]),
+				port:           integer(args[2]),
+				transportTypes: stringArray(args[3]),
+				channels:       stringArray(args[4]),
+				region:         str(args[5]),
+				bandwidthMbps:  integer(args[6]),
+				maxUsers:       integer(args[7]),
+				status:         "offline",
+				operatorID:     str(args[8]),
+				approvalStatus: str(args[9]),
+				asn:            integer(args[10]),
+				createdAt:      now,
+				lastSeen:       now,
+				updatedAt:      now,
+			}
+			t.gateways[gw.id] = gw
+			return []string{"id"}, [][]driver.Value{{gw.id}}, nil
+		},
+	},
+	{
+		match: "SELECT id FROM gateways WHERE public_key = $1",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			for _, gw := range t.gateways {
+				if string(gw.publicKey) == string(args[0].([]byte)) {
+					return []string{"id"}, [][]driver.Value{{gw.id}}, nil
+				}
+			}
+			return []string{"id"}, nil, nil
+		},
+	},
+	{
+		match: "FROM gateways WHERE id = $1",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return memoryGatewayColumns, t.gatewayRows(func(gw *memoryGateway) bool { return gw.id == str(args[0]) }), nil
+		},
+	},
+	{
+		match: "UPDATE gateways SET is_honeypot = TRUE WHERE id = $1",
+		exec: func(t *memoryTables, args []driver.Value) (int64, error) {
+			gw, ok := t.gateways[str(args[0])]
+			if !ok {
+				return 0, nil
+			}
+			gw.isHoneypot = true
+			return 1, nil
+		},
+	},
+	{
+		match: "UPDATE gateways SET status = $1, current_users = $2, last_seen = NOW() WHERE id = $3",
+		exec: func(t *memoryTables, args []driver.Value) (int64, error) {
+			gw, ok := t.gateways[str(args[2])]
+			if !ok {
+				return 0, nil
+			}
+			gw.status, gw.currentUsers, gw.lastSeen = str(args[0]), integer(args[1]), t.clock.Now()
+			return 1, nil
+		},
+	},
+	{match: "DELETE FROM operator_metrics_sequences", exec: ignored},
+	{
+		match: "INSERT INTO operator_metrics_sequences",
+		exec: func(t *memoryTables, args []driver.Value) (int64, error) {
+			id, sequence := str(args[0]), integer(args[1])
+			if t.statusSequences[id] == nil {
+				t.statusSequences[id] = map[int64]bool{}
+			}
+			if t.statusSequences[id][sequence] {
+				return 0, &pq.Error{Code: "23505"}
+			}
+			t.statusSequences[id][sequence] = true
+			return 1, nil
+		},
+	},
+	{match: "INSERT INTO operator_metrics", exec: ignored},
+	{
+		match: "WHERE region = $1 AND (status = 'active' OR ($2 AND status = 'degraded')) AND is_honeypot = FALSE AND approval_status = 'approved'",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			region, includeDegraded := str(args[0]), args[1].(bool)
+			gateways := t.sortedGateways(func(gw *memoryGateway) bool {
+				return gw.region == region && (gw.status == "active" || includeDegraded && gw.status == "degraded") &&
+					!gw.isHoneypot && gw.approvalStatus == "approved"
+			}, integer(args[2]))
+			return memoryGatewayColumns, gateways, nil
+		},
+	},
+	{
+		match: "WHERE ($1 = '' OR region = $1) AND status = 'active' AND is_honeypot = TRUE",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			region := str(args[0])
+			gateways := t.sortedGateways(func(gw *memoryGateway) bool {
+				return (region == "" || gw.region == region) && gw.status == "active" && gw.isHoneypot
+			}, 10)
+			return memoryGatewayColumns, gateways, nil
+		},
+	},
+
+	// Policy tables the scenarios leave empty
+	{match: "FROM config_revocations", query: none("id", "kind", "value", "reason", "revoked_at")},
+	{match: "FROM transports ORDER BY", query: none("id", "type", "endpoints", "fingerprint", "options", "region", "enabled", "priority", "updated_at", "endpoint_pool", "endpoints_per_client", "weight")},
+	{match: "FROM rendezvous_mirrors", query: none("id", "url", "region", "priority", "enabled", "created_at", "updated_at")},
+	{match: "FROM rollouts ORDER BY", query: none("key", "region", "percentage", "description", "created_at", "updated_at", "schedule_start_at", "schedule_end_at", "schedule_start_percentage", "schedule_end_percentage", "schedule_easing", "aborted_at")},
+	{match: "FROM experiments ORDER BY", query: none("name", "description", "variants", "regions", "platforms", "starts_at", "ends_at", "created_at", "updated_at")},
+	{match: "FROM launch_open_regions", query: none("region")},
+	{match: "FROM discovery_configs", query: none("region", "channels", "scan_interval", "battery_aware", "updated_at")},
+	{match: "SELECT value FROM settings WHERE key = $1", query: none("value")},
+	{
+		match: "SELECT EXISTS (SELECT 1 FROM revoked_devices WHERE device_id = $1)",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			return []string{"exists"}, [][]driver.Value{{false}}, nil
+		},
+	},
+
+	// Attestations
+	{
+		match: "INSERT INTO attestations",
+		exec: func(t *memoryTables, args []driver.Value) (int64, error) {
+			verifiedAt, _ := args[4].(time.Time)
+			t.attestations = append(t.attestations, &memoryAttestation{
+				deviceID:   str(args[0]),
+				platform:   str(args[1]),
+				verified:   args[3].(bool),
+				verifiedAt: verifiedAt,
+				integrity:  str(args[5]),
+				clientIP:   str(args[10]),
+				downgraded: args[12].(bool),
+			})
+			return 1, nil
+		},
+	},
+	{
+		match: "SELECT device_integrity FROM attestations WHERE device_id = $1 AND platform = $2 AND verified AND NOT downgraded",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			var latest *memoryAttestation
+			for _, a := range t.attestations {
+				if a.deviceID == str(args[0]) && a.platform == str(args[1]) && a.verified && !a.downgraded &&
+					(latest == nil || !a.verifiedAt.Before(latest.verifiedAt)) {
+					latest = a
+				}
+			}
+			if latest == nil {
+				return []string{"device_integrity"}, nil, nil
+			}
+			return []string{"device_integrity"}, [][]driver.Value{{latest.integrity}}, nil
+		},
+	},
+	{
+		match: "SELECT verified FROM attestations WHERE device_id = $1 AND client_ip = $2",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			failures := 0
+			for _, a := range t.recentAttestations(func(a *memoryAttestation) bool {
+				return a.deviceID == str(args[0]) && a.clientIP == str(args[1])
+			}, integer(args[2])) {
+				if !a.verified {
+					failures++
+				}
+			}
+			return []string{"count"}, [][]driver.Value{{int64(failures)}}, nil
+		},
+	},
+	{
+		match: "SELECT verified FROM attestations WHERE device_id = $1 ORDER BY",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			recent := t.recentAttestations(func(a *memoryAttestation) bool { return a.deviceID == str(args[0]) }, integer(args[1]))
+			failures := 0
+			for _, a := range recent {
+				if !a.verified {
+					failures++
+				}
+			}
+			return []string{"failures", "count"}, [][]driver.Value{{int64(failures), int64(len(recent))}}, nil
+		},
+	},
+
+	// Device trust
+	{
+		match: "FROM device_trust WHERE device_id = $1 FOR UPDATE",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			d, ok := t.deviceTrust[str(args[0])]
+			if !ok {
+				return []string{"tier"}, nil, nil
+			}
+			return []string{"tier"}, [][]driver.Value{{d.tier}}, nil
+		},
+	},
+	{
+		match: "FROM device_trust WHERE device_id = $1",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			d, ok := t.deviceTrust[str(args[0])]
+			if !ok {
+				return memoryDeviceTrustColumns, nil, nil
+			}
+			return memoryDeviceTrustColumns, [][]driver.Value{d.row()}, nil
+		},
+	},
+	{
+		match: "INSERT INTO device_trust (device_id, valid_attestations)",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			d := t.device(str(args[0]))
+			d.validAttestations++
+			return memoryDeviceTrustColumns, [][]driver.Value{d.row()}, nil
+		},
+	},
+	{
+		match: "INSERT INTO device_trust (device_id, successful_connections)",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			d := t.device(str(args[0]))
+			d.successfulConnections++
+			return memoryDeviceTrustColumns, [][]driver.Value{d.row()}, nil
+		},
+	},
+	{
+		match: "UPDATE device_trust SET tier = 'trusted'",
+		exec: func(t *memoryTables, args []driver.Value) (int64, error) {
+			d, ok := t.deviceTrust[str(args[0])]
+			if !ok || d.tier != "limited" {
+				return 0, nil
+			}
+			d.tier, d.tierChangedAt = "trusted", t.clock.Now()
+			return 1, nil
+		},
+	},
+	{
+		match: "INSERT INTO device_trust (device_id, last_anomaly, last_anomaly_at)",
+		exec: func(t *memoryTables, args []driver.Value) (int64, error) {
+			_, existed := t.deviceTrust[str(args[0])]
+			d := t.device(str(args[0]))
+			now := t.clock.Now()
+			if existed {
+				d.tier, d.probationStartedAt, d.validAttestations, d.successfulConnections = "limited", now, 0, 0
+				if args[2].(bool) {
+					d.tierChangedAt = now
+				}
+			}
+			d.lastAnomaly, d.lastAnomalyAt = str(args[1]), now
+			return 1, nil
+		},
+	},
+
+	// Discovery logs are not kept; only their honeypot flag is read back
+	{
+		match: "INSERT INTO discovery_log_events",
+		exec: func(t *memoryTables, args []driver.Value) (int64, error) {
+			claimed, ok := t.discoveryEvents[str(args[0])]
+			if ok && !claimed.Before(args[1].(time.Time)) {
+				return 0, nil
+			}
+			t.discoveryEvents[str(args[0])] = t.clock.Now()
+			return 1, nil
+		},
+	},
+	{
+		match: "INSERT INTO discovery_logs",
+		query: func(t *memoryTables, args []driver.Value) ([]string, [][]driver.Value, error) {
+			isHoneypot := false
+			if gw, ok := t.gateways[str(args[1])]; ok {
+				isHoneypot = gw.isHoneypot
+			}
+			return []string{"is_honeypot"}, [][]driver.Value{{isHoneypot}}, nil
+		},
+	},
+	{match: "FROM discovery_logs WHERE success AND gateway_id IS NOT NULL AND latency_ms IS NOT NULL", query: none("gateway_id", "count", "p50", "p95")},
+}
@@ -0,0 +1,179 @@
+package e2e
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+)
+
+// startGateways starts n real gateways, the first with the fewest users
+func startGateways(h *Harness, n int) []*GatewayAgent {
+	agents := make([]*GatewayAgent, n)
+	for i := range agents {
+		agents[i] = h.StartGateway(10 + i)
+	}
+	return agents
+}
+
+// startHoneypots starts n honeypots with no users, so load ordering alone
+// would put them first in any pack that may include them
+func startHoneypots(h *Harness, n int) []*GatewayAgent {
+	agents := make([]*GatewayAgent, n)
+	for i := range agents {
+		agents[i] = h.StartGateway(0)
+		h.MarkHoneypot(agents[i].ID)
+	}
+	return agents
+}
+
+func contains(ids []string, id string) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestScenario_AttestedClientLearnsOnlyRealGateways(t *testing.T) {
+	h := New(t)
+	gateways := startGateways(h, 3)
+	startHoneypots(h, 2)
+
+	learned := h.NewClient(VerdictStrong).Gateways()
+	if len(learned) != len(gateways) {
+		t.Fatalf("learned %d gateways, want the %d real ones", len(learned), len(gateways))
+	}
+	for _, agent := range gateways {
+		if !contains(learned, agent.ID) {
+			t.Errorf("real gateway %s missing from the pack", agent.ID)
+		}
+	}
+	for _, id := range learned {
+		if h.IsHoneypot(id) {
+			t.Errorf("attested client was given honeypot %s", id)
+		}
+	}
+}
+
+func TestScenario_WeakClientsAreGivenHoneypots(t *testing.T) {
+	h := New(t)
+	startGateways(h, 3)
+	honeypots := startHoneypots(h, 2)
+
+	for name, client := range map[string]*Client{
+		"basic integrity": h.NewClient(VerdictBasic),
+		"unattested":      h.NewClient(""),
+	} {
+		learned := client.Gateways()
+		for _, honeypot := range honeypots {
+			if !contains(learned, honeypot.ID) {
+				t.Errorf("%s client was not given honeypot %s", name, honeypot.ID)
+			}
+		}
+		if len(learned) > RevealCap {
+			t.Errorf("%s client learned %d gateways, over the cap of %d", name, len(learned), RevealCap)
+		}
+	}
+}
+
+func TestScenario_RotatingScraperLearnsAtMostRevealCap(t *testing.T) {
+	h := New(t)
+	startGateways(h, 12)
+	startHoneypots(h, 2)
+
+	scraper := h.NewScraper()
+	scraper.Scrape(40, true)
+	if scraper.Throttled != 0 {
+		t.Fatalf("rotating scraper throttled %d times; the scenario expects every request served", scraper.Throttled)
+	}
+	if learned := scraper.LearnedReal(); learned > RevealCap {
+		t.Errorf("scraper learned %d real gateways over %d identities, want at most %d", learned, scraper.Requests, RevealCap)
+	}
+}
+
+func TestScenario_ScraperOnOneAddressIsThrottled(t *testing.T) {
+	h := New(t)
+	startGateways(h, 2)
+
+	scraper := h.NewScraper()
+	scraper.Scrape(25, false)
+	const burst = 10 // The API rate limit's burst
+	if scraper.Throttled != scraper.Requests-burst {
+		t.Errorf("throttled %d of %d requests, want all past the burst of %d", scraper.Throttled, scraper.Requests, burst)
+	}
+
+	// Other addresses keep their own allowance
+	if _, status := h.NewClient(VerdictStrong).FetchConfig(); status != http.StatusOK {
+		t.Errorf("client on another address: status %d", status)
+	}
+	// And the scraper's refills with time
+	h.Advance(time.Minute)
+	scraper.Scrape(1, false)
+	if scraper.Throttled != scraper.Requests-burst-1 {
+		t.Errorf("scraper still throttled a minute later")
+	}
+}
+
+func TestScenario_OfflineGatewayLeavesPacksWithinCacheWindow(t *testing.T) {
+	h := New(t)
+	agents := startGateways(h, 2)
+	leaving := agents[0]
+
+	legacy := h.NewClient(VerdictStrong)
+	current := h.NewClient(VerdictStrong)
+	current.PackVersions = []string{config.PackVersion2}
+	if !contains(legacy.Gateways(), leaving.ID) || !contains(current.Gateways(), leaving.ID) {
+		t.Fatalf("gateway %s not listed while active", leaving.ID)
+	}
+
+	leaving.Heartbeat("offline", 0)
+
+	// 1.0 packs are built per request, from candidates reused until the
+	// gateway cache window passes
+	h.Advance(GatewayCacheWindow + time.Second)
+	if contains(legacy.Gateways(), leaving.ID) {
+		t.Errorf("1.0 pack lists gateway %s %s after it went offline", leaving.ID, GatewayCacheWindow+time.Second)
+	}
+	// 2.0 packs may also reuse a signed base until the pack cache window passes
+	h.Advance(PackCacheWindow)
+	learned := current.Gateways()
+	if contains(learned, leaving.ID) {
+		t.Errorf("2.0 pack lists gateway %s %s after it went offline", leaving.ID, GatewayCacheWindow+PackCacheWindow+time.Second)
+	}
+	if !contains(learned, agents[1].ID) {
+		t.Errorf("gateway %s that stayed active is missing", agents[1].ID)
+	}
+}
+
+func TestScenario_HoneypotContactDemotesTrustedDevice(t *testing.T) {
+	h := New(t)
+	gw := startGateways(h, 1)[0]
+	honeypot := startHoneypots(h, 1)[0]
+
+	client := h.NewClient(VerdictStrong)
+	client.Attest()
+	client.Gateways()
+	client.ReportConnection(gw.ID, true)
+	if tier := h.DeviceTier(client.DeviceID); tier != db.DeviceTierLimited {
+		t.Fatalf("new device tier %q, want %q", tier, db.DeviceTierLimited)
+	}
+
+	// Past probation, the next valid attestation promotes it
+	h.Advance(TrustPolicy.Probation + time.Minute) // Margin for the database clock
+	client.Gateways()
+	if tier := h.DeviceTier(client.DeviceID); tier != db.DeviceTierTrusted {
+		t.Fatalf("tier after probation %q, want %q", tier, db.DeviceTierTrusted)
+	}
+
+	// A device that reaches a honeypot had its addresses from elsewhere. Its
+	// first session expired during probation, so it attests again first.
+	client.Attest()
+	client.ReportConnection(honeypot.ID, false)
+	if tier := h.DeviceTier(client.DeviceID); tier != db.DeviceTierLimited {
+		t.Errorf("tier after honeypot contact %q, want %q", tier, db.DeviceTierLimited)
+	}
+}
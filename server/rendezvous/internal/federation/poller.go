@@ -0,0 +1,283 @@
+// Package federation imports gateways from partner rendezvous deployments.
+// Each peer publishes a signed gateway announcement; the poller fetches it,
+// verifies it against the peer's pinned key and reconciles the peer's
+// imported gateways with it.
+package federation
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+// Limits on what an announcement may contain
+const (
+	maxAnnouncementBytes  = 1 << 20
+	maxAnnouncedGateways  = 1000
+	maxPeerGatewayIDLen   = 255
+	maxRegionLen          = 10
+	maxGatewayTransports  = 8
+	maxTransportNameLen   = 32
+	maxAnnouncementFuture = 5 * time.Minute // Clock skew allowed for a peer's timestamp
+)
+
+var (
+	// ErrAnnouncementInvalid is returned for an announcement that does not
+	// verify against the peer's pinned key or is malformed
+	ErrAnnouncementInvalid = errors.New("announcement signature or format invalid")
+	// ErrAnnouncementExpired is returned for an announcement older than the
+	// maximum age, or dated in the future
+	ErrAnnouncementExpired = errors.New("announcement expired")
+)
+
+// Config controls federation
+type Config struct {
+	Import       bool          // Poll peers and include their gateways in packs
+	Publish      bool          // Serve our own announcement to peers
+	Issuer       string        // Our name in announcements
+	PollInterval time.Duration // How often peers are polled
+	MaxAge       time.Duration // Oldest announcement accepted; older imports are left out of packs
+}
+
+// LoadConfigFromEnv reads LUMENLINK_FEDERATION_IMPORT and
+// LUMENLINK_FEDERATION_PUBLISH (default false), LUMENLINK_FEDERATION_ISSUER
+// (default lumenlink), LUMENLINK_FEDERATION_POLL_INTERVAL (default 5m) and
+// LUMENLINK_FEDERATION_MAX_AGE (default 1h).
+func LoadConfigFromEnv() Config {
+	cfg := Config{
+		Import:       os.Getenv("LUMENLINK_FEDERATION_IMPORT") == "true",
+		Publish:      os.Getenv("LUMENLINK_FEDERATION_PUBLISH") == "true",
+		Issuer:       strings.TrimSpace(os.Getenv("LUMENLINK_FEDERATION_ISSUER")),
+		PollInterval: envDuration("LUMENLINK_FEDERATION_POLL_INTERVAL", 5*time.Minute),
+		MaxAge:       envDuration("LUMENLINK_FEDERATION_MAX_AGE", time.Hour),
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = "lumenlink"
+	}
+	return cfg
+}
+
+// Poller imports each enabled peer's announced gateways
+type Poller struct {
+	db     *db.Database
+	signer RequestSigner
+	client *http.Client
+	maxAge time.Duration
+	clock  clock.Clock
+}
+
+// NewPoller creates a poller accepting announcements up to maxAge old. Its
+// requests are signed by signer, so peers can tell us from scrapers.
+func NewPoller(database *db.Database, signer RequestSigner, maxAge time.Duration) *Poller {
+	return &Poller{
+		db:     database,
+		signer: signer,
+		client: &http.Client{Timeout: 10 * time.Second},
+		maxAge: maxAge,
+		clock:  clock.Real{},
+	}
+}
+
+// PollAll polls every enabled peer once. A failing peer is recorded and
+// keeps its imported gateways until its announcements age out.
+func (p *Poller) PollAll(ctx context.Context) error {
+	peers, err := p.db.ListFederationPeers(ctx, true)
+	if err != nil {
+		return err
+	}
+	for _, peer := range peers {
+		imported, err := p.Poll(ctx, peer)
+		switch {
+		case errors.Is(err, db.ErrAnnouncementStale):
+			// The peer has not re-signed since the last poll
+			metrics.FederationPolls.WithLabelValues(peer.Name, "unchanged").Inc()
+		case err != nil:
+			metrics.FederationPolls.WithLabelValues(peer.Name, pollOutcome(err)).Inc()
+			log.Printf("federation poll of %s failed: %v", peer.Name, err)
+			if err := p.db.RecordFederationPollError(ctx, peer.ID, err.Error()); err != nil {
+				log.Printf("federation poll of %s not recorded: %v", peer.Name, err)
+			}
+		default:
+			metrics.FederationPolls.WithLabelValues(peer.Name, "imported").Inc()
+			if imported.Added+imported.Removed > 0 {
+				log.Printf("federation: %s added %d, updated %d, removed %d gateways",
+					peer.Name, imported.Added, imported.Updated, imported.Removed)
+			}
+		}
+	}
+	return nil
+}
+
+// Poll fetches, verifies and imports one peer's announcement
+func (p *Poller) Poll(ctx context.Context, peer *db.FederationPeer) (*db.FederationImport, error) {
+	announcement, err := p.fetch(ctx, peer.AnnouncementURL)
+	if err != nil {
+		return nil, err
+	}
+	gateways, err := p.Verify(announcement, peer.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return p.db.ReconcileFederatedGateways(ctx, peer.ID, time.Unix(announcement.Timestamp, 0), gateways)
+}
+
+// Verify checks an announcement against a peer's pinned key and freshness
+// limits, and returns the gateways to import. Malformed entries and entries
+// the peer marks as honeypots are skipped; a peer's honeypot flags are
+// never trusted.
+func (p *Poller) Verify(announcement *config.GatewayAnnouncement, pinnedKey []byte) ([]db.FederatedGateway, error) {
+	if announcement.Version != config.AnnouncementVersion ||
+		!config.VerifyAnnouncement(announcement, ed25519.PublicKey(pinnedKey)) {
+		return nil, ErrAnnouncementInvalid
+	}
+	issuedAt := time.Unix(announcement.Timestamp, 0)
+	now := p.clock.Now()
+	if now.Sub(issuedAt) > p.maxAge || issuedAt.Sub(now) > maxAnnouncementFuture {
+		return nil, fmt.Errorf("%w: issued %s", ErrAnnouncementExpired, issuedAt.UTC().Format(time.RFC3339))
+	}
+	if len(announcement.Gateways) > maxAnnouncedGateways {
+		return nil, fmt.Errorf("%w: %d gateways, at most %d", ErrAnnouncementInvalid, len(announcement.Gateways), maxAnnouncedGateways)
+	}
+
+	gateways := make([]db.FederatedGateway, 0, len(announcement.Gateways))
+	seen := map[string]bool{}
+	for _, gw := range announcement.Gateways {
+		if gw.IsHoneypot || seen[gw.ID] || !validGateway(gw) {
+			continue
+		}
+		seen[gw.ID] = true
+		load := gw.Load
+		if load < 0 || load > 1 {
+			load = 0.5
+		}
+		gateways = append(gateways, db.FederatedGateway{
+			PeerGatewayID:  gw.ID,
+			PublicKey:      gw.PublicKey,
+			IPAddress:      gw.Address,
+			Port:           gw.Port,
+			TransportTypes: gw.Transports,
+			Region:         gw.Region,
+			Load:           load,
+		})
+	}
+	return gateways, nil
+}
+
+// validGateway reports whether an announced gateway can be stored and
+// offered to clients
+func validGateway(gw config.GatewayInfo) bool {
+	if gw.ID == "" || len(gw.ID) > maxPeerGatewayIDLen ||
+		gw.Region == "" || len(gw.Region) > maxRegionLen ||
+		net.ParseIP(gw.Address) == nil ||
+		gw.Port <= 0 || gw.Port > 65535 ||
+		len(gw.PublicKey) != ed25519.PublicKeySize ||
+		len(gw.Transports) == 0 || len(gw.Transports) > maxGatewayTransports {
+		return false
+	}
+	for _, transport := range gw.Transports {
+		if transport == "" || len(transport) > maxTransportNameLen {
+			return false
+		}
+	}
+	return true
+}
+
+// fetch downloads an announcement with a signed request
+func (p *Poller) fetch(ctx context.Context, announcementURL string) (*config.GatewayAnnouncement, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, announcementURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.sign(req.URL, req.Header); err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("announcement returned status %d", resp.StatusCode)
+	}
+	var announcement config.GatewayAnnouncement
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxAnnouncementBytes)).Decode(&announcement); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAnnouncementInvalid, err)
+	}
+	return &announcement, nil
+}
+
+// sign adds our key ID, the time and a signature over the request path
+func (p *Poller) sign(u *url.URL, header http.Header) error {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/" // As the peer receives it
+	}
+	timestamp := p.clock.Now().Unix()
+	keyID, signature, err := p.signer.SignAnnouncementRequest(path, timestamp)
+	if err != nil {
+		return err
+	}
+	header.Set(HeaderKeyID, keyID)
+	header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	header.Set(HeaderSignature, base64.StdEncoding.EncodeToString(signature))
+	return nil
+}
+
+// pollOutcome labels a failed poll
+func pollOutcome(err error) string {
+	switch {
+	case errors.Is(err, ErrAnnouncementInvalid):
+		return "rejected"
+	case errors.Is(err, ErrAnnouncementExpired):
+		return "expired"
+	default:
+		return "failed"
+	}
+}
+
+// Start polls once, then every interval until ctx is cancelled, so imported
+// gateways are current soon after a restart
+func (p *Poller) Start(ctx context.Context, interval time.Duration) {
+	ticker := p.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	if err := p.PollAll(ctx); err != nil {
+		log.Printf("federation poll failed: %v", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if err := p.PollAll(ctx); err != nil {
+				log.Printf("federation poll failed: %v", err)
+			}
+		}
+	}
+}
+
+func envDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
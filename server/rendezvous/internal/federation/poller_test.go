@@ -0,0 +1,251 @@
+package federation
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+)
+
+const testPeerID = "6f1c1b7e-3d5a-4c61-9a0e-2b7f4d8c9e10"
+
+var testNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return pub, priv
+}
+
+func testGateway(id string) config.GatewayInfo {
+	gatewayKey := make([]byte, ed25519.PublicKeySize)
+	return config.GatewayInfo{
+		ID:         id,
+		Address:    "198.51.100.7",
+		Port:       443,
+		PublicKey:  gatewayKey,
+		Transports: []string{"masque"},
+		Region:     "me-south-1",
+		Load:       0.25,
+	}
+}
+
+// signedAnnouncement returns an announcement issued at testNow, signed by key
+func signedAnnouncement(t *testing.T, key ed25519.PrivateKey, gateways ...config.GatewayInfo) *config.GatewayAnnouncement {
+	t.Helper()
+	announcement := &config.GatewayAnnouncement{
+		Version:   config.AnnouncementVersion,
+		Issuer:    "partner",
+		Timestamp: testNow.Unix(),
+		Gateways:  gateways,
+	}
+	if err := config.SignAnnouncement(announcement, key); err != nil {
+		t.Fatalf("SignAnnouncement: %v", err)
+	}
+	return announcement
+}
+
+// testSigner signs announcement requests as our config key would
+type testSigner struct {
+	key ed25519.PrivateKey
+}
+
+func (s testSigner) SignAnnouncementRequest(path string, timestamp int64) (string, []byte, error) {
+	publicKey := s.key.Public().(ed25519.PublicKey)
+	return config.KeyID(publicKey), ed25519.Sign(s.key, config.AnnouncementRequestMessage(path, timestamp)), nil
+}
+
+// ourKey is the key testPoller signs its requests with
+var _, ourKey, _ = ed25519.GenerateKey(rand.Reader)
+
+func testPoller(database *db.Database) *Poller {
+	p := NewPoller(database, testSigner{ourKey}, time.Hour)
+	p.clock = clock.NewFake(testNow)
+	return p
+}
+
+func TestVerify(t *testing.T) {
+	pub, priv := testKey(t)
+	otherPub, _ := testKey(t)
+	p := testPoller(nil)
+
+	honeypot := testGateway("gw-honeypot")
+	honeypot.IsHoneypot = true
+	badAddress := testGateway("gw-bad")
+	badAddress.Address = "not-an-ip"
+	overloaded := testGateway("gw-2")
+	overloaded.Load = 7
+	announcement := signedAnnouncement(t, priv, testGateway("gw-1"), testGateway("gw-1"), honeypot, badAddress, overloaded)
+
+	gateways, err := p.Verify(announcement, pub)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(gateways) != 2 || gateways[0].PeerGatewayID != "gw-1" || gateways[1].PeerGatewayID != "gw-2" {
+		t.Fatalf("gateways: got %+v, want gw-1 and gw-2 only", gateways)
+	}
+	if gateways[0].IPAddress != "198.51.100.7" || gateways[0].Load != 0.25 || gateways[1].Load != 0.5 {
+		t.Errorf("gateways: got %+v", gateways)
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(a *config.GatewayAnnouncement)
+		key     ed25519.PublicKey
+		wantErr error
+	}{
+		{"tampered address", func(a *config.GatewayAnnouncement) { a.Gateways[0].Address = "203.0.113.66" }, pub, ErrAnnouncementInvalid},
+		{"wrong pinned key", func(a *config.GatewayAnnouncement) {}, otherPub, ErrAnnouncementInvalid},
+		{"unknown version", func(a *config.GatewayAnnouncement) { a.Version = "2.0" }, pub, ErrAnnouncementInvalid},
+		{"stripped signature", func(a *config.GatewayAnnouncement) { a.Signature = nil }, pub, ErrAnnouncementInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := signedAnnouncement(t, priv, testGateway("gw-1"))
+			tt.mutate(a)
+			if _, err := p.Verify(a, tt.key); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	for name, age := range map[string]time.Duration{"expired": 2 * time.Hour, "future": -time.Hour} {
+		t.Run(name, func(t *testing.T) {
+			a := &config.GatewayAnnouncement{
+				Version:   config.AnnouncementVersion,
+				Timestamp: testNow.Add(-age).Unix(),
+				Gateways:  []config.GatewayInfo{testGateway("gw-1")},
+			}
+			if err := config.SignAnnouncement(a, priv); err != nil {
+				t.Fatalf("SignAnnouncement: %v", err)
+			}
+			if _, err := p.Verify(a, pub); !errors.Is(err, ErrAnnouncementExpired) {
+				t.Errorf("got %v, want ErrAnnouncementExpired", err)
+			}
+		})
+	}
+}
+
+func TestPoll_ReconcilesAnnouncedGateways(t *testing.T) {
+	pub, priv := testKey(t)
+	announcement := signedAnnouncement(t, priv, testGateway("gw-1"), testGateway("gw-2"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The peer only answers requests signed by our key
+		timestamp, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		signature, _ := base64.StdEncoding.DecodeString(r.Header.Get(HeaderSignature))
+		ourPublicKey := ourKey.Public().(ed25519.PublicKey)
+		if r.Header.Get(HeaderKeyID) != config.KeyID(ourPublicKey) || timestamp != testNow.Unix() ||
+			!ed25519.Verify(ourPublicKey, config.AnnouncementRequestMessage(r.URL.EscapedPath(), timestamp), signature) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(announcement)
+	}))
+	defer server.Close()
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT last_announced_at FROM federation_peers`).WithArgs(testPeerID).
+		WillReturnRows(sqlmock.NewRows([]string{"last_announced_at"}).AddRow(testNow.Add(-5 * time.Minute)))
+	mock.ExpectQuery(`INSERT INTO federated_gateways`).WithArgs(testPeerID, "gw-1", sqlmock.AnyArg(), "198.51.100.7", 443, sqlmock.AnyArg(), "me-south-1", 0.25).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(false))
+	mock.ExpectQuery(`INSERT INTO federated_gateways`).WithArgs(testPeerID, "gw-2", sqlmock.AnyArg(), "198.51.100.7", 443, sqlmock.AnyArg(), "me-south-1", 0.25).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted"}).AddRow(true))
+	mock.ExpectExec(`DELETE FROM federated_gateways`).WithArgs(testPeerID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`UPDATE federation_peers SET last_polled_at`).WithArgs(testPeerID, time.Unix(testNow.Unix(), 0)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	peer := &db.FederationPeer{ID: testPeerID, Name: "partner", AnnouncementURL: server.URL, PublicKey: pub}
+	imported, err := testPoller(db.NewFromPool(sqlDB)).Poll(context.Background(), peer)
+	if err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+	if imported.Added != 1 || imported.Updated != 1 || imported.Removed != 3 {
+		t.Errorf("import: got %+v, want 1 added, 1 updated, 3 removed", imported)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPoll_RefusesReplayedAnnouncement(t *testing.T) {
+	pub, priv := testKey(t)
+	announcement := signedAnnouncement(t, priv, testGateway("gw-1"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(announcement)
+	}))
+	defer server.Close()
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// The same announcement was already imported
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT last_announced_at FROM federation_peers`).WithArgs(testPeerID).
+		WillReturnRows(sqlmock.NewRows([]string{"last_announced_at"}).AddRow(time.Unix(testNow.Unix(), 0)))
+	mock.ExpectRollback()
+
+	peer := &db.FederationPeer{ID: testPeerID, Name: "partner", AnnouncementURL: server.URL, PublicKey: pub}
+	if _, err := testPoller(db.NewFromPool(sqlDB)).Poll(context.Background(), peer); !errors.Is(err, db.ErrAnnouncementStale) {
+		t.Errorf("got %v, want ErrAnnouncementStale", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStart_PollsAtStartup(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	mock.ExpectQuery(`FROM federation_peers`).WillReturnRows(sqlmock.NewRows(federationPeerColumns))
+
+	fake := clock.NewFake(testNow)
+	p := NewPoller(db.NewFromPool(sqlDB), testSigner{ourKey}, time.Hour)
+	p.clock = fake
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Start(ctx, time.Hour)
+		close(done)
+	}()
+
+	// Peers are polled before the first tick
+	fake.BlockUntil(1)
+	deadline := time.Now().Add(time.Second)
+	for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
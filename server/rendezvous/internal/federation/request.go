@@ -0,0 +1,54 @@
+package federation
+
+import (
+	"context"
+	"crypto/ed25519"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+)
+
+// Headers of a signed announcement request
+const (
+	HeaderKeyID     = "X-Federation-Key-ID"
+	HeaderTimestamp = "X-Federation-Timestamp"
+	HeaderSignature = "X-Federation-Signature" // base64
+)
+
+// requestMaxSkew bounds how old, or how far in the future, a signed
+// announcement request may be
+const requestMaxSkew = 5 * time.Minute
+
+// ErrPeerUnauthorized is returned for an announcement request that is not
+// signed by an enabled peer's pinned key
+var ErrPeerUnauthorized = apperr.New(apperr.ErrUnauthorized, "federation_peer_unauthorized",
+	"announcement request is not signed by a known federation peer")
+
+// RequestSigner signs our requests for peers' announcements
+type RequestSigner interface {
+	SignAnnouncementRequest(path string, timestamp int64) (keyID string, signature []byte, err error)
+}
+
+// AuthenticatePeer returns the enabled peer whose pinned key signed a request
+// for path at timestamp. Peers sign with their config key, so a deployment
+// that fetches our announcement must be one of our peers too.
+func AuthenticatePeer(ctx context.Context, database *db.Database, keyID, path string, timestamp int64, signature []byte, now time.Time) (*db.FederationPeer, error) {
+	signedAt := time.Unix(timestamp, 0)
+	if keyID == "" || signedAt.Before(now.Add(-requestMaxSkew)) || signedAt.After(now.Add(requestMaxSkew)) {
+		return nil, ErrPeerUnauthorized
+	}
+	peers, err := database.ListFederationPeers(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	message := config.AnnouncementRequestMessage(path, timestamp)
+	for _, peer := range peers {
+		if len(peer.PublicKey) == ed25519.PublicKeySize && config.KeyID(peer.PublicKey) == keyID &&
+			ed25519.Verify(ed25519.PublicKey(peer.PublicKey), message, signature) {
+			return peer, nil
+		}
+	}
+	return nil, ErrPeerUnauthorized
+}
@@ -0,0 +1,74 @@
+package federation
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/config"
+	"rendezvous/internal/db"
+)
+
+var federationPeerColumns = []string{
+	"id", "name", "announcement_url", "public_key", "enabled", "created_at", "updated_at",
+	"last_polled_at", "last_announced_at", "last_error", "gateways",
+}
+
+const announcementPath = "/api/v1/federation/announcement"
+
+func TestAuthenticatePeer(t *testing.T) {
+	peerPub, peerPriv := testKey(t)
+	_, strangerPriv := testKey(t)
+	signed := func(key ed25519.PrivateKey, path string, at time.Time) (string, int64, []byte) {
+		keyID, signature, _ := testSigner{key}.SignAnnouncementRequest(path, at.Unix())
+		return keyID, at.Unix(), signature
+	}
+
+	tests := []struct {
+		name      string
+		keyID     string
+		timestamp int64
+		signature []byte
+		queried   bool // Whether peers are looked up
+		wantErr   error
+	}{
+		{"known peer", "", 0, nil, true, nil},
+		{"unknown key", "", 0, nil, true, ErrPeerUnauthorized},
+		{"another path", "", 0, nil, true, ErrPeerUnauthorized},
+		{"stale request", "", 0, nil, false, ErrPeerUnauthorized},
+	}
+	tests[0].keyID, tests[0].timestamp, tests[0].signature = signed(peerPriv, announcementPath, testNow)
+	tests[1].keyID, tests[1].timestamp, tests[1].signature = signed(strangerPriv, announcementPath, testNow)
+	tests[2].keyID, tests[2].timestamp, tests[2].signature = signed(peerPriv, "/api/v1/other", testNow)
+	tests[3].keyID, tests[3].timestamp, tests[3].signature = signed(peerPriv, announcementPath, testNow.Add(-10*time.Minute))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("sqlmock.New: %v", err)
+			}
+			defer sqlDB.Close()
+			if tt.queried {
+				mock.ExpectQuery(`FROM federation_peers`).WithArgs(true).WillReturnRows(sqlmock.NewRows(federationPeerColumns).
+					AddRow(testPeerID, "partner", "https://partner.example/announcement", []byte(peerPub), true,
+						testNow, testNow, nil, nil, nil, 0))
+			}
+
+			peer, err := AuthenticatePeer(context.Background(), db.NewFromPool(sqlDB), tt.keyID, announcementPath,
+				tt.timestamp, tt.signature, testNow)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (peer.Name != "partner" || config.KeyID(peer.PublicKey) != tt.keyID) {
+				t.Errorf("peer: got %+v", peer)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
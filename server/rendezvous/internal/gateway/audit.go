@@ -0,0 +1,187 @@
+package gateway
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// Cluster is a group of gateways that look like they are run by one party.
+type Cluster struct {
+	Reason     string
+	Key        string // Stable identifier used as the review queue subject
+	GatewayIDs []string
+	Details    map[string]interface{}
+}
+
+// FindSuspiciousClusters looks for groups of at least minSize gateways that are
+// likely to be a single operator posing as many: runs of sequential IPv4
+// addresses, and gateways sharing an ASN with an identical transport set.
+func FindSuspiciousClusters(gateways []*db.Gateway, minSize int) []Cluster {
+	if minSize < 2 {
+		minSize = 2
+	}
+
+	var clusters []Cluster
+	clusters = append(clusters, sequentialIPClusters(gateways, minSize)...)
+	clusters = append(clusters, asnTransportClusters(gateways, minSize)...)
+	return clusters
+}
+
+func sequentialIPClusters(gateways []*db.Gateway, minSize int) []Cluster {
+	type addressed struct {
+		addr uint32
+		ip   string
+		id   string
+	}
+
+	var v4 []addressed
+	for _, gw := range gateways {
+		ip := net.ParseIP(gw.IPAddress)
+		if ip == nil || ip.To4() == nil {
+			continue
+		}
+		v4 = append(v4, addressed{addr: binary.BigEndian.Uint32(ip.To4()), ip: gw.IPAddress, id: gw.ID})
+	}
+	sort.Slice(v4, func(i, j int) bool { return v4[i].addr < v4[j].addr })
+
+	var clusters []Cluster
+	start := 0
+	for i := 1; i <= len(v4); i++ {
+		// A run continues while addresses are adjacent (or the same host on another port)
+		if i < len(v4) && v4[i].addr-v4[i-1].addr <= 1 {
+			continue
+		}
+		if run := v4[start:i]; len(run) >= minSize {
+			ids := make([]string, len(run))
+			for j, a := range run {
+				ids[j] = a.id
+			}
+			first, last := run[0].ip, run[len(run)-1].ip
+			clusters = append(clusters, Cluster{
+				Reason:     ReasonSequentialIPs,
+				Key:        first + "-" + last,
+				GatewayIDs: ids,
+				Details: map[string]interface{}{
+					"first_ip": first,
+					"last_ip":  last,
+					"count":    len(run),
+				},
+			})
+		}
+		start = i
+	}
+	return clusters
+}
+
+func asnTransportClusters(gateways []*db.Gateway, minSize int) []Cluster {
+	groups := map[string][]string{}
+	for _, gw := range gateways {
+		if gw.ASN == nil {
+			continue
+		}
+		transports := append([]string(nil), gw.TransportTypes...)
+		sort.Strings(transports)
+		key := fmt.Sprintf("AS%d:%s", *gw.ASN, strings.Join(transports, ","))
+		groups[key] = append(groups[key], gw.ID)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var clusters []Cluster
+	for _, key := range keys {
+		ids := groups[key]
+		if len(ids) < minSize {
+			continue
+		}
+		clusters = append(clusters, Cluster{
+			Reason:     ReasonASNTransportSet,
+			Key:        key,
+			GatewayIDs: ids,
+			Details: map[string]interface{}{
+				"count": len(ids),
+			},
+		})
+	}
+	return clusters
+}
+
+// Auditor periodically scans registered gateways for suspicious clusters and
+// files them into the admin review queue.
+type Auditor struct {
+	db      *db.Database
+	minSize int
+	clock   clock.Clock
+}
+
+// NewAuditor creates a new gateway cluster auditor
+func NewAuditor(database *db.Database) *Auditor {
+	return &Auditor{
+		db:      database,
+		minSize: envInt("LUMENLINK_GATEWAY_CLUSTER_MIN_SIZE", 4),
+		clock:   clock.Real{},
+	}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (a *Auditor) SetClock(c clock.Clock) {
+	a.clock = c
+}
+
+// RunAudit performs one audit pass and returns how many new review items were opened.
+func (a *Auditor) RunAudit(ctx context.Context) (int, error) {
+	gateways, err := a.db.GetRegisteredGateways(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	opened := 0
+	for _, cluster := range FindSuspiciousClusters(gateways, a.minSize) {
+		details := map[string]interface{}{"gateway_ids": cluster.GatewayIDs}
+		for k, v := range cluster.Details {
+			details[k] = v
+		}
+		added, err := a.db.AddReviewItem(ctx, "gateway_cluster", cluster.Key, cluster.Reason, details)
+		if err != nil {
+			return opened, err
+		}
+		if added {
+			opened++
+		}
+	}
+	return opened, nil
+}
+
+// Start runs the audit every interval until ctx is cancelled.
+func (a *Auditor) Start(ctx context.Context, interval time.Duration) {
+	ticker := a.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			opened, err := a.RunAudit(ctx)
+			if err != nil {
+				log.Printf("gateway cluster audit failed: %v", err)
+				continue
+			}
+			if opened > 0 {
+				log.Printf("gateway cluster audit flagged %d new clusters for review", opened)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+func TestFindSuspiciousClusters_SequentialIPs(t *testing.T) {
+	gateways := []*db.Gateway{
+		{ID: "a", IPAddress: "203.0.113.12"},
+		{ID: "b", IPAddress: "203.0.113.10"},
+		{ID: "c", IPAddress: "203.0.113.11"},
+		{ID: "d", IPAddress: "203.0.113.13"},
+		{ID: "e", IPAddress: "198.51.100.50"},
+		{ID: "f", IPAddress: "2001:db8::1"},
+	}
+
+	clusters := FindSuspiciousClusters(gateways, 4)
+	if len(clusters) != 1 {
+		t.Fatalf("expected 1 cluster, got %d: %+v", len(clusters), clusters)
+	}
+	cluster := clusters[0]
+	if cluster.Reason != ReasonSequentialIPs {
+		t.Errorf("Reason: got %q, want %q", cluster.Reason, ReasonSequentialIPs)
+	}
+	if cluster.Key != "203.0.113.10-203.0.113.13" {
+		t.Errorf("Key: got %q", cluster.Key)
+	}
+	if len(cluster.GatewayIDs) != 4 {
+		t.Errorf("GatewayIDs: got %v, want 4 ids", cluster.GatewayIDs)
+	}
+}
+
+func TestFindSuspiciousClusters_GapBreaksRun(t *testing.T) {
+	gateways := []*db.Gateway{
+		{ID: "a", IPAddress: "203.0.113.10"},
+		{ID: "b", IPAddress: "203.0.113.11"},
+		{ID: "c", IPAddress: "203.0.113.13"},
+		{ID: "d", IPAddress: "203.0.113.14"},
+	}
+
+	if clusters := FindSuspiciousClusters(gateways, 3); len(clusters) != 0 {
+		t.Errorf("expected no clusters, got %+v", clusters)
+	}
+}
+
+func TestFindSuspiciousClusters_ASNTransportSet(t *testing.T) {
+	asn := 64500
+	other := 64501
+	gateways := []*db.Gateway{
+		{ID: "a", IPAddress: "192.0.2.1", ASN: &asn, TransportTypes: []string{"xtls", "masque"}},
+		{ID: "b", IPAddress: "198.51.100.7", ASN: &asn, TransportTypes: []string{"masque", "xtls"}},
+		{ID: "c", IPAddress: "203.0.113.99", ASN: &asn, TransportTypes: []string{"masque", "xtls"}},
+		{ID: "d", IPAddress: "203.0.113.200", ASN: &asn, TransportTypes: []string{"ssh"}},
+		{ID: "e", IPAddress: "203.0.113.150", ASN: &other, TransportTypes: []string{"masque", "xtls"}},
+		{ID: "f", IPAddress: "203.0.113.160", TransportTypes: []string{"masque", "xtls"}},
+	}
+
+	clusters := FindSuspiciousClusters(gateways, 3)
+	if len(clusters) != 1 {
+		t.Fatalf("expected 1 cluster, got %d: %+v", len(clusters), clusters)
+	}
+	if clusters[0].Reason != ReasonASNTransportSet || clusters[0].Key != "AS64500:masque,xtls" {
+		t.Errorf("cluster: got %+v", clusters[0])
+	}
+}
+
+func TestRunAudit_FilesClustersIntoReviewQueue(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	rows := sqlmock.NewRows([]string{
+		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
+		"created_at", "last_seen", "updated_at",
+	})
+	now := time.Now()
+	for i, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		rows.AddRow(
+			string(rune('a'+i)), make([]byte, 32), ip, 443, "{masque}", "{}",
+			"us-east-1", nil, 0, nil, "active", false,
+			"op-1", "approved", nil,
+			now, nil, now,
+		)
+	}
+	mock.ExpectQuery(`SELECT id, public_key`).WillReturnRows(rows)
+	mock.ExpectExec(`INSERT INTO review_queue`).
+		WithArgs("gateway_cluster", "192.0.2.1-192.0.2.3", ReasonSequentialIPs, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0)) // already open from a previous pass
+
+	auditor := NewAuditor(db.NewFromPool(sqlDB))
+	auditor.minSize = 3
+	opened, err := auditor.RunAudit(context.Background())
+	if err != nil {
+		t.Fatalf("RunAudit: %v", err)
+	}
+	if opened != 0 {
+		t.Errorf("opened: got %d, want 0 for an already-open cluster", opened)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
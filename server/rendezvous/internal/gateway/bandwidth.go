@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"fmt"
+	"time"
+
+	"rendezvous/internal/db"
+	"rendezvous/internal/notify"
+)
+
+// LoadBandwidthWarnPercentFromEnv reads the share of a gateway's declared
+// bandwidth at which its operator is warned.
+func LoadBandwidthWarnPercentFromEnv() int {
+	return envInt("LUMENLINK_BANDWIDTH_CAP_WARN_PERCENT", 90)
+}
+
+// BandwidthCapEvent returns the operator event for a heartbeat reporting
+// usedMbps, and false unless the gateway has an operator, declared its
+// bandwidth, and is using at least warnPercent of it.
+func BandwidthCapEvent(gw *db.Gateway, usedMbps int, warnPercent int, now time.Time) (notify.OperatorEvent, bool) {
+	if gw.OperatorID == "" || gw.BandwidthMbps == nil || *gw.BandwidthMbps <= 0 || warnPercent <= 0 {
+		return notify.OperatorEvent{}, false
+	}
+	capMbps := *gw.BandwidthMbps
+	if usedMbps*100 < capMbps*warnPercent {
+		return notify.OperatorEvent{}, false
+	}
+	return notify.OperatorEvent{
+		Type:       notify.EventBandwidthCap,
+		OperatorID: gw.OperatorID,
+		GatewayID:  gw.ID,
+		Message:    fmt.Sprintf("Gateway %s is using %d of its %d Mbps", gw.ID, usedMbps, capMbps),
+		Details: map[string]interface{}{
+			"bandwidth_used_mbps": usedMbps,
+			"bandwidth_mbps":      capMbps,
+			"warn_percent":        warnPercent,
+		},
+		OccurredAt: now.UTC(),
+	}, true
+}
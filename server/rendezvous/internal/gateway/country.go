@@ -0,0 +1,172 @@
+package gateway
+
+import (
+	"context"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// CountryOther labels the share of clients from countries that are not listed
+// individually.
+const CountryOther = "other"
+
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ParseCountry returns the ISO 3166-1 alpha-2 code from a CF-IPCountry header.
+// Cloudflare sends XX for unknown locations and T1 for Tor exits; neither
+// names a country.
+func ParseCountry(value string) (string, bool) {
+	country := strings.ToUpper(strings.TrimSpace(value))
+	if !countryCodePattern.MatchString(country) || country == "XX" {
+		return "", false
+	}
+	return country, true
+}
+
+// CountryPolicy controls how a gateway's country distribution is summarized.
+type CountryPolicy struct {
+	TopN       int // Countries listed individually, largest first
+	MinClients int // k-anonymity threshold: smaller groups are never shown
+	WindowDays int // Days of rollups the distribution covers
+}
+
+// LoadCountryPolicyFromEnv reads the country distribution policy from the environment.
+func LoadCountryPolicyFromEnv() CountryPolicy {
+	policy := CountryPolicy{
+		TopN:       envInt("LUMENLINK_COUNTRY_TOP_N", 5),
+		MinClients: envInt("LUMENLINK_COUNTRY_MIN_CLIENTS", 10),
+		WindowDays: envInt("LUMENLINK_COUNTRY_WINDOW_DAYS", 30),
+	}
+	// A threshold of 0 or 1 would expose single clients
+	if policy.MinClients < 2 {
+		policy.MinClients = 2
+	}
+	if policy.WindowDays < 1 {
+		policy.WindowDays = 1
+	}
+	return policy
+}
+
+// CountryShare is one country's share of a gateway's clients, in percent.
+type CountryShare struct {
+	Country    string  `json:"country"`
+	Percentage float64 `json:"percentage"`
+}
+
+// CountryDistribution is the suppressed country breakdown exposed to operators.
+// It carries percentages only, never client counts.
+type CountryDistribution struct {
+	WindowDays int            `json:"window_days"`
+	Suppressed bool           `json:"suppressed"` // Too few clients for any breakdown
+	Countries  []CountryShare `json:"countries"`
+}
+
+// SummarizeCountries applies the k-anonymity rule to raw per-country counts.
+// If the gateway has fewer than MinClients clients in total nothing is shown.
+// Otherwise up to TopN countries with at least MinClients clients are listed,
+// and every remaining client is folded into a single CountryOther share, so a
+// small country never appears on its own. If fewer than MinClients clients
+// would be left for CountryOther, the smallest listed countries are folded
+// into it too, since its share could otherwise be read as 100 minus the rest.
+func SummarizeCountries(counts []db.CountryCount, policy CountryPolicy) CountryDistribution {
+	dist := CountryDistribution{WindowDays: policy.WindowDays, Countries: []CountryShare{}}
+
+	var total int64
+	for _, c := range counts {
+		total += c.Clients
+	}
+	if total == 0 || total < int64(policy.MinClients) {
+		dist.Suppressed = true
+		return dist
+	}
+
+	sorted := make([]db.CountryCount, len(counts))
+	copy(sorted, counts)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Clients != sorted[j].Clients {
+			return sorted[i].Clients > sorted[j].Clients
+		}
+		return sorted[i].Country < sorted[j].Country
+	})
+
+	listed := 0
+	other := total
+	for _, c := range sorted {
+		if listed >= policy.TopN || c.Clients < int64(policy.MinClients) {
+			break
+		}
+		listed++
+		other -= c.Clients
+	}
+	for listed > 0 && other > 0 && other < int64(policy.MinClients) {
+		listed--
+		other += sorted[listed].Clients
+	}
+
+	for _, c := range sorted[:listed] {
+		dist.Countries = append(dist.Countries, CountryShare{Country: c.Country, Percentage: percentOf(c.Clients, total)})
+	}
+	if other > 0 {
+		dist.Countries = append(dist.Countries, CountryShare{Country: CountryOther, Percentage: percentOf(other, total)})
+	}
+	return dist
+}
+
+// percentOf rounds to one decimal place.
+func percentOf(part, total int64) float64 {
+	return math.Round(float64(part)*1000/float64(total)) / 10
+}
+
+// CountryRollup refreshes the per-gateway country rollup.
+type CountryRollup struct {
+	db         *db.Database
+	windowDays int
+	clock      clock.Clock
+}
+
+// NewCountryRollup creates the rollup job over the window of
+// LUMENLINK_COUNTRY_WINDOW_DAYS days.
+func NewCountryRollup(database *db.Database) *CountryRollup {
+	return &CountryRollup{
+		db:         database,
+		windowDays: LoadCountryPolicyFromEnv().WindowDays,
+		clock:      clock.Real{},
+	}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (r *CountryRollup) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Run rebuilds the rollup for the window ending today, counting each client
+// once over the whole window. The rollup is replaced rather than added to,
+// so overlapping runs are harmless. It returns the number of rollup rows
+// written.
+func (r *CountryRollup) Run(ctx context.Context, now time.Time) (int64, error) {
+	return r.db.RefreshGatewayCountryRollup(ctx, now.UTC(), r.windowDays)
+}
+
+// Start runs the rollup immediately, then every interval until ctx is cancelled.
+func (r *CountryRollup) Start(ctx context.Context, interval time.Duration) {
+	ticker := r.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Run(ctx, r.clock.Now()); err != nil {
+			log.Printf("gateway country rollup failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
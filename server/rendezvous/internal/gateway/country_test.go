@@ -0,0 +1,162 @@
+package gateway
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+func TestParseCountry(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"IR", "IR", true},
+		{" ru ", "RU", true},
+		{"XX", "", false}, // Unknown location
+		{"T1", "", false}, // Tor exit
+		{"", "", false},
+		{"USA", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseCountry(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseCountry(%q) = %q, %v; want %q, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSummarizeCountries(t *testing.T) {
+	policy := CountryPolicy{TopN: 2, MinClients: 10, WindowDays: 30}
+
+	tests := []struct {
+		name           string
+		counts         []db.CountryCount
+		wantSuppressed bool
+		want           []CountryShare
+	}{
+		{
+			name:           "no clients",
+			counts:         nil,
+			wantSuppressed: true,
+			want:           []CountryShare{},
+		},
+		{
+			name:           "total below threshold",
+			counts:         []db.CountryCount{{Country: "IR", Clients: 6}, {Country: "RU", Clients: 3}},
+			wantSuppressed: true,
+			want:           []CountryShare{},
+		},
+		{
+			name:   "small countries folded into other",
+			counts: []db.CountryCount{{Country: "RU", Clients: 9}, {Country: "IR", Clients: 30}, {Country: "CN", Clients: 1}},
+			want:   []CountryShare{{Country: "IR", Percentage: 75}, {Country: CountryOther, Percentage: 25}},
+		},
+		{
+			name:   "every country below threshold",
+			counts: []db.CountryCount{{Country: "IR", Clients: 5}, {Country: "RU", Clients: 5}},
+			want:   []CountryShare{{Country: CountryOther, Percentage: 100}},
+		},
+		{
+			name: "top N limits the list",
+			counts: []db.CountryCount{
+				{Country: "CN", Clients: 20}, {Country: "IR", Clients: 40}, {Country: "RU", Clients: 20}, {Country: "BY", Clients: 10},
+			},
+			want: []CountryShare{{Country: "IR", Percentage: 44.4}, {Country: "CN", Percentage: 22.2}, {Country: CountryOther, Percentage: 33.3}},
+		},
+		{
+			name:   "small other share folds the smallest listed country",
+			counts: []db.CountryCount{{Country: "IR", Clients: 30}, {Country: "RU", Clients: 12}, {Country: "CN", Clients: 3}},
+			want:   []CountryShare{{Country: "IR", Percentage: 66.7}, {Country: CountryOther, Percentage: 33.3}},
+		},
+		{
+			name:   "small other share folds every listed country",
+			counts: []db.CountryCount{{Country: "IR", Clients: 10}, {Country: "CN", Clients: 2}},
+			want:   []CountryShare{{Country: CountryOther, Percentage: 100}},
+		},
+		{
+			name:   "no other share when every client is listed",
+			counts: []db.CountryCount{{Country: "IR", Clients: 10}, {Country: "RU", Clients: 10}},
+			want:   []CountryShare{{Country: "IR", Percentage: 50}, {Country: "RU", Percentage: 50}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SummarizeCountries(tt.counts, policy)
+			if got.Suppressed != tt.wantSuppressed {
+				t.Errorf("suppressed: got %v, want %v", got.Suppressed, tt.wantSuppressed)
+			}
+			if !reflect.DeepEqual(got.Countries, tt.want) {
+				t.Errorf("countries: got %+v, want %+v", got.Countries, tt.want)
+			}
+			if got.WindowDays != 30 {
+				t.Errorf("window_days: got %d, want 30", got.WindowDays)
+			}
+		})
+	}
+}
+
+func TestLoadCountryPolicyFromEnv_EnforcesMinimumThreshold(t *testing.T) {
+	t.Setenv("LUMENLINK_COUNTRY_MIN_CLIENTS", "1")
+	if got := LoadCountryPolicyFromEnv().MinClients; got != 2 {
+		t.Errorf("MinClients: got %d, want 2", got)
+	}
+}
+
+func TestCountryRollup_RunIsIdempotent(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// Every run counts the whole window ending today with the same
+	// statements, replacing rather than adding to the stored rows
+	now := time.Date(2026, 3, 10, 15, 30, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM gateway_country_rollups`).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`INSERT INTO gateway_country_rollups`).
+			WithArgs("2026-03-10", time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectCommit()
+	}
+
+	rollup := NewCountryRollup(db.NewFromPool(sqlDB))
+	rollup.windowDays = 7
+	for i := 0; i < 2; i++ {
+		if written, err := rollup.Run(context.Background(), now); err != nil || written != 3 {
+			t.Fatalf("run %d: written=%d err=%v, want 3", i, written, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCountryRollup_FailedRunKeepsPreviousRollup(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM gateway_country_rollups`).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`INSERT INTO gateway_country_rollups`).WillReturnError(context.DeadlineExceeded)
+	mock.ExpectRollback()
+
+	rollup := NewCountryRollup(db.NewFromPool(sqlDB))
+	if _, err := rollup.Run(context.Background(), time.Now()); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
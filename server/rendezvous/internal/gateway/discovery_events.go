@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// DiscoveryEventCleanup periodically deletes discovery log event IDs older
+// than the dedupe window. Every logged attempt with an event ID claims one,
+// and pruning them as discovery logs arrive made each request wait on the
+// delete.
+type DiscoveryEventCleanup struct {
+	db     *db.Database
+	window time.Duration
+	clock  clock.Clock
+}
+
+// NewDiscoveryEventCleanup creates a cleanup that keeps event IDs for
+// db.DiscoveryDedupeWindow
+func NewDiscoveryEventCleanup(database *db.Database) *DiscoveryEventCleanup {
+	return &DiscoveryEventCleanup{db: database, window: db.DiscoveryDedupeWindow, clock: clock.Real{}}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (c *DiscoveryEventCleanup) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// Run deletes event IDs claimed before the dedupe window once and returns
+// how many it deleted
+func (c *DiscoveryEventCleanup) Run(ctx context.Context, now time.Time) (int64, error) {
+	return c.db.DeleteDiscoveryEventsBefore(ctx, now.Add(-c.window))
+}
+
+// Start cleans up event IDs every interval until ctx is cancelled.
+func (c *DiscoveryEventCleanup) Start(ctx context.Context, interval time.Duration) {
+	ticker := c.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			deleted, err := c.Run(ctx, c.clock.Now())
+			if err != nil {
+				log.Printf("discovery event cleanup failed after deleting %d event IDs: %v", deleted, err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("discovery event cleanup deleted %d event IDs", deleted)
+			}
+		}
+	}
+}
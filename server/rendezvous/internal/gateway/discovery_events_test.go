@@ -0,0 +1,30 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+func TestDiscoveryEventCleanup_DeletesBeforeDedupeWindow(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	mock.ExpectExec(`DELETE FROM discovery_log_events`).WithArgs(now.Add(-db.DiscoveryDedupeWindow), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	deleted, err := NewDiscoveryEventCleanup(db.NewFromPool(sqlDB)).Run(context.Background(), now)
+	if err != nil || deleted != 4 {
+		t.Fatalf("Run: got %d, %v; want 4", deleted, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
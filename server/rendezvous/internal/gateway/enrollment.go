@@ -0,0 +1,103 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/db"
+)
+
+// Enrollment token lifetimes
+const (
+	DefaultEnrollmentTTL = 24 * time.Hour
+	MaxEnrollmentTTL     = 7 * 24 * time.Hour
+)
+
+// ErrAlreadyRegistered is returned when a bootstrapping gateway's public key
+// is already registered; the agent must generate a fresh key. The token is
+// released so it can be retried.
+var ErrAlreadyRegistered = apperr.New(apperr.ErrConflict, "gateway_already_registered", "a gateway with this public key is already registered")
+
+// HeartbeatSchedule tells a gateway agent how often to report status
+type HeartbeatSchedule struct {
+	IntervalSeconds   int `json:"interval_seconds"`
+	StaleAfterSeconds int `json:"stale_after_seconds"` // Marked offline after this long without a heartbeat
+}
+
+// LoadHeartbeatScheduleFromEnv reads the heartbeat interval from
+// LUMENLINK_GATEWAY_HEARTBEAT_INTERVAL_SECONDS (default 60) and the reaper's
+// LUMENLINK_GATEWAY_STALE_AFTER_MINUTES (default 15).
+func LoadHeartbeatScheduleFromEnv() HeartbeatSchedule {
+	return HeartbeatSchedule{
+		IntervalSeconds:   envInt("LUMENLINK_GATEWAY_HEARTBEAT_INTERVAL_SECONDS", 60),
+		StaleAfterSeconds: envInt("LUMENLINK_GATEWAY_STALE_AFTER_MINUTES", 15) * 60,
+	}
+}
+
+// HashEnrollmentToken returns the hex SHA-256 a token is stored under; it
+// also hashes operator credentials
+func HashEnrollmentToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueEnrollmentToken creates a single-use token that registers one gateway
+// for operatorID in region. The token is returned only here.
+func (r *Registry) IssueEnrollmentToken(
+	ctx context.Context,
+	operatorID string,
+	region string,
+	createdBy string,
+	ttl time.Duration,
+	now time.Time,
+) (string, *db.EnrollmentToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	stored, err := r.db.CreateEnrollmentToken(ctx, HashEnrollmentToken(token), operatorID, region, createdBy, now.Add(ttl))
+	if err != nil {
+		return "", nil, err
+	}
+	return token, stored, nil
+}
+
+// Enroll redeems token and registers reg for the token's operator and
+// region, which replace any in reg. Redemption is atomic, so a token
+// registers at most one gateway. If registration fails, or reg's public key
+// is already registered, the token is released for a retry.
+func (r *Registry) Enroll(ctx context.Context, token string, reg *Registration, now time.Time) (*RegistrationResult, *db.EnrollmentToken, error) {
+	redeemed, err := r.db.RedeemEnrollmentToken(ctx, HashEnrollmentToken(token), now)
+	if err != nil {
+		return nil, nil, err
+	}
+	reg.OperatorID = redeemed.OperatorID
+	reg.Region = redeemed.Region
+	reg.Confirmation = nil
+
+	result, err := r.register(ctx, reg)
+	if err == nil && result.Outcome != OutcomeCreated {
+		err = ErrAlreadyRegistered
+	}
+	if err != nil {
+		if releaseErr := r.db.ReleaseEnrollmentToken(ctx, redeemed.ID); releaseErr != nil {
+			log.Printf("enrollment token %s could not be released: %v", redeemed.ID, releaseErr)
+		}
+		return nil, nil, err
+	}
+
+	// The gateway exists either way; the link is for operators' records
+	if err := r.db.CompleteEnrollment(ctx, redeemed.ID, result.GatewayID); err != nil {
+		log.Printf("enrollment token %s not linked to gateway %s: %v", redeemed.ID, result.GatewayID, err)
+	} else {
+		redeemed.GatewayID = &result.GatewayID
+	}
+	return result, redeemed, nil
+}
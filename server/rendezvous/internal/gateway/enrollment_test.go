@@ -0,0 +1,163 @@
+package gateway
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+var redeemedTokenColumns = []string{"id", "operator_id", "region", "created_by", "created_at", "expires_at", "used_at"}
+
+func redeemedTokenRows(now time.Time) *sqlmock.Rows {
+	return sqlmock.NewRows(redeemedTokenColumns).
+		AddRow("tok-1", "op-enrolled", "me-south-1", "admin", now.Add(-time.Hour), now.Add(time.Hour), now)
+}
+
+func TestEnroll_UsesTokenOperatorAndRegion(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{})
+	now := time.Now().UTC()
+	token := "enrollment-token"
+
+	mock.ExpectQuery(`UPDATE gateway_enrollment_tokens SET used_at`).
+		WithArgs(HashEnrollmentToken(token), now).
+		WillReturnRows(redeemedTokenRows(now))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).
+		WithArgs(sqlmock.AnyArg(), "192.0.2.1", 443, sqlmock.AnyArg(), sqlmock.AnyArg(), "me-south-1",
+			nil, nil, "op-enrolled", ApprovalApproved, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-1"))
+	mock.ExpectCommit()
+	mock.ExpectExec(`UPDATE gateway_enrollment_tokens SET gateway_id`).
+		WithArgs("tok-1", "gw-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// The agent cannot choose its operator or region
+	result, redeemed, err := registry.Enroll(context.Background(), token, testRegistration("op-other", "192.0.2.1"), now)
+	if err != nil {
+		t.Fatalf("Enroll: %v", err)
+	}
+	if result.GatewayID != "gw-1" || result.Outcome != OutcomeCreated {
+		t.Errorf("result: got %+v", result)
+	}
+	if redeemed.GatewayID == nil || *redeemed.GatewayID != "gw-1" {
+		t.Errorf("token gateway: got %v, want gw-1", redeemed.GatewayID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEnroll_RejectedTokens(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name   string
+		usedAt driver.Value
+		found  bool
+		want   error
+	}{
+		{"unknown", nil, false, db.ErrEnrollmentTokenInvalid},
+		{"used", now.Add(-time.Minute), true, db.ErrEnrollmentTokenUsed},
+		{"expired", nil, true, db.ErrEnrollmentTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, mock := newTestRegistry(t, QuotaConfig{})
+			mock.ExpectQuery(`UPDATE gateway_enrollment_tokens SET used_at`).
+				WillReturnRows(sqlmock.NewRows(redeemedTokenColumns))
+			rows := sqlmock.NewRows([]string{"used_at"})
+			if tt.found {
+				rows.AddRow(tt.usedAt)
+			}
+			mock.ExpectQuery(`SELECT used_at FROM gateway_enrollment_tokens`).WillReturnRows(rows)
+
+			_, _, err := registry.Enroll(context.Background(), "token", testRegistration("", "192.0.2.1"), now)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Enroll: got %v, want %v", err, tt.want)
+			}
+			// Nothing is registered
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestEnroll_ExistingKeyReleasesToken(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{})
+	now := time.Now().UTC()
+	reg := testRegistration("", "192.0.2.1")
+
+	mock.ExpectQuery(`UPDATE gateway_enrollment_tokens SET used_at`).WillReturnRows(redeemedTokenRows(now))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT id FROM gateways WHERE public_key`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-old"))
+	mock.ExpectRollback()
+	mock.ExpectQuery(`WHERE id = \$1`).WillReturnRows(existingGatewayRows("gw-old", reg.PublicKey, "op-enrolled", "192.0.2.1"))
+	mock.ExpectExec(`UPDATE gateway_enrollment_tokens SET used_at = NULL`).
+		WithArgs("tok-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, _, err := registry.Enroll(context.Background(), "token", reg, now)
+	if !errors.Is(err, ErrAlreadyRegistered) {
+		t.Errorf("Enroll: got %v, want ErrAlreadyRegistered", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEnroll_ConcurrentRedemptionRegistersOnce(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{})
+	mock.MatchExpectationsInOrder(false)
+	now := time.Now().UTC()
+	const agents = 8
+
+	// The database lets exactly one conditional update claim the token
+	mock.ExpectQuery(`UPDATE gateway_enrollment_tokens SET used_at`).WillReturnRows(redeemedTokenRows(now))
+	for i := 1; i < agents; i++ {
+		mock.ExpectQuery(`UPDATE gateway_enrollment_tokens SET used_at`).WillReturnRows(sqlmock.NewRows(redeemedTokenColumns))
+		mock.ExpectQuery(`SELECT used_at FROM gateway_enrollment_tokens`).
+			WillReturnRows(sqlmock.NewRows([]string{"used_at"}).AddRow(now))
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-1"))
+	mock.ExpectCommit()
+	mock.ExpectExec(`UPDATE gateway_enrollment_tokens SET gateway_id`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, agents)
+	for i := 0; i < agents; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := registry.Enroll(context.Background(), "token", testRegistration("", "192.0.2.1"), now)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded, used := 0, 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, db.ErrEnrollmentTokenUsed):
+			used++
+		default:
+			t.Errorf("Enroll: unexpected error %v", err)
+		}
+	}
+	if succeeded != 1 || used != agents-1 {
+		t.Errorf("got %d enrolled and %d refused as used, want 1 and %d", succeeded, used, agents-1)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
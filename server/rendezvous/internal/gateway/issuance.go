@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// IssuanceCounter counts, per gateway and hour, the config packs that listed
+// the gateway. Counts are kept in memory and added to the database on each
+// flush; no client information is recorded.
+type IssuanceCounter struct {
+	db    *db.Database
+	clock clock.Clock
+
+	mu     sync.Mutex
+	counts map[time.Time]map[string]int64 // By hour, then gateway ID
+}
+
+// NewIssuanceCounter creates an issuance counter
+func NewIssuanceCounter(database *db.Database) *IssuanceCounter {
+	return &IssuanceCounter{db: database, clock: clock.Real{}, counts: map[time.Time]map[string]int64{}}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (c *IssuanceCounter) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// Record counts one pack listing the given gateways in the current hour
+func (c *IssuanceCounter) Record(gatewayIDs []string) {
+	if len(gatewayIDs) == 0 {
+		return
+	}
+	hour := c.clock.Now().UTC().Truncate(time.Hour)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	byGateway := c.counts[hour]
+	if byGateway == nil {
+		byGateway = map[string]int64{}
+		c.counts[hour] = byGateway
+	}
+	for _, id := range gatewayIDs {
+		byGateway[id]++
+	}
+}
+
+// Flush adds the counts recorded since the last flush to the database. Counts
+// that fail to be written are kept for the next flush.
+func (c *IssuanceCounter) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	pending := c.counts
+	c.counts = map[time.Time]map[string]int64{}
+	c.mu.Unlock()
+
+	for hour, counts := range pending {
+		if err := c.db.RecordGatewayIssuance(ctx, hour, counts); err != nil {
+			c.restore(pending)
+			return err
+		}
+		delete(pending, hour)
+	}
+	return nil
+}
+
+// restore merges unwritten counts back into the pending ones
+func (c *IssuanceCounter) restore(unwritten map[time.Time]map[string]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for hour, counts := range unwritten {
+		byGateway := c.counts[hour]
+		if byGateway == nil {
+			byGateway = map[string]int64{}
+			c.counts[hour] = byGateway
+		}
+		for id, n := range counts {
+			byGateway[id] += n
+		}
+	}
+}
+
+// Start flushes counts every interval until ctx is cancelled, then flushes
+// once more.
+func (c *IssuanceCounter) Start(ctx context.Context, interval time.Duration) {
+	ticker := c.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := c.Flush(flushCtx); err != nil {
+				log.Printf("final gateway issuance flush failed: %v", err)
+			}
+			return
+		case <-ticker.C():
+			if err := c.Flush(ctx); err != nil {
+				log.Printf("gateway issuance flush failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+func TestIssuanceCounter_FlushesPerHour(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	fake := clock.NewFake(time.Date(2026, 3, 1, 10, 59, 0, 0, time.UTC))
+	counter := NewIssuanceCounter(db.NewFromPool(sqlDB))
+	counter.SetClock(fake)
+	counter.Record([]string{"gw-1", "gw-2"})
+	counter.Record([]string{"gw-1"})
+	counter.Record(nil)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO gateway_issuance_counts`).
+		WithArgs("gw-1", time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO gateway_issuance_counts`).
+		WithArgs("gw-2", time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.MatchExpectationsInOrder(false)
+
+	if err := counter.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	// Nothing new to write
+	if err := counter.Flush(context.Background()); err != nil {
+		t.Fatalf("second Flush: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIssuanceCounter_KeepsCountsAfterFailedFlush(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	hour := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(hour)
+	counter := NewIssuanceCounter(db.NewFromPool(sqlDB))
+	counter.SetClock(fake)
+	counter.Record([]string{"gw-1"})
+
+	mock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+	if err := counter.Flush(context.Background()); err == nil {
+		t.Fatal("Flush succeeded without a database")
+	}
+
+	// Packs issued meanwhile add to the kept count
+	counter.Record([]string{"gw-1"})
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO gateway_issuance_counts`).WithArgs("gw-1", hour, int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := counter.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
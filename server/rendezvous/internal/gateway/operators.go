@@ -0,0 +1,44 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+
+	"rendezvous/internal/db"
+)
+
+// IssueOperatorCredential creates a credential operatorID authenticates
+// with when registering gateways. The token is returned only here and
+// stored as its SHA-256, like an enrollment token.
+func (r *Registry) IssueOperatorCredential(ctx context.Context, operatorID, createdBy string) (string, *db.OperatorCredential, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	stored, err := r.db.CreateOperatorCredential(ctx, HashEnrollmentToken(token), operatorID, createdBy)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, stored, nil
+}
+
+// AuthenticateOperatorCredential returns the operator an unrevoked
+// credential was issued to, or db.ErrOperatorCredentialInvalid.
+func (r *Registry) AuthenticateOperatorCredential(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return "", db.ErrOperatorCredentialInvalid
+	}
+	credential, err := r.db.GetOperatorCredential(ctx, HashEnrollmentToken(token))
+	if err != nil {
+		return "", err
+	}
+	return credential.OperatorID, nil
+}
+
+// RevokeOperatorCredential revokes a credential; requests made with it fail
+// from then on.
+func (r *Registry) RevokeOperatorCredential(ctx context.Context, id string) (*db.OperatorCredential, error) {
+	return r.db.RevokeOperatorCredential(ctx, id, r.clock.Now())
+}
@@ -0,0 +1,49 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+func TestOperatorCredential_IssueAndAuthenticate(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{})
+	mock.ExpectQuery(`INSERT INTO operator_credentials`).
+		WithArgs(sqlmock.AnyArg(), "op-1", "admin").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("cred-1", time.Now()))
+
+	token, credential, err := registry.IssueOperatorCredential(context.Background(), "op-1", "admin")
+	if err != nil {
+		t.Fatalf("IssueOperatorCredential: %v", err)
+	}
+	if token == "" || credential.ID != "cred-1" || credential.OperatorID != "op-1" {
+		t.Fatalf("got token %q, credential %+v", token, credential)
+	}
+
+	// Only the hash is looked up
+	mock.ExpectQuery(`FROM operator_credentials`).
+		WithArgs(HashEnrollmentToken(token)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "operator_id", "created_by", "created_at"}).
+			AddRow("cred-1", "op-1", "admin", time.Now()))
+	operatorID, err := registry.AuthenticateOperatorCredential(context.Background(), token)
+	if err != nil || operatorID != "op-1" {
+		t.Errorf("AuthenticateOperatorCredential: got %q, %v", operatorID, err)
+	}
+
+	// A revoked or unknown credential is not found
+	mock.ExpectQuery(`FROM operator_credentials`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	if _, err := registry.AuthenticateOperatorCredential(context.Background(), token); !errors.Is(err, db.ErrOperatorCredentialInvalid) {
+		t.Errorf("revoked credential: got %v, want ErrOperatorCredentialInvalid", err)
+	}
+	// An empty token never reaches the database
+	if _, err := registry.AuthenticateOperatorCredential(context.Background(), ""); !errors.Is(err, db.ErrOperatorCredentialInvalid) {
+		t.Errorf("empty token: got %v, want ErrOperatorCredentialInvalid", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/notify"
+)
+
+// Reaper periodically marks operator gateways that stopped sending heartbeats
+// as offline and tells their operators.
+type Reaper struct {
+	db         *db.Database
+	staleAfter time.Duration
+	events     notify.OperatorEmitter
+	clock      clock.Clock
+}
+
+// NewReaper creates a reaper that treats gateways as offline after
+// LUMENLINK_GATEWAY_STALE_AFTER_MINUTES without a heartbeat.
+func NewReaper(database *db.Database) *Reaper {
+	return &Reaper{
+		db:         database,
+		staleAfter: time.Duration(envInt("LUMENLINK_GATEWAY_STALE_AFTER_MINUTES", 15)) * time.Minute,
+		events:     notify.NopEmitter{},
+		clock:      clock.Real{},
+	}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (r *Reaper) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// SetEvents attaches the sink for operator events
+func (r *Reaper) SetEvents(events notify.OperatorEmitter) {
+	r.events = events
+}
+
+// Run marks stale gateways offline once and returns how many it marked. A
+// gateway's next heartbeat sets its status again.
+func (r *Reaper) Run(ctx context.Context, now time.Time) (int, error) {
+	stale, err := r.db.MarkStaleGatewaysOffline(ctx, now.Add(-r.staleAfter))
+	if err != nil {
+		return 0, err
+	}
+	for _, gw := range stale {
+		details := map[string]interface{}{"stale_after_minutes": int(r.staleAfter.Minutes())}
+		if gw.LastSeen != nil {
+			details["last_seen"] = gw.LastSeen.UTC().Format(time.RFC3339)
+		}
+		r.events.Emit(notify.OperatorEvent{
+			Type:       notify.EventGatewayOffline,
+			OperatorID: gw.OperatorID,
+			GatewayID:  gw.ID,
+			Message:    fmt.Sprintf("Gateway %s stopped reporting and was marked offline", gw.ID),
+			Details:    details,
+			OccurredAt: now.UTC(),
+		})
+	}
+	return len(stale), nil
+}
+
+// Start reaps stale gateways every interval until ctx is cancelled.
+func (r *Reaper) Start(ctx context.Context, interval time.Duration) {
+	ticker := r.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			marked, err := r.Run(ctx, r.clock.Now())
+			if err != nil {
+				log.Printf("gateway reaper failed: %v", err)
+				continue
+			}
+			if marked > 0 {
+				log.Printf("gateway reaper marked %d gateways offline", marked)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/notify"
+)
+
+// recordingEmitter keeps the operator events it is given
+type recordingEmitter struct {
+	mu     sync.Mutex
+	events []notify.OperatorEvent
+}
+
+func (e *recordingEmitter) Emit(event notify.OperatorEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+}
+
+func TestReaper_MarksStaleGatewaysAndEmits(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	lastSeen := now.Add(-time.Hour)
+	mock.ExpectQuery(`UPDATE gateways SET status = 'offline'`).
+		WithArgs(now.Add(-15 * time.Minute)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "operator_id", "last_seen"}).
+			AddRow("gw-1", "op-1", lastSeen).
+			AddRow("gw-2", "op-2", lastSeen))
+
+	reaper := NewReaper(db.NewFromPool(sqlDB))
+	reaper.staleAfter = 15 * time.Minute
+	events := &recordingEmitter{}
+	reaper.SetEvents(events)
+
+	marked, err := reaper.Run(context.Background(), now)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if marked != 2 || len(events.events) != 2 {
+		t.Fatalf("marked %d, emitted %d; want 2 and 2", marked, len(events.events))
+	}
+	event := events.events[0]
+	if event.Type != notify.EventGatewayOffline || event.OperatorID != "op-1" || event.GatewayID != "gw-1" {
+		t.Errorf("event: got %+v", event)
+	}
+	if event.Details["last_seen"] != lastSeen.Format(time.RFC3339) {
+		t.Errorf("last_seen: got %v", event.Details["last_seen"])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBandwidthCapEvent(t *testing.T) {
+	capMbps := 100
+	withCap := &db.Gateway{ID: "gw-1", OperatorID: "op-1", BandwidthMbps: &capMbps}
+	tests := []struct {
+		name     string
+		gw       *db.Gateway
+		usedMbps int
+		want     bool
+	}{
+		{"below the warning", withCap, 89, false},
+		{"at the warning", withCap, 90, true},
+		{"over the cap", withCap, 120, true},
+		{"no declared bandwidth", &db.Gateway{ID: "gw-2", OperatorID: "op-1"}, 500, false},
+		{"no operator", &db.Gateway{ID: "gw-3", BandwidthMbps: &capMbps}, 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, ok := BandwidthCapEvent(tt.gw, tt.usedMbps, 90, time.Now())
+			if ok != tt.want {
+				t.Fatalf("got %v, want %v", ok, tt.want)
+			}
+			if ok && (event.Type != notify.EventBandwidthCap || event.OperatorID != "op-1") {
+				t.Errorf("event: got %+v", event)
+			}
+		})
+	}
+}
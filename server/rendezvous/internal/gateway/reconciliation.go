@@ -0,0 +1,239 @@
+package gateway
+
+import (
+	"context"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// UserCountPolicy controls the reconciliation of the users_connected
+// gateways report against independent signals: config packs that listed the
+// gateway and connections clients confirmed. A gateway may inflate its count
+// to look more important on the community page.
+type UserCountPolicy struct {
+	WindowHours          int     // Hours of reports considered
+	MinHours             int     // Gateways that reported in fewer hours are not judged
+	SessionHours         int     // Packs issued this many hours back still account for connected users
+	UsersPerPack         float64 // Connected users one issued pack can account for
+	UsersPerConfirmation float64 // Users one confirmed connection stands for; telemetry is opt-in
+	Slack                int     // Users any gateway may report whatever the signals
+	Tolerance            float64 // Relative headroom over the signal estimate
+	Persistence          float64 // Share of judged hours over the bound at which a gateway is flagged
+	DismissalHours       int     // Hours a dismissed finding keeps the gateway from being flagged again
+}
+
+// LoadUserCountPolicyFromEnv reads the reconciliation policy from the
+// environment.
+func LoadUserCountPolicyFromEnv() UserCountPolicy {
+	return UserCountPolicy{
+		WindowHours:          envInt("LUMENLINK_RECONCILIATION_WINDOW_HOURS", 24),
+		MinHours:             envInt("LUMENLINK_RECONCILIATION_MIN_HOURS", 6),
+		SessionHours:         envInt("LUMENLINK_RECONCILIATION_SESSION_HOURS", 6),
+		UsersPerPack:         envFloat("LUMENLINK_RECONCILIATION_USERS_PER_PACK", 1),
+		UsersPerConfirmation: envFloat("LUMENLINK_RECONCILIATION_USERS_PER_CONFIRMATION", 10),
+		Slack:                envInt("LUMENLINK_RECONCILIATION_SLACK", 5),
+		Tolerance:            envFloat("LUMENLINK_RECONCILIATION_TOLERANCE", 0.5),
+		Persistence:          envFloat("LUMENLINK_RECONCILIATION_PERSISTENCE", 0.5),
+		DismissalHours:       envInt("LUMENLINK_RECONCILIATION_DISMISSAL_HOURS", 168),
+	}
+}
+
+// UserCountReconciliation is the outcome of reconciling one gateway
+type UserCountReconciliation struct {
+	Plausibility   float64 // Share of reported users the signals account for, 0-1
+	PlausibleUsers int     // Highest hourly bound; the community page cap while flagged
+	Hours          int     // Hours the gateway reported in
+	ExceededHours  int     // Hours the report exceeded the bound
+	Judged         bool    // False when the gateway reported in fewer than MinHours hours
+	Flagged        bool
+}
+
+// ReconcileUserCounts compares one gateway's hourly reports, ordered by hour,
+// with its signals. For each hour it reported, the plausible bound is
+//
+//	ceil(max(UsersPerPack*packs, UsersPerConfirmation*confirmations) * (1+Tolerance)) + Slack
+//
+// where packs counts those issued over the last SessionHours hours. The
+// gateway is flagged when at least Persistence of its hours exceed the bound,
+// so a noisy but honest gateway that spikes now and then is left alone.
+func ReconcileUserCounts(hours []*db.GatewayUserHour, policy UserCountPolicy) UserCountReconciliation {
+	var result UserCountReconciliation
+	var reported, plausible float64
+	session := time.Duration(policy.SessionHours) * time.Hour
+	for i, h := range hours {
+		if !h.Reports {
+			continue
+		}
+		var issued int64
+		for j := i; j >= 0 && h.Hour.Sub(hours[j].Hour) < session; j-- {
+			issued += hours[j].Issued
+		}
+		estimate := math.Max(policy.UsersPerPack*float64(issued), policy.UsersPerConfirmation*float64(h.Confirmed))
+		bound := int(math.Ceil(estimate*(1+policy.Tolerance))) + policy.Slack
+
+		result.Hours++
+		if h.Reported > bound {
+			result.ExceededHours++
+		}
+		if bound > result.PlausibleUsers {
+			result.PlausibleUsers = bound
+		}
+		reported += float64(h.Reported)
+		plausible += math.Min(float64(h.Reported), float64(bound))
+	}
+
+	result.Plausibility = 1
+	if reported > 0 {
+		result.Plausibility = math.Round(plausible/reported*1000) / 1000
+	}
+	result.Judged = result.Hours > 0 && result.Hours >= policy.MinHours
+	result.Flagged = result.Judged && float64(result.ExceededHours) >= policy.Persistence*float64(result.Hours)
+	return result
+}
+
+// UserCountReconciler periodically reconciles every gateway's reported user
+// count, flags persistent over-reporters into the review queue and caps
+// their community page count.
+type UserCountReconciler struct {
+	db     *db.Database
+	policy UserCountPolicy
+	clock  clock.Clock
+}
+
+// NewUserCountReconciler creates a reconciler with the policy from the
+// environment.
+func NewUserCountReconciler(database *db.Database) *UserCountReconciler {
+	return &UserCountReconciler{db: database, policy: LoadUserCountPolicyFromEnv(), clock: clock.Real{}}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (r *UserCountReconciler) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// ReconciliationRunResult counts what one reconciliation pass did.
+type ReconciliationRunResult struct {
+	Judged  int
+	Flagged int
+}
+
+// Run reconciles every gateway once and prunes issuance counts the next
+// pass no longer needs. Flagged gateways get an open review item unless an
+// admin dismissed the finding within the last DismissalHours, in which case
+// they are not capped either. Once the dismissal expires, a gateway that
+// still over-reports is flagged again.
+func (r *UserCountReconciler) Run(ctx context.Context, now time.Time) (ReconciliationRunResult, error) {
+	var result ReconciliationRunResult
+	since := now.Add(-time.Duration(r.policy.WindowHours) * time.Hour)
+	dismissedSince := now.Add(-time.Duration(r.policy.DismissalHours) * time.Hour)
+	// Earlier issuance still counts toward the window's first hours
+	hours, err := r.db.GetGatewayUserHours(ctx, since.Add(-time.Duration(r.policy.SessionHours)*time.Hour))
+	if err != nil {
+		return result, err
+	}
+
+	for start := 0; start < len(hours); {
+		end := start + 1
+		for end < len(hours) && hours[end].GatewayID == hours[start].GatewayID {
+			end++
+		}
+		gatewayID := hours[start].GatewayID
+		judged := judgedHours(hours[start:end], since)
+		start = end
+
+		reconciliation := ReconcileUserCounts(judged, r.policy)
+		if reconciliation.Judged {
+			result.Judged++
+		}
+		flagged := reconciliation.Flagged
+		if flagged {
+			dismissed, err := r.db.HasDismissedReviewItemSince(ctx, "gateway", gatewayID, ReasonUserInflation, dismissedSince)
+			if err != nil {
+				return result, err
+			}
+			flagged = !dismissed
+		}
+		if flagged {
+			result.Flagged++
+			_, err := r.db.AddReviewItem(ctx, "gateway", gatewayID, ReasonUserInflation, map[string]interface{}{
+				"plausibility":    reconciliation.Plausibility,
+				"plausible_users": reconciliation.PlausibleUsers,
+				"hours":           reconciliation.Hours,
+				"exceeded_hours":  reconciliation.ExceededHours,
+			})
+			if err != nil {
+				return result, err
+			}
+		}
+		err := r.db.UpsertGatewayReconciliation(ctx, &db.GatewayReconciliation{
+			GatewayID:      gatewayID,
+			Plausibility:   reconciliation.Plausibility,
+			PlausibleUsers: reconciliation.PlausibleUsers,
+			Hours:          reconciliation.Hours,
+			ExceededHours:  reconciliation.ExceededHours,
+			Flagged:        flagged,
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if _, err := r.db.PruneGatewayIssuance(ctx, since.Add(-time.Duration(r.policy.SessionHours)*time.Hour)); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// judgedHours drops the reports before since from one gateway's hours; the
+// issuance in those hours is kept for the session lookback
+func judgedHours(hours []*db.GatewayUserHour, since time.Time) []*db.GatewayUserHour {
+	judged := make([]*db.GatewayUserHour, 0, len(hours))
+	cutoff := since.Truncate(time.Hour)
+	for _, h := range hours {
+		if h.Hour.Before(cutoff) && h.Reports {
+			lookback := *h
+			lookback.Reports = false
+			h = &lookback
+		}
+		judged = append(judged, h)
+	}
+	return judged
+}
+
+// Start reconciles gateways every interval until ctx is cancelled.
+func (r *UserCountReconciler) Start(ctx context.Context, interval time.Duration) {
+	ticker := r.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			result, err := r.Run(ctx, r.clock.Now())
+			if err != nil {
+				log.Printf("gateway user count reconciliation failed: %v", err)
+				continue
+			}
+			if result.Flagged > 0 {
+				log.Printf("gateway user count reconciliation flagged %d of %d gateways", result.Flagged, result.Judged)
+			}
+		}
+	}
+}
+
+func envFloat(key string, defaultValue float64) float64 {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil && f >= 0 {
+			return f
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,225 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+var reconcileStart = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func testUserCountPolicy() UserCountPolicy {
+	return UserCountPolicy{
+		WindowHours:          24,
+		MinHours:             6,
+		SessionHours:         6,
+		UsersPerPack:         1,
+		UsersPerConfirmation: 10,
+		Slack:                5,
+		Tolerance:            0.5,
+		Persistence:          0.5,
+		DismissalHours:       168,
+	}
+}
+
+// userHours builds n consecutive hours of one gateway from a pattern
+func userHours(n int, pattern func(i int) (reported int, issued, confirmed int64)) []*db.GatewayUserHour {
+	hours := make([]*db.GatewayUserHour, n)
+	for i := range hours {
+		reported, issued, confirmed := pattern(i)
+		hours[i] = &db.GatewayUserHour{
+			GatewayID: "gw",
+			Hour:      reconcileStart.Add(time.Duration(i) * time.Hour),
+			Reported:  reported,
+			Reports:   true,
+			Issued:    issued,
+			Confirmed: confirmed,
+		}
+	}
+	return hours
+}
+
+func TestReconcileUserCounts(t *testing.T) {
+	tests := []struct {
+		name         string
+		hours        []*db.GatewayUserHour
+		want         UserCountReconciliation
+		minPlausible float64
+		maxPlausible float64
+	}{
+		{
+			name: "honest: reports track issuance and confirmations",
+			hours: userHours(24, func(i int) (int, int64, int64) {
+				return 30, 10, 3
+			}),
+			want:         UserCountReconciliation{PlausibleUsers: 95, Hours: 24, ExceededHours: 0, Judged: true},
+			minPlausible: 1, maxPlausible: 1,
+		},
+		{
+			name: "noisy: occasional spikes above the signals",
+			hours: userHours(24, func(i int) (int, int64, int64) {
+				reported := 25 + (i*7)%11 // 25-35
+				if i%8 == 3 {
+					reported = 200
+				}
+				return reported, 8 + int64(i%3), int64(2 + i%2)
+			}),
+			want:         UserCountReconciliation{PlausibleUsers: 86, Hours: 24, ExceededHours: 3, Judged: true},
+			minPlausible: 0.6, maxPlausible: 0.9,
+		},
+		{
+			name: "inflating: reports far above every signal",
+			hours: userHours(24, func(i int) (int, int64, int64) {
+				return 400, 10, 3
+			}),
+			want:         UserCountReconciliation{PlausibleUsers: 95, Hours: 24, ExceededHours: 24, Judged: true, Flagged: true},
+			minPlausible: 0.1, maxPlausible: 0.25,
+		},
+		{
+			name: "inflating only while unobserved: too few hours to judge",
+			hours: userHours(3, func(i int) (int, int64, int64) {
+				return 400, 0, 0
+			}),
+			want:         UserCountReconciliation{PlausibleUsers: 5, Hours: 3, ExceededHours: 3},
+			minPlausible: 0, maxPlausible: 0.05,
+		},
+		{
+			name: "small gateway without signals stays within the slack",
+			hours: userHours(12, func(i int) (int, int64, int64) {
+				return 4, 0, 0
+			}),
+			want:         UserCountReconciliation{PlausibleUsers: 5, Hours: 12, Judged: true},
+			minPlausible: 1, maxPlausible: 1,
+		},
+		{
+			name: "ramping up: issuance from earlier hours still counts",
+			hours: userHours(12, func(i int) (int, int64, int64) {
+				if i == 0 {
+					return 0, 60, 0
+				}
+				return 60, 0, 0
+			}),
+			// Hours 1-5 see the first hour's packs; hours 6-11 no longer do
+			want:         UserCountReconciliation{PlausibleUsers: 95, Hours: 12, ExceededHours: 6, Judged: true, Flagged: true},
+			minPlausible: 0.5, maxPlausible: 0.6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ReconcileUserCounts(tt.hours, testUserCountPolicy())
+			plausibility := got.Plausibility
+			got.Plausibility = 0
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if plausibility < tt.minPlausible || plausibility > tt.maxPlausible {
+				t.Errorf("plausibility: got %v, want %v-%v", plausibility, tt.minPlausible, tt.maxPlausible)
+			}
+		})
+	}
+}
+
+func TestReconcileUserCounts_SkipsHoursWithoutReports(t *testing.T) {
+	hours := userHours(8, func(i int) (int, int64, int64) { return 400, 0, 0 })
+	for _, h := range hours[:4] {
+		h.Reports = false
+	}
+	got := ReconcileUserCounts(hours, testUserCountPolicy())
+	if got.Hours != 4 || got.Judged {
+		t.Errorf("got %+v, want 4 hours, not judged", got)
+	}
+	if got := ReconcileUserCounts(nil, testUserCountPolicy()); got.Plausibility != 1 || got.Judged {
+		t.Errorf("no hours: got %+v", got)
+	}
+}
+
+func userHourRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"gateway_id", "hour", "max", "issued", "confirmed"})
+}
+
+func TestUserCountReconciler_FlagsInflatingGateway(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	now := reconcileStart.Add(24 * time.Hour)
+	rows := userHourRows()
+	// An hour before the window only contributes its issuance
+	rows.AddRow("gw-honest", reconcileStart.Add(-time.Hour), 900, 5, 0)
+	for i := 0; i < 24; i++ {
+		rows.AddRow("gw-honest", reconcileStart.Add(time.Duration(i)*time.Hour), 30, 10, 3)
+	}
+	for i := 0; i < 24; i++ {
+		rows.AddRow("gw-inflating", reconcileStart.Add(time.Duration(i)*time.Hour), 400, 10, 3)
+	}
+	mock.ExpectQuery(`FROM operator_metrics`).WithArgs(reconcileStart.Add(-6 * time.Hour)).WillReturnRows(rows)
+	mock.ExpectExec(`INSERT INTO gateway_user_reconciliation`).
+		WithArgs("gw-honest", 1.0, 95, 24, 0, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("gateway", "gw-inflating", ReasonUserInflation, now.Add(-168*time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`INSERT INTO review_queue`).
+		WithArgs("gateway", "gw-inflating", ReasonUserInflation, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO gateway_user_reconciliation`).
+		WithArgs("gw-inflating", sqlmock.AnyArg(), 95, 24, 24, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM gateway_issuance_counts`).WithArgs(reconcileStart.Add(-6 * time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 12))
+
+	reconciler := NewUserCountReconciler(db.NewFromPool(sqlDB))
+	reconciler.policy = testUserCountPolicy()
+
+	result, err := reconciler.Run(context.Background(), now)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result != (ReconciliationRunResult{Judged: 2, Flagged: 1}) {
+		t.Errorf("result: got %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUserCountReconciler_DismissalLiftsCap(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	rows := userHourRows()
+	for i := 0; i < 24; i++ {
+		rows.AddRow("gw-inflating", reconcileStart.Add(time.Duration(i)*time.Hour), 400, 10, 3)
+	}
+	mock.ExpectQuery(`FROM operator_metrics`).WillReturnRows(rows)
+	// Only a dismissal within the last week holds
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("gateway", "gw-inflating", ReasonUserInflation, reconcileStart.Add(24*time.Hour-168*time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec(`INSERT INTO gateway_user_reconciliation`).
+		WithArgs("gw-inflating", sqlmock.AnyArg(), 95, 24, 24, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM gateway_issuance_counts`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	reconciler := NewUserCountReconciler(db.NewFromPool(sqlDB))
+	reconciler.policy = testUserCountPolicy()
+
+	result, err := reconciler.Run(context.Background(), reconcileStart.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Flagged != 0 {
+		t.Errorf("dismissed gateway was flagged again: %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
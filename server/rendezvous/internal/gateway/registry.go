@@ -0,0 +1,514 @@
+package gateway
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// Approval states stored in gateways.approval_status
+const (
+	ApprovalApproved = "approved"
+	ApprovalPending  = "pending"
+	ApprovalRejected = "rejected"
+)
+
+// Review queue reasons raised by the registry, the cluster audit, the
+// suspicion scorer and the user count reconciler
+const (
+	ReasonOperatorQuota     = "operator_quota_exceeded"
+	ReasonSubnetQuota       = "subnet_quota_exceeded"
+	ReasonSequentialIPs     = "sequential_ips"
+	ReasonASNTransportSet   = "asn_transport_cluster"
+	ReasonHoneypotSuspicion = "honeypot_suspicion"
+	ReasonUserInflation     = "user_count_inflation"
+)
+
+// Registration outcomes
+const (
+	OutcomeCreated              = "created"
+	OutcomeAlreadyExists        = "already_exists"
+	OutcomeConfirmationRequired = "confirmation_required"
+	OutcomeUpdated              = "updated"
+)
+
+// confirmationMaxSkew bounds how old (or how far in the future) a signed
+// re-registration confirmation or gateway request may be.
+const confirmationMaxSkew = 5 * time.Minute
+
+var (
+	// ErrInvalidAddress is returned when a gateway IP address cannot be parsed.
+	ErrInvalidAddress = apperr.New(apperr.ErrInvalidInput, "invalid_ip_address", "invalid gateway address")
+	// ErrInvalidConfirmation is returned when a re-registration confirmation is
+	// stale or not signed by the gateway's registered key.
+	ErrInvalidConfirmation = apperr.New(apperr.ErrUnauthorized, "invalid_confirmation", "invalid re-registration confirmation")
+	// ErrInvalidRequestSignature is returned when a gateway request is stale,
+	// unsigned, or not signed by the gateway's registered key.
+	ErrInvalidRequestSignature = apperr.New(apperr.ErrUnauthorized, "invalid_signature", "invalid gateway request signature")
+	// ErrInvalidKeyProof is returned when a registration is stale or not
+	// signed by the key it registers.
+	ErrInvalidKeyProof = apperr.New(apperr.ErrUnauthorized, "invalid_key_proof", "registration not signed by the gateway key")
+)
+
+// QuotaConfig holds the soft registration limits used to limit Sybil capacity.
+type QuotaConfig struct {
+	MaxPerOperator int // Non-rejected gateways one operator may register before approval is required
+	MaxPerSubnet   int // Non-rejected gateways allowed in one /24 (IPv4) or /48 (IPv6)
+}
+
+// LoadQuotaConfigFromEnv reads quota limits from the environment.
+func LoadQuotaConfigFromEnv() QuotaConfig {
+	return QuotaConfig{
+		MaxPerOperator: envInt("LUMENLINK_MAX_GATEWAYS_PER_OPERATOR", 10),
+		MaxPerSubnet:   envInt("LUMENLINK_MAX_GATEWAYS_PER_SUBNET", 3),
+	}
+}
+
+// Registration describes a gateway registration request.
+type Registration struct {
+	OperatorID        string
+	PublicKey         []byte
+	IPAddress         string
+	Port              int
+	TransportTypes    []string
+	DiscoveryChannels []string
+	Region            string
+	BandwidthMbps     *int
+	MaxUsers          *int
+	ASN               *int
+	Confirmation      *Confirmation // Required to change an existing gateway's attributes
+
+	// KeyProof shows the registrant holds PublicKey's private key, signed
+	// over RegistrationMessage
+	KeyProof *Confirmation
+}
+
+// Confirmation is a signature with the gateway's ed25519 key: over
+// ConfirmationMessage to confirm a re-registration, or over
+// RegistrationMessage as a registration's key proof.
+type Confirmation struct {
+	Timestamp int64 // Unix seconds
+	Signature []byte
+}
+
+// RegistrationResult reports the outcome of a registration.
+type RegistrationResult struct {
+	Outcome        string
+	GatewayID      string
+	ApprovalStatus string
+	QuotaReasons   []string // Quotas that were exceeded, if approval is pending
+}
+
+// Registry handles gateway registration and the Sybil quotas around it
+type Registry struct {
+	db     *db.Database
+	quotas QuotaConfig
+	clock  clock.Clock
+}
+
+// NewRegistry creates a new gateway registry
+func NewRegistry(database *db.Database) *Registry {
+	return &Registry{
+		db:     database,
+		quotas: LoadQuotaConfigFromEnv(),
+		clock:  clock.Real{},
+	}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (r *Registry) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Register stores a new gateway. Registrations that exceed the operator or subnet
+// quota are still stored, but as pending, and an item is added to the review queue;
+// pending gateways are never selected into config packs until an admin approves them.
+//
+// Registering a public key that already exists is idempotent when every attribute
+// matches (OutcomeAlreadyExists). If any attribute differs, nothing is changed
+// (OutcomeConfirmationRequired) unless the registration carries a Confirmation
+// signed by the gateway key, in which case the stored attributes are replaced
+// (OutcomeUpdated).
+//
+// The operator is the one the caller authenticated as, and the registration
+// must carry a KeyProof, so no one can register a key they do not hold or
+// count against another operator's quota.
+//
+// The quota is soft: two concurrent registrations can both observe a count just
+// under the limit. The cluster audit catches anything that slips through.
+func (r *Registry) Register(ctx context.Context, reg *Registration) (*RegistrationResult, error) {
+	if err := verifyKeyProof(reg, r.clock.Now()); err != nil {
+		return nil, err
+	}
+	return r.register(ctx, reg)
+}
+
+// register stores a registration whose operator and key are already vouched
+// for, by the caller's credential and key proof or by an enrollment token
+func (r *Registry) register(ctx context.Context, reg *Registration) (*RegistrationResult, error) {
+	subnet, err := SubnetOf(reg.IPAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	reasons, err := r.quotaReasons(ctx, reg, subnet)
+	if err != nil {
+		return nil, err
+	}
+
+	status := ApprovalApproved
+	if len(reasons) > 0 {
+		status = ApprovalPending
+	}
+
+	id, created, err := r.db.InsertGateway(ctx, newGateway(reg, status), review(reg, subnet, reasons))
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return r.reregister(ctx, id, reg, subnet, reasons)
+	}
+
+	return &RegistrationResult{
+		Outcome:        OutcomeCreated,
+		GatewayID:      id,
+		ApprovalStatus: status,
+		QuotaReasons:   reasons,
+	}, nil
+}
+
+// reregister handles a registration for a public key that is already stored.
+func (r *Registry) reregister(
+	ctx context.Context,
+	id string,
+	reg *Registration,
+	subnet string,
+	reasons []string,
+) (*RegistrationResult, error) {
+	existing, err := r.db.GetGatewayByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if sameRegistration(existing, reg) {
+		return &RegistrationResult{
+			Outcome:        OutcomeAlreadyExists,
+			GatewayID:      id,
+			ApprovalStatus: existing.ApprovalStatus,
+		}, nil
+	}
+	if reg.Confirmation == nil {
+		return &RegistrationResult{
+			Outcome:        OutcomeConfirmationRequired,
+			GatewayID:      id,
+			ApprovalStatus: existing.ApprovalStatus,
+		}, nil
+	}
+	if err := verifyConfirmation(existing.PublicKey, id, reg, r.clock.Now()); err != nil {
+		return nil, err
+	}
+
+	// The existing gateway already counts toward its own operator and subnet,
+	// so only quotas it is moving into apply.
+	var applicable []string
+	for _, reason := range reasons {
+		switch reason {
+		case ReasonOperatorQuota:
+			if reg.OperatorID == existing.OperatorID {
+				continue
+			}
+		case ReasonSubnetQuota:
+			if existingSubnet, err := SubnetOf(existing.IPAddress); err == nil && existingSubnet == subnet {
+				continue
+			}
+		}
+		applicable = append(applicable, reason)
+	}
+
+	status := existing.ApprovalStatus
+	if status != ApprovalRejected && len(applicable) > 0 {
+		status = ApprovalPending
+	}
+	if err := r.db.UpdateGatewayRegistration(ctx, id, newGateway(reg, status), review(reg, subnet, applicable)); err != nil {
+		return nil, err
+	}
+
+	return &RegistrationResult{
+		Outcome:        OutcomeUpdated,
+		GatewayID:      id,
+		ApprovalStatus: status,
+		QuotaReasons:   applicable,
+	}, nil
+}
+
+// quotaReasons returns the quotas a registration would exceed.
+func (r *Registry) quotaReasons(ctx context.Context, reg *Registration, subnet string) ([]string, error) {
+	var reasons []string
+	if reg.OperatorID != "" && r.quotas.MaxPerOperator > 0 {
+		count, err := r.db.CountGatewaysByOperator(ctx, reg.OperatorID)
+		if err != nil {
+			return nil, err
+		}
+		if count >= r.quotas.MaxPerOperator {
+			reasons = append(reasons, ReasonOperatorQuota)
+		}
+	}
+	if r.quotas.MaxPerSubnet > 0 {
+		count, err := r.db.CountGatewaysInSubnet(ctx, subnet)
+		if err != nil {
+			return nil, err
+		}
+		if count >= r.quotas.MaxPerSubnet {
+			reasons = append(reasons, ReasonSubnetQuota)
+		}
+	}
+	return reasons, nil
+}
+
+// review returns the review items a registration over quota opens, nil if
+// it is within quota
+func review(reg *Registration, subnet string, reasons []string) *db.GatewayReview {
+	if len(reasons) == 0 {
+		return nil
+	}
+	return &db.GatewayReview{
+		Reasons: reasons,
+		Details: map[string]interface{}{
+			"operator_id": reg.OperatorID,
+			"ip_address":  reg.IPAddress,
+			"subnet":      subnet,
+		},
+	}
+}
+
+// ConfirmationMessage returns the message a gateway signs to confirm a
+// re-registration that changes its stored attributes. It covers every
+// attribute the registration replaces: transport types and discovery
+// channels sorted and comma-separated, and unset capacities and ASN empty.
+func ConfirmationMessage(gatewayID string, reg *Registration, timestamp int64) []byte {
+	return []byte(fmt.Sprintf("lumenlink-gateway-reregister\n%s\n%s\n%s\n%d\n%s\n%s\n%s\n%s\n%s\n%s\n%d",
+		gatewayID, reg.OperatorID, reg.IPAddress, reg.Port, reg.Region,
+		sortedList(reg.TransportTypes), sortedList(reg.DiscoveryChannels),
+		optionalInt(reg.BandwidthMbps), optionalInt(reg.MaxUsers), optionalInt(reg.ASN),
+		timestamp))
+}
+
+func sortedList(values []string) string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+func optionalInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.Itoa(*value)
+}
+
+func verifyConfirmation(publicKey []byte, gatewayID string, reg *Registration, now time.Time) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return ErrInvalidConfirmation
+	}
+	signedAt := time.Unix(reg.Confirmation.Timestamp, 0)
+	if signedAt.Before(now.Add(-confirmationMaxSkew)) || signedAt.After(now.Add(confirmationMaxSkew)) {
+		return ErrInvalidConfirmation
+	}
+	message := ConfirmationMessage(gatewayID, reg, reg.Confirmation.Timestamp)
+	if !ed25519.Verify(ed25519.PublicKey(publicKey), message, reg.Confirmation.Signature) {
+		return ErrInvalidConfirmation
+	}
+	return nil
+}
+
+// RegistrationMessage returns the message a registrant signs with the key it
+// registers, to show it holds that key.
+func RegistrationMessage(operatorID string, publicKey []byte, timestamp int64) []byte {
+	return []byte(fmt.Sprintf("lumenlink-gateway-register\n%s\n%s\n%d",
+		operatorID, hex.EncodeToString(publicKey), timestamp))
+}
+
+func verifyKeyProof(reg *Registration, now time.Time) error {
+	if reg.KeyProof == nil || len(reg.PublicKey) != ed25519.PublicKeySize {
+		return ErrInvalidKeyProof
+	}
+	signedAt := time.Unix(reg.KeyProof.Timestamp, 0)
+	if signedAt.Before(now.Add(-confirmationMaxSkew)) || signedAt.After(now.Add(confirmationMaxSkew)) {
+		return ErrInvalidKeyProof
+	}
+	message := RegistrationMessage(reg.OperatorID, reg.PublicKey, reg.KeyProof.Timestamp)
+	if !ed25519.Verify(ed25519.PublicKey(reg.PublicKey), message, reg.KeyProof.Signature) {
+		return ErrInvalidKeyProof
+	}
+	return nil
+}
+
+// RequestMessage returns the message a gateway signs to authenticate a request
+// for its own data at path (e.g. /api/v1/gateway/<id>/metrics).
+func RequestMessage(gatewayID, path string, timestamp int64) []byte {
+	return []byte(fmt.Sprintf("lumenlink-gateway-request\n%s\n%s\n%d", gatewayID, path, timestamp))
+}
+
+// RequestBodyMessage returns the message a gateway signs to authenticate a
+// request with a body: RequestMessage followed by the hex SHA-256 of the body.
+func RequestBodyMessage(gatewayID, path string, timestamp int64, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(fmt.Sprintf("%s\n%s", RequestMessage(gatewayID, path, timestamp), hex.EncodeToString(sum[:])))
+}
+
+// Authenticate verifies that a request for path was signed with gatewayID's
+// registered key within the allowed clock skew. Unknown gateways return
+// ErrInvalidRequestSignature as well, so callers cannot probe for IDs.
+func (r *Registry) Authenticate(ctx context.Context, gatewayID, path string, timestamp int64, signature []byte) error {
+	_, err := r.authenticate(ctx, gatewayID, RequestMessage(gatewayID, path, timestamp), timestamp, signature)
+	return err
+}
+
+// AuthenticateGateway verifies a request like Authenticate and returns the
+// gateway. The request acts for the gateway alone: operators authenticate
+// with their own credential, see AuthenticateOperatorCredential. A non-nil
+// body must be covered by the signature, over RequestBodyMessage.
+func (r *Registry) AuthenticateGateway(
+	ctx context.Context,
+	gatewayID string,
+	path string,
+	body []byte,
+	timestamp int64,
+	signature []byte,
+) (*db.Gateway, error) {
+	message := RequestMessage(gatewayID, path, timestamp)
+	if body != nil {
+		message = RequestBodyMessage(gatewayID, path, timestamp, body)
+	}
+	return r.authenticate(ctx, gatewayID, message, timestamp, signature)
+}
+
+func (r *Registry) authenticate(ctx context.Context, gatewayID string, message []byte, timestamp int64, signature []byte) (*db.Gateway, error) {
+	gw, err := r.db.GetGatewayByID(ctx, gatewayID)
+	if errors.Is(err, db.ErrGatewayNotFound) {
+		return nil, ErrInvalidRequestSignature
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(gw.PublicKey) != ed25519.PublicKeySize {
+		return nil, ErrInvalidRequestSignature
+	}
+	now := r.clock.Now()
+	signedAt := time.Unix(timestamp, 0)
+	if signedAt.Before(now.Add(-confirmationMaxSkew)) || signedAt.After(now.Add(confirmationMaxSkew)) {
+		return nil, ErrInvalidRequestSignature
+	}
+	if !ed25519.Verify(ed25519.PublicKey(gw.PublicKey), message, signature) {
+		return nil, ErrInvalidRequestSignature
+	}
+	return gw, nil
+}
+
+// sameRegistration reports whether a registration repeats the stored attributes.
+func sameRegistration(existing *db.Gateway, reg *Registration) bool {
+	return existing.OperatorID == reg.OperatorID &&
+		sameIP(existing.IPAddress, reg.IPAddress) &&
+		existing.Port == reg.Port &&
+		existing.Region == reg.Region &&
+		sameSet(existing.TransportTypes, reg.TransportTypes) &&
+		sameSet(existing.DiscoveryChannels, reg.DiscoveryChannels) &&
+		sameIntPtr(existing.BandwidthMbps, reg.BandwidthMbps) &&
+		sameIntPtr(existing.MaxUsers, reg.MaxUsers) &&
+		sameIntPtr(existing.ASN, reg.ASN)
+}
+
+func sameIP(stored, requested string) bool {
+	// inet values may come back with a prefix length
+	if i := strings.IndexByte(stored, '/'); i >= 0 {
+		stored = stored[:i]
+	}
+	a := net.ParseIP(strings.TrimSpace(stored))
+	b := net.ParseIP(strings.TrimSpace(requested))
+	return a != nil && b != nil && a.Equal(b)
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameIntPtr(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func newGateway(reg *Registration, status string) *db.NewGateway {
+	return &db.NewGateway{
+		OperatorID:        reg.OperatorID,
+		PublicKey:         reg.PublicKey,
+		IPAddress:         reg.IPAddress,
+		Port:              reg.Port,
+		TransportTypes:    reg.TransportTypes,
+		DiscoveryChannels: reg.DiscoveryChannels,
+		Region:            reg.Region,
+		BandwidthMbps:     reg.BandwidthMbps,
+		MaxUsers:          reg.MaxUsers,
+		ASN:               reg.ASN,
+		ApprovalStatus:    status,
+	}
+}
+
+// SetApproval records an admin approval decision for a pending gateway.
+func (r *Registry) SetApproval(ctx context.Context, gatewayID string, approved bool) error {
+	status := ApprovalRejected
+	if approved {
+		status = ApprovalApproved
+	}
+	return r.db.SetGatewayApprovalStatus(ctx, gatewayID, status)
+}
+
+// SubnetOf returns the CIDR block used for subnet quotas: the /24 for IPv4
+// addresses and the /48 for IPv6 addresses.
+func SubnetOf(address string) (string, error) {
+	ip := net.ParseIP(strings.TrimSpace(address))
+	if ip == nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidAddress, address)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		mask := net.CIDRMask(24, 32)
+		return (&net.IPNet{IP: v4.Mask(mask), Mask: mask}).String(), nil
+	}
+	mask := net.CIDRMask(48, 128)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String(), nil
+}
+
+func envInt(key string, defaultValue int) int {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
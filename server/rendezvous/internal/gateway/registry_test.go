@@ -0,0 +1,564 @@
+package gateway
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+func TestSubnetOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		want    string
+		wantErr bool
+	}{
+		{"ipv4", "203.0.113.77", "203.0.113.0/24", false},
+		{"ipv4 network address", "203.0.113.0", "203.0.113.0/24", false},
+		{"ipv6", "2001:db8:1234:5678::1", "2001:db8:1234::/48", false},
+		{"whitespace", " 198.51.100.9 ", "198.51.100.0/24", false},
+		{"invalid", "not-an-ip", "", true},
+		{"empty", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SubnetOf(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SubnetOf(%q) error = %v, wantErr %v", tt.address, err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrInvalidAddress) {
+				t.Errorf("SubnetOf(%q) error = %v, want ErrInvalidAddress", tt.address, err)
+			}
+			if got != tt.want {
+				t.Errorf("SubnetOf(%q) = %q, want %q", tt.address, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegister_UnderQuotaApproved(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{MaxPerOperator: 3, MaxPerSubnet: 2})
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM gateways\s+WHERE operator_id`).
+		WithArgs("op-1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM gateways\s+WHERE ip_address <<=`).
+		WithArgs("203.0.113.0/24").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).
+		WithArgs(sqlmock.AnyArg(), "203.0.113.10", 443, sqlmock.AnyArg(), sqlmock.AnyArg(), "us-east-1",
+			nil, nil, sqlmock.AnyArg(), ApprovalApproved, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-1"))
+
+	mock.ExpectCommit()
+
+	result, err := registry.Register(context.Background(), testRegistration("op-1", "203.0.113.10"))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if result.GatewayID != "gw-1" || result.ApprovalStatus != ApprovalApproved {
+		t.Errorf("Register: got %+v, want approved gw-1", result)
+	}
+	if len(result.QuotaReasons) != 0 {
+		t.Errorf("QuotaReasons: got %v, want none", result.QuotaReasons)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegister_OperatorQuotaRequiresApproval(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{MaxPerOperator: 3, MaxPerSubnet: 2})
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM gateways\s+WHERE operator_id`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM gateways\s+WHERE ip_address <<=`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), ApprovalPending, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-4"))
+	mock.ExpectExec(`INSERT INTO review_queue`).
+		WithArgs("gateway", "gw-4", ReasonOperatorQuota, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectCommit()
+
+	result, err := registry.Register(context.Background(), testRegistration("op-1", "198.51.100.4"))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if result.ApprovalStatus != ApprovalPending {
+		t.Errorf("ApprovalStatus: got %q, want pending", result.ApprovalStatus)
+	}
+	if len(result.QuotaReasons) != 1 || result.QuotaReasons[0] != ReasonOperatorQuota {
+		t.Errorf("QuotaReasons: got %v, want [%s]", result.QuotaReasons, ReasonOperatorQuota)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegister_SubnetQuotaRequiresApproval(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{MaxPerOperator: 10, MaxPerSubnet: 2})
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM gateways\s+WHERE operator_id`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM gateways\s+WHERE ip_address <<=`).
+		WithArgs("192.0.2.0/24").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-sybil"))
+	mock.ExpectExec(`INSERT INTO review_queue`).
+		WithArgs("gateway", "gw-sybil", ReasonSubnetQuota, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectCommit()
+
+	result, err := registry.Register(context.Background(), testRegistration("op-new", "192.0.2.200"))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if result.ApprovalStatus != ApprovalPending {
+		t.Errorf("ApprovalStatus: got %q, want pending", result.ApprovalStatus)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegister_BothQuotasExceeded(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{MaxPerOperator: 1, MaxPerSubnet: 1})
+
+	mock.ExpectQuery(`SELECT COUNT`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	mock.ExpectQuery(`SELECT COUNT`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-x"))
+	mock.ExpectExec(`INSERT INTO review_queue`).
+		WithArgs("gateway", "gw-x", ReasonOperatorQuota, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO review_queue`).
+		WithArgs("gateway", "gw-x", ReasonSubnetQuota, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectCommit()
+
+	result, err := registry.Register(context.Background(), testRegistration("op-1", "192.0.2.1"))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if len(result.QuotaReasons) != 2 {
+		t.Errorf("QuotaReasons: got %v, want both quotas", result.QuotaReasons)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegister_DisabledQuotasSkipCounts(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-1"))
+	mock.ExpectCommit()
+
+	result, err := registry.Register(context.Background(), testRegistration("op-1", "192.0.2.1"))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if result.ApprovalStatus != ApprovalApproved {
+		t.Errorf("ApprovalStatus: got %q, want approved", result.ApprovalStatus)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegister_InvalidAddress(t *testing.T) {
+	registry, _ := newTestRegistry(t, QuotaConfig{MaxPerOperator: 1, MaxPerSubnet: 1})
+
+	_, err := registry.Register(context.Background(), testRegistration("op-1", "999.1.1.1"))
+	if !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("Register: got %v, want ErrInvalidAddress", err)
+	}
+}
+
+func TestRegister_RequiresKeyProof(t *testing.T) {
+	_, attackerKey, _ := ed25519.GenerateKey(rand.Reader)
+	tests := []struct {
+		name   string
+		modify func(*Registration)
+	}{
+		{"missing", func(reg *Registration) { reg.KeyProof = nil }},
+		{"signed by another key", func(reg *Registration) {
+			reg.KeyProof.Signature = ed25519.Sign(attackerKey, RegistrationMessage(reg.OperatorID, reg.PublicKey, reg.KeyProof.Timestamp))
+		}},
+		{"for another operator", func(reg *Registration) { reg.OperatorID = "op-2" }},
+		{"stale", func(reg *Registration) { reg.KeyProof.Timestamp -= 600 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Nothing is read or written for an unproven key
+			registry, mock := newTestRegistry(t, QuotaConfig{MaxPerOperator: 1, MaxPerSubnet: 1})
+			reg := testRegistration("op-1", "192.0.2.1")
+			tt.modify(reg)
+			if _, err := registry.Register(context.Background(), reg); !errors.Is(err, ErrInvalidKeyProof) {
+				t.Errorf("Register: got %v, want ErrInvalidKeyProof", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRegister_ReviewItemFailureRollsBack(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{MaxPerOperator: 1})
+
+	// A pending gateway is never left without its review item
+	mock.ExpectQuery(`SELECT COUNT`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-2"))
+	mock.ExpectExec(`INSERT INTO review_queue`).WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	if _, err := registry.Register(context.Background(), testRegistration("op-1", "192.0.2.1")); err == nil {
+		t.Error("Register: got nil error, want the review item's")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegister_RepeatIsIdempotent(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{})
+	reg := testRegistration("op-1", "192.0.2.1")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT id FROM gateways WHERE public_key`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-1"))
+	mock.ExpectRollback()
+	mock.ExpectQuery(`WHERE id = \$1`).WithArgs("gw-1").
+		WillReturnRows(existingGatewayRows("gw-1", reg.PublicKey, "op-1", "192.0.2.1"))
+
+	result, err := registry.Register(context.Background(), reg)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if result.Outcome != OutcomeAlreadyExists || result.GatewayID != "gw-1" {
+		t.Errorf("Register: got %+v, want already_exists gw-1", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegister_ChangedIPRequiresConfirmation(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{})
+	reg := testRegistration("op-1", "198.51.100.1")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT id FROM gateways WHERE public_key`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-1"))
+	mock.ExpectRollback()
+	mock.ExpectQuery(`WHERE id = \$1`).
+		WillReturnRows(existingGatewayRows("gw-1", reg.PublicKey, "op-1", "192.0.2.1"))
+
+	result, err := registry.Register(context.Background(), reg)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if result.Outcome != OutcomeConfirmationRequired {
+		t.Errorf("Outcome: got %q, want %q", result.Outcome, OutcomeConfirmationRequired)
+	}
+	// No UPDATE may have been issued
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegister_SignedConfirmationUpdates(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{})
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	reg := testRegistrationWithKey("op-1", "198.51.100.1", privateKey)
+	timestamp := time.Now().Unix()
+	reg.Confirmation = &Confirmation{
+		Timestamp: timestamp,
+		Signature: ed25519.Sign(privateKey, ConfirmationMessage("gw-1", reg, timestamp)),
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT id FROM gateways WHERE public_key`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-1"))
+	mock.ExpectRollback()
+	mock.ExpectQuery(`WHERE id = \$1`).
+		WillReturnRows(existingGatewayRows("gw-1", publicKey, "op-1", "192.0.2.1"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE gateways`).
+		WithArgs("gw-1", "198.51.100.1", 443, sqlmock.AnyArg(), sqlmock.AnyArg(), "us-east-1",
+			nil, nil, sqlmock.AnyArg(), ApprovalApproved, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result, err := registry.Register(context.Background(), reg)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if result.Outcome != OutcomeUpdated || result.ApprovalStatus != ApprovalApproved {
+		t.Errorf("Register: got %+v, want updated/approved", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegister_ForgedConfirmationRejected(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{})
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, attackerKey, _ := ed25519.GenerateKey(rand.Reader)
+	reg := testRegistrationWithKey("op-1", "198.51.100.1", privateKey)
+	timestamp := time.Now().Unix()
+	reg.Confirmation = &Confirmation{
+		Timestamp: timestamp,
+		Signature: ed25519.Sign(attackerKey, ConfirmationMessage("gw-1", reg, timestamp)),
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT id FROM gateways WHERE public_key`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-1"))
+	mock.ExpectRollback()
+	mock.ExpectQuery(`WHERE id = \$1`).
+		WillReturnRows(existingGatewayRows("gw-1", publicKey, "op-1", "192.0.2.1"))
+
+	_, err := registry.Register(context.Background(), reg)
+	if !errors.Is(err, ErrInvalidConfirmation) {
+		t.Errorf("Register: got %v, want ErrInvalidConfirmation", err)
+	}
+}
+
+func TestRegister_ConfirmationCoversEveryAttribute(t *testing.T) {
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	signed := testRegistrationWithKey("op-1", "198.51.100.1", privateKey)
+	timestamp := time.Now().Unix()
+	signature := ed25519.Sign(privateKey, ConfirmationMessage("gw-1", signed, timestamp))
+
+	// Transports in another order are the same set
+	reordered := *signed
+	reordered.TransportTypes = []string{"xtls", "masque"}
+	reordered.Confirmation = &Confirmation{Timestamp: timestamp, Signature: signature}
+	if err := verifyConfirmation(privateKey.Public().(ed25519.PublicKey), "gw-1", &reordered, time.Now()); err != nil {
+		t.Errorf("reordered transports: %v", err)
+	}
+
+	capacity, asn := 500, 64500
+	changes := map[string]func(*Registration){
+		"region":             func(r *Registration) { r.Region = "eu-west-1" },
+		"transports":         func(r *Registration) { r.TransportTypes = []string{"masque"} },
+		"discovery channels": func(r *Registration) { r.DiscoveryChannels = []string{"dtv"} },
+		"bandwidth":          func(r *Registration) { r.BandwidthMbps = &capacity },
+		"max users":          func(r *Registration) { r.MaxUsers = &capacity },
+		"asn":                func(r *Registration) { r.ASN = &asn },
+	}
+	for name, change := range changes {
+		reg := *signed
+		change(&reg)
+		reg.Confirmation = &Confirmation{Timestamp: timestamp, Signature: signature}
+		if err := verifyConfirmation(privateKey.Public().(ed25519.PublicKey), "gw-1", &reg, time.Now()); !errors.Is(err, ErrInvalidConfirmation) {
+			t.Errorf("%s changed after signing: got %v, want ErrInvalidConfirmation", name, err)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, attackerKey, _ := ed25519.GenerateKey(rand.Reader)
+	const path = "/api/v1/gateway/gw-1/metrics"
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name      string
+		path      string
+		timestamp int64
+		key       ed25519.PrivateKey
+		wantErr   bool
+	}{
+		{"valid", path, now, privateKey, false},
+		{"other path", "/api/v1/gateway/gw-2/metrics", now, privateKey, true},
+		{"stale", path, now - 600, privateKey, true},
+		{"wrong key", path, now, attackerKey, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, mock := newTestRegistry(t, QuotaConfig{})
+			mock.ExpectQuery(`WHERE id = \$1`).
+				WillReturnRows(existingGatewayRows("gw-1", publicKey, "op-1", "192.0.2.1"))
+
+			signature := ed25519.Sign(tt.key, RequestMessage("gw-1", tt.path, tt.timestamp))
+			err := registry.Authenticate(context.Background(), "gw-1", path, tt.timestamp, signature)
+			if tt.wantErr && !errors.Is(err, ErrInvalidRequestSignature) {
+				t.Errorf("Authenticate: got %v, want ErrInvalidRequestSignature", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Authenticate: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_UnknownGateway(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{})
+	mock.ExpectQuery(`WHERE id = \$1`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	err := registry.Authenticate(context.Background(), "gw-1", "/api/v1/gateway/gw-1/metrics", time.Now().Unix(), make([]byte, 64))
+	if !errors.Is(err, ErrInvalidRequestSignature) {
+		t.Errorf("Authenticate: got %v, want ErrInvalidRequestSignature", err)
+	}
+}
+
+func TestAuthenticateGateway_CoversBody(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	const path = "/api/v1/gateway/gw-1/notifications"
+	now := time.Now().Unix()
+	body := []byte(`{"webhook_url":"https://ops.example.org/hook"}`)
+	signature := ed25519.Sign(privateKey, RequestBodyMessage("gw-1", path, now, body))
+
+	tests := []struct {
+		name    string
+		body    []byte
+		wantErr bool
+	}{
+		{"signed body", body, false},
+		{"altered body", []byte(`{"webhook_url":"https://attacker.example/hook"}`), true},
+		{"body ignored", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, mock := newTestRegistry(t, QuotaConfig{})
+			mock.ExpectQuery(`WHERE id = \$1`).
+				WillReturnRows(existingGatewayRows("gw-1", publicKey, "op-1", "192.0.2.1"))
+
+			gw, err := registry.AuthenticateGateway(context.Background(), "gw-1", path, tt.body, now, signature)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRequestSignature) {
+					t.Errorf("AuthenticateGateway: got %v, want ErrInvalidRequestSignature", err)
+				}
+				return
+			}
+			if err != nil || gw.OperatorID != "op-1" {
+				t.Errorf("AuthenticateGateway: got %+v, %v", gw, err)
+			}
+		})
+	}
+}
+
+func TestRegister_ConcurrentDuplicates(t *testing.T) {
+	registry, mock := newTestRegistry(t, QuotaConfig{})
+	mock.MatchExpectationsInOrder(false)
+	reg := testRegistration("op-1", "192.0.2.1")
+
+	// The database lets exactly one INSERT win; the other sees the conflict
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-1"))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO gateways`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT id FROM gateways WHERE public_key`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("gw-1"))
+	mock.ExpectRollback()
+	mock.ExpectQuery(`WHERE id = \$1`).
+		WillReturnRows(existingGatewayRows("gw-1", reg.PublicKey, "op-1", "192.0.2.1"))
+
+	var wg sync.WaitGroup
+	results := make([]*RegistrationResult, 2)
+	errs := make([]error, 2)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = registry.Register(context.Background(), reg)
+		}(i)
+	}
+	wg.Wait()
+
+	outcomes := map[string]int{}
+	for i := range results {
+		if errs[i] != nil {
+			t.Fatalf("Register: %v", errs[i])
+		}
+		if results[i].GatewayID != "gw-1" {
+			t.Errorf("GatewayID: got %q, want gw-1", results[i].GatewayID)
+		}
+		outcomes[results[i].Outcome]++
+	}
+	if outcomes[OutcomeCreated] != 1 || outcomes[OutcomeAlreadyExists] != 1 {
+		t.Errorf("outcomes: got %v, want one created and one already_exists", outcomes)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func newTestRegistry(t *testing.T, quotas QuotaConfig) (*Registry, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	registry := NewRegistry(db.NewFromPool(sqlDB))
+	registry.quotas = quotas
+	return registry, mock
+}
+
+// testRegistration returns a registration of a new key, with its key proof
+func testRegistration(operatorID, ip string) *Registration {
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	return testRegistrationWithKey(operatorID, ip, privateKey)
+}
+
+func testRegistrationWithKey(operatorID, ip string, privateKey ed25519.PrivateKey) *Registration {
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	timestamp := time.Now().Unix()
+	return &Registration{
+		OperatorID:     operatorID,
+		PublicKey:      publicKey,
+		IPAddress:      ip,
+		Port:           443,
+		TransportTypes: []string{"masque", "xtls"},
+		Region:         "us-east-1",
+		KeyProof: &Confirmation{
+			Timestamp: timestamp,
+			Signature: ed25519.Sign(privateKey, RegistrationMessage(operatorID, publicKey, timestamp)),
+		},
+	}
+}
+
+func existingGatewayRows(id string, publicKey []byte, operatorID, ip string) *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows([]string{
+		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
+		"created_at", "last_seen", "updated_at",
+	}).AddRow(
+		id, publicKey, ip, 443, "{xtls,masque}", "{}",
+		"us-east-1", nil, 0, nil, "active", false,
+		operatorID, ApprovalApproved, nil,
+		now, nil, now,
+	)
+}
@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"rendezvous/internal/apperr"
+	"rendezvous/internal/crypt"
+	"rendezvous/internal/db"
+)
+
+// ErrSecretsUnavailable is returned when gateway secrets cannot be stored
+// because no data key is configured.
+var ErrSecretsUnavailable = apperr.New(apperr.ErrUnavailable, "secrets_unavailable", "gateway secrets are not configured")
+
+// Secret is one decrypted generation of a gateway's transport secret
+type Secret struct {
+	Generation int
+	Value      []byte
+	ExpiresAt  *time.Time // Nil for the current generation
+}
+
+// SecretStore keeps per-gateway transport secrets encrypted at rest. A nil
+// store has no secrets.
+type SecretStore struct {
+	db      *db.Database
+	sealer  *crypt.Sealer
+	overlap time.Duration
+}
+
+// NewSecretStore creates a store encrypting with sealer. After a rotation the
+// previous secret stays valid for overlap.
+func NewSecretStore(database *db.Database, sealer *crypt.Sealer, overlap time.Duration) *SecretStore {
+	return &SecretStore{db: database, sealer: sealer, overlap: overlap}
+}
+
+// NewSecretStoreFromEnv creates a store with the data key from
+// LUMENLINK_DATA_KEY and the overlap from LUMENLINK_GATEWAY_SECRET_OVERLAP
+// (default 24h). It returns nil when no data key is set.
+func NewSecretStoreFromEnv(database *db.Database) (*SecretStore, error) {
+	sealer, err := crypt.LoadSealerFromEnv()
+	if err != nil || sealer == nil {
+		return nil, err
+	}
+	overlap := 24 * time.Hour
+	if value := strings.TrimSpace(os.Getenv("LUMENLINK_GATEWAY_SECRET_OVERLAP")); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			overlap = d
+		}
+	}
+	return NewSecretStore(database, sealer, overlap), nil
+}
+
+// Rotate makes secret the gateway's current secret. The previous one stays
+// valid for the overlap, so clients holding older packs keep connecting
+// while they refresh. It returns the new generation and when the previous
+// one expires.
+func (s *SecretStore) Rotate(ctx context.Context, gatewayID string, secret []byte, now time.Time) (int, time.Time, error) {
+	if s == nil {
+		return 0, time.Time{}, ErrSecretsUnavailable
+	}
+	ciphertext, err := s.sealer.Seal(secret, []byte(gatewayID))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	previousExpiresAt := now.Add(s.overlap)
+	generation, err := s.db.RotateGatewaySecret(ctx, gatewayID, ciphertext, previousExpiresAt, now)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return generation, previousExpiresAt, nil
+}
+
+// Active returns the unexpired secrets of each gateway, newest first.
+// Generations that fail to decrypt are logged by number and skipped.
+func (s *SecretStore) Active(ctx context.Context, gatewayIDs []string, now time.Time) (map[string][]Secret, error) {
+	if s == nil || len(gatewayIDs) == 0 {
+		return nil, nil
+	}
+	stored, err := s.db.GetActiveGatewaySecrets(ctx, gatewayIDs, now)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make(map[string][]Secret, len(gatewayIDs))
+	for _, row := range stored {
+		value, err := s.sealer.Open(row.Ciphertext, []byte(row.GatewayID))
+		if err != nil {
+			log.Printf("gateway %s secret generation %d: %v", row.GatewayID, row.Generation, err)
+			continue
+		}
+		secrets[row.GatewayID] = append(secrets[row.GatewayID], Secret{
+			Generation: row.Generation,
+			Value:      value,
+			ExpiresAt:  row.ExpiresAt,
+		})
+	}
+	return secrets, nil
+}
@@ -0,0 +1,113 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/crypt"
+	"rendezvous/internal/db"
+)
+
+const secretsGatewayID = "5c2a7e10-3b4d-4f6a-8e9b-0c1d2e3f4a5b"
+
+// sealedAs matches a ciphertext that opens to plaintext for the gateway
+type sealedAs struct {
+	sealer    *crypt.Sealer
+	plaintext string
+}
+
+func (m sealedAs) Match(v driver.Value) bool {
+	sealed, ok := v.([]byte)
+	if !ok || bytes.Contains(sealed, []byte(m.plaintext)) {
+		return false
+	}
+	opened, err := m.sealer.Open(sealed, []byte(secretsGatewayID))
+	return err == nil && string(opened) == m.plaintext
+}
+
+func newTestSecretStore(t *testing.T, overlap time.Duration) (*SecretStore, sqlmock.Sqlmock, *crypt.Sealer) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	sealer, err := crypt.NewSealer(bytes.Repeat([]byte{5}, crypt.KeySize))
+	if err != nil {
+		t.Fatalf("NewSealer: %v", err)
+	}
+	return NewSecretStore(db.NewFromPool(sqlDB), sealer, overlap), mock, sealer
+}
+
+func TestSecretStore_RotateKeepsPreviousForOverlap(t *testing.T) {
+	store, mock, sealer := newTestSecretStore(t, 6*time.Hour)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM gateway_secrets WHERE gateway_id = \$1 AND expires_at <= \$2`).
+		WithArgs(secretsGatewayID, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE gateway_secrets SET expires_at = \$2 WHERE gateway_id = \$1 AND expires_at IS NULL`).
+		WithArgs(secretsGatewayID, now.Add(6*time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO gateway_secrets`).
+		WithArgs(secretsGatewayID, sealedAs{sealer, "new-obfuscation-seed"}, now).
+		WillReturnRows(sqlmock.NewRows([]string{"generation"}).AddRow(3))
+	mock.ExpectCommit()
+
+	generation, previousExpiresAt, err := store.Rotate(context.Background(), secretsGatewayID, []byte("new-obfuscation-seed"), now)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if generation != 3 || !previousExpiresAt.Equal(now.Add(6*time.Hour)) {
+		t.Errorf("Rotate: got generation %d expiring the previous at %s", generation, previousExpiresAt)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSecretStore_Active(t *testing.T) {
+	store, mock, sealer := newTestSecretStore(t, time.Hour)
+	now := time.Now()
+	current, _ := sealer.Seal([]byte("new-obfuscation-seed"), []byte(secretsGatewayID))
+	previous, _ := sealer.Seal([]byte("old-obfuscation-seed"), []byte(secretsGatewayID))
+	// Sealed for another gateway and copied over: must not be served
+	moved, _ := sealer.Seal([]byte("other-seed"), []byte("0b9e8d7c-6a5f-4e3d-8c2b-1a0f9e8d7c6b"))
+	expiresAt := now.Add(time.Hour)
+
+	mock.ExpectQuery(`FROM gateway_secrets`).
+		WithArgs(sqlmock.AnyArg(), now).
+		WillReturnRows(sqlmock.NewRows([]string{"gateway_id", "generation", "ciphertext", "created_at", "expires_at"}).
+			AddRow(secretsGatewayID, 3, current, now, nil).
+			AddRow(secretsGatewayID, 2, previous, now, expiresAt).
+			AddRow(secretsGatewayID, 1, moved, now, expiresAt))
+
+	secrets, err := store.Active(context.Background(), []string{secretsGatewayID}, now)
+	if err != nil {
+		t.Fatalf("Active: %v", err)
+	}
+	got := secrets[secretsGatewayID]
+	if len(got) != 2 || string(got[0].Value) != "new-obfuscation-seed" || got[0].ExpiresAt != nil ||
+		string(got[1].Value) != "old-obfuscation-seed" || got[1].Generation != 2 {
+		t.Errorf("Active: got %+v, want generations 3 and 2", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSecretStore_Nil(t *testing.T) {
+	var store *SecretStore
+	if secrets, err := store.Active(context.Background(), []string{secretsGatewayID}, time.Now()); secrets != nil || err != nil {
+		t.Errorf("Active: got %v, %v; want nothing", secrets, err)
+	}
+	if _, _, err := store.Rotate(context.Background(), secretsGatewayID, []byte("seed"), time.Now()); !errors.Is(err, ErrSecretsUnavailable) {
+		t.Errorf("Rotate: got %v, want ErrSecretsUnavailable", err)
+	}
+}
@@ -0,0 +1,264 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/notify"
+)
+
+// Suspicion score components and their weights; a gateway scores 1 when every
+// component is at its worst.
+const (
+	ComponentUnconfirmed   = "unconfirmed"    // Few distinct clients confirm successful connections
+	ComponentClaimMismatch = "claim_mismatch" // The gateway claims more users than clients confirm
+	ComponentLowDiversity  = "low_diversity"  // Confirmations come from few networks
+	ComponentASNReputation = "asn_reputation" // The gateway is hosted in a listed ASN
+
+	weightUnconfirmed   = 0.5
+	weightClaimMismatch = 0.2
+	weightLowDiversity  = 0.15
+	weightASNReputation = 0.15
+)
+
+// SuspicionPolicy controls honeypot suspicion scoring: a gateway that keeps
+// heartbeating but is rarely confirmed by clients may be an adversary-run
+// listening post harvesting client IPs.
+type SuspicionPolicy struct {
+	WindowDays     int          // Days of heartbeats and client reports considered
+	MinHeartbeats  int64        // Gateways with fewer heartbeats are not scored
+	MinClients     int64        // Confirmed clients at which the unconfirmed component reaches 0
+	MinSubnets     int64        // Client networks at which the low diversity component reaches 0
+	Threshold      float64      // Scores at or above this are flagged for review
+	AutoExclude    bool         // Also move flagged gateways to pending, keeping them out of packs, until an admin approves them
+	SuspiciousASNs map[int]bool // ASNs with a bad reputation
+}
+
+// LoadSuspicionPolicyFromEnv reads the suspicion policy from the environment.
+func LoadSuspicionPolicyFromEnv() SuspicionPolicy {
+	policy := SuspicionPolicy{
+		WindowDays:     envInt("LUMENLINK_SUSPICION_WINDOW_DAYS", 7),
+		MinHeartbeats:  int64(envInt("LUMENLINK_SUSPICION_MIN_HEARTBEATS", 100)),
+		MinClients:     int64(envInt("LUMENLINK_SUSPICION_MIN_CLIENTS", 5)),
+		MinSubnets:     int64(envInt("LUMENLINK_SUSPICION_MIN_SUBNETS", 3)),
+		Threshold:      0.6,
+		AutoExclude:    os.Getenv("LUMENLINK_SUSPICION_AUTO_EXCLUDE") == "true",
+		SuspiciousASNs: make(map[int]bool),
+	}
+	if value := strings.TrimSpace(os.Getenv("LUMENLINK_SUSPICION_THRESHOLD")); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil && f > 0 && f <= 1 {
+			policy.Threshold = f
+		}
+	}
+	for _, value := range strings.Split(os.Getenv("LUMENLINK_SUSPICIOUS_ASNS"), ",") {
+		if asn, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(strings.ToUpper(value)), "AS")); err == nil && asn > 0 {
+			policy.SuspiciousASNs[asn] = true
+		}
+	}
+	return policy
+}
+
+// SuspicionScore is the outcome of scoring one gateway.
+type SuspicionScore struct {
+	Score      float64
+	Components map[string]float64 // Each 0-1, before weighting
+	Scored     bool               // False when the gateway had too few heartbeats to judge
+}
+
+// ScoreSuspicion scores a gateway's activity between 0 (clients confirm it is
+// used as claimed) and 1 (it heartbeats, claims users, but no client confirms
+// a connection). Gateways with fewer than MinHeartbeats heartbeats are not
+// scored, so new or intermittent gateways are left alone.
+func ScoreSuspicion(a *db.GatewayActivity, policy SuspicionPolicy) SuspicionScore {
+	if a.Heartbeats < policy.MinHeartbeats {
+		return SuspicionScore{Components: map[string]float64{}}
+	}
+
+	components := map[string]float64{
+		ComponentUnconfirmed:   shortfall(a.ConfirmedClients, policy.MinClients),
+		ComponentLowDiversity:  shortfall(a.ClientSubnets, policy.MinSubnets),
+		ComponentClaimMismatch: 0,
+		ComponentASNReputation: 0,
+	}
+	if a.MaxUsersReported > 0 {
+		components[ComponentClaimMismatch] = shortfall(a.ConfirmedClients, int64(a.MaxUsersReported))
+	}
+	if a.ASN != nil && policy.SuspiciousASNs[*a.ASN] {
+		components[ComponentASNReputation] = 1
+	}
+
+	score := weightUnconfirmed*components[ComponentUnconfirmed] +
+		weightClaimMismatch*components[ComponentClaimMismatch] +
+		weightLowDiversity*components[ComponentLowDiversity] +
+		weightASNReputation*components[ComponentASNReputation]
+	return SuspicionScore{
+		Score:      math.Min(1, math.Round(score*1000)/1000),
+		Components: components,
+		Scored:     true,
+	}
+}
+
+// shortfall is how far observed falls short of expected, between 0 and 1.
+func shortfall(observed, expected int64) float64 {
+	if expected <= 0 || observed >= expected {
+		return 0
+	}
+	return 1 - float64(observed)/float64(expected)
+}
+
+// SuspicionScorer periodically scores every gateway and flags suspicious
+// ones into the review queue.
+type SuspicionScorer struct {
+	db     *db.Database
+	policy SuspicionPolicy
+	events notify.OperatorEmitter // Nil until SetEvents
+	clock  clock.Clock
+}
+
+// NewSuspicionScorer creates a scorer with the policy from the environment.
+func NewSuspicionScorer(database *db.Database) *SuspicionScorer {
+	return &SuspicionScorer{db: database, policy: LoadSuspicionPolicyFromEnv(), clock: clock.Real{}}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (s *SuspicionScorer) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetEvents attaches the sink for operator events; gateways newly flagged
+// for review are reported to their operators.
+func (s *SuspicionScorer) SetEvents(events notify.OperatorEmitter) {
+	s.events = events
+}
+
+// SuspicionRunResult counts what one scoring pass did.
+type SuspicionRunResult struct {
+	Scored   int
+	Flagged  int
+	Excluded int // Flagged gateways moved from approved to pending
+}
+
+// Run scores every gateway once. Flagged gateways get an open review item
+// (one per gateway, however many passes flag it) unless an admin already
+// dismissed the finding; with AutoExclude, approved ones are also moved to
+// pending until an admin reviews them. A gateway an admin approved after its
+// last exclusion is not excluded again.
+func (s *SuspicionScorer) Run(ctx context.Context, now time.Time) (SuspicionRunResult, error) {
+	var result SuspicionRunResult
+	activity, err := s.db.GetGatewayActivity(ctx, now.AddDate(0, 0, -s.policy.WindowDays))
+	if err != nil {
+		return result, err
+	}
+
+	for _, a := range activity {
+		score := ScoreSuspicion(a, s.policy)
+		if !score.Scored {
+			continue
+		}
+		result.Scored++
+
+		flagged := score.Score >= s.policy.Threshold
+		err := s.db.UpsertGatewaySuspicion(ctx, &db.GatewaySuspicion{
+			GatewayID:  a.GatewayID,
+			Score:      score.Score,
+			Components: score.Components,
+			Signals: map[string]int64{
+				"heartbeats":         a.Heartbeats,
+				"max_users_reported": int64(a.MaxUsersReported),
+				"confirmed_clients":  a.ConfirmedClients,
+				"client_subnets":     a.ClientSubnets,
+			},
+			Flagged: flagged,
+		})
+		if err != nil {
+			return result, err
+		}
+		if !flagged {
+			continue
+		}
+
+		dismissed, err := s.db.HasDismissedReviewItem(ctx, "gateway", a.GatewayID, ReasonHoneypotSuspicion)
+		if err != nil {
+			return result, err
+		}
+		if dismissed {
+			continue
+		}
+		result.Flagged++
+		added, err := s.db.AddReviewItem(ctx, "gateway", a.GatewayID, ReasonHoneypotSuspicion, map[string]interface{}{
+			"score":      score.Score,
+			"components": score.Components,
+		})
+		if err != nil {
+			return result, err
+		}
+		if added {
+			s.emitFlagged(ctx, a.GatewayID, score, now)
+		}
+		if s.policy.AutoExclude && a.ApprovalStatus == ApprovalApproved && !a.Reapproved {
+			excluded, err := s.db.ExcludeSuspiciousGateway(ctx, a.GatewayID)
+			if err != nil {
+				return result, err
+			}
+			if excluded {
+				result.Excluded++
+			}
+		}
+	}
+	return result, nil
+}
+
+// emitFlagged tells the gateway's operator, if it has one, that it was
+// flagged. The review item is already stored, so failures are only logged.
+func (s *SuspicionScorer) emitFlagged(ctx context.Context, gatewayID string, score SuspicionScore, now time.Time) {
+	if s.events == nil {
+		return
+	}
+	gw, err := s.db.GetGatewayByID(ctx, gatewayID)
+	if err != nil {
+		log.Printf("failed to load gateway %s for its flagged notification: %v", gatewayID, err)
+		return
+	}
+	if gw.OperatorID == "" {
+		return
+	}
+	s.events.Emit(notify.OperatorEvent{
+		Type:       notify.EventGatewayFlagged,
+		OperatorID: gw.OperatorID,
+		GatewayID:  gatewayID,
+		Message:    fmt.Sprintf("Gateway %s was flagged for review", gatewayID),
+		Details:    map[string]interface{}{"reason": ReasonHoneypotSuspicion, "score": score.Score},
+		OccurredAt: now.UTC(),
+	})
+}
+
+// Start scores gateways every interval until ctx is cancelled.
+func (s *SuspicionScorer) Start(ctx context.Context, interval time.Duration) {
+	ticker := s.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			result, err := s.Run(ctx, s.clock.Now())
+			if err != nil {
+				log.Printf("gateway suspicion scoring failed: %v", err)
+				continue
+			}
+			if result.Flagged > 0 {
+				log.Printf("gateway suspicion scoring flagged %d of %d gateways (%d excluded pending review)",
+					result.Flagged, result.Scored, result.Excluded)
+			}
+		}
+	}
+}
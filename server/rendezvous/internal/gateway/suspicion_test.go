@@ -0,0 +1,260 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/notify"
+)
+
+func testSuspicionPolicy() SuspicionPolicy {
+	return SuspicionPolicy{
+		WindowDays:     7,
+		MinHeartbeats:  100,
+		MinClients:     5,
+		MinSubnets:     3,
+		Threshold:      0.6,
+		SuspiciousASNs: map[int]bool{64512: true},
+	}
+}
+
+func TestScoreSuspicion(t *testing.T) {
+	badASN, cleanASN := 64512, 13335
+
+	tests := []struct {
+		name        string
+		activity    db.GatewayActivity
+		wantScored  bool
+		wantFlagged bool
+	}{
+		{
+			name:        "confirmed by many clients across networks",
+			activity:    db.GatewayActivity{Heartbeats: 2000, MaxUsersReported: 40, ConfirmedClients: 60, ClientSubnets: 25, ASN: &cleanASN},
+			wantScored:  true,
+			wantFlagged: false,
+		},
+		{
+			name:        "listening post: heartbeats and claimed users, no confirmations",
+			activity:    db.GatewayActivity{Heartbeats: 2000, MaxUsersReported: 30},
+			wantScored:  true,
+			wantFlagged: true,
+		},
+		{
+			name:        "healthy heartbeats, never confirmed",
+			activity:    db.GatewayActivity{Heartbeats: 2000},
+			wantScored:  true,
+			wantFlagged: true,
+		},
+		{
+			name:        "too few heartbeats to judge",
+			activity:    db.GatewayActivity{Heartbeats: 20, MaxUsersReported: 30},
+			wantScored:  false,
+			wantFlagged: false,
+		},
+		{
+			name:        "confirmations from a single network",
+			activity:    db.GatewayActivity{Heartbeats: 2000, MaxUsersReported: 5, ConfirmedClients: 5, ClientSubnets: 1},
+			wantScored:  true,
+			wantFlagged: false,
+		},
+		{
+			name:        "few confirmations from a listed ASN",
+			activity:    db.GatewayActivity{Heartbeats: 2000, MaxUsersReported: 20, ConfirmedClients: 2, ClientSubnets: 1, ASN: &badASN},
+			wantScored:  true,
+			wantFlagged: true,
+		},
+		{
+			name:        "listed ASN alone is not enough",
+			activity:    db.GatewayActivity{Heartbeats: 2000, MaxUsersReported: 10, ConfirmedClients: 12, ClientSubnets: 6, ASN: &badASN},
+			wantScored:  true,
+			wantFlagged: false,
+		},
+	}
+	policy := testSuspicionPolicy()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ScoreSuspicion(&tt.activity, policy)
+			if got.Scored != tt.wantScored {
+				t.Fatalf("scored: got %v, want %v", got.Scored, tt.wantScored)
+			}
+			if flagged := got.Scored && got.Score >= policy.Threshold; flagged != tt.wantFlagged {
+				t.Errorf("flagged: got %v (score %.3f, components %v), want %v", flagged, got.Score, got.Components, tt.wantFlagged)
+			}
+			if got.Score < 0 || got.Score > 1 {
+				t.Errorf("score %v out of range", got.Score)
+			}
+		})
+	}
+}
+
+func TestLoadSuspicionPolicyFromEnv(t *testing.T) {
+	t.Setenv("LUMENLINK_SUSPICIOUS_ASNS", "AS64512, 64513,bogus")
+	t.Setenv("LUMENLINK_SUSPICION_THRESHOLD", "0.8")
+	t.Setenv("LUMENLINK_SUSPICION_AUTO_EXCLUDE", "true")
+
+	policy := LoadSuspicionPolicyFromEnv()
+	if !policy.SuspiciousASNs[64512] || !policy.SuspiciousASNs[64513] || len(policy.SuspiciousASNs) != 2 {
+		t.Errorf("SuspiciousASNs: got %v", policy.SuspiciousASNs)
+	}
+	if policy.Threshold != 0.8 || !policy.AutoExclude {
+		t.Errorf("policy: got %+v", policy)
+	}
+}
+
+func activityRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"id", "approval_status", "asn", "heartbeats", "max_users", "clients", "subnets", "reapproved",
+	})
+}
+
+func TestSuspicionScorer_FlagsAndExcludes(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`FROM gateways g`).WillReturnRows(activityRows().
+		AddRow("gw-busy", ApprovalApproved, nil, 2000, 40, 60, 25, false).
+		AddRow("gw-post", ApprovalApproved, nil, 2000, 30, 0, 0, false).
+		AddRow("gw-new", ApprovalApproved, nil, 10, 0, 0, 0, false))
+	mock.ExpectExec(`INSERT INTO gateway_suspicion_scores`).
+		WithArgs("gw-busy", 0.0, sqlmock.AnyArg(), sqlmock.AnyArg(), false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO gateway_suspicion_scores`).
+		WithArgs("gw-post", 0.85, sqlmock.AnyArg(), sqlmock.AnyArg(), true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("gateway", "gw-post", ReasonHoneypotSuspicion).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`INSERT INTO review_queue`).
+		WithArgs("gateway", "gw-post", ReasonHoneypotSuspicion, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE gateways SET approval_status = 'pending', suspicion_excluded_at`).
+		WithArgs("gw-post").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	scorer := NewSuspicionScorer(db.NewFromPool(sqlDB))
+	scorer.policy = testSuspicionPolicy()
+	scorer.policy.AutoExclude = true
+
+	result, err := scorer.Run(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result != (SuspicionRunResult{Scored: 2, Flagged: 1, Excluded: 1}) {
+		t.Errorf("result: got %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSuspicionScorer_KeepsReapprovedGateway(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// An admin approved gw-post after the last pass excluded it; it is still
+	// flagged but stays approved
+	mock.ExpectQuery(`FROM gateways g`).WillReturnRows(activityRows().
+		AddRow("gw-post", ApprovalApproved, nil, 2000, 30, 0, 0, true))
+	mock.ExpectExec(`INSERT INTO gateway_suspicion_scores`).
+		WithArgs("gw-post", 0.85, sqlmock.AnyArg(), sqlmock.AnyArg(), true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`INSERT INTO review_queue`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	scorer := NewSuspicionScorer(db.NewFromPool(sqlDB))
+	scorer.policy = testSuspicionPolicy()
+	scorer.policy.AutoExclude = true
+
+	result, err := scorer.Run(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result != (SuspicionRunResult{Scored: 1, Flagged: 1}) {
+		t.Errorf("result: got %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSuspicionScorer_RespectsDismissal(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(`FROM gateways g`).WillReturnRows(activityRows().
+		AddRow("gw-post", ApprovalApproved, nil, 2000, 30, 0, 0, false))
+	mock.ExpectExec(`INSERT INTO gateway_suspicion_scores`).
+		WithArgs("gw-post", 0.85, sqlmock.AnyArg(), sqlmock.AnyArg(), true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	scorer := NewSuspicionScorer(db.NewFromPool(sqlDB))
+	scorer.policy = testSuspicionPolicy()
+	scorer.policy.AutoExclude = true
+
+	result, err := scorer.Run(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Flagged != 0 || result.Excluded != 0 {
+		t.Errorf("dismissed gateway was flagged again: %+v", result)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSuspicionScorer_EmitsFlaggedToOperator(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	for _, added := range []int64{1, 0} {
+		mock.ExpectQuery(`FROM gateways g`).WillReturnRows(activityRows().
+			AddRow("gw-post", ApprovalApproved, nil, 2000, 30, 0, 0, false))
+		mock.ExpectExec(`INSERT INTO gateway_suspicion_scores`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectExec(`INSERT INTO review_queue`).WillReturnResult(sqlmock.NewResult(0, added))
+		if added == 1 {
+			mock.ExpectQuery(`WHERE id = \$1`).
+				WillReturnRows(existingGatewayRows("gw-post", make([]byte, 32), "op-1", "192.0.2.1"))
+		}
+	}
+
+	scorer := NewSuspicionScorer(db.NewFromPool(sqlDB))
+	scorer.policy = testSuspicionPolicy()
+	events := &recordingEmitter{}
+	scorer.SetEvents(events)
+
+	// The second pass finds the review item still open and emits nothing
+	for i := 0; i < 2; i++ {
+		if _, err := scorer.Run(context.Background(), time.Now()); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	}
+	if len(events.events) != 1 {
+		t.Fatalf("emitted %d events, want 1", len(events.events))
+	}
+	if event := events.events[0]; event.Type != notify.EventGatewayFlagged || event.OperatorID != "op-1" || event.GatewayID != "gw-post" {
+		t.Errorf("event: got %+v", event)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,196 @@
+package gateway
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"rendezvous/internal/db"
+)
+
+// UptimeWindows are the periods uptime can be computed over
+var UptimeWindows = map[string]time.Duration{
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+}
+
+// DefaultUptimeWindow is used when a request does not select a window
+const DefaultUptimeWindow = "30d"
+
+// initialStatus is assumed before a gateway's first recorded status change:
+// history is only written when the status changes, and gateways are
+// registered active.
+const initialStatus = "active"
+
+// Uptime is a gateway's uptime over a window. Approved maintenance is left
+// out of both the expected and the observed time.
+type Uptime struct {
+	Window          string   `json:"window"`
+	Percent         *float64 `json:"percent"` // Nil when no time was expected, e.g. all maintenance
+	ExpectedSeconds int64    `json:"expected_seconds"`
+	UpSeconds       int64    `json:"up_seconds"`
+	ExcludedSeconds int64    `json:"excluded_seconds"` // Approved maintenance inside the window
+}
+
+// isUp reports whether a status counts as serving clients
+func isUp(status string) bool {
+	return status == "active" || status == "degraded"
+}
+
+type interval struct {
+	start, end time.Time
+}
+
+func (i interval) duration() time.Duration {
+	if i.end.Before(i.start) {
+		return 0
+	}
+	return i.end.Sub(i.start)
+}
+
+// ComputeUptime computes a gateway's uptime over [from, to) as the time it
+// was up divided by the time it was expected up: the window from the later
+// of from and createdAt, minus approved maintenance. history holds the
+// gateway's status changes, including the last one before from; maintenance
+// holds its approved windows. Both may be unordered and windows may overlap.
+func ComputeUptime(createdAt time.Time, history []db.StatusChange, maintenance []db.MaintenanceWindow, from, to time.Time) Uptime {
+	var uptime Uptime
+	start := from
+	if createdAt.After(start) {
+		start = createdAt
+	}
+	if !start.Before(to) {
+		return uptime
+	}
+	window := interval{start, to}
+
+	excluded := mergeIntervals(window, maintenance)
+	var excludedTime time.Duration
+	for _, e := range excluded {
+		excludedTime += e.duration()
+	}
+
+	var upTime time.Duration
+	for _, up := range upIntervals(window, history) {
+		upTime += up.duration()
+		for _, e := range excluded {
+			upTime -= overlap(up, e)
+		}
+	}
+
+	expected := window.duration() - excludedTime
+	uptime.ExpectedSeconds = int64(expected / time.Second)
+	uptime.UpSeconds = int64(upTime / time.Second)
+	uptime.ExcludedSeconds = int64(excludedTime / time.Second)
+	if expected > 0 {
+		percent := 100 * float64(upTime) / float64(expected)
+		uptime.Percent = &percent
+	}
+	return uptime
+}
+
+// upIntervals splits window by status changes and returns the parts during
+// which the gateway was up.
+func upIntervals(window interval, history []db.StatusChange) []interval {
+	changes := make([]db.StatusChange, len(history))
+	copy(changes, history)
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].ChangedAt.Before(changes[j].ChangedAt) })
+
+	status := initialStatus
+	i := 0
+	for ; i < len(changes) && !changes[i].ChangedAt.After(window.start); i++ {
+		status = changes[i].Status
+	}
+
+	var ups []interval
+	segmentStart := window.start
+	for ; i < len(changes) && changes[i].ChangedAt.Before(window.end); i++ {
+		if isUp(status) {
+			ups = append(ups, interval{segmentStart, changes[i].ChangedAt})
+		}
+		segmentStart = changes[i].ChangedAt
+		status = changes[i].Status
+	}
+	if isUp(status) {
+		ups = append(ups, interval{segmentStart, window.end})
+	}
+	return ups
+}
+
+// mergeIntervals clips maintenance windows to window and merges overlapping
+// ones, so no time is excluded twice.
+func mergeIntervals(window interval, maintenance []db.MaintenanceWindow) []interval {
+	clipped := make([]interval, 0, len(maintenance))
+	for _, m := range maintenance {
+		i := interval{m.StartsAt, m.EndsAt}
+		if i.start.Before(window.start) {
+			i.start = window.start
+		}
+		if i.end.After(window.end) {
+			i.end = window.end
+		}
+		if i.start.Before(i.end) {
+			clipped = append(clipped, i)
+		}
+	}
+	sort.Slice(clipped, func(a, b int) bool { return clipped[a].start.Before(clipped[b].start) })
+
+	var merged []interval
+	for _, i := range clipped {
+		if n := len(merged); n > 0 && !i.start.After(merged[n-1].end) {
+			if i.end.After(merged[n-1].end) {
+				merged[n-1].end = i.end
+			}
+			continue
+		}
+		merged = append(merged, i)
+	}
+	return merged
+}
+
+func overlap(a, b interval) time.Duration {
+	start, end := a.start, a.end
+	if b.start.After(start) {
+		start = b.start
+	}
+	if b.end.Before(end) {
+		end = b.end
+	}
+	return interval{start, end}.duration()
+}
+
+// Uptimes computes the uptime of each gateway over the named window ending
+// at now, keyed by gateway ID. window must be a key of UptimeWindows.
+func (r *Registry) Uptimes(ctx context.Context, gateways []*db.Gateway, window string, now time.Time) (map[string]Uptime, error) {
+	from := now.Add(-UptimeWindows[window])
+	ids := make([]string, len(gateways))
+	for i, gw := range gateways {
+		ids[i] = gw.ID
+	}
+	history, err := r.db.GetStatusHistory(ctx, ids, from)
+	if err != nil {
+		return nil, err
+	}
+	maintenance, err := r.db.GetMaintenanceWindows(ctx, ids, from, now)
+	if err != nil {
+		return nil, err
+	}
+
+	historyByGateway := map[string][]db.StatusChange{}
+	for _, change := range history {
+		historyByGateway[change.GatewayID] = append(historyByGateway[change.GatewayID], change)
+	}
+	maintenanceByGateway := map[string][]db.MaintenanceWindow{}
+	for _, m := range maintenance {
+		maintenanceByGateway[m.GatewayID] = append(maintenanceByGateway[m.GatewayID], m)
+	}
+
+	uptimes := make(map[string]Uptime, len(gateways))
+	for _, gw := range gateways {
+		uptime := ComputeUptime(gw.CreatedAt, historyByGateway[gw.ID], maintenanceByGateway[gw.ID], from, now)
+		uptime.Window = window
+		uptimes[gw.ID] = uptime
+	}
+	return uptimes, nil
+}
@@ -0,0 +1,174 @@
+package gateway
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"rendezvous/internal/db"
+)
+
+var uptimeFrom = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// at returns the time h hours into the test window
+func at(h float64) time.Time {
+	return uptimeFrom.Add(time.Duration(h * float64(time.Hour)))
+}
+
+func change(h float64, status string) db.StatusChange {
+	return db.StatusChange{GatewayID: "gw", Status: status, ChangedAt: at(h)}
+}
+
+func maintenanceWindow(from, to float64) db.MaintenanceWindow {
+	return db.MaintenanceWindow{GatewayID: "gw", StartsAt: at(from), EndsAt: at(to)}
+}
+
+func TestComputeUptime(t *testing.T) {
+	created := at(-1000)
+	tests := []struct {
+		name         string
+		createdAt    time.Time
+		history      []db.StatusChange
+		maintenance  []db.MaintenanceWindow
+		wantPercent  float64 // -1 for no value
+		wantExpected float64 // hours
+		wantExcluded float64 // hours
+	}{
+		{
+			name:         "no history is up throughout",
+			createdAt:    created,
+			wantPercent:  100,
+			wantExpected: 100,
+		},
+		{
+			name:         "offline before the window and throughout",
+			createdAt:    created,
+			history:      []db.StatusChange{change(-5, "offline")},
+			wantPercent:  0,
+			wantExpected: 100,
+		},
+		{
+			name:         "one outage",
+			createdAt:    created,
+			history:      []db.StatusChange{change(10, "offline"), change(20, "active")},
+			wantPercent:  90,
+			wantExpected: 100,
+		},
+		{
+			name:      "flapping",
+			createdAt: created,
+			history: []db.StatusChange{
+				change(10, "offline"), change(11, "active"),
+				change(20, "offline"), change(20.5, "degraded"),
+				change(30, "offline"), change(30, "active"), // Same instant: last one wins
+				change(99, "offline"),
+			},
+			wantPercent:  97.5,
+			wantExpected: 100,
+		},
+		{
+			name:         "unordered history",
+			createdAt:    created,
+			history:      []db.StatusChange{change(20, "active"), change(10, "offline")},
+			wantPercent:  90,
+			wantExpected: 100,
+		},
+		{
+			name:         "outage inside maintenance does not count",
+			createdAt:    created,
+			history:      []db.StatusChange{change(10, "maintenance"), change(20, "active")},
+			maintenance:  []db.MaintenanceWindow{maintenanceWindow(10, 20)},
+			wantPercent:  100,
+			wantExpected: 90,
+			wantExcluded: 10,
+		},
+		{
+			name:         "outage overrunning maintenance counts for the overrun",
+			createdAt:    created,
+			history:      []db.StatusChange{change(10, "offline"), change(25, "active")},
+			maintenance:  []db.MaintenanceWindow{maintenanceWindow(10, 20)},
+			wantPercent:  100 * 85.0 / 90.0,
+			wantExpected: 90,
+			wantExcluded: 10,
+		},
+		{
+			name:        "overlapping maintenance is excluded once",
+			createdAt:   created,
+			history:     []db.StatusChange{change(10, "offline"), change(30, "active")},
+			maintenance: []db.MaintenanceWindow{maintenanceWindow(10, 20), maintenanceWindow(15, 30), maintenanceWindow(12, 14)},
+			wantPercent: 100, wantExpected: 80, wantExcluded: 20,
+		},
+		{
+			name:         "maintenance outside the window is clipped",
+			createdAt:    created,
+			maintenance:  []db.MaintenanceWindow{maintenanceWindow(-10, 5), maintenanceWindow(95, 120)},
+			wantPercent:  100,
+			wantExpected: 90,
+			wantExcluded: 10,
+		},
+		{
+			name:         "up time inside maintenance is not counted either",
+			createdAt:    created,
+			history:      []db.StatusChange{change(50, "offline")},
+			maintenance:  []db.MaintenanceWindow{maintenanceWindow(40, 60)},
+			wantPercent:  100 * 40.0 / 80.0,
+			wantExpected: 80,
+			wantExcluded: 20,
+		},
+		{
+			name:         "created mid-window",
+			createdAt:    at(60),
+			history:      []db.StatusChange{change(70, "offline"), change(80, "active")},
+			wantPercent:  75,
+			wantExpected: 40,
+		},
+		{
+			name:         "created mid-window with earlier maintenance",
+			createdAt:    at(60),
+			maintenance:  []db.MaintenanceWindow{maintenanceWindow(50, 70)},
+			wantPercent:  100,
+			wantExpected: 30,
+			wantExcluded: 10,
+		},
+		{
+			name:         "created after the window",
+			createdAt:    at(150),
+			wantPercent:  -1,
+			wantExpected: 0,
+		},
+		{
+			name:         "maintenance covers the window",
+			createdAt:    created,
+			history:      []db.StatusChange{change(-1, "offline")},
+			maintenance:  []db.MaintenanceWindow{maintenanceWindow(-10, 200)},
+			wantPercent:  -1,
+			wantExpected: 0,
+			wantExcluded: 100,
+		},
+		{
+			name:         "unapproved maintenance status counts as down",
+			createdAt:    created,
+			history:      []db.StatusChange{change(0, "maintenance"), change(50, "active")},
+			wantPercent:  50,
+			wantExpected: 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ComputeUptime(tt.createdAt, tt.history, tt.maintenance, uptimeFrom, at(100))
+			if tt.wantPercent < 0 {
+				if got.Percent != nil {
+					t.Errorf("percent: got %v, want none", *got.Percent)
+				}
+			} else if got.Percent == nil || math.Abs(*got.Percent-tt.wantPercent) > 1e-9 {
+				t.Errorf("percent: got %v, want %v", got.Percent, tt.wantPercent)
+			}
+			if want := int64(tt.wantExpected * 3600); got.ExpectedSeconds != want {
+				t.Errorf("expected seconds: got %d, want %d", got.ExpectedSeconds, want)
+			}
+			if want := int64(tt.wantExcluded * 3600); got.ExcludedSeconds != want {
+				t.Errorf("excluded seconds: got %d, want %d", got.ExcludedSeconds, want)
+			}
+		})
+	}
+}
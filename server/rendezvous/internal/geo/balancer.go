@@ -2,26 +2,39 @@ package geo
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
+	"rendezvous/internal/clock"
 	"rendezvous/internal/db"
 )
 
 // GeoBalancer handles geo-load balancing for gateway selection
 type GeoBalancer struct {
-	db *db.Database
+	db    *db.Database
+	clock clock.Clock
 }
 
 // NewBalancer creates a new geo balancer
 func NewBalancer(database *db.Database) *GeoBalancer {
 	return &GeoBalancer{
-		db: database,
+		db:    database,
+		clock: clock.Real{},
 	}
 }
 
+// SetClock replaces the time source scheduled rollouts are evaluated at; it
+// is intended for tests.
+func (b *GeoBalancer) SetClock(c clock.Clock) {
+	b.clock = c
+}
+
 // SelectRegion selects the best region for a client based on their location
 func (b *GeoBalancer) SelectRegion(
 	ctx context.Context,
@@ -54,44 +67,26 @@ func (b *GeoBalancer) SelectRegion(
 	return "us-east-1", nil
 }
 
-// GetLoadBalancedGateways returns gateways for a region with load balancing
+// GetLoadBalancedGateways returns up to count of a region's gateways,
+// sampled by available capacity unless WithStrategy says otherwise. The
+// returned gateways are copies with Load set.
 func (b *GeoBalancer) GetLoadBalancedGateways(
 	ctx context.Context,
 	region string,
 	count int,
+	opts ...GatewayOption,
 ) ([]*db.Gateway, error) {
 	// Get all gateways in region
 	gateways, err := b.db.GetGatewaysByRegion(ctx, region)
 	if err != nil {
-		return nil, err
-	}
-
-	if len(gateways) == 0 {
-		return []*db.Gateway{}, nil
-	}
-
-	// Sort by load (prefer lower load)
-	// In production, use a more sophisticated algorithm (weighted random, etc.)
-	sorted := make([]*db.Gateway, len(gateways))
-	copy(sorted, gateways)
-	
-	// Simple load-based sorting
-	for i := 0; i < len(sorted)-1; i++ {
-		for j := i + 1; j < len(sorted); j++ {
-			sorted[i].Load = calculateGatewayLoad(sorted[i])
-			sorted[j].Load = calculateGatewayLoad(sorted[j])
-			if sorted[i].Load > sorted[j].Load {
-				sorted[i], sorted[j] = sorted[j], sorted[i]
-			}
-		}
+		return nil, fmt.Errorf("failed to load gateways for region %s: %w", region, err)
 	}
 
-	// Select top N gateways
-	if count > len(sorted) {
-		count = len(sorted)
+	var selection gatewaySelection
+	for _, opt := range opts {
+		opt(&selection)
 	}
-
-	return sorted[:count], nil
+	return pickGateways(gateways, count, selection), nil
 }
 
 // UpdateGatewayLoad updates a gateway's load metric
@@ -119,14 +114,17 @@ func (b *GeoBalancer) UpdateGatewayLoad(
 		load,
 		gatewayID,
 	)
-	return err
+	if err != nil {
+		return fmt.Errorf("failed to update gateway load: %w", db.ClassifyError(err))
+	}
+	return nil
 }
 
 // isRegionAvailable checks if a region has available gateways
 func (b *GeoBalancer) isRegionAvailable(ctx context.Context, region string) (bool, error) {
 	gateways, err := b.db.GetGatewaysByRegion(ctx, region)
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("failed to load gateways for region %s: %w", region, err)
 	}
 
 	// Check if any gateway is active and not overloaded
@@ -139,24 +137,66 @@ func (b *GeoBalancer) isRegionAvailable(ctx context.Context, region string) (boo
 	return false, nil
 }
 
-// findNearestRegion finds the nearest available region to the client
-func (b *GeoBalancer) findNearestRegion(ctx context.Context, clientRegion string) (string, error) {
-	regionPreference := map[string][]string{
-		"us-east-1":     {"us-east-1", "us-west-1", "eu-west-1", "ap-southeast-1"},
-		"us-west-1":     {"us-west-1", "us-east-1", "ap-southeast-1", "eu-west-1"},
-		"eu-west-1":     {"eu-west-1", "eu-central-1", "us-east-1", "ap-southeast-1"},
-		"eu-central-1":  {"eu-central-1", "eu-west-1", "us-east-1", "ap-southeast-1"},
-		"ap-southeast-1": {"ap-southeast-1", "ap-east-1", "us-west-1", "eu-west-1"},
-		"ap-east-1":     {"ap-east-1", "ap-southeast-1", "us-west-1", "eu-west-1"},
-		"me-south-1":    {"me-south-1", "eu-central-1", "eu-west-1", "ap-southeast-1"},
+// regionPreference lists, for each known region, the regions to try in order
+var regionPreference = map[string][]string{
+	"us-east-1":      {"us-east-1", "us-west-1", "eu-west-1", "ap-southeast-1"},
+	"us-west-1":      {"us-west-1", "us-east-1", "ap-southeast-1", "eu-west-1"},
+	"eu-west-1":      {"eu-west-1", "eu-central-1", "us-east-1", "ap-southeast-1"},
+	"eu-central-1":   {"eu-central-1", "eu-west-1", "us-east-1", "ap-southeast-1"},
+	"ap-southeast-1": {"ap-southeast-1", "ap-east-1", "us-west-1", "eu-west-1"},
+	"ap-east-1":      {"ap-east-1", "ap-southeast-1", "us-west-1", "eu-west-1"},
+	"me-south-1":     {"me-south-1", "eu-central-1", "eu-west-1", "ap-southeast-1"},
+}
+
+// Regions returns the known infrastructure regions in sorted order
+func Regions() []string {
+	regions := make([]string, 0, len(regionPreference))
+	for region := range regionPreference {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// defaultRegionPreference is the order regions are tried in for a region
+// without its own preference
+var defaultRegionPreference = []string{"us-east-1", "us-west-1", "eu-west-1", "ap-southeast-1"}
+
+// nearestRegions lists the regions to try for clientRegion, nearest first
+func nearestRegions(clientRegion string) []string {
+	if candidates, ok := regionPreference[clientRegion]; ok {
+		return candidates
+	}
+	return defaultRegionPreference
+}
+
+// FallbackRegions returns the regions to borrow gateways from when region
+// has too few, nearest first, in the order findNearestRegion tries them
+func FallbackRegions(region string) []string {
+	preference := nearestRegions(region)
+	fallbacks := make([]string, 0, len(preference))
+	for _, r := range preference {
+		if r != region {
+			fallbacks = append(fallbacks, r)
+		}
 	}
+	return fallbacks
+}
 
-	candidates, ok := regionPreference[clientRegion]
-	if !ok {
-		candidates = []string{"us-east-1", "us-west-1", "eu-west-1", "ap-southeast-1"}
+// findNearestRegion finds the nearest available region to the client: by
+// distance from the client's region, or in the static preference order when
+// it is not located
+func (b *GeoBalancer) findNearestRegion(ctx context.Context, clientRegion string) (string, error) {
+	if origin, ok := b.regionLocation(ctx, clientRegion); ok {
+		nearest, err := b.NearestRegions(ctx, origin)
+		if err != nil {
+			log.Printf("nearest regions unavailable, using the preference order: %v", err)
+		} else if len(nearest) > 0 {
+			return nearest[0], nil
+		}
 	}
 
-	for _, region := range candidates {
+	for _, region := range nearestRegions(clientRegion) {
 		available, err := b.isRegionAvailable(ctx, region)
 		if err == nil && available {
 			return region, nil
@@ -166,24 +206,19 @@ func (b *GeoBalancer) findNearestRegion(ctx context.Context, clientRegion string
 	return "us-east-1", nil
 }
 
-// GetRolloutPercentage returns the rollout percentage for a config version
+// GetRolloutPercentage returns the rollout percentage for a config version.
+// Rollouts stored in the database take precedence over environment variables;
+// versions with no rollout configured are served to everyone.
 func (b *GeoBalancer) GetRolloutPercentage(
 	ctx context.Context,
 	configVersion string,
 	region string,
 ) (int, error) {
-	_ = ctx
-
-	keys := rolloutEnvKeys(configVersion, region)
-	for _, key := range keys {
-		if value := strings.TrimSpace(os.Getenv(key)); value != "" {
-			if percent, err := strconv.Atoi(value); err == nil {
-				return clampPercentage(percent), nil
-			}
-		}
+	rollouts, err := b.loadRollouts(ctx)
+	if err != nil {
+		return 0, err
 	}
-
-	return 100, nil
+	return resolveRolloutPercentage(rollouts, configVersion, region, rolloutEnvKeys(configVersion, region), 100, b.clock.Now()), nil
 }
 
 // ShouldIncludeInRollout determines if a client should receive a new config version
@@ -198,10 +233,136 @@ func (b *GeoBalancer) ShouldIncludeInRollout(
 		return false, err
 	}
 
+	return inRolloutCohort(clientID, configVersion, region, percentage), nil
+}
+
+// GetFeaturePercentage returns the rollout percentage for a named feature key
+// (e.g. "scan_interval_120"). Unlike config versions, features with no rollout
+// configured are off.
+func (b *GeoBalancer) GetFeaturePercentage(
+	ctx context.Context,
+	feature string,
+	region string,
+) (int, error) {
+	rollouts, err := b.loadRollouts(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return resolveRolloutPercentage(rollouts, feature, region, featureEnvKeys(feature, region), 0, b.clock.Now()), nil
+}
+
+// FeatureCohort is the rollout decision for one feature and device
+type FeatureCohort struct {
+	Key        string `json:"key"`
+	Percentage int    `json:"percentage"`
+	InCohort   bool   `json:"in_cohort"`
+}
+
+// EnabledFeatures evaluates each named feature for a device and returns the
+// ones the device's cohort falls into, in the order given. The rollouts table
+// is read once for the whole set.
+func (b *GeoBalancer) EnabledFeatures(
+	ctx context.Context,
+	deviceID string,
+	region string,
+	features []string,
+) ([]string, error) {
+	cohorts, err := b.FeatureCohorts(ctx, deviceID, region, features)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := []string{}
+	for _, cohort := range cohorts {
+		if cohort.InCohort {
+			enabled = append(enabled, cohort.Key)
+		}
+	}
+	return enabled, nil
+}
+
+// FeatureCohorts evaluates each named feature for a device, reporting the
+// resolved percentage alongside whether the device is in the cohort.
+func (b *GeoBalancer) FeatureCohorts(
+	ctx context.Context,
+	deviceID string,
+	region string,
+	features []string,
+) ([]FeatureCohort, error) {
+	rollouts, err := b.loadRollouts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := b.clock.Now()
+	cohorts := make([]FeatureCohort, 0, len(features))
+	for _, feature := range features {
+		percentage := resolveRolloutPercentage(rollouts, feature, region, featureEnvKeys(feature, region), 0, now)
+		cohorts = append(cohorts, FeatureCohort{
+			Key:        feature,
+			Percentage: percentage,
+			InCohort:   inRolloutCohort(deviceID, feature, region, percentage),
+		})
+	}
+	return cohorts, nil
+}
+
+func (b *GeoBalancer) loadRollouts(ctx context.Context) ([]*db.Rollout, error) {
+	if b.db == nil {
+		return nil, nil
+	}
+	rollouts, err := b.db.GetRollouts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rollouts: %w", err)
+	}
+	return rollouts, nil
+}
+
+// resolveRolloutPercentage picks the most specific rollout for a key: a stored
+// region row, then a stored all-regions row, then the environment, then the
+// default. Scheduled rollouts are evaluated at now.
+func resolveRolloutPercentage(
+	rollouts []*db.Rollout,
+	key string,
+	region string,
+	envKeys []string,
+	defaultPercent int,
+	now time.Time,
+) int {
+	var global *db.Rollout
+	for _, rollout := range rollouts {
+		if rollout.Key != key {
+			continue
+		}
+		if rollout.Region == region && region != "" {
+			return clampPercentage(rollout.EffectivePercentage(now))
+		}
+		if rollout.Region == "" {
+			global = rollout
+		}
+	}
+	if global != nil {
+		return clampPercentage(global.EffectivePercentage(now))
+	}
+
+	for _, envKey := range envKeys {
+		if value := strings.TrimSpace(os.Getenv(envKey)); value != "" {
+			if percent, err := strconv.Atoi(value); err == nil {
+				return clampPercentage(percent)
+			}
+		}
+	}
+
+	return defaultPercent
+}
+
+// inRolloutCohort buckets a client into 0-99 for a rollout key. The bucket is
+// stable for a given client, key, and region.
+func inRolloutCohort(clientID, key, region string, percentage int) bool {
 	// Simple hash-based rollout
 	// In production, use a more sophisticated algorithm
-	hash := hashString(clientID + configVersion + region)
-	return (hash % 100) < percentage, nil
+	hash := hashString(clientID + key + region)
+	return (hash % 100) < percentage
 }
 
 // hashString creates a simple hash from a string
@@ -242,6 +403,22 @@ func rolloutEnvKeys(configVersion, region string) []string {
 	return keys
 }
 
+func featureEnvKeys(feature, region string) []string {
+	var keys []string
+	normalizedFeature := normalizeRolloutKey(feature)
+	normalizedRegion := normalizeRolloutKey(region)
+
+	if normalizedFeature == "" {
+		return keys
+	}
+	if normalizedRegion != "" {
+		keys = append(keys, "LUMENLINK_FEATURE_ROLLOUT_"+normalizedFeature+"_"+normalizedRegion)
+	}
+	keys = append(keys, "LUMENLINK_FEATURE_ROLLOUT_"+normalizedFeature)
+
+	return keys
+}
+
 func normalizeRolloutKey(value string) string {
 	if value == "" {
 		return ""
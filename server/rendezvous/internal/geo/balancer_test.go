@@ -2,9 +2,12 @@ package geo
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/clock"
 	"rendezvous/internal/db"
 )
 
@@ -54,6 +57,19 @@ func TestClampPercentage(t *testing.T) {
 	}
 }
 
+func TestFallbackRegions(t *testing.T) {
+	if got := fmt.Sprint(FallbackRegions("eu-west-1")); got != "[eu-central-1 us-east-1 ap-southeast-1]" {
+		t.Errorf("eu-west-1: got %s", got)
+	}
+	if got := fmt.Sprint(FallbackRegions("us-east-1")); got != "[us-west-1 eu-west-1 ap-southeast-1]" {
+		t.Errorf("us-east-1: got %s", got)
+	}
+	// Unknown regions borrow in the default order, as findNearestRegion tries
+	if got := fmt.Sprint(FallbackRegions("af-south-1")); got != "[us-east-1 us-west-1 eu-west-1 ap-southeast-1]" {
+		t.Errorf("af-south-1: got %s", got)
+	}
+}
+
 func TestGetLoadBalancedGateways(t *testing.T) {
 	ctx := context.Background()
 	database := mustTestDB(t)
@@ -114,6 +130,83 @@ func TestShouldIncludeInRollout(t *testing.T) {
 	}
 }
 
+func TestResolveRolloutPercentage(t *testing.T) {
+	t.Setenv("LUMENLINK_FEATURE_ROLLOUT_SCAN_INTERVAL_120", "30")
+
+	rollouts := []*db.Rollout{
+		{Key: "scan_interval_120", Region: "", Percentage: 10},
+		{Key: "scan_interval_120", Region: "me-south-1", Percentage: 80},
+		{Key: "1.1", Region: "", Percentage: 25},
+	}
+	tests := []struct {
+		name    string
+		key     string
+		region  string
+		rollout []*db.Rollout
+		want    int
+	}{
+		{"regional row", "scan_interval_120", "me-south-1", rollouts, 80},
+		{"global row", "scan_interval_120", "us-east-1", rollouts, 10},
+		{"env fallback", "scan_interval_120", "us-east-1", nil, 30},
+		{"unconfigured feature", "battery_saver", "us-east-1", rollouts, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveRolloutPercentage(tt.rollout, tt.key, tt.region, featureEnvKeys(tt.key, tt.region), 0, time.Now())
+			if got != tt.want {
+				t.Errorf("resolveRolloutPercentage() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnabledFeatures(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT key, region, percentage`).WillReturnRows(
+		sqlmock.NewRows([]string{"key", "region", "percentage", "description", "created_at", "updated_at",
+			"schedule_start_at", "schedule_end_at", "schedule_start_percentage", "schedule_end_percentage",
+			"schedule_easing", "aborted_at"}).
+			AddRow("always_on", "", 100, nil, now, now, nil, nil, nil, nil, nil, nil).
+			AddRow("always_off", "", 0, nil, now, now, nil, nil, nil, nil, nil, nil),
+	)
+
+	balancer := NewBalancer(db.NewFromPool(sqlDB))
+	enabled, err := balancer.EnabledFeatures(context.Background(), "device-1", "us-east-1",
+		[]string{"always_on", "always_off", "unconfigured"})
+	if err != nil {
+		t.Fatalf("EnabledFeatures: %v", err)
+	}
+	if len(enabled) != 1 || enabled[0] != "always_on" {
+		t.Errorf("EnabledFeatures: got %v, want [always_on]", enabled)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInRolloutCohort_StablePerDevice(t *testing.T) {
+	included := 0
+	for i := 0; i < 1000; i++ {
+		deviceID := fmt.Sprintf("device-%d", i)
+		first := inRolloutCohort(deviceID, "scan_interval_120", "us-east-1", 50)
+		if first != inRolloutCohort(deviceID, "scan_interval_120", "us-east-1", 50) {
+			t.Fatalf("cohort for %s is not stable", deviceID)
+		}
+		if first {
+			included++
+		}
+	}
+	if included == 0 || included == 1000 {
+		t.Errorf("50%% rollout included %d of 1000 devices", included)
+	}
+}
+
 func intPtr(n int) *int { return &n }
 
 func mustTestDB(t *testing.T) *db.Database {
@@ -127,13 +220,57 @@ func mustTestDB(t *testing.T) *db.Database {
 	mock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{
 		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
 		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
 		"created_at", "last_seen", "updated_at",
 	}))
 	mock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{
 		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
 		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
 		"created_at", "last_seen", "updated_at",
 	}))
 
 	return db.NewFromPool(sqlDB)
 }
+
+func TestGetFeaturePercentage_ScheduleBoundaries(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(10 * time.Hour)
+	columns := []string{"key", "region", "percentage", "description", "created_at", "updated_at",
+		"schedule_start_at", "schedule_end_at", "schedule_start_percentage", "schedule_end_percentage",
+		"schedule_easing", "aborted_at"}
+	fake := clock.NewFake(start)
+	balancer := NewBalancer(db.NewFromPool(sqlDB))
+	balancer.SetClock(fake)
+
+	for _, tt := range []struct {
+		at   time.Time
+		want int
+	}{
+		{start, 10},                    // Held until the start, inclusive
+		{start.Add(5 * time.Hour), 50}, // Halfway up a linear ramp
+		{end.Add(-time.Hour), 82},      // Not yet at the end
+		{end, 90},                      // Exactly at the end
+		{end.Add(24 * time.Hour), 90},  // Held afterwards
+	} {
+		mock.ExpectQuery(`SELECT key, region, percentage`).WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("ramp", "", 0, nil, start, start, start, end, 10, 90, "linear", nil))
+		fake.Set(tt.at)
+		got, err := balancer.GetFeaturePercentage(context.Background(), "ramp", "us-east-1")
+		if err != nil {
+			t.Fatalf("GetFeaturePercentage: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("at %s: got %d%%, want %d%%", tt.at.Sub(start), got, tt.want)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
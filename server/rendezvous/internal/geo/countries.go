@@ -0,0 +1,170 @@
+package geo
+
+import (
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// continentRegions is the region each continent's countries are served from
+// unless countries.csv or an override names another
+var continentRegions = map[string]string{
+	"AF": "af-south-1",
+	"AN": "sa-east-1",
+	"AS": "ap-southeast-1",
+	"EU": "eu-central-1",
+	"NA": "us-east-1",
+	"OC": "ap-southeast-1",
+	"SA": "sa-east-1",
+}
+
+//go:embed countries.csv
+var countriesCSV string
+
+// country is a row of countries.csv
+type country struct {
+	region   string
+	centroid Location
+}
+
+// defaultCountries holds every ISO 3166-1 alpha-2 code
+var defaultCountries = mustParseCountries(countriesCSV)
+
+func mustParseCountries(data string) map[string]country {
+	countries, err := parseCountries(data)
+	if err != nil {
+		panic(fmt.Sprintf("embedded country table: %v", err))
+	}
+	return countries
+}
+
+// parseCountries reads country,continent,region,latitude,longitude rows,
+// falling back to the continent's region where region is empty
+func parseCountries(data string) (map[string]country, error) {
+	r := csv.NewReader(strings.NewReader(data))
+	r.Comment = '#'
+	r.FieldsPerRecord = 5
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != "country,continent,region,latitude,longitude" {
+		return nil, fmt.Errorf("missing country,continent,region,latitude,longitude header")
+	}
+
+	countries := make(map[string]country, len(records)-1)
+	for _, record := range records[1:] {
+		code, continent, region := record[0], record[1], record[2]
+		if _, ok := countries[code]; ok {
+			return nil, fmt.Errorf("duplicate country %s", code)
+		}
+		if region == "" {
+			var ok bool
+			if region, ok = continentRegions[continent]; !ok {
+				return nil, fmt.Errorf("country %s: unknown continent %q", code, continent)
+			}
+		}
+		centroid, err := parseLocation(record[3], record[4])
+		if err != nil {
+			return nil, fmt.Errorf("country %s: %w", code, err)
+		}
+		countries[code] = country{region: region, centroid: centroid}
+	}
+	return countries, nil
+}
+
+// CountryCentroid returns the approximate centre of an ISO country, for
+// placing clients that send no coordinates
+func CountryCentroid(code string) (Location, bool) {
+	c, ok := defaultCountries[strings.ToUpper(strings.TrimSpace(code))]
+	return c.centroid, ok
+}
+
+// CountryRegions maps countries to the region their clients are served from:
+// the embedded table, with rows in country_region_overrides taking
+// precedence. Overrides are read by Refresh; a nil CountryRegions uses the
+// embedded table alone.
+type CountryRegions struct {
+	db    *db.Database
+	clock clock.Clock
+
+	mu        sync.RWMutex
+	overrides map[string]string
+}
+
+// NewCountryRegions creates a country table; call Refresh to load overrides
+func NewCountryRegions(database *db.Database) *CountryRegions {
+	return &CountryRegions{
+		db:        database,
+		clock:     clock.Real{},
+		overrides: map[string]string{},
+	}
+}
+
+// Lookup returns the region for an ISO country code, reporting false when
+// the code names no country
+func (r *CountryRegions) Lookup(country string) (string, bool) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if r != nil {
+		r.mu.RLock()
+		region, ok := r.overrides[country]
+		r.mu.RUnlock()
+		if ok {
+			return region, true
+		}
+	}
+	c, ok := defaultCountries[country]
+	return c.region, ok
+}
+
+// Override returns the region an operator has pinned an ISO country code to
+// in country_region_overrides, reporting false when there is none
+func (r *CountryRegions) Override(country string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	region, ok := r.overrides[strings.ToUpper(strings.TrimSpace(country))]
+	return region, ok
+}
+
+// Refresh reloads the overrides. On failure the previous overrides stay.
+func (r *CountryRegions) Refresh(ctx context.Context) error {
+	if r.db == nil {
+		return nil
+	}
+	overrides, err := r.db.GetCountryRegionOverrides(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.overrides = overrides
+	r.mu.Unlock()
+	return nil
+}
+
+// Start refreshes the overrides every interval until ctx is cancelled.
+func (r *CountryRegions) Start(ctx context.Context, interval time.Duration) {
+	ticker := r.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if err := r.Refresh(ctx); err != nil {
+				log.Printf("country region refresh failed: %v", err)
+			}
+		}
+	}
+}
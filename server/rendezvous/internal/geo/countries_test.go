@@ -0,0 +1,147 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+func TestCountryRegions_Lookup(t *testing.T) {
+	var regions *CountryRegions
+	tests := []struct {
+		country string
+		want    string
+	}{
+		// A country on every continent
+		{"NG", "af-south-1"},
+		{"AQ", "sa-east-1"},
+		{"VN", "ap-southeast-1"},
+		{"PL", "eu-central-1"},
+		{"CA", "us-east-1"},
+		{"AU", "ap-southeast-1"},
+		{"BR", "sa-east-1"},
+		// Countries served from another region than their continent's
+		{"CN", "ap-east-1"},
+		{"IR", "me-south-1"},
+		{"EG", "me-south-1"},
+		{"IN", "ap-south-1"},
+		{"GB", "eu-west-1"},
+		{"RU", "eu-central-1"},
+		{"US", "us-east-1"},
+		{" de ", "eu-central-1"},
+	}
+	for _, tt := range tests {
+		if got, ok := regions.Lookup(tt.country); !ok || got != tt.want {
+			t.Errorf("Lookup(%q) = %q, %v; want %q", tt.country, got, ok, tt.want)
+		}
+	}
+	for _, country := range []string{"", "XX", "T1", "ZZ"} {
+		if got, ok := regions.Lookup(country); ok {
+			t.Errorf("Lookup(%q) = %q, want no region", country, got)
+		}
+	}
+}
+
+func TestCountryTable_Complete(t *testing.T) {
+	if len(defaultCountries) != 249 {
+		t.Errorf("got %d countries, want the 249 of ISO 3166-1", len(defaultCountries))
+	}
+	// ap-south-1 has no preference list of its own yet
+	known := map[string]bool{"ap-south-1": true}
+	for _, region := range continentRegions {
+		known[region] = true
+	}
+	for region := range regionPreference {
+		known[region] = true
+	}
+	for code, c := range defaultCountries {
+		if !known[c.region] {
+			t.Errorf("%s maps to unknown region %q", code, c.region)
+		}
+	}
+}
+
+func TestParseCountries(t *testing.T) {
+	const header = "country,continent,region,latitude,longitude\n"
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"no header", "FR,EU,,46.6,2.4\n", "header"},
+		{"unknown continent", header + "FR,XY,,46.6,2.4\n", "unknown continent"},
+		{"duplicate", header + "FR,EU,,46.6,2.4\nFR,EU,eu-west-1,46.6,2.4\n", "duplicate"},
+		{"short row", header + "FR,EU,,46.6\n", "wrong number of fields"},
+		{"bad latitude", header + "FR,EU,,north,2.4\n", "invalid latitude"},
+		{"latitude out of range", header + "FR,EU,,146.6,2.4\n", "out of range"},
+	}
+	for _, tt := range tests {
+		if _, err := parseCountries(tt.data); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	countries, err := parseCountries("# comment\n" + header + "FR,EU,,46.6,2.4\nGB,EU,eu-west-1,54.0,-2.5\n")
+	if err != nil {
+		t.Fatalf("parseCountries: %v", err)
+	}
+	if countries["FR"].region != "eu-central-1" || countries["GB"].region != "eu-west-1" {
+		t.Errorf("got %v", countries)
+	}
+	if got := countries["GB"].centroid; got != (Location{Latitude: 54, Longitude: -2.5}) {
+		t.Errorf("GB centroid: got %+v", got)
+	}
+}
+
+func TestCountryRegions_Overrides(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	mock.ExpectQuery(`FROM country_region_overrides`).WillReturnRows(
+		sqlmock.NewRows([]string{"country", "region"}).
+			AddRow("NG", "eu-west-1").
+			AddRow("ar", "us-east-1"))
+	mock.ExpectQuery(`FROM country_region_overrides`).WillReturnError(errors.New("connection refused"))
+	mock.ExpectQuery(`FROM country_region_overrides`).WillReturnRows(sqlmock.NewRows([]string{"country", "region"}))
+
+	regions := NewCountryRegions(db.NewFromPool(sqlDB))
+	if err := regions.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	check := func(when string, want map[string]string) {
+		t.Helper()
+		for country, region := range want {
+			if got, _ := regions.Lookup(country); got != region {
+				t.Errorf("%s: Lookup(%s) = %q, want %q", when, country, got, region)
+			}
+		}
+	}
+	check("overridden", map[string]string{"NG": "eu-west-1", "AR": "us-east-1", "KE": "af-south-1"})
+	if region, ok := regions.Override("ng"); !ok || region != "eu-west-1" {
+		t.Errorf("Override(ng) = %q, %v; want eu-west-1", region, ok)
+	}
+	if _, ok := regions.Override("KE"); ok {
+		t.Error("Override(KE) reported an override for a mapped country")
+	}
+
+	// A failed reload keeps the overrides
+	if err := regions.Refresh(context.Background()); err == nil {
+		t.Error("Refresh: expected an error")
+	}
+	check("after a failed refresh", map[string]string{"NG": "eu-west-1", "AR": "us-east-1"})
+
+	// Removed overrides fall back to the table
+	if err := regions.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	check("cleared", map[string]string{"NG": "af-south-1", "AR": "sa-east-1"})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,116 @@
+package geo
+
+import (
+	"cmp"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"slices"
+
+	"rendezvous/internal/db"
+)
+
+// GatewayStrategy decides which of a region's gateways
+// GetLoadBalancedGateways returns
+type GatewayStrategy int
+
+const (
+	// StrategyWeightedRandom samples gateways without replacement, each
+	// weighted by its available capacity, so load spreads across the region
+	// instead of every client piling onto the least loaded gateway
+	StrategyWeightedRandom GatewayStrategy = iota
+	// StrategyLowestLoad returns the least loaded gateways first
+	StrategyLowestLoad
+)
+
+// gatewaySelection is how GetLoadBalancedGateways picks gateways
+type gatewaySelection struct {
+	strategy GatewayStrategy
+	seed     string // Draws are deterministic per seed; empty draws at random
+}
+
+// GatewayOption configures GetLoadBalancedGateways
+type GatewayOption func(*gatewaySelection)
+
+// WithStrategy replaces the default weighted random strategy
+func WithStrategy(strategy GatewayStrategy) GatewayOption {
+	return func(s *gatewaySelection) {
+		s.strategy = strategy
+	}
+}
+
+// WithClientSeed makes weighted random draws deterministic for clientID, so
+// the same client is given the same gateways while their loads hold
+func WithClientSeed(clientID string) GatewayOption {
+	return func(s *gatewaySelection) {
+		s.seed = clientID
+	}
+}
+
+// loadedGateway is a gateway with its load computed once for selection
+type loadedGateway struct {
+	gateway *db.Gateway
+	load    float64
+	key     float64 // Sampling key; higher is picked first
+}
+
+// pickGateways returns count gateways by the selection's strategy. The
+// gateways are copies with Load set; the input slice and its gateways are
+// not modified, so they can be shared with other readers.
+func pickGateways(gateways []*db.Gateway, count int, selection gatewaySelection) []*db.Gateway {
+	if count > len(gateways) {
+		count = len(gateways)
+	}
+	if count <= 0 {
+		return []*db.Gateway{}
+	}
+
+	loaded := make([]loadedGateway, len(gateways))
+	for i, gw := range gateways {
+		loaded[i] = loadedGateway{gateway: gw, load: calculateGatewayLoad(gw)}
+	}
+
+	switch selection.strategy {
+	case StrategyLowestLoad:
+		slices.SortStableFunc(loaded, func(a, b loadedGateway) int { return cmp.Compare(a.load, b.load) })
+	default:
+		// Efraimidis-Spirakis sampling: the count highest keys u^(1/w) are
+		// a weighted sample without replacement. Keys are compared as
+		// log(u)/w. Full gateways have no weight and follow the rest, least
+		// loaded first.
+		draw := rand.Float64
+		if selection.seed != "" {
+			draw = rand.New(rand.NewSource(seedOf(selection.seed))).Float64
+		}
+		for i := range loaded {
+			weight := 1 - loaded[i].load
+			if weight <= 0 {
+				loaded[i].key = math.Inf(-1)
+				continue
+			}
+			// 1-u keeps the draw in (0, 1], away from log(0)
+			loaded[i].key = math.Log(1-draw()) / weight
+		}
+		slices.SortStableFunc(loaded, func(a, b loadedGateway) int {
+			if a.key != b.key {
+				return cmp.Compare(b.key, a.key)
+			}
+			return cmp.Compare(a.load, b.load)
+		})
+	}
+
+	picked := make([]*db.Gateway, count)
+	for i := range picked {
+		gw := *loaded[i].gateway
+		gw.Load = loaded[i].load
+		picked[i] = &gw
+	}
+	return picked
+}
+
+// seedOf derives a random source seed from a client ID
+func seedOf(clientID string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(clientID))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,146 @@
+package geo
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"rendezvous/internal/db"
+)
+
+// testGateways returns gateways with max 100 users and the given current
+// users, named gw-<index>
+func testGateways(users ...int) []*db.Gateway {
+	gateways := make([]*db.Gateway, len(users))
+	for i, current := range users {
+		gateways[i] = &db.Gateway{ID: fmt.Sprintf("gw-%d", i), CurrentUsers: current, MaxUsers: intPtr(100)}
+	}
+	return gateways
+}
+
+func gatewayIDs(gateways []*db.Gateway) []string {
+	ids := make([]string, len(gateways))
+	for i, gw := range gateways {
+		ids[i] = gw.ID
+	}
+	return ids
+}
+
+func TestPickGateways_LowestLoad(t *testing.T) {
+	gateways := testGateways(80, 10, 50, 10, 95)
+	picked := pickGateways(gateways, 3, gatewaySelection{strategy: StrategyLowestLoad})
+	if got, want := gatewayIDs(picked), []string{"gw-1", "gw-3", "gw-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if picked[2].Load != 0.5 {
+		t.Errorf("Load: got %v, want 0.5", picked[2].Load)
+	}
+	if got := pickGateways(gateways, 10, gatewaySelection{strategy: StrategyLowestLoad}); len(got) != 5 {
+		t.Errorf("count above the region's gateways: got %d", len(got))
+	}
+	if got := pickGateways(nil, 5, gatewaySelection{}); got == nil || len(got) != 0 {
+		t.Errorf("no gateways: got %v", got)
+	}
+}
+
+func TestPickGateways_WeightedRandom(t *testing.T) {
+	gateways := testGateways(0, 90, 100, 120)
+
+	// Deterministic per client, without replacement, and full gateways last
+	for _, clientID := range []string{"client-1", "client-2", "client-3"} {
+		selection := gatewaySelection{seed: clientID}
+		first := gatewayIDs(pickGateways(gateways, 4, selection))
+		if again := gatewayIDs(pickGateways(gateways, 4, selection)); !reflect.DeepEqual(first, again) {
+			t.Errorf("%s: got %v then %v", clientID, first, again)
+		}
+		if first[2] != "gw-2" || first[3] != "gw-3" {
+			t.Errorf("%s: full gateways not last: %v", clientID, first)
+		}
+	}
+
+	// Picks follow available capacity: 1.0 against 0.1
+	var idle int
+	for i := 0; i < 1000; i++ {
+		if picked := pickGateways(gateways[:2], 1, gatewaySelection{seed: fmt.Sprintf("client-%d", i)}); picked[0].ID == "gw-0" {
+			idle++
+		}
+	}
+	if idle < 850 || idle > 960 {
+		t.Errorf("idle gateway picked %d of 1000 times, want about 909", idle)
+	}
+}
+
+func TestPickGateways_DoesNotMutateInput(t *testing.T) {
+	gateways := testGateways(70, 20, 100, 40, 0)
+	gateways = append(gateways, &db.Gateway{ID: "gw-unlimited", CurrentUsers: 30})
+	snapshot := make([]db.Gateway, len(gateways))
+	for i, gw := range gateways {
+		snapshot[i] = *gw
+	}
+	order := gatewayIDs(gateways)
+
+	for _, selection := range []gatewaySelection{
+		{strategy: StrategyLowestLoad},
+		{strategy: StrategyWeightedRandom, seed: "client-1"},
+		{strategy: StrategyWeightedRandom},
+	} {
+		picked := pickGateways(gateways, 4, selection)
+		for _, gw := range picked {
+			gw.Load = -1
+		}
+		if got := gatewayIDs(gateways); !reflect.DeepEqual(got, order) {
+			t.Errorf("strategy %d reordered the input: %v", selection.strategy, got)
+		}
+		for i, gw := range gateways {
+			if !reflect.DeepEqual(*gw, snapshot[i]) {
+				t.Errorf("strategy %d modified %s: got %+v, want %+v", selection.strategy, gw.ID, *gw, snapshot[i])
+			}
+		}
+	}
+}
+
+// bubbleSortByLoad is the selection GetLoadBalancedGateways used to make,
+// kept as the benchmark's baseline
+func bubbleSortByLoad(gateways []*db.Gateway, count int) []*db.Gateway {
+	sorted := make([]*db.Gateway, len(gateways))
+	copy(sorted, gateways)
+	for i := 0; i < len(sorted)-1; i++ {
+		for j := i + 1; j < len(sorted); j++ {
+			sorted[i].Load = calculateGatewayLoad(sorted[i])
+			sorted[j].Load = calculateGatewayLoad(sorted[j])
+			if sorted[i].Load > sorted[j].Load {
+				sorted[i], sorted[j] = sorted[j], sorted[i]
+			}
+		}
+	}
+	if count > len(sorted) {
+		count = len(sorted)
+	}
+	return sorted[:count]
+}
+
+// BenchmarkPickGateways selects 5 of 1,000 gateways with each strategy and
+// with the bubble sort it replaced
+func BenchmarkPickGateways(b *testing.B) {
+	users := make([]int, 1000)
+	for i := range users {
+		users[i] = (i * 37) % 100
+	}
+	gateways := testGateways(users...)
+
+	b.Run("bubble_sort", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			bubbleSortByLoad(gateways, 5)
+		}
+	})
+	b.Run("lowest_load", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pickGateways(gateways, 5, gatewaySelection{strategy: StrategyLowestLoad})
+		}
+	})
+	b.Run("weighted_random", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pickGateways(gateways, 5, gatewaySelection{})
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// earthRadiusKm is the mean radius of the Earth
+const earthRadiusKm = 6371.0
+
+// Location is a point on the Earth in decimal degrees
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// NewLocation returns the location at latitude and longitude, which must be
+// within [-90, 90] and [-180, 180]
+func NewLocation(latitude, longitude float64) (Location, error) {
+	if math.IsNaN(latitude) || latitude < -90 || latitude > 90 {
+		return Location{}, fmt.Errorf("latitude %v out of range", latitude)
+	}
+	if math.IsNaN(longitude) || longitude < -180 || longitude > 180 {
+		return Location{}, fmt.Errorf("longitude %v out of range", longitude)
+	}
+	return Location{Latitude: latitude, Longitude: longitude}, nil
+}
+
+// parseLocation parses decimal degree strings
+func parseLocation(latitude, longitude string) (Location, error) {
+	lat, err := strconv.ParseFloat(latitude, 64)
+	if err != nil {
+		return Location{}, fmt.Errorf("invalid latitude %q", latitude)
+	}
+	lng, err := strconv.ParseFloat(longitude, 64)
+	if err != nil {
+		return Location{}, fmt.Errorf("invalid longitude %q", longitude)
+	}
+	return NewLocation(lat, lng)
+}
+
+// ClientLocation returns where a client approximately is: the coordinates it
+// sent, or else its country's centroid. It reports false when neither is
+// known.
+func ClientLocation(country string, latitude, longitude *float64) (Location, bool) {
+	if latitude != nil && longitude != nil {
+		if location, err := NewLocation(*latitude, *longitude); err == nil {
+			return location, true
+		}
+	}
+	return CountryCentroid(country)
+}
+
+// distanceKm returns the great-circle distance between a and b by the
+// haversine formula
+func distanceKm(a, b Location) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
@@ -0,0 +1,167 @@
+package geo
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"math"
+	"slices"
+
+	"rendezvous/internal/db"
+)
+
+// regionDistanceBandKm groups regions by distance: regions in the same band
+// are about as near, and the less loaded is preferred among them
+const regionDistanceBandKm = 500
+
+// regionAvailableLoad is the load a region needs a gateway under to be
+// available
+const regionAvailableLoad = 0.9
+
+// rankedRegion is a located region's distance from a client and its load
+type rankedRegion struct {
+	name     string
+	distance float64
+	load     float64
+}
+
+// rankRegions orders the regions in loads by distance from origin in bands
+// of regionDistanceBandKm, then by load, then by exact distance. Regions
+// missing from loads are left out; a nil loads ranks every region by
+// distance alone.
+func rankRegions(origin Location, regions []*db.Region, loads map[string]float64) []string {
+	ranked := make([]rankedRegion, 0, len(regions))
+	for _, r := range regions {
+		load, ok := loads[r.Name]
+		if loads != nil && !ok {
+			continue
+		}
+		ranked = append(ranked, rankedRegion{
+			name:     r.Name,
+			distance: distanceKm(origin, Location{Latitude: r.Latitude, Longitude: r.Longitude}),
+			load:     load,
+		})
+	}
+	slices.SortFunc(ranked, func(a, b rankedRegion) int {
+		if c := cmp.Compare(math.Floor(a.distance/regionDistanceBandKm), math.Floor(b.distance/regionDistanceBandKm)); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.load, b.load); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.distance, b.distance); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.name, b.name)
+	})
+
+	names := make([]string, len(ranked))
+	for i, r := range ranked {
+		names[i] = r.name
+	}
+	return names
+}
+
+// availableLoads returns the mean load of the regions with a gateway under
+// regionAvailableLoad
+func availableLoads(loads []*db.RegionLoad) map[string]float64 {
+	available := map[string]float64{}
+	for _, l := range loads {
+		if l.Minimum < regionAvailableLoad {
+			available[l.Region] = l.Mean
+		}
+	}
+	return available
+}
+
+// NearestRegions returns the available located regions nearest origin
+// first, with the less loaded first among regions about as near. Regions
+// missing from the regions table are not ranked. Region loads come from the
+// policy cache, so ranking does not read every gateway on each request.
+func (b *GeoBalancer) NearestRegions(ctx context.Context, origin Location) ([]string, error) {
+	regions, err := b.db.GetRegions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	loads, err := b.db.GetRegionLoads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rankRegions(origin, regions, availableLoads(loads)), nil
+}
+
+// RegionForClient returns the region to serve a client from: mapped, the
+// region its country maps to, while that region is available, and otherwise
+// the available located region nearest origin. Distance only decides for
+// countries without a mapped region or whose region is full or down, since
+// a country's centroid can be far from where its clients are. mapped is
+// returned as is when the client is not located or no region is available.
+func (b *GeoBalancer) RegionForClient(ctx context.Context, mapped string, origin Location, located bool) (string, error) {
+	loads, err := b.db.GetRegionLoads(ctx)
+	if err != nil {
+		return "", err
+	}
+	available := availableLoads(loads)
+	if _, ok := available[mapped]; ok || !located {
+		return mapped, nil
+	}
+	regions, err := b.db.GetRegions(ctx)
+	if err != nil {
+		return "", err
+	}
+	if ranked := rankRegions(origin, regions, available); len(ranked) > 0 {
+		return ranked[0], nil
+	}
+	return mapped, nil
+}
+
+// NearestFallbackRegions returns the regions to borrow gateways from when
+// region has too few: the other located regions, nearest first. Without
+// coordinates for region, or when they cannot be read, it returns
+// FallbackRegions' preference order.
+func (b *GeoBalancer) NearestFallbackRegions(ctx context.Context, region string) []string {
+	if b.db == nil {
+		return FallbackRegions(region)
+	}
+	regions, err := b.db.GetRegions(ctx)
+	if err != nil {
+		log.Printf("region coordinates unavailable, borrowing in preference order: %v", err)
+		return FallbackRegions(region)
+	}
+	origin, ok := findRegion(regions, region)
+	if !ok {
+		return FallbackRegions(region)
+	}
+
+	fallbacks := []string{}
+	for _, name := range rankRegions(origin, regions, nil) {
+		if name != region {
+			fallbacks = append(fallbacks, name)
+		}
+	}
+	return fallbacks
+}
+
+// regionLocation returns where region is, reporting false when it has no
+// coordinates or they cannot be read
+func (b *GeoBalancer) regionLocation(ctx context.Context, region string) (Location, bool) {
+	if region == "" {
+		return Location{}, false
+	}
+	regions, err := b.db.GetRegions(ctx)
+	if err != nil {
+		log.Printf("region coordinates unavailable: %v", err)
+		return Location{}, false
+	}
+	return findRegion(regions, region)
+}
+
+// findRegion returns the location of the named region among regions
+func findRegion(regions []*db.Region, name string) (Location, bool) {
+	for _, r := range regions {
+		if r.Name == name {
+			return Location{Latitude: r.Latitude, Longitude: r.Longitude}, true
+		}
+	}
+	return Location{}, false
+}
@@ -0,0 +1,313 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/cache"
+	"rendezvous/internal/db"
+)
+
+// testRegions are a few of the seeded regions, plus London
+var testRegions = []*db.Region{
+	{Name: "eu-central-1", Latitude: 50.11, Longitude: 8.68},
+	{Name: "eu-west-1", Latitude: 53.35, Longitude: -6.26},
+	{Name: "eu-west-2", Latitude: 51.51, Longitude: -0.13},
+	{Name: "me-south-1", Latitude: 26.07, Longitude: 50.56},
+	{Name: "us-east-1", Latitude: 38.95, Longitude: -77.45},
+}
+
+var (
+	paris    = Location{Latitude: 48.86, Longitude: 2.35}
+	brussels = Location{Latitude: 50.85, Longitude: 4.35}
+)
+
+func TestDistanceKm(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Location
+		want float64
+	}{
+		{"same point", paris, paris, 0},
+		{"London to Paris", Location{Latitude: 51.51, Longitude: -0.13}, paris, 344},
+		{"across the antimeridian", Location{Latitude: 0, Longitude: 179.5}, Location{Latitude: 0, Longitude: -179.5}, 111},
+		{"pole to pole", Location{Latitude: 90}, Location{Latitude: -90}, 20015},
+	}
+	for _, tt := range tests {
+		if got := distanceKm(tt.a, tt.b); math.Abs(got-tt.want) > 2 {
+			t.Errorf("%s: got %.0f km, want %.0f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClientLocation(t *testing.T) {
+	lat, lng := 35.69, 51.39
+	if got, ok := ClientLocation("FR", &lat, &lng); !ok || got != (Location{Latitude: lat, Longitude: lng}) {
+		t.Errorf("explicit coordinates: got %+v, %v", got, ok)
+	}
+	if got, ok := ClientLocation("fr", nil, nil); !ok || distanceKm(got, paris) > 500 {
+		t.Errorf("FR centroid: got %+v, %v", got, ok)
+	}
+	bad := 91.0
+	if got, ok := ClientLocation("FR", &bad, &lng); !ok || distanceKm(got, paris) > 500 {
+		t.Errorf("out of range coordinates should fall back to the centroid: got %+v, %v", got, ok)
+	}
+	if got, ok := ClientLocation("ZZ", nil, &lng); ok {
+		t.Errorf("unknown country: got %+v", got)
+	}
+}
+
+func TestRankRegions(t *testing.T) {
+	all := map[string]float64{"eu-central-1": 0.5, "eu-west-1": 0.5, "eu-west-2": 0.5, "me-south-1": 0.5, "us-east-1": 0.5}
+	tests := []struct {
+		name   string
+		origin Location
+		loads  map[string]float64
+		want   []string
+	}{
+		{
+			name:   "by distance",
+			origin: paris,
+			loads:  all,
+			want:   []string{"eu-west-2", "eu-central-1", "eu-west-1", "me-south-1", "us-east-1"},
+		},
+		{
+			name:   "distance alone",
+			origin: brussels,
+			want:   []string{"eu-central-1", "eu-west-2", "eu-west-1", "me-south-1", "us-east-1"},
+		},
+		{
+			// Frankfurt and London are both about 320 km from Brussels
+			name:   "load breaks ties within a band",
+			origin: brussels,
+			loads:  map[string]float64{"eu-central-1": 0.7, "eu-west-2": 0.2, "eu-west-1": 0.1, "us-east-1": 0},
+			want:   []string{"eu-west-2", "eu-central-1", "eu-west-1", "us-east-1"},
+		},
+		{
+			name:   "unavailable regions left out",
+			origin: paris,
+			loads:  map[string]float64{"me-south-1": 0.5, "us-east-1": 0.1},
+			want:   []string{"me-south-1", "us-east-1"},
+		},
+		{
+			name:   "none available",
+			origin: paris,
+			loads:  map[string]float64{},
+			want:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		if got := rankRegions(tt.origin, testRegions, tt.loads); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAvailableLoads(t *testing.T) {
+	got := availableLoads([]*db.RegionLoad{
+		{Region: "eu-west-1", Mean: 0.575, Minimum: 0.2},
+		{Region: "me-south-1", Mean: 0.95, Minimum: 0.95},
+		{Region: "us-east-1", Mean: 0.9, Minimum: 0.9},
+	})
+	if want := map[string]float64{"eu-west-1": 0.575}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+var regionColumns = []string{"name", "latitude", "longitude"}
+
+func regionRows() *sqlmock.Rows {
+	rows := sqlmock.NewRows(regionColumns)
+	for _, r := range testRegions {
+		rows.AddRow(r.Name, r.Latitude, r.Longitude)
+	}
+	return rows
+}
+
+var regionLoadColumns = []string{"region", "avg", "min"}
+
+func TestNearestRegions(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	balancer := NewBalancer(db.NewFromPool(sqlDB))
+	ctx := context.Background()
+
+	// Frankfurt is full
+	mock.ExpectQuery(`FROM regions`).WillReturnRows(regionRows())
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(sqlmock.NewRows(regionLoadColumns).
+		AddRow("eu-central-1", 0.95, 0.95).
+		AddRow("eu-west-1", 0.1, 0.1).
+		AddRow("us-east-1", 0, 0))
+	if got, err := balancer.NearestRegions(ctx, brussels); err != nil || !reflect.DeepEqual(got, []string{"eu-west-1", "us-east-1"}) {
+		t.Errorf("got %v, %v; want eu-west-1, us-east-1", got, err)
+	}
+
+	mock.ExpectQuery(`FROM regions`).WillReturnRows(regionRows())
+	mock.ExpectQuery(`FROM gateways`).WillReturnError(errors.New("connection refused"))
+	if got, err := balancer.NearestRegions(ctx, brussels); err == nil {
+		t.Errorf("unreadable loads: got %v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRegionForClient(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	balancer := NewBalancer(db.NewFromPool(sqlDB))
+	ctx := context.Background()
+	loads := func() *sqlmock.Rows {
+		return sqlmock.NewRows(regionLoadColumns).
+			AddRow("eu-central-1", 0.95, 0.95).
+			AddRow("eu-west-1", 0.3, 0.3).
+			AddRow("us-east-1", 0, 0)
+	}
+
+	// An available mapped region wins over a nearer one, without ranking
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(loads())
+	if got, err := balancer.RegionForClient(ctx, "us-east-1", brussels, true); err != nil || got != "us-east-1" {
+		t.Errorf("available mapped region: got %q, %v; want us-east-1", got, err)
+	}
+
+	// A full mapped region gives way to the nearest available one
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(loads())
+	mock.ExpectQuery(`FROM regions`).WillReturnRows(regionRows())
+	if got, err := balancer.RegionForClient(ctx, "eu-central-1", brussels, true); err != nil || got != "eu-west-1" {
+		t.Errorf("full mapped region: got %q, %v; want eu-west-1", got, err)
+	}
+
+	// So does no mapped region at all
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(loads())
+	mock.ExpectQuery(`FROM regions`).WillReturnRows(regionRows())
+	if got, err := balancer.RegionForClient(ctx, "", paris, true); err != nil || got != "eu-west-1" {
+		t.Errorf("unmapped country: got %q, %v; want eu-west-1", got, err)
+	}
+
+	// An unlocated client keeps its mapped region
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(loads())
+	if got, err := balancer.RegionForClient(ctx, "eu-central-1", Location{}, false); err != nil || got != "eu-central-1" {
+		t.Errorf("unlocated: got %q, %v; want eu-central-1", got, err)
+	}
+
+	mock.ExpectQuery(`FROM gateways`).WillReturnError(errors.New("connection refused"))
+	if got, err := balancer.RegionForClient(ctx, "eu-central-1", brussels, true); err == nil {
+		t.Errorf("unreadable loads: got %q", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNearestRegions_CachedLoads(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	policy, err := cache.NewPolicyCache(time.Minute, nil)
+	if err != nil {
+		t.Fatalf("NewPolicyCache: %v", err)
+	}
+	database := db.NewFromPool(sqlDB)
+	database.SetPolicyCache(policy)
+	balancer := NewBalancer(database)
+
+	// Gateways are read once for any number of requests within the TTL
+	mock.ExpectQuery(`FROM regions`).WillReturnRows(regionRows())
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(sqlmock.NewRows(regionLoadColumns).
+		AddRow("eu-west-1", 0.1, 0.1).
+		AddRow("us-east-1", 0, 0))
+	for _, origin := range []Location{brussels, paris, brussels} {
+		if got, err := balancer.NearestRegions(context.Background(), origin); err != nil || len(got) != 2 || got[0] != "eu-west-1" {
+			t.Errorf("from %+v: got %v, %v", origin, got, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSelectRegion_Nearest(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	balancer := NewBalancer(db.NewFromPool(sqlDB))
+	ctx := context.Background()
+
+	// From the client's region when it has no gateways
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectQuery(`FROM regions`).WillReturnRows(regionRows())
+	mock.ExpectQuery(`FROM regions`).WillReturnRows(regionRows())
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(sqlmock.NewRows(regionLoadColumns).
+		AddRow("me-south-1", 0.1, 0.1).
+		AddRow("us-east-1", 0, 0))
+	region, err := balancer.SelectRegion(ctx, "eu-west-2", nil)
+	if err != nil || region != "me-south-1" {
+		t.Errorf("from the client's region: got %q, %v; want me-south-1", region, err)
+	}
+
+	// An unreadable regions table falls back to the preference order
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectQuery(`FROM regions`).WillReturnError(errors.New("connection refused"))
+	mock.ExpectQuery(`FROM gateways`).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "public_key", "ip_address", "port", "transport_types", "discovery_channels",
+		"region", "bandwidth_mbps", "current_users", "max_users", "status", "is_honeypot",
+		"operator_id", "approval_status", "asn",
+		"created_at", "last_seen", "updated_at",
+	}).AddRow("gw-1", []byte{}, "192.0.2.1", 443, "{}", "{}", "us-east-1", nil, 10, 100,
+		"active", false, nil, "approved", nil, now, now, now))
+	region, err = balancer.SelectRegion(ctx, "eu-west-2", nil)
+	if err != nil || region != "us-east-1" {
+		t.Errorf("without region coordinates: got %q, %v; want the first region in the default order", region, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNearestFallbackRegions(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	balancer := NewBalancer(db.NewFromPool(sqlDB))
+	ctx := context.Background()
+
+	mock.ExpectQuery(`FROM regions`).WillReturnRows(regionRows())
+	if got, want := balancer.NearestFallbackRegions(ctx, "eu-west-1"), []string{"eu-west-2", "eu-central-1", "us-east-1", "me-south-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("eu-west-1: got %v, want %v", got, want)
+	}
+
+	// Regions without coordinates, and unreadable coordinates, borrow in
+	// the preference order
+	mock.ExpectQuery(`FROM regions`).WillReturnRows(regionRows())
+	if got, want := balancer.NearestFallbackRegions(ctx, "ap-east-1"), FallbackRegions("ap-east-1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("ap-east-1: got %v, want %v", got, want)
+	}
+	mock.ExpectQuery(`FROM regions`).WillReturnError(errors.New("connection refused"))
+	if got, want := balancer.NearestFallbackRegions(ctx, "eu-west-1"), FallbackRegions("eu-west-1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("unreadable: got %v, want %v", got, want)
+	}
+	if got, want := NewBalancer(nil).NearestFallbackRegions(ctx, "eu-west-1"), FallbackRegions("eu-west-1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("no database: got %v, want %v", got, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
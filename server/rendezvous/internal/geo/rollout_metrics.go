@@ -0,0 +1,57 @@
+package geo
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+var rolloutEffectivePercentage = prometheus.NewDesc(
+	"lumenlink_rollout_effective_percentage",
+	"Rollout percentage in effect by key and region (all for every region), evaluated at scrape time",
+	[]string{"key", "region"},
+	nil,
+)
+
+// RolloutCollector exports each stored rollout's effective percentage. It
+// evaluates schedules when scraped, so ramps show up without any writes.
+type RolloutCollector struct {
+	db    *db.Database
+	clock clock.Clock
+}
+
+// NewRolloutCollector creates a collector over the rollouts table
+func NewRolloutCollector(database *db.Database) *RolloutCollector {
+	return &RolloutCollector{db: database, clock: clock.Real{}}
+}
+
+// Describe implements prometheus.Collector
+func (c *RolloutCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rolloutEffectivePercentage
+}
+
+// Collect implements prometheus.Collector. Rollouts come from the policy
+// cache, so scrapes rarely reach the database.
+func (c *RolloutCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rollouts, err := c.db.GetRollouts(ctx)
+	if err != nil {
+		log.Printf("rollout metrics: %v", err)
+		return
+	}
+
+	now := c.clock.Now()
+	for _, rollout := range rollouts {
+		region := rollout.Region
+		if region == "" {
+			region = "all"
+		}
+		ch <- prometheus.MustNewConstMetric(rolloutEffectivePercentage, prometheus.GaugeValue,
+			float64(clampPercentage(rollout.EffectivePercentage(now))), rollout.Key, region)
+	}
+}
@@ -0,0 +1,47 @@
+package geo
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+func TestRolloutCollector(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	aborted := now.Add(-time.Minute)
+	mock.ExpectQuery(`SELECT key, region, percentage`).WillReturnRows(
+		sqlmock.NewRows([]string{"key", "region", "percentage", "description", "created_at", "updated_at",
+			"schedule_start_at", "schedule_end_at", "schedule_start_percentage", "schedule_end_percentage",
+			"schedule_easing", "aborted_at"}).
+			AddRow("always_on", "", 100, nil, now, now, nil, nil, nil, nil, nil, nil).
+			AddRow("ramp", "eu-west-1", 0, nil, now, now, now.Add(-48*time.Hour), now.Add(-24*time.Hour), 0, 80, "ease_in", nil).
+			AddRow("stopped", "", 35, nil, now, now, now.Add(-time.Hour), now.Add(time.Hour), 0, 100, "linear", aborted),
+	)
+
+	want := `
+# HELP lumenlink_rollout_effective_percentage Rollout percentage in effect by key and region (all for every region), evaluated at scrape time
+# TYPE lumenlink_rollout_effective_percentage gauge
+lumenlink_rollout_effective_percentage{key="always_on",region="all"} 100
+lumenlink_rollout_effective_percentage{key="ramp",region="eu-west-1"} 80
+lumenlink_rollout_effective_percentage{key="stopped",region="all"} 35
+`
+	collector := NewRolloutCollector(db.NewFromPool(sqlDB))
+	collector.clock = clock.NewFake(now)
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,167 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+	"rendezvous/internal/apperr"
+)
+
+// DefaultLocale is the language every message must exist in.
+const DefaultLocale = "en"
+
+// maxLocaleLength bounds client-supplied locales before parsing.
+const maxLocaleLength = 35
+
+// ErrInvalidLocale is returned for locales that are not well-formed BCP-47 tags.
+var ErrInvalidLocale = apperr.New(apperr.ErrInvalidInput, "invalid_locale", "invalid locale")
+
+//go:embed messages/*.json
+var messagesFS embed.FS
+
+var defaultCatalog = mustLoadDefault()
+
+// Catalog holds message strings per locale. Each locale is one JSON file
+// (messages/<locale>.json) mapping message keys to text.
+type Catalog struct {
+	defaultLocale string
+	messages      map[string]map[string]string
+}
+
+// Default returns the catalog embedded in the binary.
+func Default() *Catalog {
+	return defaultCatalog
+}
+
+func mustLoadDefault() *Catalog {
+	sub, err := fs.Sub(messagesFS, "messages")
+	if err != nil {
+		panic(err)
+	}
+	catalog, err := LoadCatalog(sub, DefaultLocale)
+	if err != nil {
+		panic(fmt.Sprintf("embedded message catalog: %v", err))
+	}
+	return catalog
+}
+
+// LoadCatalog reads every <locale>.json file in fsys. It fails if a file name
+// is not a BCP-47 tag, a message is empty, or a locale defines a key that is
+// missing from defaultLocale, so that every lookup has a final fallback.
+func LoadCatalog(fsys fs.FS, defaultLocale string) (*Catalog, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := &Catalog{defaultLocale: defaultLocale, messages: make(map[string]map[string]string)}
+	for _, file := range files {
+		locale, err := ParseLocale(strings.TrimSuffix(path.Base(file), ".json"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if _, ok := catalog.messages[locale]; ok {
+			return nil, fmt.Errorf("%s: duplicate locale %s", file, locale)
+		}
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for key, text := range messages {
+			if strings.TrimSpace(text) == "" {
+				return nil, fmt.Errorf("%s: message %q is empty", file, key)
+			}
+		}
+		catalog.messages[locale] = messages
+	}
+
+	defaults, ok := catalog.messages[defaultLocale]
+	if !ok {
+		return nil, fmt.Errorf("default locale %s has no messages", defaultLocale)
+	}
+	for _, locale := range catalog.Locales() {
+		var missing []string
+		for key := range catalog.messages[locale] {
+			if _, ok := defaults[key]; !ok {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return nil, fmt.Errorf("%s defines keys missing from %s: %s", locale, defaultLocale, strings.Join(missing, ", "))
+		}
+	}
+
+	return catalog, nil
+}
+
+// ParseLocale validates a BCP-47 tag and returns its canonical form
+// (e.g. "pt-br" becomes "pt-BR").
+func ParseLocale(value string) (string, error) {
+	if value == "" || len(value) > maxLocaleLength {
+		return "", ErrInvalidLocale
+	}
+	tag, err := language.Parse(value)
+	if err != nil {
+		return "", ErrInvalidLocale
+	}
+	return tag.String(), nil
+}
+
+// Locales returns the locales in the catalog in sorted order.
+func (c *Catalog) Locales() []string {
+	locales := make([]string, 0, len(c.messages))
+	for locale := range c.messages {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Has reports whether key exists (it then exists in the default locale).
+func (c *Catalog) Has(key string) bool {
+	_, ok := c.messages[c.defaultLocale][key]
+	return ok
+}
+
+// Resolve returns the text for key in the closest available locale and the
+// locale it came from. The fallback chain drops subtags from the right
+// ("zh-Hant-TW", "zh-Hant", "zh") and ends at the default locale. Invalid or
+// empty locales resolve in the default locale.
+func (c *Catalog) Resolve(locale, key string) (string, string, bool) {
+	for _, candidate := range FallbackChain(locale, c.defaultLocale) {
+		if text, ok := c.messages[candidate][key]; ok {
+			return text, candidate, true
+		}
+	}
+	return "", "", false
+}
+
+// FallbackChain lists the locales tried for locale, ending at defaultLocale.
+func FallbackChain(locale, defaultLocale string) []string {
+	var chain []string
+	if canonical, err := ParseLocale(locale); err == nil {
+		for candidate := canonical; candidate != ""; {
+			if candidate != defaultLocale {
+				chain = append(chain, candidate)
+			}
+			i := strings.LastIndex(candidate, "-")
+			if i < 0 {
+				break
+			}
+			candidate = candidate[:i]
+		}
+	}
+	return append(chain, defaultLocale)
+}
@@ -0,0 +1,146 @@
+package i18n
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDefaultCatalog(t *testing.T) {
+	catalog := Default()
+	locales := catalog.Locales()
+	if len(locales) < 2 || !catalog.Has("maintenance_scheduled") {
+		t.Fatalf("unexpected embedded catalog: locales %v", locales)
+	}
+	// Every embedded language should be complete, not just valid
+	for _, locale := range locales {
+		for key := range catalog.messages[DefaultLocale] {
+			if _, ok := catalog.messages[locale][key]; !ok {
+				t.Errorf("%s is missing %q", locale, key)
+			}
+		}
+	}
+}
+
+func TestResolve_Fallback(t *testing.T) {
+	catalog, err := LoadCatalog(fstest.MapFS{
+		"en.json":      {Data: []byte(`{"greeting": "Hello", "farewell": "Goodbye"}`)},
+		"es.json":      {Data: []byte(`{"greeting": "Hola", "farewell": "Adiós"}`)},
+		"zh.json":      {Data: []byte(`{"greeting": "你好"}`)},
+		"zh-Hant.json": {Data: []byte(`{"greeting": "您好"}`)},
+	}, "en")
+	if err != nil {
+		t.Fatalf("LoadCatalog: %v", err)
+	}
+
+	tests := []struct {
+		locale, key, wantText, wantLocale string
+	}{
+		{"es", "greeting", "Hola", "es"},
+		{"es-MX", "greeting", "Hola", "es"},
+		{"zh-Hant-TW", "greeting", "您好", "zh-Hant"},
+		{"zh-Hans-CN", "greeting", "你好", "zh"},
+		{"zh-Hant", "farewell", "Goodbye", "en"}, // missing everywhere but the default
+		{"fr-CA", "greeting", "Hello", "en"},
+		{"en-GB", "greeting", "Hello", "en"},
+		{"", "greeting", "Hello", "en"},
+		{"not a locale", "greeting", "Hello", "en"},
+	}
+	for _, tt := range tests {
+		text, locale, ok := catalog.Resolve(tt.locale, tt.key)
+		if !ok || text != tt.wantText || locale != tt.wantLocale {
+			t.Errorf("Resolve(%q, %q) = %q, %q, %v; want %q, %q", tt.locale, tt.key, text, locale, ok, tt.wantText, tt.wantLocale)
+		}
+	}
+
+	if _, _, ok := catalog.Resolve("es", "unknown"); ok {
+		t.Error("Resolve of unknown key: expected not ok")
+	}
+}
+
+func TestFallbackChain(t *testing.T) {
+	got := strings.Join(FallbackChain("zh-hant-tw", "en"), ",")
+	if want := "zh-Hant-TW,zh-Hant,zh,en"; got != want {
+		t.Errorf("FallbackChain: got %s, want %s", got, want)
+	}
+	if got := strings.Join(FallbackChain("en-US", "en"), ","); got != "en-US,en" {
+		t.Errorf("FallbackChain(en-US): got %s", got)
+	}
+}
+
+func TestParseLocale(t *testing.T) {
+	valid := map[string]string{
+		"en":         "en",
+		"pt-br":      "pt-BR",
+		"ZH-hant-tw": "zh-Hant-TW",
+		"es-419":     "es-419",
+	}
+	for input, want := range valid {
+		got, err := ParseLocale(input)
+		if err != nil || got != want {
+			t.Errorf("ParseLocale(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+
+	malformed := []string{"", "e", "english please", "en-", "-US", "12345", "en--US", strings.Repeat("a", 40), "en-US;q=0.9"}
+	for _, input := range malformed {
+		if _, err := ParseLocale(input); !errors.Is(err, ErrInvalidLocale) {
+			t.Errorf("ParseLocale(%q): expected ErrInvalidLocale, got %v", input, err)
+		}
+	}
+}
+
+func TestLoadCatalog_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr string
+	}{
+		{
+			name: "key missing from default",
+			files: fstest.MapFS{
+				"en.json": {Data: []byte(`{"greeting": "Hello"}`)},
+				"es.json": {Data: []byte(`{"greeting": "Hola", "farewell": "Adiós"}`)},
+			},
+			wantErr: "farewell",
+		},
+		{
+			name: "no default locale",
+			files: fstest.MapFS{
+				"es.json": {Data: []byte(`{"greeting": "Hola"}`)},
+			},
+			wantErr: "default locale",
+		},
+		{
+			name: "malformed locale file name",
+			files: fstest.MapFS{
+				"en.json":      {Data: []byte(`{"greeting": "Hello"}`)},
+				"spanish.json": {Data: []byte(`{"greeting": "Hola"}`)},
+			},
+			wantErr: "invalid locale",
+		},
+		{
+			name: "empty message",
+			files: fstest.MapFS{
+				"en.json": {Data: []byte(`{"greeting": " "}`)},
+			},
+			wantErr: "empty",
+		},
+		{
+			name: "invalid JSON",
+			files: fstest.MapFS{
+				"en.json": {Data: []byte(`{"greeting": ["Hello"]}`)},
+			},
+			wantErr: "en.json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadCatalog(tt.files, "en")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadCatalog error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
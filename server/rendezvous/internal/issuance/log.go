@@ -0,0 +1,215 @@
+package issuance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+// maxPending bounds the records waiting to be written, so an unreachable
+// primary sink cannot grow the buffer without limit
+var maxPending = 10000
+
+// Log buffers issuance records in memory and writes them to its primary sink
+// on each flush, and to the secondary sink if there is one. The secondary is
+// best effort: records it fails to take are counted as divergence and not
+// retried. Records the primary fails to take are retried on the next flush.
+// Reads go to the primary and fall back to the secondary when it fails.
+type Log struct {
+	primary   IssuanceSink
+	secondary IssuanceSink
+	retention time.Duration
+	clock     clock.Clock
+
+	mu      sync.Mutex
+	pending []Record // Not yet written to either sink
+	retry   []Record // Already offered to the secondary, not yet in the primary
+}
+
+// NewLog creates an issuance log writing to primary and, unless it is nil,
+// to secondary. Sinks that implement Pruner lose records older than
+// retention on each flush; a retention of zero keeps them.
+func NewLog(primary, secondary IssuanceSink, retention time.Duration) *Log {
+	return &Log{primary: primary, secondary: secondary, retention: retention, clock: clock.Real{}}
+}
+
+// NewLogFromEnv creates an issuance log with the primary sink named by
+// LUMENLINK_ISSUANCE_LOG (postgres, the default, file or off) and the
+// secondary named by LUMENLINK_ISSUANCE_LOG_SECONDARY (postgres, file, or
+// empty for none). The file sink appends to LUMENLINK_ISSUANCE_LOG_FILE.
+// Records older than LUMENLINK_ISSUANCE_LOG_RETENTION (default 720h) are
+// pruned from Postgres. It returns nil when the log is off.
+func NewLogFromEnv(database *db.Database) (*Log, error) {
+	primaryName := strings.ToLower(strings.TrimSpace(os.Getenv("LUMENLINK_ISSUANCE_LOG")))
+	if primaryName == "" {
+		primaryName = "postgres"
+	}
+	if primaryName == "off" {
+		return nil, nil
+	}
+	primary, err := sinkFromEnv(primaryName, database)
+	if err != nil {
+		return nil, err
+	}
+	var secondary IssuanceSink
+	if name := strings.ToLower(strings.TrimSpace(os.Getenv("LUMENLINK_ISSUANCE_LOG_SECONDARY"))); name != "" {
+		if name == primaryName {
+			return nil, fmt.Errorf("issuance log secondary sink %q is the same as the primary", name)
+		}
+		if secondary, err = sinkFromEnv(name, database); err != nil {
+			return nil, err
+		}
+	}
+	retention := 720 * time.Hour
+	if value := strings.TrimSpace(os.Getenv("LUMENLINK_ISSUANCE_LOG_RETENTION")); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			retention = d
+		}
+	}
+	return NewLog(primary, secondary, retention), nil
+}
+
+// sinkFromEnv creates the sink with the given name
+func sinkFromEnv(name string, database *db.Database) (IssuanceSink, error) {
+	switch name {
+	case "postgres":
+		return NewPostgresSink(database), nil
+	case "file":
+		return NewFileSink(strings.TrimSpace(os.Getenv("LUMENLINK_ISSUANCE_LOG_FILE")))
+	default:
+		return nil, fmt.Errorf("unknown issuance log sink %q", name)
+	}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (l *Log) SetClock(clk clock.Clock) {
+	l.clock = clk
+}
+
+// Record queues one issued pack for the next flush, stamping it with the
+// current time if it has none
+func (l *Log) Record(record Record) {
+	if record.IssuedAt.IsZero() {
+		record.IssuedAt = l.clock.Now().UTC()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending)+len(l.retry) >= maxPending {
+		metrics.IssuanceLogDropped.Inc()
+		return
+	}
+	l.pending = append(l.pending, record)
+}
+
+// Flush writes the records recorded since the last flush to both sinks. A
+// failing secondary does not fail the flush; a failing primary does, and
+// its records are kept for the next flush.
+func (l *Log) Flush(ctx context.Context) error {
+	l.mu.Lock()
+	pending, retry := l.pending, l.retry
+	l.pending, l.retry = nil, nil
+	l.mu.Unlock()
+
+	if len(pending) > 0 && l.secondary != nil {
+		if err := l.secondary.Append(ctx, pending); err != nil {
+			log.Printf("secondary issuance log write failed: %v", err)
+			metrics.IssuanceLogDivergence.WithLabelValues("secondary").Add(float64(len(pending)))
+		}
+	}
+
+	batch := append(retry, pending...)
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := l.primary.Append(ctx, batch); err != nil {
+		l.restore(batch)
+		return err
+	}
+	return nil
+}
+
+// restore puts records the primary failed to take back in front of the
+// retry queue, dropping the oldest beyond the buffer's bound
+func (l *Log) restore(unwritten []Record) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	retry := append(unwritten, l.retry...)
+	if excess := len(retry) + len(l.pending) - maxPending; excess > 0 {
+		if excess > len(retry) {
+			excess = len(retry)
+		}
+		retry = retry[excess:]
+		metrics.IssuanceLogDropped.Add(float64(excess))
+		if l.secondary != nil {
+			metrics.IssuanceLogDivergence.WithLabelValues("primary").Add(float64(excess))
+		}
+	}
+	l.retry = retry
+}
+
+// DeviceIssuances returns the last limit packs issued to a device, newest
+// first, from the primary sink, or from the secondary if the primary fails.
+// Records not yet flushed are not included.
+func (l *Log) DeviceIssuances(ctx context.Context, deviceID string, limit int) ([]Record, error) {
+	records, err := l.primary.DeviceIssuances(ctx, deviceID, limit)
+	if err == nil || l.secondary == nil {
+		return records, err
+	}
+	metrics.IssuanceLogReadFallbacks.Inc()
+	records, fallbackErr := l.secondary.DeviceIssuances(ctx, deviceID, limit)
+	if fallbackErr != nil {
+		return nil, errors.Join(err, fallbackErr)
+	}
+	return records, nil
+}
+
+// Prune deletes records older than the retention from the sinks that can
+func (l *Log) Prune(ctx context.Context) {
+	if l.retention <= 0 {
+		return
+	}
+	before := l.clock.Now().Add(-l.retention)
+	for _, sink := range []IssuanceSink{l.primary, l.secondary} {
+		pruner, ok := sink.(Pruner)
+		if !ok {
+			continue
+		}
+		if _, err := pruner.Prune(ctx, before); err != nil {
+			log.Printf("issuance log prune failed: %v", err)
+		}
+	}
+}
+
+// Start flushes records every interval, pruning old ones as it goes, until
+// ctx is cancelled, then flushes once more.
+func (l *Log) Start(ctx context.Context, interval time.Duration) {
+	ticker := l.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := l.Flush(flushCtx); err != nil {
+				log.Printf("final issuance log flush failed: %v", err)
+			}
+			return
+		case <-ticker.C():
+			if err := l.Flush(ctx); err != nil {
+				log.Printf("issuance log flush failed: %v", err)
+			}
+			l.Prune(ctx)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package issuance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"rendezvous/internal/metrics"
+)
+
+// memorySink is an IssuanceSink that can be told to fail
+type memorySink struct {
+	records     []Record
+	appendErr   error
+	readErr     error
+	appendCalls int
+}
+
+func (s *memorySink) Append(_ context.Context, records []Record) error {
+	s.appendCalls++
+	if s.appendErr != nil {
+		return s.appendErr
+	}
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func (s *memorySink) DeviceIssuances(_ context.Context, deviceID string, limit int) ([]Record, error) {
+	if s.readErr != nil {
+		return nil, s.readErr
+	}
+	var records []Record
+	for i := len(s.records) - 1; i >= 0 && len(records) < limit; i-- {
+		if s.records[i].DeviceID == deviceID {
+			records = append(records, s.records[i])
+		}
+	}
+	return records, nil
+}
+
+func record(deviceID, hash string) Record {
+	return Record{DeviceID: deviceID, IssuedAt: time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC), PackHash: hash, GatewayIDs: []string{"gw-1"}}
+}
+
+func TestLog_FailingSecondaryDoesNotFailFlush(t *testing.T) {
+	primary := &memorySink{}
+	secondary := &memorySink{appendErr: errors.New("disk full")}
+	issuances := NewLog(primary, secondary, 0)
+	before := testutil.ToFloat64(metrics.IssuanceLogDivergence.WithLabelValues("secondary"))
+
+	issuances.Record(record("device-1", "a"))
+	issuances.Record(record("device-1", "b"))
+	if err := issuances.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	if len(primary.records) != 2 {
+		t.Fatalf("primary has %d records, want 2", len(primary.records))
+	}
+	if got := testutil.ToFloat64(metrics.IssuanceLogDivergence.WithLabelValues("secondary")) - before; got != 2 {
+		t.Errorf("secondary divergence = %v, want 2", got)
+	}
+
+	// The secondary is not retried
+	secondary.appendErr = nil
+	if err := issuances.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if len(secondary.records) != 0 {
+		t.Errorf("secondary has %d records after a failed write, want 0", len(secondary.records))
+	}
+}
+
+func TestLog_FailingPrimaryIsRetriedWithoutRewritingSecondary(t *testing.T) {
+	primary := &memorySink{appendErr: errors.New("database down")}
+	secondary := &memorySink{}
+	issuances := NewLog(primary, secondary, 0)
+
+	issuances.Record(record("device-1", "a"))
+	if err := issuances.Flush(context.Background()); err == nil {
+		t.Fatal("Flush succeeded with a failing primary")
+	}
+	if len(secondary.records) != 1 {
+		t.Fatalf("secondary has %d records, want 1", len(secondary.records))
+	}
+
+	primary.appendErr = nil
+	issuances.Record(record("device-1", "b"))
+	if err := issuances.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if len(primary.records) != 2 || primary.records[0].PackHash != "a" || primary.records[1].PackHash != "b" {
+		t.Errorf("primary records = %+v, want a then b", primary.records)
+	}
+	if len(secondary.records) != 2 {
+		t.Errorf("secondary has %d records, want 2 (each written once)", len(secondary.records))
+	}
+}
+
+func TestLog_DropsBeyondBound(t *testing.T) {
+	defer func(n int) { maxPending = n }(maxPending)
+	maxPending = 2
+
+	primary := &memorySink{appendErr: errors.New("database down")}
+	issuances := NewLog(primary, nil, 0)
+	before := testutil.ToFloat64(metrics.IssuanceLogDropped)
+
+	issuances.Record(record("device-1", "a"))
+	issuances.Record(record("device-1", "b"))
+	issuances.Record(record("device-1", "c"))
+	_ = issuances.Flush(context.Background())
+	issuances.Record(record("device-1", "d"))
+
+	if got := testutil.ToFloat64(metrics.IssuanceLogDropped) - before; got != 2 {
+		t.Errorf("dropped = %v, want 2", got)
+	}
+	primary.appendErr = nil
+	if err := issuances.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if len(primary.records) != 2 {
+		t.Errorf("primary has %d records, want 2", len(primary.records))
+	}
+}
+
+func TestLog_ReadFallsBackToSecondary(t *testing.T) {
+	primary := &memorySink{}
+	secondary := &memorySink{}
+	issuances := NewLog(primary, secondary, 0)
+	issuances.Record(record("device-1", "a"))
+	issuances.Record(record("device-2", "b"))
+	if err := issuances.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	primary.readErr = errors.New("database down")
+	before := testutil.ToFloat64(metrics.IssuanceLogReadFallbacks)
+	records, err := issuances.DeviceIssuances(context.Background(), "device-1", 10)
+	if err != nil {
+		t.Fatalf("DeviceIssuances: %v", err)
+	}
+	if len(records) != 1 || records[0].PackHash != "a" {
+		t.Errorf("records = %+v, want the secondary's record a", records)
+	}
+	if got := testutil.ToFloat64(metrics.IssuanceLogReadFallbacks) - before; got != 1 {
+		t.Errorf("read fallbacks = %v, want 1", got)
+	}
+
+	secondary.readErr = errors.New("file missing")
+	if _, err := issuances.DeviceIssuances(context.Background(), "device-1", 10); err == nil {
+		t.Error("DeviceIssuances succeeded with both sinks failing")
+	}
+}
+
+func TestLog_ReadWithoutSecondaryReturnsPrimaryError(t *testing.T) {
+	primary := &memorySink{readErr: errors.New("database down")}
+	issuances := NewLog(primary, nil, 0)
+	if _, err := issuances.DeviceIssuances(context.Background(), "device-1", 10); !errors.Is(err, primary.readErr) {
+		t.Errorf("err = %v, want the primary's error", err)
+	}
+}
+
+func TestLog_RecordStampsTime(t *testing.T) {
+	primary := &memorySink{}
+	issuances := NewLog(primary, nil, 0)
+	issuances.Record(Record{DeviceID: "device-1", PackHash: "a"})
+	if err := issuances.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if primary.records[0].IssuedAt.IsZero() {
+		t.Error("record was not stamped with the issue time")
+	}
+}
@@ -0,0 +1,153 @@
+// Package issuance keeps a log of the config packs issued to each device, so
+// an admin looking up a device can see what it was given. The log is written
+// through IssuanceSink; Postgres is the default sink and a JSONL file the
+// other, and a Log can write to a secondary sink alongside the primary.
+package issuance
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"rendezvous/internal/db"
+)
+
+// Record is one config pack issued to a device
+type Record = db.IssuanceRecord
+
+// IssuanceSink stores issuance records and reads them back per device
+type IssuanceSink interface {
+	// Append stores records; on error none of them may be assumed stored
+	Append(ctx context.Context, records []Record) error
+	// DeviceIssuances returns the last limit records of a device, newest
+	// first
+	DeviceIssuances(ctx context.Context, deviceID string, limit int) ([]Record, error)
+}
+
+// Pruner is implemented by sinks that can delete old records themselves
+type Pruner interface {
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+// PostgresSink stores issuance records in the issuance_log table
+type PostgresSink struct {
+	db *db.Database
+}
+
+// NewPostgresSink creates a sink backed by the database
+func NewPostgresSink(database *db.Database) *PostgresSink {
+	return &PostgresSink{db: database}
+}
+
+// Append implements IssuanceSink
+func (s *PostgresSink) Append(ctx context.Context, records []Record) error {
+	return s.db.RecordIssuances(ctx, records)
+}
+
+// DeviceIssuances implements IssuanceSink
+func (s *PostgresSink) DeviceIssuances(ctx context.Context, deviceID string, limit int) ([]Record, error) {
+	return s.db.GetDeviceIssuances(ctx, deviceID, limit)
+}
+
+// Prune implements Pruner
+func (s *PostgresSink) Prune(ctx context.Context, before time.Time) (int64, error) {
+	return s.db.DeleteIssuancesBefore(ctx, before)
+}
+
+// FileSink appends issuance records to a file, one JSON object per line.
+// Reads scan the whole file, so it suits a secondary copy or a small
+// deployment rather than a busy primary; rotating the file is left to the
+// operator.
+type FileSink struct {
+	path string
+
+	mu sync.Mutex
+}
+
+// NewFileSink creates a sink appending to the file at path, creating it if
+// needed
+func NewFileSink(path string) (*FileSink, error) {
+	if path == "" {
+		return nil, errors.New("issuance log file path is empty")
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open issuance log file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to open issuance log file: %w", err)
+	}
+	return &FileSink{path: path}, nil
+}
+
+// Append implements IssuanceSink. The records are written with a single
+// write, so a failure leaves at most a partial last line, which reads skip.
+func (s *FileSink) Append(_ context.Context, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	var buf []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode issuance: %w", err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open issuance log file: %w", err)
+	}
+	if _, err := f.Write(buf); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write issuance log file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write issuance log file: %w", err)
+	}
+	return nil
+}
+
+// DeviceIssuances implements IssuanceSink
+func (s *FileSink) DeviceIssuances(_ context.Context, deviceID string, limit int) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open issuance log file: %w", err)
+	}
+	defer f.Close()
+
+	records := []Record{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue // A line cut short by a failed write
+		}
+		if record.DeviceID == deviceID {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read issuance log file: %w", err)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].IssuedAt.After(records[j].IssuedAt)
+	})
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
@@ -0,0 +1,98 @@
+package issuance
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"rendezvous/internal/db"
+)
+
+func TestFileSink_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "issuances.jsonl")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("NewFileSink: %v", err)
+	}
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	err = sink.Append(context.Background(), []Record{
+		{DeviceID: "device-1", IssuedAt: base, PackHash: "a", Region: "us-east-1", GatewayIDs: []string{"gw-1"}},
+		{DeviceID: "device-2", IssuedAt: base, PackHash: "b"},
+		{DeviceID: "device-1", IssuedAt: base.Add(time.Hour), PackHash: "c", GatewayIDs: []string{"gw-2", "gw-3"}},
+	})
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	// A line cut short by a failed write is skipped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, _ = f.WriteString(`{"device_id":"device-1","pack_`)
+	_ = f.Close()
+
+	records, err := sink.DeviceIssuances(context.Background(), "device-1", 10)
+	if err != nil {
+		t.Fatalf("DeviceIssuances: %v", err)
+	}
+	if len(records) != 2 || records[0].PackHash != "c" || records[1].PackHash != "a" {
+		t.Fatalf("records = %+v, want c then a", records)
+	}
+	if records[1].Region != "us-east-1" || len(records[0].GatewayIDs) != 2 {
+		t.Errorf("records lost fields: %+v", records)
+	}
+
+	records, err = sink.DeviceIssuances(context.Background(), "device-1", 1)
+	if err != nil {
+		t.Fatalf("DeviceIssuances: %v", err)
+	}
+	if len(records) != 1 || records[0].PackHash != "c" {
+		t.Errorf("limited records = %+v, want only c", records)
+	}
+}
+
+func TestNewFileSink_RequiresPath(t *testing.T) {
+	if _, err := NewFileSink(""); err == nil {
+		t.Error("NewFileSink accepted an empty path")
+	}
+}
+
+func TestPostgresSink(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer sqlDB.Close()
+	sink := NewPostgresSink(db.NewFromPool(sqlDB))
+	issuedAt := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO issuance_log`).
+		WithArgs("device-1", issuedAt, "a", "us-east-1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	err = sink.Append(context.Background(), []Record{{DeviceID: "device-1", IssuedAt: issuedAt, PackHash: "a", Region: "us-east-1", GatewayIDs: []string{"gw-1"}}})
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	mock.ExpectQuery(`SELECT device_id, issued_at, pack_hash`).
+		WithArgs("device-1", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"device_id", "issued_at", "pack_hash", "region", "gateway_ids"}).
+			AddRow("device-1", issuedAt, "a", "us-east-1", "{gw-1,gw-2}"))
+	records, err := sink.DeviceIssuances(context.Background(), "device-1", 5)
+	if err != nil {
+		t.Fatalf("DeviceIssuances: %v", err)
+	}
+	if len(records) != 1 || len(records[0].GatewayIDs) != 2 || records[0].GatewayIDs[1] != "gw-2" {
+		t.Errorf("records = %+v", records)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
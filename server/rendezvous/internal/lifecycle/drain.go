@@ -0,0 +1,103 @@
+package lifecycle
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"rendezvous/internal/clock"
+)
+
+// DrainGraceMargin is how much longer than one heartbeat interval the grace
+// period lasts at least, for heartbeats that arrive late
+const DrainGraceMargin = 10 * time.Second
+
+// DrainConfig controls how gateway agents are moved off a replica that is
+// shutting down.
+type DrainConfig struct {
+	Grace        time.Duration // How long to keep serving after the drain starts
+	ReconnectMin time.Duration // Shortest delay an agent is told to wait
+	ReconnectMax time.Duration // Longest delay an agent is told to wait
+
+	// HeartbeatInterval is how often agents heartbeat, or 0 if unknown. An
+	// agent only hears of the drain on its next heartbeat, so a grace period
+	// shorter than one interval leaves some agents to find the replica gone.
+	HeartbeatInterval time.Duration
+}
+
+// Drain coordinates a graceful shutdown with gateway agents. Once begun, every
+// heartbeat is answered with a drain directive carrying a jittered reconnect
+// delay, so agents back off and spread their reconnects across the new
+// replicas instead of retrying all at once.
+type Drain struct {
+	config   DrainConfig
+	draining atomic.Bool
+	clock    clock.Clock
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewDrain creates a drain coordinator. A ReconnectMax below ReconnectMin is
+// raised to ReconnectMin, and a Grace that does not exceed HeartbeatInterval
+// is raised to HeartbeatInterval plus DrainGraceMargin.
+func NewDrain(config DrainConfig) *Drain {
+	if config.HeartbeatInterval > 0 && config.Grace <= config.HeartbeatInterval {
+		config.Grace = config.HeartbeatInterval + DrainGraceMargin
+	}
+	if config.ReconnectMin < 0 {
+		config.ReconnectMin = 0
+	}
+	if config.ReconnectMax < config.ReconnectMin {
+		config.ReconnectMax = config.ReconnectMin
+	}
+	return &Drain{
+		config: config,
+		clock:  clock.Real{},
+		rng:    rand.New(rand.NewSource(clock.Real{}.Now().UnixNano())),
+	}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (d *Drain) SetClock(c clock.Clock) {
+	d.clock = c
+}
+
+// Grace returns how long Wait keeps serving
+func (d *Drain) Grace() time.Duration {
+	return d.config.Grace
+}
+
+// Begin starts draining. It is safe to call more than once.
+func (d *Drain) Begin() {
+	d.draining.Store(true)
+}
+
+// Draining reports whether the drain has begun. A nil Drain never drains.
+func (d *Drain) Draining() bool {
+	return d != nil && d.draining.Load()
+}
+
+// ReconnectAfter returns a delay drawn uniformly from [ReconnectMin, ReconnectMax].
+func (d *Drain) ReconnectAfter() time.Duration {
+	spread := d.config.ReconnectMax - d.config.ReconnectMin
+	if spread <= 0 {
+		return d.config.ReconnectMin
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.config.ReconnectMin + time.Duration(d.rng.Int63n(int64(spread)+1))
+}
+
+// Wait blocks for the grace period, or until ctx is done, so that agents
+// heartbeating in the meantime receive the directive before listeners close.
+func (d *Drain) Wait(ctx context.Context) {
+	timer := d.clock.NewTimer(d.config.Grace)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C():
+	}
+}
@@ -0,0 +1,133 @@
+package lifecycle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rendezvous/internal/clock"
+)
+
+func TestDrain_Draining(t *testing.T) {
+	var unset *Drain
+	if unset.Draining() {
+		t.Error("nil drain must not drain")
+	}
+
+	drain := NewDrain(DrainConfig{})
+	if drain.Draining() {
+		t.Error("drain began before Begin")
+	}
+	drain.Begin()
+	drain.Begin()
+	if !drain.Draining() {
+		t.Error("drain did not begin")
+	}
+}
+
+func TestDrain_ReconnectAfterJitter(t *testing.T) {
+	drain := NewDrain(DrainConfig{ReconnectMin: 5 * time.Second, ReconnectMax: 10 * time.Second})
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 200; i++ {
+		d := drain.ReconnectAfter()
+		if d < 5*time.Second || d > 10*time.Second {
+			t.Fatalf("ReconnectAfter() = %v, want within [5s, 10s]", d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 {
+		t.Error("ReconnectAfter() returned the same delay every time")
+	}
+}
+
+func TestDrain_ReconnectAfterInvertedRange(t *testing.T) {
+	drain := NewDrain(DrainConfig{ReconnectMin: 5 * time.Second, ReconnectMax: time.Second})
+	if d := drain.ReconnectAfter(); d != 5*time.Second {
+		t.Errorf("ReconnectAfter() = %v, want 5s", d)
+	}
+}
+
+func TestDrain_WaitStopsOnCancel(t *testing.T) {
+	drain := NewDrain(DrainConfig{Grace: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		drain.Wait(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after cancel")
+	}
+}
+
+func TestDrain_WaitEndsAtGrace(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	drain := NewDrain(DrainConfig{Grace: 10 * time.Second})
+	drain.SetClock(fake)
+
+	done := make(chan struct{})
+	go func() {
+		drain.Wait(context.Background())
+		close(done)
+	}()
+	fake.BlockUntil(1)
+	fake.Advance(10*time.Second - time.Nanosecond)
+	select {
+	case <-done:
+		t.Fatal("Wait returned before the grace period ended")
+	default:
+	}
+	fake.Advance(time.Nanosecond)
+	<-done
+}
+
+func TestNewDrain_GraceOutlastsHeartbeatInterval(t *testing.T) {
+	tests := []struct {
+		name      string
+		grace     time.Duration
+		heartbeat time.Duration
+		want      time.Duration
+	}{
+		{"shorter than a heartbeat", 10 * time.Second, time.Minute, time.Minute + DrainGraceMargin},
+		{"exactly one heartbeat", time.Minute, time.Minute, time.Minute + DrainGraceMargin},
+		{"longer than a heartbeat", 2 * time.Minute, time.Minute, 2 * time.Minute},
+		{"unset", 0, time.Minute, time.Minute + DrainGraceMargin},
+		{"heartbeat unknown", 10 * time.Second, 0, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drain := NewDrain(DrainConfig{Grace: tt.grace, HeartbeatInterval: tt.heartbeat})
+			if got := drain.Grace(); got != tt.want {
+				t.Errorf("Grace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDrain_WaitCoversAHeartbeat(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	drain := NewDrain(DrainConfig{Grace: 10 * time.Second, HeartbeatInterval: time.Minute})
+	drain.SetClock(fake)
+
+	done := make(chan struct{})
+	go func() {
+		drain.Wait(context.Background())
+		close(done)
+	}()
+	fake.BlockUntil(1)
+	// An agent that heartbeat just before the drain began is heard from again
+	// within the grace period
+	fake.Advance(time.Minute)
+	select {
+	case <-done:
+		t.Fatal("Wait returned before every agent's next heartbeat")
+	default:
+	}
+	fake.Advance(DrainGraceMargin)
+	<-done
+}
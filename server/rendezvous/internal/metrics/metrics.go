@@ -19,6 +19,87 @@ var (
 		},
 		[]string{"platform", "reason"},
 	)
+	AttestationPoolUtilization = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "lumenlink_attestation_pool_utilization",
+			Help: "Share of attestation verification slots in use (0-1)",
+		},
+	)
+	AttestationQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "lumenlink_attestation_queue_depth",
+			Help: "Attestation verifications waiting for a slot",
+		},
+	)
+	AttestationShed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "lumenlink_attestation_shed_total",
+			Help: "Attestation verifications refused as attestation_busy because the queue was full",
+		},
+	)
+	AttestationRateLimited = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_attestation_rate_limited_total",
+			Help: "Attestation verifications refused as too_many_verifications because the device was over its budget, by platform",
+		},
+		[]string{"platform"},
+	)
+	AttestationDowngrades = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_attestation_downgrades_total",
+			Help: "Attestations reporting weaker device integrity than the device's previous one, by platform and verdicts",
+		},
+		[]string{"platform", "from", "to"},
+	)
+	AttestationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "lumenlink_attestation_duration_seconds",
+			Help:    "Time to verify an attestation, including any wait for a verification slot, by platform and outcome",
+			Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2, 3, 5, 10},
+		},
+		[]string{"platform", "outcome"},
+	)
+	PlayIntegrityAPIDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "lumenlink_play_integrity_api_duration_seconds",
+			Help:    "Time spent in the Play Integrity API's decodeIntegrityToken call, successful or not",
+			Buckets: []float64{.05, .1, .25, .5, 1, 2, 3, 5, 10, 20},
+		},
+	)
+	PlayIntegrityRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_play_integrity_requests_total",
+			Help: "Android attestations by Play Integrity request type (classic or standard) and result",
+		},
+		[]string{"request_type", "result"},
+	)
+	AttestationSessions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_attestation_sessions_total",
+			Help: "Attestation session tokens issued, and presented with config requests by result (valid, expired or invalid)",
+		},
+		[]string{"result"},
+	)
+	AppAttestSharedKeys = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "lumenlink_app_attest_shared_keys_total",
+			Help: "Verified App Attest attestations of a key already bound to another device",
+		},
+	)
+	AppAttestReceiptRefreshes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_app_attest_receipt_refreshes_total",
+			Help: "App Attest receipt exchanges with Apple by outcome (refreshed, not_modified or error)",
+		},
+		[]string{"outcome"},
+	)
+	AttestationsDeleted = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "lumenlink_attestation_cleanup_deleted_rows",
+			Help:    "Attestation records deleted per retention cleanup run",
+			Buckets: prometheus.ExponentialBuckets(1, 10, 7),
+		},
+	)
 	ConfigPackGenerated = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "lumenlink_config_pack_generated_total",
@@ -26,6 +107,63 @@ var (
 		},
 		[]string{"region"},
 	)
+	ConfigPackVersion = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_config_pack_version_total",
+			Help: "Config packs generated by the config version they were built from",
+		},
+		[]string{"version"},
+	)
+	RemoteSignerRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_remote_signer_requests_total",
+			Help: "Signing requests to the remote config signer by outcome (signed, retried, failed)",
+		},
+		[]string{"outcome"},
+	)
+	ConfigPhaseDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "lumenlink_config_phase_duration_seconds",
+			Help:    "Time spent in each phase of a served config request; pack_core is the whole request less attestation",
+			Buckets: []float64{.005, .01, .025, .05, .1, .2, .3, .4, .5, .75, 1, 2.5, 5},
+		},
+		[]string{"phase"},
+	)
+	ConfigGatewayCache = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_config_gateway_cache_total",
+			Help: "Gateway selection cache lookups for config packs by result (hit or miss)",
+		},
+		[]string{"result"},
+	)
+	RegionFallback = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_config_region_fallback_total",
+			Help: "Config packs whose region had too few gateways and borrowed from the nearest regions, by region",
+		},
+		[]string{"region"},
+	)
+	ExperimentAssignments = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_config_experiment_assignments_total",
+			Help: "Config packs built under each experiment variant",
+		},
+		[]string{"experiment", "variant"},
+	)
+	RegionDemand = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_region_demand_total",
+			Help: "Config requests by region, client country and launch status (open or closed)",
+		},
+		[]string{"region", "country", "status"},
+	)
+	AdmissionRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_admission_requests_total",
+			Help: "Config requests from new devices by region and admission outcome (admitted, deferred or returning)",
+		},
+		[]string{"region", "outcome"},
+	)
 	GatewayStatusUpdates = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "lumenlink_gateway_status_updates_total",
@@ -39,14 +177,185 @@ var (
 		},
 		[]string{"channel", "success"},
 	)
+	HoneypotDiscoveryLogs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_honeypot_discovery_logs_total",
+			Help: "Discovery log entries that targeted honeypot gateways",
+		},
+		[]string{"channel", "success"},
+	)
+	DiscoveryLogDuplicates = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_discovery_log_duplicates_total",
+			Help: "Discovery log entries acknowledged but not recounted because their event_id was already logged",
+		},
+		[]string{"channel"},
+	)
+	ClientErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_client_errors_total",
+			Help: "Client-reported errors by code and client release (major.minor)",
+		},
+		[]string{"code", "version"},
+	)
+	PackVerificationFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_pack_verification_failures_total",
+			Help: "Client-reported config pack verification failures by reason: key_mismatch or signature_invalid",
+		},
+		[]string{"reason"},
+	)
+	AttestationFailureAlerts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_attestation_failure_alerts_total",
+			Help: "Webhook alerts for devices failing attestation repeatedly, by status (delivered or failed)",
+		},
+		[]string{"status"},
+	)
+	OperatorNotifications = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_operator_notifications_total",
+			Help: "Operator event notification attempts by event type and status (delivered, failed, rate_limited or dropped)",
+		},
+		[]string{"event", "status"},
+	)
+	CanaryDifferences = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_canary_differences_total",
+			Help: "Pack fields that differed from the canary peer, by field and outcome (allowed or blocking)",
+		},
+		[]string{"field", "outcome"},
+	)
+	AuditAppendFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "lumenlink_audit_append_failures_total",
+			Help: "Actions that took effect but could not be recorded in the audit log, such as device trust transitions",
+		},
+	)
+	PersistenceMode = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "lumenlink_persistence_mode",
+			Help: "1 for the persistence mode in effect (standard or minimized)",
+		},
+		[]string{"mode"},
+	)
+	DeviceTrustTransitions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_device_trust_transitions_total",
+			Help: "Device trust tier changes by transition (promoted or demoted) and reason",
+		},
+		[]string{"transition", "reason"},
+	)
+	RevokedDeviceHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_revoked_device_hits_total",
+			Help: "Requests from revoked devices by stage (attestation or config)",
+		},
+		[]string{"stage"},
+	)
+	RevokedPacksRefused = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "lumenlink_revoked_packs_refused_total",
+			Help: "Config packs not served because their content hash was revoked",
+		},
+	)
+	FederationPolls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_federation_polls_total",
+			Help: "Federation peer polls by peer and outcome (imported, unchanged, rejected, expired or failed)",
+		},
+		[]string{"peer", "outcome"},
+	)
+	IssuanceLogDivergence = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "lumenlink_issuance_log_divergence_total",
+			Help: "Issuance records written to one issuance log sink but not the other, by the sink missing them (primary or secondary)",
+		},
+		[]string{"missing"},
+	)
+	IssuanceLogDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "lumenlink_issuance_log_dropped_total",
+			Help: "Issuance records dropped because the pending buffer was full",
+		},
+	)
+	IssuanceLogReadFallbacks = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "lumenlink_issuance_log_read_fallbacks_total",
+			Help: "Device issuance lookups answered by the secondary sink because the primary failed",
+		},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(
 		AttestationTotal,
 		AttestationFailures,
+		AttestationPoolUtilization,
+		AttestationQueueDepth,
+		AttestationShed,
+		AttestationRateLimited,
+		AttestationDowngrades,
+		AttestationDuration,
+		PlayIntegrityAPIDuration,
+		PlayIntegrityRequests,
+		AttestationSessions,
+		AppAttestSharedKeys,
+		AppAttestReceiptRefreshes,
+		AttestationsDeleted,
 		ConfigPackGenerated,
+		ConfigPackVersion,
+		RemoteSignerRequests,
+		ConfigPhaseDuration,
+		ConfigGatewayCache,
+		RegionFallback,
+		ExperimentAssignments,
+		RegionDemand,
+		AdmissionRequests,
 		GatewayStatusUpdates,
 		DiscoveryLogs,
+		HoneypotDiscoveryLogs,
+		DiscoveryLogDuplicates,
+		ClientErrors,
+		PackVerificationFailures,
+		AttestationFailureAlerts,
+		OperatorNotifications,
+		CanaryDifferences,
+		AuditAppendFailures,
+		PersistenceMode,
+		DeviceTrustTransitions,
+		RevokedDeviceHits,
+		RevokedPacksRefused,
+		FederationPolls,
+		IssuanceLogDivergence,
+		IssuanceLogDropped,
+		IssuanceLogReadFallbacks,
 	)
+
+	// Pre-initialize series we always expect so dashboards and alerts see
+	// zeros instead of missing series before the first event.
+	for _, platform := range []string{"android", "ios", "desktop"} {
+		for _, result := range []string{"valid", "invalid", "error"} {
+			AttestationTotal.WithLabelValues(platform, result)
+			AttestationDuration.WithLabelValues(platform, result)
+		}
+	}
+	for _, requestType := range []string{"classic", "standard"} {
+		for _, result := range []string{"valid", "invalid", "error"} {
+			PlayIntegrityRequests.WithLabelValues(requestType, result)
+		}
+	}
+	for _, result := range []string{"issued", "valid", "expired", "invalid"} {
+		AttestationSessions.WithLabelValues(result)
+	}
+	for _, status := range []string{"delivered", "failed"} {
+		AttestationFailureAlerts.WithLabelValues(status)
+	}
+	for _, missing := range []string{"primary", "secondary"} {
+		IssuanceLogDivergence.WithLabelValues(missing)
+	}
+	for _, reason := range []string{"key_mismatch", "signature_invalid"} {
+		PackVerificationFailures.WithLabelValues(reason)
+	}
+	ConfigPackGenerated.WithLabelValues("us-east-1") // default region
 }
@@ -19,10 +19,16 @@ func TestMetricsEndpoint(t *testing.T) {
 		t.Errorf("status: got %d, want 200", w.Code)
 	}
 	body := w.Body.String()
-	if !strings.Contains(body, "lumenlink_attestation_total") {
-		t.Error("expected lumenlink_attestation_total in metrics")
-	}
-	if !strings.Contains(body, "lumenlink_config_pack_generated_total") {
-		t.Error("expected lumenlink_config_pack_generated_total in metrics")
+	for _, name := range []string{
+		"lumenlink_attestation_total",
+		"lumenlink_attestation_duration_seconds",
+		"lumenlink_play_integrity_api_duration_seconds",
+		"lumenlink_attestation_sessions_total",
+		"lumenlink_attestation_failure_alerts_total",
+		"lumenlink_config_pack_generated_total",
+	} {
+		if !strings.Contains(body, name) {
+			t.Errorf("expected %s in metrics", name)
+		}
 	}
 }
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"rendezvous/internal/clock"
+)
+
+// Config request phases timed by ConfigPhaseDuration
+const (
+	PhaseAttestation       = "attestation"
+	PhaseRegionResolution  = "region_resolution"
+	PhaseGatewaySelection  = "gateway_selection"
+	PhasePolicyApplication = "policy_application"
+	PhaseSigning           = "signing"
+	PhaseSerialization     = "serialization"
+
+	// PhasePackCore is derived rather than timed: the whole request except
+	// attestation, which has its own SLO. Time spent queued for an
+	// attestation slot counts as attestation.
+	PhasePackCore = "pack_core"
+)
+
+// PhaseTimer times the phases of one config request. Time in a phase started
+// more than once accumulates, and each phase is observed once. Like a
+// DecisionTrace, a nil timer records nothing.
+type PhaseTimer struct {
+	clock clock.Clock
+	start time.Time
+
+	mu     sync.Mutex
+	phases map[string]time.Duration
+}
+
+// NewPhaseTimer starts timing a request
+func NewPhaseTimer() *PhaseTimer {
+	return newPhaseTimer(clock.Real{})
+}
+
+func newPhaseTimer(c clock.Clock) *PhaseTimer {
+	return &PhaseTimer{clock: c, start: c.Now(), phases: map[string]time.Duration{}}
+}
+
+// Start begins timing phase and returns the function that ends it.
+func (t *PhaseTimer) Start(phase string) func() {
+	if t == nil {
+		return func() {}
+	}
+	began := t.clock.Now()
+	return func() {
+		elapsed := t.clock.Now().Sub(began)
+		t.mu.Lock()
+		t.phases[phase] += elapsed
+		t.mu.Unlock()
+	}
+}
+
+// Durations returns the time spent in each phase that ran, plus
+// PhasePackCore: the time since the timer started, less attestation.
+func (t *PhaseTimer) Durations() map[string]time.Duration {
+	if t == nil {
+		return nil
+	}
+	total := t.clock.Now().Sub(t.start)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	durations := make(map[string]time.Duration, len(t.phases)+1)
+	for phase, d := range t.phases {
+		durations[phase] = d
+	}
+	durations[PhasePackCore] = total - t.phases[PhaseAttestation]
+	return durations
+}
+
+// Observe records each phase's duration in histogram, labeled by phase.
+// Call it once, when the request has been served.
+func (t *PhaseTimer) Observe(histogram *prometheus.HistogramVec) {
+	for phase, d := range t.Durations() {
+		histogram.WithLabelValues(phase).Observe(d.Seconds())
+	}
+}
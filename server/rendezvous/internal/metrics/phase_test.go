@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"rendezvous/internal/clock"
+)
+
+func TestPhaseTimer_Durations(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	timer := newPhaseTimer(fake)
+
+	fake.Advance(2 * time.Millisecond) // Request parsing: untimed but part of pack_core
+	end := timer.Start(PhaseAttestation)
+	fake.Advance(300 * time.Millisecond)
+	end()
+
+	// Region resolution runs in the handler and again in the service
+	end = timer.Start(PhaseRegionResolution)
+	fake.Advance(time.Millisecond)
+	end()
+	end = timer.Start(PhaseRegionResolution)
+	fake.Advance(4 * time.Millisecond)
+	end()
+
+	end = timer.Start(PhaseSigning)
+	fake.Advance(10 * time.Millisecond)
+	end()
+	fake.Advance(3 * time.Millisecond)
+
+	got := timer.Durations()
+	want := map[string]time.Duration{
+		PhaseAttestation:      300 * time.Millisecond,
+		PhaseRegionResolution: 5 * time.Millisecond,
+		PhaseSigning:          10 * time.Millisecond,
+		PhasePackCore:         20 * time.Millisecond, // 320ms total less 300ms attestation
+	}
+	if len(got) != len(want) {
+		t.Fatalf("durations: got %v, want %v", got, want)
+	}
+	for phase, d := range want {
+		if got[phase] != d {
+			t.Errorf("%s: got %v, want %v", phase, got[phase], d)
+		}
+	}
+}
+
+func TestPhaseTimer_WithoutAttestation(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	timer := newPhaseTimer(fake)
+	fake.Advance(40 * time.Millisecond)
+
+	got := timer.Durations()
+	if _, ok := got[PhaseAttestation]; ok {
+		t.Errorf("attestation recorded without running: %v", got)
+	}
+	if got[PhasePackCore] != 40*time.Millisecond {
+		t.Errorf("pack_core: got %v, want 40ms", got[PhasePackCore])
+	}
+}
+
+func TestPhaseTimer_ObserveOncePerPhase(t *testing.T) {
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_phase_seconds"}, []string{"phase"})
+	fake := clock.NewFake(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	timer := newPhaseTimer(fake)
+	for i := 0; i < 3; i++ {
+		end := timer.Start(PhasePolicyApplication)
+		fake.Advance(time.Millisecond)
+		end()
+	}
+	timer.Observe(histogram)
+
+	for phase, want := range map[string]float64{PhasePolicyApplication: .003, PhasePackCore: .003} {
+		var m dto.Metric
+		if err := histogram.WithLabelValues(phase).(prometheus.Histogram).Write(&m); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if got := m.GetHistogram().GetSampleCount(); got != 1 {
+			t.Errorf("%s: got %d observations, want 1", phase, got)
+		}
+		if got := m.GetHistogram().GetSampleSum(); got < want-1e-9 || got > want+1e-9 {
+			t.Errorf("%s: got sum %v, want %v", phase, got, want)
+		}
+	}
+}
+
+func TestPhaseTimer_Nil(t *testing.T) {
+	var timer *PhaseTimer
+	timer.Start(PhaseSigning)()
+	if got := timer.Durations(); got != nil {
+		t.Errorf("durations: got %v, want nil", got)
+	}
+}
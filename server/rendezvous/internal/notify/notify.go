@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Alert is a single operator-facing notification
+type Alert struct {
+	Kind    string                 `json:"kind"` // e.g. pack_verification_failures
+	Key     string                 `json:"key"`  // What the alert is about, e.g. a key pair
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	FiredAt time.Time              `json:"fired_at"`
+}
+
+// Notifier delivers alerts
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// Nop discards alerts. It is used when no webhook is configured.
+type Nop struct{}
+
+// Notify implements Notifier
+func (Nop) Notify(context.Context, Alert) error { return nil }
+
+// Webhook posts alerts as JSON to a URL
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook creates a webhook notifier for the given URL
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NewFromEnv returns a webhook notifier for LUMENLINK_NOTIFY_WEBHOOK_URL, or a
+// Nop notifier if it is not set.
+func NewFromEnv() Notifier {
+	url := strings.TrimSpace(os.Getenv("LUMENLINK_NOTIFY_WEBHOOK_URL"))
+	if url == "" {
+		return Nop{}
+	}
+	return NewWebhook(url)
+}
+
+// Notify implements Notifier
+func (w *Webhook) Notify(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, w.client, w.url, alert)
+}
+
+// postJSON posts v as JSON to url and expects a 2xx response
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
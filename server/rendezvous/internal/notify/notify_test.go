@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhook_PostsAlert(t *testing.T) {
+	var got Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type: got %q", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	err := NewWebhook(server.URL).Notify(context.Background(), Alert{Kind: "test", Key: "k", Message: "hello"})
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if got.Kind != "test" || got.Key != "k" || got.Message != "hello" {
+		t.Errorf("alert: got %+v", got)
+	}
+}
+
+func TestWebhook_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	if err := NewWebhook(server.URL).Notify(context.Background(), Alert{Kind: "test"}); err == nil {
+		t.Error("Notify: expected error for 502")
+	}
+}
@@ -0,0 +1,395 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+// Operator event types; operators choose which of them they receive
+const (
+	EventGatewayOffline = "gateway_offline" // The reaper marked a gateway offline
+	EventGatewayFlagged = "gateway_flagged" // The suspicion scorer flagged a gateway for review
+	EventBandwidthCap   = "bandwidth_cap"   // A gateway reported bandwidth near its cap
+)
+
+// OperatorEventTypes lists every operator event type
+var OperatorEventTypes = []string{EventGatewayOffline, EventGatewayFlagged, EventBandwidthCap}
+
+// Delivery channels and statuses recorded for each attempt
+const (
+	ChannelWebhook = "webhook"
+	ChannelEmail   = "email"
+	ChannelNone    = "none" // Nothing was sent, e.g. the operator was rate limited
+
+	DeliveryDelivered   = "delivered"
+	DeliveryFailed      = "failed"
+	DeliveryRateLimited = "rate_limited"
+)
+
+// OperatorEvent is something that happened to one operator's gateway
+type OperatorEvent struct {
+	Type       string                 `json:"type"`
+	OperatorID string                 `json:"operator_id"`
+	GatewayID  string                 `json:"gateway_id"`
+	Message    string                 `json:"message"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	OccurredAt time.Time              `json:"occurred_at"`
+}
+
+// OperatorEmitter accepts operator events. Emit must not block the caller.
+type OperatorEmitter interface {
+	Emit(event OperatorEvent)
+}
+
+// OperatorStore is the storage the dispatcher needs; *db.Database implements it
+type OperatorStore interface {
+	GetOperatorPreferences(ctx context.Context, operatorID string) (*db.OperatorPreferences, error)
+	RecordNotificationDelivery(ctx context.Context, delivery *db.NotificationDelivery) error
+}
+
+// EmailSender sends a plain-text email
+type EmailSender interface {
+	SendEmail(ctx context.Context, to, subject, body string) error
+}
+
+// OperatorDispatcherConfig controls operator event delivery
+type OperatorDispatcherConfig struct {
+	MaxPerHour          int           // Events delivered to one operator per hour; 0 for no limit
+	Cooldown            time.Duration // Repeats of an event type for the same gateway within this are dropped
+	MaxAttempts         int           // Attempts per channel before giving up
+	RetryBackoff        time.Duration // Wait before the second attempt; doubled for each later one
+	QueueSize           int           // Events buffered for Run before Emit drops them
+	Workers             int           // Events delivered at once, so one slow operator does not hold up the rest
+	AllowPrivateTargets bool          // Allow webhooks to loopback and private addresses (tests only)
+}
+
+// LoadOperatorDispatcherConfigFromEnv reads the dispatcher config from the environment.
+func LoadOperatorDispatcherConfigFromEnv() OperatorDispatcherConfig {
+	return OperatorDispatcherConfig{
+		MaxPerHour:   envInt("LUMENLINK_OPERATOR_NOTIFY_MAX_PER_HOUR", 20),
+		Cooldown:     envDuration("LUMENLINK_OPERATOR_NOTIFY_COOLDOWN", time.Hour),
+		MaxAttempts:  envInt("LUMENLINK_OPERATOR_NOTIFY_MAX_ATTEMPTS", 3),
+		RetryBackoff: envDuration("LUMENLINK_OPERATOR_NOTIFY_RETRY_BACKOFF", 5*time.Second),
+		QueueSize:    1000,
+		Workers:      envInt("LUMENLINK_OPERATOR_NOTIFY_WORKERS", 4),
+	}
+}
+
+// OperatorDispatcher delivers operator events to the webhook and email each
+// operator configured, for the event types they enabled. Repeats of an event
+// for the same gateway are dropped for a cooldown, and each operator receives
+// at most MaxPerHour events; events over the limit are recorded as
+// rate_limited rather than sent. Failed sends are retried with backoff, and
+// every attempt is recorded so operators can see what reached them.
+type OperatorDispatcher struct {
+	store   OperatorStore
+	email   EmailSender
+	client  *http.Client
+	config  OperatorDispatcherConfig
+	queue   chan OperatorEvent
+	repeats *ThresholdAlerter // Keyed by gateway and event type
+	limiter *ThresholdAlerter // Keyed by operator
+	clock   clock.Clock
+}
+
+// NewOperatorDispatcher creates a dispatcher. email may be nil, in which
+// case operators' email addresses are ignored.
+func NewOperatorDispatcher(store OperatorStore, email EmailSender, config OperatorDispatcherConfig) *OperatorDispatcher {
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	if config.QueueSize < 1 {
+		config.QueueSize = 1
+	}
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !config.AllowPrivateTargets {
+		dialer.Control = publicOnly
+	}
+	return &OperatorDispatcher{
+		store:  store,
+		email:  email,
+		config: config,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			// A redirect could lead to an address the dial check never saw as a URL
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		queue:   make(chan OperatorEvent, config.QueueSize),
+		repeats: NewThresholdAlerter(1, config.Cooldown, 0),
+		limiter: NewThresholdAlerter(0, time.Hour, 0),
+		clock:   clock.Real{},
+	}
+}
+
+// SetClock replaces the time source, including the cooldown and rate limit
+// windows; it is intended for tests.
+func (d *OperatorDispatcher) SetClock(c clock.Clock) {
+	d.clock = c
+	d.repeats.SetClock(c)
+	d.limiter.SetClock(c)
+}
+
+// Emit queues an event for Run. Events are dropped when the queue is full.
+func (d *OperatorDispatcher) Emit(event OperatorEvent) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = d.clock.Now().UTC()
+	}
+	select {
+	case d.queue <- event:
+	default:
+		metrics.OperatorNotifications.WithLabelValues(event.Type, "dropped").Inc()
+		log.Printf("operator notification queue full, dropping %s for gateway %s", event.Type, event.GatewayID)
+	}
+}
+
+// Run delivers queued events on Workers goroutines until ctx is cancelled.
+// A worker retrying one event's webhook leaves the others to deliver the
+// rest of the queue.
+func (d *OperatorDispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work delivers queued events one at a time until ctx is cancelled
+func (d *OperatorDispatcher) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-d.queue:
+			if err := d.Deliver(ctx, event); err != nil {
+				log.Printf("operator notification %s for gateway %s failed: %v", event.Type, event.GatewayID, err)
+			}
+		}
+	}
+}
+
+// Deliver sends one event to its operator. Failed sends are recorded, not
+// returned; the error is for failures to load preferences or record attempts.
+func (d *OperatorDispatcher) Deliver(ctx context.Context, event OperatorEvent) error {
+	if event.OperatorID == "" {
+		return nil
+	}
+	if d.config.Cooldown > 0 {
+		if _, _, first := d.repeats.Observe(event.GatewayID + "|" + event.Type); !first {
+			return nil
+		}
+	}
+
+	prefs, err := d.store.GetOperatorPreferences(ctx, event.OperatorID)
+	if errors.Is(err, db.ErrPreferencesNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !containsString(prefs.Events, event.Type) {
+		return nil
+	}
+	email := prefs.Email
+	if d.email == nil {
+		email = ""
+	}
+	if prefs.WebhookURL == "" && email == "" {
+		return nil
+	}
+
+	if d.config.MaxPerHour > 0 {
+		if _, count, _ := d.limiter.Observe(event.OperatorID); count > d.config.MaxPerHour {
+			return d.record(ctx, event, ChannelNone, 0, DeliveryRateLimited, nil)
+		}
+	}
+
+	if prefs.WebhookURL != "" {
+		if err := d.deliver(ctx, event, ChannelWebhook, func() error {
+			return postJSON(ctx, d.client, prefs.WebhookURL, event)
+		}); err != nil {
+			return err
+		}
+	}
+	if email != "" {
+		subject, body := emailContent(event)
+		if err := d.deliver(ctx, event, ChannelEmail, func() error {
+			return d.email.SendEmail(ctx, email, subject, body)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver calls send until it succeeds or MaxAttempts is reached, recording
+// every attempt.
+func (d *OperatorDispatcher) deliver(ctx context.Context, event OperatorEvent, channel string, send func() error) error {
+	backoff := d.config.RetryBackoff
+	for attempt := 1; attempt <= d.config.MaxAttempts; attempt++ {
+		sendErr := send()
+		status := DeliveryDelivered
+		if sendErr != nil {
+			status = DeliveryFailed
+		}
+		if err := d.record(ctx, event, channel, attempt, status, sendErr); err != nil {
+			return err
+		}
+		if sendErr == nil || attempt == d.config.MaxAttempts {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-d.clock.After(backoff):
+		}
+		backoff *= 2
+	}
+	return nil
+}
+
+func (d *OperatorDispatcher) record(ctx context.Context, event OperatorEvent, channel string, attempt int, status string, sendErr error) error {
+	metrics.OperatorNotifications.WithLabelValues(event.Type, status).Inc()
+	delivery := &db.NotificationDelivery{
+		OperatorID: event.OperatorID,
+		EventType:  event.Type,
+		GatewayID:  event.GatewayID,
+		Channel:    channel,
+		Attempt:    attempt,
+		Status:     status,
+	}
+	if sendErr != nil {
+		delivery.Error = sendErr.Error()
+	}
+	return d.store.RecordNotificationDelivery(ctx, delivery)
+}
+
+// emailContent renders an event as an email subject and body
+func emailContent(event OperatorEvent) (string, string) {
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s\n\nGateway: %s\nEvent: %s\nTime: %s\n",
+		event.Message, event.GatewayID, event.Type, event.OccurredAt.UTC().Format(time.RFC3339))
+	keys := make([]string, 0, len(event.Details))
+	for key := range event.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&body, "%s: %v\n", key, event.Details[key])
+	}
+	return "[LumenLink] " + event.Message, body.String()
+}
+
+// publicOnly refuses connections to loopback, private and link-local
+// addresses, so operator webhooks cannot reach internal services.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
+
+// NopEmitter discards operator events. It is used until a dispatcher is set.
+type NopEmitter struct{}
+
+// Emit implements OperatorEmitter
+func (NopEmitter) Emit(OperatorEvent) {}
+
+// SMTPSender sends email through an SMTP relay
+type SMTPSender struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPSenderFromEnv returns an SMTP sender for LUMENLINK_SMTP_ADDR
+// (host:port) and LUMENLINK_SMTP_FROM, authenticating with
+// LUMENLINK_SMTP_USERNAME and LUMENLINK_SMTP_PASSWORD if set. It returns nil
+// if the relay or sender address is not configured.
+func NewSMTPSenderFromEnv() *SMTPSender {
+	addr := strings.TrimSpace(os.Getenv("LUMENLINK_SMTP_ADDR"))
+	from := strings.TrimSpace(os.Getenv("LUMENLINK_SMTP_FROM"))
+	if addr == "" || from == "" {
+		return nil
+	}
+	sender := &SMTPSender{addr: addr, from: from}
+	if username := os.Getenv("LUMENLINK_SMTP_USERNAME"); username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		sender.auth = smtp.PlainAuth("", username, os.Getenv("LUMENLINK_SMTP_PASSWORD"), host)
+	}
+	return sender
+}
+
+// SendEmail implements EmailSender. net/smtp has no context support, so ctx
+// is only checked before sending.
+func (s *SMTPSender) SendEmail(ctx context.Context, to, subject, body string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	message := "From: " + s.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" +
+		body
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{to}, []byte(message)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func envInt(key string, defaultValue int) int {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func envDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,298 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rendezvous/internal/db"
+)
+
+type fakeOperatorStore struct {
+	mu         sync.Mutex
+	prefs      map[string]*db.OperatorPreferences
+	deliveries []db.NotificationDelivery
+}
+
+func (s *fakeOperatorStore) GetOperatorPreferences(_ context.Context, operatorID string) (*db.OperatorPreferences, error) {
+	if p, ok := s.prefs[operatorID]; ok {
+		return p, nil
+	}
+	return nil, db.ErrPreferencesNotFound
+}
+
+func (s *fakeOperatorStore) RecordNotificationDelivery(_ context.Context, delivery *db.NotificationDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries = append(s.deliveries, *delivery)
+	return nil
+}
+
+func (s *fakeOperatorStore) statuses() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var statuses []string
+	for _, d := range s.deliveries {
+		statuses = append(statuses, d.Channel+":"+d.Status)
+	}
+	return statuses
+}
+
+type fakeEmail struct{ sent []string }
+
+func (e *fakeEmail) SendEmail(_ context.Context, to, subject, _ string) error {
+	e.sent = append(e.sent, to+": "+subject)
+	return nil
+}
+
+// receiver is an httptest webhook that fails its first failures requests
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	events   []OperatorEvent
+	failures int
+	calls    int
+}
+
+func newReceiver(t *testing.T, failures int) *receiver {
+	r := &receiver{failures: failures}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.calls++
+		if r.calls <= r.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event OperatorEvent
+		if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		r.events = append(r.events, event)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) received() []OperatorEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]OperatorEvent(nil), r.events...)
+}
+
+func testDispatcherConfig() OperatorDispatcherConfig {
+	return OperatorDispatcherConfig{
+		Cooldown:            time.Hour,
+		MaxAttempts:         3,
+		RetryBackoff:        time.Millisecond,
+		QueueSize:           10,
+		AllowPrivateTargets: true,
+	}
+}
+
+func allEvents() []string {
+	return append([]string(nil), OperatorEventTypes...)
+}
+
+func deliver(t *testing.T, d *OperatorDispatcher, event OperatorEvent) {
+	t.Helper()
+	if err := d.Deliver(context.Background(), event); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+}
+
+func TestOperatorDispatcher_RoutesToOperator(t *testing.T) {
+	alice, bob := newReceiver(t, 0), newReceiver(t, 0)
+	store := &fakeOperatorStore{prefs: map[string]*db.OperatorPreferences{
+		"alice": {OperatorID: "alice", WebhookURL: alice.URL, Email: "alice@example.org", Events: allEvents()},
+		"bob":   {OperatorID: "bob", WebhookURL: bob.URL, Events: allEvents()},
+	}}
+	email := &fakeEmail{}
+	d := NewOperatorDispatcher(store, email, testDispatcherConfig())
+
+	deliver(t, d, OperatorEvent{Type: EventGatewayOffline, OperatorID: "alice", GatewayID: "gw-1", Message: "Gateway gw-1 is offline"})
+
+	if got := alice.received(); len(got) != 1 || got[0].GatewayID != "gw-1" || got[0].Type != EventGatewayOffline {
+		t.Errorf("alice's webhook received %+v", got)
+	}
+	if got := bob.received(); len(got) != 0 {
+		t.Errorf("bob's webhook received alice's event: %+v", got)
+	}
+	if len(email.sent) != 1 || !strings.HasPrefix(email.sent[0], "alice@example.org: ") {
+		t.Errorf("emails sent: %v", email.sent)
+	}
+	if got := strings.Join(store.statuses(), ","); got != "webhook:delivered,email:delivered" {
+		t.Errorf("recorded deliveries: %s", got)
+	}
+	if store.deliveries[0].OperatorID != "alice" {
+		t.Errorf("delivery recorded for %q", store.deliveries[0].OperatorID)
+	}
+}
+
+func TestOperatorDispatcher_PreferenceFiltering(t *testing.T) {
+	hook := newReceiver(t, 0)
+	store := &fakeOperatorStore{prefs: map[string]*db.OperatorPreferences{
+		"alice": {OperatorID: "alice", WebhookURL: hook.URL, Events: []string{EventGatewayFlagged}},
+		"carol": {OperatorID: "carol", Events: allEvents()}, // No channel configured
+	}}
+	d := NewOperatorDispatcher(store, nil, testDispatcherConfig())
+
+	deliver(t, d, OperatorEvent{Type: EventGatewayOffline, OperatorID: "alice", GatewayID: "gw-1"})
+	deliver(t, d, OperatorEvent{Type: EventBandwidthCap, OperatorID: "alice", GatewayID: "gw-1"})
+	deliver(t, d, OperatorEvent{Type: EventGatewayFlagged, OperatorID: "alice", GatewayID: "gw-1"})
+	deliver(t, d, OperatorEvent{Type: EventGatewayFlagged, OperatorID: "carol", GatewayID: "gw-2"})
+	deliver(t, d, OperatorEvent{Type: EventGatewayFlagged, OperatorID: "dave", GatewayID: "gw-3"}) // No preferences
+
+	got := hook.received()
+	if len(got) != 1 || got[0].Type != EventGatewayFlagged {
+		t.Errorf("webhook received %+v, want only the gateway_flagged event", got)
+	}
+	if got := store.statuses(); len(got) != 1 {
+		t.Errorf("recorded deliveries %v, want one", got)
+	}
+}
+
+func TestOperatorDispatcher_RetriesUntilDelivered(t *testing.T) {
+	hook := newReceiver(t, 2)
+	store := &fakeOperatorStore{prefs: map[string]*db.OperatorPreferences{
+		"alice": {OperatorID: "alice", WebhookURL: hook.URL, Events: allEvents()},
+	}}
+	d := NewOperatorDispatcher(store, nil, testDispatcherConfig())
+
+	deliver(t, d, OperatorEvent{Type: EventGatewayOffline, OperatorID: "alice", GatewayID: "gw-1"})
+
+	if got := strings.Join(store.statuses(), ","); got != "webhook:failed,webhook:failed,webhook:delivered" {
+		t.Errorf("recorded deliveries: %s", got)
+	}
+	for i, delivery := range store.deliveries {
+		if delivery.Attempt != i+1 {
+			t.Errorf("delivery %d: attempt %d", i, delivery.Attempt)
+		}
+	}
+	if !strings.Contains(store.deliveries[0].Error, "503") {
+		t.Errorf("failed attempt error: %q", store.deliveries[0].Error)
+	}
+	if got := hook.received(); len(got) != 1 {
+		t.Errorf("webhook received %d events, want 1", len(got))
+	}
+}
+
+func TestOperatorDispatcher_GivesUpAfterMaxAttempts(t *testing.T) {
+	hook := newReceiver(t, 100)
+	store := &fakeOperatorStore{prefs: map[string]*db.OperatorPreferences{
+		"alice": {OperatorID: "alice", WebhookURL: hook.URL, Events: allEvents()},
+	}}
+	d := NewOperatorDispatcher(store, nil, testDispatcherConfig())
+
+	deliver(t, d, OperatorEvent{Type: EventGatewayOffline, OperatorID: "alice", GatewayID: "gw-1"})
+
+	if got := strings.Join(store.statuses(), ","); got != "webhook:failed,webhook:failed,webhook:failed" {
+		t.Errorf("recorded deliveries: %s", got)
+	}
+}
+
+func TestOperatorDispatcher_CooldownAndRateLimit(t *testing.T) {
+	hook := newReceiver(t, 0)
+	store := &fakeOperatorStore{prefs: map[string]*db.OperatorPreferences{
+		"alice": {OperatorID: "alice", WebhookURL: hook.URL, Events: allEvents()},
+	}}
+	config := testDispatcherConfig()
+	config.MaxPerHour = 2
+	d := NewOperatorDispatcher(store, nil, config)
+
+	// A repeat for the same gateway is dropped without a record
+	deliver(t, d, OperatorEvent{Type: EventBandwidthCap, OperatorID: "alice", GatewayID: "gw-1"})
+	deliver(t, d, OperatorEvent{Type: EventBandwidthCap, OperatorID: "alice", GatewayID: "gw-1"})
+	// Other gateways count toward the operator's limit
+	deliver(t, d, OperatorEvent{Type: EventBandwidthCap, OperatorID: "alice", GatewayID: "gw-2"})
+	deliver(t, d, OperatorEvent{Type: EventBandwidthCap, OperatorID: "alice", GatewayID: "gw-3"})
+
+	if got := strings.Join(store.statuses(), ","); got != "webhook:delivered,webhook:delivered,none:rate_limited" {
+		t.Errorf("recorded deliveries: %s", got)
+	}
+	if got := hook.received(); len(got) != 2 {
+		t.Errorf("webhook received %d events, want 2", len(got))
+	}
+}
+
+func TestOperatorDispatcher_RefusesPrivateTargets(t *testing.T) {
+	hook := newReceiver(t, 0)
+	store := &fakeOperatorStore{prefs: map[string]*db.OperatorPreferences{
+		"alice": {OperatorID: "alice", WebhookURL: hook.URL, Events: allEvents()},
+	}}
+	config := testDispatcherConfig()
+	config.AllowPrivateTargets = false
+	config.MaxAttempts = 1
+	d := NewOperatorDispatcher(store, nil, config)
+
+	deliver(t, d, OperatorEvent{Type: EventGatewayOffline, OperatorID: "alice", GatewayID: "gw-1"})
+
+	if got := hook.received(); len(got) != 0 {
+		t.Errorf("loopback webhook received %+v", got)
+	}
+	if len(store.deliveries) != 1 || !strings.Contains(store.deliveries[0].Error, "not public") {
+		t.Errorf("recorded deliveries: %+v", store.deliveries)
+	}
+}
+
+func TestOperatorDispatcher_Run(t *testing.T) {
+	hook := newReceiver(t, 0)
+	store := &fakeOperatorStore{prefs: map[string]*db.OperatorPreferences{
+		"alice": {OperatorID: "alice", WebhookURL: hook.URL, Events: allEvents()},
+	}}
+	d := NewOperatorDispatcher(store, nil, testDispatcherConfig())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	d.Emit(OperatorEvent{Type: EventGatewayFlagged, OperatorID: "alice", GatewayID: "gw-1"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(hook.received()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	got := hook.received()
+	if len(got) != 1 || got[0].OccurredAt.IsZero() {
+		t.Errorf("webhook received %+v", got)
+	}
+}
+
+func TestOperatorDispatcher_RunDoesNotWaitOnSlowOperators(t *testing.T) {
+	release := make(chan struct{})
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer stalled.Close()
+	defer close(release)
+	hook := newReceiver(t, 0)
+	store := &fakeOperatorStore{prefs: map[string]*db.OperatorPreferences{
+		"slow":  {OperatorID: "slow", WebhookURL: stalled.URL, Events: allEvents()},
+		"alice": {OperatorID: "alice", WebhookURL: hook.URL, Events: allEvents()},
+	}}
+	config := testDispatcherConfig()
+	config.Workers = 2
+	d := NewOperatorDispatcher(store, nil, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	d.Emit(OperatorEvent{Type: EventGatewayOffline, OperatorID: "slow", GatewayID: "gw-1"})
+	d.Emit(OperatorEvent{Type: EventGatewayOffline, OperatorID: "alice", GatewayID: "gw-2"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(hook.received()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := hook.received(); len(got) != 1 || got[0].GatewayID != "gw-2" {
+		t.Errorf("webhook received %+v while another operator's webhook stalled", got)
+	}
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+)
+
+// OverflowKey is the key events are counted under once a ThresholdAlerter is
+// tracking its maximum number of distinct keys.
+const OverflowKey = "other"
+
+// ThresholdAlerter counts events per key in fixed windows and reports the
+// event that first reaches the threshold, so each key alerts at most once per
+// window. The window for a key starts at its first event.
+type ThresholdAlerter struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	maxKeys   int
+	clock     clock.Clock
+	buckets   map[string]*thresholdBucket
+}
+
+type thresholdBucket struct {
+	start time.Time
+	count int
+	fired bool
+}
+
+// NewThresholdAlerter creates an alerter that fires when a key sees threshold
+// events within window. At most maxKeys distinct keys are tracked; further keys
+// share OverflowKey so that untrusted input cannot grow the map without bound.
+func NewThresholdAlerter(threshold int, window time.Duration, maxKeys int) *ThresholdAlerter {
+	return &ThresholdAlerter{
+		threshold: threshold,
+		window:    window,
+		maxKeys:   maxKeys,
+		clock:     clock.Real{},
+		buckets:   make(map[string]*thresholdBucket),
+	}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (a *ThresholdAlerter) SetClock(c clock.Clock) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.clock = c
+}
+
+// Observe records one event for key. It returns the key the event was counted
+// under, the count in the current window, and whether this event crossed the
+// threshold.
+func (a *ThresholdAlerter) Observe(key string) (string, int, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clock.Now()
+	a.expire(now)
+
+	bucket, ok := a.buckets[key]
+	if !ok && a.maxKeys > 0 && len(a.buckets) >= a.maxKeys {
+		key = OverflowKey
+		bucket, ok = a.buckets[key]
+	}
+	if !ok {
+		bucket = &thresholdBucket{start: now}
+		a.buckets[key] = bucket
+	}
+
+	bucket.count++
+	if a.threshold > 0 && bucket.count >= a.threshold && !bucket.fired {
+		bucket.fired = true
+		return key, bucket.count, true
+	}
+	return key, bucket.count, false
+}
+
+// expire drops buckets whose window has ended.
+func (a *ThresholdAlerter) expire(now time.Time) {
+	for key, bucket := range a.buckets {
+		if now.Sub(bucket.start) >= a.window {
+			delete(a.buckets, key)
+		}
+	}
+}
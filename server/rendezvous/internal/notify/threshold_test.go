@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"rendezvous/internal/clock"
+)
+
+func TestThresholdAlerter_FiresOncePerWindow(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	alerter := NewThresholdAlerter(3, time.Minute, 10)
+	alerter.clock = fake
+
+	var fired []int
+	for i := 1; i <= 10; i++ {
+		if _, count, fire := alerter.Observe("a"); fire {
+			fired = append(fired, count)
+		}
+	}
+	if len(fired) != 1 || fired[0] != 3 {
+		t.Fatalf("fired at counts %v, want [3]", fired)
+	}
+
+	// A new window starts counting again
+	fake.Advance(time.Minute)
+	for i := 1; i <= 3; i++ {
+		_, _, fire := alerter.Observe("a")
+		if fire != (i == 3) {
+			t.Errorf("event %d in second window: fire = %v", i, fire)
+		}
+	}
+}
+
+func TestThresholdAlerter_KeysAreIndependent(t *testing.T) {
+	alerter := NewThresholdAlerter(2, time.Minute, 10)
+
+	alerter.Observe("a")
+	if _, _, fire := alerter.Observe("b"); fire {
+		t.Error("b fired after one event")
+	}
+	if _, _, fire := alerter.Observe("a"); !fire {
+		t.Error("a did not fire at threshold")
+	}
+}
+
+func TestThresholdAlerter_Overflow(t *testing.T) {
+	alerter := NewThresholdAlerter(100, time.Minute, 2)
+
+	alerter.Observe("a")
+	alerter.Observe("b")
+	key, _, _ := alerter.Observe("c")
+	if key != OverflowKey {
+		t.Errorf("third key: got %q, want %q", key, OverflowKey)
+	}
+	if key, _, _ := alerter.Observe("a"); key != "a" {
+		t.Errorf("tracked key: got %q, want a", key)
+	}
+}
@@ -0,0 +1,372 @@
+// Package openapi generates an OpenAPI 3 document from a route table and the
+// Go types the handlers bind and return. Schemas follow encoding/json: field
+// names come from json tags, omitempty fields are optional in responses, and
+// request fields are required when they carry binding:"required".
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI version of generated documents
+const Version = "3.0.3"
+
+// Info describes the API in the generated document
+type Info struct {
+	Title   string
+	Version string
+}
+
+// Route documents one handler route
+type Route struct {
+	Method        string
+	Path          string // Gin syntax: /gateways/:id
+	OperationID   string
+	Summary       string
+	Admin         bool     // Requires the admin bearer token
+	Query         []string // Optional query parameters
+	RequiredQuery []string // Required query parameters
+	Headers       []string // Required request headers
+	Request       interface{}
+	Response      interface{} // Nil for an unstructured JSON object
+	Status        int         // Success status; defaults to 200
+	HTML          bool        // Success response is an HTML page rather than JSON
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// Generate builds the document for routes as indented JSON. The output is
+// deterministic so a checked-in copy can be compared against it.
+func Generate(info Info, routes []Route) ([]byte, error) {
+	g := &generator{schemas: map[string]interface{}{}, types: map[string]reflect.Type{}}
+
+	paths := map[string]map[string]interface{}{}
+	for _, route := range routes {
+		operation, err := g.operation(route)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", route.Method, route.Path, err)
+		}
+		path := openAPIPath(route.Path)
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		method := strings.ToLower(route.Method)
+		if _, ok := paths[path][method]; ok {
+			return nil, fmt.Errorf("%s %s: duplicate route", route.Method, route.Path)
+		}
+		paths[path][method] = operation
+	}
+
+	g.schemas["Error"] = map[string]interface{}{
+		"type":     "object",
+		"required": []string{"error"},
+		"properties": map[string]interface{}{
+			"error": map[string]interface{}{"type": "string"},
+		},
+	}
+
+	document := map[string]interface{}{
+		"openapi": Version,
+		"info":    map[string]interface{}{"title": info.Title, "version": info.Version},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]interface{}{
+				"adminToken": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+
+	// encoding/json sorts map keys, which keeps the output stable
+	out, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+type generator struct {
+	schemas map[string]interface{}
+	types   map[string]reflect.Type // Component name to the type that claimed it
+}
+
+func (g *generator) operation(route Route) (map[string]interface{}, error) {
+	operation := map[string]interface{}{"operationId": route.OperationID}
+	if route.Summary != "" {
+		operation["summary"] = route.Summary
+	}
+	if route.Admin {
+		operation["security"] = []interface{}{map[string]interface{}{"adminToken": []string{}}}
+	}
+
+	var parameters []interface{}
+	for _, segment := range strings.Split(route.Path, "/") {
+		if strings.HasPrefix(segment, ":") {
+			parameters = append(parameters, parameter(segment[1:], "path", true))
+		}
+	}
+	for _, name := range route.RequiredQuery {
+		parameters = append(parameters, parameter(name, "query", true))
+	}
+	for _, name := range route.Query {
+		parameters = append(parameters, parameter(name, "query", false))
+	}
+	for _, name := range route.Headers {
+		parameters = append(parameters, parameter(name, "header", true))
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if route.Request != nil {
+		schema, err := g.schema(reflect.TypeOf(route.Request), true)
+		if err != nil {
+			return nil, err
+		}
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(schema),
+		}
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if route.HTML {
+		success["content"] = map[string]interface{}{"text/html": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	} else if status != http.StatusNoContent {
+		schema := map[string]interface{}{"type": "object"}
+		if route.Response != nil {
+			var err error
+			if schema, err = g.schema(reflect.TypeOf(route.Response), false); err != nil {
+				return nil, err
+			}
+		}
+		success["content"] = jsonContent(schema)
+	}
+	operation["responses"] = map[string]interface{}{
+		fmt.Sprint(status): success,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content":     jsonContent(map[string]interface{}{"$ref": "#/components/schemas/Error"}),
+		},
+	}
+	return operation, nil
+}
+
+// schema returns the schema for t, registering named structs as components.
+// Request and response views of a struct differ in which fields are required,
+// so request structs are only ever expected to appear in requests.
+func (g *generator) schema(t reflect.Type, request bool) (map[string]interface{}, error) {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+	case t == rawJSONType:
+		return map[string]interface{}{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem(), request)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}, nil
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}, nil
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}, nil
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}, nil
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Interface:
+		return map[string]interface{}{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json sends byte slices as base64
+			return map[string]interface{}{"type": "string", "format": "byte"}, nil
+		}
+		items, err := g.schema(t.Elem(), request)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := g.schema(t.Elem(), request)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		return g.structRef(t, request)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// structRef registers t under its type name and returns a reference to it
+func (g *generator) structRef(t reflect.Type, request bool) (map[string]interface{}, error) {
+	name := t.Name()
+	if name == "" {
+		return g.structSchema(t, request)
+	}
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	if claimed, ok := g.types[name]; ok {
+		if claimed != t {
+			return nil, fmt.Errorf("schema name %s used by both %s and %s", name, claimed, t)
+		}
+		return ref, nil
+	}
+	// Claim the name first so recursive types terminate
+	g.types[name] = t
+	schema, err := g.structSchema(t, request)
+	if err != nil {
+		return nil, err
+	}
+	g.schemas[name] = schema
+	return ref, nil
+}
+
+func (g *generator) structSchema(t reflect.Type, request bool) (map[string]interface{}, error) {
+	properties := map[string]interface{}{}
+	var required []string
+	if err := g.fields(t, request, properties, &required); err != nil {
+		return nil, err
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema, nil
+}
+
+// fields adds t's JSON fields to properties, flattening embedded structs
+func (g *generator) fields(t reflect.Type, request bool, properties map[string]interface{}, required *[]string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if err := g.fields(embedded, request, properties, required); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema, err := g.schema(field.Type, request)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t.Name(), field.Name, err)
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			schema = withEnum(schema, strings.Split(enum, ","))
+		}
+		if field.Type.Kind() == reflect.Ptr && !request {
+			schema = nullable(schema)
+		}
+		properties[name] = schema
+
+		if isRequired(field, options, request) {
+			*required = append(*required, name)
+		}
+	}
+	return nil
+}
+
+// isRequired reports whether a field must be present: bound requests enforce
+// binding:"required", and responses always include fields without omitempty.
+func isRequired(field reflect.StructField, options string, request bool) bool {
+	if request {
+		for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+			if rule == "required" {
+				return true
+			}
+		}
+		return false
+	}
+	for _, option := range strings.Split(options, ",") {
+		if option == "omitempty" {
+			return false
+		}
+	}
+	return true
+}
+
+func withEnum(schema map[string]interface{}, values []string) map[string]interface{} {
+	if items, ok := schema["items"].(map[string]interface{}); ok && schema["type"] == "array" {
+		return map[string]interface{}{"type": "array", "items": withEnum(items, values)}
+	}
+	out := make(map[string]interface{}, len(schema)+1)
+	for key, value := range schema {
+		out[key] = value
+	}
+	out["enum"] = values
+	return out
+}
+
+// nullable marks a schema as accepting null. References cannot carry sibling
+// keywords in OpenAPI 3.0, so they are wrapped in allOf.
+func nullable(schema map[string]interface{}) map[string]interface{} {
+	if _, ok := schema["$ref"]; ok {
+		return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+	}
+	out := make(map[string]interface{}, len(schema)+1)
+	for key, value := range schema {
+		out[key] = value
+	}
+	out["nullable"] = true
+	return out
+}
+
+func parameter(name, in string, required bool) map[string]interface{} {
+	return map[string]interface{}{
+		"name":     name,
+		"in":       in,
+		"required": required,
+		"schema":   map[string]interface{}{"type": "string"},
+	}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// openAPIPath converts Gin path parameters (:id) to OpenAPI templates ({id})
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,172 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type embeddedFields struct {
+	Shared string `json:"shared"`
+}
+
+type testRequest struct {
+	Name    string   `json:"name" binding:"required"`
+	Kind    string   `json:"kind" enum:"a,b"`
+	Tags    []string `json:"tags,omitempty"`
+	Payload []byte   `json:"payload"`
+	Skipped string   `json:"-"`
+	hidden  string
+}
+
+type testResponse struct {
+	embeddedFields
+	ID        string            `json:"id"`
+	Count     *int              `json:"count,omitempty"`
+	Nested    *testNested       `json:"nested"`
+	Labels    map[string]string `json:"labels"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type testNested struct {
+	Score float64 `json:"score"`
+}
+
+func generate(t *testing.T, routes ...Route) map[string]interface{} {
+	t.Helper()
+	out, err := Generate(Info{Title: "test", Version: "1"}, routes)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(out, &document); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	return document
+}
+
+func schemaOf(t *testing.T, document map[string]interface{}, name string) map[string]interface{} {
+	t.Helper()
+	schemas := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	schema, ok := schemas[name].(map[string]interface{})
+	if !ok {
+		t.Fatalf("schema %s missing", name)
+	}
+	return schema
+}
+
+func TestGenerate_Schemas(t *testing.T) {
+	document := generate(t, Route{
+		Method: "POST", Path: "/items", OperationID: "CreateItem",
+		Request: testRequest{}, Response: testResponse{},
+	})
+
+	request := schemaOf(t, document, "testRequest")
+	properties := request["properties"].(map[string]interface{})
+	if _, ok := properties["Skipped"]; ok {
+		t.Error(`json:"-" field documented`)
+	}
+	if _, ok := properties["hidden"]; ok {
+		t.Error("unexported field documented")
+	}
+	if got := properties["payload"].(map[string]interface{})["format"]; got != "byte" {
+		t.Errorf("[]byte format = %v, want byte", got)
+	}
+	if got := properties["kind"].(map[string]interface{})["enum"]; len(got.([]interface{})) != 2 {
+		t.Errorf("kind enum = %v", got)
+	}
+	if got := request["required"].([]interface{}); len(got) != 1 || got[0] != "name" {
+		t.Errorf("request required = %v, want [name]", got)
+	}
+
+	response := schemaOf(t, document, "testResponse")
+	properties = response["properties"].(map[string]interface{})
+	if _, ok := properties["shared"]; !ok {
+		t.Error("embedded field not flattened")
+	}
+	if got := properties["created_at"].(map[string]interface{})["format"]; got != "date-time" {
+		t.Errorf("time.Time format = %v, want date-time", got)
+	}
+	nested := properties["nested"].(map[string]interface{})
+	if nested["nullable"] != true || nested["allOf"] == nil {
+		t.Errorf("pointer to struct = %v, want nullable allOf ref", nested)
+	}
+	required := response["required"].([]interface{})
+	for _, name := range required {
+		if name == "count" {
+			t.Error("omitempty response field is required")
+		}
+	}
+	if len(required) != 5 {
+		t.Errorf("response required = %v", required)
+	}
+	schemaOf(t, document, "testNested")
+}
+
+func TestGenerate_Operations(t *testing.T) {
+	document := generate(t,
+		Route{Method: "GET", Path: "/items/:id", OperationID: "GetItem", Admin: true, Query: []string{"window"}, RequiredQuery: []string{"device_id"}},
+		Route{Method: "DELETE", Path: "/items/:id", OperationID: "DeleteItem", Status: 204},
+		Route{Method: "GET", Path: "/page", OperationID: "GetPage", HTML: true},
+	)
+	item := document["paths"].(map[string]interface{})["/items/{id}"].(map[string]interface{})
+
+	get := item["get"].(map[string]interface{})
+	if get["security"] == nil {
+		t.Error("admin route has no security requirement")
+	}
+	parameters := get["parameters"].([]interface{})
+	if len(parameters) != 3 {
+		t.Fatalf("parameters = %v, want path id and query device_id and window", parameters)
+	}
+	if deviceID := parameters[1].(map[string]interface{}); deviceID["name"] != "device_id" || deviceID["required"] != true {
+		t.Errorf("required query parameter = %v", deviceID)
+	}
+
+	deleted := item["delete"].(map[string]interface{})
+	noContent := deleted["responses"].(map[string]interface{})["204"].(map[string]interface{})
+	if _, ok := noContent["content"]; ok {
+		t.Error("204 response has content")
+	}
+
+	page := document["paths"].(map[string]interface{})["/page"].(map[string]interface{})["get"].(map[string]interface{})
+	content := page["responses"].(map[string]interface{})["200"].(map[string]interface{})["content"].(map[string]interface{})
+	if _, ok := content["text/html"]; !ok || len(content) != 1 {
+		t.Errorf("HTML route content = %v, want text/html only", content)
+	}
+}
+
+func TestGenerate_Deterministic(t *testing.T) {
+	route := Route{Method: "POST", Path: "/items", OperationID: "CreateItem", Request: testRequest{}, Response: testResponse{}}
+	first, err := Generate(Info{}, []Route{route})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		again, _ := Generate(Info{}, []Route{route})
+		if string(again) != string(first) {
+			t.Fatal("output differs between runs")
+		}
+	}
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	cases := map[string][]Route{
+		"duplicate route": {
+			{Method: "GET", Path: "/items", OperationID: "A"},
+			{Method: "GET", Path: "/items", OperationID: "B"},
+		},
+		"unsupported type": {
+			{Method: "POST", Path: "/items", OperationID: "A", Request: struct {
+				C chan int `json:"c"`
+			}{}},
+		},
+	}
+	for want, routes := range cases {
+		_, err := Generate(Info{}, routes)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("err = %v, want %q", err, want)
+		}
+	}
+}
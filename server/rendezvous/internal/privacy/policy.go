@@ -0,0 +1,159 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// Persistence modes
+const (
+	ModeStandard  = "standard"
+	ModeMinimized = "minimized"
+)
+
+// Policy decides what client data the server may persist. Under data
+// minimization nothing that can link a device to the gateways it was given
+// is stored: per-device records are dropped in favour of aggregate
+// counters, client addresses are kept only as a keyed hash of their network,
+// and features that must recognise a device across requests turn themselves
+// off. A nil Policy is standard.
+type Policy struct {
+	minimize  bool
+	bucketKey []byte
+}
+
+// NewPolicy creates a policy, minimizing data when minimize is set. Client
+// networks are hashed with a per-process key; see SetBucketSecret.
+func NewPolicy(minimize bool) *Policy {
+	p := &Policy{minimize: minimize}
+	if minimize {
+		p.bucketKey = make([]byte, 32)
+		if _, err := rand.Read(p.bucketKey); err != nil {
+			panic(fmt.Sprintf("privacy: failed to generate client bucket key: %v", err))
+		}
+	}
+	return p
+}
+
+// SetBucketSecret sets the key client networks are hashed with. Every
+// replica must share it for one network to land in the same bucket
+// everywhere.
+func (p *Policy) SetBucketSecret(secret string) {
+	p.bucketKey = []byte(secret)
+}
+
+// LoadPolicyFromEnv reads LUMENLINK_DATA_MINIMIZATION (default false) and,
+// when it is on, LUMENLINK_DATA_MINIMIZATION_BUCKET_SECRET. An unrecognised
+// value is an error rather than a silent fallback to standard.
+func LoadPolicyFromEnv() (*Policy, error) {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("LUMENLINK_DATA_MINIMIZATION"))) {
+	case "", "false", "0", "no":
+		return NewPolicy(false), nil
+	case "true", "1", "yes":
+		policy := NewPolicy(true)
+		if secret := os.Getenv("LUMENLINK_DATA_MINIMIZATION_BUCKET_SECRET"); secret != "" {
+			policy.SetBucketSecret(secret)
+		} else {
+			log.Printf("LUMENLINK_DATA_MINIMIZATION_BUCKET_SECRET is not set; client networks are hashed with a per-process key")
+		}
+		return policy, nil
+	default:
+		return nil, fmt.Errorf("invalid LUMENLINK_DATA_MINIMIZATION %q", os.Getenv("LUMENLINK_DATA_MINIMIZATION"))
+	}
+}
+
+// Minimized reports whether data minimization is on
+func (p *Policy) Minimized() bool {
+	return p != nil && p.minimize
+}
+
+// Mode returns ModeMinimized or ModeStandard
+func (p *Policy) Mode() string {
+	if p.Minimized() {
+		return ModeMinimized
+	}
+	return ModeStandard
+}
+
+// PersistDeviceRecords reports whether records keyed by a device, such as
+// attestation results, may be stored
+func (p *Policy) PersistDeviceRecords() bool {
+	return !p.Minimized()
+}
+
+// ClientAddress returns the client address a write may store: ip, or nil
+// under data minimization
+func (p *Policy) ClientAddress(ip *string) *string {
+	if p.Minimized() {
+		return nil
+	}
+	return ip
+}
+
+// ClientBucket returns the client bucket a write may store in place of the
+// address: under data minimization a keyed hash of the client's /24 (/48 for
+// IPv6) network, otherwise nil as the address itself is kept. The bucket
+// still tells clients on different networks apart, which the suspicion
+// scorer and country rollups need, but names neither a client nor its
+// network.
+func (p *Policy) ClientBucket(ip *string) *string {
+	if !p.Minimized() || ip == nil {
+		return nil
+	}
+	network := ClientNetwork(*ip)
+	if network == "" {
+		return nil
+	}
+	mac := hmac.New(sha256.New, p.bucketKey)
+	mac.Write([]byte(network))
+	bucket := hex.EncodeToString(mac.Sum(nil)[:16])
+	return &bucket
+}
+
+// ClientNetwork returns the /24 (/48 for IPv6) network of ip, or empty when
+// ip is not an address. Clients on one network are usually one user or one
+// proxy, so it groups clients that can change every other identifier.
+func ClientNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// TrackDevices reports whether features that recognise a device across
+// requests, such as the admission controller's seen-device set, may run
+func (p *Policy) TrackDevices() bool {
+	return !p.Minimized()
+}
+
+// aggregateContextKeys are client error context keys kept under data
+// minimization. They name config signing keys, which every client of a
+// release shares.
+var aggregateContextKeys = []string{"trusted_key_id", "pack_key_id"}
+
+// ClientErrorContext returns the client error context a write may store.
+// Under data minimization free-form values, which a client could fill with
+// anything identifying, are dropped.
+func (p *Policy) ClientErrorContext(errorContext map[string]string) map[string]string {
+	if !p.Minimized() {
+		return errorContext
+	}
+	kept := map[string]string{}
+	for _, key := range aggregateContextKeys {
+		if value, ok := errorContext[key]; ok {
+			kept[key] = value
+		}
+	}
+	return kept
+}
@@ -0,0 +1,108 @@
+package privacy
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadPolicyFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", ModeStandard, false},
+		{"false", ModeStandard, false},
+		{"TRUE", ModeMinimized, false},
+		{"1", ModeMinimized, false},
+		{"strict", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			os.Setenv("LUMENLINK_DATA_MINIMIZATION", tt.value)
+			defer os.Unsetenv("LUMENLINK_DATA_MINIMIZATION")
+			policy, err := LoadPolicyFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPolicyFromEnv: err %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && policy.Mode() != tt.want {
+				t.Errorf("Mode() = %s, want %s", policy.Mode(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_NilIsStandard(t *testing.T) {
+	var policy *Policy
+	ip := "192.0.2.1"
+	if policy.Minimized() || !policy.PersistDeviceRecords() || !policy.TrackDevices() {
+		t.Error("nil policy restricts persistence")
+	}
+	if got := policy.ClientAddress(&ip); got != &ip {
+		t.Errorf("ClientAddress() = %v, want the address", got)
+	}
+}
+
+func TestPolicy_Minimized(t *testing.T) {
+	policy := NewPolicy(true)
+	ip := "192.0.2.1"
+	if policy.PersistDeviceRecords() || policy.TrackDevices() {
+		t.Error("minimized policy allows device records or tracking")
+	}
+	if got := policy.ClientAddress(&ip); got != nil {
+		t.Errorf("ClientAddress() = %v, want nil", *got)
+	}
+	got := policy.ClientErrorContext(map[string]string{"trusted_key_id": "k1", "pack_key_id": "k2", "transport": "masque"})
+	want := map[string]string{"trusted_key_id": "k1", "pack_key_id": "k2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ClientErrorContext() = %v, want %v", got, want)
+	}
+}
+
+func TestPolicy_ClientBucket(t *testing.T) {
+	policy := NewPolicy(true)
+	policy.SetBucketSecret("secret")
+	bucket := func(ip string) string {
+		got := policy.ClientBucket(&ip)
+		if got == nil {
+			t.Fatalf("ClientBucket(%s) = nil", ip)
+		}
+		return *got
+	}
+	if bucket("192.0.2.1") != bucket("192.0.2.200") {
+		t.Error("addresses in one /24 land in different buckets")
+	}
+	if bucket("192.0.2.1") == bucket("198.51.100.1") {
+		t.Error("different networks share a bucket")
+	}
+	if strings.Contains(bucket("192.0.2.1"), "192.0.2") {
+		t.Error("bucket carries the network")
+	}
+
+	other := NewPolicy(true)
+	other.SetBucketSecret("other")
+	ip := "192.0.2.1"
+	if *other.ClientBucket(&ip) == bucket(ip) {
+		t.Error("bucket does not depend on the secret")
+	}
+	if got := NewPolicy(false).ClientBucket(&ip); got != nil {
+		t.Errorf("standard ClientBucket() = %v, want nil", *got)
+	}
+}
+
+func TestClientNetwork(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.77":        "192.0.2.0",
+		"::ffff:192.0.2.77": "192.0.2.0",
+		"2001:db8:1:2:3::4": "2001:db8:1::",
+		"not-an-address":    "",
+		"":                  "",
+	}
+	for ip, want := range tests {
+		if got := ClientNetwork(ip); got != want {
+			t.Errorf("ClientNetwork(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
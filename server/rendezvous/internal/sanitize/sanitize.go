@@ -0,0 +1,132 @@
+// Package sanitize cleans free text from clients and admins before it is
+// stored, so that whatever later renders it (dashboards, terminals, exports)
+// sees bounded, printable UTF-8. Only the encoding is touched: wording is
+// passed through as sent, with no word or profanity filtering.
+package sanitize
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ellipsis marks text that was truncated
+const Ellipsis = "…"
+
+// Text returns s as single-line text of at most maxBytes bytes. Invalid
+// UTF-8 becomes U+FFFD, terminal escape sequences and control and bidi
+// override characters are removed, runs of whitespace collapse to one space,
+// and text over the limit is cut at a rune boundary and ends in Ellipsis.
+func Text(s string, maxBytes int) string {
+	return clean(s, maxBytes, false)
+}
+
+// Multiline is Text but keeps line breaks and tabs, for notes and
+// descriptions where layout matters.
+func Multiline(s string, maxBytes int) string {
+	return clean(s, maxBytes, true)
+}
+
+func clean(s string, maxBytes int, multiline bool) string {
+	s = strings.ToValidUTF8(s, string(utf8.RuneError))
+
+	var b strings.Builder
+	b.Grow(len(s))
+	space, lineStart := false, true
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == 0x1b || r == 0x9b { // ESC or CSI
+			i += escapeLen(s[i:])
+			continue
+		}
+		i += size
+
+		switch {
+		case multiline && (r == '\n' || r == '\t'):
+			b.WriteRune(r)
+			space, lineStart = false, r == '\n'
+		case multiline && r == '\r':
+			// CRLF becomes LF; a lone CR would let text overwrite a line
+		case unicode.IsSpace(r):
+			space = !lineStart
+		case unicode.IsControl(r) || isBidiControl(r):
+		default:
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteRune(r)
+			lineStart = false
+		}
+	}
+	return truncate(strings.TrimSpace(b.String()), maxBytes)
+}
+
+// escapeLen returns the length of the escape sequence at the start of s,
+// which begins with ESC or the C1 CSI. CSI sequences run to a final byte in
+// 0x40-0x7e and OSC sequences to BEL or ST; any other ESC takes one rune.
+func escapeLen(s string) int {
+	if strings.HasPrefix(s, "\u009b") {
+		return csiLen(s, len("\u009b"))
+	}
+	if len(s) < 2 {
+		return len(s)
+	}
+	switch s[1] {
+	case '[':
+		return csiLen(s, 2)
+	case ']':
+		return oscLen(s)
+	}
+	_, size := utf8.DecodeRuneInString(s[1:])
+	return 1 + size
+}
+
+// csiLen returns the length of the CSI sequence at the start of s whose
+// parameters start at n
+func csiLen(s string, n int) int {
+	for ; n < len(s); n++ {
+		if s[n] >= 0x40 && s[n] <= 0x7e {
+			return n + 1
+		}
+		if s[n] < 0x20 || s[n] > 0x7e {
+			// Malformed: stop before text that does not belong to it
+			return n
+		}
+	}
+	return n
+}
+
+// oscLen returns the length of the OSC sequence at the start of s
+func oscLen(s string) int {
+	for n := 2; n < len(s); n++ {
+		switch {
+		case s[n] == 0x07:
+			return n + 1
+		case s[n] == 0x1b && n+1 < len(s) && s[n+1] == '\\':
+			return n + 2
+		}
+	}
+	return len(s)
+}
+
+// isBidiControl reports whether r is a bidirectional embedding, override or
+// isolate, which can make stored text display differently from its content.
+func isBidiControl(r rune) bool {
+	return (r >= 0x202a && r <= 0x202e) || (r >= 0x2066 && r <= 0x2069)
+}
+
+// truncate cuts s to at most maxBytes bytes, ending in Ellipsis when cut
+func truncate(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	if maxBytes < len(Ellipsis) {
+		return ""
+	}
+	cut := maxBytes - len(Ellipsis)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return strings.TrimRightFunc(s[:cut], unicode.IsSpace) + Ellipsis
+}
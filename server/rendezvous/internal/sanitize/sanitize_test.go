@@ -0,0 +1,70 @@
+package sanitize
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		max  int
+		want string
+	}{
+		{"plain", "connection refused", 64, "connection refused"},
+		{"embedded nulls", "time\x00out\x00", 64, "timeout"},
+		{"ansi colour", "\x1b[31mfailed\x1b[0m to bind", 64, "failed to bind"},
+		{"ansi cursor and erase", "ok\x1b[2K\x1b[1Gforged", 64, "okforged"},
+		{"osc title", "\x1b]0;pwned\x07done", 64, "done"},
+		{"osc with st", "\x1b]8;;https://evil.example\x1b\\link\x1b]8;;\x1b\\", 64, "link"},
+		{"c1 csi", "a\u009b31mb", 64, "ab"},
+		{"lone esc", "abc\x1b", 64, "abc"},
+		{"bidi override", "file\u202etxt.exe", 64, "filetxt.exe"},
+		{"newlines collapse", "line one\r\nline two\t end", 64, "line one line two end"},
+		{"invalid utf8", "bad\xff\xfebyte", 64, "bad\ufffdbyte"},
+		{"profanity passes through", "damn this gateway", 64, "damn this gateway"},
+		{"truncated", "abcdefghij", 8, "abcde…"},
+		{"exact fit", "abcdefgh", 8, "abcdefgh"},
+		{"limit below marker", "abcdef", 2, ""},
+		{"no trailing space before marker", "abcd efgh", 8, "abcd…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Text(tt.in, tt.max); got != tt.want {
+				t.Errorf("Text(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestText_MultiByteBoundaries(t *testing.T) {
+	// Each of these runes takes 2, 3 and 4 bytes
+	for _, r := range []string{"é", "中", "🙂"} {
+		in := strings.Repeat(r, 20)
+		for max := len(Ellipsis); max <= len(in); max++ {
+			got := Text(in, max)
+			if !utf8.ValidString(got) {
+				t.Fatalf("Text(%q x20, %d) split a rune: %q", r, max, got)
+			}
+			if len(got) > max {
+				t.Fatalf("Text(%q x20, %d) is %d bytes", r, max, len(got))
+			}
+			if max < len(in) && !strings.HasSuffix(got, Ellipsis) {
+				t.Fatalf("Text(%q x20, %d) = %q, want the ellipsis marker", r, max, got)
+			}
+			if kept := strings.TrimSuffix(got, Ellipsis); strings.Repeat(r, utf8.RuneCountInString(kept)) != kept {
+				t.Fatalf("Text(%q x20, %d) = %q", r, max, got)
+			}
+		}
+	}
+}
+
+func TestMultiline(t *testing.T) {
+	in := "Rollout for\r\n  \x1b[1mDTV\x1b[0m clients\n\tstage 2\rX\x00"
+	want := "Rollout for\nDTV clients\n\tstage 2X"
+	if got := Multiline(in, 128); got != want {
+		t.Errorf("Multiline = %q, want %q", got, want)
+	}
+}
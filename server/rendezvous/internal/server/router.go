@@ -0,0 +1,257 @@
+// Package server assembles the HTTP router shared by the rendezvous binary
+// and the end-to-end scenario tests.
+package server
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"rendezvous/internal/api"
+	"rendezvous/internal/store"
+)
+
+// NewRouter registers every route. Document new routes in api.Routes and
+// regenerate the OpenAPI spec; TestRouterMatchesOpenAPIRoutes checks both.
+// Rate limits are kept in rateLimits.
+func NewRouter(handler *api.Handler, rateLimits store.RateLimitStore) *gin.Engine {
+	router := gin.Default()
+
+	// Security headers (all responses)
+	router.Use(securityHeaders())
+
+	// CORS: strict in production, permissive in dev
+	router.Use(corsMiddleware())
+
+	// Health check (no rate limit)
+	router.GET("/health", handler.Health)
+	router.GET("/status", handler.GetStatusPage)
+
+	// Prometheus metrics
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// API routes - using /api/v1 to match frontend expectations (rate limited)
+	apiLimiter := newRateLimiter(rateLimits, "api", 100, 10) // 100 req/min burst 10
+	// Client error reports are cheap to send and only useful in aggregate: 10 req/min burst 2
+	clientErrorLimiter := newRateLimiter(rateLimits, "client_errors", 10, 2)
+	apiGroup := router.Group("/api/v1")
+	apiGroup.Use(apiLimiter.middleware())
+	{
+		apiGroup.POST("/config", handler.GetConfig)
+		apiGroup.GET("/config/signing-keys", handler.GetSigningKeys)
+		apiGroup.GET("/config/revocations", handler.GetRevocations)
+		apiGroup.GET("/attest/challenge", handler.GetAttestationChallenge)
+		apiGroup.POST("/attest", handler.VerifyAttestation)
+		apiGroup.POST("/attest/desktop/enroll", handler.EnrollDesktopDevice)
+		apiGroup.POST("/gateway/status", handler.HandleGatewayStatus)
+		apiGroup.POST("/gateway/register", handler.RegisterGateway)
+		apiGroup.POST("/gateway/bootstrap", handler.BootstrapGateway)
+		apiGroup.GET("/gateway/:id/metrics", handler.GetGatewayMetrics) // Signed by the gateway key
+		apiGroup.PUT("/gateway/:id/secret", handler.PutGatewaySecret)   // Signed by the gateway key
+		apiGroup.GET("/gateway/:id/notifications", handler.GetNotificationPreferences)
+		apiGroup.PUT("/gateway/:id/notifications", handler.PutNotificationPreferences)
+		apiGroup.GET("/gateway/:id/notifications/deliveries", handler.GetNotificationDeliveries)
+		apiGroup.POST("/discovery/log", handler.HandleDiscoveryLog)
+		apiGroup.POST("/discovery/logs", handler.HandleDiscoveryLogBatch)
+		apiGroup.POST("/client/errors", clientErrorLimiter.middleware(), handler.ReportClientError)
+		apiGroup.GET("/gateways", handler.GetGateways) // Community page endpoint
+		apiGroup.GET("/stats/discovery", handler.GetDiscoveryStats)
+		apiGroup.GET("/federation/announcement", handler.GetFederationAnnouncement)
+		apiGroup.GET("/openapi.json", handler.GetOpenAPISpec)
+	}
+
+	// Admin routes (bearer token; disabled when no admin token is set)
+	adminGroup := router.Group("/api/v1/admin")
+	adminGroup.Use(adminAuth())
+	{
+		adminGroup.GET("/review-queue", handler.GetReviewQueue)
+		adminGroup.POST("/review-queue/:id/close", handler.CloseReviewItem)
+		adminGroup.GET("/gateways/:id", handler.GetAdminGateway)
+		adminGroup.POST("/gateways/:id/approve", handler.ApproveGateway)
+		adminGroup.POST("/gateways/:id/reject", handler.RejectGateway)
+		adminGroup.POST("/gateways/:id/maintenance-windows", handler.CreateMaintenanceWindow)
+		adminGroup.GET("/devices/:id", handler.GetAdminDevice)
+		adminGroup.GET("/federation/peers", handler.ListFederationPeers)
+		adminGroup.POST("/federation/peers", handler.CreateFederationPeer)
+		adminGroup.PUT("/federation/peers/:id", handler.UpdateFederationPeer)
+		adminGroup.DELETE("/federation/peers/:id", handler.DeleteFederationPeer)
+		adminGroup.POST("/federation/peers/:id/enable", handler.EnableFederationPeer)
+		adminGroup.POST("/federation/peers/:id/disable", handler.DisableFederationPeer)
+		adminGroup.POST("/enrollment-tokens", handler.CreateEnrollmentToken)
+		adminGroup.POST("/operator-credentials", handler.CreateOperatorCredential)
+		adminGroup.DELETE("/operator-credentials/:id", handler.RevokeOperatorCredential)
+		adminGroup.GET("/client-errors", handler.GetClientErrorSummary)
+		adminGroup.GET("/pack-verification-failures", handler.GetPackVerificationFailures)
+		adminGroup.GET("/adversarial-activity", handler.GetAdversarialActivity)
+		adminGroup.GET("/attestation/stats", handler.GetAttestationStats)
+		adminGroup.POST("/packs/preview", handler.PreviewConfigPack)
+		adminGroup.GET("/config/preview", handler.GetConfigPreview)
+		adminGroup.GET("/rollouts", handler.ListRollouts)
+		adminGroup.PUT("/rollouts/:key", handler.PutRollout)
+		adminGroup.DELETE("/rollouts/:key", handler.DeleteRollout)
+		adminGroup.POST("/rollouts/:key/abort", handler.AbortRollout)
+		adminGroup.GET("/launch-policy", handler.GetLaunchPolicy)
+		adminGroup.PUT("/launch-policy", handler.PutLaunchPolicy)
+		adminGroup.GET("/transport-policies", handler.ListTransportPolicies)
+		adminGroup.PUT("/transport-policies/:country/:transport", handler.PutTransportPolicy)
+		adminGroup.DELETE("/transport-policies/:country/:transport", handler.DeleteTransportPolicy)
+		adminGroup.GET("/experiments", handler.ListExperiments)
+		adminGroup.PUT("/experiments/:name", handler.PutExperiment)
+		adminGroup.DELETE("/experiments/:name", handler.DeleteExperiment)
+		adminGroup.GET("/kill-switches", handler.ListKillSwitches)
+		adminGroup.PUT("/kill-switches/:transport", handler.PutKillSwitch)
+		adminGroup.DELETE("/kill-switches/:transport", handler.DeleteKillSwitch)
+		adminGroup.GET("/transports/endpoint-burn", handler.GetEndpointBurn)
+		adminGroup.GET("/audit/export", handler.ExportAuditLog)
+		adminGroup.POST("/signing-keys/rotate", handler.RotateSigningKey)
+		adminGroup.POST("/config/revocations", handler.CreateRevocation)
+	}
+
+	return router
+}
+
+// securityHeaders adds security headers to all responses.
+func securityHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("X-Frame-Options", "DENY")
+		c.Header("X-XSS-Protection", "1; mode=block")
+		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
+		c.Next()
+	}
+}
+
+// adminCredential is an admin bearer token and the name its requests are
+// audited under
+type adminCredential struct {
+	name  string
+	token string
+}
+
+var adminNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.@+-]{1,100}$`)
+
+// loadAdminCredentials reads the admin tokens: LUMENLINK_ADMIN_TOKENS, a
+// comma-separated list of name:token pairs, one per admin, and the shared
+// LUMENLINK_ADMIN_TOKEN, named admin. Malformed entries are logged and
+// skipped.
+func loadAdminCredentials() []adminCredential {
+	var credentials []adminCredential
+	for _, entry := range strings.Split(os.Getenv("LUMENLINK_ADMIN_TOKENS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(entry, ":")
+		if !ok || !adminNamePattern.MatchString(name) || token == "" {
+			log.Printf("ignoring malformed LUMENLINK_ADMIN_TOKENS entry %q", name)
+			continue
+		}
+		credentials = append(credentials, adminCredential{name: name, token: token})
+	}
+	if token := os.Getenv("LUMENLINK_ADMIN_TOKEN"); token != "" {
+		credentials = append(credentials, adminCredential{name: api.DefaultAdminActor, token: token})
+	}
+	return credentials
+}
+
+// adminAuth requires an admin bearer token on admin routes, and names the
+// request's admin after the credential for the audit log. Admin routes
+// respond 404 when no token is configured.
+func adminAuth() gin.HandlerFunc {
+	credentials := loadAdminCredentials()
+	return func(c *gin.Context) {
+		if len(credentials) == 0 {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		name := ""
+		for _, credential := range credentials {
+			// Every credential is compared, so the timing does not tell
+			// which one matched
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(credential.token)) == 1 && name == "" {
+				name = credential.name
+			}
+		}
+		if name == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Set(api.ContextAdminActor, name)
+		c.Next()
+	}
+}
+
+// corsMiddleware returns CORS config: strict in production, permissive in dev.
+func corsMiddleware() gin.HandlerFunc {
+	origins := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if origins == "" {
+		if strings.ToLower(os.Getenv("GO_ENV")) == "production" {
+			// Production default: only lumenlink.org
+			origins = "https://lumenlink.org,https://www.lumenlink.org"
+		} else {
+			// Dev default: allow localhost
+			origins = "http://localhost:3000,http://127.0.0.1:3000,http://localhost:3001"
+		}
+	}
+	allowList := strings.Split(origins, ",")
+	for i := range allowList {
+		allowList[i] = strings.TrimSpace(allowList[i])
+	}
+	cfg := cors.Config{
+		AllowOrigins:     allowList,
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		ExposeHeaders:    []string{"Content-Length"},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}
+	return cors.New(cfg)
+}
+
+// rateLimiter provides per-client rate limiting.
+type rateLimiter struct {
+	store    store.RateLimitStore
+	fallback *store.Memory // Limits clients in this process while the store is unreachable
+	name     string        // Namespaces the limiter's keys in the store
+	limit    store.Limit
+}
+
+func newRateLimiter(rateLimits store.RateLimitStore, name string, perMin int, burst int) *rateLimiter {
+	return &rateLimiter{
+		store:    rateLimits,
+		fallback: store.NewMemory(),
+		name:     name,
+		limit:    store.Limit{PerMinute: perMin, Burst: burst},
+	}
+}
+
+// middleware rejects clients over the limit. When the store is unreachable
+// the limit is kept in process instead, so the API neither fails with the
+// store nor goes unlimited; each replica then limits clients on its own.
+func (rl *rateLimiter) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		if ip == "" {
+			ip = "unknown"
+		}
+		key := rl.name + ":" + ip
+		allowed, err := rl.store.Allow(c.Request.Context(), key, rl.limit)
+		if err != nil {
+			log.Printf("Rate limit store unavailable, limiting in process: %v", err)
+			allowed, _ = rl.fallback.Allow(c.Request.Context(), key, rl.limit)
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate_limit_exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"rendezvous/internal/api"
+	"rendezvous/internal/store"
+)
+
+func TestRouterMatchesOpenAPIRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := NewRouter(api.NewHandler(nil, nil, nil, nil), store.NewMemory())
+
+	registered := make(map[string]bool)
+	for _, route := range router.Routes() {
+		if route.Path == "/metrics" {
+			continue // Prometheus scrape endpoint, not part of the API
+		}
+		registered[route.Method+" "+route.Path] = true
+	}
+	documented := make(map[string]bool)
+	for _, route := range api.Routes {
+		documented[route.Method+" "+route.Path] = true
+	}
+
+	for route := range registered {
+		if !documented[route] {
+			t.Errorf("%s is registered but missing from api.Routes; add it and run go generate ./internal/api", route)
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			t.Errorf("%s is in api.Routes but not registered", route)
+		}
+	}
+}
+
+type failingRateLimits struct{}
+
+func (failingRateLimits) Allow(context.Context, string, store.Limit) (bool, error) {
+	return false, errors.New("redis: connection refused")
+}
+
+func TestRateLimiter_SharedAcrossReplicas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	shared := store.NewMemory()
+	newReplica := func(rateLimits store.RateLimitStore) *gin.Engine {
+		router := gin.New()
+		router.GET("/", newRateLimiter(rateLimits, "api", 60, 2).middleware(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		return router
+	}
+	get := func(router *gin.Engine) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Code
+	}
+
+	// The burst is shared, whichever replica the client reaches
+	first, second := newReplica(shared), newReplica(shared)
+	if code := get(first); code != http.StatusOK {
+		t.Fatalf("first request: status %d", code)
+	}
+	if code := get(second); code != http.StatusOK {
+		t.Fatalf("second request: status %d", code)
+	}
+	if code := get(first); code != http.StatusTooManyRequests {
+		t.Errorf("past the burst: status %d, want 429", code)
+	}
+
+	// An unreachable store neither takes the API down with it nor lifts the
+	// limit: the replica limits clients in process
+	unreachable := newReplica(failingRateLimits{})
+	for i := 0; i < 2; i++ {
+		if code := get(unreachable); code != http.StatusOK {
+			t.Errorf("store error, request %d: status %d, want 200", i+1, code)
+		}
+	}
+	if code := get(unreachable); code != http.StatusTooManyRequests {
+		t.Errorf("store error, past the burst: status %d, want 429", code)
+	}
+}
+
+func TestAdminAuth_NamesActorByCredential(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("LUMENLINK_ADMIN_TOKENS", "alice:alice-token, bob:bob-token,Not An Admin:x")
+	t.Setenv("LUMENLINK_ADMIN_TOKEN", "shared-token")
+	router := gin.New()
+	router.GET("/admin", adminAuth(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(api.ContextAdminActor))
+	})
+
+	tests := []struct {
+		token     string
+		wantCode  int
+		wantActor string
+	}{
+		{"alice-token", http.StatusOK, "alice"},
+		{"bob-token", http.StatusOK, "bob"},
+		{"shared-token", http.StatusOK, api.DefaultAdminActor},
+		{"x", http.StatusUnauthorized, ""},
+		{"", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		// The header no longer names the admin
+		req.Header.Set("X-Admin-Actor", "mallory")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.wantCode || (tt.wantCode == http.StatusOK && w.Body.String() != tt.wantActor) {
+			t.Errorf("token %q: got %d %q, want %d %q", tt.token, w.Code, w.Body.String(), tt.wantCode, tt.wantActor)
+		}
+	}
+}
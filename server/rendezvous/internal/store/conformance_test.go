@@ -0,0 +1,302 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// conformanceStart is the fake time every backend starts at
+var conformanceStart = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// backend is one implementation under the conformance suite. advance moves
+// its time forward; backends that leave expiry to a server also wait.
+type backend struct {
+	stores  Stores
+	advance func(d time.Duration)
+}
+
+func TestMemory(t *testing.T) {
+	runConformance(t, func(t *testing.T) backend {
+		fake := clock.NewFake(conformanceStart)
+		memory := NewMemory()
+		memory.SetClock(fake)
+		return backend{stores: memory.Stores(), advance: fake.Advance}
+	})
+}
+
+func TestRedis(t *testing.T) {
+	redisURL := os.Getenv("TEST_REDIS_URL")
+	if redisURL == "" {
+		t.Skip("TEST_REDIS_URL not set, skipping Redis store tests")
+	}
+	options, err := redis.ParseURL(redisURL)
+	if err != nil {
+		t.Fatalf("ParseURL: %v", err)
+	}
+	client := redis.NewClient(options)
+	defer client.Close()
+
+	runConformance(t, func(t *testing.T) backend {
+		fake := clock.NewFake(time.Now())
+		store := NewRedis(client)
+		store.SetClock(fake)
+		return backend{stores: store.Stores(), advance: func(d time.Duration) {
+			fake.Advance(d)
+			time.Sleep(d + 50*time.Millisecond)
+		}}
+	})
+}
+
+func TestPostgres(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL not set, skipping Postgres store tests")
+	}
+	if err := db.RunMigrations(databaseURL); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+	database, err := db.New(context.Background(), databaseURL)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer database.Close()
+
+	runConformance(t, func(t *testing.T) backend {
+		fake := clock.NewFake(conformanceStart)
+		store := NewPostgres(database)
+		store.SetClock(fake)
+		return backend{stores: store.Stores(), advance: fake.Advance}
+	})
+}
+
+// runConformance runs the shared suite against fresh instances of a backend.
+// Keys are unique per run so backends with shared state need no cleanup.
+func runConformance(t *testing.T, newBackend func(t *testing.T) backend) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	run := "conformance:" + hex.EncodeToString(b) + ":"
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, b backend, key string)
+	}{
+		{"challenge single use", testChallengeSingleUse},
+		{"challenge expiry", testChallengeExpiry},
+		{"challenge concurrent consume", testChallengeConcurrentConsume},
+		{"rate limit burst and refill", testRateLimit},
+		{"sticky assignment", testStickyAssignment},
+		{"reservation counting", testReservation},
+		{"reservation concurrent", testReservationConcurrent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newBackend(t), run+tt.name+":")
+		})
+	}
+}
+
+func testChallengeSingleUse(t *testing.T, b backend, key string) {
+	ctx := context.Background()
+	if err := b.stores.Challenges.PutChallenge(ctx, key+"c", time.Minute); err != nil {
+		t.Fatalf("PutChallenge: %v", err)
+	}
+	for i, want := range []bool{true, false} {
+		ok, err := b.stores.Challenges.ConsumeChallenge(ctx, key+"c")
+		if err != nil || ok != want {
+			t.Errorf("consume %d: got %v, %v; want %v", i, ok, err, want)
+		}
+	}
+	if ok, err := b.stores.Challenges.ConsumeChallenge(ctx, key+"unknown"); err != nil || ok {
+		t.Errorf("unknown challenge: got %v, %v", ok, err)
+	}
+}
+
+func testChallengeExpiry(t *testing.T, b backend, key string) {
+	ctx := context.Background()
+	if err := b.stores.Challenges.PutChallenge(ctx, key+"c", time.Second); err != nil {
+		t.Fatalf("PutChallenge: %v", err)
+	}
+	b.advance(time.Second)
+	if ok, err := b.stores.Challenges.ConsumeChallenge(ctx, key+"c"); err != nil || ok {
+		t.Errorf("expired challenge: got %v, %v", ok, err)
+	}
+}
+
+func testChallengeConcurrentConsume(t *testing.T, b backend, key string) {
+	ctx := context.Background()
+	if err := b.stores.Challenges.PutChallenge(ctx, key+"c", time.Minute); err != nil {
+		t.Fatalf("PutChallenge: %v", err)
+	}
+	const consumers = 16
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	consumed := 0
+	for i := 0; i < consumers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := b.stores.Challenges.ConsumeChallenge(ctx, key+"c")
+			if err != nil {
+				t.Errorf("ConsumeChallenge: %v", err)
+			}
+			if ok {
+				mu.Lock()
+				consumed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if consumed != 1 {
+		t.Errorf("consumed %d times, want once", consumed)
+	}
+}
+
+func testRateLimit(t *testing.T, b backend, key string) {
+	ctx := context.Background()
+	limit := Limit{PerMinute: 60, Burst: 3} // One per second
+	allow := func(key string) bool {
+		t.Helper()
+		ok, err := b.stores.RateLimits.Allow(ctx, key, limit)
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		return ok
+	}
+
+	for i := 0; i < 3; i++ {
+		if !allow(key + "a") {
+			t.Fatalf("request %d within the burst denied", i)
+		}
+	}
+	if allow(key + "a") {
+		t.Error("request past the burst allowed")
+	}
+	if !allow(key + "b") {
+		t.Error("other key limited")
+	}
+
+	b.advance(time.Second)
+	if !allow(key + "a") {
+		t.Error("request after one interval denied")
+	}
+	if allow(key + "a") {
+		t.Error("second request after one interval allowed")
+	}
+
+	b.advance(3 * time.Second)
+	for i := 0; i < 3; i++ {
+		if !allow(key + "a") {
+			t.Fatalf("request %d after the burst refilled denied", i)
+		}
+	}
+
+	// Rates slower than one a minute
+	limit = Limit{Burst: 2, Interval: 6 * time.Minute}
+	for i := 0; i < 2; i++ {
+		if !allow(key + "c") {
+			t.Fatalf("slow request %d within the burst denied", i)
+		}
+	}
+	if allow(key + "c") {
+		t.Error("slow request past the burst allowed")
+	}
+	b.advance(time.Minute)
+	if allow(key + "c") {
+		t.Error("slow request after a minute allowed")
+	}
+	b.advance(5 * time.Minute)
+	if !allow(key + "c") {
+		t.Error("slow request after one interval denied")
+	}
+}
+
+func testStickyAssignment(t *testing.T, b backend, key string) {
+	ctx := context.Background()
+	lookup := func(want string, wantOK bool) {
+		t.Helper()
+		value, ok, err := b.stores.Assignments.Lookup(ctx, key+"k", 2*time.Second)
+		if err != nil || ok != wantOK || value != want {
+			t.Errorf("Lookup: got %q, %v, %v; want %q, %v", value, ok, err, want, wantOK)
+		}
+	}
+
+	lookup("", false)
+	if err := b.stores.Assignments.Assign(ctx, key+"k", "eu-central-1", 2*time.Second); err != nil {
+		t.Fatalf("Assign: %v", err)
+	}
+	lookup("eu-central-1", true)
+
+	// Each lookup extends the expiry
+	b.advance(1500 * time.Millisecond)
+	lookup("eu-central-1", true)
+	b.advance(1500 * time.Millisecond)
+	lookup("eu-central-1", true)
+
+	if err := b.stores.Assignments.Assign(ctx, key+"k", "ap-east-1", 2*time.Second); err != nil {
+		t.Fatalf("Assign: %v", err)
+	}
+	lookup("ap-east-1", true)
+
+	b.advance(2 * time.Second)
+	lookup("", false)
+}
+
+func testReservation(t *testing.T, b backend, key string) {
+	ctx := context.Background()
+	reserve := func(key string, want int64) {
+		t.Helper()
+		n, err := b.stores.Reservations.Reserve(ctx, key, 2*time.Second)
+		if err != nil || n != want {
+			t.Errorf("Reserve(%s): got %d, %v; want %d", key, n, err, want)
+		}
+	}
+
+	for want := int64(1); want <= 3; want++ {
+		reserve(key+"a", want)
+	}
+	reserve(key+"b", 1)
+
+	b.advance(2 * time.Second)
+	reserve(key+"a", 1)
+}
+
+func testReservationConcurrent(t *testing.T, b backend, key string) {
+	ctx := context.Background()
+	const reservers = 16
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := map[int64]bool{}
+	for i := 0; i < reservers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := b.stores.Reservations.Reserve(ctx, key+"k", time.Minute)
+			if err != nil {
+				t.Errorf("Reserve: %v", err)
+				return
+			}
+			mu.Lock()
+			taken[n] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	for n := int64(1); n <= reservers; n++ {
+		if !taken[n] {
+			t.Errorf("reservation %d not handed out", n)
+		}
+	}
+}
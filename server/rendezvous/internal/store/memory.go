@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"rendezvous/internal/clock"
+)
+
+// sweepInterval is how often the memory store drops expired entries
+const sweepInterval = time.Minute
+
+// Memory keeps every store in process. It suits single-replica deployments
+// and tests; state is lost on restart.
+type Memory struct {
+	mu        sync.Mutex
+	clock     clock.Clock
+	nextSweep time.Time
+
+	challenges   map[string]time.Time // Challenge to expiry
+	rateLimits   map[string]time.Time // Key to theoretical arrival time
+	assignments  map[string]memoryAssignment
+	reservations map[string]memoryReservation
+}
+
+type memoryAssignment struct {
+	value   string
+	expires time.Time
+}
+
+type memoryReservation struct {
+	count   int64
+	expires time.Time
+}
+
+// NewMemory creates an empty in-process store
+func NewMemory() *Memory {
+	return &Memory{
+		clock:        clock.Real{},
+		challenges:   make(map[string]time.Time),
+		rateLimits:   make(map[string]time.Time),
+		assignments:  make(map[string]memoryAssignment),
+		reservations: make(map[string]memoryReservation),
+	}
+}
+
+// SetClock replaces the time source; it is intended for tests.
+func (m *Memory) SetClock(c clock.Clock) {
+	m.clock = c
+}
+
+// Stores returns m as every store
+func (m *Memory) Stores() Stores {
+	return bundle(m)
+}
+
+// now returns the current time and drops expired entries once per
+// sweepInterval. m.mu must be held.
+func (m *Memory) now() time.Time {
+	now := m.clock.Now()
+	if now.Before(m.nextSweep) {
+		return now
+	}
+	m.nextSweep = now.Add(sweepInterval)
+	for challenge, expires := range m.challenges {
+		if !now.Before(expires) {
+			delete(m.challenges, challenge)
+		}
+	}
+	for key, tat := range m.rateLimits {
+		if !now.Before(tat) {
+			delete(m.rateLimits, key)
+		}
+	}
+	for key, assignment := range m.assignments {
+		if !now.Before(assignment.expires) {
+			delete(m.assignments, key)
+		}
+	}
+	for key, reservation := range m.reservations {
+		if !now.Before(reservation.expires) {
+			delete(m.reservations, key)
+		}
+	}
+	return now
+}
+
+// PutChallenge implements ChallengeStore
+func (m *Memory) PutChallenge(_ context.Context, challenge string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.challenges[challenge] = m.now().Add(ttl)
+	return nil
+}
+
+// ConsumeChallenge implements ChallengeStore
+func (m *Memory) ConsumeChallenge(_ context.Context, challenge string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	expires, ok := m.challenges[challenge]
+	delete(m.challenges, challenge)
+	return ok && m.now().Before(expires), nil
+}
+
+// Allow implements RateLimitStore
+func (m *Memory) Allow(_ context.Context, key string, limit Limit) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	tat := m.rateLimits[key]
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(limit.interval())
+	if next.Sub(now) > limit.tolerance() {
+		return false, nil
+	}
+	m.rateLimits[key] = next
+	return true, nil
+}
+
+// Lookup implements StickyAssignmentStore
+func (m *Memory) Lookup(_ context.Context, key string, ttl time.Duration) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	assignment, ok := m.assignments[key]
+	if !ok || !now.Before(assignment.expires) {
+		delete(m.assignments, key)
+		return "", false, nil
+	}
+	assignment.expires = now.Add(ttl)
+	m.assignments[key] = assignment
+	return assignment.value, true, nil
+}
+
+// Assign implements StickyAssignmentStore
+func (m *Memory) Assign(_ context.Context, key, value string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.assignments[key] = memoryAssignment{value: value, expires: m.now().Add(ttl)}
+	return nil
+}
+
+// Reserve implements ReservationStore
+func (m *Memory) Reserve(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	reservation := m.reservations[key]
+	if !now.Before(reservation.expires) {
+		reservation.count = 0
+	}
+	reservation.count++
+	reservation.expires = now.Add(ttl)
+	m.reservations[key] = reservation
+	return reservation.count, nil
+}
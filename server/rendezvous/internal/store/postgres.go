@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+)
+
+// Postgres keeps every store in the ephemeral tables. It is shared between
+// replicas and survives restarts, at the cost of a database write per
+// challenge, rate-limited request, lookup and reservation.
+type Postgres struct {
+	db    *db.Database
+	clock clock.Clock
+}
+
+// NewPostgres creates a store on the database
+func NewPostgres(database *db.Database) *Postgres {
+	return &Postgres{db: database, clock: clock.Real{}}
+}
+
+// SetClock replaces the time source expiry is judged by; it is intended for
+// tests.
+func (p *Postgres) SetClock(c clock.Clock) {
+	p.clock = c
+}
+
+// Stores returns p as every store
+func (p *Postgres) Stores() Stores {
+	return bundle(p)
+}
+
+// PutChallenge implements ChallengeStore
+func (p *Postgres) PutChallenge(ctx context.Context, challenge string, ttl time.Duration) error {
+	return p.db.PutChallenge(ctx, challenge, p.clock.Now().Add(ttl))
+}
+
+// ConsumeChallenge implements ChallengeStore
+func (p *Postgres) ConsumeChallenge(ctx context.Context, challenge string) (bool, error) {
+	return p.db.ConsumeChallenge(ctx, challenge, p.clock.Now())
+}
+
+// Allow implements RateLimitStore
+func (p *Postgres) Allow(ctx context.Context, key string, limit Limit) (bool, error) {
+	return p.db.AllowRate(ctx, key, p.clock.Now(), limit.interval(), limit.tolerance())
+}
+
+// Lookup implements StickyAssignmentStore
+func (p *Postgres) Lookup(ctx context.Context, key string, ttl time.Duration) (string, bool, error) {
+	now := p.clock.Now()
+	return p.db.LookupAssignment(ctx, key, now, now.Add(ttl))
+}
+
+// Assign implements StickyAssignmentStore
+func (p *Postgres) Assign(ctx context.Context, key, value string, ttl time.Duration) error {
+	return p.db.Assign(ctx, key, value, p.clock.Now().Add(ttl))
+}
+
+// Reserve implements ReservationStore
+func (p *Postgres) Reserve(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	now := p.clock.Now()
+	return p.db.Reserve(ctx, key, now, now.Add(ttl))
+}
+
+// Start prunes expired rows every interval until ctx is cancelled.
+func (p *Postgres) Start(ctx context.Context, interval time.Duration) {
+	ticker := p.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if _, err := p.db.PruneEphemeral(ctx, p.clock.Now()); err != nil {
+				log.Printf("ephemeral store pruning failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"rendezvous/internal/clock"
+)
+
+// keyPrefix namespaces every key the Redis store writes. Callers namespace
+// their own keys below it, e.g. admission:seen:<device>.
+const keyPrefix = "lumenlink:"
+
+// Redis key namespaces of the single-purpose stores. Assignment and
+// reservation keys are namespaced by their callers.
+const (
+	challengeNamespace = "challenge:"
+	rateLimitNamespace = "ratelimit:"
+)
+
+// allowScript applies the generic cell rate algorithm atomically. KEYS[1]
+// holds the theoretical arrival time in milliseconds; ARGV is now, the
+// interval and the tolerance, all in milliseconds.
+var allowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+local next = tat + tonumber(ARGV[2])
+if next - now > tonumber(ARGV[3]) then
+	return 0
+end
+redis.call('SET', KEYS[1], next, 'PX', next - now)
+return 1
+`)
+
+// Redis shares every store between replicas through Redis
+type Redis struct {
+	client *redis.Client
+	clock  clock.Clock // Rate limit arrival times; expiry is left to Redis
+}
+
+// NewRedis creates a store using the given client
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client, clock: clock.Real{}}
+}
+
+// SetClock replaces the time source rate limits are computed with; it is
+// intended for tests.
+func (r *Redis) SetClock(c clock.Clock) {
+	r.clock = c
+}
+
+// Stores returns r as every store
+func (r *Redis) Stores() Stores {
+	return bundle(r)
+}
+
+// PutChallenge implements ChallengeStore
+func (r *Redis) PutChallenge(ctx context.Context, challenge string, ttl time.Duration) error {
+	if err := r.client.Set(ctx, keyPrefix+challengeNamespace+challenge, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store challenge: %w", err)
+	}
+	return nil
+}
+
+// ConsumeChallenge implements ChallengeStore
+func (r *Redis) ConsumeChallenge(ctx context.Context, challenge string) (bool, error) {
+	deleted, err := r.client.Del(ctx, keyPrefix+challengeNamespace+challenge).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to consume challenge: %w", err)
+	}
+	return deleted == 1, nil
+}
+
+// Allow implements RateLimitStore
+func (r *Redis) Allow(ctx context.Context, key string, limit Limit) (bool, error) {
+	allowed, err := allowScript.Run(
+		ctx,
+		r.client,
+		[]string{keyPrefix + rateLimitNamespace + key},
+		r.clock.Now().UnixMilli(),
+		limit.interval().Milliseconds(),
+		limit.tolerance().Milliseconds(),
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to apply rate limit: %w", err)
+	}
+	return allowed == 1, nil
+}
+
+// Lookup implements StickyAssignmentStore
+func (r *Redis) Lookup(ctx context.Context, key string, ttl time.Duration) (string, bool, error) {
+	value, err := r.client.GetEx(ctx, keyPrefix+key, ttl).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to look up assignment: %w", err)
+	}
+	return value, true, nil
+}
+
+// Assign implements StickyAssignmentStore
+func (r *Redis) Assign(ctx context.Context, key, value string, ttl time.Duration) error {
+	if err := r.client.Set(ctx, keyPrefix+key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store assignment: %w", err)
+	}
+	return nil
+}
+
+// Reserve implements ReservationStore
+func (r *Redis) Reserve(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, keyPrefix+key)
+		pipe.PExpire(ctx, keyPrefix+key, ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve: %w", err)
+	}
+	return incr.Val(), nil
+}
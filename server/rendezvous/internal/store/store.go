@@ -0,0 +1,147 @@
+// Package store defines the short-lived state the server keeps between
+// requests (attestation challenges, rate limits, sticky assignments and
+// reservations) behind narrow interfaces, with in-memory, Redis and Postgres
+// backends. Features take the interface they need, so a deployment picks one
+// backend for all of them in configuration.
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChallengeStore keeps single-use challenges until they are consumed or
+// expire.
+type ChallengeStore interface {
+	// PutChallenge stores challenge for ttl.
+	PutChallenge(ctx context.Context, challenge string, ttl time.Duration) error
+	// ConsumeChallenge removes challenge, reporting whether it was stored and
+	// unexpired. A challenge is consumed at most once across replicas.
+	ConsumeChallenge(ctx context.Context, challenge string) (bool, error)
+}
+
+// Limit is a request rate with a burst allowance; both must be positive
+type Limit struct {
+	PerMinute int
+	Burst     int
+
+	// Interval, when set, replaces PerMinute with one request per Interval,
+	// for rates slower than one a minute
+	Interval time.Duration
+}
+
+// interval is the time one request uses up
+func (l Limit) interval() time.Duration {
+	if l.Interval > 0 {
+		return l.Interval
+	}
+	return time.Minute / time.Duration(l.PerMinute)
+}
+
+// tolerance is how far ahead of now the allowed requests may have used up
+func (l Limit) tolerance() time.Duration {
+	return time.Duration(l.Burst) * l.interval()
+}
+
+// RateLimitStore applies a Limit per key. Every backend implements the same
+// generic cell rate algorithm: up to Burst requests are allowed at once, then
+// one per interval.
+type RateLimitStore interface {
+	// Allow counts a request on key and reports whether it is within limit.
+	Allow(ctx context.Context, key string, limit Limit) (bool, error)
+}
+
+// StickyAssignmentStore remembers a value assigned to a key while the key
+// keeps being looked up within the ttl.
+type StickyAssignmentStore interface {
+	// Lookup returns the value assigned to key and extends its expiry to
+	// ttl. ok is false when key is unassigned or expired.
+	Lookup(ctx context.Context, key string, ttl time.Duration) (value string, ok bool, err error)
+	// Assign sets the value assigned to key for ttl.
+	Assign(ctx context.Context, key, value string, ttl time.Duration) error
+}
+
+// ReservationStore hands out numbered reservations on a key, e.g. slots in a
+// per-minute quota.
+type ReservationStore interface {
+	// Reserve takes the next reservation on key and returns how many have
+	// been taken, counting from 1 again once key expired. Each reservation
+	// extends key's expiry to ttl.
+	Reserve(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
+
+// Stores bundles the stores of one backend
+type Stores struct {
+	Challenges   ChallengeStore
+	RateLimits   RateLimitStore
+	Assignments  StickyAssignmentStore
+	Reservations ReservationStore
+}
+
+// Backends
+const (
+	BackendMemory   = "memory"   // In process; single replica only
+	BackendRedis    = "redis"    // Shared by every replica
+	BackendPostgres = "postgres" // Shared and durable; costs a database write per use
+)
+
+// Config selects the store backend
+type Config struct {
+	Backend  string
+	Replicas int // Replicas the deployment runs; only used for startup warnings
+}
+
+// LoadConfigFromEnv reads LUMENLINK_STORE_BACKEND (default redis) and
+// LUMENLINK_REPLICAS (default 1).
+func LoadConfigFromEnv() (Config, error) {
+	config := Config{Backend: BackendRedis, Replicas: 1}
+	if backend := strings.ToLower(strings.TrimSpace(os.Getenv("LUMENLINK_STORE_BACKEND"))); backend != "" {
+		config.Backend = backend
+	}
+	switch config.Backend {
+	case BackendMemory, BackendRedis, BackendPostgres:
+	default:
+		return config, fmt.Errorf("invalid LUMENLINK_STORE_BACKEND %q: want memory, redis or postgres", config.Backend)
+	}
+	if value := strings.TrimSpace(os.Getenv("LUMENLINK_REPLICAS")); value != "" {
+		replicas, err := strconv.Atoi(value)
+		if err != nil || replicas < 1 {
+			return config, fmt.Errorf("invalid LUMENLINK_REPLICAS %q", value)
+		}
+		config.Replicas = replicas
+	}
+	return config, nil
+}
+
+// Warnings describes what the configured backend cannot do for this
+// deployment, for the startup log.
+func (c Config) Warnings() []string {
+	var warnings []string
+	switch c.Backend {
+	case BackendMemory:
+		if c.Replicas > 1 {
+			warnings = append(warnings, fmt.Sprintf(
+				"memory store with %d replicas: challenges only verify on the replica that issued them, rate limits and admission caps apply per replica; use redis or postgres",
+				c.Replicas,
+			))
+		}
+		warnings = append(warnings, "memory store: challenges, rate limits and admitted devices are lost on restart")
+	case BackendPostgres:
+		warnings = append(warnings, "postgres store: every rate-limited request writes to the database")
+	}
+	return warnings
+}
+
+// bundle returns one value implementing every store as Stores
+func bundle(s interface {
+	ChallengeStore
+	RateLimitStore
+	StickyAssignmentStore
+	ReservationStore
+}) Stores {
+	return Stores{Challenges: s, RateLimits: s, Assignments: s, Reservations: s}
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		backend  string
+		replicas string
+		want     Config
+		wantErr  bool
+	}{
+		{"defaults", "", "", Config{Backend: BackendRedis, Replicas: 1}, false},
+		{"memory", "Memory", "", Config{Backend: BackendMemory, Replicas: 1}, false},
+		{"postgres with replicas", "postgres", "3", Config{Backend: BackendPostgres, Replicas: 3}, false},
+		{"unknown backend", "etcd", "", Config{}, true},
+		{"invalid replicas", "memory", "0", Config{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LUMENLINK_STORE_BACKEND", tt.backend)
+			t.Setenv("LUMENLINK_REPLICAS", tt.replicas)
+			got, err := LoadConfigFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigWarnings(t *testing.T) {
+	if warnings := (Config{Backend: BackendRedis, Replicas: 4}).Warnings(); len(warnings) != 0 {
+		t.Errorf("redis: got %v", warnings)
+	}
+	single := Config{Backend: BackendMemory, Replicas: 1}.Warnings()
+	for _, warning := range single {
+		if strings.Contains(warning, "replicas") {
+			t.Errorf("single replica warned about replicas: %q", warning)
+		}
+	}
+	multi := Config{Backend: BackendMemory, Replicas: 3}.Warnings()
+	if len(multi) == 0 || !strings.Contains(multi[0], "3 replicas") {
+		t.Errorf("memory with replicas: got %v", multi)
+	}
+}
@@ -0,0 +1,161 @@
+// Package trust implements progressive device trust. A device that passes
+// attestation still starts in the limited tier; it is promoted to trusted
+// only after a probation period of sustained valid attestations and
+// successful connections, and anomalies send it back to the start.
+package trust
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+// Reasons for tier transitions
+const (
+	ReasonProbationCompleted = "probation_completed" // Promotion
+	ReasonAttestationRevoked = "attestation_revoked" // The device failed attestation
+	ReasonHoneypotContact    = "honeypot_contact"    // The device reported contacting a honeypot
+)
+
+// Audit log actions for tier transitions, recorded with auditActor
+const (
+	AuditDevicePromote = "device.promote"
+	AuditDeviceDemote  = "device.demote"
+	auditActor         = "trust"
+)
+
+// Policy sets what a device must show before it is trusted
+type Policy struct {
+	Probation       time.Duration // Minimum time in the limited tier
+	MinAttestations int           // Valid attestations during probation
+	MinConnections  int           // Successful connections during probation
+}
+
+// LoadPolicyFromEnv reads LUMENLINK_TRUST_PROBATION_DAYS (default 7),
+// LUMENLINK_TRUST_MIN_ATTESTATIONS (default 5) and
+// LUMENLINK_TRUST_MIN_CONNECTIONS (default 3).
+func LoadPolicyFromEnv() Policy {
+	return Policy{
+		Probation:       time.Duration(envInt("LUMENLINK_TRUST_PROBATION_DAYS", 7)) * 24 * time.Hour,
+		MinAttestations: envInt("LUMENLINK_TRUST_MIN_ATTESTATIONS", 5),
+		MinConnections:  envInt("LUMENLINK_TRUST_MIN_CONNECTIONS", 3),
+	}
+}
+
+// Eligible reports whether a limited device has completed its probation at now
+func (p Policy) Eligible(state *db.DeviceTrust, now time.Time) bool {
+	return now.Sub(state.ProbationStartedAt) >= p.Probation &&
+		state.ValidAttestations >= p.MinAttestations &&
+		state.SuccessfulConnections >= p.MinConnections
+}
+
+// Tracker keeps each device's tier from the signals it reports
+type Tracker struct {
+	db     *db.Database
+	policy Policy
+	clock  clock.Clock
+}
+
+// NewTracker creates a tracker storing device state in database
+func NewTracker(database *db.Database, policy Policy) *Tracker {
+	return &Tracker{db: database, policy: policy, clock: clock.Real{}}
+}
+
+// SetClock replaces the time source probation is judged by; it is intended
+// for tests.
+func (t *Tracker) SetClock(c clock.Clock) {
+	t.clock = c
+}
+
+// ObserveAttestation records an attestation result for a device and returns
+// its tier. A valid attestation counts towards promotion; a failed one is
+// an anomaly.
+func (t *Tracker) ObserveAttestation(ctx context.Context, deviceID string, valid bool) (string, error) {
+	if !valid {
+		return db.DeviceTierLimited, t.Demote(ctx, deviceID, ReasonAttestationRevoked)
+	}
+	state, err := t.db.RecordDeviceAttestation(ctx, deviceID)
+	if err != nil {
+		return db.DeviceTierLimited, err
+	}
+	return t.promoteIfEligible(ctx, state)
+}
+
+// Tier returns a device's tier without recording anything. A device with no
+// state is limited.
+func (t *Tracker) Tier(ctx context.Context, deviceID string) (string, error) {
+	state, err := t.db.GetDeviceTrust(ctx, deviceID)
+	if errors.Is(err, db.ErrDeviceNotFound) {
+		return db.DeviceTierLimited, nil
+	}
+	if err != nil {
+		return db.DeviceTierLimited, err
+	}
+	return state.Tier, nil
+}
+
+// ObserveConnection records a successful gateway connection for a device
+func (t *Tracker) ObserveConnection(ctx context.Context, deviceID string) error {
+	state, err := t.db.RecordDeviceConnection(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	_, err = t.promoteIfEligible(ctx, state)
+	return err
+}
+
+// Demote returns a device to the limited tier and restarts its probation
+func (t *Tracker) Demote(ctx context.Context, deviceID, reason string) error {
+	demoted, err := t.db.DemoteDevice(ctx, deviceID, reason)
+	if err != nil {
+		return err
+	}
+	if demoted {
+		metrics.DeviceTrustTransitions.WithLabelValues("demoted", reason).Inc()
+		t.audit(ctx, AuditDeviceDemote, deviceID, reason)
+	}
+	return nil
+}
+
+// promoteIfEligible promotes a limited device that has completed probation
+// and returns its tier
+func (t *Tracker) promoteIfEligible(ctx context.Context, state *db.DeviceTrust) (string, error) {
+	if state.Tier != db.DeviceTierLimited || !t.policy.Eligible(state, t.clock.Now()) {
+		return state.Tier, nil
+	}
+	promoted, err := t.db.PromoteDevice(ctx, state.DeviceID)
+	if err != nil {
+		return db.DeviceTierLimited, err
+	}
+	if promoted {
+		metrics.DeviceTrustTransitions.WithLabelValues("promoted", ReasonProbationCompleted).Inc()
+		t.audit(ctx, AuditDevicePromote, state.DeviceID, ReasonProbationCompleted)
+	}
+	return db.DeviceTierTrusted, nil
+}
+
+// audit records a tier transition. The transition has already committed, so
+// a failed append is logged and counted like a failed admin action record.
+func (t *Tracker) audit(ctx context.Context, action, deviceID, reason string) {
+	if _, err := t.db.AppendAuditEntry(ctx, auditActor, action, "device", deviceID, map[string]interface{}{"reason": reason}); err != nil {
+		metrics.AuditAppendFailures.Inc()
+		log.Printf("audit log append failed for %s device/%s: %v", action, deviceID, err)
+	}
+}
+
+func envInt(key string, defaultValue int) int {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,180 @@
+package trust
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"rendezvous/internal/clock"
+	"rendezvous/internal/db"
+	"rendezvous/internal/metrics"
+)
+
+const testDeviceID = "device-7f3a"
+
+var testPolicy = Policy{Probation: 7 * 24 * time.Hour, MinAttestations: 5, MinConnections: 3}
+
+func newTestTracker(t *testing.T, now time.Time) (*Tracker, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	tracker := NewTracker(db.NewFromPool(sqlDB), testPolicy)
+	tracker.clock = clock.NewFake(now)
+	return tracker, mock
+}
+
+// trustRows is a device's state as RETURNING or SELECT reads it
+func trustRows(tier string, probationStarted time.Time, attestations, connections int) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"device_id", "tier", "first_seen_at", "probation_started_at", "valid_attestations",
+		"successful_connections", "tier_changed_at", "last_anomaly", "last_anomaly_at",
+	}).AddRow(testDeviceID, tier, probationStarted, probationStarted, attestations, connections, nil, nil, nil)
+}
+
+func TestPolicy_Eligible(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		age          time.Duration
+		attestations int
+		connections  int
+		want         bool
+	}{
+		{"new device with every signal", time.Hour, 50, 50, false},
+		{"probation over", 7 * 24 * time.Hour, 5, 3, true},
+		{"too few attestations", 30 * 24 * time.Hour, 4, 3, false},
+		{"no connections", 30 * 24 * time.Hour, 5, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &db.DeviceTrust{ProbationStartedAt: start, ValidAttestations: tt.attestations, SuccessfulConnections: tt.connections}
+			if got := testPolicy.Eligible(state, start.Add(tt.age)); got != tt.want {
+				t.Errorf("Eligible() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObserveAttestation_PromotionTimeline(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	promotions := metrics.DeviceTrustTransitions.WithLabelValues("promoted", ReasonProbationCompleted)
+
+	// Day 2: strong signals, but still within probation
+	tracker, mock := newTestTracker(t, start.Add(2*24*time.Hour))
+	mock.ExpectQuery(`INSERT INTO device_trust`).WithArgs(testDeviceID).
+		WillReturnRows(trustRows(db.DeviceTierLimited, start, 6, 4))
+	tier, err := tracker.ObserveAttestation(context.Background(), testDeviceID, true)
+	if err != nil || tier != db.DeviceTierLimited {
+		t.Fatalf("day 2: got %q, %v; want limited", tier, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// Day 8: probation over, promoted once and audited
+	before := testutil.ToFloat64(promotions)
+	tracker, mock = newTestTracker(t, start.Add(8*24*time.Hour))
+	mock.ExpectQuery(`INSERT INTO device_trust`).WithArgs(testDeviceID).
+		WillReturnRows(trustRows(db.DeviceTierLimited, start, 6, 4))
+	mock.ExpectExec(`UPDATE device_trust SET tier = 'trusted'`).WithArgs(testDeviceID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin().WillReturnError(context.Canceled) // audit append; logged and counted
+	tier, err = tracker.ObserveAttestation(context.Background(), testDeviceID, true)
+	if err != nil || tier != db.DeviceTierTrusted {
+		t.Fatalf("day 8: got %q, %v; want trusted", tier, err)
+	}
+	if got := testutil.ToFloat64(promotions) - before; got != 1 {
+		t.Errorf("promotions counted: %v, want 1", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// Later attestations keep the tier without another promotion
+	tracker, mock = newTestTracker(t, start.Add(9*24*time.Hour))
+	mock.ExpectQuery(`INSERT INTO device_trust`).WithArgs(testDeviceID).
+		WillReturnRows(trustRows(db.DeviceTierTrusted, start, 7, 4))
+	if tier, err = tracker.ObserveAttestation(context.Background(), testDeviceID, true); err != nil || tier != db.DeviceTierTrusted {
+		t.Fatalf("day 9: got %q, %v; want trusted", tier, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestObserveConnection_CompletesProbation(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	tracker, mock := newTestTracker(t, start.Add(10*24*time.Hour))
+	mock.ExpectQuery(`INSERT INTO device_trust`).WithArgs(testDeviceID).
+		WillReturnRows(trustRows(db.DeviceTierLimited, start, 5, 3))
+	mock.ExpectExec(`UPDATE device_trust SET tier = 'trusted'`).WithArgs(testDeviceID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin().WillReturnError(context.Canceled) // audit append; logged and counted
+
+	if err := tracker.ObserveConnection(context.Background(), testDeviceID); err != nil {
+		t.Fatalf("ObserveConnection: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDemotionTriggers(t *testing.T) {
+	tests := []struct {
+		reason  string
+		trigger func(tracker *Tracker) error
+	}{
+		{ReasonAttestationRevoked, func(tracker *Tracker) error {
+			tier, err := tracker.ObserveAttestation(context.Background(), testDeviceID, false)
+			if tier != db.DeviceTierLimited {
+				t.Errorf("tier after a failed attestation: %q, want limited", tier)
+			}
+			return err
+		}},
+		{ReasonHoneypotContact, func(tracker *Tracker) error {
+			return tracker.Demote(context.Background(), testDeviceID, ReasonHoneypotContact)
+		}},
+	}
+	for _, tt := range tests {
+		for _, wasTrusted := range []bool{true, false} {
+			tier := db.DeviceTierLimited
+			if wasTrusted {
+				tier = db.DeviceTierTrusted
+			}
+			t.Run(tt.reason+"/"+tier, func(t *testing.T) {
+				demotions := metrics.DeviceTrustTransitions.WithLabelValues("demoted", tt.reason)
+				before := testutil.ToFloat64(demotions)
+
+				tracker, mock := newTestTracker(t, time.Now())
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT tier FROM device_trust`).WithArgs(testDeviceID).
+					WillReturnRows(sqlmock.NewRows([]string{"tier"}).AddRow(tier))
+				mock.ExpectExec(`INSERT INTO device_trust`).WithArgs(testDeviceID, tt.reason, wasTrusted).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				if wasTrusted {
+					mock.ExpectBegin().WillReturnError(context.Canceled) // audit append; logged and counted
+				}
+
+				if err := tt.trigger(tracker); err != nil {
+					t.Fatalf("trigger: %v", err)
+				}
+				want := 0.0
+				if wasTrusted {
+					want = 1
+				}
+				if got := testutil.ToFloat64(demotions) - before; got != want {
+					t.Errorf("demotions counted: %v, want %v", got, want)
+				}
+				if err := mock.ExpectationsWereMet(); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
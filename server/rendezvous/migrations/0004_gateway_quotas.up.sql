@@ -0,0 +1,40 @@
+-- LumenLink Gateway Registration Quotas
+-- Migration: 0004_gateway_quotas.up.sql
+-- Description: Tracks gateway operators and approval state, and adds an admin review queue
+
+-- Operator account that registered the gateway (NULL for gateways we run ourselves)
+ALTER TABLE gateways
+ADD COLUMN operator_id VARCHAR(255);
+
+-- Gateways registered above quota wait for admin approval before being served
+ALTER TABLE gateways
+ADD COLUMN approval_status VARCHAR(20) NOT NULL DEFAULT 'approved'
+    CHECK (approval_status IN ('approved', 'pending', 'rejected'));
+
+-- Autonomous system number, when known, used by the cluster audit
+ALTER TABLE gateways
+ADD COLUMN asn INTEGER CHECK (asn > 0);
+
+CREATE INDEX idx_gateways_operator ON gateways(operator_id) WHERE operator_id IS NOT NULL;
+CREATE INDEX idx_gateways_approval_status ON gateways(approval_status);
+
+-- Review Queue table
+-- Items flagged for admin review (quota overruns, suspicious gateway clusters)
+CREATE TABLE review_queue (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    subject_type VARCHAR(50) NOT NULL,
+    subject_id VARCHAR(255) NOT NULL,
+    reason VARCHAR(100) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    resolved_at TIMESTAMPTZ,
+    resolved_by VARCHAR(255)
+);
+
+-- Only one open item per subject and reason so periodic audits don't pile up duplicates
+CREATE UNIQUE INDEX idx_review_queue_open_subject
+ON review_queue(subject_type, subject_id, reason)
+WHERE status = 'open';
+
+CREATE INDEX idx_review_queue_status_created ON review_queue(status, created_at DESC);
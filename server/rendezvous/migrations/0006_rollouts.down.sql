@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_rollouts_updated_at ON rollouts;
+DROP TABLE IF EXISTS rollouts;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_discovery_logs_honeypot_created;
+ALTER TABLE discovery_logs DROP COLUMN IF EXISTS is_honeypot;
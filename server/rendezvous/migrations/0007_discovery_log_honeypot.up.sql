@@ -0,0 +1,19 @@
+-- LumenLink Honeypot Discovery Logs
+-- Migration: 0007_discovery_log_honeypot.up.sql
+-- Description: Tags discovery logs that target honeypot gateways so they can be
+-- kept out of public success-rate stats and reviewed as adversarial activity
+
+ALTER TABLE discovery_logs
+ADD COLUMN is_honeypot BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Backfill logs recorded before the flag existed
+UPDATE discovery_logs dl
+SET is_honeypot = TRUE
+FROM gateways g
+WHERE dl.gateway_id = g.id AND g.is_honeypot = TRUE;
+
+CREATE INDEX idx_discovery_logs_honeypot_created
+ON discovery_logs (created_at DESC, gateway_id)
+WHERE is_honeypot = TRUE;
+
+COMMENT ON COLUMN discovery_logs.is_honeypot IS 'Set at insert when gateway_id refers to a honeypot gateway';
@@ -0,0 +1,22 @@
+-- LumenLink Gateway Country Distribution
+-- Migration: 0009_gateway_country_rollups.up.sql
+-- Description: Records the client country with each discovery log and rolls up
+-- distinct clients per gateway, day and country for operator metrics
+
+-- ISO 3166-1 alpha-2 code from CF-IPCountry; NULL when unknown or anonymized
+ALTER TABLE discovery_logs ADD COLUMN country CHAR(2);
+
+-- Rebuilt one day at a time by the daily rollup job. clients holds raw counts
+-- and must only be exposed through the k-anonymity suppression rule.
+CREATE TABLE gateway_country_rollups (
+    gateway_id UUID NOT NULL REFERENCES gateways(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    country CHAR(2) NOT NULL,
+    clients INTEGER NOT NULL CHECK (clients > 0),
+    PRIMARY KEY (gateway_id, day, country)
+);
+
+CREATE INDEX idx_gateway_country_rollups_day ON gateway_country_rollups (day);
+
+COMMENT ON COLUMN discovery_logs.country IS 'Client country (ISO 3166-1 alpha-2) from CF-IPCountry';
+COMMENT ON COLUMN gateway_country_rollups.clients IS 'Distinct client IPs with a successful discovery that day';
@@ -0,0 +1,4 @@
+-- Migration: 0010_admin_audit_log.down.sql
+
+DROP TABLE IF EXISTS admin_audit_log;
+DROP FUNCTION IF EXISTS admin_audit_log_append_only();
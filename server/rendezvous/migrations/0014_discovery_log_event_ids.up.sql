@@ -0,0 +1,14 @@
+-- LumenLink Discovery Log Event IDs
+-- Migration: 0014_discovery_log_event_ids.up.sql
+-- Description: Claims client-generated discovery log event IDs so retried
+-- posts are acknowledged without being stored or counted twice
+
+-- Claims older than the dedupe window are pruned on insert, after which the
+-- same ID is accepted again.
+CREATE TABLE discovery_log_events (
+    event_id UUID PRIMARY KEY,
+    received_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX idx_discovery_log_events_received
+ON discovery_log_events (received_at);
@@ -0,0 +1,21 @@
+-- LumenLink Rollout Schedules
+-- Migration: 0015_rollout_schedules.up.sql
+-- Description: Optional ramp schedules for rollouts. A scheduled rollout's
+-- effective percentage is computed from the wall clock at read time; aborting
+-- it stores the value reached in percentage and sets aborted_at.
+
+ALTER TABLE rollouts
+    ADD COLUMN schedule_start_at TIMESTAMPTZ,
+    ADD COLUMN schedule_end_at TIMESTAMPTZ,
+    ADD COLUMN schedule_start_percentage INTEGER
+        CHECK (schedule_start_percentage >= 0 AND schedule_start_percentage <= 100),
+    ADD COLUMN schedule_end_percentage INTEGER
+        CHECK (schedule_end_percentage >= 0 AND schedule_end_percentage <= 100),
+    ADD COLUMN schedule_easing VARCHAR(20),
+    ADD COLUMN aborted_at TIMESTAMPTZ,
+    ADD CONSTRAINT rollouts_schedule_complete CHECK (
+        (schedule_start_at IS NULL AND schedule_end_at IS NULL AND schedule_start_percentage IS NULL
+            AND schedule_end_percentage IS NULL AND schedule_easing IS NULL)
+        OR (schedule_end_at > schedule_start_at AND schedule_start_percentage IS NOT NULL
+            AND schedule_end_percentage IS NOT NULL AND schedule_easing IS NOT NULL)
+    );
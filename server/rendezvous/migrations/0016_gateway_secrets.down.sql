@@ -0,0 +1,3 @@
+-- Migration: 0016_gateway_secrets.down.sql
+
+DROP TABLE IF EXISTS gateway_secrets;
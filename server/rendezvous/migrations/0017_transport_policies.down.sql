@@ -0,0 +1,3 @@
+-- Migration: 0017_transport_policies.down.sql
+
+DROP TABLE IF EXISTS transport_policies;
@@ -0,0 +1,13 @@
+-- LumenLink Transport Policies
+-- Migration: 0017_transport_policies.up.sql
+-- Description: Per-country overrides of the transports advertised in packs,
+-- for transports that are fingerprinted in some countries but not others
+
+CREATE TABLE transport_policies (
+    country CHAR(2) NOT NULL, -- ISO 3166-1 alpha-2, as in CF-IPCountry
+    transport VARCHAR(20) NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('allow', 'deny', 'prefer')),
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    PRIMARY KEY (country, transport)
+);
@@ -0,0 +1,3 @@
+-- Migration: 0020_device_trust.down.sql
+
+DROP TABLE IF EXISTS device_trust;
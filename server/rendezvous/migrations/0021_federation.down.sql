@@ -0,0 +1,4 @@
+-- Migration: 0021_federation.down.sql
+
+DROP TABLE IF EXISTS federated_gateways;
+DROP TABLE IF EXISTS federation_peers;
@@ -0,0 +1,34 @@
+-- LumenLink Federation
+-- Migration: 0021_federation.up.sql
+-- Description: Peer rendezvous deployments whose signed gateway
+-- announcements we import, and the gateways imported from them
+
+CREATE TABLE federation_peers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL UNIQUE,
+    announcement_url TEXT NOT NULL,
+    public_key BYTEA NOT NULL, -- Pinned Ed25519 key the announcements must verify against
+    enabled BOOLEAN DEFAULT TRUE NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    last_polled_at TIMESTAMPTZ,
+    last_announced_at TIMESTAMPTZ, -- Timestamp of the last imported announcement
+    last_error TEXT
+);
+
+CREATE TABLE federated_gateways (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), -- The ID clients see; peers' IDs may collide with ours
+    peer_id UUID NOT NULL REFERENCES federation_peers(id) ON DELETE CASCADE,
+    peer_gateway_id VARCHAR(255) NOT NULL,
+    public_key BYTEA NOT NULL,
+    ip_address INET NOT NULL,
+    port INTEGER NOT NULL CHECK (port > 0 AND port <= 65535),
+    transport_types TEXT[] NOT NULL,
+    region VARCHAR(10) NOT NULL,
+    load REAL DEFAULT 0.5 NOT NULL,
+    imported_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    UNIQUE (peer_id, peer_gateway_id)
+);
+
+CREATE INDEX idx_federated_gateways_region ON federated_gateways(region);
@@ -0,0 +1,4 @@
+-- Migration: 0022_gateway_user_reconciliation.down.sql
+
+DROP TABLE IF EXISTS gateway_user_reconciliation;
+DROP TABLE IF EXISTS gateway_issuance_counts;
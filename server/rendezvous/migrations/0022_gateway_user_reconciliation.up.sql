@@ -0,0 +1,31 @@
+-- LumenLink Gateway User Count Reconciliation
+-- Migration: 0022_gateway_user_reconciliation.up.sql
+-- Description: Hourly counts of config packs that listed each gateway, and
+-- the reconciliation of each gateway's reported users_connected against them
+-- and against connections confirmed by clients
+
+CREATE TABLE gateway_issuance_counts (
+    gateway_id UUID NOT NULL REFERENCES gateways(id) ON DELETE CASCADE,
+    hour TIMESTAMPTZ NOT NULL,
+    packs BIGINT DEFAULT 0 NOT NULL CHECK (packs >= 0),
+    PRIMARY KEY (gateway_id, hour)
+);
+
+CREATE INDEX idx_gateway_issuance_counts_hour ON gateway_issuance_counts (hour);
+
+CREATE TABLE gateway_user_reconciliation (
+    gateway_id UUID PRIMARY KEY REFERENCES gateways(id) ON DELETE CASCADE,
+    plausibility DOUBLE PRECISION NOT NULL CHECK (plausibility >= 0 AND plausibility <= 1),
+    plausible_users INTEGER NOT NULL CHECK (plausible_users >= 0),
+    hours INTEGER NOT NULL,
+    exceeded_hours INTEGER NOT NULL,
+    flagged BOOLEAN NOT NULL DEFAULT FALSE,
+    computed_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX idx_gateway_user_reconciliation_flagged
+ON gateway_user_reconciliation (gateway_id)
+WHERE flagged = TRUE;
+
+COMMENT ON COLUMN gateway_user_reconciliation.plausibility IS 'Share of reported users the independent signals account for, 0-1';
+COMMENT ON COLUMN gateway_user_reconciliation.plausible_users IS 'Community page cap on users_connected while flagged';
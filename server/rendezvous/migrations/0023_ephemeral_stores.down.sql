@@ -0,0 +1,6 @@
+-- Migration: 0023_ephemeral_stores.down.sql
+
+DROP TABLE IF EXISTS ephemeral_reservations;
+DROP TABLE IF EXISTS ephemeral_assignments;
+DROP TABLE IF EXISTS ephemeral_rate_limits;
+DROP TABLE IF EXISTS ephemeral_challenges;
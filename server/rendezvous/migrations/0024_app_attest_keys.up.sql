@@ -0,0 +1,17 @@
+-- LumenLink App Attest Keys
+-- Migration: 0024_app_attest_keys.up.sql
+-- Description: Public keys from verified iOS App Attest attestations, so a
+-- device's later requests can be checked with a cheap assertion instead of a
+-- full attestation. A key ID belongs to the device that attested it.
+
+CREATE TABLE app_attest_keys (
+    key_id TEXT PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL,
+    public_key BYTEA NOT NULL, -- Uncompressed P-256 point from the credential certificate
+    receipt BYTEA, -- For Apple's fraud metric
+    counter BIGINT DEFAULT 0 NOT NULL, -- Highest assertion counter accepted
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_app_attest_keys_device ON app_attest_keys (device_id);
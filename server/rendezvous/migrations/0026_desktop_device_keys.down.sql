@@ -0,0 +1,3 @@
+-- Migration: 0026_desktop_device_keys.down.sql
+
+DROP TABLE IF EXISTS desktop_device_keys;
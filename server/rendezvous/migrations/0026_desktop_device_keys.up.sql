@@ -0,0 +1,11 @@
+-- LumenLink Desktop Device Keys
+-- Migration: 0026_desktop_device_keys.up.sql
+-- Description: Ed25519 keys desktop clients enroll at install time. A
+-- desktop attestation is a signature over an issued challenge by the
+-- device's enrolled key.
+
+CREATE TABLE desktop_device_keys (
+    device_id VARCHAR(255) PRIMARY KEY,
+    public_key BYTEA NOT NULL CHECK (octet_length(public_key) = 32),
+    enrolled_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
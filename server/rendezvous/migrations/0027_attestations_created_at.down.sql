@@ -0,0 +1,3 @@
+-- Migration: 0027_attestations_created_at.down.sql
+
+DROP INDEX IF EXISTS idx_attestations_created_at;
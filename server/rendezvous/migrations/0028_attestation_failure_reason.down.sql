@@ -0,0 +1,3 @@
+-- Migration: 0028_attestation_failure_reason.down.sql
+
+ALTER TABLE attestations DROP COLUMN IF EXISTS failure_reason;
@@ -0,0 +1,5 @@
+-- Migration: 0032_attestation_client_origin.down.sql
+
+DROP INDEX IF EXISTS idx_attestations_client_region_failed;
+ALTER TABLE attestations DROP COLUMN IF EXISTS client_region;
+ALTER TABLE attestations DROP COLUMN IF EXISTS client_ip;
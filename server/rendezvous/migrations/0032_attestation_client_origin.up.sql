@@ -0,0 +1,12 @@
+-- LumenLink Attestation Client Origin
+-- Migration: 0032_attestation_client_origin.up.sql
+-- Description: The client address each attestation came from, hashed when
+-- LUMENLINK_ATTESTATION_ANONYMIZE_IP is set, and the region its country
+-- maps to, so that failures can be correlated with geography when
+-- investigating probing.
+
+ALTER TABLE attestations ADD COLUMN IF NOT EXISTS client_ip TEXT;
+ALTER TABLE attestations ADD COLUMN IF NOT EXISTS client_region VARCHAR(50);
+
+CREATE INDEX IF NOT EXISTS idx_attestations_client_region_failed
+    ON attestations (client_region, created_at) WHERE NOT verified;
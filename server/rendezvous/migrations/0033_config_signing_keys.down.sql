@@ -0,0 +1,3 @@
+-- Migration: 0033_config_signing_keys.down.sql
+
+DROP TABLE IF EXISTS config_signing_keys;
@@ -0,0 +1,3 @@
+-- Migration: 0034_transports.down.sql
+
+DROP TABLE IF EXISTS transports;
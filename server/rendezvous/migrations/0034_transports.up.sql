@@ -0,0 +1,20 @@
+-- LumenLink Transports
+-- Migration: 0034_transports.up.sql
+-- Description: Transport configurations advertised in packs, global or per
+-- region, so endpoints and fingerprints can change without a deploy
+
+CREATE TABLE transports (
+    id SERIAL PRIMARY KEY,
+    type VARCHAR(20) NOT NULL,
+    endpoints TEXT[] NOT NULL DEFAULT '{}',
+    fingerprint VARCHAR(100) NOT NULL DEFAULT '',
+    options JSONB NOT NULL DEFAULT '{}',
+    region VARCHAR(50), -- NULL for every region
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    priority INTEGER NOT NULL DEFAULT 0, -- Higher first in packs
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+-- One row per transport globally and per region
+CREATE UNIQUE INDEX idx_transports_type_region ON transports (type, COALESCE(region, ''));
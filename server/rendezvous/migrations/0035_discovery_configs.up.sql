@@ -0,0 +1,16 @@
+-- LumenLink Discovery Configs
+-- Migration: 0035_discovery_configs.up.sql
+-- Description: Discovery settings sent in packs, per region with a global
+-- default, since broadcast channels and scan intervals vary by region
+
+CREATE TABLE discovery_configs (
+    region VARCHAR(50) PRIMARY KEY, -- 'default' for regions without a row
+    channels TEXT[] NOT NULL,
+    scan_interval INTEGER NOT NULL CHECK (scan_interval > 0), -- Seconds
+    battery_aware BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+INSERT INTO discovery_configs (region, channels, scan_interval, battery_aware)
+VALUES ('default', ARRAY['gps', 'fm_rds', 'dtv', 'plc', 'gsm_cb', 'lte_sib', 'blockchain'], 300, true);
@@ -0,0 +1,4 @@
+-- Migration: 0036_signing_key_endorsements.down.sql
+
+ALTER TABLE config_signing_keys DROP COLUMN IF EXISTS endorsement;
+ALTER TABLE config_signing_keys DROP COLUMN IF EXISTS previous_key_id;
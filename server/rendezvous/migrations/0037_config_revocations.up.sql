@@ -0,0 +1,23 @@
+-- LumenLink Config Revocations
+-- Migration: 0037_config_revocations.up.sql
+-- Description: Packs and signing keys clients must no longer trust, e.g.
+-- after a key leak or the compromise of gateways a pack listed.
+
+-- Each revocation's id is the generation of the revocation list it first
+-- appears in; the list's generation is the highest id, so it only grows.
+-- value is a pack's content hash (hex SHA-256) or a signing key ID.
+CREATE TABLE config_revocations (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('pack', 'key')),
+    value VARCHAR(64) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    revoked_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    UNIQUE (kind, value)
+);
+
+-- Persisted packs are marked when their hash or signing key is revoked
+ALTER TABLE config_packs
+    ADD COLUMN content_hash VARCHAR(64),
+    ADD COLUMN revoked_at TIMESTAMPTZ;
+
+CREATE INDEX idx_config_packs_content_hash ON config_packs(content_hash) WHERE content_hash IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Migration: 0038_endpoint_allocations.down.sql
+
+DROP TABLE IF EXISTS endpoint_allocations;
+ALTER TABLE transports DROP COLUMN IF EXISTS endpoints_per_client;
+ALTER TABLE transports DROP COLUMN IF EXISTS endpoint_pool;
@@ -0,0 +1,21 @@
+-- LumenLink Endpoint Allocations
+-- Migration: 0038_endpoint_allocations.up.sql
+-- Description: Per-client fronting endpoints. A transport may hold a pool of
+-- SNI/host candidates, of which each device is given a small slice per
+-- epoch, so blocking one device's endpoints does not burn the whole pool.
+
+ALTER TABLE transports
+    ADD COLUMN endpoint_pool TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN endpoints_per_client INTEGER NOT NULL DEFAULT 2 CHECK (endpoints_per_client > 0);
+
+-- How often each pool endpoint was allocated, and reported unusable, per
+-- epoch. Counts only; no device is recorded.
+CREATE TABLE endpoint_allocations (
+    epoch BIGINT NOT NULL,
+    transport_type VARCHAR(20) NOT NULL,
+    endpoint TEXT NOT NULL,
+    packs BIGINT NOT NULL DEFAULT 0, -- Packs the endpoint was allocated in
+    failures BIGINT NOT NULL DEFAULT 0, -- transport_unusable reports naming it
+    first_allocated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    PRIMARY KEY (epoch, transport_type, endpoint)
+);
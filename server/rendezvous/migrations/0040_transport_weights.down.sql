@@ -0,0 +1,3 @@
+-- Migration: 0040_transport_weights.down.sql
+
+ALTER TABLE transports DROP COLUMN IF EXISTS weight;
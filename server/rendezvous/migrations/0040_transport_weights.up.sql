@@ -0,0 +1,7 @@
+-- LumenLink Transport Weights
+-- Migration: 0040_transport_weights.up.sql
+-- Description: A weight per transport row, sent in packs with the priority
+-- so clients can spread their attempts among transports of equal priority.
+
+ALTER TABLE transports
+    ADD COLUMN weight INTEGER NOT NULL DEFAULT 1 CHECK (weight > 0);
@@ -0,0 +1,11 @@
+-- LumenLink Country Region Overrides
+-- Migration: 0042_country_region_overrides.up.sql
+-- Description: Regions assigned to countries in place of the table built
+-- into the server. Servers reload the rows periodically
+-- (LUMENLINK_COUNTRY_REGION_REFRESH_INTERVAL).
+
+CREATE TABLE country_region_overrides (
+    country CHAR(2) PRIMARY KEY CHECK (country ~ '^[A-Z]{2}$'),
+    region VARCHAR(50) NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
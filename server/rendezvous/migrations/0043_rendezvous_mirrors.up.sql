@@ -0,0 +1,18 @@
+-- LumenLink Rendezvous Mirrors
+-- Migration: 0043_rendezvous_mirrors.up.sql
+-- Description: Alternate rendezvous endpoints listed in signed packs, global
+-- or per region, so clients can still refresh their config when this
+-- endpoint is blocked
+
+CREATE TABLE rendezvous_mirrors (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL CHECK (url LIKE 'https://%'),
+    region VARCHAR(50), -- NULL for every region
+    priority INTEGER NOT NULL DEFAULT 0, -- Higher first in packs
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+-- One row per mirror globally and per region
+CREATE UNIQUE INDEX idx_rendezvous_mirrors_url_region ON rendezvous_mirrors (url, COALESCE(region, ''));
@@ -0,0 +1,3 @@
+-- Migration: 0044_regions.down.sql
+
+DROP TABLE IF EXISTS regions;
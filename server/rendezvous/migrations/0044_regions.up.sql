@@ -0,0 +1,25 @@
+-- LumenLink Regions
+-- Migration: 0044_regions.up.sql
+-- Description: Where each infrastructure region is, so clients and regions
+-- without gateways are sent to the nearest available region by distance.
+-- Regions without a row fall back to the built-in preference order.
+
+CREATE TABLE regions (
+    name VARCHAR(50) PRIMARY KEY,
+    latitude DOUBLE PRECISION NOT NULL CHECK (latitude BETWEEN -90 AND 90),
+    longitude DOUBLE PRECISION NOT NULL CHECK (longitude BETWEEN -180 AND 180),
+    created_at TIMESTAMPTZ DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW() NOT NULL
+);
+
+INSERT INTO regions (name, latitude, longitude) VALUES
+    ('us-east-1', 38.95, -77.45),      -- Northern Virginia
+    ('us-west-1', 37.35, -121.96),     -- Northern California
+    ('eu-west-1', 53.35, -6.26),       -- Dublin
+    ('eu-central-1', 50.11, 8.68),     -- Frankfurt
+    ('me-south-1', 26.07, 50.56),      -- Bahrain
+    ('ap-east-1', 22.32, 114.17),      -- Hong Kong
+    ('ap-southeast-1', 1.35, 103.82),  -- Singapore
+    ('ap-south-1', 19.08, 72.88),      -- Mumbai
+    ('af-south-1', -33.92, 18.42),     -- Cape Town
+    ('sa-east-1', -23.55, -46.63);     -- Sao Paulo